@@ -1,9 +1,13 @@
 package client
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,3 +23,25 @@ func TestEncodeLabelerHeader(t *testing.T) {
 	assert.Equal("did:web:aaa.example.com;redact,did:web:bbb.example.com", encodeLabelerHeader([]syntax.DID{labelerA}, []syntax.DID{labelerB}))
 	assert.Equal("did:web:aaa.example.com;redact", encodeLabelerHeader([]syntax.DID{labelerA}, nil))
 }
+
+func TestLexDoStream(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"repos": [{"did": "did:plc:aaa"}, {"did": "did:plc:bbb"}], "cursor": "2"}`))
+	}))
+	defer srv.Close()
+	c := NewAPIClient(srv.URL)
+
+	type repo struct {
+		Did string `json:"did"`
+	}
+	var dids []string
+	cursor, err := lexutil.StreamQuery(context.Background(), c, "com.atproto.sync.listRepos", nil, "repos", func(r *repo) error {
+		dids = append(dids, r.Did)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal("2", cursor)
+	assert.Equal([]string{"did:plc:aaa", "did:plc:bbb"}, dids)
+}
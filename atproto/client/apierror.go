@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"net/http"
 )
 
 type APIError struct {
@@ -22,6 +23,11 @@ func (ae *APIError) Error() string {
 	return "API request failed"
 }
 
+// IsThrottled returns true if the request was rate limited
+func (ae *APIError) IsThrottled() bool {
+	return ae.StatusCode == http.StatusTooManyRequests
+}
+
 type ErrorBody struct {
 	Name    string `json:"error"`
 	Message string `json:"message,omitempty"`
@@ -10,6 +10,11 @@ import (
 	"github.com/bluesky-social/indigo/atproto/syntax"
 )
 
+// streamDecoder is [github.com/bluesky-social/indigo/lex/util.StreamDecoder]: an output which decodes the response body as it is read
+type streamDecoder interface {
+	DecodeStream(r io.Reader) error
+}
+
 // Implements the [github.com/bluesky-social/indigo/lex/util.LexClient] interface, for use with code-generated API helpers.
 func (c *APIClient) LexDo(ctx context.Context, method string, inputEncoding string, endpoint string, params map[string]any, bodyData any, out any) error {
 	// some of the code here is copied from indigo:xrpc/xrpc.go
@@ -82,6 +87,10 @@ func (c *APIClient) LexDo(ctx context.Context, method string, inputEncoding stri
 				return fmt.Errorf("reading length delimited response body (%d < %d): %w", n, resp.ContentLength, err)
 			}
 		}
+	} else if sd, ok := out.(streamDecoder); ok {
+		if err := sd.DecodeStream(resp.Body); err != nil {
+			return fmt.Errorf("failed decoding JSON response body: %w", err)
+		}
 	} else {
 		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 			return fmt.Errorf("failed decoding JSON response body: %w", err)
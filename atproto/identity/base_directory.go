@@ -23,6 +23,8 @@ type BaseDirectory struct {
 	HTTPClient http.Client
 	// DNS resolver used for DNS handle resolution. Calling code can use a custom Dialer to query against a specific DNS server, or re-implement the interface for even more control over the resolution process
 	Resolver net.Resolver
+	// if not nil, handle TXT lookups go to these DNS-over-HTTPS endpoints instead of Resolver. To keep all resolution traffic within the DoH endpoints, leave TryAuthoritativeDNS and FallbackDNSServers unset, and the DoH resolver's own Fallback nil
+	DoH *DoHResolver
 	// when doing DNS handle resolution, should this resolver attempt re-try against an authoritative nameserver if the first TXT lookup fails?
 	TryAuthoritativeDNS bool
 	// set of handle domain suffixes for for which DNS handle resolution will be skipped
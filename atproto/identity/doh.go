@@ -0,0 +1,168 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DoH endpoints of CIRA's Canadian Shield resolvers. "Private" only resolves; "Protect" also blocks malware and phishing domains.
+const (
+	CanadianShieldPrivateDoH = "https://private.canadianshield.cira.ca/dns-query"
+	CanadianShieldProtectDoH = "https://protected.canadianshield.cira.ca/dns-query"
+)
+
+// maximum size of a DoH response body
+const dohMaxResponse = 64 << 10
+
+// DoHResolver looks up DNS TXT records with DNS-over-HTTPS (RFC 8484), so resolution traffic stays within a set of approved resolvers.
+//
+// Endpoints are tried in order. If all of them fail (as opposed to answering that the name doesn't exist), the Fallback resolver is used, if set.
+type DoHResolver struct {
+	// full URLs of DoH endpoints, eg CanadianShieldPrivateDoH
+	Endpoints []string
+	// HTTP client used for DoH requests; nil uses a client with a 5 second timeout
+	HTTPClient *http.Client
+	// resolver used if all endpoints fail, eg to fail over to system DNS; nil disables failover
+	Fallback *net.Resolver
+}
+
+// NewDoHResolver returns a resolver for the given endpoints, failing over to system DNS.
+func NewDoHResolver(endpoints []string) *DoHResolver {
+	return &DoHResolver{
+		Endpoints: endpoints,
+		Fallback:  net.DefaultResolver,
+	}
+}
+
+// LookupTXT returns the TXT records for a name. As with net.Resolver, a name which doesn't exist or has no TXT records results in a *net.DNSError with IsNotFound set.
+func (r *DoHResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	query, err := buildTXTQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, endpoint := range r.Endpoints {
+		start := time.Now()
+		var res []string
+		raw, err := r.exchange(ctx, endpoint, query)
+		if err == nil {
+			res, err = parseTXTAnswer(raw, name)
+		}
+		var dnsErr *net.DNSError
+		switch {
+		case err == nil:
+			dohLookups.WithLabelValues("success").Inc()
+			dohLookupDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+			return res, nil
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			dohLookups.WithLabelValues("notfound").Inc()
+			dohLookupDuration.WithLabelValues("notfound").Observe(time.Since(start).Seconds())
+			return nil, err
+		}
+		dohLookups.WithLabelValues("error").Inc()
+		dohLookupDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no DoH endpoints configured"))
+	}
+	err = errors.Join(errs...)
+	if r.Fallback == nil {
+		return nil, err
+	}
+	slog.Warn("DoH lookup failed, falling back to system DNS", "name", name, "err", err)
+	dohLookups.WithLabelValues("fallback").Inc()
+	return r.Fallback.LookupTXT(ctx, name)
+}
+
+func (r *DoHResolver) exchange(ctx context.Context, endpoint string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	client := r.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH request failed: HTTP status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/dns-message") {
+		return nil, fmt.Errorf("DoH request failed: unexpected content type %q", ct)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, dohMaxResponse))
+}
+
+// buildTXTQuery encodes a recursive TXT query. The ID is zero, as recommended for DoH so responses are cacheable.
+func buildTXTQuery(name string) ([]byte, error) {
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS name %q: %w", name, err)
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  dnsmessage.TypeTXT,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// parseTXTAnswer decodes the TXT records from a DNS response for name. Each record's strings are concatenated, as net.Resolver does.
+func parseTXTAnswer(raw []byte, name string) ([]string, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(raw); err != nil {
+		return nil, fmt.Errorf("invalid DNS response: %w", err)
+	}
+	switch msg.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: "DNS server failure: " + msg.Header.RCode.String(), Name: name, IsTemporary: true}
+	}
+
+	var out []string
+	for _, ans := range msg.Answers {
+		// any CNAME chain has already been followed by the recursive resolver
+		txt, ok := ans.Body.(*dnsmessage.TXTResource)
+		if !ok {
+			continue
+		}
+		out = append(out, strings.Join(txt.TXT, ""))
+	}
+	if len(out) == 0 {
+		return nil, &net.DNSError{Err: "no TXT records", Name: name, IsNotFound: true}
+	}
+	return out, nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,81 @@
+package identity
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohServer answers TXT queries from a fixed table, with NXDOMAIN for anything else
+func dohServer(t *testing.T, records map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q dnsmessage.Message
+		if err := q.Unpack(body); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: q.Questions,
+		}
+		txt, ok := records[q.Questions[0].Name.String()]
+		if !ok {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		for _, s := range txt {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.TXTResource{TXT: []string{s}},
+			})
+		}
+		out, err := resp.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}))
+}
+
+func TestDoHResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := dohServer(t, map[string][]string{
+		"_atproto.handle.example.ca.": {"did=did:plc:abc123"},
+	})
+	defer srv.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", 503)
+	}))
+	defer broken.Close()
+
+	// a failing endpoint is skipped
+	r := &DoHResolver{Endpoints: []string{broken.URL, srv.URL}}
+	res, err := r.LookupTXT(ctx, "_atproto.handle.example.ca")
+	assert.NoError(err)
+	assert.Equal([]string{"did=did:plc:abc123"}, res)
+
+	dir := BaseDirectory{DoH: r}
+	did, err := dir.ResolveHandleDNS(ctx, syntax.Handle("handle.example.ca"))
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:plc:abc123"), did)
+	_, err = dir.ResolveHandleDNS(ctx, syntax.Handle("missing.example.ca"))
+	assert.ErrorIs(err, ErrHandleNotFound)
+
+	// all endpoints failing, without failover
+	r = &DoHResolver{Endpoints: []string{broken.URL}}
+	_, err = r.LookupTXT(ctx, "_atproto.handle.example.ca")
+	assert.Error(err)
+}
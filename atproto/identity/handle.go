@@ -30,7 +30,13 @@ func parseTXTResp(res []string) (syntax.DID, error) {
 
 // Does not cross-verify, only does the handle resolution step.
 func (d *BaseDirectory) ResolveHandleDNS(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
-	res, err := d.Resolver.LookupTXT(ctx, "_atproto."+handle.String())
+	var res []string
+	var err error
+	if d.DoH != nil {
+		res, err = d.DoH.LookupTXT(ctx, "_atproto."+handle.String())
+	} else {
+		res, err = d.Resolver.LookupTXT(ctx, "_atproto."+handle.String())
+	}
 	// check for NXDOMAIN
 	var dnsErr *net.DNSError
 	if errors.As(err, &dnsErr) {
@@ -26,3 +26,14 @@ var didResolutionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Help:    "Time to resolve a DID",
 	Buckets: prometheus.ExponentialBucketsRange(0.001, 2, 15),
 }, []string{"directory", "status"})
+
+var dohLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "atproto_identity_doh_lookups",
+	Help: "DNS-over-HTTPS TXT lookups, by outcome (fallback counts failovers to system DNS)",
+}, []string{"status"})
+
+var dohLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "atproto_identity_doh_lookup_duration",
+	Help:    "Time to look up a TXT record from a DNS-over-HTTPS endpoint",
+	Buckets: prometheus.ExponentialBucketsRange(0.001, 2, 15),
+}, []string{"status"})
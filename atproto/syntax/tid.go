@@ -118,7 +118,9 @@ func (t *TID) UnmarshalText(text []byte) error {
 //
 // Uses [sync.Mutex], so may block briefly but safe for concurrent use.
 type TIDClock struct {
-	ClockID       uint
+	ClockID uint
+	// source of the current time; if nil, [time.Now] is used. Deterministic tests can set this to a simulated clock
+	Now           func() time.Time
 	mtx           sync.Mutex
 	lastUnixMicro int64
 }
@@ -139,7 +141,11 @@ func ClockFromTID(t TID) TIDClock {
 }
 
 func (c *TIDClock) Next() TID {
-	now := time.Now().UTC().UnixMicro()
+	nowFn := c.Now
+	if nowFn == nil {
+		nowFn = time.Now
+	}
+	now := nowFn().UTC().UnixMicro()
 	c.mtx.Lock()
 	if now <= c.lastUnixMicro {
 		now = c.lastUnixMicro + 1
@@ -129,3 +129,15 @@ func TestTIDClock(t *testing.T) {
 		last = next
 	}
 }
+
+func TestTIDClockNow(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewTIDClock(7)
+	clk.Now = func() time.Time { return ts }
+	first := clk.Next()
+	assert.Equal(NewTIDFromTime(ts, 7), first)
+	// a stopped clock still yields increasing TIDs
+	assert.Equal(ts.Add(time.Microsecond), clk.Next().Time())
+}
@@ -0,0 +1,33 @@
+package rules
+
+import (
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/keyword"
+)
+
+// name of the set holding DIDs of organizations verified by the relay's registry
+const VerifiedOrgsSet = "verified-orgs"
+
+// keeps the "org-verified" account label in sync with the verified organization registry. Only enable this rule when the "verified-orgs" set is populated, or existing labels will be removed.
+func VerifiedOrgIdentityRule(c *automod.AccountContext) error {
+	if c.Account.Identity == nil {
+		return nil
+	}
+	labeled := keyword.TokenInSet("org-verified", c.Account.AccountLabels)
+	verified := c.InSet(VerifiedOrgsSet, c.Account.Identity.DID.String())
+	if verified && !labeled {
+		c.AddAccountLabel("org-verified")
+	} else if labeled && !verified {
+		c.RemoveAccountLabel("org-verified")
+	}
+	return nil
+}
+
+var _ automod.IdentityRuleFunc = VerifiedOrgIdentityRule
+
+// same as VerifiedOrgIdentityRule, but run on record events so newly verified organizations get labeled without waiting for an identity change
+func VerifiedOrgRecordRule(c *automod.RecordContext) error {
+	return VerifiedOrgIdentityRule(&c.AccountContext)
+}
+
+var _ automod.RecordRuleFunc = VerifiedOrgRecordRule
@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/setstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifiedOrgIdentityRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := engine.EngineTestFixture()
+	sets := setstore.NewMemSetStore()
+	sets.Sets[VerifiedOrgsSet] = map[string]bool{"did:plc:gov111": true}
+	eng.Sets = sets
+
+	am1 := automod.AccountMeta{
+		Identity: &identity.Identity{
+			DID:    syntax.DID("did:plc:gov111"),
+			Handle: syntax.Handle("canada.ca"),
+		},
+	}
+	c1 := engine.NewAccountContext(ctx, &eng, am1)
+	assert.NoError(VerifiedOrgIdentityRule(&c1))
+	eff1 := engine.ExtractEffects(&c1.BaseContext)
+	assert.Equal([]string{"org-verified"}, eff1.AccountLabels)
+
+	// already labeled: nothing to do
+	am1.AccountLabels = []string{"org-verified"}
+	c2 := engine.NewAccountContext(ctx, &eng, am1)
+	assert.NoError(VerifiedOrgIdentityRule(&c2))
+	eff2 := engine.ExtractEffects(&c2.BaseContext)
+	assert.Empty(eff2.AccountLabels)
+	assert.Empty(eff2.RemovedAccountLabels)
+
+	// verification revoked
+	am2 := automod.AccountMeta{
+		Identity: &identity.Identity{
+			DID:    syntax.DID("did:plc:abc111"),
+			Handle: syntax.Handle("handle.example.com"),
+		},
+		AccountLabels: []string{"org-verified"},
+	}
+	c3 := engine.NewAccountContext(ctx, &eng, am2)
+	assert.NoError(VerifiedOrgIdentityRule(&c3))
+	eff3 := engine.ExtractEffects(&c3.BaseContext)
+	assert.Equal([]string{"org-verified"}, eff3.RemovedAccountLabels)
+}
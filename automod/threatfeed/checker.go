@@ -0,0 +1,145 @@
+package threatfeed
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/enrich"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// DefaultLabel is applied to records linking to a known threat, unless the feed configures its own.
+const DefaultLabel = "threat-link"
+
+// Match identifies the feed entry a link matched.
+type Match struct {
+	Feed  string
+	Label string
+	// the matching indicator: a normalized URL or domain
+	Indicator string
+}
+
+// Checker matches links against the indicators of a set of feeds.
+type Checker struct {
+	Feeds  []Feed
+	Client *http.Client
+	Label  string
+	Logger *slog.Logger
+
+	lk    sync.RWMutex
+	feeds map[string]*indicators
+	// link verdicts; a nil Match means "no match". Purged whenever indicators change.
+	cache *expirable.LRU[string, *Match]
+}
+
+func NewChecker(feeds []Feed, client *http.Client, logger *slog.Logger) *Checker {
+	return &Checker{
+		Feeds:  feeds,
+		Client: client,
+		Label:  DefaultLabel,
+		Logger: logger,
+		feeds:  make(map[string]*indicators),
+		cache:  expirable.NewLRU[string, *Match](50_000, nil, 6*time.Hour),
+	}
+}
+
+// Refresh downloads every feed. A feed which fails to download keeps its previously loaded indicators.
+func (ch *Checker) Refresh(ctx context.Context) error {
+	var firstErr error
+	for _, f := range ch.Feeds {
+		ind, err := fetchFeed(ctx, ch.Client, f)
+		if err != nil {
+			feedRefreshCount.WithLabelValues(f.Name, "error").Inc()
+			ch.Logger.Warn("failed to refresh threat feed", "feed", f.Name, "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		feedRefreshCount.WithLabelValues(f.Name, "ok").Inc()
+		feedIndicators.WithLabelValues(f.Name).Set(float64(ind.size()))
+		ch.setFeed(f.Name, ind)
+	}
+	return firstErr
+}
+
+func (ch *Checker) setFeed(name string, ind *indicators) {
+	ch.lk.Lock()
+	ch.feeds[name] = ind
+	ch.lk.Unlock()
+	ch.cache.Purge()
+}
+
+// Run refreshes the feeds immediately, then on the given interval, until the context is cancelled.
+func (ch *Checker) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		_ = ch.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Check returns the first feed entry the link matches, if any. Links are normalized first; a domain indicator matches the domain itself and all of its subdomains.
+func (ch *Checker) Check(raw string) *Match {
+	l, ok := enrich.NormalizeLink(raw)
+	if !ok {
+		return nil
+	}
+	if m, ok := ch.cache.Get(l.URL); ok {
+		return m
+	}
+
+	var m *Match
+	ch.lk.RLock()
+	for _, f := range ch.Feeds {
+		ind := ch.feeds[f.Name]
+		if ind == nil {
+			continue
+		}
+		if ind.urls[l.URL] {
+			m = &Match{Feed: f.Name, Label: ch.label(f), Indicator: l.URL}
+			break
+		}
+		if d := matchDomain(ind.domains, l.Domain); d != "" {
+			m = &Match{Feed: f.Name, Label: ch.label(f), Indicator: d}
+			break
+		}
+	}
+	ch.lk.RUnlock()
+
+	ch.cache.Add(l.URL, m)
+	return m
+}
+
+func (ch *Checker) label(f Feed) string {
+	if f.Label != "" {
+		return f.Label
+	}
+	return ch.Label
+}
+
+// matchDomain returns the domain or the closest parent domain in the set
+func matchDomain(domains map[string]bool, domain string) string {
+	domain = strings.TrimPrefix(domain, "www.")
+	for domain != "" {
+		if domains[domain] {
+			return domain
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	return ""
+}
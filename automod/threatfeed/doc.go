@@ -0,0 +1,4 @@
+// automod helpers for checking links against operator-configured threat intelligence feeds (eg, lists published by the Canadian Centre for Cyber Security).
+//
+// Feeds are plain-text (or CSV, first column) lists of malicious domains and URLs, fetched over HTTP and refreshed in the background on a schedule; rules only ever consult the most recently loaded indicators, and never wait on a feed download. Per-link verdicts are cached until the next refresh. Matching links get a warning label on the record and a moderation report naming the feed.
+package threatfeed
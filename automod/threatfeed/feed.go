@@ -0,0 +1,103 @@
+package threatfeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty/enrich"
+)
+
+// Feed is a single threat intelligence list.
+type Feed struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// label applied to records linking to an indicator on this feed; empty uses the checker default
+	Label string `json:"label,omitempty"`
+}
+
+// LoadFeedsJSON reads a list of feed configurations from a JSON file.
+func LoadFeedsJSON(p string) ([]Feed, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var feeds []Feed
+	if err := json.Unmarshal(raw, &feeds); err != nil {
+		return nil, fmt.Errorf("parsing threat feed config: %w", err)
+	}
+	for _, f := range feeds {
+		if f.Name == "" || f.URL == "" {
+			return nil, fmt.Errorf("threat feed config entries need a name and URL")
+		}
+	}
+	return feeds, nil
+}
+
+// indicators is the parsed contents of one feed: normalized domains and URLs
+type indicators struct {
+	domains map[string]bool
+	urls    map[string]bool
+}
+
+func (ind *indicators) size() int {
+	return len(ind.domains) + len(ind.urls)
+}
+
+// fetchFeed downloads and parses a feed.
+func fetchFeed(ctx context.Context, client *http.Client, f Feed) (*indicators, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching threat feed %s: HTTP %d", f.Name, resp.StatusCode)
+	}
+	return parseFeed(resp.Body)
+}
+
+// parseFeed reads one indicator per line. Blank lines and '#' comments are skipped, and only the first column of CSV rows is used. Entries with a scheme are URLs; anything else is a domain, which also covers its subdomains.
+func parseFeed(r io.Reader) (*indicators, error) {
+	ind := &indicators{
+		domains: make(map[string]bool),
+		urls:    make(map[string]bool),
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if col, _, ok := strings.Cut(line, ","); ok {
+			line = strings.Trim(strings.TrimSpace(col), `"`)
+		}
+		// defanged indicators, as commonly published
+		line = strings.NewReplacer("[.]", ".", "hxxp", "http").Replace(line)
+		if strings.Contains(line, "://") {
+			if l, ok := enrich.NormalizeLink(line); ok {
+				ind.urls[l.URL] = true
+			}
+			continue
+		}
+		domain := strings.TrimSuffix(strings.ToLower(line), ".")
+		domain = strings.TrimPrefix(domain, "www.")
+		if domain != "" && !strings.ContainsAny(domain, " /") {
+			ind.domains[domain] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading threat feed: %w", err)
+	}
+	return ind, nil
+}
@@ -0,0 +1,21 @@
+package threatfeed
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var feedRefreshCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_threat_feed_refresh_count",
+	Help: "Number of threat feed downloads, by feed and result",
+}, []string{"feed", "result"})
+
+var feedIndicators = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "automod_threat_feed_indicators",
+	Help: "Number of indicators loaded from each threat feed",
+}, []string{"feed"})
+
+var linkMatchCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_threat_feed_link_match_count",
+	Help: "Number of records linking to a threat feed indicator, by feed",
+}, []string{"feed"})
@@ -0,0 +1,62 @@
+package threatfeed
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/helpers"
+	"github.com/bluesky-social/indigo/sovereignty/enrich"
+)
+
+// labels and reports posts linking (via facets or external embeds) to a threat feed indicator
+func (ch *Checker) ThreatLinkPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	e := enrich.Post(post)
+	ch.apply(c, e.URLs())
+	return nil
+}
+
+var _ automod.PostRuleFunc = (&Checker{}).ThreatLinkPostRule
+
+// labels and reports profiles with a threat feed indicator in their description or display name
+func (ch *Checker) ThreatLinkProfileRule(c *automod.RecordContext, profile *appbsky.ActorProfile) error {
+	var urls []string
+	for _, u := range helpers.ExtractTextURLsProfile(profile) {
+		if !strings.Contains(u, "://") {
+			u = "https://" + u
+		}
+		urls = append(urls, u)
+	}
+	ch.apply(c, urls)
+	return nil
+}
+
+var _ automod.ProfileRuleFunc = (&Checker{}).ThreatLinkProfileRule
+
+func (ch *Checker) apply(c *automod.RecordContext, urls []string) {
+	var matched []string
+	labeled := make(map[string]bool)
+	for _, u := range urls {
+		m := ch.Check(u)
+		if m == nil {
+			continue
+		}
+		desc := fmt.Sprintf("%s (%s)", m.Indicator, m.Feed)
+		if slices.Contains(matched, desc) {
+			continue
+		}
+		linkMatchCount.WithLabelValues(m.Feed).Inc()
+		c.Logger.Info("threat-feed-link", "feed", m.Feed, "indicator", m.Indicator)
+		matched = append(matched, desc)
+		if !labeled[m.Label] {
+			c.AddRecordLabel(m.Label)
+			labeled[m.Label] = true
+		}
+	}
+	if len(matched) > 0 {
+		// only one report per reason is filed for a record, so it lists every match
+		c.ReportRecord(automod.ReportReasonOther, "links to threat feed indicators: "+strings.Join(matched, ", "))
+	}
+}
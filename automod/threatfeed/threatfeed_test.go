@@ -0,0 +1,123 @@
+package threatfeed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleFeed = `# indicator,type,first_seen
+"phish.example.ca",domain,2024-01-01
+hxxps://bad[.]example/login?utm_source=mail,url,2024-01-02
+
+malware.example.
+`
+
+func TestParseFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	ind, err := parseFeed(strings.NewReader(exampleFeed))
+	assert.NoError(err)
+	assert.True(ind.domains["phish.example.ca"])
+	assert.True(ind.domains["malware.example"])
+	assert.True(ind.urls["https://bad.example/login"])
+	assert.Equal(3, ind.size())
+}
+
+func TestChecker(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	body := exampleFeed
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body == "" {
+			w.WriteHeader(500)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	ch := NewChecker([]Feed{{Name: "cccs", URL: srv.URL}}, srv.Client(), slog.Default())
+	assert.Nil(ch.Check("https://phish.example.ca"))
+	assert.NoError(ch.Refresh(ctx))
+
+	m := ch.Check("https://login.phish.example.ca/account")
+	assert.NotNil(m)
+	assert.Equal("cccs", m.Feed)
+	assert.Equal(DefaultLabel, m.Label)
+	assert.Equal("phish.example.ca", m.Indicator)
+	assert.NotNil(ch.Check("https://WWW.bad.example/login#form"))
+	assert.Nil(ch.Check("https://bad.example/"))
+	assert.Nil(ch.Check("https://example.ca/"))
+
+	// a failed download keeps the previous indicators
+	body = ""
+	assert.Error(ch.Refresh(ctx))
+	assert.NotNil(ch.Check("https://phish.example.ca"))
+
+	// cached verdicts don't outlive a refresh
+	body = "other.example\n"
+	assert.NoError(ch.Refresh(ctx))
+	assert.Nil(ch.Check("https://phish.example.ca"))
+	assert.NotNil(ch.Check("http://other.example"))
+}
+
+func TestThreatLinkPostRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	ch := NewChecker([]Feed{{Name: "cccs"}, {Name: "local", Label: "phishing"}}, nil, slog.Default())
+	ch.setFeed("cccs", &indicators{domains: map[string]bool{"phish.example.ca": true}, urls: map[string]bool{}})
+	ch.setFeed("local", &indicators{domains: map[string]bool{"phish.example.ca": true, "scam.example": true}, urls: map[string]bool{}})
+
+	eng := engine.EngineTestFixture()
+	am := automod.AccountMeta{Identity: &identity.Identity{DID: syntax.DID("did:plc:abc111"), Handle: syntax.Handle("handle.example.com")}}
+	op := engine.RecordOp{
+		Action:     engine.CreateOp,
+		DID:        am.Identity.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+	}
+	post := &appbsky.FeedPost{
+		Text: "win a prize",
+		Facets: []*appbsky.RichtextFacet{{
+			Features: []*appbsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Link: &appbsky.RichtextFacet_Link{Uri: "https://phish.example.ca/prize"}},
+				{RichtextFacet_Link: &appbsky.RichtextFacet_Link{Uri: "https://phish.example.ca/other"}},
+			},
+		}},
+		Embed: &appbsky.FeedPost_Embed{
+			EmbedExternal: &appbsky.EmbedExternal{External: &appbsky.EmbedExternal_External{Uri: "https://scam.example"}},
+		},
+	}
+
+	c := engine.NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(ch.ThreatLinkPostRule(&c, post))
+	eff := engine.ExtractEffects(&c.BaseContext)
+	assert.Equal([]string{DefaultLabel, "phishing"}, eff.RecordLabels)
+	assert.Len(eff.RecordReports, 1)
+	assert.Contains(eff.RecordReports[0].Comment, "scam.example (local)")
+
+	profile := &appbsky.ActorProfile{Description: strPtr("visit scam.example today")}
+	c = engine.NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(ch.ThreatLinkProfileRule(&c, profile))
+	eff = engine.ExtractEffects(&c.BaseContext)
+	assert.Equal([]string{"phishing"}, eff.RecordLabels)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
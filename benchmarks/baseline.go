@@ -0,0 +1,126 @@
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"testing"
+)
+
+// DefaultThreshold is the allowed slowdown, as a fraction of the baseline, for benchmarks without their own threshold.
+const DefaultThreshold = 0.25
+
+// Result is one benchmark's recorded performance.
+type Result struct {
+	NsPerOp     float64 `json:"nsPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+	// allowed regression for this benchmark, as a fraction of the baseline; zero uses the baseline's default
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// NewResult converts a benchmark run to a Result.
+func NewResult(r testing.BenchmarkResult) Result {
+	res := Result{
+		AllocsPerOp: r.AllocsPerOp(),
+		BytesPerOp:  r.AllocedBytesPerOp(),
+	}
+	if r.N > 0 {
+		res.NsPerOp = math.Round(float64(r.T.Nanoseconds()) / float64(r.N))
+	}
+	return res
+}
+
+// Baseline is a set of recorded results, keyed by benchmark name.
+type Baseline struct {
+	// default allowed regression, as a fraction; zero uses DefaultThreshold
+	Threshold  float64           `json:"threshold,omitempty"`
+	Benchmarks map[string]Result `json:"benchmarks"`
+}
+
+// LoadBaseline reads a baseline file. A missing file is an empty baseline.
+func LoadBaseline(fname string) (*Baseline, error) {
+	bl := &Baseline{Benchmarks: make(map[string]Result)}
+	b, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return bl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, bl); err != nil {
+		return nil, fmt.Errorf("parsing benchmark baseline: %w", err)
+	}
+	if bl.Benchmarks == nil {
+		bl.Benchmarks = make(map[string]Result)
+	}
+	return bl, nil
+}
+
+// Save writes the baseline as indented JSON.
+func (bl *Baseline) Save(fname string) error {
+	b, err := json.MarshalIndent(bl, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, append(b, '\n'), 0644)
+}
+
+// Record replaces the baseline result for a benchmark, keeping any per-benchmark threshold.
+func (bl *Baseline) Record(name string, r Result) {
+	r.Threshold = bl.Benchmarks[name].Threshold
+	bl.Benchmarks[name] = r
+}
+
+// Regression describes a benchmark which got worse than its baseline allows.
+type Regression struct {
+	Name     string
+	Metric   string
+	Baseline float64
+	Current  float64
+	// allowed fraction over the baseline
+	Threshold float64
+}
+
+func (r Regression) String() string {
+	if r.Baseline == 0 {
+		return fmt.Sprintf("%s: %s regressed from 0 to %.0f", r.Name, r.Metric, r.Current)
+	}
+	return fmt.Sprintf("%s: %s regressed from %.0f to %.0f (+%.1f%%, threshold %.0f%%)", r.Name, r.Metric, r.Baseline, r.Current, (r.Current/r.Baseline-1)*100, r.Threshold*100)
+}
+
+// Compare checks results against the baseline: time and allocations per op may each exceed the baseline by the threshold. If override is positive it replaces all thresholds. Benchmarks missing from the baseline are ignored.
+func (bl *Baseline) Compare(results map[string]Result, override float64) []Regression {
+	var out []Regression
+	for name, cur := range results {
+		base, ok := bl.Benchmarks[name]
+		if !ok {
+			continue
+		}
+		threshold := override
+		if threshold <= 0 {
+			threshold = base.Threshold
+		}
+		if threshold <= 0 {
+			threshold = bl.Threshold
+		}
+		if threshold <= 0 {
+			threshold = DefaultThreshold
+		}
+		if base.NsPerOp > 0 && cur.NsPerOp > base.NsPerOp*(1+threshold) {
+			out = append(out, Regression{Name: name, Metric: "ns/op", Baseline: base.NsPerOp, Current: cur.NsPerOp, Threshold: threshold})
+		}
+		if float64(cur.AllocsPerOp) > float64(base.AllocsPerOp)*(1+threshold) {
+			out = append(out, Regression{Name: name, Metric: "allocs/op", Baseline: float64(base.AllocsPerOp), Current: float64(cur.AllocsPerOp), Threshold: threshold})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	return out
+}
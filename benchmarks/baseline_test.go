@@ -0,0 +1,52 @@
+package benchmarks
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	fname := filepath.Join(t.TempDir(), "baseline.json")
+	bl, err := LoadBaseline(fname)
+	assert.NoError(err)
+	assert.Empty(bl.Benchmarks)
+
+	bl.Threshold = 0.1
+	bl.Record("Fast", Result{NsPerOp: 100, AllocsPerOp: 10})
+	bl.Benchmarks["Loose"] = Result{NsPerOp: 100, AllocsPerOp: 10, Threshold: 1}
+	bl.Record("Loose", Result{NsPerOp: 100, AllocsPerOp: 10})
+	assert.NoError(bl.Save(fname))
+
+	bl, err = LoadBaseline(fname)
+	assert.NoError(err)
+	assert.Equal(1.0, bl.Benchmarks["Loose"].Threshold)
+
+	results := map[string]Result{
+		"Fast":  {NsPerOp: 115, AllocsPerOp: 12},
+		"Loose": {NsPerOp: 190, AllocsPerOp: 10},
+		"New":   {NsPerOp: 1e9},
+	}
+	regs := bl.Compare(results, 0)
+	if assert.Len(regs, 2) {
+		assert.Equal("Fast", regs[0].Name)
+		assert.Equal("allocs/op", regs[0].Metric)
+		assert.Equal("ns/op", regs[1].Metric)
+		assert.Equal(0.1, regs[1].Threshold)
+	}
+
+	// allocating where the baseline didn't is always a regression
+	bl.Record("Zero", Result{NsPerOp: 100})
+	regs = bl.Compare(map[string]Result{"Zero": {NsPerOp: 100, AllocsPerOp: 1}}, 0)
+	if assert.Len(regs, 1) {
+		assert.Equal("Zero: allocs/op regressed from 0 to 1", regs[0].String())
+	}
+	delete(bl.Benchmarks, "Zero")
+
+	// an override replaces every threshold
+	assert.Empty(bl.Compare(results, 0.95))
+	assert.Len(bl.Compare(results, 0.05), 3)
+}
@@ -0,0 +1,258 @@
+package benchmarks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/diskpersist"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const baselineFile = "baseline.json"
+
+var suite = []struct {
+	name string
+	fn   func(b *testing.B)
+}{
+	{"FilterHotPath", benchFilterHotPath},
+	{"FrameEncode", benchFrameEncode},
+	{"FrameDecode", benchFrameDecode},
+	{"PersisterWrite", benchPersisterWrite},
+	{"BroadcastFanout", benchBroadcastFanout},
+}
+
+func BenchmarkFilterHotPath(b *testing.B)   { benchFilterHotPath(b) }
+func BenchmarkFrameEncode(b *testing.B)     { benchFrameEncode(b) }
+func BenchmarkFrameDecode(b *testing.B)     { benchFrameDecode(b) }
+func BenchmarkPersisterWrite(b *testing.B)  { benchPersisterWrite(b) }
+func BenchmarkBroadcastFanout(b *testing.B) { benchBroadcastFanout(b) }
+
+// TestRegressions runs the suite and compares it to the recorded baseline. It only runs when asked to, as results depend on the machine: set BENCH_CHECK=1 to check (optionally with BENCH_THRESHOLD, a fraction, overriding all thresholds), or BENCH_UPDATE=1 to record a new baseline.
+func TestRegressions(t *testing.T) {
+	update := os.Getenv("BENCH_UPDATE") != ""
+	if os.Getenv("BENCH_CHECK") == "" && !update {
+		t.Skip("set BENCH_CHECK=1 to check for benchmark regressions, or BENCH_UPDATE=1 to record a baseline")
+	}
+	var override float64
+	if v := os.Getenv("BENCH_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			t.Fatalf("invalid BENCH_THRESHOLD: %s", err)
+		}
+		override = f
+	}
+
+	bl, err := LoadBaseline(baselineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]Result)
+	for _, c := range suite {
+		r := NewResult(testing.Benchmark(c.fn))
+		if r.NsPerOp == 0 {
+			t.Fatalf("benchmark %s failed", c.name)
+		}
+		t.Logf("%-16s %12.0f ns/op %8d B/op %6d allocs/op", c.name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+		results[c.name] = r
+	}
+
+	if update {
+		for name, r := range results {
+			bl.Record(name, r)
+		}
+		if err := bl.Save(baselineFile); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	for name := range results {
+		if _, ok := bl.Benchmarks[name]; !ok {
+			t.Logf("%s has no baseline; run with BENCH_UPDATE=1 to record one", name)
+		}
+	}
+	for _, reg := range bl.Compare(results, override) {
+		t.Error(reg)
+	}
+}
+
+func referenceEvent(b *testing.B) *events.XRPCStreamEvent {
+	commit, err := ReferenceCommit()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return &events.XRPCStreamEvent{RepoCommit: commit}
+}
+
+// freshEvent copies an event, without any cached serialization, so each op does the full work
+func freshEvent(evt *events.XRPCStreamEvent) *events.XRPCStreamEvent {
+	commit := *evt.RepoCommit
+	return &events.XRPCStreamEvent{RepoCommit: &commit}
+}
+
+// benchFilterHotPath mirrors the sovereign stream filter: priority check, classification lookup, then the country and ramp checks
+func benchFilterHotPath(b *testing.B) {
+	table := sovereignty.NewTable()
+	var entries []sovereignty.Classification
+	for i := 0; i < 100_000; i++ {
+		country := "CA"
+		if i%2 == 1 {
+			country = "US"
+		}
+		entries = append(entries, sovereignty.Classification{DID: fmt.Sprintf("did:plc:bench%07d", i), Country: country})
+	}
+	table.Replace(entries)
+	reg := priority.NewRegistry()
+	for i := 0; i < 100; i++ {
+		reg.Set(priority.Account{DID: fmt.Sprintf("did:plc:priority%03d", i), Category: priority.CategoryEmergency})
+	}
+	countries := map[string]bool{"CA": true}
+
+	// a mix of classified, unclassified and priority accounts
+	dids := make([]string, 1024)
+	for i := range dids {
+		switch i % 8 {
+		case 0:
+			dids[i] = fmt.Sprintf("did:plc:priority%03d", i%100)
+		case 1:
+			dids[i] = fmt.Sprintf("did:plc:unknown%04d", i)
+		default:
+			dids[i] = fmt.Sprintf("did:plc:bench%07d", i*97)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var carried int
+	for i := 0; i < b.N; i++ {
+		did := dids[i%len(dids)]
+		if reg.IsPriority(did) {
+			carried++
+			continue
+		}
+		cl, ok := table.Get(did)
+		if ok && countries[cl.Country] && policy.Covers(did, 50) {
+			carried++
+		}
+	}
+	if carried == 0 {
+		b.Fatal("filter carried nothing")
+	}
+}
+
+func benchFrameEncode(b *testing.B) {
+	evt := referenceEvent(b)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := evt.Serialize(&buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchFrameDecode(b *testing.B) {
+	var buf bytes.Buffer
+	if err := referenceEvent(b).Serialize(&buf); err != nil {
+		b.Fatal(err)
+	}
+	frame := buf.Bytes()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out events.XRPCStreamEvent
+		if err := out.Deserialize(bytes.NewReader(frame)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchPersisterWrite(b *testing.B) {
+	dir := b.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "bench.sqlite")))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ActorInfo{}); err != nil {
+		b.Fatal(err)
+	}
+	evt := referenceEvent(b)
+	if err := db.Create(&models.ActorInfo{Uid: 1, Did: evt.RepoCommit.Repo}).Error; err != nil {
+		b.Fatal(err)
+	}
+	opts := diskpersist.DefaultDiskPersistOptions()
+	dp, err := diskpersist.NewDiskPersistence(filepath.Join(dir, "primary"), "", db, opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+	ctx := context.Background()
+	defer dp.Shutdown(ctx)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dp.Persist(ctx, freshEvent(evt)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := dp.Flush(ctx); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchBroadcastFanout measures delivering each event to 16 subscribers, through the event manager
+func benchBroadcastFanout(b *testing.B) {
+	const subscribers = 16
+	em := events.NewEventManager(events.NewMemPersister())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var cleanups []func()
+	for i := 0; i < subscribers; i++ {
+		ch, cleanup, err := em.Subscribe(ctx, fmt.Sprintf("bench-%d", i), func(*events.XRPCStreamEvent) bool { return true }, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		cleanups = append(cleanups, cleanup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < b.N; n++ {
+				if evt, ok := <-ch; !ok || evt.Error != nil {
+					return
+				}
+			}
+		}()
+	}
+	evt := referenceEvent(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := em.AddEvent(ctx, freshEvent(evt)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	wg.Wait()
+	b.StopTimer()
+	for _, c := range cleanups {
+		c()
+	}
+}
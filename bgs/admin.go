@@ -79,7 +79,7 @@ func (bgs *BGS) handleAdminTakeDownRepo(e echo.Context) error {
 		}
 	}
 
-	err := bgs.TakeDownRepo(ctx, did)
+	conflict, err := bgs.TakeDownRepo(ctx, did)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &echo.HTTPError{
@@ -92,6 +92,12 @@ func (bgs *BGS) handleAdminTakeDownRepo(e echo.Context) error {
 			Message: err.Error(),
 		}
 	}
+	if conflict != nil {
+		return e.JSON(200, map[string]any{
+			"success":  "true",
+			"conflict": conflict,
+		})
+	}
 	return nil
 }
 
@@ -245,6 +251,8 @@ type consumer struct {
 	UserAgent      string    `json:"user_agent"`
 	EventsConsumed uint64    `json:"events_consumed"`
 	ConnectedAt    time.Time `json:"connected_at"`
+	// negotiated stream protocol version, or "undeclared"
+	ProtocolVersion string `json:"protocol_version"`
 }
 
 func (bgs *BGS) handleAdminListConsumers(e echo.Context) error {
@@ -258,11 +266,12 @@ func (bgs *BGS) handleAdminListConsumers(e echo.Context) error {
 			continue
 		}
 		consumers = append(consumers, consumer{
-			ID:             id,
-			RemoteAddr:     c.RemoteAddr,
-			UserAgent:      c.UserAgent,
-			EventsConsumed: uint64(m.Counter.GetValue()),
-			ConnectedAt:    c.ConnectedAt,
+			ID:              id,
+			RemoteAddr:      c.RemoteAddr,
+			UserAgent:       c.UserAgent,
+			EventsConsumed:  uint64(m.Counter.GetValue()),
+			ConnectedAt:     c.ConnectedAt,
+			ProtocolVersion: c.ProtocolVersion,
 		})
 	}
 
@@ -601,6 +610,13 @@ func (bgs *BGS) handleAdminResetRepo(e echo.Context) error {
 		return fmt.Errorf("no such user: %w", err)
 	}
 
+	if conflict := bgs.legalHoldConflict(ctx, did, holdWorkflowReset, false); conflict != nil {
+		return e.JSON(http.StatusConflict, map[string]any{
+			"error":    "repo is under legal hold",
+			"conflict": conflict,
+		})
+	}
+
 	if err := bgs.repoman.ResetRepo(ctx, ai.Uid); err != nil {
 		return err
 	}
@@ -0,0 +1,639 @@
+package bgs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/webauthn"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// number of recovery codes issued at a time
+const adminRecoveryCodes = 10
+
+// recovery code attempts allowed, across all clients: a burst of 5, then one a minute
+const (
+	adminRecoverBurst    = 5
+	adminRecoverInterval = time.Minute
+)
+
+// errBootstrapUsed is returned when a bootstrap enrollment finishes after another credential was enrolled
+var errBootstrapUsed = errors.New("a hardware token is already enrolled")
+
+// AdminWebAuthnConfig enables hardware-token sign-in for the admin API, as an alternative (or replacement) to static admin tokens.
+type AdminWebAuthnConfig struct {
+	RelyingParty webauthn.RelyingParty
+	// lifetime of the bearer tokens issued on sign-in
+	SessionTTL time.Duration
+	// token authorizing enrollment of the first hardware token; empty generates one at startup
+	BootstrapToken string
+	// file a generated bootstrap token is written to (mode 0600); empty prints it once to stderr
+	BootstrapTokenFile string
+	// only accept hardware-token sessions on the admin API, rejecting static admin tokens
+	DisableStaticTokens bool
+}
+
+type adminCeremony struct {
+	register bool
+	// enrollment authorized by the bootstrap token, only valid while no credential is enrolled
+	bootstrap bool
+	user      webauthn.User
+	expires   time.Time
+}
+
+// adminWebAuthn is the state of hardware-token sign-in
+type adminWebAuthn struct {
+	config    AdminWebAuthnConfig
+	bootstrap string
+
+	lk sync.Mutex
+	// in-flight ceremonies, by base64url challenge
+	ceremonies map[string]adminCeremony
+
+	// serializes enrollments, so concurrent bootstrap ceremonies can't both succeed
+	enrollLk sync.Mutex
+	// recovery code attempts
+	recoverLimiter *rate.Limiter
+}
+
+func (bgs *BGS) startAdminWebAuthn(config *AdminWebAuthnConfig) error {
+	if config.RelyingParty.ID == "" || len(config.RelyingParty.Origins) == 0 {
+		return fmt.Errorf("admin WebAuthn requires a relying party ID and origin")
+	}
+	wa := &adminWebAuthn{
+		config:         *config,
+		bootstrap:      config.BootstrapToken,
+		ceremonies:     make(map[string]adminCeremony),
+		recoverLimiter: rate.NewLimiter(rate.Every(adminRecoverInterval), adminRecoverBurst),
+	}
+	n, err := bgs.countAdminCredentials(context.Background())
+	if err != nil {
+		return err
+	}
+	if n == 0 && wa.bootstrap == "" {
+		tok, err := randomToken()
+		if err != nil {
+			return err
+		}
+		wa.bootstrap = tok
+		if err := revealBootstrapToken(config.BootstrapTokenFile, tok); err != nil {
+			return err
+		}
+		bgs.log.Warn("no admin hardware tokens are enrolled; a bootstrap token was issued to enroll one", "file", config.BootstrapTokenFile)
+	}
+	bgs.adminWebAuthn = wa
+	return nil
+}
+
+// revealBootstrapToken hands a generated bootstrap token to the operator, without it reaching the logs
+func revealBootstrapToken(path, tok string) error {
+	if path == "" {
+		_, err := fmt.Fprintf(os.Stderr, "admin WebAuthn bootstrap token: %s\n", tok)
+		return err
+	}
+	// replace any token left by a previous run, rather than writing through its permissions
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("writing bootstrap token: %w", err)
+	}
+	if _, err := f.WriteString(tok + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("writing bootstrap token: %w", err)
+	}
+	return f.Close()
+}
+
+// checkBootstrapToken compares a bootstrap token in constant time
+func (wa *adminWebAuthn) checkBootstrapToken(tok string) bool {
+	wa.lk.Lock()
+	want := wa.bootstrap
+	wa.lk.Unlock()
+	return want != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(want)) == 1
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(tok string) string {
+	h := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(h[:])
+}
+
+func (bgs *BGS) countAdminCredentials(ctx context.Context) (int64, error) {
+	var n int64
+	err := bgs.db.WithContext(ctx).Model(&models.AdminCredential{}).Count(&n).Error
+	return n, err
+}
+
+// validAdminToken checks an admin API bearer token: a static admin token (unless disabled), or an unexpired sign-in session. Enrollment-only sessions, opened with a recovery code, are only accepted when enrolling.
+func (bgs *BGS) validAdminToken(ctx context.Context, tok string, enrolling bool) (bool, error) {
+	if bgs.adminWebAuthn == nil || !bgs.adminWebAuthn.config.DisableStaticTokens {
+		ok, err := bgs.lookupAdminToken(tok)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	if bgs.adminWebAuthn == nil {
+		return false, nil
+	}
+	var s models.AdminSession
+	if err := bgs.db.WithContext(ctx).Where("token_hash = ? AND expires_at > ?", hashToken(tok), time.Now()).Limit(1).Find(&s).Error; err != nil {
+		return false, err
+	}
+	if s.EnrollOnly && !enrolling {
+		return false, nil
+	}
+	return s.ID != 0, nil
+}
+
+// openAdminSession issues a bearer token for the admin API, or if enrollOnly, only for enrolling a hardware token
+func (bgs *BGS) openAdminSession(ctx context.Context, method string, enrollOnly bool) (map[string]any, error) {
+	tok, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	s := models.AdminSession{
+		TokenHash:  hashToken(tok),
+		ExpiresAt:  time.Now().Add(bgs.adminWebAuthn.config.SessionTTL),
+		Method:     method,
+		EnrollOnly: enrollOnly,
+	}
+	if err := bgs.db.WithContext(ctx).Create(&s).Error; err != nil {
+		return nil, err
+	}
+	// expired sessions are of no further use
+	if err := bgs.db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.AdminSession{}).Error; err != nil {
+		bgs.log.Warn("failed to prune expired admin sessions", "err", err)
+	}
+	bgs.log.Info("admin session opened", "method", method, "enrollOnly", enrollOnly, "expiresAt", s.ExpiresAt)
+	return map[string]any{
+		"token":      tok,
+		"expiresAt":  s.ExpiresAt.UTC().Format(time.RFC3339),
+		"enrollOnly": enrollOnly,
+	}, nil
+}
+
+// startCeremony records a ceremony's challenge, pruning expired ones
+func (wa *adminWebAuthn) startCeremony(c adminCeremony) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	c.expires = time.Now().Add(webauthn.CeremonyTimeout)
+	wa.lk.Lock()
+	defer wa.lk.Unlock()
+	for k, v := range wa.ceremonies {
+		if time.Now().After(v.expires) {
+			delete(wa.ceremonies, k)
+		}
+	}
+	wa.ceremonies[base64.RawURLEncoding.EncodeToString(challenge)] = c
+	return challenge, nil
+}
+
+// finishCeremony consumes a ceremony; each challenge may only be answered once
+func (wa *adminWebAuthn) finishCeremony(challenge []byte, register bool) (adminCeremony, bool) {
+	key := base64.RawURLEncoding.EncodeToString(challenge)
+	wa.lk.Lock()
+	defer wa.lk.Unlock()
+	c, ok := wa.ceremonies[key]
+	delete(wa.ceremonies, key)
+	if !ok || c.register != register || time.Now().After(c.expires) {
+		return adminCeremony{}, false
+	}
+	return c, true
+}
+
+func (bgs *BGS) webAuthnEnabled() error {
+	if bgs.adminWebAuthn == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "admin WebAuthn is not enabled",
+		}
+	}
+	return nil
+}
+
+type webAuthnRegisterBeginBody struct {
+	// label for the new credential
+	Name string `json:"name"`
+	// required to enroll the first credential, unless signed in
+	BootstrapToken string `json:"bootstrapToken"`
+}
+
+// handleWebAuthnRegisterBegin starts enrolling a hardware token. Signed-in admins may enroll further tokens; the first requires the bootstrap token.
+func (bgs *BGS) handleWebAuthnRegisterBegin(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	var body webAuthnRegisterBeginBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Name == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify a name for the credential",
+		}
+	}
+
+	authorized, bootstrap := false, false
+	if tok, ok := bearerToken(e); ok {
+		valid, err := bgs.validAdminToken(ctx, tok, true)
+		if err != nil {
+			return err
+		}
+		authorized = valid
+	}
+	if !authorized && body.BootstrapToken != "" {
+		n, err := bgs.countAdminCredentials(ctx)
+		if err != nil {
+			return err
+		}
+		bootstrap = n == 0 && bgs.adminWebAuthn.checkBootstrapToken(body.BootstrapToken)
+		authorized = bootstrap
+	}
+	if !authorized {
+		return echo.ErrForbidden
+	}
+
+	var existing []models.AdminCredential
+	if err := bgs.db.WithContext(ctx).Find(&existing).Error; err != nil {
+		return err
+	}
+	exclude := make([]webauthn.Credential, 0, len(existing))
+	for _, c := range existing {
+		exclude = append(exclude, webauthn.Credential{ID: c.CredentialID})
+	}
+	userID := make([]byte, 16)
+	if _, err := rand.Read(userID); err != nil {
+		return err
+	}
+	user := webauthn.User{ID: userID, Name: body.Name, DisplayName: body.Name}
+	challenge, err := bgs.adminWebAuthn.startCeremony(adminCeremony{register: true, bootstrap: bootstrap, user: user})
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"publicKey": bgs.adminWebAuthn.config.RelyingParty.CreationOptions(challenge, user, exclude),
+	})
+}
+
+type webAuthnRegisterFinishBody struct {
+	Challenge webauthn.Bytes               `json:"challenge"`
+	Response  webauthn.AttestationResponse `json:"response"`
+}
+
+// handleWebAuthnRegisterFinish completes enrollment. Recovery codes are issued with the first credential.
+func (bgs *BGS) handleWebAuthnRegisterFinish(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	var body webAuthnRegisterFinishBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	c, ok := bgs.adminWebAuthn.finishCeremony(body.Challenge, true)
+	if !ok {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "unknown or expired challenge",
+		}
+	}
+	cred, err := bgs.adminWebAuthn.config.RelyingParty.VerifyRegistration(body.Challenge, body.Response)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid registration: %s", err),
+		}
+	}
+
+	row := models.AdminCredential{
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		UserHandle:   c.user.ID,
+		Name:         c.user.Name,
+	}
+	codes, err := bgs.enrollAdminCredential(ctx, &row, c.bootstrap)
+	if errors.Is(err, errBootstrapUsed) {
+		return &echo.HTTPError{
+			Code:    403,
+			Message: "the bootstrap token is no longer valid: a hardware token is already enrolled",
+		}
+	}
+	if err != nil {
+		return err
+	}
+	bgs.log.Info("admin hardware token enrolled", "name", row.Name, "id", row.ID, "bootstrap", c.bootstrap)
+
+	out := map[string]any{
+		"id":   row.ID,
+		"name": row.Name,
+	}
+	if codes != nil {
+		out["recoveryCodes"] = codes
+	}
+	return e.JSON(200, out)
+}
+
+// enrollAdminCredential stores a new credential, issuing recovery codes with the first. Bootstrap enrollments fail with errBootstrapUsed if any credential is already enrolled; the check is made in the transaction which inserts the row, so two bootstrap ceremonies can't both enroll a key.
+func (bgs *BGS) enrollAdminCredential(ctx context.Context, row *models.AdminCredential, bootstrap bool) ([]string, error) {
+	wa := bgs.adminWebAuthn
+	wa.enrollLk.Lock()
+	defer wa.enrollLk.Unlock()
+
+	var codes []string
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.AdminCredential{}).Count(&n).Error; err != nil {
+			return err
+		}
+		if bootstrap && n > 0 {
+			return errBootstrapUsed
+		}
+		if err := tx.Create(row).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bootstrap {
+		// the bootstrap token is single-use
+		wa.lk.Lock()
+		wa.bootstrap = ""
+		wa.lk.Unlock()
+	}
+	return codes, nil
+}
+
+// replaceRecoveryCodes discards unused recovery codes, and issues new ones
+func replaceRecoveryCodes(tx *gorm.DB) ([]string, error) {
+	codes, err := webauthn.NewRecoveryCodes(adminRecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("used_at IS NULL").Delete(&models.AdminRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]models.AdminRecoveryCode, 0, len(codes))
+	for _, c := range codes {
+		rows = append(rows, models.AdminRecoveryCode{Hash: webauthn.HashRecoveryCode(c)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// handleWebAuthnLoginBegin starts signing in with any enrolled (discoverable) hardware token
+func (bgs *BGS) handleWebAuthnLoginBegin(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	challenge, err := bgs.adminWebAuthn.startCeremony(adminCeremony{})
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"publicKey": bgs.adminWebAuthn.config.RelyingParty.RequestOptions(challenge, nil),
+	})
+}
+
+type webAuthnLoginFinishBody struct {
+	Challenge webauthn.Bytes             `json:"challenge"`
+	ID        webauthn.Bytes             `json:"id"`
+	Response  webauthn.AssertionResponse `json:"response"`
+}
+
+// handleWebAuthnLoginFinish verifies a sign-in, returning a session bearer token for the admin API
+func (bgs *BGS) handleWebAuthnLoginFinish(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	var body webAuthnLoginFinishBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if _, ok := bgs.adminWebAuthn.finishCeremony(body.Challenge, false); !ok {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "unknown or expired challenge",
+		}
+	}
+	var row models.AdminCredential
+	if err := bgs.db.WithContext(ctx).Where("credential_id = ?", []byte(body.ID)).Limit(1).Find(&row).Error; err != nil {
+		return err
+	}
+	if row.ID == 0 {
+		return echo.ErrForbidden
+	}
+	cred := &webauthn.Credential{ID: row.CredentialID, PublicKey: row.PublicKey, SignCount: row.SignCount, UserHandle: row.UserHandle}
+	count, err := bgs.adminWebAuthn.config.RelyingParty.VerifyAssertion(body.Challenge, cred, body.Response)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCloned) {
+			bgs.log.Error("admin hardware token may have been cloned", "name", row.Name, "id", row.ID)
+		}
+		bgs.log.Warn("admin hardware token sign-in failed", "name", row.Name, "err", err)
+		return echo.ErrForbidden
+	}
+	now := time.Now()
+	if err := bgs.db.WithContext(ctx).Model(&row).Updates(map[string]any{
+		"sign_count":   count,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	out, err := bgs.openAdminSession(ctx, "webauthn:"+row.Name, false)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, out)
+}
+
+type webAuthnRecoverBody struct {
+	Code string `json:"code"`
+}
+
+// handleWebAuthnRecover signs in with a single-use recovery code, so a new hardware token can be enrolled. The session it opens is only good for enrollment, and attempts are rate limited.
+func (bgs *BGS) handleWebAuthnRecover(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	if !bgs.adminWebAuthn.recoverLimiter.Allow() {
+		bgs.log.Warn("admin recovery code sign-in rate limited")
+		return &echo.HTTPError{
+			Code:    429,
+			Message: "too many recovery attempts, try again later",
+		}
+	}
+	ctx := e.Request().Context()
+	var body webAuthnRecoverBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Code == "" {
+		return echo.ErrForbidden
+	}
+	res := bgs.db.WithContext(ctx).Model(&models.AdminRecoveryCode{}).
+		Where("hash = ? AND used_at IS NULL", webauthn.HashRecoveryCode(body.Code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		bgs.log.Warn("admin recovery code sign-in failed")
+		return echo.ErrForbidden
+	}
+	bgs.log.Warn("admin signed in with a recovery code")
+	out, err := bgs.openAdminSession(ctx, "recovery-code", true)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, out)
+}
+
+type adminCredentialView struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// handleAdminListCredentials lists the enrolled hardware tokens, and how many unused recovery codes remain
+func (bgs *BGS) handleAdminListCredentials(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	var rows []models.AdminCredential
+	if err := bgs.db.WithContext(ctx).Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	var remaining int64
+	if err := bgs.db.WithContext(ctx).Model(&models.AdminRecoveryCode{}).Where("used_at IS NULL").Count(&remaining).Error; err != nil {
+		return err
+	}
+	out := make([]adminCredentialView, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, adminCredentialView{ID: r.ID, Name: r.Name, CreatedAt: r.CreatedAt, LastUsedAt: r.LastUsedAt})
+	}
+	return e.JSON(200, map[string]any{
+		"credentials":   out,
+		"recoveryCodes": remaining,
+	})
+}
+
+// handleAdminRemoveCredential removes an enrolled hardware token; the last one can't be removed
+func (bgs *BGS) handleAdminRemoveCredential(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	var body struct {
+		ID uint `json:"id"`
+	}
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	err := bgs.db.WithContext(e.Request().Context()).Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&models.AdminCredential{}).Count(&n).Error; err != nil {
+			return err
+		}
+		if n <= 1 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "cannot remove the last enrolled credential",
+			}
+		}
+		res := tx.Delete(&models.AdminCredential{}, body.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "no such credential",
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bgs.log.Info("admin hardware token removed", "id", body.ID)
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+// handleAdminRegenerateRecoveryCodes replaces the unused recovery codes with new ones
+func (bgs *BGS) handleAdminRegenerateRecoveryCodes(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	var codes []string
+	err := bgs.db.WithContext(e.Request().Context()).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bgs.log.Info("admin recovery codes regenerated")
+	return e.JSON(200, map[string]any{
+		"recoveryCodes": codes,
+	})
+}
+
+// handleAdminLogout ends the calling session
+func (bgs *BGS) handleAdminLogout(e echo.Context) error {
+	if err := bgs.webAuthnEnabled(); err != nil {
+		return err
+	}
+	tok, _ := bearerToken(e)
+	if err := bgs.db.WithContext(e.Request().Context()).Where("token_hash = ?", hashToken(tok)).Delete(&models.AdminSession{}).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func bearerToken(e echo.Context) (string, bool) {
+	tok, ok := strings.CutPrefix(e.Request().Header.Get("Authorization"), "Bearer ")
+	return tok, ok && tok != ""
+}
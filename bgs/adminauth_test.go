@@ -0,0 +1,116 @@
+package bgs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/webauthn"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupWebAuthnTest(t *testing.T) *BGS {
+	b := newTestBGS(t)
+	file := filepath.Join(t.TempDir(), "bootstrap-token")
+	err := b.startAdminWebAuthn(&AdminWebAuthnConfig{
+		RelyingParty:       webauthn.RelyingParty{ID: "relay.example.ca", Origins: []string{"https://relay.example.ca"}},
+		SessionTTL:         time.Hour,
+		BootstrapTokenFile: file,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBootstrapToken(t *testing.T) {
+	assert := assert.New(t)
+	b := setupWebAuthnTest(t)
+	ctx := context.Background()
+
+	// the generated token is written to a private file
+	info, err := os.Stat(b.adminWebAuthn.config.BootstrapTokenFile)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	raw, err := os.ReadFile(b.adminWebAuthn.config.BootstrapTokenFile)
+	assert.NoError(err)
+	tok := strings.TrimSpace(string(raw))
+	assert.True(b.adminWebAuthn.checkBootstrapToken(tok))
+	assert.False(b.adminWebAuthn.checkBootstrapToken(tok[1:]))
+	assert.False(b.adminWebAuthn.checkBootstrapToken(""))
+
+	// two bootstrap ceremonies were started before either finished; only the first enrolls
+	codes, err := b.enrollAdminCredential(ctx, &models.AdminCredential{CredentialID: []byte("one"), Name: "one"}, true)
+	assert.NoError(err)
+	assert.Len(codes, adminRecoveryCodes)
+	_, err = b.enrollAdminCredential(ctx, &models.AdminCredential{CredentialID: []byte("two"), Name: "two"}, true)
+	assert.ErrorIs(err, errBootstrapUsed)
+	n, err := b.countAdminCredentials(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(1), n)
+	assert.False(b.adminWebAuthn.checkBootstrapToken(tok))
+
+	// signed-in admins may enroll further tokens, without new recovery codes
+	codes, err = b.enrollAdminCredential(ctx, &models.AdminCredential{CredentialID: []byte("three"), Name: "three"}, false)
+	assert.NoError(err)
+	assert.Nil(codes)
+}
+
+func TestRecoverySession(t *testing.T) {
+	assert := assert.New(t)
+	b := setupWebAuthnTest(t)
+	b.adminWebAuthn.config.DisableStaticTokens = true
+	ctx := context.Background()
+
+	codes, err := b.enrollAdminCredential(ctx, &models.AdminCredential{CredentialID: []byte("one"), Name: "one"}, true)
+	assert.NoError(err)
+
+	recover := func(code string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/admin/webauthn/recover", strings.NewReader(`{"code":"`+code+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if err := b.handleWebAuthnRecover(e.NewContext(req, rec)); err != nil {
+			e.HTTPErrorHandler(err, e.NewContext(req, rec))
+		}
+		return rec
+	}
+
+	rec := recover(codes[0])
+	assert.Equal(200, rec.Code)
+	assert.Contains(rec.Body.String(), `"enrollOnly":true`)
+
+	// a recovery session may enroll a token, and nothing else
+	var s models.AdminSession
+	assert.NoError(b.db.Where("method = ?", "recovery-code").First(&s).Error)
+	assert.True(s.EnrollOnly)
+	tok, err := b.openAdminSession(ctx, "recovery-code", true)
+	assert.NoError(err)
+	ok, err := b.validAdminToken(ctx, tok["token"].(string), true)
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = b.validAdminToken(ctx, tok["token"].(string), false)
+	assert.NoError(err)
+	assert.False(ok)
+
+	tok, err = b.openAdminSession(ctx, "webauthn:one", false)
+	assert.NoError(err)
+	ok, err = b.validAdminToken(ctx, tok["token"].(string), false)
+	assert.NoError(err)
+	assert.True(ok)
+
+	// codes are single-use, and attempts are rate limited, even with a valid code
+	assert.Equal(403, recover(codes[0]).Code)
+	for i := 2; i < adminRecoverBurst; i++ {
+		assert.Equal(403, recover("nope").Code)
+	}
+	assert.Equal(429, recover(codes[1]).Code)
+}
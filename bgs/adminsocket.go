@@ -0,0 +1,140 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminSocketConfig serves the admin API on a Unix domain socket. Connections are authenticated by the connecting process's user (peer credentials, Linux only) instead of admin tokens.
+type AdminSocketConfig struct {
+	Path string
+	// file mode of the socket
+	Mode os.FileMode
+	// UIDs allowed to connect, in addition to the relay's own UID and root
+	AllowUIDs []int
+	// serve the admin API only on the socket, not the HTTP listener
+	Exclusive bool
+}
+
+// peerCredListener only accepts connections from processes running as an allowed user
+type peerCredListener struct {
+	net.Listener
+	allowUIDs []int
+	log       *slog.Logger
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		uid, err := peerUID(c)
+		if err == nil && slices.Contains(l.allowUIDs, uid) {
+			return c, nil
+		}
+		adminSocketRejections.Inc()
+		l.log.Warn("rejected admin socket connection", "uid", uid, "err", err)
+		c.Close()
+	}
+}
+
+// StartAdminSocket serves the admin API on the configured Unix socket, until the relay shuts down
+func (bgs *BGS) StartAdminSocket() error {
+	config := bgs.adminSocket
+	if config == nil {
+		return fmt.Errorf("admin socket is not configured")
+	}
+	// a socket left over from a previous run would make listening fail
+	if fi, err := os.Lstat(config.Path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return fmt.Errorf("admin socket path exists and is not a socket: %s", config.Path)
+		}
+		if err := os.Remove(config.Path); err != nil {
+			return err
+		}
+	}
+	li, err := listenAdminSocket(config.Path, config.Mode)
+	if err != nil {
+		return err
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = bgs.handleHTTPError
+	bgs.registerAdminRoutes(e.Group("/admin"))
+	e.Listener = &peerCredListener{
+		Listener:  li,
+		allowUIDs: append([]int{0, os.Getuid()}, config.AllowUIDs...),
+		log:       bgs.log.With("subsystem", "admin-socket"),
+	}
+	bgs.adminSocketLk.Lock()
+	if bgs.adminSocketClosed {
+		bgs.adminSocketLk.Unlock()
+		li.Close()
+		return os.Remove(config.Path)
+	}
+	bgs.adminSocketServer = e
+	bgs.adminSocketLk.Unlock()
+
+	bgs.log.Info("serving admin API on unix socket", "path", config.Path, "exclusive", config.Exclusive)
+	// serve on e.Server, which is the one Shutdown stops
+	if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listenAdminSocket listens on a Unix socket with the given mode. The socket is created inside a private (0700) directory and only moved to its path once its mode is set, so it is never reachable with the default, umask-derived, mode.
+func listenAdminSocket(path string, mode os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".admin-socket-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "admin.sock")
+	li, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is unlinked at its final path by stopAdminSocket
+	li.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		li.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		li.Close()
+		return nil, err
+	}
+	return li, nil
+}
+
+func (bgs *BGS) stopAdminSocket() error {
+	bgs.adminSocketLk.Lock()
+	e := bgs.adminSocketServer
+	bgs.adminSocketClosed = true
+	bgs.adminSocketLk.Unlock()
+	if e == nil {
+		return nil
+	}
+	if err := e.Shutdown(context.TODO()); err != nil {
+		return err
+	}
+	if err := os.Remove(bgs.adminSocket.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package bgs
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminSocket(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	b.adminSocket = &AdminSocketConfig{Path: path, Mode: 0600}
+
+	done := make(chan error, 1)
+	go func() { done <- b.StartAdminSocket() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var res *http.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		if res, err = client.Get("http://relay/admin/subs/getEnabled"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(err) {
+		return
+	}
+	res.Body.Close()
+	assert.Equal(200, res.StatusCode)
+
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	// only the socket is left behind in its directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(err)
+	assert.Len(entries, 1)
+
+	assert.NoError(b.stopAdminSocket())
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("admin socket server did not stop")
+	}
+	_, err = os.Stat(path)
+	assert.ErrorIs(err, os.ErrNotExist)
+}
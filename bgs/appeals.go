@@ -0,0 +1,385 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	AppealKindClassification = "classification"
+	AppealKindTakedown       = "takedown"
+
+	AppealStatusPending  = "pending"
+	AppealStatusAccepted = "accepted"
+	AppealStatusRejected = "rejected"
+)
+
+var (
+	ErrAppealNotFound = errors.New("no such appeal")
+	ErrAppealPending  = errors.New("an appeal of this kind is already pending review")
+	ErrAppealClosed   = errors.New("appeal already resolved")
+)
+
+// AppealDecision is a reviewer's ruling on an appeal.
+type AppealDecision struct {
+	// AppealStatusAccepted or AppealStatusRejected
+	Status string
+	Actor  string
+	Note   string
+	// for accepted classification appeals, overrides the requested country; empty removes the classification
+	Country *string
+}
+
+// pendingAppeal returns the account's open appeal of the given kind (any kind if empty), if any
+func (bgs *BGS) pendingAppeal(ctx context.Context, db *gorm.DB, did, kind string) (*models.Appeal, error) {
+	q := db.WithContext(ctx).Where("did = ? AND status = ?", did, AppealStatusPending)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	var appeal models.Appeal
+	err := q.First(&appeal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &appeal, nil
+}
+
+// SubmitAppeal records a new pending appeal, unless the account already has one of the same kind pending.
+func (bgs *BGS) SubmitAppeal(ctx context.Context, appeal *models.Appeal, remoteIP string) error {
+	appeal.Status = AppealStatusPending
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		prev, err := bgs.pendingAppeal(ctx, tx, appeal.Did, appeal.Kind)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			return ErrAppealPending
+		}
+		if err := tx.Create(appeal).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AppealAuditEntry{
+			AppealID: appeal.ID,
+			Action:   "submit",
+			Actor:    appeal.Did,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	appealsSubmittedCounter.WithLabelValues(appeal.Kind).Inc()
+	bgs.log.Info("appeal submitted", "id", appeal.ID, "did", appeal.Did, "kind", appeal.Kind)
+	bgs.notifyAppeal("submitted", appeal)
+	return nil
+}
+
+// AssignAppeal assigns a pending appeal to a reviewer.
+func (bgs *BGS) AssignAppeal(ctx context.Context, id uint, reviewer, actor, remoteIP string) (*models.Appeal, error) {
+	var appeal models.Appeal
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := loadOpenAppeal(tx, id, &appeal); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&appeal).Updates(map[string]any{
+			"assigned_to": reviewer,
+			"assigned_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AppealAuditEntry{
+			AppealID: appeal.ID,
+			Action:   "assign",
+			Actor:    actor,
+			Note:     reviewer,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bgs.log.Info("appeal assigned", "id", appeal.ID, "reviewer", reviewer, "actor", actor)
+	bgs.notifyAppeal("assigned", &appeal)
+	return &appeal, nil
+}
+
+// ResolveAppeal records a decision on a pending appeal. Accepting a classification appeal applies the requested (or overridden) classification with source "appeal"; accepting a takedown appeal reverses the takedown.
+func (bgs *BGS) ResolveAppeal(ctx context.Context, id uint, d AppealDecision, remoteIP string) (*models.Appeal, error) {
+	if d.Status != AppealStatusAccepted && d.Status != AppealStatusRejected {
+		return nil, fmt.Errorf("invalid appeal decision: %q", d.Status)
+	}
+
+	var appeal models.Appeal
+	if err := loadOpenAppeal(bgs.db.WithContext(ctx), id, &appeal); err != nil {
+		return nil, err
+	}
+
+	if d.Status == AppealStatusAccepted {
+		if err := bgs.applyAppeal(ctx, &appeal, d); err != nil {
+			return nil, err
+		}
+	}
+
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&appeal).Where("status = ?", AppealStatusPending).Updates(map[string]any{
+			"status":          d.Status,
+			"resolved_by":     d.Actor,
+			"resolution_note": d.Note,
+			"resolved_at":     &now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAppealClosed
+		}
+		return tx.Create(&models.AppealAuditEntry{
+			AppealID: appeal.ID,
+			Action:   d.Status,
+			Actor:    d.Actor,
+			Note:     d.Note,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	appealsResolvedCounter.WithLabelValues(appeal.Kind, d.Status).Inc()
+	appealResolutionDuration.WithLabelValues(appeal.Kind).Observe(time.Since(appeal.CreatedAt).Seconds())
+	bgs.log.Info("appeal resolved", "id", appeal.ID, "did", appeal.Did, "kind", appeal.Kind, "status", d.Status, "actor", d.Actor)
+	bgs.notifyAppeal("resolved", &appeal)
+	return &appeal, nil
+}
+
+func loadOpenAppeal(db *gorm.DB, id uint, appeal *models.Appeal) error {
+	if err := db.First(appeal, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAppealNotFound
+		}
+		return err
+	}
+	if appeal.Status != AppealStatusPending {
+		return ErrAppealClosed
+	}
+	return nil
+}
+
+func (bgs *BGS) applyAppeal(ctx context.Context, appeal *models.Appeal, d AppealDecision) error {
+	switch appeal.Kind {
+	case AppealKindClassification:
+		country := appeal.RequestedCountry
+		if d.Country != nil {
+			country = *d.Country
+		}
+		if country == "" {
+			return bgs.DeleteClassification(ctx, appeal.Did)
+		}
+		country, err := sovereignty.NormalizeCountry(country)
+		if err != nil {
+			return err
+		}
+		return bgs.SetClassification(ctx, sovereignty.Classification{
+			DID:     appeal.Did,
+			Country: country,
+			Source:  "appeal",
+		})
+	case AppealKindTakedown:
+		return bgs.ReverseTakedown(ctx, appeal.Did)
+	default:
+		return fmt.Errorf("unknown appeal kind: %q", appeal.Kind)
+	}
+}
+
+// appealNotification is the JSON body POSTed to appeal webhooks
+type appealNotification struct {
+	// "submitted", "assigned" or "resolved"
+	Event  string         `json:"event"`
+	Appeal *models.Appeal `json:"appeal"`
+}
+
+// notifyAppeal delivers an appeal event to all configured webhooks, in the background
+func (bgs *BGS) notifyAppeal(event string, appeal *models.Appeal) {
+	if len(bgs.appealWebhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(appealNotification{Event: event, Appeal: appeal})
+	if err != nil {
+		bgs.log.Error("failed to encode appeal notification", "err", err)
+		return
+	}
+	for _, u := range bgs.appealWebhooks {
+		go func(u string) {
+			resp, err := bgs.httpClients.Get(httpprofile.Interactive).Post(u, "application/json", bytes.NewReader(body))
+			if err != nil {
+				bgs.log.Warn("appeal webhook failed", "url", u, "err", err)
+				return
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+			if resp.StatusCode/100 != 2 {
+				bgs.log.Warn("appeal webhook failed", "url", u, "status", resp.StatusCode)
+			}
+		}(u)
+	}
+}
+
+// appealHTTPError maps appeal workflow errors to HTTP responses
+func appealHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrAppealNotFound):
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: err.Error()}
+	case errors.Is(err, ErrAppealClosed), errors.Is(err, ErrAppealPending):
+		return &echo.HTTPError{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+}
+
+// handleAdminListAppeals returns appeals, oldest first, optionally filtered by status, kind and assigned reviewer
+func (bgs *BGS) handleAdminListAppeals(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	q := bgs.db.WithContext(e.Request().Context()).Order("id").Limit(limit)
+	if status := e.QueryParam("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if kind := e.QueryParam("kind"); kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	if reviewer := e.QueryParam("assignee"); reviewer != "" {
+		q = q.Where("assigned_to = ?", reviewer)
+	}
+	var appeals []models.Appeal
+	if err := q.Find(&appeals).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, appeals)
+}
+
+// handleAdminAppealAudit returns the audit trail of a single appeal, oldest first
+func (bgs *BGS) handleAdminAppealAudit(e echo.Context) error {
+	id, err := strconv.ParseUint(e.QueryParam("id"), 10, 64)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify numeric appeal id",
+		}
+	}
+	var entries []models.AppealAuditEntry
+	if err := bgs.db.WithContext(e.Request().Context()).Where("appeal_id = ?", id).Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, entries)
+}
+
+type assignAppealBody struct {
+	ID       uint   `json:"id"`
+	Reviewer string `json:"reviewer"`
+	// name of the operator making the assignment
+	Actor string `json:"actor"`
+}
+
+func (bgs *BGS) handleAdminAssignAppeal(e echo.Context) error {
+	var body assignAppealBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Reviewer == "" || body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify reviewer and actor",
+		}
+	}
+
+	appeal, err := bgs.AssignAppeal(e.Request().Context(), body.ID, body.Reviewer, body.Actor, e.RealIP())
+	if err != nil {
+		return appealHTTPError(err)
+	}
+	return e.JSON(200, appeal)
+}
+
+type resolveAppealBody struct {
+	ID uint `json:"id"`
+	// "accept" or "reject"
+	Decision string `json:"decision"`
+	// name of the reviewing operator
+	Actor string `json:"actor"`
+	Note  string `json:"note"`
+	// overrides the requested country when accepting a classification appeal
+	Country *string `json:"country"`
+}
+
+func (bgs *BGS) handleAdminResolveAppeal(e echo.Context) error {
+	var body resolveAppealBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor",
+		}
+	}
+	d := AppealDecision{
+		Actor:   body.Actor,
+		Note:    body.Note,
+		Country: body.Country,
+	}
+	switch body.Decision {
+	case "accept":
+		d.Status = AppealStatusAccepted
+	case "reject":
+		d.Status = AppealStatusRejected
+	default:
+		return &echo.HTTPError{
+			Code:    400,
+			Message: `decision must be "accept" or "reject"`,
+		}
+	}
+	if d.Country != nil && *d.Country != "" {
+		if _, err := sovereignty.NormalizeCountry(*d.Country); err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	appeal, err := bgs.ResolveAppeal(e.Request().Context(), body.ID, d, e.RealIP())
+	if err != nil {
+		return appealHTTPError(err)
+	}
+	return e.JSON(200, appeal)
+}
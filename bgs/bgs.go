@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
@@ -13,17 +14,56 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/auth"
+	"github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/did"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/sequencer"
 	"github.com/bluesky-social/indigo/handles"
 	"github.com/bluesky-social/indigo/indexer"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/models"
 	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/blobs"
+	"github.com/bluesky-social/indigo/sovereignty/didlist"
+	"github.com/bluesky-social/indigo/sovereignty/egress"
+	"github.com/bluesky-social/indigo/sovereignty/extension"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/filterplugin"
+	"github.com/bluesky-social/indigo/sovereignty/flapping"
+	"github.com/bluesky-social/indigo/sovereignty/forensics"
+	"github.com/bluesky-social/indigo/sovereignty/handlecheck"
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+	"github.com/bluesky-social/indigo/sovereignty/langfilter"
+	"github.com/bluesky-social/indigo/sovereignty/langstats"
+	"github.com/bluesky-social/indigo/sovereignty/lexcheck"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
+	"github.com/bluesky-social/indigo/sovereignty/namespaces"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/sovereignty/peering"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
+	"github.com/bluesky-social/indigo/sovereignty/plcorigin"
+	"github.com/bluesky-social/indigo/sovereignty/prescreen"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+	"github.com/bluesky-social/indigo/sovereignty/residency"
+	"github.com/bluesky-social/indigo/sovereignty/resume"
+	"github.com/bluesky-social/indigo/sovereignty/selfrepo"
+	"github.com/bluesky-social/indigo/sovereignty/shadow"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+	"github.com/bluesky-social/indigo/sovereignty/talkers"
+	"github.com/bluesky-social/indigo/sovereignty/verify"
+	"github.com/bluesky-social/indigo/util/carstream"
+	"github.com/bluesky-social/indigo/util/clock"
+	"github.com/bluesky-social/indigo/util/httpprofile"
 	"github.com/bluesky-social/indigo/util/svcutil"
 	"github.com/bluesky-social/indigo/xrpc"
 	lru "github.com/hashicorp/golang-lru/v2"
@@ -85,12 +125,139 @@ type BGS struct {
 	// Management of Compaction
 	compactor *Compactor
 
+	// integrity scrubbing of stored shards; nil when disabled
+	scrubber   *Scrubber
+	scrubStore ShardScrubber
+	scrubPeers []string
+
+	// sampled comparison of mirrored repos with their origin PDS; nil when disabled
+	mirrorChecker *MirrorChecker
+
+	// autoscaling signals; see scaling.go
+	ingestLag    ingestLag
+	scaleTargets ScaleTargets
+	scaleStop    chan struct{}
+
+	// bounds on concurrent block fetches for repo exports
+	exportOpts *carstream.Options
+
 	// User cache
 	userCache *lru.Cache[string, *User]
 
 	// nextCrawlers gets forwarded POST /xrpc/com.atproto.sync.requestCrawl
 	nextCrawlers []*url.URL
-	httpClient   http.Client
+
+	streamVersions    events.VersionPolicy
+	adminWebAuthn     *adminWebAuthn
+	adminSocket       *AdminSocketConfig
+	adminSocketLk     sync.Mutex
+	adminSocketServer *echo.Echo
+	adminSocketClosed bool
+	// outbound HTTP clients, by profile
+	httpClients *httpprofile.Clients
+
+	// DID to country classification table, for sovereignty features
+	Classifications     *sovereignty.Table
+	Priority            *priority.Registry
+	Orgs                *orgs.Registry
+	orgVerifier         *orgs.Verifier
+	serviceAuth         *auth.ServiceAuthValidator
+	pdsGeo              *pdsgeo.Resolver
+	geoIP               *pdsgeo.MMDB
+	appealWebhooks      []string
+	snapshotDir         string
+	snapshotPublisher   *snapshot.Publisher
+	sovereignHostname   string
+	beacon              *peering.Beacon
+	alternates          []string
+	minors              *minors.Module
+	features            *features.Set
+	holds               *holdRegistry
+	rewrappers          []namedRewrapper
+	blobPolicy          *blobs.Policy
+	transcoder          *blobs.Transcoder
+	selfRepo            *selfrepo.Repo
+	handleChecks        *handlecheck.Pool
+	plcAudits           *plcops.Client
+	plcOrigin           *plcorigin.Resolver
+	talkers             *talkers.Tracker
+	forensics           *forensics.Recorder
+	plcAuditQueue       chan string
+	langStats           *langstats.Collector
+	langStatsStore      *langstats.Store
+	langStatsMinSamples int64
+	sovereignKey        crypto.PrivateKey
+	sovereignCancel     context.CancelFunc
+	sovereignWg         sync.WaitGroup
+
+	// classification of accounts the sovereign stream sees unclassified; countryQueue is nil when automatic classification is disabled
+	countryResolver      sovereignty.CountryResolver
+	countryMinConfidence sovereignty.Confidence
+	filterMode           sovereignty.FilterMode
+	filterHashOnly       bool
+	countryQueue         chan string
+	countryTried         *lru.Cache[string, time.Time]
+	countryRetry         time.Duration
+	classificationTTL    time.Duration
+	filterCache          sovereignty.FilterCache
+	// accounts the country resolver couldn't place, by when it last tried
+	countryUnresolved *lru.Cache[string, time.Time]
+	// allocates the output stream's sequence numbers; nil unless the disk persister is used
+	sequencer *sequencer.Sequencer
+	// declarations waiting to be evaluated against the residency policy; nil if declarations aren't consumed
+	residencyQueue  chan *residency.Declaration
+	residencyPolicy *residency.Policy
+	// holds watchlisted accounts' events for moderation; nil if not configured
+	prescreen *prescreen.Queue
+	// validates the records of processed commits against their lexicons; nil if not configured
+	lexCheck *lexcheck.Checker
+	// external verification of accounts the country resolvers have no answer for; nil if not configured
+	verifier *verify.Verifier
+	// how long the sovereign stream is held back from public subscribers; 0 if it isn't
+	publicDelay time.Duration
+	// detects accounts whose classification oscillates, and damps them; nil if disabled
+	flaps *flapping.Detector
+	// operator's lists of accounts classified in and out of country, overriding their classifications; nil if not configured
+	inCountry    *didlist.File
+	outOfCountry *didlist.File
+	// accounts listed in or out of country through the admin API, by DID, to the list name
+	listedLk sync.RWMutex
+	listed   map[string]string
+	// operator's extensions filtering and transforming the sovereign stream; nil if not configured
+	extensions *extension.Host
+	// operator's gRPC filter plugin, asked about the events the filter and extensions carry; nil if not configured
+	filterPlugin *filterplugin.Client
+	// restrictions on which countries' subscribers receive records of some collections in full; nil if not configured
+	egress *egress.Policy
+	// collections whose records the sovereign stream carries, by NSID namespace; nil if not configured
+	namespaces *namespaces.Policy
+	// judges commits by the languages their posts declare; nil if not configured
+	langFilter *langfilter.Filter
+	// sovereign stream shapes assignable to subscriber tokens, by name
+	subscriberProfiles atomic.Pointer[map[string]*profile.Profile]
+	// sampled filter decisions made in shadow mode; nil if not kept
+	shadowLog *shadow.Log
+
+	clock clock.Clock
+	// language of operator-facing output when the request doesn't ask for one; empty for English
+	lang i18n.Lang
+
+	// sovereign stream settings, replaced as a whole when a policy document is applied
+	policy          atomic.Pointer[sovereignPolicy]
+	policyAuthority crypto.PublicKey
+	policyHistory   int
+	policyLk        sync.Mutex
+
+	// issues sovereign stream resume tokens; nil when consumers use integer cursors
+	resumeSigner *resume.Signer
+	resumeEpoch  int64
+	// whether unchecked integer cursors are still accepted alongside resume tokens
+	resumeIntegerCursors bool
+
+	// closed when shutdown starts, so consumers can be told where to go
+	shutdownCh chan struct{}
+	// tracks open subscribeRepos handlers
+	consumersWg sync.WaitGroup
 
 	log *slog.Logger
 }
@@ -110,18 +277,66 @@ type SocketConsumer struct {
 	RemoteAddr  string
 	ConnectedAt time.Time
 	EventsSent  promclient.Counter
+	// negotiated stream protocol version, or "undeclared"
+	ProtocolVersion string
 }
 
 type BGSConfig struct {
 	SSL                  bool
 	CompactInterval      time.Duration
-	DefaultRepoLimit     int64
-	ConcurrencyPerPDS    int64
-	MaxQueuePerPDS       int64
-	NumCompactionWorkers int
+	DefaultRepoLimit     int64 `config:"min=0"`
+	ConcurrencyPerPDS    int64 `config:"min=1"`
+	MaxQueuePerPDS       int64 `config:"min=1"`
+	NumCompactionWorkers int   `config:"min=0"`
+
+	// how often every block in the carstore is re-hashed against its CID; 0 disables scrubbing. Requires a carstore implementing ShardScrubber
+	ScrubInterval time.Duration
+	// shards verified per second while scrubbing; 0 is unlimited
+	ScrubRate float64 `config:"min=0"`
+	// repair damaged shards from the account's PDS, falling back to Sovereign.Peers
+	ScrubRepair bool
+
+	// how often a sample of mirrored repos is compared with their origin PDS; 0 disables checking
+	MirrorCheckInterval time.Duration
+	// repos sampled per mirror check pass; 0 uses the default
+	MirrorCheckSample int `config:"min=0"`
+	// requests per second to origin PDSes while checking; 0 is unlimited
+	MirrorCheckRate float64 `config:"min=0"`
+	// resync repos found to differ from their origin
+	MirrorCheckResync bool
+
+	// blocks fetched concurrently when streaming a full repo export for getRepo; 0 uses the default
+	RepoExportConcurrency int `config:"min=0"`
+
+	// levels at which a replica counts as fully loaded, by each of the autoscaling signals reported at /scale-advice
+	Scale ScaleTargets
 
 	// NextCrawlers gets forwarded POST /xrpc/com.atproto.sync.requestCrawl
 	NextCrawlers []*url.URL
+
+	// stream protocol versions accepted from consumers, and the warnings and notices sent to them
+	StreamVersions events.VersionPolicy
+
+	// hardware-token sign-in for the admin API; nil disables it
+	AdminWebAuthn *AdminWebAuthnConfig
+
+	// serve the admin API on a Unix socket; nil disables it
+	AdminSocket *AdminSocketConfig
+
+	// clients for the relay's outbound HTTP requests, by profile: interactive for webhooks and requests made while handling one, crawler for background requests to PDSes and other services; nil uses the default profiles
+	HTTPClients *httpprofile.Clients
+
+	// country resolution decisions of the sovereign stream filter, shared with other relay instances using the same cache; nil uses FilterCacheRedisURL if set, otherwise a cache local to the process
+	FilterCache sovereignty.FilterCache
+	// Redis server the filter cache is kept in, eg "redis://localhost:6379/0"
+	FilterCacheRedisURL string
+
+	// time source for classification expiry, country resolution retries, the process-local filter cache, and the compactor and mirror checker schedules; nil uses the system clock. Tests can pass a clock.Mock to run on simulated time
+	Clock clock.Clock
+	// seeds the randomness of compaction order and mirror check sampling, so runs can be reproduced; 0 seeds from the system
+	RandSeed uint64 `config:"-"`
+
+	Sovereign SovereignConfig
 }
 
 func DefaultBGSConfig() *BGSConfig {
@@ -132,6 +347,9 @@ func DefaultBGSConfig() *BGSConfig {
 		ConcurrencyPerPDS:    100,
 		MaxQueuePerPDS:       1_000,
 		NumCompactionWorkers: 2,
+		StreamVersions:       events.DefaultVersionPolicy(),
+		Scale:                DefaultScaleTargets(),
+		Sovereign:            DefaultSovereignConfig(),
 	}
 }
 
@@ -142,11 +360,42 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 	}
 	db.AutoMigrate(User{})
 	db.AutoMigrate(AuthToken{})
+	db.AutoMigrate(models.AdminCredential{})
+	db.AutoMigrate(models.AdminRecoveryCode{})
+	db.AutoMigrate(models.AdminSession{})
 	db.AutoMigrate(models.PDS{})
 	db.AutoMigrate(models.DomainBan{})
+	db.AutoMigrate(models.DIDClassification{})
+	db.AutoMigrate(models.MinorFlag{})
+	db.AutoMigrate(models.PriorityAccount{})
+	db.AutoMigrate(models.PriorityAuditEntry{})
+	db.AutoMigrate(models.VerifiedOrg{})
+	db.AutoMigrate(models.Appeal{})
+	db.AutoMigrate(models.AppealAuditEntry{})
+	db.AutoMigrate(models.AppliedPolicy{})
+	db.AutoMigrate(models.BlobViolation{})
+	db.AutoMigrate(models.VideoPlaylist{})
+	db.AutoMigrate(models.IdentityRefresh{})
+	db.AutoMigrate(models.HandleVerification{})
+	db.AutoMigrate(models.PLCAudit{})
+	db.AutoMigrate(models.FeatureFlag{})
+	db.AutoMigrate(models.LegalHold{})
+	db.AutoMigrate(models.LegalHoldAuditEntry{})
+	db.AutoMigrate(models.LegalHoldConflict{})
+	db.AutoMigrate(models.SubscriberProfile{})
+	db.AutoMigrate(models.SubscriberToken{})
+	db.AutoMigrate(models.ListedDID{})
+	db.AutoMigrate(models.WatchedRepo{})
+	db.AutoMigrate(models.PreScreenAuditEntry{})
+	db.AutoMigrate(models.ResidencyDeclaration{})
+	db.AutoMigrate(models.InvalidRecord{})
 
 	uc, _ := lru.New[string, *User](1_000_000)
 
+	clk := clock.OrSystem(config.Clock)
+	classifications := sovereignty.NewTable()
+	classifications.Clock = clk
+
 	bgs := &BGS{
 		Index:       ix,
 		db:          db,
@@ -165,11 +414,28 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 
 		userCache: uc,
 
-		log: slog.Default().With("system", "bgs"),
+		Classifications: classifications,
+		Priority:        priority.NewRegistry(),
+		Orgs:            orgs.NewRegistry(),
+		holds:           &holdRegistry{},
+		shutdownCh:      make(chan struct{}),
+
+		log:   slog.Default().With("system", "bgs"),
+		clock: clk,
+	}
+
+	if err := bgs.loadLegalHolds(); err != nil {
+		return nil, err
+	}
+
+	bgs.httpClients = config.HTTPClients
+	if bgs.httpClients == nil {
+		bgs.httpClients = httpprofile.DefaultClients()
 	}
 
 	ix.CreateExternalUser = bgs.createExternalUser
 	slOpts := DefaultSlurperOptions()
+	slOpts.Proxy = bgs.httpClients.Proxy(httpprofile.Crawler)
 	slOpts.SSL = config.SSL
 	slOpts.DefaultRepoLimit = config.DefaultRepoLimit
 	slOpts.ConcurrencyPerPDS = config.ConcurrencyPerPDS
@@ -179,6 +445,7 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 		return nil, err
 	}
 
+	s.ExemptFromLimits = bgs.isPriorityEvent
 	bgs.slurper = s
 
 	if err := bgs.slurper.RestartAll(); err != nil {
@@ -187,19 +454,97 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 
 	cOpts := DefaultCompactorOptions()
 	cOpts.NumWorkers = config.NumCompactionWorkers
+	cOpts.Clock = clk
+	cOpts.Rand = newSeededRand(config.RandSeed, 1)
 	compactor := NewCompactor(cOpts)
 	compactor.requeueInterval = config.CompactInterval
 	compactor.Start(bgs)
 	bgs.compactor = compactor
 
+	if config.ScrubInterval > 0 {
+		store, ok := repoman.CarStore().(ShardScrubber)
+		if !ok {
+			return nil, fmt.Errorf("integrity scrubbing is not supported by the configured carstore")
+		}
+		sOpts := DefaultScrubberOptions()
+		sOpts.Interval = config.ScrubInterval
+		sOpts.Rate = config.ScrubRate
+		var repair ShardRepairer
+		if config.ScrubRepair {
+			repair = bgs.repairShard
+		}
+		bgs.scrubStore = store
+		bgs.scrubPeers = config.Sovereign.Peers
+		bgs.scrubber = NewScrubber(store, repair, sOpts)
+		bgs.scrubber.Start()
+	}
+
+	if config.MirrorCheckInterval > 0 {
+		mOpts := DefaultMirrorCheckOptions()
+		mOpts.Interval = config.MirrorCheckInterval
+		if config.MirrorCheckSample > 0 {
+			mOpts.SampleSize = config.MirrorCheckSample
+		}
+		mOpts.Rate = config.MirrorCheckRate
+		mOpts.Resync = config.MirrorCheckResync
+		mOpts.Clock = clk
+		mOpts.Rand = newSeededRand(config.RandSeed, 2)
+		bgs.mirrorChecker = newMirrorChecker(bgs, mOpts)
+		bgs.mirrorChecker.Start()
+	}
+
+	bgs.scaleTargets = config.Scale
+	bgs.scaleStop = make(chan struct{})
+	go bgs.runScaleGauges(bgs.scaleStop)
+
+	bgs.exportOpts = carstream.DefaultOptions()
+	if n := config.RepoExportConcurrency; n > 0 {
+		bgs.exportOpts.Concurrency = n
+		bgs.exportOpts.Window = 8 * n
+	}
+
 	bgs.nextCrawlers = config.NextCrawlers
-	bgs.httpClient.Timeout = time.Second * 5
+	bgs.streamVersions = config.StreamVersions
+	bgs.adminSocket = config.AdminSocket
+
+	if config.AdminWebAuthn != nil {
+		if err := bgs.startAdminWebAuthn(config.AdminWebAuthn); err != nil {
+			return nil, err
+		}
+	}
+
+	bgs.filterCache = config.FilterCache
+	if bgs.filterCache == nil && config.FilterCacheRedisURL != "" {
+		fc, err := sovereignty.NewRedisFilterCache(config.FilterCacheRedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to filter cache: %w", err)
+		}
+		bgs.filterCache = fc
+	}
+	if bgs.filterCache == nil {
+		fc := sovereignty.NewMemFilterCache(filterCacheSize)
+		fc.Clock = clk
+		bgs.filterCache = fc
+	}
+
+	if err := bgs.startSovereignty(&config.Sovereign); err != nil {
+		return nil, err
+	}
 
 	return bgs, nil
 }
 
+// newSeededRand returns a random source for one subsystem, derived from seed and the subsystem's stream number, or nil (the global source) if seed is 0. Each subsystem gets its own, as sources aren't safe for concurrent use
+func newSeededRand(seed, stream uint64) *rand.Rand {
+	if seed == 0 {
+		return nil
+	}
+	return rand.New(rand.NewPCG(seed, stream))
+}
+
 func (bgs *BGS) StartMetrics(listen string) error {
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/debug/features", bgs.handleDebugFeatures)
 	return http.ListenAndServe(listen, nil)
 }
 
@@ -238,36 +583,42 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	e.File("/dash/*", "public/index.html")
 	e.Static("/assets", "public/assets")
 
-	e.Use(svcutil.MetricsMiddleware)
-
-	e.HTTPErrorHandler = func(err error, ctx echo.Context) {
-		switch err := err.(type) {
-		case *echo.HTTPError:
-			if err2 := ctx.JSON(err.Code, map[string]any{
-				"error": err.Message,
-			}); err2 != nil {
-				bgs.log.Error("Failed to write http error", "err", err2)
-			}
-		default:
-			sendHeader := true
-			if ctx.Path() == "/xrpc/com.atproto.sync.subscribeRepos" {
-				sendHeader = false
-			}
-
-			bgs.log.Warn("HANDLER ERROR: (%s) %s", ctx.Path(), err)
-
-			if strings.HasPrefix(ctx.Path(), "/admin/") {
-				ctx.JSON(500, map[string]any{
-					"error": err.Error(),
-				})
-				return
-			}
-
-			if sendHeader {
-				ctx.Response().WriteHeader(500)
-			}
+	if bgs.snapshotDir != "" {
+		e.Static("/sovereignty/snapshots", bgs.snapshotDir)
+	}
+	if bgs.policy.Load().carriesAny() || bgs.policyAuthority != nil {
+		e.GET("/sovereignty/xrpc/com.atproto.sync.subscribeRepos", bgs.SovereignEventsHandler)
+	}
+	e.GET("/sovereignty/priority/xrpc/com.atproto.sync.subscribeRepos", bgs.PriorityEventsHandler)
+	e.GET(orgs.ListPath, bgs.handleListOrgs)
+	if bgs.serviceAuth != nil {
+		e.GET("/xrpc/ca.gander.sovereignty.getStanding", bgs.handleGetStanding)
+		e.POST("/xrpc/ca.gander.sovereignty.submitAppeal", bgs.handleSubmitAppeal)
+	}
+	if bgs.transcoder != nil {
+		e.POST(transcodeCallbackPath, bgs.handleTranscodeCallback)
+		e.GET("/xrpc/ca.gander.video.getPlaylist", bgs.handleGetPlaylist)
+	}
+	if bgs.langStats != nil {
+		e.GET("/xrpc/ca.gander.sovereignty.getLanguageStats", bgs.handleGetLanguageStats)
+	}
+	if bgs.selfRepo != nil {
+		e.GET("/.well-known/did.json", bgs.handleSelfDIDDocument)
+		e.GET("/.well-known/atproto-did", bgs.handleSelfAtprotoDID)
+		e.GET("/xrpc/com.atproto.repo.getRecord", bgs.handleSelfGetRecord)
+		e.GET("/xrpc/com.atproto.repo.listRecords", bgs.handleSelfListRecords)
+		if bgs.handleChecks != nil {
+			e.GET("/xrpc/com.atproto.label.queryLabels", bgs.handleQueryLabels)
 		}
 	}
+	if bgs.beacon != nil {
+		e.POST(peering.BeaconPath, bgs.handlePeeringBeacon)
+		e.GET(peering.MeshPath, bgs.handlePeeringMesh)
+	}
+
+	e.Use(svcutil.MetricsMiddleware)
+
+	e.HTTPErrorHandler = bgs.handleHTTPError
 
 	// TODO: this API is temporary until we formalize what we want here
 
@@ -279,13 +630,82 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	e.POST("/xrpc/com.atproto.sync.requestCrawl", bgs.HandleComAtprotoSyncRequestCrawl)
 	e.GET("/xrpc/com.atproto.sync.listRepos", bgs.HandleComAtprotoSyncListRepos)
 	e.GET("/xrpc/com.atproto.sync.getLatestCommit", bgs.HandleComAtprotoSyncGetLatestCommit)
+	e.GET("/xrpc/com.atproto.sync.getHead", bgs.HandleComAtprotoSyncGetHead)
+	e.GET("/xrpc/com.atproto.sync.getCheckout", bgs.HandleComAtprotoSyncGetCheckout)
 	e.GET("/xrpc/com.atproto.sync.notifyOfUpdate", bgs.HandleComAtprotoSyncNotifyOfUpdate)
+	e.GET("/xrpc/com.atproto.server.describeServer", bgs.HandleDescribeServer)
 	e.GET("/xrpc/_health", bgs.HandleHealthCheck)
 	e.GET("/_health", bgs.HandleHealthCheck)
+	e.GET("/scale-advice", bgs.handleScaleAdvice)
 	e.GET("/", bgs.HandleHomeMessage)
 
-	admin := e.Group("/admin", bgs.checkAdminAuth)
+	// the admin API is served here unless it is confined to the admin socket
+	if bgs.adminSocket == nil || !bgs.adminSocket.Exclusive {
+		// hardware-token sign-in and enrollment, which authenticate themselves
+		if bgs.adminWebAuthn != nil {
+			e.POST("/admin/webauthn/register/begin", bgs.handleWebAuthnRegisterBegin)
+			e.POST("/admin/webauthn/register/finish", bgs.handleWebAuthnRegisterFinish)
+			e.POST("/admin/webauthn/login/begin", bgs.handleWebAuthnLoginBegin)
+			e.POST("/admin/webauthn/login/finish", bgs.handleWebAuthnLoginFinish)
+			e.POST("/admin/webauthn/recover", bgs.handleWebAuthnRecover)
+		}
+
+		bgs.registerAdminRoutes(e.Group("/admin", bgs.checkAdminAuth))
+	}
+
+	// In order to support booting on random ports in tests, we need to tell the
+	// Echo instance it's already got a port, and then use its StartServer
+	// method to re-use that listener.
+	e.Listener = listen
+	srv := &http.Server{}
+	return e.StartServer(srv)
+}
 
+// handleHTTPError renders handler errors, as JSON for the admin API. Admin API errors are translated into the request's language
+func (bgs *BGS) handleHTTPError(err error, ctx echo.Context) {
+	switch err := err.(type) {
+	case *echo.HTTPError:
+		msg := err.Message
+		if s, ok := msg.(string); ok && strings.HasPrefix(ctx.Path(), "/admin/") {
+			lang := bgs.requestLang(ctx)
+			msg = i18n.Translate(lang, s)
+			ctx.Response().Header().Set("Content-Language", string(lang))
+		}
+		if err2 := ctx.JSON(err.Code, map[string]any{
+			"error": msg,
+		}); err2 != nil {
+			bgs.log.Error("Failed to write http error", "err", err2)
+		}
+	default:
+		// subscribeRepos handlers (the firehose, and its sovereign variants) have hijacked the connection by the time they fail
+		sendHeader := !strings.HasSuffix(ctx.Path(), "/com.atproto.sync.subscribeRepos")
+
+		bgs.log.Warn("HANDLER ERROR: (%s) %s", ctx.Path(), err)
+
+		if strings.HasPrefix(ctx.Path(), "/admin/") {
+			ctx.JSON(500, map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if sendHeader {
+			ctx.Response().WriteHeader(500)
+		}
+	}
+}
+
+// requestLang returns the language to answer a request in, from its Accept-Language header or the configured language
+func (bgs *BGS) requestLang(ctx echo.Context) i18n.Lang {
+	fallback := bgs.lang
+	if fallback == "" {
+		fallback = i18n.English
+	}
+	return i18n.Negotiate(ctx.Request().Header.Get("Accept-Language"), fallback)
+}
+
+// registerAdminRoutes adds the admin API to a group, which handles authentication
+func (bgs *BGS) registerAdminRoutes(admin *echo.Group) {
 	// Slurper-related Admin API
 	admin.GET("/subs/getUpstreamConns", bgs.handleAdminGetUpstreamConns)
 	admin.GET("/subs/getEnabled", bgs.handleAdminGetSubsEnabled)
@@ -307,6 +727,8 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	admin.POST("/repo/compactAll", bgs.handleAdminCompactAllRepos)
 	admin.POST("/repo/reset", bgs.handleAdminResetRepo)
 	admin.POST("/repo/verify", bgs.handleAdminVerifyRepo)
+	admin.POST("/repo/refreshIdentity", bgs.handleAdminRefreshIdentity)
+	admin.GET("/repo/identityRefreshes", bgs.handleAdminListIdentityRefreshes)
 
 	// PDS-related Admin API
 	admin.POST("/pds/requestCrawl", bgs.handleAdminRequestCrawl)
@@ -321,15 +743,99 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	// Consumer-related Admin API
 	admin.GET("/consumers/list", bgs.handleAdminListConsumers)
 
-	// In order to support booting on random ports in tests, we need to tell the
-	// Echo instance it's already got a port, and then use its StartServer
-	// method to re-use that listener.
-	e.Listener = listen
-	srv := &http.Server{}
-	return e.StartServer(srv)
+	// Sovereignty-related Admin API
+	admin.GET("/sovereignty/classification", bgs.handleAdminGetClassification)
+	admin.POST("/sovereignty/classify", bgs.handleAdminClassify)
+	admin.POST("/sovereignty/classify/pds", bgs.handleAdminClassifyPDS)
+	admin.POST("/sovereignty/classify/resolve", bgs.handleAdminResolveCountry)
+	admin.POST("/sovereignty/unclassify", bgs.handleAdminUnclassify)
+	admin.POST("/sovereignty/import", bgs.handleAdminImportClassifications)
+	admin.GET("/sovereignty/export", bgs.handleAdminExportClassifications)
+	admin.GET("/sovereignty/filter-state", bgs.handleAdminExportFilterState)
+	admin.POST("/sovereignty/filter-state", bgs.handleAdminImportFilterState)
+	admin.GET("/sovereignty/classifications", bgs.handleAdminListClassifications)
+	admin.POST("/sovereignty/classifications/query", bgs.handleAdminQueryClassifications)
+	admin.GET("/sovereignty/talkers", bgs.handleAdminTopTalkers)
+	admin.GET("/sovereignty/profiles", bgs.handleAdminListSubscriberProfiles)
+	admin.POST("/sovereignty/profiles", bgs.handleAdminPutSubscriberProfile)
+	admin.POST("/sovereignty/profiles/remove", bgs.handleAdminRemoveSubscriberProfile)
+	admin.GET("/sovereignty/subscribers", bgs.handleAdminListSubscribers)
+	admin.POST("/sovereignty/subscribers/issue", bgs.handleAdminIssueSubscriberToken)
+	admin.POST("/sovereignty/subscribers/assign", bgs.handleAdminAssignSubscriberProfile)
+	admin.POST("/sovereignty/subscribers/revoke", bgs.handleAdminRevokeSubscriberToken)
+	admin.GET("/sovereignty/extensions", bgs.handleAdminListExtensions)
+	admin.POST("/sovereignty/extensions/reload", bgs.handleAdminReloadExtensions)
+	admin.GET("/sovereignty/filter-plugin", bgs.handleAdminFilterPluginStatus)
+	admin.POST("/sovereignty/filter-plugin/forget", bgs.handleAdminForgetFilterPlugin)
+	admin.GET("/sovereignty/dids", bgs.handleAdminListedDIDs)
+	admin.POST("/sovereignty/dids", bgs.handleAdminListDID)
+	admin.POST("/sovereignty/dids/remove", bgs.handleAdminUnlistDID)
+	admin.GET("/sovereignty/lists", bgs.handleAdminDIDLists)
+	admin.POST("/sovereignty/lists/reload", bgs.handleAdminReloadDIDLists)
+	admin.GET("/sovereignty/flapping", bgs.handleAdminFlapping)
+	admin.POST("/sovereignty/flapping/release", bgs.handleAdminReleaseFlapping)
+	admin.GET("/sovereignty/shadow", bgs.handleAdminShadowDecisions)
+	admin.GET("/sovereignty/verification", bgs.handleAdminVerificationStatus)
+	admin.POST("/sovereignty/verification/forget", bgs.handleAdminForgetVerification)
+	admin.GET("/sovereignty/prescreen", bgs.handleAdminPreScreenQueue)
+	admin.POST("/sovereignty/prescreen/decide", bgs.handleAdminPreScreenDecide)
+	admin.GET("/sovereignty/prescreen/watchlist", bgs.handleAdminPreScreenWatchlist)
+	admin.POST("/sovereignty/prescreen/watchlist", bgs.handleAdminPreScreenWatch)
+	admin.POST("/sovereignty/prescreen/watchlist/remove", bgs.handleAdminPreScreenUnwatch)
+	admin.GET("/sovereignty/declarations", bgs.handleAdminResidencyDeclarations)
+	admin.GET("/sovereignty/lexicons", bgs.handleAdminLexicons)
+	admin.POST("/sovereignty/lexicons/reload", bgs.handleAdminReloadLexicons)
+	admin.GET("/sovereignty/invalid-records", bgs.handleAdminInvalidRecords)
+	admin.GET("/sovereignty/forensics", bgs.handleAdminListForensics)
+	admin.GET("/sovereignty/forensics/bundle", bgs.handleAdminGetForensicBundle)
+	admin.POST("/sovereignty/forensics/capture", bgs.handleAdminForensicCapture)
+	admin.GET("/sovereignty/minors", bgs.handleAdminListMinors)
+	admin.POST("/sovereignty/minors/label", bgs.handleAdminMinorLabel)
+	admin.GET("/sovereignty/priority", bgs.handleAdminListPriority)
+	admin.POST("/sovereignty/priority/add", bgs.handleAdminAddPriority)
+	admin.POST("/sovereignty/priority/remove", bgs.handleAdminRemovePriority)
+	admin.GET("/sovereignty/priority/audit", bgs.handleAdminPriorityAudit)
+	admin.POST("/sovereignty/orgs/verify", bgs.handleAdminVerifyOrg)
+	admin.POST("/sovereignty/orgs/remove", bgs.handleAdminRemoveOrg)
+	admin.GET("/sovereignty/appeals", bgs.handleAdminListAppeals)
+	admin.GET("/sovereignty/appeals/audit", bgs.handleAdminAppealAudit)
+	admin.POST("/sovereignty/appeals/assign", bgs.handleAdminAssignAppeal)
+	admin.POST("/sovereignty/appeals/resolve", bgs.handleAdminResolveAppeal)
+	admin.GET("/sovereignty/policy", bgs.handleAdminGetPolicy)
+	admin.POST("/sovereignty/policy", bgs.handleAdminApplyPolicy)
+	admin.GET("/sovereignty/policy/history", bgs.handleAdminPolicyHistory)
+	admin.GET("/sovereignty/policy/ramp", bgs.handleAdminPolicyRamp)
+	admin.GET("/sovereignty/blobs/violations", bgs.handleAdminBlobViolations)
+	admin.GET("/sovereignty/handles/failing", bgs.handleAdminFailingHandles)
+	admin.GET("/sovereignty/handles/status", bgs.handleAdminHandleStatus)
+	admin.POST("/sovereignty/handles/check", bgs.handleAdminCheckHandle)
+	admin.GET("/sovereignty/plc/audit", bgs.handleAdminPLCAudit)
+	admin.GET("/sovereignty/plc/flagged", bgs.handleAdminFlaggedPLCAudits)
+	admin.GET("/webauthn/credentials", bgs.handleAdminListCredentials)
+	admin.POST("/webauthn/credentials/remove", bgs.handleAdminRemoveCredential)
+	admin.POST("/webauthn/recovery-codes", bgs.handleAdminRegenerateRecoveryCodes)
+	admin.POST("/webauthn/logout", bgs.handleAdminLogout)
+	admin.GET("/features", bgs.handleAdminListFeatures)
+	admin.POST("/features/set", bgs.handleAdminSetFeature)
+	admin.POST("/features/reset", bgs.handleAdminResetFeature)
+	admin.GET("/sovereignty/holds", bgs.handleAdminListLegalHolds)
+	admin.POST("/sovereignty/holds/place", bgs.handleAdminPlaceLegalHold)
+	admin.POST("/sovereignty/holds/release", bgs.handleAdminReleaseLegalHold)
+	admin.GET("/sovereignty/holds/audit", bgs.handleAdminLegalHoldAudit)
+	admin.GET("/sovereignty/holds/conflicts", bgs.handleAdminLegalHoldConflicts)
+	admin.GET("/sovereignty/report", bgs.handleAdminComplianceReport)
+	admin.GET("/sovereignty/audit", bgs.handleAdminAuditLog)
+	admin.POST("/encryption/rewrap", bgs.handleAdminRewrapKeys)
+	admin.GET("/sequencer", bgs.handleAdminSequencer)
+	admin.GET("/scrub", bgs.handleAdminScrubStatus)
+	admin.POST("/scrub/start", bgs.handleAdminStartScrub)
+	admin.GET("/mirror/check", bgs.handleAdminMirrorCheckStatus)
+	admin.POST("/mirror/check/start", bgs.handleAdminStartMirrorCheck)
 }
 
 func (bgs *BGS) Shutdown() []error {
+	bgs.drainConsumers()
+
 	errs := bgs.slurper.Shutdown()
 
 	if err := bgs.events.Shutdown(context.TODO()); err != nil {
@@ -338,6 +844,22 @@ func (bgs *BGS) Shutdown() []error {
 
 	bgs.compactor.Shutdown()
 
+	if bgs.scrubber != nil {
+		bgs.scrubber.Shutdown()
+	}
+
+	if bgs.mirrorChecker != nil {
+		bgs.mirrorChecker.Shutdown()
+	}
+
+	close(bgs.scaleStop)
+
+	bgs.stopSovereignty()
+
+	if err := bgs.stopAdminSocket(); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
 
@@ -420,7 +942,7 @@ func (bgs *BGS) checkAdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
 
 		token := authheader[len(pref):]
 
-		exists, err := bgs.lookupAdminToken(token)
+		exists, err := bgs.validAdminToken(ctx, token, false)
 		if err != nil {
 			return err
 		}
@@ -528,18 +1050,61 @@ func (bgs *BGS) cleanupConsumer(id uint64) {
 }
 
 func (bgs *BGS) EventsHandler(c echo.Context) error {
+	return bgs.serveEvents(c, streamOptions{
+		filter: func(evt *events.XRPCStreamEvent) bool { return true },
+	})
+}
+
+// streamOptions customizes the stream served by serveEvents
+type streamOptions struct {
+	// only events passing filter are sent
+	filter func(*events.XRPCStreamEvent) bool
+	// if non-nil, applied to each event before sending
+	transform func(*events.XRPCStreamEvent) (*events.XRPCStreamEvent, error)
+	// if non-nil, parses the cursor parameter in place of an integer seq; a returned error frame is sent to the consumer instead of the stream
+	parseCursor func(string) (int64, *events.ErrorFrame)
+	// if non-nil, applied to each outbound frame after transform
+	stamp func(*events.XRPCStreamEvent) *events.XRPCStreamEvent
+	// if positive, events are read from the persister, each sent once it is this old
+	delay time.Duration
+}
+
+// serveEvents streams events to a websocket consumer. Consumers can subscribe to some collections with the collection parameter, which may be repeated, in which case commits touching none of them are left out.
+func (bgs *BGS) serveEvents(c echo.Context, opts streamOptions) error {
+	declared := c.QueryParam(events.StreamVersionParam)
+	if declared == "" {
+		declared = c.Request().Header.Get(events.StreamVersionHeader)
+	}
+	negotiated, rejection := bgs.streamVersions.Negotiate(declared)
+	if negotiated != nil {
+		c.Response().Header().Set(events.StreamVersionHeader, strconv.FormatInt(negotiated.Version, 10))
+	}
+
 	var since *int64
-	if sinceVal := c.QueryParam("cursor"); sinceVal != "" {
-		sval, err := strconv.ParseInt(sinceVal, 10, 64)
-		if err != nil {
-			return err
+	if sinceVal := c.QueryParam("cursor"); sinceVal != "" && rejection == nil {
+		if opts.parseCursor != nil {
+			sval, ef := opts.parseCursor(sinceVal)
+			since, rejection = &sval, ef
+		} else {
+			sval, err := strconv.ParseInt(sinceVal, 10, 64)
+			if err != nil {
+				return err
+			}
+			since = &sval
 		}
-		since = &sval
+	}
+
+	match, err := namespaces.Matcher(c.QueryParams()["collection"])
+	if err != nil {
+		return &echo.HTTPError{Code: 400, Message: err.Error()}
 	}
 
 	ctx, cancel := context.WithCancel(c.Request().Context())
 	defer cancel()
 
+	bgs.consumersWg.Add(1)
+	defer bgs.consumersWg.Done()
+
 	// TODO: authhhh
 	conn, err := websocket.Upgrade(c.Response(), c.Request(), c.Response().Header(), 10<<10, 10<<10)
 	if err != nil {
@@ -548,6 +1113,18 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 
 	defer conn.Close()
 
+	if rejection != nil {
+		wc, err := conn.NextWriter(websocket.BinaryMessage)
+		if err != nil {
+			return err
+		}
+		evt := &events.XRPCStreamEvent{Error: rejection}
+		if err := evt.Serialize(wc); err != nil {
+			return fmt.Errorf("failed to write cursor error frame: %w", err)
+		}
+		return wc.Close()
+	}
+
 	lastWriteLk := sync.Mutex{}
 	lastWrite := time.Now()
 
@@ -604,7 +1181,19 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 
 	ident := c.RealIP() + "-" + c.Request().UserAgent()
 
-	evts, cleanup, err := bgs.events.Subscribe(ctx, ident, func(evt *events.XRPCStreamEvent) bool { return true }, since)
+	var evts <-chan *events.XRPCStreamEvent
+	var cleanup func()
+	if opts.delay > 0 {
+		filter := opts.filter
+		if match != nil {
+			filter = func(evt *events.XRPCStreamEvent) bool {
+				return evt.MatchesPaths(match) && (opts.filter == nil || opts.filter(evt))
+			}
+		}
+		evts, cleanup, err = bgs.events.SubscribeDelayed(ctx, ident, filter, since, opts.delay)
+	} else {
+		evts, cleanup, err = bgs.events.SubscribePaths(ctx, ident, opts.filter, match, since)
+	}
 	if err != nil {
 		return err
 	}
@@ -612,9 +1201,10 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 
 	// Keep track of the consumer for metrics and admin endpoints
 	consumer := SocketConsumer{
-		RemoteAddr:  c.RealIP(),
-		UserAgent:   c.Request().UserAgent(),
-		ConnectedAt: time.Now(),
+		RemoteAddr:      c.RealIP(),
+		UserAgent:       c.Request().UserAgent(),
+		ConnectedAt:     time.Now(),
+		ProtocolVersion: negotiated.Label(),
 	}
 	sentCounter := eventsSentCounter.WithLabelValues(consumer.RemoteAddr, consumer.UserAgent)
 	consumer.EventsSent = sentCounter
@@ -628,7 +1218,24 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 		"user_agent", consumer.UserAgent,
 	)
 
-	logger.Info("new consumer", "cursor", since)
+	logger.Info("new consumer", "cursor", since, "protocol_version", consumer.ProtocolVersion)
+	streamConsumerConnections.WithLabelValues(consumer.ProtocolVersion).Inc()
+	streamConsumersByVersion.WithLabelValues(consumer.ProtocolVersion).Inc()
+	defer streamConsumersByVersion.WithLabelValues(consumer.ProtocolVersion).Dec()
+
+	for _, info := range negotiated.Info {
+		wc, err := conn.NextWriter(websocket.BinaryMessage)
+		if err != nil {
+			return err
+		}
+		evt := &events.XRPCStreamEvent{RepoInfo: info}
+		if err := evt.Serialize(wc); err != nil {
+			return fmt.Errorf("failed to write info frame: %w", err)
+		}
+		if err := wc.Close(); err != nil {
+			return err
+		}
+	}
 
 	for {
 		select {
@@ -638,6 +1245,17 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 				return nil
 			}
 
+			if opts.transform != nil {
+				evt, err = opts.transform(evt)
+				if err != nil {
+					logger.Error("failed to transform outbound event", "err", err)
+					continue
+				}
+			}
+			if opts.stamp != nil {
+				evt = opts.stamp(evt)
+			}
+
 			wc, err := conn.NextWriter(websocket.BinaryMessage)
 			if err != nil {
 				logger.Error("failed to get next writer", "err", err)
@@ -662,6 +1280,16 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 			lastWrite = time.Now()
 			lastWriteLk.Unlock()
 			sentCounter.Inc()
+		case <-bgs.shutdownCh:
+			wc, err := conn.NextWriter(websocket.BinaryMessage)
+			if err != nil {
+				return err
+			}
+			evt := &events.XRPCStreamEvent{Error: events.ShutdownErrorFrame(bgs.alternates)}
+			if err := evt.Serialize(wc); err != nil {
+				return fmt.Errorf("failed to write shutdown frame: %w", err)
+			}
+			return wc.Close()
 		case <-ctx.Done():
 			return nil
 		}
@@ -754,6 +1382,16 @@ func (bgs *BGS) lookupUserByUID(ctx context.Context, uid models.Uid) (*User, err
 	return &u, nil
 }
 
+// pdsClient returns an XRPC client for a PDS, with the operator's PDS client settings, on the crawler profile unless those pick another
+func (bgs *BGS) pdsClient(pds *models.PDS) *xrpc.Client {
+	c := models.ClientForPds(pds)
+	bgs.Index.ApplyPDSClientSettings(c)
+	if c.Client == nil {
+		bgs.httpClients.ApplyXRPC(httpprofile.Crawler, c)
+	}
+	return c
+}
+
 func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *events.XRPCStreamEvent) error {
 	ctx, span := tracer.Start(ctx, "handleFedEvent")
 	defer span.End()
@@ -764,6 +1402,12 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 	}()
 
 	eventsReceivedCounter.WithLabelValues(host.Host).Add(1)
+	if bgs.talkers != nil {
+		bgs.countTalker(host, env)
+	}
+	if bgs.forensics != nil {
+		bgs.forensics.RecordFrame(host.Host, env)
+	}
 
 	switch {
 	case env.RepoCommit != nil:
@@ -901,6 +1545,20 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 			return fmt.Errorf("handle user event failed: %w", err)
 		}
 
+		if bgs.minors != nil {
+			bgs.observeMinorCommit(ctx, evt)
+		}
+		if bgs.residencyQueue != nil {
+			bgs.observeResidencyCommit(evt)
+		}
+		if bgs.blobPolicy != nil || bgs.transcoder != nil {
+			bgs.observeBlobs(ctx, host, evt)
+		}
+		if bgs.langStats != nil {
+			bgs.observeLangStats(evt)
+		}
+		bgs.observeIngestLag(evt.Time)
+
 		repoCommitsResultCounter.WithLabelValues(host.Host, "ok").Inc()
 		return nil
 	case env.RepoIdentity != nil:
@@ -914,6 +1572,14 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 			return err
 		}
 
+		// re-verify the handles of tracked accounts, rather than waiting for their next scheduled check
+		if bgs.handleChecks != nil {
+			if _, ok := bgs.Classifications.Get(env.RepoIdentity.Did); ok {
+				bgs.handleChecks.Enqueue(env.RepoIdentity.Did)
+			}
+		}
+		bgs.enqueuePLCAudit(env.RepoIdentity.Did)
+
 		// Broadcast the identity event to all consumers
 		err = bgs.events.AddEvent(ctx, &events.XRPCStreamEvent{
 			RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{
@@ -1225,6 +1891,7 @@ func (s *BGS) createExternalUser(ctx context.Context, did string) (*models.Actor
 			return nil, fmt.Errorf("failed to create other pds user: %w", err)
 		}
 	}
+	s.holds.noteAccount(did, u.ID)
 
 	// okay cool, its a user on a server we are peered with
 	// lets make a local record of that user for the future
@@ -1306,7 +1973,10 @@ func (bgs *BGS) UpdateAccountStatus(ctx context.Context, did string, status stri
 			return err
 		}
 
-		// delete data from carstore
+		// delete data from carstore, unless a legal hold defers it
+		if bgs.legalHoldConflict(ctx, u.Did, holdWorkflowDeletion, true) != nil {
+			break
+		}
 		if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
 			// don't let a failure here prevent us from propagating this event
 			bgs.log.Error("failed to delete user data from carstore", "err", err)
@@ -1316,26 +1986,36 @@ func (bgs *BGS) UpdateAccountStatus(ctx context.Context, did string, status stri
 	return nil
 }
 
-func (bgs *BGS) TakeDownRepo(ctx context.Context, did string) error {
+// TakeDownRepo hides the account's events from playback and erases its data. If legal holds cover some of that data, it is kept and the returned conflict lists the holds; the erasure runs once they are released.
+func (bgs *BGS) TakeDownRepo(ctx context.Context, did string) (*LegalHoldConflict, error) {
 	u, err := bgs.lookupUserByDid(ctx, did)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := bgs.db.Model(User{}).Where("id = ?", u.ID).Update("taken_down", true).Error; err != nil {
-		return err
+		return nil, err
 	}
 	u.SetTakenDown(true)
 
-	if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
-		return err
+	// held data stays put until the holds are released; the disk persister keeps held events while hiding them
+	conflict := bgs.legalHoldConflict(ctx, did, holdWorkflowTakedown, true)
+	if conflict == nil || !conflict.RepoHeld {
+		if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := bgs.events.TakeDownRepo(ctx, u.ID); err != nil {
-		return err
+		return nil, err
+	}
+	if bgs.prescreen != nil {
+		if n := bgs.prescreen.DropAccount(did); n > 0 {
+			bgs.log.Info("dropped taken down account's pre-screened events", "did", did, "count", n)
+		}
 	}
 
-	return nil
+	return conflict, nil
 }
 
 func (bgs *BGS) ReverseTakedown(ctx context.Context, did string) error {
@@ -1437,42 +2117,38 @@ func (bgs *BGS) ResyncPDS(ctx context.Context, pds models.PDS) error {
 	bgs.Index.ApplyPDSClientSettings(&xrpcc)
 
 	limiter := rate.NewLimiter(rate.Limit(50), 1)
-	cursor := ""
 	limit := int64(500)
+	listRepos := func(ctx context.Context, cursor string) ([]*comatproto.SyncListRepos_Repo, *string, error) {
+		repoList, err := comatproto.SyncListRepos(ctx, &xrpcc, cursor, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repoList.Repos, repoList.Cursor, nil
+	}
 
 	repos := []comatproto.SyncListRepos_Repo{}
 
 	pages := 0
 
 	resync = bgs.SetResyncStatus(pds.ID, "listing repos")
-	for {
-		pages++
+	for page, err := range lexutil.Pages(ctx, listRepos, lexutil.PaginateOptions{Limiter: limiter}) {
+		if err != nil {
+			log.Error("failed to list repos", "error", err)
+			return fmt.Errorf("failed to list repos: %w", err)
+		}
+		pages = page.Number
 		if pages%10 == 0 {
 			log.Warn("fetching PDS page during resync", "pages", pages, "total_repos", len(repos))
 			resync.NumRepoPages = pages
 			resync.NumRepos = len(repos)
 			bgs.UpdateResync(resync)
 		}
-		if err := limiter.Wait(ctx); err != nil {
-			log.Error("failed to wait for rate limiter", "error", err)
-			return fmt.Errorf("failed to wait for rate limiter: %w", err)
-		}
-		repoList, err := comatproto.SyncListRepos(ctx, &xrpcc, cursor, limit)
-		if err != nil {
-			log.Error("failed to list repos", "error", err)
-			return fmt.Errorf("failed to list repos: %w", err)
-		}
 
-		for _, r := range repoList.Repos {
+		for _, r := range page.Items {
 			if r != nil {
 				repos = append(repos, *r)
 			}
 		}
-
-		if repoList.Cursor == nil || *repoList.Cursor == "" {
-			break
-		}
-		cursor = *repoList.Cursor
 	}
 
 	resync.NumRepoPages = pages
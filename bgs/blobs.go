@@ -0,0 +1,189 @@
+package bgs
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/url"
+	"strconv"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/blobs"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+const transcodeCallbackPath = "/sovereignty/transcode/callback"
+
+// observeBlobs checks the blobs referenced by a mirrored commit against the blob policy, and hands new video blobs off for transcoding
+func (bgs *BGS) observeBlobs(ctx context.Context, host *models.PDS, evt *comatproto.SyncSubscribeRepos_Commit) {
+	refs, err := blobs.Refs(evt)
+	if err != nil {
+		bgs.log.Warn("failed to read blob references", "did", evt.Repo, "seq", evt.Seq, "err", err)
+		return
+	}
+	for _, ref := range refs {
+		if bgs.blobPolicy != nil {
+			if reason := bgs.blobPolicy.Check(ref.Blob); reason != "" {
+				blobPolicyViolations.WithLabelValues(reason).Inc()
+				v := models.BlobViolation{
+					Did:      evt.Repo,
+					Path:     ref.Path,
+					Cid:      ref.Blob.Ref.String(),
+					MimeType: ref.Blob.MimeType,
+					Size:     ref.Blob.Size,
+					Reason:   reason,
+				}
+				if err := bgs.db.WithContext(ctx).Create(&v).Error; err != nil {
+					bgs.log.Error("failed to record blob policy violation", "did", evt.Repo, "err", err)
+				}
+				// non-conforming blobs aren't worth transcoding
+				continue
+			}
+		}
+		if bgs.transcoder != nil && blobs.IsVideo(ref.Blob) {
+			bgs.queueTranscode(ctx, host, evt.Repo, ref)
+		}
+	}
+}
+
+// queueTranscode hands a video blob off to the transcoding service, unless it was already
+func (bgs *BGS) queueTranscode(ctx context.Context, host *models.PDS, did string, ref blobs.Ref) {
+	row := models.VideoPlaylist{
+		Did:      did,
+		Cid:      ref.Blob.Ref.String(),
+		MimeType: ref.Blob.MimeType,
+		Size:     ref.Blob.Size,
+		Status:   blobs.StatusQueued,
+	}
+	res := bgs.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if res.Error != nil {
+		bgs.log.Error("failed to record transcoding job", "did", did, "cid", row.Cid, "err", res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		// the same blob referenced again, eg by a record update
+		return
+	}
+
+	source := models.ClientForPds(host).Host + "/xrpc/com.atproto.sync.getBlob?" + url.Values{"did": {did}, "cid": {row.Cid}}.Encode()
+	if !bgs.transcoder.Enqueue(blobs.Job{Did: did, Cid: row.Cid, MimeType: row.MimeType, Size: row.Size, Source: source}) {
+		bgs.log.Warn("transcoding queue full, dropping job", "did", did, "cid", row.Cid)
+		// forget the job, so a later reference to the blob queues it again
+		bgs.db.WithContext(ctx).Unscoped().Delete(&row)
+	}
+}
+
+// handleTranscodeCallback records the result of a transcoding job, as reported by the transcoding service
+func (bgs *BGS) handleTranscodeCallback(e echo.Context) error {
+	token, ok := strings.CutPrefix(e.Request().Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(bgs.transcoder.Secret)) != 1 {
+		return &echo.HTTPError{
+			Code:    401,
+			Message: "invalid transcoding service credentials",
+		}
+	}
+	var body blobs.Result
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Status != blobs.StatusReady && body.Status != blobs.StatusFailed {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "status must be 'ready' or 'failed'",
+		}
+	}
+	if body.Status == blobs.StatusReady && body.Playlist == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "ready jobs must include a playlist",
+		}
+	}
+
+	res := bgs.db.WithContext(e.Request().Context()).Model(&models.VideoPlaylist{}).
+		Where("did = ? AND cid = ?", body.Did, body.Cid).
+		Updates(map[string]any{"status": body.Status, "playlist": body.Playlist, "error": body.Error})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no such transcoding job",
+		}
+	}
+	return e.NoContent(200)
+}
+
+type playlistView struct {
+	Did      string `json:"did"`
+	Cid      string `json:"cid"`
+	Status   string `json:"status"`
+	Playlist string `json:"playlist,omitempty"`
+}
+
+// handleGetPlaylist serves ca.gander.video.getPlaylist, the transcoding status and playlist reference of a video blob, for the AppView
+func (bgs *BGS) handleGetPlaylist(e echo.Context) error {
+	did, err := syntax.ParseDID(e.QueryParam("did"))
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify a valid 'did'",
+		}
+	}
+	cid := e.QueryParam("cid")
+	if cid == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify a 'cid'",
+		}
+	}
+	var row models.VideoPlaylist
+	res := bgs.db.WithContext(e.Request().Context()).Where("did = ? AND cid = ?", did.String(), cid).Limit(1).Find(&row)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "video not found",
+		}
+	}
+	return e.JSON(200, playlistView{
+		Did:      row.Did,
+		Cid:      row.Cid,
+		Status:   row.Status,
+		Playlist: row.Playlist,
+	})
+}
+
+// handleAdminBlobViolations lists recorded blob policy violations, newest first
+func (bgs *BGS) handleAdminBlobViolations(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc").Limit(limit)
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	if reason := e.QueryParam("reason"); reason != "" {
+		q = q.Where("reason = ?", reason)
+	}
+	var out []models.BlobViolation
+	if err := q.Find(&out).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,232 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// SetClassifications persists a batch of classifications and updates the in-memory table.
+func (bgs *BGS) SetClassifications(ctx context.Context, batch []sovereignty.Classification) error {
+	rows := make([]models.DIDClassification, len(batch))
+	for i, c := range batch {
+		rows[i] = models.DIDClassification{
+			Did:         c.DID,
+			Country:     c.Country,
+			Subdivision: c.Subdivision,
+			Source:      c.Source,
+			ExpiresAt:   c.ExpiresAt,
+			Confidence:  int(c.Confidence),
+		}
+		rows[i].UpdatedAt = c.UpdatedAt
+	}
+	if err := bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"country", "subdivision", "source", "expires_at", "updated_at", "confidence"}),
+	}).Create(&rows).Error; err != nil {
+		return err
+	}
+	bgs.Classifications.ApplyBatch(batch, nil)
+	return nil
+}
+
+// handleAdminImportClassifications bulk-imports classifications from the request body (CSV or JSONL, per the "format" query parameter). With dryRun=true, only reports what would change.
+func (bgs *BGS) handleAdminImportClassifications(e echo.Context) error {
+	ctx := e.Request().Context()
+	format := e.QueryParam("format")
+	if format == "" {
+		format = sovereignty.FormatCSV
+	}
+	if err := sovereignty.ValidFormat(format); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	dryRun, _ := strconv.ParseBool(e.QueryParam("dryRun"))
+	source := e.QueryParam("source")
+	if source == "" {
+		source = "import"
+	}
+
+	start := time.Now()
+	im := sovereignty.Importer{
+		Table:         bgs.Classifications,
+		DefaultSource: source,
+		DryRun:        dryRun,
+		BatchSize:     1000,
+		Apply: func(batch []sovereignty.Classification) error {
+			return bgs.SetClassifications(ctx, batch)
+		},
+		ProgressEvery: 100_000,
+		Progress: func(rep *sovereignty.ImportReport) {
+			bgs.log.Info("classification import progress", "rows", rep.Rows, "added", rep.Added, "changed", rep.Changed, "invalid", rep.Invalid, "dry_run", dryRun, "elapsed", time.Since(start))
+		},
+	}
+	rep, err := im.Run(e.Request().Body, format)
+	if err != nil {
+		return fmt.Errorf("classification import failed after %d rows: %w", rep.Rows, err)
+	}
+	bgs.log.Info("classification import finished", "rows", rep.Rows, "added", rep.Added, "changed", rep.Changed, "unchanged", rep.Unchanged, "duplicates", rep.Duplicates, "invalid", rep.Invalid, "dry_run", dryRun, "elapsed", time.Since(start))
+	return e.JSON(200, rep)
+}
+
+// handleAdminExportClassifications streams the classification table (CSV or JSONL), optionally filtered by country, source, and update time
+func (bgs *BGS) handleAdminExportClassifications(e echo.Context) error {
+	format := e.QueryParam("format")
+	if format == "" {
+		format = sovereignty.FormatCSV
+	}
+	if err := sovereignty.ValidFormat(format); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	var filter sovereignty.ExportFilter
+	if c := e.QueryParam("country"); c != "" {
+		country, err := sovereignty.NormalizeCountry(c)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+		filter.Country = country
+	}
+	filter.Source = e.QueryParam("source")
+	if s := e.QueryParam("since"); s != "" {
+		since, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid since (expected RFC 3339): %s", err),
+			}
+		}
+		filter.Since = since
+	}
+
+	contentType := "text/csv"
+	if format == sovereignty.FormatJSONL {
+		contentType = "application/jsonl"
+	}
+	e.Response().Header().Set(echo.HeaderContentType, contentType)
+	e.Response().WriteHeader(200)
+	n, err := sovereignty.Export(e.Response(), format, bgs.Classifications.Snapshot(), filter)
+	if err != nil {
+		bgs.log.Warn("classification export failed", "written", n, "err", err)
+		return nil
+	}
+	bgs.log.Info("classification export finished", "rows", n)
+	return nil
+}
+
+type listClassificationsResponse struct {
+	Classifications []sovereignty.Classification `json:"classifications"`
+	// DID to pass as the cursor for the next page; empty on the last page
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// handleAdminListClassifications pages through the persisted classifications in DID order, optionally filtered by country and source. Expired classifications are left out.
+func (bgs *BGS) handleAdminListClassifications(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	q := bgs.db.WithContext(e.Request().Context()).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("did").
+		Limit(limit)
+	if c := e.QueryParam("country"); c != "" {
+		country, err := sovereignty.NormalizeCountry(c)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+		q = q.Where("country = ?", country)
+	}
+	if source := e.QueryParam("source"); source != "" {
+		q = q.Where("source = ?", source)
+	}
+	if cursor := e.QueryParam("cursor"); cursor != "" {
+		q = q.Where("did > ?", cursor)
+	}
+	var rows []models.DIDClassification
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+
+	out := listClassificationsResponse{
+		Classifications: make([]sovereignty.Classification, len(rows)),
+	}
+	for i, r := range rows {
+		out.Classifications[i] = sovereignty.Classification{
+			DID:         r.Did,
+			Country:     r.Country,
+			Subdivision: r.Subdivision,
+			Source:      r.Source,
+			UpdatedAt:   r.UpdatedAt.UTC(),
+			ExpiresAt:   r.ExpiresAt,
+		}
+	}
+	if len(rows) == limit {
+		out.Cursor = rows[len(rows)-1].Did
+	}
+	return e.JSON(200, out)
+}
+
+// maxClassificationQuery is the most DIDs looked up in one bulk query
+const maxClassificationQuery = 1000
+
+type queryClassificationsBody struct {
+	Dids []string `json:"dids"`
+}
+
+type queryClassificationsResponse struct {
+	Classifications []sovereignty.Classification `json:"classifications"`
+	// requested DIDs with no current classification
+	Missing []string `json:"missing"`
+}
+
+// handleAdminQueryClassifications looks up the current classifications of a batch of DIDs
+func (bgs *BGS) handleAdminQueryClassifications(e echo.Context) error {
+	var body queryClassificationsBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if len(body.Dids) > maxClassificationQuery {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("at most %d DIDs may be queried at once", maxClassificationQuery),
+		}
+	}
+	out := queryClassificationsResponse{
+		Classifications: []sovereignty.Classification{},
+		Missing:         []string{},
+	}
+	for _, did := range body.Dids {
+		if c, ok := bgs.Classifications.Get(did); ok {
+			out.Classifications = append(out.Classifications, c)
+		} else {
+			out.Missing = append(out.Missing, did)
+		}
+	}
+	return e.JSON(200, out)
+}
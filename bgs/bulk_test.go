@@ -0,0 +1,117 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassificationListAndQuery(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+	ctx := context.Background()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	assert.NoError(b.SetClassifications(ctx, []sovereignty.Classification{
+		{DID: "did:plc:aaa", Country: "CA", Source: "admin"},
+		{DID: "did:plc:bbb", Country: "CA", Source: "import"},
+		{DID: "did:plc:ccc", Country: "US", Source: "admin"},
+		{DID: "did:plc:ddd", Country: "CA", Source: "admin"},
+		{DID: "did:plc:eee", Country: "CA", Source: "admin", ExpiresAt: &expired},
+	}))
+
+	var page listClassificationsResponse
+	var dids []string
+	cursor := ""
+	for {
+		rec, err := call(http.MethodGet, "/admin/sovereignty/classifications?country=ca&limit=2&cursor="+cursor, "", b.handleAdminListClassifications)
+		if !assert.NoError(err) {
+			return
+		}
+		page = listClassificationsResponse{}
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &page))
+		for _, c := range page.Classifications {
+			dids = append(dids, c.DID)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	assert.Equal([]string{"did:plc:aaa", "did:plc:bbb", "did:plc:ddd"}, dids)
+
+	rec, err := call(http.MethodGet, "/admin/sovereignty/classifications?source=import", "", b.handleAdminListClassifications)
+	assert.NoError(err)
+	page = listClassificationsResponse{}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &page))
+	if assert.Len(page.Classifications, 1) {
+		assert.Equal("did:plc:bbb", page.Classifications[0].DID)
+	}
+	assert.Empty(page.Cursor)
+
+	_, err = call(http.MethodGet, "/admin/sovereignty/classifications?country=can", "", b.handleAdminListClassifications)
+	assert.Equal(400, err.(*echo.HTTPError).Code)
+
+	rec, err = call(http.MethodPost, "/admin/sovereignty/classifications/query", `{"dids": ["did:plc:ccc", "did:plc:eee", "did:plc:zzz"]}`, b.handleAdminQueryClassifications)
+	assert.NoError(err)
+	var q queryClassificationsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &q))
+	if assert.Len(q.Classifications, 1) {
+		assert.Equal("US", q.Classifications[0].Country)
+	}
+	assert.Equal([]string{"did:plc:eee", "did:plc:zzz"}, q.Missing)
+
+	body, _ := json.Marshal(queryClassificationsBody{Dids: make([]string, maxClassificationQuery+1)})
+	_, err = call(http.MethodPost, "/admin/sovereignty/classifications/query", string(body), b.handleAdminQueryClassifications)
+	assert.Equal(400, err.(*echo.HTTPError).Code)
+}
+
+func TestClassificationExpirySimulatedTime(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b.clock = clk
+	b.Classifications.Clock = clk
+
+	exp := clk.Now().Add(5 * time.Minute)
+	assert.NoError(b.SetClassifications(ctx, []sovereignty.Classification{
+		{DID: "did:plc:aaa", Country: "CA", Source: "resolver", ExpiresAt: &exp},
+		{DID: "did:plc:bbb", Country: "CA", Source: "admin"},
+	}))
+
+	go b.runClassificationExpiry(ctx)
+	clk.BlockUntil(1)
+	_, ok := b.Classifications.Get("did:plc:aaa")
+	assert.True(ok)
+
+	// one expiry pass runs as the clock passes the interval
+	clk.Advance(classificationExpiryInterval)
+	assert.Eventually(func() bool { return b.Classifications.Len() == 1 }, time.Second, time.Millisecond)
+	var n int64
+	assert.NoError(b.db.Model(&models.DIDClassification{}).Count(&n).Error)
+	assert.Equal(int64(1), n)
+	_, ok = b.Classifications.Get("did:plc:bbb")
+	assert.True(ok)
+}
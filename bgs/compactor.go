@@ -9,6 +9,7 @@ import (
 
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/clock"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -23,6 +24,8 @@ type uniQueue struct {
 	q       []queueItem
 	members map[models.Uid]struct{}
 	lk      sync.Mutex
+	// used under lk by PopRandom; nil uses the global source
+	rand *rand.Rand
 }
 
 // Append appends a uid to the end of the queue if it doesn't already exist
@@ -109,12 +112,17 @@ func (q *uniQueue) PopRandom() (queueItem, bool) {
 		return queueItem{}, false
 	}
 
+	intN := rand.IntN
+	if q.rand != nil {
+		intN = q.rand.IntN
+	}
+
 	var item queueItem
 	if len(q.q) == 1 {
 		item = q.q[0]
 		q.q = nil
 	} else {
-		pos := rand.IntN(len(q.q))
+		pos := intN(len(q.q))
 		item = q.q[pos]
 		last := len(q.q) - 1
 		q.q[pos] = q.q[last]
@@ -149,6 +157,7 @@ type Compactor struct {
 	requeueLimit      int
 	requeueShardCount int
 	requeueFast       bool
+	clock             clock.Clock
 
 	numWorkers int
 	wg         sync.WaitGroup
@@ -160,6 +169,10 @@ type CompactorOptions struct {
 	RequeueShardCount int
 	RequeueFast       bool
 	NumWorkers        int
+	// schedules requeues; nil uses the system clock
+	Clock clock.Clock
+	// picks repos for the random-order workers; nil uses the global source
+	Rand *rand.Rand
 }
 
 func DefaultCompactorOptions() *CompactorOptions {
@@ -180,6 +193,7 @@ func NewCompactor(opts *CompactorOptions) *Compactor {
 	return &Compactor{
 		q: &uniQueue{
 			members: make(map[models.Uid]struct{}),
+			rand:    opts.Rand,
 		},
 		exit:              make(chan struct{}),
 		requeueInterval:   opts.RequeueInterval,
@@ -187,6 +201,7 @@ func NewCompactor(opts *CompactorOptions) *Compactor {
 		requeueFast:       opts.RequeueFast,
 		requeueShardCount: opts.RequeueShardCount,
 		numWorkers:        opts.NumWorkers,
+		clock:             clock.OrSystem(opts.Clock),
 	}
 }
 
@@ -217,12 +232,13 @@ func (c *Compactor) Start(bgs *BGS) {
 				"fast", c.requeueFast,
 			)
 
-			t := time.NewTicker(c.requeueInterval)
+			t := c.clock.NewTicker(c.requeueInterval)
+			defer t.Stop()
 			for {
 				select {
 				case <-c.exit:
 					return
-				case <-t.C:
+				case <-t.C():
 					ctx := context.Background()
 					ctx, span := otel.Tracer("compactor").Start(ctx, "RequeueRoutine")
 					if err := c.EnqueueAllRepos(ctx, bgs, c.requeueLimit, c.requeueShardCount, c.requeueFast); err != nil {
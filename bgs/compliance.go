@@ -0,0 +1,162 @@
+package bgs
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/export"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ComplianceReport summarizes what the sovereign stream carries, and the records behind it, in the versioned export format
+func (bgs *BGS) ComplianceReport(ctx context.Context) (*export.Report, error) {
+	r := export.NewReport(bgs.clock.Now())
+	pol := bgs.policy.Load()
+	r.PolicyVersion = pol.doc.Version
+	for c := range pol.streamCountries {
+		r.StreamCountries = append(r.StreamCountries, c)
+	}
+	sort.Strings(r.StreamCountries)
+	for s := range pol.streamSubdivisions {
+		r.StreamSubdivisions = append(r.StreamSubdivisions, s)
+	}
+	sort.Strings(r.StreamSubdivisions)
+	for c := range pol.excludeCountries {
+		r.ExcludeCountries = append(r.ExcludeCountries, c)
+	}
+	sort.Strings(r.ExcludeCountries)
+
+	counts := &r.Classifications
+	for _, c := range bgs.Classifications.Snapshot() {
+		counts.Total++
+		if pol.forDID(c.DID).carries(c) {
+			counts.Carried++
+		}
+		counts.ByRegion[c.Region()]++
+		source := c.Source
+		if source == "" {
+			source = "unspecified"
+		}
+		counts.BySource[source]++
+	}
+	r.PriorityAccounts = len(bgs.Priority.List())
+
+	db := bgs.db.WithContext(ctx)
+	var holds int64
+	if err := db.Model(&models.LegalHold{}).Where("released_at IS NULL").Count(&holds).Error; err != nil {
+		return nil, err
+	}
+	r.ActiveLegalHolds = int(holds)
+
+	var appeals []struct {
+		Status string
+		Count  int
+	}
+	if err := db.Model(&models.Appeal{}).Select("status, count(*) as count").Group("status").Scan(&appeals).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range appeals {
+		r.Appeals[a.Status] = a.Count
+	}
+	return r, nil
+}
+
+func (bgs *BGS) handleAdminComplianceReport(e echo.Context) error {
+	r, err := bgs.ComplianceReport(e.Request().Context())
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, r)
+}
+
+// handleAdminAuditLog returns a page of one of the sovereignty audit logs, newest first, in the versioned export format
+func (bgs *BGS) handleAdminAuditLog(e echo.Context) error {
+	name := e.QueryParam("log")
+	if !export.ValidLog(name) {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "log must be priority, appeals or legal-holds",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	out := export.NewAuditLog(name, bgs.clock.Now())
+	db := bgs.db.WithContext(e.Request().Context())
+	switch name {
+	case export.LogPriority:
+		var entries []models.PriorityAuditEntry
+		if err := db.Order("id desc").Limit(limit).Find(&entries).Error; err != nil {
+			return err
+		}
+		for _, a := range entries {
+			out.Entries = append(out.Entries, export.AuditEntry{
+				ID:        a.ID,
+				CreatedAt: a.CreatedAt.UTC(),
+				DID:       a.Did,
+				Action:    a.Action,
+				Actor:     a.Actor,
+				Note:      a.Note,
+				Category:  a.Category,
+				RemoteIP:  a.RemoteIP,
+			})
+		}
+	case export.LogAppeals:
+		var entries []struct {
+			models.AppealAuditEntry
+			Did string
+		}
+		// the account comes from the appeal
+		err := db.Table("appeal_audit_entries").
+			Select("appeal_audit_entries.*, appeals.did").
+			Joins("LEFT JOIN appeals ON appeals.id = appeal_audit_entries.appeal_id").
+			Order("appeal_audit_entries.id desc").
+			Limit(limit).
+			Find(&entries).Error
+		if err != nil {
+			return err
+		}
+		for _, a := range entries {
+			out.Entries = append(out.Entries, export.AuditEntry{
+				ID:        a.ID,
+				CreatedAt: a.CreatedAt.UTC(),
+				DID:       a.Did,
+				Subject:   a.AppealID,
+				Action:    a.Action,
+				Actor:     a.Actor,
+				Note:      a.Note,
+				RemoteIP:  a.RemoteIP,
+			})
+		}
+	case export.LogLegalHolds:
+		var entries []models.LegalHoldAuditEntry
+		if err := db.Order("id desc").Limit(limit).Find(&entries).Error; err != nil {
+			return err
+		}
+		for _, a := range entries {
+			out.Entries = append(out.Entries, export.AuditEntry{
+				ID:        a.ID,
+				CreatedAt: a.CreatedAt.UTC(),
+				DID:       a.Did,
+				Subject:   a.HoldID,
+				Action:    a.Action,
+				Actor:     a.Actor,
+				Note:      a.Note,
+				RemoteIP:  a.RemoteIP,
+			})
+		}
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,74 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/export"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplianceExports(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(target string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}, StreamSubdivisions: []string{"US-AK"}})
+	assert.NoError(err)
+	b.policy.Store(pol)
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "admin"})
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:bbb", Country: "US", Subdivision: "AK"})
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:ccc", Country: "US", Source: "pds-geo"})
+	assert.NoError(b.SetPriorityAccount(ctx, priority.Account{DID: "did:plc:gov", Category: "government", AddedBy: "ops"}, "127.0.0.1"))
+	placeHold(t, b, "did:plc:aaa", 0, 0)
+	assert.NoError(b.SubmitAppeal(ctx, &models.Appeal{Did: "did:plc:ccc", Kind: AppealKindClassification, RequestedCountry: "CA"}, "127.0.0.1"))
+
+	rec, err := call("/admin/sovereignty/report", b.handleAdminComplianceReport)
+	assert.NoError(err)
+	assert.NoError(export.Validate(export.SchemaReport, export.Version, rec.Body.Bytes()))
+	var report export.Report
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal([]string{"CA"}, report.StreamCountries)
+	assert.Equal([]string{"US-AK"}, report.StreamSubdivisions)
+	assert.Equal(3, report.Classifications.Total)
+	assert.Equal(2, report.Classifications.Carried)
+	assert.Equal(map[string]int{"CA": 1, "US": 1, "US-AK": 1}, report.Classifications.ByRegion)
+	assert.Equal(map[string]int{"admin": 1, "pds-geo": 1, "unspecified": 1}, report.Classifications.BySource)
+	assert.Equal(1, report.PriorityAccounts)
+	assert.Equal(1, report.ActiveLegalHolds)
+	assert.Equal(map[string]int{AppealStatusPending: 1}, report.Appeals)
+
+	_, err = call("/admin/sovereignty/audit?log=other", b.handleAdminAuditLog)
+	assert.Error(err)
+	for log, action := range map[string]string{
+		export.LogPriority:   "add",
+		export.LogAppeals:    "submit",
+		export.LogLegalHolds: "place",
+	} {
+		rec, err := call("/admin/sovereignty/audit?log="+log, b.handleAdminAuditLog)
+		assert.NoError(err)
+		assert.NoError(export.Validate(export.SchemaAuditLog, export.Version, rec.Body.Bytes()), log)
+		var out export.AuditLog
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+		assert.Equal(log, out.Log)
+		if assert.Len(out.Entries, 1, log) {
+			assert.Equal(action, out.Entries[0].Action)
+			assert.NotEmpty(out.Entries[0].DID)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maximum number of accounts waiting for country resolution
+const countryQueueSize = 10_000
+
+// accounts remembered as recently tried, so the sovereign filter doesn't queue them again on every event
+const countryTriedSize = 500_000
+
+// source recorded for answers from resolvers which don't report one
+const countryResolverSource = "resolver"
+
+// decisions held by the default, in-process filter cache
+const filterCacheSize = 500_000
+
+// how often expired classifications are removed
+const classificationExpiryInterval = 10 * time.Minute
+
+// defaultCountryResolver chains the external resolver service, PDS geolocation and PLC origin, each if configured. Returns nil if none is
+func (bgs *BGS) defaultCountryResolver(config *SovereignConfig) sovereignty.CountryResolver {
+	var links []sovereignty.ResolverLink
+	if config.CountryResolverURL != "" {
+		links = append(links, sovereignty.ResolverLink{Name: "external", Resolver: &sovereignty.HTTPCountryResolver{URL: config.CountryResolverURL, Client: bgs.httpClients.Get(httpprofile.Interactive)}})
+	}
+	if bgs.pdsGeo != nil {
+		links = append(links, sovereignty.ResolverLink{Name: "pds", Resolver: bgs.pdsGeo})
+	}
+	if bgs.plcOrigin != nil {
+		links = append(links, sovereignty.ResolverLink{Name: "plc", Resolver: bgs.plcOrigin})
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return &sovereignty.ChainedResolver{Links: links, StopAt: config.CountryMinConfidence}
+}
+
+// enqueueCountryResolve queues an unclassified account for country resolution, unless it was tried recently. Drops it if the queue is full
+func (bgs *BGS) enqueueCountryResolve(did string) {
+	if bgs.countryQueue == nil {
+		return
+	}
+	if at, ok := bgs.countryTried.Get(did); ok && bgs.clock.Since(at) < bgs.countryRetry {
+		return
+	}
+	bgs.countryTried.Add(did, bgs.clock.Now())
+	select {
+	case bgs.countryQueue <- did:
+	default:
+		bgs.countryTried.Remove(did)
+		countryResolutionsCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+// ResolveCountry asks the country resolver about an account, and classifies it if the answer is confident enough, or apply is set. Returns the resolver's answer, and whether it was applied
+func (bgs *BGS) ResolveCountry(ctx context.Context, did string, apply bool) (*sovereignty.Resolution, bool, error) {
+	res, err := sovereignty.Resolve(ctx, bgs.countryResolver, did, countryResolverSource)
+	if err != nil {
+		if errors.Is(err, sovereignty.ErrCountryUnknown) {
+			countryResolutionsCounter.WithLabelValues("unknown").Inc()
+			bgs.cacheNoDecision(ctx, did, sovereignty.FilterDecision{})
+		} else {
+			countryResolutionsCounter.WithLabelValues("error").Inc()
+		}
+		bgs.markCountryUnresolved(did)
+		return nil, false, err
+	}
+	if !apply && res.Confidence < bgs.countryMinConfidence {
+		countryResolutionsCounter.WithLabelValues("low_confidence").Inc()
+		bgs.markCountryUnresolved(did)
+		bgs.cacheNoDecision(ctx, did, sovereignty.FilterDecision{Confidence: res.Confidence, Source: res.Source})
+		return res, false, nil
+	}
+	cl := sovereignty.Classification{
+		DID:         did,
+		Country:     res.Country,
+		Subdivision: res.Subdivision,
+		Source:      res.Source,
+		Confidence:  res.Confidence,
+	}
+	if bgs.classificationTTL > 0 {
+		exp := bgs.clock.Now().UTC().Add(bgs.classificationTTL)
+		cl.ExpiresAt = &exp
+	}
+	if !apply && bgs.flaps != nil {
+		if held, damped := bgs.flaps.Damp(cl); damped {
+			countryResolutionsCounter.WithLabelValues("damped").Inc()
+			bgs.log.Info("country resolver answer damped while the account's classification is held", "did", did, "country", res.Country, "confidence", res.Confidence, "heldCountry", held.Country)
+			return res, false, nil
+		}
+	}
+	if err := bgs.setClassification(ctx, cl, res.Confidence, apply); err != nil {
+		return res, false, err
+	}
+	countryResolutionsCounter.WithLabelValues("classified").Inc()
+	bgs.log.Info("classified account by country resolver", "did", did, "country", res.Country, "confidence", res.Confidence, "source", res.Source)
+	return res, true, nil
+}
+
+// runCountryResolves is a worker classifying queued accounts, until the context is cancelled
+func (bgs *BGS) runCountryResolves(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case did := <-bgs.countryQueue:
+			// classified by other means while it was queued
+			if _, ok := bgs.Classifications.Get(did); ok {
+				continue
+			}
+			rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if bgs.applyCachedDecision(rctx, did) {
+				cancel()
+				continue
+			}
+			_, _, err := bgs.ResolveCountry(rctx, did, false)
+			cancel()
+			if err != nil && !errors.Is(err, sovereignty.ErrCountryUnknown) && ctx.Err() == nil {
+				bgs.log.Warn("failed to resolve account country", "did", did, "err", err)
+			}
+		}
+	}
+}
+
+// applyCachedDecision applies a decision on the account from the filter cache, made by this or another relay instance. Returns false if there is none, and the account should be resolved
+func (bgs *BGS) applyCachedDecision(ctx context.Context, did string) bool {
+	d, err := bgs.filterCache.Get(ctx, did)
+	if err != nil {
+		filterCacheLookupsCounter.WithLabelValues("error").Inc()
+		bgs.log.Warn("failed to read filter cache", "did", did, "err", err)
+		return false
+	}
+	if d == nil {
+		filterCacheLookupsCounter.WithLabelValues("miss").Inc()
+		return false
+	}
+	cl, ok := d.Classification(did)
+	if ok && cl.Expired(bgs.clock.Now()) {
+		filterCacheLookupsCounter.WithLabelValues("miss").Inc()
+		return false
+	}
+	filterCacheLookupsCounter.WithLabelValues("hit").Inc()
+	if ok {
+		// already persisted by the instance which made the decision
+		bgs.Classifications.Set(cl)
+	} else {
+		bgs.markCountryUnresolved(did)
+	}
+	return true
+}
+
+// markCountryUnresolved records that the country resolver couldn't place an account, so the filter can tell it from accounts not tried yet
+func (bgs *BGS) markCountryUnresolved(did string) {
+	if bgs.countryUnresolved != nil {
+		bgs.countryUnresolved.Add(did, bgs.clock.Now())
+	}
+}
+
+// countryUnresolvedRecently returns true if the country resolver couldn't place an account when it was last tried, within the retry interval
+func (bgs *BGS) countryUnresolvedRecently(did string) bool {
+	if bgs.countryUnresolved == nil {
+		return false
+	}
+	at, ok := bgs.countryUnresolved.Get(did)
+	return ok && bgs.clock.Since(at) < bgs.countryRetry
+}
+
+// observeFilterCacheSize reports the number of decisions held by the filter cache, if it is in-process
+func (bgs *BGS) observeFilterCacheSize() {
+	if c, ok := bgs.filterCache.(interface{ Len() int }); ok {
+		filterCacheEntries.Set(float64(c.Len()))
+	}
+}
+
+// cacheDecision records a classification in the filter cache, for as long as it lasts
+func (bgs *BGS) cacheDecision(ctx context.Context, c sovereignty.Classification, conf sovereignty.Confidence) {
+	var ttl time.Duration
+	if c.ExpiresAt != nil {
+		ttl = time.Until(*c.ExpiresAt)
+		if ttl <= 0 {
+			return
+		}
+	}
+	d := sovereignty.FilterDecision{
+		Country:    c.Country,
+		Confidence: conf,
+		Source:     c.Source,
+		ExpiresAt:  c.ExpiresAt,
+		DecidedAt:  c.UpdatedAt,
+	}
+	if err := bgs.filterCache.Set(ctx, c.DID, d, ttl); err != nil {
+		bgs.log.Warn("failed to update filter cache", "did", c.DID, "err", err)
+	}
+	bgs.observeFilterCacheSize()
+}
+
+// cacheNoDecision records that the account couldn't be classified, until it is due to be tried again. Not recorded if automatic classification is disabled
+func (bgs *BGS) cacheNoDecision(ctx context.Context, did string, d sovereignty.FilterDecision) {
+	if bgs.countryRetry <= 0 {
+		return
+	}
+	d.DecidedAt = bgs.clock.Now().UTC()
+	if err := bgs.filterCache.Set(ctx, did, d, bgs.countryRetry); err != nil {
+		bgs.log.Warn("failed to update filter cache", "did", did, "err", err)
+	}
+	bgs.observeFilterCacheSize()
+}
+
+// runClassificationExpiry periodically removes expired classifications, until the context is cancelled
+func (bgs *BGS) runClassificationExpiry(ctx context.Context) {
+	t := bgs.clock.NewTicker(classificationExpiryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if err := bgs.expireClassifications(ctx); err != nil {
+				bgs.log.Warn("failed to expire classifications", "err", err)
+			}
+		}
+	}
+}
+
+// expireClassifications removes classifications which have lapsed, both persisted and in-memory. The accounts are resolved again next time the sovereign stream sees them.
+func (bgs *BGS) expireClassifications(ctx context.Context) error {
+	now := bgs.clock.Now().UTC()
+	// rows replaced since they expired carry a later expiry, so aren't matched
+	if err := bgs.db.WithContext(ctx).Unscoped().Where("expires_at <= ?", now).Delete(&models.DIDClassification{}).Error; err != nil {
+		return err
+	}
+	expired := bgs.Classifications.Expire(now)
+	if bgs.flaps != nil {
+		for _, c := range expired {
+			bgs.flaps.Lapsed(c)
+		}
+	}
+	if len(expired) > 0 {
+		classificationExpirationsCounter.Add(float64(len(expired)))
+		bgs.log.Info("expired DID classifications", "count", len(expired))
+	}
+	return nil
+}
+
+type resolveCountryBody struct {
+	Did string `json:"did"`
+	// classify the account whatever the answer's confidence
+	Apply bool `json:"apply"`
+}
+
+// handleAdminResolveCountry asks the country resolver about an account. Confident answers are applied as with automatic classification; apply forces less confident ones
+func (bgs *BGS) handleAdminResolveCountry(e echo.Context) error {
+	if bgs.countryResolver == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "no country resolver is configured",
+		}
+	}
+	var body resolveCountryBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if _, err := syntax.ParseDID(body.Did); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+
+	res, applied, err := bgs.ResolveCountry(e.Request().Context(), body.Did, body.Apply)
+	if err != nil {
+		if errors.Is(err, sovereignty.ErrCountryUnknown) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: err.Error(),
+			}
+		}
+		if res == nil {
+			return &echo.HTTPError{
+				Code:    502,
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"result":  res,
+		"applied": applied,
+	})
+}
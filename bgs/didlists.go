@@ -0,0 +1,395 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/didlist"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// setupDIDLists loads the operator's lists of accounts classified in and out of country, if configured
+func (bgs *BGS) setupDIDLists(config *SovereignConfig) error {
+	if config.InCountryList != "" {
+		f, err := didlist.Open(config.InCountryList)
+		if err != nil {
+			return fmt.Errorf("loading in-country list: %w", err)
+		}
+		bgs.inCountry = f
+		didListSize.WithLabelValues("in_country").Set(float64(f.Len()))
+		bgs.log.Info("loaded in-country list", "path", f.Path(), "accounts", f.Len())
+	}
+	if config.OutOfCountryList != "" {
+		f, err := didlist.Open(config.OutOfCountryList)
+		if err != nil {
+			return fmt.Errorf("loading out-of-country list: %w", err)
+		}
+		bgs.outOfCountry = f
+		didListSize.WithLabelValues("out_of_country").Set(float64(f.Len()))
+		bgs.log.Info("loaded out-of-country list", "path", f.Path(), "accounts", f.Len())
+	}
+	return nil
+}
+
+// ReloadFiles reloads the GeoIP database, the in-country and out-of-country lists, and the extensions, those which have changed since they were last loaded. A file which fails to load is logged, and the previous version kept. Called periodically, and by bigsky on SIGHUP
+func (bgs *BGS) ReloadFiles() {
+	if bgs.geoIP != nil {
+		bgs.reloadGeoIP()
+	}
+	if bgs.inCountry != nil {
+		bgs.reloadDIDList("in_country", bgs.inCountry)
+	}
+	if bgs.outOfCountry != nil {
+		bgs.reloadDIDList("out_of_country", bgs.outOfCountry)
+	}
+	if bgs.extensions != nil {
+		bgs.reloadExtensions()
+	}
+}
+
+func (bgs *BGS) reloadDIDList(name string, f *didlist.File) error {
+	reloaded, err := f.Reload()
+	if err != nil {
+		didListReloadsCounter.WithLabelValues(name, "failed").Inc()
+		bgs.log.Error("failed to reload account list, keeping the previous one", "list", name, "path", f.Path(), "err", err)
+		return err
+	}
+	if reloaded {
+		didListReloadsCounter.WithLabelValues(name, "reloaded").Inc()
+		didListSize.WithLabelValues(name).Set(float64(f.Len()))
+		bgs.log.Info("reloaded account list", "list", name, "path", f.Path(), "accounts", f.Len())
+	}
+	return nil
+}
+
+// runDIDListReloads checks the list files for changes every interval, reloading them when they have, until the context is cancelled
+func (bgs *BGS) runDIDListReloads(ctx context.Context, interval time.Duration) {
+	t := bgs.clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if bgs.inCountry != nil {
+				bgs.reloadDIDList("in_country", bgs.inCountry)
+			}
+			if bgs.outOfCountry != nil {
+				bgs.reloadDIDList("out_of_country", bgs.outOfCountry)
+			}
+		}
+	}
+}
+
+type didListStatus struct {
+	Path     string `json:"path"`
+	Accounts int    `json:"accounts"`
+}
+
+type didListsResponse struct {
+	InCountry    *didListStatus `json:"inCountry,omitempty"`
+	OutOfCountry *didListStatus `json:"outOfCountry,omitempty"`
+}
+
+func (bgs *BGS) didListsStatus() didListsResponse {
+	var out didListsResponse
+	if bgs.inCountry != nil {
+		out.InCountry = &didListStatus{Path: bgs.inCountry.Path(), Accounts: bgs.inCountry.Len()}
+	}
+	if bgs.outOfCountry != nil {
+		out.OutOfCountry = &didListStatus{Path: bgs.outOfCountry.Path(), Accounts: bgs.outOfCountry.Len()}
+	}
+	return out
+}
+
+func (bgs *BGS) handleAdminDIDLists(e echo.Context) error {
+	return e.JSON(200, bgs.didListsStatus())
+}
+
+// handleAdminReloadDIDLists reloads the list files now, rather than waiting for the next check
+func (bgs *BGS) handleAdminReloadDIDLists(e echo.Context) error {
+	if bgs.inCountry == nil && bgs.outOfCountry == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "account lists are not configured",
+		}
+	}
+	for name, f := range map[string]*didlist.File{"in_country": bgs.inCountry, "out_of_country": bgs.outOfCountry} {
+		if f == nil {
+			continue
+		}
+		if err := bgs.reloadDIDList(name, f); err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+	}
+	return e.JSON(200, bgs.didListsStatus())
+}
+
+// Names of the account lists, as used by the admin API and metrics
+const (
+	listInCountry    = "in_country"
+	listOutOfCountry = "out_of_country"
+)
+
+// loadListedDIDs populates the accounts listed through the admin API from the database
+func (bgs *BGS) loadListedDIDs() error {
+	var rows []models.ListedDID
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading listed DIDs: %w", err)
+	}
+	listed := make(map[string]string, len(rows))
+	for _, r := range rows {
+		listed[r.Did] = r.List
+	}
+	bgs.listedLk.Lock()
+	bgs.listed = listed
+	bgs.listedLk.Unlock()
+	return nil
+}
+
+func (bgs *BGS) listedAt(did string) string {
+	bgs.listedLk.RLock()
+	defer bgs.listedLk.RUnlock()
+	return bgs.listed[did]
+}
+
+// listedIn reports whether the account is on the in-country list, in the file or through the admin API
+func (bgs *BGS) listedIn(did string) bool {
+	return (bgs.inCountry != nil && bgs.inCountry.Contains(did)) || bgs.listedAt(did) == listInCountry
+}
+
+// listedOut reports whether the account is on the out-of-country list, in the file or through the admin API
+func (bgs *BGS) listedOut(did string) bool {
+	return (bgs.outOfCountry != nil && bgs.outOfCountry.Contains(did)) || bgs.listedAt(did) == listOutOfCountry
+}
+
+// invalidateFilterDecision drops the filter cache's decision on an account whose listing changed, so that neither this instance nor others sharing the cache apply it once the account is no longer listed; it is resolved afresh instead
+func (bgs *BGS) invalidateFilterDecision(ctx context.Context, did string) {
+	if err := bgs.filterCache.Delete(ctx, did); err != nil {
+		bgs.log.Warn("failed to update filter cache", "did", did, "err", err)
+	}
+	if bgs.countryUnresolved != nil {
+		bgs.countryUnresolved.Remove(did)
+	}
+	bgs.observeFilterCacheSize()
+}
+
+type listedDIDView struct {
+	// the account's classification, and whether the sovereign stream carries it
+	sovereignty.Standing
+	// the lists the account is on, whether in the files or through the admin API
+	InCountry    bool `json:"inCountry"`
+	OutOfCountry bool `json:"outOfCountry"`
+	// the admin API entry, if any
+	Entry *listedDIDEntry `json:"entry,omitempty"`
+}
+
+type listedDIDEntry struct {
+	Did       string    `json:"did"`
+	List      string    `json:"list"`
+	Reason    string    `json:"reason"`
+	AddedBy   string    `json:"addedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func listedDIDEntryOf(row models.ListedDID) *listedDIDEntry {
+	return &listedDIDEntry{
+		Did:       row.Did,
+		List:      row.List,
+		Reason:    row.Reason,
+		AddedBy:   row.AddedBy,
+		CreatedAt: row.CreatedAt.UTC(),
+	}
+}
+
+func (bgs *BGS) listedDIDView(e echo.Context, did string) (listedDIDView, error) {
+	v := listedDIDView{
+		Standing:     bgs.accountStanding(did, bgs.requestLang(e)),
+		InCountry:    bgs.listedIn(did),
+		OutOfCountry: bgs.listedOut(did),
+	}
+	var row models.ListedDID
+	if err := bgs.db.WithContext(e.Request().Context()).Where("did = ?", did).Limit(1).Find(&row).Error; err != nil {
+		return v, err
+	}
+	if row.ID != 0 {
+		v.Entry = listedDIDEntryOf(row)
+	}
+	return v, nil
+}
+
+type listedDIDsResponse struct {
+	Dids   []*listedDIDEntry `json:"dids"`
+	Cursor string            `json:"cursor,omitempty"`
+}
+
+// handleAdminListedDIDs queries an account's listing (with did), or lists the accounts listed through the admin API, optionally those on one list
+func (bgs *BGS) handleAdminListedDIDs(e echo.Context) error {
+	if d := e.QueryParam("did"); d != "" {
+		did, err := syntax.ParseDID(d)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Errorf("invalid did: %w", err).Error(),
+			}
+		}
+		v, err := bgs.listedDIDView(e, did.String())
+		if err != nil {
+			return err
+		}
+		return e.JSON(200, v)
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	q := bgs.db.WithContext(e.Request().Context()).Order("did").Limit(limit)
+	switch list := e.QueryParam("list"); list {
+	case "":
+	case listInCountry, listOutOfCountry:
+		q = q.Where("list = ?", list)
+	default:
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "list must be in_country or out_of_country",
+		}
+	}
+	if cursor := e.QueryParam("cursor"); cursor != "" {
+		q = q.Where("did > ?", cursor)
+	}
+	var rows []models.ListedDID
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+
+	out := listedDIDsResponse{
+		Dids: make([]*listedDIDEntry, len(rows)),
+	}
+	for i, r := range rows {
+		out.Dids[i] = listedDIDEntryOf(r)
+	}
+	if len(rows) == limit {
+		out.Cursor = rows[len(rows)-1].Did
+	}
+	return e.JSON(200, out)
+}
+
+type listDIDBody struct {
+	Did    string `json:"did"`
+	List   string `json:"list"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// handleAdminListDID adds an account to the in-country or out-of-country list, moving it if it is on the other. It applies to the sovereign stream straight away
+func (bgs *BGS) handleAdminListDID(e echo.Context) error {
+	var body listDIDBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	if body.List != listInCountry && body.List != listOutOfCountry {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "list must be in_country or out_of_country",
+		}
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	ctx := e.Request().Context()
+	row := models.ListedDID{
+		Did:     did.String(),
+		List:    body.List,
+		Reason:  body.Reason,
+		AddedBy: body.Actor,
+	}
+	err = bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"list", "reason", "added_by", "created_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	bgs.listedLk.Lock()
+	if bgs.listed == nil {
+		bgs.listed = make(map[string]string)
+	}
+	bgs.listed[row.Did] = row.List
+	bgs.listedLk.Unlock()
+	bgs.invalidateFilterDecision(ctx, row.Did)
+	bgs.log.Info("account listed", "did", row.Did, "list", row.List, "reason", row.Reason, "actor", body.Actor)
+
+	v, err := bgs.listedDIDView(e, row.Did)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, v)
+}
+
+type unlistDIDBody struct {
+	Did   string `json:"did"`
+	Actor string `json:"actor"`
+}
+
+// handleAdminUnlistDID removes an account added through the admin API from its list. Accounts in the list files stay listed until removed from the file
+func (bgs *BGS) handleAdminUnlistDID(e echo.Context) error {
+	var body unlistDIDBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	ctx := e.Request().Context()
+	res := bgs.db.WithContext(ctx).Where("did = ?", body.Did).Delete(&models.ListedDID{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "account is not listed through the admin API",
+		}
+	}
+	bgs.listedLk.Lock()
+	delete(bgs.listed, body.Did)
+	bgs.listedLk.Unlock()
+	bgs.invalidateFilterDecision(ctx, body.Did)
+	bgs.log.Info("account unlisted", "did", body.Did, "actor", body.Actor)
+
+	v, err := bgs.listedDIDView(e, body.Did)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, v)
+}
@@ -0,0 +1,179 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDIDLists(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, nil)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("POST", "/admin/sovereignty/lists/reload", b.handleAdminReloadDIDLists)
+	assert.Error(err)
+
+	dir := t.TempDir()
+	inPath, outPath := filepath.Join(dir, "in.csv"), filepath.Join(dir, "out.txt")
+	mtime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(path, s string) {
+		mtime = mtime.Add(time.Minute)
+		assert.NoError(os.WriteFile(path, []byte(s), 0644))
+		assert.NoError(os.Chtimes(path, mtime, mtime))
+	}
+	write(inPath, "did,note\ndid:plc:ministry,official account\ndid:plc:both,\n")
+	write(outPath, "# known abroad\ndid:plc:abroad\ndid:plc:both\ndid:plc:gov\n")
+
+	config := DefaultSovereignConfig()
+	config.InCountryList = inPath
+	config.OutOfCountryList = outPath
+	assert.NoError(b.setupDIDLists(&config))
+
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	assert.NoError(err)
+	b.policy.Store(pol)
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:abroad", Country: "CA", Source: "admin"})
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:ministry", Country: "US", Source: "pds-geo"})
+	b.Priority.Set(priority.Account{DID: "did:plc:gov"})
+
+	filter := func(did string) sovereignty.FilterResult {
+		return b.filterEvent(&events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}})
+	}
+	assert.Equal(sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonListedIn}, filter("did:plc:ministry"))
+	assert.Equal(sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonListedOut}, filter("did:plc:abroad"))
+	assert.Equal(sovereignty.FilterReasonListedOut, filter("did:plc:both").Reason)
+	assert.Equal(sovereignty.FilterReasonPriority, filter("did:plc:gov").Reason)
+	assert.True(b.AccountStanding("did:plc:ministry").Included)
+	assert.False(b.AccountStanding("did:plc:abroad").Included)
+
+	// replaced files are picked up on reload; a broken one keeps the previous list
+	write(inPath, "did:plc:abroad\n")
+	write(outPath, "not a did\n")
+	b.ReloadFiles()
+	assert.Equal(sovereignty.FilterReasonOtherCountry, filter("did:plc:ministry").Reason)
+	assert.Equal(sovereignty.FilterReasonListedOut, filter("did:plc:abroad").Reason)
+
+	_, err = call("POST", "/admin/sovereignty/lists/reload", b.handleAdminReloadDIDLists)
+	assert.Error(err)
+	write(outPath, "did:plc:someone-else\n")
+	rec, err := call("POST", "/admin/sovereignty/lists/reload", b.handleAdminReloadDIDLists)
+	assert.NoError(err)
+	assert.Equal(sovereignty.FilterReasonListedIn, filter("did:plc:abroad").Reason)
+
+	var status didListsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	if assert.NotNil(status.InCountry) && assert.NotNil(status.OutOfCountry) {
+		assert.Equal(inPath, status.InCountry.Path)
+		assert.Equal(1, status.InCountry.Accounts)
+		assert.Equal(1, status.OutOfCountry.Accounts)
+	}
+
+	config.OutOfCountryList = filepath.Join(dir, "missing.txt")
+	assert.Error(b.setupDIDLists(&config))
+}
+
+func TestListedDIDs(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	assert.NoError(b.loadListedDIDs())
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	assert.NoError(err)
+	b.policy.Store(pol)
+	filter := func(did string) sovereignty.FilterResult {
+		return b.filterEvent(&events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}})
+	}
+	cached := func(did string) *sovereignty.FilterDecision {
+		d, err := b.filterCache.Get(ctx, did)
+		assert.NoError(err)
+		return d
+	}
+
+	// resolved to the carried country, then known to be abroad
+	assert.NoError(b.filterCache.Set(ctx, "did:plc:abroad", sovereignty.FilterDecision{Country: "CA", Confidence: sovereignty.ConfidenceLow}, time.Hour))
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:abroad", Country: "CA", Source: "pds-geo", Confidence: sovereignty.ConfidenceLow})
+	assert.Equal(sovereignty.FilterReasonCountry, filter("did:plc:abroad").Reason)
+
+	_, err = call("POST", "/admin/sovereignty/dids", `{"did": "did:plc:abroad", "list": "elsewhere", "actor": "ops"}`, b.handleAdminListDID)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/dids", `{"did": "did:plc:abroad", "list": "out_of_country"}`, b.handleAdminListDID)
+	assert.Error(err)
+	rec, err := call("POST", "/admin/sovereignty/dids", `{"did": "did:plc:abroad", "list": "out_of_country", "reason": "moved", "actor": "ops"}`, b.handleAdminListDID)
+	assert.NoError(err)
+	var v listedDIDView
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &v))
+	assert.True(v.OutOfCountry)
+	assert.False(v.Included)
+	if assert.NotNil(v.Entry) {
+		assert.Equal("ops", v.Entry.AddedBy)
+	}
+	assert.Equal(sovereignty.FilterReasonListedOut, filter("did:plc:abroad").Reason)
+	assert.Nil(cached("did:plc:abroad"))
+
+	// moving an account to the other list
+	_, err = call("POST", "/admin/sovereignty/dids", `{"did": "did:plc:ministry", "list": "out_of_country", "actor": "ops"}`, b.handleAdminListDID)
+	assert.NoError(err)
+	_, err = call("POST", "/admin/sovereignty/dids", `{"did": "did:plc:ministry", "list": "in_country", "actor": "ops"}`, b.handleAdminListDID)
+	assert.NoError(err)
+	assert.Equal(sovereignty.FilterReasonListedIn, filter("did:plc:ministry").Reason)
+
+	rec, err = call("GET", "/admin/sovereignty/dids?list=in_country", "", b.handleAdminListedDIDs)
+	assert.NoError(err)
+	var list listedDIDsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &list))
+	if assert.Len(list.Dids, 1) {
+		assert.Equal("did:plc:ministry", list.Dids[0].Did)
+	}
+	rec, err = call("GET", "/admin/sovereignty/dids?limit=1", "", b.handleAdminListedDIDs)
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Equal("did:plc:abroad", list.Cursor)
+
+	// listings survive a restart
+	b.listed = nil
+	assert.NoError(b.loadListedDIDs())
+	assert.True(b.listedIn("did:plc:ministry"))
+	assert.True(b.AccountStanding("did:plc:ministry").Included)
+
+	_, err = call("POST", "/admin/sovereignty/dids/remove", `{"did": "did:plc:nobody", "actor": "ops"}`, b.handleAdminUnlistDID)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/dids/remove", `{"did": "did:plc:abroad", "actor": "ops"}`, b.handleAdminUnlistDID)
+	assert.NoError(err)
+	assert.Equal(sovereignty.FilterReasonCountry, filter("did:plc:abroad").Reason)
+	rec, err = call("GET", "/admin/sovereignty/dids?did=did:plc:abroad", "", b.handleAdminListedDIDs)
+	assert.NoError(err)
+	v = listedDIDView{}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &v))
+	assert.Nil(v.Entry)
+	assert.False(v.OutOfCountry)
+	assert.True(v.Included)
+}
@@ -0,0 +1,43 @@
+package bgs
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/bluesky-social/indigo/sovereignty/egress"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupEgress loads the egress rules, which locate subscribers with the PDS geolocator
+func (bgs *BGS) setupEgress(config *SovereignConfig) error {
+	if bgs.pdsGeo == nil {
+		return errors.New("egress rules require subscriber geolocation: a GeoIP database or PDS geolocation ranges")
+	}
+	p, err := egress.NewPolicy(config.EgressRules)
+	if err != nil {
+		return err
+	}
+	bgs.egress = p
+	return nil
+}
+
+// egressRestriction locates a sovereign stream subscriber by its address, returning the egress rules which withhold records from it; nil if none do
+func (bgs *BGS) egressRestriction(c echo.Context) *egress.Restriction {
+	if bgs.egress == nil {
+		return nil
+	}
+	var country string
+	if addr, err := netip.ParseAddr(c.RealIP()); err == nil {
+		country, _ = bgs.pdsGeo.Geo.Country(addr.Unmap())
+	}
+	r := bgs.egress.For(country)
+	if r != nil {
+		label := country
+		if label == "" {
+			label = "unknown"
+		}
+		egressSubscribers.WithLabelValues(label).Inc()
+	}
+	return r
+}
@@ -0,0 +1,85 @@
+package bgs
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty/egress"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressRestriction(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	config := DefaultSovereignConfig()
+	config.EgressRules = []egress.Rule{{Name: "health", Collection: "ca.gander.health.*", Countries: []string{"CA"}}}
+	// subscribers can't be located
+	assert.Error(b.setupEgress(&config))
+
+	ranges, err := pdsgeo.NewRangeTable(map[string]string{"192.0.2.0/24": "CA", "198.51.100.0/24": "FR"})
+	assert.NoError(err)
+	b.pdsGeo = &pdsgeo.Resolver{Geo: ranges}
+	assert.NoError(b.setupEgress(&config))
+
+	restriction := func(addr string) *egress.Restriction {
+		req := httptest.NewRequest("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", nil)
+		req.RemoteAddr = addr
+		return b.egressRestriction(e.NewContext(req, httptest.NewRecorder()))
+	}
+	assert.Nil(restriction("192.0.2.10:4000"))
+	assert.NotNil(restriction("203.0.113.5:4000"))
+	abroad := restriction("198.51.100.7:4000")
+	if !assert.NotNil(abroad) {
+		return
+	}
+
+	commit := cartest.Commit(t, "did:plc:aaa")
+	health := cartest.NewBlock(t, map[string]any{"$type": "ca.gander.health.record", "note": "private"})
+	post := cartest.NewBlock(t, map[string]any{"$type": "app.gndr.feed.post", "text": "hello"})
+	evt := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:aaa",
+		Commit: lexutil.LexLink(commit.Cid),
+		Blocks: cartest.CAR(t, commit, health, post),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "ca.gander.health.record/3k", Cid: health.Link()},
+			{Action: "create", Path: "app.gndr.feed.post/3k", Cid: post.Link()},
+		},
+	}}
+
+	out, err := b.sovereignTransform(evt, "", nil, abroad)
+	assert.NoError(err)
+	cr, err := car.NewCarReader(bytes.NewReader(out.RepoCommit.Blocks))
+	assert.NoError(err)
+	found := map[cid.Cid]bool{}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		found[blk.Cid()] = true
+	}
+	assert.True(found[commit.Cid])
+	assert.True(found[post.Cid])
+	assert.False(found[health.Cid])
+	// the ops still say what was committed
+	assert.Len(out.RepoCommit.Ops, 2)
+
+	// subscribers at home get the commit as it is
+	same, err := b.sovereignTransform(evt, "", nil, nil)
+	assert.NoError(err)
+	assert.Equal(evt.RepoCommit.Blocks, same.RepoCommit.Blocks)
+}
@@ -0,0 +1,50 @@
+package bgs
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeyRewrapper is storage encrypted at rest under the relay's keyring, which can re-wrap its data keys under the keyring's current primary key.
+type KeyRewrapper interface {
+	RewrapKeys(ctx context.Context) (int, error)
+}
+
+type namedRewrapper struct {
+	name string
+	kr   KeyRewrapper
+}
+
+// AddKeyRewrapper registers encrypted storage to be re-wrapped by the /admin/encryption/rewrap endpoint. Must be called before the relay starts serving.
+func (bgs *BGS) AddKeyRewrapper(name string, kr KeyRewrapper) {
+	bgs.rewrappers = append(bgs.rewrappers, namedRewrapper{name: name, kr: kr})
+}
+
+// handleAdminRewrapKeys re-wraps every data key under the primary key after a rotation, reporting how many were updated per store. Once it succeeds, rotated-out keys can be removed from the keyring.
+func (bgs *BGS) handleAdminRewrapKeys(e echo.Context) error {
+	if len(bgs.rewrappers) == 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "encryption at rest is not enabled",
+		}
+	}
+	ctx := e.Request().Context()
+	out := make(map[string]int, len(bgs.rewrappers))
+	for _, r := range bgs.rewrappers {
+		n, err := r.kr.RewrapKeys(ctx)
+		if err != nil {
+			bgs.log.Error("failed to re-wrap data keys", "store", r.name, "updated", n, "err", err)
+			return &echo.HTTPError{
+				Code:    500,
+				Message: r.name + ": " + err.Error(),
+			}
+		}
+		out[r.name] = n
+	}
+	bgs.log.Info("re-wrapped data keys", "updated", out, "remote_ip", e.RealIP())
+	return e.JSON(200, map[string]any{
+		"success": "true",
+		"updated": out,
+	})
+}
@@ -0,0 +1,114 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/extension"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupExtensions loads the operator's extension modules, which classify events in place of the relay's geographic filter, and filter and transform the sovereign stream after the relay's own filter and transformations
+func (bgs *BGS) setupExtensions(config *SovereignConfig) error {
+	if bgs.sovereignKey == nil {
+		return errors.New("sovereign stream extensions require a signing key")
+	}
+	opts := extension.DefaultOptions()
+	opts.Dir = config.ExtensionDir
+	opts.MemoryLimit = uint64(config.ExtensionMemoryLimit)
+	opts.Timeout = config.ExtensionTimeout
+	opts.Classify = bgs.Classifications.Get
+	h, err := extension.NewHost(context.Background(), opts)
+	if err != nil {
+		return fmt.Errorf("loading extensions: %w", err)
+	}
+	bgs.extensions = h
+	for _, m := range h.Modules() {
+		bgs.log.Info("loaded extension", "name", m.Name, "sha256", m.SHA256, "filters", m.Filters, "transforms", m.Transforms, "classifies", m.Classifies)
+	}
+	return nil
+}
+
+func (bgs *BGS) reloadExtensions() error {
+	changed, err := bgs.extensions.Reload(context.Background())
+	if err != nil {
+		bgs.log.Error("failed to reload extensions, keeping the previous versions", "err", err)
+	}
+	if changed {
+		bgs.log.Info("reloaded extensions", "modules", len(bgs.extensions.Modules()))
+	}
+	return err
+}
+
+// runExtensionReloads checks the extension directory for changes every interval, reloading modules when they have, until the context is cancelled
+func (bgs *BGS) runExtensionReloads(ctx context.Context, interval time.Duration) {
+	t := bgs.clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			bgs.reloadExtensions()
+		}
+	}
+}
+
+type extensionStatus struct {
+	Name       string    `json:"name"`
+	SHA256     string    `json:"sha256"`
+	LoadedAt   time.Time `json:"loadedAt"`
+	Filters    bool      `json:"filters"`
+	Transforms bool      `json:"transforms"`
+	Classifies bool      `json:"classifies"`
+}
+
+type extensionsResponse struct {
+	Extensions []extensionStatus `json:"extensions"`
+}
+
+func (bgs *BGS) extensionsStatus() extensionsResponse {
+	out := extensionsResponse{Extensions: []extensionStatus{}}
+	for _, m := range bgs.extensions.Modules() {
+		out.Extensions = append(out.Extensions, extensionStatus{
+			Name:       m.Name,
+			SHA256:     m.SHA256,
+			LoadedAt:   m.LoadedAt,
+			Filters:    m.Filters,
+			Transforms: m.Transforms,
+			Classifies: m.Classifies,
+		})
+	}
+	return out
+}
+
+// handleAdminListExtensions lists the loaded extensions, in the order they apply
+func (bgs *BGS) handleAdminListExtensions(e echo.Context) error {
+	if bgs.extensions == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "extensions are not configured",
+		}
+	}
+	return e.JSON(200, bgs.extensionsStatus())
+}
+
+// handleAdminReloadExtensions reloads the extension directory now, rather than waiting for the next check
+func (bgs *BGS) handleAdminReloadExtensions(e echo.Context) error {
+	if bgs.extensions == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "extensions are not configured",
+		}
+	}
+	if err := bgs.reloadExtensions(); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	return e.JSON(200, bgs.extensionsStatus())
+}
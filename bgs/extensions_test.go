@@ -0,0 +1,116 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtensionsSetup(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, nil)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/extensions", b.handleAdminListExtensions)
+	assert.Error(err)
+
+	dir := t.TempDir()
+	config := DefaultSovereignConfig()
+	config.ExtensionDir = dir
+
+	// rewritten commits are re-signed
+	assert.Error(b.setupExtensions(&config))
+
+	key, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.sovereignKey = key
+
+	// a module which isn't valid WebAssembly fails startup
+	bad := filepath.Join(dir, "bad.wasm")
+	assert.NoError(os.WriteFile(bad, []byte("not wasm"), 0o644))
+	assert.Error(b.setupExtensions(&config))
+	assert.NoError(os.Remove(bad))
+
+	assert.NoError(b.setupExtensions(&config))
+	defer b.extensions.Close(context.Background())
+	rec, err := call("GET", "/admin/sovereignty/extensions", b.handleAdminListExtensions)
+	assert.NoError(err)
+	var resp extensionsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(resp.Extensions)
+
+	// and fails a reload, leaving the loaded modules as they were
+	assert.NoError(os.WriteFile(bad, []byte("not wasm"), 0o644))
+	_, err = call("POST", "/admin/sovereignty/extensions/reload", b.handleAdminReloadExtensions)
+	assert.Error(err)
+	assert.Empty(b.extensions.Modules())
+}
+
+func TestExtensionsClassify(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available to build extensions")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(gobin, "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "classify.wasm"), "../sovereignty/extension/testdata/classify")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building extension: %s\n%s", err, out)
+	}
+	key, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.sovereignKey = key
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA", "US"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	ctx := context.Background()
+	assert.NoError(b.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:us", Country: "US", Source: "admin"}))
+	assert.NoError(b.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:ca", Country: "CA", Source: "admin"}))
+
+	config := DefaultSovereignConfig()
+	config.ExtensionDir = dir
+	assert.NoError(b.setupExtensions(&config))
+	defer b.extensions.Close(ctx)
+
+	identity := func(did, handle string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Handle: &handle}}
+	}
+	// kept though unclassified
+	r := b.evaluateFilter(identity("did:plc:unknown", "agency.gc.ca"), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonExtension, r.Reason)
+	// dropped though in a carried country
+	r = b.evaluateFilter(identity("did:plc:us", "someone.example.com"), nil)
+	assert.False(r.Include)
+	assert.Equal(sovereignty.FilterReasonExtension, r.Reason)
+	// left to the relay
+	r = b.evaluateFilter(identity("did:plc:ca", "someone.example.com"), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonCountry, r.Reason)
+}
@@ -0,0 +1,131 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dbFeatureStore persists runtime feature flag overrides in the relay database
+type dbFeatureStore struct {
+	db *gorm.DB
+}
+
+func (s *dbFeatureStore) Load(ctx context.Context) (map[string]bool, error) {
+	var rows []models.FeatureFlag
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		out[r.Name] = r.Enabled
+	}
+	return out, nil
+}
+
+func (s *dbFeatureStore) Put(ctx context.Context, name string, enabled bool) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&models.FeatureFlag{Name: name, Enabled: enabled}).Error
+}
+
+func (s *dbFeatureStore) Delete(ctx context.Context, name string) error {
+	return s.db.WithContext(ctx).Where("name = ?", name).Delete(&models.FeatureFlag{}).Error
+}
+
+// handleDebugFeatures serves the current feature flags alongside the other /debug endpoints on the metrics listener
+func (bgs *BGS) handleDebugFeatures(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bgs.featureStates())
+}
+
+func (bgs *BGS) featureStates() []features.State {
+	if bgs.features == nil {
+		out := []features.State{}
+		for _, d := range features.Definitions() {
+			out = append(out, features.State{Definition: d, Enabled: d.Default, Source: features.SourceDefault})
+		}
+		return out
+	}
+	return bgs.features.States()
+}
+
+func (bgs *BGS) handleAdminListFeatures(e echo.Context) error {
+	return e.JSON(200, map[string]any{
+		"features": bgs.featureStates(),
+	})
+}
+
+// lookupFeature resolves a feature flag named in an admin request
+func (bgs *BGS) lookupFeature(name string) (features.Flag, error) {
+	if bgs.features == nil {
+		return 0, &echo.HTTPError{
+			Code:    400,
+			Message: "feature flags are not enabled",
+		}
+	}
+	f, err := features.Lookup(name)
+	if errors.Is(err, features.ErrUnknownFlag) {
+		return 0, &echo.HTTPError{
+			Code:    404,
+			Message: err.Error(),
+		}
+	}
+	return f, err
+}
+
+func (bgs *BGS) handleAdminSetFeature(e echo.Context) error {
+	var body struct {
+		Name    string `json:"name"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Enabled == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify enabled",
+		}
+	}
+	f, err := bgs.lookupFeature(body.Name)
+	if err != nil {
+		return err
+	}
+	if err := bgs.features.Override(e.Request().Context(), f, *body.Enabled); err != nil {
+		return err
+	}
+	bgs.log.Info("feature flag overridden", "flag", f, "enabled", *body.Enabled)
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminResetFeature(e echo.Context) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	f, err := bgs.lookupFeature(body.Name)
+	if err != nil {
+		return err
+	}
+	if err := bgs.features.Reset(e.Request().Context(), f); err != nil {
+		return err
+	}
+	bgs.log.Info("feature flag override reset", "flag", f, "enabled", bgs.features.Enabled(f))
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
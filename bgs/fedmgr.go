@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -55,7 +57,11 @@ type Slurper struct {
 	shutdownChan   chan bool
 	shutdownResult chan []error
 
-	ssl bool
+	ssl   bool
+	proxy func(*http.Request) (*url.URL, error)
+
+	// if set, events for which this returns true are not subject to per-host rate limits
+	ExemptFromLimits func(evt *events.XRPCStreamEvent) bool
 }
 
 type Limiters struct {
@@ -73,6 +79,8 @@ type SlurperOptions struct {
 	DefaultRepoLimit      int64
 	ConcurrencyPerPDS     int64
 	MaxQueuePerPDS        int64
+	// chooses the proxy subscriptions to PDSes connect through; nil connects directly
+	Proxy func(*http.Request) (*url.URL, error)
 }
 
 func DefaultSlurperOptions() *SlurperOptions {
@@ -85,6 +93,7 @@ func DefaultSlurperOptions() *SlurperOptions {
 		DefaultRepoLimit:      100,
 		ConcurrencyPerPDS:     100,
 		MaxQueuePerPDS:        1_000,
+		Proxy:                 http.ProxyFromEnvironment,
 	}
 }
 
@@ -113,6 +122,7 @@ func NewSlurper(db *gorm.DB, cb IndexCallback, opts *SlurperOptions) (*Slurper,
 		ConcurrencyPerPDS:     opts.ConcurrencyPerPDS,
 		MaxQueuePerPDS:        opts.MaxQueuePerPDS,
 		ssl:                   opts.SSL,
+		proxy:                 opts.Proxy,
 		shutdownChan:          make(chan bool),
 		shutdownResult:        make(chan []error),
 	}
@@ -471,6 +481,7 @@ func (s *Slurper) subscribeWithRedialer(ctx context.Context, host *models.PDS, s
 
 	d := websocket.Dialer{
 		HandshakeTimeout: time.Second * 5,
+		Proxy:            s.proxy,
 	}
 
 	protocol := "ws"
@@ -644,6 +655,7 @@ func (s *Slurper) handleConnection(ctx context.Context, host *models.PDS, con *w
 	}
 
 	instrumentedRSC := events.NewInstrumentedRepoStreamCallbacks(limiters, rsc.EventHandler)
+	instrumentedRSC.Exempt = s.ExemptFromLimits
 
 	pool := parallel.NewScheduler(
 		100,
@@ -0,0 +1,181 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSovereignFilterConfidence(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+
+	assert.NoError(b.SetClassifications(context.Background(), []sovereignty.Classification{
+		{DID: "did:plc:admin", Country: "CA", Source: "admin"},
+		{DID: "did:plc:geo", Country: "CA", Source: "pds-geo", Confidence: sovereignty.ConfidenceMedium},
+		{DID: "did:plc:tld", Country: "CA", Source: "pds-geo", Confidence: sovereignty.ConfidenceLow},
+		{DID: "did:plc:away", Country: "US", Source: "pds-geo", Confidence: sovereignty.ConfidenceLow},
+	}))
+	// recorded confidence survives a restart
+	assert.NoError(b.loadClassifications())
+	cl, ok := b.Classifications.Get("did:plc:tld")
+	assert.True(ok)
+	assert.Equal(sovereignty.ConfidenceLow, cl.Confidence)
+
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}}
+	}
+	for _, tc := range []struct {
+		mode     sovereignty.FilterMode
+		did      string
+		expected sovereignty.FilterResult
+	}{
+		{sovereignty.FilterBalanced, "did:plc:admin", sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonCountry}},
+		{sovereignty.FilterBalanced, "did:plc:tld", sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonCountry}},
+		{sovereignty.FilterBalanced, "did:plc:away", sovereignty.FilterResult{Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonOtherCountry}},
+		{sovereignty.FilterBalanced, "did:plc:nobody", sovereignty.FilterResult{Confidence: sovereignty.ConfidenceNone, Reason: sovereignty.FilterReasonUnclassified}},
+		{sovereignty.FilterStrict, "did:plc:geo", sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceMedium, Reason: sovereignty.FilterReasonCountry}},
+		{sovereignty.FilterStrict, "did:plc:tld", sovereignty.FilterResult{Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonLowConfidence}},
+		{sovereignty.FilterStrict, "", sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonNoAccount}},
+	} {
+		b.filterMode = tc.mode
+		evt := identity(tc.did)
+		if tc.did == "" {
+			evt = &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}}
+		}
+		assert.Equal(tc.expected, b.sovereignFilter(evt, nil), "%s %s", tc.mode, tc.did)
+	}
+
+	_, err = sovereignty.ParseFilterMode("lenient")
+	assert.Error(err)
+
+	// with hash-only pass-through, commits left out are sent as stubs
+	b.filterMode = sovereignty.FilterBalanced
+	b.filterHashOnly = true
+	c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum([]byte("commit"))
+	assert.NoError(err)
+	since := "2222222222222"
+	commit := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Seq:    42,
+		Repo:   "did:plc:away",
+		Rev:    "3333333333333",
+		Since:  &since,
+		Commit: lexutil.LexLink(c),
+		Blocks: []byte("record content"),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.gndr.feed.post/3333333333333"}},
+		Blobs:  []lexutil.LexLink{lexutil.LexLink(c)},
+		Time:   "2024-01-01T00:00:00Z",
+	}}
+	assert.Equal(sovereignty.FilterResult{HashOnly: true, Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonOtherCountry}, b.sovereignFilter(commit, nil))
+	assert.False(b.sovereignFilter(identity("did:plc:away"), nil).HashOnly)
+	commit.RepoCommit.Repo = "did:plc:tld"
+	assert.Equal(sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonCountry}, b.sovereignFilter(commit, nil))
+
+	stub := hashOnlyEvent(commit)
+	assert.Equal(int64(42), stub.RepoCommit.Seq)
+	assert.Equal(commit.RepoCommit.Commit, stub.RepoCommit.Commit)
+	assert.Equal("3333333333333", stub.RepoCommit.Rev)
+	assert.Empty(stub.RepoCommit.Blocks)
+	assert.Empty(stub.RepoCommit.Ops)
+	assert.Empty(stub.RepoCommit.Blobs)
+	assert.NotEmpty(commit.RepoCommit.Blocks)
+	var buf bytes.Buffer
+	assert.NoError(stub.Serialize(&buf))
+
+	// a provincial stream carries accounts by subdivision
+	pol, err = b.newSovereignPolicy(&policy.Document{StreamSubdivisions: []string{"ca-qc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	assert.NoError(b.SetClassifications(context.Background(), []sovereignty.Classification{
+		{DID: "did:plc:quebec", Country: "CA", Subdivision: "QC", Source: "admin"},
+		{DID: "did:plc:ontario", Country: "CA", Subdivision: "ON", Source: "admin"},
+	}))
+	assert.Equal(sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonSubdivision}, b.sovereignFilter(identity("did:plc:quebec"), nil))
+	assert.Equal(sovereignty.FilterReasonOtherCountry, b.sovereignFilter(identity("did:plc:ontario"), nil).Reason)
+	// without a known subdivision, accounts aren't carried
+	assert.False(b.sovereignFilter(identity("did:plc:admin"), nil).Include)
+	assert.True(b.AccountStanding("did:plc:quebec").Included)
+	_, err = b.newSovereignPolicy(&policy.Document{StreamSubdivisions: []string{"QC"}})
+	assert.Error(err)
+
+	// an exclusion stream carries everyone but the excluded countries' accounts
+	pol, err = b.newSovereignPolicy(&policy.Document{ExcludeCountries: []string{"us"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	b.filterMode = sovereignty.FilterStrict
+	assert.Equal(sovereignty.FilterResult{Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonExcludedCountry}, b.sovereignFilter(identity("did:plc:away"), nil))
+	assert.Equal(sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonCountry}, b.sovereignFilter(identity("did:plc:tld"), nil))
+	assert.Equal(sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceNone, Reason: sovereignty.FilterReasonUnclassified}, b.sovereignFilter(identity("did:plc:nobody"), nil))
+	assert.True(b.AccountStanding("did:plc:quebec").Included)
+	assert.False(b.AccountStanding("did:plc:away").Included)
+	_, err = b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}, ExcludeCountries: []string{"US"}})
+	assert.ErrorIs(err, policy.ErrCarryAndExclude)
+}
+
+func TestSovereignFilterReasons(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b.clock = clk
+	b.Classifications.Clock = clk
+	b.filterCache = sovereignty.NewMemFilterCache(10)
+	b.countryRetry = time.Hour
+	b.countryUnresolved, _ = lru.New[string, time.Time](10)
+	b.countryResolver = sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		if did == "did:plc:away" {
+			return "US", sovereignty.ConfidenceHigh, nil
+		}
+		return "", sovereignty.ConfidenceNone, sovereignty.ErrCountryUnknown
+	})
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}}
+	}
+
+	// accounts not tried yet are told from those the resolver couldn't place
+	assert.Equal(sovereignty.FilterReasonUnclassified, b.sovereignFilter(identity("did:plc:nobody"), nil).Reason)
+	_, _, err = b.ResolveCountry(ctx, "did:plc:nobody", false)
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.Equal(sovereignty.FilterReasonUnresolved, b.sovereignFilter(identity("did:plc:nobody"), nil).Reason)
+	assert.Equal(1, b.filterCache.(*sovereignty.MemFilterCache).Len())
+	assert.Equal(float64(1), testutil.ToFloat64(filterCacheEntries))
+	clk.Advance(2 * time.Hour)
+	assert.Equal(sovereignty.FilterReasonUnclassified, b.sovereignFilter(identity("did:plc:nobody"), nil).Reason)
+
+	// decisions are counted by the account's country
+	_, applied, err := b.ResolveCountry(ctx, "did:plc:away", false)
+	assert.NoError(err)
+	assert.True(applied)
+	before := testutil.ToFloat64(sovereignFilterResults.WithLabelValues("exclude", "high", sovereignty.FilterReasonOtherCountry, "US"))
+	assert.Equal(sovereignty.FilterReasonOtherCountry, b.sovereignFilter(identity("did:plc:away"), nil).Reason)
+	assert.Equal(before+1, testutil.ToFloat64(sovereignFilterResults.WithLabelValues("exclude", "high", sovereignty.FilterReasonOtherCountry, "US")))
+	assert.Equal("none", b.filterCountryLabel(identity("did:plc:nobody")))
+}
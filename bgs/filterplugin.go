@@ -0,0 +1,68 @@
+package bgs
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/sovereignty/filterplugin"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupFilterPlugin connects to the operator's filter plugin, which is asked about the events the relay's filter and extensions carry
+func (bgs *BGS) setupFilterPlugin(config *SovereignConfig) error {
+	opts := filterplugin.DefaultOptions()
+	opts.Target = config.FilterPluginTarget
+	opts.TLS = config.FilterPluginTLS
+	opts.Conns = config.FilterPluginConns
+	opts.Timeout = config.FilterPluginTimeout
+	opts.Fallback = config.FilterPluginFallback
+	opts.Failures = config.FilterPluginFailures
+	opts.Cooldown = config.FilterPluginCooldown
+	opts.Classify = bgs.Classifications.Get
+	opts.Clock = bgs.clock
+	c, err := filterplugin.NewClient(opts)
+	if err != nil {
+		return fmt.Errorf("setting up filter plugin: %w", err)
+	}
+	bgs.filterPlugin = c
+	bgs.log.Info("using filter plugin", "target", opts.Target, "conns", opts.Conns, "timeout", opts.Timeout, "fallback", opts.Fallback)
+	return nil
+}
+
+// handleAdminFilterPluginStatus reports whether the filter plugin is being asked, or the relay has stopped asking it after failures, and which calls it implements
+func (bgs *BGS) handleAdminFilterPluginStatus(e echo.Context) error {
+	if bgs.filterPlugin == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "filter plugin is not configured",
+		}
+	}
+	return e.JSON(200, bgs.filterPlugin.Status())
+}
+
+type forgetFilterPluginBody struct {
+	Did string `json:"did"`
+}
+
+// handleAdminForgetFilterPlugin drops the filter plugin's cached decision on an account, so it is asked again about the account's next event
+func (bgs *BGS) handleAdminForgetFilterPlugin(e echo.Context) error {
+	if bgs.filterPlugin == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "filter plugin is not configured",
+		}
+	}
+	var body forgetFilterPluginBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did in body",
+		}
+	}
+	bgs.filterPlugin.Forget(body.Did)
+	bgs.log.Info("filter plugin decision forgotten", "did", body.Did)
+	return e.JSON(200, map[string]any{"success": true})
+}
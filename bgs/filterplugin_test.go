@@ -0,0 +1,80 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/filterplugin"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// handlePlugin drops identity events setting a spam handle
+type handlePlugin struct {
+	filterplugin.UnimplementedFilterServer
+}
+
+func (handlePlugin) ClassifyEvent(ctx context.Context, evt *filterplugin.Event) (*filterplugin.Decision, error) {
+	if evt.Handle == "spam.example.com" {
+		return &filterplugin.Decision{Verdict: filterplugin.Verdict_VERDICT_DROP, Reason: "handle"}, nil
+	}
+	return &filterplugin.Decision{Verdict: filterplugin.Verdict_VERDICT_KEEP}, nil
+}
+
+func TestFilterPlugin(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	assert.NoError(b.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:home", Country: "CA", Source: "admin"}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	filterplugin.RegisterFilterServer(srv, handlePlugin{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	config := DefaultSovereignConfig()
+	config.FilterPluginTarget = lis.Addr().String()
+	config.FilterPluginTimeout = 5 * time.Second
+	assert.NoError(b.setupFilterPlugin(&config))
+	defer b.filterPlugin.Close()
+
+	identity := func(handle string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:home", Handle: &handle}}
+	}
+	assert.True(b.evaluateFilter(identity("home.example.com"), nil).Include)
+	r := b.evaluateFilter(identity("spam.example.com"), nil)
+	assert.False(r.Include)
+	assert.Equal(sovereignty.FilterReasonPlugin, r.Reason)
+
+	// events the relay's own filter drops aren't asked about
+	other := &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:away"}}
+	assert.Equal(sovereignty.FilterReasonUnclassified, b.evaluateFilter(other, nil).Reason)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	assert.NoError(b.handleAdminFilterPluginStatus(e.NewContext(httptest.NewRequest("GET", "/admin/sovereignty/filter-plugin", nil), rec)))
+	var st filterplugin.Status
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &st))
+	assert.Equal(filterplugin.CircuitClosed, st.Circuit)
+	assert.False(st.Classify)
+	assert.True(st.ClassifyEvent)
+}
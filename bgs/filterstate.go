@@ -0,0 +1,232 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// classifications imported from a filter state snapshot per database write
+const filterStateBatchSize = 1000
+
+// FilterStateImport reports what was taken from a filter state snapshot
+type FilterStateImport struct {
+	ExportedAt      time.Time `json:"exportedAt"`
+	Accounts        int       `json:"accounts"`
+	Classifications int       `json:"classifications"`
+	Decisions       int       `json:"decisions"`
+	Tried           int       `json:"tried"`
+	Unresolved      int       `json:"unresolved"`
+	// pieces of state left out as lapsed, invalid, or older than what this relay already knows
+	Skipped int `json:"skipped"`
+}
+
+// ExportFilterState writes a snapshot of what the sovereign stream filter knows about accounts: their classifications, the decisions held by an in-process filter cache (a shared cache is left out, being shared already), and when the country resolver last tried them or couldn't place them. Returns the number of accounts written
+func (bgs *BGS) ExportFilterState(w io.Writer) (int, error) {
+	entries := make(map[string]*sovereignty.FilterStateEntry)
+	entry := func(did string) *sovereignty.FilterStateEntry {
+		e, ok := entries[did]
+		if !ok {
+			e = &sovereignty.FilterStateEntry{DID: did}
+			entries[did] = e
+		}
+		return e
+	}
+
+	for _, c := range bgs.Classifications.Snapshot() {
+		c := c
+		entry(c.DID).Classification = &c
+	}
+	if fc, ok := bgs.filterCache.(*sovereignty.MemFilterCache); ok {
+		fc.Range(func(did string, d sovereignty.FilterDecision, expires time.Time) bool {
+			e := entry(did)
+			e.Decision = &d
+			if !expires.IsZero() {
+				exp := expires.UTC()
+				e.DecisionExpiresAt = &exp
+			}
+			return true
+		})
+	}
+	rangeTimes(bgs.countryTried, func(did string, at time.Time) {
+		entry(did).TriedAt = &at
+	})
+	rangeTimes(bgs.countryUnresolved, func(did string, at time.Time) {
+		entry(did).UnresolvedAt = &at
+	})
+
+	dids := make([]string, 0, len(entries))
+	for did := range entries {
+		dids = append(dids, did)
+	}
+	sort.Strings(dids)
+
+	fw, err := sovereignty.NewFilterStateWriter(w, bgs.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	for i, did := range dids {
+		if err := fw.Write(*entries[did]); err != nil {
+			return i, err
+		}
+	}
+	return len(dids), nil
+}
+
+func rangeTimes(c *lru.Cache[string, time.Time], fn func(did string, at time.Time)) {
+	if c == nil {
+		return
+	}
+	for _, did := range c.Keys() {
+		if at, ok := c.Peek(did); ok {
+			fn(did, at.UTC())
+		}
+	}
+}
+
+// ImportFilterState takes the state of another relay's sovereign stream filter from a snapshot written by ExportFilterState, to warm-start this one. Lapsed state, and state older than what this relay already knows of an account, is skipped; classifications are persisted
+func (bgs *BGS) ImportFilterState(ctx context.Context, r io.Reader) (*FilterStateImport, error) {
+	rep := &FilterStateImport{}
+	now := bgs.clock.Now()
+	var batch []sovereignty.Classification
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := bgs.SetClassifications(ctx, batch); err != nil {
+			return fmt.Errorf("persisting classifications: %w", err)
+		}
+		rep.Classifications += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	hdr, err := sovereignty.ReadFilterState(r, func(e sovereignty.FilterStateEntry) error {
+		rep.Accounts++
+		if c := e.Classification; c != nil {
+			if bgs.importableClassification(e.DID, c, now) {
+				c.DID = e.DID
+				batch = append(batch, *c)
+			} else {
+				rep.Skipped++
+			}
+		}
+		if e.Decision != nil {
+			if bgs.importDecision(ctx, e, now) {
+				rep.Decisions++
+			} else {
+				rep.Skipped++
+			}
+		}
+		if e.TriedAt != nil {
+			if bgs.importTime(bgs.countryTried, e.DID, *e.TriedAt, now) {
+				rep.Tried++
+			} else {
+				rep.Skipped++
+			}
+		}
+		if e.UnresolvedAt != nil {
+			if bgs.importTime(bgs.countryUnresolved, e.DID, *e.UnresolvedAt, now) {
+				rep.Unresolved++
+			} else {
+				rep.Skipped++
+			}
+		}
+		if len(batch) >= filterStateBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if hdr != nil {
+		rep.ExportedAt = hdr.ExportedAt
+	}
+	if err != nil {
+		return rep, err
+	}
+	if err := flush(); err != nil {
+		return rep, err
+	}
+	bgs.observeFilterCacheSize()
+	return rep, nil
+}
+
+// importableClassification returns true if a classification from a snapshot is valid, unexpired, and newer than the account's current one
+func (bgs *BGS) importableClassification(did string, c *sovereignty.Classification, now time.Time) bool {
+	if c.Expired(now) || c.UpdatedAt.IsZero() {
+		return false
+	}
+	country, err := sovereignty.NormalizeCountry(c.Country)
+	if err != nil {
+		return false
+	}
+	c.Country = country
+	if cur, ok := bgs.Classifications.Get(did); ok && !cur.UpdatedAt.Before(c.UpdatedAt) {
+		return false
+	}
+	return true
+}
+
+// importDecision caches a decision from a snapshot for the rest of its lifetime, unless it has lapsed or the cache already holds one
+func (bgs *BGS) importDecision(ctx context.Context, e sovereignty.FilterStateEntry, now time.Time) bool {
+	var ttl time.Duration
+	if e.DecisionExpiresAt != nil {
+		ttl = e.DecisionExpiresAt.Sub(now)
+		if ttl <= 0 {
+			return false
+		}
+	}
+	if cur, err := bgs.filterCache.Get(ctx, e.DID); err != nil || cur != nil {
+		return false
+	}
+	if err := bgs.filterCache.Set(ctx, e.DID, *e.Decision, ttl); err != nil {
+		bgs.log.Warn("failed to update filter cache", "did", e.DID, "err", err)
+		return false
+	}
+	return true
+}
+
+// importTime records when the country resolver tried an account, or couldn't place it, if automatic classification is enabled, it is still within the retry interval, and it is later than what is recorded
+func (bgs *BGS) importTime(c *lru.Cache[string, time.Time], did string, at, now time.Time) bool {
+	if c == nil || now.Sub(at) >= bgs.countryRetry {
+		return false
+	}
+	if cur, ok := c.Peek(did); ok && !cur.Before(at) {
+		return false
+	}
+	c.Add(did, at)
+	return true
+}
+
+// handleAdminExportFilterState streams a snapshot of the sovereign stream filter's state, as JSON lines
+func (bgs *BGS) handleAdminExportFilterState(e echo.Context) error {
+	e.Response().Header().Set(echo.HeaderContentType, "application/jsonl")
+	e.Response().WriteHeader(200)
+	n, err := bgs.ExportFilterState(e.Response())
+	if err != nil {
+		bgs.log.Warn("filter state export failed", "written", n, "err", err)
+		return nil
+	}
+	bgs.log.Info("filter state export finished", "accounts", n)
+	return nil
+}
+
+// handleAdminImportFilterState warm-starts the sovereign stream filter from a snapshot exported by another relay, in the request body
+func (bgs *BGS) handleAdminImportFilterState(e echo.Context) error {
+	start := time.Now()
+	rep, err := bgs.ImportFilterState(e.Request().Context(), e.Request().Body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("filter state import failed after %d accounts: %s", rep.Accounts, err),
+		}
+	}
+	bgs.log.Info("filter state import finished", "accounts", rep.Accounts, "classifications", rep.Classifications, "decisions", rep.Decisions, "tried", rep.Tried, "unresolved", rep.Unresolved, "skipped", rep.Skipped, "exported_at", rep.ExportedAt, "elapsed", time.Since(start))
+	return e.JSON(200, rep)
+}
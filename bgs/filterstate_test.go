@@ -0,0 +1,108 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFilterStateTest(t *testing.T, clk *clock.Mock) *BGS {
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	b.clock = clk
+	b.Classifications.Clock = clk
+	fc := sovereignty.NewMemFilterCache(10)
+	fc.Clock = clk
+	b.filterCache = fc
+	b.countryRetry = time.Hour
+	b.countryTried, _ = lru.New[string, time.Time](10)
+	b.countryUnresolved, _ = lru.New[string, time.Time](10)
+	b.countryResolver = sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		return "", sovereignty.ConfidenceNone, sovereignty.ErrCountryUnknown
+	})
+	return b
+}
+
+func TestFilterState(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}}
+	}
+
+	src := setupFilterStateTest(t, clk)
+	assert.NoError(src.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:home", Country: "CA", Source: "admin"}))
+	src.countryTried.Add("did:plc:nobody", clk.Now())
+	_, _, err := src.ResolveCountry(ctx, "did:plc:nobody", false)
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	// tried too long ago to matter
+	src.countryTried.Add("did:plc:stale", clk.Now().Add(-2*time.Hour))
+
+	var buf bytes.Buffer
+	n, err := src.ExportFilterState(&buf)
+	assert.NoError(err)
+	assert.Equal(3, n)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 4)
+	assert.JSONEq(`{"version": 1, "exportedAt": "2024-01-01T00:00:00Z"}`, lines[0])
+
+	clk.Advance(time.Minute)
+	dst := setupFilterStateTest(t, clk)
+	assert.Equal(sovereignty.FilterReasonUnclassified, dst.sovereignFilter(identity("did:plc:nobody"), nil).Reason)
+	rep, err := dst.ImportFilterState(ctx, bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(FilterStateImport{
+		ExportedAt:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Accounts:        3,
+		Classifications: 1,
+		Decisions:       2,
+		Tried:           1,
+		Unresolved:      1,
+		Skipped:         1,
+	}, *rep)
+
+	cl, ok := dst.Classifications.Get("did:plc:home")
+	assert.True(ok)
+	assert.Equal("CA", cl.Country)
+	assert.True(dst.sovereignFilter(identity("did:plc:home"), nil).Include)
+	// the account the source relay couldn't place isn't tried again here
+	assert.Equal(sovereignty.FilterReasonUnresolved, dst.sovereignFilter(identity("did:plc:nobody"), nil).Reason)
+	_, tried := dst.countryTried.Get("did:plc:nobody")
+	assert.True(tried)
+	_, tried = dst.countryTried.Get("did:plc:stale")
+	assert.False(tried)
+
+	// nothing is newer the second time
+	rep, err = dst.ImportFilterState(ctx, bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(0, rep.Classifications+rep.Decisions+rep.Tried+rep.Unresolved)
+	assert.Equal(6, rep.Skipped)
+
+	// nor once it has lapsed
+	clk.Advance(2 * time.Hour)
+	other := setupFilterStateTest(t, clk)
+	rep, err = other.ImportFilterState(ctx, bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(1, rep.Classifications)
+	assert.Equal(1, rep.Decisions)
+	assert.Equal(0, rep.Tried+rep.Unresolved)
+
+	_, err = dst.ImportFilterState(ctx, strings.NewReader(`{"version": 2, "exportedAt": "2024-01-01T00:00:00Z"}`+"\n"))
+	assert.ErrorContains(err, "unsupported filter state version 2")
+}
@@ -0,0 +1,115 @@
+package bgs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/flapping"
+	"github.com/bluesky-social/indigo/sovereignty/forensics"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (bgs *BGS) setupFlapping(config *SovereignConfig) {
+	opts := flapping.DefaultOptions()
+	opts.Changes = config.ClassificationFlapChanges
+	opts.Window = config.ClassificationFlapWindow
+	opts.HoldDown = config.ClassificationHoldDown
+	opts.Clock = bgs.clock
+	bgs.flaps = flapping.NewDetector(opts)
+}
+
+// observeClassification records an applied classification with the flapping detector. If the account is held at another classification, it is returned, to go back to
+func (bgs *BGS) observeClassification(prev *sovereignty.Classification, c sovereignty.Classification, manual bool) *sovereignty.Classification {
+	flapping, hold := bgs.flaps.Observe(prev, c, manual)
+	if !flapping {
+		return nil
+	}
+	held := c
+	if hold != nil {
+		held = *hold
+	}
+	bgs.log.Warn("account classification is flapping", "did", c.DID, "country", c.Country, "source", c.Source, "heldCountry", held.Country)
+	if bgs.forensics != nil {
+		detail := fmt.Sprintf("classified %s by %s", c.Country, c.Source)
+		if prev != nil {
+			detail = fmt.Sprintf("classified %s by %s, after %s", c.Country, c.Source, prev.Country)
+		}
+		bgs.forensics.Trigger(forensics.Trigger{Kind: forensics.KindFlapping, DID: c.DID, Detail: detail})
+	}
+	return hold
+}
+
+// holdClassification goes back to the classification a flapping account is held at
+func (bgs *BGS) holdClassification(hold sovereignty.Classification) sovereignty.Classification {
+	hold.UpdatedAt = bgs.clock.Now().UTC()
+	hold.ExpiresAt = nil
+	if hold.Confidence != sovereignty.ConfidenceNone && bgs.classificationTTL > 0 {
+		// it came from the resolver, and lapses as its answers do
+		exp := hold.UpdatedAt.Add(bgs.classificationTTL)
+		hold.ExpiresAt = &exp
+	}
+	return hold
+}
+
+type flappingResponse struct {
+	Accounts []flapping.Status `json:"accounts"`
+}
+
+// handleAdminFlapping reports the accounts whose classification is flapping, or held after flapping, by most changes
+func (bgs *BGS) handleAdminFlapping(e echo.Context) error {
+	if bgs.flaps == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "flapping detection is not enabled",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	accounts := bgs.flaps.Flapping()
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+	}
+	if accounts == nil {
+		accounts = []flapping.Status{}
+	}
+	return e.JSON(200, flappingResponse{Accounts: accounts})
+}
+
+type releaseHoldBody struct {
+	Did string `json:"did"`
+}
+
+// handleAdminReleaseFlapping ends the hold on a flapping account's classification, so the country resolver's answers apply again
+func (bgs *BGS) handleAdminReleaseFlapping(e echo.Context) error {
+	if bgs.flaps == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "flapping detection is not enabled",
+		}
+	}
+	var body releaseHoldBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	bgs.flaps.Release(did.String())
+	return e.JSON(200, map[string]any{"success": true})
+}
@@ -0,0 +1,81 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassificationFlapping(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	b.flaps = nil
+	_, err := call("GET", "/admin/sovereignty/flapping", "", b.handleAdminFlapping)
+	assert.Error(err)
+
+	config := DefaultSovereignConfig()
+	b.setupFlapping(&config)
+
+	// the resolvers disagree, the weaker answer sometimes winning
+	var country string
+	var conf sovereignty.Confidence
+	b.countryResolver = sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		return country, conf, nil
+	})
+	b.countryMinConfidence = sovereignty.ConfidenceLow
+	resolve := func(c string, cf sovereignty.Confidence) bool {
+		country, conf = c, cf
+		_, applied, err := b.ResolveCountry(ctx, "did:plc:flappy", false)
+		assert.NoError(err)
+		return applied
+	}
+	assert.True(resolve("CA", sovereignty.ConfidenceMedium))
+	assert.True(resolve("US", sovereignty.ConfidenceLow))
+	assert.True(resolve("CA", sovereignty.ConfidenceMedium))
+	assert.True(resolve("US", sovereignty.ConfidenceLow))
+
+	// held at the more confident classification
+	cl, ok := b.Classifications.Get("did:plc:flappy")
+	assert.True(ok)
+	assert.Equal("CA", cl.Country)
+	assert.Equal(sovereignty.ConfidenceMedium, cl.Confidence)
+	assert.False(resolve("US", sovereignty.ConfidenceLow))
+	cl, _ = b.Classifications.Get("did:plc:flappy")
+	assert.Equal("CA", cl.Country)
+
+	rec, err := call("GET", "/admin/sovereignty/flapping", "", b.handleAdminFlapping)
+	assert.NoError(err)
+	var report flappingResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &report))
+	if assert.Len(report.Accounts, 1) {
+		assert.Equal("did:plc:flappy", report.Accounts[0].DID)
+		assert.Equal(3, report.Accounts[0].Changes)
+		if assert.NotNil(report.Accounts[0].Held) {
+			assert.Equal("CA", report.Accounts[0].Held.Country)
+		}
+	}
+
+	_, err = call("POST", "/admin/sovereignty/flapping/release", `{"did": "nope"}`, b.handleAdminReleaseFlapping)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/flapping/release", `{"did": "did:plc:flappy"}`, b.handleAdminReleaseFlapping)
+	assert.NoError(err)
+	assert.True(resolve("US", sovereignty.ConfidenceLow))
+	cl, _ = b.Classifications.Get("did:plc:flappy")
+	assert.Equal("US", cl.Country)
+}
@@ -0,0 +1,153 @@
+package bgs
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/flapping"
+	"github.com/bluesky-social/indigo/sovereignty/forensics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// forensicState is the classification state of an account recorded in its forensic bundles
+type forensicState struct {
+	Classification *sovereignty.Classification `json:"classification,omitempty"`
+	// recent changes of the account's classification, if it has any
+	Flapping *flapping.Status `json:"flapping,omitempty"`
+	// the account's events are being withheld from the sovereign stream for dominating the talkers window
+	Limited  bool `json:"limited,omitempty"`
+	Priority bool `json:"priority,omitempty"`
+}
+
+func (bgs *BGS) setupForensics(config *SovereignConfig) error {
+	opts := forensics.DefaultOptions()
+	opts.Frames = config.ForensicsFrames
+	opts.Cooldown = config.ForensicsCooldown
+	opts.MaxBundles = config.ForensicsMaxBundles
+	opts.State = bgs.forensicState
+	opts.Clock = bgs.clock
+	opts.Log = bgs.log.With("subsystem", "forensics")
+	rec, err := forensics.NewRecorder(config.ForensicsDir, opts)
+	if err != nil {
+		return fmt.Errorf("setting up forensic capture: %w", err)
+	}
+	bgs.forensics = rec
+	// so bundles carry the relay's log records about the account
+	bgs.log = slog.New(rec.Handler(bgs.log.Handler()))
+	if bgs.events != nil {
+		bgs.events.OnOrderingViolation(bgs.orderingViolated)
+	}
+	return nil
+}
+
+func (bgs *BGS) forensicState(did string) any {
+	st := forensicState{
+		Limited:  bgs.talkers != nil && bgs.talkers.Limited(did),
+		Priority: bgs.Priority.IsPriority(did),
+	}
+	if c, ok := bgs.Classifications.Get(did); ok {
+		st.Classification = &c
+	}
+	if bgs.flaps != nil {
+		if f, ok := bgs.flaps.Get(did); ok {
+			st.Flapping = &f
+		}
+	}
+	return st
+}
+
+func (bgs *BGS) orderingViolated(v events.OrderingViolation) {
+	detail := fmt.Sprintf("seq %d after %d", v.Seq, v.PrevSeq)
+	if v.Kind == "rev" {
+		detail = fmt.Sprintf("rev %s after %s", v.Rev, v.PrevRev)
+	}
+	bgs.forensics.Trigger(forensics.Trigger{Kind: forensics.KindOrdering, DID: v.DID, Detail: detail})
+}
+
+type forensicCaptureBody struct {
+	Did    string `json:"did"`
+	Host   string `json:"host"`
+	Reason string `json:"reason"`
+}
+
+// handleAdminForensicCapture captures a forensic bundle for an account or host on request
+func (bgs *BGS) handleAdminForensicCapture(e echo.Context) error {
+	if bgs.forensics == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "forensic capture is not enabled",
+		}
+	}
+	var body forensicCaptureBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did != "" {
+		if _, err := syntax.ParseDID(body.Did); err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Errorf("invalid did: %w", err).Error(),
+			}
+		}
+	} else if body.Host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did or host",
+		}
+	}
+	queued := bgs.forensics.Trigger(forensics.Trigger{Kind: forensics.KindManual, DID: body.Did, Host: body.Host, Detail: body.Reason})
+	if !queued {
+		return &echo.HTTPError{
+			Code:    503,
+			Message: "too many captures waiting to be written",
+		}
+	}
+	return e.JSON(200, map[string]any{"queued": true})
+}
+
+// handleAdminListForensics lists the forensic bundles on disk, newest first
+func (bgs *BGS) handleAdminListForensics(e echo.Context) error {
+	if bgs.forensics == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "forensic capture is not enabled",
+		}
+	}
+	list, err := bgs.forensics.List()
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		list = []forensics.BundleInfo{}
+	}
+	return e.JSON(200, list)
+}
+
+// handleAdminGetForensicBundle returns a forensic bundle by name
+func (bgs *BGS) handleAdminGetForensicBundle(e echo.Context) error {
+	if bgs.forensics == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "forensic capture is not enabled",
+		}
+	}
+	b, err := bgs.forensics.Open(e.QueryParam("name"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "no such bundle",
+			}
+		}
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	return e.JSON(200, b)
+}
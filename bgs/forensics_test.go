@@ -0,0 +1,94 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/forensics"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForensicCapture(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/forensics", "", b.handleAdminListForensics)
+	assert.Error(err)
+
+	config := DefaultSovereignConfig()
+	config.ForensicsDir = t.TempDir()
+	b.setupFlapping(&config)
+	assert.NoError(b.setupForensics(&config))
+	go b.forensics.Run(ctx)
+
+	for i := int64(1); i <= 3; i++ {
+		b.forensics.RecordFrame("pds.example.ca", &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:flappy", Seq: i, Time: "2024-01-01T00:00:00Z"}})
+	}
+	// the account moves back and forth between countries; the first classification isn't a change
+	for _, country := range []string{"CA", "US", "CA", "US"} {
+		assert.NoError(b.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:flappy", Country: country, Source: "pds-geo"}))
+	}
+
+	var list []forensics.BundleInfo
+	assert.Eventually(func() bool {
+		rec, err := call("GET", "/admin/sovereignty/forensics", "", b.handleAdminListForensics)
+		return err == nil && json.Unmarshal(rec.Body.Bytes(), &list) == nil && len(list) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	if len(list) != 1 {
+		return
+	}
+
+	rec, err := call("GET", "/admin/sovereignty/forensics/bundle?name="+list[0].Name, "", b.handleAdminGetForensicBundle)
+	assert.NoError(err)
+	var bundle struct {
+		forensics.Bundle
+		State forensicState `json:"state"`
+	}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &bundle))
+	assert.Equal(forensics.KindFlapping, bundle.Trigger.Kind)
+	assert.Equal("did:plc:flappy", bundle.Trigger.DID)
+	assert.Equal("pds.example.ca", bundle.Trigger.Host)
+	assert.Len(bundle.Frames, 3)
+	assert.Equal("US", bundle.State.Classification.Country)
+	if assert.NotNil(bundle.State.Flapping) {
+		assert.Equal(3, bundle.State.Flapping.Changes)
+	}
+	var flapLogged bool
+	for _, l := range bundle.Logs {
+		flapLogged = flapLogged || l.Message == "account classification is flapping"
+	}
+	assert.True(flapLogged)
+
+	_, err = call("GET", "/admin/sovereignty/forensics/bundle?name=missing.json.gz", "", b.handleAdminGetForensicBundle)
+	if assert.Error(err) {
+		assert.Equal(404, err.(*echo.HTTPError).Code)
+	}
+
+	// operators can capture the same account again straight away
+	_, err = call("POST", "/admin/sovereignty/forensics/capture", `{"did": "did:plc:flappy", "reason": "appeal 12"}`, b.handleAdminForensicCapture)
+	assert.NoError(err)
+	assert.Eventually(func() bool {
+		l, err := b.forensics.List()
+		return err == nil && len(l) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = call("POST", "/admin/sovereignty/forensics/capture", `{"reason": "nobody"}`, b.handleAdminForensicCapture)
+	assert.Error(err)
+}
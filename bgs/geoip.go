@@ -0,0 +1,55 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+)
+
+// setupPDSGeo opens the GeoIP database, if configured, and returns the geolocator for PDS addresses: the operator's IP ranges first, then the database. Returns nil if neither is configured
+func (bgs *BGS) setupPDSGeo(config *SovereignConfig) (pdsgeo.Geolocator, error) {
+	if config.PDSGeoIPDatabase == "" {
+		return config.PDSGeoRanges, nil
+	}
+	db, err := pdsgeo.OpenMMDB(config.PDSGeoIPDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("opening GeoIP database: %w", err)
+	}
+	bgs.geoIP = db
+	md := db.Metadata()
+	bgs.log.Info("loaded GeoIP database", "path", config.PDSGeoIPDatabase, "type", md.DatabaseType, "built", time.Unix(int64(md.BuildEpoch), 0).UTC())
+	if config.PDSGeoRanges == nil {
+		return db, nil
+	}
+	return pdsgeo.Geolocators{config.PDSGeoRanges, db}, nil
+}
+
+// runGeoIPReloads checks the GeoIP database file for changes every interval, reloading it when it has, until the context is cancelled. A file which fails to load is logged, and the previous database kept
+func (bgs *BGS) runGeoIPReloads(ctx context.Context, interval time.Duration) {
+	t := bgs.clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			bgs.reloadGeoIP()
+		}
+	}
+}
+
+func (bgs *BGS) reloadGeoIP() {
+	reloaded, err := bgs.geoIP.Reload()
+	if err != nil {
+		geoIPReloadsCounter.WithLabelValues("failed").Inc()
+		bgs.log.Error("failed to reload GeoIP database, keeping the previous one", "err", err)
+		return
+	}
+	if reloaded {
+		geoIPReloadsCounter.WithLabelValues("reloaded").Inc()
+		md := bgs.geoIP.Metadata()
+		bgs.log.Info("reloaded GeoIP database", "type", md.DatabaseType, "built", time.Unix(int64(md.BuildEpoch), 0).UTC())
+	}
+}
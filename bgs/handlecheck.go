@@ -0,0 +1,252 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/label"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/handlecheck"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// label the relay applies to accounts whose handle persistently fails verification
+const HandleUnverifiedLabel = "handle-unverified"
+
+// checkHandle re-resolves the account's DID document, and verifies that its claimed handle resolves back to the DID
+func (bgs *BGS) checkHandle(ctx context.Context, did string) (string, error) {
+	bgs.didr.FlushCacheFor(did)
+	doc, err := bgs.didr.GetDocument(ctx, did)
+	if err != nil {
+		return "", fmt.Errorf("resolving DID document: %w", err)
+	}
+	if len(doc.AlsoKnownAs) == 0 {
+		return "", fmt.Errorf("DID document claims no handle")
+	}
+	u, err := url.Parse(doc.AlsoKnownAs[0])
+	if err != nil || u.Scheme != "at" || u.Host == "" {
+		return "", fmt.Errorf("DID document has an invalid handle: %q", doc.AlsoKnownAs[0])
+	}
+	handle := strings.ToLower(u.Host)
+	resolved, err := bgs.hr.ResolveHandleToDid(ctx, handle)
+	if err != nil {
+		return handle, err
+	}
+	if resolved != did {
+		return handle, fmt.Errorf("handle resolves to %s", resolved)
+	}
+	return handle, nil
+}
+
+// trackedHandleDIDs returns the accounts whose handles are periodically verified: all classified accounts
+func (bgs *BGS) trackedHandleDIDs() []string {
+	snap := bgs.Classifications.Snapshot()
+	out := make([]string, 0, len(snap))
+	for _, c := range snap {
+		out = append(out, c.DID)
+	}
+	return out
+}
+
+// loadHandleChecks restores persisted handle check results into the pool
+func (bgs *BGS) loadHandleChecks() error {
+	var rows []models.HandleVerification
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading handle verifications: %w", err)
+	}
+	sts := make([]handlecheck.Status, 0, len(rows))
+	for _, r := range rows {
+		st := handlecheck.Status{
+			DID:       r.Did,
+			Handle:    r.Handle,
+			Verified:  r.Verified,
+			Failures:  r.Failures,
+			LastError: r.LastError,
+			CheckedAt: r.CheckedAt,
+			NextCheck: r.NextCheck,
+		}
+		if r.FailingSince != nil {
+			st.FailingSince = *r.FailingSince
+		}
+		sts = append(sts, st)
+	}
+	bgs.handleChecks.Load(sts)
+	return nil
+}
+
+// saveHandleCheck persists a handle check result
+func (bgs *BGS) saveHandleCheck(st handlecheck.Status, flipped bool) {
+	row := models.HandleVerification{
+		Did:       st.DID,
+		Handle:    st.Handle,
+		Verified:  st.Verified,
+		Failures:  st.Failures,
+		LastError: st.LastError,
+		CheckedAt: st.CheckedAt,
+		NextCheck: st.NextCheck,
+	}
+	if st.Persistent() {
+		row.FailingSince = &st.FailingSince
+	}
+	err := bgs.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "handle", "verified", "failures", "last_error", "checked_at", "next_check", "failing_since"}),
+	}).Create(&row).Error
+	if err != nil {
+		bgs.log.Error("failed to persist handle verification", "did", st.DID, "err", err)
+	}
+	if flipped {
+		bgs.log.Info("handle verification persistence changed", "did", st.DID, "handle", st.Handle, "failing", st.Persistent(), "err", st.LastError)
+	}
+}
+
+// handleLabel returns the signed label for a persistently failing account
+func (bgs *BGS) handleLabel(st handlecheck.Status) (*comatproto.LabelDefs_Label, error) {
+	l := label.Label{
+		CreatedAt: st.FailingSince.UTC().Format(time.RFC3339),
+		URI:       st.DID,
+		Val:       HandleUnverifiedLabel,
+		Version:   label.ATPROTO_LABEL_VERSION,
+	}
+	if err := bgs.selfRepo.SignLabel(&l); err != nil {
+		return nil, err
+	}
+	lex := l.ToLexicon()
+	return &lex, nil
+}
+
+// handleQueryLabels serves the relay's labels (com.atproto.label.queryLabels), signed with its own repo key. uriPatterns may be DIDs, or prefixes ending in '*'.
+func (bgs *BGS) handleQueryLabels(e echo.Context) error {
+	patterns := e.QueryParams()["uriPatterns"]
+	if len(patterns) == 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify at least one uriPatterns",
+		}
+	}
+	if sources := e.QueryParams()["sources"]; len(sources) > 0 {
+		found := false
+		for _, s := range sources {
+			found = found || s == bgs.selfRepo.DID().String()
+		}
+		if !found {
+			return e.JSON(200, comatproto.LabelQueryLabels_Output{Labels: []*comatproto.LabelDefs_Label{}})
+		}
+	}
+	limit := 50
+	if l := e.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 250 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 250)",
+			}
+		}
+		limit = n
+	}
+	cursor := e.QueryParam("cursor")
+
+	// pages are in DID order, so the cursor is the last DID returned
+	var matched []handlecheck.Status
+	for _, st := range bgs.handleChecks.Failing() {
+		if st.DID > cursor && matchesURIPatterns(st.DID, patterns) {
+			matched = append(matched, st)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].DID < matched[j].DID })
+
+	out := comatproto.LabelQueryLabels_Output{Labels: []*comatproto.LabelDefs_Label{}}
+	if len(matched) > limit {
+		matched = matched[:limit]
+		next := matched[limit-1].DID
+		out.Cursor = &next
+	}
+	for _, st := range matched {
+		lbl, err := bgs.handleLabel(st)
+		if err != nil {
+			return err
+		}
+		out.Labels = append(out.Labels, lbl)
+	}
+	return e.JSON(200, out)
+}
+
+func matchesURIPatterns(uri string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(uri, prefix) {
+				return true
+			}
+		} else if uri == p {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAdminFailingHandles reports the tracked accounts whose handle verification is persistently failing
+func (bgs *BGS) handleAdminFailingHandles(e echo.Context) error {
+	if bgs.handleChecks == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "handle verification is not enabled",
+		}
+	}
+	failing := bgs.handleChecks.Failing()
+	if failing == nil {
+		failing = []handlecheck.Status{}
+	}
+	return e.JSON(200, failing)
+}
+
+// handleAdminHandleStatus returns an account's latest handle check
+func (bgs *BGS) handleAdminHandleStatus(e echo.Context) error {
+	if bgs.handleChecks == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "handle verification is not enabled",
+		}
+	}
+	st, ok := bgs.handleChecks.Get(e.QueryParam("did"))
+	if !ok {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "account's handle has not been checked",
+		}
+	}
+	return e.JSON(200, st)
+}
+
+// handleAdminCheckHandle queues an immediate re-check of an account's handle
+func (bgs *BGS) handleAdminCheckHandle(e echo.Context) error {
+	if bgs.handleChecks == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "handle verification is not enabled",
+		}
+	}
+	did := e.QueryParam("did")
+	if _, ok := bgs.Classifications.Get(did); !ok {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "only classified accounts' handles are tracked",
+		}
+	}
+	if !bgs.handleChecks.Enqueue(did) {
+		return &echo.HTTPError{
+			Code:    503,
+			Message: "handle check queue is full",
+		}
+	}
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/bluesky-social/indigo/mst"
 	"gorm.io/gorm"
 
+	"github.com/bluesky-social/indigo/util/httpprofile"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
@@ -26,6 +27,10 @@ import (
 )
 
 func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection string, did string, rkey string) (io.Reader, error) {
+	if s.isSelfRepo(did) {
+		// the relay's own repo is small enough that the full repo serves as the record proof
+		return s.selfRepoCAR(ctx)
+	}
 	u, err := s.lookupUserByDid(ctx, did)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -84,6 +89,9 @@ func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection stri
 }
 
 func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context, did string, since string) (io.Reader, error) {
+	if s.isSelfRepo(did) {
+		return s.selfRepoCAR(ctx)
+	}
 	u, err := s.lookupUserByDid(ctx, did)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -114,14 +122,34 @@ func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context, did string, since
 		return nil, fmt.Errorf("account is suspended by its PDS")
 	}
 
-	// TODO: stream the response
-	buf := new(bytes.Buffer)
-	if err := s.repoman.ReadRepo(ctx, u.ID, since, buf); err != nil {
-		log.Error("failed to read repo into buffer", "err", err, "did", did)
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read repo into buffer")
+	// stream the CAR rather than buffering it, so large repos don't spike memory
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		if since == "" {
+			_, err = s.repoman.ExportRepo(ctx, u.ID, pw, s.exportOpts)
+		} else {
+			_, err = s.repoman.ExportRepoSince(ctx, u.ID, since, pw, s.exportOpts)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Error("failed to stream repo", "err", err, "did", did)
+		}
+		pw.CloseWithError(err)
+	}()
+	// the request context ends once the response is done, or the client goes away; stop the export then
+	context.AfterFunc(ctx, func() {
+		pr.CloseWithError(ctx.Err())
+	})
+
+	// hold the response until the export has written something, so failures up front still get an error status
+	first := make([]byte, 32<<10)
+	n, err := pr.Read(first)
+	if err != nil {
+		pr.Close()
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read repo")
 	}
 
-	return buf, nil
+	return io.MultiReader(bytes.NewReader(first[:n]), pr), nil
 }
 
 func (s *BGS) handleComAtprotoSyncGetBlocks(ctx context.Context, cids []string, did string) (io.Reader, error) {
@@ -174,10 +202,9 @@ func (s *BGS) handleComAtprotoSyncRequestCrawl(ctx context.Context, body *comatp
 
 	clientHost := fmt.Sprintf("%s://%s", u.Scheme, host)
 
-	c := &xrpc.Client{
-		Host:   clientHost,
-		Client: http.DefaultClient, // not using the client that auto-retries
-	}
+	c := &xrpc.Client{Host: clientHost}
+	// the requester is waiting, so not retried
+	s.httpClients.ApplyXRPC(httpprofile.Interactive, c)
 
 	desc, err := atproto.ServerDescribeServer(ctx, c)
 	if err != nil {
@@ -196,7 +223,7 @@ func (s *BGS) handleComAtprotoSyncRequestCrawl(ctx context.Context, body *comatp
 			go func(bodyBlob []byte) {
 				for _, rpu := range s.nextCrawlers {
 					pu := rpu.JoinPath("/xrpc/com.atproto.sync.requestCrawl")
-					response, err := s.httpClient.Post(pu.String(), "application/json", bytes.NewReader(bodyBlob))
+					response, err := s.httpClients.Get(httpprofile.Interactive).Post(pu.String(), "application/json", bytes.NewReader(bodyBlob))
 					if response != nil && response.Body != nil {
 						response.Body.Close()
 					}
@@ -272,6 +299,9 @@ func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context, cursor int64, l
 }
 
 func (s *BGS) handleComAtprotoSyncGetLatestCommit(ctx context.Context, did string) (*comatprototypes.SyncGetLatestCommit_Output, error) {
+	if s.isSelfRepo(did) {
+		return s.selfRepoLatestCommit()
+	}
 	u, err := s.lookupUserByDid(ctx, did)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -0,0 +1,87 @@
+package bgs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/handles"
+	"github.com/bluesky-social/indigo/indexer"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/plc"
+	"github.com/bluesky-social/indigo/repomgr"
+	bsutil "github.com/bluesky-social/indigo/util"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestBGS returns a BGS on sqlite databases in a temporary directory, which is shut down when the test ends
+func newTestBGS(t *testing.T) *BGS {
+	return newTestBGSWith(t, nil, events.NewMemPersister())
+}
+
+// newTestBGSWith is newTestBGS, with its carstore wrapped by wrap (if set), and events persisted by persister
+func newTestBGSWith(t *testing.T, wrap func(carstore.CarStore) carstore.CarStore, persister events.EventPersistence) *BGS {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cardb, err := gorm.Open(sqlite.Open(filepath.Join(dir, "car.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cs carstore.CarStore
+	cs, err = carstore.NewNonArchivalCarstore(cardb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		cs = wrap(cs)
+	}
+
+	repoman := repomgr.NewRepoManager(cs, &bsutil.FakeKeyManager{})
+	evtman := events.NewEventManager(persister)
+	didr := plc.NewFakeDid(db)
+	rf := indexer.NewRepoFetcher(db, repoman, 10)
+	ix, err := indexer.NewIndexer(db, evtman, didr, rf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultBGSConfig()
+	config.SSL = false
+	// compaction workers poll every few seconds, which would hold up shutdown
+	config.NumCompactionWorkers = 0
+	b, err := NewBGS(db, ix, repoman, evtman, didr, rf, &handles.TestHandleResolver{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// some tests break the database on purpose, so shutdown errors aren't failures
+		for _, err := range b.Shutdown() {
+			t.Logf("shutting down test BGS: %s", err)
+		}
+		for _, d := range []*gorm.DB{db, cardb} {
+			if sqldb, err := d.DB(); err == nil {
+				sqldb.Close()
+			}
+		}
+	})
+	return b
+}
+
+// createTestUser adds an account to the BGS's database
+func createTestUser(t *testing.T, b *BGS, did string) models.Uid {
+	u := User{Did: did}
+	if err := b.db.Create(&u).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.db.Create(&models.ActorInfo{Uid: u.ID, Did: did}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
@@ -0,0 +1,36 @@
+package bgs
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerErrorHeaders(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	fail := func(path string) *echo.Response {
+		c := e.NewContext(httptest.NewRequest("GET", path, nil), httptest.NewRecorder())
+		c.SetPath(path)
+		b.handleHTTPError(errors.New("stream closed"), c)
+		return c.Response()
+	}
+
+	// websocket handlers own the connection, so no status is written after they fail
+	for _, path := range []string{
+		"/xrpc/com.atproto.sync.subscribeRepos",
+		"/sovereignty/xrpc/com.atproto.sync.subscribeRepos",
+		"/sovereignty/priority/xrpc/com.atproto.sync.subscribeRepos",
+	} {
+		assert.False(fail(path).Committed, path)
+	}
+
+	res := fail("/xrpc/com.atproto.sync.getRepo")
+	assert.True(res.Committed)
+	assert.Equal(500, res.Status)
+}
@@ -0,0 +1,73 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mirroredAccount adds an account with an empty repo, mirrored from the PDS at host, and returns it with its current commit
+func mirroredAccount(t *testing.T, b *BGS, did, host string) (*User, comatproto.SyncGetLatestCommit_Output) {
+	ctx := context.Background()
+	pds := models.PDS{Host: host}
+	if err := b.db.Create(&pds).Error; err != nil {
+		t.Fatal(err)
+	}
+	uid := createTestUser(t, b, did)
+	if err := b.db.Model(&User{}).Where("id = ?", uid).Update("pds", pds.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.repoman.InitNewActor(ctx, uid, "handle.invalid", did, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := b.repoman.GetRepoRev(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := b.repoman.GetRepoRoot(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.lookupUserByUID(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, comatproto.SyncGetLatestCommit_Output{Rev: rev, Cid: root.String()}
+}
+
+func TestMirrorCheckProfile(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	ps := httpprofile.Defaults()
+	ps[httpprofile.Crawler].UserAgent = "relay-crawler/test"
+	clients, err := httpprofile.NewClients(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.httpClients = clients
+
+	var latest comatproto.SyncGetLatestCommit_Output
+	var userAgent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.UserAgent())
+		json.NewEncoder(w).Encode(latest)
+	}))
+	defer srv.Close()
+
+	// the origin PDS is asked with the crawler profile's client
+	u, out := mirroredAccount(t, b, "did:plc:alice", strings.TrimPrefix(srv.URL, "http://"))
+	latest = out
+	res := b.checkMirroredRepo(context.Background(), u)
+	assert.Equal(mirrorConsistent, res.Status, res.Error)
+	assert.Equal("relay-crawler/test", userAgent.Load())
+}
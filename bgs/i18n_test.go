@@ -0,0 +1,52 @@
+package bgs
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperatorLanguage(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	fail := func(path, acceptLanguage string) (string, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath(path)
+		b.handleHTTPError(&echo.HTTPError{Code: 400, Message: "limit must be between 1 and 1000"}, c)
+		var body struct {
+			Error string `json:"error"`
+		}
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Error, rec.Header().Get("Content-Language")
+	}
+
+	msg, lang := fail("/admin/sovereignty/talkers", "")
+	assert.Equal("limit must be between 1 and 1000", msg)
+	assert.Equal("en", lang)
+	msg, lang = fail("/admin/sovereignty/talkers", "fr-CA,fr;q=0.9,en;q=0.8")
+	assert.Equal("limit doit être compris entre 1 et 1000", msg)
+	assert.Equal("fr", lang)
+	// outside the admin API, errors aren't translated
+	msg, _ = fail("/xrpc/com.atproto.sync.listRepos", "fr")
+	assert.Equal("limit must be between 1 and 1000", msg)
+
+	// the configured language applies when the request doesn't choose one
+	b.lang = i18n.French
+	msg, _ = fail("/admin/sovereignty/talkers", "")
+	assert.Equal("limit doit être compris entre 1 et 1000", msg)
+	assert.Equal([]string{"n'est classé dans aucun pays"}, b.AccountStanding("did:plc:nobody").Reasons)
+	msg, _ = fail("/admin/sovereignty/talkers", "en")
+	assert.Equal("limit must be between 1 and 1000", msg)
+}
@@ -0,0 +1,217 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maximum number of DIDs queued for an identity refresh by a single admin request
+const identityRefreshMaxDIDs = 10_000
+
+// errIdentityRefreshSkipped marks refreshes of accounts which shouldn't appear on the stream
+var errIdentityRefreshSkipped = errors.New("account is taken down or tombstoned")
+
+// ScheduleIdentityRefresh queues a synthetic #identity event for each DID, to be emitted once due.
+func (bgs *BGS) ScheduleIdentityRefresh(ctx context.Context, dids []string, due time.Time, reason, actor string) error {
+	rows := make([]models.IdentityRefresh, 0, len(dids))
+	for _, did := range dids {
+		rows = append(rows, models.IdentityRefresh{
+			Did:    did,
+			DueAt:  due,
+			Reason: reason,
+			Actor:  actor,
+		})
+	}
+	return bgs.db.WithContext(ctx).CreateInBatches(rows, 500).Error
+}
+
+// RefreshIdentity re-resolves an account's DID document and handle, and emits a synthetic #identity event for it so downstream caches converge.
+func (bgs *BGS) RefreshIdentity(ctx context.Context, did string) error {
+	u, err := bgs.lookupUserByDid(ctx, did)
+	if err != nil {
+		return err
+	}
+	if u.GetTakenDown() || u.GetTombstoned() {
+		return errIdentityRefreshSkipped
+	}
+
+	bgs.didr.FlushCacheFor(did)
+	ai, err := bgs.createExternalUser(ctx, did)
+	if err != nil {
+		return err
+	}
+
+	evt := &comatproto.SyncSubscribeRepos_Identity{
+		Did:  did,
+		Time: syntax.DatetimeNow().String(),
+	}
+	if ai.ValidHandle && ai.Handle.Valid {
+		evt.Handle = &ai.Handle.String
+	}
+	if err := bgs.events.AddEvent(ctx, &events.XRPCStreamEvent{RepoIdentity: evt}); err != nil {
+		return fmt.Errorf("failed to broadcast Identity event: %w", err)
+	}
+	return nil
+}
+
+// runIdentityRefreshes emits due synthetic #identity events, at most batch per interval, until the context is cancelled
+func (bgs *BGS) runIdentityRefreshes(ctx context.Context, interval time.Duration, batch int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := bgs.emitDueIdentityRefreshes(ctx, batch); err != nil && ctx.Err() == nil {
+			bgs.log.Error("failed to emit identity refreshes", "err", err)
+		}
+	}
+}
+
+func (bgs *BGS) emitDueIdentityRefreshes(ctx context.Context, batch int) error {
+	var due []models.IdentityRefresh
+	if err := bgs.db.WithContext(ctx).Where("done_at IS NULL AND due_at <= ?", time.Now()).Order("due_at ASC, id ASC").Limit(batch).Find(&due).Error; err != nil {
+		return err
+	}
+	for _, r := range due {
+		var msg string
+		err := bgs.RefreshIdentity(ctx, r.Did)
+		switch {
+		case err == nil:
+			identityRefreshesCounter.WithLabelValues("emitted").Inc()
+		case errors.Is(err, errIdentityRefreshSkipped) || errors.Is(err, gorm.ErrRecordNotFound):
+			identityRefreshesCounter.WithLabelValues("skipped").Inc()
+			msg = "skipped: " + err.Error()
+		default:
+			if ctx.Err() != nil {
+				return nil
+			}
+			identityRefreshesCounter.WithLabelValues("failed").Inc()
+			bgs.log.Warn("failed to refresh identity", "did", r.Did, "err", err)
+			msg = err.Error()
+		}
+		if err := bgs.db.WithContext(ctx).Model(&models.IdentityRefresh{}).Where("id = ?", r.ID).Updates(map[string]any{
+			"done_at": time.Now(),
+			"error":   msg,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type identityRefreshBody struct {
+	Dids []string `json:"dids"`
+	// RFC 3339 time to emit the events at; empty emits them as soon as possible
+	At     string `json:"at"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+func (bgs *BGS) handleAdminRefreshIdentity(e echo.Context) error {
+	var body identityRefreshBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if len(body.Dids) == 0 || len(body.Dids) > identityRefreshMaxDIDs {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("must specify between 1 and %d dids", identityRefreshMaxDIDs),
+		}
+	}
+	for _, d := range body.Dids {
+		if _, err := syntax.ParseDID(d); err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Errorf("invalid did: %w", err).Error(),
+			}
+		}
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	due := time.Now()
+	if body.At != "" {
+		t, err := time.Parse(time.RFC3339, body.At)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid 'at' (expected RFC 3339): %s", err),
+			}
+		}
+		due = t
+	}
+
+	if err := bgs.ScheduleIdentityRefresh(e.Request().Context(), body.Dids, due, body.Reason, body.Actor); err != nil {
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"queued": len(body.Dids),
+		"dueAt":  due.UTC().Format(time.RFC3339),
+	})
+}
+
+type identityRefreshView struct {
+	ID     uint       `json:"id"`
+	Did    string     `json:"did"`
+	DueAt  time.Time  `json:"due_at"`
+	Reason string     `json:"reason,omitempty"`
+	Actor  string     `json:"actor"`
+	DoneAt *time.Time `json:"done_at,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// handleAdminListIdentityRefreshes lists queued identity refreshes, newest first; pending=true lists only those not yet emitted
+func (bgs *BGS) handleAdminListIdentityRefreshes(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 1000)",
+			}
+		}
+		limit = n
+	}
+	q := bgs.db.WithContext(e.Request().Context()).Order("id DESC").Limit(limit)
+	if e.QueryParam("pending") == "true" {
+		q = q.Where("done_at IS NULL")
+	}
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	var rows []models.IdentityRefresh
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+	out := make([]identityRefreshView, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, identityRefreshView{
+			ID:     r.ID,
+			Did:    r.Did,
+			DueAt:  r.DueAt,
+			Reason: r.Reason,
+			Actor:  r.Actor,
+			DoneAt: r.DoneAt,
+			Error:  r.Error,
+		})
+	}
+	return e.JSON(200, out)
+}
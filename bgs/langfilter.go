@@ -0,0 +1,57 @@
+package bgs
+
+import (
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/langfilter"
+)
+
+// setupLanguageFilter sets up the filter judging commits by the languages their posts declare
+func (bgs *BGS) setupLanguageFilter(config *SovereignConfig) error {
+	mode, err := langfilter.ParseMode(config.LanguageFilter)
+	if err != nil {
+		return err
+	}
+	opts := langfilter.DefaultOptions()
+	opts.Mode = mode
+	if len(config.LanguageFilterLangs) > 0 {
+		opts.Langs = config.LanguageFilterLangs
+	}
+	opts.KeepUndeclared = config.LanguageFilterKeepUndeclared
+	f, err := langfilter.NewFilter(opts)
+	if err != nil {
+		return fmt.Errorf("setting up language filter: %w", err)
+	}
+	bgs.langFilter = f
+	bgs.log.Info("using language filter", "mode", opts.Mode, "langs", opts.Langs, "keepUndeclared", opts.KeepUndeclared)
+	return nil
+}
+
+// applyLanguageFilter judges a commit by the languages its posts declare, after the relay's geographic filter: in require mode, commits it carries whose posts declare none of the filter's languages are left out, except those of priority accounts; in prefer mode, commits it leaves out for the account's classification are carried if a post declares one. A commit whose blocks can't be read counts as declaring none
+func (bgs *BGS) applyLanguageFilter(commit *comatproto.SyncSubscribeRepos_Commit, r sovereignty.FilterResult) sovereignty.FilterResult {
+	switch bgs.langFilter.Mode {
+	case langfilter.ModeRequire:
+		if !r.Include || r.Reason == sovereignty.FilterReasonPriority {
+			return r
+		}
+	case langfilter.ModePrefer:
+		if r.Include || !geographicReason(r.Reason) {
+			return r
+		}
+	}
+	v, err := bgs.langFilter.Commit(commit)
+	if err != nil {
+		bgs.log.Warn("language filter couldn't read commit", "did", commit.Repo, "err", err)
+		v = langfilter.Unmatched
+	}
+	languageFilterCommits.WithLabelValues(v.String()).Inc()
+	switch {
+	case bgs.langFilter.Mode == langfilter.ModeRequire && v == langfilter.Unmatched:
+		return sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonLanguage}
+	case bgs.langFilter.Mode == langfilter.ModePrefer && v == langfilter.Matched:
+		return sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonLanguage}
+	}
+	return r
+}
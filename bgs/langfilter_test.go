@@ -0,0 +1,70 @@
+package bgs
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageFilter(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	assert.NoError(b.SetClassification(context.Background(), sovereignty.Classification{DID: "did:plc:home", Country: "CA", Source: "admin"}))
+	assert.NoError(b.SetClassification(context.Background(), sovereignty.Classification{DID: "did:plc:away", Country: "FR", Source: "admin"}))
+
+	commit := cartest.Commit(t, "did:plc:home")
+	fr := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "bonjour", "langs": []any{"fr-CA"}})
+	de := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "hallo", "langs": []any{"de"}})
+	blocks := cartest.CAR(t, commit, fr, de)
+	post := func(did string, rec cartest.Block) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   did,
+			Commit: lexutil.LexLink(commit.Cid),
+			Blocks: blocks,
+			Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/3k", Cid: rec.Link()}},
+		}}
+	}
+	like := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo: "did:plc:home",
+		Ops:  []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "delete", Path: "app.bsky.feed.like/3k"}},
+	}}
+
+	config := DefaultSovereignConfig()
+	config.LanguageFilter = "require"
+	assert.NoError(b.setupLanguageFilter(&config))
+	r := b.evaluateFilter(post("did:plc:home", fr), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonCountry, r.Reason)
+	r = b.evaluateFilter(post("did:plc:home", de), nil)
+	assert.False(r.Include)
+	assert.Equal(sovereignty.FilterReasonLanguage, r.Reason)
+	// commits creating no posts are left to the geographic filter, which goes first
+	assert.True(b.evaluateFilter(like, nil).Include)
+	assert.Equal(sovereignty.FilterReasonOtherCountry, b.evaluateFilter(post("did:plc:away", fr), nil).Reason)
+
+	config.LanguageFilter = "prefer"
+	assert.NoError(b.setupLanguageFilter(&config))
+	r = b.evaluateFilter(post("did:plc:away", fr), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonLanguage, r.Reason)
+	r = b.evaluateFilter(post("did:plc:away", de), nil)
+	assert.False(r.Include)
+	assert.Equal(sovereignty.FilterReasonOtherCountry, r.Reason)
+	assert.True(b.evaluateFilter(post("did:plc:home", de), nil).Include)
+
+	config.LanguageFilter = "favour"
+	assert.Error(b.setupLanguageFilter(&config))
+}
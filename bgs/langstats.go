@@ -0,0 +1,110 @@
+package bgs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/langstats"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maximum number of days covered by a single language statistics request
+const langStatsMaxDays = 366
+
+// observeLangStats samples the posts of a mirrored commit for language statistics, if the account is classified and not excluded from statistics
+func (bgs *BGS) observeLangStats(evt *comatproto.SyncSubscribeRepos_Commit) {
+	cl, ok := bgs.Classifications.Get(evt.Repo)
+	if !ok {
+		return
+	}
+	if bgs.minors != nil && bgs.minors.ExcludeStats(evt.Repo) {
+		return
+	}
+	if err := bgs.langStats.ObserveCommit(evt, cl.Region(), time.Now()); err != nil {
+		bgs.log.Warn("failed to sample commit for language statistics", "did", evt.Repo, "seq", evt.Seq, "err", err)
+	}
+}
+
+type languageStatsResponse struct {
+	Region     string               `json:"region,omitempty"`
+	Since      string               `json:"since"`
+	Until      string               `json:"until"`
+	SampleRate float64              `json:"sampleRate"`
+	Estimates  []langstats.Estimate `json:"estimates"`
+}
+
+// handleGetLanguageStats serves daily language distribution estimates, optionally for one region ("CA", or a subdivision like "CA-QC"). The range defaults to the last 30 days.
+func (bgs *BGS) handleGetLanguageStats(e echo.Context) error {
+	until := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := e.QueryParam("until"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid 'until' (expected YYYY-MM-DD): %s", err),
+			}
+		}
+		until = t
+	}
+	since := until.AddDate(0, 0, -29)
+	if s := e.QueryParam("since"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid 'since' (expected YYYY-MM-DD): %s", err),
+			}
+		}
+		since = t
+	}
+	if since.After(until) || until.Sub(since) >= langStatsMaxDays*24*time.Hour {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("'since' must not be after 'until', and the range may cover at most %d days", langStatsMaxDays),
+		}
+	}
+
+	var region string
+	if r := e.QueryParam("region"); r != "" {
+		countryCode, sub, _ := strings.Cut(r, "-")
+		country, err := sovereignty.NormalizeCountry(countryCode)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+		subdivision, err := sovereignty.NormalizeSubdivision(country, sub)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+		region = sovereignty.Classification{Country: country, Subdivision: subdivision}.Region()
+	}
+
+	est, err := bgs.langStatsStore.Estimates(e.Request().Context(), langstats.Query{
+		Region:     region,
+		Since:      since,
+		Until:      until,
+		MinSamples: bgs.langStatsMinSamples,
+	})
+	if err != nil {
+		return err
+	}
+	if est == nil {
+		est = []langstats.Estimate{}
+	}
+	return e.JSON(200, languageStatsResponse{
+		Region:     region,
+		Since:      since.Format(time.DateOnly),
+		Until:      until.Format(time.DateOnly),
+		SampleRate: bgs.langStats.Rate,
+		Estimates:  est,
+	})
+}
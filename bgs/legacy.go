@@ -0,0 +1,73 @@
+package bgs
+
+import (
+	"fmt"
+	"net/http"
+
+	comatprototypes "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+)
+
+// Compatibility shims for sync methods which have been removed from the protocol, but which older tooling still calls. Responses carry a Deprecation header pointing at the replacement method.
+
+// markDeprecated sets the deprecation headers on a shim response, and counts the call
+func markDeprecated(c echo.Context, method, successor string) {
+	c.Response().Header().Set("Deprecation", "true")
+	c.Response().Header().Set("Link", fmt.Sprintf("</xrpc/%s>; rel=\"successor-version\"", successor))
+	legacySyncCalls.WithLabelValues(method).Inc()
+}
+
+// HandleComAtprotoSyncGetHead serves com.atproto.sync.getHead, superseded by getLatestCommit: the CID of the repo's current commit.
+func (s *BGS) HandleComAtprotoSyncGetHead(c echo.Context) error {
+	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoSyncGetHead")
+	defer span.End()
+	did := c.QueryParam("did")
+
+	_, err := syntax.ParseDID(did)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid did: %s", did)})
+	}
+
+	markDeprecated(c, "com.atproto.sync.getHead", "com.atproto.sync.getLatestCommit")
+	latest, err := s.handleComAtprotoSyncGetLatestCommit(ctx, did)
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, comatprototypes.SyncGetHead_Output{Root: latest.Cid})
+}
+
+// HandleComAtprotoSyncGetCheckout serves com.atproto.sync.getCheckout, superseded by getRepo: the full repo at its current commit. Mirrored repos only keep their current state, so a 'commit' other than the current one is not found.
+func (s *BGS) HandleComAtprotoSyncGetCheckout(c echo.Context) error {
+	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoSyncGetCheckout")
+	defer span.End()
+	did := c.QueryParam("did")
+
+	_, err := syntax.ParseDID(did)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid did: %s", did)})
+	}
+
+	markDeprecated(c, "com.atproto.sync.getCheckout", "com.atproto.sync.getRepo")
+	if commit := c.QueryParam("commit"); commit != "" {
+		want, err := cid.Decode(commit)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid commit: %s", commit)})
+		}
+		latest, err := s.handleComAtprotoSyncGetLatestCommit(ctx, did)
+		if err != nil {
+			return err
+		}
+		if latest.Cid != want.String() {
+			return c.JSON(http.StatusNotFound, XRPCError{Message: fmt.Sprintf("commit %s is not the repo's current commit, and earlier commits are not kept", commit)})
+		}
+	}
+	out, err := s.handleComAtprotoSyncGetRepo(ctx, did, "")
+	if err != nil {
+		return err
+	}
+	return c.Stream(200, "application/vnd.ipld.car", out)
+}
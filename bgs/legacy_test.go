@@ -0,0 +1,108 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/ipld/go-car"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLegacySyncShims(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	// the non-archival carstore can't export repos, so use sharded files
+	b := newTestBGSWith(t, func(carstore.CarStore) carstore.CarStore {
+		dir := t.TempDir()
+		db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "shards.sqlite")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if sqldb, err := db.DB(); err == nil {
+				sqldb.Close()
+			}
+		})
+		cs, err := carstore.NewCarStore(db, []string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}, events.NewMemPersister())
+	e := echo.New()
+	e.HTTPErrorHandler = b.handleHTTPError
+
+	uid := createTestUser(t, b, "did:plc:alice")
+	assert.NoError(b.repoman.InitNewActor(ctx, uid, "alice.test", "did:plc:alice", "", "", ""))
+	root, err := b.repoman.GetRepoRoot(ctx, uid)
+	assert.NoError(err)
+
+	call := func(handler echo.HandlerFunc, method, did string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/xrpc/"+method+"?did="+did, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := handler(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	// getHead answers with the current commit, like getLatestCommit
+	rec := call(b.HandleComAtprotoSyncGetHead, "com.atproto.sync.getHead", "did:plc:alice")
+	assert.Equal(200, rec.Code)
+	var head comatproto.SyncGetHead_Output
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &head))
+	assert.Equal(root.String(), head.Root)
+	assert.Equal("true", rec.Header().Get("Deprecation"))
+	assert.Equal(`</xrpc/com.atproto.sync.getLatestCommit>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	// getCheckout answers with the whole repo, like getRepo
+	rec = call(b.HandleComAtprotoSyncGetCheckout, "com.atproto.sync.getCheckout", "did:plc:alice")
+	assert.Equal(200, rec.Code)
+	assert.Equal("application/vnd.ipld.car", rec.Header().Get("Content-Type"))
+	assert.Equal("true", rec.Header().Get("Deprecation"))
+	assert.Equal(`</xrpc/com.atproto.sync.getRepo>; rel="successor-version"`, rec.Header().Get("Link"))
+	cr, err := car.NewCarReader(bytes.NewReader(rec.Body.Bytes()))
+	if assert.NoError(err) {
+		assert.Equal(root, cr.Header.Roots[0])
+	}
+
+	// asking for the current commit is the same; any other is not found
+	rec = call(b.HandleComAtprotoSyncGetCheckout, "com.atproto.sync.getCheckout", "did:plc:alice&commit="+root.String())
+	assert.Equal(200, rec.Code)
+	rec = call(b.HandleComAtprotoSyncGetCheckout, "com.atproto.sync.getCheckout", "did:plc:alice&commit=bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+	assert.Equal(404, rec.Code)
+	assert.Contains(rec.Body.String(), "not the repo's current commit")
+	assert.NotEqual("application/vnd.ipld.car", rec.Header().Get("Content-Type"))
+	rec = call(b.HandleComAtprotoSyncGetCheckout, "com.atproto.sync.getCheckout", "did:plc:alice&commit=nope")
+	assert.Equal(400, rec.Code)
+
+	// unknown accounts are not found, and the call is still marked deprecated
+	for _, shim := range []struct {
+		method  string
+		handler echo.HandlerFunc
+	}{
+		{"com.atproto.sync.getHead", b.HandleComAtprotoSyncGetHead},
+		{"com.atproto.sync.getCheckout", b.HandleComAtprotoSyncGetCheckout},
+	} {
+		rec = call(shim.handler, shim.method, "did:plc:nobody")
+		assert.Equal(404, rec.Code, shim.method)
+		assert.Contains(rec.Body.String(), "user not found", shim.method)
+		assert.Equal("true", rec.Header().Get("Deprecation"), shim.method)
+
+		rec = call(shim.handler, shim.method, "alice")
+		assert.Equal(400, rec.Code, shim.method)
+		assert.Empty(rec.Header().Get("Deprecation"), shim.method)
+	}
+}
@@ -0,0 +1,444 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/diskpersist"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Erasure workflows checked against legal holds. A takedown erases the account's repo and events; deletions and resets only touch the repo.
+const (
+	holdWorkflowTakedown = "takedown"
+	holdWorkflowDeletion = "deletion"
+	holdWorkflowReset    = "reset"
+)
+
+// LegalHoldConflict reports an erasure request which hit a legal hold.
+type LegalHoldConflict struct {
+	Did      string `json:"did"`
+	Workflow string `json:"workflow"`
+	Holds    []uint `json:"holds"`
+	// set if a hold covers the whole account, so the repo was kept. Otherwise only the held ranges of the event log were kept
+	RepoHeld bool `json:"repoHeld"`
+	// the rest of the request was carried out, and the erasure runs once the holds are released
+	Deferred bool `json:"deferred"`
+}
+
+// holdCoversRepo reports whether a hold covers the whole account rather than a range of its events
+func holdCoversRepo(h models.LegalHold) bool {
+	return h.SeqStart == 0 && h.SeqEnd == 0
+}
+
+// holdRegistry is the in-memory view of active holds, consulted by the disk persister on retention sweeps and takedowns
+type holdRegistry struct {
+	// serialises reloads with noteAccount, so an account created during a reload isn't missed
+	loadLk sync.Mutex
+
+	lk    sync.RWMutex
+	byDID map[string][]models.LegalHold
+	byUid map[models.Uid][]models.LegalHold
+	// set while the holds or their accounts couldn't be loaded; every event is treated as held until a reload succeeds
+	failed bool
+}
+
+func (lh *holdRegistry) forDID(did string) []models.LegalHold {
+	lh.lk.RLock()
+	defer lh.lk.RUnlock()
+	return lh.byDID[did]
+}
+
+func (lh *holdRegistry) HasHolds() bool {
+	lh.lk.RLock()
+	defer lh.lk.RUnlock()
+	return lh.failed || len(lh.byDID) > 0
+}
+
+func (lh *holdRegistry) Held(usr models.Uid, seq int64) bool {
+	lh.lk.RLock()
+	defer lh.lk.RUnlock()
+	if lh.failed {
+		return true
+	}
+	for _, h := range lh.byUid[usr] {
+		if (h.SeqStart == 0 || seq >= h.SeqStart) && (h.SeqEnd == 0 || seq <= h.SeqEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// replace swaps in a freshly loaded set of holds; uids maps the held DIDs the relay has seen to their accounts
+func (lh *holdRegistry) replace(holds []models.LegalHold, uids map[string]models.Uid) {
+	lh.lk.Lock()
+	defer lh.lk.Unlock()
+	lh.byDID = make(map[string][]models.LegalHold)
+	lh.byUid = make(map[models.Uid][]models.LegalHold)
+	for _, h := range holds {
+		lh.byDID[h.Did] = append(lh.byDID[h.Did], h)
+		if uid, ok := uids[h.Did]; ok {
+			lh.byUid[uid] = append(lh.byUid[uid], h)
+		}
+	}
+	lh.failed = false
+}
+
+func (lh *holdRegistry) failClosed() {
+	lh.lk.Lock()
+	defer lh.lk.Unlock()
+	lh.failed = true
+}
+
+// noteAccount applies any holds on a DID to the account just created for it
+func (lh *holdRegistry) noteAccount(did string, uid models.Uid) {
+	lh.loadLk.Lock()
+	defer lh.loadLk.Unlock()
+	lh.lk.Lock()
+	defer lh.lk.Unlock()
+	if holds, ok := lh.byDID[did]; ok {
+		lh.byUid[uid] = holds
+	}
+}
+
+// HoldChecker exposes the active legal holds to the disk persister
+func (bgs *BGS) HoldChecker() diskpersist.HoldChecker {
+	return bgs.holds
+}
+
+// loadLegalHolds populates the in-memory registry with the active holds in the database. On failure the registry holds every event until a later load succeeds.
+func (bgs *BGS) loadLegalHolds() error {
+	bgs.holds.loadLk.Lock()
+	defer bgs.holds.loadLk.Unlock()
+
+	var rows []models.LegalHold
+	if err := bgs.db.Where("released_at IS NULL").Find(&rows).Error; err != nil {
+		bgs.holds.failClosed()
+		return fmt.Errorf("loading legal holds: %w", err)
+	}
+	dids := make([]string, 0, len(rows))
+	for _, h := range rows {
+		dids = append(dids, h.Did)
+	}
+	var users []User
+	if len(dids) > 0 {
+		if err := bgs.db.Select("id", "did").Where("did IN ?", dids).Find(&users).Error; err != nil {
+			bgs.holds.failClosed()
+			return fmt.Errorf("resolving held accounts: %w", err)
+		}
+	}
+	uids := make(map[string]models.Uid, len(users))
+	for i := range users {
+		uids[users[i].Did] = users[i].ID
+	}
+	bgs.holds.replace(rows, uids)
+	return nil
+}
+
+// reloadLegalHolds refreshes the registry after a hold changes, retrying in the background if the load fails
+func (bgs *BGS) reloadLegalHolds() error {
+	err := bgs.loadLegalHolds()
+	if err != nil {
+		bgs.log.Error("failed to reload legal holds, holding all events until a retry succeeds", "err", err)
+		time.AfterFunc(time.Minute, func() {
+			bgs.reloadLegalHolds()
+		})
+	}
+	return err
+}
+
+// PlaceLegalHold records a new hold, exempting the account's data from retention and erasure until it is released.
+func (bgs *BGS) PlaceLegalHold(ctx context.Context, hold models.LegalHold, remoteIP string) (*models.LegalHold, error) {
+	if hold.SeqStart < 0 || hold.SeqEnd < 0 || (hold.SeqEnd != 0 && hold.SeqEnd < hold.SeqStart) {
+		return nil, fmt.Errorf("invalid sequence range %d-%d", hold.SeqStart, hold.SeqEnd)
+	}
+	hold.ID = 0
+	hold.ReleasedAt = nil
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hold).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LegalHoldAuditEntry{
+			HoldID:   hold.ID,
+			Did:      hold.Did,
+			Action:   "place",
+			Actor:    hold.PlacedBy,
+			Note:     hold.Reason,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	bgs.log.Info("legal hold placed", "id", hold.ID, "did", hold.Did, "reference", hold.Reference, "actor", hold.PlacedBy, "remote_ip", remoteIP)
+	if err := bgs.reloadLegalHolds(); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ReleaseLegalHold lifts a hold. Erasures deferred by it run once no other hold covers the account.
+func (bgs *BGS) ReleaseLegalHold(ctx context.Context, id uint, actor, note, remoteIP string) error {
+	var hold models.LegalHold
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("released_at IS NULL").First(&hold, id).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&hold).Updates(map[string]any{"released_at": now, "released_by": actor}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LegalHoldAuditEntry{
+			HoldID:   hold.ID,
+			Did:      hold.Did,
+			Action:   "release",
+			Actor:    actor,
+			Note:     note,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	bgs.log.Info("legal hold released", "id", hold.ID, "did", hold.Did, "actor", actor, "remote_ip", remoteIP)
+	if err := bgs.reloadLegalHolds(); err != nil {
+		return err
+	}
+	return bgs.runDeferredErasures(ctx, hold.Did)
+}
+
+// legalHoldConflict returns nil if no hold stands in the way of the workflow. Otherwise the conflict is recorded and returned; deferred erasures run once the holds are released.
+func (bgs *BGS) legalHoldConflict(ctx context.Context, did, workflow string, deferred bool) *LegalHoldConflict {
+	c := &LegalHoldConflict{Did: did, Workflow: workflow, Deferred: deferred}
+	var ids []string
+	for _, h := range bgs.holds.forDID(did) {
+		covers := holdCoversRepo(h)
+		// held ranges of the event log don't concern workflows which only touch the repo
+		if !covers && workflow != holdWorkflowTakedown {
+			continue
+		}
+		c.RepoHeld = c.RepoHeld || covers
+		c.Holds = append(c.Holds, h.ID)
+		ids = append(ids, strconv.FormatUint(uint64(h.ID), 10))
+	}
+	if len(c.Holds) == 0 {
+		return nil
+	}
+	legalHoldConflicts.WithLabelValues(workflow).Inc()
+	bgs.log.Warn("erasure request hit a legal hold", "did", did, "workflow", workflow, "holds", c.Holds, "repo_held", c.RepoHeld, "deferred", deferred)
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.LegalHoldConflict{
+			Did:      did,
+			Workflow: workflow,
+			HoldIDs:  strings.Join(ids, ","),
+			Deferred: deferred,
+		}).Error; err != nil {
+			return err
+		}
+		for _, id := range c.Holds {
+			if err := tx.Create(&models.LegalHoldAuditEntry{
+				HoldID: id,
+				Did:    did,
+				Action: "conflict",
+				Note:   workflow,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// the hold still applies; only the report is lost
+		bgs.log.Error("failed to record legal hold conflict", "did", did, "err", err)
+	}
+	return c
+}
+
+// runDeferredErasures carries out erasures held back by legal holds once none remain on the account. Each only runs if the account is still taken down or deleted.
+func (bgs *BGS) runDeferredErasures(ctx context.Context, did string) error {
+	if len(bgs.holds.forDID(did)) > 0 {
+		return nil
+	}
+	var pending []models.LegalHoldConflict
+	if err := bgs.db.WithContext(ctx).Where("did = ? AND deferred = ? AND resolved_at IS NULL", did, true).Find(&pending).Error; err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	u, err := bgs.lookupUserByDid(ctx, did)
+	if err != nil {
+		return err
+	}
+
+	var eraseRepo, eraseEvents bool
+	for _, c := range pending {
+		switch c.Workflow {
+		case holdWorkflowTakedown:
+			if u.GetTakenDown() {
+				eraseRepo, eraseEvents = true, true
+			}
+		case holdWorkflowDeletion:
+			if u.GetTombstoned() || u.GetUpstreamStatus() == events.AccountStatusDeleted {
+				eraseRepo = true
+			}
+		}
+	}
+	if eraseRepo {
+		if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
+			return err
+		}
+	}
+	if eraseEvents {
+		if err := bgs.events.TakeDownRepo(ctx, u.ID); err != nil {
+			return err
+		}
+	}
+	if eraseRepo || eraseEvents {
+		bgs.log.Info("ran erasure deferred by legal hold", "did", did, "repo", eraseRepo, "events", eraseEvents)
+	}
+
+	ids := make([]uint, len(pending))
+	for i, c := range pending {
+		ids[i] = c.ID
+	}
+	return bgs.db.WithContext(ctx).Model(&models.LegalHoldConflict{}).Where("id IN ?", ids).Update("resolved_at", time.Now()).Error
+}
+
+type legalHoldBody struct {
+	Did       string `json:"did"`
+	SeqStart  int64  `json:"seqStart"`
+	SeqEnd    int64  `json:"seqEnd"`
+	Reason    string `json:"reason"`
+	Reference string `json:"reference"`
+	// name of the operator placing the hold, for the audit log
+	Actor string `json:"actor"`
+}
+
+func (bgs *BGS) handleAdminPlaceLegalHold(e echo.Context) error {
+	var body legalHoldBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	if body.Actor == "" || body.Reason == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify reason and actor for the audit log",
+		}
+	}
+	hold, err := bgs.PlaceLegalHold(e.Request().Context(), models.LegalHold{
+		Did:       did.String(),
+		SeqStart:  body.SeqStart,
+		SeqEnd:    body.SeqEnd,
+		Reason:    body.Reason,
+		Reference: body.Reference,
+		PlacedBy:  body.Actor,
+	}, e.RealIP())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	return e.JSON(200, hold)
+}
+
+func (bgs *BGS) handleAdminReleaseLegalHold(e echo.Context) error {
+	var body struct {
+		ID    uint   `json:"id"`
+		Note  string `json:"note"`
+		Actor string `json:"actor"`
+	}
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	if err := bgs.ReleaseLegalHold(e.Request().Context(), body.ID, body.Actor, body.Note, e.RealIP()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "no such active hold",
+			}
+		}
+		return err
+	}
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminListLegalHolds(e echo.Context) error {
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc")
+	if e.QueryParam("released") != "true" {
+		q = q.Where("released_at IS NULL")
+	}
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	var holds []models.LegalHold
+	if err := q.Find(&holds).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, holds)
+}
+
+func (bgs *BGS) handleAdminLegalHoldAudit(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc").Limit(limit)
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	var entries []models.LegalHoldAuditEntry
+	if err := q.Find(&entries).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, entries)
+}
+
+func (bgs *BGS) handleAdminLegalHoldConflicts(e echo.Context) error {
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc").Limit(1000)
+	if e.QueryParam("pending") == "true" {
+		q = q.Where("deferred = ? AND resolved_at IS NULL", true)
+	}
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	var conflicts []models.LegalHoldConflict
+	if err := q.Find(&conflicts).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, conflicts)
+}
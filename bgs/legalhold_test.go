@@ -0,0 +1,283 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// wipeRecorder records the accounts whose repos and events are erased
+type wipeRecorder struct {
+	lk     sync.Mutex
+	repos  []models.Uid
+	events []models.Uid
+}
+
+func (wr *wipeRecorder) counts() (int, int) {
+	wr.lk.Lock()
+	defer wr.lk.Unlock()
+	return len(wr.repos), len(wr.events)
+}
+
+type recordingCarStore struct {
+	carstore.CarStore
+	wr *wipeRecorder
+}
+
+func (cs *recordingCarStore) WipeUserData(ctx context.Context, user models.Uid) error {
+	cs.wr.lk.Lock()
+	cs.wr.repos = append(cs.wr.repos, user)
+	cs.wr.lk.Unlock()
+	return cs.CarStore.WipeUserData(ctx, user)
+}
+
+type recordingPersister struct {
+	*events.MemPersister
+	wr *wipeRecorder
+}
+
+func (p *recordingPersister) TakeDownRepo(ctx context.Context, usr models.Uid) error {
+	p.wr.lk.Lock()
+	p.wr.events = append(p.wr.events, usr)
+	p.wr.lk.Unlock()
+	// the memory persister doesn't support takedowns
+	return nil
+}
+
+// setupHoldTest returns a test BGS which records the accounts whose repos and events are erased
+func setupHoldTest(t *testing.T) (*BGS, *wipeRecorder) {
+	wr := &wipeRecorder{}
+	wrap := func(cs carstore.CarStore) carstore.CarStore {
+		return &recordingCarStore{CarStore: cs, wr: wr}
+	}
+	return newTestBGSWith(t, wrap, &recordingPersister{MemPersister: events.NewMemPersister(), wr: wr}), wr
+}
+
+func placeHold(t *testing.T, b *BGS, did string, seqStart, seqEnd int64) *models.LegalHold {
+	hold, err := b.PlaceLegalHold(context.Background(), models.LegalHold{
+		Did:      did,
+		SeqStart: seqStart,
+		SeqEnd:   seqEnd,
+		Reason:   "litigation",
+		PlacedBy: "counsel",
+	}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hold
+}
+
+func TestLegalHoldRegistry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b, _ := setupHoldTest(t)
+
+	alice := createTestUser(t, b, "did:plc:alice")
+	assert.False(b.holds.HasHolds())
+
+	// whole-account and ranged holds are resolved to the account when placed
+	whole := placeHold(t, b, "did:plc:alice", 0, 0)
+	assert.True(b.holds.HasHolds())
+	assert.True(b.holds.Held(alice, 1))
+	assert.NoError(b.ReleaseLegalHold(ctx, whole.ID, "counsel", "", "127.0.0.1"))
+	assert.False(b.holds.Held(alice, 1))
+
+	placeHold(t, b, "did:plc:alice", 10, 20)
+	assert.False(b.holds.Held(alice, 9))
+	assert.True(b.holds.Held(alice, 10))
+	assert.True(b.holds.Held(alice, 20))
+	assert.False(b.holds.Held(alice, 21))
+
+	// holds survive a reload from the database
+	b.holds.replace(nil, nil)
+	assert.False(b.holds.Held(alice, 15))
+	assert.NoError(b.loadLegalHolds())
+	assert.True(b.holds.Held(alice, 15))
+
+	// a hold on an account the relay hasn't seen yet applies once it is created
+	placeHold(t, b, "did:plc:bob", 0, 0)
+	bob := createTestUser(t, b, "did:plc:bob")
+	assert.False(b.holds.Held(bob, 1))
+	b.holds.noteAccount("did:plc:bob", bob)
+	assert.True(b.holds.Held(bob, 1))
+
+	// if the holds can't be loaded, everything is held
+	carol := createTestUser(t, b, "did:plc:carol")
+	assert.False(b.holds.Held(carol, 1))
+	sqlDB, err := b.db.DB()
+	assert.NoError(err)
+	assert.NoError(sqlDB.Close())
+	assert.Error(b.loadLegalHolds())
+	assert.True(b.holds.HasHolds())
+	assert.True(b.holds.Held(carol, 1))
+}
+
+func TestLegalHoldConflicts(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b, wr := setupHoldTest(t)
+
+	createTestUser(t, b, "did:plc:alice")
+	createTestUser(t, b, "did:plc:bob")
+
+	// a ranged hold keeps only those events; the repo is erased and resets go ahead
+	ranged := placeHold(t, b, "did:plc:bob", 5, 10)
+	assert.Nil(b.legalHoldConflict(ctx, "did:plc:bob", holdWorkflowReset, false))
+	conflict, err := b.TakeDownRepo(ctx, "did:plc:bob")
+	assert.NoError(err)
+	if assert.NotNil(conflict) {
+		assert.False(conflict.RepoHeld)
+		assert.Equal([]uint{ranged.ID}, conflict.Holds)
+	}
+	repos, evts := wr.counts()
+	assert.Equal(1, repos)
+	assert.Equal(1, evts)
+
+	// a whole-account hold keeps the repo, and defers the erasure until it is released
+	hold := placeHold(t, b, "did:plc:alice", 0, 0)
+	conflict, err = b.TakeDownRepo(ctx, "did:plc:alice")
+	assert.NoError(err)
+	if assert.NotNil(conflict) {
+		assert.True(conflict.RepoHeld)
+		assert.True(conflict.Deferred)
+	}
+	repos, evts = wr.counts()
+	assert.Equal(1, repos)
+	assert.Equal(2, evts)
+
+	assert.NotNil(b.legalHoldConflict(ctx, "did:plc:alice", holdWorkflowReset, false))
+
+	var pending []models.LegalHoldConflict
+	assert.NoError(b.db.Where("did = ? AND resolved_at IS NULL", "did:plc:alice").Find(&pending).Error)
+	assert.Len(pending, 2)
+
+	assert.NoError(b.ReleaseLegalHold(ctx, hold.ID, "counsel", "case closed", "127.0.0.1"))
+	repos, evts = wr.counts()
+	assert.Equal(2, repos)
+	assert.Equal(3, evts)
+
+	// refused requests aren't rerun, and deferred ones only run once
+	assert.NoError(b.db.Where("did = ? AND deferred = ? AND resolved_at IS NULL", "did:plc:alice", true).Find(&pending).Error)
+	assert.Empty(pending)
+	assert.NoError(b.runDeferredErasures(ctx, "did:plc:alice"))
+	repos, evts = wr.counts()
+	assert.Equal(2, repos)
+	assert.Equal(3, evts)
+
+	var audit []models.LegalHoldAuditEntry
+	assert.NoError(b.db.Where("hold_id = ?", hold.ID).Order("id asc").Find(&audit).Error)
+	var actions []string
+	for _, a := range audit {
+		actions = append(actions, a.Action)
+	}
+	assert.Equal([]string{"place", "conflict", "conflict", "release"}, actions)
+}
+
+func TestLegalHoldDeferredErasureRestored(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b, wr := setupHoldTest(t)
+
+	createTestUser(t, b, "did:plc:alice")
+	hold := placeHold(t, b, "did:plc:alice", 0, 0)
+	_, err := b.TakeDownRepo(ctx, "did:plc:alice")
+	assert.NoError(err)
+	assert.NoError(b.ReverseTakedown(ctx, "did:plc:alice"))
+
+	// the account was restored while held, so there is nothing left to erase
+	assert.NoError(b.ReleaseLegalHold(ctx, hold.ID, "counsel", "", "127.0.0.1"))
+	repos, _ := wr.counts()
+	assert.Equal(0, repos)
+
+	var c models.LegalHoldConflict
+	assert.NoError(b.db.Where("did = ?", "did:plc:alice").First(&c).Error)
+	assert.NotNil(c.ResolvedAt)
+}
+
+func TestLegalHoldAdminHandlers(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := setupHoldTest(t)
+	e := echo.New()
+	createTestUser(t, b, "did:plc:alice")
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+
+	_, err := call(http.MethodPost, "/admin/sovereignty/holds/place", `{"did": "did:plc:alice"}`, b.handleAdminPlaceLegalHold)
+	assert.Equal(400, err.(*echo.HTTPError).Code)
+	_, err = call(http.MethodPost, "/admin/sovereignty/holds/place", `{"did": "did:plc:alice", "seqStart": 10, "seqEnd": 5, "reason": "r", "actor": "a"}`, b.handleAdminPlaceLegalHold)
+	assert.Equal(400, err.(*echo.HTTPError).Code)
+
+	rec, err := call(http.MethodPost, "/admin/sovereignty/holds/place", `{"did": "did:plc:alice", "reason": "litigation", "reference": "case-1", "actor": "counsel"}`, b.handleAdminPlaceLegalHold)
+	assert.NoError(err)
+	var hold models.LegalHold
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &hold))
+	assert.NotZero(hold.ID)
+	assert.Equal("case-1", hold.Reference)
+
+	rec, err = call(http.MethodGet, "/admin/sovereignty/holds", "", b.handleAdminListLegalHolds)
+	assert.NoError(err)
+	var holds []models.LegalHold
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &holds))
+	assert.Len(holds, 1)
+
+	// a takedown of a held account succeeds, reporting the conflict
+	rec, err = call(http.MethodPost, "/admin/repo/takedown", `{"did": "did:plc:alice"}`, b.handleAdminTakeDownRepo)
+	assert.NoError(err)
+	assert.Equal(200, rec.Code)
+	var out struct {
+		Success  string            `json:"success"`
+		Conflict LegalHoldConflict `json:"conflict"`
+	}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal("true", out.Success)
+	assert.Equal([]uint{hold.ID}, out.Conflict.Holds)
+	assert.True(out.Conflict.RepoHeld)
+	assert.True(out.Conflict.Deferred)
+
+	rec, err = call(http.MethodGet, "/admin/sovereignty/holds/conflicts?pending=true", "", b.handleAdminLegalHoldConflicts)
+	assert.NoError(err)
+	var conflicts []models.LegalHoldConflict
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &conflicts))
+	assert.Len(conflicts, 1)
+
+	rec, err = call(http.MethodGet, "/admin/repo/reset?did=did:plc:alice", "", b.handleAdminResetRepo)
+	assert.NoError(err)
+	assert.Equal(http.StatusConflict, rec.Code)
+
+	_, err = call(http.MethodPost, "/admin/sovereignty/holds/release", `{"id": 999, "actor": "counsel"}`, b.handleAdminReleaseLegalHold)
+	assert.Equal(404, err.(*echo.HTTPError).Code)
+	_, err = call(http.MethodPost, "/admin/sovereignty/holds/release", `{"id": 1}`, b.handleAdminReleaseLegalHold)
+	assert.Equal(400, err.(*echo.HTTPError).Code)
+	rec, err = call(http.MethodPost, "/admin/sovereignty/holds/release", `{"id": 1, "actor": "counsel", "note": "case closed"}`, b.handleAdminReleaseLegalHold)
+	assert.NoError(err)
+	assert.Equal(200, rec.Code)
+
+	rec, err = call(http.MethodGet, "/admin/sovereignty/holds/conflicts?pending=true", "", b.handleAdminLegalHoldConflicts)
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &conflicts))
+	assert.Empty(conflicts)
+
+	rec, err = call(http.MethodGet, "/admin/sovereignty/holds/audit?did=did:plc:alice", "", b.handleAdminLegalHoldAudit)
+	assert.NoError(err)
+	var audit []models.LegalHoldAuditEntry
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &audit))
+	assert.Len(audit, 4)
+	assert.Equal("release", audit[0].Action)
+	assert.Equal("192.0.2.1", audit[0].RemoteIP)
+}
@@ -0,0 +1,206 @@
+package bgs
+
+import (
+	"strconv"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/lexcheck"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupLexCheck loads the lexicon registry the records of processed commits are validated against
+func (bgs *BGS) setupLexCheck(config *SovereignConfig) error {
+	policy := config.LexiconPolicy
+	if policy == nil {
+		policy = lexcheck.DefaultPolicy()
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	opts := lexcheck.DefaultRegistryOptions()
+	opts.Dir = config.LexiconDir
+	opts.Logger = bgs.log
+	if config.LexiconResolve {
+		opts.Directory = config.Directory
+		if opts.Directory == nil {
+			opts.Directory = identity.DefaultDirectory()
+		}
+	}
+	reg, err := lexcheck.NewRegistry(opts)
+	if err != nil {
+		return err
+	}
+	bgs.lexCheck = lexcheck.NewChecker(reg, policy)
+	bgs.events.SetHold(bgs.holdEvent)
+	bgs.log.Info("loaded lexicons for record validation", "count", len(reg.Lexicons()), "default", policy.Default, "unknown", policy.Unknown, "resolve", config.LexiconResolve)
+	return nil
+}
+
+// holdEvent decides whether an added event is held back from persistence and broadcast: commits with records the lexicon policy rejects are dropped, and watchlisted accounts' events are held for moderation
+func (bgs *BGS) holdEvent(evt *events.XRPCStreamEvent) bool {
+	if bgs.lexCheck != nil && evt.RepoCommit != nil && bgs.rejectCommit(evt.RepoCommit) {
+		return true
+	}
+	return bgs.prescreen != nil && bgs.prescreen.Hold(evt)
+}
+
+// rejectCommit validates a commit's records, recording those failing under a label or reject strictness. Returns true if the commit is to be left out of the relay's output
+func (bgs *BGS) rejectCommit(commit *comatproto.SyncSubscribeRepos_Commit) bool {
+	action, findings := bgs.lexCheck.CheckCommit(commit)
+	lexiconCommitsCounter.WithLabelValues(action).Inc()
+	if action == lexcheck.StrictnessPass {
+		return false
+	}
+	recorded := "labeled"
+	if action == lexcheck.StrictnessReject {
+		recorded = "rejected"
+	}
+	var rows []models.InvalidRecord
+	for _, f := range findings {
+		if f.Strictness == lexcheck.StrictnessPass {
+			continue
+		}
+		rows = append(rows, models.InvalidRecord{
+			Did:       commit.Repo,
+			Rev:       commit.Rev,
+			Seq:       commit.Seq,
+			Path:      f.Path,
+			Cid:       f.CID,
+			ErrorType: f.Type,
+			Error:     f.Error,
+			Action:    recorded,
+		})
+	}
+	if err := bgs.db.Create(&rows).Error; err != nil {
+		bgs.log.Error("failed to record invalid records", "did", commit.Repo, "seq", commit.Seq, "err", err)
+	}
+	if action == lexcheck.StrictnessReject {
+		bgs.log.Info("rejected commit with invalid records", "did", commit.Repo, "seq", commit.Seq, "rev", commit.Rev, "records", len(rows))
+		return true
+	}
+	return false
+}
+
+func (bgs *BGS) lexCheckEnabled() error {
+	if bgs.lexCheck == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "record validation is not enabled",
+		}
+	}
+	return nil
+}
+
+type lexiconsResponse struct {
+	Lexicons []lexcheck.Entry `json:"lexicons"`
+	Policy   *lexcheck.Policy `json:"policy"`
+}
+
+// handleAdminLexicons lists the lexicons records are validated against, and the validation policy
+func (bgs *BGS) handleAdminLexicons(e echo.Context) error {
+	if err := bgs.lexCheckEnabled(); err != nil {
+		return err
+	}
+	return e.JSON(200, lexiconsResponse{
+		Lexicons: bgs.lexCheck.Registry().Lexicons(),
+		Policy:   bgs.lexCheck.Policy(),
+	})
+}
+
+// handleAdminReloadLexicons reloads the lexicon directory; if it has errors, the previous lexicons are kept
+func (bgs *BGS) handleAdminReloadLexicons(e echo.Context) error {
+	if err := bgs.lexCheckEnabled(); err != nil {
+		return err
+	}
+	if err := bgs.lexCheck.Registry().Reload(); err != nil {
+		bgs.log.Error("failed to reload lexicons, keeping the previous versions", "err", err)
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	lexicons := bgs.lexCheck.Registry().Lexicons()
+	bgs.log.Info("reloaded lexicons", "count", len(lexicons))
+	return e.JSON(200, lexiconsResponse{
+		Lexicons: lexicons,
+		Policy:   bgs.lexCheck.Policy(),
+	})
+}
+
+type invalidRecordView struct {
+	ID        uint      `json:"id"`
+	DID       string    `json:"did"`
+	Rev       string    `json:"rev"`
+	Seq       int64     `json:"seq"`
+	Path      string    `json:"path"`
+	CID       string    `json:"cid"`
+	ErrorType string    `json:"errorType"`
+	Error     string    `json:"error"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type invalidRecordsResponse struct {
+	Records []invalidRecordView `json:"records"`
+	Cursor  string              `json:"cursor,omitempty"`
+}
+
+// handleAdminInvalidRecords lists the records labeled or rejected by validation, newest first, optionally only an account's or those failing for a given reason
+func (bgs *BGS) handleAdminInvalidRecords(e echo.Context) error {
+	if err := bgs.lexCheckEnabled(); err != nil {
+		return err
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc").Limit(limit)
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	if typ := e.QueryParam("type"); typ != "" {
+		q = q.Where("error_type = ?", typ)
+	}
+	if cursor := e.QueryParam("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return &echo.HTTPError{Code: 400, Message: "bad cursor"}
+		}
+		q = q.Where("id < ?", id)
+	}
+	var rows []models.InvalidRecord
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+	out := invalidRecordsResponse{Records: make([]invalidRecordView, len(rows))}
+	for i, r := range rows {
+		out.Records[i] = invalidRecordView{
+			ID:        r.ID,
+			DID:       r.Did,
+			Rev:       r.Rev,
+			Seq:       r.Seq,
+			Path:      r.Path,
+			CID:       r.Cid,
+			ErrorType: r.ErrorType,
+			Error:     r.Error,
+			Action:    r.Action,
+			CreatedAt: r.CreatedAt.UTC(),
+		}
+	}
+	if len(rows) == limit {
+		out.Cursor = strconv.FormatUint(uint64(rows[limit-1].ID), 10)
+	}
+	return e.JSON(200, out)
+}
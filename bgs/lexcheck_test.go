@@ -0,0 +1,99 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty/lexcheck"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexiconValidation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/lexicons", "", b.handleAdminLexicons)
+	assert.Error(err)
+
+	dir := t.TempDir()
+	note := `{"lexicon": 1, "id": "com.example.note", "defs": {"main": {"type": "record", "key": "tid", "record": {"type": "object", "required": ["text"], "properties": {"text": {"type": "string", "maxLength": 10}}}}}}`
+	if err := os.WriteFile(filepath.Join(dir, "note.json"), []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultSovereignConfig()
+	config.LexiconDir = dir
+	config.LexiconPolicy = lexcheck.DefaultPolicy()
+	config.LexiconPolicy.Collections = map[string]string{"com.example.note": lexcheck.StrictnessReject}
+	if err := b.setupLexCheck(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(seq int64, path string, rec map[string]any) *events.XRPCStreamEvent {
+		blk := cartest.NewBlock(t, rec)
+		link := lexutil.LexLink(blk.Cid)
+		return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:abc",
+			Seq:    seq,
+			Rev:    "3333333333333",
+			Commit: link,
+			Blocks: cartest.CAR(t, blk),
+			Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: path, Cid: &link}},
+			Time:   "2024-01-01T00:00:00Z",
+		}}
+	}
+	head := func() int64 {
+		seq, _ := b.events.Head()
+		return seq
+	}
+
+	start := head()
+	assert.NoError(b.events.AddEvent(ctx, commit(1, "com.example.note/3333333333333", map[string]any{"$type": "com.example.note", "text": "hi"})))
+	assert.Equal(start+1, head())
+	// rejected
+	assert.NoError(b.events.AddEvent(ctx, commit(2, "com.example.note/3333333333334", map[string]any{"$type": "com.example.note", "text": "far too long a note"})))
+	assert.Equal(start+1, head())
+	// unknown collections pass by default
+	assert.NoError(b.events.AddEvent(ctx, commit(3, "com.example.other/3333333333335", map[string]any{"$type": "com.example.other"})))
+	assert.Equal(start+2, head())
+
+	rec, err := call("GET", "/admin/sovereignty/invalid-records", "", b.handleAdminInvalidRecords)
+	assert.NoError(err)
+	var out invalidRecordsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	if assert.Len(out.Records, 1) {
+		assert.Equal("did:plc:abc", out.Records[0].DID)
+		assert.Equal(int64(2), out.Records[0].Seq)
+		assert.Equal(lexcheck.ErrorInvalid, out.Records[0].ErrorType)
+		assert.Equal("rejected", out.Records[0].Action)
+	}
+	_, err = call("GET", "/admin/sovereignty/invalid-records?limit=0", "", b.handleAdminInvalidRecords)
+	assert.Error(err)
+
+	rec, err = call("GET", "/admin/sovereignty/lexicons", "", b.handleAdminLexicons)
+	assert.NoError(err)
+	var lexicons lexiconsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &lexicons))
+	if assert.Len(lexicons.Lexicons, 1) {
+		assert.Equal("com.example.note", lexicons.Lexicons[0].NSID)
+		assert.Equal(lexcheck.SourceFile, lexicons.Lexicons[0].Source)
+	}
+}
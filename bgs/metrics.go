@@ -73,3 +73,234 @@ var newUserDiscoveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 	Help:    "A histogram of new user discovery latencies",
 	Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
 })
+
+var appealsSubmittedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_appeals_submitted",
+	Help: "The total number of appeals submitted",
+}, []string{"kind"})
+
+var appealsResolvedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_appeals_resolved",
+	Help: "The total number of appeals resolved, by decision",
+}, []string{"kind", "status"})
+
+var appealResolutionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bgs_appeal_resolution_seconds",
+	Help:    "Time from appeal submission to resolution",
+	Buckets: prometheus.ExponentialBuckets(60, 4, 10),
+}, []string{"kind"})
+
+var blobPolicyViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_blob_policy_violations",
+	Help: "Records referencing blobs the blob policy doesn't allow, by reason",
+}, []string{"reason"})
+
+var policyRampPercent = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_policy_ramp_percent",
+	Help: "Percentage of accounts the current sovereignty policy applies to",
+})
+
+var policyRampDivergentAccounts = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_policy_ramp_divergent_accounts",
+	Help: "Classified accounts whose sovereign stream carriage differs between the ramping and previous policies",
+})
+
+var policyRampSwitchedAccounts = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_policy_ramp_switched_accounts",
+	Help: "Divergent accounts the ramping policy already applies to",
+})
+
+var policyRampDivergentEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_policy_ramp_divergent_events",
+	Help: "Sovereign stream events the ramping and previous policies disagree on carrying, by whether the ramping policy adds or removes them",
+}, []string{"change"})
+
+var resumeCursorChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_resume_cursor_checks",
+	Help: "Sovereign stream reconnections by how their cursor checked out: ok, integer, integer_refused, malformed, invalid_mac, epoch_mismatch or filter_changed",
+}, []string{"result"})
+
+var legacySyncCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_legacy_sync_calls",
+	Help: "Calls to removed sync methods served by compatibility shims, by method",
+}, []string{"method"})
+
+var streamConsumerConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_stream_consumer_connections",
+	Help: "Stream consumer connections, by negotiated protocol version (or undeclared)",
+}, []string{"version"})
+
+var streamConsumersByVersion = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bgs_stream_consumers_by_version",
+	Help: "Connected stream consumers, by negotiated protocol version (or undeclared)",
+}, []string{"version"})
+
+var identityRefreshesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_identity_refreshes",
+	Help: "Queued synthetic #identity refresh events, by outcome (emitted, skipped or failed)",
+}, []string{"result"})
+
+var plcAuditsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_plc_audits",
+	Help: "did:plc operation history audits, by outcome (clean, flagged or error)",
+}, []string{"result"})
+
+var adminSocketRejections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_admin_socket_rejections",
+	Help: "Admin socket connections rejected by peer credential checks",
+})
+
+var legalHoldConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_legal_hold_conflicts",
+	Help: "Erasure requests which hit a legal hold, by workflow (takedown, deletion or reset)",
+}, []string{"workflow"})
+
+var scrubShardsChecked = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_scrub_shards_checked",
+	Help: "CAR shards verified by the integrity scrubber",
+})
+
+var scrubCorruptBlocks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_scrub_corrupt_blocks",
+	Help: "Blocks found not to match their CID by the integrity scrubber",
+})
+
+var scrubCorruptShards = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_scrub_corrupt_shards",
+	Help: "Damaged CAR shards found by the last completed scrub pass",
+})
+
+var scrubLastPass = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_scrub_last_pass_timestamp",
+	Help: "Unix time the last scrub pass completed",
+})
+
+var scrubRepairs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_scrub_repairs",
+	Help: "Repairs of damaged CAR shards, by outcome (repaired, unrecoverable or failed)",
+}, []string{"result"})
+
+var mirrorChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_mirror_checks",
+	Help: "Mirrored repos compared with their origin PDS, by outcome (consistent, behind, ahead, forked or error)",
+}, []string{"result"})
+
+var mirrorDivergence = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_mirror_divergence",
+	Help: "Fraction of the repos sampled by the last completed mirror check which differed from their origin PDS",
+})
+
+var mirrorLastCheck = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_mirror_last_check_timestamp",
+	Help: "Unix time the last mirror check pass completed",
+})
+
+var mirrorResyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_mirror_resyncs",
+	Help: "Resyncs of repos found to differ from their origin PDS, by outcome (queued, reset, held or failed)",
+}, []string{"result"})
+
+var countryResolutionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_country_resolutions",
+	Help: "Country resolutions of unclassified accounts, by outcome (classified, low_confidence, damped while the account's classification is held, unknown, error, or dropped from a full queue)",
+}, []string{"result"})
+
+var filterCacheLookupsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_filter_cache_lookups",
+	Help: "Filter cache lookups for accounts queued for country resolution, by result (hit, miss or error)",
+}, []string{"result"})
+
+var filterCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_filter_cache_entries",
+	Help: "Decisions held by the in-process filter cache; not reported for a shared cache",
+})
+
+var classificationExpirationsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_classification_expirations",
+	Help: "DID classifications removed on expiry, to be resolved again",
+})
+
+var geoIPReloadsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_geoip_reloads",
+	Help: "Reloads of the GeoIP database after its file changed, by result (reloaded or failed)",
+}, []string{"result"})
+
+var didListReloadsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_did_list_reloads",
+	Help: "Reloads of the in-country and out-of-country account lists after their file changed, by list and result (reloaded or failed)",
+}, []string{"list", "result"})
+
+var didListSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bgs_did_list_accounts",
+	Help: "Accounts on the in-country and out-of-country lists, by list",
+}, []string{"list"})
+
+var talkersLimitedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_talkers_limited_events",
+	Help: "Events withheld from the sovereign stream because their account dominated the talkers window",
+})
+
+var talkersActionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_talkers_actions",
+	Help: "Accounts which started dominating the talkers window, by the action taken (review, limit or none)",
+}, []string{"action"})
+
+var egressSubscribers = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_egress_subscribers",
+	Help: "Sovereign stream connections with records withheld by egress rules, by the country the subscriber was located in (unknown if it couldn't be)",
+}, []string{"country"})
+
+var egressWithheldRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_egress_withheld_records",
+	Help: "Records withheld from sovereign stream subscribers by egress rules, by rule",
+}, []string{"rule"})
+
+var namespaceBlockedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_namespace_blocked_records",
+	Help: "Record ops left out of the sovereign stream, or withheld from commits it carries, by the namespace blocking them (unlisted for collections outside the allowlist)",
+}, []string{"namespace"})
+
+var languageFilterCommits = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_language_filter_commits",
+	Help: "Commits judged by the language filter, by verdict (matched, unmatched or undecided for commits creating no posts)",
+}, []string{"verdict"})
+
+var subscriberConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_subscriber_connections",
+	Help: "Sovereign stream connections made with a subscriber token, by the token's profile",
+}, []string{"profile"})
+
+var publicDelayedConnections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_sovereign_public_delayed_connections",
+	Help: "Connections to the sovereign stream by public subscribers, which get it with the public delay",
+})
+
+var shadowFilterResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_shadow_results",
+	Help: "Sovereign stream filter decisions in shadow mode, which the stream doesn't act on, by what the filter would do (include, hash_only or exclude), confidence in the account's country, reason, and the account's classified country (none if unclassified)",
+}, []string{"result", "confidence", "reason", "country"})
+
+var sovereignFilterResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_sovereign_filter_results",
+	Help: "Sovereign stream filter decisions, per consumer, by result (include, hash_only or exclude), confidence in the account's country, reason, and the account's classified country (none if unclassified, or for events not about an account)",
+}, []string{"result", "confidence", "reason", "country"})
+
+var residencyDeclarationsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_residency_declarations",
+	Help: "Residency declarations read from accounts' repos, by what the residency policy made of them (see the residency package), or invalid, dropped from a full queue, or error",
+}, []string{"result"})
+
+var lexiconCommitsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_lexicon_commits",
+	Help: "Commits whose records were validated against their lexicons, by the strictest handling of their failing records: pass (including commits without any), label or reject",
+}, []string{"action"})
+
+var scaleSignalGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bgs_scale_signal",
+	Help: "Autoscaling signals, in their own units: ingest_lag (seconds), persister_backlog (events), fanout_saturation (0 to 1) and subscribers",
+}, []string{"signal"})
+
+var scaleLoadGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bgs_scale_load",
+	Help: "Autoscaling signals normalized by their targets, 1 meaning the replica is at capacity by that signal; \"max\" is the highest",
+}, []string{"signal"})
@@ -0,0 +1,414 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/time/rate"
+)
+
+// outcomes of checking a mirrored repo against its origin PDS
+const (
+	mirrorConsistent = "consistent"
+	// the origin has commits the mirror doesn't; usually just lag, unless it persists
+	mirrorBehind = "behind"
+	// the mirror has a later rev than the origin; the origin rolled back, or the mirror took commits it shouldn't have
+	mirrorAhead = "ahead"
+	// the same rev, with a different commit
+	mirrorForked = "forked"
+	// the origin couldn't be asked, or the mirror couldn't be read
+	mirrorError = "error"
+)
+
+// MirrorCheck is the outcome of comparing one mirrored repo with its origin PDS
+type MirrorCheck struct {
+	Did        string `json:"did"`
+	PDS        string `json:"pds"`
+	Status     string `json:"status"`
+	LocalRev   string `json:"localRev,omitempty"`
+	LocalRoot  string `json:"localRoot,omitempty"`
+	OriginRev  string `json:"originRev,omitempty"`
+	OriginRoot string `json:"originRoot,omitempty"`
+	// queued, reset, held or failed; empty unless the repo was resynced
+	Resync string `json:"resync,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// MirrorCheckReport summarizes a pass of the mirror checker over a sample of mirrored repos
+type MirrorCheckReport struct {
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Sampled  int            `json:"sampled"`
+	Counts   map[string]int `json:"counts"`
+	// fraction of the sampled repos whose origin answered which differ from it
+	Divergence float64       `json:"divergence"`
+	Divergent  []MirrorCheck `json:"divergent"`
+	// divergent repos beyond maxMirrorCheckFindings are counted, but not listed
+	Omitted int    `json:"omitted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+const maxMirrorCheckFindings = 1000
+
+type MirrorCheckOptions struct {
+	// time between the end of one pass and the start of the next
+	Interval time.Duration
+	// repos sampled per pass
+	SampleSize int
+	// requests per second to origin PDSes; 0 is unlimited
+	Rate float64
+	// resync repos found to differ from their origin
+	Resync bool
+	// schedules passes and timestamps reports; nil uses the system clock
+	Clock clock.Clock
+	// picks the repos sampled; nil uses the global source. Only used by the checker's own goroutine
+	Rand *rand.Rand
+}
+
+func DefaultMirrorCheckOptions() *MirrorCheckOptions {
+	return &MirrorCheckOptions{
+		Interval:   time.Hour,
+		SampleSize: 500,
+		Rate:       10,
+	}
+}
+
+// MirrorChecker periodically samples mirrored repos, and compares each with the latest commit its origin PDS reports, to measure how faithfully the relay mirrors the network. Divergent repos are reported, and resynced if enabled.
+type MirrorChecker struct {
+	bgs     *BGS
+	limiter *rate.Limiter
+
+	interval   time.Duration
+	sampleSize int
+	resync     bool
+	clock      clock.Clock
+	rand       *rand.Rand
+
+	lk      sync.Mutex
+	current *MirrorCheckReport
+	last    *MirrorCheckReport
+
+	trigger chan struct{}
+	exit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newMirrorChecker(bgs *BGS, opts *MirrorCheckOptions) *MirrorChecker {
+	if opts == nil {
+		opts = DefaultMirrorCheckOptions()
+	}
+	lim := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		lim = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	return &MirrorChecker{
+		bgs:        bgs,
+		limiter:    lim,
+		interval:   opts.Interval,
+		sampleSize: max(opts.SampleSize, 1),
+		resync:     opts.Resync,
+		clock:      clock.OrSystem(opts.Clock),
+		rand:       opts.Rand,
+		trigger:    make(chan struct{}, 1),
+		exit:       make(chan struct{}),
+	}
+}
+
+// Start runs a pass every interval, or when triggered
+func (mc *MirrorChecker) Start() {
+	log.Info("starting mirror checker", "interval", mc.interval, "sample", mc.sampleSize, "resync", mc.resync)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-mc.exit
+		cancel()
+	}()
+	mc.wg.Add(1)
+	go func() {
+		defer mc.wg.Done()
+		t := mc.clock.NewTimer(mc.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-mc.exit:
+				return
+			case <-t.C():
+			case <-mc.trigger:
+				t.Stop()
+			}
+			mc.run(ctx)
+			t.Reset(mc.interval)
+		}
+	}()
+}
+
+// Shutdown stops the mirror checker, abandoning any pass in progress
+func (mc *MirrorChecker) Shutdown() {
+	log.Info("stopping mirror checker")
+	close(mc.exit)
+	mc.wg.Wait()
+	log.Info("mirror checker stopped")
+}
+
+// Trigger starts a pass now, unless one is already running. Returns false if it is
+func (mc *MirrorChecker) Trigger() bool {
+	mc.lk.Lock()
+	defer mc.lk.Unlock()
+	if mc.current != nil {
+		return false
+	}
+	select {
+	case mc.trigger <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Reports returns the pass in progress, if any, and the last completed one
+func (mc *MirrorChecker) Reports() (*MirrorCheckReport, *MirrorCheckReport) {
+	mc.lk.Lock()
+	defer mc.lk.Unlock()
+	var cur *MirrorCheckReport
+	if mc.current != nil {
+		c := *mc.current
+		c.Counts = make(map[string]int, len(mc.current.Counts))
+		for k, v := range mc.current.Counts {
+			c.Counts[k] = v
+		}
+		c.Divergent = append([]MirrorCheck(nil), mc.current.Divergent...)
+		cur = &c
+	}
+	return cur, mc.last
+}
+
+func (mc *MirrorChecker) run(ctx context.Context) {
+	ctx, span := otel.Tracer("mirrorcheck").Start(ctx, "MirrorCheckPass")
+	defer span.End()
+
+	rep := &MirrorCheckReport{Started: mc.clock.Now(), Counts: make(map[string]int)}
+	mc.lk.Lock()
+	mc.current = rep
+	mc.lk.Unlock()
+
+	err := mc.checkSample(ctx, rep)
+
+	mc.lk.Lock()
+	defer mc.lk.Unlock()
+	now := mc.clock.Now()
+	rep.Finished = &now
+	if answered := rep.Sampled - rep.Counts[mirrorError]; answered > 0 {
+		rep.Divergence = float64(rep.Counts[mirrorBehind]+rep.Counts[mirrorAhead]+rep.Counts[mirrorForked]) / float64(answered)
+	}
+	if err != nil {
+		rep.Error = err.Error()
+		log.Error("mirror check pass failed", "err", err, "sampled", rep.Sampled)
+	} else {
+		mirrorDivergence.Set(rep.Divergence)
+		mirrorLastCheck.SetToCurrentTime()
+		log.Info("mirror check pass complete", "sampled", rep.Sampled, "counts", rep.Counts, "divergence", rep.Divergence, "duration", now.Sub(rep.Started))
+	}
+	mc.current = nil
+	mc.last = rep
+}
+
+func (mc *MirrorChecker) checkSample(ctx context.Context, rep *MirrorCheckReport) error {
+	users, err := mc.bgs.sampleMirroredUsers(ctx, mc.sampleSize, mc.rand)
+	if err != nil {
+		return fmt.Errorf("sampling repos: %w", err)
+	}
+	for _, u := range users {
+		if err := mc.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		res := mc.bgs.checkMirroredRepo(ctx, u)
+		if mc.resync && res.Status != mirrorConsistent && res.Status != mirrorError {
+			res.Resync = mc.bgs.resyncMirroredRepo(ctx, u, res.Status)
+		}
+		mirrorChecks.WithLabelValues(res.Status).Inc()
+
+		mc.lk.Lock()
+		rep.Sampled++
+		rep.Counts[res.Status]++
+		if res.Status != mirrorConsistent && res.Status != mirrorError {
+			if len(rep.Divergent) < maxMirrorCheckFindings {
+				rep.Divergent = append(rep.Divergent, *res)
+			} else {
+				rep.Omitted++
+			}
+		}
+		mc.lk.Unlock()
+	}
+	return nil
+}
+
+// sampleMirroredUsers picks up to n active accounts at random, by probing random points in the range of user IDs. Accounts after gaps in the range are a little more likely to be picked. rng may be nil, to use the global source.
+func (bgs *BGS) sampleMirroredUsers(ctx context.Context, n int, rng *rand.Rand) ([]*User, error) {
+	int64N := rand.Int64N
+	if rng != nil {
+		int64N = rng.Int64N
+	}
+
+	var maxID int64
+	if err := bgs.db.WithContext(ctx).Model(&User{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+		return nil, err
+	}
+	if maxID == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[models.Uid]bool)
+	var out []*User
+	for attempts := 0; len(out) < n && attempts < 4*n; attempts++ {
+		var u User
+		if err := bgs.db.WithContext(ctx).
+			Where("id >= ? AND taken_down = false AND tombstoned = false AND (upstream_status = '' OR upstream_status = ?)", int64N(maxID)+1, events.AccountStatusActive).
+			Order("id").Limit(1).Find(&u).Error; err != nil {
+			return nil, err
+		}
+		if u.ID == 0 || seen[u.ID] {
+			continue
+		}
+		seen[u.ID] = true
+		out = append(out, &u)
+	}
+	return out, nil
+}
+
+// checkMirroredRepo compares the mirrored repo with the latest commit its origin PDS reports. The mirror is read first, so commits landing in between can only make it look behind, never ahead or forked.
+func (bgs *BGS) checkMirroredRepo(ctx context.Context, u *User) *MirrorCheck {
+	res := &MirrorCheck{Did: u.Did}
+	fail := func(err error) *MirrorCheck {
+		res.Status = mirrorError
+		res.Error = err.Error()
+		return res
+	}
+
+	var pds models.PDS
+	if err := bgs.db.WithContext(ctx).Find(&pds, "id = ?", u.PDS).Error; err != nil {
+		return fail(err)
+	}
+	if pds.ID == 0 {
+		return fail(fmt.Errorf("no origin PDS"))
+	}
+	res.PDS = pds.Host
+
+	localRev, err := bgs.repoman.GetRepoRev(ctx, u.ID)
+	if err != nil {
+		return fail(fmt.Errorf("reading mirror: %w", err))
+	}
+	localRoot, err := bgs.repoman.GetRepoRoot(ctx, u.ID)
+	if err != nil {
+		return fail(fmt.Errorf("reading mirror: %w", err))
+	}
+	res.LocalRev = localRev
+	if localRoot.Defined() {
+		res.LocalRoot = localRoot.String()
+	}
+
+	fctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	latest, err := comatproto.SyncGetLatestCommit(fctx, bgs.pdsClient(&pds), u.Did)
+	if err != nil {
+		return fail(fmt.Errorf("asking origin: %w", err))
+	}
+	res.OriginRev = latest.Rev
+	res.OriginRoot = latest.Cid
+
+	switch {
+	case res.LocalRoot == res.OriginRoot:
+		res.Status = mirrorConsistent
+	case res.LocalRev == res.OriginRev:
+		res.Status = mirrorForked
+	case res.LocalRev < res.OriginRev:
+		res.Status = mirrorBehind
+	default:
+		res.Status = mirrorAhead
+	}
+	return res
+}
+
+// resyncMirroredRepo brings a divergent repo back in line with its origin: one which is behind is recrawled, and one which has diverged is reset first, unless a legal hold prevents it. Returns the outcome
+func (bgs *BGS) resyncMirroredRepo(ctx context.Context, u *User, status string) string {
+	result := bgs.doResyncMirroredRepo(ctx, u, status)
+	mirrorResyncs.WithLabelValues(result).Inc()
+	return result
+}
+
+func (bgs *BGS) doResyncMirroredRepo(ctx context.Context, u *User, status string) string {
+	log := bgs.log.With("did", u.Did, "status", status)
+	ai, err := bgs.Index.LookupUserByDid(ctx, u.Did)
+	if err != nil {
+		log.Error("failed to look up divergent repo for resync", "err", err)
+		return "failed"
+	}
+	if ai.PDS == 0 {
+		log.Error("divergent repo has no PDS to resync from")
+		return "failed"
+	}
+	if status == mirrorBehind {
+		if err := bgs.Index.Crawler.Crawl(ctx, ai); err != nil {
+			log.Error("failed to enqueue crawl for divergent repo", "err", err)
+			return "failed"
+		}
+		return "queued"
+	}
+
+	if conflict := bgs.legalHoldConflict(ctx, u.Did, holdWorkflowReset, false); conflict != nil {
+		log.Warn("not resetting divergent repo under legal hold", "holds", conflict.Holds)
+		return "held"
+	}
+	if err := bgs.repoman.ResetRepo(ctx, ai.Uid); err != nil {
+		log.Error("failed to reset divergent repo", "err", err)
+		return "failed"
+	}
+	if err := bgs.Index.Crawler.Crawl(ctx, ai); err != nil {
+		log.Error("failed to enqueue crawl for reset repo", "err", err)
+		return "failed"
+	}
+	log.Info("reset divergent repo")
+	return "reset"
+}
+
+// handleAdminMirrorCheckStatus returns the mirror check pass in progress, if any, and the last completed one
+func (bgs *BGS) handleAdminMirrorCheckStatus(e echo.Context) error {
+	if bgs.mirrorChecker == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "mirror checking is not enabled",
+		}
+	}
+	cur, last := bgs.mirrorChecker.Reports()
+	return e.JSON(200, map[string]any{
+		"running": cur,
+		"last":    last,
+	})
+}
+
+// handleAdminStartMirrorCheck starts a mirror check pass now, rather than waiting for the next scheduled one
+func (bgs *BGS) handleAdminStartMirrorCheck(e echo.Context) error {
+	if bgs.mirrorChecker == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "mirror checking is not enabled",
+		}
+	}
+	if !bgs.mirrorChecker.Trigger() {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: "a mirror check pass is already running",
+		}
+	}
+	bgs.log.Info("mirror check pass requested", "remote_ip", e.RealIP())
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
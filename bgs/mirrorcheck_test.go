@@ -0,0 +1,123 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorCheckPass(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+
+	// what the origin PDS reports for each account
+	origin := make(map[string]comatproto.SyncGetLatestCommit_Output)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, ok := origin[r.URL.Query().Get("did")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"RepoNotFound"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+	pds := models.PDS{Host: strings.TrimPrefix(srv.URL, "http://")}
+	assert.NoError(b.db.Create(&pds).Error)
+
+	mirror := func(did string) (string, string) {
+		uid := createTestUser(t, b, did)
+		assert.NoError(b.db.Model(&User{}).Where("id = ?", uid).Update("pds", pds.ID).Error)
+		assert.NoError(b.db.Model(&models.ActorInfo{}).Where("uid = ?", uid).Update("pds", pds.ID).Error)
+		if did == "did:plc:dave" {
+			return "", ""
+		}
+		assert.NoError(b.repoman.InitNewActor(ctx, uid, "handle.invalid", did, "", "", ""))
+		rev, err := b.repoman.GetRepoRev(ctx, uid)
+		assert.NoError(err)
+		root, err := b.repoman.GetRepoRoot(ctx, uid)
+		assert.NoError(err)
+		return rev, root.String()
+	}
+
+	rev, root := mirror("did:plc:alice")
+	origin["did:plc:alice"] = comatproto.SyncGetLatestCommit_Output{Rev: rev, Cid: root}
+	rev, _ = mirror("did:plc:bob")
+	origin["did:plc:bob"] = comatproto.SyncGetLatestCommit_Output{Rev: rev, Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}
+	mirror("did:plc:carol")
+	origin["did:plc:carol"] = comatproto.SyncGetLatestCommit_Output{Rev: "2222222222222", Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}
+	mirror("did:plc:dave")
+	origin["did:plc:dave"] = comatproto.SyncGetLatestCommit_Output{Rev: "3zzzzzzzzzzzz", Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}
+	mirror("did:plc:erin")
+
+	mc := newMirrorChecker(b, &MirrorCheckOptions{SampleSize: 10})
+	mc.run(ctx)
+	cur, last := mc.Reports()
+	assert.Nil(cur)
+	assert.NotNil(last.Finished)
+	assert.Empty(last.Error)
+	assert.Equal(5, last.Sampled)
+	assert.Equal(map[string]int{mirrorConsistent: 1, mirrorForked: 1, mirrorAhead: 1, mirrorBehind: 1, mirrorError: 1}, last.Counts)
+	assert.Equal(0.75, last.Divergence)
+	status := make(map[string]string)
+	for _, d := range last.Divergent {
+		status[d.Did] = d.Status
+		assert.Empty(d.Resync)
+	}
+	assert.Equal(map[string]string{"did:plc:bob": mirrorForked, "did:plc:carol": mirrorAhead, "did:plc:dave": mirrorBehind}, status)
+
+	// diverged repos under a legal hold are left alone
+	placeHold(t, b, "did:plc:bob", 0, 0)
+	mc = newMirrorChecker(b, &MirrorCheckOptions{SampleSize: 10, Resync: true})
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	mc.run(rctx)
+	_, last = mc.Reports()
+	resync := make(map[string]string)
+	for _, d := range last.Divergent {
+		resync[d.Did] = d.Resync
+	}
+	assert.Equal("held", resync["did:plc:bob"])
+	assert.Equal("reset", resync["did:plc:carol"])
+	assert.Equal("queued", resync["did:plc:dave"])
+}
+
+func TestMirrorCheckProxy(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+
+	var latest comatproto.SyncGetLatestCommit_Output
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxied request names the whole URL
+		proxied.Store(r.URL.String())
+		json.NewEncoder(w).Encode(latest)
+	}))
+	defer proxy.Close()
+	ps := httpprofile.Defaults()
+	ps.SetProxy("none", []httpprofile.ProxyRule{{Hosts: []string{"pds.example.com"}, Proxy: proxy.URL}})
+	clients, err := httpprofile.NewClients(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.httpClients = clients
+
+	// the origin PDS is only reachable through the proxy
+	u, out := mirroredAccount(t, b, "did:plc:alice", "pds.example.com")
+	latest = out
+	res := b.checkMirroredRepo(context.Background(), u)
+	assert.Equal(mirrorConsistent, res.Status, res.Error)
+	assert.Equal("http://pds.example.com/xrpc/com.atproto.sync.getLatestCommit?did=did%3Aplc%3Aalice", proxied.Load())
+}
@@ -0,0 +1,29 @@
+package bgs
+
+import (
+	"github.com/bluesky-social/indigo/events"
+)
+
+// namespaceBlocked returns true if an event is a commit touching only collections outside the sovereign stream's namespaces, counting its ops
+func (bgs *BGS) namespaceBlocked(evt *events.XRPCStreamEvent) bool {
+	if bgs.namespaces == nil || evt.RepoCommit == nil || !bgs.namespaces.AllBlocked(evt.RepoCommit) {
+		return false
+	}
+	for _, op := range evt.RepoCommit.Ops {
+		ns, _ := bgs.namespaces.BlockedPath(op.Path)
+		namespaceBlockedRecords.WithLabelValues(ns).Inc()
+	}
+	return true
+}
+
+// namespaceWithheld returns true if the record at a path is of a collection outside the sovereign stream's namespaces, counting it
+func (bgs *BGS) namespaceWithheld(path string) bool {
+	if bgs.namespaces == nil {
+		return false
+	}
+	ns, blocked := bgs.namespaces.BlockedPath(path)
+	if blocked {
+		namespaceBlockedRecords.WithLabelValues(ns).Inc()
+	}
+	return blocked
+}
@@ -0,0 +1,81 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/namespaces"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSovereignNamespaces(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.policy.Store(pol)
+	assert.NoError(b.SetClassification(context.Background(), sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "admin"}))
+	b.namespaces, err = namespaces.NewPolicy([]string{"app.gndr.*", "ca.gndr.*"}, []string{"chat.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := cartest.Commit(t, "did:plc:aaa")
+	chat := cartest.NewBlock(t, map[string]any{"$type": "chat.bsky.convo.message", "text": "psst"})
+	post := cartest.NewBlock(t, map[string]any{"$type": "app.gndr.feed.post", "text": "hello"})
+	blocks := cartest.CAR(t, root, chat, post)
+	commit := func(ops ...*comatproto.SyncSubscribeRepos_RepoOp) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:aaa",
+			Commit: lexutil.LexLink(root.Cid),
+			Blocks: blocks,
+			Ops:    ops,
+		}}
+	}
+	chatOp := &comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "chat.bsky.convo.message/3k", Cid: chat.Link()}
+	postOp := &comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "app.gndr.feed.post/3k", Cid: post.Link()}
+	likeOp := &comatproto.SyncSubscribeRepos_RepoOp{Action: "delete", Path: "app.bsky.feed.like/3k"}
+
+	// commits touching only blocked or unlisted collections are left out
+	r := b.evaluateFilter(commit(chatOp, likeOp), nil)
+	assert.False(r.Include)
+	assert.Equal(sovereignty.FilterReasonNamespace, r.Reason)
+	r = b.evaluateFilter(commit(chatOp, postOp), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonCountry, r.Reason)
+	// events other than commits aren't about collections
+	r = b.evaluateFilter(&events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:aaa"}}, nil)
+	assert.True(r.Include)
+
+	// the rest have the blocked records withheld
+	out, err := b.sovereignTransform(commit(chatOp, postOp), "", nil, nil)
+	assert.NoError(err)
+	cr, err := car.NewCarReader(bytes.NewReader(out.RepoCommit.Blocks))
+	assert.NoError(err)
+	found := map[cid.Cid]bool{}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		found[blk.Cid()] = true
+	}
+	assert.True(found[root.Cid])
+	assert.True(found[post.Cid])
+	assert.False(found[chat.Cid])
+	assert.Len(out.RepoCommit.Ops, 2)
+}
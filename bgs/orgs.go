@@ -0,0 +1,176 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// orgDomainResolver returns a resolver for proving organization domains with regular handle resolution, over the interactive HTTP client
+func (bgs *BGS) orgDomainResolver() *identity.BaseDirectory {
+	return &identity.BaseDirectory{
+		HTTPClient: *bgs.httpClients.Get(httpprofile.Interactive),
+		Resolver: net.Resolver{
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: time.Second * 3}
+				return d.DialContext(ctx, network, address)
+			},
+		},
+		UserAgent: "indigo-relay",
+	}
+}
+
+// loadVerifiedOrgs populates the in-memory registry from the database
+func (bgs *BGS) loadVerifiedOrgs() error {
+	var rows []models.VerifiedOrg
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading verified organizations: %w", err)
+	}
+	list := make([]orgs.Org, len(rows))
+	for i, r := range rows {
+		list[i] = orgs.Org{
+			DID:        r.Did,
+			Domain:     r.Domain,
+			Name:       r.Name,
+			Kind:       r.Kind,
+			Method:     r.Method,
+			VerifiedAt: r.VerifiedAt.UTC(),
+		}
+	}
+	bgs.Orgs.Replace(list)
+	bgs.log.Info("loaded verified organizations", "count", len(list))
+	return nil
+}
+
+// VerifyOrg proves the organization's domain against its DID and, on success, records it as verified.
+func (bgs *BGS) VerifyOrg(ctx context.Context, o orgs.Org) (orgs.Org, error) {
+	if err := orgs.ValidKind(o.Kind); err != nil {
+		return o, err
+	}
+	o, err := bgs.orgVerifier.Verify(ctx, o)
+	if err != nil {
+		return o, err
+	}
+
+	row := models.VerifiedOrg{
+		Did:        o.DID,
+		Domain:     o.Domain,
+		Name:       o.Name,
+		Kind:       o.Kind,
+		Method:     o.Method,
+		VerifiedAt: o.VerifiedAt,
+	}
+	if err := bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"domain", "name", "kind", "method", "verified_at", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		return o, err
+	}
+	bgs.Orgs.Set(o)
+	bgs.log.Info("verified organization", "did", o.DID, "domain", o.Domain, "kind", o.Kind, "method", o.Method)
+	return o, nil
+}
+
+// RemoveOrg revokes an organization's verification.
+func (bgs *BGS) RemoveOrg(ctx context.Context, did string) error {
+	if err := bgs.db.WithContext(ctx).Unscoped().Where("did = ?", did).Delete(&models.VerifiedOrg{}).Error; err != nil {
+		return err
+	}
+	bgs.Orgs.Delete(did)
+	bgs.log.Info("removed verified organization", "did", did)
+	return nil
+}
+
+// handleListOrgs publishes the verified organization list for downstream consumers (feed generators, labelers)
+func (bgs *BGS) handleListOrgs(e echo.Context) error {
+	return e.JSON(200, bgs.Orgs.List())
+}
+
+type orgBody struct {
+	Did    string `json:"did"`
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+}
+
+func (bgs *BGS) handleAdminVerifyOrg(e echo.Context) error {
+	var body orgBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	domain, err := syntax.ParseHandle(body.Domain)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid domain: %w", err).Error(),
+		}
+	}
+	if err := orgs.ValidKind(body.Kind); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+
+	o, err := bgs.VerifyOrg(e.Request().Context(), orgs.Org{
+		DID:    did.String(),
+		Domain: domain.String(),
+		Name:   body.Name,
+		Kind:   body.Kind,
+	})
+	if err != nil {
+		if errors.Is(err, orgs.ErrDomainMismatch) || errors.Is(err, identity.ErrHandleNotFound) || errors.Is(err, identity.ErrHandleResolutionFailed) {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("domain verification failed: %s", err),
+			}
+		}
+		return err
+	}
+	return e.JSON(200, o)
+}
+
+func (bgs *BGS) handleAdminRemoveOrg(e echo.Context) error {
+	var body orgBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did in body",
+		}
+	}
+	if !bgs.Orgs.IsVerified(body.Did) {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "not a verified organization",
+		}
+	}
+
+	if err := bgs.RemoveOrg(e.Request().Context(), body.Did); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
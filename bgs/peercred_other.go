@@ -0,0 +1,13 @@
+//go:build !linux
+
+package bgs
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerUID is only implemented on Linux; elsewhere all admin socket connections are rejected
+func peerUID(c net.Conn) (int, error) {
+	return -1, fmt.Errorf("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,181 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// maximum number of accounts waiting for a PLC audit
+const plcAuditQueueSize = 10_000
+
+// enqueuePLCAudit queues an audit of a classified did:plc account's identity history, dropping it if the queue is full
+func (bgs *BGS) enqueuePLCAudit(did string) {
+	if bgs.plcAudits == nil || !strings.HasPrefix(did, "did:plc:") {
+		return
+	}
+	if _, ok := bgs.Classifications.Get(did); !ok {
+		return
+	}
+	select {
+	case bgs.plcAuditQueue <- did:
+	default:
+		bgs.log.Warn("PLC audit queue is full, dropping audit", "did", did)
+	}
+}
+
+// AuditPLC replays an account's PLC operation log, and persists the result
+func (bgs *BGS) AuditPLC(ctx context.Context, did string) (*plcops.Audit, error) {
+	a, err := bgs.plcAudits.Audit(ctx, did, plcops.DefaultAuditOptions())
+	if err != nil {
+		plcAuditsCounter.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	report, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	row := models.PLCAudit{
+		Did:        did,
+		Valid:      a.Valid,
+		Flagged:    a.Flagged(),
+		Operations: a.Operations,
+		Report:     report,
+		AuditedAt:  time.Now(),
+	}
+	err = bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "valid", "flagged", "operations", "report", "audited_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	if a.Flagged() {
+		plcAuditsCounter.WithLabelValues("flagged").Inc()
+		bgs.log.Warn("identity history flagged", "did", did, "valid", a.Valid, "errors", a.Errors, "anomalies", a.Anomalies)
+	} else {
+		plcAuditsCounter.WithLabelValues("clean").Inc()
+	}
+	return a, nil
+}
+
+// runPLCAudits audits queued accounts, and periodically queues classified accounts whose last audit is older than interval, until the context is cancelled
+func (bgs *BGS) runPLCAudits(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	rescan := func() {
+		if interval <= 0 {
+			return
+		}
+		for _, did := range bgs.stalePLCAudits(ctx, interval) {
+			bgs.enqueuePLCAudit(did)
+		}
+	}
+	rescan()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rescan()
+		case did := <-bgs.plcAuditQueue:
+			if _, err := bgs.AuditPLC(ctx, did); err != nil && ctx.Err() == nil {
+				bgs.log.Warn("failed to audit PLC history", "did", did, "err", err)
+			}
+		}
+	}
+}
+
+// stalePLCAudits returns the classified did:plc accounts which were never audited, or not within interval
+func (bgs *BGS) stalePLCAudits(ctx context.Context, interval time.Duration) []string {
+	var fresh []string
+	if err := bgs.db.WithContext(ctx).Model(&models.PLCAudit{}).Where("audited_at > ?", time.Now().Add(-interval)).Pluck("did", &fresh).Error; err != nil {
+		bgs.log.Error("failed to list PLC audits", "err", err)
+		return nil
+	}
+	skip := make(map[string]bool, len(fresh))
+	for _, d := range fresh {
+		skip[d] = true
+	}
+	var out []string
+	for _, c := range bgs.Classifications.Snapshot() {
+		if strings.HasPrefix(c.DID, "did:plc:") && !skip[c.DID] {
+			out = append(out, c.DID)
+		}
+	}
+	return out
+}
+
+// plcAuditFlags summarizes the problems found by an account's latest PLC audit, if it was flagged
+func (bgs *BGS) plcAuditFlags(did string) []string {
+	var row models.PLCAudit
+	if err := bgs.db.Where("did = ? AND flagged = ?", did, true).Limit(1).Find(&row).Error; err != nil || row.ID == 0 {
+		return nil
+	}
+	var a plcops.Audit
+	if err := json.Unmarshal(row.Report, &a); err != nil {
+		return nil
+	}
+	out := append([]string{}, a.Errors...)
+	for _, an := range a.Anomalies {
+		out = append(out, an.Detail)
+	}
+	return out
+}
+
+// handleAdminPLCAudit audits an account's PLC history immediately
+func (bgs *BGS) handleAdminPLCAudit(e echo.Context) error {
+	if bgs.plcAudits == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "PLC auditing is not enabled",
+		}
+	}
+	did := e.QueryParam("did")
+	if !strings.HasPrefix(did, "did:plc:") {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify a did:plc",
+		}
+	}
+	a, err := bgs.AuditPLC(e.Request().Context(), did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    502,
+			Message: "failed to audit PLC history: " + err.Error(),
+		}
+	}
+	return e.JSON(200, a)
+}
+
+// handleAdminFlaggedPLCAudits lists the latest audits of accounts with invalid or anomalous identity histories, most recent first
+func (bgs *BGS) handleAdminFlaggedPLCAudits(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 1000)",
+			}
+		}
+		limit = n
+	}
+	var rows []models.PLCAudit
+	if err := bgs.db.WithContext(e.Request().Context()).Where("flagged = ?", true).Order("audited_at DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return err
+	}
+	out := make([]json.RawMessage, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.Report)
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,380 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoPolicyAuthority = errors.New("no policy authority configured")
+	ErrInvalidPolicy     = errors.New("invalid policy document")
+	ErrStalePolicy       = errors.New("policy document does not supersede the current policy")
+)
+
+// sovereignPolicy is the compiled form of a policy document, swapped in atomically so the stream never sees a half-applied policy
+type sovereignPolicy struct {
+	doc             *policy.Document
+	streamCountries map[string]bool
+	// carried subdivisions, by region (eg, "CA-QC")
+	streamSubdivisions map[string]bool
+	transforms         *transform.Pipeline
+	annotateLangs      bool
+	priorityNeedsOrg   bool
+	filterHash         uint64
+
+	// in exclusion mode, the countries left out; every other account is carried
+	excludeCountries map[string]bool
+
+	// while a ramp is in progress: the last fully rolled out policy, which still applies to accounts the ramp doesn't cover yet
+	prev      *sovereignPolicy
+	ramp      *policy.Ramp
+	rampStart time.Time
+}
+
+// rampPercent returns the percentage of accounts this policy applies to
+func (sp *sovereignPolicy) rampPercent(now time.Time) float64 {
+	if sp.prev == nil {
+		return 100
+	}
+	return sp.ramp.Percent(sp.rampStart, now)
+}
+
+// excluding returns true if the policy carries every account except those of its excluded countries
+func (sp *sovereignPolicy) excluding() bool {
+	return len(sp.excludeCountries) > 0
+}
+
+// carries returns true if the policy carries accounts with the classification, by their country or subdivision
+func (sp *sovereignPolicy) carries(c sovereignty.Classification) bool {
+	if sp.excluding() {
+		return !sp.excludeCountries[c.Country]
+	}
+	return sp.streamCountries[c.Country] || (c.Subdivision != "" && sp.streamSubdivisions[c.Region()])
+}
+
+// carriesAny returns true if the policy carries any accounts at all
+func (sp *sovereignPolicy) carriesAny() bool {
+	return len(sp.streamCountries) > 0 || len(sp.streamSubdivisions) > 0 || sp.excluding()
+}
+
+// forDID returns the policy which applies to the account: this one, or the previous one if a ramp hasn't reached the account yet
+func (sp *sovereignPolicy) forDID(did string) *sovereignPolicy {
+	if sp.prev == nil || policy.Covers(did, sp.rampPercent(time.Now())) {
+		return sp
+	}
+	return sp.prev
+}
+
+func (bgs *BGS) newSovereignPolicy(doc *policy.Document) (*sovereignPolicy, error) {
+	sp := &sovereignPolicy{
+		doc:                doc,
+		streamCountries:    make(map[string]bool),
+		streamSubdivisions: make(map[string]bool),
+		excludeCountries:   make(map[string]bool),
+		annotateLangs:      doc.AnnotateIndigenousLangs,
+		priorityNeedsOrg:   doc.PriorityRequiresVerifiedOrg,
+		filterHash:         doc.FilterHash(),
+	}
+	for _, raw := range doc.StreamCountries {
+		c, err := sovereignty.NormalizeCountry(raw)
+		if err != nil {
+			return nil, err
+		}
+		sp.streamCountries[c] = true
+	}
+	for _, raw := range doc.StreamSubdivisions {
+		r, err := sovereignty.NormalizeRegion(raw)
+		if err != nil {
+			return nil, err
+		}
+		sp.streamSubdivisions[r] = true
+	}
+	for _, raw := range doc.ExcludeCountries {
+		c, err := sovereignty.NormalizeCountry(raw)
+		if err != nil {
+			return nil, err
+		}
+		sp.excludeCountries[c] = true
+	}
+	if sp.excluding() && (len(sp.streamCountries) > 0 || len(sp.streamSubdivisions) > 0) {
+		return nil, policy.ErrCarryAndExclude
+	}
+	if len(doc.TransformRules) > 0 {
+		pl, err := transform.NewPipeline(doc.TransformRules, bgs.sovereignKey)
+		if err != nil {
+			return nil, err
+		}
+		sp.transforms = pl
+	}
+	return sp, nil
+}
+
+// loadPolicy re-applies the most recently applied policy document, then the configured one if it is newer
+func (bgs *BGS) loadPolicy(configured string) error {
+	if bgs.policyAuthority == nil {
+		if configured != "" {
+			return fmt.Errorf("applying a policy document requires a policy authority key")
+		}
+		return nil
+	}
+
+	// the latest document, and the one before it in case the latest is still ramping
+	var rows []models.AppliedPolicy
+	if err := bgs.db.Order("id desc").Limit(2).Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading applied policy: %w", err)
+	}
+	var restored []*sovereignPolicy
+	for _, row := range rows {
+		doc, err := policy.Verify(row.Token, bgs.policyAuthority, nil)
+		if err != nil {
+			// eg, the authority key was rotated; the local configuration applies until a new document arrives
+			bgs.log.Warn("previously applied policy document no longer verifies, ignoring it", "version", row.Version, "err", err)
+			break
+		}
+		sp, err := bgs.newSovereignPolicy(doc)
+		if err != nil {
+			return fmt.Errorf("loading applied policy: %w", err)
+		}
+		if row.Ramp != "" {
+			var ramp policy.Ramp
+			if err := json.Unmarshal([]byte(row.Ramp), &ramp); err != nil {
+				return fmt.Errorf("loading applied policy ramp: %w", err)
+			}
+			sp.ramp = &ramp
+			sp.rampStart = row.CreatedAt
+		}
+		restored = append(restored, sp)
+	}
+	if len(restored) > 0 {
+		sp := restored[0]
+		if sp.ramp != nil && sp.ramp.Percent(sp.rampStart, time.Now()) < 100 {
+			sp.prev = bgs.policy.Load()
+			if len(restored) > 1 {
+				sp.prev = restored[1]
+			}
+		}
+		bgs.policy.Store(sp)
+		bgs.log.Info("loaded applied policy document", "version", sp.doc.Version, "ramp_percent", sp.rampPercent(time.Now()))
+	}
+
+	if configured != "" {
+		doc, err := bgs.ApplyPolicy(context.Background(), configured, nil, "config", "")
+		if errors.Is(err, ErrStalePolicy) {
+			bgs.log.Info("configured policy document already applied or superseded", "current_version", bgs.policy.Load().doc.Version)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		bgs.log.Info("applied configured policy document", "version", doc.Version)
+	}
+	return nil
+}
+
+// ApplyPolicy verifies a signed policy document against the policy authority key and, if it supersedes the current one (a higher version, issued no earlier), makes it the relay's sovereign stream policy. With a ramp, the document first applies to only a share of accounts, growing over time; the rest stay on the last fully rolled out policy. Applying a document while another is ramping replaces the ramping one. The document is kept in the audit history, which is pruned to the configured length.
+func (bgs *BGS) ApplyPolicy(ctx context.Context, token string, ramp *policy.Ramp, actor, remoteIP string) (*policy.Document, error) {
+	if bgs.policyAuthority == nil {
+		return nil, ErrNoPolicyAuthority
+	}
+	var rampJSON string
+	if ramp != nil {
+		if err := ramp.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+		}
+		b, err := json.Marshal(ramp)
+		if err != nil {
+			return nil, err
+		}
+		rampJSON = string(b)
+	}
+
+	bgs.policyLk.Lock()
+	defer bgs.policyLk.Unlock()
+	cur := bgs.policy.Load()
+	// against the current document, so an earlier token presented again is refused
+	doc, err := policy.Verify(token, bgs.policyAuthority, cur.doc)
+	switch {
+	case errors.Is(err, policy.ErrNotNewer):
+		return nil, ErrStalePolicy
+	case err != nil:
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+	sp, err := bgs.newSovereignPolicy(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+	row := models.AppliedPolicy{
+		Version:  doc.Version,
+		Token:    token,
+		Ramp:     rampJSON,
+		Actor:    actor,
+		RemoteIP: remoteIP,
+	}
+	err = bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		if bgs.policyHistory <= 0 {
+			return nil
+		}
+		keep := tx.Model(&models.AppliedPolicy{}).Select("id").Order("id desc").Limit(bgs.policyHistory)
+		return tx.Where("id NOT IN (?)", keep).Delete(&models.AppliedPolicy{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ramp != nil {
+		sp.ramp = ramp
+		sp.rampStart = row.CreatedAt
+		sp.prev = cur
+		if cur.prev != nil {
+			sp.prev = cur.prev
+		}
+	}
+	bgs.policy.Store(sp)
+	bgs.updatePolicyRampLocked()
+	bgs.log.Info("applied policy document", "version", doc.Version, "countries", doc.StreamCountries, "subdivisions", doc.StreamSubdivisions, "excluded", doc.ExcludeCountries, "rules", len(doc.TransformRules), "ramp", rampJSON, "actor", actor, "remote_ip", remoteIP)
+	if bgs.selfRepo != nil {
+		bgs.announcePolicy(ctx, doc, token)
+	}
+	return doc, nil
+}
+
+// runPolicyRamp advances any policy ramp, and its metrics, until the context is cancelled
+func (bgs *BGS) runPolicyRamp(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			bgs.policyLk.Lock()
+			bgs.updatePolicyRampLocked()
+			bgs.policyLk.Unlock()
+		}
+	}
+}
+
+// updatePolicyRampLocked refreshes the ramp metrics, and completes the ramp once it covers all accounts. Must hold policyLk.
+func (bgs *BGS) updatePolicyRampLocked() {
+	sp := bgs.policy.Load()
+	pct := sp.rampPercent(time.Now())
+	policyRampPercent.Set(pct)
+	if sp.prev == nil {
+		policyRampDivergentAccounts.Set(0)
+		policyRampSwitchedAccounts.Set(0)
+		return
+	}
+
+	// classified accounts whose carriage differs between the two policies, and how many of those have moved over
+	var divergent, switched int
+	for _, c := range bgs.Classifications.Snapshot() {
+		if sp.carries(c) == sp.prev.carries(c) {
+			continue
+		}
+		divergent++
+		if policy.Covers(c.DID, pct) {
+			switched++
+		}
+	}
+	policyRampDivergentAccounts.Set(float64(divergent))
+	policyRampSwitchedAccounts.Set(float64(switched))
+
+	if pct >= 100 {
+		done := *sp
+		done.prev = nil
+		bgs.policy.Store(&done)
+		bgs.log.Info("policy ramp complete", "version", sp.doc.Version, "divergent_accounts", divergent)
+	}
+}
+
+// PolicyRampStatus describes the rollout of the current policy
+type PolicyRampStatus struct {
+	Version int64 `json:"version"`
+	// version still applied to accounts the ramp doesn't cover; unset when no ramp is in progress
+	PreviousVersion *int64       `json:"previousVersion,omitempty"`
+	Ramp            *policy.Ramp `json:"ramp,omitempty"`
+	StartedAt       *time.Time   `json:"startedAt,omitempty"`
+	Percent         float64      `json:"percent"`
+}
+
+// PolicyRamp returns the rollout status of the current policy.
+func (bgs *BGS) PolicyRamp() PolicyRampStatus {
+	sp := bgs.policy.Load()
+	st := PolicyRampStatus{
+		Version: sp.doc.Version,
+		Percent: sp.rampPercent(time.Now()),
+	}
+	if sp.prev != nil {
+		st.PreviousVersion = &sp.prev.doc.Version
+		st.Ramp = sp.ramp
+		st.StartedAt = &sp.rampStart
+	}
+	return st
+}
+
+type applyPolicyBody struct {
+	Token string `json:"token"`
+	// optional staged rollout
+	Ramp  *policy.Ramp `json:"ramp,omitempty"`
+	Actor string       `json:"actor"`
+}
+
+func (bgs *BGS) handleAdminApplyPolicy(e echo.Context) error {
+	var body applyPolicyBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	doc, err := bgs.ApplyPolicy(e.Request().Context(), body.Token, body.Ramp, body.Actor, e.RealIP())
+	switch {
+	case errors.Is(err, ErrStalePolicy):
+		return &echo.HTTPError{
+			Code:    409,
+			Message: err.Error(),
+		}
+	case errors.Is(err, ErrInvalidPolicy), errors.Is(err, ErrNoPolicyAuthority):
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	case err != nil:
+		return err
+	}
+	return e.JSON(200, doc)
+}
+
+// handleAdminGetPolicy returns the policy currently in effect; version 0 is the relay's local configuration
+func (bgs *BGS) handleAdminGetPolicy(e echo.Context) error {
+	return e.JSON(200, bgs.policy.Load().doc)
+}
+
+func (bgs *BGS) handleAdminPolicyRamp(e echo.Context) error {
+	return e.JSON(200, bgs.PolicyRamp())
+}
+
+// handleAdminPolicyHistory returns the retained applied policy documents, newest first
+func (bgs *BGS) handleAdminPolicyHistory(e echo.Context) error {
+	var entries []models.AppliedPolicy
+	if err := bgs.db.WithContext(e.Request().Context()).Order("id desc").Find(&entries).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, entries)
+}
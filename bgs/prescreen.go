@@ -0,0 +1,253 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/prescreen"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// setupPreScreen holds watchlisted accounts' events back from persistence and broadcast until moderators decide on them
+func (bgs *BGS) setupPreScreen(config *SovereignConfig) error {
+	opts := prescreen.DefaultOptions()
+	opts.Timeout = config.PreScreenTimeout
+	action, err := prescreen.ParseAction(config.PreScreenOnTimeout)
+	if err != nil {
+		return err
+	}
+	opts.OnTimeout = action
+	opts.MaxPending = config.PreScreenMaxPending
+	opts.Clock = bgs.clock
+	q := prescreen.NewQueue(opts, func(evt *events.XRPCStreamEvent) {
+		bgs.events.Release(context.Background(), evt)
+	})
+
+	var rows []models.WatchedRepo
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading pre-screen watchlist: %w", err)
+	}
+	watched := make(map[string]string, len(rows))
+	for _, r := range rows {
+		watched[r.Did] = r.Reason
+	}
+	q.SetWatchlist(watched)
+	bgs.prescreen = q
+	bgs.events.SetHold(bgs.holdEvent)
+	bgs.log.Info("loaded pre-screen watchlist", "count", len(rows), "timeout", opts.Timeout, "onTimeout", opts.OnTimeout)
+	return nil
+}
+
+func (bgs *BGS) preScreenEnabled() error {
+	if bgs.prescreen == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "moderation pre-screening is not enabled",
+		}
+	}
+	return nil
+}
+
+type preScreenQueueResponse struct {
+	Pending []prescreen.Item `json:"pending"`
+}
+
+// handleAdminPreScreenQueue lists the held events, oldest first
+func (bgs *BGS) handleAdminPreScreenQueue(e echo.Context) error {
+	if err := bgs.preScreenEnabled(); err != nil {
+		return err
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	return e.JSON(200, preScreenQueueResponse{Pending: bgs.prescreen.Pending(limit)})
+}
+
+type preScreenDecideBody struct {
+	ID      uint64 `json:"id"`
+	Approve bool   `json:"approve"`
+	Actor   string `json:"actor"`
+	Note    string `json:"note"`
+}
+
+// handleAdminPreScreenDecide approves a held event, emitting it once the account's earlier events are decided, or rejects it, dropping it
+func (bgs *BGS) handleAdminPreScreenDecide(e echo.Context) error {
+	if err := bgs.preScreenEnabled(); err != nil {
+		return err
+	}
+	var body preScreenDecideBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	item, err := bgs.prescreen.Decide(body.ID, body.Approve)
+	if errors.Is(err, prescreen.ErrNotPending) {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no such pending event",
+		}
+	}
+	if err != nil {
+		return err
+	}
+	action := "reject"
+	if body.Approve {
+		action = "approve"
+	}
+	entry := models.PreScreenAuditEntry{
+		Did:       item.DID,
+		Action:    action,
+		EventKind: item.Kind,
+		Rev:       item.Rev,
+		Actor:     body.Actor,
+		Note:      body.Note,
+		RemoteIP:  e.RealIP(),
+	}
+	if err := bgs.db.WithContext(e.Request().Context()).Create(&entry).Error; err != nil {
+		return err
+	}
+	bgs.log.Info("pre-screened event decided", "did", item.DID, "kind", item.Kind, "rev", item.Rev, "action", item.Action, "actor", body.Actor)
+	return e.JSON(200, item)
+}
+
+// handleAdminPreScreenWatchlist lists the watched accounts, by DID
+func (bgs *BGS) handleAdminPreScreenWatchlist(e echo.Context) error {
+	if err := bgs.preScreenEnabled(); err != nil {
+		return err
+	}
+	var rows []models.WatchedRepo
+	if err := bgs.db.WithContext(e.Request().Context()).Order("did").Find(&rows).Error; err != nil {
+		return err
+	}
+	type watchedRepo struct {
+		Did       string `json:"did"`
+		Reason    string `json:"reason,omitempty"`
+		AddedBy   string `json:"addedBy"`
+		CreatedAt string `json:"createdAt"`
+	}
+	out := make([]watchedRepo, len(rows))
+	for i, r := range rows {
+		out[i] = watchedRepo{Did: r.Did, Reason: r.Reason, AddedBy: r.AddedBy, CreatedAt: r.CreatedAt.UTC().Format("2006-01-02T15:04:05Z")}
+	}
+	return e.JSON(200, map[string]any{"watchlist": out})
+}
+
+type preScreenWatchBody struct {
+	Did    string `json:"did"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// handleAdminPreScreenWatch adds an account to the watchlist, holding its events from the next one
+func (bgs *BGS) handleAdminPreScreenWatch(e echo.Context) error {
+	if err := bgs.preScreenEnabled(); err != nil {
+		return err
+	}
+	var body preScreenWatchBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	row := models.WatchedRepo{
+		Did:     did.String(),
+		Reason:  body.Reason,
+		AddedBy: body.Actor,
+	}
+	err = bgs.db.WithContext(e.Request().Context()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "did"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason", "added_by"}),
+		}).Create(&row).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.PreScreenAuditEntry{
+			Did:      row.Did,
+			Action:   "watch",
+			Actor:    body.Actor,
+			Note:     body.Reason,
+			RemoteIP: e.RealIP(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	bgs.prescreen.Watch(row.Did, row.Reason)
+	bgs.log.Info("account added to pre-screen watchlist", "did", row.Did, "reason", row.Reason, "actor", body.Actor)
+	return e.JSON(200, map[string]any{"success": true})
+}
+
+// handleAdminPreScreenUnwatch removes an account from the watchlist. Its held events still wait for decisions
+func (bgs *BGS) handleAdminPreScreenUnwatch(e echo.Context) error {
+	if err := bgs.preScreenEnabled(); err != nil {
+		return err
+	}
+	var body preScreenWatchBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	err := bgs.db.WithContext(e.Request().Context()).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("did = ?", body.Did).Delete(&models.WatchedRepo{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "account is not on the watchlist",
+			}
+		}
+		return tx.Create(&models.PreScreenAuditEntry{
+			Did:      body.Did,
+			Action:   "unwatch",
+			Actor:    body.Actor,
+			Note:     body.Reason,
+			RemoteIP: e.RealIP(),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	bgs.prescreen.Unwatch(body.Did)
+	bgs.log.Info("account removed from pre-screen watchlist", "did", body.Did, "actor", body.Actor)
+	return e.JSON(200, map[string]any{"success": true})
+}
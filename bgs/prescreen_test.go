@@ -0,0 +1,112 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreScreen(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/prescreen", "", b.handleAdminPreScreenQueue)
+	assert.Error(err)
+
+	config := DefaultSovereignConfig()
+	config.PreScreenTimeout = time.Hour
+	if err := b.setupPreScreen(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = call("POST", "/admin/sovereignty/prescreen/watchlist", `{"did": "did:plc:watched", "reason": "order 123"}`, b.handleAdminPreScreenWatch)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/prescreen/watchlist", `{"did": "nope", "actor": "mod"}`, b.handleAdminPreScreenWatch)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/prescreen/watchlist", `{"did": "did:plc:watched", "reason": "order 123", "actor": "mod"}`, b.handleAdminPreScreenWatch)
+	assert.NoError(err)
+
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Time: time.Now().UTC().Format(time.RFC3339)}}
+	}
+	head := func() int64 {
+		seq, _ := b.events.Head()
+		return seq
+	}
+
+	// other accounts' events go straight through
+	start := head()
+	assert.NoError(b.events.AddEvent(ctx, identity("did:plc:other")))
+	assert.Equal(start+1, head())
+
+	// the watched account's are held until a moderator decides
+	assert.NoError(b.events.AddEvent(ctx, identity("did:plc:watched")))
+	assert.NoError(b.events.AddEvent(ctx, identity("did:plc:watched")))
+	assert.Equal(start+1, head())
+
+	rec, err := call("GET", "/admin/sovereignty/prescreen", "", b.handleAdminPreScreenQueue)
+	assert.NoError(err)
+	var queue preScreenQueueResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &queue))
+	if !assert.Len(queue.Pending, 2) {
+		return
+	}
+	assert.Equal("did:plc:watched", queue.Pending[0].DID)
+	assert.Equal("identity", queue.Pending[0].Kind)
+	assert.Equal("order 123", queue.Pending[0].Reason)
+
+	decide := func(id uint64, approve bool) error {
+		_, err := call("POST", "/admin/sovereignty/prescreen/decide", fmt.Sprintf(`{"id": %d, "approve": %t, "actor": "mod"}`, id, approve), b.handleAdminPreScreenDecide)
+		return err
+	}
+	assert.NoError(decide(queue.Pending[0].ID, false))
+	assert.Error(decide(queue.Pending[0].ID, true))
+	assert.NoError(decide(queue.Pending[1].ID, true))
+	assert.Equal(start+2, head())
+	assert.Empty(b.prescreen.Pending(10))
+
+	var audit []models.PreScreenAuditEntry
+	assert.NoError(b.db.Order("id").Find(&audit).Error)
+	if assert.Len(audit, 3) {
+		assert.Equal("watch", audit[0].Action)
+		assert.Equal("reject", audit[1].Action)
+		assert.Equal("approve", audit[2].Action)
+		assert.Equal("identity", audit[2].EventKind)
+	}
+
+	// a takedown drops what the account has held
+	assert.NoError(b.events.AddEvent(ctx, identity("did:plc:watched")))
+	assert.Len(b.prescreen.Pending(10), 1)
+	b.prescreen.DropAccount("did:plc:watched")
+	assert.Empty(b.prescreen.Pending(10))
+
+	_, err = call("POST", "/admin/sovereignty/prescreen/watchlist/remove", `{"did": "did:plc:watched", "actor": "mod"}`, b.handleAdminPreScreenUnwatch)
+	assert.NoError(err)
+	_, err = call("POST", "/admin/sovereignty/prescreen/watchlist/remove", `{"did": "did:plc:watched", "actor": "mod"}`, b.handleAdminPreScreenUnwatch)
+	assert.Error(err)
+	assert.NoError(b.events.AddEvent(ctx, identity("did:plc:watched")))
+	assert.Equal(start+3, head())
+
+	rec, err = call("GET", "/admin/sovereignty/prescreen/watchlist", "", b.handleAdminPreScreenWatchlist)
+	assert.NoError(err)
+	assert.Contains(rec.Body.String(), `"watchlist":[]`)
+}
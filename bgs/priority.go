@@ -0,0 +1,226 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loadPriorityAccounts populates the in-memory registry from the database
+func (bgs *BGS) loadPriorityAccounts() error {
+	var rows []models.PriorityAccount
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading priority accounts: %w", err)
+	}
+	accounts := make([]priority.Account, len(rows))
+	for i, r := range rows {
+		accounts[i] = priority.Account{
+			DID:      r.Did,
+			Category: r.Category,
+			Note:     r.Note,
+			AddedBy:  r.AddedBy,
+			AddedAt:  r.CreatedAt.UTC(),
+		}
+	}
+	bgs.Priority.Replace(accounts)
+	return nil
+}
+
+// isPriorityEvent returns true if the event is about a priority account
+func (bgs *BGS) isPriorityEvent(evt *events.XRPCStreamEvent) bool {
+	did := eventDID(evt)
+	return did != "" && bgs.Priority.IsPriority(did)
+}
+
+// PriorityEventsHandler serves the priority stream: only events from priority accounts, unfiltered and untransformed.
+func (bgs *BGS) PriorityEventsHandler(c echo.Context) error {
+	return bgs.serveEvents(c, streamOptions{
+		filter: func(evt *events.XRPCStreamEvent) bool {
+			// info and error frames pass too
+			return eventDID(evt) == "" || bgs.isPriorityEvent(evt)
+		},
+	})
+}
+
+// SetPriorityAccount designates (or updates) a priority account, recording the change in the audit log.
+func (bgs *BGS) SetPriorityAccount(ctx context.Context, a priority.Account, remoteIP string) error {
+	action := "add"
+	a.AddedAt = time.Now().UTC()
+	if prev, ok := bgs.Priority.Get(a.DID); ok {
+		action = "update"
+		a.AddedAt = prev.AddedAt
+	}
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		row := models.PriorityAccount{
+			Did:      a.DID,
+			Category: a.Category,
+			Note:     a.Note,
+			AddedBy:  a.AddedBy,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "did"}},
+			DoUpdates: clause.AssignmentColumns([]string{"category", "note", "added_by", "updated_at"}),
+		}).Create(&row).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PriorityAuditEntry{
+			Did:      a.DID,
+			Action:   action,
+			Category: a.Category,
+			Note:     a.Note,
+			Actor:    a.AddedBy,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	bgs.Priority.Set(a)
+	bgs.log.Info("priority account changed", "action", action, "did", a.DID, "category", a.Category, "actor", a.AddedBy, "remote_ip", remoteIP)
+	return nil
+}
+
+// RemovePriorityAccount removes a priority account designation, recording the change in the audit log.
+func (bgs *BGS) RemovePriorityAccount(ctx context.Context, did, actor, remoteIP string) error {
+	prev, ok := bgs.Priority.Get(did)
+	if !ok {
+		return fmt.Errorf("not a priority account: %s", did)
+	}
+	err := bgs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("did = ?", did).Delete(&models.PriorityAccount{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PriorityAuditEntry{
+			Did:      did,
+			Action:   "remove",
+			Category: prev.Category,
+			Actor:    actor,
+			RemoteIP: remoteIP,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	bgs.Priority.Delete(did)
+	bgs.log.Info("priority account changed", "action", "remove", "did", did, "category", prev.Category, "actor", actor, "remote_ip", remoteIP)
+	return nil
+}
+
+func (bgs *BGS) handleAdminListPriority(e echo.Context) error {
+	return e.JSON(200, bgs.Priority.List())
+}
+
+type priorityBody struct {
+	Did      string `json:"did"`
+	Category string `json:"category"`
+	Note     string `json:"note"`
+	// name of the operator making the change, for the audit log
+	Actor string `json:"actor"`
+}
+
+func (bgs *BGS) handleAdminAddPriority(e echo.Context) error {
+	var body priorityBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	if err := priority.ValidCategory(body.Category); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify actor for the audit log",
+		}
+	}
+	if bgs.policy.Load().forDID(did.String()).priorityNeedsOrg && !bgs.Orgs.IsVerified(did.String()) {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "priority accounts must be verified organizations",
+		}
+	}
+
+	if err := bgs.SetPriorityAccount(e.Request().Context(), priority.Account{
+		DID:      did.String(),
+		Category: body.Category,
+		Note:     body.Note,
+		AddedBy:  body.Actor,
+	}, e.RealIP()); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminRemovePriority(e echo.Context) error {
+	var body priorityBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did == "" || body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did and actor in body",
+		}
+	}
+	if _, ok := bgs.Priority.Get(body.Did); !ok {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "not a priority account",
+		}
+	}
+
+	if err := bgs.RemovePriorityAccount(e.Request().Context(), body.Did, body.Actor, e.RealIP()); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+// handleAdminPriorityAudit returns audit log entries, newest first, optionally for a single DID
+func (bgs *BGS) handleAdminPriorityAudit(e echo.Context) error {
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	q := bgs.db.WithContext(e.Request().Context()).Order("id desc").Limit(limit)
+	if did := e.QueryParam("did"); did != "" {
+		q = q.Where("did = ?", did)
+	}
+	var entries []models.PriorityAuditEntry
+	if err := q.Find(&entries).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, entries)
+}
@@ -0,0 +1,310 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// loadSubscriberProfiles populates the in-memory profiles from the database
+func (bgs *BGS) loadSubscriberProfiles() error {
+	var rows []models.SubscriberProfile
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading subscriber profiles: %w", err)
+	}
+	profiles := make(map[string]*profile.Profile, len(rows))
+	for _, r := range rows {
+		profiles[r.Name] = &profile.Profile{
+			Name:             r.Name,
+			Description:      r.Description,
+			Redaction:        r.Redaction,
+			Annotations:      r.Annotations,
+			HashOnlyBelow:    sovereignty.Confidence(r.HashOnlyBelow),
+			HashOnlyExcluded: r.HashOnlyExcluded,
+			Public:           r.Public,
+		}
+	}
+	bgs.subscriberProfiles.Store(&profiles)
+	return nil
+}
+
+// subscriberProfile returns the named profile, or nil (the relay's default shape) if there is no such profile
+func (bgs *BGS) subscriberProfile(name string) *profile.Profile {
+	profiles := bgs.subscriberProfiles.Load()
+	if profiles == nil {
+		return nil
+	}
+	return (*profiles)[name]
+}
+
+// authSubscriber looks up the subscriber token a sovereign stream consumer presented, if any. A token which is unknown or revoked is an error.
+func (bgs *BGS) authSubscriber(e echo.Context) (*models.SubscriberToken, error) {
+	tok, ok := bearerToken(e)
+	if !ok {
+		return nil, nil
+	}
+	var st models.SubscriberToken
+	if err := bgs.db.WithContext(e.Request().Context()).Where("token_hash = ? AND revoked_at IS NULL", hashToken(tok)).Limit(1).Find(&st).Error; err != nil {
+		return nil, err
+	}
+	if st.ID == 0 {
+		return nil, &echo.HTTPError{
+			Code:    401,
+			Message: "invalid subscriber token",
+		}
+	}
+	return &st, nil
+}
+
+type subscriberProfilesResponse struct {
+	Profiles []*profile.Profile `json:"profiles"`
+}
+
+func (bgs *BGS) handleAdminListSubscriberProfiles(e echo.Context) error {
+	var rows []models.SubscriberProfile
+	if err := bgs.db.WithContext(e.Request().Context()).Order("name").Find(&rows).Error; err != nil {
+		return err
+	}
+	out := subscriberProfilesResponse{Profiles: []*profile.Profile{}}
+	for _, r := range rows {
+		if p := bgs.subscriberProfile(r.Name); p != nil {
+			out.Profiles = append(out.Profiles, p)
+		}
+	}
+	return e.JSON(200, out)
+}
+
+// handleAdminPutSubscriberProfile creates or replaces a profile. Connections made with tokens assigned to it are shaped by the new version from their next event.
+func (bgs *BGS) handleAdminPutSubscriberProfile(e echo.Context) error {
+	var body profile.Profile
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if err := body.Validate(); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	row := models.SubscriberProfile{
+		Name:             body.Name,
+		Description:      body.Description,
+		Redaction:        body.Redaction,
+		Annotations:      body.Annotations,
+		HashOnlyBelow:    int(body.HashOnlyBelow),
+		HashOnlyExcluded: body.HashOnlyExcluded,
+		Public:           body.Public,
+	}
+	err := bgs.db.WithContext(e.Request().Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description", "redaction", "annotations", "hash_only_below", "hash_only_excluded", "public", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+	if err := bgs.loadSubscriberProfiles(); err != nil {
+		return err
+	}
+	bgs.log.Info("subscriber profile saved", "name", body.Name, "redaction", body.Redaction, "annotations", body.Annotations, "hashOnlyBelow", body.HashOnlyBelow, "public", body.Public)
+	return e.JSON(200, bgs.subscriberProfile(body.Name))
+}
+
+type removeSubscriberProfileBody struct {
+	Name string `json:"name"`
+}
+
+// handleAdminRemoveSubscriberProfile deletes a profile which no active token is assigned to
+func (bgs *BGS) handleAdminRemoveSubscriberProfile(e echo.Context) error {
+	var body removeSubscriberProfileBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	var assigned int64
+	if err := bgs.db.WithContext(ctx).Model(&models.SubscriberToken{}).Where("profile = ? AND revoked_at IS NULL", body.Name).Count(&assigned).Error; err != nil {
+		return err
+	}
+	if assigned > 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "profile is assigned to active subscriber tokens",
+		}
+	}
+	res := bgs.db.WithContext(ctx).Where("name = ?", body.Name).Delete(&models.SubscriberProfile{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no such profile",
+		}
+	}
+	if err := bgs.loadSubscriberProfiles(); err != nil {
+		return err
+	}
+	bgs.log.Info("subscriber profile removed", "name", body.Name)
+	return e.JSON(200, map[string]any{"success": true})
+}
+
+type subscriberTokenView struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Profile   string     `json:"profile"`
+	IssuedBy  string     `json:"issuedBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func subscriberTokenViewOf(st models.SubscriberToken) subscriberTokenView {
+	return subscriberTokenView{
+		ID:        st.ID,
+		Name:      st.Name,
+		Profile:   st.Profile,
+		IssuedBy:  st.IssuedBy,
+		CreatedAt: st.CreatedAt.UTC(),
+		RevokedAt: st.RevokedAt,
+	}
+}
+
+// handleAdminListSubscribers lists the subscriber tokens issued, without their secrets
+func (bgs *BGS) handleAdminListSubscribers(e echo.Context) error {
+	q := bgs.db.WithContext(e.Request().Context()).Order("id")
+	if e.QueryParam("includeRevoked") != "true" {
+		q = q.Where("revoked_at IS NULL")
+	}
+	var rows []models.SubscriberToken
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+	out := make([]subscriberTokenView, len(rows))
+	for i, r := range rows {
+		out[i] = subscriberTokenViewOf(r)
+	}
+	return e.JSON(200, map[string]any{"subscribers": out})
+}
+
+type issueSubscriberTokenBody struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile"`
+	Actor   string `json:"actor"`
+}
+
+// lookupSubscriberProfile checks a profile named in an admin request exists
+func (bgs *BGS) lookupSubscriberProfile(name string) error {
+	if bgs.subscriberProfile(name) == nil {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no such profile",
+		}
+	}
+	return nil
+}
+
+// handleAdminIssueSubscriberToken issues a token for a consumer, shaping its sovereign stream by the profile. The token is only ever returned here.
+func (bgs *BGS) handleAdminIssueSubscriberToken(e echo.Context) error {
+	var body issueSubscriberTokenBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Name == "" || body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify name and actor",
+		}
+	}
+	if err := bgs.lookupSubscriberProfile(body.Profile); err != nil {
+		return err
+	}
+	tok, err := randomToken()
+	if err != nil {
+		return err
+	}
+	st := models.SubscriberToken{
+		Name:      body.Name,
+		TokenHash: hashToken(tok),
+		Profile:   body.Profile,
+		IssuedBy:  body.Actor,
+	}
+	if err := bgs.db.WithContext(e.Request().Context()).Create(&st).Error; err != nil {
+		return err
+	}
+	bgs.log.Info("subscriber token issued", "id", st.ID, "name", st.Name, "profile", st.Profile, "actor", body.Actor)
+	return e.JSON(200, map[string]any{
+		"token":      tok,
+		"subscriber": subscriberTokenViewOf(st),
+	})
+}
+
+type assignSubscriberProfileBody struct {
+	ID      uint   `json:"id"`
+	Profile string `json:"profile"`
+}
+
+// getSubscriberToken loads an active subscriber token by ID
+func (bgs *BGS) getSubscriberToken(ctx context.Context, id uint) (*models.SubscriberToken, error) {
+	var st models.SubscriberToken
+	err := bgs.db.WithContext(ctx).Where("id = ? AND revoked_at IS NULL", id).First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &echo.HTTPError{
+			Code:    404,
+			Message: "no such subscriber token",
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// handleAdminAssignSubscriberProfile moves a subscriber token to another profile, which applies to its next connection
+func (bgs *BGS) handleAdminAssignSubscriberProfile(e echo.Context) error {
+	var body assignSubscriberProfileBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	st, err := bgs.getSubscriberToken(ctx, body.ID)
+	if err != nil {
+		return err
+	}
+	if err := bgs.lookupSubscriberProfile(body.Profile); err != nil {
+		return err
+	}
+	if err := bgs.db.WithContext(ctx).Model(st).Update("profile", body.Profile).Error; err != nil {
+		return err
+	}
+	bgs.log.Info("subscriber profile assigned", "id", st.ID, "name", st.Name, "profile", body.Profile)
+	return e.JSON(200, subscriberTokenViewOf(*st))
+}
+
+type revokeSubscriberTokenBody struct {
+	ID uint `json:"id"`
+}
+
+// handleAdminRevokeSubscriberToken revokes a subscriber token; connections already made with it stay open
+func (bgs *BGS) handleAdminRevokeSubscriberToken(e echo.Context) error {
+	var body revokeSubscriberTokenBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	ctx := e.Request().Context()
+	st, err := bgs.getSubscriberToken(ctx, body.ID)
+	if err != nil {
+		return err
+	}
+	if err := bgs.db.WithContext(ctx).Model(st).Update("revoked_at", time.Now().UTC()).Error; err != nil {
+		return err
+	}
+	bgs.log.Info("subscriber token revoked", "id", st.ID, "name", st.Name)
+	return e.JSON(200, map[string]any{"success": true})
+}
@@ -0,0 +1,127 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriberProfiles(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	assert.NoError(b.loadSubscriberProfiles())
+	e := echo.New()
+
+	call := func(method, target, body, token string, h echo.HandlerFunc) (*httptest.ResponseRecorder, echo.Context, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		return rec, c, h(c)
+	}
+
+	_, _, err := call("POST", "/admin/sovereignty/profiles", `{"name": "research", "redaction": "everything"}`, "", b.handleAdminPutSubscriberProfile)
+	assert.Error(err)
+	_, _, err = call("POST", "/admin/sovereignty/profiles", `{"name": "research", "redaction": "records", "annotations": "none", "hashOnlyBelow": "medium", "public": true}`, "", b.handleAdminPutSubscriberProfile)
+	assert.NoError(err)
+	_, _, err = call("POST", "/admin/sovereignty/profiles", `{"name": "appview", "redaction": "standard", "annotations": "full"}`, "", b.handleAdminPutSubscriberProfile)
+	assert.NoError(err)
+	research := b.subscriberProfile("research")
+	if assert.NotNil(research) {
+		assert.Equal(sovereignty.ConfidenceMedium, research.HashOnlyBelow)
+		assert.True(research.IsPublic())
+	}
+	assert.False(b.subscriberProfile("appview").IsPublic())
+
+	rec, _, err := call("GET", "/admin/sovereignty/profiles", "", "", b.handleAdminListSubscriberProfiles)
+	assert.NoError(err)
+	var profiles subscriberProfilesResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &profiles))
+	assert.Len(profiles.Profiles, 2)
+
+	// tokens are issued against existing profiles
+	_, _, err = call("POST", "/admin/sovereignty/subscribers/issue", `{"name": "lab", "profile": "nope", "actor": "ops"}`, "", b.handleAdminIssueSubscriberToken)
+	assert.Error(err)
+	rec, _, err = call("POST", "/admin/sovereignty/subscribers/issue", `{"name": "lab", "profile": "research", "actor": "ops"}`, "", b.handleAdminIssueSubscriberToken)
+	assert.NoError(err)
+	var issued struct {
+		Token      string              `json:"token"`
+		Subscriber subscriberTokenView `json:"subscriber"`
+	}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &issued))
+	assert.NotEmpty(issued.Token)
+
+	_, c, _ := call("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", "", issued.Token, func(echo.Context) error { return nil })
+	sub, err := b.authSubscriber(c)
+	assert.NoError(err)
+	if assert.NotNil(sub) {
+		assert.Equal("research", sub.Profile)
+	}
+	_, c, _ = call("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", "", "", func(echo.Context) error { return nil })
+	sub, err = b.authSubscriber(c)
+	assert.NoError(err)
+	assert.Nil(sub)
+	_, c, _ = call("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", "", "wrong", func(echo.Context) error { return nil })
+	_, err = b.authSubscriber(c)
+	assert.Error(err)
+
+	// a profile in use can't be removed
+	_, _, err = call("POST", "/admin/sovereignty/profiles/remove", `{"name": "research"}`, "", b.handleAdminRemoveSubscriberProfile)
+	assert.Error(err)
+
+	body := fmt.Sprintf(`{"id": %d`, issued.Subscriber.ID)
+	_, _, err = call("POST", "/admin/sovereignty/subscribers/assign", body+`, "profile": "appview"}`, "", b.handleAdminAssignSubscriberProfile)
+	assert.NoError(err)
+	_, c, _ = call("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", "", issued.Token, func(echo.Context) error { return nil })
+	sub, err = b.authSubscriber(c)
+	assert.NoError(err)
+	if assert.NotNil(sub) {
+		assert.Equal("appview", sub.Profile)
+	}
+	_, _, err = call("POST", "/admin/sovereignty/profiles/remove", `{"name": "research"}`, "", b.handleAdminRemoveSubscriberProfile)
+	assert.NoError(err)
+	assert.Nil(b.subscriberProfile("research"))
+
+	_, _, err = call("POST", "/admin/sovereignty/subscribers/revoke", body+`}`, "", b.handleAdminRevokeSubscriberToken)
+	assert.NoError(err)
+	_, c, _ = call("GET", "/sovereignty/xrpc/com.atproto.sync.subscribeRepos", "", issued.Token, func(echo.Context) error { return nil })
+	_, err = b.authSubscriber(c)
+	assert.Error(err)
+}
+
+func TestSubscriberProfileShapes(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+
+	assert.NoError(b.SetClassifications(context.Background(), []sovereignty.Classification{
+		{DID: "did:plc:aaa", Country: "CA", Subdivision: "ON", Source: "admin"},
+	}))
+	identity := &events.XRPCStreamEvent{
+		RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:aaa", Seq: 1},
+	}
+
+	// full annotations carry the region without the subscriber asking, and none leave it out when they do
+	out, err := b.sovereignTransform(identity, "", &profile.Profile{Name: "appview", Annotations: profile.AnnotationsFull}, nil)
+	assert.NoError(err)
+	if assert.NotNil(out.Meta) {
+		assert.Equal("CA-ON", out.Meta.Region)
+		assert.Equal(RegionBasisCurrent, out.Meta.RegionBasis)
+	}
+	out, err = b.sovereignTransform(identity, RegionBasisCurrent, &profile.Profile{Name: "research", Annotations: profile.AnnotationsNone}, nil)
+	assert.NoError(err)
+	assert.Nil(out.Meta)
+}
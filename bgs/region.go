@@ -0,0 +1,65 @@
+package bgs
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+)
+
+// Values of the sovereign stream's regionBasis parameter, and of FrameMeta.RegionBasis.
+const (
+	// the account's classification when the frame is served
+	RegionBasisCurrent = "current"
+	// the account's classification when the event was persisted, where the persister recorded it
+	RegionBasisPersisted = "persisted"
+)
+
+func parseRegionBasis(v string) (string, error) {
+	switch v {
+	case "", RegionBasisCurrent, RegionBasisPersisted:
+		return v, nil
+	default:
+		return "", fmt.Errorf("regionBasis must be %q or %q", RegionBasisCurrent, RegionBasisPersisted)
+	}
+}
+
+// RegionLookup returns the account's current classification region, or "" if it is unclassified. The disk persister records it with each event, for consumers replaying with regionBasis=persisted.
+func (bgs *BGS) RegionLookup(did string) string {
+	cl, ok := bgs.Classifications.Get(did)
+	if !ok {
+		return ""
+	}
+	return cl.Region()
+}
+
+// eventRegion returns the region to annotate evt with under basis, and the basis it actually came from: events persisted without a region fall back to the current classification.
+func (bgs *BGS) eventRegion(evt *events.XRPCStreamEvent, basis string) (string, string) {
+	if basis == RegionBasisPersisted && evt.PrivRegion != "" {
+		return evt.PrivRegion, RegionBasisPersisted
+	}
+	return bgs.RegionLookup(eventDID(evt)), RegionBasisCurrent
+}
+
+// annotateRegion sets the region in the frame metadata of an outbound event, signing the metadata again.
+func (bgs *BGS) annotateRegion(evt *events.XRPCStreamEvent, region, basis string) (*events.XRPCStreamEvent, error) {
+	meta := events.FrameMeta{
+		Repo: eventDID(evt),
+		Seq:  evt.Sequence(),
+	}
+	if evt.Meta != nil {
+		meta = *evt.Meta
+	}
+	meta.Region = region
+	meta.RegionBasis = basis
+	meta.Sig = nil
+	if bgs.sovereignKey != nil {
+		if err := transform.SignMeta(&meta, bgs.sovereignKey); err != nil {
+			return nil, err
+		}
+	}
+	out := *evt
+	out.Meta = &meta
+	out.Preserialized = nil
+	return &out, nil
+}
@@ -0,0 +1,77 @@
+package bgs
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSovereignRegionBasis(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	key, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.sovereignKey = key
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the account moved since its events were persisted
+	assert.NoError(b.SetClassifications(context.Background(), []sovereignty.Classification{
+		{DID: "did:plc:aaa", Country: "CA", Subdivision: "ON", Source: "admin"},
+	}))
+	identity := func(seq int64, region string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{
+			RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:aaa", Seq: seq},
+			PrivRegion:   region,
+		}
+	}
+
+	for _, tc := range []struct {
+		basis      string
+		evt        *events.XRPCStreamEvent
+		region     string
+		usedBasis  string
+		noMetadata bool
+	}{
+		{basis: "", evt: identity(1, "CA-QC"), noMetadata: true},
+		{basis: RegionBasisCurrent, evt: identity(2, "CA-QC"), region: "CA-ON", usedBasis: RegionBasisCurrent},
+		{basis: RegionBasisPersisted, evt: identity(3, "CA-QC"), region: "CA-QC", usedBasis: RegionBasisPersisted},
+		// legacy events fall back to the current classification
+		{basis: RegionBasisPersisted, evt: identity(4, ""), region: "CA-ON", usedBasis: RegionBasisCurrent},
+	} {
+		out, err := b.sovereignTransform(tc.evt, tc.basis, nil, nil)
+		assert.NoError(err)
+		if tc.noMetadata {
+			assert.Nil(out.Meta)
+			continue
+		}
+		if assert.NotNil(out.Meta) {
+			assert.Equal("did:plc:aaa", out.Meta.Repo)
+			assert.Equal(tc.evt.Sequence(), out.Meta.Seq)
+			assert.Equal(tc.region, out.Meta.Region)
+			assert.Equal(tc.usedBasis, out.Meta.RegionBasis)
+			assert.NoError(transform.VerifyMeta(out.Meta, pub))
+		}
+		assert.Nil(tc.evt.Meta)
+	}
+
+	// info frames aren't about an account
+	info := &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}}
+	out, err := b.sovereignTransform(info, RegionBasisCurrent, nil, nil)
+	assert.NoError(err)
+	assert.Nil(out.Meta)
+
+	_, err = parseRegionBasis("historical")
+	assert.Error(err)
+}
@@ -0,0 +1,174 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/residency"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// maximum number of declarations waiting to be evaluated
+const residencyQueueSize = 1000
+
+// observeResidencyCommit queues the residency declaration a processed commit makes or withdraws, if any. Drops it if the queue is full
+func (bgs *BGS) observeResidencyCommit(evt *comatproto.SyncSubscribeRepos_Commit) {
+	d, err := residency.ObserveCommit(evt)
+	if err != nil {
+		residencyDeclarationsCounter.WithLabelValues("invalid").Inc()
+		bgs.log.Info("ignoring invalid residency declaration", "did", evt.Repo, "seq", evt.Seq, "err", err)
+		return
+	}
+	if d == nil {
+		return
+	}
+	select {
+	case bgs.residencyQueue <- d:
+	default:
+		residencyDeclarationsCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+// runResidencyDeclarations is a worker evaluating queued declarations, until the context is cancelled
+func (bgs *BGS) runResidencyDeclarations(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-bgs.residencyQueue:
+			rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			_, err := bgs.applyResidencyDeclaration(rctx, d)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				residencyDeclarationsCounter.WithLabelValues("error").Inc()
+				bgs.log.Warn("failed to apply residency declaration", "did", d.DID, "err", err)
+			}
+		}
+	}
+}
+
+// applyResidencyDeclaration evaluates a declaration against the residency policy, classifying the account if the policy allows, and records it. A withdrawn declaration's classification is removed and the account resolved afresh. Returns the policy's result
+func (bgs *BGS) applyResidencyDeclaration(ctx context.Context, d *residency.Declaration) (string, error) {
+	var current *sovereignty.Classification
+	if c, ok := bgs.Classifications.Get(d.DID); ok {
+		current = &c
+	}
+	var resolved *sovereignty.Resolution
+	if !d.Withdrawn && bgs.residencyPolicy.Mode == residency.ModeCorroborate && bgs.countryResolver != nil {
+		res, err := sovereignty.Resolve(ctx, bgs.countryResolver, d.DID, countryResolverSource)
+		if err != nil && !errors.Is(err, sovereignty.ErrCountryUnknown) {
+			return "", err
+		}
+		resolved = res
+	}
+	now := bgs.clock.Now().UTC()
+	result, cl := bgs.residencyPolicy.Evaluate(d, current, resolved, now)
+
+	switch result {
+	case residency.ResultApplied:
+		if err := bgs.setClassification(ctx, *cl, cl.Confidence, false); err != nil {
+			return "", err
+		}
+		bgs.log.Info("classified account by its residency declaration", "did", d.DID, "country", d.Region(), "confidence", cl.Confidence)
+	case residency.ResultWithdrawn:
+		if current != nil && current.Source == residency.SourceDeclaration {
+			if err := bgs.DeleteClassification(ctx, d.DID); err != nil {
+				return "", err
+			}
+			bgs.log.Info("removed classification made by a withdrawn residency declaration", "did", d.DID, "country", current.Region())
+			bgs.enqueueCountryResolve(d.DID)
+		}
+	}
+
+	row := models.ResidencyDeclaration{
+		Did:         d.DID,
+		Country:     d.Country,
+		Subdivision: d.Subdivision,
+		DeclaredAt:  d.CreatedAt,
+		Result:      result,
+	}
+	row.UpdatedAt = now
+	cols := []string{"country", "subdivision", "declared_at", "result", "updated_at"}
+	if result == residency.ResultApplied {
+		row.AppliedAt = &now
+		cols = append(cols, "applied_at")
+	}
+	if err := bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns(cols),
+	}).Create(&row).Error; err != nil {
+		return result, err
+	}
+	residencyDeclarationsCounter.WithLabelValues(result).Inc()
+	return result, nil
+}
+
+type residencyDeclarationView struct {
+	DID         string     `json:"did"`
+	Country     string     `json:"country,omitempty"`
+	Subdivision string     `json:"subdivision,omitempty"`
+	DeclaredAt  time.Time  `json:"declaredAt,omitempty"`
+	Result      string     `json:"result"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+}
+
+type residencyDeclarationsResponse struct {
+	Declarations []residencyDeclarationView `json:"declarations"`
+	Cursor       string                     `json:"cursor,omitempty"`
+}
+
+// handleAdminResidencyDeclarations lists accounts' latest residency declarations, by DID, optionally only those with a given result
+func (bgs *BGS) handleAdminResidencyDeclarations(e echo.Context) error {
+	if bgs.residencyQueue == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "residency declarations are not enabled",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	q := bgs.db.WithContext(e.Request().Context()).Order("did").Limit(limit)
+	if result := e.QueryParam("result"); result != "" {
+		q = q.Where("result = ?", result)
+	}
+	if cursor := e.QueryParam("cursor"); cursor != "" {
+		q = q.Where("did > ?", cursor)
+	}
+	var rows []models.ResidencyDeclaration
+	if err := q.Find(&rows).Error; err != nil {
+		return err
+	}
+	out := residencyDeclarationsResponse{Declarations: make([]residencyDeclarationView, len(rows))}
+	for i, r := range rows {
+		out.Declarations[i] = residencyDeclarationView{
+			DID:         r.Did,
+			Country:     r.Country,
+			Subdivision: r.Subdivision,
+			DeclaredAt:  r.DeclaredAt.UTC(),
+			Result:      r.Result,
+			UpdatedAt:   r.UpdatedAt.UTC(),
+			AppliedAt:   r.AppliedAt,
+		}
+	}
+	if len(rows) == limit {
+		out.Cursor = rows[len(rows)-1].Did
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,90 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/residency"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResidencyDeclarations(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/declarations", "", b.handleAdminResidencyDeclarations)
+	assert.Error(err)
+
+	b.residencyPolicy = residency.DefaultPolicy()
+	b.residencyQueue = make(chan *residency.Declaration, residencyQueueSize)
+	places := map[string]string{"did:plc:here": "CA"}
+	b.countryResolver = sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		if c, ok := places[did]; ok {
+			return c, sovereignty.ConfidenceLow, nil
+		}
+		return "", sovereignty.ConfidenceNone, fmt.Errorf("%w: %s", sovereignty.ErrCountryUnknown, did)
+	})
+
+	result, err := b.applyResidencyDeclaration(ctx, &residency.Declaration{DID: "did:plc:here", Country: "CA", Subdivision: "QC"})
+	assert.NoError(err)
+	assert.Equal(residency.ResultApplied, result)
+	cl, ok := b.Classifications.Get("did:plc:here")
+	assert.True(ok)
+	assert.Equal("CA-QC", cl.Region())
+	assert.Equal(residency.SourceDeclaration, cl.Source)
+
+	result, err = b.applyResidencyDeclaration(ctx, &residency.Declaration{DID: "did:plc:nowhere", Country: "CA"})
+	assert.NoError(err)
+	assert.Equal(residency.ResultUnconfirmed, result)
+	_, ok = b.Classifications.Get("did:plc:nowhere")
+	assert.False(ok)
+
+	// an operator's classification stands
+	assert.NoError(b.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:set", Country: "US", Source: "admin"}))
+	places["did:plc:set"] = "CA"
+	result, err = b.applyResidencyDeclaration(ctx, &residency.Declaration{DID: "did:plc:set", Country: "CA"})
+	assert.NoError(err)
+	assert.Equal(residency.ResultOverridden, result)
+	cl, _ = b.Classifications.Get("did:plc:set")
+	assert.Equal("US", cl.Country)
+
+	rec, err := call("GET", "/admin/sovereignty/declarations?result=applied", "", b.handleAdminResidencyDeclarations)
+	assert.NoError(err)
+	var out residencyDeclarationsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	if assert.Len(out.Declarations, 1) {
+		assert.Equal("did:plc:here", out.Declarations[0].DID)
+		assert.NotNil(out.Declarations[0].AppliedAt)
+	}
+
+	// withdrawing the declaration removes the classification it made
+	result, err = b.applyResidencyDeclaration(ctx, &residency.Declaration{DID: "did:plc:here", Withdrawn: true})
+	assert.NoError(err)
+	assert.Equal(residency.ResultWithdrawn, result)
+	_, ok = b.Classifications.Get("did:plc:here")
+	assert.False(ok)
+
+	rec, err = call("GET", "/admin/sovereignty/declarations?limit=2", "", b.handleAdminResidencyDeclarations)
+	assert.NoError(err)
+	out = residencyDeclarationsResponse{}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Len(out.Declarations, 2)
+	assert.Equal("did:plc:nowhere", out.Cursor)
+	_, err = call("GET", "/admin/sovereignty/declarations?limit=0", "", b.handleAdminResidencyDeclarations)
+	assert.Error(err)
+}
@@ -0,0 +1,139 @@
+package bgs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+	"github.com/bluesky-social/indigo/sovereignty/resume"
+)
+
+// Error frame types sent to sovereign stream consumers whose resume token can't be honoured
+const (
+	ErrInvalidResumeToken  = "InvalidResumeToken"
+	ErrResumeEpochMismatch = "ResumeEpochMismatch"
+	ErrFilterConfigChanged = "FilterConfigChanged"
+)
+
+// resumeFilter returns the filter hash for a sovereign stream connection's resume tokens. It covers the policy, the subscriber's profile and the connection's regionBasis and collection parameters, so a token only resumes a stream shaped the way it was when the token was issued. The hash is recomputed when the policy or profile is replaced.
+func (bgs *BGS) resumeFilter(prof func() *profile.Profile, basis string, collections []string) func() uint64 {
+	collections = slices.Clone(collections)
+	slices.Sort(collections)
+	var (
+		lk       sync.Mutex
+		lastPol  *sovereignPolicy
+		lastProf *profile.Profile
+		hash     uint64
+	)
+	return func() uint64 {
+		lk.Lock()
+		defer lk.Unlock()
+		pol, p := bgs.policy.Load(), prof()
+		if pol != lastPol || p != lastProf {
+			lastPol, lastProf = pol, p
+			hash = streamFilterHash(pol.filterHash, p, basis, collections)
+		}
+		return hash
+	}
+}
+
+// streamFilterHash combines a policy's filter hash with a connection's stream parameters. A connection on the relay's default shape keeps the policy's hash, so its tokens match those issued before subscriber parameters were covered.
+func streamFilterHash(policyHash uint64, prof *profile.Profile, basis string, collections []string) uint64 {
+	if prof == nil && basis == "" && len(collections) == 0 {
+		return policyHash
+	}
+	var shape *profile.Profile
+	if prof != nil {
+		// the description doesn't change what the stream carries
+		p := *prof
+		p.Description = ""
+		shape = &p
+	}
+	buf, err := json.Marshal(struct {
+		Policy      uint64           `json:"policy"`
+		Profile     *profile.Profile `json:"profile,omitempty"`
+		RegionBasis string           `json:"regionBasis,omitempty"`
+		Collections []string         `json:"collections,omitempty"`
+	}{policyHash, shape, basis, collections})
+	if err != nil {
+		// not reachable for these types
+		panic(err)
+	}
+	sum := sha256.Sum256(buf)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// stampResumeToken attaches a resume token, under the connection's filter hash, to an outbound sovereign stream frame
+func (bgs *BGS) stampResumeToken(evt *events.XRPCStreamEvent, filter uint64) *events.XRPCStreamEvent {
+	seq, ok := evt.GetSequence()
+	if !ok {
+		return evt
+	}
+	out := *evt
+	out.Resume = bgs.resumeSigner.Issue(resume.Token{
+		Seq:    seq,
+		Epoch:  bgs.resumeEpoch,
+		Filter: filter,
+	})
+	// the header changed, so any cached encoding is stale
+	out.Preserialized = nil
+	return &out
+}
+
+// parseResumeCursor checks a reconnecting consumer's resume token against the connection's filter hash, returning the seq to resume after, or an error frame explaining what the consumer should do instead. Integer cursors can't be checked, so they are refused unless the relay is configured to accept them from consumers which predate resume tokens.
+func (bgs *BGS) parseResumeCursor(cursor string, filter uint64) (int64, *events.ErrorFrame) {
+	if seq, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+		if !bgs.resumeIntegerCursors {
+			resumeCursorChecks.WithLabelValues("integer_refused").Inc()
+			return 0, &events.ErrorFrame{
+				Error:   ErrInvalidResumeToken,
+				Message: "this relay only resumes from the resume tokens carried on its frames, not from sequence numbers; resume with the last token received, or reconnect without a cursor",
+			}
+		}
+		resumeCursorChecks.WithLabelValues("integer").Inc()
+		return seq, nil
+	}
+
+	tok, err := bgs.resumeSigner.Parse(cursor)
+	switch {
+	case errors.Is(err, resume.ErrMalformed):
+		resumeCursorChecks.WithLabelValues("malformed").Inc()
+		return 0, &events.ErrorFrame{
+			Error:   ErrInvalidResumeToken,
+			Message: "cursor is neither a sequence number nor a resume token; reconnect without a cursor to start from the live stream",
+		}
+	case err != nil:
+		resumeCursorChecks.WithLabelValues("invalid_mac").Inc()
+		return 0, &events.ErrorFrame{
+			Error:   ErrInvalidResumeToken,
+			Message: "resume token failed its integrity check: it was modified, or issued by another relay or under a rotated key; resume with a token received from this relay, or reconnect without a cursor",
+		}
+	}
+
+	if tok.Epoch != bgs.resumeEpoch {
+		resumeCursorChecks.WithLabelValues("epoch_mismatch").Inc()
+		return 0, &events.ErrorFrame{
+			Error:   ErrResumeEpochMismatch,
+			Message: fmt.Sprintf("resume token is from event log epoch %d, but the relay is now at epoch %d and its sequence numbers have started over; reconnect without a cursor and backfill anything missed from the repositories", tok.Epoch, bgs.resumeEpoch),
+		}
+	}
+
+	if tok.Filter != filter {
+		resumeCursorChecks.WithLabelValues("filter_changed").Inc()
+		fresh := bgs.resumeSigner.Issue(resume.Token{Seq: tok.Seq, Epoch: bgs.resumeEpoch, Filter: filter})
+		return 0, &events.ErrorFrame{
+			Error:   ErrFilterConfigChanged,
+			Message: fmt.Sprintf("the token was issued for a different stream configuration than this connection's (the relay's policy, now version %d, the subscriber's profile, or the regionBasis or collection parameters differ), so events from seq %d on are carried or transformed differently; to continue under this connection's configuration, resume with cursor=%s", bgs.policy.Load().doc.Version, tok.Seq, fresh),
+		}
+	}
+
+	resumeCursorChecks.WithLabelValues("ok").Inc()
+	return tok.Seq, nil
+}
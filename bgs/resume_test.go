@@ -0,0 +1,69 @@
+package bgs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+	"github.com/bluesky-social/indigo/sovereignty/resume"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeCursorChecks(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	signer, err := resume.NewSigner([]byte("resume-token-test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.resumeSigner = signer
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	assert.NoError(err)
+	b.policy.Store(pol)
+
+	research := &profile.Profile{Name: "research", Redaction: profile.RedactionRecords}
+	appview := &profile.Profile{Name: "appview", Annotations: profile.AnnotationsFull}
+	noProfile := func() *profile.Profile { return nil }
+	defaultFilter := b.resumeFilter(noProfile, "", nil)
+	researchFilter := b.resumeFilter(func() *profile.Profile { return research }, "", nil)
+	appviewFilter := b.resumeFilter(func() *profile.Profile { return appview }, "", nil)
+
+	// the default stream shape keeps the policy's hash
+	assert.Equal(pol.filterHash, defaultFilter())
+	assert.NotEqual(researchFilter(), appviewFilter())
+	assert.NotEqual(defaultFilter(), b.resumeFilter(noProfile, RegionBasisPersisted, nil)())
+	assert.NotEqual(defaultFilter(), b.resumeFilter(noProfile, "", []string{"app.bsky.feed.post"})())
+	assert.Equal(
+		b.resumeFilter(noProfile, "", []string{"app.bsky.feed.post", "app.bsky.feed.like"})(),
+		b.resumeFilter(noProfile, "", []string{"app.bsky.feed.like", "app.bsky.feed.post"})(),
+	)
+
+	// integer cursors skip the integrity check, so they are refused unless enabled
+	_, ef := b.parseResumeCursor("42", defaultFilter())
+	if assert.NotNil(ef) {
+		assert.Equal(ErrInvalidResumeToken, ef.Error)
+	}
+	b.resumeIntegerCursors = true
+	seq, ef := b.parseResumeCursor("42", defaultFilter())
+	assert.Nil(ef)
+	assert.Equal(int64(42), seq)
+
+	tok := signer.Issue(resume.Token{Seq: 7, Epoch: b.resumeEpoch, Filter: researchFilter()})
+	seq, ef = b.parseResumeCursor(tok, researchFilter())
+	assert.Nil(ef)
+	assert.Equal(int64(7), seq)
+
+	// a token issued under one profile doesn't resume under another
+	_, ef = b.parseResumeCursor(tok, appviewFilter())
+	if assert.NotNil(ef) {
+		assert.Equal(ErrFilterConfigChanged, ef.Error)
+		assert.Contains(ef.Message, fmt.Sprintf("cursor=%s", signer.Issue(resume.Token{Seq: 7, Epoch: b.resumeEpoch, Filter: appviewFilter()})))
+	}
+
+	// replacing the profile changes the hash
+	before := researchFilter()
+	research = &profile.Profile{Name: "research", Redaction: profile.RedactionStandard}
+	assert.NotEqual(before, researchFilter())
+}
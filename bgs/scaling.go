@@ -0,0 +1,156 @@
+package bgs
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+)
+
+// how often the autoscaling gauges are updated
+const scaleSampleInterval = 5 * time.Second
+
+// replicas are advised to scale down while the load of every signal is below this
+const scaleDownBelow = 0.5
+
+// weight of each new observation in the ingest lag's moving average
+const ingestLagWeight = 0.1
+
+// ingestLag is a moving average of how long after their PDS emitted them events are processed
+type ingestLag struct {
+	lk   sync.Mutex
+	avg  float64
+	seen bool
+}
+
+func (l *ingestLag) observe(lag time.Duration) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	// PDS clocks can run ahead of ours
+	s := max(lag.Seconds(), 0)
+	if !l.seen {
+		l.avg, l.seen = s, true
+		return
+	}
+	l.avg += ingestLagWeight * (s - l.avg)
+}
+
+func (l *ingestLag) seconds() float64 {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return l.avg
+}
+
+// observeIngestLag records the lag of a processed event, by the time its PDS stamped it with
+func (bgs *BGS) observeIngestLag(stamp string) {
+	t, err := syntax.ParseDatetimeTime(stamp)
+	if err != nil {
+		return
+	}
+	bgs.ingestLag.observe(bgs.clock.Since(t))
+}
+
+// ScaleTargets are the levels at which a relay replica counts as fully loaded, by each autoscaling signal. Zero leaves a signal out
+type ScaleTargets struct {
+	// moving average of how far behind their PDS events are processed
+	IngestLag time.Duration
+	// events handed to the persister and not yet broadcast; only reported by the disk persister
+	PersisterBacklog int64 `config:"min=0"`
+	// how full the fullest consumer's outgoing buffer is, from 0 to 1; consumers whose buffers fill are dropped
+	FanoutSaturation float64 `config:"min=0,max=1"`
+	// consumers connected to any stream
+	Subscribers int `config:"min=0"`
+}
+
+func DefaultScaleTargets() ScaleTargets {
+	return ScaleTargets{
+		IngestLag:        30 * time.Second,
+		PersisterBacklog: 5_000,
+		FanoutSaturation: 0.5,
+		Subscribers:      500,
+	}
+}
+
+type scaleSignal struct {
+	Value  float64 `json:"value"`
+	Target float64 `json:"target"`
+	// Value over Target: 1 when the replica is at capacity by this signal
+	Load float64 `json:"load"`
+}
+
+type scaleAdviceResponse struct {
+	// the highest load of any signal
+	Load float64 `json:"load"`
+	// "scale_up" above 1, "scale_down" below 0.5, otherwise "hold"
+	Advice string `json:"advice"`
+	// the limiting signal
+	Signal  string                 `json:"signal,omitempty"`
+	Signals map[string]scaleSignal `json:"signals"`
+}
+
+// scaleAdvice samples the autoscaling signals, normalizing each by its target
+func (bgs *BGS) scaleAdvice() scaleAdviceResponse {
+	out := scaleAdviceResponse{Signals: make(map[string]scaleSignal)}
+	add := func(name string, value, target float64) {
+		if target <= 0 {
+			return
+		}
+		s := scaleSignal{Value: value, Target: target, Load: value / target}
+		out.Signals[name] = s
+		if s.Load > out.Load || out.Signal == "" {
+			out.Load, out.Signal = s.Load, name
+		}
+	}
+	t := bgs.scaleTargets
+	add("ingest_lag", bgs.ingestLag.seconds(), t.IngestLag.Seconds())
+	if backlog, ok := bgs.events.PersisterBacklog(); ok {
+		add("persister_backlog", float64(backlog), float64(t.PersisterBacklog))
+	}
+	subs, saturation := bgs.events.Fanout()
+	add("fanout_saturation", saturation, t.FanoutSaturation)
+	add("subscribers", float64(subs), float64(t.Subscribers))
+
+	switch {
+	case out.Load > 1:
+		out.Advice = "scale_up"
+	case out.Load < scaleDownBelow:
+		out.Advice = "scale_down"
+	default:
+		out.Advice = "hold"
+	}
+	// rounded, so scalers comparing successive values aren't thrown by float noise
+	out.Load = math.Round(out.Load*1000) / 1000
+	return out
+}
+
+func (bgs *BGS) updateScaleGauges(a scaleAdviceResponse) {
+	for name, s := range a.Signals {
+		scaleSignalGauge.WithLabelValues(name).Set(s.Value)
+		scaleLoadGauge.WithLabelValues(name).Set(s.Load)
+	}
+	scaleLoadGauge.WithLabelValues("max").Set(a.Load)
+}
+
+// runScaleGauges updates the autoscaling gauges every scaleSampleInterval, until stopped
+func (bgs *BGS) runScaleGauges(stop <-chan struct{}) {
+	t := bgs.clock.NewTicker(scaleSampleInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C():
+			bgs.updateScaleGauges(bgs.scaleAdvice())
+		}
+	}
+}
+
+// handleScaleAdvice reports how loaded this replica is, for autoscalers (eg, a KEDA metrics-api scaler reading "load", with a target of 1)
+func (bgs *BGS) handleScaleAdvice(e echo.Context) error {
+	a := bgs.scaleAdvice()
+	bgs.updateScaleGauges(a)
+	return e.JSON(200, a)
+}
@@ -0,0 +1,61 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleAdvice(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	advise := func() scaleAdviceResponse {
+		req := httptest.NewRequest("GET", "/scale-advice", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(b.handleScaleAdvice(e.NewContext(req, rec)))
+		var out scaleAdviceResponse
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+		return out
+	}
+
+	// idle
+	a := advise()
+	assert.Equal("scale_down", a.Advice)
+	assert.Equal(0.0, a.Load)
+	assert.Contains(a.Signals, "ingest_lag")
+	assert.Contains(a.Signals, "subscribers")
+	// the in-memory persister doesn't report a backlog
+	assert.NotContains(a.Signals, "persister_backlog")
+
+	// events arriving a minute late, twice the default target
+	now := b.clock.Now()
+	for i := 0; i < 5; i++ {
+		b.observeIngestLag(now.Add(-time.Minute).UTC().Format(time.RFC3339Nano))
+	}
+	a = advise()
+	assert.Equal("scale_up", a.Advice)
+	assert.Equal("ingest_lag", a.Signal)
+	assert.InDelta(2.0, a.Load, 0.01)
+
+	// the average moves towards the current lag
+	b.observeIngestLag(now.UTC().Format(time.RFC3339Nano))
+	assert.Less(advise().Signals["ingest_lag"].Load, 2.0)
+
+	// consumers are counted against their target
+	b.scaleTargets = ScaleTargets{Subscribers: 2}
+	_, cancel, err := b.events.Subscribe(context.Background(), "test", nil, nil)
+	assert.NoError(err)
+	defer cancel()
+	a = advise()
+	assert.Equal("hold", a.Advice)
+	assert.Equal("subscribers", a.Signal)
+	assert.Equal(0.5, a.Load)
+	assert.Len(a.Signals, 1)
+}
@@ -0,0 +1,394 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/time/rate"
+)
+
+// ShardScrubber is a carstore whose shards can be verified against their CIDs and repaired from intact copies of their blocks. carstore.FileCarStore implements it.
+type ShardScrubber interface {
+	ListShards(ctx context.Context, after uint, limit int) ([]carstore.CarShard, error)
+	VerifyShard(ctx context.Context, sh *carstore.CarShard) (*carstore.ShardCheck, error)
+	RepairShard(ctx context.Context, sh *carstore.CarShard, good map[cid.Cid]blockformat.Block) (int, error)
+}
+
+// ScrubFinding is a damaged shard found by the scrubber
+type ScrubFinding struct {
+	Shard         uint       `json:"shard"`
+	Uid           models.Uid `json:"uid"`
+	Path          string     `json:"path"`
+	CorruptBlocks int        `json:"corruptBlocks"`
+	BadHeader     bool       `json:"badHeader,omitempty"`
+	Unreadable    bool       `json:"unreadable,omitempty"`
+	// repaired, unrecoverable or failed; empty when repairs are disabled
+	Repair string `json:"repair,omitempty"`
+	// where the intact blocks came from
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ScrubReport summarizes a pass of the scrubber over every stored shard
+type ScrubReport struct {
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Shards   int            `json:"shards"`
+	Blocks   int            `json:"blocks"`
+	Corrupt  []ScrubFinding `json:"corrupt"`
+	// findings beyond maxScrubFindings are counted, but not listed
+	Omitted int    `json:"omitted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+const maxScrubFindings = 1000
+
+type ScrubberOptions struct {
+	// time between the end of one pass and the start of the next
+	Interval time.Duration
+	// shards verified per second; 0 is unlimited
+	Rate float64
+	// shards listed per database query
+	BatchSize int
+}
+
+func DefaultScrubberOptions() *ScrubberOptions {
+	return &ScrubberOptions{
+		Interval:  24 * time.Hour,
+		Rate:      50,
+		BatchSize: 1000,
+	}
+}
+
+// ShardRepairer restores a damaged shard, returning where the intact blocks came from
+type ShardRepairer func(ctx context.Context, sh *carstore.CarShard) (string, error)
+
+// Scrubber periodically re-hashes every block in the carstore against its CID, to catch bit rot before the only copy of a repo is lost. Damaged shards are reported, and repaired if a repairer is set.
+type Scrubber struct {
+	store   ShardScrubber
+	repair  ShardRepairer
+	limiter *rate.Limiter
+
+	interval  time.Duration
+	batchSize int
+
+	lk      sync.Mutex
+	current *ScrubReport
+	last    *ScrubReport
+
+	trigger chan struct{}
+	exit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewScrubber(store ShardScrubber, repair ShardRepairer, opts *ScrubberOptions) *Scrubber {
+	if opts == nil {
+		opts = DefaultScrubberOptions()
+	}
+	lim := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		lim = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	return &Scrubber{
+		store:     store,
+		repair:    repair,
+		limiter:   lim,
+		interval:  opts.Interval,
+		batchSize: max(opts.BatchSize, 1),
+		trigger:   make(chan struct{}, 1),
+		exit:      make(chan struct{}),
+	}
+}
+
+// Start runs a pass every interval, or when triggered
+func (s *Scrubber) Start() {
+	log.Info("starting scrubber", "interval", s.interval, "repair", s.repair != nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.exit
+		cancel()
+	}()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTimer(s.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.exit:
+				return
+			case <-t.C:
+			case <-s.trigger:
+				t.Stop()
+			}
+			s.run(ctx)
+			t.Reset(s.interval)
+		}
+	}()
+}
+
+// Shutdown stops the scrubber, abandoning any pass in progress
+func (s *Scrubber) Shutdown() {
+	log.Info("stopping scrubber")
+	close(s.exit)
+	s.wg.Wait()
+	log.Info("scrubber stopped")
+}
+
+// Trigger starts a pass now, unless one is already running. Returns false if it is
+func (s *Scrubber) Trigger() bool {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.current != nil {
+		return false
+	}
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Reports returns the pass in progress, if any, and the last completed one
+func (s *Scrubber) Reports() (*ScrubReport, *ScrubReport) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var cur *ScrubReport
+	if s.current != nil {
+		c := *s.current
+		c.Corrupt = append([]ScrubFinding(nil), s.current.Corrupt...)
+		cur = &c
+	}
+	return cur, s.last
+}
+
+func (s *Scrubber) run(ctx context.Context) {
+	ctx, span := otel.Tracer("scrubber").Start(ctx, "ScrubPass")
+	defer span.End()
+
+	rep := &ScrubReport{Started: time.Now()}
+	s.lk.Lock()
+	s.current = rep
+	s.lk.Unlock()
+
+	err := s.scrubAll(ctx, rep)
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	now := time.Now()
+	rep.Finished = &now
+	if err != nil {
+		rep.Error = err.Error()
+		log.Error("scrub pass failed", "err", err, "shards", rep.Shards)
+	} else {
+		scrubCorruptShards.Set(float64(len(rep.Corrupt) + rep.Omitted))
+		scrubLastPass.SetToCurrentTime()
+		log.Info("scrub pass complete", "shards", rep.Shards, "blocks", rep.Blocks, "corrupt", len(rep.Corrupt)+rep.Omitted, "duration", now.Sub(rep.Started))
+	}
+	s.current = nil
+	s.last = rep
+}
+
+func (s *Scrubber) scrubAll(ctx context.Context, rep *ScrubReport) error {
+	var after uint
+	for {
+		shards, err := s.store.ListShards(ctx, after, s.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(shards) == 0 {
+			return nil
+		}
+		for i := range shards {
+			sh := &shards[i]
+			after = sh.ID
+			if err := s.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			check, err := s.store.VerifyShard(ctx, sh)
+			if err != nil {
+				return fmt.Errorf("verifying shard %d: %w", sh.ID, err)
+			}
+			scrubShardsChecked.Inc()
+
+			f := s.handleCheck(ctx, check)
+			s.lk.Lock()
+			rep.Shards++
+			rep.Blocks += check.Blocks
+			if f != nil {
+				if len(rep.Corrupt) < maxScrubFindings {
+					rep.Corrupt = append(rep.Corrupt, *f)
+				} else {
+					rep.Omitted++
+				}
+			}
+			s.lk.Unlock()
+		}
+	}
+}
+
+// handleCheck reports, and tries to repair, a damaged shard. Returns nil for a clean one
+func (s *Scrubber) handleCheck(ctx context.Context, check *carstore.ShardCheck) *ScrubFinding {
+	if check.OK() {
+		return nil
+	}
+	sh := &check.Shard
+	scrubCorruptBlocks.Add(float64(len(check.Corrupt)))
+	f := &ScrubFinding{
+		Shard:         sh.ID,
+		Uid:           sh.Usr,
+		Path:          sh.Path,
+		CorruptBlocks: len(check.Corrupt),
+		BadHeader:     check.BadHeader,
+		Unreadable:    check.Unreadable,
+	}
+	log.Warn("corrupt shard", "shard", sh.ID, "uid", sh.Usr, "path", sh.Path, "corrupt", len(check.Corrupt), "blocks", check.Blocks, "unreadable", check.Unreadable)
+	if s.repair == nil {
+		return f
+	}
+
+	src, err := s.repair(ctx, sh)
+	switch {
+	case err == nil:
+		f.Repair = "repaired"
+		f.Source = src
+		log.Info("repaired corrupt shard", "shard", sh.ID, "uid", sh.Usr, "source", src)
+	case errors.Is(err, carstore.ErrUnrecoverable):
+		f.Repair = "unrecoverable"
+		f.Error = err.Error()
+		log.Error("corrupt shard is unrecoverable", "shard", sh.ID, "uid", sh.Usr, "err", err)
+	default:
+		f.Repair = "failed"
+		f.Error = err.Error()
+		log.Error("failed to repair corrupt shard", "shard", sh.ID, "uid", sh.Usr, "err", err)
+	}
+	scrubRepairs.WithLabelValues(f.Repair).Inc()
+	return f
+}
+
+// repairShard restores a damaged shard from the account's current repo, fetched from its PDS, falling back to each peer relay in turn. Blocks from earlier sources are kept, so a repair can draw on several.
+func (bgs *BGS) repairShard(ctx context.Context, sh *carstore.CarShard) (string, error) {
+	u, err := bgs.lookupUserByUID(ctx, sh.Usr)
+	if err != nil {
+		return "", fmt.Errorf("looking up account: %w", err)
+	}
+
+	type source struct {
+		name string
+		c    *xrpc.Client
+	}
+	var sources []source
+	var pds models.PDS
+	if err := bgs.db.WithContext(ctx).First(&pds, "id = ?", u.PDS).Error; err == nil {
+		sources = append(sources, source{name: pds.Host, c: bgs.pdsClient(&pds)})
+	}
+	for _, p := range bgs.scrubPeers {
+		c := &xrpc.Client{Host: strings.TrimSuffix(p, "/")}
+		// peers serve whole repos, as large hosts do
+		bgs.httpClients.ApplyXRPC(httpprofile.Bulk, c)
+		sources = append(sources, source{name: p, c: c})
+	}
+	if len(sources) == 0 {
+		return "", fmt.Errorf("%w: no origin PDS or peer to fetch %s from", carstore.ErrUnrecoverable, u.Did)
+	}
+
+	good := make(map[cid.Cid]blockformat.Block)
+	var lastErr error
+	for _, src := range sources {
+		fctx, cancel := context.WithTimeout(ctx, time.Minute)
+		b, err := comatproto.SyncGetRepo(fctx, src.c, u.Did, "")
+		cancel()
+		if err != nil {
+			log.Warn("failed to fetch repo for shard repair", "did", u.Did, "source", src.name, "err", err)
+			lastErr = err
+			continue
+		}
+		if err := readCarBlocksInto(bytes.NewReader(b), good); err != nil {
+			log.Warn("bad repo from shard repair source", "did", u.Did, "source", src.name, "err", err)
+			lastErr = err
+			continue
+		}
+		_, err = bgs.scrubStore.RepairShard(ctx, sh, good)
+		if err == nil {
+			return src.name, nil
+		}
+		lastErr = err
+		if !errors.Is(err, carstore.ErrUnrecoverable) {
+			return "", err
+		}
+	}
+	if !errors.Is(lastErr, carstore.ErrUnrecoverable) {
+		// couldn't find out what the sources had
+		return "", fmt.Errorf("fetching %s: %w", u.Did, lastErr)
+	}
+	return "", lastErr
+}
+
+func readCarBlocksInto(r io.Reader, out map[cid.Cid]blockformat.Block) error {
+	cr, err := car.NewCarReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out[blk.Cid()] = blk
+	}
+}
+
+// handleAdminScrubStatus returns the scrub pass in progress, if any, and the last completed one
+func (bgs *BGS) handleAdminScrubStatus(e echo.Context) error {
+	if bgs.scrubber == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "integrity scrubbing is not enabled",
+		}
+	}
+	cur, last := bgs.scrubber.Reports()
+	return e.JSON(200, map[string]any{
+		"running": cur,
+		"last":    last,
+	})
+}
+
+// handleAdminStartScrub starts a scrub pass now, rather than waiting for the next scheduled one
+func (bgs *BGS) handleAdminStartScrub(e echo.Context) error {
+	if bgs.scrubber == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "integrity scrubbing is not enabled",
+		}
+	}
+	if !bgs.scrubber.Trigger() {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: "a scrub pass is already running",
+		}
+	}
+	bgs.log.Info("scrub pass requested", "remote_ip", e.RealIP())
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
@@ -0,0 +1,78 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/carstore"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeScrubStore has shards 1 through n, of which those in corrupt fail verification
+type fakeScrubStore struct {
+	n       uint
+	corrupt map[uint]bool
+}
+
+func (fs *fakeScrubStore) ListShards(ctx context.Context, after uint, limit int) ([]carstore.CarShard, error) {
+	var out []carstore.CarShard
+	for id := after + 1; id <= fs.n && len(out) < limit; id++ {
+		out = append(out, carstore.CarShard{ID: id, Usr: 7})
+	}
+	return out, nil
+}
+
+func (fs *fakeScrubStore) VerifyShard(ctx context.Context, sh *carstore.CarShard) (*carstore.ShardCheck, error) {
+	check := &carstore.ShardCheck{Shard: *sh, Blocks: 3}
+	if fs.corrupt[sh.ID] {
+		check.Corrupt = []cid.Cid{cid.Undef}
+	}
+	return check, nil
+}
+
+func (fs *fakeScrubStore) RepairShard(ctx context.Context, sh *carstore.CarShard, good map[cid.Cid]blockformat.Block) (int, error) {
+	return 0, fmt.Errorf("not used")
+}
+
+func TestScrubberPass(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := &fakeScrubStore{n: 5, corrupt: map[uint]bool{2: true, 4: true, 5: true}}
+	repair := func(ctx context.Context, sh *carstore.CarShard) (string, error) {
+		switch sh.ID {
+		case 2:
+			return "pds.example.com", nil
+		case 4:
+			return "", fmt.Errorf("shard 4: %w: 1 of 3", carstore.ErrUnrecoverable)
+		default:
+			return "", fmt.Errorf("connection refused")
+		}
+	}
+	s := NewScrubber(store, repair, &ScrubberOptions{BatchSize: 2})
+
+	s.run(ctx)
+	cur, last := s.Reports()
+	assert.Nil(cur)
+	assert.NotNil(last.Finished)
+	assert.Empty(last.Error)
+	assert.Equal(5, last.Shards)
+	assert.Equal(15, last.Blocks)
+	if assert.Len(last.Corrupt, 3) {
+		assert.Equal("repaired", last.Corrupt[0].Repair)
+		assert.Equal("pds.example.com", last.Corrupt[0].Source)
+		assert.Equal("unrecoverable", last.Corrupt[1].Repair)
+		assert.Equal("failed", last.Corrupt[2].Repair)
+	}
+
+	// without a repairer, damage is only reported
+	s = NewScrubber(store, nil, nil)
+	s.run(ctx)
+	_, last = s.Reports()
+	assert.Len(last.Corrupt, 3)
+	assert.Empty(last.Corrupt[0].Repair)
+}
@@ -0,0 +1,189 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	comatprototypes "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/selfrepo"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+
+	"github.com/labstack/echo/v4"
+)
+
+// isSelfRepo returns true if the DID is the relay's own repo
+func (bgs *BGS) isSelfRepo(did string) bool {
+	return bgs.selfRepo != nil && did == bgs.selfRepo.DID().String()
+}
+
+// runSelfRepoStatus refreshes the status record in the relay's own repo until the context is cancelled
+func (bgs *BGS) runSelfRepoStatus(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		rec := selfrepo.StatusRecord(bgs.sovereignHealth(), bgs.policy.Load().doc.StreamCountries)
+		if _, err := bgs.selfRepo.Put(ctx, selfrepo.StatusCollection, selfrepo.StatusRKey, rec); err != nil {
+			bgs.log.Warn("failed to publish relay status record", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// announcePolicy records an applied policy document in the relay's own repo
+func (bgs *BGS) announcePolicy(ctx context.Context, doc *policy.Document, token string) {
+	if _, _, err := bgs.selfRepo.Create(ctx, selfrepo.PolicyCollection, selfrepo.PolicyRecord(doc, token)); err != nil {
+		bgs.log.Error("failed to publish policy record", "version", doc.Version, "err", err)
+	}
+}
+
+// announceSnapshot records a published classification snapshot in the relay's own repo
+func (bgs *BGS) announceSnapshot(m *snapshot.Manifest) {
+	var baseURL string
+	if bgs.snapshotDir != "" {
+		baseURL = "https://" + bgs.sovereignHostname + "/sovereignty/snapshots"
+	}
+	if _, _, err := bgs.selfRepo.Create(context.Background(), selfrepo.SnapshotCollection, selfrepo.SnapshotRecord(m, baseURL)); err != nil {
+		bgs.log.Error("failed to publish snapshot record", "generation", m.Generation, "err", err)
+	}
+}
+
+func (bgs *BGS) selfRepoCAR(ctx context.Context) (io.Reader, error) {
+	buf := new(bytes.Buffer)
+	if err := bgs.selfRepo.WriteCAR(ctx, buf); err != nil {
+		if errors.Is(err, selfrepo.ErrNotFound) {
+			return nil, echo.NewHTTPError(404, "relay repo has no commits yet")
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (bgs *BGS) selfRepoLatestCommit() (*comatprototypes.SyncGetLatestCommit_Output, error) {
+	head, rev := bgs.selfRepo.Head()
+	if !head.Defined() {
+		return nil, echo.NewHTTPError(404, "relay repo has no commits yet")
+	}
+	return &comatprototypes.SyncGetLatestCommit_Output{
+		Cid: head.String(),
+		Rev: rev,
+	}, nil
+}
+
+func (bgs *BGS) handleSelfDIDDocument(e echo.Context) error {
+	pub, err := bgs.selfRepo.PublicKey()
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, selfrepo.DIDDocument(bgs.sovereignHostname, pub))
+}
+
+func (bgs *BGS) handleSelfAtprotoDID(e echo.Context) error {
+	return e.String(200, bgs.selfRepo.DID().String())
+}
+
+type selfRecordView struct {
+	Uri   string         `json:"uri"`
+	Cid   string         `json:"cid"`
+	Value map[string]any `json:"value"`
+}
+
+// selfRepoParams validates the repo and collection parameters, which must name the relay's own repo
+func (bgs *BGS) selfRepoParams(e echo.Context) (syntax.NSID, error) {
+	repo := e.QueryParam("repo")
+	if repo != bgs.selfRepo.DID().String() && repo != bgs.sovereignHostname {
+		return "", &echo.HTTPError{
+			Code:    400,
+			Message: "this relay only hosts its own repo",
+		}
+	}
+	collection, err := syntax.ParseNSID(e.QueryParam("collection"))
+	if err != nil {
+		return "", &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid collection: %s", err),
+		}
+	}
+	return collection, nil
+}
+
+func (bgs *BGS) handleSelfGetRecord(e echo.Context) error {
+	collection, err := bgs.selfRepoParams(e)
+	if err != nil {
+		return err
+	}
+	rkey, err := syntax.ParseRecordKey(e.QueryParam("rkey"))
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid rkey: %s", err),
+		}
+	}
+	c, raw, err := bgs.selfRepo.GetRecord(e.Request().Context(), collection, rkey)
+	if errors.Is(err, selfrepo.ErrNotFound) {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "record not found",
+		}
+	}
+	if err != nil {
+		return err
+	}
+	val, err := data.UnmarshalCBOR(raw)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, selfRecordView{
+		Uri:   fmt.Sprintf("at://%s/%s/%s", bgs.selfRepo.DID(), collection, rkey),
+		Cid:   c.String(),
+		Value: val,
+	})
+}
+
+func (bgs *BGS) handleSelfListRecords(e echo.Context) error {
+	collection, err := bgs.selfRepoParams(e)
+	if err != nil {
+		return err
+	}
+	limit := 50
+	if l := e.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 100 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 100)",
+			}
+		}
+	}
+	entries, err := bgs.selfRepo.List(e.Request().Context(), collection, e.QueryParam("cursor"), limit)
+	if err != nil {
+		return err
+	}
+	out := struct {
+		Records []selfRecordView `json:"records"`
+		Cursor  *string          `json:"cursor,omitempty"`
+	}{Records: []selfRecordView{}}
+	for _, ent := range entries {
+		out.Records = append(out.Records, selfRecordView{
+			Uri:   fmt.Sprintf("at://%s/%s/%s", bgs.selfRepo.DID(), collection, ent.RKey),
+			Cid:   ent.CID.String(),
+			Value: ent.Value,
+		})
+	}
+	if len(entries) == limit {
+		cur := entries[len(entries)-1].RKey.String()
+		out.Cursor = &cur
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,56 @@
+package bgs
+
+import (
+	"strconv"
+
+	"github.com/bluesky-social/indigo/events/sequencer"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SetSequencer registers the sequencer allocating the output stream's sequence numbers, for the /admin/sequencer endpoint. Must be called before the relay starts serving.
+func (bgs *BGS) SetSequencer(s *sequencer.Sequencer) {
+	bgs.sequencer = s
+}
+
+type sequencerResponse struct {
+	sequencer.Status
+	Gaps []sequencer.Gap `json:"gaps"`
+}
+
+// handleAdminSequencer reports which holder is allocating sequence numbers, and the ranges skipped after restarts and failovers, oldest first from ?after
+func (bgs *BGS) handleAdminSequencer(e echo.Context) error {
+	if bgs.sequencer == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "the sequencer is only used by the disk persister",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	var after int64
+	if a := e.QueryParam("after"); a != "" {
+		v, err := strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "after must be a sequence number",
+			}
+		}
+		after = v
+	}
+	gaps, err := bgs.sequencer.Gaps(e.Request().Context(), after, limit)
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, sequencerResponse{Status: bgs.sequencer.Status(), Gaps: gaps})
+}
@@ -0,0 +1,64 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/events/sequencer"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminSequencer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(target string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		return rec, b.handleAdminSequencer(e.NewContext(req, rec))
+	}
+	_, err := call("/admin/sequencer")
+	assert.Error(err)
+
+	alloc, err := sequencer.NewDBAllocator(b.db, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sequencer.New(alloc, sequencer.Options{Holder: "relay-a", BlockSize: 10})
+	_, err = s.Start(ctx, 0)
+	assert.NoError(err)
+	_, err = s.Next(ctx)
+	assert.NoError(err)
+
+	// relay-b takes over with nothing in its log
+	s = sequencer.New(alloc, sequencer.Options{Holder: "relay-b", BlockSize: 10})
+	_, err = s.Start(ctx, 0)
+	assert.NoError(err)
+	b.SetSequencer(s)
+
+	rec, err := call("/admin/sequencer")
+	assert.NoError(err)
+	var resp sequencerResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal("relay-b", resp.Holder)
+	assert.Equal(int64(11), resp.Next)
+	assert.True(resp.Active)
+	if assert.Len(resp.Gaps, 1) {
+		assert.Equal(int64(1), resp.Gaps[0].First)
+		assert.Equal(int64(10), resp.Gaps[0].Last)
+		assert.Equal(sequencer.GapFailover, resp.Gaps[0].Reason)
+	}
+
+	rec, err = call("/admin/sequencer?after=10")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Empty(resp.Gaps)
+	_, err = call("/admin/sequencer?after=x")
+	assert.Error(err)
+}
@@ -0,0 +1,112 @@
+package bgs
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/shadow"
+
+	"github.com/labstack/echo/v4"
+)
+
+// runShadowFilter evaluates the sovereign stream filter on every event broadcast while the shadow-filtering flag is on, until the context is cancelled. It subscribes to the event manager only to see each event once, whoever is connected, and never queues any.
+func (bgs *BGS) runShadowFilter(ctx context.Context) {
+	_, cleanup, err := bgs.events.Subscribe(ctx, "shadow", func(evt *events.XRPCStreamEvent) bool {
+		if bgs.features.Enabled(features.ShadowFiltering) {
+			bgs.shadowEvaluate(evt)
+		}
+		return false
+	}, nil)
+	if err != nil {
+		bgs.log.Error("failed to subscribe the shadow filter to events", "err", err)
+		return
+	}
+	defer cleanup()
+	<-ctx.Done()
+}
+
+// shadowEvaluate records what the sovereign stream filter would do with an event, for the relay's default shape
+func (bgs *BGS) shadowEvaluate(evt *events.XRPCStreamEvent) {
+	kind := eventKind(evt)
+	if kind == "" {
+		// info and error frames are always carried
+		return
+	}
+	r := bgs.evaluateFilter(evt, nil)
+	result := filterResultLabel(r)
+	shadowFilterResults.WithLabelValues(result, r.Confidence.String(), r.Reason, bgs.filterCountryLabel(evt)).Inc()
+	if bgs.shadowLog == nil {
+		return
+	}
+	seq, _ := evt.GetSequence()
+	bgs.shadowLog.Record(shadow.Decision{
+		Time:       bgs.clock.Now().UTC(),
+		Seq:        seq,
+		DID:        eventDID(evt),
+		Kind:       kind,
+		Result:     result,
+		Confidence: r.Confidence.String(),
+		Reason:     r.Reason,
+	})
+}
+
+// eventKind names the type of an event tied to an account, or returns empty string for other events
+func eventKind(evt *events.XRPCStreamEvent) string {
+	switch {
+	case evt.RepoCommit != nil:
+		return "commit"
+	case evt.RepoSync != nil:
+		return "sync"
+	case evt.RepoIdentity != nil:
+		return "identity"
+	case evt.RepoAccount != nil:
+		return "account"
+	default:
+		return ""
+	}
+}
+
+type shadowDecisionsResponse struct {
+	// whether shadow mode is on now; the log keeps decisions from earlier periods it was on
+	Enabled bool `json:"enabled"`
+	// decisions sampled since the relay started, including those no longer kept
+	Sampled   int64             `json:"sampled"`
+	Decisions []shadow.Decision `json:"decisions"`
+}
+
+// handleAdminShadowDecisions lists the most recent sampled decisions of shadow mode, newest first, optionally only those with a result
+func (bgs *BGS) handleAdminShadowDecisions(e echo.Context) error {
+	if bgs.shadowLog == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "shadow decision logging is not enabled",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+	result := e.QueryParam("result")
+	switch result {
+	case "", shadow.ResultInclude, shadow.ResultHashOnly, shadow.ResultExclude:
+	default:
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "result must be include, hash_only or exclude",
+		}
+	}
+	return e.JSON(200, shadowDecisionsResponse{
+		Enabled:   bgs.features.Enabled(features.ShadowFiltering),
+		Sampled:   bgs.shadowLog.Sampled(),
+		Decisions: bgs.shadowLog.Recent(limit, result),
+	})
+}
@@ -0,0 +1,90 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/shadow"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowFiltering(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(target string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		return rec, b.handleAdminShadowDecisions(e.NewContext(req, rec))
+	}
+	b.shadowLog = nil
+	_, err := call("/admin/sovereignty/shadow")
+	assert.Error(err)
+
+	pol, err := b.newSovereignPolicy(&policy.Document{StreamCountries: []string{"CA"}})
+	assert.NoError(err)
+	b.policy.Store(pol)
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "admin"})
+	b.Classifications.Set(sovereignty.Classification{DID: "did:plc:bbb", Country: "US", Source: "admin"})
+	identity := func(seq int64, did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Seq: seq, Did: did}}
+	}
+
+	// enforcing
+	assert.False(b.sovereignFilter(identity(1, "did:plc:bbb"), nil).Include)
+
+	flags, err := features.NewSet(map[string]bool{"shadow-filtering": true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.features = flags
+	b.shadowLog = shadow.NewLog(shadow.Options{Size: 10, SampleRate: 1})
+
+	// the stream carries everything, while the decisions are recorded
+	r := b.sovereignFilter(identity(2, "did:plc:bbb"), nil)
+	assert.True(r.Include)
+	assert.Equal(sovereignty.FilterReasonShadow, r.Reason)
+	b.shadowEvaluate(identity(2, "did:plc:bbb"))
+	b.shadowEvaluate(identity(3, "did:plc:aaa"))
+	b.shadowEvaluate(&events.XRPCStreamEvent{Error: &events.ErrorFrame{Error: "oops"}})
+
+	rec, err := call("/admin/sovereignty/shadow")
+	assert.NoError(err)
+	var resp shadowDecisionsResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(resp.Enabled)
+	assert.Equal(int64(2), resp.Sampled)
+	if assert.Len(resp.Decisions, 2) {
+		assert.Equal(int64(3), resp.Decisions[0].Seq)
+		assert.Equal(shadow.ResultInclude, resp.Decisions[0].Result)
+		assert.Equal("did:plc:bbb", resp.Decisions[1].DID)
+		assert.Equal("identity", resp.Decisions[1].Kind)
+		assert.Equal(shadow.ResultExclude, resp.Decisions[1].Result)
+		assert.Equal(sovereignty.FilterReasonOtherCountry, resp.Decisions[1].Reason)
+	}
+
+	rec, err = call("/admin/sovereignty/shadow?result=exclude")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	if assert.Len(resp.Decisions, 1) {
+		assert.Equal(int64(2), resp.Decisions[0].Seq)
+	}
+	_, err = call("/admin/sovereignty/shadow?result=maybe")
+	assert.Error(err)
+	_, err = call("/admin/sovereignty/shadow?limit=0")
+	assert.Error(err)
+
+	// back to enforcing
+	assert.NoError(flags.Override(context.Background(), features.ShadowFiltering, false))
+	assert.False(b.sovereignFilter(identity(4, "did:plc:bbb"), nil).Include)
+}
@@ -0,0 +1,1514 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/auth"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/diskpersist"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/blobs"
+	"github.com/bluesky-social/indigo/sovereignty/egress"
+	"github.com/bluesky-social/indigo/sovereignty/enrich"
+	"github.com/bluesky-social/indigo/sovereignty/extension"
+	"github.com/bluesky-social/indigo/sovereignty/failover"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/filterplugin"
+	"github.com/bluesky-social/indigo/sovereignty/handlecheck"
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+	"github.com/bluesky-social/indigo/sovereignty/indigenous"
+	"github.com/bluesky-social/indigo/sovereignty/langfilter"
+	"github.com/bluesky-social/indigo/sovereignty/langstats"
+	"github.com/bluesky-social/indigo/sovereignty/lexcheck"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
+	"github.com/bluesky-social/indigo/sovereignty/namespaces"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/sovereignty/peering"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
+	"github.com/bluesky-social/indigo/sovereignty/plcorigin"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/prescreen"
+	"github.com/bluesky-social/indigo/sovereignty/profile"
+	"github.com/bluesky-social/indigo/sovereignty/residency"
+	"github.com/bluesky-social/indigo/sovereignty/resume"
+	"github.com/bluesky-social/indigo/sovereignty/selfrepo"
+	"github.com/bluesky-social/indigo/sovereignty/shadow"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+	"github.com/bluesky-social/indigo/sovereignty/talkers"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+	"github.com/bluesky-social/indigo/sovereignty/verify"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+)
+
+// SovereignConfig holds configuration for the relay's data sovereignty features.
+type SovereignConfig struct {
+	// local directory to publish snapshots to, and serve them from; empty disables
+	SnapshotDir string
+	// if set, upload snapshots here with HTTP PUT instead of using SnapshotDir
+	SnapshotUploadURL  string
+	SnapshotInterval   time.Duration
+	SnapshotMaxDiffs   int `config:"min=0"`
+	SnapshotSigningKey crypto.PrivateKey
+	// public hostname of this relay, as known to peers
+	Hostname string
+	// base URLs of cooperating relays to exchange health beacons with
+	Peers           []string
+	PeeringInterval time.Duration
+	// base URLs of relays consumers may fail over to, advertised in describeServer and in shutdown error frames
+	Alternates []string
+	// countries whose accounts are carried on the sovereign stream; empty disables the stream, unless StreamSubdivisions or ExcludeCountries is set
+	StreamCountries []string
+	// ISO 3166-2 subdivisions (eg, "CA-QC") whose accounts are carried on the sovereign stream, for provincial or territorial deployments; accounts are carried if their country is in StreamCountries, or their classified subdivision is in StreamSubdivisions
+	StreamSubdivisions []string
+	// countries whose accounts are left out of the sovereign stream, for deployments dropping traffic from some jurisdictions rather than carrying one: every other account is carried, including those not yet classified, and FilterMode doesn't apply. Can't be combined with StreamCountries or StreamSubdivisions
+	ExcludeCountries []string
+	// outbound transformation rules for the sovereign stream; requires SnapshotSigningKey, which also signs frame metadata
+	TransformRules []transform.Rule
+	// rules restricting which countries' subscribers receive records of some collections in full, the rest getting them withheld; subscribers are located by PDSGeoRanges and PDSGeoIPDatabase, one of which is required
+	EgressRules []egress.Rule
+	// NSIDs of collections, or namespaces ending in ".*" (eg, "app.gndr.*"), whose records the sovereign stream carries; empty carries all but those of NamespaceBlocklist. Commits are judged by their op paths: those touching only other collections are left out, and in the rest the other records' blocks are withheld
+	NamespaceAllowlist []string
+	// collections or namespaces whose records the sovereign stream doesn't carry, applied over NamespaceAllowlist
+	NamespaceBlocklist []string
+	// how commits are judged by the languages their posts declare (see the langfilter package): "require" leaves out those whose posts declare none of LanguageFilterLangs, "prefer" carries those whose posts declare one of them whatever the account's classification. Empty disables
+	LanguageFilter string
+	// BCP-47 language tags the language filter looks for, each matching the tags equal to it or extending it
+	LanguageFilterLangs []string
+	// posts declaring no languages count as declaring one of LanguageFilterLangs
+	LanguageFilterKeepUndeclared bool
+	// stricter handling of accounts flagged as minors; nil disables
+	MinorPolicy *minors.Policy
+	// how residency declarations (app.gndr.sovereign.residencyDeclaration records) in accounts' repos are verified before classifying them; nil ignores declarations
+	ResidencyPolicy *residency.Policy
+	// annotate posts in Indigenous languages on the sovereign stream
+	AnnotateIndigenousLangs bool
+	// feature flag values (by name) applied over the built-in defaults; see features.Definitions
+	Features map[string]bool
+	// JSON file runtime feature flag overrides are persisted to; empty keeps them in the database
+	FeatureFile string
+	// limits on the blobs records may reference; violations are recorded, not rejected. nil disables
+	BlobPolicy *blobs.Policy
+	// URL of an external transcoding service video blobs are handed off to; requires Hostname, for the service's callbacks. Empty disables
+	TranscodeURL string
+	// bearer token sent to the transcoding service, and required on its callbacks
+	TranscodeSecret  string
+	TranscodeWorkers int `config:"min=0"`
+	// fraction of new posts from classified accounts sampled for language statistics by region; 0 disables
+	LangStatsSampleRate float64 `config:"min=0,max=1"`
+	// days with fewer sampled posts in a region are left out of published language statistics
+	LangStatsMinSamples int64 `config:"min=0"`
+	// resolver used to prove organization domains; nil uses DNS and HTTPS well-known handle resolution
+	OrgResolver orgs.HandleResolver
+	// only verified organizations may be added as priority accounts
+	PriorityRequiresVerifiedOrg bool
+	// identity directory for validating service auth on the transparency endpoints, which are enabled when Hostname is set; nil uses the default directory
+	Directory identity.Directory
+	// URLs notified (HTTP POST, JSON) when appeals are submitted, assigned or resolved
+	AppealWebhooks []string
+	// key of the authority whose signed policy documents may replace StreamCountries, ExcludeCountries, TransformRules, AnnotateIndigenousLangs and PriorityRequiresVerifiedOrg at runtime; nil disables
+	PolicyAuthority crypto.PublicKey
+	// signed policy document (compact JWS) to apply at startup, if newer than the last one applied
+	PolicyDocument string
+	// number of applied policy documents kept for audit
+	PolicyHistory int `config:"min=0"`
+	// HMAC key for sovereign stream resume tokens, at least resume.MinKeyLength bytes; nil leaves consumers on integer cursors
+	ResumeKey []byte
+	// epoch of the relay's event log, carried in resume tokens; bump it whenever the log is reset and sequence numbers start over
+	ResumeEpoch int64
+	// accept plain integer cursors, which can't be checked, from consumers which predate resume tokens; otherwise they are refused once a resume key is set
+	ResumeIntegerCursors bool
+	// signing key of the relay's own repo, under its did:web identity; requires Hostname. nil disables the repo
+	SelfRepoKey crypto.PrivateKey
+	// CAR file the relay's own repo is persisted to
+	SelfRepoPath string
+	// how often the queue of synthetic #identity refresh events is checked for due entries; 0 disables emitting them
+	IdentityRefreshInterval time.Duration
+	// maximum synthetic #identity events emitted per check, so bulk refreshes trickle out to consumers
+	IdentityRefreshBatch int `config:"min=1"`
+	// how often the status record in the relay's own repo is refreshed
+	SelfRepoStatusInterval time.Duration
+	// number of workers periodically verifying the handles of classified accounts; 0 disables. Persistent failures are labeled with HandleUnverifiedLabel, served by queryLabels when the relay's own repo is enabled
+	HandleCheckWorkers int `config:"min=0"`
+	// how long a verified handle is trusted before it is checked again
+	HandleCheckVerifiedTTL time.Duration
+	// how long a failed check is cached before it is retried
+	HandleCheckFailedTTL time.Duration
+	// consecutive failed checks after which an account is reported and labeled
+	HandleCheckFailureThreshold int `config:"min=1"`
+	// PLC directory whose operation logs are replayed to audit classified did:plc accounts' identity histories; empty disables auditing
+	PLCAuditHost string
+	// maximum requests per second to the PLC directory
+	PLCAuditRate float64 `config:"min=0"`
+	// how old an account's last audit may get before it is audited again
+	PLCAuditInterval time.Duration
+	// per-collection overrides of how long events stay available for playback; applied by the disk persister, which is required
+	RetentionRules []diskpersist.RetentionRule
+	// IP ranges by country, for attributing accounts to the country their PDS is hosted in; PDS geolocation is disabled if neither this nor PDSGeoIPDatabase is set
+	PDSGeoRanges pdsgeo.Geolocator
+	// MaxMind GeoIP2 or GeoLite2 Country or City database file, consulted for PDS addresses which aren't in PDSGeoRanges
+	PDSGeoIPDatabase string
+	// how often the GeoIP database file is checked for changes, and reloaded if it has
+	PDSGeoIPReloadInterval time.Duration
+	// file of accounts classified as in country, one DID per line (or first CSV column), which the sovereign stream always carries; empty disables
+	InCountryList string
+	// file of accounts classified as out of country, which the sovereign stream never carries, unless they are priority accounts; takes precedence over InCountryList. Empty disables
+	OutOfCountryList string
+	// how often the list files are checked for changes, and reloaded if they have
+	DIDListReloadInterval time.Duration
+	// directory of WebAssembly extensions (see the extension package) classifying, filtering and transforming the sovereign stream; requires SnapshotSigningKey, which signs the frame metadata of transformed events. Empty disables
+	ExtensionDir string
+	// most memory each extension instance may use, in bytes
+	ExtensionMemoryLimit int64 `config:"min=0"`
+	// longest a single call into an extension may run
+	ExtensionTimeout time.Duration
+	// how often the extension directory is checked for added, changed and removed modules
+	ExtensionReloadInterval time.Duration
+	// gRPC target of a filter plugin (see the filterplugin package), asked about the events the relay's filter and extensions carry; empty disables
+	FilterPluginTarget string
+	// connect to the filter plugin with TLS
+	FilterPluginTLS bool
+	// connections kept to the filter plugin
+	FilterPluginConns int `config:"min=1"`
+	// longest a call to the filter plugin may take
+	FilterPluginTimeout time.Duration
+	// what becomes of events the filter plugin can't decide on: "keep" or "drop"
+	FilterPluginFallback string
+	// failed calls in a row after which the filter plugin isn't asked for FilterPluginCooldown
+	FilterPluginFailures int `config:"min=1"`
+	FilterPluginCooldown time.Duration
+	// attributes accounts to countries, for classifying accounts the sovereign stream sees unclassified; nil uses a chain of CountryResolverURL, then PDS geolocation when PDSGeoRanges is set, then PLC origin if enabled
+	CountryResolver sovereignty.CountryResolver
+	// attribute did:plc accounts to the country of the PDS they registered on, from their operation log in the PLC directory at PLCAuditHost; requires PDS geolocation
+	PLCOriginResolver bool
+	// how long PLC origin answers are cached
+	PLCOriginCacheTTL time.Duration
+	// window over which events and bytes are counted by account and PDS, for the top talkers report; 0 disables accounting
+	TalkersWindow time.Duration
+	// share of the window's bytes at which an account dominates, and the talkers policy applies; 0 disables the policy
+	TalkersDominantShare float64 `config:"min=0,max=1"`
+	// nobody dominates a window with fewer bytes than this
+	TalkersMinBytes int64 `config:"min=0"`
+	// what is done about dominant accounts by default: "review" flags them in the report, "limit" withholds their events from the sovereign stream while they dominate
+	TalkersAction string
+	// decides what is done about each dominant account; nil applies TalkersAction
+	TalkersPolicy talkers.Policy
+	// directory forensic bundles are captured to when anomalies are detected (an account dominating the talkers window, events out of order, a flapping classification); it is made readable only by the relay's user. Empty disables capture
+	ForensicsDir string
+	// recent frames from PDS hosts kept in memory for bundles
+	ForensicsFrames int `config:"min=1"`
+	// an account or host is captured at most once per cooldown
+	ForensicsCooldown time.Duration
+	// bundles kept; the oldest are removed beyond this. 0 keeps every bundle
+	ForensicsMaxBundles int `config:"min=0"`
+	// external country resolution service, asked first by the default resolver chain; see sovereignty.HTTPCountryResolver
+	CountryResolverURL string
+	// external verification service, which accounts the country resolver has no answer for are POSTed to; see the verify package. Empty disables
+	VerificationURL string
+	// bearer token sent to the verification service; empty sends none
+	VerificationToken string
+	// longest a request to the verification service may take
+	VerificationTimeout time.Duration
+	// failed requests in a row after which the verification service isn't asked for VerificationCooldown
+	VerificationFailures int `config:"min=1"`
+	VerificationCooldown time.Duration
+	// how long the verification service's answers are cached, and its not being able to verify an account
+	VerificationCacheTTL   time.Duration
+	VerificationUnknownTTL time.Duration
+	// answers below this confidence are not applied automatically
+	CountryMinConfidence sovereignty.Confidence
+	// how sure the sovereign stream must be of an account's country to carry its events: "balanced" carries accounts classified with any confidence, "strict" only those classified with at least medium confidence. Classifications made by operators or imported count as certain
+	FilterMode string
+	// language of operator-facing output (admin API errors, account standing) for requests without an Accept-Language header naming a supported one: "en" or "fr". Logs and metrics are always in English
+	Language string
+	// how long the sovereign stream is held back from public subscribers (consumers without a subscriber token, and those whose profile is public), giving moderators lead time; each event is sent to them once it is this old, read from the persister rather than broadcast. Other subscribers get it in real time. 0 disables
+	PublicStreamDelay time.Duration
+	// how long watchlisted accounts' events are held for a moderator's decision before OnTimeout applies; held events are neither persisted nor broadcast until then, on any stream, and are lost if the relay restarts. 0 disables pre-screening
+	PreScreenTimeout time.Duration
+	// what is done with held events nobody decides on in time: "emit" or "drop"
+	PreScreenOnTimeout string
+	// most events held at once; beyond this, the oldest is handled as if it had timed out
+	PreScreenMaxPending int `config:"min=1"`
+	// share of the filter's decisions in shadow mode (the shadow-filtering feature flag) kept in the decision log, from 0 to 1; 0 disables the log, leaving only the metrics
+	ShadowSampleRate float64 `config:"min=0,max=1"`
+	// sampled decisions kept in the log
+	ShadowLogSize int `config:"min=1"`
+	// commits the sovereign stream doesn't carry are sent as stubs holding only the commit's hash and sequence, rather than left out, so consumers see every sequence number
+	FilterHashOnly bool
+	// workers classifying unclassified accounts with the country resolver; 0 disables automatic classification
+	CountryResolveWorkers int `config:"min=0"`
+	// how long before an account without a confident answer is tried again
+	CountryRetryInterval time.Duration
+	// lifetime of classifications applied automatically by the country resolver, after which the account is resolved again; 0 keeps them indefinitely
+	ClassificationTTL time.Duration
+	// changes of an account's classified country or subdivision within ClassificationFlapWindow at which it is flapping; 0 disables detection
+	ClassificationFlapChanges int `config:"min=0"`
+	ClassificationFlapWindow  time.Duration
+	// how long a flapping account is held at its most confident, longest standing recent classification, the country resolver's answers only replacing it if more confident; 0 reports flapping without damping it
+	ClassificationHoldDown time.Duration
+
+	// directory of lexicon schema files the records of processed commits are validated against, before the commits are persisted or broadcast; empty disables validation
+	LexiconDir string
+	// how strictly each collection's invalid records, and records of collections without a lexicon, are handled; nil uses lexcheck.DefaultPolicy
+	LexiconPolicy *lexcheck.Policy
+	// resolve the lexicons of collections missing from LexiconDir from the network, as their records turn up; records are handled as of unknown collections until resolved
+	LexiconResolve bool
+}
+
+// DefaultSovereignConfig returns a config with snapshot publishing disabled.
+func DefaultSovereignConfig() SovereignConfig {
+	return SovereignConfig{
+		SnapshotInterval:            15 * time.Minute,
+		SnapshotMaxDiffs:            24,
+		PeeringInterval:             time.Minute,
+		PolicyHistory:               20,
+		TranscodeWorkers:            4,
+		LangStatsMinSamples:         20,
+		SelfRepoPath:                "data/bigsky/relay-repo.car",
+		SelfRepoStatusInterval:      10 * time.Minute,
+		IdentityRefreshInterval:     10 * time.Second,
+		IdentityRefreshBatch:        100,
+		HandleCheckVerifiedTTL:      24 * time.Hour,
+		HandleCheckFailedTTL:        time.Hour,
+		HandleCheckFailureThreshold: 3,
+		PLCAuditRate:                5,
+		PLCAuditInterval:            24 * time.Hour,
+		CountryMinConfidence:        sovereignty.ConfidenceMedium,
+		FilterMode:                  string(sovereignty.FilterBalanced),
+		Language:                    string(i18n.English),
+		CountryRetryInterval:        24 * time.Hour,
+		ClassificationTTL:           30 * 24 * time.Hour,
+		PDSGeoIPReloadInterval:      time.Minute,
+		DIDListReloadInterval:       time.Minute,
+		ExtensionMemoryLimit:        int64(extension.DefaultOptions().MemoryLimit),
+		ExtensionTimeout:            extension.DefaultOptions().Timeout,
+		ExtensionReloadInterval:     time.Minute,
+		FilterPluginConns:           filterplugin.DefaultOptions().Conns,
+		FilterPluginTimeout:         filterplugin.DefaultOptions().Timeout,
+		FilterPluginFallback:        filterplugin.DefaultOptions().Fallback,
+		FilterPluginFailures:        filterplugin.DefaultOptions().Failures,
+		FilterPluginCooldown:        filterplugin.DefaultOptions().Cooldown,
+		LanguageFilterLangs:         langfilter.DefaultOptions().Langs,
+		PLCOriginCacheTTL:           24 * time.Hour,
+		TalkersDominantShare:        0.05,
+		TalkersMinBytes:             64 << 20,
+		TalkersAction:               string(talkers.ActionReview),
+		ForensicsFrames:             10_000,
+		ForensicsCooldown:           10 * time.Minute,
+		ForensicsMaxBundles:         100,
+		ClassificationFlapChanges:   3,
+		ClassificationFlapWindow:    time.Hour,
+		ClassificationHoldDown:      6 * time.Hour,
+		VerificationTimeout:         verify.DefaultOptions().Timeout,
+		VerificationFailures:        verify.DefaultOptions().Failures,
+		VerificationCooldown:        verify.DefaultOptions().Cooldown,
+		VerificationCacheTTL:        verify.DefaultOptions().CacheTTL,
+		VerificationUnknownTTL:      verify.DefaultOptions().UnknownTTL,
+		PreScreenOnTimeout:          prescreen.DefaultOptions().OnTimeout,
+		PreScreenMaxPending:         prescreen.DefaultOptions().MaxPending,
+		ShadowSampleRate:            shadow.DefaultOptions().SampleRate,
+		ShadowLogSize:               shadow.DefaultOptions().Size,
+	}
+}
+
+func (bgs *BGS) startSovereignty(config *SovereignConfig) error {
+	// first, so the log records of everything set up after are captured
+	if config.ForensicsDir != "" {
+		if err := bgs.setupForensics(config); err != nil {
+			return err
+		}
+	}
+
+	var featureStore features.Store = &dbFeatureStore{db: bgs.db}
+	if config.FeatureFile != "" {
+		featureStore = &features.FileStore{Path: config.FeatureFile}
+	}
+	flags, err := features.NewSet(config.Features, featureStore)
+	if err != nil {
+		return err
+	}
+	if err := flags.Load(context.Background()); err != nil {
+		return err
+	}
+	bgs.features = flags
+
+	if err := bgs.loadClassifications(); err != nil {
+		return err
+	}
+	if err := bgs.loadListedDIDs(); err != nil {
+		return err
+	}
+	if err := bgs.loadSubscriberProfiles(); err != nil {
+		return err
+	}
+	if err := bgs.loadPriorityAccounts(); err != nil {
+		return err
+	}
+	if err := bgs.loadVerifiedOrgs(); err != nil {
+		return err
+	}
+	resolver := config.OrgResolver
+	if resolver == nil {
+		resolver = bgs.orgDomainResolver()
+	}
+	bgs.orgVerifier = orgs.NewVerifier(resolver)
+	if config.MinorPolicy != nil {
+		bgs.minors = minors.NewModule(config.MinorPolicy)
+		if err := bgs.minors.LoadFlags(context.Background(), bgs.db); err != nil {
+			return err
+		}
+	}
+
+	if config.SelfRepoKey != nil {
+		if config.Hostname == "" {
+			return fmt.Errorf("the relay's own repo requires the relay's public hostname")
+		}
+		r, err := selfrepo.Open(context.Background(), config.SelfRepoPath, syntax.DID("did:web:"+config.Hostname), config.SelfRepoKey)
+		if err != nil {
+			return err
+		}
+		bgs.selfRepo = r
+	}
+
+	if config.HandleCheckWorkers > 0 {
+		opts := handlecheck.DefaultOptions()
+		opts.Workers = config.HandleCheckWorkers
+		opts.VerifiedTTL = config.HandleCheckVerifiedTTL
+		opts.FailedTTL = config.HandleCheckFailedTTL
+		opts.FailureThreshold = max(config.HandleCheckFailureThreshold, 1)
+		opts.OnResult = bgs.saveHandleCheck
+		bgs.handleChecks = handlecheck.NewPool(handlecheck.CheckerFunc(bgs.checkHandle), opts)
+		if err := bgs.loadHandleChecks(); err != nil {
+			return err
+		}
+	}
+	if config.PLCAuditHost != "" {
+		bgs.plcAudits = plcops.NewClient(config.PLCAuditHost, config.PLCAuditRate)
+		bgs.plcAudits.HTTPClient = bgs.httpClients.Get(httpprofile.Crawler)
+		bgs.plcAudits.UserAgent = bgs.httpClients.UserAgent(httpprofile.Crawler)
+		bgs.plcAuditQueue = make(chan string, plcAuditQueueSize)
+	}
+
+	var store snapshot.Store
+	switch {
+	case config.SnapshotUploadURL != "":
+		store = &snapshot.HTTPStore{BaseURL: config.SnapshotUploadURL, Client: bgs.httpClients.Get(httpprofile.Bulk)}
+	case config.SnapshotDir != "":
+		store = &snapshot.DirStore{Dir: config.SnapshotDir}
+		bgs.snapshotDir = config.SnapshotDir
+	}
+	if store != nil {
+		if config.SnapshotSigningKey == nil {
+			return fmt.Errorf("classification snapshot publishing requires a signing key")
+		}
+		opts := snapshot.DefaultPublisherOptions()
+		opts.Interval = config.SnapshotInterval
+		opts.MaxDiffs = config.SnapshotMaxDiffs
+		if bgs.selfRepo != nil {
+			opts.OnPublish = bgs.announceSnapshot
+		}
+		var source snapshot.Source = bgs.Classifications
+		if bgs.minors != nil {
+			source = &statsSource{table: bgs.Classifications, minors: bgs.minors}
+		}
+		bgs.snapshotPublisher = snapshot.NewPublisher(source, store, config.SnapshotSigningKey, opts)
+	}
+
+	bgs.alternates = config.Alternates
+	bgs.blobPolicy = config.BlobPolicy
+	if config.TranscodeURL != "" {
+		if config.Hostname == "" {
+			return fmt.Errorf("video transcoding requires the relay's public hostname")
+		}
+		if config.TranscodeSecret == "" {
+			return fmt.Errorf("video transcoding requires a shared secret")
+		}
+		bgs.transcoder = blobs.NewTranscoder(config.TranscodeURL, config.TranscodeSecret, "https://"+config.Hostname+transcodeCallbackPath, bgs.httpClients.Get(httpprofile.Bulk), bgs.log.With("subsystem", "transcoder"))
+	}
+
+	if config.LangStatsSampleRate > 0 {
+		collector, err := langstats.NewCollector(config.LangStatsSampleRate)
+		if err != nil {
+			return err
+		}
+		statsStore, err := langstats.NewStore(bgs.db)
+		if err != nil {
+			return err
+		}
+		bgs.langStats = collector
+		bgs.langStatsStore = statsStore
+		bgs.langStatsMinSamples = config.LangStatsMinSamples
+	}
+
+	bgs.sovereignKey = config.SnapshotSigningKey
+	if config.ExtensionDir != "" {
+		if err := bgs.setupExtensions(config); err != nil {
+			return err
+		}
+	}
+	if config.FilterPluginTarget != "" {
+		if err := bgs.setupFilterPlugin(config); err != nil {
+			return err
+		}
+	}
+	local, err := bgs.newSovereignPolicy(&policy.Document{
+		StreamCountries:             config.StreamCountries,
+		StreamSubdivisions:          config.StreamSubdivisions,
+		ExcludeCountries:            config.ExcludeCountries,
+		TransformRules:              config.TransformRules,
+		AnnotateIndigenousLangs:     config.AnnotateIndigenousLangs,
+		PriorityRequiresVerifiedOrg: config.PriorityRequiresVerifiedOrg,
+	})
+	if err != nil {
+		return err
+	}
+	bgs.policy.Store(local)
+	bgs.policyAuthority = config.PolicyAuthority
+	bgs.policyHistory = config.PolicyHistory
+	if err := bgs.loadPolicy(config.PolicyDocument); err != nil {
+		return err
+	}
+	if config.ResumeKey != nil {
+		signer, err := resume.NewSigner(config.ResumeKey)
+		if err != nil {
+			return err
+		}
+		bgs.resumeSigner = signer
+		bgs.resumeEpoch = config.ResumeEpoch
+		bgs.resumeIntegerCursors = config.ResumeIntegerCursors
+	}
+	bgs.sovereignHostname = config.Hostname
+	bgs.appealWebhooks = config.AppealWebhooks
+	if config.Hostname != "" {
+		dir := config.Directory
+		if dir == nil {
+			dir = bgs.defaultDirectory()
+		}
+		bgs.serviceAuth = &auth.ServiceAuthValidator{
+			Audience: "did:web:" + config.Hostname,
+			Dir:      dir,
+		}
+	}
+
+	geo, err := bgs.setupPDSGeo(config)
+	if err != nil {
+		return err
+	}
+	if geo != nil {
+		dir := config.Directory
+		if dir == nil {
+			dir = bgs.defaultDirectory()
+		}
+		bgs.pdsGeo = &pdsgeo.Resolver{Dir: dir, Geo: geo}
+	}
+	if len(config.EgressRules) > 0 {
+		if err := bgs.setupEgress(config); err != nil {
+			return err
+		}
+	}
+	nsPolicy, err := namespaces.NewPolicy(config.NamespaceAllowlist, config.NamespaceBlocklist)
+	if err != nil {
+		return err
+	}
+	bgs.namespaces = nsPolicy
+	if config.LanguageFilter != "" {
+		if err := bgs.setupLanguageFilter(config); err != nil {
+			return err
+		}
+	}
+
+	if config.PLCOriginResolver {
+		if bgs.plcAudits == nil || bgs.pdsGeo == nil {
+			return fmt.Errorf("PLC origin resolution requires a PLC directory and PDS geolocation")
+		}
+		opts := plcorigin.DefaultOptions()
+		opts.CacheTTL = config.PLCOriginCacheTTL
+		opts.Clock = bgs.clock
+		bgs.plcOrigin = plcorigin.NewResolver(bgs.plcAudits, bgs.pdsGeo, opts)
+	}
+
+	if err := bgs.setupDIDLists(config); err != nil {
+		return err
+	}
+
+	if config.TalkersWindow > 0 {
+		if err := bgs.setupTalkers(config); err != nil {
+			return err
+		}
+	}
+
+	bgs.countryResolver = config.CountryResolver
+	if bgs.countryResolver == nil {
+		bgs.countryResolver = bgs.defaultCountryResolver(config)
+	}
+	if config.VerificationURL != "" {
+		if err := bgs.setupVerification(config); err != nil {
+			return err
+		}
+	}
+	bgs.countryMinConfidence = config.CountryMinConfidence
+	if config.ClassificationFlapChanges > 0 {
+		bgs.setupFlapping(config)
+	}
+	bgs.filterMode = sovereignty.FilterBalanced
+	if config.FilterMode != "" {
+		mode, err := sovereignty.ParseFilterMode(config.FilterMode)
+		if err != nil {
+			return err
+		}
+		bgs.filterMode = mode
+	}
+	bgs.filterHashOnly = config.FilterHashOnly
+	bgs.publicDelay = config.PublicStreamDelay
+	if config.ResidencyPolicy != nil {
+		if err := config.ResidencyPolicy.Validate(); err != nil {
+			return err
+		}
+		bgs.residencyPolicy = config.ResidencyPolicy
+		bgs.residencyQueue = make(chan *residency.Declaration, residencyQueueSize)
+	}
+	if config.LexiconDir != "" {
+		if err := bgs.setupLexCheck(config); err != nil {
+			return err
+		}
+	}
+	if config.PreScreenTimeout > 0 {
+		if err := bgs.setupPreScreen(config); err != nil {
+			return err
+		}
+	}
+	if config.ShadowSampleRate > 0 {
+		bgs.shadowLog = shadow.NewLog(shadow.Options{Size: config.ShadowLogSize, SampleRate: config.ShadowSampleRate})
+	}
+	if config.Language != "" {
+		lang, err := i18n.ParseLang(config.Language)
+		if err != nil {
+			return err
+		}
+		bgs.lang = lang
+	}
+	bgs.classificationTTL = config.ClassificationTTL
+	if bgs.countryResolver != nil && config.CountryResolveWorkers > 0 {
+		bgs.countryQueue = make(chan string, countryQueueSize)
+		bgs.countryTried, _ = lru.New[string, time.Time](countryTriedSize)
+		bgs.countryUnresolved, _ = lru.New[string, time.Time](countryTriedSize)
+		bgs.countryRetry = config.CountryRetryInterval
+	}
+
+	if len(config.Peers) > 0 {
+		if config.Hostname == "" {
+			return fmt.Errorf("relay peering requires the relay's public hostname")
+		}
+		bgs.beacon = peering.NewBeacon(bgs.sovereignHealth, config.Peers, config.PeeringInterval)
+		bgs.beacon.Client = bgs.httpClients.Get(httpprofile.Interactive)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bgs.sovereignCancel = cancel
+	if bgs.forensics != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.forensics.Run(ctx)
+		}()
+	}
+	if bgs.snapshotPublisher != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.snapshotPublisher.Run(ctx)
+		}()
+	}
+	if bgs.beacon != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.beacon.Run(ctx)
+		}()
+	}
+	if bgs.transcoder != nil {
+		workers := max(config.TranscodeWorkers, 1)
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.transcoder.Run(ctx, workers)
+		}()
+	}
+	if bgs.selfRepo != nil && config.SelfRepoStatusInterval > 0 {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runSelfRepoStatus(ctx, config.SelfRepoStatusInterval)
+		}()
+	}
+	if bgs.langStats != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.langStats.Run(ctx, bgs.langStatsStore, time.Minute, bgs.log.With("subsystem", "langstats"))
+		}()
+	}
+	if config.IdentityRefreshInterval > 0 {
+		batch := max(config.IdentityRefreshBatch, 1)
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runIdentityRefreshes(ctx, config.IdentityRefreshInterval, batch)
+		}()
+	}
+	if bgs.handleChecks != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.handleChecks.Run(ctx, bgs.trackedHandleDIDs)
+		}()
+	}
+	if bgs.plcAudits != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runPLCAudits(ctx, config.PLCAuditInterval)
+		}()
+	}
+	if bgs.geoIP != nil && config.PDSGeoIPReloadInterval > 0 {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runGeoIPReloads(ctx, config.PDSGeoIPReloadInterval)
+		}()
+	}
+	if bgs.extensions != nil && config.ExtensionReloadInterval > 0 {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runExtensionReloads(ctx, config.ExtensionReloadInterval)
+		}()
+	}
+	if (bgs.inCountry != nil || bgs.outOfCountry != nil) && config.DIDListReloadInterval > 0 {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runDIDListReloads(ctx, config.DIDListReloadInterval)
+		}()
+	}
+	if bgs.countryQueue != nil {
+		for i := 0; i < config.CountryResolveWorkers; i++ {
+			bgs.sovereignWg.Add(1)
+			go func() {
+				defer bgs.sovereignWg.Done()
+				bgs.runCountryResolves(ctx)
+			}()
+		}
+	}
+	if bgs.residencyQueue != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runResidencyDeclarations(ctx)
+		}()
+	}
+	if bgs.prescreen != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.prescreen.Run(ctx)
+		}()
+	}
+	if bgs.lexCheck != nil && config.LexiconResolve {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.lexCheck.Registry().Run(ctx)
+		}()
+	}
+	// the flag may be turned on at runtime
+	bgs.sovereignWg.Add(1)
+	go func() {
+		defer bgs.sovereignWg.Done()
+		bgs.runShadowFilter(ctx)
+	}()
+	// classifications may carry expiry times from earlier runs, whatever the current TTL
+	bgs.sovereignWg.Add(1)
+	go func() {
+		defer bgs.sovereignWg.Done()
+		bgs.runClassificationExpiry(ctx)
+	}()
+	if bgs.policyAuthority != nil {
+		bgs.sovereignWg.Add(1)
+		go func() {
+			defer bgs.sovereignWg.Done()
+			bgs.runPolicyRamp(ctx)
+		}()
+	}
+	return nil
+}
+
+func (bgs *BGS) stopSovereignty() {
+	if bgs.sovereignCancel != nil {
+		bgs.sovereignCancel()
+	}
+	bgs.sovereignWg.Wait()
+	if bgs.extensions != nil {
+		bgs.extensions.Close(context.Background())
+	}
+	if bgs.filterPlugin != nil {
+		bgs.filterPlugin.Close()
+	}
+}
+
+// loadClassifications populates the in-memory table from the database
+func (bgs *BGS) loadClassifications() error {
+	var rows []models.DIDClassification
+	if err := bgs.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading DID classifications: %w", err)
+	}
+	entries := make([]sovereignty.Classification, len(rows))
+	for i, r := range rows {
+		entries[i] = sovereignty.Classification{
+			DID:         r.Did,
+			Country:     r.Country,
+			Subdivision: r.Subdivision,
+			Source:      r.Source,
+			UpdatedAt:   r.UpdatedAt.UTC(),
+			ExpiresAt:   r.ExpiresAt,
+			Confidence:  sovereignty.Confidence(r.Confidence),
+		}
+	}
+	bgs.Classifications.Replace(entries)
+	bgs.log.Info("loaded DID classifications", "count", len(entries))
+	return nil
+}
+
+// SovereignEventsHandler serves the sovereign stream: the firehose restricted to accounts classified into one of the configured countries, with minor protection and outbound transformations applied. Frames carry resume tokens when a resume key is configured. Consumers presenting a subscriber token get the stream shaped by its profile. Public subscribers get it with the public delay, if there is one.
+func (bgs *BGS) SovereignEventsHandler(c echo.Context) error {
+	basis, err := parseRegionBasis(c.QueryParam("regionBasis"))
+	if err != nil {
+		return &echo.HTTPError{Code: 400, Message: err.Error()}
+	}
+	sub, err := bgs.authSubscriber(c)
+	if err != nil {
+		return err
+	}
+	restrict := bgs.egressRestriction(c)
+	// the subscriber's profile, as it stands when each event is sent; nil for the relay's default shape
+	prof := func() *profile.Profile { return nil }
+	if sub != nil {
+		prof = func() *profile.Profile { return bgs.subscriberProfile(sub.Profile) }
+		subscriberConnections.WithLabelValues(sub.Profile).Inc()
+	}
+	// events the filter let through as stubs, until they are sent
+	var stubs sync.Map
+	opts := streamOptions{
+		filter: func(evt *events.XRPCStreamEvent) bool {
+			r := bgs.sovereignFilter(evt, prof())
+			if r.HashOnly {
+				stubs.Store(evt, struct{}{})
+			}
+			return r.Include || r.HashOnly
+		},
+		transform: func(evt *events.XRPCStreamEvent) (*events.XRPCStreamEvent, error) {
+			if _, ok := stubs.LoadAndDelete(evt); ok {
+				return hashOnlyEvent(evt), nil
+			}
+			return bgs.sovereignTransform(evt, basis, prof(), restrict)
+		},
+	}
+	if bgs.publicDelay > 0 && prof().IsPublic() {
+		// a profile made public later applies from the subscriber's next connection
+		opts.delay = bgs.publicDelay
+		publicDelayedConnections.Inc()
+	}
+	if bgs.resumeSigner != nil {
+		filter := bgs.resumeFilter(prof, basis, c.QueryParams()["collection"])
+		opts.parseCursor = func(cursor string) (int64, *events.ErrorFrame) { return bgs.parseResumeCursor(cursor, filter()) }
+		opts.stamp = func(evt *events.XRPCStreamEvent) *events.XRPCStreamEvent { return bgs.stampResumeToken(evt, filter()) }
+	}
+	return bgs.serveEvents(c, opts)
+}
+
+// sovereignTransform prepares an event for the sovereign stream, shaped by the subscriber's profile (nil for the relay's default), and withholding the records egress rules restrict from it (nil if none). If basis is set, the frame metadata carries the account's region under it.
+func (bgs *BGS) sovereignTransform(evt *events.XRPCStreamEvent, basis string, prof *profile.Profile, restrict *egress.Restriction) (*events.XRPCStreamEvent, error) {
+	annotations := prof.AnnotationLevel()
+	switch {
+	case annotations == profile.AnnotationsNone:
+		basis = ""
+	case annotations == profile.AnnotationsFull && basis == "":
+		basis = RegionBasisCurrent
+	}
+	var region string
+	if basis != "" && eventDID(evt) != "" {
+		// before the other stages, which don't carry the persisted region over
+		region, basis = bgs.eventRegion(evt, basis)
+	} else {
+		basis = ""
+	}
+	if bgs.minors != nil && bgs.features.Enabled(features.HashOnlyEmission) {
+		out, err := bgs.minors.HashOnlyEvent(evt)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	if prof.WithholdsRecords() {
+		out, err := minors.WithholdRecords(evt, nil)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	} else if bgs.namespaces != nil || restrict != nil {
+		// before annotation, which would carry what the records say
+		out, err := minors.WithholdRecords(evt, func(path string) bool {
+			if bgs.namespaceWithheld(path) {
+				return true
+			}
+			if restrict == nil {
+				return false
+			}
+			rule, ok := restrict.Withheld(path)
+			if ok {
+				egressWithheldRecords.WithLabelValues(rule).Inc()
+			}
+			return ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	pol := bgs.policy.Load().forDID(eventDID(evt))
+	if (pol.annotateLangs && annotations == profile.AnnotationsStandard) || annotations == profile.AnnotationsFull {
+		out, err := indigenous.AnnotateEvent(evt)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	if (bgs.features.Enabled(features.PostEnrichment) && annotations == profile.AnnotationsStandard) || annotations == profile.AnnotationsFull {
+		out, err := enrich.AnnotateEvent(evt)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	if pol.transforms != nil && prof.Transforms() {
+		out, err := pol.transforms.TransformEvent(evt)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	if bgs.extensions != nil && prof.Transforms() {
+		out, err := bgs.extensions.TransformEvent(context.Background(), evt, bgs.sovereignKey)
+		if err != nil {
+			return nil, err
+		}
+		evt = out
+	}
+	if basis != "" {
+		return bgs.annotateRegion(evt, region, basis)
+	}
+	if evt.Meta != nil && evt.Meta.Sig == nil && bgs.sovereignKey != nil {
+		// annotation-only metadata, which the transform pipeline didn't sign
+		meta := *evt.Meta
+		if err := transform.SignMeta(&meta, bgs.sovereignKey); err != nil {
+			return nil, err
+		}
+		out := *evt
+		out.Meta = &meta
+		out.Preserialized = nil
+		evt = &out
+	}
+	return evt, nil
+}
+
+// sovereignFilter decides whether the sovereign stream carries an event, and how sure it is, for a subscriber with the profile (nil for the relay's default)
+func (bgs *BGS) sovereignFilter(evt *events.XRPCStreamEvent, prof *profile.Profile) sovereignty.FilterResult {
+	if bgs.features.Enabled(features.ShadowFiltering) {
+		// evaluated once per event by runShadowFilter instead
+		r := sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonShadow}
+		sovereignFilterResults.WithLabelValues(shadow.ResultInclude, r.Confidence.String(), r.Reason, bgs.filterCountryLabel(evt)).Inc()
+		return r
+	}
+	r := bgs.evaluateFilter(evt, prof)
+	sovereignFilterResults.WithLabelValues(filterResultLabel(r), r.Confidence.String(), r.Reason, bgs.filterCountryLabel(evt)).Inc()
+	return r
+}
+
+// evaluateFilter runs the relay's filter, the language filter, the extensions', the filter plugin's and the profile's on an event. Extensions which classify events decide in place of the relay's geographic filter, but not over its lists of accounts, priority accounts or talker limits
+func (bgs *BGS) evaluateFilter(evt *events.XRPCStreamEvent, prof *profile.Profile) sovereignty.FilterResult {
+	r := bgs.filterEvent(evt)
+	if bgs.extensions != nil && geographicReason(r.Reason) {
+		v, err := bgs.extensions.Classify(context.Background(), evt)
+		switch {
+		case err != nil:
+			bgs.log.Warn("extension failed to classify event, dropping it", "did", eventDID(evt), "err", err)
+			r = sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonExtension}
+		case v != nil:
+			r = sovereignty.FilterResult{Include: v.Keep, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonExtension}
+		}
+	}
+	if bgs.langFilter != nil && evt.RepoCommit != nil {
+		r = bgs.applyLanguageFilter(evt.RepoCommit, r)
+	}
+	if r.Include && bgs.extensions != nil {
+		keep, err := bgs.extensions.Filter(context.Background(), evt)
+		if err != nil {
+			bgs.log.Warn("extension failed to filter event, dropping it", "did", eventDID(evt), "err", err)
+		}
+		if !keep {
+			r = sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonExtension}
+		}
+	}
+	if r.Include && bgs.filterPlugin != nil {
+		keep, err := bgs.filterPlugin.Filter(context.Background(), evt)
+		if err != nil && !errors.Is(err, filterplugin.ErrCircuitOpen) {
+			bgs.log.Warn("filter plugin failed to filter event, applying its fallback", "did", eventDID(evt), "keep", keep, "err", err)
+		}
+		if !keep {
+			r = sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonPlugin}
+		}
+	}
+	if r.Include && bgs.namespaceBlocked(evt) {
+		r = sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonNamespace}
+	}
+	return prof.Apply(r, evt.RepoCommit != nil, bgs.filterHashOnly)
+}
+
+// defaultDirectory returns an identity directory as identity.DefaultDirectory does, resolving over the interactive HTTP client
+func (bgs *BGS) defaultDirectory() identity.Directory {
+	base := identity.BaseDirectory{
+		PLCURL:     identity.DefaultPLCURL,
+		HTTPClient: *bgs.httpClients.Get(httpprofile.Interactive),
+		Resolver: net.Resolver{
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: time.Second * 3}
+				return d.DialContext(ctx, network, address)
+			},
+		},
+		TryAuthoritativeDNS:   true,
+		SkipDNSDomainSuffixes: []string{".bsky.social"},
+		UserAgent:             "indigo-relay",
+	}
+	cached := identity.NewCacheDirectory(&base, 250_000, time.Hour*24, time.Minute*2, time.Minute*5)
+	return &cached
+}
+
+// geographicReason reports whether the relay's filter decided on an event by the account's classification, which classifying extensions may overrule
+func geographicReason(reason string) bool {
+	switch reason {
+	case sovereignty.FilterReasonUnclassified, sovereignty.FilterReasonUnresolved, sovereignty.FilterReasonCountry, sovereignty.FilterReasonSubdivision,
+		sovereignty.FilterReasonOtherCountry, sovereignty.FilterReasonExcludedCountry, sovereignty.FilterReasonLowConfidence:
+		return true
+	}
+	return false
+}
+
+// filterResultLabel names what the sovereign stream does with an event, for metrics and the shadow decision log
+func filterResultLabel(r sovereignty.FilterResult) string {
+	switch {
+	case r.Include:
+		return shadow.ResultInclude
+	case r.HashOnly:
+		return shadow.ResultHashOnly
+	default:
+		return shadow.ResultExclude
+	}
+}
+
+func (bgs *BGS) filterEvent(evt *events.XRPCStreamEvent) sovereignty.FilterResult {
+	did := eventDID(evt)
+	if did == "" {
+		// info and error frames
+		return sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonNoAccount}
+	}
+	if bgs.Priority.IsPriority(did) {
+		return sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonPriority}
+	}
+	if bgs.talkers != nil && bgs.talkers.Limited(did) {
+		talkersLimitedCounter.Inc()
+		return sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonLimited}
+	}
+	if bgs.listedOut(did) {
+		return sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonListedOut}
+	}
+	if bgs.listedIn(did) {
+		return sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonListedIn}
+	}
+	cl, ok := bgs.Classifications.Get(did)
+	if !ok {
+		bgs.enqueueCountryResolve(did)
+		reason := sovereignty.FilterReasonUnclassified
+		if bgs.countryUnresolvedRecently(did) {
+			reason = sovereignty.FilterReasonUnresolved
+		}
+		// when excluding countries, accounts are carried until they are attributed to one
+		if bgs.policy.Load().forDID(did).excluding() {
+			return sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceNone, Reason: reason}
+		}
+		return sovereignty.FilterResult{Confidence: sovereignty.ConfidenceNone, Reason: reason}
+	}
+	conf := cl.Assurance()
+	pol := bgs.policy.Load()
+	if pol.prev != nil {
+		next, prev := pol.carries(cl), pol.prev.carries(cl)
+		if next && !prev {
+			policyRampDivergentEvents.WithLabelValues("add").Inc()
+		} else if prev && !next {
+			policyRampDivergentEvents.WithLabelValues("remove").Inc()
+		}
+	}
+	dp := pol.forDID(did)
+	if dp.excluding() {
+		// the filter mode keeps weak classifications from carrying an account; when excluding, they only ever leave one out
+		if !dp.carries(cl) {
+			return sovereignty.FilterResult{Confidence: conf, Reason: sovereignty.FilterReasonExcludedCountry}
+		}
+		return sovereignty.FilterResult{Include: true, Confidence: conf, Reason: sovereignty.FilterReasonCountry}
+	}
+	if !dp.carries(cl) {
+		return sovereignty.FilterResult{Confidence: conf, Reason: sovereignty.FilterReasonOtherCountry}
+	}
+	if !bgs.filterMode.Admits(conf) {
+		return sovereignty.FilterResult{Confidence: conf, Reason: sovereignty.FilterReasonLowConfidence}
+	}
+	if !dp.streamCountries[cl.Country] {
+		return sovereignty.FilterResult{Include: true, Confidence: conf, Reason: sovereignty.FilterReasonSubdivision}
+	}
+	return sovereignty.FilterResult{Include: true, Confidence: conf, Reason: sovereignty.FilterReasonCountry}
+}
+
+// filterCountryLabel returns the classified country of an event's account for the filter metrics, or "none"
+func (bgs *BGS) filterCountryLabel(evt *events.XRPCStreamEvent) string {
+	did := eventDID(evt)
+	if did == "" {
+		return "none"
+	}
+	cl, ok := bgs.Classifications.Get(did)
+	if !ok || cl.Country == "" {
+		return "none"
+	}
+	return cl.Country
+}
+
+// hashOnlyEvent returns a stub of a commit the sovereign stream doesn't carry, holding only the commit's hash, sequence and revision, with no blocks, ops or blobs, and no metadata
+func hashOnlyEvent(evt *events.XRPCStreamEvent) *events.XRPCStreamEvent {
+	c := evt.RepoCommit
+	return &events.XRPCStreamEvent{
+		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Seq:    c.Seq,
+			Repo:   c.Repo,
+			Rev:    c.Rev,
+			Since:  c.Since,
+			Commit: c.Commit,
+			Time:   c.Time,
+			Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{},
+			Blobs:  []lexutil.LexLink{},
+		},
+	}
+}
+
+// eventDID returns the account an event is about, or empty string for events not tied to an account
+func eventDID(evt *events.XRPCStreamEvent) string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Repo
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Did
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Did
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Did
+	default:
+		return ""
+	}
+}
+
+// HandleDescribeServer serves com.atproto.server.describeServer, extended with the relay's alternates and head sequence number so consumers can fail over.
+func (bgs *BGS) HandleDescribeServer(e echo.Context) error {
+	seq, _ := bgs.events.Head()
+	desc := failover.Description{
+		AvailableUserDomains: []string{},
+		Alternates:           bgs.alternates,
+		HeadSeq:              seq,
+	}
+	if bgs.sovereignHostname != "" {
+		desc.Did = "did:web:" + bgs.sovereignHostname
+	}
+	return e.JSON(200, desc)
+}
+
+// drainConsumers sends a shutdown frame (with alternates) to all connected consumers, and waits briefly for them to be written
+func (bgs *BGS) drainConsumers() {
+	select {
+	case <-bgs.shutdownCh:
+		return
+	default:
+		close(bgs.shutdownCh)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bgs.consumersWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		bgs.log.Warn("timed out waiting for consumers to disconnect")
+	}
+}
+
+// sovereignHealth summarizes this relay's state for peer beacons
+func (bgs *BGS) sovereignHealth() peering.Health {
+	seq, at := bgs.events.Head()
+	lag := -1.0
+	if !at.IsZero() {
+		lag = time.Since(at).Seconds()
+	}
+	var known int64
+	if err := bgs.db.Model(&models.PDS{}).Count(&known).Error; err != nil {
+		bgs.log.Warn("failed to count known hosts for peering beacon", "err", err)
+	}
+	var gen int64
+	if bgs.snapshotPublisher != nil {
+		gen = bgs.snapshotPublisher.Generation()
+	}
+	return peering.Health{
+		Relay:              bgs.sovereignHostname,
+		HeadSeq:            seq,
+		LagSeconds:         lag,
+		ActiveHosts:        len(bgs.slurper.GetActiveList()),
+		KnownHosts:         int(known),
+		Classifications:    bgs.publicClassificationCount(),
+		SnapshotGeneration: gen,
+		Time:               syntax.DatetimeNow().String(),
+	}
+}
+
+func (bgs *BGS) handlePeeringBeacon(e echo.Context) error {
+	var h peering.Health
+	if err := e.Bind(&h); err != nil {
+		return err
+	}
+	resp, err := bgs.beacon.HandleBeacon(&h)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    403,
+			Message: err.Error(),
+		}
+	}
+	return e.JSON(200, resp)
+}
+
+func (bgs *BGS) handlePeeringMesh(e echo.Context) error {
+	return e.JSON(200, bgs.beacon.Mesh())
+}
+
+// SetClassification persists a classification and updates the in-memory table and filter cache.
+func (bgs *BGS) SetClassification(ctx context.Context, c sovereignty.Classification) error {
+	return bgs.setClassification(ctx, c, sovereignty.ConfidenceHigh, true)
+}
+
+// setClassification applies a classification with the given confidence. If the account's classification is flapping and held at another, that is applied instead; manual classifications, made by operators, release the hold
+func (bgs *BGS) setClassification(ctx context.Context, c sovereignty.Classification, conf sovereignty.Confidence, manual bool) error {
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = bgs.clock.Now().UTC()
+	}
+	row := models.DIDClassification{
+		Did:         c.DID,
+		Country:     c.Country,
+		Subdivision: c.Subdivision,
+		Source:      c.Source,
+		ExpiresAt:   c.ExpiresAt,
+		Confidence:  int(c.Confidence),
+	}
+	row.UpdatedAt = c.UpdatedAt
+	var prev *sovereignty.Classification
+	if p, ok := bgs.Classifications.Get(c.DID); ok {
+		prev = &p
+	}
+	if err := bgs.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"country", "subdivision", "source", "expires_at", "updated_at", "confidence"}),
+	}).Create(&row).Error; err != nil {
+		return err
+	}
+	bgs.Classifications.Set(c)
+	bgs.cacheDecision(ctx, c, conf)
+	if bgs.flaps != nil {
+		if hold := bgs.observeClassification(prev, c, manual); hold != nil {
+			held := bgs.holdClassification(*hold)
+			return bgs.setClassification(ctx, held, held.Assurance(), false)
+		}
+	}
+	return nil
+}
+
+// DeleteClassification removes any classification for the DID: persisted, in-memory, and in the filter cache.
+func (bgs *BGS) DeleteClassification(ctx context.Context, did string) error {
+	if err := bgs.db.WithContext(ctx).Unscoped().Where("did = ?", did).Delete(&models.DIDClassification{}).Error; err != nil {
+		return err
+	}
+	bgs.Classifications.Delete(did)
+	if err := bgs.filterCache.Delete(ctx, did); err != nil {
+		bgs.log.Warn("failed to update filter cache", "did", did, "err", err)
+	}
+	bgs.observeFilterCacheSize()
+	return nil
+}
+
+func (bgs *BGS) handleAdminGetClassification(e echo.Context) error {
+	did := e.QueryParam("did")
+	c, ok := bgs.Classifications.Get(did)
+	if !ok {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no classification for DID",
+		}
+	}
+	return e.JSON(200, c)
+}
+
+type classifyBody struct {
+	Did         string `json:"did"`
+	Country     string `json:"country"`
+	Subdivision string `json:"subdivision"`
+	Source      string `json:"source"`
+}
+
+func (bgs *BGS) handleAdminClassify(e echo.Context) error {
+	var body classifyBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	country, err := sovereignty.NormalizeCountry(body.Country)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	subdivision, err := sovereignty.NormalizeSubdivision(country, body.Subdivision)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+	source := body.Source
+	if source == "" {
+		source = "admin"
+	}
+
+	if err := bgs.SetClassification(e.Request().Context(), sovereignty.Classification{
+		DID:         did.String(),
+		Country:     country,
+		Subdivision: subdivision,
+		Source:      source,
+	}); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+type classifyPDSBody struct {
+	Did string `json:"did"`
+	// record the result as the account's classification, rather than just reporting it
+	Apply bool `json:"apply"`
+}
+
+// handleAdminClassifyPDS attributes an account to the country its PDS is hosted in, by geolocating the PDS named in its DID document, falling back to the PDS hostname's country-code TLD
+func (bgs *BGS) handleAdminClassifyPDS(e echo.Context) error {
+	if bgs.pdsGeo == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "PDS geolocation is not configured",
+		}
+	}
+	var body classifyPDSBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+
+	ctx := e.Request().Context()
+	res, err := bgs.pdsGeo.Resolve(ctx, did)
+	if err != nil {
+		if errors.Is(err, pdsgeo.ErrNoCountry) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: err.Error(),
+			}
+		}
+		return &echo.HTTPError{
+			Code:    502,
+			Message: err.Error(),
+		}
+	}
+	if body.Apply {
+		if err := bgs.SetClassification(ctx, sovereignty.Classification{
+			DID:         res.DID,
+			Country:     res.Country,
+			Subdivision: res.Subdivision,
+			Source:      res.Source,
+		}); err != nil {
+			return err
+		}
+		bgs.log.Info("classified account by PDS location", "did", res.DID, "country", res.Country, "source", res.Source, "pds", res.PDS)
+	}
+	return e.JSON(200, map[string]any{
+		"result":  res,
+		"applied": body.Apply,
+	})
+}
+
+func (bgs *BGS) handleAdminUnclassify(e echo.Context) error {
+	var body classifyBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did in body",
+		}
+	}
+
+	if err := bgs.DeleteClassification(e.Request().Context(), body.Did); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+// statsSource is the classification table as published, with accounts excluded by the minor-protection policy left out
+type statsSource struct {
+	table  *sovereignty.Table
+	minors *minors.Module
+}
+
+func (s *statsSource) Snapshot() []sovereignty.Classification {
+	all := s.table.Snapshot()
+	out := all[:0]
+	for _, c := range all {
+		if !s.minors.ExcludeStats(c.DID) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// publicClassificationCount is the number of classified accounts, less any excluded from statistics
+func (bgs *BGS) publicClassificationCount() int {
+	if bgs.minors == nil || !bgs.minors.Policy.ExcludeStats {
+		return bgs.Classifications.Len()
+	}
+	n := 0
+	for _, c := range bgs.Classifications.Snapshot() {
+		if !bgs.minors.ExcludeStats(c.DID) {
+			n++
+		}
+	}
+	return n
+}
+
+// observeMinorCommit updates and persists an account's birthdate flag from a processed commit
+func (bgs *BGS) observeMinorCommit(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Commit) {
+	changed, err := bgs.minors.ObserveCommit(evt)
+	if err != nil {
+		bgs.log.Warn("failed to check birthdate record", "did", evt.Repo, "seq", evt.Seq, "err", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if err := bgs.minors.SaveFlag(ctx, bgs.db, evt.Repo, minors.ReasonBirthdate); err != nil {
+		bgs.log.Error("failed to persist minor flag", "did", evt.Repo, "err", err)
+	}
+}
+
+func (bgs *BGS) handleAdminListMinors(e echo.Context) error {
+	if bgs.minors == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "minor protection is not enabled",
+		}
+	}
+	return e.JSON(200, bgs.minors.Flags())
+}
+
+type minorLabelBody struct {
+	Did   string `json:"did"`
+	Label string `json:"label"`
+	Neg   bool   `json:"neg"`
+}
+
+// handleAdminMinorLabel applies (or, with neg, removes) a moderation label to the minor-protection policy
+func (bgs *BGS) handleAdminMinorLabel(e echo.Context) error {
+	if bgs.minors == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "minor protection is not enabled",
+		}
+	}
+	var body minorLabelBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Errorf("invalid did: %w", err).Error(),
+		}
+	}
+	if !bgs.minors.Policy.IsMinorLabel(body.Label) {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("label %q does not flag minors under this relay's policy", body.Label),
+		}
+	}
+
+	if bgs.minors.ObserveLabel(did.String(), body.Label, body.Neg) {
+		if err := bgs.minors.SaveFlag(e.Request().Context(), bgs.db, did.String(), minors.ReasonLabel); err != nil {
+			return err
+		}
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
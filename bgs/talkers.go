@@ -0,0 +1,129 @@
+package bgs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/forensics"
+	"github.com/bluesky-social/indigo/sovereignty/talkers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (bgs *BGS) setupTalkers(config *SovereignConfig) error {
+	opts := talkers.DefaultOptions()
+	opts.Window = config.TalkersWindow
+	opts.DominantShare = config.TalkersDominantShare
+	opts.MinBytes = config.TalkersMinBytes
+	opts.Policy = config.TalkersPolicy
+	if opts.Policy == nil {
+		action, err := talkers.ParseAction(config.TalkersAction)
+		if err != nil {
+			return err
+		}
+		opts.Policy = talkers.PolicyFunc(func(talkers.Usage) talkers.Action { return action })
+	}
+	opts.OnChange = bgs.talkerChanged
+	opts.Clock = bgs.clock
+	bgs.talkers = talkers.NewTracker(opts)
+	return nil
+}
+
+func (bgs *BGS) talkerChanged(u talkers.Usage, dominant bool) {
+	if !dominant {
+		bgs.log.Info("account no longer dominates event volume", "did", u.Key, "bytes", u.Bytes, "share", u.Share)
+		return
+	}
+	action := string(u.Action)
+	if u.Action == talkers.ActionNone {
+		action = "none"
+	}
+	talkersActionsCounter.WithLabelValues(action).Inc()
+	bgs.log.Warn("account dominates event volume", "did", u.Key, "events", u.Events, "bytes", u.Bytes, "share", u.Share, "action", action)
+	if bgs.forensics != nil {
+		bgs.forensics.Trigger(forensics.Trigger{
+			Kind:   forensics.KindFlood,
+			DID:    u.Key,
+			Detail: fmt.Sprintf("%d events, %d bytes, %.1f%% of the window; action %s", u.Events, u.Bytes, u.Share*100, action),
+		})
+	}
+}
+
+// countTalker accounts an event received from a PDS to its account and host, by the size of its frame
+func (bgs *BGS) countTalker(host *models.PDS, env *events.XRPCStreamEvent) {
+	did := eventDID(env)
+	if did == "" {
+		return
+	}
+	var n byteCounter
+	if err := env.Serialize(&n); err != nil {
+		// nor could it be persisted or streamed
+		return
+	}
+	bgs.talkers.Add(did, host.Host, int64(n))
+}
+
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+type topTalkersResponse struct {
+	// length of the window, in seconds
+	Window  float64         `json:"window"`
+	Total   talkers.Usage   `json:"total"`
+	Talkers []talkers.Usage `json:"talkers"`
+	// accounts currently dominating the window, and what is done about them
+	Dominant map[string]talkers.Action `json:"dominant"`
+}
+
+// handleAdminTopTalkers reports the accounts (or, with kind=pds, PDS hosts) with the most bytes, or with by=events the most events, in the talkers window
+func (bgs *BGS) handleAdminTopTalkers(e echo.Context) error {
+	if bgs.talkers == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "event accounting is not enabled",
+		}
+	}
+	kind := talkers.Kind(e.QueryParam("kind"))
+	switch kind {
+	case "":
+		kind = talkers.KindAccount
+	case talkers.KindAccount, talkers.KindPDS:
+	default:
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "kind must be account or pds",
+		}
+	}
+	by := e.QueryParam("by")
+	if by != "" && by != "bytes" && by != "events" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "by must be bytes or events",
+		}
+	}
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "limit must be between 1 and 1000",
+			}
+		}
+		limit = v
+	}
+
+	top, total := bgs.talkers.Top(kind, limit, by == "events")
+	return e.JSON(200, topTalkersResponse{
+		Window:   bgs.talkers.Window().Seconds(),
+		Total:    total,
+		Talkers:  top,
+		Dominant: bgs.talkers.Dominant(),
+	})
+}
@@ -0,0 +1,85 @@
+package bgs
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty/talkers"
+
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopTalkers(t *testing.T) {
+	assert := assert.New(t)
+	b := newTestBGS(t)
+	e := echo.New()
+
+	get := func(target string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		return rec, b.handleAdminTopTalkers(e.NewContext(req, rec))
+	}
+	_, err := get("/admin/sovereignty/talkers")
+	assert.Error(err)
+
+	config := DefaultSovereignConfig()
+	config.TalkersWindow = time.Hour
+	config.TalkersDominantShare = 0.5
+	config.TalkersMinBytes = 1
+	config.TalkersAction = "limit"
+	assert.NoError(b.setupTalkers(&config))
+	config.TalkersAction = "ignore"
+	assert.Error(b.setupTalkers(&config))
+	config.TalkersAction = "limit"
+	assert.NoError(b.setupTalkers(&config))
+
+	c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum([]byte("commit"))
+	assert.NoError(err)
+	commit := func(did string, size int) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{Repo: did, Commit: lexutil.LexLink(c), Blocks: make([]byte, size)}}
+	}
+	ca := &models.PDS{Host: "pds.example.ca"}
+	b.countTalker(ca, commit("did:plc:bulk", 4000))
+	b.countTalker(ca, commit("did:plc:alice", 100))
+	b.countTalker(&models.PDS{Host: "pds.example.com"}, commit("did:plc:bob", 100))
+	b.countTalker(ca, &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}})
+
+	// the bulk account dominated from its first event
+	assert.True(b.talkers.Limited("did:plc:bulk"))
+	assert.False(b.sovereignFilter(commit("did:plc:bulk", 1), nil).Include)
+
+	rec, err := get("/admin/sovereignty/talkers?limit=2")
+	assert.NoError(err)
+	var resp topTalkersResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(float64(3600), resp.Window)
+	assert.Equal(int64(3), resp.Total.Events)
+	if assert.Len(resp.Talkers, 2) {
+		assert.Equal("did:plc:bulk", resp.Talkers[0].Key)
+		assert.Equal(talkers.ActionLimit, resp.Talkers[0].Action)
+		assert.Greater(resp.Talkers[0].Bytes, int64(4000))
+	}
+	assert.Equal(map[string]talkers.Action{"did:plc:bulk": talkers.ActionLimit}, resp.Dominant)
+
+	rec, err = get("/admin/sovereignty/talkers?kind=pds&by=events")
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	if assert.Len(resp.Talkers, 2) {
+		assert.Equal("pds.example.ca", resp.Talkers[0].Key)
+		assert.Equal(int64(2), resp.Talkers[0].Events)
+	}
+
+	for _, q := range []string{"kind=repo", "by=size", "limit=0"} {
+		_, err = get("/admin/sovereignty/talkers?" + q)
+		assert.Error(err, q)
+	}
+}
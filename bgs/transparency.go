@@ -0,0 +1,170 @@
+package bgs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// longest appeal message accepted from users
+const maxAppealMessage = 2000
+
+// serviceAuthDID validates the request's inter-service auth token for the given XRPC method, returning the caller's DID
+func (bgs *BGS) serviceAuthDID(e echo.Context, method string) (syntax.DID, error) {
+	hdr := e.Request().Header.Get("Authorization")
+	token, ok := strings.CutPrefix(hdr, "Bearer ")
+	if !ok || token == "" {
+		return "", &echo.HTTPError{
+			Code:    401,
+			Message: "atproto service auth required",
+		}
+	}
+	lxm := syntax.NSID(method)
+	did, err := bgs.serviceAuth.Validate(e.Request().Context(), token, &lxm)
+	if err != nil {
+		return "", &echo.HTTPError{
+			Code:    401,
+			Message: fmt.Sprintf("invalid service auth: %s", err),
+		}
+	}
+	return did, nil
+}
+
+// AccountStanding explains whether the account is carried on the sovereign stream, in the configured language
+func (bgs *BGS) AccountStanding(did string) sovereignty.Standing {
+	return bgs.accountStanding(did, bgs.lang)
+}
+
+func (bgs *BGS) accountStanding(did string, lang i18n.Lang) sovereignty.Standing {
+	pol := bgs.policy.Load().forDID(did)
+	in := sovereignty.StandingInput{
+		DID:                did,
+		StreamCountries:    pol.streamCountries,
+		StreamSubdivisions: pol.streamSubdivisions,
+		ExcludeCountries:   pol.excludeCountries,
+		Priority:           bgs.Priority.IsPriority(did),
+		ListedIn:           bgs.listedIn(did),
+		ListedOut:          bgs.listedOut(did),
+		Lang:               lang,
+	}
+	if c, ok := bgs.Classifications.Get(did); ok {
+		in.Classification = &c
+	}
+	if bgs.minors != nil {
+		in.HashOnly = bgs.minors.HashOnly(did) && bgs.features.Enabled(features.HashOnlyEmission)
+	}
+	in.IdentityFlags = bgs.plcAuditFlags(did)
+	return sovereignty.Explain(in)
+}
+
+// handleGetStanding serves ca.gander.sovereignty.getStanding: the authenticated account's classification, the signals behind it, and any open appeal
+func (bgs *BGS) handleGetStanding(e echo.Context) error {
+	did, err := bgs.serviceAuthDID(e, "ca.gander.sovereignty.getStanding")
+	if err != nil {
+		return err
+	}
+	lang := bgs.requestLang(e)
+	out := struct {
+		sovereignty.Standing
+		PendingAppeal *uint `json:"pendingAppeal,omitempty"`
+	}{Standing: bgs.accountStanding(did.String(), lang)}
+	e.Response().Header().Set("Content-Language", string(lang))
+
+	appeal, err := bgs.pendingAppeal(e.Request().Context(), bgs.db, did.String(), "")
+	if err != nil {
+		return err
+	}
+	if appeal != nil {
+		out.PendingAppeal = &appeal.ID
+	}
+	return e.JSON(200, out)
+}
+
+type submitAppealBody struct {
+	// "classification" (default) or "takedown"
+	Kind string `json:"kind"`
+	// requested country for classification appeals; empty asks to not be classified
+	Country string `json:"country"`
+	Message string `json:"message"`
+}
+
+// handleSubmitAppeal serves ca.gander.sovereignty.submitAppeal, queueing a classification correction or takedown appeal for review
+func (bgs *BGS) handleSubmitAppeal(e echo.Context) error {
+	did, err := bgs.serviceAuthDID(e, "ca.gander.sovereignty.submitAppeal")
+	if err != nil {
+		return err
+	}
+	var body submitAppealBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if len(body.Message) > maxAppealMessage {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("message must be at most %d bytes", maxAppealMessage),
+		}
+	}
+
+	ctx := e.Request().Context()
+	appeal := models.Appeal{
+		Did:     did.String(),
+		Kind:    body.Kind,
+		Message: body.Message,
+	}
+	switch body.Kind {
+	case "", AppealKindClassification:
+		appeal.Kind = AppealKindClassification
+		if body.Country != "" {
+			appeal.RequestedCountry, err = sovereignty.NormalizeCountry(body.Country)
+			if err != nil {
+				return &echo.HTTPError{
+					Code:    400,
+					Message: err.Error(),
+				}
+			}
+		}
+		if c, ok := bgs.Classifications.Get(did.String()); ok {
+			appeal.CurrentCountry = c.Country
+		}
+	case AppealKindTakedown:
+		u, err := bgs.lookupUserByDid(ctx, did.String())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if u == nil || !u.GetTakenDown() {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "account is not taken down",
+			}
+		}
+	default:
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("unknown appeal kind: %q", body.Kind),
+		}
+	}
+
+	if err := bgs.SubmitAppeal(ctx, &appeal, e.RealIP()); err != nil {
+		if errors.Is(err, ErrAppealPending) {
+			return &echo.HTTPError{
+				Code:    409,
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"id":     appeal.ID,
+		"status": appeal.Status,
+	})
+}
@@ -0,0 +1,69 @@
+package bgs
+
+import (
+	"github.com/bluesky-social/indigo/sovereignty/verify"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setupVerification puts the external verification service behind the country resolver, to be asked about the accounts it has no answer for
+func (bgs *BGS) setupVerification(config *SovereignConfig) error {
+	opts := verify.DefaultOptions()
+	opts.URL = config.VerificationURL
+	if config.VerificationToken != "" {
+		opts.Headers = map[string]string{"Authorization": "Bearer " + config.VerificationToken}
+	}
+	opts.Timeout = config.VerificationTimeout
+	opts.Failures = config.VerificationFailures
+	opts.Cooldown = config.VerificationCooldown
+	opts.CacheTTL = config.VerificationCacheTTL
+	opts.UnknownTTL = config.VerificationUnknownTTL
+	opts.Client = bgs.httpClients.Get(httpprofile.Interactive)
+	opts.Clock = bgs.clock
+	v, err := verify.NewVerifier(opts)
+	if err != nil {
+		return err
+	}
+	bgs.verifier = v
+	bgs.countryResolver = verify.Fallback(bgs.countryResolver, v)
+	return nil
+}
+
+// handleAdminVerificationStatus reports whether the verification service is being asked, or the relay has stopped asking it after failures
+func (bgs *BGS) handleAdminVerificationStatus(e echo.Context) error {
+	if bgs.verifier == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "external verification is not enabled",
+		}
+	}
+	return e.JSON(200, bgs.verifier.Status())
+}
+
+type forgetVerificationBody struct {
+	Did string `json:"did"`
+}
+
+// handleAdminForgetVerification drops the cached verdict on an account, so the verification service is asked again the next time the account needs resolving
+func (bgs *BGS) handleAdminForgetVerification(e echo.Context) error {
+	if bgs.verifier == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "external verification is not enabled",
+		}
+	}
+	var body forgetVerificationBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify did in body",
+		}
+	}
+	bgs.verifier.Forget(body.Did)
+	bgs.log.Info("verification verdict forgotten", "did", body.Did)
+	return e.JSON(200, map[string]any{"success": true})
+}
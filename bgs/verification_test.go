@@ -0,0 +1,77 @@
+package bgs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/verify"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalVerification(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	b := newTestBGS(t)
+	e := echo.New()
+
+	call := func(method, target, body string, h echo.HandlerFunc) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	_, err := call("GET", "/admin/sovereignty/verification", "", b.handleAdminVerificationStatus)
+	assert.Error(err)
+
+	asked := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked++
+		assert.Equal("Bearer secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"country": "CA"}`))
+	}))
+	defer srv.Close()
+
+	// the resolver chain knows nothing
+	b.countryResolver = sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		return "", sovereignty.ConfidenceNone, sovereignty.ErrCountryUnknown
+	})
+	config := DefaultSovereignConfig()
+	config.VerificationURL = srv.URL
+	config.VerificationToken = "secret"
+	assert.NoError(b.setupVerification(&config))
+
+	res, applied, err := b.ResolveCountry(ctx, "did:plc:gov", false)
+	assert.NoError(err)
+	assert.True(applied)
+	assert.Equal(verify.SourceVerification, res.Source)
+	cl, ok := b.Classifications.Get("did:plc:gov")
+	assert.True(ok)
+	assert.Equal("CA", cl.Country)
+	assert.Equal(sovereignty.ConfidenceHigh, cl.Confidence)
+
+	// the verdict is cached, until forgotten
+	_, _, err = b.ResolveCountry(ctx, "did:plc:gov", false)
+	assert.NoError(err)
+	assert.Equal(1, asked)
+	_, err = call("POST", "/admin/sovereignty/verification/forget", `{}`, b.handleAdminForgetVerification)
+	assert.Error(err)
+	_, err = call("POST", "/admin/sovereignty/verification/forget", `{"did": "did:plc:gov"}`, b.handleAdminForgetVerification)
+	assert.NoError(err)
+	_, _, err = b.ResolveCountry(ctx, "did:plc:gov", false)
+	assert.NoError(err)
+	assert.Equal(2, asked)
+
+	rec, err := call("GET", "/admin/sovereignty/verification", "", b.handleAdminVerificationStatus)
+	assert.NoError(err)
+	var st verify.Status
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &st))
+	assert.Equal(verify.CircuitClosed, st.Circuit)
+	assert.Equal(1, st.Cached)
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/keymgmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
@@ -66,6 +67,12 @@ type FileCarStore struct {
 
 	lastShardCache lastShardCache
 
+	// set to encrypt shards at rest
+	keys *keymgmt.Keyring
+
+	// set to migrate old shards to a cold store
+	tiers *Tiering
+
 	log *slog.Logger
 }
 
@@ -115,6 +122,11 @@ type userView struct {
 
 	cache    map[cid.Cid]blockformat.Block
 	prefetch bool
+
+	// for reading sealed shards
+	keys *keymgmt.Keyring
+	// for reading shards in the cold store
+	tiers *Tiering
 }
 
 var _ blockstore.Blockstore = (*userView)(nil)
@@ -167,32 +179,31 @@ func (uv *userView) Get(ctx context.Context, k cid.Cid) (blockformat.Block, erro
 	}
 
 	if prefetch {
-		return uv.prefetchRead(ctx, k, path, offset)
+		return uv.prefetchRead(ctx, k, path, offset, user)
 	} else {
-		return uv.singleRead(ctx, k, path, offset)
+		return uv.singleRead(ctx, k, path, offset, user)
 	}
 }
 
 const prefetchThreshold = 512 << 10
 
-func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, offset int64) (blockformat.Block, error) {
+func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, offset int64, user models.Uid) (blockformat.Block, error) {
 	ctx, span := otel.Tracer("carstore").Start(ctx, "getLastShard")
 	defer span.End()
 
-	fi, err := os.Open(path)
+	path, err := uv.tiers.localPath(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	defer fi.Close()
-
-	st, err := fi.Stat()
+	fi, size, err := openShard(uv.keys, path, user)
 	if err != nil {
-		return nil, fmt.Errorf("stat file for prefetch: %w", err)
+		return nil, err
 	}
+	defer fi.Close()
 
-	span.SetAttributes(attribute.Int64("shard_size", st.Size()))
+	span.SetAttributes(attribute.Int64("shard_size", size))
 
-	if st.Size() > prefetchThreshold {
+	if size > prefetchThreshold {
 		span.SetAttributes(attribute.Bool("no_prefetch", true))
 		return doBlockRead(fi, k, offset)
 	}
@@ -222,8 +233,12 @@ func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, of
 	return outblk, nil
 }
 
-func (uv *userView) singleRead(ctx context.Context, k cid.Cid, path string, offset int64) (blockformat.Block, error) {
-	fi, err := os.Open(path)
+func (uv *userView) singleRead(ctx context.Context, k cid.Cid, path string, offset int64, user models.Uid) (blockformat.Block, error) {
+	path, err := uv.tiers.localPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	fi, _, err := openShard(uv.keys, path, user)
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +247,7 @@ func (uv *userView) singleRead(ctx context.Context, k cid.Cid, path string, offs
 	return doBlockRead(fi, k, offset)
 }
 
-func doBlockRead(fi *os.File, k cid.Cid, offset int64) (blockformat.Block, error) {
+func doBlockRead(fi io.ReadSeeker, k cid.Cid, offset int64) (blockformat.Block, error) {
 	seeked, err := fi.Seek(offset, io.SeekStart)
 	if err != nil {
 		return nil, err
@@ -340,6 +355,8 @@ func (cs *FileCarStore) NewDeltaSession(ctx context.Context, user models.Uid, si
 			cs:       cs.meta,
 			prefetch: true,
 			cache:    make(map[cid.Cid]blockformat.Block),
+			keys:     cs.keys,
+			tiers:    cs.tiers,
 		},
 		user:    user,
 		baseCid: lastShard.Root.CID,
@@ -356,6 +373,8 @@ func (cs *FileCarStore) ReadOnlySession(user models.Uid) (*DeltaSession, error)
 			cs:       cs.meta,
 			prefetch: false,
 			cache:    make(map[cid.Cid]blockformat.Block),
+			keys:     cs.keys,
+			tiers:    cs.tiers,
 		},
 		readonly: true,
 		user:     user,
@@ -415,7 +434,11 @@ func (cs *FileCarStore) writeShardBlocks(ctx context.Context, sh *CarShard, shar
 	ctx, span := otel.Tracer("carstore").Start(ctx, "writeShardBlocks")
 	defer span.End()
 
-	fi, err := os.Open(sh.Path)
+	path, err := cs.tiers.localPath(ctx, sh.Path)
+	if err != nil {
+		return err
+	}
+	fi, _, err := openShard(cs.keys, path, sh.Usr)
 	if err != nil {
 		return err
 	}
@@ -436,7 +459,11 @@ func (cs *FileCarStore) writeShardBlocks(ctx context.Context, sh *CarShard, shar
 
 // inner loop part of compactBucket
 func (cs *FileCarStore) iterateShardBlocks(ctx context.Context, sh *CarShard, cb func(blk blockformat.Block) error) error {
-	fi, err := os.Open(sh.Path)
+	path, err := cs.tiers.localPath(ctx, sh.Path)
+	if err != nil {
+		return err
+	}
+	fi, _, err := openShard(cs.keys, path, sh.Usr)
 	if err != nil {
 		return err
 	}
@@ -558,6 +585,11 @@ func (cs *FileCarStore) writeNewShardFile(ctx context.Context, user models.Uid,
 	_, span := otel.Tracer("carstore").Start(ctx, "writeNewShardFile")
 	defer span.End()
 
+	data, err := cs.sealShard(data, user)
+	if err != nil {
+		return "", fmt.Errorf("encrypting shard: %w", err)
+	}
+
 	// TODO: some overwrite protections
 	fname := filepath.Join(cs.dirForUser(user), fnameForShard(user, seq))
 	if err := os.WriteFile(fname, data, 0664); err != nil {
@@ -568,6 +600,9 @@ func (cs *FileCarStore) writeNewShardFile(ctx context.Context, user models.Uid,
 }
 
 func (cs *FileCarStore) deleteShardFile(ctx context.Context, sh *CarShard) error {
+	if isColdPath(sh.Path) {
+		return cs.tiers.delete(ctx, sh.Path)
+	}
 	return os.Remove(sh.Path)
 }
 
@@ -840,6 +875,11 @@ func (cs *FileCarStore) GetUserRepoRev(ctx context.Context, user models.Uid) (st
 	return lastShard.Rev, nil
 }
 
+// CommitForRev returns the user's commit with the given rev, if its shard is still around. Returns cid.Undef if it isn't; only the latest commit of compacted shards is kept.
+func (cs *FileCarStore) CommitForRev(ctx context.Context, user models.Uid, rev string) (cid.Cid, error) {
+	return cs.meta.RootForRev(ctx, user, rev)
+}
+
 type UserStat struct {
 	Seq     int
 	Root    string
@@ -1081,6 +1121,12 @@ func (cs *FileCarStore) CompactUserShards(ctx context.Context, user models.Uid,
 		return nil, err
 	}
 
+	// cold shards are left where they are: compacting them would pull old
+	// history back onto local disk. They are the oldest, so this mostly
+	// trims a prefix, the same as skipping big shards below
+	shards, cold := hotShards(shards)
+	span.SetAttributes(attribute.Int("coldShards", cold))
+
 	if skipBigShards {
 		// Since we generally expect shards to start bigger and get smaller,
 		// and because we want to avoid compacting non-adjacent shards
@@ -1335,7 +1381,15 @@ func (cs *FileCarStore) compactBucket(ctx context.Context, user models.Uid, b *c
 	defer fi.Close()
 	root := lastsh.Root.CID
 
-	hnw, err := WriteCarHeader(fi, root)
+	// sealed shards are encrypted as a whole, so they are built up in memory first
+	var w io.Writer = fi
+	var sealbuf *bytes.Buffer
+	if cs.keys != nil {
+		sealbuf = new(bytes.Buffer)
+		w = sealbuf
+	}
+
+	hnw, err := WriteCarHeader(w, root)
 	if err != nil {
 		return err
 	}
@@ -1351,7 +1405,7 @@ func (cs *FileCarStore) compactBucket(ctx context.Context, user models.Uid, b *c
 			}
 
 			if keep[blk.Cid()] {
-				nw, err := LdWrite(fi, blk.Cid().Bytes(), blk.RawData())
+				nw, err := LdWrite(w, blk.Cid().Bytes(), blk.RawData())
 				if err != nil {
 					return fmt.Errorf("failed to write block: %w", err)
 				}
@@ -1372,6 +1426,16 @@ func (cs *FileCarStore) compactBucket(ctx context.Context, user models.Uid, b *c
 		}
 	}
 
+	if sealbuf != nil {
+		sealed, err := cs.sealShard(sealbuf.Bytes(), user)
+		if err != nil {
+			return fmt.Errorf("encrypting shard: %w", err)
+		}
+		if _, err := fi.Write(sealed); err != nil {
+			return err
+		}
+	}
+
 	shard := CarShard{
 		Root:      models.DbCID{CID: root},
 		DataStart: hnw,
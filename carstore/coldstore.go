@@ -0,0 +1,148 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ColdStore is an object store that holds shard files migrated off local disk. Names may contain slashes.
+//
+// Get must return an error satisfying os.IsNotExist for missing objects (eg, an *fs.PathError wrapping fs.ErrNotExist), and Delete of a missing object is not an error.
+type ColdStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// DirColdStore keeps cold shards in a local directory, typically a mount of slower or cheaper storage.
+type DirColdStore struct {
+	Dir string
+}
+
+func (s *DirColdStore) Put(ctx context.Context, name string, data []byte) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+	// write to a temporary file and rename, so readers never observe a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DirColdStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(name)))
+}
+
+func (s *DirColdStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// HTTPColdStore keeps cold shards behind an HTTP endpoint, with PUT, GET and DELETE requests relative to a base URL. This works with S3-compatible object stores (behind pre-signed or proxy auth), WebDAV, and similar.
+type HTTPColdStore struct {
+	BaseURL string
+	Client  *http.Client
+	// optional extra headers (eg, "Authorization") to include in every request
+	Headers map[string]string
+}
+
+func (s *HTTPColdStore) Put(ctx context.Context, name string, data []byte) error {
+	req, err := s.newRequest(ctx, http.MethodPut, name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("cold store upload failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPColdStore) Get(ctx context.Context, name string) ([]byte, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: "get", Path: name, Err: fs.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cold store fetch failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *HTTPColdStore) Delete(ctx context.Context, name string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("cold store delete failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPColdStore) newRequest(ctx context.Context, method, name string, body io.Reader) (*http.Request, error) {
+	u := strings.TrimSuffix(s.BaseURL, "/") + "/" + name
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (s *HTTPColdStore) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
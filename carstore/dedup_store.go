@@ -0,0 +1,526 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-libipfs/blocks"
+	"github.com/ipld/go-car"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DedupStore keeps each distinct block once, however many repos it appears in. Common records, MST nodes and the like are shared between accounts, so across a full network mirror this takes far less space than storing every repo separately.
+//
+// Blocks live in a content-addressed table with a count of the repos referencing them. Each repo has its own table of references, which are added as commits arrive, and dropped for blocks a commit removes or when the repo is wiped. Blocks whose count reaches zero stay in place until the next GC, so a block that comes back in the meantime is just referenced again.
+//
+// Like SQLiteStore, metadata and blocks are kept in a local sqlite3 database.
+type DedupStore struct {
+	dbPath string
+	db     *sql.DB
+
+	log *slog.Logger
+
+	lastShardCache lastShardCache
+}
+
+// DedupStats describes how much space deduplication is saving
+type DedupStats struct {
+	// distinct blocks stored
+	Blocks int64 `json:"blocks"`
+	// references from repos to blocks
+	Refs int64 `json:"refs"`
+	// blocks no repo references any more, awaiting GC
+	Unreferenced int64 `json:"unreferenced"`
+	// bytes of block data stored
+	PhysicalBytes int64 `json:"physicalBytes"`
+	// bytes of block data there would be if every repo kept its own copy
+	LogicalBytes int64 `json:"logicalBytes"`
+}
+
+// SavedBytes is the storage deduplication avoids
+func (st *DedupStats) SavedBytes() int64 {
+	return st.LogicalBytes - st.PhysicalBytes
+}
+
+func NewDedupStore(csdir string) (*DedupStore, error) {
+	if err := ensureDir(csdir); err != nil {
+		return nil, err
+	}
+	out := new(DedupStore)
+	if err := out.Open(filepath.Join(csdir, "dedup.sqlite3")); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (ds *DedupStore) Open(path string) error {
+	if ds.log == nil {
+		ds.log = slog.Default().With("system", "carstore")
+	}
+	ds.log.Debug("open db", "path", path)
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=10000&_journal_mode=WAL")
+	if err != nil {
+		return fmt.Errorf("%s: sqlite could not open, %w", path, err)
+	}
+	ds.db = db
+	ds.dbPath = path
+	if err := ds.createTables(); err != nil {
+		return fmt.Errorf("%s: sqlite could not create tables, %w", path, err)
+	}
+	ds.lastShardCache.source = ds
+	ds.lastShardCache.Init()
+	return nil
+}
+
+func (ds *DedupStore) createTables() error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS dedup_blocks (cid blob PRIMARY KEY, block blob NOT NULL, size int NOT NULL, refs int NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS dedup_blocks_by_refs ON dedup_blocks (refs)",
+		"CREATE TABLE IF NOT EXISTS dedup_refs (uid int, cid blob, rev varchar, PRIMARY KEY(uid,cid))",
+		"CREATE INDEX IF NOT EXISTS dedup_refs_by_rev ON dedup_refs (uid, rev DESC)",
+		"CREATE TABLE IF NOT EXISTS dedup_heads (uid int PRIMARY KEY, seq int, rev varchar, root blob)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("%s: %s, %w", ds.dbPath, stmt, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// writeNewShard needed for DeltaSession.CloseWithRoot
+func (ds *DedupStore) writeNewShard(ctx context.Context, root cid.Cid, rev string, user models.Uid, seq int, blks map[cid.Cid]blockformat.Block, rmcids map[cid.Cid]bool) ([]byte, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "writeNewShard")
+	defer span.End()
+	span.SetAttributes(attribute.Int("blocks", len(blks)), attribute.Int("removed", len(rmcids)))
+
+	buf := new(bytes.Buffer)
+	if _, err := WriteCarHeader(buf, root); err != nil {
+		return nil, fmt.Errorf("failed to write car header: %w", err)
+	}
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dedup write tx, %w", err)
+	}
+	defer tx.Rollback()
+
+	for rc := range rmcids {
+		if _, ok := blks[rc]; ok {
+			continue
+		}
+		if err := ds.dropRef(ctx, tx, user, rc); err != nil {
+			return nil, err
+		}
+	}
+
+	var added, deduped int
+	for bcid, block := range blks {
+		if _, err := LdWrite(buf, bcid.Bytes(), block.RawData()); err != nil {
+			return nil, fmt.Errorf("failed to write block: %w", err)
+		}
+
+		dbcid := models.DbCID{CID: bcid}
+		res, err := tx.ExecContext(ctx, "UPDATE dedup_refs SET rev = ? WHERE uid = ? AND cid = ?", rev, user, dbcid)
+		if err != nil {
+			return nil, fmt.Errorf("dedup ref update, %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			// the repo already references the block
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO dedup_refs (uid, cid, rev) VALUES (?, ?, ?)", user, dbcid, rev); err != nil {
+			return nil, fmt.Errorf("dedup ref insert, %w", err)
+		}
+
+		data := block.RawData()
+		res, err = tx.ExecContext(ctx, "INSERT INTO dedup_blocks (cid, block, size, refs) VALUES (?, ?, ?, 1) ON CONFLICT (cid) DO NOTHING", dbcid, data, len(data))
+		if err != nil {
+			return nil, fmt.Errorf("dedup block insert, %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE dedup_blocks SET refs = refs + 1 WHERE cid = ?", dbcid); err != nil {
+			return nil, fmt.Errorf("dedup block ref, %w", err)
+		}
+		deduped++
+		dedupBytesAvoided.Add(float64(len(data)))
+	}
+
+	dbroot := models.DbCID{CID: root}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO dedup_heads (uid, seq, rev, root) VALUES (?, ?, ?, ?) ON CONFLICT (uid) DO UPDATE SET seq=excluded.seq, rev=excluded.rev, root=excluded.root", user, seq, rev, dbroot); err != nil {
+		return nil, fmt.Errorf("dedup head update, %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("dedup write commit, %w", err)
+	}
+	dedupBlockWrites.WithLabelValues("new").Add(float64(added))
+	dedupBlockWrites.WithLabelValues("dedup").Add(float64(deduped))
+	ds.log.Debug("write shard", "uid", user, "root", root, "rev", rev, "new", added, "dedup", deduped, "removed", len(rmcids))
+
+	ds.lastShardCache.put(&CarShard{
+		Root: dbroot,
+		Seq:  seq,
+		Usr:  user,
+		Rev:  rev,
+	})
+
+	return buf.Bytes(), nil
+}
+
+// dropRef removes a repo's reference to a block, if it has one
+func (ds *DedupStore) dropRef(ctx context.Context, tx *sql.Tx, user models.Uid, k cid.Cid) error {
+	dbcid := models.DbCID{CID: k}
+	res, err := tx.ExecContext(ctx, "DELETE FROM dedup_refs WHERE uid = ? AND cid = ?", user, dbcid)
+	if err != nil {
+		return fmt.Errorf("dedup ref delete, %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE dedup_blocks SET refs = refs - 1 WHERE cid = ?", dbcid); err != nil {
+		return fmt.Errorf("dedup block unref, %w", err)
+	}
+	return nil
+}
+
+// GetLastShard needed for NewDeltaSession indirectly through lastShardCache. There are no shards as such; this is the repo's head
+func (ds *DedupStore) GetLastShard(ctx context.Context, uid models.Uid) (*CarShard, error) {
+	var seq int
+	var rev string
+	var root models.DbCID
+	err := ds.db.QueryRowContext(ctx, "SELECT seq, rev, root FROM dedup_heads WHERE uid = ?", uid).Scan(&seq, &rev, &root)
+	if err == sql.ErrNoRows {
+		return &CarShard{Usr: uid}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dedup head, %w", err)
+	}
+	return &CarShard{
+		Root: root,
+		Seq:  seq,
+		Usr:  uid,
+		Rev:  rev,
+	}, nil
+}
+
+func (ds *DedupStore) CompactUserShards(ctx context.Context, user models.Uid, skipBigShards bool) (*CompactionStats, error) {
+	// blocks are already stored once each; unreferenced ones are removed by GC
+	return nil, nil
+}
+
+func (ds *DedupStore) GetCompactionTargets(ctx context.Context, shardCount int) ([]CompactionTarget, error) {
+	return nil, nil
+}
+
+func (ds *DedupStore) GetUserRepoHead(ctx context.Context, user models.Uid) (cid.Cid, error) {
+	head, err := ds.lastShardCache.get(ctx, user)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return head.Root.CID, nil
+}
+
+func (ds *DedupStore) GetUserRepoRev(ctx context.Context, user models.Uid) (string, error) {
+	head, err := ds.lastShardCache.get(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	return head.Rev, nil
+}
+
+func (ds *DedupStore) ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "ImportSlice")
+	defer span.End()
+
+	carr, err := car.NewCarReader(bytes.NewReader(carslice))
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	if len(carr.Header.Roots) != 1 {
+		return cid.Undef, nil, fmt.Errorf("invalid car file, header must have a single root (has %d)", len(carr.Header.Roots))
+	}
+
+	dsess, err := ds.NewDeltaSession(ctx, uid, since)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("new delta session failed: %w", err)
+	}
+
+	for {
+		blk, err := carr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return cid.Undef, nil, err
+		}
+
+		if err := dsess.Put(ctx, blk); err != nil {
+			return cid.Undef, nil, err
+		}
+	}
+
+	return carr.Header.Roots[0], dsess, nil
+}
+
+func (ds *DedupStore) NewDeltaSession(ctx context.Context, user models.Uid, since *string) (*DeltaSession, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "NewSession")
+	defer span.End()
+
+	head, err := ds.lastShardCache.get(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("NewDeltaSession, lsc, %w", err)
+	}
+
+	if since != nil && *since != head.Rev {
+		return nil, fmt.Errorf("revision mismatch: %s != %s: %w", *since, head.Rev, ErrRepoBaseMismatch)
+	}
+
+	return &DeltaSession{
+		blks: make(map[cid.Cid]blockformat.Block),
+		base: &sqliteUserView{
+			uid: user,
+			sqs: ds,
+		},
+		user:    user,
+		baseCid: head.Root.CID,
+		cs:      ds,
+		seq:     head.Seq + 1,
+		lastRev: head.Rev,
+	}, nil
+}
+
+func (ds *DedupStore) ReadOnlySession(user models.Uid) (*DeltaSession, error) {
+	return &DeltaSession{
+		base: &sqliteUserView{
+			uid: user,
+			sqs: ds,
+		},
+		readonly: true,
+		user:     user,
+		cs:       ds,
+	}, nil
+}
+
+// ReadUserCar writes the blocks the repo has referenced since sinceRev, newest first
+func (ds *DedupStore) ReadUserCar(ctx context.Context, user models.Uid, sinceRev string, incremental bool, shardOut io.Writer) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "ReadUserCar")
+	defer span.End()
+
+	head, err := ds.lastShardCache.get(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !head.Root.CID.Defined() {
+		return nil
+	}
+
+	rows, err := ds.db.QueryContext(ctx, "SELECT r.cid, b.block FROM dedup_refs r JOIN dedup_blocks b ON b.cid = r.cid WHERE r.uid = ? AND r.rev > ? ORDER BY r.rev DESC", user, sinceRev)
+	if err != nil {
+		return fmt.Errorf("rcar err, %w", err)
+	}
+	defer rows.Close()
+
+	if err := car.WriteHeader(&car.CarHeader{
+		Roots:   []cid.Cid{head.Root.CID},
+		Version: 1,
+	}, shardOut); err != nil {
+		return fmt.Errorf("rcar bad header, %w", err)
+	}
+	for rows.Next() {
+		var xcid models.DbCID
+		var xblock []byte
+		if err := rows.Scan(&xcid, &xblock); err != nil {
+			return fmt.Errorf("rcar bad scan, %w", err)
+		}
+		if _, err := LdWrite(shardOut, xcid.CID.Bytes(), xblock); err != nil {
+			return fmt.Errorf("rcar bad write, %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// Stat is only used in a debugging admin handler
+func (ds *DedupStore) Stat(ctx context.Context, usr models.Uid) ([]UserStat, error) {
+	return nil, nil
+}
+
+// WipeUserData drops all of a repo's references. Blocks no other repo references are removed at the next GC
+func (ds *DedupStore) WipeUserData(ctx context.Context, user models.Uid) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "WipeUserData")
+	defer span.End()
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("wipe tx, %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "UPDATE dedup_blocks SET refs = refs - 1 WHERE cid IN (SELECT cid FROM dedup_refs WHERE uid = ?)", user); err != nil {
+		return fmt.Errorf("wipe unref, %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dedup_refs WHERE uid = ?", user); err != nil {
+		return fmt.Errorf("wipe refs, %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dedup_heads WHERE uid = ?", user); err != nil {
+		return fmt.Errorf("wipe head, %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ds.lastShardCache.remove(user)
+	return nil
+}
+
+// GC deletes blocks no repo references any more, returning how many were deleted and their size
+func (ds *DedupStore) GC(ctx context.Context) (int64, int64, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "DedupGC")
+	defer span.End()
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("gc tx, %w", err)
+	}
+	defer tx.Rollback()
+	var n, size int64
+	if err := tx.QueryRowContext(ctx, "SELECT count(*), coalesce(sum(size), 0) FROM dedup_blocks WHERE refs <= 0").Scan(&n, &size); err != nil {
+		return 0, 0, fmt.Errorf("gc count, %w", err)
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dedup_blocks WHERE refs <= 0"); err != nil {
+		return 0, 0, fmt.Errorf("gc delete, %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	dedupBlocksCollected.Add(float64(n))
+	ds.log.Info("collected unreferenced blocks", "blocks", n, "bytes", size)
+	return n, size, nil
+}
+
+// Stats reports the store's deduplication savings, and updates the corresponding metrics
+func (ds *DedupStore) Stats(ctx context.Context) (*DedupStats, error) {
+	var st DedupStats
+	if err := ds.db.QueryRowContext(ctx, `SELECT count(*), coalesce(sum(refs), 0), coalesce(sum(CASE WHEN refs <= 0 THEN 1 ELSE 0 END), 0), coalesce(sum(size), 0), coalesce(sum(CASE WHEN refs > 0 THEN size * refs ELSE 0 END), 0) FROM dedup_blocks`).Scan(
+		&st.Blocks, &st.Refs, &st.Unreferenced, &st.PhysicalBytes, &st.LogicalBytes); err != nil {
+		return nil, fmt.Errorf("dedup stats, %w", err)
+	}
+	dedupPhysicalBytes.Set(float64(st.PhysicalBytes))
+	dedupLogicalBytes.Set(float64(st.LogicalBytes))
+	dedupUnreferencedBlocks.Set(float64(st.Unreferenced))
+	return &st, nil
+}
+
+// RunGC collects unreferenced blocks and refreshes the deduplication metrics every interval, until the context is cancelled
+func (ds *DedupStore) RunGC(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, _, err := ds.GC(ctx); err != nil {
+			ds.log.Error("dedup gc failed", "err", err)
+		}
+		if _, err := ds.Stats(ctx); err != nil {
+			ds.log.Error("dedup stats failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// HasUidCid needed for NewDeltaSession userView
+func (ds *DedupStore) HasUidCid(ctx context.Context, user models.Uid, bcid cid.Cid) (bool, error) {
+	var one int
+	err := ds.db.QueryRowContext(ctx, "SELECT 1 FROM dedup_refs WHERE uid = ? AND cid = ? LIMIT 1", user, models.DbCID{CID: bcid}).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("hasUC err, %w", err)
+	}
+	return true, nil
+}
+
+func (ds *DedupStore) CarStore() CarStore {
+	return ds
+}
+
+func (ds *DedupStore) Close() error {
+	return ds.db.Close()
+}
+
+func (ds *DedupStore) getBlock(ctx context.Context, user models.Uid, bcid cid.Cid) (blockformat.Block, error) {
+	var blockb []byte
+	err := ds.db.QueryRowContext(ctx, "SELECT b.block FROM dedup_refs r JOIN dedup_blocks b ON b.cid = r.cid WHERE r.uid = ? AND r.cid = ?", user, models.DbCID{CID: bcid}).Scan(&blockb)
+	if err == sql.ErrNoRows {
+		return nil, ErrNothingThere
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getb err, %w", err)
+	}
+	return blocks.NewBlockWithCid(blockb, bcid)
+}
+
+func (ds *DedupStore) getBlockSize(ctx context.Context, user models.Uid, bcid cid.Cid) (int64, error) {
+	var size int64
+	err := ds.db.QueryRowContext(ctx, "SELECT b.size FROM dedup_refs r JOIN dedup_blocks b ON b.cid = r.cid WHERE r.uid = ? AND r.cid = ?", user, models.DbCID{CID: bcid}).Scan(&size)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("getbs err, %w", err)
+	}
+	return size, nil
+}
+
+var dedupBlockWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "carstore_dedup_block_writes",
+	Help: "Blocks newly referenced by a repo in the dedup store, by whether they were new or already stored for another repo (new or dedup)",
+}, []string{"result"})
+
+var dedupBytesAvoided = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "carstore_dedup_bytes_avoided",
+	Help: "Bytes of block data not written because another repo already stored the block",
+})
+
+var dedupBlocksCollected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "carstore_dedup_blocks_collected",
+	Help: "Unreferenced blocks deleted by dedup store GC",
+})
+
+var dedupPhysicalBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "carstore_dedup_physical_bytes",
+	Help: "Bytes of block data stored by the dedup store",
+})
+
+var dedupLogicalBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "carstore_dedup_logical_bytes",
+	Help: "Bytes of block data the dedup store's repos would take if each kept its own copies",
+})
+
+var dedupUnreferencedBlocks = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "carstore_dedup_unreferenced_blocks",
+	Help: "Blocks in the dedup store no repo references, awaiting GC",
+})
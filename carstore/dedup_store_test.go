@@ -0,0 +1,109 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDedupStore(t testing.TB) (CarStore, func(), error) {
+	ds := &DedupStore{}
+	ds.log = slogForTest(t)
+	if err := ds.Open(filepath.Join(t.TempDir(), "dedup.sqlite3")); err != nil {
+		return nil, nil, err
+	}
+	return ds, func() { ds.Close() }, nil
+}
+
+// writeSameRepo gives user a repo holding the same posts as every other user written with it
+func writeSameRepo(t *testing.T, cs CarStore, user models.Uid, texts ...string) []cid.Cid {
+	ctx := context.Background()
+	ds, err := cs.NewDeltaSession(ctx, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := repo.NewRepo(ctx, "did:foo", ds)
+	var recs []cid.Cid
+	for _, text := range texts {
+		rc, _, err := rr.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: text, CreatedAt: "2026-01-01T00:00:00Z"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rc)
+	}
+	kmgr := &util.FakeKeyManager{}
+	head, rev, err := rr.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func TestDedupStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, cleanup, err := testDedupStore(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	ds := store.(*DedupStore)
+
+	recs := writeSameRepo(t, ds, 1, "hello", "world")
+	st, err := ds.Stats(ctx)
+	assert.NoError(err)
+	assert.Equal(st.Blocks, st.Refs)
+	assert.Zero(st.SavedBytes())
+
+	// a second repo with the same records shares their blocks
+	writeSameRepo(t, ds, 2, "hello", "world")
+	st2, err := ds.Stats(ctx)
+	assert.NoError(err)
+	assert.Less(st2.Blocks, st2.Refs)
+	assert.Less(st2.PhysicalBytes, 2*st.PhysicalBytes)
+	assert.Greater(st2.LogicalBytes, st2.PhysicalBytes)
+	assert.Positive(st2.SavedBytes())
+
+	// wiping one repo leaves the other intact; only the blocks unique to it become garbage
+	assert.NoError(ds.WipeUserData(ctx, 2))
+	st3, err := ds.Stats(ctx)
+	assert.NoError(err)
+	assert.Equal(st2.Blocks, st3.Blocks)
+	assert.Positive(st3.Unreferenced)
+	assert.Equal(st.LogicalBytes, st3.LogicalBytes)
+
+	n, size, err := ds.GC(ctx)
+	assert.NoError(err)
+	assert.Equal(st3.Unreferenced, n)
+	assert.Positive(size)
+	st4, err := ds.Stats(ctx)
+	assert.NoError(err)
+	assert.Equal(*st, *st4)
+
+	head, err := ds.GetUserRepoHead(ctx, 2)
+	assert.NoError(err)
+	assert.False(head.Defined())
+	buf := new(bytes.Buffer)
+	assert.NoError(ds.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, ds, buf, recs)
+
+	// wiping the last repo referencing the blocks lets GC remove them all
+	assert.NoError(ds.WipeUserData(ctx, 1))
+	_, _, err = ds.GC(ctx)
+	assert.NoError(err)
+	st5, err := ds.Stats(ctx)
+	assert.NoError(err)
+	assert.Zero(st5.Blocks)
+}
@@ -0,0 +1,169 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/keymgmt"
+)
+
+// SetKeyring enables encryption at rest: shard files written from now on are sealed under a fresh data key wrapped by the keyring. Shards are read transparently whether sealed or not, so existing plaintext shards stay readable, and are sealed when compaction rewrites them. Must be called before the carstore is used.
+func (cs *FileCarStore) SetKeyring(kr *keymgmt.Keyring) {
+	cs.keys = kr
+}
+
+// shardAAD binds a sealed shard to the account it belongs to
+func shardAAD(user models.Uid) []byte {
+	return []byte(fmt.Sprintf("carshard:%d", user))
+}
+
+// ErrNoKeyring is returned reading a sealed shard when no keyring is configured
+var ErrNoKeyring = errors.New("shard is encrypted, but no keyring is configured")
+
+type shardReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type sealedShard struct {
+	*bytes.Reader
+}
+
+func (ss sealedShard) Close() error {
+	return nil
+}
+
+// openShard opens a shard file for reading, decrypting it into memory if it is sealed. Offsets in the returned reader are those of the plaintext CAR, as recorded in block refs. Also returns the plaintext size
+func openShard(kr *keymgmt.Keyring, path string, user models.Uid) (shardReader, int64, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := fi.Stat()
+	if err != nil {
+		fi.Close()
+		return nil, 0, err
+	}
+
+	magic := make([]byte, 4)
+	if _, err := fi.ReadAt(magic, 0); err != nil && !errors.Is(err, io.EOF) {
+		fi.Close()
+		return nil, 0, err
+	}
+	if !keymgmt.IsSealed(magic) {
+		return fi, st.Size(), nil
+	}
+
+	defer fi.Close()
+	if kr == nil {
+		return nil, 0, fmt.Errorf("shard %s: %w", path, ErrNoKeyring)
+	}
+	sealed, err := io.ReadAll(fi)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := kr.Open(sealed, shardAAD(user))
+	if err != nil {
+		return nil, 0, fmt.Errorf("shard %s: %w", path, err)
+	}
+	return sealedShard{bytes.NewReader(data)}, int64(len(data)), nil
+}
+
+// sealShard returns the bytes to write out for a new shard, sealing it if a keyring is set
+func (cs *FileCarStore) sealShard(data []byte, user models.Uid) ([]byte, error) {
+	if cs.keys == nil {
+		return data, nil
+	}
+	return cs.keys.Seal(data, shardAAD(user))
+}
+
+// RewrapKeys re-wraps the data keys of sealed shards under the keyring's primary key, so keys rotated out of the keyring can be retired. Each affected shard file is rewritten with the new wrapped key, carrying its ciphertext over as it is. Returns the number of shards updated.
+func (cs *FileCarStore) RewrapKeys(ctx context.Context) (int, error) {
+	if cs.keys == nil {
+		return 0, fmt.Errorf("no keyring configured")
+	}
+
+	var n int
+	var last uint
+	for {
+		var shards []CarShard
+		if err := cs.meta.meta.WithContext(ctx).Select("id", "path").Where("id > ?", last).Order("id asc").Limit(1000).Find(&shards).Error; err != nil {
+			return n, err
+		}
+		if len(shards) == 0 {
+			break
+		}
+		for _, sh := range shards {
+			last = sh.ID
+			if isColdPath(sh.Path) {
+				// cold shards keep their wrapped key until they are promoted back to local disk
+				continue
+			}
+			changed, err := cs.rewrapShard(sh.Path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// compacted away since the listing
+					continue
+				}
+				return n, fmt.Errorf("shard %s: %w", sh.Path, err)
+			}
+			if changed {
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		cs.log.Info("re-wrapped shard data keys", "shards", n, "key", cs.keys.Primary())
+	}
+	return n, nil
+}
+
+func (cs *FileCarStore) rewrapShard(path string) (bool, error) {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if !keymgmt.IsSealed(sealed) {
+		return false, nil
+	}
+	resealed, changed, err := cs.keys.Reseal(sealed)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	// write alongside and swap in, so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".rewrap")
+	if err != nil {
+		return false, err
+	}
+	if err := tmp.Chmod(0664); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if _, err := tmp.Write(resealed); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
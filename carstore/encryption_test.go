@@ -0,0 +1,151 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/util/keymgmt"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyring(t testing.TB, primary string, ids ...string) *keymgmt.Keyring {
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), keymgmt.KeySize)
+	}
+	kr, err := keymgmt.NewKeyring(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func testEncryptedCarStore(t testing.TB) (CarStore, func(), error) {
+	cs, cleanup, err := testCarStore(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs.(*FileCarStore).SetKeyring(testKeyring(t, "k1", "k1"))
+	return cs, cleanup, nil
+}
+
+// writePosts commits a post per text to user 1's repo, returning the record cids
+func writePosts(t *testing.T, cs CarStore, head cid.Cid, rev string, texts ...string) (cid.Cid, string, []cid.Cid) {
+	ctx := context.Background()
+	var recs []cid.Cid
+	for _, text := range texts {
+		ds, err := cs.NewDeltaSession(ctx, 1, &rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr, err := repo.OpenRepo(ctx, ds, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, _, err := rr.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rc)
+		kmgr := &util.FakeKeyManager{}
+		head, rev, err = rr.Commit(ctx, kmgr.SignForUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.CalcDiff(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return head, rev, recs
+}
+
+func TestEncryptedShards(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, cleanup, err := testCarStore(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	cs := store.(*FileCarStore)
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, rev, err := setupRepo(ctx, ds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	// shards written before encryption was enabled stay readable alongside sealed ones
+	head, rev, recs := writePosts(t, cs, head, rev, "plaintext post")
+	cs.SetKeyring(testKeyring(t, "k1", "k1"))
+	_, _, more := writePosts(t, cs, head, rev, "secret post one", "secret post two")
+	recs = append(recs, more...)
+
+	shardFiles := func() [][]byte {
+		var shards []CarShard
+		if err := cs.meta.meta.Order("id asc").Find(&shards).Error; err != nil {
+			t.Fatal(err)
+		}
+		var out [][]byte
+		for _, sh := range shards {
+			b, err := os.ReadFile(sh.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, b)
+		}
+		return out
+	}
+	files := shardFiles()
+	assert.Len(files, 4)
+	assert.True(bytes.Contains(files[1], []byte("plaintext post")))
+	assert.True(keymgmt.IsSealed(files[2]))
+	assert.False(bytes.Contains(files[2], []byte("secret post")))
+
+	buf := new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+
+	// rotate, then re-wrap so the old key can be retired
+	cs.SetKeyring(testKeyring(t, "k2", "k1", "k2"))
+	n, err := cs.RewrapKeys(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	n, err = cs.RewrapKeys(ctx)
+	assert.NoError(err)
+	assert.Equal(0, n)
+
+	cs.SetKeyring(testKeyring(t, "k2", "k2"))
+	buf = new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+
+	// compaction seals everything it rewrites
+	_, err = cs.CompactUserShards(ctx, 1, false)
+	assert.NoError(err)
+	for _, b := range shardFiles() {
+		assert.True(keymgmt.IsSealed(b))
+	}
+	buf = new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+
+	cs.SetKeyring(nil)
+	assert.Error(cs.ReadUserCar(ctx, 1, "", true, new(bytes.Buffer)))
+}
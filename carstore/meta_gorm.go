@@ -112,6 +112,18 @@ func (cs *CarStoreGormMeta) SeqForRev(ctx context.Context, user models.Uid, sinc
 	return untilShard.Seq, nil
 }
 
+// RootForRev returns the commit of the user's shard with exactly the given rev, or cid.Undef if there is none (eg, it was compacted into a later shard)
+func (cs *CarStoreGormMeta) RootForRev(ctx context.Context, user models.Uid, rev string) (cid.Cid, error) {
+	var sh CarShard
+	if err := cs.meta.WithContext(ctx).Model(CarShard{}).Limit(1).Find(&sh, "usr = ? AND rev = ?", user, rev).Error; err != nil {
+		return cid.Undef, err
+	}
+	if sh.ID == 0 {
+		return cid.Undef, nil
+	}
+	return sh.Root.CID, nil
+}
+
 func (cs *CarStoreGormMeta) GetCompactionTargets(ctx context.Context, minShardCount int) ([]CompactionTarget, error) {
 	var targets []CompactionTarget
 	if err := cs.meta.Raw(`select usr, count(*) as num_shards from car_shards group by usr having count(*) > ? order by num_shards desc`, minShardCount).Scan(&targets).Error; err != nil {
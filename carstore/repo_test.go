@@ -74,8 +74,10 @@ func testSqliteCarStore(t testing.TB) (CarStore, func(), error) {
 type testFactory func(t testing.TB) (CarStore, func(), error)
 
 var backends = map[string]testFactory{
-	"cartore": testCarStore,
-	"sqlite":  testSqliteCarStore,
+	"cartore":   testCarStore,
+	"sqlite":    testSqliteCarStore,
+	"encrypted": testEncryptedCarStore,
+	"dedup":     testDedupStore,
 }
 
 func testFlatfsBs() (blockstore.Blockstore, func(), error) {
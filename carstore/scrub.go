@@ -0,0 +1,238 @@
+package carstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bluesky-social/indigo/util/keymgmt"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// ErrUnrecoverable is returned by RepairShard when a damaged block has no intact copy to restore it from
+var ErrUnrecoverable = errors.New("blocks could not be recovered")
+
+// ShardCheck is the result of verifying a shard file against its block refs
+type ShardCheck struct {
+	Shard  CarShard
+	Blocks int
+	// blocks whose bytes on disk are missing, unparseable, or don't hash to their CID
+	Corrupt []cid.Cid
+	// the CAR header doesn't parse
+	BadHeader bool
+	// the file as a whole couldn't be read: it is missing, or a sealed shard failed to decrypt. All of its blocks are listed as corrupt
+	Unreadable bool
+}
+
+// OK reports whether the shard verified clean
+func (sc *ShardCheck) OK() bool {
+	return len(sc.Corrupt) == 0 && !sc.BadHeader && !sc.Unreadable
+}
+
+// ListShards returns up to limit shards with ids above after, in id order, for walking the whole store in batches
+func (cs *FileCarStore) ListShards(ctx context.Context, after uint, limit int) ([]CarShard, error) {
+	var shards []CarShard
+	if err := cs.meta.meta.WithContext(ctx).Where("id > ?", after).Order("id asc").Limit(limit).Find(&shards).Error; err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+// shardFileError reports whether a failure opening a shard is a problem with the file itself, rather than with the relay's configuration
+func shardFileError(err error) bool {
+	return !errors.Is(err, ErrNoKeyring) && !errors.Is(err, keymgmt.ErrUnknownKey) && !errors.Is(err, os.ErrPermission)
+}
+
+// VerifyShard re-reads every block referenced from a shard and checks it hashes to its CID. Damage to the file is reported in the returned check; errors are only returned when the shard can't be checked at all, such as a missing encryption key.
+func (cs *FileCarStore) VerifyShard(ctx context.Context, sh *CarShard) (*ShardCheck, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "VerifyShard")
+	defer span.End()
+
+	refs, err := cs.meta.GetBlockRefsForShards(ctx, []uint{sh.ID})
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("blocks", len(refs)))
+
+	check := &ShardCheck{Shard: *sh, Blocks: len(refs)}
+
+	var fi shardReader
+	src, err := cs.tiers.localPath(ctx, sh.Path)
+	if err == nil {
+		fi, _, err = openShard(cs.keys, src, sh.Usr)
+	}
+	if err != nil {
+		if !shardFileError(err) {
+			return nil, err
+		}
+		if os.IsNotExist(err) {
+			// compacted away since it was listed
+			var n int64
+			if err := cs.meta.meta.WithContext(ctx).Model(&CarShard{}).Where("id = ?", sh.ID).Count(&n).Error; err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return &ShardCheck{Shard: *sh}, nil
+			}
+		}
+		cs.log.Warn("shard unreadable", "shard", sh.ID, "path", sh.Path, "err", err)
+		check.Unreadable = true
+		for _, ref := range refs {
+			check.Corrupt = append(check.Corrupt, ref.Cid.CID)
+		}
+		return check, nil
+	}
+	defer fi.Close()
+
+	if _, err := car.ReadHeader(bufio.NewReader(fi)); err != nil {
+		check.BadHeader = true
+	}
+
+	for _, ref := range refs {
+		if _, err := readVerifiedBlock(fi, ref.Cid.CID, ref.Offset); err != nil {
+			check.Corrupt = append(check.Corrupt, ref.Cid.CID)
+		}
+	}
+	return check, nil
+}
+
+// readVerifiedBlock is doBlockRead, additionally checking the block's data hashes to its CID
+func readVerifiedBlock(fi io.ReadSeeker, k cid.Cid, offset int64) (blockformat.Block, error) {
+	blk, err := doBlockRead(fi, k, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlock(k, blk.RawData()); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func verifyBlock(k cid.Cid, data []byte) error {
+	sum, err := k.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(k) {
+		return fmt.Errorf("block data does not match cid %s", k)
+	}
+	return nil
+}
+
+// RepairShard rewrites a shard, taking intact blocks from the shard file and corrupt or missing ones from good, which typically holds a copy of the repo fetched from elsewhere. Replacement blocks are hashed before use. Nothing is changed unless every block can be recovered, otherwise the error wraps ErrUnrecoverable. Returns the number of blocks replaced.
+func (cs *FileCarStore) RepairShard(ctx context.Context, sh *CarShard, good map[cid.Cid]blockformat.Block) (int, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "RepairShard")
+	defer span.End()
+
+	refs, err := cs.meta.GetBlockRefsForShards(ctx, []uint{sh.ID})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Offset < refs[j].Offset
+	})
+
+	var old shardReader
+	src, err := cs.tiers.localPath(ctx, sh.Path)
+	if err == nil {
+		old, _, err = openShard(cs.keys, src, sh.Usr)
+	}
+	if err == nil {
+		defer old.Close()
+	} else if !shardFileError(err) {
+		return 0, err
+	}
+
+	buf := new(bytes.Buffer)
+	hnw, err := WriteCarHeader(buf, sh.Root.CID)
+	if err != nil {
+		return 0, err
+	}
+
+	offsets := make([]int64, len(refs))
+	var replaced, missing int
+	for i, ref := range refs {
+		k := ref.Cid.CID
+		var blk blockformat.Block
+		if old != nil {
+			blk, _ = readVerifiedBlock(old, k, ref.Offset)
+		}
+		if blk == nil {
+			g, ok := good[k]
+			if !ok || verifyBlock(k, g.RawData()) != nil {
+				missing++
+				continue
+			}
+			blk = g
+			replaced++
+		}
+
+		offsets[i] = int64(buf.Len())
+		if _, err := LdWrite(buf, k.Bytes(), blk.RawData()); err != nil {
+			return 0, err
+		}
+	}
+	if missing > 0 {
+		return 0, fmt.Errorf("shard %d: %w: %d of %d", sh.ID, ErrUnrecoverable, missing, len(refs))
+	}
+
+	data, err := cs.sealShard(buf.Bytes(), sh.Usr)
+	if err != nil {
+		return 0, fmt.Errorf("encrypting shard: %w", err)
+	}
+	fi, path, err := cs.openNewCompactedShardFile(ctx, sh.Usr, sh.Seq)
+	if err != nil {
+		return 0, fmt.Errorf("opening new file: %w", err)
+	}
+	if _, err := fi.Write(data); err == nil {
+		err = fi.Sync()
+	}
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+
+	if err := cs.meta.meta.WithContext(ctx).Transaction(func(txn *gorm.DB) error {
+		// compaction may have replaced the shard while we were reading it
+		res := txn.Model(&CarShard{}).Where("id = ? AND path = ?", sh.ID, sh.Path).Updates(map[string]any{
+			"path":       path,
+			"data_start": hnw,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("shard %d changed during repair", sh.ID)
+		}
+		for i, ref := range refs {
+			if err := txn.Model(&blockRef{}).Where("id = ?", ref.ID).Update("offset", offsets[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+
+	cs.removeLastShardCache(sh.Usr)
+	if err := cs.deleteShardFile(ctx, sh); err != nil && !os.IsNotExist(err) {
+		cs.log.Error("failed to remove repaired shard file", "path", sh.Path, "err", err)
+	}
+	cs.log.Info("repaired shard", "shard", sh.ID, "uid", sh.Usr, "replaced", replaced, "path", path)
+	return replaced, nil
+}
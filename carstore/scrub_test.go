@@ -0,0 +1,132 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+func readCarBlocks(t *testing.T, r io.Reader) map[cid.Cid]blockformat.Block {
+	cr, err := car.NewCarReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[cid.Cid]blockformat.Block)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[blk.Cid()] = blk
+	}
+}
+
+func TestScrubShards(t *testing.T) {
+	for name, encrypted := range map[string]bool{"plain": false, "encrypted": true} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+
+			store, cleanup, err := testCarStore(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			cs := store.(*FileCarStore)
+			if encrypted {
+				cs.SetKeyring(testKeyring(t, "k1", "k1"))
+			}
+
+			ds, err := cs.NewDeltaSession(ctx, 1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, rev, err := setupRepo(ctx, ds, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+				t.Fatal(err)
+			}
+			_, _, recs := writePosts(t, cs, head, rev, "first post", "scrub me")
+
+			buf := new(bytes.Buffer)
+			assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+			good := readCarBlocks(t, bytes.NewReader(buf.Bytes()))
+
+			shards, err := cs.ListShards(ctx, 0, 100)
+			assert.NoError(err)
+			assert.Len(shards, 3)
+			for _, sh := range shards {
+				check, err := cs.VerifyShard(ctx, &sh)
+				assert.NoError(err)
+				assert.True(check.OK())
+				assert.NotZero(check.Blocks)
+			}
+			more, err := cs.ListShards(ctx, shards[1].ID, 100)
+			assert.NoError(err)
+			assert.Len(more, 1)
+
+			// flip a byte in the last shard
+			sh := shards[2]
+			raw, err := os.ReadFile(sh.Path)
+			assert.NoError(err)
+			if encrypted {
+				raw[len(raw)-1] ^= 0xff
+			} else {
+				i := bytes.Index(raw, []byte("scrub me"))
+				assert.True(i > 0)
+				raw[i] ^= 0xff
+			}
+			assert.NoError(os.WriteFile(sh.Path, raw, 0664))
+
+			check, err := cs.VerifyShard(ctx, &sh)
+			assert.NoError(err)
+			assert.False(check.OK())
+			assert.Equal(encrypted, check.Unreadable)
+			if encrypted {
+				assert.Len(check.Corrupt, check.Blocks)
+			} else {
+				assert.Equal([]cid.Cid{recs[1]}, check.Corrupt)
+			}
+
+			// nothing changes unless every block can be recovered
+			_, err = cs.RepairShard(ctx, &sh, nil)
+			assert.ErrorIs(err, ErrUnrecoverable)
+			_, err = os.Stat(sh.Path)
+			assert.NoError(err)
+
+			n, err := cs.RepairShard(ctx, &sh, good)
+			assert.NoError(err)
+			assert.Equal(len(check.Corrupt), n)
+
+			shards, err = cs.ListShards(ctx, 0, 100)
+			assert.NoError(err)
+			for _, sh := range shards {
+				check, err := cs.VerifyShard(ctx, &sh)
+				assert.NoError(err)
+				assert.True(check.OK())
+			}
+			buf = new(bytes.Buffer)
+			assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+			checkRepo(t, cs, buf, recs)
+
+			// a missing key isn't corruption
+			if encrypted {
+				cs.SetKeyring(nil)
+				_, err = cs.VerifyShard(ctx, &shards[2])
+				assert.ErrorIs(err, ErrNoKeyring)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package carstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// coldPrefix marks the path of a shard that has been migrated to the cold store; the rest of the path is its object name
+const coldPrefix = "cold:"
+
+func isColdPath(path string) bool {
+	return strings.HasPrefix(path, coldPrefix)
+}
+
+// TieringPolicy decides which shards live on local disk and which in the cold store. Reads are counted per interval, between migration passes.
+type TieringPolicy struct {
+	// shards younger than this always stay on local disk. Each repo's latest shard also stays local, however old it is, as it is read for every commit
+	MinAge time.Duration
+	// shards read more than this many times in an interval stay on local disk
+	MaxColdReads int
+	// cold shards read at least this many times in an interval are brought back to local disk. Zero disables promotion
+	PromoteReads int
+	// how often migration passes run
+	Interval time.Duration
+	// shards considered per database query
+	BatchSize int
+	// bytes of cold shards kept on local disk after being read. Zero disables the limit
+	CacheBytes int64
+}
+
+func DefaultTieringPolicy() *TieringPolicy {
+	return &TieringPolicy{
+		MinAge:       30 * 24 * time.Hour,
+		MaxColdReads: 0,
+		PromoteReads: 20,
+		Interval:     time.Hour,
+		BatchSize:    1000,
+		CacheBytes:   1 << 30,
+	}
+}
+
+// Tiering moves old, rarely read shards from local disk to a cold store, and reads them back through a local cache. Shard rows keep pointing at the same blocks; only the path changes, so nothing else in the carstore needs to know which tier a shard is in.
+type Tiering struct {
+	cold     ColdStore
+	policy   TieringPolicy
+	cacheDir string
+
+	lk         sync.Mutex
+	reads      map[string]int
+	cache      map[string]*tierCacheEntry
+	cacheBytes int64
+}
+
+type tierCacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// NewTiering sets up tiering to the given cold store. Cold shards are cached in cacheDir after being read, which is emptied first: anything left there is from an earlier run, and may be stale.
+func NewTiering(cold ColdStore, cacheDir string, policy *TieringPolicy) (*Tiering, error) {
+	if policy == nil {
+		policy = DefaultTieringPolicy()
+	}
+	p := *policy
+	if p.Interval <= 0 {
+		p.Interval = time.Hour
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = 1000
+	}
+
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cacheDir, 0775); err != nil {
+		return nil, err
+	}
+	tierCacheBytes.Set(0)
+
+	return &Tiering{
+		cold:     cold,
+		policy:   p,
+		cacheDir: cacheDir,
+		reads:    make(map[string]int),
+		cache:    make(map[string]*tierCacheEntry),
+	}, nil
+}
+
+// SetTiering enables storage tiering. Must be called before the carstore is used.
+func (cs *FileCarStore) SetTiering(t *Tiering) {
+	cs.tiers = t
+}
+
+func (t *Tiering) cachePath(name string) string {
+	return filepath.Join(t.cacheDir, strings.ReplaceAll(name, "/", "_"))
+}
+
+// localPath returns a path on local disk to read a shard from, fetching cold shards into the cache first. Safe to call on a nil Tiering
+func (t *Tiering) localPath(ctx context.Context, path string) (string, error) {
+	if !isColdPath(path) {
+		tierReads.WithLabelValues("hot").Inc()
+		if t != nil {
+			t.lk.Lock()
+			t.reads[path]++
+			t.lk.Unlock()
+		}
+		return path, nil
+	}
+	if t == nil {
+		return "", fmt.Errorf("shard %s is in cold storage, but no cold store is configured", path)
+	}
+	name := strings.TrimPrefix(path, coldPrefix)
+	cpath := t.cachePath(name)
+
+	t.lk.Lock()
+	t.reads[path]++
+	ent, ok := t.cache[name]
+	if ok {
+		ent.used = time.Now()
+	}
+	t.lk.Unlock()
+	if ok {
+		tierReads.WithLabelValues("cache").Inc()
+		return cpath, nil
+	}
+
+	ctx, span := otel.Tracer("carstore").Start(ctx, "fetchColdShard")
+	defer span.End()
+
+	start := time.Now()
+	data, err := t.cold.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	tierFetchDuration.Observe(time.Since(start).Seconds())
+	tierReads.WithLabelValues("cold").Inc()
+	span.SetAttributes(attribute.Int("size", len(data)))
+
+	// concurrent fetches of the same shard write identical content, so whichever rename lands last is fine
+	tmp, err := os.CreateTemp(t.cacheDir, ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), cpath); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	t.lk.Lock()
+	if old, ok := t.cache[name]; ok {
+		t.cacheBytes -= old.size
+	}
+	t.cache[name] = &tierCacheEntry{size: int64(len(data)), used: time.Now()}
+	t.cacheBytes += int64(len(data))
+	t.evictLocked(name)
+	t.lk.Unlock()
+
+	return cpath, nil
+}
+
+// evictLocked removes least recently used cache entries until the cache is within its limit, keeping the entry named keep. Readers with an evicted file already open carry on reading it
+func (t *Tiering) evictLocked(keep string) {
+	defer tierCacheBytes.Set(float64(t.cacheBytes))
+	if t.policy.CacheBytes <= 0 || t.cacheBytes <= t.policy.CacheBytes {
+		return
+	}
+
+	names := make([]string, 0, len(t.cache))
+	for name := range t.cache {
+		if name != keep {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return t.cache[names[i]].used.Before(t.cache[names[j]].used)
+	})
+	for _, name := range names {
+		if t.cacheBytes <= t.policy.CacheBytes {
+			return
+		}
+		t.dropCachedLocked(name)
+	}
+}
+
+func (t *Tiering) dropCachedLocked(name string) {
+	ent, ok := t.cache[name]
+	if !ok {
+		return
+	}
+	os.Remove(t.cachePath(name))
+	t.cacheBytes -= ent.size
+	delete(t.cache, name)
+	tierCacheBytes.Set(float64(t.cacheBytes))
+}
+
+// delete removes a cold shard from the cold store and the cache
+func (t *Tiering) delete(ctx context.Context, path string) error {
+	if t == nil {
+		return fmt.Errorf("shard %s is in cold storage, but no cold store is configured", path)
+	}
+	name := strings.TrimPrefix(path, coldPrefix)
+	t.lk.Lock()
+	t.dropCachedLocked(name)
+	delete(t.reads, path)
+	t.lk.Unlock()
+	return t.cold.Delete(ctx, name)
+}
+
+// takeReads returns the read counts for the interval just ended, and starts a new one
+func (t *Tiering) takeReads() map[string]int {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	reads := t.reads
+	t.reads = make(map[string]int)
+	return reads
+}
+
+// coldName is the object name a shard is stored under in the cold store. Shard file names are already unique, and include the uid; the uid prefix keeps each account's objects together
+func coldName(sh *CarShard) string {
+	return fmt.Sprintf("%d/%s", sh.Usr, filepath.Base(sh.Path))
+}
+
+// TierStats summarizes a migration pass
+type TierStats struct {
+	Demoted       int   `json:"demoted"`
+	DemotedBytes  int64 `json:"demotedBytes"`
+	Promoted      int   `json:"promoted"`
+	PromotedBytes int64 `json:"promotedBytes"`
+	// old enough to demote, but read too often
+	KeptHot int `json:"keptHot"`
+}
+
+// MigrateTiers runs one migration pass: cold shards read often enough since the last pass are brought back to local disk, then shards past the minimum age that were read rarely enough are moved to the cold store.
+func (cs *FileCarStore) MigrateTiers(ctx context.Context) (*TierStats, error) {
+	t := cs.tiers
+	if t == nil {
+		return nil, fmt.Errorf("tiering is not configured")
+	}
+	ctx, span := otel.Tracer("carstore").Start(ctx, "MigrateTiers")
+	defer span.End()
+
+	reads := t.takeReads()
+	stats := &TierStats{}
+	promoted := make(map[uint]bool)
+
+	if t.policy.PromoteReads > 0 {
+		for path, n := range reads {
+			if !isColdPath(path) || n < t.policy.PromoteReads {
+				continue
+			}
+			var shards []CarShard
+			if err := cs.meta.meta.WithContext(ctx).Where("path = ?", path).Find(&shards).Error; err != nil {
+				return stats, err
+			}
+			for _, sh := range shards {
+				size, err := cs.promoteShard(ctx, &sh)
+				if err != nil {
+					return stats, fmt.Errorf("promoting shard %d: %w", sh.ID, err)
+				}
+				if size >= 0 {
+					promoted[sh.ID] = true
+					stats.Promoted++
+					stats.PromotedBytes += size
+				}
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-t.policy.MinAge)
+	var last uint
+	for {
+		// a repo's latest shard has no later shard of the same repo
+		var shards []CarShard
+		if err := cs.meta.meta.WithContext(ctx).Table("car_shards AS s").
+			Where("s.id > ? AND s.created_at < ? AND s.path NOT LIKE ?", last, cutoff, coldPrefix+"%").
+			Where("EXISTS (SELECT 1 FROM car_shards AS n WHERE n.usr = s.usr AND n.seq > s.seq)").
+			Order("s.id asc").Limit(t.policy.BatchSize).Find(&shards).Error; err != nil {
+			return stats, err
+		}
+		if len(shards) == 0 {
+			break
+		}
+		for _, sh := range shards {
+			last = sh.ID
+			if promoted[sh.ID] {
+				continue
+			}
+			if reads[sh.Path] > t.policy.MaxColdReads {
+				stats.KeptHot++
+				continue
+			}
+			size, err := cs.demoteShard(ctx, &sh)
+			if err != nil {
+				return stats, fmt.Errorf("demoting shard %d: %w", sh.ID, err)
+			}
+			if size >= 0 {
+				stats.Demoted++
+				stats.DemotedBytes += size
+			}
+		}
+	}
+
+	var cold int64
+	if err := cs.meta.meta.WithContext(ctx).Model(&CarShard{}).Where("path LIKE ?", coldPrefix+"%").Count(&cold).Error; err != nil {
+		return stats, err
+	}
+	var total int64
+	if err := cs.meta.meta.WithContext(ctx).Model(&CarShard{}).Count(&total).Error; err != nil {
+		return stats, err
+	}
+	tierShards.WithLabelValues("hot").Set(float64(total - cold))
+	tierShards.WithLabelValues("cold").Set(float64(cold))
+
+	span.SetAttributes(attribute.Int("demoted", stats.Demoted), attribute.Int("promoted", stats.Promoted))
+	if stats.Demoted > 0 || stats.Promoted > 0 {
+		cs.log.Info("migrated shards between tiers", "demoted", stats.Demoted, "demotedBytes", stats.DemotedBytes, "promoted", stats.Promoted, "promotedBytes", stats.PromotedBytes, "keptHot", stats.KeptHot)
+	}
+	return stats, nil
+}
+
+// demoteShard uploads a local shard to the cold store and points its row at it. Returns the shard's size, or -1 if it was compacted or otherwise replaced in the meantime
+func (cs *FileCarStore) demoteShard(ctx context.Context, sh *CarShard) (int64, error) {
+	t := cs.tiers
+	data, err := os.ReadFile(sh.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, nil
+		}
+		return 0, err
+	}
+	name := coldName(sh)
+	if err := t.cold.Put(ctx, name, data); err != nil {
+		return 0, err
+	}
+
+	res := cs.meta.meta.WithContext(ctx).Model(&CarShard{}).Where("id = ? AND path = ?", sh.ID, sh.Path).Update("path", coldPrefix+name)
+	if res.Error != nil || res.RowsAffected == 0 {
+		if err := t.cold.Delete(ctx, name); err != nil {
+			cs.log.Error("failed to delete orphaned cold shard", "name", name, "err", err)
+		}
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		return -1, nil
+	}
+
+	if err := os.Remove(sh.Path); err != nil && !os.IsNotExist(err) {
+		cs.log.Error("failed to remove demoted shard file", "path", sh.Path, "err", err)
+	}
+	tierMigrations.WithLabelValues("demote").Inc()
+	tierMigratedBytes.WithLabelValues("demote").Add(float64(len(data)))
+	return int64(len(data)), nil
+}
+
+// promoteShard brings a cold shard back to local disk. Returns the shard's size, or -1 if it was replaced in the meantime
+func (cs *FileCarStore) promoteShard(ctx context.Context, sh *CarShard) (int64, error) {
+	t := cs.tiers
+	src, err := t.localPath(ctx, sh.Path)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return 0, err
+	}
+
+	fi, path, err := cs.openNewCompactedShardFile(ctx, sh.Usr, sh.Seq)
+	if err != nil {
+		return 0, err
+	}
+	_, err = fi.Write(data)
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+
+	res := cs.meta.meta.WithContext(ctx).Model(&CarShard{}).Where("id = ? AND path = ?", sh.ID, sh.Path).Update("path", path)
+	if res.Error != nil || res.RowsAffected == 0 {
+		os.Remove(path)
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		return -1, nil
+	}
+
+	if err := t.delete(ctx, sh.Path); err != nil {
+		cs.log.Error("failed to delete promoted cold shard", "path", sh.Path, "err", err)
+	}
+	tierMigrations.WithLabelValues("promote").Inc()
+	tierMigratedBytes.WithLabelValues("promote").Add(float64(len(data)))
+	return int64(len(data)), nil
+}
+
+// RunTiering runs migration passes at the policy's interval until the context is cancelled
+func (cs *FileCarStore) RunTiering(ctx context.Context) {
+	t := time.NewTicker(cs.tiers.policy.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := cs.MigrateTiers(ctx); err != nil {
+			cs.log.Error("tier migration failed", "err", err)
+		}
+	}
+}
+
+// hotShards returns the shards on local disk, and how many were left out for being in the cold store
+func hotShards(shards []CarShard) (hot []CarShard, cold int) {
+	for _, sh := range shards {
+		if isColdPath(sh.Path) {
+			cold++
+		} else {
+			hot = append(hot, sh)
+		}
+	}
+	return hot, cold
+}
+
+var tierReads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "carstore_tier_reads_total",
+	Help: "Shard reads by the tier they were served from (hot, cache or cold)",
+}, []string{"tier"})
+
+var tierFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "carstore_tier_fetch_duration_seconds",
+	Help:    "Time to fetch a shard from the cold store",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+})
+
+var tierMigrations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "carstore_tier_migrations_total",
+	Help: "Shards moved between tiers, by direction (demote or promote)",
+}, []string{"direction"})
+
+var tierMigratedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "carstore_tier_migrated_bytes_total",
+	Help: "Bytes of shards moved between tiers, by direction (demote or promote)",
+}, []string{"direction"})
+
+var tierShards = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "carstore_tier_shards",
+	Help: "Shards in each tier (hot or cold), as of the last migration pass",
+}, []string{"tier"})
+
+var tierCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "carstore_tier_cache_bytes",
+	Help: "Bytes of cold shards cached on local disk",
+})
@@ -0,0 +1,109 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiering(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store, cleanup, err := testCarStore(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	cs := store.(*FileCarStore)
+
+	coldDir := t.TempDir()
+	tiers, err := NewTiering(&DirColdStore{Dir: coldDir}, filepath.Join(t.TempDir(), "cache"), &TieringPolicy{
+		PromoteReads: 2,
+		CacheBytes:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.SetTiering(tiers)
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, rev, err := setupRepo(ctx, ds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+		t.Fatal(err)
+	}
+	head, rev, recs := writePosts(t, cs, head, rev, "first post", "second post")
+
+	// shards read while writing the repo stay hot
+	stats, err := cs.MigrateTiers(ctx)
+	assert.NoError(err)
+	assert.Zero(stats.Demoted)
+	assert.NotZero(stats.KeptHot)
+
+	// then everything but the latest shard goes cold
+	stats, err = cs.MigrateTiers(ctx)
+	assert.NoError(err)
+	assert.Equal(2, stats.Demoted)
+	shards, err := cs.ListShards(ctx, 0, 100)
+	assert.NoError(err)
+	assert.Len(shards, 3)
+	assert.True(isColdPath(shards[0].Path))
+	assert.True(isColdPath(shards[1].Path))
+	assert.False(isColdPath(shards[2].Path))
+	_, err = os.Stat(filepath.Join(coldDir, coldName(&shards[0])))
+	assert.NoError(err)
+
+	// cold shards read through, and the repo can still be written to
+	_, _, more := writePosts(t, cs, head, rev, "third post")
+	recs = append(recs, more...)
+	buf := new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+	for _, sh := range shards {
+		check, err := cs.VerifyShard(ctx, &sh)
+		assert.NoError(err)
+		assert.True(check.OK())
+	}
+
+	// compaction leaves cold shards alone
+	_, err = cs.CompactUserShards(ctx, 1, false)
+	assert.NoError(err)
+	shards, err = cs.ListShards(ctx, 0, 100)
+	assert.NoError(err)
+	assert.True(isColdPath(shards[0].Path))
+	assert.True(isColdPath(shards[1].Path))
+	buf = new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+
+	// shards read often enough come back
+	stats, err = cs.MigrateTiers(ctx)
+	assert.NoError(err)
+	assert.Equal(2, stats.Promoted)
+	assert.Zero(stats.Demoted)
+	shards, err = cs.ListShards(ctx, 0, 100)
+	assert.NoError(err)
+	for _, sh := range shards {
+		assert.False(isColdPath(sh.Path))
+	}
+	_, err = os.Stat(filepath.Join(coldDir, "1"))
+	if assert.NoError(err) {
+		ents, err := os.ReadDir(filepath.Join(coldDir, "1"))
+		assert.NoError(err)
+		assert.Empty(ents)
+	}
+
+	buf = new(bytes.Buffer)
+	assert.NoError(cs.ReadUserCar(ctx, 1, "", true, buf))
+	checkRepo(t, cs, buf, recs)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	libbgs "github.com/bluesky-social/indigo/bgs"
+	"github.com/bluesky-social/indigo/util/configschema"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ResolverConfig holds identity (DID and handle) resolution settings.
+type ResolverConfig struct {
+	PLCHost        string
+	DIDCacheSize   int `config:"min=0"`
+	DIDMemcached   []string
+	ResolveAddress string
+	// DNS-over-HTTPS endpoints for handle TXT lookups
+	DoH           []string `json:"doh"`
+	DoHNoFallback bool     `json:"dohNoFallback"`
+	ForceDNSUDP   bool     `json:"forceDNSUDP"`
+}
+
+// FileConfig is the layout of the --config file. Values in the file take precedence over flags and environment variables.
+type FileConfig struct {
+	Relay    *libbgs.BGSConfig `json:"relay"`
+	Resolver *ResolverConfig   `json:"resolver"`
+}
+
+func init() {
+	configschema.Register(reflect.TypeOf((*crypto.PrivateKey)(nil)).Elem(), configschema.Codec{
+		Schema: configschema.Schema{Type: configschema.Types{"string"}, Format: "multibase-private-key", Pattern: "^z[1-9A-HJ-NP-Za-km-z]+$"},
+		Decode: func(v any) (any, error) {
+			return crypto.ParsePrivateMultibase(v.(string))
+		},
+	})
+	configschema.Register(reflect.TypeOf((*crypto.PublicKey)(nil)).Elem(), configschema.Codec{
+		Schema: configschema.Schema{Type: configschema.Types{"string"}, Format: "did-key", Pattern: "^did:key:z[1-9A-HJ-NP-Za-km-z]+$"},
+		Decode: func(v any) (any, error) {
+			return crypto.ParsePublicDIDKey(v.(string))
+		},
+	})
+}
+
+func resolverConfigFromFlags(cctx *cli.Context) ResolverConfig {
+	return ResolverConfig{
+		PLCHost:        cctx.String("plc-host"),
+		DIDCacheSize:   cctx.Int("did-cache-size"),
+		DIDMemcached:   cctx.StringSlice("did-memcached"),
+		ResolveAddress: cctx.String("resolve-address"),
+		DoH:            cctx.StringSlice("resolve-doh"),
+		DoHNoFallback:  cctx.Bool("resolve-doh-no-fallback"),
+		ForceDNSUDP:    cctx.Bool("force-dns-udp"),
+	}
+}
+
+func configSchema() *configschema.Schema {
+	return configschema.For(FileConfig{
+		Relay: libbgs.DefaultBGSConfig(),
+		Resolver: &ResolverConfig{
+			PLCHost:        "https://plc.directory",
+			DIDCacheSize:   5_000_000,
+			ResolveAddress: "1.1.1.1:53",
+		},
+	}, "bigsky configuration")
+}
+
+// readConfigFile reads and fully validates a config file; its sections are loaded with configschema.LoadSection as the relay starts up
+func readConfigFile(path string) ([]byte, error) {
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fc := FileConfig{Relay: libbgs.DefaultBGSConfig(), Resolver: &ResolverConfig{}}
+	if err := configschema.Load(doc, &fc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+var cmdConfig = &cli.Command{
+	Name:  "config",
+	Usage: "inspect and check configuration files",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "schema",
+			Usage: "print the JSON Schema of configuration files",
+			Action: func(cctx *cli.Context) error {
+				out, err := json.MarshalIndent(configSchema(), "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+				return nil
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "check a configuration file, listing every problem",
+			ArgsUsage: "<file>",
+			Action: func(cctx *cli.Context) error {
+				path := cctx.Args().First()
+				if path == "" {
+					return fmt.Errorf("must specify a configuration file")
+				}
+				_, err := readConfigFile(path)
+				var errs configschema.Errors
+				if errors.As(err, &errs) {
+					lines := make([]string, 0, len(errs))
+					for _, e := range errs {
+						lines = append(lines, e.Error())
+					}
+					fmt.Fprintln(os.Stderr, strings.Join(lines, "\n"))
+					return fmt.Errorf("%s: %d problems found", path, len(errs))
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s: ok\n", path)
+				return nil
+			},
+		},
+	},
+}
@@ -10,22 +10,38 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
 	libbgs "github.com/bluesky-social/indigo/bgs"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/did"
 	"github.com/bluesky-social/indigo/events"
 	"github.com/bluesky-social/indigo/events/dbpersist"
 	"github.com/bluesky-social/indigo/events/diskpersist"
+	"github.com/bluesky-social/indigo/events/sequencer"
 	"github.com/bluesky-social/indigo/handles"
 	"github.com/bluesky-social/indigo/indexer"
 	"github.com/bluesky-social/indigo/plc"
 	"github.com/bluesky-social/indigo/repomgr"
-	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/blobs"
+	"github.com/bluesky-social/indigo/sovereignty/egress"
+	"github.com/bluesky-social/indigo/sovereignty/features"
+	"github.com/bluesky-social/indigo/sovereignty/lexcheck"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/sovereignty/residency"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+	"github.com/bluesky-social/indigo/sovereignty/webauthn"
 	"github.com/bluesky-social/indigo/util/cliutil"
+	"github.com/bluesky-social/indigo/util/configschema"
+	"github.com/bluesky-social/indigo/util/httpprofile"
+	"github.com/bluesky-social/indigo/util/keymgmt"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -66,6 +82,11 @@ func run(args []string) error {
 	}
 
 	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "JSON configuration file (see `bigsky config schema`); its values take precedence over flags",
+			EnvVars: []string{"RELAY_CONFIG"},
+		},
 		&cli.BoolFlag{
 			Name: "jaeger",
 		},
@@ -114,10 +135,111 @@ func run(args []string) error {
 			Usage:   "set directory for disk persister (implicitly enables disk persister)",
 			EnvVars: []string{"RELAY_PERSISTER_DIR"},
 		},
+		&cli.StringFlag{
+			Name:    "disk-persister-durability",
+			Usage:   "when persisted events are fsynced: buffered (never; OS writes back), group (once per flush interval), or sync (every event)",
+			Value:   "buffered",
+			EnvVars: []string{"RELAY_PERSISTER_DURABILITY"},
+		},
+		&cli.StringFlag{
+			Name:    "sequencer-holder",
+			Usage:   "name this relay allocates sequence numbers under, telling replicas apart; defaults to the hostname",
+			EnvVars: []string{"RELAY_SEQUENCER_HOLDER"},
+		},
+		&cli.Int64Flag{
+			Name:    "sequencer-block-size",
+			Usage:   "sequence numbers reserved at a time; a crash skips at most this many",
+			Value:   1000,
+			EnvVars: []string{"RELAY_SEQUENCER_BLOCK_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    "sequencer-db-url",
+			Usage:   "database connection string for the sequence allocator, shared by replicas taking over from one another; defaults to the BGS database",
+			EnvVars: []string{"RELAY_SEQUENCER_DATABASE_URL"},
+		},
+		&cli.BoolFlag{
+			Name:    "ordering-checks",
+			Usage:   "check that each account's events are broadcast in rev and seq order, logging and counting violations",
+			EnvVars: []string{"RELAY_ORDERING_CHECKS"},
+		},
+		&cli.IntFlag{
+			Name:    "ordering-reorder-window",
+			Usage:   "hold up to this many events before persisting, to put an account's commits arriving out of rev order back in order; 0 disables",
+			EnvVars: []string{"RELAY_ORDERING_REORDER_WINDOW"},
+		},
+		&cli.DurationFlag{
+			Name:    "ordering-reorder-delay",
+			Usage:   "longest an event is held for reordering",
+			Value:   50 * time.Millisecond,
+			EnvVars: []string{"RELAY_ORDERING_REORDER_DELAY"},
+		},
+		&cli.DurationFlag{
+			Name:    "disk-persister-flush-interval",
+			Usage:   "how often buffered events are written to the log; bounds the loss window for buffered and group durability",
+			Value:   100 * time.Millisecond,
+			EnvVars: []string{"RELAY_PERSISTER_FLUSH_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "encryption-keyring",
+			Usage:   "path to a JSON keyring ({\"primary\": name, \"keys\": {name: base64 AES-256 key}}) for encrypting persisted events and carstore shards at rest; requires the disk persister and the default carstore",
+			EnvVars: []string{"RELAY_ENCRYPTION_KEYRING"},
+		},
 		&cli.StringFlag{
 			Name:    "admin-key",
 			EnvVars: []string{"RELAY_ADMIN_KEY", "BGS_ADMIN_KEY"},
 		},
+		&cli.StringFlag{
+			Name:    "admin-socket",
+			Usage:   "path of a unix socket to serve the admin API on; connections are authenticated by peer credentials (Linux only) instead of admin tokens",
+			EnvVars: []string{"RELAY_ADMIN_SOCKET"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-socket-mode",
+			Usage:   "file mode of the admin socket, in octal",
+			Value:   "0600",
+			EnvVars: []string{"RELAY_ADMIN_SOCKET_MODE"},
+		},
+		&cli.IntSliceFlag{
+			Name:    "admin-socket-allow-uid",
+			Usage:   "additional user IDs allowed to connect to the admin socket (the relay's own user and root always are)",
+			EnvVars: []string{"RELAY_ADMIN_SOCKET_ALLOW_UIDS"},
+		},
+		&cli.BoolFlag{
+			Name:    "admin-socket-only",
+			Usage:   "serve the admin API only on the admin socket, not on the HTTP listener",
+			EnvVars: []string{"RELAY_ADMIN_SOCKET_ONLY"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-webauthn-rp-id",
+			Usage:   "domain hardware tokens are enrolled for, enabling WebAuthn sign-in to the admin API (eg relay.example.ca)",
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_RP_ID"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "admin-webauthn-origin",
+			Usage:   "origin the admin dashboard is served from (eg https://relay.example.ca); defaults to https:// plus the relying party ID",
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_ORIGINS"},
+		},
+		&cli.DurationFlag{
+			Name:    "admin-webauthn-session-ttl",
+			Usage:   "lifetime of admin API sessions opened by hardware token sign-in",
+			Value:   12 * time.Hour,
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_SESSION_TTL"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-webauthn-bootstrap-token",
+			Usage:   "token authorizing enrollment of the first hardware token; if unset, one is generated at startup",
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_BOOTSTRAP_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-webauthn-bootstrap-token-file",
+			Usage:   "file a generated bootstrap token is written to, readable only by the relay's user; if unset, it is printed once to stderr",
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_BOOTSTRAP_TOKEN_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    "admin-webauthn-only",
+			Usage:   "reject static admin tokens (--admin-key), only accepting hardware token sessions",
+			EnvVars: []string{"RELAY_ADMIN_WEBAUTHN_ONLY"},
+		},
 		&cli.StringSliceFlag{
 			Name:    "handle-resolver-hosts",
 			EnvVars: []string{"HANDLE_RESOLVER_HOSTS"},
@@ -143,6 +265,16 @@ func run(args []string) error {
 			EnvVars: []string{"RESOLVE_ADDRESS"},
 			Value:   "1.1.1.1:53",
 		},
+		&cli.StringSliceFlag{
+			Name:    "resolve-doh",
+			Usage:   "DNS-over-HTTPS endpoints for handle TXT lookups, used instead of resolve-address (eg, " + identity.CanadianShieldPrivateDoH + "), comma separated",
+			EnvVars: []string{"RESOLVE_DOH"},
+		},
+		&cli.BoolFlag{
+			Name:    "resolve-doh-no-fallback",
+			Usage:   "don't fail over to system DNS when all DNS-over-HTTPS endpoints fail",
+			EnvVars: []string{"RESOLVE_DOH_NO_FALLBACK"},
+		},
 		&cli.BoolFlag{
 			Name:    "force-dns-udp",
 			EnvVars: []string{"FORCE_DNS_UDP"},
@@ -167,6 +299,21 @@ func run(args []string) error {
 			EnvVars: []string{"BSKY_SOCIAL_RATE_LIMIT_SKIP"},
 			Usage:   "ratelimit bypass secret token for *.bsky.social domains",
 		},
+		&cli.StringFlag{
+			Name:    "http-profiles",
+			Usage:   "path to a JSON file overriding the outbound HTTP client profiles (interactive, crawler, bulk): timeouts, TLS settings, proxy, User-Agent and retries",
+			EnvVars: []string{"RELAY_HTTP_PROFILES"},
+		},
+		&cli.StringFlag{
+			Name:    "http-proxy",
+			Usage:   "URL of the proxy (http, https, socks5 or socks5h) outbound requests go through, for profiles which don't set their own; none connects directly, and empty uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY",
+			EnvVars: []string{"RELAY_HTTP_PROXY"},
+		},
+		&cli.StringFlag{
+			Name:    "http-proxy-rules",
+			Usage:   "path to a JSON file of proxy rules routing requests to some destinations (host names, *.domains or CIDR ranges) through proxies of their own, or directly, for every profile",
+			EnvVars: []string{"RELAY_HTTP_PROXY_RULES"},
+		},
 		&cli.IntFlag{
 			Name:    "default-repo-limit",
 			Value:   100,
@@ -202,6 +349,74 @@ func run(args []string) error {
 			EnvVars: []string{"RELAY_NUM_COMPACTION_WORKERS"},
 			Value:   2,
 		},
+		&cli.DurationFlag{
+			Name:    "scrub-interval",
+			EnvVars: []string{"RELAY_SCRUB_INTERVAL"},
+			Usage:   "interval between integrity scrubs re-hashing every stored block against its CID, set to 0 to disable",
+		},
+		&cli.Float64Flag{
+			Name:    "scrub-rate",
+			EnvVars: []string{"RELAY_SCRUB_RATE"},
+			Value:   50,
+			Usage:   "carstore shards verified per second while scrubbing, 0 for unlimited",
+		},
+		&cli.BoolFlag{
+			Name:    "scrub-repair",
+			EnvVars: []string{"RELAY_SCRUB_REPAIR"},
+			Usage:   "repair damaged shards found while scrubbing by re-fetching the repo from its PDS, then from sovereign peers",
+		},
+		&cli.DurationFlag{
+			Name:    "mirror-check-interval",
+			EnvVars: []string{"RELAY_MIRROR_CHECK_INTERVAL"},
+			Usage:   "interval between checks comparing a sample of mirrored repos with the latest commit their origin PDS reports, set to 0 to disable",
+		},
+		&cli.IntFlag{
+			Name:    "mirror-check-sample",
+			EnvVars: []string{"RELAY_MIRROR_CHECK_SAMPLE"},
+			Value:   500,
+			Usage:   "mirrored repos sampled per check",
+		},
+		&cli.Float64Flag{
+			Name:    "mirror-check-rate",
+			EnvVars: []string{"RELAY_MIRROR_CHECK_RATE"},
+			Value:   10,
+			Usage:   "requests per second to origin PDSes while checking the mirror, 0 for unlimited",
+		},
+		&cli.BoolFlag{
+			Name:    "mirror-check-resync",
+			EnvVars: []string{"RELAY_MIRROR_CHECK_RESYNC"},
+			Usage:   "resync repos the mirror check finds differ from their origin: recrawl those behind, and reset and recrawl those which diverged",
+		},
+		&cli.DurationFlag{
+			Name:    "scale-ingest-lag-target",
+			EnvVars: []string{"RELAY_SCALE_INGEST_LAG_TARGET"},
+			Value:   libbgs.DefaultScaleTargets().IngestLag,
+			Usage:   "average ingest lag at which a replica counts as fully loaded in /scale-advice, 0 to leave the signal out",
+		},
+		&cli.Int64Flag{
+			Name:    "scale-persister-backlog-target",
+			EnvVars: []string{"RELAY_SCALE_PERSISTER_BACKLOG_TARGET"},
+			Value:   libbgs.DefaultScaleTargets().PersisterBacklog,
+			Usage:   "events waiting to be persisted and broadcast at which a replica counts as fully loaded in /scale-advice, 0 to leave the signal out",
+		},
+		&cli.Float64Flag{
+			Name:    "scale-fanout-saturation-target",
+			EnvVars: []string{"RELAY_SCALE_FANOUT_SATURATION_TARGET"},
+			Value:   libbgs.DefaultScaleTargets().FanoutSaturation,
+			Usage:   "fill of the fullest consumer's buffer (0 to 1) at which a replica counts as fully loaded in /scale-advice, 0 to leave the signal out",
+		},
+		&cli.IntFlag{
+			Name:    "scale-subscribers-target",
+			EnvVars: []string{"RELAY_SCALE_SUBSCRIBERS_TARGET"},
+			Value:   libbgs.DefaultScaleTargets().Subscribers,
+			Usage:   "connected consumers at which a replica counts as fully loaded in /scale-advice, 0 to leave the signal out",
+		},
+		&cli.IntFlag{
+			Name:    "repo-export-concurrency",
+			EnvVars: []string{"RELAY_REPO_EXPORT_CONCURRENCY"},
+			Value:   8,
+			Usage:   "blocks fetched concurrently when streaming a full repo export for getRepo",
+		},
 		&cli.StringSliceFlag{
 			Name:    "carstore-shard-dirs",
 			Usage:   "specify list of shard directories for carstore storage, overrides default storage within datadir",
@@ -212,11 +427,77 @@ func run(args []string) error {
 			Usage:   "forward POST requestCrawl to this url, should be machine root url and not xrpc/requestCrawl, comma separated list",
 			EnvVars: []string{"RELAY_NEXT_CRAWLER"},
 		},
+		&cli.Int64Flag{
+			Name:    "stream-min-version",
+			Usage:   "oldest stream protocol version served; consumers declaring an older version are rejected",
+			EnvVars: []string{"RELAY_STREAM_MIN_VERSION"},
+			Value:   1,
+		},
+		&cli.Int64Flag{
+			Name:    "stream-deprecated-below",
+			Usage:   "warn consumers declaring a stream protocol version older than this with an #info frame",
+			EnvVars: []string{"RELAY_STREAM_DEPRECATED_BELOW"},
+		},
+		&cli.BoolFlag{
+			Name:    "stream-warn-undeclared-version",
+			Usage:   "warn consumers which don't declare a stream protocol version with an #info frame",
+			EnvVars: []string{"RELAY_STREAM_WARN_UNDECLARED_VERSION"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "stream-notices",
+			Usage:   "announcements of upcoming stream changes, sent to every consumer on connect as #info frames",
+			EnvVars: []string{"RELAY_STREAM_NOTICES"},
+		},
 		&cli.BoolFlag{
 			Name:  "ex-sqlite-carstore",
 			Usage: "enable experimental sqlite carstore",
 			Value: false,
 		},
+		&cli.BoolFlag{
+			Name:    "dedup-carstore",
+			Usage:   "store each distinct block once across all repos, in a sqlite database in the carstore directory",
+			EnvVars: []string{"RELAY_DEDUP_CARSTORE"},
+		},
+		&cli.DurationFlag{
+			Name:    "dedup-gc-interval",
+			Usage:   "how often the dedup carstore deletes blocks no repo references any more",
+			Value:   time.Hour,
+			EnvVars: []string{"RELAY_DEDUP_GC_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-storage",
+			Usage:   "migrate old, rarely read carstore shards to this object store: an http(s) base URL taking PUT, GET and DELETE (eg, an S3-compatible bucket), or a local directory; requires the default carstore",
+			EnvVars: []string{"RELAY_COLD_STORAGE"},
+		},
+		&cli.DurationFlag{
+			Name:    "cold-storage-min-age",
+			Usage:   "carstore shards younger than this stay on local disk",
+			Value:   30 * 24 * time.Hour,
+			EnvVars: []string{"RELAY_COLD_STORAGE_MIN_AGE"},
+		},
+		&cli.IntFlag{
+			Name:    "cold-storage-max-reads",
+			Usage:   "carstore shards read more than this many times per migration interval stay on local disk",
+			EnvVars: []string{"RELAY_COLD_STORAGE_MAX_READS"},
+		},
+		&cli.IntFlag{
+			Name:    "cold-storage-promote-reads",
+			Usage:   "cold carstore shards read at least this many times per migration interval are brought back to local disk (0 to never)",
+			Value:   20,
+			EnvVars: []string{"RELAY_COLD_STORAGE_PROMOTE_READS"},
+		},
+		&cli.DurationFlag{
+			Name:    "cold-storage-interval",
+			Usage:   "how often carstore shards are migrated between local disk and cold storage",
+			Value:   time.Hour,
+			EnvVars: []string{"RELAY_COLD_STORAGE_INTERVAL"},
+		},
+		&cli.Int64Flag{
+			Name:    "cold-storage-cache-mb",
+			Usage:   "megabytes of cold carstore shards cached on local disk after being read",
+			Value:   1024,
+			EnvVars: []string{"RELAY_COLD_STORAGE_CACHE_MB"},
+		},
 		&cli.StringSliceFlag{
 			Name:    "scylla-carstore",
 			Usage:   "scylla server addresses for storage backend, comma separated",
@@ -228,9 +509,601 @@ func run(args []string) error {
 			EnvVars: []string{"RELAY_NON_ARCHIVAL"},
 			Value:   false,
 		},
+		&cli.StringFlag{
+			Name:    "sovereign-snapshot-dir",
+			Usage:   "directory to publish signed DID classification snapshots to (served at /sovereignty/snapshots/); empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_SNAPSHOT_DIR"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-snapshot-interval",
+			Usage:   "how often to publish classification snapshots",
+			EnvVars: []string{"RELAY_SOVEREIGN_SNAPSHOT_INTERVAL"},
+			Value:   15 * time.Minute,
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-snapshot-max-diffs",
+			Usage:   "publish a full classification snapshot after this many consecutive diffs",
+			EnvVars: []string{"RELAY_SOVEREIGN_SNAPSHOT_MAX_DIFFS"},
+			Value:   24,
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-snapshot-upload-url",
+			Usage:   "base URL to upload classification snapshots to with HTTP PUT (eg, an object store bucket), instead of a local directory",
+			EnvVars: []string{"RELAY_SOVEREIGN_SNAPSHOT_UPLOAD_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-signing-key",
+			Usage:   "private key (multibase) used to sign published sovereignty artifacts",
+			EnvVars: []string{"RELAY_SOVEREIGN_SIGNING_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-self-repo-key",
+			Usage:   "private key (multibase) of the relay's own repo, where it publishes status, policy and snapshot records under did:web:<hostname> (requires --sovereign-hostname); empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_SELF_REPO_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-self-repo-path",
+			Usage:   "CAR file the relay's own repo is persisted to",
+			Value:   "data/bigsky/relay-repo.car",
+			EnvVars: []string{"RELAY_SOVEREIGN_SELF_REPO_PATH"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-self-repo-status-interval",
+			Usage:   "how often the relay's status record is refreshed",
+			Value:   10 * time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_SELF_REPO_STATUS_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-handle-check-workers",
+			Usage:   "number of workers periodically verifying the handles of classified accounts; 0 disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_HANDLE_CHECK_WORKERS"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-handle-check-verified-ttl",
+			Usage:   "how long a verified handle is trusted before it is checked again",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_HANDLE_CHECK_VERIFIED_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-handle-check-failed-ttl",
+			Usage:   "how long a failed handle check is cached before it is retried",
+			Value:   time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_HANDLE_CHECK_FAILED_TTL"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-handle-check-failure-threshold",
+			Usage:   "consecutive failed handle checks after which an account is reported and labeled",
+			Value:   3,
+			EnvVars: []string{"RELAY_SOVEREIGN_HANDLE_CHECK_FAILURE_THRESHOLD"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-pds-geo-ranges",
+			Usage:   "CSV file of IP prefixes and the countries they are located in (prefix,country per line), enabling classification of accounts by the location of their PDS",
+			EnvVars: []string{"RELAY_SOVEREIGN_PDS_GEO_RANGES"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-pds-geoip-db",
+			Usage:   "MaxMind GeoIP2 or GeoLite2 Country or City database (.mmdb), locating PDS addresses not covered by --sovereign-pds-geo-ranges; reloaded when the file changes",
+			EnvVars: []string{"RELAY_SOVEREIGN_PDS_GEOIP_DB"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-pds-geoip-reload-interval",
+			Usage:   "how often the GeoIP database file is checked for changes",
+			Value:   time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_PDS_GEOIP_RELOAD_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-in-country-list",
+			Usage:   "file of accounts classified as in country (one DID per line, or the first column of a CSV file), which the sovereign stream always carries; reloaded when the file changes, or on SIGHUP",
+			EnvVars: []string{"RELAY_SOVEREIGN_IN_COUNTRY_LIST"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-out-of-country-list",
+			Usage:   "file of accounts classified as out of country, which the sovereign stream never carries unless they are priority accounts; takes precedence over --sovereign-in-country-list",
+			EnvVars: []string{"RELAY_SOVEREIGN_OUT_OF_COUNTRY_LIST"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-list-reload-interval",
+			Usage:   "how often the in-country and out-of-country list files are checked for changes",
+			Value:   time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_LIST_RELOAD_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-extension-dir",
+			Usage:   "directory of WebAssembly extensions (*.wasm) filtering and transforming the sovereign stream, applied in file name order; requires --sovereign-signing-key",
+			EnvVars: []string{"RELAY_SOVEREIGN_EXTENSION_DIR"},
+		},
+		&cli.Int64Flag{
+			Name:    "sovereign-extension-memory-limit",
+			Usage:   "most memory each extension instance may use, in bytes",
+			Value:   128 << 20,
+			EnvVars: []string{"RELAY_SOVEREIGN_EXTENSION_MEMORY_LIMIT"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-extension-timeout",
+			Usage:   "longest a single call into an extension may run before the event is dropped",
+			Value:   100 * time.Millisecond,
+			EnvVars: []string{"RELAY_SOVEREIGN_EXTENSION_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-extension-reload-interval",
+			Usage:   "how often the extension directory is checked for added, changed and removed modules",
+			Value:   time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_EXTENSION_RELOAD_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-filter-plugin",
+			Usage:   "gRPC target of a filter plugin (eg localhost:7400 or unix:///run/relay-filter.sock) implementing the Filter service in sovereignty/filterplugin/filter.proto, asked about the events the sovereign filter and extensions carry; empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-filter-plugin-tls",
+			Usage:   "connect to the filter plugin with TLS, rather than in plaintext",
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_TLS"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-filter-plugin-conns",
+			Usage:   "connections kept to the filter plugin, calls being spread over them",
+			Value:   4,
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_CONNS"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-filter-plugin-timeout",
+			Usage:   "longest a call to the filter plugin may take before the event is left to --sovereign-filter-plugin-fallback",
+			Value:   50 * time.Millisecond,
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-filter-plugin-fallback",
+			Usage:   "what becomes of events the filter plugin can't decide on, because it failed, timed out or isn't being asked: keep or drop",
+			Value:   "keep",
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_FALLBACK"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-filter-plugin-failures",
+			Usage:   "failed calls in a row after which the filter plugin isn't asked for --sovereign-filter-plugin-cooldown",
+			Value:   5,
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_FAILURES"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-filter-plugin-cooldown",
+			Usage:   "how long the filter plugin isn't asked after failing",
+			Value:   10 * time.Second,
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_PLUGIN_COOLDOWN"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-country-resolver-url",
+			Usage:   "external service attributing accounts to countries (GET ?did=, answering {\"country\", \"confidence\"}), asked before PDS geolocation",
+			EnvVars: []string{"RELAY_SOVEREIGN_COUNTRY_RESOLVER_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-verification-url",
+			Usage:   "external verification service, which accounts the country resolvers have no answer for are POSTed to ({\"did\"}, answering {\"country\", \"confidence\"}); empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-verification-token",
+			Usage:   "bearer token sent to the verification service",
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_TOKEN"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-verification-timeout",
+			Usage:   "longest a request to the verification service may take",
+			Value:   5 * time.Second,
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-verification-failures",
+			Usage:   "failed requests in a row after which the verification service isn't asked for --sovereign-verification-cooldown",
+			Value:   5,
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_FAILURES"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-verification-cooldown",
+			Usage:   "how long the verification service isn't asked after failing",
+			Value:   time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_COOLDOWN"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-verification-cache-ttl",
+			Usage:   "how long the verification service's answers are cached",
+			Value:   7 * 24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_CACHE_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-verification-unknown-ttl",
+			Usage:   "how long the verification service's not being able to verify an account is cached",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_VERIFICATION_UNKNOWN_TTL"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-country-resolve-workers",
+			Usage:   "workers classifying accounts seen unclassified on the sovereign stream with the country resolver; 0 disables automatic classification",
+			Value:   0,
+			EnvVars: []string{"RELAY_SOVEREIGN_COUNTRY_RESOLVE_WORKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-country-min-confidence",
+			Usage:   "minimum confidence (low, medium, high) of a country resolver answer for it to be applied automatically",
+			Value:   "medium",
+			EnvVars: []string{"RELAY_SOVEREIGN_COUNTRY_MIN_CONFIDENCE"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-filter-mode",
+			Usage:   "how sure the sovereign stream must be of an account's country to carry its events: balanced (any confidence) or strict (at least medium)",
+			Value:   "balanced",
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_MODE"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-language",
+			Usage:   "language of operator-facing output (admin API errors, account standing) when a request's Accept-Language doesn't choose one: en or fr",
+			Value:   "en",
+			EnvVars: []string{"RELAY_SOVEREIGN_LANGUAGE"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-filter-hash-only",
+			Usage:   "send commits the sovereign stream doesn't carry as stubs holding only the commit's hash and sequence, rather than leaving them out",
+			EnvVars: []string{"RELAY_SOVEREIGN_FILTER_HASH_ONLY"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-public-delay",
+			Usage:   "hold the sovereign stream back this long from public subscribers (consumers without a subscriber token, and those whose profile is public), giving moderators lead time; other subscribers get it in real time. 0 disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_PUBLIC_DELAY"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-prescreen-timeout",
+			Usage:   "hold watchlisted accounts' events this long for a moderator's decision before the timeout action applies; held events aren't persisted or broadcast on any stream until then. 0 disables pre-screening",
+			EnvVars: []string{"RELAY_SOVEREIGN_PRESCREEN_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-prescreen-on-timeout",
+			Usage:   "what is done with pre-screened events nobody decides on in time: emit or drop",
+			Value:   "emit",
+			EnvVars: []string{"RELAY_SOVEREIGN_PRESCREEN_ON_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-prescreen-max-pending",
+			Usage:   "most pre-screened events held at once; beyond this, the oldest is handled as if it had timed out",
+			Value:   10_000,
+			EnvVars: []string{"RELAY_SOVEREIGN_PRESCREEN_MAX_PENDING"},
+		},
+		&cli.Float64Flag{
+			Name:    "sovereign-shadow-sample-rate",
+			Usage:   "share of the filter's decisions in shadow mode (the shadow-filtering feature flag) kept in the decision log, from 0 to 1; 0 keeps only the metrics",
+			Value:   0.01,
+			EnvVars: []string{"RELAY_SOVEREIGN_SHADOW_SAMPLE_RATE"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-shadow-log-size",
+			Usage:   "sampled shadow mode decisions kept in the log",
+			Value:   10_000,
+			EnvVars: []string{"RELAY_SOVEREIGN_SHADOW_LOG_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-country-retry-interval",
+			Usage:   "how long before an account the country resolver had no confident answer for is tried again",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_COUNTRY_RETRY_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-classification-ttl",
+			Usage:   "lifetime of classifications applied by the country resolver, after which the account is resolved again; 0 keeps them indefinitely",
+			Value:   30 * 24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_CLASSIFICATION_TTL"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-classification-flap-changes",
+			Usage:   "changes of an account's classified country within --sovereign-classification-flap-window at which it is flapping; 0 disables detection",
+			Value:   3,
+			EnvVars: []string{"RELAY_SOVEREIGN_CLASSIFICATION_FLAP_CHANGES"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-classification-flap-window",
+			Usage:   "window over which classification changes are counted for flapping",
+			Value:   time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_CLASSIFICATION_FLAP_WINDOW"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-classification-hold-down",
+			Usage:   "how long a flapping account is held at its most confident recent classification, less confident country resolver answers being ignored; 0 reports flapping without damping it",
+			Value:   6 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_CLASSIFICATION_HOLD_DOWN"},
+		},
+		&cli.StringFlag{
+			Name:    "filter-cache-redis-url",
+			Usage:   "Redis server (eg, redis://localhost:6379/0) to share the sovereign stream filter's country resolution decisions through, with other relay instances and across restarts; empty keeps them in-process",
+			EnvVars: []string{"RELAY_FILTER_CACHE_REDIS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-plc-audit-host",
+			Usage:   "PLC directory used to audit classified did:plc accounts' identity histories; empty disables auditing",
+			EnvVars: []string{"RELAY_SOVEREIGN_PLC_AUDIT_HOST"},
+		},
+		&cli.Float64Flag{
+			Name:    "sovereign-plc-audit-rate",
+			Usage:   "maximum requests per second to the PLC directory when auditing",
+			Value:   5,
+			EnvVars: []string{"RELAY_SOVEREIGN_PLC_AUDIT_RATE"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-plc-audit-interval",
+			Usage:   "how often each classified did:plc account's identity history is re-audited",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_PLC_AUDIT_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-country-plc-origin",
+			Usage:   "attribute did:plc accounts to the country of the PDS they registered on, from their operation log in the --sovereign-plc-audit-host directory; asked after PDS geolocation, which it requires",
+			EnvVars: []string{"RELAY_SOVEREIGN_COUNTRY_PLC_ORIGIN"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-plc-origin-cache-ttl",
+			Usage:   "how long PLC origin answers are cached",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"RELAY_SOVEREIGN_PLC_ORIGIN_CACHE_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-talkers-window",
+			Usage:   "window over which received events and bytes are counted by account and PDS, for the top talkers report (eg, 1h); 0 disables accounting",
+			EnvVars: []string{"RELAY_SOVEREIGN_TALKERS_WINDOW"},
+		},
+		&cli.Float64Flag{
+			Name:    "sovereign-talkers-dominant-share",
+			Usage:   "share of the talkers window's bytes at which an account dominates, and --sovereign-talkers-action applies; 0 disables",
+			Value:   0.05,
+			EnvVars: []string{"RELAY_SOVEREIGN_TALKERS_DOMINANT_SHARE"},
+		},
+		&cli.Int64Flag{
+			Name:    "sovereign-talkers-min-bytes",
+			Usage:   "no account dominates a talkers window holding fewer bytes than this",
+			Value:   64 << 20,
+			EnvVars: []string{"RELAY_SOVEREIGN_TALKERS_MIN_BYTES"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-talkers-action",
+			Usage:   "what is done about dominant accounts: review (flag them in the report) or limit (withhold their events from the sovereign stream while they dominate)",
+			Value:   "review",
+			EnvVars: []string{"RELAY_SOVEREIGN_TALKERS_ACTION"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-forensics-dir",
+			Usage:   "directory forensic bundles (recent frames, log records and classification state of the affected account and host) are captured to when anomalies are detected; empty disables capture",
+			EnvVars: []string{"RELAY_SOVEREIGN_FORENSICS_DIR"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-forensics-frames",
+			Usage:   "recent frames from PDS hosts kept in memory for forensic bundles",
+			Value:   10_000,
+			EnvVars: []string{"RELAY_SOVEREIGN_FORENSICS_FRAMES"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-forensics-cooldown",
+			Usage:   "an account or host is captured at most once per cooldown",
+			Value:   10 * time.Minute,
+			EnvVars: []string{"RELAY_SOVEREIGN_FORENSICS_COOLDOWN"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-forensics-max-bundles",
+			Usage:   "forensic bundles kept; the oldest are removed beyond this. 0 keeps every bundle",
+			Value:   100,
+			EnvVars: []string{"RELAY_SOVEREIGN_FORENSICS_MAX_BUNDLES"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-identity-refresh-interval",
+			Usage:   "how often queued synthetic #identity refresh events are checked for due entries; 0 disables emitting them",
+			Value:   10 * time.Second,
+			EnvVars: []string{"RELAY_SOVEREIGN_IDENTITY_REFRESH_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-identity-refresh-batch",
+			Usage:   "maximum synthetic #identity refresh events emitted per check",
+			Value:   100,
+			EnvVars: []string{"RELAY_SOVEREIGN_IDENTITY_REFRESH_BATCH"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-hostname",
+			Usage:   "public hostname of this relay, as configured on peer relays; also enables the user transparency endpoints (service auth audience did:web:<hostname>)",
+			EnvVars: []string{"RELAY_SOVEREIGN_HOSTNAME"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-peers",
+			Usage:   "base URLs of cooperating relays to exchange health beacons with",
+			EnvVars: []string{"RELAY_SOVEREIGN_PEERS"},
+		},
+		&cli.DurationFlag{
+			Name:    "sovereign-peering-interval",
+			Usage:   "how often to exchange health beacons with peer relays",
+			EnvVars: []string{"RELAY_SOVEREIGN_PEERING_INTERVAL"},
+			Value:   time.Minute,
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-alternates",
+			Usage:   "base URLs of relays consumers may fail over to, advertised in describeServer and on shutdown",
+			EnvVars: []string{"RELAY_SOVEREIGN_ALTERNATES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-stream-countries",
+			Usage:   "country codes of accounts to carry on the sovereign stream (/sovereignty/xrpc/com.atproto.sync.subscribeRepos); empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_STREAM_COUNTRIES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-stream-subdivisions",
+			Usage:   "ISO 3166-2 subdivision codes (eg, CA-QC) of accounts to carry on the sovereign stream, as well as those of --sovereign-stream-countries; for provincial or territorial deployments",
+			EnvVars: []string{"RELAY_SOVEREIGN_STREAM_SUBDIVISIONS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-exclude-countries",
+			Usage:   "ISO 3166-1 alpha-2 codes of countries whose accounts are left out of the sovereign stream, which then carries all others, classified or not; can't be combined with --sovereign-stream-countries or --sovereign-stream-subdivisions",
+			EnvVars: []string{"RELAY_SOVEREIGN_EXCLUDE_COUNTRIES"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-transform-rules",
+			Usage:   "path to a JSON file of outbound record transformation rules for the sovereign stream",
+			EnvVars: []string{"RELAY_SOVEREIGN_TRANSFORM_RULES"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-egress-rules",
+			Usage:   "path to a JSON file of egress rules, naming the countries whose sovereign stream subscribers (located by --sovereign-pds-geoip-db or --sovereign-pds-geo-ranges) receive records of a collection in full",
+			EnvVars: []string{"RELAY_SOVEREIGN_EGRESS_RULES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-namespace-allow",
+			Usage:   "collection NSIDs, or namespaces ending in .* (eg, app.gndr.*), whose records the sovereign stream carries; others are left out",
+			EnvVars: []string{"RELAY_SOVEREIGN_NAMESPACE_ALLOW"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-namespace-block",
+			Usage:   "collection NSIDs, or namespaces ending in .* (eg, chat.*), whose records the sovereign stream doesn't carry, applied over --sovereign-namespace-allow",
+			EnvVars: []string{"RELAY_SOVEREIGN_NAMESPACE_BLOCK"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-language-filter",
+			Usage:   "judge commits by the languages their posts declare: require leaves out those whose posts declare none of --sovereign-language-filter-langs, prefer carries those whose posts declare one of them whatever the account's classification; empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_LANGUAGE_FILTER"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-language-filter-langs",
+			Usage:   "BCP-47 language tags the language filter looks for, each matching tags equal to it or extending it (eg, fr matches fr-CA)",
+			Value:   cli.NewStringSlice("fr-CA", "en-CA"),
+			EnvVars: []string{"RELAY_SOVEREIGN_LANGUAGE_FILTER_LANGS"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-language-filter-keep-undeclared",
+			Usage:   "count posts declaring no languages as declaring one the language filter looks for",
+			EnvVars: []string{"RELAY_SOVEREIGN_LANGUAGE_FILTER_KEEP_UNDECLARED"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-blob-policy",
+			Usage:   "path to a JSON blob policy (allowed MIME types, maximum sizes by type); records referencing other blobs are recorded as violations",
+			EnvVars: []string{"RELAY_SOVEREIGN_BLOB_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-transcode-url",
+			Usage:   "URL of an external transcoding service video blobs are handed off to (requires --sovereign-hostname)",
+			EnvVars: []string{"RELAY_SOVEREIGN_TRANSCODE_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-transcode-secret",
+			Usage:   "shared secret for the transcoding service, sent with jobs and required on its callbacks",
+			EnvVars: []string{"RELAY_SOVEREIGN_TRANSCODE_SECRET"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-transcode-workers",
+			Usage:   "number of concurrent job submissions to the transcoding service",
+			Value:   4,
+			EnvVars: []string{"RELAY_SOVEREIGN_TRANSCODE_WORKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-minor-policy",
+			Usage:   "path to a JSON minor-protection policy (flagging labels, birthdate record, and which protections apply); empty disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_MINOR_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-residency-policy",
+			Usage:   "path to a JSON policy for verifying residency declarations accounts publish in their repos (mode, confidence, countries, minimum interval); empty ignores declarations",
+			EnvVars: []string{"RELAY_SOVEREIGN_RESIDENCY_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-lexicon-dir",
+			Usage:   "directory of lexicon schema files (JSON) the records of processed commits are validated against; empty disables validation",
+			EnvVars: []string{"RELAY_SOVEREIGN_LEXICON_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-lexicon-policy",
+			Usage:   "path to a JSON policy for record validation (default, per-collection and unknown-lexicon strictness: pass, label or reject); empty labels invalid records and passes unknown collections",
+			EnvVars: []string{"RELAY_SOVEREIGN_LEXICON_POLICY"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-lexicon-resolve",
+			Usage:   "resolve the lexicons of collections missing from the lexicon directory from the network, as their records turn up",
+			EnvVars: []string{"RELAY_SOVEREIGN_LEXICON_RESOLVE"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-annotate-indigenous-langs",
+			Usage:   "annotate posts declaring Indigenous languages in sovereign stream frame metadata",
+			EnvVars: []string{"RELAY_SOVEREIGN_ANNOTATE_INDIGENOUS_LANGS"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-enrich-posts",
+			Usage:   "deprecated: use --feature post-enrichment=true",
+			EnvVars: []string{"RELAY_SOVEREIGN_ENRICH_POSTS"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-retention-rules",
+			Usage:   "path to a JSON array of per-collection playback retention rules, eg [{\"match\": \"app.gndr.chat.*\", \"ttl\": \"0s\"}, {\"match\": \"#identity\", \"forever\": true}]; requires the disk persister",
+			EnvVars: []string{"RELAY_SOVEREIGN_RETENTION_RULES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "feature",
+			Usage:   "set a feature flag's startup value, as name=true or name=false (eg, post-enrichment=true); runtime overrides from the admin API take precedence. Multiple allowed",
+			EnvVars: []string{"RELAY_FEATURES"},
+		},
+		&cli.StringFlag{
+			Name:    "feature-file",
+			Usage:   "JSON file runtime feature flag overrides are persisted to; by default they are kept in the database",
+			EnvVars: []string{"RELAY_FEATURE_FILE"},
+		},
+		&cli.Float64Flag{
+			Name:    "sovereign-lang-stats-sample-rate",
+			Usage:   "fraction of new posts from classified accounts sampled for per-region language statistics (eg, 0.01); 0 disables",
+			EnvVars: []string{"RELAY_SOVEREIGN_LANG_STATS_SAMPLE_RATE"},
+		},
+		&cli.Int64Flag{
+			Name:    "sovereign-lang-stats-min-samples",
+			Usage:   "minimum sampled posts for a region and day to be included in published language statistics",
+			Value:   20,
+			EnvVars: []string{"RELAY_SOVEREIGN_LANG_STATS_MIN_SAMPLES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "sovereign-appeal-webhooks",
+			Usage:   "URLs to POST appeal notifications (submitted, assigned, resolved) to",
+			EnvVars: []string{"RELAY_SOVEREIGN_APPEAL_WEBHOOKS"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-priority-require-verified-org",
+			Usage:   "only allow verified organizations to be added as priority accounts",
+			EnvVars: []string{"RELAY_SOVEREIGN_PRIORITY_REQUIRE_VERIFIED_ORG"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-policy-authority",
+			Usage:   "public key (did:key) of the authority whose signed policy documents may replace the sovereign stream configuration at runtime",
+			EnvVars: []string{"RELAY_SOVEREIGN_POLICY_AUTHORITY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-policy-document",
+			Usage:   "path to a signed policy document (compact JWS) to apply at startup, if newer than the last one applied",
+			EnvVars: []string{"RELAY_SOVEREIGN_POLICY_DOCUMENT"},
+		},
+		&cli.IntFlag{
+			Name:    "sovereign-policy-history",
+			Usage:   "number of applied policy documents to keep for audit",
+			Value:   20,
+			EnvVars: []string{"RELAY_SOVEREIGN_POLICY_HISTORY"},
+		},
+		&cli.StringFlag{
+			Name:    "sovereign-resume-key",
+			Usage:   "secret (at least 16 bytes) for signing the resume tokens carried on sovereign stream frames; empty leaves consumers on integer cursors",
+			EnvVars: []string{"RELAY_SOVEREIGN_RESUME_KEY"},
+		},
+		&cli.Int64Flag{
+			Name:    "sovereign-resume-epoch",
+			Usage:   "event log epoch carried in resume tokens; bump whenever the event log is reset",
+			EnvVars: []string{"RELAY_SOVEREIGN_RESUME_EPOCH"},
+		},
+		&cli.BoolFlag{
+			Name:    "sovereign-resume-integer-cursors",
+			Usage:   "with a resume key set, still accept plain integer cursors, which can't be checked, from consumers which predate resume tokens",
+			EnvVars: []string{"RELAY_SOVEREIGN_RESUME_INTEGER_CURSORS"},
+		},
 	}
 
 	app.Action = runBigsky
+	app.Commands = []*cli.Command{
+		// defined in simulate.go
+		cmdSimulate,
+		// defined in config.go
+		cmdConfig,
+	}
 	return app.Run(os.Args)
 }
 
@@ -311,6 +1184,21 @@ func runBigsky(cctx *cli.Context) error {
 		return err
 	}
 
+	// the config file is checked up front, so every problem is reported before anything starts
+	var configDoc []byte
+	if path := cctx.String("config"); path != "" {
+		configDoc, err = readConfigFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	resolverConfig := resolverConfigFromFlags(cctx)
+	if configDoc != nil {
+		if err := configschema.LoadSection(configDoc, "resolver", &resolverConfig); err != nil {
+			return err
+		}
+	}
+
 	// start observability/tracing (OTEL and jaeger)
 	if err := setupOTEL(cctx); err != nil {
 		return err
@@ -335,6 +1223,15 @@ func runBigsky(cctx *cli.Context) error {
 		}
 	}
 
+	var keyring *keymgmt.Keyring
+	if fname := cctx.String("encryption-keyring"); fname != "" {
+		keyring, err = keymgmt.LoadKeyring(fname)
+		if err != nil {
+			return err
+		}
+		slog.Info("encrypting data at rest", "keys", keyring.Keys(), "primary", keyring.Primary())
+	}
+
 	var cstore carstore.CarStore
 	scyllaAddrs := cctx.StringSlice("scylla-carstore")
 	sqliteStore := cctx.Bool("ex-sqlite-carstore")
@@ -344,6 +1241,14 @@ func runBigsky(cctx *cli.Context) error {
 	} else if sqliteStore {
 		slog.Info("starting sqlite carstore", "dir", csdir)
 		cstore, err = carstore.NewSqliteStore(csdir)
+	} else if cctx.Bool("dedup-carstore") {
+		slog.Info("starting dedup carstore", "dir", csdir)
+		dds, err := carstore.NewDedupStore(csdir)
+		if err != nil {
+			return err
+		}
+		go dds.RunGC(context.Background(), cctx.Duration("dedup-gc-interval"))
+		cstore = dds
 	} else if cctx.Bool("non-archival") {
 		csdburl := cctx.String("carstore-db-url")
 		slog.Info("setting up non-archival carstore database", "url", csdburl)
@@ -387,6 +1292,61 @@ func runBigsky(cctx *cli.Context) error {
 		cstore, err = carstore.NewCarStore(csdb, csdirs)
 	}
 
+	if err != nil {
+		return err
+	}
+	if keyring != nil {
+		fcs, ok := cstore.(*carstore.FileCarStore)
+		if !ok {
+			return fmt.Errorf("encryption at rest requires the default file carstore")
+		}
+		fcs.SetKeyring(keyring)
+	}
+	if cold := cctx.String("cold-storage"); cold != "" {
+		fcs, ok := cstore.(*carstore.FileCarStore)
+		if !ok {
+			return fmt.Errorf("cold storage requires the default file carstore")
+		}
+		var store carstore.ColdStore
+		if strings.HasPrefix(cold, "http://") || strings.HasPrefix(cold, "https://") {
+			store = &carstore.HTTPColdStore{BaseURL: cold}
+		} else {
+			store = &carstore.DirColdStore{Dir: cold}
+		}
+		tiers, err := carstore.NewTiering(store, filepath.Join(datadir, "cold-cache"), &carstore.TieringPolicy{
+			MinAge:       cctx.Duration("cold-storage-min-age"),
+			MaxColdReads: cctx.Int("cold-storage-max-reads"),
+			PromoteReads: cctx.Int("cold-storage-promote-reads"),
+			Interval:     cctx.Duration("cold-storage-interval"),
+			CacheBytes:   cctx.Int64("cold-storage-cache-mb") << 20,
+		})
+		if err != nil {
+			return err
+		}
+		fcs.SetTiering(tiers)
+		slog.Info("migrating old carstore shards to cold storage", "store", cold, "minAge", cctx.Duration("cold-storage-min-age"))
+		go fcs.RunTiering(context.Background())
+	}
+
+	httpProfiles := httpprofile.Defaults()
+	if fname := cctx.String("http-profiles"); fname != "" {
+		httpProfiles, err = httpprofile.Load(fname)
+		if err != nil {
+			return err
+		}
+	}
+	var proxyRules []httpprofile.ProxyRule
+	if fname := cctx.String("http-proxy-rules"); fname != "" {
+		proxyRules, err = httpprofile.LoadProxyRules(fname)
+		if err != nil {
+			return err
+		}
+	}
+	if proxy := cctx.String("http-proxy"); proxy != "" || len(proxyRules) > 0 {
+		httpProfiles.SetProxy(proxy, proxyRules)
+		slog.Info("routing outbound requests through proxies", "proxy", proxy, "rules", len(proxyRules))
+	}
+	httpClients, err := httpprofile.NewClients(httpProfiles)
 	if err != nil {
 		return err
 	}
@@ -399,24 +1359,24 @@ func runBigsky(cctx *cli.Context) error {
 	{
 		mr := did.NewMultiResolver()
 
-		didr := &plc.PLCServer{Host: cctx.String("plc-host")}
+		didr := &plc.PLCServer{Host: resolverConfig.PLCHost, C: httpClients.Get(httpprofile.Crawler)}
 		mr.AddHandler("plc", didr)
 
-		webr := did.WebResolver{}
+		webr := did.WebResolver{Client: httpClients.Get(httpprofile.Interactive)}
 		if cctx.Bool("crawl-insecure-ws") {
 			webr.Insecure = true
 		}
 		mr.AddHandler("web", &webr)
 
 		var prevResolver did.Resolver
-		memcachedServers := cctx.StringSlice("did-memcached")
+		memcachedServers := resolverConfig.DIDMemcached
 		if len(memcachedServers) > 0 {
 			prevResolver = plc.NewMemcachedDidResolver(mr, time.Hour*24, memcachedServers)
 		} else {
 			prevResolver = mr
 		}
 
-		cachedidr = plc.NewCachingDidResolver(prevResolver, time.Hour*24, cctx.Int("did-cache-size"))
+		cachedidr = plc.NewCachingDidResolver(prevResolver, time.Hour*24, resolverConfig.DIDCacheSize)
 	}
 
 	kmgr := indexer.NewKeyManager(cachedidr, nil)
@@ -430,12 +1390,42 @@ func runBigsky(cctx *cli.Context) error {
 
 		pOpts := diskpersist.DefaultDiskPersistOptions()
 		pOpts.Retention = cctx.Duration("event-playback-ttl")
+		pOpts.FlushInterval = cctx.Duration("disk-persister-flush-interval")
+		durability, err := diskpersist.ParseDurability(cctx.String("disk-persister-durability"))
+		if err != nil {
+			return err
+		}
+		pOpts.Durability = durability
+		pOpts.Keyring = keyring
+		seqdb := db
+		if seqdburl := cctx.String("sequencer-db-url"); seqdburl != "" {
+			seqdb, err = cliutil.SetupDatabase(seqdburl, cctx.Int("max-metadb-connections"))
+			if err != nil {
+				return fmt.Errorf("setting up sequencer database: %w", err)
+			}
+		}
+		alloc, err := sequencer.NewDBAllocator(seqdb, "events")
+		if err != nil {
+			return fmt.Errorf("setting up sequence allocator: %w", err)
+		}
+		seqOpts := sequencer.DefaultOptions()
+		seqOpts.Holder = cctx.String("sequencer-holder")
+		if seqOpts.Holder == "" {
+			if seqOpts.Holder, err = os.Hostname(); err != nil {
+				return fmt.Errorf("naming sequencer holder: %w", err)
+			}
+		}
+		seqOpts.BlockSize = cctx.Int64("sequencer-block-size")
+		pOpts.Sequencer = sequencer.New(alloc, seqOpts)
 		dp, err := diskpersist.NewDiskPersistence(dpd, "", db, pOpts)
 		if err != nil {
 			return fmt.Errorf("setting up disk persister: %w", err)
 		}
 		persister = dp
 	} else {
+		if keyring != nil {
+			return fmt.Errorf("encryption at rest requires the disk persister (--disk-persister-dir)")
+		}
 		dbp, err := dbpersist.NewDbPersistence(db, cstore, nil)
 		if err != nil {
 			return fmt.Errorf("setting up db event persistence: %w", err)
@@ -444,6 +1434,13 @@ func runBigsky(cctx *cli.Context) error {
 	}
 
 	evtman := events.NewEventManager(persister)
+	orderOpts := events.DefaultOrderingOptions()
+	orderOpts.Check = cctx.Bool("ordering-checks")
+	orderOpts.ReorderWindow = cctx.Int("ordering-reorder-window")
+	orderOpts.ReorderDelay = cctx.Duration("ordering-reorder-delay")
+	if err := evtman.SetOrdering(orderOpts); err != nil {
+		return err
+	}
 
 	rf := indexer.NewRepoFetcher(db, repoman, cctx.Int("max-fetch-concurrency"))
 
@@ -455,19 +1452,18 @@ func runBigsky(cctx *cli.Context) error {
 
 	rlskip := cctx.String("bsky-social-rate-limit-skip")
 	ix.ApplyPDSClientSettings = func(c *xrpc.Client) {
-		if c.Client == nil {
-			c.Client = util.RobustHTTPClient()
-		}
 		if strings.HasSuffix(c.Host, ".bsky.network") {
-			c.Client.Timeout = time.Minute * 30
+			// large hosts serve large repos
+			if c.Client == nil {
+				httpClients.ApplyXRPC(httpprofile.Bulk, c)
+			}
 			if rlskip != "" {
 				c.Headers = map[string]string{
 					"x-ratelimit-bypass": rlskip,
 				}
 			}
-		} else {
-			// Generic PDS timeout
-			c.Client.Timeout = time.Minute * 1
+		} else if c.Client == nil {
+			httpClients.ApplyXRPC(httpprofile.Crawler, c)
 		}
 	}
 	rf.ApplyPDSClientSettings = ix.ApplyPDSClientSettings
@@ -478,10 +1474,19 @@ func runBigsky(cctx *cli.Context) error {
 		}
 	}, false)
 
-	prodHR, err := handles.NewProdHandleResolver(100_000, cctx.String("resolve-address"), cctx.Bool("force-dns-udp"))
+	prodHR, err := handles.NewProdHandleResolver(100_000, resolverConfig.ResolveAddress, resolverConfig.ForceDNSUDP)
 	if err != nil {
 		return fmt.Errorf("failed to set up handle resolver: %w", err)
 	}
+	prodHR.Client = httpClients.Get(httpprofile.Interactive)
+	if endpoints := resolverConfig.DoH; len(endpoints) > 0 {
+		prodHR.DoH = identity.NewDoHResolver(endpoints)
+		prodHR.DoH.HTTPClient = httpClients.Get(httpprofile.Interactive)
+		if resolverConfig.DoHNoFallback {
+			prodHR.DoH.Fallback = nil
+		}
+		slog.Info("resolving handle TXT records with DNS-over-HTTPS", "endpoints", endpoints, "fallback", prodHR.DoH.Fallback != nil)
+	}
 	if rlskip != "" {
 		prodHR.ReqMod = func(req *http.Request, host string) error {
 			if strings.HasSuffix(host, ".bsky.social") {
@@ -500,12 +1505,28 @@ func runBigsky(cctx *cli.Context) error {
 
 	slog.Info("constructing bgs")
 	bgsConfig := libbgs.DefaultBGSConfig()
+	bgsConfig.HTTPClients = httpClients
 	bgsConfig.SSL = !cctx.Bool("crawl-insecure-ws")
 	bgsConfig.CompactInterval = cctx.Duration("compact-interval")
 	bgsConfig.ConcurrencyPerPDS = cctx.Int64("concurrency-per-pds")
 	bgsConfig.MaxQueuePerPDS = cctx.Int64("max-queue-per-pds")
 	bgsConfig.DefaultRepoLimit = cctx.Int64("default-repo-limit")
 	bgsConfig.NumCompactionWorkers = cctx.Int("num-compaction-workers")
+	bgsConfig.ScrubInterval = cctx.Duration("scrub-interval")
+	bgsConfig.ScrubRate = cctx.Float64("scrub-rate")
+	bgsConfig.ScrubRepair = cctx.Bool("scrub-repair")
+	bgsConfig.MirrorCheckInterval = cctx.Duration("mirror-check-interval")
+	bgsConfig.MirrorCheckSample = cctx.Int("mirror-check-sample")
+	bgsConfig.MirrorCheckRate = cctx.Float64("mirror-check-rate")
+	bgsConfig.MirrorCheckResync = cctx.Bool("mirror-check-resync")
+	bgsConfig.FilterCacheRedisURL = cctx.String("filter-cache-redis-url")
+	bgsConfig.RepoExportConcurrency = cctx.Int("repo-export-concurrency")
+	bgsConfig.Scale = libbgs.ScaleTargets{
+		IngestLag:        cctx.Duration("scale-ingest-lag-target"),
+		PersisterBacklog: cctx.Int64("scale-persister-backlog-target"),
+		FanoutSaturation: cctx.Float64("scale-fanout-saturation-target"),
+		Subscribers:      cctx.Int("scale-subscribers-target"),
+	}
 	nextCrawlers := cctx.StringSlice("next-crawler")
 	if len(nextCrawlers) != 0 {
 		nextCrawlerUrls := make([]*url.URL, len(nextCrawlers))
@@ -519,10 +1540,263 @@ func runBigsky(cctx *cli.Context) error {
 		}
 		bgsConfig.NextCrawlers = nextCrawlerUrls
 	}
+	bgsConfig.StreamVersions.Minimum = cctx.Int64("stream-min-version")
+	bgsConfig.StreamVersions.DeprecatedBelow = cctx.Int64("stream-deprecated-below")
+	bgsConfig.StreamVersions.WarnUndeclared = cctx.Bool("stream-warn-undeclared-version")
+	bgsConfig.StreamVersions.Notices = cctx.StringSlice("stream-notices")
+	if path := cctx.String("admin-socket"); path != "" {
+		mode, err := strconv.ParseUint(cctx.String("admin-socket-mode"), 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid admin socket mode: %w", err)
+		}
+		bgsConfig.AdminSocket = &libbgs.AdminSocketConfig{
+			Path:      path,
+			Mode:      os.FileMode(mode),
+			AllowUIDs: cctx.IntSlice("admin-socket-allow-uid"),
+			Exclusive: cctx.Bool("admin-socket-only"),
+		}
+	} else if cctx.Bool("admin-socket-only") {
+		return fmt.Errorf("--admin-socket-only requires --admin-socket")
+	}
+	if rpID := cctx.String("admin-webauthn-rp-id"); rpID != "" {
+		origins := cctx.StringSlice("admin-webauthn-origin")
+		if len(origins) == 0 {
+			origins = []string{"https://" + rpID}
+		}
+		bgsConfig.AdminWebAuthn = &libbgs.AdminWebAuthnConfig{
+			RelyingParty: webauthn.RelyingParty{
+				ID:                      rpID,
+				Name:                    "Relay admin (" + rpID + ")",
+				Origins:                 origins,
+				RequireUserVerification: true,
+			},
+			SessionTTL:          cctx.Duration("admin-webauthn-session-ttl"),
+			BootstrapToken:      cctx.String("admin-webauthn-bootstrap-token"),
+			BootstrapTokenFile:  cctx.String("admin-webauthn-bootstrap-token-file"),
+			DisableStaticTokens: cctx.Bool("admin-webauthn-only"),
+		}
+	}
+	if skey := cctx.String("sovereign-signing-key"); skey != "" {
+		key, err := crypto.ParsePrivateMultibase(skey)
+		if err != nil {
+			return fmt.Errorf("failed to parse sovereign signing key: %w", err)
+		}
+		bgsConfig.Sovereign.SnapshotSigningKey = key
+	}
+	if skey := cctx.String("sovereign-self-repo-key"); skey != "" {
+		key, err := crypto.ParsePrivateMultibase(skey)
+		if err != nil {
+			return fmt.Errorf("failed to parse relay repo key: %w", err)
+		}
+		bgsConfig.Sovereign.SelfRepoKey = key
+	}
+	bgsConfig.Sovereign.SelfRepoPath = cctx.String("sovereign-self-repo-path")
+	bgsConfig.Sovereign.SelfRepoStatusInterval = cctx.Duration("sovereign-self-repo-status-interval")
+	bgsConfig.Sovereign.HandleCheckWorkers = cctx.Int("sovereign-handle-check-workers")
+	bgsConfig.Sovereign.HandleCheckVerifiedTTL = cctx.Duration("sovereign-handle-check-verified-ttl")
+	bgsConfig.Sovereign.HandleCheckFailedTTL = cctx.Duration("sovereign-handle-check-failed-ttl")
+	bgsConfig.Sovereign.HandleCheckFailureThreshold = cctx.Int("sovereign-handle-check-failure-threshold")
+	if fname := cctx.String("sovereign-pds-geo-ranges"); fname != "" {
+		ranges, err := pdsgeo.LoadRangesFile(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.PDSGeoRanges = ranges
+	}
+	bgsConfig.Sovereign.PDSGeoIPDatabase = cctx.String("sovereign-pds-geoip-db")
+	bgsConfig.Sovereign.PDSGeoIPReloadInterval = cctx.Duration("sovereign-pds-geoip-reload-interval")
+	bgsConfig.Sovereign.InCountryList = cctx.String("sovereign-in-country-list")
+	bgsConfig.Sovereign.OutOfCountryList = cctx.String("sovereign-out-of-country-list")
+	bgsConfig.Sovereign.DIDListReloadInterval = cctx.Duration("sovereign-list-reload-interval")
+	bgsConfig.Sovereign.ExtensionDir = cctx.String("sovereign-extension-dir")
+	bgsConfig.Sovereign.ExtensionMemoryLimit = cctx.Int64("sovereign-extension-memory-limit")
+	bgsConfig.Sovereign.ExtensionTimeout = cctx.Duration("sovereign-extension-timeout")
+	bgsConfig.Sovereign.ExtensionReloadInterval = cctx.Duration("sovereign-extension-reload-interval")
+	bgsConfig.Sovereign.FilterPluginTarget = cctx.String("sovereign-filter-plugin")
+	bgsConfig.Sovereign.FilterPluginTLS = cctx.Bool("sovereign-filter-plugin-tls")
+	bgsConfig.Sovereign.FilterPluginConns = cctx.Int("sovereign-filter-plugin-conns")
+	bgsConfig.Sovereign.FilterPluginTimeout = cctx.Duration("sovereign-filter-plugin-timeout")
+	bgsConfig.Sovereign.FilterPluginFallback = cctx.String("sovereign-filter-plugin-fallback")
+	bgsConfig.Sovereign.FilterPluginFailures = cctx.Int("sovereign-filter-plugin-failures")
+	bgsConfig.Sovereign.FilterPluginCooldown = cctx.Duration("sovereign-filter-plugin-cooldown")
+	bgsConfig.Sovereign.CountryResolverURL = cctx.String("sovereign-country-resolver-url")
+	bgsConfig.Sovereign.CountryResolveWorkers = cctx.Int("sovereign-country-resolve-workers")
+	bgsConfig.Sovereign.VerificationURL = cctx.String("sovereign-verification-url")
+	bgsConfig.Sovereign.VerificationToken = cctx.String("sovereign-verification-token")
+	bgsConfig.Sovereign.VerificationTimeout = cctx.Duration("sovereign-verification-timeout")
+	bgsConfig.Sovereign.VerificationFailures = cctx.Int("sovereign-verification-failures")
+	bgsConfig.Sovereign.VerificationCooldown = cctx.Duration("sovereign-verification-cooldown")
+	bgsConfig.Sovereign.VerificationCacheTTL = cctx.Duration("sovereign-verification-cache-ttl")
+	bgsConfig.Sovereign.VerificationUnknownTTL = cctx.Duration("sovereign-verification-unknown-ttl")
+	minConf, err := sovereignty.ParseConfidence(cctx.String("sovereign-country-min-confidence"))
+	if err != nil {
+		return err
+	}
+	bgsConfig.Sovereign.CountryMinConfidence = minConf
+	bgsConfig.Sovereign.FilterMode = cctx.String("sovereign-filter-mode")
+	bgsConfig.Sovereign.FilterHashOnly = cctx.Bool("sovereign-filter-hash-only")
+	bgsConfig.Sovereign.PublicStreamDelay = cctx.Duration("sovereign-public-delay")
+	bgsConfig.Sovereign.PreScreenTimeout = cctx.Duration("sovereign-prescreen-timeout")
+	bgsConfig.Sovereign.PreScreenOnTimeout = cctx.String("sovereign-prescreen-on-timeout")
+	bgsConfig.Sovereign.PreScreenMaxPending = cctx.Int("sovereign-prescreen-max-pending")
+	bgsConfig.Sovereign.ShadowSampleRate = cctx.Float64("sovereign-shadow-sample-rate")
+	bgsConfig.Sovereign.ShadowLogSize = cctx.Int("sovereign-shadow-log-size")
+	bgsConfig.Sovereign.Language = cctx.String("sovereign-language")
+	bgsConfig.Sovereign.CountryRetryInterval = cctx.Duration("sovereign-country-retry-interval")
+	bgsConfig.Sovereign.ClassificationTTL = cctx.Duration("sovereign-classification-ttl")
+	bgsConfig.Sovereign.ClassificationFlapChanges = cctx.Int("sovereign-classification-flap-changes")
+	bgsConfig.Sovereign.ClassificationFlapWindow = cctx.Duration("sovereign-classification-flap-window")
+	bgsConfig.Sovereign.ClassificationHoldDown = cctx.Duration("sovereign-classification-hold-down")
+	bgsConfig.Sovereign.PLCAuditHost = cctx.String("sovereign-plc-audit-host")
+	bgsConfig.Sovereign.PLCAuditRate = cctx.Float64("sovereign-plc-audit-rate")
+	bgsConfig.Sovereign.PLCAuditInterval = cctx.Duration("sovereign-plc-audit-interval")
+	bgsConfig.Sovereign.PLCOriginResolver = cctx.Bool("sovereign-country-plc-origin")
+	bgsConfig.Sovereign.PLCOriginCacheTTL = cctx.Duration("sovereign-plc-origin-cache-ttl")
+	bgsConfig.Sovereign.TalkersWindow = cctx.Duration("sovereign-talkers-window")
+	bgsConfig.Sovereign.TalkersDominantShare = cctx.Float64("sovereign-talkers-dominant-share")
+	bgsConfig.Sovereign.TalkersMinBytes = cctx.Int64("sovereign-talkers-min-bytes")
+	bgsConfig.Sovereign.TalkersAction = cctx.String("sovereign-talkers-action")
+	bgsConfig.Sovereign.ForensicsDir = cctx.String("sovereign-forensics-dir")
+	bgsConfig.Sovereign.ForensicsFrames = cctx.Int("sovereign-forensics-frames")
+	bgsConfig.Sovereign.ForensicsCooldown = cctx.Duration("sovereign-forensics-cooldown")
+	bgsConfig.Sovereign.ForensicsMaxBundles = cctx.Int("sovereign-forensics-max-bundles")
+	bgsConfig.Sovereign.IdentityRefreshInterval = cctx.Duration("sovereign-identity-refresh-interval")
+	bgsConfig.Sovereign.IdentityRefreshBatch = cctx.Int("sovereign-identity-refresh-batch")
+	bgsConfig.Sovereign.SnapshotDir = cctx.String("sovereign-snapshot-dir")
+	bgsConfig.Sovereign.SnapshotUploadURL = cctx.String("sovereign-snapshot-upload-url")
+	bgsConfig.Sovereign.SnapshotInterval = cctx.Duration("sovereign-snapshot-interval")
+	bgsConfig.Sovereign.SnapshotMaxDiffs = cctx.Int("sovereign-snapshot-max-diffs")
+	bgsConfig.Sovereign.Hostname = cctx.String("sovereign-hostname")
+	bgsConfig.Sovereign.Peers = cctx.StringSlice("sovereign-peers")
+	bgsConfig.Sovereign.PeeringInterval = cctx.Duration("sovereign-peering-interval")
+	bgsConfig.Sovereign.Alternates = cctx.StringSlice("sovereign-alternates")
+	bgsConfig.Sovereign.StreamCountries = cctx.StringSlice("sovereign-stream-countries")
+	bgsConfig.Sovereign.StreamSubdivisions = cctx.StringSlice("sovereign-stream-subdivisions")
+	bgsConfig.Sovereign.ExcludeCountries = cctx.StringSlice("sovereign-exclude-countries")
+	bgsConfig.Sovereign.NamespaceAllowlist = cctx.StringSlice("sovereign-namespace-allow")
+	bgsConfig.Sovereign.NamespaceBlocklist = cctx.StringSlice("sovereign-namespace-block")
+	bgsConfig.Sovereign.LanguageFilter = cctx.String("sovereign-language-filter")
+	bgsConfig.Sovereign.LanguageFilterLangs = cctx.StringSlice("sovereign-language-filter-langs")
+	bgsConfig.Sovereign.LanguageFilterKeepUndeclared = cctx.Bool("sovereign-language-filter-keep-undeclared")
+	bgsConfig.Sovereign.AnnotateIndigenousLangs = cctx.Bool("sovereign-annotate-indigenous-langs")
+	bgsConfig.Sovereign.Features = map[string]bool{}
+	if cctx.Bool("sovereign-enrich-posts") {
+		bgsConfig.Sovereign.Features[features.PostEnrichment.String()] = true
+	}
+	for _, kv := range cctx.StringSlice("feature") {
+		name, val, ok := strings.Cut(kv, "=")
+		enabled, err := strconv.ParseBool(val)
+		if !ok || err != nil {
+			return fmt.Errorf("invalid --feature %q: expected name=true or name=false", kv)
+		}
+		bgsConfig.Sovereign.Features[name] = enabled
+	}
+	bgsConfig.Sovereign.FeatureFile = cctx.String("feature-file")
+	if fname := cctx.String("sovereign-retention-rules"); fname != "" {
+		rules, err := diskpersist.LoadRetentionRules(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.RetentionRules = rules
+	}
+	bgsConfig.Sovereign.PriorityRequiresVerifiedOrg = cctx.Bool("sovereign-priority-require-verified-org")
+	bgsConfig.Sovereign.AppealWebhooks = cctx.StringSlice("sovereign-appeal-webhooks")
+	if fname := cctx.String("sovereign-transform-rules"); fname != "" {
+		rules, err := transform.LoadRules(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.TransformRules = rules
+	}
+	if fname := cctx.String("sovereign-egress-rules"); fname != "" {
+		rules, err := egress.LoadRules(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.EgressRules = rules
+	}
+	if fname := cctx.String("sovereign-blob-policy"); fname != "" {
+		policy, err := blobs.LoadPolicy(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.BlobPolicy = policy
+	}
+	bgsConfig.Sovereign.TranscodeURL = cctx.String("sovereign-transcode-url")
+	bgsConfig.Sovereign.TranscodeSecret = cctx.String("sovereign-transcode-secret")
+	bgsConfig.Sovereign.TranscodeWorkers = cctx.Int("sovereign-transcode-workers")
+	bgsConfig.Sovereign.LangStatsSampleRate = cctx.Float64("sovereign-lang-stats-sample-rate")
+	bgsConfig.Sovereign.LangStatsMinSamples = cctx.Int64("sovereign-lang-stats-min-samples")
+	if fname := cctx.String("sovereign-minor-policy"); fname != "" {
+		policy, err := minors.LoadPolicy(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.MinorPolicy = policy
+	}
+	if fname := cctx.String("sovereign-residency-policy"); fname != "" {
+		policy, err := residency.LoadPolicy(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.ResidencyPolicy = policy
+	}
+	bgsConfig.Sovereign.LexiconDir = cctx.String("sovereign-lexicon-dir")
+	if fname := cctx.String("sovereign-lexicon-policy"); fname != "" {
+		policy, err := lexcheck.LoadPolicy(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.LexiconPolicy = policy
+	}
+	bgsConfig.Sovereign.LexiconResolve = cctx.Bool("sovereign-lexicon-resolve")
+	if didKey := cctx.String("sovereign-policy-authority"); didKey != "" {
+		pub, err := crypto.ParsePublicDIDKey(didKey)
+		if err != nil {
+			return fmt.Errorf("failed to parse sovereign policy authority: %w", err)
+		}
+		bgsConfig.Sovereign.PolicyAuthority = pub
+	}
+	if fname := cctx.String("sovereign-policy-document"); fname != "" {
+		b, err := os.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+		bgsConfig.Sovereign.PolicyDocument = strings.TrimSpace(string(b))
+	}
+	bgsConfig.Sovereign.PolicyHistory = cctx.Int("sovereign-policy-history")
+	if rkey := cctx.String("sovereign-resume-key"); rkey != "" {
+		bgsConfig.Sovereign.ResumeKey = []byte(rkey)
+	}
+	bgsConfig.Sovereign.ResumeEpoch = cctx.Int64("sovereign-resume-epoch")
+	bgsConfig.Sovereign.ResumeIntegerCursors = cctx.Bool("sovereign-resume-integer-cursors")
+	if configDoc != nil {
+		if err := configschema.LoadSection(configDoc, "relay", bgsConfig); err != nil {
+			return err
+		}
+	}
+	if rules := bgsConfig.Sovereign.RetentionRules; len(rules) > 0 {
+		dp, ok := persister.(*diskpersist.DiskPersistence)
+		if !ok {
+			return fmt.Errorf("retention rules require the disk persister (--disk-persister-dir)")
+		}
+		if err := dp.SetRetentionRules(rules); err != nil {
+			return err
+		}
+	}
 	bgs, err := libbgs.NewBGS(db, ix, repoman, evtman, cachedidr, rf, hr, bgsConfig)
 	if err != nil {
 		return err
 	}
+	if dp, ok := persister.(*diskpersist.DiskPersistence); ok {
+		dp.SetHoldChecker(bgs.HoldChecker())
+		dp.SetRegionLookup(bgs.RegionLookup)
+		bgs.SetSequencer(dp.Sequencer())
+	}
+	if keyring != nil {
+		bgs.AddKeyRewrapper("events", persister.(*diskpersist.DiskPersistence))
+		bgs.AddKeyRewrapper("shards", cstore.(*carstore.FileCarStore))
+	}
 
 	if tok := cctx.String("admin-key"); tok != "" {
 		if err := bgs.CreateAdminToken(tok); err != nil {
@@ -538,12 +1812,29 @@ func runBigsky(cctx *cli.Context) error {
 		}
 	}()
 
-	bgsErr := make(chan error, 1)
+	bgsErr := make(chan error, 2)
 
 	go func() {
 		err := bgs.Start(cctx.String("api-listen"))
 		bgsErr <- err
 	}()
+	if bgsConfig.AdminSocket != nil {
+		go func() {
+			if err := bgs.StartAdminSocket(); err != nil {
+				bgsErr <- fmt.Errorf("admin socket: %w", err)
+			}
+		}()
+	}
+
+	// SIGHUP reloads the files the relay reads at runtime, without waiting for their next check
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			log.Info("received SIGHUP, reloading files")
+			bgs.ReloadFiles()
+		}
+	}()
 
 	slog.Info("startup complete")
 	select {
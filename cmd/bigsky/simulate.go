@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bluesky-social/indigo/cmd/bigsky/simulate"
+
+	"github.com/urfave/cli/v2"
+)
+
+var cmdSimulate = &cli.Command{
+	Name:   "simulate",
+	Usage:  "estimate CPU, network, memory and storage needs for a relay deployment, from benchmarks run on this machine",
+	Action: runSimulate,
+	Flags: []cli.Flag{
+		&cli.Float64Flag{
+			Name:  "events-per-sec",
+			Usage: "sustained inbound firehose event rate",
+			Value: 1000,
+		},
+		&cli.Float64Flag{
+			Name:  "sovereign-percent",
+			Usage: "percentage of events from accounts carried on the sovereign stream",
+			Value: 0,
+		},
+		&cli.IntFlag{
+			Name:  "consumers",
+			Usage: "number of full firehose subscribers",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "sovereign-consumers",
+			Usage: "number of sovereign stream subscribers",
+			Value: 0,
+		},
+		&cli.Float64Flag{
+			Name:  "retention-days",
+			Usage: "firehose playback retention",
+			Value: 3,
+		},
+		&cli.IntFlag{
+			Name:  "frame-bytes",
+			Usage: "average serialized event size; defaults to the built-in reference commit",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "output the report as JSON",
+		},
+	},
+}
+
+func runSimulate(cctx *cli.Context) error {
+	params := simulate.Params{
+		EventsPerSec:       cctx.Float64("events-per-sec"),
+		SovereignPercent:   cctx.Float64("sovereign-percent"),
+		Consumers:          cctx.Int("consumers"),
+		SovereignConsumers: cctx.Int("sovereign-consumers"),
+		RetentionDays:      cctx.Float64("retention-days"),
+		FrameBytes:         cctx.Int("frame-bytes"),
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "running benchmarks...")
+	costs, err := simulate.Measure()
+	if err != nil {
+		return err
+	}
+	report := simulate.Estimate(params, costs)
+
+	if cctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.WriteText(os.Stdout)
+}
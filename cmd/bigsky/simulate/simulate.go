@@ -0,0 +1,302 @@
+// Package simulate estimates relay resource needs for capacity planning, from per-event costs measured on the local machine.
+package simulate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/benchmarks"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+)
+
+const (
+	// matches the event manager's per-subscriber outgoing buffer
+	subscriberBufferEvents = 16 << 10
+	// disk persister per-event header
+	persistHeaderBytes = 4 + 4 + 4 + 8 + 8
+	// plan for this CPU utilization at the modeled rate
+	targetUtilization = 0.5
+)
+
+// Params describes the deployment being sized.
+type Params struct {
+	// sustained inbound firehose rate
+	EventsPerSec float64 `json:"eventsPerSec"`
+	// share of events from accounts carried on the sovereign stream
+	SovereignPercent float64 `json:"sovereignPercent"`
+	// full firehose subscribers
+	Consumers int `json:"consumers"`
+	// sovereign stream subscribers; each runs its own filter and transformation pass
+	SovereignConsumers int `json:"sovereignConsumers"`
+	// firehose playback retention
+	RetentionDays float64 `json:"retentionDays"`
+	// average serialized frame size; zero uses the reference commit measured by Measure
+	FrameBytes int `json:"frameBytes,omitempty"`
+}
+
+// Validate checks the parameters are in range.
+func (p *Params) Validate() error {
+	switch {
+	case p.EventsPerSec <= 0:
+		return fmt.Errorf("events per second must be positive")
+	case p.SovereignPercent < 0 || p.SovereignPercent > 100:
+		return fmt.Errorf("sovereign percent must be between 0 and 100")
+	case p.Consumers < 0 || p.SovereignConsumers < 0:
+		return fmt.Errorf("consumer counts can't be negative")
+	case p.RetentionDays < 0:
+		return fmt.Errorf("retention can't be negative")
+	case p.FrameBytes < 0:
+		return fmt.Errorf("frame size can't be negative")
+	}
+	return nil
+}
+
+// Costs are per-event costs, as measured by Measure.
+type Costs struct {
+	// serialized size of the reference commit frame
+	FrameBytes int `json:"frameBytes"`
+	// heap allocated decoding one frame, approximating an event's in-memory size
+	EventMemBytes int64 `json:"eventMemBytes"`
+	// decoding an inbound frame
+	DecodeNs float64 `json:"decodeNs"`
+	// verifying a commit signature
+	VerifyNs float64 `json:"verifyNs"`
+	// serializing an outbound frame, done once per event
+	EncodeNs float64 `json:"encodeNs"`
+	// copying a serialized frame to one subscriber; a lower bound, as it excludes syscalls and TLS
+	SendNs float64 `json:"sendNs"`
+	// classification lookup, done for every event per sovereign subscriber
+	LookupNs float64 `json:"lookupNs"`
+	// outbound transformation of one sovereign event, per sovereign subscriber
+	TransformNs float64 `json:"transformNs"`
+}
+
+// Report is the sizing estimate for a set of parameters.
+type Report struct {
+	Params Params `json:"params"`
+	Costs  Costs  `json:"costs"`
+
+	IngestCores    float64 `json:"ingestCores"`
+	FanoutCores    float64 `json:"fanoutCores"`
+	SovereignCores float64 `json:"sovereignCores"`
+	// total cores needed to stay at the target utilization
+	RecommendedCores int `json:"recommendedCores"`
+
+	InboundBytesPerSec  float64 `json:"inboundBytesPerSec"`
+	OutboundBytesPerSec float64 `json:"outboundBytesPerSec"`
+
+	// worst case, with every subscriber's outgoing buffer full
+	BufferMemoryBytes float64 `json:"bufferMemoryBytes"`
+
+	EventsRetained float64 `json:"eventsRetained"`
+	StorageBytes   float64 `json:"storageBytes"`
+}
+
+// Estimate models resource needs for the parameters, from measured costs.
+func Estimate(p Params, c Costs) Report {
+	frame := float64(c.FrameBytes)
+	if p.FrameBytes > 0 {
+		frame = float64(p.FrameBytes)
+	}
+	// costs that scale with frame size are scaled from the reference frame
+	scale := 1.0
+	if c.FrameBytes > 0 {
+		scale = frame / float64(c.FrameBytes)
+	}
+	eps := p.EventsPerSec
+	sovEps := eps * p.SovereignPercent / 100
+	consumers := float64(p.Consumers)
+	sovConsumers := float64(p.SovereignConsumers)
+
+	r := Report{
+		Params:         p,
+		Costs:          c,
+		IngestCores:    eps * (c.DecodeNs*scale + c.VerifyNs + c.EncodeNs*scale) / 1e9,
+		FanoutCores:    eps * consumers * c.SendNs * scale / 1e9,
+		SovereignCores: (eps*sovConsumers*c.LookupNs + sovEps*sovConsumers*(c.TransformNs+c.SendNs*scale)) / 1e9,
+
+		InboundBytesPerSec:  eps * frame,
+		OutboundBytesPerSec: eps*consumers*frame + sovEps*sovConsumers*frame,
+
+		BufferMemoryBytes: (consumers + sovConsumers) * subscriberBufferEvents * float64(c.EventMemBytes) * scale,
+
+		EventsRetained: eps * p.RetentionDays * 86400,
+	}
+	r.StorageBytes = r.EventsRetained * (frame + persistHeaderBytes)
+	total := r.IngestCores + r.FanoutCores + r.SovereignCores
+	r.RecommendedCores = int(math.Max(1, math.Ceil(total/targetUtilization)))
+	return r
+}
+
+// WriteText writes the report in human-readable form.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "relay sizing estimate\n\n")
+	fmt.Fprintf(&b, "inputs\n")
+	fmt.Fprintf(&b, "  events/sec:           %.0f\n", r.Params.EventsPerSec)
+	fmt.Fprintf(&b, "  sovereign share:      %.1f%%\n", r.Params.SovereignPercent)
+	fmt.Fprintf(&b, "  firehose consumers:   %d\n", r.Params.Consumers)
+	fmt.Fprintf(&b, "  sovereign consumers:  %d\n", r.Params.SovereignConsumers)
+	fmt.Fprintf(&b, "  retention:            %.1f days\n\n", r.Params.RetentionDays)
+	fmt.Fprintf(&b, "measured per-event costs (reference frame %d bytes)\n", r.Costs.FrameBytes)
+	fmt.Fprintf(&b, "  decode:               %s\n", nanos(r.Costs.DecodeNs))
+	fmt.Fprintf(&b, "  verify signature:     %s\n", nanos(r.Costs.VerifyNs))
+	fmt.Fprintf(&b, "  encode:               %s\n", nanos(r.Costs.EncodeNs))
+	fmt.Fprintf(&b, "  send (per consumer):  %s\n", nanos(r.Costs.SendNs))
+	fmt.Fprintf(&b, "  classification:       %s\n", nanos(r.Costs.LookupNs))
+	fmt.Fprintf(&b, "  transform:            %s\n", nanos(r.Costs.TransformNs))
+	fmt.Fprintf(&b, "  in-memory event:      %s\n\n", byteSize(float64(r.Costs.EventMemBytes)))
+	fmt.Fprintf(&b, "cpu\n")
+	fmt.Fprintf(&b, "  ingest:               %.2f cores\n", r.IngestCores)
+	fmt.Fprintf(&b, "  firehose fan-out:     %.2f cores\n", r.FanoutCores)
+	fmt.Fprintf(&b, "  sovereign stream:     %.2f cores\n", r.SovereignCores)
+	fmt.Fprintf(&b, "  recommended:          %d cores (%.0f%% target utilization)\n\n", r.RecommendedCores, targetUtilization*100)
+	fmt.Fprintf(&b, "network\n")
+	fmt.Fprintf(&b, "  inbound:              %s/s\n", byteSize(r.InboundBytesPerSec))
+	fmt.Fprintf(&b, "  outbound:             %s/s\n\n", byteSize(r.OutboundBytesPerSec))
+	fmt.Fprintf(&b, "memory\n")
+	fmt.Fprintf(&b, "  consumer buffers:     %s (worst case, all buffers full)\n\n", byteSize(r.BufferMemoryBytes))
+	fmt.Fprintf(&b, "storage\n")
+	fmt.Fprintf(&b, "  events retained:      %.0f\n", r.EventsRetained)
+	fmt.Fprintf(&b, "  playback files:       %s\n", byteSize(r.StorageBytes))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func nanos(ns float64) string {
+	return time.Duration(ns).String()
+}
+
+func byteSize(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// Measure runs the built-in benchmarks against a reference commit event, taking a few seconds.
+func Measure() (Costs, error) {
+	commit, err := benchmarks.ReferenceCommit()
+	if err != nil {
+		return Costs{}, err
+	}
+	evt := &events.XRPCStreamEvent{RepoCommit: commit}
+	var frame bytes.Buffer
+	if err := evt.Serialize(&frame); err != nil {
+		return Costs{}, err
+	}
+	frameBytes := frame.Bytes()
+
+	priv, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		return Costs{}, err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return Costs{}, err
+	}
+	unsigned := frameBytes[:min(len(frameBytes), 200)]
+	sig, err := priv.HashAndSign(unsigned)
+	if err != nil {
+		return Costs{}, err
+	}
+
+	table := sovereignty.NewTable()
+	table.Set(sovereignty.Classification{DID: commit.Repo, Country: "CA", Source: "simulate"})
+	signer, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		return Costs{}, err
+	}
+	pipeline, err := transform.NewPipeline([]transform.Rule{{
+		Name:        "redact-email",
+		Collection:  "app.bsky.*",
+		Path:        "text",
+		Action:      transform.ActionReplace,
+		Pattern:     `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		Replacement: "[redacted]",
+	}}, signer)
+	if err != nil {
+		return Costs{}, err
+	}
+
+	var benchErr error
+	decode := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var out events.XRPCStreamEvent
+			if err := out.Deserialize(bytes.NewReader(frameBytes)); err != nil {
+				benchErr = err
+				return
+			}
+		}
+	})
+	verify := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := pub.HashAndVerify(unsigned, sig); err != nil {
+				benchErr = err
+				return
+			}
+		}
+	})
+	encode := testing.Benchmark(func(b *testing.B) {
+		var buf bytes.Buffer
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			if err := evt.Serialize(&buf); err != nil {
+				benchErr = err
+				return
+			}
+		}
+	})
+	send := testing.Benchmark(func(b *testing.B) {
+		dst := make([]byte, 0, len(frameBytes))
+		for i := 0; i < b.N; i++ {
+			dst = append(dst[:0], frameBytes...)
+		}
+	})
+	lookup := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			table.Get(commit.Repo)
+		}
+	})
+	transformed := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := pipeline.TransformEvent(evt); err != nil {
+				benchErr = err
+				return
+			}
+		}
+	})
+	if benchErr != nil {
+		return Costs{}, fmt.Errorf("running benchmarks: %w", benchErr)
+	}
+
+	return Costs{
+		FrameBytes:    len(frameBytes),
+		EventMemBytes: decode.AllocedBytesPerOp(),
+		DecodeNs:      nsPerOp(decode),
+		VerifyNs:      nsPerOp(verify),
+		EncodeNs:      nsPerOp(encode),
+		SendNs:        nsPerOp(send),
+		LookupNs:      nsPerOp(lookup),
+		TransformNs:   nsPerOp(transformed),
+	}, nil
+}
+
+func nsPerOp(r testing.BenchmarkResult) float64 {
+	if r.N == 0 {
+		return 0
+	}
+	return float64(r.T.Nanoseconds()) / float64(r.N)
+}
@@ -0,0 +1,81 @@
+package simulate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bluesky-social/indigo/benchmarks"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	assert := assert.New(t)
+
+	costs := Costs{
+		FrameBytes:    1000,
+		EventMemBytes: 4000,
+		DecodeNs:      20_000,
+		VerifyNs:      60_000,
+		EncodeNs:      10_000,
+		SendNs:        100,
+		LookupNs:      50,
+		TransformNs:   30_000,
+	}
+	p := Params{
+		EventsPerSec:       1000,
+		SovereignPercent:   10,
+		Consumers:          20,
+		SovereignConsumers: 4,
+		RetentionDays:      2,
+	}
+	assert.NoError(p.Validate())
+	r := Estimate(p, costs)
+
+	assert.InDelta(0.09, r.IngestCores, 1e-9)
+	assert.InDelta(0.002, r.FanoutCores, 1e-9)
+	// lookups on every event, transforms on the sovereign tenth
+	assert.InDelta((1000*4*50+100*4*(30_000+100))/1e9, r.SovereignCores, 1e-9)
+	assert.Equal(1, r.RecommendedCores)
+	assert.Equal(1000*1000.0, r.InboundBytesPerSec)
+	assert.Equal(1000*20*1000.0+100*4*1000.0, r.OutboundBytesPerSec)
+	assert.Equal(24*16384*4000.0, r.BufferMemoryBytes)
+	assert.Equal(1000*2*86400.0, r.EventsRetained)
+	assert.Equal(r.EventsRetained*1028, r.StorageBytes)
+
+	// larger frames scale the size-dependent costs
+	p.FrameBytes = 2000
+	big := Estimate(p, costs)
+	assert.Equal(2*r.InboundBytesPerSec, big.InboundBytesPerSec)
+	assert.Equal(2*r.BufferMemoryBytes, big.BufferMemoryBytes)
+	assert.InDelta(0.12, big.IngestCores, 1e-9)
+
+	var out bytes.Buffer
+	assert.NoError(r.WriteText(&out))
+	assert.Contains(out.String(), "recommended:          1 cores")
+
+	for _, bad := range []Params{
+		{EventsPerSec: 0},
+		{EventsPerSec: 1, SovereignPercent: 101},
+		{EventsPerSec: 1, Consumers: -1},
+		{EventsPerSec: 1, RetentionDays: -1},
+	} {
+		assert.Error(bad.Validate())
+	}
+}
+
+func TestReferenceCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	commit, err := benchmarks.ReferenceCommit()
+	assert.NoError(err)
+	var buf bytes.Buffer
+	assert.NoError((&events.XRPCStreamEvent{RepoCommit: commit}).Serialize(&buf))
+	var out events.XRPCStreamEvent
+	assert.NoError(out.Deserialize(&buf))
+	if assert.NotNil(out.RepoCommit) {
+		assert.Equal(commit.Repo, out.RepoCommit.Repo)
+		assert.Equal(commit.Blocks, out.RepoCommit.Blocks)
+	}
+}
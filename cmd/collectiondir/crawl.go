@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 
 	"github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
 
@@ -127,17 +128,21 @@ type CrawlStats struct {
 // does _not_ close chan
 // (allow multiple threads of PDS queries running to one output chan, e.g. feeding into SetFromResults() )
 func (cr *Crawler) CrawlPDSRepoCollections() error {
-	var cursor string
 	limiter := rate.NewLimiter(rate.Limit(cr.QPS), 1)
-	for {
-		limiter.Wait(cr.Ctx)
-		repos, err := atproto.SyncListRepos(cr.Ctx, cr.RpcClient, cursor, 1000)
+	listRepos := func(ctx context.Context, cursor string) ([]*atproto.SyncListRepos_Repo, *string, error) {
+		repos, err := atproto.SyncListRepos(ctx, cr.RpcClient, cursor, 1000)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repos.Repos, repos.Cursor, nil
+	}
+	for page, err := range lexutil.Pages(cr.Ctx, listRepos, lexutil.PaginateOptions{Limiter: limiter}) {
 		if err != nil {
 			return fmt.Errorf("%s: sync repos: %w", cr.RpcClient.Host, err)
 		}
 		pdsRepoPages.Inc()
-		slog.Debug("got repo list", "count", len(repos.Repos))
-		for _, xr := range repos.Repos {
+		slog.Debug("got repo list", "count", len(page.Items))
+		for _, xr := range page.Items {
 			limiter.Wait(cr.Ctx)
 			desc, err := atproto.RepoDescribeRepo(cr.Ctx, cr.RpcClient, xr.Did)
 			if err != nil {
@@ -157,11 +162,6 @@ func (cr *Crawler) CrawlPDSRepoCollections() error {
 				cr.Stats.ReposDescribed.Add(1)
 			}
 		}
-		if repos.Cursor != nil {
-			cursor = *repos.Cursor
-		} else {
-			break
-		}
 	}
 	return nil
 }
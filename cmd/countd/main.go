@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/sovereignty/counts"
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/util/cliutil"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/urfave/cli/v2"
+	_ "go.uber.org/automaxprocs"
+)
+
+func main() {
+	app := cli.App{
+		Name:    "countd",
+		Usage:   "like, repost and reply counts for sovereign accounts",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "relay-host",
+			Usage:   "websocket URL of the relay serving the sovereign stream",
+			Value:   "ws://localhost:2470",
+			EnvVars: []string{"COUNTD_RELAY_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "mirror-host",
+			Usage:   "HTTP URL of the relay whose repo mirror is used for reconciliation (com.atproto.sync.getRepo)",
+			Value:   "http://localhost:2470",
+			EnvVars: []string{"COUNTD_MIRROR_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "bind",
+			Usage:   "local IP/port for the internal API",
+			Value:   ":2491",
+			EnvVars: []string{"COUNTD_BIND"},
+		},
+		&cli.StringFlag{
+			Name:    "database-url",
+			Value:   "sqlite://data/countd/countd.db",
+			EnvVars: []string{"DATABASE_URL"},
+		},
+		&cli.IntFlag{
+			Name:    "max-db-connections",
+			Value:   40,
+			EnvVars: []string{"COUNTD_MAX_DB_CONNECTIONS"},
+		},
+		&cli.DurationFlag{
+			Name:    "reconcile-interval",
+			Usage:   "how often to run a reconciliation pass; zero disables reconciliation",
+			Value:   time.Minute,
+			EnvVars: []string{"COUNTD_RECONCILE_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "reconcile-account-batch",
+			Usage:   "accounts compared with the repo mirror per reconciliation pass",
+			Value:   100,
+			EnvVars: []string{"COUNTD_RECONCILE_ACCOUNT_BATCH"},
+		},
+		&cli.IntFlag{
+			Name:    "reconcile-subject-batch",
+			Usage:   "subjects recounted per reconciliation pass",
+			Value:   5000,
+			EnvVars: []string{"COUNTD_RECONCILE_SUBJECT_BATCH"},
+		},
+	}
+
+	app.Action = runCountd
+
+	if err := app.Run(os.Args); err != nil {
+		slog.Error("fatal", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func runCountd(cctx *cli.Context) error {
+	ctx, cancel := context.WithCancel(cctx.Context)
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	db, err := cliutil.SetupDatabase(cctx.String("database-url"), cctx.Int("max-db-connections"))
+	if err != nil {
+		return fmt.Errorf("failed to set up database: %w", err)
+	}
+	store, err := counts.NewStore(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	svc := counts.NewService(store)
+	if err := svc.LoadCursor(ctx); err != nil {
+		return fmt.Errorf("loading stream cursor: %w", err)
+	}
+
+	mirror := &xrpc.Client{
+		Client: util.RobustHTTPClient(),
+		Host:   cctx.String("mirror-host"),
+	}
+	rec := counts.NewReconciler(store, func(ctx context.Context, did string) ([]byte, error) {
+		return comatproto.SyncGetRepo(ctx, mirror, did, "")
+	}, logger.With("subsystem", "reconcile"))
+	rec.AccountBatch = cctx.Int("reconcile-account-batch")
+	rec.SubjectBatch = cctx.Int("reconcile-subject-batch")
+	if interval := cctx.Duration("reconcile-interval"); interval > 0 {
+		go rec.Run(ctx, interval)
+	}
+
+	go func() {
+		t := time.NewTicker(5 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := svc.SaveCursor(ctx); err != nil {
+					logger.Error("failed to save stream cursor", "err", err)
+				}
+			}
+		}
+	}()
+
+	srv := NewServer(store, rec, logger)
+	go func() {
+		if err := srv.Start(cctx.String("bind")); err != nil && err != http.ErrServerClosed {
+			logger.Error("API server failed", "err", err)
+			cancel()
+		}
+	}()
+
+	go func() {
+		opts := follower.Options{Name: "countd", Cursor: svc.Seq, Logger: logger}
+		if err := follower.Follow(ctx, cctx.String("relay-host"), svc.HandleEvent, opts); err != nil {
+			logger.Error("failed to follow sovereign stream", "err", err)
+			cancel()
+		}
+	}()
+
+	select {
+	case <-signals:
+		logger.Info("shutting down on signal")
+	case <-ctx.Done():
+	}
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down API server", "err", err)
+	}
+	return svc.SaveCursor(shutdownCtx)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/counts"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	slogecho "github.com/samber/slog-echo"
+)
+
+// max subjects per getCounts request
+const maxCountsURIs = 100
+
+type Server struct {
+	store  *counts.Store
+	rec    *counts.Reconciler
+	echo   *echo.Echo
+	logger *slog.Logger
+}
+
+func NewServer(store *counts.Store, rec *counts.Reconciler, logger *slog.Logger) *Server {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(slogecho.New(logger))
+	e.Use(middleware.Recover())
+
+	srv := &Server{
+		store:  store,
+		rec:    rec,
+		echo:   e,
+		logger: logger,
+	}
+
+	e.GET("/_health", srv.handleHealth)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/xrpc/ca.gander.counts.getCounts", srv.handleGetCounts)
+	e.POST("/admin/reconcile", srv.handleReconcile)
+	return srv
+}
+
+func (s *Server) Start(listen string) error {
+	s.logger.Info("starting counts API", "bind", listen)
+	return s.echo.Start(listen)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.echo.Shutdown(ctx)
+}
+
+func (s *Server) handleHealth(c echo.Context) error {
+	return c.JSON(200, map[string]any{"status": "ok"})
+}
+
+type subjectCounts struct {
+	Uri     string `json:"uri"`
+	Likes   int64  `json:"likes"`
+	Reposts int64  `json:"reposts"`
+	Replies int64  `json:"replies"`
+}
+
+func (s *Server) handleGetCounts(c echo.Context) error {
+	uris := c.QueryParams()["uris"]
+	if len(uris) == 0 || len(uris) > maxCountsURIs {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("'uris' must have between 1 and %d values", maxCountsURIs),
+		}
+	}
+	for _, u := range uris {
+		if _, err := syntax.ParseATURI(u); err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid AT-URI in 'uris': %s", err),
+			}
+		}
+	}
+
+	found, err := s.store.Get(c.Request().Context(), uris)
+	if err != nil {
+		return err
+	}
+	out := make([]subjectCounts, 0, len(uris))
+	for _, u := range uris {
+		cnt := found[u]
+		out = append(out, subjectCounts{Uri: u, Likes: cnt.Likes, Reposts: cnt.Reposts, Replies: cnt.Replies})
+	}
+	return c.JSON(200, map[string]any{"counts": out})
+}
+
+// handleReconcile compares a single account with the repo mirror immediately, eg after an outage affecting a known set of accounts
+func (s *Server) handleReconcile(c echo.Context) error {
+	did, err := syntax.ParseDID(c.QueryParam("did"))
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid DID for 'did': %s", err),
+		}
+	}
+	added, removed, err := s.rec.ReconcileAccount(c.Request().Context(), did.String())
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    502,
+			Message: err.Error(),
+		}
+	}
+	return c.JSON(200, map[string]any{
+		"did":     did.String(),
+		"added":   added,
+		"removed": removed,
+	})
+}
@@ -11,7 +11,9 @@ import (
 
 	"github.com/bluesky-social/indigo/api/agnostic"
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	"github.com/urfave/cli/v2"
@@ -40,10 +42,20 @@ var cmdAccountMigrate = &cli.Command{
 			EnvVars:  []string{"NEW_ACCOUNT_PASSWORD"},
 		},
 		&cli.StringFlag{
-			Name:     "plc-token",
-			Required: true,
-			Usage:    "token from old PDS authorizing token signature",
-			EnvVars:  []string{"PLC_SIGN_TOKEN"},
+			Name:    "plc-token",
+			Usage:   "token from old PDS authorizing token signature",
+			EnvVars: []string{"PLC_SIGN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "plc-rotation-key",
+			Usage:   "private key (multibase) of one of the DID's rotation keys, for identities the operator manages; the identity update is signed locally instead of by the old PDS",
+			EnvVars: []string{"PLC_ROTATION_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "plc-host",
+			Usage:   "method, hostname, and port of PLC registry (with --plc-rotation-key)",
+			Value:   "https://plc.directory",
+			EnvVars: []string{"ATP_PLC_HOST"},
 		},
 		&cli.StringFlag{
 			Name:  "invite-code",
@@ -80,6 +92,15 @@ func runAccountMigrate(cctx *cli.Context) error {
 	}
 	newPassword := cctx.String("new-password")
 	plcToken := cctx.String("plc-token")
+	var rotationKey crypto.PrivateKey
+	if s := cctx.String("plc-rotation-key"); s != "" {
+		rotationKey, err = crypto.ParsePrivateMultibase(s)
+		if err != nil {
+			return fmt.Errorf("invalid PLC rotation key: %w", err)
+		}
+	} else if plcToken == "" {
+		return fmt.Errorf("need either a PLC token (for PDS-managed identities) or a PLC rotation key")
+	}
 	inviteCode := cctx.String("invite-code")
 	newEmail := cctx.String("new-email")
 
@@ -220,29 +241,36 @@ func runAccountMigrate(cctx *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed fetching new credentials: %w", err)
 	}
-	credsBytes, err := json.Marshal(credsResp)
-	if err != nil {
-		return nil
-	}
 
-	var unsignedOp agnostic.IdentitySignPlcOperation_Input
-	if err = json.Unmarshal(credsBytes, &unsignedOp); err != nil {
-		return fmt.Errorf("failed parsing PLC op: %w", err)
-	}
-	unsignedOp.Token = &plcToken
+	if rotationKey != nil {
+		if err := migrateOperatorIdentity(ctx, cctx.String("plc-host"), did, newHandle, credsResp, rotationKey); err != nil {
+			return err
+		}
+	} else {
+		credsBytes, err := json.Marshal(credsResp)
+		if err != nil {
+			return nil
+		}
 
-	// NOTE: could add additional sanity checks here that any extra rotation keys were retained, and that old alsoKnownAs and service entries are retained? The stakes aren't super high for the later, as PLC has the full history. PLC and the new PDS already implement some basic sanity checks.
+		var unsignedOp agnostic.IdentitySignPlcOperation_Input
+		if err = json.Unmarshal(credsBytes, &unsignedOp); err != nil {
+			return fmt.Errorf("failed parsing PLC op: %w", err)
+		}
+		unsignedOp.Token = &plcToken
 
-	signedPlcOpResp, err := agnostic.IdentitySignPlcOperation(ctx, oldClient, &unsignedOp)
-	if err != nil {
-		return fmt.Errorf("failed requesting PLC operation signature: %w", err)
-	}
+		// NOTE: could add additional sanity checks here that any extra rotation keys were retained, and that old alsoKnownAs and service entries are retained? The stakes aren't super high for the later, as PLC has the full history. PLC and the new PDS already implement some basic sanity checks.
 
-	err = agnostic.IdentitySubmitPlcOperation(ctx, &newClient, &agnostic.IdentitySubmitPlcOperation_Input{
-		Operation: signedPlcOpResp.Operation,
-	})
-	if err != nil {
-		return fmt.Errorf("failed submitting PLC operation: %w", err)
+		signedPlcOpResp, err := agnostic.IdentitySignPlcOperation(ctx, oldClient, &unsignedOp)
+		if err != nil {
+			return fmt.Errorf("failed requesting PLC operation signature: %w", err)
+		}
+
+		err = agnostic.IdentitySubmitPlcOperation(ctx, &newClient, &agnostic.IdentitySubmitPlcOperation_Input{
+			Operation: signedPlcOpResp.Operation,
+		})
+		if err != nil {
+			return fmt.Errorf("failed submitting PLC operation: %w", err)
+		}
 	}
 
 	// 4. Finalize Migration
@@ -260,3 +288,33 @@ func runAccountMigrate(cctx *cli.Context) error {
 	slog.Info("account migration completed")
 	return nil
 }
+
+// migrateOperatorIdentity points an operator-managed did:plc identity at the new host, signing the operation with the operator's rotation key. The identity's rotation keys are kept as they are.
+func migrateOperatorIdentity(ctx context.Context, plcHost, did, handle string, creds *json.RawMessage, key crypto.PrivateKey) error {
+	var recommended plcops.Operation
+	if err := json.Unmarshal(*creds, &recommended); err != nil {
+		return fmt.Errorf("failed parsing recommended credentials: %w", err)
+	}
+	ch := plcops.Change{
+		PDSEndpoint: recommended.Services[plcops.PDSServiceID].Endpoint,
+		Handle:      syntax.Handle(handle),
+	}
+	var err error
+	if k := recommended.VerificationMethods[plcops.SigningKeyID]; k != "" {
+		ch.SigningKey, err = crypto.ParsePublicDIDKey(k)
+		if err != nil {
+			return fmt.Errorf("new host recommended an invalid signing key: %w", err)
+		}
+	}
+
+	client := plcops.NewClient(plcHost, 1)
+	client.UserAgent = *userAgent()
+	preview, _, err := client.Apply(ctx, did, ch, key, false)
+	if err != nil {
+		return fmt.Errorf("failed updating PLC identity: %w", err)
+	}
+	for _, c := range preview.Changes {
+		slog.Info("updated PLC identity", "change", c)
+	}
+	return nil
+}
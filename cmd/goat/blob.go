@@ -8,6 +8,7 @@ import (
 	"os"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	"github.com/urfave/cli/v2"
@@ -99,37 +100,39 @@ func runBlobExport(cctx *cli.Context) error {
 	fmt.Printf("downloading blobs to: %s\n", topDir)
 	os.MkdirAll(topDir, os.ModePerm)
 
-	cursor := ""
-	for {
-		resp, err := comatproto.SyncListBlobs(ctx, &xrpcc, cursor, ident.DID.String(), 500, "")
+	for cidStr, err := range lexutil.Paginate(ctx, listBlobsPage(&xrpcc, ident.DID.String()), lexutil.PaginateOptions{}) {
 		if err != nil {
 			return err
 		}
-		for _, cidStr := range resp.Cids {
-			blobPath := topDir + "/" + cidStr
-			if _, err := os.Stat(blobPath); err == nil {
-				fmt.Printf("%s\texists\n", blobPath)
-				continue
-			}
-			blobBytes, err := comatproto.SyncGetBlob(ctx, &xrpcc, cidStr, ident.DID.String())
-			if err != nil {
-				fmt.Printf("%s\tfailed %s\n", blobPath, err)
-				continue
-			}
-			if err := os.WriteFile(blobPath, blobBytes, 0666); err != nil {
-				return err
-			}
-			fmt.Printf("%s\tdownloaded\n", blobPath)
+		blobPath := topDir + "/" + cidStr
+		if _, err := os.Stat(blobPath); err == nil {
+			fmt.Printf("%s\texists\n", blobPath)
+			continue
 		}
-		if resp.Cursor != nil && *resp.Cursor != "" {
-			cursor = *resp.Cursor
-		} else {
-			break
+		blobBytes, err := comatproto.SyncGetBlob(ctx, &xrpcc, cidStr, ident.DID.String())
+		if err != nil {
+			fmt.Printf("%s\tfailed %s\n", blobPath, err)
+			continue
+		}
+		if err := os.WriteFile(blobPath, blobBytes, 0666); err != nil {
+			return err
 		}
+		fmt.Printf("%s\tdownloaded\n", blobPath)
 	}
 	return nil
 }
 
+// listBlobsPage fetches a page of an account's blob CIDs
+func listBlobsPage(xrpcc *xrpc.Client, did string) lexutil.PageFunc[string] {
+	return func(ctx context.Context, cursor string) ([]string, *string, error) {
+		resp, err := comatproto.SyncListBlobs(ctx, xrpcc, cursor, did, 500, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.Cids, resp.Cursor, nil
+	}
+}
+
 func runBlobList(cctx *cli.Context) error {
 	ctx := context.Background()
 	username := cctx.Args().First()
@@ -150,20 +153,11 @@ func runBlobList(cctx *cli.Context) error {
 		return fmt.Errorf("no PDS endpoint for identity")
 	}
 
-	cursor := ""
-	for {
-		resp, err := comatproto.SyncListBlobs(ctx, &xrpcc, cursor, ident.DID.String(), 500, "")
+	for cidStr, err := range lexutil.Paginate(ctx, listBlobsPage(&xrpcc, ident.DID.String()), lexutil.PaginateOptions{}) {
 		if err != nil {
 			return err
 		}
-		for _, cidStr := range resp.Cids {
-			fmt.Println(cidStr)
-		}
-		if resp.Cursor != nil && *resp.Cursor != "" {
-			cursor = *resp.Cursor
-		} else {
-			break
-		}
+		fmt.Println(cidStr)
 	}
 	return nil
 }
@@ -9,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
 	"github.com/bluesky-social/indigo/util"
 
 	"github.com/urfave/cli/v2"
@@ -71,6 +73,45 @@ var cmdPLC = &cli.Command{
 			},
 			Action: runPLCDump,
 		},
+		&cli.Command{
+			Name:      "update",
+			Usage:     "sign and submit an operation for a DID whose rotation key you hold (not via PDS)",
+			ArgsUsage: `<did>`,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "rotation-key",
+					Usage:    "private key (multibase) of one of the DID's current rotation keys",
+					Required: true,
+					EnvVars:  []string{"PLC_ROTATION_KEY"},
+				},
+				&cli.StringFlag{
+					Name:  "pds-endpoint",
+					Usage: "new PDS service endpoint URL",
+				},
+				&cli.StringFlag{
+					Name:  "signing-key",
+					Usage: "new atproto signing key (public, did:key or multibase)",
+				},
+				&cli.StringFlag{
+					Name:  "handle",
+					Usage: "new handle",
+				},
+				&cli.StringSliceFlag{
+					Name:  "rotation-keys",
+					Usage: "replacement rotation keys (public, did:key or multibase), highest priority first",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the preview and signed operation without submitting it",
+				},
+				&cli.Float64Flag{
+					Name:  "rate-limit",
+					Usage: "maximum requests per second to the PLC directory",
+					Value: 1,
+				},
+			},
+			Action: runPLCUpdate,
+		},
 	},
 }
 
@@ -320,3 +361,77 @@ func fetchPLCData(ctx context.Context, plcHost string, did syntax.DID) (*PLCData
 	}
 	return &d, nil
 }
+
+// parsePublicKey accepts a public key as a did:key or multibase string
+func parsePublicKey(s string) (crypto.PublicKey, error) {
+	if pub, err := crypto.ParsePublicDIDKey(s); err == nil {
+		return pub, nil
+	}
+	pub, err := crypto.ParsePublicMultibase(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown public key encoding or type: %s", s)
+	}
+	return pub, nil
+}
+
+func runPLCUpdate(cctx *cli.Context) error {
+	ctx := context.Background()
+	did, err := syntax.ParseDID(cctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("need to provide a DID as an argument: %w", err)
+	}
+	if did.Method() != "plc" {
+		return fmt.Errorf("non-PLC DID method: %s", did.Method())
+	}
+	key, err := crypto.ParsePrivateMultibase(cctx.String("rotation-key"))
+	if err != nil {
+		return fmt.Errorf("invalid rotation key: %w", err)
+	}
+
+	ch := plcops.Change{
+		PDSEndpoint: cctx.String("pds-endpoint"),
+	}
+	if s := cctx.String("signing-key"); s != "" {
+		ch.SigningKey, err = parsePublicKey(s)
+		if err != nil {
+			return err
+		}
+	}
+	if s := cctx.String("handle"); s != "" {
+		ch.Handle, err = syntax.ParseHandle(s)
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range cctx.StringSlice("rotation-keys") {
+		pub, err := parsePublicKey(s)
+		if err != nil {
+			return err
+		}
+		ch.RotationKeys = append(ch.RotationKeys, pub)
+	}
+
+	client := plcops.NewClient(cctx.String("plc-host"), cctx.Float64("rate-limit"))
+	client.UserAgent = *userAgent()
+	dryRun := cctx.Bool("dry-run")
+	preview, op, err := client.Apply(ctx, did.String(), ch, key, dryRun)
+	if preview != nil {
+		for _, c := range preview.Changes {
+			fmt.Println(c)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		b, err := json.MarshalIndent(op, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		fmt.Println("dry run: operation not submitted")
+		return nil
+	}
+	fmt.Println("operation submitted")
+	return nil
+}
@@ -105,6 +105,7 @@ func run(args []string) {
 		parseRkey,
 		listLabelsCmd,
 		verifyUserCmd,
+		sovereignCmd,
 	}
 
 	app.RunAndExitOnError()
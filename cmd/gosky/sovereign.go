@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/peering"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+	"github.com/bluesky-social/indigo/util"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var sovereignCmd = &cli.Command{
+	Name:  "sovereign",
+	Usage: "sub-commands for data sovereignty tooling",
+	Subcommands: []*cli.Command{
+		sovereignLoadSnapshotCmd,
+		sovereignMeshCmd,
+		sovereignImportCmd,
+		sovereignExportCmd,
+		sovereignSignPolicyCmd,
+	},
+}
+
+var sovereignRelayFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "key",
+		Usage:   "relay admin key",
+		EnvVars: []string{"BGS_ADMIN_KEY"},
+	},
+	&cli.StringFlag{
+		Name:  "bgs",
+		Value: "http://localhost:2470",
+	},
+}
+
+// formatFromPath guesses the bulk format from a file name, defaulting to CSV
+func formatFromPath(p string) string {
+	if strings.HasSuffix(p, ".jsonl") || strings.HasSuffix(p, ".ndjson") {
+		return sovereignty.FormatJSONL
+	}
+	return sovereignty.FormatCSV
+}
+
+// progressReader reports bytes read to stderr, at most once a second
+type progressReader struct {
+	r     io.Reader
+	total int64
+	read  int64
+	last  time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if time.Since(p.last) > time.Second || err == io.EOF {
+		p.last = time.Now()
+		if p.total > 0 {
+			fmt.Fprintf(os.Stderr, "\ruploaded %d / %d MB (%.0f%%)", p.read>>20, p.total>>20, float64(p.read)*100/float64(p.total))
+		} else {
+			fmt.Fprintf(os.Stderr, "\ruploaded %d MB", p.read>>20)
+		}
+	}
+	return n, err
+}
+
+var sovereignImportCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "bulk-import DID classifications (CSV: did,country,source; or JSONL) into a relay",
+	ArgsUsage: "<file>",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "csv or jsonl; guessed from the file extension if not set",
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "source recorded for rows which don't specify one",
+			Value: "import",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report what would change",
+		},
+	}, sovereignRelayFlags...),
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("expected input file as argument")
+		}
+		fname := cctx.Args().First()
+		format := cctx.String("format")
+		if format == "" {
+			format = formatFromPath(fname)
+		}
+		if err := sovereignty.ValidFormat(format); err != nil {
+			return err
+		}
+
+		f, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		q.Set("format", format)
+		q.Set("source", cctx.String("source"))
+		q.Set("dryRun", strconv.FormatBool(cctx.Bool("dry-run")))
+		req, err := http.NewRequestWithContext(cctx.Context, "POST", cctx.String("bgs")+"/admin/sovereignty/import?"+q.Encode(), &progressReader{r: f, total: st.Size()})
+		if err != nil {
+			return err
+		}
+		req.ContentLength = st.Size()
+		req.Header.Set("Authorization", "Bearer "+cctx.String("key"))
+
+		resp, err := http.DefaultClient.Do(req)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			b, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("import failed (HTTP %d): %s", resp.StatusCode, b)
+		}
+
+		var rep sovereignty.ImportReport
+		if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+			return err
+		}
+		verb := "applied"
+		if rep.DryRun {
+			verb = "would apply (dry run)"
+		}
+		fmt.Printf("%d rows: %d added, %d changed, %d unchanged, %d duplicates, %d invalid; %s\n", rep.Rows, rep.Added, rep.Changed, rep.Unchanged, rep.Duplicates, rep.Invalid, verb)
+		for _, c := range rep.Sample {
+			from := c.From
+			if from == "" {
+				from = "(none)"
+			}
+			fmt.Printf("  %s: %s -> %s\n", c.DID, from, c.To)
+		}
+		for _, re := range rep.Errors {
+			fmt.Printf("  line %d: %s\n", re.Line, re.Error)
+		}
+		return nil
+	},
+}
+
+var sovereignExportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "export a relay's DID classification table to stdout",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "csv or jsonl",
+			Value: sovereignty.FormatCSV,
+		},
+		&cli.StringFlag{
+			Name:  "country",
+			Usage: "only export entries for this country code",
+		},
+		&cli.StringFlag{
+			Name:  "source",
+			Usage: "only export entries with this source",
+		},
+		&cli.TimestampFlag{
+			Name:   "since",
+			Usage:  "only export entries updated at or after this time",
+			Layout: time.RFC3339,
+		},
+	}, sovereignRelayFlags...),
+	Action: func(cctx *cli.Context) error {
+		q := url.Values{}
+		q.Set("format", cctx.String("format"))
+		for _, k := range []string{"country", "source"} {
+			if v := cctx.String(k); v != "" {
+				q.Set(k, v)
+			}
+		}
+		if since := cctx.Timestamp("since"); since != nil {
+			q.Set("since", since.UTC().Format(time.RFC3339))
+		}
+		req, err := http.NewRequestWithContext(cctx.Context, "GET", cctx.String("bgs")+"/admin/sovereignty/export?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+cctx.String("key"))
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			b, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("export failed (HTTP %d): %s", resp.StatusCode, b)
+		}
+		n, err := io.Copy(os.Stdout, resp.Body)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d bytes\n", n)
+		return nil
+	},
+}
+
+var sovereignSignPolicyCmd = &cli.Command{
+	Name:      "sign-policy",
+	Usage:     "sign a JSON sovereignty policy document as the policy authority, printing the compact JWS",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "signing-key",
+			Usage:    "policy authority private key (multibase)",
+			Required: true,
+			EnvVars:  []string{"SOVEREIGN_POLICY_KEY"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a policy document file")
+		}
+		b, err := os.ReadFile(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		var doc policy.Document
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("parsing policy document: %w", err)
+		}
+		priv, err := crypto.ParsePrivateMultibase(cctx.String("signing-key"))
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key: %w", err)
+		}
+		token, err := policy.Sign(doc, priv)
+		if err != nil {
+			return err
+		}
+		fmt.Println(token)
+		return nil
+	},
+}
+
+var sovereignLoadSnapshotCmd = &cli.Command{
+	Name:      "load-snapshot",
+	Usage:     "fetch and verify a published DID classification snapshot, and print it as JSON lines",
+	ArgsUsage: "<snapshot-base-url>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "signer",
+			Usage:    "did:key of the publishing relay's signing key",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "country",
+			Usage: "only print entries for this country code",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("expected snapshot base URL as argument")
+		}
+		pub, err := crypto.ParsePublicDIDKey(cctx.String("signer"))
+		if err != nil {
+			return err
+		}
+		var country string
+		if cctx.IsSet("country") {
+			country, err = sovereignty.NormalizeCountry(cctx.String("country"))
+			if err != nil {
+				return err
+			}
+		}
+
+		tbl := sovereignty.NewTable()
+		loader := snapshot.NewLoader(cctx.Args().First(), pub)
+		n, err := loader.Sync(cctx.Context, tbl)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "applied %d entries (generation %d)\n", n, loader.Generation)
+
+		enc := json.NewEncoder(os.Stdout)
+		for _, c := range tbl.Snapshot() {
+			if country != "" && c.Country != country {
+				continue
+			}
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var sovereignMeshCmd = &cli.Command{
+	Name:      "mesh",
+	Usage:     "display health of a sovereign relay and its peers",
+	ArgsUsage: "<relay-url>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print raw JSON output",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("expected relay base URL as argument")
+		}
+		mesh, err := peering.FetchMesh(cctx.Context, util.RobustHTTPClient(), cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		if cctx.Bool("json") {
+			b, err := json.MarshalIndent(mesh, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+
+		row := func(name, status string, h *peering.Health) {
+			if h == nil {
+				fmt.Printf("%-40s %-8s\n", name, status)
+				return
+			}
+			fmt.Printf("%-40s %-8s seq=%d lag=%.0fs hosts=%d/%d classified=%d snapshot=%d\n", name, status, h.HeadSeq, h.LagSeconds, h.ActiveHosts, h.KnownHosts, h.Classifications, h.SnapshotGeneration)
+		}
+		row(mesh.Self.Relay+" (self)", "ok", &mesh.Self)
+		for _, p := range mesh.Peers {
+			status := "ok"
+			if p.Error != "" {
+				status = "error"
+			}
+			if p.Health == nil {
+				status = "unknown"
+			}
+			row(p.URL, status, p.Health)
+			if p.Error != "" {
+				fmt.Printf("    last error: %s (last seen: %s)\n", p.Error, p.LastSeen)
+			}
+		}
+		return nil
+	},
+}
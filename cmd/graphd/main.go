@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+	"github.com/bluesky-social/indigo/sovereignty/graph"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/urfave/cli/v2"
+	_ "go.uber.org/automaxprocs"
+)
+
+func main() {
+	app := cli.App{
+		Name:    "graphd",
+		Usage:   "follow and block graph service for sovereign accounts",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "relay-host",
+			Usage:   "websocket URL of the relay serving the sovereign stream",
+			Value:   "ws://localhost:2470",
+			EnvVars: []string{"GRAPHD_RELAY_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "bind",
+			Usage:   "local IP/port for the internal API",
+			Value:   ":2480",
+			EnvVars: []string{"GRAPHD_BIND"},
+		},
+		&cli.StringFlag{
+			Name:    "snapshot-path",
+			Usage:   "file the graph is periodically snapshotted to, and loaded from on start",
+			Value:   "graphd.snapshot",
+			EnvVars: []string{"GRAPHD_SNAPSHOT_PATH"},
+		},
+		&cli.DurationFlag{
+			Name:    "snapshot-interval",
+			Usage:   "how often to write a graph snapshot",
+			Value:   10 * time.Minute,
+			EnvVars: []string{"GRAPHD_SNAPSHOT_INTERVAL"},
+		},
+	}
+
+	app.Action = runGraphd
+
+	if err := app.Run(os.Args); err != nil {
+		slog.Error("fatal", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func runGraphd(cctx *cli.Context) error {
+	ctx, cancel := context.WithCancel(cctx.Context)
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	snapshotPath := cctx.String("snapshot-path")
+	g, err := graph.LoadFile(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("loading graph snapshot: %w", err)
+	}
+	logger.Info("loaded graph snapshot", "path", snapshotPath, "stats", g.Stats())
+
+	go func() {
+		t := time.NewTicker(cctx.Duration("snapshot-interval"))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				start := time.Now()
+				if err := g.SaveFile(snapshotPath); err != nil {
+					logger.Error("failed to write graph snapshot", "err", err)
+					continue
+				}
+				logger.Info("wrote graph snapshot", "duration", time.Since(start), "stats", g.Stats())
+			}
+		}
+	}()
+
+	srv := NewServer(g, logger)
+	go func() {
+		if err := srv.Start(cctx.String("bind")); err != nil && err != http.ErrServerClosed {
+			logger.Error("API server failed", "err", err)
+			cancel()
+		}
+	}()
+
+	go func() {
+		opts := follower.Options{Name: "graphd", Cursor: g.Seq, Logger: logger}
+		if err := follower.Follow(ctx, cctx.String("relay-host"), g.HandleEvent, opts); err != nil {
+			logger.Error("failed to follow sovereign stream", "err", err)
+			cancel()
+		}
+	}()
+
+	select {
+	case <-signals:
+		logger.Info("shutting down on signal")
+	case <-ctx.Done():
+	}
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down API server", "err", err)
+	}
+	if err := g.SaveFile(snapshotPath); err != nil {
+		return fmt.Errorf("writing final graph snapshot: %w", err)
+	}
+	logger.Info("wrote final graph snapshot", "stats", g.Stats())
+	return nil
+}
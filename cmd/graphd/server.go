@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/graph"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	slogecho "github.com/samber/slog-echo"
+)
+
+type Server struct {
+	graph  *graph.Graph
+	echo   *echo.Echo
+	logger *slog.Logger
+}
+
+func NewServer(g *graph.Graph, logger *slog.Logger) *Server {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(slogecho.New(logger))
+	e.Use(middleware.Recover())
+
+	srv := &Server{
+		graph:  g,
+		echo:   e,
+		logger: logger,
+	}
+
+	e.GET("/_health", srv.handleHealth)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/xrpc/ca.gander.graph.getCounts", srv.handleGetCounts)
+	e.GET("/xrpc/ca.gander.graph.getMutuals", srv.handleGetMutuals)
+	e.GET("/xrpc/ca.gander.graph.checkFollow", srv.handleCheckFollow)
+	e.GET("/xrpc/ca.gander.graph.checkBlock", srv.handleCheckBlock)
+	return srv
+}
+
+func (s *Server) Start(listen string) error {
+	s.logger.Info("starting graph API", "bind", listen)
+	return s.echo.Start(listen)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.echo.Shutdown(ctx)
+}
+
+func (s *Server) handleHealth(c echo.Context) error {
+	return c.JSON(200, map[string]any{"status": "ok", "graph": s.graph.Stats()})
+}
+
+// didParam parses a required DID query parameter
+func didParam(c echo.Context, name string) (string, error) {
+	did, err := syntax.ParseDID(c.QueryParam(name))
+	if err != nil {
+		return "", &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid DID for '%s': %s", name, err),
+		}
+	}
+	return did.String(), nil
+}
+
+func (s *Server) handleGetCounts(c echo.Context) error {
+	did, err := didParam(c, "did")
+	if err != nil {
+		return err
+	}
+	followers, following := s.graph.Counts(did)
+	return c.JSON(200, map[string]any{
+		"did":       did,
+		"followers": followers,
+		"following": following,
+	})
+}
+
+func (s *Server) handleGetMutuals(c echo.Context) error {
+	did, err := didParam(c, "did")
+	if err != nil {
+		return err
+	}
+	limit := 100
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 10000 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 10000)",
+			}
+		}
+	}
+	return c.JSON(200, map[string]any{
+		"did":     did,
+		"mutuals": s.graph.Mutuals(did, limit),
+	})
+}
+
+func (s *Server) handleCheckFollow(c echo.Context) error {
+	actor, err := didParam(c, "actor")
+	if err != nil {
+		return err
+	}
+	subject, err := didParam(c, "subject")
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, map[string]any{
+		"following":  s.graph.Follows(actor, subject),
+		"followedBy": s.graph.Follows(subject, actor),
+	})
+}
+
+func (s *Server) handleCheckBlock(c echo.Context) error {
+	actor, err := didParam(c, "actor")
+	if err != nil {
+		return err
+	}
+	subject, err := didParam(c, "subject")
+	if err != nil {
+		return err
+	}
+	blocking := s.graph.Blocks(actor, subject)
+	blockedBy := s.graph.Blocks(subject, actor)
+	return c.JSON(200, map[string]any{
+		"blocking":  blocking,
+		"blockedBy": blockedBy,
+		"blocked":   blocking || blockedBy,
+	})
+}
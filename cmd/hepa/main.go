@@ -18,6 +18,7 @@ import (
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/automod/capture"
 	"github.com/bluesky-social/indigo/automod/consumer"
+	"github.com/bluesky-social/indigo/util"
 
 	"github.com/carlmjohnson/versioninfo"
 	_ "github.com/joho/godotenv/autoload"
@@ -104,6 +105,22 @@ func run(args []string) error {
 			Usage:   "file path of JSON file containing static sets",
 			EnvVars: []string{"HEPA_SETS_JSON_PATH"},
 		},
+		&cli.StringFlag{
+			Name:    "verified-orgs-relay",
+			Usage:   "base URL of a relay publishing verified organizations; enables the org-verified account label",
+			EnvVars: []string{"HEPA_VERIFIED_ORGS_RELAY"},
+		},
+		&cli.StringFlag{
+			Name:    "threat-feeds-json-path",
+			Usage:   "file path of JSON file listing threat intelligence feeds (name, url, optional label) to check links against",
+			EnvVars: []string{"HEPA_THREAT_FEEDS_JSON_PATH"},
+		},
+		&cli.DurationFlag{
+			Name:    "threat-feeds-refresh",
+			Usage:   "how often to re-download threat intelligence feeds",
+			Value:   time.Hour,
+			EnvVars: []string{"HEPA_THREAT_FEEDS_REFRESH"},
+		},
 		&cli.StringFlag{
 			Name:    "hiveai-api-token",
 			Usage:   "API token for Hive AI image auto-labeling",
@@ -302,12 +319,21 @@ var runCmd = &cli.Command{
 				RecordEventTimeout:   cctx.Duration("record-event-timeout"),
 				IdentityEventTimeout: cctx.Duration("identity-event-timeout"),
 				OzoneEventTimeout:    cctx.Duration("ozone-event-timeout"),
+				VerifiedOrgsRelay:    cctx.String("verified-orgs-relay"),
+				ThreatFeedsJSON:      cctx.String("threat-feeds-json-path"),
 			},
 		)
 		if err != nil {
 			return fmt.Errorf("failed to construct server: %v", err)
 		}
 
+		if srv.Orgs != nil {
+			go srv.Orgs.Follow(ctx, util.RobustHTTPClient(), cctx.String("verified-orgs-relay"), 10*time.Minute, logger.With("subsystem", "orgs"))
+		}
+		if srv.ThreatFeeds != nil {
+			go srv.ThreatFeeds.Run(ctx, cctx.Duration("threat-feeds-refresh"))
+		}
+
 		// ozone event consumer (if configured)
 		if srv.Engine.OzoneClient != nil {
 			oc := consumer.OzoneConsumer{
@@ -17,7 +17,9 @@ import (
 	"github.com/bluesky-social/indigo/automod/flagstore"
 	"github.com/bluesky-social/indigo/automod/rules"
 	"github.com/bluesky-social/indigo/automod/setstore"
+	"github.com/bluesky-social/indigo/automod/threatfeed"
 	"github.com/bluesky-social/indigo/automod/visual"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
 
@@ -28,6 +30,10 @@ import (
 type Server struct {
 	Engine      *automod.Engine
 	RedisClient *redis.Client
+	// verified organization registry, followed from a relay; nil if not configured
+	Orgs *orgs.Registry
+	// threat intelligence feed checker; nil if not configured
+	ThreatFeeds *threatfeed.Checker
 
 	logger *slog.Logger
 }
@@ -57,6 +63,23 @@ type Config struct {
 	RecordEventTimeout   time.Duration
 	IdentityEventTimeout time.Duration
 	OzoneEventTimeout    time.Duration
+	// base URL of a relay publishing the verified organization list
+	VerifiedOrgsRelay string
+	// file path of JSON file listing threat intelligence feeds to check links against
+	ThreatFeedsJSON string
+}
+
+// orgSetStore answers the verified organizations set from a live registry, deferring to the static sets otherwise
+type orgSetStore struct {
+	setstore.SetStore
+	orgs *orgs.Registry
+}
+
+func (s *orgSetStore) InSet(ctx context.Context, name, val string) (bool, error) {
+	if name == rules.VerifiedOrgsSet {
+		return s.orgs.IsVerified(val), nil
+	}
+	return s.SetStore.InSet(ctx, name, val)
 }
 
 func NewServer(dir identity.Directory, config Config) (*Server, error) {
@@ -106,9 +129,9 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		logger.Info("did not configure PDS admin client")
 	}
 
-	sets := setstore.NewMemSetStore()
+	memSets := setstore.NewMemSetStore()
 	if config.SetsFileJSON != "" {
-		if err := sets.LoadFromFileJSON(config.SetsFileJSON); err != nil {
+		if err := memSets.LoadFromFileJSON(config.SetsFileJSON); err != nil {
 			return nil, fmt.Errorf("initializing in-process setstore: %v", err)
 		} else {
 			logger.Info("loaded set config from JSON", "path", config.SetsFileJSON)
@@ -188,6 +211,28 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		return nil, fmt.Errorf("unknown ruleset config: %s", config.RulesetName)
 	}
 
+	var sets setstore.SetStore = memSets
+	var orgReg *orgs.Registry
+	if config.VerifiedOrgsRelay != "" {
+		orgReg = orgs.NewRegistry()
+		sets = &orgSetStore{SetStore: memSets, orgs: orgReg}
+		ruleset.IdentityRules = append(ruleset.IdentityRules, rules.VerifiedOrgIdentityRule)
+		ruleset.RecordRules = append(ruleset.RecordRules, rules.VerifiedOrgRecordRule)
+		logger.Info("following verified organizations", "relay", config.VerifiedOrgsRelay)
+	}
+
+	var threats *threatfeed.Checker
+	if config.ThreatFeedsJSON != "" {
+		feeds, err := threatfeed.LoadFeedsJSON(config.ThreatFeedsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("loading threat feed config: %v", err)
+		}
+		threats = threatfeed.NewChecker(feeds, util.RobustHTTPClient(), logger.With("subsystem", "threat-feeds"))
+		ruleset.PostRules = append(ruleset.PostRules, threats.ThreatLinkPostRule)
+		ruleset.ProfileRules = append(ruleset.ProfileRules, threats.ThreatLinkProfileRule)
+		logger.Info("checking links against threat feeds", "feeds", len(feeds))
+	}
+
 	var notifier automod.Notifier
 	if config.SlackWebhookURL != "" {
 		notifier = &automod.SlackNotifier{
@@ -232,6 +277,8 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		logger:      logger,
 		Engine:      &eng,
 		RedisClient: rdb,
+		Orgs:        orgReg,
+		ThreatFeeds: threats,
 	}
 
 	return s, nil
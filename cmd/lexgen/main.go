@@ -70,6 +70,10 @@ func main() {
 		&cli.BoolFlag{
 			Name: "gen-handlers",
 		},
+		&cli.BoolFlag{
+			Name:  "gen-mocks",
+			Usage: "generate a test double of util.LexClient for each package, in a <package>mock subdirectory of its outdir",
+		},
 		&cli.StringSliceFlag{
 			Name: "types-import",
 		},
@@ -88,6 +92,10 @@ func main() {
 			Name:  "build-file",
 			Value: "",
 		},
+		&cli.StringSliceFlag{
+			Name:  "remap",
+			Usage: "rewrite an NSID prefix in lexicon IDs and refs before generating, eg app.bsky=app.gndr",
+		},
 	}
 	app.Action = func(cctx *cli.Context) error {
 		paths, err := expandArgs(cctx.Args().Slice())
@@ -123,6 +131,13 @@ func main() {
 			externalSchemas = append(externalSchemas, s)
 		}
 
+		remaps, err := lex.ParseRemaps(cctx.StringSlice("remap"))
+		if err != nil {
+			return fmt.Errorf("--remap error, %w", err)
+		}
+		lex.RemapSchemas(schemas, remaps)
+		lex.RemapSchemas(externalSchemas, remaps)
+
 		buildLiteral := cctx.String("build")
 		buildPath := cctx.String("build-file")
 		var packages []lex.Package
@@ -175,6 +190,8 @@ func main() {
 				return err
 			}
 
+		} else if cctx.Bool("gen-mocks") {
+			return lex.RunMocks(schemas, externalSchemas, packages)
 		} else {
 			return lex.Run(schemas, externalSchemas, packages)
 		}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+	"github.com/bluesky-social/indigo/sovereignty/notify"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/util/cliutil"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/urfave/cli/v2"
+	_ "go.uber.org/automaxprocs"
+)
+
+func main() {
+	app := cli.App{
+		Name:    "notifyd",
+		Usage:   "notification service for sovereign accounts",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "relay-host",
+			Usage:   "websocket URL of the relay serving the sovereign stream",
+			Value:   "ws://localhost:2470",
+			EnvVars: []string{"NOTIFYD_RELAY_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "bind",
+			Usage:   "local IP/port for the internal API",
+			Value:   ":2490",
+			EnvVars: []string{"NOTIFYD_BIND"},
+		},
+		&cli.StringFlag{
+			Name:    "database-url",
+			Value:   "sqlite://data/notifyd/notifyd.db",
+			EnvVars: []string{"DATABASE_URL"},
+		},
+		&cli.IntFlag{
+			Name:    "max-db-connections",
+			Value:   40,
+			EnvVars: []string{"NOTIFYD_MAX_DB_CONNECTIONS"},
+		},
+		&cli.StringFlag{
+			Name:    "atp-plc-host",
+			Usage:   "method, hostname, and port of PLC registry",
+			Value:   "https://plc.directory",
+			EnvVars: []string{"ATP_PLC_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "country-snapshots-url",
+			Usage:   "base URL of a relay's published classification snapshots; if set, only classified accounts receive notifications",
+			EnvVars: []string{"NOTIFYD_COUNTRY_SNAPSHOTS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "country-snapshots-signer",
+			Usage:   "did:key of the key classification snapshots must be signed by (required with --country-snapshots-url)",
+			EnvVars: []string{"NOTIFYD_COUNTRY_SNAPSHOTS_SIGNER"},
+		},
+		&cli.DurationFlag{
+			Name:    "country-snapshots-interval",
+			Usage:   "how often to sync classification snapshots",
+			Value:   5 * time.Minute,
+			EnvVars: []string{"NOTIFYD_COUNTRY_SNAPSHOTS_INTERVAL"},
+		},
+	}
+
+	app.Action = runNotifyd
+
+	if err := app.Run(os.Args); err != nil {
+		slog.Error("fatal", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func runNotifyd(cctx *cli.Context) error {
+	ctx, cancel := context.WithCancel(cctx.Context)
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	db, err := cliutil.SetupDatabase(cctx.String("database-url"), cctx.Int("max-db-connections"))
+	if err != nil {
+		return fmt.Errorf("failed to set up database: %w", err)
+	}
+	store, err := notify.NewStore(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	svc := notify.NewService(store)
+	if err := svc.LoadCursor(ctx); err != nil {
+		return fmt.Errorf("loading stream cursor: %w", err)
+	}
+
+	if snapURL := cctx.String("country-snapshots-url"); snapURL != "" {
+		pub, err := crypto.ParsePublicDIDKey(cctx.String("country-snapshots-signer"))
+		if err != nil {
+			return fmt.Errorf("invalid --country-snapshots-signer: %w", err)
+		}
+		loader := snapshot.NewLoader(snapURL, pub)
+		loader.Client = util.RobustHTTPClient()
+		tbl := sovereignty.NewTable()
+		// the recipient filter needs a populated table before any events are processed
+		if _, err := loader.Sync(ctx, tbl); err != nil {
+			return fmt.Errorf("loading classification snapshots: %w", err)
+		}
+		svc.IsRecipient = func(did string) bool {
+			_, ok := tbl.Get(did)
+			return ok
+		}
+		go func() {
+			t := time.NewTicker(cctx.Duration("country-snapshots-interval"))
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					if _, err := loader.Sync(ctx, tbl); err != nil {
+						logger.Warn("failed to sync classification snapshots", "err", err)
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		t := time.NewTicker(5 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := svc.SaveCursor(ctx); err != nil {
+					logger.Error("failed to save stream cursor", "err", err)
+				}
+			}
+		}
+	}()
+
+	base := identity.BaseDirectory{
+		PLCURL: cctx.String("atp-plc-host"),
+		HTTPClient: http.Client{
+			Timeout: time.Second * 15,
+		},
+		TryAuthoritativeDNS: true,
+	}
+	dir := identity.NewCacheDirectory(&base, 250_000, time.Hour*24, time.Minute*2, time.Minute*5)
+
+	srv := NewServer(store, &dir, logger)
+	go func() {
+		if err := srv.Start(cctx.String("bind")); err != nil && err != http.ErrServerClosed {
+			logger.Error("API server failed", "err", err)
+			cancel()
+		}
+	}()
+
+	go func() {
+		opts := follower.Options{Name: "notifyd", Cursor: svc.Seq, Logger: logger}
+		if err := follower.Follow(ctx, cctx.String("relay-host"), svc.HandleEvent, opts); err != nil {
+			logger.Error("failed to follow sovereign stream", "err", err)
+			cancel()
+		}
+	}()
+
+	select {
+	case <-signals:
+		logger.Info("shutting down on signal")
+	case <-ctx.Done():
+	}
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down API server", "err", err)
+	}
+	return svc.SaveCursor(shutdownCtx)
+}
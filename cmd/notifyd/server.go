@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty/notify"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	slogecho "github.com/samber/slog-echo"
+)
+
+// Server serves the internal notification API. Requests are made by the AppView on behalf of an authenticated account, which is passed as the 'viewer' parameter.
+type Server struct {
+	store  *notify.Store
+	dir    identity.Directory
+	echo   *echo.Echo
+	logger *slog.Logger
+}
+
+func NewServer(store *notify.Store, dir identity.Directory, logger *slog.Logger) *Server {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(slogecho.New(logger))
+	e.Use(middleware.Recover())
+
+	srv := &Server{
+		store:  store,
+		dir:    dir,
+		echo:   e,
+		logger: logger,
+	}
+
+	e.GET("/_health", srv.handleHealth)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/xrpc/app.bsky.notification.listNotifications", srv.handleListNotifications)
+	e.GET("/xrpc/app.bsky.notification.getUnreadCount", srv.handleGetUnreadCount)
+	e.POST("/xrpc/app.bsky.notification.updateSeen", srv.handleUpdateSeen)
+	return srv
+}
+
+func (s *Server) Start(listen string) error {
+	s.logger.Info("starting notification API", "bind", listen)
+	return s.echo.Start(listen)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.echo.Shutdown(ctx)
+}
+
+func (s *Server) handleHealth(c echo.Context) error {
+	return c.JSON(200, map[string]any{"status": "ok"})
+}
+
+func viewerParam(c echo.Context) (string, error) {
+	did, err := syntax.ParseDID(c.QueryParam("viewer"))
+	if err != nil {
+		return "", &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid DID for 'viewer': %s", err),
+		}
+	}
+	return did.String(), nil
+}
+
+func (s *Server) handleListNotifications(c echo.Context) error {
+	ctx := c.Request().Context()
+	viewer, err := viewerParam(c)
+	if err != nil {
+		return err
+	}
+
+	params := notify.ListParams{
+		Recipient: viewer,
+		Limit:     50,
+		Reasons:   c.QueryParams()["reasons"],
+	}
+	if l := c.QueryParam("limit"); l != "" {
+		params.Limit, err = strconv.Atoi(l)
+		if err != nil || params.Limit < 1 || params.Limit > 100 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'limit' (must be between 1 and 100)",
+			}
+		}
+	}
+	if cur := c.QueryParam("cursor"); cur != "" {
+		before, err := strconv.ParseUint(cur, 10, 64)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid value for 'cursor': %s", err),
+			}
+		}
+		params.Before = uint(before)
+	}
+
+	rows, err := s.store.List(ctx, params)
+	if err != nil {
+		return err
+	}
+	seenAt, err := s.store.SeenAt(ctx, viewer)
+	if err != nil {
+		return err
+	}
+
+	out := appbsky.NotificationListNotifications_Output{
+		Notifications: []*appbsky.NotificationListNotifications_Notification{},
+	}
+	if !seenAt.IsZero() {
+		sa := seenAt.UTC().Format(syntax.AtprotoDatetimeLayout)
+		out.SeenAt = &sa
+	}
+	for _, row := range rows {
+		rec, err := lexutil.CborDecodeValue(row.Record)
+		if err != nil {
+			s.logger.Warn("skipping notification with undecodable record", "uri", row.URI, "err", err)
+			continue
+		}
+		n := &appbsky.NotificationListNotifications_Notification{
+			Author:    s.profileView(ctx, row.Author),
+			Cid:       row.CID,
+			IndexedAt: row.CreatedAt.UTC().Format(syntax.AtprotoDatetimeLayout),
+			IsRead:    !row.CreatedAt.After(seenAt),
+			Reason:    row.Reason,
+			Record:    &lexutil.LexiconTypeDecoder{Val: rec},
+			Uri:       row.URI,
+		}
+		if row.ReasonSubject != "" {
+			rs := row.ReasonSubject
+			n.ReasonSubject = &rs
+		}
+		out.Notifications = append(out.Notifications, n)
+	}
+	if len(rows) == params.Limit {
+		cur := strconv.FormatUint(uint64(rows[len(rows)-1].ID), 10)
+		out.Cursor = &cur
+	}
+	return c.JSON(200, out)
+}
+
+// profileView returns a minimal author view; the AppView fills in the rest of the profile
+func (s *Server) profileView(ctx context.Context, did string) *appbsky.ActorDefs_ProfileView {
+	pv := &appbsky.ActorDefs_ProfileView{
+		Did:    did,
+		Handle: syntax.HandleInvalid.String(),
+	}
+	ident, err := s.dir.LookupDID(ctx, syntax.DID(did))
+	if err == nil && !ident.Handle.IsInvalidHandle() {
+		pv.Handle = ident.Handle.String()
+	}
+	return pv
+}
+
+func (s *Server) handleGetUnreadCount(c echo.Context) error {
+	viewer, err := viewerParam(c)
+	if err != nil {
+		return err
+	}
+	count, err := s.store.UnreadCount(c.Request().Context(), viewer)
+	if err != nil {
+		return err
+	}
+	return c.JSON(200, appbsky.NotificationGetUnreadCount_Output{Count: count})
+}
+
+func (s *Server) handleUpdateSeen(c echo.Context) error {
+	viewer, err := viewerParam(c)
+	if err != nil {
+		return err
+	}
+	var body appbsky.NotificationUpdateSeen_Input
+	if err := c.Bind(&body); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid request body: %s", err),
+		}
+	}
+	seenAt, err := syntax.ParseDatetimeTime(body.SeenAt)
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid Datetime for 'seenAt': %s", err),
+		}
+	}
+	if err := s.store.UpdateSeen(c.Request().Context(), viewer, seenAt); err != nil {
+		return err
+	}
+	return c.NoContent(200)
+}
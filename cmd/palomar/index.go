@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bluesky-social/indigo/search"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var indexCmd = &cli.Command{
+	Name:  "index",
+	Usage: "manage aliased indices: rotation, rebuilds and snapshots",
+	Subcommands: []*cli.Command{
+		indexStatusCmd,
+		indexMigrateCmd,
+		indexRotateCmd,
+		indexReindexCmd,
+		indexPruneCmd,
+		indexSnapshotRepoCmd,
+		indexSnapshotCmd,
+		indexSnapshotsCmd,
+		indexRestoreCmd,
+	},
+}
+
+// indexTargets maps the names accepted by index subcommands to the configured index names and their schemas
+func indexTargets(cctx *cli.Context) (map[string]string, error) {
+	targets := map[string]string{}
+	names := cctx.Args().Slice()
+	if len(names) == 0 {
+		names = []string{"post", "profile"}
+	}
+	for _, n := range names {
+		switch n {
+		case "post":
+			targets[cctx.String("es-post-index")] = search.PostSchemaJSON()
+		case "profile":
+			targets[cctx.String("es-profile-index")] = search.ProfileSchemaJSON()
+		default:
+			return nil, fmt.Errorf("unknown index %q (expected post or profile)", n)
+		}
+	}
+	return targets, nil
+}
+
+func newLifecycle(cctx *cli.Context) (*search.Lifecycle, error) {
+	escli, err := createEsClient(cctx)
+	if err != nil {
+		return nil, err
+	}
+	return search.NewLifecycle(escli, slog.Default()), nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+var indexStatusCmd = &cli.Command{
+	Name:      "status",
+	Usage:     "show the backing indices of aliased indices",
+	ArgsUsage: "[post|profile]...",
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		for alias := range targets {
+			st, err := lc.Status(cctx.Context, alias)
+			if err != nil {
+				return err
+			}
+			if st == nil {
+				fmt.Printf("%s: not an alias\n", alias)
+				continue
+			}
+			if err := printJSON(st); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var indexMigrateCmd = &cli.Command{
+	Name:      "migrate",
+	Usage:     "convert concrete indices in to aliased indices (stop the indexer first)",
+	ArgsUsage: "[post|profile]...",
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		for index, schema := range targets {
+			if err := lc.Migrate(cctx.Context, index, schema); err != nil {
+				return fmt.Errorf("migrating %s: %w", index, err)
+			}
+		}
+		return nil
+	},
+}
+
+var indexRotateCmd = &cli.Command{
+	Name:      "rotate",
+	Usage:     "start a new backing index now, regardless of the rotation schedule",
+	ArgsUsage: "[post|profile]...",
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		for alias, schema := range targets {
+			name, err := lc.Rollover(cctx.Context, alias, schema)
+			if err != nil {
+				return fmt.Errorf("rotating %s: %w", alias, err)
+			}
+			fmt.Printf("%s: new write index %s\n", alias, name)
+		}
+		return nil
+	},
+}
+
+var indexReindexCmd = &cli.Command{
+	Name:      "reindex",
+	Usage:     "rebuild backing indices with the current schema (eg, after analyzer changes), without downtime",
+	ArgsUsage: "[post|profile]...",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "delete-old",
+			Usage: "delete each old backing index once it has been replaced",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		for alias, schema := range targets {
+			if err := lc.Reindex(cctx.Context, alias, schema, cctx.Bool("delete-old")); err != nil {
+				return fmt.Errorf("reindexing %s: %w", alias, err)
+			}
+		}
+		return nil
+	},
+}
+
+var indexPruneCmd = &cli.Command{
+	Name:      "prune",
+	Usage:     "delete all but the newest backing indices",
+	ArgsUsage: "[post|profile]...",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:     "keep",
+			Usage:    "number of backing indices to keep",
+			Required: true,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		if cctx.Int("keep") < 1 {
+			return fmt.Errorf("--keep must be at least 1")
+		}
+		for alias := range targets {
+			deleted, err := lc.Prune(cctx.Context, alias, cctx.Int("keep"))
+			if err != nil {
+				return fmt.Errorf("pruning %s: %w", alias, err)
+			}
+			fmt.Printf("%s: deleted %v\n", alias, deleted)
+		}
+		return nil
+	},
+}
+
+var snapshotRepoFlag = &cli.StringFlag{
+	Name:    "repository",
+	Usage:   "name of the snapshot repository",
+	Value:   "palomar-s3",
+	EnvVars: []string{"PALOMAR_SNAPSHOT_REPOSITORY"},
+}
+
+var indexSnapshotRepoCmd = &cli.Command{
+	Name:  "snapshot-repo",
+	Usage: "register an S3 snapshot repository (requires the repository-s3 plugin)",
+	Flags: []cli.Flag{
+		snapshotRepoFlag,
+		&cli.StringFlag{
+			Name:     "bucket",
+			Required: true,
+			EnvVars:  []string{"PALOMAR_SNAPSHOT_BUCKET"},
+		},
+		&cli.StringFlag{
+			Name:    "base-path",
+			EnvVars: []string{"PALOMAR_SNAPSHOT_BASE_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Usage:   "S3-compatible endpoint, if not AWS",
+			EnvVars: []string{"PALOMAR_SNAPSHOT_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "region",
+			EnvVars: []string{"PALOMAR_SNAPSHOT_REGION"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		return lc.RegisterS3Repository(cctx.Context, cctx.String("repository"), search.S3Repository{
+			Bucket:   cctx.String("bucket"),
+			BasePath: cctx.String("base-path"),
+			Endpoint: cctx.String("endpoint"),
+			Region:   cctx.String("region"),
+		})
+	},
+}
+
+var indexSnapshotCmd = &cli.Command{
+	Name:      "snapshot",
+	Usage:     "snapshot indices to the repository",
+	ArgsUsage: "[post|profile]...",
+	Flags: []cli.Flag{
+		snapshotRepoFlag,
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "snapshot name (default: based on the current time)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		targets, err := indexTargets(cctx)
+		if err != nil {
+			return err
+		}
+		name := cctx.String("name")
+		if name == "" {
+			name = search.SnapshotName(time.Now())
+		}
+		var indices []string
+		for index := range targets {
+			indices = append(indices, index)
+		}
+		if err := lc.CreateSnapshot(cctx.Context, cctx.String("repository"), name, indices); err != nil {
+			return err
+		}
+		fmt.Println(name)
+		return nil
+	},
+}
+
+var indexSnapshotsCmd = &cli.Command{
+	Name:  "snapshots",
+	Usage: "list snapshots in the repository",
+	Flags: []cli.Flag{
+		snapshotRepoFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		snaps, err := lc.ListSnapshots(cctx.Context, cctx.String("repository"))
+		if err != nil {
+			return err
+		}
+		return printJSON(snaps)
+	},
+}
+
+var indexRestoreCmd = &cli.Command{
+	Name:      "restore",
+	Usage:     "restore backing indices from a snapshot",
+	ArgsUsage: "<snapshot> [index]...",
+	Flags: []cli.Flag{
+		snapshotRepoFlag,
+		&cli.StringFlag{
+			Name:  "rename-suffix",
+			Usage: "restore alongside the live indices, with this suffix appended to their names (aliases are not restored)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() < 1 {
+			return fmt.Errorf("snapshot name is required")
+		}
+		lc, err := newLifecycle(cctx)
+		if err != nil {
+			return err
+		}
+		return lc.RestoreSnapshot(cctx.Context, cctx.String("repository"), cctx.Args().First(), cctx.Args().Tail(), cctx.String("rename-suffix"))
+	},
+}
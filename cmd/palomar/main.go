@@ -21,8 +21,14 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"golang.org/x/time/rate"
 
+	"github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/search"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/util/cliutil"
 
 	"github.com/carlmjohnson/versioninfo"
@@ -116,6 +122,7 @@ func run(args []string) error {
 		elasticCheckCmd,
 		searchPostCmd,
 		searchProfileCmd,
+		indexCmd,
 	}
 
 	return app.Run(args)
@@ -176,6 +183,104 @@ var runCmd = &cli.Command{
 			EnvVars: []string{"PALOMAR_DISCOVER_REPOS"},
 			Value:   false,
 		},
+		&cli.StringFlag{
+			Name:    "indigenous-feed-uri",
+			Usage:   "AT-URI of a feed generator record; if set, serves a feed of posts in Indigenous languages for it",
+			EnvVars: []string{"PALOMAR_INDIGENOUS_FEED_URI"},
+		},
+		&cli.StringFlag{
+			Name:    "verified-orgs-relay",
+			Usage:   "base URL of a relay publishing verified organizations",
+			EnvVars: []string{"PALOMAR_VERIFIED_ORGS_RELAY"},
+		},
+		&cli.StringFlag{
+			Name:    "verified-orgs-feed-uri",
+			Usage:   "AT-URI of a feed generator record; if set, serves a feed of posts by verified organizations for it (requires --verified-orgs-relay)",
+			EnvVars: []string{"PALOMAR_VERIFIED_ORGS_FEED_URI"},
+		},
+		&cli.StringFlag{
+			Name:    "country-snapshots-url",
+			Usage:   "base URL of a relay's published classification snapshots; if set, indexed profiles and posts are labeled with the author's country",
+			EnvVars: []string{"PALOMAR_COUNTRY_SNAPSHOTS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "country-snapshots-signer",
+			Usage:   "did:key of the key classification snapshots must be signed by (required with --country-snapshots-url)",
+			EnvVars: []string{"PALOMAR_COUNTRY_SNAPSHOTS_SIGNER"},
+		},
+		&cli.DurationFlag{
+			Name:    "country-snapshots-interval",
+			Usage:   "how often to sync classification snapshots",
+			Value:   5 * time.Minute,
+			EnvVars: []string{"PALOMAR_COUNTRY_SNAPSHOTS_INTERVAL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "country-feed",
+			Usage:   "serve a feed of posts by accounts classified to a country, as CC=<feed generator AT-URI> (eg CA=at://did:web:feeds.example.com/app.bsky.feed.generator/canadian-authors)",
+			EnvVars: []string{"PALOMAR_COUNTRY_FEEDS"},
+		},
+		&cli.BoolFlag{
+			Name:    "thread-strict",
+			Usage:   "in assembled threads, replace posts by accounts without a sovereignty classification with placeholders (requires --country-snapshots-url on the indexer)",
+			EnvVars: []string{"PALOMAR_THREAD_STRICT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "thread-countries",
+			Usage:   "with --thread-strict, only accounts classified to these countries are shown (default: any classified account)",
+			EnvVars: []string{"PALOMAR_THREAD_COUNTRIES"},
+		},
+		&cli.StringFlag{
+			Name:    "thread-placeholder",
+			Usage:   "how hidden posts are shown in threads: notfound, blocked or omit",
+			Value:   search.PlaceholderNotFound,
+			EnvVars: []string{"PALOMAR_THREAD_PLACEHOLDER"},
+		},
+		&cli.BoolFlag{
+			Name:    "typeahead-trie",
+			Usage:   "serve typeahead searches from an in-memory prefix index, kept up to date by the indexer (ignored with --readonly)",
+			EnvVars: []string{"PALOMAR_TYPEAHEAD_TRIE"},
+		},
+		&cli.BoolFlag{
+			Name:    "index-aliases",
+			Usage:   "treat the index names as aliases over managed backing indices (see 'palomar index')",
+			EnvVars: []string{"PALOMAR_INDEX_ALIASES"},
+		},
+		&cli.StringFlag{
+			Name:    "post-index-rotation",
+			Usage:   "with --index-aliases, start a new backing post index: none, daily or weekly",
+			Value:   "none",
+			EnvVars: []string{"PALOMAR_POST_INDEX_ROTATION"},
+		},
+		&cli.IntFlag{
+			Name:    "post-index-retention",
+			Usage:   "with --post-index-rotation, number of backing post indices to keep (0 keeps all)",
+			EnvVars: []string{"PALOMAR_POST_INDEX_RETENTION"},
+		},
+		&cli.StringFlag{
+			Name:    "minor-policy",
+			Usage:   "path to a JSON minor-protection policy; accounts it flags are kept out of the index",
+			EnvVars: []string{"PALOMAR_MINOR_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "bearer token for the admin API (researcher dataset exports); empty disables it",
+			EnvVars: []string{"PALOMAR_ADMIN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "export-dir",
+			Usage:   "directory researcher datasets are written to; empty disables exports (ignored with --readonly)",
+			EnvVars: []string{"PALOMAR_EXPORT_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "export-key",
+			Usage:   "secret (at least 32 bytes) from which per-export pseudonym keys are derived",
+			EnvVars: []string{"PALOMAR_EXPORT_KEY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "export-fields",
+			Usage:   "privacy-reviewed allowlist of fields researchers may request (default leaves out text, replies and mentions)",
+			EnvVars: []string{"PALOMAR_EXPORT_FIELDS"},
+		},
 		&cli.StringFlag{
 			Name:    "pagerank-file",
 			EnvVars: []string{"PAGERANK_FILE"},
@@ -265,6 +370,43 @@ var runCmd = &cli.Command{
 			Logger:       logger,
 			ProfileIndex: cctx.String("es-profile-index"),
 			PostIndex:    cctx.String("es-post-index"),
+
+			IndigenousFeedURI: cctx.String("indigenous-feed-uri"),
+			OrgsFeedURI:       cctx.String("verified-orgs-feed-uri"),
+			AdminToken:        cctx.String("admin-token"),
+		}
+		if relay := cctx.String("verified-orgs-relay"); relay != "" {
+			apiConfig.Orgs = orgs.NewRegistry()
+			go apiConfig.Orgs.Follow(cctx.Context, util.RobustHTTPClient(), relay, 10*time.Minute, logger.With("subsystem", "orgs"))
+		}
+
+		if specs := cctx.StringSlice("country-feed"); len(specs) > 0 {
+			apiConfig.CountryFeeds, err = search.ParseCountryFeeds(specs)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cctx.Bool("thread-strict") {
+			placeholder, err := search.ParseThreadPlaceholder(cctx.String("thread-placeholder"))
+			if err != nil {
+				return err
+			}
+			policy := search.ThreadPolicy{Strict: true, Placeholder: placeholder}
+			for _, raw := range cctx.StringSlice("thread-countries") {
+				country, err := sovereignty.NormalizeCountry(raw)
+				if err != nil {
+					return err
+				}
+				policy.Countries = append(policy.Countries, country)
+			}
+			apiConfig.ThreadPolicy = &policy
+		}
+
+		var actorTrie *search.ActorTrie
+		if cctx.Bool("typeahead-trie") && !readonly {
+			actorTrie = search.NewActorTrie()
+			apiConfig.ActorTrie = actorTrie
 		}
 
 		srv, err := search.NewServer(escli, &dir, apiConfig)
@@ -273,6 +415,7 @@ var runCmd = &cli.Command{
 		}
 
 		// Configure the indexer if we're not in readonly mode
+		var countryLoader *snapshot.Loader
 		if !readonly {
 			db, err := cliutil.SetupDatabase(cctx.String("database-url"), cctx.Int("max-metadb-connections"))
 			if err != nil {
@@ -289,6 +432,32 @@ var runCmd = &cli.Command{
 				DiscoverRepos:       cctx.Bool("discover-repos"),
 				IndexingRateLimit:   cctx.Int("indexing-rate-limit"),
 			}
+			indexerConfig.ActorTrie = actorTrie
+			if cctx.Bool("index-aliases") {
+				rotation, err := search.ParseRotation(cctx.String("post-index-rotation"))
+				if err != nil {
+					return err
+				}
+				indexerConfig.IndexAliases = true
+				indexerConfig.PostRotation = rotation
+				indexerConfig.PostRetention = cctx.Int("post-index-retention")
+			}
+			if fname := cctx.String("minor-policy"); fname != "" {
+				policy, err := minors.LoadPolicy(fname)
+				if err != nil {
+					return err
+				}
+				indexerConfig.MinorPolicy = policy
+			}
+			if url := cctx.String("country-snapshots-url"); url != "" {
+				pub, err := crypto.ParsePublicDIDKey(cctx.String("country-snapshots-signer"))
+				if err != nil {
+					return fmt.Errorf("invalid --country-snapshots-signer: %w", err)
+				}
+				countryLoader = snapshot.NewLoader(url, pub)
+				countryLoader.Client = util.RobustHTTPClient()
+				indexerConfig.Countries = sovereignty.NewTable()
+			}
 
 			idx, err := search.NewIndexer(db, escli, &dir, indexerConfig)
 			if err != nil {
@@ -296,6 +465,13 @@ var runCmd = &cli.Command{
 			}
 
 			srv.Indexer = idx
+
+			if exportDir := cctx.String("export-dir"); exportDir != "" {
+				srv.Exporter, err = search.NewExporter(db, escli, cctx.String("es-post-index"), exportDir, []byte(cctx.String("export-key")), cctx.StringSlice("export-fields"), logger.With("subsystem", "exports"))
+				if err != nil {
+					return fmt.Errorf("failed to set up dataset exports: %w", err)
+				}
+			}
 		}
 
 		go func() {
@@ -336,6 +512,20 @@ var runCmd = &cli.Command{
 			if err := srv.Indexer.EnsureIndices(ctx); err != nil {
 				return fmt.Errorf("failed to create opensearch indices: %w", err)
 			}
+			go srv.Indexer.RunLifecycle(ctx)
+			if actorTrie != nil {
+				go func() {
+					n, err := search.LoadActorTrie(ctx, escli, cctx.String("es-profile-index"), actorTrie, countryLoader != nil)
+					if err != nil {
+						logger.Error("failed to load typeahead trie", "err", err)
+						return
+					}
+					logger.Info("loaded typeahead trie", "actors", n)
+				}()
+			}
+			if countryLoader != nil {
+				go srv.Indexer.FollowCountries(ctx, countryLoader, cctx.Duration("country-snapshots-interval"))
+			}
 			if err := srv.Indexer.RunIndexer(ctx); err != nil {
 				return fmt.Errorf("failed to run indexer: %w", err)
 			}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/cmd/relay/relay"
+	"github.com/bluesky-social/indigo/util/configschema"
+
+	"github.com/urfave/cli/v2"
+)
+
+// ResolverConfig holds identity resolution settings.
+type ResolverConfig struct {
+	PLCHost        string
+	IdentCacheSize int `config:"min=0"`
+}
+
+// FileConfig is the layout of the --config file. Values in the file take precedence over flags and environment variables.
+type FileConfig struct {
+	Service  *relay.ServiceConfig `json:"service"`
+	Relay    *relay.RelayConfig   `json:"relay"`
+	Resolver *ResolverConfig      `json:"resolver"`
+}
+
+func defaultFileConfig() FileConfig {
+	return FileConfig{
+		Service: relay.DefaultServiceConfig(),
+		Relay:   relay.DefaultRelayConfig(),
+		Resolver: &ResolverConfig{
+			PLCHost:        "https://plc.directory",
+			IdentCacheSize: 5_000_000,
+		},
+	}
+}
+
+// readConfigFile reads and fully validates a config file; its sections are loaded with configschema.LoadSection as the relay starts up
+func readConfigFile(path string) ([]byte, error) {
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fc := defaultFileConfig()
+	if err := configschema.Load(doc, &fc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+var cmdConfig = &cli.Command{
+	Name:  "config",
+	Usage: "inspect and check configuration files",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "schema",
+			Usage: "print the JSON Schema of configuration files",
+			Action: func(cctx *cli.Context) error {
+				out, err := json.MarshalIndent(configschema.For(defaultFileConfig(), "relay configuration"), "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+				return nil
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "check a configuration file, listing every problem",
+			ArgsUsage: "<file>",
+			Action: func(cctx *cli.Context) error {
+				path := cctx.Args().First()
+				if path == "" {
+					return fmt.Errorf("must specify a configuration file")
+				}
+				_, err := readConfigFile(path)
+				var errs configschema.Errors
+				if errors.As(err, &errs) {
+					lines := make([]string, 0, len(errs))
+					for _, e := range errs {
+						lines = append(lines, e.Error())
+					}
+					fmt.Fprintln(os.Stderr, strings.Join(lines, "\n"))
+					return fmt.Errorf("%s: %d problems found", path, len(errs))
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s: ok\n", path)
+				return nil
+			},
+		},
+	},
+}
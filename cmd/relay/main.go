@@ -16,11 +16,10 @@ import (
 	_ "go.uber.org/automaxprocs"
 	_ "net/http/pprof"
 
-	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/cmd/relay/relay"
-	"github.com/bluesky-social/indigo/cmd/relay/stream/eventmgr"
 	"github.com/bluesky-social/indigo/cmd/relay/stream/persist/diskpersist"
 	"github.com/bluesky-social/indigo/util/cliutil"
+	"github.com/bluesky-social/indigo/util/configschema"
 
 	"github.com/carlmjohnson/versioninfo"
 	"github.com/urfave/cli/v2"
@@ -65,6 +64,11 @@ func run(args []string) error {
 			Usage:  "run the relay daemon",
 			Action: runRelay,
 			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "config",
+					Usage:   "JSON configuration file; see 'relay config schema'. Values in the file take precedence over flags",
+					EnvVars: []string{"RELAY_CONFIG"},
+				},
 				&cli.StringFlag{
 					Name:    "db-url",
 					Usage:   "database connection string for relay database",
@@ -124,6 +128,11 @@ func run(args []string) error {
 					Usage:   "don't process public (un-authenticated) com.atproto.sync.requestCrawl",
 					EnvVars: []string{"RELAY_DISABLE_REQUEST_CRAWL"},
 				},
+				&cli.BoolFlag{
+					Name:    "gateway",
+					Usage:   "run as a read-only public gateway over a database and persist-dir replicated from another relay: no host subscriptions, requestCrawl or admin API, and firehose playback only",
+					EnvVars: []string{"RELAY_GATEWAY"},
+				},
 				&cli.BoolFlag{
 					Name:    "allow-insecure-hosts",
 					Usage:   "enables subscription to non-SSL hosts via requestCrawl",
@@ -181,6 +190,8 @@ func run(args []string) error {
 		},
 		// additional commands defined in pull.go
 		cmdPullHosts,
+		// defined in config.go
+		cmdConfig,
 	}
 	return app.Run(os.Args)
 
@@ -215,6 +226,24 @@ func runRelay(cctx *cli.Context) error {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
+	var configDoc []byte
+	if path := cctx.String("config"); path != "" {
+		doc, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		configDoc = doc
+	}
+	resolverConfig := ResolverConfig{
+		PLCHost:        cctx.String("plc-host"),
+		IdentCacheSize: cctx.Int("ident-cache-size"),
+	}
+	if configDoc != nil {
+		if err := configschema.LoadSection(configDoc, "resolver", &resolverConfig); err != nil {
+			return err
+		}
+	}
+
 	dburl := cctx.String("db-url")
 	maxConn := cctx.Int("max-db-conn")
 	logger.Info("configuring database", "url", dburl, "maxConn", maxConn)
@@ -223,27 +252,9 @@ func runRelay(cctx *cli.Context) error {
 		return err
 	}
 
-	// TODO: add shared external cache
-	baseDir := identity.BaseDirectory{
-		SkipHandleVerification: true,
-		SkipDNSDomainSuffixes:  []string{".bsky.social"},
-		TryAuthoritativeDNS:    true,
-		PLCURL:                 cctx.String("plc-host"),
-	}
-	dir := identity.NewCacheDirectory(&baseDir, cctx.Int("ident-cache-size"), time.Hour*24, time.Minute*2, time.Minute*5)
-
-	persistDir := cctx.String("persist-dir")
-	if err := os.MkdirAll(persistDir, os.ModePerm); err != nil {
-		return err
-	}
 	persitConfig := diskpersist.DefaultDiskPersistOptions()
 	persitConfig.Retention = cctx.Duration("replay-window")
 	persitConfig.InitialSeq = cctx.Int64("initial-seq-number")
-	logger.Info("setting up disk persister", "dir", persistDir, "replayWindow", persitConfig.Retention)
-	persister, err := diskpersist.NewDiskPersistence(persistDir, "", db, persitConfig)
-	if err != nil {
-		return fmt.Errorf("setting up disk persister: %w", err)
-	}
 
 	relayConfig := relay.DefaultRelayConfig()
 	relayConfig.UserAgent = fmt.Sprintf("indigo-relay/%s (atproto-relay)", versioninfo.Short())
@@ -253,9 +264,10 @@ func runRelay(cctx *cli.Context) error {
 	relayConfig.TrustedDomains = cctx.StringSlice("trusted-domains")
 	relayConfig.LenientSyncValidation = cctx.Bool("lenient-sync-validation")
 
-	svcConfig := DefaultServiceConfig()
+	svcConfig := relay.DefaultServiceConfig()
 	svcConfig.AllowInsecureHosts = cctx.Bool("allow-insecure-hosts")
 	svcConfig.DisableRequestCrawl = cctx.Bool("disable-request-crawl")
+	svcConfig.Gateway = cctx.Bool("gateway")
 	svcConfig.SiblingRelayHosts = cctx.StringSlice("sibling-relays")
 	if len(svcConfig.SiblingRelayHosts) > 0 {
 		logger.Info("sibling relay hosts configured for admin state forwarding", "servers", svcConfig.SiblingRelayHosts)
@@ -269,23 +281,33 @@ func runRelay(cctx *cli.Context) error {
 		svcConfig.AdminPasswords = []string{randPassword}
 		logger.Info("generated random admin password", "username", "admin", "password", randPassword)
 	}
-
-	evtman := eventmgr.NewEventManager(persister)
+	if configDoc != nil {
+		if err := configschema.LoadSection(configDoc, "relay", relayConfig); err != nil {
+			return err
+		}
+		if err := configschema.LoadSection(configDoc, "service", svcConfig); err != nil {
+			return err
+		}
+	}
 
 	logger.Info("constructing relay service")
-	r, err := relay.NewRelay(db, evtman, &dir, relayConfig)
-	if err != nil {
-		return err
-	}
-	svc, err := NewService(r, svcConfig)
+	daemonConfig := relay.DefaultConfig()
+	daemonConfig.Relay = relayConfig
+	daemonConfig.Service = svcConfig
+	daemonConfig.DB = db
+	daemonConfig.PLCHost = resolverConfig.PLCHost
+	daemonConfig.IdentCacheSize = resolverConfig.IdentCacheSize
+	daemonConfig.PersistDir = cctx.String("persist-dir")
+	daemonConfig.PersistOptions = persitConfig
+	daemonConfig.Bind = cctx.String("bind")
+	d, err := relay.New(daemonConfig)
 	if err != nil {
 		return err
 	}
-	persister.SetUidSource(r)
 
 	// start metrics endpoint
 	go func() {
-		if err := svc.StartMetrics(cctx.String("metrics-listen")); err != nil {
+		if err := d.Service.StartMetrics(cctx.String("metrics-listen")); err != nil {
 			logger.Error("failed to start metrics endpoint", "err", err)
 			os.Exit(1)
 		}
@@ -301,22 +323,20 @@ func runRelay(cctx *cli.Context) error {
 		}
 	}
 
-	// restart any existing subscriptions as worker goroutines
-	if err := r.ResubscribeAllHosts(ctx); err != nil {
+	if err := d.Start(ctx); err != nil {
 		return err
 	}
 
 	svcErr := make(chan error, 1)
 	go func() {
-		err := svc.StartAPI(cctx.String("bind"))
-		svcErr <- err
+		svcErr <- d.Wait()
 	}()
 
 	logger.Info("startup complete")
 	select {
 	case <-signals:
 		logger.Info("received shutdown signal")
-		errs := svc.Shutdown()
+		errs := d.Stop()
 		for err := range errs {
 			logger.Error("error during shutdown", "err", err)
 		}
@@ -325,7 +345,7 @@ func runRelay(cctx *cli.Context) error {
 			logger.Error("error during startup", "err", err)
 		}
 		logger.Info("shutting down")
-		errs := svc.Shutdown()
+		errs := d.Stop()
 		for err := range errs {
 			logger.Error("error during shutdown", "err", err)
 		}
@@ -131,7 +131,16 @@ func (r *Relay) HandleSubscribeRepos(resp http.ResponseWriter, req *http.Request
 
 	ident := realIP + "-" + req.UserAgent()
 
-	evts, cleanup, err := r.Events.Subscribe(ctx, ident, func(evt *stream.XRPCStreamEvent) bool { return true }, since)
+	var evts <-chan *stream.XRPCStreamEvent
+	var cleanup func()
+	if r.Config.ReadOnly {
+		if since == nil {
+			return fmt.Errorf("read-only relay requires a cursor")
+		}
+		evts, cleanup, err = r.Events.Replay(ctx, *since)
+	} else {
+		evts, cleanup, err = r.Events.Subscribe(ctx, ident, func(evt *stream.XRPCStreamEvent) bool { return true }, since)
+	}
 	if err != nil {
 		return err
 	}
@@ -161,6 +170,12 @@ func (r *Relay) HandleSubscribeRepos(resp http.ResponseWriter, req *http.Request
 		select {
 		case evt, ok := <-evts:
 			if !ok {
+				if r.Config.ReadOnly {
+					// replay reached the end of the persisted events; the consumer reconnects with its cursor to continue
+					logger.Info("replay complete")
+					_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay complete"), time.Now().Add(5*time.Second))
+					return nil
+				}
 				logger.Error("event stream closed unexpectedly")
 				return nil
 			}
@@ -0,0 +1,200 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/cmd/relay/stream/eventmgr"
+	"github.com/bluesky-social/indigo/cmd/relay/stream/persist"
+	"github.com/bluesky-social/indigo/cmd/relay/stream/persist/diskpersist"
+
+	"gorm.io/gorm"
+)
+
+// Config is everything needed to run a complete relay in-process; see New. Dependencies left nil get the same defaults as the relay daemon.
+type Config struct {
+	Relay   *RelayConfig
+	Service *ServiceConfig
+
+	// database for host and account state, and the disk persister's log file index. required
+	DB *gorm.DB
+
+	// identity directory; nil uses a caching directory over PLCHost
+	Dir            identity.Directory
+	PLCHost        string
+	IdentCacheSize int
+
+	// checks hosts are atproto services before subscribing to them; nil uses HTTP requests
+	HostChecker HostChecker
+
+	// output firehose event log; nil uses a disk persister in PersistDir
+	Persister      persist.EventPersistence
+	PersistDir     string
+	PersistOptions *diskpersist.DiskPersistOptions
+
+	// address to listen on for HTTP APIs (including firehose), eg ":2470"; ignored if Listener is set
+	Bind     string
+	Listener net.Listener
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Relay:          DefaultRelayConfig(),
+		Service:        DefaultServiceConfig(),
+		PLCHost:        "https://plc.directory",
+		IdentCacheSize: 5_000_000,
+		PersistDir:     "data/relay/persist",
+		PersistOptions: diskpersist.DefaultDiskPersistOptions(),
+		Bind:           ":2470",
+	}
+}
+
+// Daemon is a complete relay: ingest from upstream hosts, the output firehose, and the HTTP API including admin endpoints. Create with New, then Start, and Stop when done.
+type Daemon struct {
+	Relay   *Relay
+	Service *Service
+
+	config   Config
+	logger   *slog.Logger
+	listener net.Listener
+	serveErr chan error
+}
+
+// New sets up a relay, migrating the database, without subscribing to hosts or serving anything yet. In gateway mode (Service.Gateway), the relay and default disk persister are opened read-only.
+func New(config *Config) (*Daemon, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	cfg := *config
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("relay requires a database")
+	}
+	if cfg.Relay == nil {
+		cfg.Relay = DefaultRelayConfig()
+	}
+	if cfg.Service == nil {
+		cfg.Service = DefaultServiceConfig()
+	}
+	logger := slog.Default().With("system", "relay")
+
+	relayConfig := *cfg.Relay
+	if cfg.Service.Gateway {
+		relayConfig.ReadOnly = true
+	}
+
+	if cfg.Dir == nil {
+		// TODO: add shared external cache
+		baseDir := identity.BaseDirectory{
+			SkipHandleVerification: true,
+			SkipDNSDomainSuffixes:  []string{".bsky.social"},
+			TryAuthoritativeDNS:    true,
+			PLCURL:                 cfg.PLCHost,
+		}
+		dir := identity.NewCacheDirectory(&baseDir, cfg.IdentCacheSize, time.Hour*24, time.Minute*2, time.Minute*5)
+		cfg.Dir = &dir
+	}
+
+	var dp *diskpersist.DiskPersistence
+	if cfg.Persister == nil {
+		if err := os.MkdirAll(cfg.PersistDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		opts := diskpersist.DefaultDiskPersistOptions()
+		if cfg.PersistOptions != nil {
+			o := *cfg.PersistOptions
+			opts = &o
+		}
+		opts.ReadOnly = relayConfig.ReadOnly
+		logger.Info("setting up disk persister", "dir", cfg.PersistDir, "replayWindow", opts.Retention)
+		var err error
+		dp, err = diskpersist.NewDiskPersistence(cfg.PersistDir, "", cfg.DB, opts)
+		if err != nil {
+			return nil, fmt.Errorf("setting up disk persister: %w", err)
+		}
+		cfg.Persister = dp
+	} else {
+		dp, _ = cfg.Persister.(*diskpersist.DiskPersistence)
+	}
+
+	evtman := eventmgr.NewEventManager(cfg.Persister)
+
+	r, err := NewRelay(cfg.DB, evtman, cfg.Dir, &relayConfig)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HostChecker != nil {
+		r.HostChecker = cfg.HostChecker
+	}
+	if dp != nil {
+		dp.SetUidSource(r)
+	}
+
+	svc, err := NewService(r, cfg.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Daemon{
+		Relay:    r,
+		Service:  svc,
+		config:   cfg,
+		logger:   logger,
+		serveErr: make(chan error, 1),
+	}, nil
+}
+
+// Start restarts subscriptions to known hosts (except in gateway mode), and starts serving the HTTP API in the background. Returns once the API is listening.
+func (d *Daemon) Start(ctx context.Context) error {
+	if d.Relay.Config.ReadOnly {
+		d.logger.Info("running as read-only gateway; not subscribing to hosts")
+	} else {
+		// restart any existing subscriptions as worker goroutines
+		if err := d.Relay.ResubscribeAllHosts(ctx); err != nil {
+			return err
+		}
+	}
+
+	li := d.config.Listener
+	if li == nil {
+		var err error
+		li, err = d.Service.listen(d.config.Bind)
+		if err != nil {
+			return err
+		}
+	}
+	d.listener = li
+	e := d.Service.newAPIServer()
+	go func() {
+		d.serveErr <- d.Service.serve(e, li)
+	}()
+	return nil
+}
+
+// Addr is the address the HTTP API is listening on, once started
+func (d *Daemon) Addr() net.Addr {
+	if d.listener == nil {
+		return nil
+	}
+	return d.listener.Addr()
+}
+
+// Wait blocks until the HTTP API stops serving, returning any error other than a clean shutdown by Stop
+func (d *Daemon) Wait() error {
+	err := <-d.serveErr
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop shuts down the HTTP API, upstream subscriptions, and the event log. The database is left open, for the caller to close.
+func (d *Daemon) Stop() []error {
+	return d.Service.Shutdown()
+}
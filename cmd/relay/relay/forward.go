@@ -1,4 +1,4 @@
-package main
+package relay
 
 import (
 	"bytes"
@@ -6,8 +6,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/bluesky-social/indigo/cmd/relay/relay"
-
 	"github.com/labstack/echo/v4"
 )
 
@@ -36,7 +34,7 @@ func (s *Service) ForwardSiblingRequest(c echo.Context, body []byte) {
 	}
 
 	for _, rawHost := range s.config.SiblingRelayHosts {
-		hostname, noSSL, err := relay.ParseHostname(rawHost)
+		hostname, noSSL, err := ParseHostname(rawHost)
 		if err != nil {
 			s.logger.Error("invalid sibling hostname configured", "host", rawHost, "err", err)
 			return
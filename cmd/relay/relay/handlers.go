@@ -1,4 +1,4 @@
-package main
+package relay
 
 import (
 	"encoding/json"
@@ -9,7 +9,6 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/syntax"
-	"github.com/bluesky-social/indigo/cmd/relay/relay"
 	"github.com/bluesky-social/indigo/cmd/relay/relay/models"
 	"github.com/bluesky-social/indigo/xrpc"
 
@@ -23,7 +22,7 @@ func (s *Service) handleComAtprotoSyncRequestCrawl(c echo.Context, body *comatpr
 		return c.JSON(http.StatusForbidden, xrpc.XRPCError{ErrStr: "Forbidden", Message: "public requestCrawl not allowed on this relay"})
 	}
 
-	hostname, noSSL, err := relay.ParseHostname(body.Hostname)
+	hostname, noSSL, err := ParseHostname(body.Hostname)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: fmt.Sprintf("hostname field empty or invalid: %s", body.Hostname)})
 	}
@@ -110,7 +109,7 @@ func (s *Service) handleComAtprotoSyncGetHostStatus(c echo.Context, hostname str
 
 	host, err := s.relay.GetHost(ctx, hostname)
 	if err != nil {
-		if errors.Is(err, relay.ErrHostNotFound) {
+		if errors.Is(err, ErrHostNotFound) {
 			// TODO: test that not found DID is a 404
 			return nil, c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "HostNotFound", Message: "host not found"})
 		}
@@ -180,7 +179,7 @@ func (s *Service) handleComAtprotoSyncGetRepoStatus(c echo.Context, did syntax.D
 
 	acc, err := s.relay.GetAccount(ctx, did)
 	if err != nil {
-		if errors.Is(err, relay.ErrAccountNotFound) {
+		if errors.Is(err, ErrAccountNotFound) {
 			// TODO: test that not found DID is a 404
 			return nil, c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "RepoNotFound", Message: "account not found"})
 		}
@@ -194,7 +193,7 @@ func (s *Service) handleComAtprotoSyncGetRepoStatus(c echo.Context, did syntax.D
 	}
 
 	repo, err := s.relay.GetAccountRepo(ctx, acc.UID)
-	if err != nil && !errors.Is(err, relay.ErrAccountRepoNotFound) {
+	if err != nil && !errors.Is(err, ErrAccountRepoNotFound) {
 		return nil, err
 	}
 
@@ -208,7 +207,7 @@ func (s *Service) handleComAtprotoSyncGetLatestCommit(c echo.Context, did syntax
 
 	acc, err := s.relay.GetAccount(ctx, did)
 	if err != nil {
-		if errors.Is(err, relay.ErrAccountNotFound) {
+		if errors.Is(err, ErrAccountNotFound) {
 			// TODO: test that not found DID is a 404
 			return nil, c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "RepoNotFound", Message: "account not found"})
 		}
@@ -230,7 +229,7 @@ func (s *Service) handleComAtprotoSyncGetLatestCommit(c echo.Context, did syntax
 
 	repo, err := s.relay.GetAccountRepo(ctx, acc.UID)
 	if err != nil {
-		if errors.Is(err, relay.ErrAccountRepoNotFound) {
+		if errors.Is(err, ErrAccountRepoNotFound) {
 			return nil, c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "RepoNotSynchronized", Message: "do not know current repo state for account"})
 		}
 		return nil, err
@@ -257,6 +256,14 @@ func (svc *Service) HandleHealthCheck(c echo.Context) error {
 	}
 }
 
+func (svc *Service) HandleStats(c echo.Context) error {
+	stats, err := svc.relay.Stats(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, xrpc.XRPCError{ErrStr: "DatabaseError", Message: "failed to count hosts"})
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
 var homeMessage string = `
 .########..########.##..........###....##....##
 .##.....##.##.......##.........##.##....##..##.
@@ -1,4 +1,4 @@
-package main
+package relay
 
 import (
 	"encoding/json"
@@ -11,7 +11,6 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/syntax"
-	"github.com/bluesky-social/indigo/cmd/relay/relay"
 	"github.com/bluesky-social/indigo/cmd/relay/relay/models"
 
 	"github.com/labstack/echo/v4"
@@ -86,7 +85,7 @@ func (s *Service) handleAdminTakeDownRepo(c echo.Context) error {
 	}
 
 	if err := s.relay.UpdateAccountLocalStatus(ctx, did, models.AccountStatusTakendown, true); err != nil {
-		if errors.Is(err, relay.ErrAccountNotFound) {
+		if errors.Is(err, ErrAccountNotFound) {
 			return &echo.HTTPError{
 				Code:    http.StatusNotFound,
 				Message: "account not found",
@@ -130,7 +129,7 @@ func (s *Service) handleAdminReverseTakedown(c echo.Context) error {
 	}
 
 	if err := s.relay.UpdateAccountLocalStatus(ctx, did, models.AccountStatusActive, true); err != nil {
-		if errors.Is(err, relay.ErrAccountNotFound) {
+		if errors.Is(err, ErrAccountNotFound) {
 			return &echo.HTTPError{
 				Code:    http.StatusNotFound,
 				Message: "repo not found",
@@ -280,7 +279,7 @@ func (s *Service) handleListHosts(c echo.Context) error {
 
 		// pull event counter metrics from prometheus
 		var m = &dto.Metric{}
-		if err := relay.EventsReceivedCounter.WithLabelValues(host.Hostname).Write(m); err != nil {
+		if err := EventsReceivedCounter.WithLabelValues(host.Hostname).Write(m); err != nil {
 			hostInfos[i].EventsSeenSinceStartup = 0
 			continue
 		}
@@ -298,7 +297,7 @@ func (s *Service) handleAdminKillUpstreamConn(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	queryHost := strings.TrimSpace(c.QueryParam("host"))
-	hostname, _, err := relay.ParseHostname(queryHost)
+	hostname, _, err := ParseHostname(queryHost)
 	if err != nil {
 		return &echo.HTTPError{
 			Code:    http.StatusBadRequest,
@@ -310,7 +309,7 @@ func (s *Service) handleAdminKillUpstreamConn(c echo.Context) error {
 
 	// TODO: move this method to relay (for updating the database)
 	if err := s.relay.Slurper.KillUpstreamConnection(ctx, hostname, banHost); err != nil {
-		if errors.Is(err, relay.ErrHostInactive) {
+		if errors.Is(err, ErrHostInactive) {
 			return &echo.HTTPError{
 				Code:    http.StatusBadRequest,
 				Message: "no active connection to given host",
@@ -331,7 +330,7 @@ func (s *Service) handleBlockHost(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	queryHost := strings.TrimSpace(c.QueryParam("host"))
-	hostname, _, err := relay.ParseHostname(queryHost)
+	hostname, _, err := ParseHostname(queryHost)
 	if err != nil {
 		return &echo.HTTPError{
 			Code:    http.StatusBadRequest,
@@ -365,7 +364,7 @@ func (s *Service) handleUnblockHost(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	queryHost := strings.TrimSpace(c.QueryParam("host"))
-	hostname, _, err := relay.ParseHostname(queryHost)
+	hostname, _, err := ParseHostname(queryHost)
 	if err != nil {
 		return &echo.HTTPError{
 			Code:    http.StatusBadRequest,
@@ -482,7 +481,7 @@ func (s *Service) handleAdminChangeHostRateLimits(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
 	}
 
-	hostname, _, err := relay.ParseHostname(body.Hostname)
+	hostname, _, err := ParseHostname(body.Hostname)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid hostname: %s", err))
 	}
@@ -39,15 +39,18 @@ type Relay struct {
 
 type RelayConfig struct {
 	UserAgent             string
-	DefaultRepoLimit      int64
-	TrustedRepoLimit      int64
-	ConcurrencyPerHost    int
+	DefaultRepoLimit      int64 `config:"min=0"`
+	TrustedRepoLimit      int64 `config:"min=0"`
+	ConcurrencyPerHost    int   `config:"min=1"`
 	LenientSyncValidation bool
 	TrustedDomains        []string
-	HostPerDayLimit       int64
+	HostPerDayLimit       int64 `config:"min=0"`
 
 	// If true, skip validation that messages for a given account (DID) are coming from the expected upstream host (PDS). Currently only used in tests; might be used for intermediate relays in the future.
 	SkipAccountHostCheck bool
+
+	// If true, the relay runs as a read-only gateway over a database and event log replicated from another relay: it doesn't migrate the database, and firehose consumers get playback of persisted events only. Set by New from ServiceConfig.Gateway.
+	ReadOnly bool `config:"-"`
 }
 
 func DefaultRelayConfig() *RelayConfig {
@@ -89,8 +92,10 @@ func NewRelay(db *gorm.DB, evtman *eventmgr.EventManager, dir identity.Directory
 		HostPerDayLimiter: perDayLimiter(config.HostPerDayLimit),
 	}
 
-	if err := r.MigrateDatabase(); err != nil {
-		return nil, err
+	if !config.ReadOnly {
+		if err := r.MigrateDatabase(); err != nil {
+			return nil, err
+		}
 	}
 
 	slurpConfig := DefaultSlurperConfig()
@@ -129,3 +134,26 @@ func (r *Relay) MigrateDatabase() error {
 func (r *Relay) Healthcheck(ctx context.Context) error {
 	return r.db.WithContext(ctx).Exec("SELECT 1").Error
 }
+
+type Stats struct {
+	// hosts currently subscribed to (status active)
+	Hosts int64 `json:"hosts"`
+	// sum of account counts across all hosts
+	Accounts  int64 `json:"accounts"`
+	Consumers int   `json:"consumers"`
+}
+
+// aggregate counts suitable for public display
+func (r *Relay) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := r.db.WithContext(ctx).Model(&models.Host{}).Where("status = ?", models.HostStatusActive).Count(&stats.Hosts).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).Model(&models.Host{}).Select("COALESCE(SUM(account_count), 0)").Scan(&stats.Accounts).Error; err != nil {
+		return nil, err
+	}
+	r.consumersLk.RLock()
+	stats.Consumers = len(r.consumers)
+	r.consumersLk.RUnlock()
+	return &stats, nil
+}
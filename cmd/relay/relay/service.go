@@ -1,4 +1,4 @@
-package main
+package relay
 
 import (
 	"context"
@@ -8,9 +8,9 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/bluesky-social/indigo/cmd/relay/relay"
 	"github.com/bluesky-social/indigo/util/svcutil"
 
 	"github.com/labstack/echo/v4"
@@ -20,10 +20,14 @@ import (
 
 type Service struct {
 	logger *slog.Logger
-	relay  *relay.Relay
+	relay  *Relay
 	config ServiceConfig
 
 	siblingClient http.Client
+
+	// HTTP server, once started; kept for shutdown
+	echoLk sync.Mutex
+	echo   *echo.Echo
 }
 
 type ServiceConfig struct {
@@ -41,6 +45,9 @@ type ServiceConfig struct {
 
 	// if true, allows non-SSL hosts to be added via public requestCrawl
 	AllowInsecureHosts bool
+
+	// if true, serve only public read endpoints: no requestCrawl, admin API or dashboard. firehose consumers must supply a cursor, and get playback only
+	Gateway bool
 }
 
 func DefaultServiceConfig() *ServiceConfig {
@@ -49,7 +56,7 @@ func DefaultServiceConfig() *ServiceConfig {
 	}
 }
 
-func NewService(r *relay.Relay, config *ServiceConfig) (*Service, error) {
+func NewService(r *Relay, config *ServiceConfig) (*Service, error) {
 
 	if config == nil {
 		config = DefaultServiceConfig()
@@ -73,19 +80,32 @@ func (svc *Service) StartMetrics(listen string) error {
 }
 
 func (svc *Service) StartAPI(bind string) error {
+	li, err := svc.listen(bind)
+	if err != nil {
+		return err
+	}
+	return svc.StartWithListener(li)
+}
+
+func (svc *Service) listen(bind string) (net.Listener, error) {
 	var lc net.ListenConfig
 	ctx, cancel := context.WithTimeout(context.Background(), svc.config.ListenerBootTimeout)
 	defer cancel()
 
-	li, err := lc.Listen(ctx, "tcp", bind)
-	if err != nil {
-		return err
-	}
-	return svc.startWithListener(li)
+	return lc.Listen(ctx, "tcp", bind)
+}
+
+// StartWithListener serves the HTTP API (including firehose) on an existing listener, until the service is shut down
+func (svc *Service) StartWithListener(listen net.Listener) error {
+	return svc.serve(svc.newAPIServer(), listen)
 }
 
-func (svc *Service) startWithListener(listen net.Listener) error {
+// newAPIServer sets up the HTTP API, and keeps it for shutdown
+func (svc *Service) newAPIServer() *echo.Echo {
 	e := echo.New()
+	svc.echoLk.Lock()
+	svc.echo = e
+	svc.echoLk.Unlock()
 	e.HideBanner = true
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -100,11 +120,13 @@ func (svc *Service) startWithListener(listen net.Listener) error {
 	})
 	e.Use(middleware.LoggerWithConfig(middleware.DefaultLoggerConfig))
 
-	// React uses a virtual router, so we need to serve the index.html for all
-	// routes that aren't otherwise handled or in the /assets directory.
-	e.File("/dash", "public/index.html")
-	e.File("/dash/*", "public/index.html")
-	e.Static("/assets", "public/assets")
+	if !svc.config.Gateway {
+		// React uses a virtual router, so we need to serve the index.html for all
+		// routes that aren't otherwise handled or in the /assets directory.
+		e.File("/dash", "public/index.html")
+		e.File("/dash/*", "public/index.html")
+		e.Static("/assets", "public/assets")
+	}
 
 	e.Use(svcutil.MetricsMiddleware)
 
@@ -145,15 +167,24 @@ func (svc *Service) startWithListener(listen net.Listener) error {
 	e.GET("/_health", svc.HandleHealthCheck)
 	e.GET("/xrpc/_health", svc.HandleHealthCheck)
 
+	e.GET("/_stats", svc.HandleStats)
+
 	e.GET("/xrpc/com.atproto.sync.subscribeRepos", svc.HandleComAtprotoSyncSubscribeRepos)
-	e.POST("/xrpc/com.atproto.sync.requestCrawl", svc.HandleComAtprotoSyncRequestCrawl)
 	e.GET("/xrpc/com.atproto.sync.listHosts", svc.HandleComAtprotoSyncListHosts)
 	e.GET("/xrpc/com.atproto.sync.getHostStatus", svc.HandleComAtprotoSyncGetHostStatus)
 	e.GET("/xrpc/com.atproto.sync.listRepos", svc.HandleComAtprotoSyncListRepos)
-	e.GET("/xrpc/com.atproto.sync.getRepo", svc.HandleComAtprotoSyncGetRepo) // just returns 3xx redirect to source PDS
+	e.GET("/xrpc/com.atproto.sync.getRepo", svc.HandleComAtprotoSyncGetRepo)     // just returns 3xx redirect to source PDS
+	e.GET("/xrpc/com.atproto.sync.getRecord", svc.HandleComAtprotoSyncGetRecord) // just returns 3xx redirect to source PDS
 	e.GET("/xrpc/com.atproto.sync.getRepoStatus", svc.HandleComAtprotoSyncGetRepoStatus)
 	e.GET("/xrpc/com.atproto.sync.getLatestCommit", svc.HandleComAtprotoSyncGetLatestCommit)
 
+	if svc.config.Gateway {
+		// read endpoints only; the rest is left to the relay this gateway replicates from
+		return e
+	}
+
+	e.POST("/xrpc/com.atproto.sync.requestCrawl", svc.HandleComAtprotoSyncRequestCrawl)
+
 	admin := e.Group("/admin", svc.checkAdminAuth)
 
 	// Slurper-related Admin API
@@ -185,17 +216,31 @@ func (svc *Service) startWithListener(listen net.Listener) error {
 	// Consumer-related Admin API
 	admin.GET("/consumers/list", svc.handleAdminListConsumers)
 
-	// In order to support booting on random ports in tests, we need to tell the
-	// Echo instance it's already got a port, and then use its StartServer
-	// method to re-use that listener.
+	return e
+}
+
+// In order to support booting on random ports in tests, we need to tell the
+// Echo instance it's already got a port, and then use its StartServer
+// method to re-use that listener. Serving with the Echo instance's own server
+// lets Shutdown stop it.
+func (svc *Service) serve(e *echo.Echo, listen net.Listener) error {
 	e.Listener = listen
-	srv := &http.Server{}
-	// TODO: attach echo to Service, for shutdown?
-	return e.StartServer(srv)
+	return e.StartServer(e.Server)
 }
 
 func (svc *Service) Shutdown() []error {
 	var errs []error
+	svc.echoLk.Lock()
+	e := svc.echo
+	svc.echoLk.Unlock()
+	if e != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := e.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+
 	if err := svc.relay.Slurper.Shutdown(); err != nil {
 		errs = append(errs, err)
 	}
@@ -1,4 +1,4 @@
-package main
+package relay
 
 import (
 	"fmt"
@@ -7,7 +7,6 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/syntax"
-	"github.com/bluesky-social/indigo/cmd/relay/relay"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	"github.com/labstack/echo/v4"
@@ -26,6 +25,9 @@ func (s *Service) HandleComAtprotoSyncSubscribeRepos(c echo.Context) error {
 		}
 		cursor = &cval
 	}
+	if cursor == nil && s.config.Gateway {
+		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: "this relay gateway only replays persisted events; cursor parameter is required"})
+	}
 
 	// pass off HTTP connection to the WebSocket handler
 	return s.relay.HandleSubscribeRepos(c.Response(), c.Request(), cursor, c.RealIP())
@@ -126,7 +128,7 @@ func (s *Service) HandleComAtprotoSyncListRepos(c echo.Context) error {
 //
 // NOTE: currently does not check account status locally; a takendown account will still redirect. this saves a database lookup.
 func (s *Service) HandleComAtprotoSyncGetRepo(c echo.Context) error {
-	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoSyncGetRepo")
+	_, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoSyncGetRepo")
 	defer span.End()
 
 	didQuery := c.QueryParam("did")
@@ -136,12 +138,36 @@ func (s *Service) HandleComAtprotoSyncGetRepo(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: fmt.Sprintf("missing or invalid DID parameter: %s", err)})
 	}
 
-	ident, err := s.relay.Dir.LookupDID(ctx, did)
+	return s.redirectToPDS(c, did)
+}
+
+// does a simple HTTP redirect to getRecord on the account's PDS. see HandleComAtprotoSyncGetRepo
+func (s *Service) HandleComAtprotoSyncGetRecord(c echo.Context) error {
+	_, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoSyncGetRecord")
+	defer span.End()
+
+	did, err := syntax.ParseDID(c.QueryParam("did"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: fmt.Sprintf("missing or invalid DID parameter: %s", err)})
+	}
+	if _, err := syntax.ParseNSID(c.QueryParam("collection")); err != nil {
+		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: fmt.Sprintf("missing or invalid collection parameter: %s", err)})
+	}
+	if _, err := syntax.ParseRecordKey(c.QueryParam("rkey")); err != nil {
+		return c.JSON(http.StatusBadRequest, xrpc.XRPCError{ErrStr: "BadRequest", Message: fmt.Sprintf("missing or invalid rkey parameter: %s", err)})
+	}
+
+	return s.redirectToPDS(c, did)
+}
+
+// redirects the request, path and query unchanged, to the account's PDS
+func (s *Service) redirectToPDS(c echo.Context, did syntax.DID) error {
+	ident, err := s.relay.Dir.LookupDID(c.Request().Context(), did)
 	if err != nil {
 		// TODO: could handle lookup errors more granularly
 		return c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "RepoNotFound", Message: fmt.Sprintf("could not resolve DID: %s", err)})
 	}
-	pdsHost, _, err := relay.ParseHostname(ident.PDSEndpoint())
+	pdsHost, _, err := ParseHostname(ident.PDSEndpoint())
 	if err != nil {
 		return c.JSON(http.StatusNotFound, xrpc.XRPCError{ErrStr: "RepoNotFound", Message: "DID document has no valid atproto PDS endpoint"})
 	}
@@ -217,6 +217,35 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 	return out, sub.cleanup, nil
 }
 
+// Replay plays back persisted events after since, without switching over to the live stream; the returned channel is closed once playback reaches the end of the persisted events. Used where there is no live stream, such as on read-only gateways.
+func (em *EventManager) Replay(ctx context.Context, since int64) (<-chan *stream.XRPCStreamEvent, func(), error) {
+	done := make(chan struct{})
+	cleanup := sync.OnceFunc(func() {
+		close(done)
+	})
+
+	out := make(chan *stream.XRPCStreamEvent, em.crossoverBufferSize)
+	go func() {
+		defer close(out)
+		if err := em.persister.Playback(ctx, since, func(e *stream.XRPCStreamEvent) error {
+			select {
+			case <-done:
+				return ErrPlaybackShutdown
+			case out <- e:
+				return nil
+			}
+		}); err != nil {
+			if errors.Is(err, ErrPlaybackShutdown) {
+				em.log.Warn("events replay", "err", err)
+			} else {
+				em.log.Error("events replay", "err", err)
+			}
+		}
+	}()
+
+	return out, cleanup, nil
+}
+
 func (em *EventManager) rmSubscriber(sub *Subscriber) {
 	em.subsLk.Lock()
 	defer em.subsLk.Unlock()
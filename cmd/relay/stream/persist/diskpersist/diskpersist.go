@@ -41,6 +41,8 @@ type DiskPersistence struct {
 	curSeq       int64
 	initialSeq   int64
 
+	readOnly bool
+
 	uids     UidSource
 	uidCache *arc.ARCCache[uint64, string]
 	didCache *arc.ARCCache[string, uint64]
@@ -82,6 +84,9 @@ type DiskPersistOptions struct {
 	// starting sequence number to use (if there is no existing persisted data)
 	InitialSeq int64
 
+	// open existing log files (eg, replicated from another relay) for playback only: don't migrate the database, write or garbage collect log files
+	ReadOnly bool
+
 	Logger *slog.Logger
 }
 
@@ -115,8 +120,10 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		return nil, fmt.Errorf("failed to create did cache: %w", err)
 	}
 
-	if err := db.AutoMigrate(&LogFileRef{}); err != nil {
-		return nil, fmt.Errorf("failed to set up database: %w", err)
+	if !opts.ReadOnly {
+		if err := db.AutoMigrate(&LogFileRef{}); err != nil {
+			return nil, fmt.Errorf("failed to set up database: %w", err)
+		}
 	}
 
 	bufpool := &sync.Pool{
@@ -151,11 +158,16 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		shutdown:        make(chan struct{}),
 		log:             opts.Logger,
 		initialSeq:      opts.InitialSeq,
+		readOnly:        opts.ReadOnly,
 	}
 	if dp.log == nil {
 		dp.log = slog.Default().With("system", "diskpersist")
 	}
 
+	if dp.readOnly {
+		return dp, nil
+	}
+
 	if err := dp.resumeLog(); err != nil {
 		return nil, err
 	}
@@ -167,6 +179,9 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 	return dp, nil
 }
 
+// ErrReadOnly is returned for writes to a persister opened with ReadOnly
+var ErrReadOnly = errors.New("disk persister is read-only")
+
 type LogFileRef struct {
 	gorm.Model
 	Path     string
@@ -519,6 +534,10 @@ func (dp *DiskPersistence) doPersist(ctx context.Context, pjob persistJob) error
 // Persist implements persist.EventPersistence
 // Persist may mutate contents of xevt and what it points to
 func (dp *DiskPersistence) Persist(ctx context.Context, xevt *stream.XRPCStreamEvent) error {
+	if dp.readOnly {
+		return ErrReadOnly
+	}
+
 	buffer := dp.buffers.Get().(*bytes.Buffer)
 	cw := dp.writers.Get().(*cbg.CborWriter)
 	defer dp.writers.Put(cw)
@@ -828,6 +847,10 @@ type UserAction struct {
 }
 
 func (dp *DiskPersistence) TakeDownRepo(ctx context.Context, uid uint64) error {
+	if dp.readOnly {
+		return ErrReadOnly
+	}
+
 	/*
 		if err := p.meta.Create(&UserAction{
 			Usr:      uid,
@@ -960,6 +983,9 @@ func (dp *DiskPersistence) Flush(ctx context.Context) error {
 
 func (dp *DiskPersistence) Shutdown(ctx context.Context) error {
 	close(dp.shutdown)
+	if dp.readOnly {
+		return nil
+	}
 	if err := dp.Flush(ctx); err != nil {
 		return err
 	}
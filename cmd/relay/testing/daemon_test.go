@@ -0,0 +1,81 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/cmd/relay/relay"
+	"github.com/bluesky-social/indigo/util/cliutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runs a complete relay in-process, then stops it
+func TestDaemonLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tmpd := t.TempDir()
+
+	db, err := cliutil.SetupDatabase("sqlite://"+filepath.Join(tmpd, "relay.sqlite"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := identity.NewMockDirectory()
+
+	config := relay.DefaultConfig()
+	config.DB = db
+	config.Dir = &dir
+	config.PersistDir = filepath.Join(tmpd, "persist")
+	config.Bind = "localhost:0"
+	config.Service.AdminPasswords = []string{"test"}
+	d, err := relay.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	base := fmt.Sprintf("http://%s", d.Addr())
+
+	resp, err := http.Get(base + "/xrpc/_health")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get(base + "/_stats")
+	if !assert.NoError(err) {
+		return
+	}
+	var stats relay.Stats
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+	resp.Body.Close()
+	assert.Equal(int64(0), stats.Hosts)
+
+	// admin API requires the password
+	resp, err = http.Get(base + "/admin/pds/list")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+	req, _ := http.NewRequest(http.MethodGet, base+"/admin/pds/list", nil)
+	req.SetBasicAuth("admin", "test")
+	resp, err = http.DefaultClient.Do(req)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Empty(d.Stop())
+	assert.NoError(d.Wait())
+	_, err = http.Get(base + "/xrpc/_health")
+	assert.Error(err)
+}
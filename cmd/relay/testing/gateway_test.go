@@ -0,0 +1,85 @@
+package testing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/cmd/relay/stream"
+	"github.com/bluesky-social/indigo/cmd/relay/stream/eventmgr"
+	"github.com/bluesky-social/indigo/cmd/relay/stream/persist/diskpersist"
+	"github.com/bluesky-social/indigo/util/cliutil"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedUids struct{}
+
+func (fixedUids) DidToUid(ctx context.Context, did string) (uint64, error) {
+	return 1, nil
+}
+
+// a read-only persister plays back events written by another, and refuses writes
+func TestGatewayReplay(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	tmpd := t.TempDir()
+	dburl := "sqlite://" + filepath.Join(tmpd, "relay.sqlite")
+
+	db, err := cliutil.SetupDatabase(dburl, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persister, err := diskpersist.NewDiskPersistence(tmpd, "", db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persister.SetUidSource(fixedUids{})
+	evtman := eventmgr.NewEventManager(persister)
+	for i := 0; i < 5; i++ {
+		assert.NoError(evtman.AddEvent(ctx, &stream.XRPCStreamEvent{
+			RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{
+				Did:  "did:web:example.atbin.dev",
+				Time: syntax.DatetimeNow().String(),
+			},
+		}))
+	}
+	assert.NoError(persister.Flush(ctx))
+
+	rodb, err := cliutil.SetupDatabase(dburl, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := diskpersist.DefaultDiskPersistOptions()
+	opts.ReadOnly = true
+	ro, err := diskpersist.NewDiskPersistence(tmpd, "", rodb, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro.SetUidSource(fixedUids{})
+	roman := eventmgr.NewEventManager(ro)
+
+	replay := func(since int64) []int64 {
+		evts, cleanup, err := roman.Replay(ctx, since)
+		assert.NoError(err)
+		defer cleanup()
+		var seqs []int64
+		for evt := range evts {
+			seqs = append(seqs, evt.RepoIdentity.Seq)
+		}
+		return seqs
+	}
+	assert.Equal([]int64{1, 2, 3, 4, 5}, replay(0))
+	assert.Equal([]int64{4, 5}, replay(3))
+	assert.Empty(replay(5))
+
+	assert.ErrorIs(ro.Persist(ctx, &stream.XRPCStreamEvent{
+		RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:web:example.atbin.dev"},
+	}), diskpersist.ErrReadOnly)
+	assert.Equal([]int64{1, 2, 3, 4, 5}, replay(0))
+
+	assert.NoError(ro.Shutdown(ctx))
+	assert.NoError(persister.Shutdown(ctx))
+}
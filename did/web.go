@@ -19,12 +19,19 @@ type WebResolver struct {
 	Insecure bool
 	// TODO: cache? maybe at a different layer
 
+	// fetches DID documents; nil uses a client with a 5s timeout
+	Client *http.Client
+
 	client http.Client
 }
 
 func (wr *WebResolver) GetDocument(ctx context.Context, didstr string) (*Document, error) {
-	if wr.client.Timeout == 0 {
-		wr.client.Timeout = webDidDefaultTimeout
+	client := wr.Client
+	if client == nil {
+		if wr.client.Timeout == 0 {
+			wr.client.Timeout = webDidDefaultTimeout
+		}
+		client = &wr.client
 	}
 	ctx, span := otel.Tracer("did").Start(ctx, "didWebGetDocument")
 	defer span.End()
@@ -44,7 +51,7 @@ func (wr *WebResolver) GetDocument(ctx context.Context, didstr string) (*Documen
 		proto = "http"
 	}
 
-	resp, err := wr.client.Get(proto + "://" + val + "/.well-known/did.json")
+	resp, err := client.Get(proto + "://" + val + "/.well-known/did.json")
 	if err != nil {
 		return nil, err
 	}
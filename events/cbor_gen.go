@@ -25,12 +25,20 @@ func (t *EventHeader) MarshalCBOR(w io.Writer) error {
 	}
 
 	cw := cbg.NewCborWriter(w)
-	fieldCount := 2
+	fieldCount := 4
 
 	if t.MsgType == "" {
 		fieldCount--
 	}
 
+	if t.Meta == nil {
+		fieldCount--
+	}
+
+	if t.Resume == "" {
+		fieldCount--
+	}
+
 	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
 		return err
 	}
@@ -83,6 +91,50 @@ func (t *EventHeader) MarshalCBOR(w io.Writer) error {
 		}
 	}
 
+	// t.Meta (events.FrameMeta) (struct)
+	if t.Meta != nil {
+
+		if len("meta") > 1000000 {
+			return xerrors.Errorf("Value in field \"meta\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("meta"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("meta")); err != nil {
+			return err
+		}
+
+		if err := t.Meta.MarshalCBOR(cw); err != nil {
+			return err
+		}
+	}
+
+	// t.Resume (string) (string)
+	if t.Resume != "" {
+
+		if len("resume") > 1000000 {
+			return xerrors.Errorf("Value in field \"resume\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("resume"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("resume")); err != nil {
+			return err
+		}
+
+		if len(t.Resume) > 1000000 {
+			return xerrors.Errorf("Value in field t.Resume was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Resume))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string(t.Resume)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -111,7 +163,7 @@ func (t *EventHeader) UnmarshalCBOR(r io.Reader) (err error) {
 
 	n := extra
 
-	nameBuf := make([]byte, 2)
+	nameBuf := make([]byte, 6)
 	for i := uint64(0); i < n; i++ {
 		nameLen, ok, err := cbg.ReadFullStringIntoBuf(cr, nameBuf, 1000000)
 		if err != nil {
@@ -164,6 +216,37 @@ func (t *EventHeader) UnmarshalCBOR(r io.Reader) (err error) {
 
 				t.Op = int64(extraI)
 			}
+			// t.Meta (events.FrameMeta) (struct)
+		case "meta":
+
+			{
+
+				b, err := cr.ReadByte()
+				if err != nil {
+					return err
+				}
+				if b != cbg.CborNull[0] {
+					if err := cr.UnreadByte(); err != nil {
+						return err
+					}
+					t.Meta = new(FrameMeta)
+					if err := t.Meta.UnmarshalCBOR(cr); err != nil {
+						return xerrors.Errorf("unmarshaling t.Meta pointer: %w", err)
+					}
+				}
+
+			}
+			// t.Resume (string) (string)
+		case "resume":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Resume = string(sval)
+			}
 
 		default:
 			// Field doesn't exist on this type, so ignore it
@@ -309,3 +392,1129 @@ func (t *ErrorFrame) UnmarshalCBOR(r io.Reader) (err error) {
 
 	return nil
 }
+func (t *FrameMeta) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+	fieldCount := 8
+
+	if t.Modified == nil {
+		fieldCount--
+	}
+
+	if t.Annotations == nil {
+		fieldCount--
+	}
+
+	if t.Region == "" {
+		fieldCount--
+	}
+
+	if t.RegionBasis == "" {
+		fieldCount--
+	}
+
+	if t.Sig == nil {
+		fieldCount--
+	}
+
+	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
+		return err
+	}
+
+	// t.Seq (int64) (int64)
+	if len("seq") > 1000000 {
+		return xerrors.Errorf("Value in field \"seq\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("seq"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("seq")); err != nil {
+		return err
+	}
+
+	if t.Seq >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Seq)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.Seq-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Sig ([]uint8) (slice)
+	if t.Sig != nil {
+
+		if len("sig") > 1000000 {
+			return xerrors.Errorf("Value in field \"sig\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("sig"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("sig")); err != nil {
+			return err
+		}
+
+		if len(t.Sig) > 2097152 {
+			return xerrors.Errorf("Byte array in field t.Sig was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajByteString, uint64(len(t.Sig))); err != nil {
+			return err
+		}
+
+		if _, err := cw.Write(t.Sig); err != nil {
+			return err
+		}
+
+	}
+
+	// t.Repo (string) (string)
+	if len("repo") > 1000000 {
+		return xerrors.Errorf("Value in field \"repo\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("repo"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("repo")); err != nil {
+		return err
+	}
+
+	if len(t.Repo) > 1000000 {
+		return xerrors.Errorf("Value in field t.Repo was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Repo))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Repo)); err != nil {
+		return err
+	}
+
+	// t.Region (string) (string)
+	if t.Region != "" {
+
+		if len("region") > 1000000 {
+			return xerrors.Errorf("Value in field \"region\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("region"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("region")); err != nil {
+			return err
+		}
+
+		if len(t.Region) > 1000000 {
+			return xerrors.Errorf("Value in field t.Region was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Region))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string(t.Region)); err != nil {
+			return err
+		}
+	}
+
+	// t.Signer (string) (string)
+	if len("signer") > 1000000 {
+		return xerrors.Errorf("Value in field \"signer\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("signer"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("signer")); err != nil {
+		return err
+	}
+
+	if len(t.Signer) > 1000000 {
+		return xerrors.Errorf("Value in field t.Signer was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Signer))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Signer)); err != nil {
+		return err
+	}
+
+	// t.Modified ([]events.ModifiedOp) (slice)
+	if t.Modified != nil {
+
+		if len("modified") > 1000000 {
+			return xerrors.Errorf("Value in field \"modified\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("modified"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("modified")); err != nil {
+			return err
+		}
+
+		if len(t.Modified) > 8192 {
+			return xerrors.Errorf("Slice value in field t.Modified was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Modified))); err != nil {
+			return err
+		}
+		for _, v := range t.Modified {
+			if err := v.MarshalCBOR(cw); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	// t.Annotations ([]events.OpAnnotation) (slice)
+	if t.Annotations != nil {
+
+		if len("annotations") > 1000000 {
+			return xerrors.Errorf("Value in field \"annotations\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("annotations"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("annotations")); err != nil {
+			return err
+		}
+
+		if len(t.Annotations) > 8192 {
+			return xerrors.Errorf("Slice value in field t.Annotations was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Annotations))); err != nil {
+			return err
+		}
+		for _, v := range t.Annotations {
+			if err := v.MarshalCBOR(cw); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	// t.RegionBasis (string) (string)
+	if t.RegionBasis != "" {
+
+		if len("regionBasis") > 1000000 {
+			return xerrors.Errorf("Value in field \"regionBasis\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("regionBasis"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("regionBasis")); err != nil {
+			return err
+		}
+
+		if len(t.RegionBasis) > 1000000 {
+			return xerrors.Errorf("Value in field t.RegionBasis was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.RegionBasis))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string(t.RegionBasis)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *FrameMeta) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = FrameMeta{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("FrameMeta: map struct too large (%d)", extra)
+	}
+
+	n := extra
+
+	nameBuf := make([]byte, 11)
+	for i := uint64(0); i < n; i++ {
+		nameLen, ok, err := cbg.ReadFullStringIntoBuf(cr, nameBuf, 1000000)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(cr, func(cid.Cid) {}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch string(nameBuf[:nameLen]) {
+		// t.Seq (int64) (int64)
+		case "seq":
+			{
+				maj, extra, err := cr.ReadHeader()
+				if err != nil {
+					return err
+				}
+				var extraI int64
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Seq = int64(extraI)
+			}
+			// t.Sig ([]uint8) (slice)
+		case "sig":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 2097152 {
+				return fmt.Errorf("t.Sig: byte array too large (%d)", extra)
+			}
+			if maj != cbg.MajByteString {
+				return fmt.Errorf("expected byte array")
+			}
+
+			if extra > 0 {
+				t.Sig = make([]uint8, extra)
+			}
+
+			if _, err := io.ReadFull(cr, t.Sig); err != nil {
+				return err
+			}
+
+			// t.Repo (string) (string)
+		case "repo":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Repo = string(sval)
+			}
+			// t.Region (string) (string)
+		case "region":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Region = string(sval)
+			}
+			// t.Signer (string) (string)
+		case "signer":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Signer = string(sval)
+			}
+			// t.Modified ([]events.ModifiedOp) (slice)
+		case "modified":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Modified: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Modified = make([]ModifiedOp, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+
+						if err := t.Modified[i].UnmarshalCBOR(cr); err != nil {
+							return xerrors.Errorf("unmarshaling t.Modified[i]: %w", err)
+						}
+
+					}
+
+				}
+			}
+			// t.Annotations ([]events.OpAnnotation) (slice)
+		case "annotations":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Annotations: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Annotations = make([]OpAnnotation, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+
+						if err := t.Annotations[i].UnmarshalCBOR(cr); err != nil {
+							return xerrors.Errorf("unmarshaling t.Annotations[i]: %w", err)
+						}
+
+					}
+
+				}
+			}
+			// t.RegionBasis (string) (string)
+		case "regionBasis":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.RegionBasis = string(sval)
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(r, func(cid.Cid) {}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+func (t *ModifiedOp) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{164}); err != nil {
+		return err
+	}
+
+	// t.Cid (string) (string)
+	if len("cid") > 1000000 {
+		return xerrors.Errorf("Value in field \"cid\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("cid"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("cid")); err != nil {
+		return err
+	}
+
+	if len(t.Cid) > 1000000 {
+		return xerrors.Errorf("Value in field t.Cid was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Cid))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Cid)); err != nil {
+		return err
+	}
+
+	// t.Orig (string) (string)
+	if len("orig") > 1000000 {
+		return xerrors.Errorf("Value in field \"orig\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("orig"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("orig")); err != nil {
+		return err
+	}
+
+	if len(t.Orig) > 1000000 {
+		return xerrors.Errorf("Value in field t.Orig was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Orig))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Orig)); err != nil {
+		return err
+	}
+
+	// t.Path (string) (string)
+	if len("path") > 1000000 {
+		return xerrors.Errorf("Value in field \"path\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("path"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("path")); err != nil {
+		return err
+	}
+
+	if len(t.Path) > 1000000 {
+		return xerrors.Errorf("Value in field t.Path was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Path))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Path)); err != nil {
+		return err
+	}
+
+	// t.Rules ([]string) (slice)
+	if len("rules") > 1000000 {
+		return xerrors.Errorf("Value in field \"rules\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("rules"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("rules")); err != nil {
+		return err
+	}
+
+	if len(t.Rules) > 8192 {
+		return xerrors.Errorf("Slice value in field t.Rules was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Rules))); err != nil {
+		return err
+	}
+	for _, v := range t.Rules {
+		if len(v) > 1000000 {
+			return xerrors.Errorf("Value in field v was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(v))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string(v)); err != nil {
+			return err
+		}
+
+	}
+	return nil
+}
+
+func (t *ModifiedOp) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = ModifiedOp{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("ModifiedOp: map struct too large (%d)", extra)
+	}
+
+	n := extra
+
+	nameBuf := make([]byte, 5)
+	for i := uint64(0); i < n; i++ {
+		nameLen, ok, err := cbg.ReadFullStringIntoBuf(cr, nameBuf, 1000000)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(cr, func(cid.Cid) {}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch string(nameBuf[:nameLen]) {
+		// t.Cid (string) (string)
+		case "cid":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Cid = string(sval)
+			}
+			// t.Orig (string) (string)
+		case "orig":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Orig = string(sval)
+			}
+			// t.Path (string) (string)
+		case "path":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Path = string(sval)
+			}
+			// t.Rules ([]string) (slice)
+		case "rules":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Rules: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Rules = make([]string, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+						sval, err := cbg.ReadStringWithMax(cr, 1000000)
+						if err != nil {
+							return err
+						}
+
+						t.Rules[i] = string(sval)
+					}
+
+				}
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(r, func(cid.Cid) {}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+func (t *OpAnnotation) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+	fieldCount := 5
+
+	if t.Langs == nil {
+		fieldCount--
+	}
+
+	if t.Hashtags == nil {
+		fieldCount--
+	}
+
+	if t.Links == nil {
+		fieldCount--
+	}
+
+	if t.CaDomains == nil {
+		fieldCount--
+	}
+
+	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
+		return err
+	}
+
+	// t.Path (string) (string)
+	if len("path") > 1000000 {
+		return xerrors.Errorf("Value in field \"path\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("path"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("path")); err != nil {
+		return err
+	}
+
+	if len(t.Path) > 1000000 {
+		return xerrors.Errorf("Value in field t.Path was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Path))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string(t.Path)); err != nil {
+		return err
+	}
+
+	// t.Langs ([]string) (slice)
+	if t.Langs != nil {
+
+		if len("langs") > 1000000 {
+			return xerrors.Errorf("Value in field \"langs\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("langs"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("langs")); err != nil {
+			return err
+		}
+
+		if len(t.Langs) > 8192 {
+			return xerrors.Errorf("Slice value in field t.Langs was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Langs))); err != nil {
+			return err
+		}
+		for _, v := range t.Langs {
+			if len(v) > 1000000 {
+				return xerrors.Errorf("Value in field v was too long")
+			}
+
+			if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(v))); err != nil {
+				return err
+			}
+			if _, err := cw.WriteString(string(v)); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	// t.Links ([]string) (slice)
+	if t.Links != nil {
+
+		if len("links") > 1000000 {
+			return xerrors.Errorf("Value in field \"links\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("links"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("links")); err != nil {
+			return err
+		}
+
+		if len(t.Links) > 8192 {
+			return xerrors.Errorf("Slice value in field t.Links was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Links))); err != nil {
+			return err
+		}
+		for _, v := range t.Links {
+			if len(v) > 1000000 {
+				return xerrors.Errorf("Value in field v was too long")
+			}
+
+			if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(v))); err != nil {
+				return err
+			}
+			if _, err := cw.WriteString(string(v)); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	// t.Hashtags ([]string) (slice)
+	if t.Hashtags != nil {
+
+		if len("hashtags") > 1000000 {
+			return xerrors.Errorf("Value in field \"hashtags\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("hashtags"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("hashtags")); err != nil {
+			return err
+		}
+
+		if len(t.Hashtags) > 8192 {
+			return xerrors.Errorf("Slice value in field t.Hashtags was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Hashtags))); err != nil {
+			return err
+		}
+		for _, v := range t.Hashtags {
+			if len(v) > 1000000 {
+				return xerrors.Errorf("Value in field v was too long")
+			}
+
+			if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(v))); err != nil {
+				return err
+			}
+			if _, err := cw.WriteString(string(v)); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	// t.CaDomains ([]string) (slice)
+	if t.CaDomains != nil {
+
+		if len("caDomains") > 1000000 {
+			return xerrors.Errorf("Value in field \"caDomains\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("caDomains"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("caDomains")); err != nil {
+			return err
+		}
+
+		if len(t.CaDomains) > 8192 {
+			return xerrors.Errorf("Slice value in field t.CaDomains was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.CaDomains))); err != nil {
+			return err
+		}
+		for _, v := range t.CaDomains {
+			if len(v) > 1000000 {
+				return xerrors.Errorf("Value in field v was too long")
+			}
+
+			if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(v))); err != nil {
+				return err
+			}
+			if _, err := cw.WriteString(string(v)); err != nil {
+				return err
+			}
+
+		}
+	}
+	return nil
+}
+
+func (t *OpAnnotation) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = OpAnnotation{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("OpAnnotation: map struct too large (%d)", extra)
+	}
+
+	n := extra
+
+	nameBuf := make([]byte, 9)
+	for i := uint64(0); i < n; i++ {
+		nameLen, ok, err := cbg.ReadFullStringIntoBuf(cr, nameBuf, 1000000)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(cr, func(cid.Cid) {}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch string(nameBuf[:nameLen]) {
+		// t.Path (string) (string)
+		case "path":
+
+			{
+				sval, err := cbg.ReadStringWithMax(cr, 1000000)
+				if err != nil {
+					return err
+				}
+
+				t.Path = string(sval)
+			}
+			// t.Langs ([]string) (slice)
+		case "langs":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Langs: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Langs = make([]string, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+						sval, err := cbg.ReadStringWithMax(cr, 1000000)
+						if err != nil {
+							return err
+						}
+
+						t.Langs[i] = string(sval)
+					}
+
+				}
+			}
+			// t.Links ([]string) (slice)
+		case "links":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Links: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Links = make([]string, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+						sval, err := cbg.ReadStringWithMax(cr, 1000000)
+						if err != nil {
+							return err
+						}
+
+						t.Links[i] = string(sval)
+					}
+
+				}
+			}
+			// t.Hashtags ([]string) (slice)
+		case "hashtags":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.Hashtags: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Hashtags = make([]string, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+						sval, err := cbg.ReadStringWithMax(cr, 1000000)
+						if err != nil {
+							return err
+						}
+
+						t.Hashtags[i] = string(sval)
+					}
+
+				}
+			}
+			// t.CaDomains ([]string) (slice)
+		case "caDomains":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > 8192 {
+				return fmt.Errorf("t.CaDomains: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.CaDomains = make([]string, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+				{
+					var maj byte
+					var extra uint64
+					var err error
+					_ = maj
+					_ = extra
+					_ = err
+
+					{
+						sval, err := cbg.ReadStringWithMax(cr, 1000000)
+						if err != nil {
+							return err
+						}
+
+						t.CaDomains[i] = string(sval)
+					}
+
+				}
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			if err := cbg.ScanForLinks(r, func(cid.Cid) {}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
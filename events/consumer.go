@@ -52,6 +52,8 @@ func (rsc *RepoStreamCallbacks) EventHandler(ctx context.Context, xev *XRPCStrea
 type InstrumentedRepoStreamCallbacks struct {
 	limiters []*slidingwindow.Limiter
 	Next     func(ctx context.Context, xev *XRPCStreamEvent) error
+	// if set, events for which this returns true skip the limiters entirely
+	Exempt func(xev *XRPCStreamEvent) bool
 }
 
 func NewInstrumentedRepoStreamCallbacks(limiters []*slidingwindow.Limiter, next func(ctx context.Context, xev *XRPCStreamEvent) error) *InstrumentedRepoStreamCallbacks {
@@ -82,6 +84,9 @@ func waitForLimiter(ctx context.Context, lim *slidingwindow.Limiter) error {
 }
 
 func (rsc *InstrumentedRepoStreamCallbacks) EventHandler(ctx context.Context, xev *XRPCStreamEvent) error {
+	if rsc.Exempt != nil && rsc.Exempt(xev) {
+		return rsc.Next(ctx, xev)
+	}
 	// Wait on all limiters before calling the next handler
 	for _, lim := range rsc.limiters {
 		if err := waitForLimiter(ctx, lim); err != nil {
@@ -212,6 +217,8 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 
 				if err := sched.AddWork(ctx, evt.Repo, &XRPCStreamEvent{
 					RepoCommit: &evt,
+					Meta:       header.Meta,
+					Resume:     header.Resume,
 				}); err != nil {
 					return err
 				}
@@ -229,6 +236,7 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 
 				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
 					RepoSync: &evt,
+					Resume:   header.Resume,
 				}); err != nil {
 					return err
 				}
@@ -245,6 +253,7 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 
 				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
 					RepoIdentity: &evt,
+					Resume:       header.Resume,
 				}); err != nil {
 					return err
 				}
@@ -261,6 +270,7 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 
 				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
 					RepoAccount: &evt,
+					Resume:      header.Resume,
 				}); err != nil {
 					return err
 				}
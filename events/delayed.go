@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// longest a delayed subscriber waits before reading the persister again, once it has caught up
+const delayedPollInterval = time.Second
+
+var errNotDue = errors.New("event is not due yet")
+
+// SubscribeDelayed returns events as Subscribe does, but each only once it is delay old, by its own timestamp. Rather than being fed by broadcast, each delayed subscriber reads the persister from its own cursor, so events taken down from the persister within the delay are never sent to it. Without since, it starts at the current head: events broadcast before it subscribed are not sent, even if they are not yet due.
+func (em *EventManager) SubscribeDelayed(ctx context.Context, ident string, filter func(*XRPCStreamEvent) bool, since *int64, delay time.Duration) (<-chan *XRPCStreamEvent, func(), error) {
+	if filter == nil {
+		filter = func(*XRPCStreamEvent) bool { return true }
+	}
+	cursor, _ := em.Head()
+	if since != nil {
+		cursor = *since
+	}
+
+	done := make(chan struct{})
+	cleanup := sync.OnceFunc(func() { close(done) })
+	out := make(chan *XRPCStreamEvent, em.crossoverBufferSize)
+	enqueued := eventsEnqueued.WithLabelValues(ident)
+
+	go func() {
+		defer close(out)
+		for {
+			wait := delayedPollInterval
+			err := em.persister.Playback(ctx, cursor, func(e *XRPCStreamEvent) error {
+				seq := e.Sequence()
+				if seq <= cursor {
+					return nil
+				}
+				if due := e.eventTime().Add(delay); time.Now().Before(due) {
+					wait = min(wait, time.Until(due))
+					return errNotDue
+				}
+				cursor = seq
+				if !filter(e) {
+					return nil
+				}
+				enqueued.Inc()
+				select {
+				case out <- e:
+					return nil
+				case <-done:
+					return ErrPlaybackShutdown
+				}
+			})
+			if err != nil && !errors.Is(err, errNotDue) {
+				if !errors.Is(err, ErrPlaybackShutdown) {
+					em.log.Error("delayed events playback", "ident", ident, "err", err)
+				}
+				return
+			}
+			select {
+			case <-time.After(wait):
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, cleanup, nil
+}
+
+// eventTime returns when an event says it happened, or the zero time if it doesn't say, or can't be parsed
+func (evt *XRPCStreamEvent) eventTime() time.Time {
+	var s string
+	switch {
+	case evt.RepoCommit != nil:
+		s = evt.RepoCommit.Time
+	case evt.RepoSync != nil:
+		s = evt.RepoSync.Time
+	case evt.RepoIdentity != nil:
+		s = evt.RepoIdentity.Time
+	case evt.RepoAccount != nil:
+		s = evt.RepoAccount.Time
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeDelayed(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	em := NewEventManager(NewMemPersister())
+
+	identity := func(did string, at time.Time) *XRPCStreamEvent {
+		return &XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Time: at.UTC().Format(time.RFC3339Nano)}}
+	}
+	next := func(evts <-chan *XRPCStreamEvent, within time.Duration) *XRPCStreamEvent {
+		select {
+		case evt := <-evts:
+			return evt
+		case <-time.After(within):
+			return nil
+		}
+	}
+
+	assert.NoError(em.AddEvent(ctx, identity("did:plc:old", time.Now().Add(-time.Hour))))
+	assert.NoError(em.AddEvent(ctx, identity("did:plc:new", time.Now())))
+
+	since := int64(0)
+	evts, cleanup, err := em.SubscribeDelayed(ctx, "test", nil, &since, 300*time.Millisecond)
+	assert.NoError(err)
+	defer cleanup()
+
+	// due already
+	if evt := next(evts, time.Second); assert.NotNil(evt) {
+		assert.Equal("did:plc:old", evt.RepoIdentity.Did)
+	}
+	// held until it is old enough
+	assert.Nil(next(evts, 100*time.Millisecond))
+	if evt := next(evts, 2*time.Second); assert.NotNil(evt) {
+		assert.Equal("did:plc:new", evt.RepoIdentity.Did)
+		assert.Equal(int64(2), evt.Sequence())
+	}
+
+	// without a cursor, starting at the head
+	filtered, cleanupFiltered, err := em.SubscribeDelayed(ctx, "test", func(evt *XRPCStreamEvent) bool {
+		return evt.RepoIdentity.Did != "did:plc:skip"
+	}, nil, time.Minute)
+	assert.NoError(err)
+	defer cleanupFiltered()
+	assert.NoError(em.AddEvent(ctx, identity("did:plc:skip", time.Now().Add(-time.Hour))))
+	assert.NoError(em.AddEvent(ctx, identity("did:plc:later", time.Now().Add(-time.Hour))))
+	if evt := next(filtered, 2*time.Second); assert.NotNil(evt) {
+		assert.Equal("did:plc:later", evt.RepoIdentity.Did)
+	}
+}
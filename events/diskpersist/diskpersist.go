@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -12,11 +13,15 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/sequencer"
 	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/clock"
+	"github.com/bluesky-social/indigo/util/keymgmt"
 	arc "github.com/hashicorp/golang-lru/arc/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -32,14 +37,26 @@ type DiskPersistence struct {
 	eventsPerFile   int64
 	writeBufferSize int
 	retention       time.Duration
+	durability      Durability
+	flushInterval   time.Duration
+	clock           clock.Clock
 
 	meta *gorm.DB
 
 	broadcast func(*events.XRPCStreamEvent)
 
 	logfi *os.File
+	idxfi *os.File
+	// nil when events are encrypted at rest
+	pathfi *os.File
 
-	curSeq int64
+	recovery *RecoveryReport
+
+	// logOffset is the length of the current log file including buffered events
+	logOffset int64
+
+	// allocates the sequence numbers of persisted events
+	seq *sequencer.Sequencer
 
 	uidCache *arc.ARCCache[models.Uid, string] // TODO: unused
 	didCache *arc.ARCCache[string, models.Uid]
@@ -48,12 +65,27 @@ type DiskPersistence struct {
 	buffers *sync.Pool
 	scratch []byte
 
-	outbuf *bytes.Buffer
-	evtbuf []persistJob
+	outbuf  *bytes.Buffer
+	idxbuf  []byte
+	pathbuf []byte
+	evtbuf  []persistJob
+	// events handed to Persist and not yet broadcast, including those waiting for the lock
+	backlog atomic.Int64
 
 	shutdown chan struct{}
 
+	retentionRules atomic.Pointer[retentionPolicy]
+	holds          atomic.Pointer[HoldChecker]
+	regions        atomic.Pointer[RegionLookup]
+
+	// set when events are encrypted at rest; logKey is the data key of the current log file
+	keys     *keymgmt.Keyring
+	logKey   cipher.AEAD
+	fileKeys sync.Map // LogFileRef ID -> cipher.AEAD
+
 	lk sync.Mutex
+	// held while rewriting headers of closed log files
+	sweepLk sync.Mutex
 }
 
 type persistJob struct {
@@ -70,9 +102,19 @@ type jobResult struct {
 const (
 	EvtFlagTakedown = 1 << iota
 	EvtFlagRebased
+	// past the retention of its collection
+	EvtFlagExpired
+	// taken down, but its data is kept on disk under legal hold
+	EvtFlagRetained
+	// payload encrypted under the log file's data key
+	EvtFlagEncrypted
+	// payload starts with the account's classification region at persist time (a length byte, then the region)
+	EvtFlagRegion
 )
 
 var _ (events.EventPersistence) = (*DiskPersistence)(nil)
+var _ (events.BacklogReporter) = (*DiskPersistence)(nil)
+var _ (events.PathPlayback) = (*DiskPersistence)(nil)
 
 type DiskPersistOptions struct {
 	UIDCacheSize    int
@@ -80,6 +122,11 @@ type DiskPersistOptions struct {
 	EventsPerFile   int64
 	WriteBufferSize int
 	Retention       time.Duration
+	Durability      Durability
+	FlushInterval   time.Duration        // how often buffered events are written out, bounding the loss window
+	Keyring         *keymgmt.Keyring     // if set, event payloads are encrypted at rest under per-file data keys wrapped by the keyring
+	Clock           clock.Clock          // time source for log file ages, retention sweeps, garbage collection and the flush interval; nil uses the system clock
+	Sequencer       *sequencer.Sequencer // allocates sequence numbers; nil uses one kept in the metadata database, for a single relay
 }
 
 func DefaultDiskPersistOptions() *DiskPersistOptions {
@@ -89,6 +136,8 @@ func DefaultDiskPersistOptions() *DiskPersistOptions {
 		DIDCacheSize:    1_000_000,
 		WriteBufferSize: 50,
 		Retention:       time.Hour * 24 * 3, // 3 days
+		Durability:      DurabilityBuffered,
+		FlushInterval:   time.Millisecond * 100,
 	}
 }
 
@@ -107,8 +156,22 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		return nil, fmt.Errorf("failed to create did cache: %w", err)
 	}
 
+	flushInterval := opts.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Millisecond * 100
+	}
+
 	db.AutoMigrate(&LogFileRef{})
 
+	seq := opts.Sequencer
+	if seq == nil {
+		alloc, err := sequencer.NewDBAllocator(db, "events")
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up sequence allocator: %w", err)
+		}
+		seq = sequencer.New(alloc, sequencer.DefaultOptions())
+	}
+
 	bufpool := &sync.Pool{
 		New: func() any {
 			return new(bytes.Buffer)
@@ -134,6 +197,11 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		scratch:         make([]byte, headerSize),
 		outbuf:          new(bytes.Buffer),
 		writeBufferSize: opts.WriteBufferSize,
+		durability:      opts.Durability,
+		flushInterval:   flushInterval,
+		clock:           clock.OrSystem(opts.Clock),
+		keys:            opts.Keyring,
+		seq:             seq,
 		shutdown:        make(chan struct{}),
 	}
 
@@ -141,7 +209,9 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		return nil, err
 	}
 
-	go dp.flushRoutine()
+	if dp.durability != DurabilitySync {
+		go dp.flushRoutine()
+	}
 
 	go dp.garbageCollectRoutine()
 
@@ -153,6 +223,12 @@ type LogFileRef struct {
 	Path     string
 	Archived bool
 	SeqStart int64
+	// when the retention sweep next needs to look at the file; nil if it hasn't been swept yet
+	SweepAt *time.Time
+	// every event left in the file is kept forever
+	Pinned bool
+	// the file's data key, wrapped by the keyring; nil if its events are stored in the clear
+	DataKey []byte
 }
 
 func (dp *DiskPersistence) resumeLog() error {
@@ -162,8 +238,12 @@ func (dp *DiskPersistence) resumeLog() error {
 	}
 
 	if lfr.ID == 0 {
-		// no files, start anew!
-		return dp.initLogFile()
+		// no files, start anew! (the sequence may not, eg on a replica taking over with an empty disk)
+		next, err := dp.seq.Start(context.Background(), 0)
+		if err != nil {
+			return err
+		}
+		return dp.initLogFile(next)
 	}
 
 	// 0 for the mode is fine since that is only used if O_CREAT is passed
@@ -172,37 +252,136 @@ func (dp *DiskPersistence) resumeLog() error {
 		return err
 	}
 
-	seq, err := scanForLastSeq(fi, -1)
+	report, err := recoverLog(fi)
 	if err != nil {
 		return fmt.Errorf("failed to scan log file for last seqno: %w", err)
 	}
+	if report.Repaired() {
+		log.Warn("repaired event log after unclean shutdown",
+			"file", report.File,
+			"truncatedBytes", report.TruncatedBytes,
+			"indexDiscarded", report.IndexDiscarded,
+			"indexRecovered", report.IndexRecovered,
+			"indexTruncatedBytes", report.IndexTruncBytes,
+		)
+	}
+	seq := report.LastSeq
+
+	idxfi, err := os.OpenFile(seqIndexPath(fi.Name()), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	pathfi, err := dp.openPathIndex(fi.Name())
+	if err != nil {
+		return err
+	}
+
+	// continue after the last event; an empty file was created when its first seq was next
+	if seq < 0 {
+		seq = max(lfr.SeqStart-1, 0)
+	}
+	next, err := dp.seq.Start(context.Background(), seq)
+	if err != nil {
+		return err
+	}
+
+	// a log file started before encryption was enabled gets a data key for the events still to be written to it
+	if dp.keys != nil && len(lfr.DataKey) == 0 {
+		key, wrapped, err := dp.newLogDataKey()
+		if err != nil {
+			return err
+		}
+		if err := dp.meta.Model(&lfr).Update("data_key", wrapped).Error; err != nil {
+			return err
+		}
+		lfr.DataKey = wrapped
+		dp.fileKeys.Store(lfr.ID, key)
+	}
+	key, err := dp.logFileKey(&lfr)
+	if err != nil {
+		return err
+	}
 
-	dp.curSeq = seq
 	dp.logfi = fi
+	dp.idxfi = idxfi
+	dp.pathfi = pathfi
+	dp.logOffset = report.Size
+	dp.recovery = report
+	dp.logKey = key
+
+	// numbers skipped after a crash may run past the end of the file's range, which playback finds files by
+	if next > fileSeqEnd(seq, dp.eventsPerFile) {
+		return dp.swapLog(context.Background())
+	}
 
 	return nil
 }
 
-func (dp *DiskPersistence) initLogFile() error {
+// fileSeqEnd returns the last seq of the log file holding seq. Files end at multiples of the events per file, and start where the previous one ended, or later when the sequence skipped numbers.
+func fileSeqEnd(seq, eventsPerFile int64) int64 {
+	if seq <= 0 {
+		return eventsPerFile
+	}
+	return (seq + eventsPerFile - 1) / eventsPerFile * eventsPerFile
+}
+
+// LastRecovery returns the result of the recovery scan run when the persister resumed an existing log, or nil for a fresh one
+func (dp *DiskPersistence) LastRecovery() *RecoveryReport {
+	return dp.recovery
+}
+
+func (dp *DiskPersistence) initLogFile(next int64) error {
 	if err := os.MkdirAll(dp.primaryDir, 0775); err != nil {
 		return err
 	}
 
-	p := filepath.Join(dp.primaryDir, "evts-0")
+	var seqStart int64
+	if next > 1 {
+		seqStart = next
+	}
+	fname := fmt.Sprintf("evts-%d", seqStart)
+	p := filepath.Join(dp.primaryDir, fname)
 	fi, err := os.Create(p)
 	if err != nil {
 		return err
 	}
 
-	if err := dp.meta.Create(&LogFileRef{
-		Path:     "evts-0",
-		SeqStart: 0,
-	}).Error; err != nil {
+	idxfi, err := os.Create(seqIndexPath(p))
+	if err != nil {
+		return err
+	}
+
+	pathfi, err := dp.openPathIndex(p)
+	if err != nil {
+		return err
+	}
+
+	key, wrapped, err := dp.newLogDataKey()
+	if err != nil {
+		return err
+	}
+
+	ref := LogFileRef{
+		Path:     fname,
+		SeqStart: seqStart,
+		DataKey:  wrapped,
+	}
+	ref.CreatedAt = dp.clock.Now()
+	if err := dp.meta.Create(&ref).Error; err != nil {
 		return err
 	}
 
+	if dp.durability != DurabilityBuffered {
+		if err := syncDir(dp.primaryDir); err != nil {
+			return err
+		}
+	}
+
 	dp.logfi = fi
-	dp.curSeq = 1
+	dp.idxfi = idxfi
+	dp.pathfi = pathfi
+	dp.logOffset = 0
+	dp.logKey = key
 	return nil
 }
 
@@ -212,8 +391,23 @@ func (dp *DiskPersistence) swapLog(ctx context.Context) error {
 	if err := dp.logfi.Close(); err != nil {
 		return fmt.Errorf("failed to close current log file: %w", err)
 	}
+	// closed log files don't have their index rebuilt on resume
+	if dp.durability != DurabilityBuffered {
+		if err := dp.idxfi.Sync(); err != nil {
+			return fmt.Errorf("failed to sync current sequence index: %w", err)
+		}
+	}
+	if err := dp.idxfi.Close(); err != nil {
+		return fmt.Errorf("failed to close current sequence index: %w", err)
+	}
+	if dp.pathfi != nil {
+		if err := dp.pathfi.Close(); err != nil {
+			return fmt.Errorf("failed to close current path index: %w", err)
+		}
+	}
 
-	fname := fmt.Sprintf("evts-%d", dp.curSeq)
+	seqStart := dp.seq.Peek()
+	fname := fmt.Sprintf("evts-%d", seqStart)
 	nextp := filepath.Join(dp.primaryDir, fname)
 
 	fi, err := os.Create(nextp)
@@ -221,22 +415,55 @@ func (dp *DiskPersistence) swapLog(ctx context.Context) error {
 		return err
 	}
 
-	if err := dp.meta.Create(&LogFileRef{
+	idxfi, err := os.Create(seqIndexPath(nextp))
+	if err != nil {
+		return err
+	}
+
+	pathfi, err := dp.openPathIndex(nextp)
+	if err != nil {
+		return err
+	}
+
+	// each file gets its own data key, wrapped under the keyring's primary key at the time
+	key, wrapped, err := dp.newLogDataKey()
+	if err != nil {
+		return err
+	}
+
+	ref := LogFileRef{
 		Path:     fname,
-		SeqStart: dp.curSeq,
-	}).Error; err != nil {
+		SeqStart: seqStart,
+		DataKey:  wrapped,
+	}
+	ref.CreatedAt = dp.clock.Now()
+	if err := dp.meta.Create(&ref).Error; err != nil {
 		return err
 	}
 
+	if dp.durability != DurabilityBuffered {
+		if err := syncDir(dp.primaryDir); err != nil {
+			return err
+		}
+	}
+
 	dp.logfi = fi
+	dp.idxfi = idxfi
+	dp.pathfi = pathfi
+	dp.logOffset = 0
+	dp.logKey = key
 	return nil
 }
 
+// scanForLastSeq reads event headers from the current position of fi, stopping at the first event with seq greater than end (if end > 0)
 func scanForLastSeq(fi *os.File, end int64) (int64, error) {
 	scratch := make([]byte, headerSize)
 
 	var lastSeq int64 = -1
-	var offset int64
+	offset, err := fi.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
 	for {
 		eh, err := readHeader(fi, scratch)
 		if err != nil {
@@ -288,15 +515,17 @@ const (
 var emptyHeader = make([]byte, headerSize)
 
 func (dp *DiskPersistence) addJobToQueue(ctx context.Context, job persistJob) error {
+	dp.backlog.Add(1)
 	dp.lk.Lock()
 	defer dp.lk.Unlock()
 
 	if err := dp.doPersist(ctx, job); err != nil {
+		dp.backlog.Add(-1)
 		return err
 	}
 
 	// TODO: for some reason replacing this constant with p.writeBufferSize dramatically reduces perf...
-	if len(dp.evtbuf) > 400 {
+	if dp.durability == DurabilitySync || len(dp.evtbuf) > 400 {
 		if err := dp.flushLog(ctx); err != nil {
 			return fmt.Errorf("failed to flush disk log: %w", err)
 		}
@@ -306,14 +535,15 @@ func (dp *DiskPersistence) addJobToQueue(ctx context.Context, job persistJob) er
 }
 
 func (dp *DiskPersistence) flushRoutine() {
-	t := time.NewTicker(time.Millisecond * 100)
+	t := dp.clock.NewTicker(dp.flushInterval)
+	defer t.Stop()
 
 	for {
 		ctx := context.Background()
 		select {
 		case <-dp.shutdown:
 			return
-		case <-t.C:
+		case <-t.C():
 			dp.lk.Lock()
 			if err := dp.flushLog(ctx); err != nil {
 				// TODO: this happening is quite bad. Need a recovery strategy
@@ -329,6 +559,8 @@ func (dp *DiskPersistence) flushLog(ctx context.Context) error {
 		return nil
 	}
 
+	start := time.Now()
+
 	_, err := io.Copy(dp.logfi, dp.outbuf)
 	if err != nil {
 		return err
@@ -336,11 +568,36 @@ func (dp *DiskPersistence) flushLog(ctx context.Context) error {
 
 	dp.outbuf.Truncate(0)
 
+	if dp.durability != DurabilityBuffered {
+		syncStart := time.Now()
+		if err := dp.logfi.Sync(); err != nil {
+			return fmt.Errorf("failed to sync log file: %w", err)
+		}
+		fsyncDuration.Observe(time.Since(syncStart).Seconds())
+	}
+
+	// the index is written after the events so it never points past the log
+	if _, err := dp.idxfi.Write(dp.idxbuf); err != nil {
+		return err
+	}
+	dp.idxbuf = dp.idxbuf[:0]
+	if dp.pathfi != nil {
+		if _, err := dp.pathfi.Write(dp.pathbuf); err != nil {
+			return err
+		}
+		dp.pathbuf = dp.pathbuf[:0]
+	}
+
+	mode := dp.durability.String()
+	flushDuration.WithLabelValues(mode).Observe(time.Since(start).Seconds())
+	flushBatchSize.WithLabelValues(mode).Observe(float64(len(dp.evtbuf)))
+
 	for _, ej := range dp.evtbuf {
 		dp.broadcast(ej.Evt)
 		ej.Buffer.Truncate(0)
 		dp.buffers.Put(ej.Buffer)
 	}
+	dp.backlog.Add(-int64(len(dp.evtbuf)))
 
 	dp.evtbuf = dp.evtbuf[:0]
 
@@ -348,7 +605,8 @@ func (dp *DiskPersistence) flushLog(ctx context.Context) error {
 }
 
 func (dp *DiskPersistence) garbageCollectRoutine() {
-	t := time.NewTicker(time.Hour)
+	t := dp.clock.NewTicker(time.Hour)
+	defer t.Stop()
 
 	for {
 		ctx := context.Background()
@@ -356,7 +614,7 @@ func (dp *DiskPersistence) garbageCollectRoutine() {
 		// Closing a channel can be listened to with multiple routines: https://goplay.tools/snippet/UcwbC0CeJAL
 		case <-dp.shutdown:
 			return
-		case <-t.C:
+		case <-t.C():
 			if errs := dp.garbageCollect(ctx); len(errs) > 0 {
 				for _, err := range errs {
 					log.Error("garbage collection error", "err", err)
@@ -386,9 +644,20 @@ var filesGarbageCollected = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Number of files collected during garbage collection",
 }, []string{})
 
+var seqIndexSeeks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "disk_persister_cursor_seeks",
+	Help: "Number of playback cursor seeks by method (index, partial, scan)",
+}, []string{"method"})
+
 func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 	garbageCollectionsExecuted.WithLabelValues().Inc()
 
+	if dp.retentionRules.Load() != nil || dp.hasHolds() {
+		errs := dp.sweep(ctx)
+		garbageCollectionErrors.WithLabelValues().Add(float64(len(errs)))
+		return errs
+	}
+
 	// Grab refs created before the retention period
 	var refs []LogFileRef
 	var errs []error
@@ -397,7 +666,7 @@ func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 		garbageCollectionErrors.WithLabelValues().Add(float64(len(errs)))
 	}()
 
-	if err := dp.meta.WithContext(ctx).Find(&refs, "created_at < ?", time.Now().Add(-dp.retention)).Error; err != nil {
+	if err := dp.meta.WithContext(ctx).Find(&refs, "created_at < ?", dp.clock.Now().Add(-dp.retention)).Error; err != nil {
 		return []error{err}
 	}
 
@@ -417,19 +686,14 @@ func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 			continue
 		}
 
-		// Delete the ref in the database to prevent playback from finding it
-		if err := dp.meta.WithContext(ctx).Delete(&r).Error; err != nil {
-			errs = append(errs, err)
-			continue
+		refDeleted, fileDeleted, rerrs := dp.removeLogFile(ctx, r)
+		errs = append(errs, rerrs...)
+		if refDeleted {
+			refsDeleted++
 		}
-		refsDeleted++
-
-		// Delete the file from disk
-		if err := os.Remove(filepath.Join(dp.primaryDir, r.Path)); err != nil {
-			errs = append(errs, err)
-			continue
+		if fileDeleted {
+			filesDeleted++
 		}
-		filesDeleted++
 	}
 
 	refsGarbageCollected.WithLabelValues().Add(float64(refsDeleted))
@@ -444,11 +708,35 @@ func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 	return errs
 }
 
+// removeLogFile deletes a log file, its sequence and path indexes, and its ref
+func (dp *DiskPersistence) removeLogFile(ctx context.Context, r LogFileRef) (refDeleted, fileDeleted bool, errs []error) {
+	// Delete the ref in the database to prevent playback from finding it
+	if err := dp.meta.WithContext(ctx).Delete(&r).Error; err != nil {
+		return false, false, []error{err}
+	}
+	dp.fileKeys.Delete(r.ID)
+
+	// Delete the file from disk
+	if err := os.Remove(filepath.Join(dp.primaryDir, r.Path)); err != nil {
+		return true, false, []error{err}
+	}
+
+	if err := os.Remove(seqIndexPath(filepath.Join(dp.primaryDir, r.Path))); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	if err := os.Remove(pathIndexPath(filepath.Join(dp.primaryDir, r.Path))); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	return true, true, errs
+}
+
 func (dp *DiskPersistence) doPersist(ctx context.Context, j persistJob) error {
 	b := j.Bytes
 	e := j.Evt
-	seq := dp.curSeq
-	dp.curSeq++
+	seq, err := dp.seq.Next(ctx)
+	if err != nil {
+		return fmt.Errorf("allocating sequence number: %w", err)
+	}
 
 	// Set sequence number in event header
 	binary.LittleEndian.PutUint64(b[20:], uint64(seq))
@@ -468,12 +756,25 @@ func (dp *DiskPersistence) doPersist(ctx context.Context, j persistJob) error {
 		return nil
 	}
 
+	if dp.logKey != nil {
+		sealed, err := dp.sealEvent(b)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt event: %w", err)
+		}
+		b = sealed
+	}
+
 	// TODO: does this guarantee a full write?
-	_, err := dp.outbuf.Write(b)
+	_, err = dp.outbuf.Write(b)
 	if err != nil {
 		return err
 	}
 
+	dp.idxbuf = appendSeqIndexEntry(dp.idxbuf, seq, dp.logOffset)
+	if dp.pathfi != nil && e.RepoCommit != nil {
+		dp.pathbuf = appendPathIndexEntry(dp.pathbuf, seq, e.RepoCommit.Ops)
+	}
+	dp.logOffset += int64(len(b))
 	dp.evtbuf = append(dp.evtbuf, j)
 
 	if seq%dp.eventsPerFile == 0 {
@@ -501,36 +802,40 @@ func (dp *DiskPersistence) Persist(ctx context.Context, e *events.XRPCStreamEven
 
 	var did string
 	var evtKind uint32
+	var body cbg.CBORMarshaler
 	switch {
 	case e.RepoCommit != nil:
 		evtKind = evtKindCommit
 		did = e.RepoCommit.Repo
-		if err := e.RepoCommit.MarshalCBOR(cw); err != nil {
-			return fmt.Errorf("failed to marshal: %w", err)
-		}
+		body = e.RepoCommit
 	case e.RepoSync != nil:
 		evtKind = evtKindSync
 		did = e.RepoSync.Did
-		if err := e.RepoSync.MarshalCBOR(cw); err != nil {
-			return fmt.Errorf("failed to marshal: %w", err)
-		}
+		body = e.RepoSync
 	case e.RepoIdentity != nil:
 		evtKind = evtKindIdentity
 		did = e.RepoIdentity.Did
-		if err := e.RepoIdentity.MarshalCBOR(cw); err != nil {
-			return fmt.Errorf("failed to marshal: %w", err)
-		}
+		body = e.RepoIdentity
 	case e.RepoAccount != nil:
 		evtKind = evtKindAccount
 		did = e.RepoAccount.Did
-		if err := e.RepoAccount.MarshalCBOR(cw); err != nil {
-			return fmt.Errorf("failed to marshal: %w", err)
-		}
+		body = e.RepoAccount
 	default:
 		return nil
 		// only those two get peristed right now
 	}
 
+	flags := dp.retentionFlags(e)
+	if region := dp.region(did); region != "" {
+		flags |= EvtFlagRegion
+		buffer.WriteByte(byte(len(region)))
+		buffer.WriteString(region)
+		e.PrivRegion = region
+	}
+	if err := body.MarshalCBOR(cw); err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
 	usr, err := dp.uidForDid(ctx, did)
 	if err != nil {
 		return err
@@ -538,8 +843,8 @@ func (dp *DiskPersistence) Persist(ctx context.Context, e *events.XRPCStreamEven
 
 	b := buffer.Bytes()
 
-	// Set flags in header (no flags for now)
-	binary.LittleEndian.PutUint32(b, 0)
+	// Set flags in header
+	binary.LittleEndian.PutUint32(b, flags)
 	// Set event kind in header
 	binary.LittleEndian.PutUint32(b[4:], evtKind)
 	// Set event length in header
@@ -629,6 +934,11 @@ func (dp *DiskPersistence) uidForDid(ctx context.Context, did string) (models.Ui
 }
 
 func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*events.XRPCStreamEvent) error) error {
+	return dp.playback(ctx, since, nil, cb)
+}
+
+// playback reads events after since, leaving out commits none of whose op paths match, if match is set
+func (dp *DiskPersistence) playback(ctx context.Context, since int64, match func(string) bool, cb func(*events.XRPCStreamEvent) error) error {
 	base := since - (since % dp.eventsPerFile)
 	var logs []LogFileRef
 	if err := dp.meta.Debug().Order("seq_start asc").Find(&logs, "seq_start >= ?", base).Error; err != nil {
@@ -636,7 +946,7 @@ func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*e
 	}
 
 	for i := 0; i < 10; i++ {
-		lastSeq, err := dp.PlaybackLogfiles(ctx, since, cb, logs)
+		lastSeq, err := dp.playbackLogfiles(ctx, since, match, cb, logs)
 		if err != nil {
 			return err
 		}
@@ -656,15 +966,23 @@ func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*e
 }
 
 func (dp *DiskPersistence) PlaybackLogfiles(ctx context.Context, since int64, cb func(*events.XRPCStreamEvent) error, logFiles []LogFileRef) (*int64, error) {
+	return dp.playbackLogfiles(ctx, since, nil, cb, logFiles)
+}
+
+func (dp *DiskPersistence) playbackLogfiles(ctx context.Context, since int64, match func(string) bool, cb func(*events.XRPCStreamEvent) error, logFiles []LogFileRef) (*int64, error) {
 	for i, lf := range logFiles {
-		lastSeq, err := dp.readEventsFrom(ctx, since, filepath.Join(dp.primaryDir, lf.Path), cb)
+		key, err := dp.logFileKey(&lf)
+		if err != nil {
+			return nil, err
+		}
+		lastSeq, err := dp.readEventsFrom(ctx, since, filepath.Join(dp.primaryDir, lf.Path), key, match, cb)
 		if err != nil {
 			return nil, err
 		}
 		since = 0
 		if i == len(logFiles)-1 &&
 			lastSeq != nil &&
-			(*lastSeq-lf.SeqStart) == dp.eventsPerFile-1 {
+			*lastSeq > 0 && *lastSeq%dp.eventsPerFile == 0 {
 			// There may be more log files to read since the last one was full
 			return lastSeq, nil
 		}
@@ -674,21 +992,29 @@ func (dp *DiskPersistence) PlaybackLogfiles(ctx context.Context, since int64, cb
 }
 
 func postDoNotEmit(flags uint32) bool {
-	if flags&(EvtFlagRebased|EvtFlagTakedown) != 0 {
+	if flags&(EvtFlagRebased|EvtFlagTakedown|EvtFlagExpired) != 0 {
 		return true
 	}
 
 	return false
 }
 
-func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn string, cb func(*events.XRPCStreamEvent) error) (*int64, error) {
+func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn string, key cipher.AEAD, match func(string) bool, cb func(*events.XRPCStreamEvent) error) (*int64, error) {
 	fi, err := os.OpenFile(fn, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer fi.Close()
+
+	var paths map[int64][]string
+	if match != nil {
+		if paths, err = readPathIndex(fn); err != nil {
+			log.Warn("failed to read path index, decoding all commits", "file", fn, "err", err)
+		}
+	}
 
 	if since != 0 {
-		lastSeq, err := scanForLastSeq(fi, since)
+		lastSeq, err := seekPastSeq(fi, since)
 		if err != nil {
 			return nil, err
 		}
@@ -719,8 +1045,15 @@ func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn s
 
 		lastSeq = h.Seq
 
-		if postDoNotEmit(h.Flags) {
-			// event taken down, skip
+		skip := postDoNotEmit(h.Flags)
+		if !skip && match != nil && h.Kind == evtKindCommit {
+			if ps, ok := paths[h.Seq]; ok && !anyPathMatches(match, ps) {
+				pathIndexFrames.WithLabelValues("skipped").Inc()
+				skip = true
+			}
+		}
+		if skip {
+			// event taken down, or not of the collections asked for
 			_, err := io.CopyN(io.Discard, bufr, h.Len64()) // would be really nice if the buffered reader had a 'skip' method that does a seek under the hood
 			if err != nil {
 				return nil, fmt.Errorf("failed while skipping event (seq: %d, fn: %q): %w", h.Seq, fn, err)
@@ -728,41 +1061,60 @@ func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn s
 			continue
 		}
 
+		payload, err := eventPayload(bufr, h, scratch, key)
+		if err != nil {
+			return nil, fmt.Errorf("reading event (fn: %q): %w", fn, err)
+		}
+		var region string
+		if h.Flags&EvtFlagRegion != 0 {
+			if region, err = readRegion(payload); err != nil {
+				return nil, fmt.Errorf("reading region of event %d (fn: %q): %w", h.Seq, fn, err)
+			}
+		}
+
 		switch h.Kind {
 		case evtKindCommit:
 			var evt atproto.SyncSubscribeRepos_Commit
-			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+			if err := evt.UnmarshalCBOR(payload); err != nil {
 				return nil, err
 			}
 			evt.Seq = h.Seq
-			if err := cb(&events.XRPCStreamEvent{RepoCommit: &evt}); err != nil {
+			e := &events.XRPCStreamEvent{RepoCommit: &evt, PrivRegion: region}
+			if match != nil {
+				if !e.MatchesPaths(match) {
+					pathIndexFrames.WithLabelValues("decoded_skipped").Inc()
+					continue
+				}
+				pathIndexFrames.WithLabelValues("matched").Inc()
+			}
+			if err := cb(e); err != nil {
 				return nil, err
 			}
 		case evtKindSync:
 			var evt atproto.SyncSubscribeRepos_Sync
-			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+			if err := evt.UnmarshalCBOR(payload); err != nil {
 				return nil, err
 			}
 			evt.Seq = h.Seq
-			if err := cb(&events.XRPCStreamEvent{RepoSync: &evt}); err != nil {
+			if err := cb(&events.XRPCStreamEvent{RepoSync: &evt, PrivRegion: region}); err != nil {
 				return nil, err
 			}
 		case evtKindIdentity:
 			var evt atproto.SyncSubscribeRepos_Identity
-			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+			if err := evt.UnmarshalCBOR(payload); err != nil {
 				return nil, err
 			}
 			evt.Seq = h.Seq
-			if err := cb(&events.XRPCStreamEvent{RepoIdentity: &evt}); err != nil {
+			if err := cb(&events.XRPCStreamEvent{RepoIdentity: &evt, PrivRegion: region}); err != nil {
 				return nil, err
 			}
 		case evtKindAccount:
 			var evt atproto.SyncSubscribeRepos_Account
-			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+			if err := evt.UnmarshalCBOR(payload); err != nil {
 				return nil, err
 			}
 			evt.Seq = h.Seq
-			if err := cb(&events.XRPCStreamEvent{RepoAccount: &evt}); err != nil {
+			if err := cb(&events.XRPCStreamEvent{RepoAccount: &evt, PrivRegion: region}); err != nil {
 				return nil, err
 			}
 		default:
@@ -781,6 +1133,8 @@ type UserAction struct {
 }
 
 func (dp *DiskPersistence) TakeDownRepo(ctx context.Context, usr models.Uid) error {
+	dp.sweepLk.Lock()
+	defer dp.sweepLk.Unlock()
 	/*
 		if err := p.meta.Create(&UserAction{
 			Usr:      usr,
@@ -866,16 +1220,25 @@ func (dp *DiskPersistence) mutateUserEventsInLog(ctx context.Context, usr models
 			return err
 		}
 
-		if h.Usr == usr && h.Flags&flag == 0 {
+		// events under legal hold are hidden but not erased; erasing again after the hold is released clears them
+		if h.Usr == usr && (h.Flags&flag == 0 || (zeroEvts && h.Flags&EvtFlagRetained != 0)) {
+			retain := zeroEvts && dp.held(h.Usr, h.Seq)
 			nflag := h.Flags | flag
+			if retain {
+				nflag |= EvtFlagRetained
+			} else {
+				nflag &^= EvtFlagRetained
+			}
 
-			binary.LittleEndian.PutUint32(scratch, nflag)
+			if nflag != h.Flags {
+				binary.LittleEndian.PutUint32(scratch, nflag)
 
-			if _, err := fi.WriteAt(scratch[:4], offset); err != nil {
-				return fmt.Errorf("failed to write updated flag value: %w", err)
+				if _, err := fi.WriteAt(scratch[:4], offset); err != nil {
+					return fmt.Errorf("failed to write updated flag value: %w", err)
+				}
 			}
 
-			if zeroEvts {
+			if zeroEvts && !retain {
 				// sync that write before blanking the event data
 				if err := fi.Sync(); err != nil {
 					return err
@@ -916,7 +1279,23 @@ func (dp *DiskPersistence) Shutdown(ctx context.Context) error {
 	}
 
 	dp.logfi.Close()
-	return nil
+	dp.idxfi.Close()
+	if dp.pathfi != nil {
+		dp.pathfi.Close()
+	}
+
+	// everything handed out has been written, so a restart can continue without a gap
+	return dp.seq.Stop(ctx)
+}
+
+// Backlog returns the number of events handed to Persist and not yet written out and broadcast.
+func (dp *DiskPersistence) Backlog() int64 {
+	return dp.backlog.Load()
+}
+
+// Sequencer returns the sequencer allocating the persisted events' sequence numbers
+func (dp *DiskPersistence) Sequencer() *sequencer.Sequencer {
+	return dp.seq
 }
 
 func (dp *DiskPersistence) SetEventBroadcaster(f func(*events.XRPCStreamEvent)) {
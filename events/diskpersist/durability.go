@@ -0,0 +1,76 @@
+package diskpersist
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Durability controls when persisted events reach the log file and stable storage. Events are only broadcast to live consumers once they have been written (and, where the mode calls for it, fsynced), so a consumer never sees an event that a crash could lose.
+type Durability int
+
+const (
+	// DurabilityBuffered writes batches to the OS every FlushInterval (or 400 events) without fsyncing. A process crash loses up to FlushInterval of events that were accepted but not yet written; a power loss or kernel crash can additionally lose whatever the OS had not yet written back, typically up to ~30s.
+	DurabilityBuffered Durability = iota
+	// DurabilityGroupCommit writes and fsyncs batches every FlushInterval (or 400 events). A crash of any kind loses at most the events accepted since the last group commit, up to FlushInterval.
+	DurabilityGroupCommit
+	// DurabilitySync writes and fsyncs each event before Persist returns. Nothing that was acknowledged is lost, at the cost of one fsync per event.
+	DurabilitySync
+)
+
+func (d Durability) String() string {
+	switch d {
+	case DurabilityBuffered:
+		return "buffered"
+	case DurabilityGroupCommit:
+		return "group"
+	case DurabilitySync:
+		return "sync"
+	default:
+		return fmt.Sprintf("durability(%d)", int(d))
+	}
+}
+
+// ParseDurability parses a durability mode name: buffered, group, or sync
+func ParseDurability(s string) (Durability, error) {
+	switch s {
+	case "buffered", "":
+		return DurabilityBuffered, nil
+	case "group":
+		return DurabilityGroupCommit, nil
+	case "sync":
+		return DurabilitySync, nil
+	default:
+		return 0, fmt.Errorf("unknown persister durability mode %q (expected buffered, group, or sync)", s)
+	}
+}
+
+var flushDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "disk_persister_flush_duration_seconds",
+	Help:    "Time taken to write a batch of events to the log, including fsync where the durability mode requires it",
+	Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+}, []string{"durability"})
+
+var fsyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "disk_persister_fsync_duration_seconds",
+	Help:    "Time taken to fsync the event log",
+	Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+})
+
+var flushBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "disk_persister_flush_batch_size",
+	Help:    "Number of events written per flush",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+}, []string{"durability"})
+
+// syncDir fsyncs a directory so that newly created files in it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,162 @@
+package diskpersist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/sequencer"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// crash simulates the process dying: background routines stop and anything still buffered in memory is dropped without being written
+func crash(dp *DiskPersistence) {
+	close(dp.shutdown)
+	dp.lk.Lock()
+	defer dp.lk.Unlock()
+	dp.outbuf.Reset()
+	dp.evtbuf = nil
+	dp.idxbuf = nil
+	dp.logfi.Close()
+	dp.idxfi.Close()
+}
+
+func openDurabilityTestPersister(t *testing.T, db *gorm.DB, dir string, mode Durability, interval time.Duration) *DiskPersistence {
+	dp, err := NewDiskPersistence(filepath.Join(dir, "diskPrimary"), filepath.Join(dir, "diskArchive"), db, &DiskPersistOptions{
+		EventsPerFile: 10,
+		UIDCacheSize:  1000,
+		DIDCacheSize:  1000,
+		Durability:    mode,
+		FlushInterval: interval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+	return dp
+}
+
+func TestParseDurability(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, mode := range []Durability{DurabilityBuffered, DurabilityGroupCommit, DurabilitySync} {
+		parsed, err := ParseDurability(mode.String())
+		assert.NoError(err)
+		assert.Equal(mode, parsed)
+	}
+
+	_, err := ParseDurability("fsync")
+	assert.Error(err)
+}
+
+func TestCrashRecovery(t *testing.T) {
+	for _, mode := range []Durability{DurabilityBuffered, DurabilityGroupCommit, DurabilitySync} {
+		t.Run(mode.String(), func(t *testing.T) {
+			assert := assert.New(t)
+			db, dir := setupSeqTest(t)
+
+			// an interval long enough that only explicit flushes happen
+			dp := openDurabilityTestPersister(t, db, dir, mode, time.Hour)
+			persistIdentityEvents(t, dp, 25)
+			persistUnflushed(t, dp, 3)
+			if mode == DurabilitySync {
+				assert.Equal(int64(0), dp.Backlog())
+			} else {
+				assert.Equal(int64(3), dp.Backlog())
+			}
+			crash(dp)
+
+			dp = openDurabilityTestPersister(t, db, dir, mode, time.Hour)
+			seqs := playbackSeqs(t, dp, 0)
+			if mode == DurabilitySync {
+				// every acknowledged event was written
+				assert.Len(seqs, 28)
+			} else {
+				// events accepted since the last flush are the loss window
+				assert.Len(seqs, 25)
+			}
+
+			// the sequence continues after the numbers reserved before the crash, which are recorded as skipped
+			last := seqs[len(seqs)-1]
+			persistIdentityEvents(t, dp, 1)
+			seqs = playbackSeqs(t, dp, 0)
+			for i := 1; i < len(seqs)-1; i++ {
+				assert.Equal(seqs[i-1]+1, seqs[i])
+			}
+			next := sequencer.DefaultOptions().BlockSize + 1
+			assert.Equal(next, seqs[len(seqs)-1])
+			gaps, err := dp.Sequencer().Gaps(context.Background(), 0, 10)
+			assert.NoError(err)
+			if assert.Len(gaps, 1) {
+				assert.Equal(last+1, gaps[0].First)
+				assert.Equal(next-1, gaps[0].Last)
+				assert.Equal(sequencer.GapRestart, gaps[0].Reason)
+			}
+		})
+	}
+}
+
+func TestFlushIntervalBoundsLossWindow(t *testing.T) {
+	for _, mode := range []Durability{DurabilityBuffered, DurabilityGroupCommit} {
+		t.Run(mode.String(), func(t *testing.T) {
+			assert := assert.New(t)
+			db, dir := setupSeqTest(t)
+
+			dp := openDurabilityTestPersister(t, db, dir, mode, time.Millisecond*10)
+			persistUnflushed(t, dp, 5)
+			assert.Eventually(func() bool {
+				dp.lk.Lock()
+				defer dp.lk.Unlock()
+				return len(dp.evtbuf) == 0
+			}, time.Second, time.Millisecond*5)
+			crash(dp)
+
+			dp = openDurabilityTestPersister(t, db, dir, mode, time.Hour)
+			assert.Len(playbackSeqs(t, dp, 0), 5)
+		})
+	}
+}
+
+func TestTornWriteRecovery(t *testing.T) {
+	for _, torn := range []struct {
+		name string
+		tail []byte
+	}{
+		{"partial header", []byte{1, 2, 3, 4, 5}},
+		// a complete header claiming a 1000 byte body, followed by only part of it
+		{"partial body", append([]byte{0, 0, 0, 0, evtKindIdentity, 0, 0, 0, 0xe8, 0x03, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 24, 0, 0, 0, 0, 0, 0, 0}, make([]byte, 100)...)},
+	} {
+		t.Run(torn.name, func(t *testing.T) {
+			assert := assert.New(t)
+			db, dir := setupSeqTest(t)
+
+			dp := openDurabilityTestPersister(t, db, dir, DurabilitySync, time.Hour)
+			persistUnflushed(t, dp, 23)
+			logPath := dp.logfi.Name()
+			crash(dp)
+
+			fi, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fi.Write(torn.tail); err != nil {
+				t.Fatal(err)
+			}
+			fi.Close()
+
+			dp = openDurabilityTestPersister(t, db, dir, DurabilitySync, time.Hour)
+			persistUnflushed(t, dp, 2)
+
+			seqs := playbackSeqs(t, dp, 0)
+			if assert.Len(seqs, 25) {
+				assert.Equal(int64(23), seqs[22])
+				assert.Equal(sequencer.DefaultOptions().BlockSize+2, seqs[24])
+			}
+			assert.Len(playbackSeqs(t, dp, 22), 3)
+		})
+	}
+}
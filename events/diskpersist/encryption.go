@@ -0,0 +1,127 @@
+package diskpersist
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Encrypted events keep their header in the clear, so takedowns, retention sweeps and recovery work without the keys. The payload is a random nonce followed by the AES-GCM sealed event, under the data key of the log file it was written to. The event's kind, account and sequence number are authenticated with it, so encrypted payloads can't be moved between events.
+const eventNonceSize = 12
+
+var eventDecryptionErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "disk_persister_event_decryption_errors",
+	Help: "Encrypted events which could not be decrypted during playback",
+})
+
+// eventAAD is the additional data authenticated with an encrypted event: its kind, account and sequence number. Flags change after the event is written, and the length is covered by the AEAD itself
+func eventAAD(hdr []byte) []byte {
+	aad := make([]byte, 0, 20)
+	aad = append(aad, hdr[4:8]...)
+	return append(aad, hdr[12:headerSize]...)
+}
+
+// newLogDataKey generates the data key for a new log file, returning it wrapped for its LogFileRef. Without a keyring, events are written in the clear
+func (dp *DiskPersistence) newLogDataKey() (cipher.AEAD, []byte, error) {
+	if dp.keys == nil {
+		return nil, nil, nil
+	}
+	return dp.keys.NewDataKey()
+}
+
+// logFileKey returns the data key of a log file, or nil if it has none
+func (dp *DiskPersistence) logFileKey(r *LogFileRef) (cipher.AEAD, error) {
+	if len(r.DataKey) == 0 {
+		return nil, nil
+	}
+	if k, ok := dp.fileKeys.Load(r.ID); ok {
+		return k.(cipher.AEAD), nil
+	}
+	if dp.keys == nil {
+		return nil, fmt.Errorf("log file %s is encrypted, but no keyring is configured", r.Path)
+	}
+	k, err := dp.keys.UnwrapDataKey(r.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("log file %s: %w", r.Path, err)
+	}
+	dp.fileKeys.Store(r.ID, k)
+	return k, nil
+}
+
+// sealEvent encrypts the payload of a framed event under the current log file's data key, once its sequence number is set
+func (dp *DiskPersistence) sealEvent(b []byte) ([]byte, error) {
+	out := make([]byte, headerSize+eventNonceSize, headerSize+eventNonceSize+len(b)-headerSize+dp.logKey.Overhead())
+	copy(out, b[:headerSize])
+	nonce := out[headerSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = dp.logKey.Seal(out, nonce, b[headerSize:], eventAAD(b))
+
+	binary.LittleEndian.PutUint32(out, binary.LittleEndian.Uint32(out)|EvtFlagEncrypted)
+	binary.LittleEndian.PutUint32(out[8:], uint32(len(out)-headerSize))
+	return out, nil
+}
+
+// eventPayload returns a reader over the event's plaintext, decrypting it if needed. scratch holds the header just read
+func eventPayload(r io.Reader, h *evtHeader, scratch []byte, key cipher.AEAD) (io.Reader, error) {
+	if h.Flags&EvtFlagEncrypted == 0 {
+		return io.LimitReader(r, h.Len64()), nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("event %d is encrypted, but its log file has no data key", h.Seq)
+	}
+	buf := make([]byte, h.Len)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if len(buf) < eventNonceSize {
+		eventDecryptionErrors.Inc()
+		return nil, fmt.Errorf("event %d: encrypted payload too short", h.Seq)
+	}
+	pt, err := key.Open(buf[eventNonceSize:eventNonceSize], buf[:eventNonceSize], buf[eventNonceSize:], eventAAD(scratch))
+	if err != nil {
+		eventDecryptionErrors.Inc()
+		return nil, fmt.Errorf("decrypting event %d: %w", h.Seq, err)
+	}
+	return bytes.NewReader(pt), nil
+}
+
+// RewrapKeys re-wraps the data keys of log files under the keyring's primary key, so keys rotated out of the keyring can be retired. The events themselves aren't rewritten. Returns the number of log files updated.
+func (dp *DiskPersistence) RewrapKeys(ctx context.Context) (int, error) {
+	if dp.keys == nil {
+		return 0, fmt.Errorf("no keyring configured")
+	}
+	var refs []LogFileRef
+	if err := dp.meta.WithContext(ctx).Select("id", "path", "data_key").Where("data_key IS NOT NULL").Find(&refs).Error; err != nil {
+		return 0, err
+	}
+	var n int
+	for _, r := range refs {
+		if len(r.DataKey) == 0 {
+			continue
+		}
+		wrapped, changed, err := dp.keys.Rewrap(r.DataKey)
+		if err != nil {
+			return n, fmt.Errorf("log file %s: %w", r.Path, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := dp.meta.WithContext(ctx).Model(&LogFileRef{}).Where("id = ?", r.ID).Update("data_key", wrapped).Error; err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Info("re-wrapped log file data keys", "files", n, "key", dp.keys.Primary())
+	}
+	return n, nil
+}
@@ -0,0 +1,116 @@
+package diskpersist
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/keymgmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newEncryptedTestPersister(db *gorm.DB, dir string, kr *keymgmt.Keyring) (*DiskPersistence, error) {
+	return NewDiskPersistence(filepath.Join(dir, "diskPrimary"), filepath.Join(dir, "diskArchive"), db, &DiskPersistOptions{
+		EventsPerFile: 10,
+		UIDCacheSize:  1000,
+		DIDCacheSize:  1000,
+		Keyring:       kr,
+	})
+}
+
+func openEncryptedTestPersister(t *testing.T, db *gorm.DB, dir string, kr *keymgmt.Keyring) *DiskPersistence {
+	dp, err := newEncryptedTestPersister(db, dir, kr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+	return dp
+}
+
+func testKeyring(t *testing.T, primary string, ids ...string) *keymgmt.Keyring {
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), keymgmt.KeySize)
+	}
+	kr, err := keymgmt.NewKeyring(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestEncryptedPlayback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	// events written before encryption was enabled stay readable
+	dp := openSeqTestPersister(t, db, dir, 10)
+	persistIdentityEvents(t, dp, 5)
+	assert.NoError(dp.Shutdown(ctx))
+
+	k1 := testKeyring(t, "k1", "k1")
+	dp = openEncryptedTestPersister(t, db, dir, k1)
+	persistIdentityEvents(t, dp, 10)
+	assert.Equal([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, playbackSeqs(t, dp, 0))
+	assert.Equal([]int64{13, 14, 15}, playbackSeqs(t, dp, 12))
+	assert.NoError(dp.Shutdown(ctx))
+
+	raw, err := os.ReadFile(filepath.Join(dir, "diskPrimary", "evts-11"))
+	assert.NoError(err)
+	assert.NotEmpty(raw)
+	assert.False(bytes.Contains(raw, []byte("did:example:123")))
+
+	// rotate: the old key stays readable until the data keys are re-wrapped
+	k2 := testKeyring(t, "k2", "k1", "k2")
+	dp = openEncryptedTestPersister(t, db, dir, k2)
+	assert.Len(playbackSeqs(t, dp, 0), 15)
+	n, err := dp.RewrapKeys(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	n, err = dp.RewrapKeys(ctx)
+	assert.NoError(err)
+	assert.Equal(0, n)
+	assert.NoError(dp.Shutdown(ctx))
+
+	dp = openEncryptedTestPersister(t, db, dir, testKeyring(t, "k2", "k2"))
+	assert.Len(playbackSeqs(t, dp, 0), 15)
+
+	// takedowns only need the headers
+	assert.NoError(dp.TakeDownRepo(ctx, 1))
+	assert.Empty(playbackSeqs(t, dp, 0))
+	assert.NoError(dp.Shutdown(ctx))
+}
+
+func TestEncryptedPlaybackErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	dp := openEncryptedTestPersister(t, db, dir, testKeyring(t, "k1", "k1"))
+	persistIdentityEvents(t, dp, 3)
+	assert.NoError(dp.Shutdown(ctx))
+
+	noop := func(*events.XRPCStreamEvent) error { return nil }
+
+	// the current log file's data key must be available to resume writing it
+	_, err := newEncryptedTestPersister(db, dir, testKeyring(t, "k2", "k2"))
+	assert.ErrorIs(err, keymgmt.ErrUnknownKey)
+	_, err = newEncryptedTestPersister(db, dir, nil)
+	assert.Error(err)
+
+	// flip a byte of the last event's ciphertext
+	fn := filepath.Join(dir, "diskPrimary", "evts-0")
+	raw, err := os.ReadFile(fn)
+	assert.NoError(err)
+	raw[len(raw)-1] ^= 0xff
+	assert.NoError(os.WriteFile(fn, raw, 0664))
+
+	dp = openEncryptedTestPersister(t, db, dir, testKeyring(t, "k1", "k1"))
+	assert.Error(dp.Playback(ctx, 0, noop))
+	assert.NoError(dp.Shutdown(ctx))
+}
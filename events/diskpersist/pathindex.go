@@ -0,0 +1,137 @@
+package diskpersist
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Each log file also has a sidecar path index, listing the op paths (collection/rkey) of its commits, so playback for narrow subscriptions can skip commits without reading them. Entries are variable length: the seq, the number of ops, then each path prefixed with its length. Like the sequence index, it is appended after the events it describes, so it may lag the log file and end in a torn entry; commits missing from it are read and matched as usual. Encrypted logs get no path index, as it would hold the paths in the clear.
+
+func pathIndexPath(logPath string) string {
+	return logPath + ".paths"
+}
+
+var pathIndexFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "disk_persister_path_playback_frames",
+	Help: "Commits read by path-filtered playback, by outcome: skipped by the path index, skipped after decoding (not in the index), or matched",
+}, []string{"outcome"})
+
+// appendPathIndexEntry appends a commit's entry, unless its ops can't be represented, leaving it to be decoded on playback
+func appendPathIndexEntry(buf []byte, seq int64, ops []*atproto.SyncSubscribeRepos_RepoOp) []byte {
+	if len(ops) > 0xffff {
+		return buf
+	}
+	for _, op := range ops {
+		if len(op.Path) > 0xffff {
+			return buf
+		}
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(seq))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ops)))
+	for _, op := range ops {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(op.Path)))
+		buf = append(buf, op.Path...)
+	}
+	return buf
+}
+
+// nextPathIndexEntry parses the entry at the start of b, returning its length; ok is false if b doesn't hold a complete entry
+func nextPathIndexEntry(b []byte) (seq int64, paths []string, n int, ok bool) {
+	if len(b) < 10 {
+		return 0, nil, 0, false
+	}
+	seq = int64(binary.LittleEndian.Uint64(b))
+	count := int(binary.LittleEndian.Uint16(b[8:]))
+	n = 10
+	paths = make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if len(b)-n < 2 {
+			return 0, nil, 0, false
+		}
+		l := int(binary.LittleEndian.Uint16(b[n:]))
+		n += 2
+		if len(b)-n < l {
+			return 0, nil, 0, false
+		}
+		paths = append(paths, string(b[n:n+l]))
+		n += l
+	}
+	return seq, paths, n, true
+}
+
+// readPathIndex reads the path index of a log file, returning the op paths of its commits by seq; nil if it has none
+func readPathIndex(logPath string) (map[int64][]string, error) {
+	b, err := os.ReadFile(pathIndexPath(logPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	index := make(map[int64][]string)
+	for {
+		seq, paths, n, ok := nextPathIndexEntry(b)
+		if !ok {
+			// a torn trailing entry
+			return index, nil
+		}
+		index[seq] = paths
+		b = b[n:]
+	}
+}
+
+// truncatePathIndex drops a torn trailing entry from a log file's path index, and the entries of events past lastSeq, which were lost from the log
+func truncatePathIndex(logPath string, lastSeq int64) error {
+	p := pathIndexPath(logPath)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var out []byte
+	for rest := b; ; {
+		seq, _, n, ok := nextPathIndexEntry(rest)
+		if !ok {
+			break
+		}
+		if seq <= lastSeq {
+			out = append(out, rest[:n]...)
+		}
+		rest = rest[n:]
+	}
+	if len(out) == len(b) {
+		return nil
+	}
+	return os.WriteFile(p, out, 0664)
+}
+
+// openPathIndex opens a log file's path index for appending, creating it if needed; nil for encrypted logs
+func (dp *DiskPersistence) openPathIndex(logPath string) (*os.File, error) {
+	if dp.keys != nil {
+		return nil, nil
+	}
+	return os.OpenFile(pathIndexPath(logPath), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
+}
+
+// PlaybackPaths is Playback for a subscription to some collections: commits none of whose op paths (collection/rkey) match are left out, those listed in the path index without being read. Other events are all passed to cb.
+func (dp *DiskPersistence) PlaybackPaths(ctx context.Context, since int64, match func(path string) bool, cb func(*events.XRPCStreamEvent) error) error {
+	return dp.playback(ctx, since, match, cb)
+}
+
+func anyPathMatches(match func(string) bool, paths []string) bool {
+	for _, p := range paths {
+		if match(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package diskpersist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+)
+
+// persistCommits persists n commits, every tenth of app.gndr.feed.post records and the rest of app.gndr.feed.like records, each with a kilobyte of blocks
+func persistCommits(tb testing.TB, dp *DiskPersistence, n int) {
+	ctx := context.Background()
+	blocks := make([]byte, 1024)
+	c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(blocks)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		collection := "app.gndr.feed.like"
+		if i%10 == 0 {
+			collection = "app.gndr.feed.post"
+		}
+		if err := dp.Persist(ctx, &events.XRPCStreamEvent{
+			RepoCommit: &atproto.SyncSubscribeRepos_Commit{
+				Repo:   "did:example:123",
+				Commit: lexutil.LexLink(c),
+				Blocks: blocks,
+				Ops: []*atproto.SyncSubscribeRepos_RepoOp{
+					{Action: "create", Path: fmt.Sprintf("%s/%d", collection, i)},
+				},
+				Time: "2024-01-01T00:00:00Z",
+			},
+		}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := dp.Flush(ctx); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func matchPosts(path string) bool {
+	return strings.HasPrefix(path, "app.gndr.feed.post/")
+}
+
+func playbackPaths(t *testing.T, dp *DiskPersistence, since int64) []int64 {
+	var seqs []int64
+	if err := dp.PlaybackPaths(context.Background(), since, matchPosts, func(evt *events.XRPCStreamEvent) error {
+		seqs = append(seqs, evt.Sequence())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return seqs
+}
+
+func TestPathIndexPlayback(t *testing.T) {
+	assert := assert.New(t)
+	db, dir := setupSeqTest(t)
+
+	dp := openSeqTestPersister(t, db, dir, 100)
+	persistCommits(t, dp, 150)
+	persistIdentityEvents(t, dp, 1)
+
+	expected := []int64{1, 11, 21, 31, 41, 51, 61, 71, 81, 91, 101, 111, 121, 131, 141, 151}
+	assert.Equal(expected, playbackPaths(t, dp, 0))
+	assert.Equal(expected[5:], playbackPaths(t, dp, 50))
+
+	// commits missing from the index, after a torn entry, are decoded and matched
+	pathPath := pathIndexPath(dp.logfi.Name())
+	st, err := os.Stat(pathPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(pathPath, st.Size()-100); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(expected, playbackPaths(t, dp, 0))
+	index, err := readPathIndex(dp.logfi.Name())
+	assert.NoError(err)
+	assert.NotEmpty(index)
+	assert.Less(len(index), 50)
+
+	// a resumed log drops the torn entry and keeps appending
+	if err := dp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dp = openSeqTestPersister(t, db, dir, 100)
+	persistCommits(t, dp, 10)
+	index, err = readPathIndex(dp.logfi.Name())
+	assert.NoError(err)
+	assert.Equal([]string{"app.gndr.feed.post/0"}, index[152])
+	assert.Equal(append(expected, 152), playbackPaths(t, dp, 0))
+
+	// without a match, playback is unchanged
+	var all int
+	assert.NoError(dp.Playback(context.Background(), 0, func(*events.XRPCStreamEvent) error {
+		all++
+		return nil
+	}))
+	assert.Equal(161, all)
+}
+
+func TestPathIndexRecovery(t *testing.T) {
+	assert := assert.New(t)
+	db, dir := setupSeqTest(t)
+
+	dp := openSeqTestPersister(t, db, dir, 100)
+	persistCommits(t, dp, 5)
+	logPath := dp.logfi.Name()
+	idx, err := os.ReadFile(seqIndexPath(logPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.Shutdown(context.Background())
+
+	// the log loses its last two events, which the path index still lists
+	_, off := indexEntryAt(idx, 3)
+	if err := os.Truncate(logPath, off); err != nil {
+		t.Fatal(err)
+	}
+	dp = openSeqTestPersister(t, db, dir, 100)
+	assert.Equal(int64(3), dp.LastRecovery().LastSeq)
+	index, err := readPathIndex(logPath)
+	assert.NoError(err)
+	assert.Len(index, 3)
+	assert.NotContains(index, int64(4))
+}
+
+// BenchmarkPathPlayback compares replaying a large log file for a consumer of one collection, carried by a tenth of the commits, with and without the path index.
+func BenchmarkPathPlayback(b *testing.B) {
+	db, dir := setupSeqTest(b)
+
+	const n = 20_000
+	dp := openSeqTestPersister(b, db, dir, n+1)
+	persistCommits(b, dp, n)
+	ctx := context.Background()
+
+	replay := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var got int
+			if err := dp.PlaybackPaths(ctx, 0, matchPosts, func(*events.XRPCStreamEvent) error {
+				got++
+				return nil
+			}); err != nil {
+				b.Fatal(err)
+			}
+			if got != n/10 {
+				b.Fatalf("played back %d commits, expected %d", got, n/10)
+			}
+		}
+	}
+	b.Run("index", replay)
+
+	if err := os.Remove(pathIndexPath(dp.logfi.Name())); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("decode", replay)
+}
@@ -0,0 +1,141 @@
+package diskpersist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RecoveryReport describes what the startup recovery scan found and repaired in the current log file
+type RecoveryReport struct {
+	File            string
+	LastSeq         int64 // -1 for an empty log
+	Size            int64 // length of the log after repair
+	TruncatedBytes  int64 // partial or invalid frames removed from the end of the log
+	IndexVerified   int   // index entries that matched the log
+	IndexDiscarded  int   // index entries that did not match a valid frame
+	IndexRecovered  int   // entries added for frames missing from the index
+	IndexTruncBytes int64 // torn trailing bytes in the index file
+}
+
+func (r *RecoveryReport) Repaired() bool {
+	return r.TruncatedBytes > 0 || r.IndexDiscarded > 0 || r.IndexRecovered > 0 || r.IndexTruncBytes > 0
+}
+
+var recoveryTruncatedBytes = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "disk_persister_recovery_truncated_bytes",
+	Help: "Bytes of partial or invalid frames truncated from the event log during startup recovery",
+})
+
+var recoveryIndexRepairs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "disk_persister_recovery_index_repairs",
+	Help: "Sequence index entries repaired during startup recovery",
+}, []string{"repair"})
+
+// validFrame reports whether a header read at offset could have been written by doPersist. A power loss can leave the end of a file zero-filled or holding stale blocks, which fail the kind or sequence checks.
+func validFrame(eh *evtHeader, offset, size, lastSeq int64) bool {
+	switch eh.Kind {
+	case evtKindCommit, evtKindHandle, evtKindTombstone, evtKindIdentity, evtKindAccount, evtKindSync:
+	default:
+		return false
+	}
+	// older logs could repeat a seq across a restart, so only reject going backwards
+	if lastSeq != -1 && eh.Seq < lastSeq {
+		return false
+	}
+	return offset+headerSize+eh.Len64() <= size
+}
+
+// recoverLog scans the current log file on startup, truncating any partially written or invalid frames at its end, and checks the sequence index against the frames found before rewriting it. The path index loses entries of truncated frames. Leaves fi at the end of the log.
+func recoverLog(fi *os.File) (*RecoveryReport, error) {
+	st, err := fi.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+
+	report := &RecoveryReport{
+		File:    fi.Name(),
+		LastSeq: -1,
+	}
+
+	var old []byte
+	idxPath := seqIndexPath(fi.Name())
+	if b, err := os.ReadFile(idxPath); err == nil {
+		report.IndexTruncBytes = int64(len(b) % seqIndexEntrySize)
+		old = b[:len(b)-len(b)%seqIndexEntrySize]
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading sequence index: %w", err)
+	}
+
+	if _, err := fi.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	scratch := make([]byte, headerSize)
+	var idx []byte
+	var offset int64
+	matching := true
+	for offset < size {
+		eh, err := readHeader(fi, scratch)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		if err != nil || !validFrame(eh, offset, size, report.LastSeq) {
+			break
+		}
+
+		idx = appendSeqIndexEntry(idx, eh.Seq, offset)
+		if matching {
+			n := len(idx)
+			if n <= len(old) && string(old[n-seqIndexEntrySize:n]) == string(idx[n-seqIndexEntrySize:]) {
+				report.IndexVerified++
+			} else {
+				matching = false
+			}
+		}
+
+		report.LastSeq = eh.Seq
+		offset += headerSize + eh.Len64()
+		if _, err := fi.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Size = offset
+	report.TruncatedBytes = size - offset
+	report.IndexDiscarded = len(old)/seqIndexEntrySize - report.IndexVerified
+	report.IndexRecovered = len(idx)/seqIndexEntrySize - report.IndexVerified
+
+	if report.TruncatedBytes > 0 {
+		if err := fi.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("truncating partial frames: %w", err)
+		}
+		if _, err := fi.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.WriteFile(idxPath, idx, 0664); err != nil {
+		return nil, fmt.Errorf("writing sequence index: %w", err)
+	}
+	if err := truncatePathIndex(fi.Name(), report.LastSeq); err != nil {
+		return nil, fmt.Errorf("repairing path index: %w", err)
+	}
+
+	if report.IndexDiscarded > 0 {
+		// entries past the verified prefix point at frames that are gone or were rewritten
+		_, off := indexEntryAt(old, report.IndexVerified)
+		log.Warn("sequence index does not match log file", "file", report.File, "firstMismatchOffset", off, "discarded", report.IndexDiscarded)
+	}
+
+	recoveryTruncatedBytes.Add(float64(report.TruncatedBytes))
+	recoveryIndexRepairs.WithLabelValues("discarded").Add(float64(report.IndexDiscarded))
+	recoveryIndexRepairs.WithLabelValues("recovered").Add(float64(report.IndexRecovered))
+
+	return report, nil
+}
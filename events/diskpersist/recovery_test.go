@@ -0,0 +1,118 @@
+package diskpersist
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/events/sequencer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryCleanRestart(t *testing.T) {
+	assert := assert.New(t)
+	db, dir := setupSeqTest(t)
+
+	dp := openDurabilityTestPersister(t, db, dir, DurabilityBuffered, time.Hour)
+	assert.Nil(dp.LastRecovery())
+	persistIdentityEvents(t, dp, 15)
+	if err := dp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dp = openDurabilityTestPersister(t, db, dir, DurabilityBuffered, time.Hour)
+	report := dp.LastRecovery()
+	assert.False(report.Repaired())
+	assert.Equal(int64(15), report.LastSeq)
+	assert.Equal(5, report.IndexVerified)
+}
+
+func TestRecoveryRepairs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// damage simulates a power loss against a log of 5 events, given the paths of the current log and its index and the index entries
+		damage    func(t *testing.T, logPath, idxPath string, idx []byte)
+		expect    RecoveryReport
+		recovered int
+	}{
+		{
+			name: "zero-filled tail",
+			damage: func(t *testing.T, logPath, idxPath string, idx []byte) {
+				st, err := os.Stat(logPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(logPath, st.Size()+4096); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expect:    RecoveryReport{LastSeq: 5, TruncatedBytes: 4096, IndexVerified: 5},
+			recovered: 5,
+		},
+		{
+			name: "index ahead of log",
+			damage: func(t *testing.T, logPath, idxPath string, idx []byte) {
+				_, off := indexEntryAt(idx, 3)
+				if err := os.Truncate(logPath, off); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expect:    RecoveryReport{LastSeq: 3, IndexVerified: 3, IndexDiscarded: 2},
+			recovered: 3,
+		},
+		{
+			name: "index behind log",
+			damage: func(t *testing.T, logPath, idxPath string, idx []byte) {
+				torn := append(idx[:4*seqIndexEntrySize:4*seqIndexEntrySize], 1, 2, 3, 4, 5)
+				if err := os.WriteFile(idxPath, torn, 0664); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expect:    RecoveryReport{LastSeq: 5, IndexVerified: 4, IndexRecovered: 1, IndexTruncBytes: 5},
+			recovered: 5,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			db, dir := setupSeqTest(t)
+
+			dp := openDurabilityTestPersister(t, db, dir, DurabilitySync, time.Hour)
+			persistUnflushed(t, dp, 5)
+			logPath := dp.logfi.Name()
+			idxPath := seqIndexPath(logPath)
+			crash(dp)
+
+			idx, err := os.ReadFile(idxPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.damage(t, logPath, idxPath, idx)
+
+			dp = openDurabilityTestPersister(t, db, dir, DurabilitySync, time.Hour)
+			report := dp.LastRecovery()
+			assert.True(report.Repaired())
+			assert.Equal(tc.expect.LastSeq, report.LastSeq)
+			assert.Equal(tc.expect.TruncatedBytes, report.TruncatedBytes)
+			assert.Equal(tc.expect.IndexVerified, report.IndexVerified)
+			assert.Equal(tc.expect.IndexDiscarded, report.IndexDiscarded)
+			assert.Equal(tc.expect.IndexRecovered, report.IndexRecovered)
+			assert.Equal(tc.expect.IndexTruncBytes, report.IndexTruncBytes)
+
+			st, err := os.Stat(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(report.Size, st.Size())
+
+			// replay sees only whole frames, and new events follow them, after the numbers reserved before the crash
+			next := sequencer.DefaultOptions().BlockSize + 1
+			persistUnflushed(t, dp, 1)
+			seqs := playbackSeqs(t, dp, 0)
+			if assert.Len(seqs, tc.recovered+1) {
+				assert.Equal(next, seqs[len(seqs)-1])
+			}
+			assert.Equal([]int64{next}, playbackSeqs(t, dp, tc.expect.LastSeq))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package diskpersist
+
+import (
+	"fmt"
+	"io"
+)
+
+// RegionLookup returns the ISO 3166-2 classification region of an account (eg, "CA-QC"), or "" if it is unclassified.
+type RegionLookup func(did string) string
+
+// SetRegionLookup installs the lookup used to record each account's classification region with the events persisted from then on, so replay can serve the classification the event was persisted under. Events persisted without one carry no region.
+func (dp *DiskPersistence) SetRegionLookup(fn RegionLookup) {
+	dp.regions.Store(&fn)
+}
+
+func (dp *DiskPersistence) region(did string) string {
+	fn := dp.regions.Load()
+	if fn == nil || *fn == nil {
+		return ""
+	}
+	r := (*fn)(did)
+	if len(r) > 255 {
+		return ""
+	}
+	return r
+}
+
+// readRegion consumes the region prefix of an EvtFlagRegion payload
+func readRegion(r io.Reader) (string, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n[0])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", fmt.Errorf("truncated region: %w", err)
+	}
+	return string(buf), nil
+}
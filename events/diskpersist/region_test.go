@@ -0,0 +1,40 @@
+package diskpersist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionPlayback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	// events persisted before a lookup is installed carry no region
+	dp := openSeqTestPersister(t, db, dir, 10)
+	persistIdentityEvents(t, dp, 2)
+
+	region := "CA-QC"
+	dp.SetRegionLookup(func(did string) string { return region })
+	persistIdentityEvents(t, dp, 2)
+	region = ""
+	persistIdentityEvents(t, dp, 1)
+	region = "CA"
+	persistIdentityEvents(t, dp, 1)
+	assert.NoError(dp.Shutdown(ctx))
+
+	// and the region survives encryption at rest
+	dp = openEncryptedTestPersister(t, db, dir, testKeyring(t, "k1", "k1"))
+	dp.SetRegionLookup(func(did string) string { return "CA-QC" })
+	persistIdentityEvents(t, dp, 1)
+
+	var got []string
+	for _, e := range playbackAll(t, dp) {
+		assert.Equal("did:example:123", e.RepoIdentity.Did)
+		got = append(got, e.PrivRegion)
+	}
+	assert.Equal([]string{"", "", "CA-QC", "CA-QC", "", "CA", "CA-QC"}, got)
+	assert.NoError(dp.Shutdown(ctx))
+}
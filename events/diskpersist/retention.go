@@ -0,0 +1,439 @@
+package diskpersist
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RetentionRule overrides how long matching events stay available for playback.
+type RetentionRule struct {
+	// record collection NSID, a collection prefix ending in ".*" (eg "app.gndr.chat.*"), or an event kind: "#identity", "#account" or "#sync"
+	Match string `json:"match"`
+	// how long matching events are kept, rounded up to whole hours. 0 drops them from playback immediately; they are still broadcast live
+	TTL time.Duration `json:"ttl"`
+	// keep matching events for as long as the log exists, ignoring TTL
+	Forever bool `json:"forever"`
+}
+
+// UnmarshalJSON accepts TTLs as duration strings, eg "2160h"
+func (r *RetentionRule) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Match   string `json:"match"`
+		TTL     string `json:"ttl"`
+		Forever bool   `json:"forever"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*r = RetentionRule{Match: raw.Match, Forever: raw.Forever}
+	if raw.TTL != "" {
+		ttl, err := time.ParseDuration(raw.TTL)
+		if err != nil {
+			return fmt.Errorf("retention rule %q: %w", raw.Match, err)
+		}
+		r.TTL = ttl
+	}
+	return nil
+}
+
+// LoadRetentionRules reads a JSON array of rules from a file.
+func LoadRetentionRules(fname string) ([]RetentionRule, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RetentionRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parsing retention rules: %w", err)
+	}
+	if _, err := newRetentionPolicy(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Bits 16-31 of an event's header flags hold its retention class, fixed when the event is persisted: 0 for the default retention, retentionForever, or the TTL in hours plus one
+const (
+	retentionShift    = 16
+	retentionForever  = 0xffff
+	maxRetentionHours = retentionForever - 2
+)
+
+// retentionPolicy is the compiled form of a rule list
+type retentionPolicy struct {
+	exact map[string]RetentionRule
+	// longest prefix first
+	prefixes []RetentionRule
+}
+
+func newRetentionPolicy(rules []RetentionRule) (*retentionPolicy, error) {
+	p := &retentionPolicy{exact: make(map[string]RetentionRule)}
+	for _, r := range rules {
+		if r.TTL < 0 {
+			return nil, fmt.Errorf("retention rule %q: negative TTL", r.Match)
+		}
+		if !r.Forever && r.TTL > maxRetentionHours*time.Hour {
+			return nil, fmt.Errorf("retention rule %q: TTL longer than %d hours; use forever instead", r.Match, maxRetentionHours)
+		}
+		switch {
+		case r.Match == "#identity" || r.Match == "#account" || r.Match == "#sync":
+		case strings.HasSuffix(r.Match, ".*") && len(r.Match) > 2:
+			r.Match = strings.TrimSuffix(r.Match, "*")
+			p.prefixes = append(p.prefixes, r)
+			continue
+		default:
+			if _, err := syntax.ParseNSID(r.Match); err != nil {
+				return nil, fmt.Errorf("retention rule %q: not an event kind, collection or collection prefix", r.Match)
+			}
+		}
+		if _, ok := p.exact[r.Match]; ok {
+			return nil, fmt.Errorf("retention rule %q: duplicate", r.Match)
+		}
+		p.exact[r.Match] = r
+	}
+	sort.SliceStable(p.prefixes, func(i, j int) bool {
+		return len(p.prefixes[i].Match) > len(p.prefixes[j].Match)
+	})
+	return p, nil
+}
+
+// match returns the most specific rule for a collection or event kind
+func (p *retentionPolicy) match(key string) (RetentionRule, bool) {
+	if r, ok := p.exact[key]; ok {
+		return r, true
+	}
+	for _, r := range p.prefixes {
+		if strings.HasPrefix(key, r.Match) {
+			return r, true
+		}
+	}
+	return RetentionRule{}, false
+}
+
+// SetRetentionRules replaces the per-collection retention rules. Rules apply to events persisted from then on; the class of events already in the log is unchanged. With no rules, all events fall back to the default retention.
+func (dp *DiskPersistence) SetRetentionRules(rules []RetentionRule) error {
+	if len(rules) == 0 {
+		dp.retentionRules.Store(nil)
+		return nil
+	}
+	p, err := newRetentionPolicy(rules)
+	if err != nil {
+		return err
+	}
+	dp.retentionRules.Store(p)
+	return nil
+}
+
+// retentionFlags returns the header flags recording the event's retention class. A commit touching several collections is kept as long as the longest-lived of them.
+func (dp *DiskPersistence) retentionFlags(e *events.XRPCStreamEvent) uint32 {
+	p := dp.retentionRules.Load()
+	if p == nil {
+		return 0
+	}
+	var keys []string
+	switch {
+	case e.RepoCommit != nil:
+		for _, op := range e.RepoCommit.Ops {
+			coll, _, _ := strings.Cut(op.Path, "/")
+			keys = append(keys, coll)
+		}
+	case e.RepoSync != nil:
+		keys = []string{"#sync"}
+	case e.RepoIdentity != nil:
+		keys = []string{"#identity"}
+	case e.RepoAccount != nil:
+		keys = []string{"#account"}
+	}
+
+	var matched, unmatched, forever bool
+	var ttl time.Duration
+	for _, k := range keys {
+		r, ok := p.match(k)
+		if !ok {
+			unmatched = true
+			continue
+		}
+		matched = true
+		forever = forever || r.Forever
+		ttl = max(ttl, r.TTL)
+	}
+	switch {
+	case !matched:
+		return 0
+	case forever:
+		return retentionForever << retentionShift
+	case unmatched && ttl <= dp.retention:
+		return 0
+	case ttl == 0:
+		return 1<<retentionShift | EvtFlagExpired
+	}
+	hours := uint32(math.Ceil(ttl.Hours()))
+	return (hours + 1) << retentionShift
+}
+
+// HoldChecker reports which events are under legal hold. Held events are exempt from retention sweeps, and are hidden but not erased by takedowns.
+type HoldChecker interface {
+	// HasHolds reports whether any hold is in place; without one, expired log files are deleted without being scanned
+	HasHolds() bool
+	Held(usr models.Uid, seq int64) bool
+}
+
+// SetHoldChecker installs the legal hold registry consulted by retention sweeps and takedowns.
+func (dp *DiskPersistence) SetHoldChecker(hc HoldChecker) {
+	dp.holds.Store(&hc)
+}
+
+func (dp *DiskPersistence) hasHolds() bool {
+	hc := dp.holds.Load()
+	return hc != nil && (*hc).HasHolds()
+}
+
+func (dp *DiskPersistence) held(usr models.Uid, seq int64) bool {
+	hc := dp.holds.Load()
+	return hc != nil && (*hc).Held(usr, seq)
+}
+
+// eventTTL decodes the retention class in an event's header flags
+func eventTTL(flags uint32, def time.Duration) (ttl time.Duration, forever bool) {
+	switch class := flags >> retentionShift; class {
+	case 0:
+		return def, false
+	case retentionForever:
+		return 0, true
+	default:
+		return time.Duration(class-1) * time.Hour, false
+	}
+}
+
+var retentionEventsExpired = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "disk_persister_retention_events_expired",
+	Help: "Events hidden from playback by per-collection retention rules",
+})
+
+var retentionEventsHeld = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "disk_persister_retention_events_held",
+	Help: "Expired events kept by retention sweeps because they are under legal hold",
+})
+
+var retentionFilesCompacted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "disk_persister_retention_files_compacted",
+	Help: "Log files past the default retention rewritten to hold only the events retention rules still keep",
+})
+
+// sweep enforces retention rules and legal holds: expired events are hidden from playback, log files with nothing left to keep are deleted, and files past the default retention are compacted down to the events still kept. Each file is only revisited when its next event is due to expire, or hourly while it holds expired events under legal hold.
+func (dp *DiskPersistence) sweep(ctx context.Context) []error {
+	now := dp.clock.Now()
+	var refs []LogFileRef
+	if err := dp.meta.WithContext(ctx).Order("seq_start asc").Find(&refs, "pinned = ? AND (sweep_at IS NULL OR sweep_at <= ?)", false, now).Error; err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	refsDeleted := 0
+	filesDeleted := 0
+	for _, r := range refs {
+		dp.lk.Lock()
+		currentLogfile := dp.logfi.Name()
+		dp.lk.Unlock()
+
+		if filepath.Join(dp.primaryDir, r.Path) == currentLogfile {
+			continue
+		}
+
+		kept, err := dp.sweepLogFile(ctx, &r, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sweeping %s: %w", r.Path, err))
+			continue
+		}
+		if kept > 0 {
+			continue
+		}
+		refDeleted, fileDeleted, rerrs := dp.removeLogFile(ctx, r)
+		errs = append(errs, rerrs...)
+		if refDeleted {
+			refsDeleted++
+		}
+		if fileDeleted {
+			filesDeleted++
+		}
+	}
+
+	refsGarbageCollected.WithLabelValues().Add(float64(refsDeleted))
+	filesGarbageCollected.WithLabelValues().Add(float64(filesDeleted))
+	log.Info("retention sweep complete", "filesDeleted", filesDeleted, "refsDeleted", refsDeleted, "refsSwept", len(refs))
+	return errs
+}
+
+// sweepLogFile marks the file's expired events and schedules its next sweep, compacting it if it is past the default retention. Returns the number of events still kept: those available for playback, and hidden ones under legal hold.
+func (dp *DiskPersistence) sweepLogFile(ctx context.Context, r *LogFileRef, now time.Time) (int, error) {
+	// takedowns also rewrite event headers in place
+	dp.sweepLk.Lock()
+	defer dp.sweepLk.Unlock()
+
+	fi, err := os.OpenFile(filepath.Join(dp.primaryDir, r.Path), os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer fi.Close()
+
+	bufr := bufio.NewReader(fi)
+	scratch := make([]byte, headerSize)
+	var offset int64
+	var kept, dropped int
+	var next time.Time
+	schedule := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	for {
+		h, err := readHeader(bufr, scratch)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := bufr.Discard(int(h.Len)); err != nil {
+			return 0, err
+		}
+
+		ttl, forever := eventTTL(h.Flags, dp.retention)
+		expired := !forever && !r.CreatedAt.Add(ttl).After(now)
+		switch {
+		case (expired || postDoNotEmit(h.Flags)) && dp.held(h.Usr, h.Seq):
+			if expired {
+				retentionEventsHeld.Inc()
+			}
+			kept++
+			schedule(now.Add(time.Hour))
+		case postDoNotEmit(h.Flags):
+			dropped++
+		case expired:
+			binary.LittleEndian.PutUint32(scratch, h.Flags|EvtFlagExpired)
+			if _, err := fi.WriteAt(scratch[:4], offset); err != nil {
+				return 0, fmt.Errorf("failed to write updated flag value: %w", err)
+			}
+			retentionEventsExpired.Inc()
+			dropped++
+		default:
+			kept++
+			if !forever {
+				schedule(r.CreatedAt.Add(ttl))
+			}
+		}
+		offset += headerSize + h.Len64()
+	}
+	if err := fi.Sync(); err != nil {
+		return 0, err
+	}
+	if kept == 0 {
+		return 0, nil
+	}
+
+	oldPath, path := r.Path, r.Path
+	if dropped > 0 && now.After(r.CreatedAt.Add(dp.retention)) {
+		compacted, err := dp.compactLogFile(fi, r)
+		if err != nil {
+			return 0, err
+		}
+		path = compacted
+	}
+	updates := map[string]any{"path": path, "pinned": next.IsZero()}
+	if !next.IsZero() {
+		updates["sweep_at"] = next
+	}
+	if err := dp.meta.WithContext(ctx).Model(r).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+	if path != oldPath {
+		// readers which already opened the old file keep reading it, scanning once its index is gone
+		os.Remove(seqIndexPath(filepath.Join(dp.primaryDir, oldPath)))
+		os.Remove(pathIndexPath(filepath.Join(dp.primaryDir, oldPath)))
+		os.Remove(filepath.Join(dp.primaryDir, oldPath))
+	}
+	return kept, nil
+}
+
+// compactLogFile writes a copy of the log file holding only the events it still keeps, with a fresh sequence index and a copy of its path index, under a new name which is returned
+func (dp *DiskPersistence) compactLogFile(fi *os.File, r *LogFileRef) (string, error) {
+	if _, err := fi.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	fname := fmt.Sprintf("evts-%d.%d", r.SeqStart, time.Now().UnixNano())
+	outPath := filepath.Join(dp.primaryDir, fname)
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	bufr := bufio.NewReader(fi)
+	bufw := bufio.NewWriter(out)
+	scratch := make([]byte, headerSize)
+	var idx []byte
+	var offset int64
+	for {
+		h, err := readHeader(bufr, scratch)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if postDoNotEmit(h.Flags) && !dp.held(h.Usr, h.Seq) {
+			if _, err := bufr.Discard(int(h.Len)); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if _, err := bufw.Write(scratch); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(bufw, bufr, h.Len64()); err != nil {
+			return "", err
+		}
+		idx = appendSeqIndexEntry(idx, h.Seq, offset)
+		offset += headerSize + h.Len64()
+	}
+	if err := bufw.Flush(); err != nil {
+		return "", err
+	}
+	if err := out.Sync(); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(seqIndexPath(outPath), idx, 0664); err != nil {
+		return "", err
+	}
+	// entries of the events left out are never looked up
+	if paths, err := os.ReadFile(pathIndexPath(fi.Name())); err == nil {
+		if err := os.WriteFile(pathIndexPath(outPath), paths, 0664); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := syncDir(dp.primaryDir); err != nil {
+		return "", err
+	}
+	retentionFilesCompacted.Inc()
+	return fname, nil
+}
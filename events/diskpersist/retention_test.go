@@ -0,0 +1,273 @@
+package diskpersist
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	dp := &DiskPersistence{retention: 72 * time.Hour}
+	assert.NoError(dp.SetRetentionRules([]RetentionRule{
+		{Match: "app.gndr.feed.post", TTL: 90 * 24 * time.Hour},
+		{Match: "app.gndr.chat.*", TTL: 0},
+		{Match: "app.gndr.chat.bsky.*", TTL: time.Hour},
+		{Match: "#identity", Forever: true},
+	}))
+	assert.Error(dp.SetRetentionRules([]RetentionRule{{Match: "not an nsid"}}))
+	assert.Error(dp.SetRetentionRules([]RetentionRule{{Match: "#identity"}, {Match: "#identity"}}))
+
+	commit := func(paths ...string) *events.XRPCStreamEvent {
+		evt := &atproto.SyncSubscribeRepos_Commit{}
+		for _, p := range paths {
+			evt.Ops = append(evt.Ops, &atproto.SyncSubscribeRepos_RepoOp{Path: p})
+		}
+		return &events.XRPCStreamEvent{RepoCommit: evt}
+	}
+	ttl := func(e *events.XRPCStreamEvent) (time.Duration, bool) {
+		return eventTTL(dp.retentionFlags(e), dp.retention)
+	}
+
+	d, forever := ttl(commit("app.gndr.feed.post/1"))
+	assert.Equal(90*24*time.Hour, d)
+	assert.False(forever)
+
+	// dropped from playback as soon as it is written
+	flags := dp.retentionFlags(commit("app.gndr.chat.convo/1"))
+	assert.True(postDoNotEmit(flags))
+
+	// the most specific prefix wins
+	d, _ = ttl(commit("app.gndr.chat.bsky.message/1"))
+	assert.Equal(time.Hour, d)
+
+	// a commit is kept as long as the longest-lived collection it touches
+	d, _ = ttl(commit("app.gndr.chat.convo/1", "app.gndr.feed.like/1"))
+	assert.Equal(72*time.Hour, d)
+	d, _ = ttl(commit("app.gndr.chat.convo/1", "app.gndr.feed.post/1"))
+	assert.Equal(90*24*time.Hour, d)
+
+	_, forever = ttl(&events.XRPCStreamEvent{RepoIdentity: &atproto.SyncSubscribeRepos_Identity{}})
+	assert.True(forever)
+	assert.Equal(uint32(0), dp.retentionFlags(&events.XRPCStreamEvent{RepoAccount: &atproto.SyncSubscribeRepos_Account{}}))
+}
+
+func TestRetentionSweep(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	dp := openSeqTestPersister(t, db, dir, 10)
+	assert.NoError(dp.SetRetentionRules([]RetentionRule{{Match: "#identity", Forever: true}}))
+	persistIdentityEvents(t, dp, 5)
+	// account events keep the default retention
+	for i := 0; i < 15; i++ {
+		assert.NoError(dp.Persist(ctx, &events.XRPCStreamEvent{
+			RepoAccount: &atproto.SyncSubscribeRepos_Account{Did: "did:example:123", Time: "2024-01-01T00:00:00Z"},
+		}))
+	}
+	persistIdentityEvents(t, dp, 15)
+	assert.Len(playbackAll(t, dp), 35)
+
+	// age every log file past the default retention
+	assert.NoError(db.Model(&LogFileRef{}).Where("1 = 1").Update("created_at", time.Now().Add(-dp.retention-time.Hour)).Error)
+	assert.Empty(dp.garbageCollect(ctx))
+
+	evts := playbackAll(t, dp)
+	assert.Len(evts, 20)
+	for _, e := range evts {
+		assert.NotNil(e.RepoIdentity)
+	}
+
+	// the first file was compacted down to its identity events, the second deleted
+	var refs []LogFileRef
+	assert.NoError(db.Order("seq_start asc").Find(&refs).Error)
+	if assert.Len(refs, 3) {
+		assert.True(refs[0].Pinned)
+		assert.NotEqual("evts-0", refs[0].Path)
+		_, err := os.Stat(filepath.Join(dir, "diskPrimary", "evts-0"))
+		assert.True(os.IsNotExist(err))
+		assert.Equal(int64(21), refs[1].SeqStart)
+		assert.True(refs[1].Pinned)
+	}
+
+	// cursors into the compacted file still resolve
+	var seqs []int64
+	assert.NoError(dp.Playback(ctx, 3, func(e *events.XRPCStreamEvent) error {
+		seqs = append(seqs, e.RepoIdentity.Seq)
+		return nil
+	}))
+	if assert.NotEmpty(seqs) {
+		assert.Equal(int64(4), seqs[0])
+	}
+}
+
+func TestRetentionSimulatedTime(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	dp, err := NewDiskPersistence(filepath.Join(dir, "diskPrimary"), filepath.Join(dir, "diskArchive"), db, &DiskPersistOptions{
+		EventsPerFile: 10,
+		UIDCacheSize:  1000,
+		DIDCacheSize:  1000,
+		Retention:     72 * time.Hour,
+		Clock:         clk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+
+	persistIdentityEvents(t, dp, 15)
+	clk.Advance(48 * time.Hour)
+	persistIdentityEvents(t, dp, 10)
+
+	// nothing is past retention yet
+	assert.Empty(dp.garbageCollect(ctx))
+	assert.Len(playbackSeqs(t, dp, 0), 25)
+
+	// the files started before the clock moved age out; the one started after is kept
+	clk.Advance(25 * time.Hour)
+	assert.Empty(dp.garbageCollect(ctx))
+	assert.Equal([]int64{21, 22, 23, 24, 25}, playbackSeqs(t, dp, 0))
+}
+
+func TestFlushSimulatedTime(t *testing.T) {
+	assert := assert.New(t)
+	db, dir := setupSeqTest(t)
+
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	dp, err := NewDiskPersistence(filepath.Join(dir, "diskPrimary"), filepath.Join(dir, "diskArchive"), db, &DiskPersistOptions{
+		EventsPerFile: 10,
+		UIDCacheSize:  1000,
+		DIDCacheSize:  1000,
+		FlushInterval: time.Hour,
+		Clock:         clk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dp.Shutdown(context.Background())
+	var broadcast atomic.Int64
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) { broadcast.Add(1) })
+
+	// the flush and garbage collection tickers
+	clk.BlockUntil(2)
+	persistUnflushed(t, dp, 3)
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(broadcast.Load())
+
+	// the buffered events are written out once the flush interval passes on the persister's clock
+	clk.Advance(time.Hour)
+	assert.Eventually(func() bool { return broadcast.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func playbackAll(t *testing.T, dp *DiskPersistence) []*events.XRPCStreamEvent {
+	var out []*events.XRPCStreamEvent
+	if err := dp.Playback(context.Background(), 0, func(e *events.XRPCStreamEvent) error {
+		out = append(out, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+type testHolds struct {
+	seqs map[int64]bool
+}
+
+func (th *testHolds) HasHolds() bool {
+	return len(th.seqs) > 0
+}
+
+func (th *testHolds) Held(usr models.Uid, seq int64) bool {
+	return th.seqs[seq]
+}
+
+func TestRetentionHolds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	db, dir := setupSeqTest(t)
+
+	dp := openSeqTestPersister(t, db, dir, 10)
+	holds := &testHolds{seqs: map[int64]bool{3: true, 4: true}}
+	dp.SetHoldChecker(holds)
+	persistIdentityEvents(t, dp, 15)
+
+	assert.NoError(db.Model(&LogFileRef{}).Where("1 = 1").Update("created_at", time.Now().Add(-dp.retention-time.Hour)).Error)
+	assert.Empty(dp.garbageCollect(ctx))
+
+	// only the held events outlive the retention window
+	seqs := playbackSeqs(t, dp, 0)
+	assert.Equal([]int64{3, 4, 11, 12, 13, 14, 15}, seqs)
+
+	// a takedown hides held events, but leaves them on disk
+	assert.NoError(dp.TakeDownRepo(ctx, 1))
+	assert.Empty(playbackSeqs(t, dp, 0))
+	var ref LogFileRef
+	assert.NoError(db.Order("seq_start asc").First(&ref).Error)
+	path := filepath.Join(dir, "diskPrimary", ref.Path)
+	assert.Equal(2, countNonZeroEvents(t, path))
+	assert.Equal(2, countRetainedEvents(t, path))
+
+	// once the hold is released, erasure and retention catch up
+	holds.seqs = nil
+	assert.NoError(dp.TakeDownRepo(ctx, 1))
+	assert.Equal(0, countNonZeroEvents(t, path))
+	assert.Equal(0, countRetainedEvents(t, path))
+	assert.Empty(dp.garbageCollect(ctx))
+	var n int64
+	assert.NoError(db.Model(&LogFileRef{}).Where("id = ?", ref.ID).Count(&n).Error)
+	assert.Equal(int64(0), n)
+}
+
+// countRetainedEvents counts the events in a log file kept under legal hold after a takedown
+func countRetainedEvents(t *testing.T, path string) int {
+	n := 0
+	forEachEvent(t, path, func(h *evtHeader, body []byte) {
+		if h.Flags&EvtFlagRetained != 0 {
+			n++
+		}
+	})
+	return n
+}
+
+// countNonZeroEvents counts the events in a log file whose data hasn't been blanked
+func countNonZeroEvents(t *testing.T, path string) int {
+	n := 0
+	forEachEvent(t, path, func(h *evtHeader, body []byte) {
+		if !bytes.Equal(body, make([]byte, len(body))) {
+			n++
+		}
+	})
+	return n
+}
+
+func forEachEvent(t *testing.T, path string, fn func(h *evtHeader, body []byte)) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(b) >= headerSize {
+		h, err := readHeader(bytes.NewReader(b), make([]byte, headerSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(h, b[headerSize:headerSize+h.Len64()])
+		b = b[headerSize+h.Len64():]
+	}
+}
@@ -0,0 +1,108 @@
+package diskpersist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Each log file has a sidecar sequence index: fixed-size (seq, file offset) entries, appended in seq order as events are flushed. It is written after the events it points to, so it may lag the log file but never points past it.
+const seqIndexEntrySize = 16
+
+func seqIndexPath(logPath string) string {
+	return logPath + ".idx"
+}
+
+func appendSeqIndexEntry(buf []byte, seq, offset int64) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(seq))
+	return binary.LittleEndian.AppendUint64(buf, uint64(offset))
+}
+
+// seqIndex is a read-only, memory-mapped view of a sequence index file
+type seqIndex struct {
+	data  []byte
+	unmap func() error
+}
+
+func openSeqIndex(path string) (*seqIndex, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	st, err := fi.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// ignore a partially written trailing entry
+	size := st.Size() - st.Size()%seqIndexEntrySize
+	if size == 0 {
+		return &seqIndex{unmap: func() error { return nil }}, nil
+	}
+	data, unmap, err := mapFile(fi, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("mapping sequence index: %w", err)
+	}
+	return &seqIndex{data: data, unmap: unmap}, nil
+}
+
+func (ix *seqIndex) Close() error {
+	return ix.unmap()
+}
+
+func (ix *seqIndex) Len() int {
+	return len(ix.data) / seqIndexEntrySize
+}
+
+func (ix *seqIndex) entry(i int) (seq, offset int64) {
+	return indexEntryAt(ix.data, i)
+}
+
+func indexEntryAt(b []byte, i int) (seq, offset int64) {
+	e := b[i*seqIndexEntrySize:]
+	return int64(binary.LittleEndian.Uint64(e)), int64(binary.LittleEndian.Uint64(e[8:]))
+}
+
+// search returns the index of the first entry with seq greater than since, or Len() if there is none
+func (ix *seqIndex) search(since int64) int {
+	return sort.Search(ix.Len(), func(i int) bool {
+		seq, _ := ix.entry(i)
+		return seq > since
+	})
+}
+
+// seekPastSeq positions fi at the first event with seq greater than since, returning that event's seq, or the last seq in the file (leaving fi at the end) if there is none. The file's sequence index is used where it covers the cursor, falling back to scanning headers from the last indexed event (or the start of the file, without an index).
+func seekPastSeq(fi *os.File, since int64) (int64, error) {
+	ix, err := openSeqIndex(seqIndexPath(fi.Name()))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("failed to open sequence index, scanning log file", "file", fi.Name(), "err", err)
+		}
+		seqIndexSeeks.WithLabelValues("scan").Inc()
+		return scanForLastSeq(fi, since)
+	}
+	defer ix.Close()
+
+	i := ix.search(since)
+	if i < ix.Len() {
+		seq, off := ix.entry(i)
+		if _, err := fi.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		seqIndexSeeks.WithLabelValues("index").Inc()
+		return seq, nil
+	}
+
+	// the cursor is past the indexed events; scan the rest
+	seqIndexSeeks.WithLabelValues("partial").Inc()
+	if i > 0 {
+		_, off := ix.entry(i - 1)
+		if _, err := fi.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return scanForLastSeq(fi, since)
+}
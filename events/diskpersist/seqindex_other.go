@@ -0,0 +1,17 @@
+//go:build !unix
+
+package diskpersist
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the file into memory on platforms without mmap
+func mapFile(fi *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(fi, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,182 @@
+package diskpersist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func openSeqTestPersister(tb testing.TB, db *gorm.DB, dir string, eventsPerFile int64) *DiskPersistence {
+	dp, err := NewDiskPersistence(filepath.Join(dir, "diskPrimary"), filepath.Join(dir, "diskArchive"), db, &DiskPersistOptions{
+		EventsPerFile: eventsPerFile,
+		UIDCacheSize:  1000,
+		DIDCacheSize:  1000,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+	return dp
+}
+
+// persistUnflushed persists n identity events, leaving any that haven't hit the flush threshold buffered
+func persistUnflushed(tb testing.TB, dp *DiskPersistence, n int) {
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		if err := dp.Persist(ctx, &events.XRPCStreamEvent{
+			RepoIdentity: &atproto.SyncSubscribeRepos_Identity{
+				Did:  "did:example:123",
+				Time: "2024-01-01T00:00:00Z",
+			},
+		}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func persistIdentityEvents(tb testing.TB, dp *DiskPersistence, n int) {
+	persistUnflushed(tb, dp, n)
+	if err := dp.Flush(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func setupSeqTest(tb testing.TB) (*gorm.DB, string) {
+	db, _, _, dir, err := setupDBs(tb)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(dir) })
+
+	db.AutoMigrate(&models.ActorInfo{})
+	db.Create(&models.ActorInfo{Uid: 1, Did: "did:example:123"})
+	return db, dir
+}
+
+func playbackSeqs(t *testing.T, dp *DiskPersistence, since int64) []int64 {
+	var seqs []int64
+	if err := dp.Playback(context.Background(), since, func(evt *events.XRPCStreamEvent) error {
+		seqs = append(seqs, evt.RepoIdentity.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return seqs
+}
+
+func TestSeqIndexPlayback(t *testing.T) {
+	assert := assert.New(t)
+	db, dir := setupSeqTest(t)
+
+	dp := openSeqTestPersister(t, db, dir, 100)
+	persistIdentityEvents(t, dp, 250)
+
+	check := func(label string) {
+		for _, since := range []int64{0, 1, 50, 99, 100, 101, 150, 249, 250} {
+			seqs := playbackSeqs(t, dp, since)
+			expected := 250 - since
+			if since == 0 {
+				expected = 250
+			}
+			if assert.Len(seqs, int(expected), "%s: since %d", label, since) && len(seqs) > 0 {
+				assert.Equal(since+1, seqs[0], "%s: since %d", label, since)
+				assert.Equal(int64(250), seqs[len(seqs)-1], "%s: since %d", label, since)
+			}
+		}
+	}
+	check("indexed")
+
+	// a crash mid-append can leave the index short with a torn trailing entry
+	idxPath := seqIndexPath(dp.logfi.Name())
+	st, err := os.Stat(idxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(idxPath, st.Size()-seqIndexEntrySize*10-5); err != nil {
+		t.Fatal(err)
+	}
+	check("partial index")
+
+	// log files written before the index existed are scanned
+	idxFiles, err := filepath.Glob(filepath.Join(dir, "diskPrimary", "*.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(idxFiles, 3)
+	for _, fn := range idxFiles {
+		if err := os.Remove(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("no index")
+
+	// resuming rebuilds the current file's index and keeps appending to it
+	if err := dp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dp = openSeqTestPersister(t, db, dir, 100)
+	persistIdentityEvents(t, dp, 10)
+
+	ix, err := openSeqIndex(seqIndexPath(dp.logfi.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	assert.Equal(60, ix.Len())
+	seq, _ := ix.entry(ix.Len() - 1)
+
+	seqs := playbackSeqs(t, dp, 240)
+	if assert.NotEmpty(seqs) {
+		assert.Equal(int64(241), seqs[0])
+		assert.Equal(seq, seqs[len(seqs)-1])
+	}
+}
+
+// BenchmarkSeqIndexSeek compares positioning a reconnecting consumer's cursor near the end of a large log file with and without the sequence index.
+func BenchmarkSeqIndexSeek(b *testing.B) {
+	db, dir := setupSeqTest(b)
+
+	const n = 50_000
+	dp := openSeqTestPersister(b, db, dir, n+1)
+	persistIdentityEvents(b, dp, n)
+	fn := dp.logfi.Name()
+
+	for _, since := range []int64{n / 2, n - 10} {
+		b.Run(fmt.Sprintf("index/since=%d", since), func(b *testing.B) {
+			benchmarkSeek(b, fn, since, seekPastSeq)
+		})
+		b.Run(fmt.Sprintf("scan/since=%d", since), func(b *testing.B) {
+			benchmarkSeek(b, fn, since, scanForLastSeq)
+		})
+	}
+}
+
+func benchmarkSeek(b *testing.B, fn string, since int64, seek func(*os.File, int64) (int64, error)) {
+	fi, err := os.Open(fn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fi.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := fi.Seek(0, 0); err != nil {
+			b.Fatal(err)
+		}
+		seq, err := seek(fi, since)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if seq != since+1 {
+			b.Fatalf("seeked to %d, expected %d", seq, since+1)
+		}
+	}
+}
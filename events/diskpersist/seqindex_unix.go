@@ -0,0 +1,16 @@
+//go:build unix
+
+package diskpersist
+
+import (
+	"os"
+	"syscall"
+)
+
+func mapFile(fi *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(fi.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
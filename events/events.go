@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
@@ -35,6 +37,16 @@ type EventManager struct {
 
 	persister EventPersistence
 
+	// sequence number and time (unix nanoseconds) of the most recently broadcast event
+	headSeq  atomic.Int64
+	headTime atomic.Int64
+
+	// optional per-account ordering enforcement; see SetOrdering
+	ordering *orderingChecker
+	reorder  *reorderBuffer
+	// optional; see SetHold
+	hold func(*XRPCStreamEvent) bool
+
 	log *slog.Logger
 }
 
@@ -64,9 +76,54 @@ type Operation struct {
 }
 
 func (em *EventManager) Shutdown(ctx context.Context) error {
+	if em.reorder != nil {
+		em.reorder.stop()
+	}
 	return em.persister.Shutdown(ctx)
 }
 
+// Head returns the sequence number and broadcast time of the most recent event. The time is zero if no event has been broadcast since startup.
+func (em *EventManager) Head() (int64, time.Time) {
+	t := em.headTime.Load()
+	if t == 0 {
+		return em.headSeq.Load(), time.Time{}
+	}
+	return em.headSeq.Load(), time.Unix(0, t)
+}
+
+// Fanout returns the number of connected subscribers, and how full the fullest one's outgoing buffer is, from 0 to 1. Subscribers whose buffers fill are dropped as too slow.
+func (em *EventManager) Fanout() (int, float64) {
+	em.subsLk.Lock()
+	defer em.subsLk.Unlock()
+	var saturation float64
+	for _, s := range em.subs {
+		if c := cap(s.outgoing); c > 0 {
+			saturation = max(saturation, float64(len(s.outgoing))/float64(c))
+		}
+	}
+	return len(em.subs), saturation
+}
+
+// BacklogReporter is implemented by persisters which can say how many events they have been handed but not yet broadcast
+type BacklogReporter interface {
+	Backlog() int64
+}
+
+// PathPlayback is implemented by persisters which can play back the commits of some collections without reading the others
+type PathPlayback interface {
+	// PlaybackPaths is Playback, leaving out commits none of whose op paths (collection/rkey) match; other events are all played back
+	PlaybackPaths(ctx context.Context, since int64, match func(path string) bool, cb func(*XRPCStreamEvent) error) error
+}
+
+// PersisterBacklog returns the number of events handed to the persister and not yet broadcast, and false if the persister doesn't report it.
+func (em *EventManager) PersisterBacklog() (int64, bool) {
+	br, ok := em.persister.(BacklogReporter)
+	if !ok {
+		return 0, false
+	}
+	return br.Backlog(), true
+}
+
 func (em *EventManager) broadcastEvent(evt *XRPCStreamEvent) {
 	// the main thing we do is send it out, so MarshalCBOR once
 	if err := evt.Preserialize(); err != nil {
@@ -75,6 +132,15 @@ func (em *EventManager) broadcastEvent(evt *XRPCStreamEvent) {
 		return
 	}
 
+	if em.ordering != nil {
+		em.ordering.check(evt)
+	}
+
+	if seq, ok := evt.GetSequence(); ok {
+		em.headSeq.Store(seq)
+		em.headTime.Store(time.Now().UnixNano())
+	}
+
 	em.subsLk.Lock()
 	defer em.subsLk.Unlock()
 
@@ -153,6 +219,49 @@ const (
 type EventHeader struct {
 	Op      int64  `cborgen:"op"`
 	MsgType string `cborgen:"t,omitempty"`
+	// relay-added metadata; not part of the atproto spec, and ignored by consumers which don't know about it
+	Meta *FrameMeta `cborgen:"meta,omitempty"`
+	// relay-issued resume token for this frame, for relays which use them instead of integer cursors; also not part of the atproto spec
+	Resume string `cborgen:"resume,omitempty"`
+}
+
+// FrameMeta records relay-side modifications and annotations of an event, signed by the relay so consumers can tell they came from it (the original commit signature no longer covers modified records).
+type FrameMeta struct {
+	Repo        string         `cborgen:"repo"`
+	Seq         int64          `cborgen:"seq"`
+	Modified    []ModifiedOp   `cborgen:"modified,omitempty"`
+	Annotations []OpAnnotation `cborgen:"annotations,omitempty"`
+	// ISO 3166-2 classification region of the account (eg, "CA-QC") the frame was served under; empty if unclassified
+	Region string `cborgen:"region,omitempty"`
+	// which classification Region is: "current" (at the time of serving) or "persisted" (recorded when the event was persisted)
+	RegionBasis string `cborgen:"regionBasis,omitempty"`
+	// did:key of the relay's signing key
+	Signer string `cborgen:"signer"`
+	// signature over the CBOR encoding of this struct with Sig unset
+	Sig []byte `cborgen:"sig,omitempty"`
+}
+
+// ModifiedOp describes a single record which was rewritten (or removed) before emission.
+type ModifiedOp struct {
+	Path string `cborgen:"path"`
+	// CID of the record as committed by the account
+	Orig string `cborgen:"orig"`
+	// CID of the record as emitted; empty if the record was removed
+	Cid string `cborgen:"cid"`
+	// names of the rules which were applied
+	Rules []string `cborgen:"rules"`
+}
+
+// OpAnnotation is relay-derived information about a single record in the event.
+type OpAnnotation struct {
+	Path string `cborgen:"path"`
+	// Indigenous language codes among the record's declared languages
+	Langs []string `cborgen:"langs,omitempty"`
+	// normalized hashtags and external link URLs in the record
+	Hashtags []string `cborgen:"hashtags,omitempty"`
+	Links    []string `cborgen:"links,omitempty"`
+	// domains of linked URLs under the .ca top-level domain
+	CaDomains []string `cborgen:"caDomains,omitempty"`
 }
 
 var (
@@ -196,15 +305,22 @@ type XRPCStreamEvent struct {
 	LabelLabels  *comatproto.LabelSubscribeLabels_Labels
 	LabelInfo    *comatproto.LabelSubscribeLabels_Info
 
+	// optional relay metadata, carried in the frame header
+	Meta *FrameMeta
+	// optional resume token, carried in the frame header
+	Resume string
+
 	// some private fields for internal routing perf
 	PrivUid         models.Uid `json:"-" cborgen:"-"`
 	PrivPdsId       uint       `json:"-" cborgen:"-"`
 	PrivRelevantPds []uint     `json:"-" cborgen:"-"`
 	Preserialized   []byte     `json:"-" cborgen:"-"`
+	// classification region of the account when the event was persisted, if the persister records it
+	PrivRegion string `json:"-" cborgen:"-"`
 }
 
 func (evt *XRPCStreamEvent) Serialize(wc io.Writer) error {
-	header := EventHeader{Op: EvtKindMessage}
+	header := EventHeader{Op: EvtKindMessage, Meta: evt.Meta, Resume: evt.Resume}
 	var obj lexutil.CBOR
 
 	switch {
@@ -242,6 +358,8 @@ func (xevt *XRPCStreamEvent) Deserialize(r io.Reader) error {
 	if err := header.UnmarshalCBOR(r); err != nil {
 		return fmt.Errorf("reading header: %w", err)
 	}
+	xevt.Meta = header.Meta
+	xevt.Resume = header.Resume
 	switch header.Op {
 	case EvtKindMessage:
 		switch header.MsgType {
@@ -316,23 +434,72 @@ type ErrorFrame struct {
 	Message string `cborgen:"message"`
 }
 
+// ErrRelayShutdown is the error frame type sent to consumers when a relay is shutting down. The message is a space-separated (possibly empty) list of alternate relay base URLs which consumers may fail over to.
+const ErrRelayShutdown = "RelayShutdown"
+
+// ShutdownErrorFrame builds an ErrRelayShutdown error frame advertising the given alternates.
+func ShutdownErrorFrame(alternates []string) *ErrorFrame {
+	return &ErrorFrame{
+		Error:   ErrRelayShutdown,
+		Message: strings.Join(alternates, " "),
+	}
+}
+
+// Alternates returns the alternate relays advertised in an ErrRelayShutdown frame, or nil for any other kind of error frame.
+func (ef *ErrorFrame) Alternates() []string {
+	if ef.Error != ErrRelayShutdown {
+		return nil
+	}
+	return strings.Fields(ef.Message)
+}
+
 func (em *EventManager) AddEvent(ctx context.Context, ev *XRPCStreamEvent) error {
 	ctx, span := otel.Tracer("events").Start(ctx, "AddEvent")
 	defer span.End()
 
+	if em.hold != nil && em.hold(ev) {
+		return nil
+	}
+	if em.reorder != nil {
+		em.reorder.add(ev)
+		return nil
+	}
 	em.persistAndSendEvent(ctx, ev)
 	return nil
 }
 
+// SetHold registers a function deciding whether each added event is held back, before it is persisted or broadcast. Whoever holds an event passes it to Release to emit it later, or drops it. It must be called before any events are added.
+func (em *EventManager) SetHold(hold func(*XRPCStreamEvent) bool) {
+	em.hold = hold
+}
+
+// Release persists and broadcasts an event which was held back.
+func (em *EventManager) Release(ctx context.Context, ev *XRPCStreamEvent) {
+	if em.reorder != nil {
+		em.reorder.add(ev)
+		return
+	}
+	em.persistAndSendEvent(ctx, ev)
+}
+
 var (
 	ErrPlaybackShutdown = fmt.Errorf("playback shutting down")
 	ErrCaughtUp         = fmt.Errorf("caught up")
 )
 
 func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func(*XRPCStreamEvent) bool, since *int64) (<-chan *XRPCStreamEvent, func(), error) {
+	return em.SubscribePaths(ctx, ident, filter, nil, since)
+}
+
+// SubscribePaths is Subscribe for a consumer of some collections: commits none of whose op paths (collection/rkey) match are left out, on playback too, where persisters implementing PathPlayback skip them without reading them. Other events are sent as by Subscribe. A nil match subscribes to everything.
+func (em *EventManager) SubscribePaths(ctx context.Context, ident string, filter func(*XRPCStreamEvent) bool, match func(path string) bool, since *int64) (<-chan *XRPCStreamEvent, func(), error) {
 	if filter == nil {
 		filter = func(*XRPCStreamEvent) bool { return true }
 	}
+	if match != nil {
+		inner := filter
+		filter = func(e *XRPCStreamEvent) bool { return e.MatchesPaths(match) && inner(e) }
+	}
 
 	done := make(chan struct{})
 	sub := &Subscriber{
@@ -363,7 +530,7 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 	go func() {
 		lastSeq := *since
 		// run playback to get through *most* of the events, getting our current cursor close to realtime
-		if err := em.persister.Playback(ctx, *since, func(e *XRPCStreamEvent) error {
+		if err := em.playback(ctx, *since, match, func(e *XRPCStreamEvent) error {
 			select {
 			case <-done:
 				return ErrPlaybackShutdown
@@ -399,7 +566,7 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 		first := <-sub.outgoing
 
 		// run playback again to get us to the events that have started buffering
-		if err := em.persister.Playback(ctx, lastSeq, func(e *XRPCStreamEvent) error {
+		if err := em.playback(ctx, lastSeq, match, func(e *XRPCStreamEvent) error {
 			seq := SequenceForEvent(e)
 			if seq > SequenceForEvent(first) {
 				return ErrCaughtUp
@@ -431,6 +598,35 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 	return out, sub.cleanup, nil
 }
 
+// playback plays back events from the persister, leaving out commits none of whose op paths match, if match is set
+func (em *EventManager) playback(ctx context.Context, since int64, match func(string) bool, cb func(*XRPCStreamEvent) error) error {
+	if match == nil {
+		return em.persister.Playback(ctx, since, cb)
+	}
+	if pp, ok := em.persister.(PathPlayback); ok {
+		return pp.PlaybackPaths(ctx, since, match, cb)
+	}
+	return em.persister.Playback(ctx, since, func(e *XRPCStreamEvent) error {
+		if !e.MatchesPaths(match) {
+			return nil
+		}
+		return cb(e)
+	})
+}
+
+// MatchesPaths returns false for commits none of whose op paths match, and true for other events
+func (evt *XRPCStreamEvent) MatchesPaths(match func(path string) bool) bool {
+	if evt.RepoCommit == nil {
+		return true
+	}
+	for _, op := range evt.RepoCommit.Ops {
+		if match(op.Path) {
+			return true
+		}
+	}
+	return false
+}
+
 func SequenceForEvent(evt *XRPCStreamEvent) int64 {
 	return evt.Sequence()
 }
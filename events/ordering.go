@@ -0,0 +1,264 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OrderingOptions configures enforcement of per-account event ordering. Indexers downstream of the sovereign stream assume each account's events arrive in rev (and seq) order, which the relay otherwise only provides as a side effect of processing each account's events sequentially.
+type OrderingOptions struct {
+	// check at broadcast that each account's rev and seq only move forward, logging and counting violations
+	Check bool
+	// number of accounts whose last rev and seq are remembered for checking
+	TrackedAccounts int
+	// if positive, hold up to this many events before persisting them, putting an account's commits and syncs which arrive out of rev order within the window back in order
+	ReorderWindow int
+	// longest an event is held for reordering; held events add up to twice this much latency
+	ReorderDelay time.Duration
+	// time source for holding and releasing reordered events; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOrderingOptions() *OrderingOptions {
+	return &OrderingOptions{
+		TrackedAccounts: 1_000_000,
+		ReorderDelay:    50 * time.Millisecond,
+	}
+}
+
+var orderingViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_events_ordering_violations_total",
+	Help: "Events broadcast out of order for their account, by whether the rev or the seq went backwards",
+}, []string{"kind"})
+
+var eventsReordered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_events_reordered_total",
+	Help: "Events moved ahead of an earlier-arriving event for the same account to restore rev order",
+})
+
+// SetOrdering enables ordering checks and reordering. It must be called before any events are added.
+func (em *EventManager) SetOrdering(opts *OrderingOptions) error {
+	if opts.Check {
+		last, err := lru.New[string, orderPos](opts.TrackedAccounts)
+		if err != nil {
+			return fmt.Errorf("creating ordering check cache: %w", err)
+		}
+		em.ordering = &orderingChecker{last: last, log: em.log}
+	}
+	if opts.ReorderWindow > 0 {
+		if opts.ReorderDelay <= 0 {
+			return fmt.Errorf("reordering requires a positive delay")
+		}
+		em.reorder = &reorderBuffer{
+			window: opts.ReorderWindow,
+			delay:  opts.ReorderDelay,
+			clock:  clock.OrSystem(opts.Clock),
+			emit:   em.persistAndSendEvent,
+			done:   make(chan struct{}),
+		}
+		em.reorder.stopped.Add(1)
+		go em.reorder.run()
+	}
+	return nil
+}
+
+// OrderingViolation describes an event broadcast out of order for its account.
+type OrderingViolation struct {
+	DID string
+	// "seq" or "rev", by which went backwards
+	Kind    string
+	Seq     int64
+	PrevSeq int64
+	Rev     string
+	PrevRev string
+}
+
+// OnOrderingViolation registers a function called with each violation the ordering checks find. It is called synchronously from broadcast, so must not block. It must be called before any events are added, and has no effect unless checks are enabled.
+func (em *EventManager) OnOrderingViolation(fn func(OrderingViolation)) {
+	if em.ordering != nil {
+		em.ordering.onViolation = fn
+	}
+}
+
+// repoDID returns the account an event is about, or empty string for events not tied to an account
+func (evt *XRPCStreamEvent) repoDID() string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Repo
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Did
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Did
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Did
+	default:
+		return ""
+	}
+}
+
+// repoRev returns the repo revision an event carries, or empty string for events without one
+func (evt *XRPCStreamEvent) repoRev() string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Rev
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Rev
+	default:
+		return ""
+	}
+}
+
+type orderPos struct {
+	seq int64
+	rev string
+}
+
+type orderingChecker struct {
+	lk   sync.Mutex
+	last *lru.Cache[string, orderPos]
+	log  *slog.Logger
+	// optional; see OnOrderingViolation
+	onViolation func(OrderingViolation)
+}
+
+// check records an event's position in its account's history, reporting it if it goes backwards
+func (oc *orderingChecker) check(evt *XRPCStreamEvent) {
+	did := evt.repoDID()
+	if did == "" {
+		return
+	}
+	seq, _ := evt.GetSequence()
+	rev := evt.repoRev()
+
+	oc.lk.Lock()
+	defer oc.lk.Unlock()
+
+	prev, ok := oc.last.Get(did)
+	if !ok {
+		oc.last.Add(did, orderPos{seq: seq, rev: rev})
+		return
+	}
+
+	if seq <= prev.seq {
+		orderingViolations.WithLabelValues("seq").Inc()
+		oc.log.Warn("account event seq went backwards at broadcast", "did", did, "seq", seq, "prevSeq", prev.seq)
+		if oc.onViolation != nil {
+			oc.onViolation(OrderingViolation{DID: did, Kind: "seq", Seq: seq, PrevSeq: prev.seq, Rev: rev, PrevRev: prev.rev})
+		}
+	}
+	// revs are TIDs, so sort lexically; a sync may restate the current rev, but a commit must advance it
+	if rev != "" && prev.rev != "" && (rev < prev.rev || (rev == prev.rev && evt.RepoCommit != nil)) {
+		orderingViolations.WithLabelValues("rev").Inc()
+		oc.log.Warn("account event rev went backwards at broadcast", "did", did, "seq", seq, "rev", rev, "prevRev", prev.rev)
+		if oc.onViolation != nil {
+			oc.onViolation(OrderingViolation{DID: did, Kind: "rev", Seq: seq, PrevSeq: prev.seq, Rev: rev, PrevRev: prev.rev})
+		}
+	}
+
+	next := prev
+	next.seq = max(prev.seq, seq)
+	if rev > prev.rev {
+		next.rev = rev
+	}
+	oc.last.Add(did, next)
+}
+
+type reorderEntry struct {
+	evt   *XRPCStreamEvent
+	added time.Time
+}
+
+// reorderBuffer holds recent events in arrival order. When an account's event arrives with a lower rev than one of its events already held, their places are swapped, so each account's events leave in rev order while keeping the positions they held in the stream.
+type reorderBuffer struct {
+	lk      sync.Mutex
+	window  int
+	delay   time.Duration
+	clock   clock.Clock
+	entries []reorderEntry
+	emit    func(context.Context, *XRPCStreamEvent)
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func (rb *reorderBuffer) add(evt *XRPCStreamEvent) {
+	rb.lk.Lock()
+	defer rb.lk.Unlock()
+
+	rb.entries = append(rb.entries, reorderEntry{evt: evt, added: rb.clock.Now()})
+	rb.settleLocked(len(rb.entries) - 1)
+	for len(rb.entries) > rb.window {
+		rb.popLocked()
+	}
+}
+
+// settleLocked moves the event at position i back past any held events of the same account with a higher rev
+func (rb *reorderBuffer) settleLocked(i int) {
+	evt := rb.entries[i].evt
+	did, rev := evt.repoDID(), evt.repoRev()
+	if rev == "" {
+		return
+	}
+	for j := i - 1; j >= 0; j-- {
+		other := rb.entries[j].evt
+		if other.repoDID() != did {
+			continue
+		}
+		orev := other.repoRev()
+		if orev == "" || orev <= rev {
+			// identity and account events aren't moved past, and earlier events are in order already
+			return
+		}
+		rb.entries[i].evt, rb.entries[j].evt = other, evt
+		eventsReordered.Inc()
+		i = j
+	}
+}
+
+func (rb *reorderBuffer) popLocked() {
+	e := rb.entries[0]
+	rb.entries[0] = reorderEntry{}
+	rb.entries = rb.entries[1:]
+	rb.emit(context.Background(), e.evt)
+}
+
+// flush emits held events older than the delay, or all of them
+func (rb *reorderBuffer) flush(all bool) {
+	rb.lk.Lock()
+	defer rb.lk.Unlock()
+
+	cutoff := rb.clock.Now().Add(-rb.delay)
+	for len(rb.entries) > 0 && (all || rb.entries[0].added.Before(cutoff)) {
+		rb.popLocked()
+	}
+}
+
+func (rb *reorderBuffer) run() {
+	defer rb.stopped.Done()
+
+	t := rb.clock.NewTicker(rb.delay)
+	defer t.Stop()
+	for {
+		select {
+		case <-rb.done:
+			return
+		case <-t.C():
+			rb.flush(false)
+		}
+	}
+}
+
+// stop halts the delay flusher and emits everything still held
+func (rb *reorderBuffer) stop() {
+	close(rb.done)
+	rb.stopped.Wait()
+	rb.flush(true)
+}
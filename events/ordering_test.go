@@ -0,0 +1,190 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/clock"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPersister assigns sequence numbers and broadcasts immediately, remembering what it persisted
+type testPersister struct {
+	lk        sync.Mutex
+	seq       int64
+	persisted []*XRPCStreamEvent
+	broadcast func(*XRPCStreamEvent)
+}
+
+func (tp *testPersister) Persist(ctx context.Context, e *XRPCStreamEvent) error {
+	tp.lk.Lock()
+	defer tp.lk.Unlock()
+	tp.seq++
+	switch {
+	case e.RepoCommit != nil:
+		e.RepoCommit.Seq = tp.seq
+	case e.RepoIdentity != nil:
+		e.RepoIdentity.Seq = tp.seq
+	}
+	tp.persisted = append(tp.persisted, e)
+	tp.broadcast(e)
+	return nil
+}
+
+func (tp *testPersister) Playback(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error) error {
+	return nil
+}
+func (tp *testPersister) TakeDownRepo(ctx context.Context, usr models.Uid) error { return nil }
+func (tp *testPersister) Flush(ctx context.Context) error                        { return nil }
+func (tp *testPersister) Shutdown(ctx context.Context) error                     { return nil }
+func (tp *testPersister) SetEventBroadcaster(f func(*XRPCStreamEvent))           { tp.broadcast = f }
+
+// order returns "did:rev" (or "did:identity") for each persisted event
+func (tp *testPersister) order() []string {
+	tp.lk.Lock()
+	defer tp.lk.Unlock()
+	var out []string
+	for _, e := range tp.persisted {
+		if e.RepoCommit != nil {
+			out = append(out, e.RepoCommit.Repo+":"+e.RepoCommit.Rev)
+		} else {
+			out = append(out, e.RepoIdentity.Did+":identity")
+		}
+	}
+	return out
+}
+
+var testCommitCid = lexutil.LexLink(cid.NewCidV1(cid.DagCBOR, mustHash("commit")))
+
+func mustHash(s string) multihash.Multihash {
+	h, err := multihash.Sum([]byte(s), multihash.SHA2_256, -1)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func commitEvt(did, rev string) *XRPCStreamEvent {
+	return &XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   did,
+		Rev:    rev,
+		Commit: testCommitCid,
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{},
+		Time:   "2024-01-01T00:00:00Z",
+	}}
+}
+
+func setupOrdering(t *testing.T, opts *OrderingOptions) (*EventManager, *testPersister) {
+	tp := &testPersister{}
+	em := NewEventManager(tp)
+	if err := em.SetOrdering(opts); err != nil {
+		t.Fatal(err)
+	}
+	return em, tp
+}
+
+func TestOrderingCheck(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	opts := DefaultOrderingOptions()
+	opts.Check = true
+	em, _ := setupOrdering(t, opts)
+	var seen []OrderingViolation
+	em.OnOrderingViolation(func(v OrderingViolation) { seen = append(seen, v) })
+
+	revViolations := testutil.ToFloat64(orderingViolations.WithLabelValues("rev"))
+	for _, evt := range []*XRPCStreamEvent{
+		commitEvt("did:plc:a", "3k2a"),
+		commitEvt("did:plc:b", "3k2b"),
+		commitEvt("did:plc:a", "3k2c"),
+		commitEvt("did:plc:b", "3k2c"),
+		// behind the account's last rev, and a repeat of it
+		commitEvt("did:plc:a", "3k2b"),
+		commitEvt("did:plc:b", "3k2c"),
+	} {
+		assert.NoError(em.AddEvent(ctx, evt))
+	}
+	assert.Equal(revViolations+2, testutil.ToFloat64(orderingViolations.WithLabelValues("rev")))
+	if assert.Len(seen, 2) {
+		assert.Equal("did:plc:a", seen[0].DID)
+		assert.Equal("rev", seen[0].Kind)
+		assert.Equal("3k2b", seen[0].Rev)
+		assert.Equal("3k2c", seen[0].PrevRev)
+	}
+}
+
+func TestReorderWindow(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	opts := DefaultOrderingOptions()
+	opts.ReorderWindow = 10
+	opts.ReorderDelay = time.Hour
+	em, tp := setupOrdering(t, opts)
+
+	for _, evt := range []*XRPCStreamEvent{
+		commitEvt("did:plc:a", "3k2b"),
+		commitEvt("did:plc:b", "3k2a"),
+		commitEvt("did:plc:a", "3k2c"),
+		commitEvt("did:plc:a", "3k2a"),
+		{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:b", Time: "2024-01-01T00:00:00Z"}},
+		// not moved past the identity event
+		commitEvt("did:plc:b", "3k29"),
+	} {
+		assert.NoError(em.AddEvent(ctx, evt))
+	}
+	assert.Empty(tp.order())
+
+	assert.NoError(em.Shutdown(ctx))
+	assert.Equal([]string{
+		"did:plc:a:3k2a",
+		"did:plc:b:3k2a",
+		"did:plc:a:3k2b",
+		"did:plc:a:3k2c",
+		"did:plc:b:identity",
+		"did:plc:b:3k29",
+	}, tp.order())
+	// sequence numbers are assigned in the restored order
+	for i, e := range tp.persisted {
+		assert.Equal(int64(i+1), e.Sequence())
+	}
+}
+
+func TestReorderFlush(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOrderingOptions()
+	opts.ReorderWindow = 2
+	opts.ReorderDelay = time.Hour
+	opts.Clock = clk
+	em, tp := setupOrdering(t, opts)
+	// the flush ticker
+	clk.BlockUntil(1)
+
+	// the window overflowing releases the oldest event
+	for _, rev := range []string{"3k2a", "3k2b", "3k2c"} {
+		assert.NoError(em.AddEvent(ctx, commitEvt("did:plc:a", rev)))
+	}
+	assert.Equal([]string{"did:plc:a:3k2a"}, tp.order())
+
+	// the first flush after they arrive finds them not yet held for the delay
+	clk.Advance(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(tp.order(), 1)
+
+	// and the next releases them
+	clk.Advance(time.Hour)
+	assert.Eventually(func() bool { return len(tp.order()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.NoError(em.Shutdown(ctx))
+}
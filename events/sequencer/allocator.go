@@ -0,0 +1,155 @@
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lease is a holder's claim on the allocator, valid until another holder acquires it.
+type Lease struct {
+	Epoch int64
+	// first number not yet reserved by any holder
+	Next int64
+	// holder of the previous epoch; empty for the first
+	PrevHolder string
+}
+
+// Gap is a range of numbers which were reserved but which the log doesn't hold.
+type Gap struct {
+	First  int64     `json:"first"`
+	Last   int64     `json:"last"`
+	Reason string    `json:"reason"`
+	Epoch  int64     `json:"epoch"`
+	Holder string    `json:"holder"`
+	At     time.Time `json:"at"`
+}
+
+// Allocator durably records how far the sequence has been reserved, and by which holder.
+type Allocator interface {
+	// Acquire starts a new epoch for holder, after which reservations under earlier epochs fail with ErrFenced
+	Acquire(ctx context.Context, holder string) (Lease, error)
+	// Reserve records next as the first number not reserved, failing with ErrFenced if the lease is no longer current
+	Reserve(ctx context.Context, lease Lease, next int64) error
+	RecordGap(ctx context.Context, gap Gap) error
+	Gaps(ctx context.Context, after int64, limit int) ([]Gap, error)
+}
+
+// SequenceState is the allocator's row for a sequence.
+type SequenceState struct {
+	Name      string `gorm:"primaryKey"`
+	Next      int64
+	Epoch     int64
+	Holder    string
+	UpdatedAt time.Time
+}
+
+type SequenceGap struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Name      string `gorm:"index:idx_sequence_gap_last,priority:1"`
+	First     int64
+	Last      int64 `gorm:"index:idx_sequence_gap_last,priority:2"`
+	Reason    string
+	Epoch     int64
+	Holder    string
+}
+
+// DBAllocator keeps a named sequence's state in a database, which replicas of the relay share to take over from one another.
+type DBAllocator struct {
+	db   *gorm.DB
+	name string
+}
+
+var _ Allocator = (*DBAllocator)(nil)
+
+func NewDBAllocator(db *gorm.DB, name string) (*DBAllocator, error) {
+	if err := db.AutoMigrate(&SequenceState{}, &SequenceGap{}); err != nil {
+		return nil, err
+	}
+	return &DBAllocator{db: db, name: name}, nil
+}
+
+func (a *DBAllocator) Acquire(ctx context.Context, holder string) (Lease, error) {
+	db := a.db.WithContext(ctx)
+	for {
+		var st SequenceState
+		if err := db.Where("name = ?", a.name).Limit(1).Find(&st).Error; err != nil {
+			return Lease{}, err
+		}
+		if st.Name == "" {
+			st = SequenceState{Name: a.name, Next: 1, Epoch: 1, Holder: holder}
+			res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&st)
+			if res.Error != nil {
+				return Lease{}, res.Error
+			}
+			if res.RowsAffected == 1 {
+				return Lease{Epoch: st.Epoch, Next: st.Next}, nil
+			}
+			// created by another holder at the same time
+			continue
+		}
+		// only the holder that read the current epoch moves it on
+		res := db.Model(&SequenceState{}).Where("name = ? AND epoch = ?", a.name, st.Epoch).Updates(map[string]any{
+			"epoch":      st.Epoch + 1,
+			"holder":     holder,
+			"updated_at": time.Now(),
+		})
+		if res.Error != nil {
+			return Lease{}, res.Error
+		}
+		if res.RowsAffected == 1 {
+			return Lease{Epoch: st.Epoch + 1, Next: st.Next, PrevHolder: st.Holder}, nil
+		}
+	}
+}
+
+func (a *DBAllocator) Reserve(ctx context.Context, lease Lease, next int64) error {
+	res := a.db.WithContext(ctx).Model(&SequenceState{}).Where("name = ? AND epoch = ?", a.name, lease.Epoch).Updates(map[string]any{
+		"next":       next,
+		"updated_at": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFenced
+	}
+	return nil
+}
+
+func (a *DBAllocator) RecordGap(ctx context.Context, gap Gap) error {
+	if gap.Last < gap.First {
+		return errors.New("empty sequence gap")
+	}
+	return a.db.WithContext(ctx).Create(&SequenceGap{
+		Name:   a.name,
+		First:  gap.First,
+		Last:   gap.Last,
+		Reason: gap.Reason,
+		Epoch:  gap.Epoch,
+		Holder: gap.Holder,
+	}).Error
+}
+
+func (a *DBAllocator) Gaps(ctx context.Context, after int64, limit int) ([]Gap, error) {
+	var rows []SequenceGap
+	if err := a.db.WithContext(ctx).Where("name = ? AND last > ?", a.name, after).Order("first").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Gap, len(rows))
+	for i, r := range rows {
+		out[i] = Gap{
+			First:  r.First,
+			Last:   r.Last,
+			Reason: r.Reason,
+			Epoch:  r.Epoch,
+			Holder: r.Holder,
+			At:     r.CreatedAt.UTC(),
+		}
+	}
+	return out, nil
+}
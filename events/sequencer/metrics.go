@@ -0,0 +1,26 @@
+package sequencer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var gapNumbers = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sequencer_gap_numbers_total",
+	Help: "Sequence numbers reserved but skipped, as they aren't in the log, by reason",
+}, []string{"reason"})
+
+var blocksReserved = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "sequencer_blocks_reserved_total",
+	Help: "Blocks of sequence numbers reserved from the allocator",
+})
+
+var fencedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "sequencer_fenced_total",
+	Help: "Reservations refused because another holder had acquired the sequence",
+})
+
+var epochGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sequencer_epoch",
+	Help: "Epoch under which this process holds the sequence",
+})
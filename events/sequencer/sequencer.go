@@ -0,0 +1,176 @@
+// Package sequencer allocates the sequence numbers of the relay's output stream.
+//
+// Numbers are strictly increasing and never reused, across restarts and, with replicas sharing the allocator's database, across replicas taking over from one another. They are reserved from the allocator in blocks before being handed out, so a crash can't lose track of any that consumers may have seen; the numbers reserved but never used are recorded as gaps. Each holder of the allocator has an epoch, and reservations under an older epoch are refused, fencing out a replica which has been taken over from.
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+var log = slog.Default().With("system", "sequencer")
+
+// ErrFenced is returned once another holder has acquired the allocator. The sequencer hands out no more numbers.
+var ErrFenced = errors.New("sequencer fenced: another holder has acquired the sequence")
+
+var ErrNotStarted = errors.New("sequencer not started")
+
+const (
+	// the previous run of the same holder stopped without returning its reservation, eg by crashing
+	GapRestart = "restart"
+	// another holder had reserved the numbers, and this one took over
+	GapFailover = "failover"
+)
+
+type Options struct {
+	// identifies this process to other replicas, eg by hostname
+	Holder string
+	// numbers reserved at a time; a crash leaves at most this many unused
+	BlockSize int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Holder:    "default",
+		BlockSize: 1000,
+	}
+}
+
+// Sequencer hands out sequence numbers reserved from an Allocator. It is safe for concurrent use.
+type Sequencer struct {
+	alloc Allocator
+	opts  Options
+
+	lk    sync.Mutex
+	lease *Lease
+	// next number to hand out, and the first not reserved
+	next int64
+	end  int64
+}
+
+func New(alloc Allocator, opts Options) *Sequencer {
+	if opts.BlockSize < 1 {
+		opts.BlockSize = DefaultOptions().BlockSize
+	}
+	return &Sequencer{
+		alloc: alloc,
+		opts:  opts,
+	}
+}
+
+// Start acquires the allocator, fencing out any previous holder, and returns the first number it will hand out. last is the highest number the caller's log holds (0 if it holds none); reserved numbers above it are recorded as a gap, and numbers are never handed out at or below it.
+func (s *Sequencer) Start(ctx context.Context, last int64) (int64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	lease, err := s.alloc.Acquire(ctx, s.opts.Holder)
+	if err != nil {
+		return 0, fmt.Errorf("acquiring sequence: %w", err)
+	}
+	next := max(lease.Next, last+1, 1)
+	if last+1 < lease.Next {
+		gap := Gap{
+			First:  last + 1,
+			Last:   lease.Next - 1,
+			Reason: GapRestart,
+			Epoch:  lease.Epoch,
+			Holder: s.opts.Holder,
+		}
+		if lease.PrevHolder != "" && lease.PrevHolder != s.opts.Holder {
+			gap.Reason = GapFailover
+		}
+		if err := s.alloc.RecordGap(ctx, gap); err != nil {
+			return 0, fmt.Errorf("recording sequence gap: %w", err)
+		}
+		gapNumbers.WithLabelValues(gap.Reason).Add(float64(gap.Last - gap.First + 1))
+		log.Warn("skipping sequence numbers reserved but not in the log", "first", gap.First, "last", gap.Last, "reason", gap.Reason, "prevHolder", lease.PrevHolder)
+	}
+	epochGauge.Set(float64(lease.Epoch))
+	log.Info("acquired sequence", "holder", s.opts.Holder, "epoch", lease.Epoch, "next", next)
+
+	s.lease = &lease
+	s.next = next
+	s.end = next
+	return next, nil
+}
+
+// Next hands out the next number, reserving another block when the current one is used up.
+func (s *Sequencer) Next(ctx context.Context) (int64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.lease == nil {
+		return 0, ErrNotStarted
+	}
+	if s.next >= s.end {
+		end := s.next + s.opts.BlockSize
+		if err := s.alloc.Reserve(ctx, *s.lease, end); err != nil {
+			if errors.Is(err, ErrFenced) {
+				fencedTotal.Inc()
+				s.lease = nil
+			}
+			return 0, err
+		}
+		blocksReserved.Inc()
+		s.end = end
+	}
+	seq := s.next
+	s.next++
+	return seq, nil
+}
+
+// Peek returns the number Next will hand out, unless another holder takes over first.
+func (s *Sequencer) Peek() int64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.next
+}
+
+// Stop returns the unused part of the reservation, so that a restart continues without a gap. Nothing may be handed out after it.
+func (s *Sequencer) Stop(ctx context.Context) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if s.lease == nil {
+		return nil
+	}
+	lease := *s.lease
+	s.lease = nil
+	if s.next == s.end {
+		return nil
+	}
+	return s.alloc.Reserve(ctx, lease, s.next)
+}
+
+// Status describes the sequencer, for operators.
+type Status struct {
+	Holder   string `json:"holder"`
+	Epoch    int64  `json:"epoch"`
+	Next     int64  `json:"next"`
+	Reserved int64  `json:"reserved"`
+	// false before Start, after Stop, and once fenced
+	Active bool `json:"active"`
+}
+
+func (s *Sequencer) Status() Status {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	st := Status{
+		Holder:   s.opts.Holder,
+		Next:     s.next,
+		Reserved: s.end,
+		Active:   s.lease != nil,
+	}
+	if s.lease != nil {
+		st.Epoch = s.lease.Epoch
+	}
+	return st
+}
+
+// Gaps returns up to limit recorded gaps ending after the given number, in order.
+func (s *Sequencer) Gaps(ctx context.Context, after int64, limit int) ([]Gap, error) {
+	return s.alloc.Gaps(ctx, after, limit)
+}
@@ -0,0 +1,153 @@
+package sequencer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testAllocator(t *testing.T) *DBAllocator {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "seq.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewDBAllocator(db, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func take(t *testing.T, s *Sequencer, n int) []int64 {
+	out := make([]int64, n)
+	for i := range out {
+		seq, err := s.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = seq
+	}
+	return out
+}
+
+func assertIncreasing(assert *assert.Assertions, seqs []int64) {
+	for i := 1; i < len(seqs); i++ {
+		assert.Greater(seqs[i], seqs[i-1])
+	}
+}
+
+func TestSequencerRestarts(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	alloc := testAllocator(t)
+	opts := Options{Holder: "relay-a", BlockSize: 10}
+
+	s := New(alloc, opts)
+	_, err := s.Next(ctx)
+	assert.ErrorIs(err, ErrNotStarted)
+	next, err := s.Start(ctx, 0)
+	assert.NoError(err)
+	assert.Equal(int64(1), next)
+	seqs := take(t, s, 25)
+	assert.Equal(int64(1), seqs[0])
+	assert.Equal(int64(25), seqs[24])
+
+	// a clean stop returns the rest of the block
+	assert.NoError(s.Stop(ctx))
+	s = New(alloc, opts)
+	next, err = s.Start(ctx, 25)
+	assert.NoError(err)
+	assert.Equal(int64(26), next)
+	gaps, err := s.Gaps(ctx, 0, 10)
+	assert.NoError(err)
+	assert.Empty(gaps)
+
+	// a crash after the log lost its last few events: nothing reserved is handed out again
+	seqs = append(seqs, take(t, s, 3)...)
+	s = New(alloc, opts)
+	next, err = s.Start(ctx, 26)
+	assert.NoError(err)
+	assert.Equal(int64(36), next)
+	seqs = append(seqs, take(t, s, 1)...)
+	assertIncreasing(assert, seqs)
+	gaps, err = s.Gaps(ctx, 0, 10)
+	assert.NoError(err)
+	if assert.Len(gaps, 1) {
+		assert.Equal(int64(27), gaps[0].First)
+		assert.Equal(int64(35), gaps[0].Last)
+		assert.Equal(GapRestart, gaps[0].Reason)
+	}
+	gaps, err = s.Gaps(ctx, 35, 10)
+	assert.NoError(err)
+	assert.Empty(gaps)
+
+	// a log ahead of the allocator, eg from before it was used, is continued
+	s = New(alloc, opts)
+	next, err = s.Start(ctx, 500)
+	assert.NoError(err)
+	assert.Equal(int64(501), next)
+	assert.Equal([]int64{501, 502}, take(t, s, 2))
+}
+
+func TestSequencerFailover(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	alloc := testAllocator(t)
+
+	a := New(alloc, Options{Holder: "relay-a", BlockSize: 10})
+	_, err := a.Start(ctx, 0)
+	assert.NoError(err)
+	fromA := take(t, a, 15)
+
+	// relay-b takes over while relay-a is still running, with its log replicated up to 12
+	b := New(alloc, Options{Holder: "relay-b", BlockSize: 10})
+	next, err := b.Start(ctx, 12)
+	assert.NoError(err)
+	assert.Equal(int64(21), next)
+	fromB := take(t, b, 15)
+
+	// relay-a may finish the block it had reserved, but reserves no more
+	fromA = append(fromA, take(t, a, 5)...)
+	_, err = a.Next(ctx)
+	assert.ErrorIs(err, ErrFenced)
+	assert.False(a.Status().Active)
+	_, err = a.Next(ctx)
+	assert.Error(err)
+	assert.NoError(a.Stop(ctx))
+
+	// no number was handed out twice
+	seen := map[int64]bool{}
+	for _, seq := range append(fromA, fromB...) {
+		assert.False(seen[seq], "seq %d handed out twice", seq)
+		seen[seq] = true
+	}
+	assertIncreasing(assert, fromB)
+	st := b.Status()
+	assert.True(st.Active)
+	assert.Equal(int64(2), st.Epoch)
+	assert.Equal(int64(36), st.Next)
+
+	gaps, err := b.Gaps(ctx, 0, 10)
+	assert.NoError(err)
+	if assert.Len(gaps, 1) {
+		assert.Equal(int64(13), gaps[0].First)
+		assert.Equal(int64(20), gaps[0].Last)
+		assert.Equal(GapFailover, gaps[0].Reason)
+		assert.Equal("relay-b", gaps[0].Holder)
+	}
+
+	// relay-a, restarted, takes back over from relay-b's crash
+	a = New(alloc, Options{Holder: "relay-a", BlockSize: 10})
+	next, err = a.Start(ctx, 35)
+	assert.NoError(err)
+	assert.Equal(int64(41), next)
+	_, err = b.Next(ctx)
+	for err == nil {
+		_, err = b.Next(ctx)
+	}
+	assert.ErrorIs(err, ErrFenced)
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+)
+
+// Stream protocol version negotiation.
+//
+// A consumer declares the version of the stream protocol it implements with the StreamVersionParam query parameter or the StreamVersionHeader header on the websocket handshake. The server answers with the version it will speak (the lower of the consumer's and its own current version) in the same header, and may follow up with #info frames warning about deprecated versions or announcing upcoming changes. Consumers declaring a version older than the server's minimum are sent an ErrUnsupportedVersion error frame and disconnected.
+const (
+	StreamVersionParam  = "protocolVersion"
+	StreamVersionHeader = "Atproto-Stream-Version"
+
+	// CurrentStreamVersion is the stream protocol version implemented by this package
+	CurrentStreamVersion int64 = 1
+
+	// error frame type sent to consumers whose declared version is no longer served
+	ErrUnsupportedVersion = "UnsupportedVersion"
+	// #info frame name warning a consumer its declared version (or lack of one) is deprecated
+	InfoDeprecatedVersion = "DeprecatedVersion"
+	// #info frame name announcing an upcoming change to the stream
+	InfoUpcomingChange = "UpcomingChange"
+)
+
+// VersionPolicy is the set of stream protocol versions a server accepts, and what it tells consumers about them.
+type VersionPolicy struct {
+	// version spoken to consumers which declare this version or a newer one
+	Current int64
+	// oldest version served; older consumers are rejected
+	Minimum int64
+	// consumers declaring an older version are warned that it is deprecated
+	DeprecatedBelow int64
+	// warn consumers which don't declare a version at all
+	WarnUndeclared bool
+	// announcements sent to every consumer on connect
+	Notices []string
+}
+
+// DefaultVersionPolicy accepts every version up to CurrentStreamVersion, without warnings.
+func DefaultVersionPolicy() VersionPolicy {
+	return VersionPolicy{
+		Current: CurrentStreamVersion,
+		Minimum: 1,
+	}
+}
+
+// Negotiation is the outcome of a consumer's version declaration.
+type Negotiation struct {
+	// declared version; zero if undeclared
+	Requested int64
+	// version the server speaks to the consumer
+	Version int64
+	// frames to send the consumer ahead of the stream
+	Info []*comatproto.SyncSubscribeRepos_Info
+}
+
+// Label returns the consumer's version for metrics: the negotiated version, or "undeclared".
+func (n *Negotiation) Label() string {
+	if n.Requested == 0 {
+		return "undeclared"
+	}
+	return strconv.FormatInt(n.Version, 10)
+}
+
+// Negotiate settles the version spoken to a consumer declaring the given version (empty if undeclared). If the consumer must be rejected, an error frame is returned for it.
+func (p *VersionPolicy) Negotiate(declared string) (*Negotiation, *ErrorFrame) {
+	n := &Negotiation{Version: p.Current}
+	declared = strings.TrimSpace(declared)
+	if declared != "" {
+		v, err := strconv.ParseInt(declared, 10, 64)
+		if err != nil || v < 1 {
+			return nil, &ErrorFrame{
+				Error:   ErrUnsupportedVersion,
+				Message: fmt.Sprintf("invalid stream protocol version: %q", declared),
+			}
+		}
+		if v < p.Minimum {
+			return nil, &ErrorFrame{
+				Error:   ErrUnsupportedVersion,
+				Message: fmt.Sprintf("stream protocol version %d is no longer supported; the oldest supported version is %d", v, p.Minimum),
+			}
+		}
+		n.Requested = v
+		n.Version = min(v, p.Current)
+	}
+
+	switch {
+	case n.Requested == 0 && p.WarnUndeclared:
+		n.Info = append(n.Info, infoFrame(InfoDeprecatedVersion, fmt.Sprintf("consumers should declare the stream protocol version they implement (with the %q parameter or %s header); the current version is %d", StreamVersionParam, StreamVersionHeader, p.Current)))
+	case n.Requested != 0 && n.Version < p.DeprecatedBelow:
+		n.Info = append(n.Info, infoFrame(InfoDeprecatedVersion, fmt.Sprintf("stream protocol version %d is deprecated and will stop being served; the current version is %d", n.Version, p.Current)))
+	}
+	for _, msg := range p.Notices {
+		n.Info = append(n.Info, infoFrame(InfoUpcomingChange, msg))
+	}
+	return n, nil
+}
+
+func infoFrame(name, msg string) *comatproto.SyncSubscribeRepos_Info {
+	return &comatproto.SyncSubscribeRepos_Info{
+		Name:    name,
+		Message: &msg,
+	}
+}
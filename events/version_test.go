@@ -0,0 +1,47 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	p := VersionPolicy{
+		Current:         3,
+		Minimum:         2,
+		DeprecatedBelow: 3,
+		Notices:         []string{"the #identity frame will carry handles from 2027-01-01"},
+	}
+
+	n, ef := p.Negotiate("")
+	assert.Nil(ef)
+	assert.Equal(int64(3), n.Version)
+	assert.Equal("undeclared", n.Label())
+	assert.Len(n.Info, 1)
+	assert.Equal(InfoUpcomingChange, n.Info[0].Name)
+
+	p.WarnUndeclared = true
+	n, _ = p.Negotiate("")
+	assert.Len(n.Info, 2)
+	assert.Equal(InfoDeprecatedVersion, n.Info[0].Name)
+
+	n, ef = p.Negotiate("2")
+	assert.Nil(ef)
+	assert.Equal(int64(2), n.Version)
+	assert.Equal("2", n.Label())
+	assert.Equal(InfoDeprecatedVersion, n.Info[0].Name)
+
+	// newer consumers get the current version
+	n, ef = p.Negotiate("7")
+	assert.Nil(ef)
+	assert.Equal(int64(3), n.Version)
+	assert.Len(n.Info, 1)
+
+	_, ef = p.Negotiate("1")
+	assert.Equal(ErrUnsupportedVersion, ef.Error)
+	_, ef = p.Negotiate("v2")
+	assert.Equal(ErrUnsupportedVersion, ef.Error)
+}
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/did"
 	arc "github.com/hashicorp/golang-lru/arc/v2"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -76,10 +77,13 @@ type failCacheItem struct {
 }
 
 type ProdHandleResolver struct {
-	client    *http.Client
+	// fetches handles' /.well-known/atproto-did; may be replaced before use
+	Client    *http.Client
 	resolver  *net.Resolver
 	ReqMod    func(*http.Request, string) error
 	FailCache *arc.ARCCache[string, *failCacheItem]
+	// if not nil, TXT lookups go to these DNS-over-HTTPS endpoints instead of the resolve address
+	DoH *identity.DoHResolver
 }
 
 func NewProdHandleResolver(failureCacheSize int, resolveAddr string, forceUDP bool) (*ProdHandleResolver, error) {
@@ -112,7 +116,7 @@ func NewProdHandleResolver(failureCacheSize int, resolveAddr string, forceUDP bo
 
 	return &ProdHandleResolver{
 		FailCache: failureCache,
-		client:    &c,
+		Client:    &c,
 		resolver:  r,
 	}, nil
 }
@@ -205,7 +209,7 @@ func (dr *ProdHandleResolver) resolveWellKnown(ctx context.Context, handle strin
 
 	req = req.WithContext(ctx)
 
-	resp, err := dr.client.Do(req)
+	resp, err := dr.Client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve handle (%s) through HTTP well-known route: %s", handle, err)
 	}
@@ -231,7 +235,13 @@ func (dr *ProdHandleResolver) resolveWellKnown(ctx context.Context, handle strin
 }
 
 func (dr *ProdHandleResolver) resolveDNS(ctx context.Context, handle string) (string, error) {
-	res, err := dr.resolver.LookupTXT(ctx, "_atproto."+handle)
+	var res []string
+	var err error
+	if dr.DoH != nil {
+		res, err = dr.DoH.LookupTXT(ctx, "_atproto."+handle)
+	} else {
+		res, err = dr.resolver.LookupTXT(ctx, "_atproto."+handle)
+	}
 	if err != nil {
 		return "", fmt.Errorf("handle lookup failed: %w", err)
 	}
@@ -0,0 +1,126 @@
+// Package lexmock provides a test double for util.LexClient, answering XRPC calls with canned responses registered per method and recording the calls made, so code calling XRPC methods can be tested without an HTTP server.
+//
+// lexgen's --gen-mocks mode generates a typed wrapper of Client for each lexicon package, with a method registering the response to each of its XRPC methods, taking the method's output type.
+package lexmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNotMocked is returned for calls of methods no response was registered for.
+var ErrNotMocked = errors.New("no response registered for XRPC method")
+
+// Call is a recorded XRPC call. A body passed as an io.Reader is recorded as the bytes read from it.
+type Call struct {
+	Method        string
+	InputEncoding string
+	Endpoint      string
+	Params        map[string]any
+	Body          any
+}
+
+// Handler answers a call, filling in out (which may be nil) like a client would from the response body.
+type Handler func(ctx context.Context, call Call, out any) error
+
+// Client is a util.LexClient answering calls with registered handlers. It is safe for concurrent use.
+type Client struct {
+	lk       sync.Mutex
+	handlers map[string]Handler
+	calls    []Call
+}
+
+func New() *Client {
+	return &Client{handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler of calls of an XRPC method (eg "app.bsky.actor.getProfile"), replacing any registered before.
+func (c *Client) Handle(endpoint string, h Handler) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.handlers[endpoint] = h
+}
+
+// Respond registers a canned response to calls of an XRPC method: err if it isn't nil, and otherwise resp, which is copied into the caller's output through JSON as it would be off the wire, or as is for raw ([]byte) responses.
+func (c *Client) Respond(endpoint string, resp any, err error) {
+	c.Handle(endpoint, func(ctx context.Context, call Call, out any) error {
+		if err != nil {
+			return err
+		}
+		return copyResponse(resp, out)
+	})
+}
+
+// Calls returns the calls of an XRPC method recorded so far, in order; all calls if endpoint is empty.
+func (c *Client) Calls(endpoint string) []Call {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	var out []Call
+	for _, call := range c.calls {
+		if endpoint == "" || call.Endpoint == endpoint {
+			out = append(out, call)
+		}
+	}
+	return out
+}
+
+// Reset forgets the recorded calls, keeping the registered responses.
+func (c *Client) Reset() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.calls = nil
+}
+
+func (c *Client) LexDo(ctx context.Context, method string, inputEncoding string, endpoint string, params map[string]any, bodyData any, out any) error {
+	if r, ok := bodyData.(io.Reader); ok {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+		bodyData = b
+	}
+	call := Call{
+		Method:        method,
+		InputEncoding: inputEncoding,
+		Endpoint:      endpoint,
+		Params:        params,
+		Body:          bodyData,
+	}
+
+	c.lk.Lock()
+	c.calls = append(c.calls, call)
+	h := c.handlers[endpoint]
+	c.lk.Unlock()
+
+	if h == nil {
+		return fmt.Errorf("%w: %s", ErrNotMocked, endpoint)
+	}
+	return h(ctx, call, out)
+}
+
+func copyResponse(resp any, out any) error {
+	if out == nil || resp == nil {
+		return nil
+	}
+	if raw, ok := resp.([]byte); ok {
+		w, ok := out.(io.Writer)
+		if !ok {
+			return fmt.Errorf("raw response for a %T output", out)
+		}
+		_, err := io.Copy(w, bytes.NewReader(raw))
+		return err
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("encoding canned response: %w", err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decoding canned response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package lexmock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	c := New()
+	var _ util.LexClient = c
+
+	cid := "bafyreib2rxk3rh6kzwq"
+	c.Respond("com.atproto.repo.getRecord", &atproto.RepoGetRecord_Output{Uri: "at://did:plc:aaa/app.gndr.feed.post/3k", Cid: &cid}, nil)
+	out, err := atproto.RepoGetRecord(ctx, c, "", "app.gndr.feed.post", "did:plc:aaa", "3k")
+	assert.NoError(err)
+	assert.Equal("at://did:plc:aaa/app.gndr.feed.post/3k", out.Uri)
+	assert.Equal(cid, *out.Cid)
+
+	boom := errors.New("boom")
+	c.Respond("com.atproto.server.createSession", nil, boom)
+	_, err = atproto.ServerCreateSession(ctx, c, &atproto.ServerCreateSession_Input{Identifier: "alice", Password: "hunter2"})
+	assert.ErrorIs(err, boom)
+
+	_, err = atproto.SyncGetLatestCommit(ctx, c, "did:plc:aaa")
+	assert.ErrorIs(err, ErrNotMocked)
+
+	c.Respond("com.atproto.sync.getRepo", []byte("car bytes"), nil)
+	car, err := atproto.SyncGetRepo(ctx, c, "did:plc:aaa", "")
+	assert.NoError(err)
+	assert.Equal([]byte("car bytes"), car)
+
+	calls := c.Calls("com.atproto.repo.getRecord")
+	assert.Len(calls, 1)
+	assert.Equal(util.Query, calls[0].Method)
+	assert.Equal("did:plc:aaa", calls[0].Params["repo"])
+	sessions := c.Calls("com.atproto.server.createSession")
+	assert.Len(sessions, 1)
+	assert.Equal("alice", sessions[0].Body.(*atproto.ServerCreateSession_Input).Identifier)
+	assert.Len(c.Calls(""), 4)
+
+	// readers are recorded as the bytes read
+	c.Respond("com.atproto.repo.importRepo", nil, nil)
+	assert.NoError(c.LexDo(ctx, util.Procedure, "application/vnd.ipld.car", "com.atproto.repo.importRepo", nil, bytes.NewReader([]byte("car")), nil))
+	assert.Equal([]byte("car"), c.Calls("com.atproto.repo.importRepo")[0].Body)
+
+	c.Reset()
+	assert.Empty(c.Calls(""))
+}
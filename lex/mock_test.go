@@ -0,0 +1,104 @@
+package lex
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunMocks(t *testing.T) {
+	lexicons := []string{`{
+  "lexicon": 1,
+  "id": "app.gndr.actor.getThing",
+  "defs": {
+    "main": {
+      "type": "query",
+      "parameters": {"type": "params", "required": ["actor"], "properties": {"actor": {"type": "string"}}},
+      "output": {"encoding": "application/json", "schema": {"type": "ref", "ref": "app.gndr.actor.defs#thing"}}
+    }
+  }
+}`, `{
+  "lexicon": 1,
+  "id": "app.gndr.actor.putThing",
+  "defs": {
+    "main": {
+      "type": "procedure",
+      "input": {"encoding": "application/json", "schema": {"type": "object", "properties": {"did": {"type": "string"}}}}
+    }
+  }
+}`, `{
+  "lexicon": 1,
+  "id": "app.gndr.actor.exportThings",
+  "defs": {
+    "main": {
+      "type": "query",
+      "output": {"encoding": "application/vnd.ipld.car"}
+    }
+  }
+}`, `{
+  "lexicon": 1,
+  "id": "app.gndr.actor.listThings",
+  "defs": {
+    "main": {
+      "type": "query",
+      "output": {"encoding": "application/json", "schema": {"type": "object", "properties": {"cursor": {"type": "string"}}}}
+    }
+  }
+}`, `{
+  "lexicon": 1,
+  "id": "app.gndr.actor.defs",
+  "defs": {
+    "thing": {"type": "object", "required": ["did"], "properties": {"did": {"type": "string"}}}
+  }
+}`}
+	var schemas []*Schema
+	for _, raw := range lexicons {
+		var s Schema
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, &s)
+	}
+
+	outdir := t.TempDir()
+	pkgs := []Package{
+		{"gndr", "app.gndr", outdir, "github.com/bluesky-social/indigo/api/gndr"},
+		{"atproto", "com.atproto", filepath.Join(outdir, "atproto"), "github.com/bluesky-social/indigo/api/atproto"},
+	}
+	if err := RunMocks(schemas, nil, pkgs); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(outdir, "gndrmock", "mock.go")
+	out, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), fname, out, 0); err != nil {
+		t.Fatalf("generated code doesn't parse: %s", err)
+	}
+	code := string(out)
+	for _, want := range []string{
+		"package gndrmock",
+		`appgndrtypes "github.com/bluesky-social/indigo/api/gndr"`,
+		"func (c *Client) OnActorGetThing(out *appgndrtypes.ActorDefs_Thing, err error)",
+		"func (c *Client) OnActorListThings(out *appgndrtypes.ActorListThings_Output, err error)",
+		"func (c *Client) OnActorExportThings(out []byte, err error)",
+		"func (c *Client) OnActorPutThing(err error)",
+		`c.Respond("app.gndr.actor.putThing", nil, err)`,
+		"func (c *Client) ActorGetThingCalls() []lexmock.Call",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "api/atproto") {
+		t.Fatalf("generated code imports an unused package:\n%s", code)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "atproto")); !os.IsNotExist(err) {
+		t.Fatalf("expected no mock for a package without schemas")
+	}
+}
@@ -0,0 +1,85 @@
+package lex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Remap rewrites an NSID prefix, e.g. "app.bsky" to "app.gndr", so that lexicons published under one namespace can be generated as if they were defined under another.
+type Remap struct {
+	From string
+	To   string
+}
+
+// ParseRemaps parses remaps written as "from=to", e.g. "app.bsky=app.gndr".
+func ParseRemaps(specs []string) ([]Remap, error) {
+	var out []Remap
+	for _, spec := range specs {
+		from, to, ok := strings.Cut(spec, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid remap %q, expected from=to", spec)
+		}
+		out = append(out, Remap{From: from, To: to})
+	}
+	return out, nil
+}
+
+// apply rewrites an NSID or a ref to a def ("nsid#name"), if it falls under the remap's prefix. Prefixes match whole NSID segments, so "app.bsky" doesn't remap "app.bskyx.foo". Local refs ("#name") are left alone.
+func (r Remap) apply(s string) (string, bool) {
+	nsid, def, hasDef := strings.Cut(s, "#")
+	if nsid != r.From && !strings.HasPrefix(nsid, r.From+".") {
+		return s, false
+	}
+	nsid = r.To + strings.TrimPrefix(nsid, r.From)
+	if hasDef {
+		return nsid + "#" + def, true
+	}
+	return nsid, true
+}
+
+func remapName(s string, remaps []Remap) string {
+	for _, r := range remaps {
+		if out, ok := r.apply(s); ok {
+			return out
+		}
+	}
+	return s
+}
+
+// RemapSchemas rewrites the IDs of the schemas and the refs inside their defs. The first remap matching a name applies.
+func RemapSchemas(schemas []*Schema, remaps []Remap) {
+	if len(remaps) == 0 {
+		return
+	}
+	for _, s := range schemas {
+		s.ID = remapName(s.ID, remaps)
+		for _, d := range s.Defs {
+			d.remap(remaps)
+		}
+	}
+}
+
+func (ts *TypeSchema) remap(remaps []Remap) {
+	if ts == nil {
+		return
+	}
+	if ts.Ref != "" {
+		ts.Ref = remapName(ts.Ref, remaps)
+	}
+	for i, r := range ts.Refs {
+		ts.Refs[i] = remapName(r, remaps)
+	}
+	ts.Parameters.remap(remaps)
+	if ts.Input != nil {
+		ts.Input.Schema.remap(remaps)
+	}
+	if ts.Output != nil {
+		ts.Output.Schema.remap(remaps)
+	}
+	ts.Record.remap(remaps)
+	ts.Items.remap(remaps)
+	for _, p := range ts.Properties {
+		p.remap(remaps)
+	}
+}
@@ -0,0 +1,135 @@
+package lex
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRemaps(t *testing.T) {
+	remaps, err := ParseRemaps([]string{"app.bsky=app.gndr", " chat.bsky = chat.gndr "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Remap{{"app.bsky", "app.gndr"}, {"chat.bsky", "chat.gndr"}}
+	if len(remaps) != 2 || remaps[0] != expected[0] || remaps[1] != expected[1] {
+		t.Fatalf("expected %#v, got %#v", expected, remaps)
+	}
+	for _, bad := range []string{"app.bsky", "=app.gndr", "app.bsky="} {
+		if _, err := ParseRemaps([]string{bad}); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestRemapSchemas(t *testing.T) {
+	postJSON := `{
+  "lexicon": 1,
+  "id": "app.bsky.feed.post",
+  "defs": {
+    "main": {
+      "type": "record",
+      "key": "tid",
+      "record": {
+        "type": "object",
+        "required": ["text", "createdAt"],
+        "properties": {
+          "text": {"type": "string"},
+          "reply": {"type": "ref", "ref": "#replyRef"},
+          "embed": {"type": "union", "refs": ["app.bsky.embed.external"]},
+          "labels": {"type": "union", "refs": ["com.atproto.label.defs#selfLabels"]},
+          "tags": {"type": "array", "items": {"type": "ref", "ref": "app.bskyx.feed.defs#tag"}},
+          "createdAt": {"type": "string", "format": "datetime"}
+        }
+      }
+    },
+    "replyRef": {
+      "type": "object",
+      "required": ["root"],
+      "properties": {
+        "root": {"type": "ref", "ref": "com.atproto.repo.strongRef"}
+      }
+    }
+  }
+}`
+	var s Schema
+	if err := json.Unmarshal([]byte(postJSON), &s); err != nil {
+		t.Fatal(err)
+	}
+	RemapSchemas([]*Schema{&s}, []Remap{{"app.bsky", "app.gndr"}})
+
+	if s.ID != "app.gndr.feed.post" {
+		t.Fatalf("expected remapped ID, got %q", s.ID)
+	}
+	props := s.Defs["main"].Record.Properties
+	for name, expected := range map[string]string{
+		"reply":  "#replyRef",
+		"embed":  "app.gndr.embed.external",
+		"labels": "com.atproto.label.defs#selfLabels",
+	} {
+		got := props[name].Ref
+		if len(props[name].Refs) > 0 {
+			got = props[name].Refs[0]
+		}
+		if got != expected {
+			t.Fatalf("%s: expected %q, got %q", name, expected, got)
+		}
+	}
+	if ref := props["tags"].Items.Ref; ref != "app.bskyx.feed.defs#tag" {
+		t.Fatalf("expected a ref outside the prefix to be left alone, got %q", ref)
+	}
+	if ref := s.Defs["replyRef"].Properties["root"].Ref; ref != "com.atproto.repo.strongRef" {
+		t.Fatalf("expected an unmapped ref to be left alone, got %q", ref)
+	}
+}
+
+func TestRemapGen(t *testing.T) {
+	getJSON := `{
+  "lexicon": 1,
+  "id": "app.bsky.actor.getThing",
+  "defs": {
+    "main": {
+      "type": "query",
+      "parameters": {"type": "params", "required": ["actor"], "properties": {"actor": {"type": "string"}}},
+      "output": {"encoding": "application/json", "schema": {"type": "ref", "ref": "app.bsky.actor.defs#thing"}}
+    }
+  }
+}`
+	defsJSON := `{
+  "lexicon": 1,
+  "id": "app.bsky.actor.defs",
+  "defs": {
+    "thing": {"type": "object", "required": ["did"], "properties": {"did": {"type": "string"}}}
+  }
+}`
+	var schemas []*Schema
+	for _, raw := range []string{getJSON, defsJSON} {
+		var s Schema
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, &s)
+	}
+	RemapSchemas(schemas, []Remap{{"app.bsky", "app.gndr"}})
+
+	outdir := t.TempDir()
+	pkgs := []Package{{"gndr", "app.gndr", outdir, "github.com/bluesky-social/indigo/api/gndr"}}
+	if err := Run(schemas, nil, pkgs); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(outdir, "actorgetThing.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(out)
+	if strings.Contains(code, "app.bsky") {
+		t.Fatalf("generated code still refers to app.bsky:\n%s", code)
+	}
+	for _, want := range []string{"package gndr", `"app.gndr.actor.getThing"`, "*ActorDefs_Thing"} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+}
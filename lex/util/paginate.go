@@ -0,0 +1,168 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+)
+
+var (
+	// ErrMaxPages is yielded when pagination stops at PaginateOptions.MaxPages with pages left
+	ErrMaxPages = errors.New("stopped paginating at the page limit")
+	// ErrCursorRepeated is yielded when a server hands back the cursor it was given, which would loop forever
+	ErrCursorRepeated = errors.New("server repeated the pagination cursor")
+)
+
+const (
+	// default number of times a rate limited page is retried
+	DefaultPageRetries = 5
+	// default cap on the wait before retrying a rate limited page
+	DefaultMaxRetryWait = time.Minute
+)
+
+// PageFunc fetches one page of a cursor paginated query, starting at cursor (empty for the first page), returning its items and the cursor of the next page (nil or empty on the last). It adapts a generated query function, eg:
+//
+//	func(ctx context.Context, cursor string) ([]*atproto.SyncListRepos_Repo, *string, error) {
+//		out, err := atproto.SyncListRepos(ctx, c, cursor, 1000)
+//		if err != nil {
+//			return nil, nil, err
+//		}
+//		return out.Repos, out.Cursor, nil
+//	}
+type PageFunc[T any] func(ctx context.Context, cursor string) ([]T, *string, error)
+
+// Waiter paces requests, eg a *rate.Limiter
+type Waiter interface {
+	Wait(ctx context.Context) error
+}
+
+// PaginateOptions configures Pages and Paginate. The zero value starts at the first page, fetches pages as fast as the server allows, and retries rate limited pages DefaultPageRetries times.
+type PaginateOptions struct {
+	// cursor to start at, eg to resume; empty for the first page
+	Cursor string
+	// stop after this many pages, yielding ErrMaxPages if there are more; 0 for no limit
+	MaxPages int
+	// waited on before fetching each page; nil doesn't pace requests
+	Limiter Waiter
+	// times a rate limited page is retried, waiting until the server's rate limit resets (or backing off exponentially, if it doesn't say); 0 uses DefaultPageRetries, negative doesn't retry
+	MaxRetries int
+	// cap on the wait before a retry; 0 uses DefaultMaxRetryWait
+	MaxRetryWait time.Duration
+}
+
+// Page is one page of a paginated query
+type Page[T any] struct {
+	Items []T
+	// cursor the page was fetched at
+	Cursor string
+	// cursor of the next page, empty on the last page
+	Next string
+	// of the pages fetched, from 1
+	Number int
+}
+
+// throttled is implemented by client errors for rate limited requests (xrpc.Error and client.APIError)
+type throttled interface {
+	IsThrottled() bool
+}
+
+// throttledUntil is implemented by client errors which report when a rate limit resets (xrpc.Error)
+type throttledUntil interface {
+	ThrottledUntil() time.Time
+}
+
+// Pages iterates over the pages of a cursor paginated query, following each page's cursor to the next. An error ends the iteration, after being yielded.
+func Pages[T any](ctx context.Context, fetch PageFunc[T], opts PaginateOptions) iter.Seq2[Page[T], error] {
+	return func(yield func(Page[T], error) bool) {
+		cursor := opts.Cursor
+		for n := 1; ; n++ {
+			if opts.MaxPages > 0 && n > opts.MaxPages {
+				yield(Page[T]{Cursor: cursor}, fmt.Errorf("%w (%d pages)", ErrMaxPages, opts.MaxPages))
+				return
+			}
+			items, next, err := fetchPage(ctx, fetch, cursor, &opts)
+			if err != nil {
+				yield(Page[T]{Cursor: cursor, Number: n}, err)
+				return
+			}
+			p := Page[T]{Items: items, Cursor: cursor, Number: n}
+			if next != nil {
+				p.Next = *next
+			}
+			if p.Next != "" && p.Next == cursor {
+				yield(p, ErrCursorRepeated)
+				return
+			}
+			if !yield(p, nil) || p.Next == "" {
+				return
+			}
+			cursor = p.Next
+		}
+	}
+}
+
+// Paginate iterates over the items of a cursor paginated query, across its pages. An error ends the iteration, after being yielded with the zero item.
+func Paginate[T any](ctx context.Context, fetch PageFunc[T], opts PaginateOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		for p, err := range Pages(ctx, fetch, opts) {
+			if err != nil {
+				// a page repeating its cursor is still yielded, before the error
+				for _, it := range p.Items {
+					if !yield(it, nil) {
+						return
+					}
+				}
+				yield(zero, err)
+				return
+			}
+			for _, it := range p.Items {
+				if !yield(it, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// fetchPage fetches one page, pacing it and retrying it while it is rate limited
+func fetchPage[T any](ctx context.Context, fetch PageFunc[T], cursor string, opts *PaginateOptions) ([]T, *string, error) {
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = DefaultPageRetries
+	}
+	maxWait := opts.MaxRetryWait
+	if maxWait == 0 {
+		maxWait = DefaultMaxRetryWait
+	}
+	for attempt := 0; ; attempt++ {
+		if opts.Limiter != nil {
+			if err := opts.Limiter.Wait(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		items, next, err := fetch(ctx, cursor)
+		if err == nil {
+			return items, next, nil
+		}
+		var th throttled
+		if !errors.As(err, &th) || !th.IsThrottled() || attempt >= retries {
+			return nil, nil, err
+		}
+		wait := time.Second << attempt
+		var tu throttledUntil
+		if errors.As(err, &tu) && !tu.ThrottledUntil().IsZero() {
+			wait = time.Until(tu.ThrottledUntil())
+		}
+		wait = min(max(wait, 0), maxWait)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pager serves items 0..total-1, size at a time, with the index of the next item as the cursor
+type pager struct {
+	total, size int
+	// fetches, and throttled responses left to give
+	calls, throttle int
+	until           time.Time
+}
+
+type throttledError struct{ until time.Time }
+
+func (e *throttledError) Error() string             { return "rate limited" }
+func (e *throttledError) IsThrottled() bool         { return true }
+func (e *throttledError) ThrottledUntil() time.Time { return e.until }
+
+func (p *pager) fetch(ctx context.Context, cursor string) ([]int, *string, error) {
+	p.calls++
+	if p.throttle > 0 {
+		p.throttle--
+		return nil, nil, fmt.Errorf("listing: %w", &throttledError{until: p.until})
+	}
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+	var items []int
+	for i := start; i < p.total && i < start+p.size; i++ {
+		items = append(items, i)
+	}
+	if start+p.size >= p.total {
+		return items, nil, nil
+	}
+	next := strconv.Itoa(start + p.size)
+	return items, &next, nil
+}
+
+type countingWaiter int
+
+func (w *countingWaiter) Wait(ctx context.Context) error {
+	*w++
+	return nil
+}
+
+func TestPaginate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	p := &pager{total: 10, size: 3}
+	var lim countingWaiter
+	var got []int
+	for it, err := range Paginate(ctx, p.fetch, PaginateOptions{Limiter: &lim}) {
+		assert.NoError(err)
+		got = append(got, it)
+	}
+	assert.Equal([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+	assert.Equal(4, p.calls)
+	assert.Equal(countingWaiter(4), lim)
+
+	// resuming, and stopping early
+	p = &pager{total: 10, size: 3}
+	got = nil
+	for it, err := range Paginate(ctx, p.fetch, PaginateOptions{Cursor: "3"}) {
+		assert.NoError(err)
+		got = append(got, it)
+		if it == 4 {
+			break
+		}
+	}
+	assert.Equal([]int{3, 4}, got)
+	assert.Equal(1, p.calls)
+}
+
+func TestPages(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	p := &pager{total: 10, size: 3}
+	var cursors []string
+	var last Page[int]
+	var lastErr error
+	for page, err := range Pages(ctx, p.fetch, PaginateOptions{MaxPages: 2}) {
+		cursors = append(cursors, page.Cursor)
+		last, lastErr = page, err
+	}
+	assert.Equal([]string{"", "3", "6"}, cursors)
+	assert.ErrorIs(lastErr, ErrMaxPages)
+	// where to pick up again
+	assert.Equal("6", last.Cursor)
+
+	repeat := func(ctx context.Context, cursor string) ([]int, *string, error) {
+		next := "same"
+		return []int{1}, &next, nil
+	}
+	n := 0
+	for _, err := range Paginate(ctx, repeat, PaginateOptions{}) {
+		n++
+		if n == 3 {
+			assert.ErrorIs(err, ErrCursorRepeated)
+		}
+	}
+	assert.Equal(3, n)
+}
+
+func TestPaginateThrottled(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// retried after the server's reset time
+	p := &pager{total: 4, size: 2, throttle: 2, until: time.Now().Add(10 * time.Millisecond)}
+	var got []int
+	for it, err := range Paginate(ctx, p.fetch, PaginateOptions{}) {
+		assert.NoError(err)
+		got = append(got, it)
+	}
+	assert.Equal([]int{0, 1, 2, 3}, got)
+	assert.Equal(4, p.calls)
+
+	// until retries run out, with the wait capped
+	p = &pager{total: 4, size: 2, throttle: 10}
+	start := time.Now()
+	var lastErr error
+	for _, err := range Paginate(ctx, p.fetch, PaginateOptions{MaxRetries: 2, MaxRetryWait: time.Millisecond}) {
+		lastErr = err
+	}
+	var th *throttledError
+	assert.True(errors.As(lastErr, &th))
+	assert.Equal(3, p.calls)
+	assert.Less(time.Since(start), time.Second)
+
+	// other errors aren't retried
+	p = &pager{total: 4, size: 2}
+	for _, err := range Paginate(ctx, p.fetch, PaginateOptions{Cursor: "bad"}) {
+		lastErr = err
+	}
+	assert.Error(lastErr)
+	assert.Equal(1, p.calls)
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamDecoder is an 'out' for LexClient.LexDo which decodes the response body itself, as it is read, rather than having it decoded whole into memory. Clients which support it pass it the body; others decode into it as JSON, so it should also implement json.Unmarshaler.
+type StreamDecoder interface {
+	DecodeStream(r io.Reader) error
+}
+
+// ArrayStream is a StreamDecoder for JSON object responses with a large array field, eg the repos of com.atproto.sync.listRepos: the array's items are decoded one at a time and passed to Each, so only one is held in memory. The response's other fields are kept in Rest.
+type ArrayStream[T any] struct {
+	// name of the array field
+	Field string
+	// called with each item of the array, in order; an error stops decoding, and is returned
+	Each func(item *T) error
+
+	Rest map[string]json.RawMessage
+	// number of items passed to Each
+	Count int
+}
+
+var _ StreamDecoder = (*ArrayStream[any])(nil)
+
+func (s *ArrayStream[T]) DecodeStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected %v in response object", tok)
+		}
+		if key != s.Field {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("decoding %q: %w", key, err)
+			}
+			if s.Rest == nil {
+				s.Rest = make(map[string]json.RawMessage)
+			}
+			s.Rest[key] = raw
+			continue
+		}
+		if err := s.decodeItems(dec); err != nil {
+			return fmt.Errorf("decoding %q: %w", key, err)
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func (s *ArrayStream[T]) decodeItems(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("expected an array, got %v", tok)
+	}
+	for dec.More() {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("item %d: %w", s.Count, err)
+		}
+		s.Count++
+		if err := s.Each(&item); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// UnmarshalJSON decodes a response which was read whole, for clients which don't stream
+func (s *ArrayStream[T]) UnmarshalJSON(b []byte) error {
+	return s.DecodeStream(bytes.NewReader(b))
+}
+
+// Cursor returns the response's string "cursor" field, empty if it has none
+func (s *ArrayStream[T]) Cursor() string {
+	raw, ok := s.Rest["cursor"]
+	if !ok {
+		return ""
+	}
+	var c string
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return ""
+	}
+	return c
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
+
+// StreamQuery calls an XRPC query whose response has a large array field, passing its items to each as they are decoded rather than reading the response into memory. Returns the response's cursor, if any.
+func StreamQuery[T any](ctx context.Context, c LexClient, endpoint string, params map[string]any, field string, each func(item *T) error) (string, error) {
+	s := &ArrayStream[T]{Field: field, Each: each}
+	if err := c.LexDo(ctx, Query, "", endpoint, params, nil, s); err != nil {
+		return "", err
+	}
+	return s.Cursor(), nil
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type streamItem struct {
+	Did string `json:"did"`
+}
+
+func TestArrayStream(t *testing.T) {
+	assert := assert.New(t)
+
+	var dids []string
+	s := &ArrayStream[streamItem]{Field: "repos", Each: func(it *streamItem) error {
+		dids = append(dids, it.Did)
+		return nil
+	}}
+	body := `{"cursor": "abc", "repos": [{"did": "did:plc:a"}, {"did": "did:plc:b", "head": "x"}], "extra": {"n": 1}}`
+	assert.NoError(s.DecodeStream(strings.NewReader(body)))
+	assert.Equal([]string{"did:plc:a", "did:plc:b"}, dids)
+	assert.Equal(2, s.Count)
+	assert.Equal("abc", s.Cursor())
+	assert.JSONEq(`{"n": 1}`, string(s.Rest["extra"]))
+
+	// clients which don't stream decode into it as JSON
+	dids = nil
+	s = &ArrayStream[streamItem]{Field: "repos", Each: s.Each}
+	assert.NoError(json.Unmarshal([]byte(body), s))
+	assert.Equal([]string{"did:plc:a", "did:plc:b"}, dids)
+
+	// a missing or null array, and no cursor
+	s = &ArrayStream[streamItem]{Field: "repos", Each: func(*streamItem) error { return nil }}
+	assert.NoError(s.DecodeStream(strings.NewReader(`{"repos": null}`)))
+	assert.Equal(0, s.Count)
+	assert.Equal("", s.Cursor())
+
+	// errors from Each stop decoding
+	stop := errors.New("stop")
+	s = &ArrayStream[streamItem]{Field: "repos", Each: func(*streamItem) error { return stop }}
+	assert.ErrorIs(s.DecodeStream(strings.NewReader(body)), stop)
+	assert.Equal(1, s.Count)
+
+	for _, bad := range []string{`[]`, `{"repos": {}}`, `{"repos": [{"did": 1}]}`, `{"repos": [`} {
+		s = &ArrayStream[streamItem]{Field: "repos", Each: func(*streamItem) error { return nil }}
+		assert.Error(s.DecodeStream(strings.NewReader(bad)), bad)
+	}
+}
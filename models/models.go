@@ -152,3 +152,354 @@ type DomainBan struct {
 	gorm.Model
 	Domain string
 }
+
+// DIDClassification is the persisted form of a sovereignty.Classification
+type DIDClassification struct {
+	gorm.Model
+	Did         string `gorm:"uniqueIndex"`
+	Country     string
+	Subdivision string
+	Source      string
+	ExpiresAt   *time.Time `gorm:"index"`
+	// sovereignty.Confidence of the country resolver's answer; 0 (none) for classifications made by operators or imported
+	Confidence int
+}
+
+// MinorFlag is the persisted form of a minors.Flag
+type MinorFlag struct {
+	gorm.Model
+	Did    string `gorm:"uniqueIndex:idx_minor_did_reason"`
+	Reason string `gorm:"uniqueIndex:idx_minor_did_reason"`
+	Until  time.Time
+}
+
+// PriorityAccount is the persisted form of a priority.Account
+type PriorityAccount struct {
+	gorm.Model
+	Did      string `gorm:"uniqueIndex"`
+	Category string
+	Note     string
+	AddedBy  string
+}
+
+// PriorityAuditEntry records a change to the set of priority accounts
+type PriorityAuditEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"index"`
+	// "add", "update" or "remove"
+	Action   string
+	Category string
+	Note     string
+	Actor    string
+	RemoteIP string
+}
+
+// VerifiedOrg is the persisted form of an orgs.Org
+type VerifiedOrg struct {
+	gorm.Model
+	Did        string `gorm:"uniqueIndex"`
+	Domain     string
+	Name       string
+	Kind       string
+	Method     string
+	VerifiedAt time.Time
+}
+
+// Appeal is a user-submitted request to review a sovereignty decision about their account
+type Appeal struct {
+	gorm.Model
+	Did string `gorm:"index"`
+	// what is being appealed: "classification" or "takedown"
+	Kind string `gorm:"index"`
+	// classification at the time of submission; empty if unclassified
+	CurrentCountry string
+	// country the user says they should be classified as; empty asks for no classification
+	RequestedCountry string
+	Message          string
+	// "pending", "accepted" or "rejected"
+	Status string `gorm:"index"`
+	// reviewer the appeal is assigned to, if any
+	AssignedTo     string `gorm:"index"`
+	AssignedAt     *time.Time
+	ResolvedBy     string
+	ResolutionNote string
+	ResolvedAt     *time.Time
+}
+
+// AppealAuditEntry records a step in an appeal's lifecycle
+type AppealAuditEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	AppealID  uint `gorm:"index"`
+	// "submit", "assign", "accepted" or "rejected"
+	Action   string
+	Actor    string
+	Note     string
+	RemoteIP string
+}
+
+// AppliedPolicy records a signed sovereignty policy document the relay applied
+type AppliedPolicy struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Version   int64 `gorm:"index"`
+	// the document exactly as signed, so it can be re-verified
+	Token string
+	// staged rollout parameters (JSON policy.Ramp), if the document was ramped in
+	Ramp     string
+	Actor    string
+	RemoteIP string
+}
+
+// BlobViolation records a record referencing a blob which the relay's blob policy doesn't allow
+type BlobViolation struct {
+	gorm.Model
+	Did      string `gorm:"index"`
+	Path     string
+	Cid      string
+	MimeType string
+	Size     int64
+	// blobs.ReasonMimeType or blobs.ReasonTooLarge
+	Reason string
+}
+
+// VideoPlaylist tracks a video blob handed off for transcoding, and the resulting playlist reference
+type VideoPlaylist struct {
+	gorm.Model
+	Did      string `gorm:"uniqueIndex:idx_video_did_cid"`
+	Cid      string `gorm:"uniqueIndex:idx_video_did_cid"`
+	MimeType string
+	Size     int64
+	// blobs.StatusQueued, StatusReady or StatusFailed
+	Status   string
+	Playlist string
+	Error    string
+}
+
+// IdentityRefresh is a queued synthetic #identity event, emitted once it comes due so downstream caches re-resolve the account
+type IdentityRefresh struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string    `gorm:"index"`
+	DueAt     time.Time `gorm:"index"`
+	Reason    string
+	Actor     string
+	// set once the event has been emitted (or the refresh given up on)
+	DoneAt *time.Time `gorm:"index"`
+	// why the refresh was skipped or failed, if it was
+	Error string
+}
+
+// HandleVerification is the persisted state of a tracked account's periodic handle checks
+type HandleVerification struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Did       string `gorm:"uniqueIndex"`
+	Handle    string
+	Verified  bool
+	// consecutive failed checks
+	Failures  int
+	LastError string
+	CheckedAt time.Time
+	NextCheck time.Time
+	// set while the account's checks are persistently failing
+	FailingSince *time.Time `gorm:"index"`
+}
+
+// PLCAudit is the latest verification of a did:plc account's operation history
+type PLCAudit struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Did       string `gorm:"uniqueIndex"`
+	Valid     bool
+	// history is invalid or anomalous
+	Flagged    bool `gorm:"index"`
+	Operations int
+	// JSON-encoded plcops.Audit
+	Report    []byte
+	AuditedAt time.Time `gorm:"index"`
+}
+
+// AdminCredential is a hardware token (WebAuthn credential) enrolled for admin sign-in
+type AdminCredential struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	CredentialID []byte `gorm:"uniqueIndex"`
+	// COSE_Key encoded public key
+	PublicKey  []byte
+	SignCount  uint32
+	UserHandle []byte
+	// operator-chosen label, eg "alice's yubikey"
+	Name       string
+	LastUsedAt *time.Time
+}
+
+// AdminRecoveryCode is a single-use code for admin sign-in without a hardware token
+type AdminRecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// sha256 of the normalized code
+	Hash   string `gorm:"uniqueIndex"`
+	UsedAt *time.Time
+}
+
+// AdminSession is an admin API session opened by hardware token or recovery code sign-in
+type AdminSession struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// sha256 of the bearer token
+	TokenHash string    `gorm:"uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+	// how the session was opened, eg "webauthn:alice's yubikey" or "recovery-code"
+	Method string
+	// recovery code sessions may only enroll a hardware token
+	EnrollOnly bool
+}
+
+// FeatureFlag is a runtime override of a feature flag
+type FeatureFlag struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Name      string `gorm:"uniqueIndex"`
+	Enabled   bool
+}
+
+// LegalHold exempts an account's data from retention sweeps and erasure until it is released
+type LegalHold struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"index"`
+	// range of the account's event sequence numbers held in the playback log; 0 leaves that end open. Only a hold with neither end set covers the account's repo
+	SeqStart int64
+	SeqEnd   int64
+	Reason   string
+	// case or matter the hold was placed for
+	Reference  string
+	PlacedBy   string
+	ReleasedAt *time.Time `gorm:"index"`
+	ReleasedBy string
+}
+
+// LegalHoldAuditEntry records a change to a legal hold, or an erasure request which hit one
+type LegalHoldAuditEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	HoldID    uint   `gorm:"index"`
+	Did       string `gorm:"index"`
+	// "place", "release" or "conflict"
+	Action   string
+	Actor    string
+	Note     string
+	RemoteIP string
+}
+
+// LegalHoldConflict is an erasure request which hit a legal hold
+type LegalHoldConflict struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"index"`
+	// "takedown", "deletion" or "reset"
+	Workflow string
+	// comma-separated IDs of the holds in the way
+	HoldIDs string
+	// the erasure runs once the holds are released; otherwise the request was refused
+	Deferred bool
+	// when a deferred erasure ran, or was dropped because the account had been restored
+	ResolvedAt *time.Time
+}
+
+// SubscriberProfile is an admin-defined shape of the sovereign stream (see the profile package), assignable to subscriber tokens
+type SubscriberProfile struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+	Redaction   string
+	Annotations string
+	// sovereignty.Confidence
+	HashOnlyBelow    int
+	HashOnlyExcluded *bool
+	Public           bool
+}
+
+// SubscriberToken is a bearer token a consumer presents when subscribing to the sovereign stream, which gets the stream shaped by its profile
+type SubscriberToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// operator-chosen label for the consumer, eg "university research group"
+	Name string
+	// sha256 of the bearer token
+	TokenHash string `gorm:"uniqueIndex"`
+	Profile   string `gorm:"index"`
+	IssuedBy  string
+	RevokedAt *time.Time `gorm:"index"`
+}
+
+// ListedDID is an account added to the in-country or out-of-country list through the admin API, alongside those in the list files
+type ListedDID struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"uniqueIndex"`
+	// "in_country" or "out_of_country"
+	List    string `gorm:"index"`
+	Reason  string
+	AddedBy string
+}
+
+// WatchedRepo is an account on the moderation pre-screen watchlist, whose events are held until a moderator decides on them
+type WatchedRepo struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"uniqueIndex"`
+	Reason    string
+	AddedBy   string
+}
+
+// PreScreenAuditEntry records a change to the pre-screen watchlist, or a moderator's decision on a held event
+type PreScreenAuditEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"index"`
+	// "watch", "unwatch", "approve" or "reject"
+	Action string
+	// for decisions, the event's type and commit revision
+	EventKind string
+	Rev       string
+	Actor     string
+	Note      string
+	RemoteIP  string
+}
+
+// ResidencyDeclaration is the latest residency an account declared in its repo, and what the relay did with it
+type ResidencyDeclaration struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Did       string `gorm:"uniqueIndex"`
+	Country   string
+	// unprefixed; empty if not declared
+	Subdivision string
+	// the record's createdAt
+	DeclaredAt time.Time
+	// what the verification policy made of it (eg, "applied", "contradicted"); see the residency package
+	Result string `gorm:"index"`
+	// when it last classified the account; nil if it never has
+	AppliedAt *time.Time
+}
+
+// InvalidRecord is a record of a processed commit which failed validation against its lexicon, and was labeled or had its commit rejected
+type InvalidRecord struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Did       string `gorm:"index"`
+	Rev       string
+	Seq       int64
+	Path      string
+	Cid       string
+	// why it failed (eg, "invalid", "unknown_lexicon"); see the lexcheck package
+	ErrorType string `gorm:"index"`
+	Error     string
+	// "labeled" if the commit was emitted, "rejected" if it was left out
+	Action string
+}
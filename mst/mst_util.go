@@ -65,6 +65,15 @@ func layerForEntries(entries []nodeEntry) int {
 	return leadingZerosOnHash(firstLeaf.Key)
 }
 
+// Layer returns the layer of a serialized node, from the hash of its first key. Nodes without entries have no keys to go by, so false is returned; their layer is one above that of their left subtree, if they have one.
+func (nd *NodeData) Layer() (int, bool) {
+	if len(nd.Entries) == 0 {
+		return 0, false
+	}
+	// the first entry's key is never prefix-compressed
+	return leadingZerosOnHashBytes(nd.Entries[0].KeySuffix), true
+}
+
 // Typescript: deserializeNodeData(storage, data, layer)
 func deserializeNodeData(ctx context.Context, cst cbor.IpldStore, nd *NodeData, layer int) ([]nodeEntry, error) {
 	entries := []nodeEntry{}
@@ -54,6 +54,11 @@ type Repo struct {
 	clk *syntax.TIDClock
 }
 
+// SetClock replaces the TID clock used for record keys and commit revisions, eg to share one clock across repos, or to use a simulated time source in tests.
+func (r *Repo) SetClock(clk *syntax.TIDClock) {
+	r.clk = clk
+}
+
 // Returns a copy of commit without the Sig field. Helpful when verifying signature.
 func (sc *SignedCommit) Unsigned() *UnsignedCommit {
 	return &UnsignedCommit{
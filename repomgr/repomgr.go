@@ -20,6 +20,8 @@ import (
 	"github.com/bluesky-social/indigo/mst"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/util/carstream"
+	"github.com/bluesky-social/indigo/util/clock"
 
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
@@ -57,6 +59,13 @@ type KeyManager interface {
 	SignForUser(context.Context, string, []byte) ([]byte, error)
 }
 
+// SetClock sets the time source for the record keys and commit revisions of repos written through the manager, eg a simulated clock in tests
+func (rm *RepoManager) SetClock(c clock.Clock) {
+	clk := syntax.NewTIDClock(0)
+	clk.Now = c.Now
+	rm.clk = &clk
+}
+
 func (rm *RepoManager) SetEventHandler(cb func(context.Context, *RepoEvent), hydrateRecords bool) {
 	rm.events = cb
 	rm.hydrateRecords = hydrateRecords
@@ -182,6 +191,7 @@ func (rm *RepoManager) CreateRecord(ctx context.Context, user models.Uid, collec
 	if err != nil {
 		return "", cid.Undef, err
 	}
+	r.SetClock(rm.clk)
 
 	cc, tid, err := r.CreateRecord(ctx, collection, rec)
 	if err != nil {
@@ -246,6 +256,7 @@ func (rm *RepoManager) UpdateRecord(ctx context.Context, user models.Uid, collec
 	if err != nil {
 		return cid.Undef, err
 	}
+	r.SetClock(rm.clk)
 
 	rpath := collection + "/" + rkey
 	cc, err := r.PutRecord(ctx, rpath, rec)
@@ -316,6 +327,7 @@ func (rm *RepoManager) DeleteRecord(ctx context.Context, user models.Uid, collec
 	if err != nil {
 		return err
 	}
+	r.SetClock(rm.clk)
 
 	rpath := collection + "/" + rkey
 	if err := r.DeleteRecord(ctx, rpath); err != nil {
@@ -375,6 +387,7 @@ func (rm *RepoManager) InitNewActor(ctx context.Context, user models.Uid, handle
 	}
 
 	r := repo.NewRepo(ctx, did, ds)
+	r.SetClock(rm.clk)
 
 	profile := &bsky.ActorProfile{
 		DisplayName: &displayname,
@@ -436,6 +449,73 @@ func (rm *RepoManager) ReadRepo(ctx context.Context, user models.Uid, since stri
 	return rm.cs.ReadUserCar(ctx, user, since, true, w)
 }
 
+// ExportRepo writes the user's current repo to w as a CAR file, walking it from the head commit and fetching records concurrently, so memory use stays bounded however large the repo is. Unlike ReadRepo, only blocks reachable from the head commit are included. Returns the number of bytes written
+func (rm *RepoManager) ExportRepo(ctx context.Context, user models.Uid, w io.Writer, opts *carstream.Options) (int64, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "ExportRepo")
+	defer span.End()
+
+	head, err := rm.cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	if !head.Defined() {
+		return 0, fmt.Errorf("no data found for user %d", user)
+	}
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := carstream.WriteRepo(ctx, w, bs, head, opts)
+	span.SetAttributes(attribute.Int64("bytes", n))
+	return n, err
+}
+
+// ExportRepoSince writes the changes to the user's repo since the given rev to w as a CAR file: the blocks a consumer holding the repo at that rev needs to bring it up to date, worked out by diffing the two commits' trees. If the carstore doesn't keep the commit at that rev, it falls back to ReadRepo, which sends the blocks stored since then. Returns the number of bytes written.
+func (rm *RepoManager) ExportRepoSince(ctx context.Context, user models.Uid, since string, w io.Writer, opts *carstream.Options) (int64, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "ExportRepoSince")
+	defer span.End()
+
+	var old cid.Cid
+	if fcs, ok := rm.cs.(*carstore.FileCarStore); ok {
+		c, err := fcs.CommitForRev(ctx, user, since)
+		if err != nil {
+			return 0, err
+		}
+		old = c
+	}
+	if !old.Defined() {
+		span.SetAttributes(attribute.Bool("fallback", true))
+		cw := &countingWriter{w: w}
+		err := rm.ReadRepo(ctx, user, since, cw)
+		return cw.n, err
+	}
+
+	head, err := rm.cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := carstream.WriteDiff(ctx, w, bs, old, head, opts)
+	span.SetAttributes(attribute.Int64("bytes", n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
 func (rm *RepoManager) GetRecord(ctx context.Context, user models.Uid, collection string, rkey string, maybeCid cid.Cid) (cid.Cid, cbg.CBORMarshaler, error) {
 	bs, err := rm.cs.ReadOnlySession(user)
 	if err != nil {
@@ -799,6 +879,7 @@ func (rm *RepoManager) BatchWrite(ctx context.Context, user models.Uid, writes [
 	if err != nil {
 		return err
 	}
+	r.SetClock(rm.clk)
 
 	ops := make([]RepoOp, 0, len(writes))
 	for _, w := range writes {
@@ -0,0 +1,340 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CountryLabel is the country classification of an account, as stored on its profile document and denormalized on to each of its posts.
+type CountryLabel struct {
+	// ISO 3166-1 alpha-2 country code, upper case
+	Country string
+	// how much to trust the classification, from 0 to 1, derived from the classification source
+	Confidence float64
+	// true if the classification was made (or confirmed) by an operator
+	Verified bool
+}
+
+// confidence assigned to classifications by source; sources not listed get the default
+var countrySourceConfidence = map[string]float64{
+	"admin":  1.0,
+	"import": 0.9,
+}
+
+const defaultCountryConfidence = 0.6
+
+// ClassificationLabel derives the indexed label for a classification.
+func ClassificationLabel(c sovereignty.Classification) CountryLabel {
+	conf, ok := countrySourceConfidence[c.Source]
+	if !ok {
+		conf = defaultCountryConfidence
+	}
+	return CountryLabel{
+		Country:    c.Country,
+		Confidence: conf,
+		Verified:   c.Source == "admin",
+	}
+}
+
+func (d *ProfileDoc) SetCountry(l CountryLabel) {
+	d.Country = l.Country
+	d.CountryConfidence = l.Confidence
+	d.CountryVerified = l.Verified
+}
+
+func (d *PostDoc) SetCountry(l CountryLabel) {
+	d.Country = l.Country
+	d.CountryConfidence = l.Confidence
+	d.CountryVerified = l.Verified
+}
+
+// countryLabel looks up the current label for an account, if the indexer has a classification table and the account is classified.
+func (idx *Indexer) countryLabel(did string) (CountryLabel, bool) {
+	if idx.countries == nil {
+		return CountryLabel{}, false
+	}
+	c, ok := idx.countries.Get(did)
+	if !ok {
+		return CountryLabel{}, false
+	}
+	return ClassificationLabel(c), true
+}
+
+// CountryFilter restricts search results to accounts (or posts by accounts) classified to a country.
+type CountryFilter struct {
+	Country string `json:"country"`
+	// if positive, skip classifications with a lower confidence
+	MinConfidence float64 `json:"minConfidence,omitempty"`
+	VerifiedOnly  bool    `json:"verifiedOnly,omitempty"`
+}
+
+// Filters turns the country filter in to elasticsearch/opensearch filter DSL
+func (f *CountryFilter) Filters() []map[string]interface{} {
+	filters := []map[string]interface{}{
+		{"term": map[string]interface{}{"country": map[string]interface{}{
+			"value":            f.Country,
+			"case_insensitive": true,
+		}}},
+	}
+	if f.MinConfidence > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{
+				"country_confidence": map[string]interface{}{
+					"gte": f.MinConfidence,
+				},
+			},
+		})
+	}
+	if f.VerifiedOnly {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"country_verified": true},
+		})
+	}
+	return filters
+}
+
+// parseCountryFilter reads the optional 'country', 'countryMinConfidence' and 'countryVerified' query params.
+func parseCountryFilter(e echo.Context) (*CountryFilter, error) {
+	raw := strings.TrimSpace(e.QueryParam("country"))
+	if raw == "" {
+		return nil, nil
+	}
+	country, err := sovereignty.NormalizeCountry(raw)
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid value for 'country': %s", err),
+		}
+	}
+	f := CountryFilter{Country: country}
+	if s := strings.TrimSpace(e.QueryParam("countryMinConfidence")); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 1 {
+			return nil, &echo.HTTPError{
+				Code:    400,
+				Message: "invalid value for 'countryMinConfidence' (must be between 0 and 1)",
+			}
+		}
+		f.MinConfidence = v
+	}
+	if s := strings.TrimSpace(e.QueryParam("countryVerified")); s == "true" || s == "1" || s == "y" {
+		f.VerifiedOnly = true
+	}
+	return &f, nil
+}
+
+// ParseCountryFeeds parses feed configuration of the form "CC=at://did/app.bsky.feed.generator/rkey" in to a map from feed AT-URI to country code.
+func ParseCountryFeeds(specs []string) (map[string]string, error) {
+	feeds := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		code, uri, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid country feed %q (expected CC=at-uri)", spec)
+		}
+		country, err := sovereignty.NormalizeCountry(code)
+		if err != nil {
+			return nil, err
+		}
+		aturi, err := syntax.ParseATURI(strings.TrimSpace(uri))
+		if err != nil {
+			return nil, fmt.Errorf("invalid country feed %q: %w", spec, err)
+		}
+		feeds[aturi.String()] = country
+	}
+	return feeds, nil
+}
+
+// DoCountryFeed queries for posts by accounts classified to the given country, newest first.
+func DoCountryFeed(ctx context.Context, escli *es.Client, index string, filter *CountryFilter, offset, size int) (*EsSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoCountryFeed")
+	defer span.End()
+	span.SetAttributes(attribute.String("country", filter.Country))
+
+	if err := checkParams(offset, size); err != nil {
+		return nil, err
+	}
+	filters := append(filter.Filters(), map[string]any{
+		"range": map[string]any{
+			"created_at": map[string]any{
+				"lte": syntax.DatetimeNow(),
+			},
+		},
+	})
+	query := map[string]any{
+		"query": map[string]any{
+			"bool": map[string]any{
+				"filter": filters,
+			},
+		},
+		"sort": map[string]any{
+			"created_at": map[string]any{
+				"order": "desc",
+			},
+		},
+		"size": size,
+		"from": offset,
+	}
+	return doSearch(ctx, escli, index, query)
+}
+
+// diffClassifications returns the entries of after which are new or changed relative to before, and the DIDs which were dropped.
+func diffClassifications(before map[string]CountryLabel, after []sovereignty.Classification) (map[CountryLabel][]string, []string) {
+	changed := make(map[CountryLabel][]string)
+	seen := make(map[string]bool, len(after))
+	for _, c := range after {
+		seen[c.DID] = true
+		l := ClassificationLabel(c)
+		if prev, ok := before[c.DID]; ok && prev == l {
+			continue
+		}
+		changed[l] = append(changed[l], c.DID)
+	}
+	var removed []string
+	for did := range before {
+		if !seen[did] {
+			removed = append(removed, did)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+func countryLabels(tbl *sovereignty.Table) map[string]CountryLabel {
+	out := make(map[string]CountryLabel, tbl.Len())
+	for _, c := range tbl.Snapshot() {
+		out[c.DID] = ClassificationLabel(c)
+	}
+	return out
+}
+
+// max DIDs in a single update_by_query terms filter
+const countryPropagateBatch = 1000
+
+// FollowCountries keeps the indexer's classification table in sync with a relay's published snapshots, and re-labels already indexed profiles and posts of any account whose classification changed. Blocks until the context is cancelled.
+func (idx *Indexer) FollowCountries(ctx context.Context, loader *snapshot.Loader, interval time.Duration) {
+	log := idx.logger.With("op", "FollowCountries")
+	refresh := func() {
+		before := countryLabels(idx.countries)
+		n, err := loader.Sync(ctx, idx.countries)
+		if err != nil {
+			log.Warn("failed to sync country classifications", "err", err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+		changed, removed := diffClassifications(before, idx.countries.Snapshot())
+		if err := idx.propagateCountries(ctx, changed, removed); err != nil {
+			log.Warn("failed to propagate country classifications", "err", err)
+			return
+		}
+		log.Info("synced country classifications", "generation", loader.Generation, "entries", n, "labels_changed", len(changed), "removed", len(removed))
+	}
+
+	refresh()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			refresh()
+		}
+	}
+}
+
+// propagateCountries rewrites the country fields on existing profile and post documents of the given accounts. Accounts are grouped by label so each update is a single script over a batch of DIDs.
+func (idx *Indexer) propagateCountries(ctx context.Context, changed map[CountryLabel][]string, removed []string) error {
+	ctx, span := tracer.Start(ctx, "propagateCountries")
+	defer span.End()
+
+	for l, dids := range changed {
+		script := map[string]any{
+			"source": "ctx._source.country = params.country; ctx._source.country_confidence = params.confidence; ctx._source.country_verified = params.verified",
+			"lang":   "painless",
+			"params": map[string]any{
+				"country":    l.Country,
+				"confidence": l.Confidence,
+				"verified":   l.Verified,
+			},
+		}
+		if err := idx.updateByDIDs(ctx, dids, script); err != nil {
+			return err
+		}
+		if idx.actors != nil {
+			if err := idx.refreshActors(ctx, dids); err != nil {
+				return err
+			}
+		}
+	}
+	if len(removed) > 0 {
+		script := map[string]any{
+			"source": "ctx._source.remove('country'); ctx._source.remove('country_confidence'); ctx._source.remove('country_verified')",
+			"lang":   "painless",
+		}
+		if err := idx.updateByDIDs(ctx, removed, script); err != nil {
+			return err
+		}
+		if idx.actors != nil {
+			if err := idx.refreshActors(ctx, removed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (idx *Indexer) updateByDIDs(ctx context.Context, dids []string, script map[string]any) error {
+	for start := 0; start < len(dids); start += countryPropagateBatch {
+		end := min(start+countryPropagateBatch, len(dids))
+		body, err := json.Marshal(map[string]any{
+			"query": map[string]any{
+				"terms": map[string]any{"did": dids[start:end]},
+			},
+			"script": script,
+		})
+		if err != nil {
+			return err
+		}
+		for _, index := range []string{idx.profileIndex, idx.postIndex} {
+			if err := idx.indexLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			res, err := idx.escli.UpdateByQuery(
+				idx.queryIndices(index),
+				idx.escli.UpdateByQuery.WithContext(ctx),
+				idx.escli.UpdateByQuery.WithBody(bytes.NewReader(body)),
+				idx.escli.UpdateByQuery.WithConflicts("proceed"),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to send update_by_query request: %w", err)
+			}
+			respBody, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				return fmt.Errorf("failed to read update_by_query response: %w", err)
+			}
+			if res.IsError() {
+				idx.logger.Warn("opensearch update_by_query error", "index", index, "status_code", res.StatusCode, "body", string(respBody))
+				return fmt.Errorf("update_by_query error, code=%d", res.StatusCode)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassificationLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	l := ClassificationLabel(sovereignty.Classification{DID: "did:plc:a", Country: "CA", Source: "admin"})
+	assert.Equal(CountryLabel{Country: "CA", Confidence: 1.0, Verified: true}, l)
+
+	l = ClassificationLabel(sovereignty.Classification{DID: "did:plc:a", Country: "CA", Source: "import"})
+	assert.Equal(0.9, l.Confidence)
+	assert.False(l.Verified)
+
+	l = ClassificationLabel(sovereignty.Classification{DID: "did:plc:a", Country: "CA", Source: "pds-geo"})
+	assert.Equal(defaultCountryConfidence, l.Confidence)
+	assert.False(l.Verified)
+
+	var doc PostDoc
+	doc.SetCountry(CountryLabel{Country: "CA", Confidence: 1.0, Verified: true})
+	assert.Equal("CA", doc.Country)
+	assert.True(doc.CountryVerified)
+}
+
+func TestCountryFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	f := CountryFilter{Country: "CA"}
+	assert.Len(f.Filters(), 1)
+
+	f = CountryFilter{Country: "CA", MinConfidence: 0.9, VerifiedOnly: true}
+	assert.Len(f.Filters(), 3)
+
+	p := PostSearchParams{Query: "*"}
+	assert.Empty(p.Filters())
+	p.Update(&PostSearchParams{Country: &f})
+	assert.Len(p.Filters(), 3)
+
+	a := ActorSearchParams{Query: "*", Country: &CountryFilter{Country: "CA"}}
+	assert.Equal([]map[string]interface{}{
+		{"term": map[string]interface{}{"country": map[string]interface{}{
+			"value":            "CA",
+			"case_insensitive": true,
+		}}},
+	}, a.Filters())
+}
+
+func TestDiffClassifications(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := CountryLabel{Country: "CA", Confidence: 1.0, Verified: true}
+	before := map[string]CountryLabel{
+		"did:plc:same":    ca,
+		"did:plc:moved":   ca,
+		"did:plc:dropped": ca,
+	}
+	after := []sovereignty.Classification{
+		{DID: "did:plc:same", Country: "CA", Source: "admin"},
+		{DID: "did:plc:moved", Country: "US", Source: "admin"},
+		{DID: "did:plc:new", Country: "US", Source: "admin"},
+		{DID: "did:plc:demoted", Country: "CA", Source: "import"},
+	}
+	changed, removed := diffClassifications(before, after)
+	assert.Equal([]string{"did:plc:dropped"}, removed)
+	assert.Len(changed, 2)
+	assert.ElementsMatch([]string{"did:plc:moved", "did:plc:new"}, changed[CountryLabel{Country: "US", Confidence: 1.0, Verified: true}])
+	assert.Equal([]string{"did:plc:demoted"}, changed[CountryLabel{Country: "CA", Confidence: 0.9}])
+}
+
+func TestParseCountryFeeds(t *testing.T) {
+	assert := assert.New(t)
+
+	feeds, err := ParseCountryFeeds([]string{"ca=at://did:web:feeds.example.com/app.bsky.feed.generator/canadian-authors"})
+	assert.NoError(err)
+	assert.Equal(map[string]string{"at://did:web:feeds.example.com/app.bsky.feed.generator/canadian-authors": "CA"}, feeds)
+
+	_, err = ParseCountryFeeds([]string{"at://did:web:feeds.example.com/app.bsky.feed.generator/canadian-authors"})
+	assert.Error(err)
+	_, err = ParseCountryFeeds([]string{"CAN=at://did:web:feeds.example.com/app.bsky.feed.generator/canadian-authors"})
+	assert.Error(err)
+	_, err = ParseCountryFeeds([]string{"CA=not-a-uri"})
+	assert.Error(err)
+}
@@ -0,0 +1,679 @@
+package search
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportApproved  = "approved"
+	ExportRejected  = "rejected"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// ExportFields are the dataset fields an export may include, subject to the operator's allowlist. Every row also has pseudonymous "author" and "post" identifiers.
+var ExportFields = []string{
+	"text",
+	"created_at",
+	"lang_code",
+	"indigenous_lang",
+	"hashtag",
+	"tag",
+	"domain",
+	"ca_domain",
+	"emoji",
+	"embed_img_count",
+	"self_label",
+	"country",
+	"reply_parent",
+	"reply_root",
+	"mentions",
+}
+
+// DefaultExportFields is the allowlist used when the operator doesn't configure one. It leaves out post text and the reply and mention graph.
+var DefaultExportFields = []string{
+	"created_at",
+	"lang_code",
+	"indigenous_lang",
+	"hashtag",
+	"domain",
+	"ca_domain",
+	"embed_img_count",
+	"self_label",
+	"country",
+}
+
+// ExportRequest is a researcher's request for a de-identified dataset, and its review
+type ExportRequest struct {
+	gorm.Model
+	Researcher  string
+	Institution string
+	// accreditation reference (eg, ethics board approval number)
+	Accreditation string
+	Purpose       string
+	// comma-separated dataset fields
+	Fields string
+	// optional filters: country code, and a created_at range
+	Country string
+	Since   *time.Time
+	Until   *time.Time
+
+	Status     string `gorm:"index"`
+	ReviewedBy string
+	ReviewNote string
+	ReviewedAt *time.Time
+	Error      string
+	// JSON ExportManifest, once completed
+	Manifest string
+}
+
+// ExportAccessLog records every administrative action on an export request, including downloads
+type ExportAccessLog struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	RequestID uint `gorm:"index"`
+	Actor     string
+	Action    string
+	RemoteIP  string
+}
+
+// ExportManifest describes a completed dataset. It is written alongside the data and kept with the request.
+type ExportManifest struct {
+	RequestID     uint         `json:"requestId"`
+	Researcher    string       `json:"researcher"`
+	Institution   string       `json:"institution"`
+	Accreditation string       `json:"accreditation"`
+	Purpose       string       `json:"purpose"`
+	ApprovedBy    string       `json:"approvedBy"`
+	ApprovedAt    time.Time    `json:"approvedAt"`
+	Fields        []string     `json:"fields"`
+	Country       string       `json:"country,omitempty"`
+	Since         *time.Time   `json:"since,omitempty"`
+	Until         *time.Time   `json:"until,omitempty"`
+	Rows          int          `json:"rows"`
+	Files         []ExportFile `json:"files"`
+	// how account and post identifiers were replaced
+	Pseudonyms string    `json:"pseudonyms"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Generator  string    `json:"generator"`
+}
+
+type ExportFile struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Exporter produces de-identified post datasets from the index for approved export requests.
+type Exporter struct {
+	db        *gorm.DB
+	escli     *es.Client
+	postIndex string
+	// directory datasets are written to, one sub-directory per request
+	dir string
+	// secret for deriving per-export pseudonym keys
+	key     []byte
+	allowed []string
+	logger  *slog.Logger
+}
+
+func NewExporter(db *gorm.DB, escli *es.Client, postIndex, dir string, key []byte, allowed []string, logger *slog.Logger) (*Exporter, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("export pseudonym key must be at least 32 bytes")
+	}
+	if len(allowed) == 0 {
+		allowed = DefaultExportFields
+	}
+	for _, f := range allowed {
+		if !slices.Contains(ExportFields, f) {
+			return nil, fmt.Errorf("unknown export field: %s", f)
+		}
+	}
+	if err := db.AutoMigrate(&ExportRequest{}, &ExportAccessLog{}); err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		db:        db,
+		escli:     escli,
+		postIndex: postIndex,
+		dir:       dir,
+		key:       key,
+		allowed:   allowed,
+		logger:    logger,
+	}, nil
+}
+
+// pseudonymizer replaces identifiers with keyed hashes. Each export gets its own key, so pseudonyms can't be joined across datasets.
+type pseudonymizer struct {
+	key []byte
+}
+
+func (ex *Exporter) pseudonymizer(requestID uint) *pseudonymizer {
+	mac := hmac.New(sha256.New, ex.key)
+	fmt.Fprintf(mac, "export:%d", requestID)
+	return &pseudonymizer{key: mac.Sum(nil)}
+}
+
+func (p *pseudonymizer) id(val string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(val))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// post returns the pseudonym of a post AT-URI (or "did_rkey" document ID), or "" if it can't be parsed
+func (p *pseudonymizer) post(uri string) string {
+	aturi, err := syntax.ParseATURI(uri)
+	if err != nil {
+		return ""
+	}
+	return p.id(aturi.Authority().String() + "/" + aturi.RecordKey().String())
+}
+
+var handleMentionRegex = regexp.MustCompile(`@[a-zA-Z0-9][a-zA-Z0-9.-]*\.[a-zA-Z][a-zA-Z0-9-]*`)
+
+// stripHandles replaces @-mentions of handles in post text
+func stripHandles(text string) string {
+	return handleMentionRegex.ReplaceAllString(text, "@[account]")
+}
+
+// exportRow returns the de-identified dataset row for a post, with only the given fields
+func exportRow(doc *PostDoc, fields []string, p *pseudonymizer) map[string]any {
+	row := map[string]any{
+		"author": p.id(doc.DID),
+		"post":   p.id(doc.DID + "/" + doc.RecordRkey),
+	}
+	for _, f := range fields {
+		switch f {
+		case "text":
+			row[f] = stripHandles(doc.Text)
+		case "created_at":
+			if doc.CreatedAt != nil {
+				row[f] = *doc.CreatedAt
+			}
+		case "lang_code":
+			row[f] = doc.LangCode
+		case "indigenous_lang":
+			row[f] = doc.IndigenousLang
+		case "hashtag":
+			row[f] = doc.Hashtag
+		case "tag":
+			row[f] = doc.Tag
+		case "domain":
+			row[f] = doc.Domain
+		case "ca_domain":
+			row[f] = doc.CADomain
+		case "emoji":
+			row[f] = doc.Emoji
+		case "embed_img_count":
+			row[f] = doc.EmbedImgCount
+		case "self_label":
+			row[f] = doc.SelfLabel
+		case "country":
+			row[f] = doc.Country
+		case "reply_parent":
+			if doc.ReplyParentATURI != nil {
+				row[f] = p.post(*doc.ReplyParentATURI)
+			}
+		case "reply_root":
+			if doc.ReplyRootATURI != nil {
+				row[f] = p.post(*doc.ReplyRootATURI)
+			}
+		case "mentions":
+			var ids []string
+			for _, did := range doc.MentionDID {
+				ids = append(ids, p.id(did))
+			}
+			row[f] = ids
+		}
+	}
+	return row
+}
+
+func (ex *Exporter) logAccess(ctx context.Context, requestID uint, actor, action, remoteIP string) {
+	entry := ExportAccessLog{RequestID: requestID, Actor: actor, Action: action, RemoteIP: remoteIP}
+	if err := ex.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		ex.logger.Error("failed to record export access", "request", requestID, "action", action, "err", err)
+	}
+}
+
+// Run produces the dataset for an approved request, recording the outcome on the request.
+func (ex *Exporter) Run(ctx context.Context, requestID uint) error {
+	var req ExportRequest
+	if err := ex.db.WithContext(ctx).First(&req, requestID).Error; err != nil {
+		return err
+	}
+	if req.Status != ExportApproved {
+		return fmt.Errorf("export request %d is %s, not approved", requestID, req.Status)
+	}
+	if err := ex.db.WithContext(ctx).Model(&req).Update("status", ExportRunning).Error; err != nil {
+		return err
+	}
+
+	manifest, err := ex.write(ctx, &req)
+	if err != nil {
+		ex.logger.Error("dataset export failed", "request", requestID, "err", err)
+		exportsCounter.WithLabelValues(ExportFailed).Inc()
+		return ex.db.WithContext(ctx).Model(&req).Updates(map[string]any{"status": ExportFailed, "error": err.Error()}).Error
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	exportsCounter.WithLabelValues(ExportCompleted).Inc()
+	exportedRowsCounter.Add(float64(manifest.Rows))
+	ex.logger.Info("dataset export completed", "request", requestID, "rows", manifest.Rows)
+	return ex.db.WithContext(ctx).Model(&req).Updates(map[string]any{"status": ExportCompleted, "manifest": string(b), "error": ""}).Error
+}
+
+func (ex *Exporter) write(ctx context.Context, req *ExportRequest) (*ExportManifest, error) {
+	ctx, span := tracer.Start(ctx, "ExportDataset")
+	defer span.End()
+
+	outDir := filepath.Join(ex.dir, strconv.FormatUint(uint64(req.ID), 10))
+	if err := os.MkdirAll(outDir, 0o700); err != nil {
+		return nil, err
+	}
+	dataName := "posts.jsonl.gz"
+	f, err := os.OpenFile(filepath.Join(outDir, dataName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(f, hash))
+	enc := json.NewEncoder(zw)
+
+	fields := splitFields(req.Fields)
+	p := ex.pseudonymizer(req.ID)
+	rows := 0
+	err = scrollPosts(ctx, ex.escli, ex.postIndex, exportQuery(req), func(doc *PostDoc) error {
+		rows++
+		return enc.Encode(exportRow(doc, fields, p))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ExportManifest{
+		RequestID:     req.ID,
+		Researcher:    req.Researcher,
+		Institution:   req.Institution,
+		Accreditation: req.Accreditation,
+		Purpose:       req.Purpose,
+		ApprovedBy:    req.ReviewedBy,
+		Fields:        fields,
+		Country:       req.Country,
+		Since:         req.Since,
+		Until:         req.Until,
+		Rows:          rows,
+		Files: []ExportFile{{
+			Name:   dataName,
+			Bytes:  info.Size(),
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		}},
+		Pseudonyms: "HMAC-SHA256 with a key unique to this export; handles in text replaced",
+		CreatedAt:  time.Now().UTC(),
+		Generator:  "palomar/" + versioninfo.Short(),
+	}
+	if req.ReviewedAt != nil {
+		manifest.ApprovedAt = req.ReviewedAt.UTC()
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "manifest.json"), b, 0o600); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func splitFields(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// exportQuery selects the posts covered by a request
+func exportQuery(req *ExportRequest) map[string]any {
+	filters := []map[string]any{}
+	if req.Country != "" {
+		filters = append(filters, map[string]any{"term": map[string]any{"country": req.Country}})
+	}
+	if req.Since != nil || req.Until != nil {
+		rng := map[string]any{}
+		if req.Since != nil {
+			rng["gte"] = req.Since.UTC().Format(time.RFC3339)
+		}
+		if req.Until != nil {
+			rng["lt"] = req.Until.UTC().Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]any{"range": map[string]any{"created_at": rng}})
+	}
+	return map[string]any{
+		"bool": map[string]any{"filter": filters},
+	}
+}
+
+// scrollPosts calls fn for every post document matching the query
+func scrollPosts(ctx context.Context, escli *es.Client, index string, query map[string]any, fn func(doc *PostDoc) error) error {
+	b, err := json.Marshal(map[string]any{
+		"query": query,
+		"size":  5000,
+		"sort":  []string{"_doc"},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := escli.Search(
+		escli.Search.WithContext(ctx),
+		escli.Search.WithIndex(index),
+		escli.Search.WithBody(strings.NewReader(string(b))),
+		escli.Search.WithScroll(5*time.Minute),
+	)
+	for {
+		if err != nil {
+			return fmt.Errorf("scrolling post index: %w", err)
+		}
+		var page struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []struct {
+					Source PostDoc `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if res.IsError() {
+			return fmt.Errorf("scrolling post index: status %d: %s", res.StatusCode, string(body))
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("decoding scroll response: %w", err)
+		}
+		for i := range page.Hits.Hits {
+			if err := fn(&page.Hits.Hits[i].Source); err != nil {
+				return err
+			}
+		}
+		if len(page.Hits.Hits) == 0 || page.ScrollID == "" {
+			if page.ScrollID != "" {
+				if cres, err := escli.ClearScroll(escli.ClearScroll.WithScrollID(page.ScrollID)); err == nil {
+					cres.Body.Close()
+				}
+			}
+			return nil
+		}
+		res, err = escli.Scroll(
+			escli.Scroll.WithContext(ctx),
+			escli.Scroll.WithScrollID(page.ScrollID),
+			escli.Scroll.WithScroll(5*time.Minute),
+		)
+	}
+}
+
+// checkAdminAuth requires the configured admin token as a bearer token
+func (s *Server) checkAdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		token, ok := strings.CutPrefix(e.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			return &echo.HTTPError{
+				Code:    401,
+				Message: "invalid admin token",
+			}
+		}
+		return next(e)
+	}
+}
+
+type exportRequestBody struct {
+	Researcher    string   `json:"researcher"`
+	Institution   string   `json:"institution"`
+	Accreditation string   `json:"accreditation"`
+	Purpose       string   `json:"purpose"`
+	Fields        []string `json:"fields"`
+	Country       string   `json:"country"`
+	Since         string   `json:"since"`
+	Until         string   `json:"until"`
+	// operator submitting the request on the researcher's behalf
+	Actor string `json:"actor"`
+}
+
+func (s *Server) handleAdminSubmitExport(e echo.Context) error {
+	var body exportRequestBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Researcher == "" || body.Institution == "" || body.Accreditation == "" || body.Purpose == "" || body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "researcher, institution, accreditation, purpose and actor are required",
+		}
+	}
+	if len(body.Fields) == 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must request at least one field",
+		}
+	}
+	for _, f := range body.Fields {
+		if !slices.Contains(s.Exporter.allowed, f) {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("field is not approved for export: %s", f),
+			}
+		}
+	}
+	req := ExportRequest{
+		Researcher:    body.Researcher,
+		Institution:   body.Institution,
+		Accreditation: body.Accreditation,
+		Purpose:       body.Purpose,
+		Fields:        strings.Join(body.Fields, ","),
+		Status:        ExportPending,
+	}
+	if body.Country != "" {
+		c, err := sovereignty.NormalizeCountry(body.Country)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: err.Error(),
+			}
+		}
+		req.Country = c
+	}
+	for _, tc := range []struct {
+		name string
+		val  string
+		dst  **time.Time
+	}{{"since", body.Since, &req.Since}, {"until", body.Until, &req.Until}} {
+		if tc.val == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, tc.val)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid value for '%s' (must be RFC 3339): %s", tc.name, err),
+			}
+		}
+		*tc.dst = &t
+	}
+
+	ctx := e.Request().Context()
+	if err := s.Exporter.db.WithContext(ctx).Create(&req).Error; err != nil {
+		return err
+	}
+	s.Exporter.logAccess(ctx, req.ID, body.Actor, "submit", e.RealIP())
+	return e.JSON(200, req)
+}
+
+func (s *Server) handleAdminListExports(e echo.Context) error {
+	q := s.Exporter.db.WithContext(e.Request().Context()).Order("id desc").Limit(100)
+	if status := e.QueryParam("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var out []ExportRequest
+	if err := q.Find(&out).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, out)
+}
+
+func (s *Server) exportParam(e echo.Context) (*ExportRequest, error) {
+	id, err := strconv.ParseUint(e.QueryParam("id"), 10, 64)
+	if err != nil {
+		return nil, &echo.HTTPError{
+			Code:    400,
+			Message: "must specify numeric export request id",
+		}
+	}
+	var req ExportRequest
+	res := s.Exporter.db.WithContext(e.Request().Context()).Limit(1).Find(&req, id)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, &echo.HTTPError{
+			Code:    404,
+			Message: "no such export request",
+		}
+	}
+	return &req, nil
+}
+
+type exportReviewBody struct {
+	Actor   string `json:"actor"`
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
+
+// handleAdminReviewExport records the approval (which starts the export) or rejection of a pending request
+func (s *Server) handleAdminReviewExport(e echo.Context) error {
+	req, err := s.exportParam(e)
+	if err != nil {
+		return err
+	}
+	var body exportReviewBody
+	if err := e.Bind(&body); err != nil {
+		return err
+	}
+	if body.Actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify the reviewing 'actor'",
+		}
+	}
+	if req.Status != ExportPending {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: fmt.Sprintf("export request is %s", req.Status),
+		}
+	}
+	status, action := ExportRejected, "reject"
+	if body.Approve {
+		status, action = ExportApproved, "approve"
+	}
+	now := time.Now().UTC()
+	ctx := e.Request().Context()
+	res := s.Exporter.db.WithContext(ctx).Model(req).Where("status = ?", ExportPending).
+		Updates(map[string]any{"status": status, "reviewed_by": body.Actor, "review_note": body.Note, "reviewed_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: "export request was reviewed concurrently",
+		}
+	}
+	s.Exporter.logAccess(ctx, req.ID, body.Actor, action, e.RealIP())
+
+	if body.Approve {
+		go func() {
+			if err := s.Exporter.Run(context.Background(), req.ID); err != nil {
+				s.logger.Error("failed to run dataset export", "request", req.ID, "err", err)
+			}
+		}()
+	}
+	return e.JSON(200, map[string]any{"id": req.ID, "status": status})
+}
+
+// handleAdminDownloadExport serves the dataset of a completed request, logging the access
+func (s *Server) handleAdminDownloadExport(e echo.Context) error {
+	req, err := s.exportParam(e)
+	if err != nil {
+		return err
+	}
+	actor := e.QueryParam("actor")
+	if actor == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must specify the downloading 'actor'",
+		}
+	}
+	if req.Status != ExportCompleted {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: fmt.Sprintf("export request is %s", req.Status),
+		}
+	}
+	file := "posts.jsonl.gz"
+	if e.QueryParam("file") == "manifest" {
+		file = "manifest.json"
+	}
+	s.Exporter.logAccess(e.Request().Context(), req.ID, actor, "download:"+file, e.RealIP())
+	return e.Attachment(filepath.Join(s.Exporter.dir, strconv.FormatUint(uint64(req.ID), 10), file), fmt.Sprintf("export-%d-%s", req.ID, file))
+}
+
+func (s *Server) handleAdminExportLog(e echo.Context) error {
+	req, err := s.exportParam(e)
+	if err != nil {
+		return err
+	}
+	var entries []ExportAccessLog
+	if err := s.Exporter.db.WithContext(e.Request().Context()).Where("request_id = ?", req.ID).Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+	return e.JSON(200, entries)
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExportRow(t *testing.T) {
+	assert := assert.New(t)
+
+	ex := &Exporter{key: []byte(strings.Repeat("k", 32))}
+	created := "2024-03-01T12:00:00Z"
+	parent := "at://did:plc:bob/app.bsky.feed.post/3kparent"
+	doc := PostDoc{
+		DID:              "did:plc:alice",
+		RecordRkey:       "3kpost",
+		Text:             "hi @bob.example.ca and @carol.bsky.social, email me@example.com",
+		CreatedAt:        &created,
+		Hashtag:          []string{"canada"},
+		MentionDID:       []string{"did:plc:bob"},
+		ReplyParentATURI: &parent,
+		Country:          "CA",
+	}
+
+	p := ex.pseudonymizer(1)
+	row := exportRow(&doc, []string{"text", "created_at", "hashtag", "reply_parent", "mentions"}, p)
+	assert.Equal("hi @[account] and @[account], email me@[account]", row["text"])
+	assert.Equal(created, row["created_at"])
+	assert.Equal([]string{"canada"}, row["hashtag"])
+	assert.NotContains(row, "country")
+	assert.Len(row["author"], 32)
+	assert.NotContains(row["author"], "alice")
+	// the parent post and mentioned account join up with their own rows
+	assert.Equal(p.id("did:plc:bob/3kparent"), row["reply_parent"])
+	assert.Equal([]string{p.id("did:plc:bob")}, row["mentions"])
+
+	// stable within an export, unlinkable across exports
+	assert.Equal(row["author"], exportRow(&doc, nil, p)["author"])
+	assert.NotEqual(row["author"], exportRow(&doc, nil, ex.pseudonymizer(2))["author"])
+}
+
+func TestExportQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	q := exportQuery(&ExportRequest{Country: "CA"})
+	filters := q["bool"].(map[string]any)["filter"].([]map[string]any)
+	assert.Len(filters, 1)
+	assert.Equal(map[string]any{"term": map[string]any{"country": "CA"}}, filters[0])
+	assert.Equal([]string{"a", "b"}, splitFields(" a, ,b"))
+}
+
+func TestExportAdminAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "export.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewExporter(db, nil, "posts", t.TempDir(), []byte("short"), nil, slog.Default())
+	assert.Error(err)
+	_, err = NewExporter(db, nil, "posts", t.TempDir(), []byte(strings.Repeat("k", 32)), []string{"did"}, slog.Default())
+	assert.Error(err)
+	ex, err := NewExporter(db, nil, "posts", t.TempDir(), []byte(strings.Repeat("k", 32)), nil, slog.Default())
+	assert.NoError(err)
+	s := &Server{Exporter: ex, adminToken: "tok", logger: slog.Default()}
+
+	call := func(method, target, body string, h echo.HandlerFunc) (int, string) {
+		e := echo.New()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer tok")
+		rec := httptest.NewRecorder()
+		err := s.checkAdminAuth(h)(e.NewContext(req, rec))
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code, ""
+		}
+		assert.NoError(err)
+		return rec.Code, rec.Body.String()
+	}
+
+	base := `"researcher":"R. Tremblay","institution":"Université Laval","accreditation":"REB-2024-17","purpose":"language use","actor":"ops@example.ca"`
+	code, _ := call("POST", "/admin/exports", `{`+base+`,"fields":["text"]}`, s.handleAdminSubmitExport)
+	assert.Equal(400, code)
+	code, _ = call("POST", "/admin/exports", `{`+base+`,"fields":["hashtag"],"since":"yesterday"}`, s.handleAdminSubmitExport)
+	assert.Equal(400, code)
+	code, _ = call("POST", "/admin/exports", `{`+base+`,"fields":["hashtag","country"],"country":"ca"}`, s.handleAdminSubmitExport)
+	assert.Equal(200, code)
+
+	var req ExportRequest
+	assert.NoError(db.First(&req).Error)
+	assert.Equal(ExportPending, req.Status)
+	assert.Equal("CA", req.Country)
+
+	code, _ = call("POST", "/admin/exports/review?id=1", `{"actor":"privacy@example.ca","note":"scope too broad"}`, s.handleAdminReviewExport)
+	assert.Equal(200, code)
+	code, _ = call("POST", "/admin/exports/review?id=1", `{"actor":"privacy@example.ca","approve":true}`, s.handleAdminReviewExport)
+	assert.Equal(http.StatusConflict, code)
+	code, _ = call("GET", "/admin/exports/download?id=1&actor=x", ``, s.handleAdminDownloadExport)
+	assert.Equal(http.StatusConflict, code)
+
+	code, body := call("GET", "/admin/exports/log?id=1", ``, s.handleAdminExportLog)
+	assert.Equal(200, code)
+	assert.Contains(body, `"Action":"submit"`)
+	assert.Contains(body, `"Action":"reject"`)
+
+	// wrong token
+	e := echo.New()
+	hreq := httptest.NewRequest("GET", "/admin/exports", nil)
+	hreq.Header.Set("Authorization", "Bearer nope")
+	err = s.checkAdminAuth(s.handleAdminListExports)(e.NewContext(hreq, httptest.NewRecorder()))
+	assert.Equal(401, err.(*echo.HTTPError).Code)
+}
@@ -0,0 +1,151 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// handleFeedSkeleton serves app.bsky.feed.getFeedSkeleton for the configured feeds, each newest first: the Indigenous languages feed (posts declaring an Indigenous language), the verified organizations feed (posts by verified organizations), and any country feeds (posts by accounts classified to the country, eg a "Canadian authors" feed)
+func (s *Server) handleFeedSkeleton(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleFeedSkeleton")
+	defer span.End()
+
+	feedURI := e.QueryParam("feed")
+	country, isCountryFeed := s.countryFeeds[feedURI]
+	if feedURI == "" || (feedURI != s.indigenousFeedURI && feedURI != s.orgsFeedURI && !isCountryFeed) {
+		return e.JSON(400, map[string]any{
+			"error":   "UnknownFeed",
+			"message": "unknown feed",
+		})
+	}
+
+	offset, limit, err := parseCursorLimit(e)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("feed", feedURI), attribute.Int("offset", offset), attribute.Int("limit", limit))
+
+	var resp *EsSearchResponse
+	if isCountryFeed {
+		var filter *CountryFilter
+		filter, err = parseCountryFilter(e)
+		if err != nil {
+			return err
+		}
+		if filter == nil {
+			filter = &CountryFilter{Country: country}
+		} else if filter.Country != country {
+			// consumers may tighten a country feed, but not point it at another country
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("feed only serves country %s", country),
+			}
+		}
+		resp, err = DoCountryFeed(ctx, s.escli, s.postIndex, filter, offset, limit)
+	} else if feedURI == s.indigenousFeedURI {
+		resp, err = DoIndigenousFeed(ctx, s.escli, s.postIndex, offset, limit)
+	} else {
+		dids := s.orgs.DIDs()
+		if len(dids) == 0 {
+			return e.JSON(200, appbsky.FeedGetFeedSkeleton_Output{Feed: []*appbsky.FeedDefs_SkeletonFeedPost{}})
+		}
+		resp, err = DoAuthorsFeed(ctx, s.escli, s.postIndex, dids, offset, limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	feed := []*appbsky.FeedDefs_SkeletonFeedPost{}
+	for _, r := range resp.Hits.Hits {
+		var doc PostDoc
+		if err := json.Unmarshal(r.Source, &doc); err != nil {
+			return fmt.Errorf("decoding post doc from search response: %w", err)
+		}
+		did, err := syntax.ParseDID(doc.DID)
+		if err != nil {
+			return fmt.Errorf("invalid DID in indexed document: %w", err)
+		}
+		feed = append(feed, &appbsky.FeedDefs_SkeletonFeedPost{
+			Post: fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, doc.RecordRkey),
+		})
+	}
+
+	out := appbsky.FeedGetFeedSkeleton_Output{Feed: feed}
+	if len(feed) == limit && (offset+limit) < 10000 {
+		c := fmt.Sprintf("%d", offset+limit)
+		out.Cursor = &c
+	}
+	return e.JSON(200, out)
+}
+
+// DoIndigenousFeed queries for posts declaring an Indigenous language, newest first.
+func DoIndigenousFeed(ctx context.Context, escli *es.Client, index string, offset, size int) (*EsSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoIndigenousFeed")
+	defer span.End()
+
+	if err := checkParams(offset, size); err != nil {
+		return nil, err
+	}
+	query := map[string]any{
+		"query": map[string]any{
+			"bool": map[string]any{
+				"filter": []map[string]any{
+					{"exists": map[string]any{"field": "indigenous_lang"}},
+					{"range": map[string]any{
+						"created_at": map[string]any{
+							"lte": syntax.DatetimeNow(),
+						},
+					}},
+				},
+			},
+		},
+		"sort": map[string]any{
+			"created_at": map[string]any{
+				"order": "desc",
+			},
+		},
+		"size": size,
+		"from": offset,
+	}
+	return doSearch(ctx, escli, index, query)
+}
+
+// DoAuthorsFeed queries for posts by any of the given accounts, newest first.
+func DoAuthorsFeed(ctx context.Context, escli *es.Client, index string, dids []string, offset, size int) (*EsSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoAuthorsFeed")
+	defer span.End()
+
+	if err := checkParams(offset, size); err != nil {
+		return nil, err
+	}
+	query := map[string]any{
+		"query": map[string]any{
+			"bool": map[string]any{
+				"filter": []map[string]any{
+					{"terms": map[string]any{"did": dids}},
+					{"range": map[string]any{
+						"created_at": map[string]any{
+							"lte": syntax.DatetimeNow(),
+						},
+					}},
+				},
+			},
+		},
+		"sort": map[string]any{
+			"created_at": map[string]any{
+				"order": "desc",
+			},
+		},
+		"size": size,
+		"from": offset,
+	}
+	return doSearch(ctx, escli, index, query)
+}
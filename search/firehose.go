@@ -17,6 +17,7 @@ import (
 	"github.com/bluesky-social/indigo/events/schedulers/autoscaling"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
 	typegen "github.com/whyrusleeping/cbor-gen"
 
 	"github.com/carlmjohnson/versioninfo"
@@ -191,10 +192,16 @@ func (idx *Indexer) discoverRepos() {
 
 func (idx *Indexer) handleCreateOrUpdate(ctx context.Context, rawDID string, rev string, path string, recB *[]byte, rcid *cid.Cid) error {
 	logger := idx.logger.With("func", "handleCreateOrUpdate", "did", rawDID, "rev", rev, "path", path)
+	if idx.isBirthdateRecord(path) {
+		return idx.observeBirthdate(ctx, rawDID, *recB)
+	}
 	// Since this gets called in a backfill job, we need to check if the path is a post or profile
 	if !strings.Contains(path, "app.bsky.feed.post") && !strings.Contains(path, "app.bsky.actor.profile") {
 		return nil
 	}
+	if idx.minors != nil && idx.minors.SuppressSearch(rawDID) {
+		return nil
+	}
 
 	did, err := syntax.ParseDID(rawDID)
 	if err != nil {
@@ -264,6 +271,12 @@ func (idx *Indexer) handleCreateOrUpdate(ctx context.Context, rawDID string, rev
 }
 
 func (idx *Indexer) handleDelete(ctx context.Context, rawDID, rev, path string) error {
+	if idx.isBirthdateRecord(path) {
+		if idx.minors.Set(rawDID, minors.ReasonBirthdate, false) {
+			return idx.minors.SaveFlag(ctx, idx.db, rawDID, minors.ReasonBirthdate)
+		}
+		return nil
+	}
 	// Since this gets called in a backfill job, we need to check if the path is a post or profile
 	if !strings.Contains(path, "app.bsky.feed.post") && !strings.Contains(path, "app.bsky.actor.profile") {
 		return nil
@@ -290,6 +303,9 @@ func (idx *Indexer) handleDelete(ctx context.Context, rawDID, rev, path string)
 
 func (idx *Indexer) processTooBigCommit(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Commit) error {
 	logger := idx.logger.With("func", "processTooBigCommit", "repo", evt.Repo, "rev", evt.Rev, "seq", evt.Seq)
+	if idx.minors != nil && idx.minors.SuppressSearch(evt.Repo) {
+		return nil
+	}
 
 	repodata, err := comatproto.SyncGetRepo(ctx, idx.relayXRPC, evt.Repo, "")
 	if err != nil {
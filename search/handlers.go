@@ -192,6 +192,12 @@ func (s *Server) handleSearchPostsSkeleton(e echo.Context) error {
 		params.Tags = tags
 	}
 
+	country, err := parseCountryFilter(e)
+	if err != nil {
+		return err
+	}
+	params.Country = country
+
 	offset, limit, err := parseCursorLimit(e)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
@@ -248,6 +254,12 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 		Size:      limit,
 	}
 
+	country, err := parseCountryFilter(e)
+	if err != nil {
+		return err
+	}
+	params.Country = country
+
 	viewerStr := e.QueryParam("viewer")
 	if viewerStr != "" {
 		d, err := syntax.ParseDID(viewerStr)
@@ -16,6 +16,9 @@ import (
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/backfill"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/ipfs/go-cid"
 	"github.com/labstack/echo/v4"
@@ -31,18 +34,31 @@ type Indexer struct {
 	escli        *es.Client
 	postIndex    string
 	profileIndex string
-	db           *gorm.DB
-	relayhost    string
-	relayXRPC    *xrpc.Client
-	dir          identity.Directory
-	echo         *echo.Echo
-	logger       *slog.Logger
+	// indices documents are written to; the write aliases when IndexAliases is set
+	postWriteIndex    string
+	profileWriteIndex string
+	db                *gorm.DB
+	relayhost         string
+	relayXRPC         *xrpc.Client
+	dir               identity.Directory
+	echo              *echo.Echo
+	logger            *slog.Logger
 
 	bfs *backfill.Gormstore
 	bf  *backfill.Backfiller
 
 	enableRepoDiscovery bool
 
+	minors *minors.Module
+
+	countries *sovereignty.Table
+
+	actors *ActorTrie
+
+	lifecycle     *Lifecycle
+	postRotation  Rotation
+	postRetention int
+
 	indexLimiter  *rate.Limiter
 	profileQueue  chan *ProfileIndexJob
 	postQueue     chan *PostIndexJob
@@ -58,6 +74,17 @@ type IndexerConfig struct {
 	IndexMaxConcurrency int
 	DiscoverRepos       bool
 	IndexingRateLimit   int
+	// if set, accounts flagged as minors (by declared birthdate record) are kept out of the index when the policy requires it
+	MinorPolicy *minors.Policy
+	// if set, profile and post documents are labeled with the author's country classification
+	Countries *sovereignty.Table
+	// if set, kept up to date with indexed profiles (of classified accounts only, if Countries is set) for typeahead search
+	ActorTrie *ActorTrie
+	// if set, the index names are read aliases over backing indices managed by a Lifecycle, and documents are written through the write aliases
+	IndexAliases bool
+	// with IndexAliases, how often the post index is rotated, and how many backing post indices to keep (zero keeps all)
+	PostRotation  Rotation
+	PostRetention int
 }
 
 type ProfileIndexJob struct {
@@ -90,6 +117,7 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 	logger.Info("running database migrations")
 	db.AutoMigrate(&LastSeq{})
 	db.AutoMigrate(&backfill.GormDBJob{})
+	db.AutoMigrate(&models.MinorFlag{})
 
 	relayWS := config.RelayHost
 	if !strings.HasPrefix(relayWS, "ws") {
@@ -107,12 +135,16 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 		escli:               escli,
 		profileIndex:        config.ProfileIndex,
 		postIndex:           config.PostIndex,
+		profileWriteIndex:   config.ProfileIndex,
+		postWriteIndex:      config.PostIndex,
 		db:                  db,
 		relayhost:           config.RelayHost,
 		relayXRPC:           relayXRPC,
 		dir:                 dir,
 		logger:              logger,
 		enableRepoDiscovery: config.DiscoverRepos,
+		countries:           config.Countries,
+		actors:              config.ActorTrie,
 
 		indexLimiter:  limiter,
 		profileQueue:  make(chan *ProfileIndexJob, 1000),
@@ -120,6 +152,21 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 		pagerankQueue: make(chan *PagerankIndexJob, 1000),
 	}
 
+	if config.IndexAliases {
+		idx.lifecycle = NewLifecycle(escli, logger)
+		idx.postWriteIndex = WriteAlias(config.PostIndex)
+		idx.profileWriteIndex = WriteAlias(config.ProfileIndex)
+		idx.postRotation = config.PostRotation
+		idx.postRetention = config.PostRetention
+	}
+
+	if config.MinorPolicy != nil {
+		idx.minors = minors.NewModule(config.MinorPolicy)
+		if err := idx.minors.LoadFlags(context.Background(), db); err != nil {
+			return nil, err
+		}
+	}
+
 	bfstore := backfill.NewGormstore(db)
 	opts := backfill.DefaultBackfillOptions()
 
@@ -137,6 +184,10 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 		opts.ParallelRecordCreates = 20
 	}
 	opts.NSIDFilter = "app.bsky."
+	if idx.minors != nil && idx.minors.Policy.BirthdateCollection != "" && !strings.HasPrefix(idx.minors.Policy.BirthdateCollection, opts.NSIDFilter) {
+		// birthdate records need to be seen during backfill too
+		opts.NSIDFilter = ""
+	}
 	bf := backfill.NewBackfiller(
 		"search",
 		bfstore,
@@ -160,13 +211,27 @@ var palomarPostSchemaJSON string
 //go:embed profile_schema.json
 var palomarProfileSchemaJSON string
 
+// PostSchemaJSON returns the settings and mappings new post indices are created with.
+func PostSchemaJSON() string {
+	return palomarPostSchemaJSON
+}
+
+// ProfileSchemaJSON returns the settings and mappings new profile indices are created with.
+func ProfileSchemaJSON() string {
+	return palomarProfileSchemaJSON
+}
+
 func (idx *Indexer) EnsureIndices(ctx context.Context) error {
+	if idx.lifecycle != nil {
+		return idx.ensureAliasedIndices(ctx)
+	}
 	indices := []struct {
-		Name       string
-		SchemaJSON string
+		Name             string
+		SchemaJSON       string
+		AddedMappingJSON string
 	}{
-		{Name: idx.postIndex, SchemaJSON: palomarPostSchemaJSON},
-		{Name: idx.profileIndex, SchemaJSON: palomarProfileSchemaJSON},
+		{Name: idx.postIndex, SchemaJSON: palomarPostSchemaJSON, AddedMappingJSON: postAddedMappingJSON},
+		{Name: idx.profileIndex, SchemaJSON: palomarProfileSchemaJSON, AddedMappingJSON: profileAddedMappingJSON},
 	}
 	for _, index := range indices {
 		resp, err := idx.escli.Indices.Exists([]string{index.Name})
@@ -195,11 +260,85 @@ func (idx *Indexer) EnsureIndices(ctx context.Context) error {
 			if resp.IsError() {
 				return fmt.Errorf("failed to create index")
 			}
+		} else if err := idx.ensureMapping(index.Name, index.AddedMappingJSON); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func (idx *Indexer) ensureAliasedIndices(ctx context.Context) error {
+	for _, index := range []struct {
+		Alias            string
+		SchemaJSON       string
+		AddedMappingJSON string
+	}{
+		{Alias: idx.postIndex, SchemaJSON: palomarPostSchemaJSON, AddedMappingJSON: postAddedMappingJSON},
+		{Alias: idx.profileIndex, SchemaJSON: palomarProfileSchemaJSON, AddedMappingJSON: profileAddedMappingJSON},
+	} {
+		if err := idx.lifecycle.Bootstrap(ctx, index.Alias, index.SchemaJSON); err != nil {
+			return err
+		}
+		// applies to every backing index, including ones being rebuilt
+		for _, name := range []string{index.Alias, WriteAlias(index.Alias)} {
+			if err := idx.ensureMapping(name, index.AddedMappingJSON); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunLifecycle rotates and prunes the aliased post index until the context is cancelled. It does nothing unless IndexAliases and a PostRotation are configured.
+func (idx *Indexer) RunLifecycle(ctx context.Context) {
+	if idx.lifecycle == nil || idx.postRotation == RotationNone {
+		return
+	}
+	idx.lifecycle.Run(ctx, idx.postIndex, palomarPostSchemaJSON, idx.postRotation, idx.postRetention, 10*time.Minute)
+}
+
+// queryIndices returns the indices a by-query update or delete has to target to reach every document of an index. With aliases this includes the write alias, which can contain a backing index that is being rebuilt and isn't in the read alias yet.
+func (idx *Indexer) queryIndices(index string) []string {
+	if idx.lifecycle == nil {
+		return []string{index}
+	}
+	return []string{index, WriteAlias(index)}
+}
+
+// fields added to the schemas after the initial release; mappings are additive, so these are safe to re-apply on every start
+const profileAddedMappingJSON = `{"properties": {
+	"country": { "type": "keyword", "normalizer": "default" },
+	"country_confidence": { "type": "float" },
+	"country_verified": { "type": "boolean" }
+}}`
+
+const postAddedMappingJSON = `{"properties": {
+	"country": { "type": "keyword", "normalizer": "default" },
+	"country_confidence": { "type": "float" },
+	"country_verified": { "type": "boolean" },
+	"reply_parent_aturi": { "type": "keyword", "normalizer": "default" },
+	"hashtag": { "type": "keyword", "normalizer": "caseSensitive" },
+	"ca_domain": { "type": "keyword", "normalizer": "default" },
+	"record": { "type": "object", "enabled": false }
+}}`
+
+// ensureMapping adds fields to an index created before they were part of the schema.
+func (idx *Indexer) ensureMapping(index, mappingJSON string) error {
+	resp, err := idx.escli.Indices.PutMapping(
+		strings.NewReader(mappingJSON),
+		idx.escli.Indices.PutMapping.WithIndex(index))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.IsError() {
+		idx.logger.Error("failed to update index mapping", "index", index, "response", string(body))
+		return fmt.Errorf("failed to update index mapping")
+	}
+	return nil
+}
+
 func (idx *Indexer) runPostIndexer(ctx context.Context) {
 	ctx, span := tracer.Start(ctx, "runPostIndexer")
 	defer span.End()
@@ -352,11 +491,28 @@ func (idx *Indexer) deletePost(ctx context.Context, did syntax.DID, recordPath s
 
 	docID := fmt.Sprintf("%s_%s", did.String(), rkey)
 	logger.Info("deleting post from index", "docID", docID)
-	req := esapi.DeleteRequest{
+	var req esapi.Request = esapi.DeleteRequest{
 		Index:      idx.postIndex,
 		DocumentID: docID,
 		Refresh:    "true",
 	}
+	if idx.lifecycle != nil {
+		// the post could be in any backing index, and deletes by ID only reach the write index
+		query, err := json.Marshal(map[string]any{
+			"query": map[string]any{
+				"ids": map[string]any{"values": []string{docID}},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		refresh := true
+		req = esapi.DeleteByQueryRequest{
+			Index:   idx.queryIndices(idx.postIndex),
+			Body:    bytes.NewReader(query),
+			Refresh: &refresh,
+		}
+	}
 
 	err = idx.indexLimiter.Wait(ctx)
 	if err != nil {
@@ -391,6 +547,15 @@ func (idx *Indexer) indexPosts(ctx context.Context, jobs []*PostIndexJob) error
 	for i := range jobs {
 		job := jobs[i]
 		doc := TransformPost(job.record, job.did, job.rkey, job.rcid.String())
+		if l, ok := idx.countryLabel(doc.DID); ok {
+			doc.SetCountry(l)
+		}
+		rec, err := json.Marshal(job.record)
+		if err != nil {
+			log.Warn("failed to marshal post record", "err", err)
+			return err
+		}
+		doc.Record = rec
 		docBytes, err := json.Marshal(doc)
 		if err != nil {
 			log.Warn("failed to marshal post", "err", err)
@@ -407,7 +572,7 @@ func (idx *Indexer) indexPosts(ctx context.Context, jobs []*PostIndexJob) error
 
 	log.Info("indexing posts", "num_posts", len(jobs))
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.postIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.postWriteIndex))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -442,6 +607,16 @@ func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob)
 		job := jobs[i]
 
 		doc := TransformProfile(job.record, job.ident, job.rcid.String())
+		if l, ok := idx.countryLabel(doc.DID); ok {
+			doc.SetCountry(l)
+		}
+		if idx.actors != nil && idx.sovereignActor(doc.DID) {
+			var displayName string
+			if doc.DisplayName != nil {
+				displayName = *doc.DisplayName
+			}
+			idx.actors.Put(doc.DID, doc.Handle, displayName)
+		}
 		docBytes, err := json.Marshal(doc)
 		if err != nil {
 			log.Warn("failed to marshal profile", "err", err)
@@ -458,7 +633,7 @@ func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob)
 
 	log.Info("indexing profiles", "num_profiles", len(jobs))
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileWriteIndex))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -515,7 +690,7 @@ func (idx *Indexer) indexPageranks(ctx context.Context, pageranks []*PagerankInd
 		buf.Write(updateScriptJSON)
 	}
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileWriteIndex))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -560,6 +735,9 @@ func (idx *Indexer) updateUserHandle(ctx context.Context, did syntax.DID, handle
 	}
 
 	log.Info("updating user handle", "handle_from_dir", ident.Handle)
+	if idx.actors != nil {
+		idx.actors.SetHandle(did.String(), ident.Handle.String())
+	}
 	span.SetAttributes(attribute.String("dir.handle", ident.Handle.String()))
 
 	b, err := json.Marshal(map[string]any{
@@ -577,7 +755,7 @@ func (idx *Indexer) updateUserHandle(ctx context.Context, did syntax.DID, handle
 	}
 
 	req := esapi.UpdateRequest{
-		Index:      idx.profileIndex,
+		Index:      idx.profileWriteIndex,
 		DocumentID: did.String(),
 		Body:       bytes.NewReader(b),
 	}
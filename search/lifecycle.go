@@ -0,0 +1,510 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// Rotation is how often a new backing index is started for an aliased index.
+type Rotation string
+
+const (
+	RotationNone   Rotation = ""
+	RotationDaily  Rotation = "daily"
+	RotationWeekly Rotation = "weekly"
+)
+
+func ParseRotation(raw string) (Rotation, error) {
+	switch Rotation(raw) {
+	case RotationNone, "none":
+		return RotationNone, nil
+	case RotationDaily, RotationWeekly:
+		return Rotation(raw), nil
+	default:
+		return "", fmt.Errorf("invalid index rotation %q (expected none, daily or weekly)", raw)
+	}
+}
+
+// periodStart returns the start of the rotation period containing t, in UTC
+func (r Rotation) periodStart(t time.Time) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	switch r {
+	case RotationDaily:
+		return day
+	case RotationWeekly:
+		// weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Time{}
+	}
+}
+
+// due reports whether a backing index created at the given time should be replaced by a new one
+func (r Rotation) due(created, now time.Time) bool {
+	if r == RotationNone {
+		return false
+	}
+	return r.periodStart(created).Before(r.periodStart(now))
+}
+
+// WriteAlias returns the name of the alias which documents are written through, for an aliased index. The configured index name is the read alias.
+func WriteAlias(alias string) string {
+	return alias + "_write"
+}
+
+const backingTimeLayout = "20060102t150405"
+
+// backingIndexName names a backing index of an alias; gen is incremented each time the index is rebuilt by Reindex
+func backingIndexName(alias string, created time.Time, gen int) string {
+	return fmt.Sprintf("%s-%s-%d", alias, created.UTC().Format(backingTimeLayout), gen)
+}
+
+var backingIndexSuffix = regexp.MustCompile(`^-(\d{8}t\d{6})-(\d+)$`)
+
+func parseBackingIndex(alias, name string) (created time.Time, gen int, ok bool) {
+	if !strings.HasPrefix(name, alias) {
+		return time.Time{}, 0, false
+	}
+	m := backingIndexSuffix.FindStringSubmatch(name[len(alias):])
+	if m == nil {
+		return time.Time{}, 0, false
+	}
+	created, err := time.Parse(backingTimeLayout, m[1])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	gen, err = strconv.Atoi(m[2])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return created, gen, true
+}
+
+// sortBackingIndices orders backing index names oldest first; names which aren't backing indices of the alias are dropped
+func sortBackingIndices(alias string, names []string) []string {
+	type backing struct {
+		name    string
+		created time.Time
+	}
+	var parsed []backing
+	for _, n := range names {
+		if created, _, ok := parseBackingIndex(alias, n); ok {
+			parsed = append(parsed, backing{name: n, created: created})
+		}
+	}
+	slices.SortFunc(parsed, func(a, b backing) int {
+		if c := a.created.Compare(b.created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	out := make([]string, len(parsed))
+	for i, b := range parsed {
+		out[i] = b.name
+	}
+	return out
+}
+
+// expiredIndices returns the backing indices beyond the newest keep, oldest first. The write index is never expired.
+func expiredIndices(alias string, names []string, writeIndex string, keep int) []string {
+	if keep <= 0 {
+		return nil
+	}
+	sorted := sortBackingIndices(alias, names)
+	if len(sorted) <= keep {
+		return nil
+	}
+	var out []string
+	for _, n := range sorted[:len(sorted)-keep] {
+		if n != writeIndex {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// AliasStatus describes the backing indices of an aliased index.
+type AliasStatus struct {
+	Alias string `json:"alias"`
+	// backing indices in the read alias, oldest first
+	Indices    []string `json:"indices"`
+	WriteIndex string   `json:"write_index"`
+}
+
+// Lifecycle manages aliased indices: the configured index name is a read alias over one or more backing indices, and documents are written through a separate write alias (see WriteAlias). This allows backing indices to be rotated, rebuilt with a new schema, and expired without downtime.
+type Lifecycle struct {
+	escli  *es.Client
+	logger *slog.Logger
+	// how often Reindex reports progress
+	pollInterval time.Duration
+}
+
+func NewLifecycle(escli *es.Client, logger *slog.Logger) *Lifecycle {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Lifecycle{
+		escli:        escli,
+		logger:       logger.With("component", "lifecycle"),
+		pollInterval: 10 * time.Second,
+	}
+}
+
+type requestError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("opensearch request failed (status %d): %s", e.StatusCode, e.Body)
+}
+
+// do sends a request and decodes a successful JSON response in to out (if not nil)
+func (lc *Lifecycle) do(ctx context.Context, req esapi.Request, out any) error {
+	res, err := req.Do(ctx, lc.escli)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &requestError{StatusCode: res.StatusCode, Body: string(body)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func jsonBody(v any) io.Reader {
+	b, _ := json.Marshal(v)
+	return bytes.NewReader(b)
+}
+
+func (lc *Lifecycle) indexExists(ctx context.Context, name string) (bool, error) {
+	res, err := lc.escli.Indices.Exists([]string{name}, lc.escli.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	io.ReadAll(res.Body)
+	switch res.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check index existence (status %d)", res.StatusCode)
+	}
+}
+
+// Status returns the backing indices of an aliased index, or nil if the alias doesn't exist.
+func (lc *Lifecycle) Status(ctx context.Context, alias string) (*AliasStatus, error) {
+	var resp map[string]struct {
+		Aliases map[string]struct {
+			IsWriteIndex *bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	err := lc.do(ctx, esapi.IndicesGetAliasRequest{Name: []string{alias, WriteAlias(alias)}}, &resp)
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := AliasStatus{Alias: alias}
+	var readIndices []string
+	var writeIndices []string
+	for index, info := range resp {
+		if _, ok := info.Aliases[alias]; ok {
+			readIndices = append(readIndices, index)
+		}
+		if w, ok := info.Aliases[WriteAlias(alias)]; ok {
+			writeIndices = append(writeIndices, index)
+			if w.IsWriteIndex == nil || *w.IsWriteIndex {
+				st.WriteIndex = index
+			}
+		}
+	}
+	if len(readIndices) == 0 {
+		return nil, nil
+	}
+	st.Indices = sortBackingIndices(alias, readIndices)
+	if st.WriteIndex == "" && len(writeIndices) == 1 {
+		st.WriteIndex = writeIndices[0]
+	}
+	return &st, nil
+}
+
+// Bootstrap creates the first backing index and aliases of an aliased index, if the alias doesn't exist yet. It fails if there is a concrete index with the alias name, which needs to be converted with Migrate first.
+func (lc *Lifecycle) Bootstrap(ctx context.Context, alias, schemaJSON string) error {
+	st, err := lc.Status(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if st != nil {
+		return nil
+	}
+	exists, err := lc.indexExists(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%s is a concrete index, not an alias (convert it with 'palomar index migrate')", alias)
+	}
+	name := backingIndexName(alias, time.Now(), 1)
+	lc.logger.Warn("creating aliased opensearch index", "alias", alias, "index", name)
+	if err := lc.do(ctx, esapi.IndicesCreateRequest{Index: name, Body: strings.NewReader(schemaJSON)}, nil); err != nil {
+		return fmt.Errorf("creating index %s: %w", name, err)
+	}
+	return lc.updateAliases(ctx, []map[string]any{
+		aliasAction("add", name, alias, nil),
+		aliasAction("add", name, WriteAlias(alias), &trueVal),
+	})
+}
+
+var trueVal, falseVal = true, false
+
+func aliasAction(action, index, alias string, isWriteIndex *bool) map[string]any {
+	params := map[string]any{"index": index, "alias": alias}
+	if isWriteIndex != nil {
+		params["is_write_index"] = *isWriteIndex
+	}
+	return map[string]any{action: params}
+}
+
+// updateAliases applies alias actions atomically
+func (lc *Lifecycle) updateAliases(ctx context.Context, actions []map[string]any) error {
+	return lc.do(ctx, esapi.IndicesUpdateAliasesRequest{Body: jsonBody(map[string]any{"actions": actions})}, nil)
+}
+
+// Rotate starts a new backing index, and moves the write alias to it, if the current write index is from an earlier rotation period. It returns the name of the new index, or an empty string if no rotation was due.
+func (lc *Lifecycle) Rotate(ctx context.Context, alias, schemaJSON string, rotation Rotation, now time.Time) (string, error) {
+	st, err := lc.Status(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	if st == nil || st.WriteIndex == "" {
+		return "", fmt.Errorf("alias %s has no write index", alias)
+	}
+	created, _, ok := parseBackingIndex(alias, st.WriteIndex)
+	if !ok || !rotation.due(created, now) {
+		return "", nil
+	}
+	return lc.rollover(ctx, alias, schemaJSON, st.WriteIndex, now)
+}
+
+// Rollover starts a new backing index and moves the write alias to it, regardless of the rotation schedule.
+func (lc *Lifecycle) Rollover(ctx context.Context, alias, schemaJSON string) (string, error) {
+	st, err := lc.Status(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	if st == nil || st.WriteIndex == "" {
+		return "", fmt.Errorf("alias %s has no write index", alias)
+	}
+	return lc.rollover(ctx, alias, schemaJSON, st.WriteIndex, time.Now())
+}
+
+func (lc *Lifecycle) rollover(ctx context.Context, alias, schemaJSON, writeIndex string, now time.Time) (string, error) {
+	name := backingIndexName(alias, now, 1)
+	lc.logger.Info("rotating aliased index", "alias", alias, "index", name, "previous", writeIndex)
+	if err := lc.do(ctx, esapi.IndicesCreateRequest{Index: name, Body: strings.NewReader(schemaJSON)}, nil); err != nil {
+		return "", fmt.Errorf("creating index %s: %w", name, err)
+	}
+	err := lc.updateAliases(ctx, []map[string]any{
+		aliasAction("add", name, alias, nil),
+		aliasAction("add", name, WriteAlias(alias), &trueVal),
+		aliasAction("remove", writeIndex, WriteAlias(alias), nil),
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Prune deletes the backing indices of an alias beyond the newest keep, returning their names. A keep of zero keeps everything.
+func (lc *Lifecycle) Prune(ctx context.Context, alias string, keep int) ([]string, error) {
+	st, err := lc.Status(ctx, alias)
+	if err != nil || st == nil {
+		return nil, err
+	}
+	expired := expiredIndices(alias, st.Indices, st.WriteIndex, keep)
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	lc.logger.Info("deleting expired backing indices", "alias", alias, "indices", expired)
+	if err := lc.do(ctx, esapi.IndicesDeleteRequest{Index: expired}, nil); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// Reindex rebuilds each backing index of an alias with the given schema (eg, after an analyzer change), one at a time, swapping the alias over to each rebuilt index when it is complete. Searches keep working throughout.
+//
+// While an index is rebuilt, the replacement is added to the write alias (as the write index, if it replaces the write index), so new documents and deletes by query through the write alias reach it. Copied documents never overwrite ones written since the copy started.
+func (lc *Lifecycle) Reindex(ctx context.Context, alias, schemaJSON string, deleteOld bool) error {
+	st, err := lc.Status(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return fmt.Errorf("alias %s does not exist", alias)
+	}
+	for _, old := range st.Indices {
+		created, gen, _ := parseBackingIndex(alias, old)
+		name := backingIndexName(alias, created, gen+1)
+		isWrite := old == st.WriteIndex
+		lc.logger.Info("rebuilding backing index", "alias", alias, "index", old, "replacement", name)
+
+		if err := lc.do(ctx, esapi.IndicesCreateRequest{Index: name, Body: strings.NewReader(schemaJSON)}, nil); err != nil {
+			return fmt.Errorf("creating index %s: %w", name, err)
+		}
+		actions := []map[string]any{aliasAction("add", name, WriteAlias(alias), &isWrite)}
+		if isWrite {
+			actions = append(actions, aliasAction("add", old, WriteAlias(alias), &falseVal))
+		}
+		if err := lc.updateAliases(ctx, actions); err != nil {
+			return err
+		}
+
+		if err := lc.copyIndex(ctx, old, name); err != nil {
+			return fmt.Errorf("reindexing %s: %w", old, err)
+		}
+
+		actions = []map[string]any{
+			aliasAction("add", name, alias, nil),
+			aliasAction("remove", old, alias, nil),
+			aliasAction("remove", old, WriteAlias(alias), nil),
+		}
+		if !isWrite {
+			actions = append(actions, aliasAction("remove", name, WriteAlias(alias), nil))
+		}
+		if err := lc.updateAliases(ctx, actions); err != nil {
+			return err
+		}
+		if deleteOld {
+			if err := lc.do(ctx, esapi.IndicesDeleteRequest{Index: []string{old}}, nil); err != nil {
+				return fmt.Errorf("deleting %s: %w", old, err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyIndex runs a reindex task from src to dst and waits for it to complete, logging progress
+func (lc *Lifecycle) copyIndex(ctx context.Context, src, dst string) error {
+	body := map[string]any{
+		"conflicts": "proceed",
+		"source":    map[string]any{"index": src},
+		"dest":      map[string]any{"index": dst, "op_type": "create"},
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := lc.do(ctx, esapi.ReindexRequest{Body: jsonBody(body), WaitForCompletion: &falseVal}, &started); err != nil {
+		return err
+	}
+	t := time.NewTicker(lc.pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		var task struct {
+			Completed bool `json:"completed"`
+			Task      struct {
+				Status struct {
+					Total   int64 `json:"total"`
+					Created int64 `json:"created"`
+				} `json:"status"`
+			} `json:"task"`
+			Error    json.RawMessage `json:"error"`
+			Response struct {
+				Failures []json.RawMessage `json:"failures"`
+			} `json:"response"`
+		}
+		if err := lc.do(ctx, esapi.TasksGetRequest{TaskID: started.Task}, &task); err != nil {
+			return err
+		}
+		lc.logger.Info("reindex progress", "src", src, "dst", dst, "created", task.Task.Status.Created, "total", task.Task.Status.Total)
+		if !task.Completed {
+			continue
+		}
+		if len(task.Error) > 0 {
+			return fmt.Errorf("reindex task failed: %s", string(task.Error))
+		}
+		if len(task.Response.Failures) > 0 {
+			return fmt.Errorf("reindex task had %d failures, first: %s", len(task.Response.Failures), string(task.Response.Failures[0]))
+		}
+		return nil
+	}
+}
+
+// Migrate converts a concrete index in to an aliased index with the same name: documents are copied to a new backing index, the concrete index is deleted, and the aliases are created in its place. Searches fail briefly between the delete and the alias creation, and the indexer should be stopped while migrating.
+func (lc *Lifecycle) Migrate(ctx context.Context, index, schemaJSON string) error {
+	exists, err := lc.indexExists(ctx, index)
+	if err != nil {
+		return err
+	}
+	if st, err := lc.Status(ctx, index); err != nil {
+		return err
+	} else if st != nil {
+		return fmt.Errorf("%s is already an alias", index)
+	}
+	if !exists {
+		return fmt.Errorf("index %s does not exist", index)
+	}
+	name := backingIndexName(index, time.Now(), 1)
+	if err := lc.do(ctx, esapi.IndicesCreateRequest{Index: name, Body: strings.NewReader(schemaJSON)}, nil); err != nil {
+		return fmt.Errorf("creating index %s: %w", name, err)
+	}
+	if err := lc.copyIndex(ctx, index, name); err != nil {
+		return fmt.Errorf("copying %s: %w", index, err)
+	}
+	lc.logger.Warn("replacing concrete index with alias", "index", index, "backing", name)
+	if err := lc.do(ctx, esapi.IndicesDeleteRequest{Index: []string{index}}, nil); err != nil {
+		return err
+	}
+	return lc.updateAliases(ctx, []map[string]any{
+		aliasAction("add", name, index, nil),
+		aliasAction("add", name, WriteAlias(index), &trueVal),
+	})
+}
+
+// Run rotates and prunes an aliased index at the given interval, until the context is cancelled.
+func (lc *Lifecycle) Run(ctx context.Context, alias, schemaJSON string, rotation Rotation, keep int, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := lc.Rotate(ctx, alias, schemaJSON, rotation, time.Now()); err != nil {
+			lc.logger.Error("failed to rotate index", "alias", alias, "err", err)
+		} else if _, err := lc.Prune(ctx, alias, keep); err != nil {
+			lc.logger.Error("failed to prune index", "alias", alias, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := ParseRotation("none")
+	assert.NoError(err)
+	assert.Equal(RotationNone, r)
+	_, err = ParseRotation("monthly")
+	assert.Error(err)
+
+	// a Thursday and the following Sunday and Monday
+	thu := time.Date(2024, 3, 14, 23, 0, 0, 0, time.UTC)
+	sun := time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)
+	mon := time.Date(2024, 3, 18, 0, 30, 0, 0, time.UTC)
+	assert.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), RotationWeekly.periodStart(thu))
+	assert.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), RotationWeekly.periodStart(sun))
+
+	assert.False(RotationWeekly.due(thu, sun))
+	assert.True(RotationWeekly.due(thu, mon))
+	assert.True(RotationDaily.due(thu, sun))
+	assert.False(RotationDaily.due(thu, thu.Add(30*time.Minute)))
+	assert.False(RotationNone.due(thu, mon))
+}
+
+func TestBackingIndices(t *testing.T) {
+	assert := assert.New(t)
+
+	created := time.Date(2024, 3, 14, 9, 30, 0, 0, time.UTC)
+	name := backingIndexName("palomar_post", created, 2)
+	assert.Equal("palomar_post-20240314t093000-2", name)
+	c, gen, ok := parseBackingIndex("palomar_post", name)
+	assert.True(ok)
+	assert.Equal(created, c)
+	assert.Equal(2, gen)
+	_, _, ok = parseBackingIndex("palomar_post", "palomar_post_write")
+	assert.False(ok)
+	_, _, ok = parseBackingIndex("palomar_profile", name)
+	assert.False(ok)
+
+	names := []string{
+		"palomar_post-20240316t000000-1",
+		"palomar_post-20240314t000000-3",
+		"unrelated",
+		"palomar_post-20240315t000000-1",
+	}
+	assert.Equal([]string{
+		"palomar_post-20240314t000000-3",
+		"palomar_post-20240315t000000-1",
+		"palomar_post-20240316t000000-1",
+	}, sortBackingIndices("palomar_post", names))
+
+	assert.Equal([]string{"palomar_post-20240314t000000-3"}, expiredIndices("palomar_post", names, "palomar_post-20240316t000000-1", 2))
+	assert.Empty(expiredIndices("palomar_post", names, "palomar_post-20240316t000000-1", 0))
+	assert.Empty(expiredIndices("palomar_post", names, "palomar_post-20240316t000000-1", 3))
+	// the write index is kept even if it is old
+	assert.Equal([]string{"palomar_post-20240315t000000-1"}, expiredIndices("palomar_post", names, "palomar_post-20240314t000000-3", 1))
+}
@@ -52,6 +52,16 @@ var profilesDeleted = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Number of profiles deleted",
 })
 
+var exportsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_dataset_exports",
+	Help: "Number of researcher dataset exports, by outcome",
+}, []string{"status"})
+
+var exportedRowsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_dataset_export_rows",
+	Help: "Number of post rows written to researcher datasets",
+})
+
 var currentSeq = promauto.NewGauge(prometheus.GaugeOpts{
 	Name: "search_current_seq",
 	Help: "Current sequence number",
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/sovereignty/minors"
+
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+func (idx *Indexer) isBirthdateRecord(path string) bool {
+	if idx.minors == nil || idx.minors.Policy.BirthdateCollection == "" {
+		return false
+	}
+	return strings.HasPrefix(path, idx.minors.Policy.BirthdateCollection+"/")
+}
+
+// observeBirthdate updates the account's birthdate flag, removing any already-indexed documents if the account is now suppressed
+func (idx *Indexer) observeBirthdate(ctx context.Context, did string, recB []byte) error {
+	rec, err := data.UnmarshalCBOR(recB)
+	if err != nil {
+		return fmt.Errorf("decoding birthdate record: %w", err)
+	}
+	changed, err := idx.minors.ObserveBirthdate(did, rec)
+	if err != nil {
+		idx.logger.Warn("ignoring invalid birthdate record", "did", did, "err", err)
+		return nil
+	}
+	if !changed {
+		return nil
+	}
+	if err := idx.minors.SaveFlag(ctx, idx.db, did, minors.ReasonBirthdate); err != nil {
+		return err
+	}
+	if idx.minors.SuppressSearch(did) {
+		return idx.deleteAccountDocs(ctx, did)
+	}
+	return nil
+}
+
+// deleteAccountDocs removes all posts and profiles for the account from the index
+func (idx *Indexer) deleteAccountDocs(ctx context.Context, did string) error {
+	ctx, span := tracer.Start(ctx, "deleteAccountDocs")
+	defer span.End()
+
+	query, err := json.Marshal(map[string]any{
+		"query": map[string]any{
+			"term": map[string]any{"did": did},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index:   append(idx.queryIndices(idx.postIndex), idx.queryIndices(idx.profileIndex)...),
+		Body:    bytes.NewReader(query),
+		Refresh: &refresh,
+	}
+
+	if err := idx.indexLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	res, err := req.Do(ctx, idx.escli)
+	if err != nil {
+		return fmt.Errorf("failed to delete account documents: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read delete response: %w", err)
+	}
+	if res.IsError() {
+		idx.logger.Warn("opensearch delete error", "status_code", res.StatusCode, "body", string(body))
+		return fmt.Errorf("delete error, code=%d", res.StatusCode)
+	}
+	if idx.actors != nil {
+		idx.actors.Remove(did)
+	}
+	idx.logger.Info("removed suppressed account from index", "did", did)
+	return nil
+}
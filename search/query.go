@@ -11,6 +11,7 @@ import (
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/indigenous"
 
 	es "github.com/opensearch-project/opensearch-go/v2"
 	"go.opentelemetry.io/otel/attribute"
@@ -62,17 +63,19 @@ type PostSearchParams struct {
 	URL      string           `json:"url"`
 	Tags     []string         `json:"tag"`
 	Viewer   *syntax.DID      `json:"viewer"`
+	Country  *CountryFilter   `json:"country"`
 	Offset   int              `json:"offset"`
 	Size     int              `json:"size"`
 }
 
 type ActorSearchParams struct {
-	Query     string       `json:"q"`
-	Typeahead bool         `json:"typeahead"`
-	Follows   []syntax.DID `json:"follows"`
-	Viewer    *syntax.DID  `json:"viewer"`
-	Offset    int          `json:"offset"`
-	Size      int          `json:"size"`
+	Query     string         `json:"q"`
+	Typeahead bool           `json:"typeahead"`
+	Follows   []syntax.DID   `json:"follows"`
+	Viewer    *syntax.DID    `json:"viewer"`
+	Country   *CountryFilter `json:"country"`
+	Offset    int            `json:"offset"`
+	Size      int            `json:"size"`
 }
 
 // Merges params from another param object in to this one. Intended to meld parsed query with HTTP query params, so not all functionality is supported, and priority is with the "current" object
@@ -102,6 +105,9 @@ func (p *PostSearchParams) Update(other *PostSearchParams) {
 	if len(p.Tags) == 0 {
 		p.Tags = other.Tags
 	}
+	if p.Country == nil {
+		p.Country = other.Country
+	}
 }
 
 // Filters turns search params in to actual elasticsearch/opensearch filter DSL
@@ -127,13 +133,23 @@ func (p *PostSearchParams) Filters() []map[string]interface{} {
 	}
 
 	if p.Lang != nil {
-		// TODO: extracting just the 2-char code would be good
-		filters = append(filters, map[string]interface{}{
-			"term": map[string]interface{}{"lang_code_iso2": map[string]interface{}{
-				"value":            p.Lang.String(),
-				"case_insensitive": true,
-			}},
-		})
+		if code, ok := indigenous.Code(p.Lang.String()); ok {
+			// lang_code_iso2 doesn't cover three-letter codes
+			filters = append(filters, map[string]interface{}{
+				"term": map[string]interface{}{"indigenous_lang": map[string]interface{}{
+					"value":            code,
+					"case_insensitive": true,
+				}},
+			})
+		} else {
+			// TODO: extracting just the 2-char code would be good
+			filters = append(filters, map[string]interface{}{
+				"term": map[string]interface{}{"lang_code_iso2": map[string]interface{}{
+					"value":            p.Lang.String(),
+					"case_insensitive": true,
+				}},
+			})
+		}
 	}
 
 	if p.Since != nil {
@@ -185,6 +201,10 @@ func (p *PostSearchParams) Filters() []map[string]interface{} {
 		})
 	}
 
+	if p.Country != nil {
+		filters = append(filters, p.Country.Filters()...)
+	}
+
 	return filters
 }
 
@@ -204,6 +224,10 @@ func (p *ActorSearchParams) Filters() []map[string]interface{} {
 		})
 	}
 
+	if p.Country != nil {
+		filters = append(filters, p.Country.Filters()...)
+	}
+
 	return filters
 }
 
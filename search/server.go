@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/sovereignty/orgs"
 
 	"github.com/carlmjohnson/versioninfo"
 	"github.com/labstack/echo/v4"
@@ -32,6 +33,20 @@ type ServerConfig struct {
 	ProfileIndex      string
 	PostIndex         string
 	AtlantisAddresses []string
+	// AT-URI of the feed generator record for the Indigenous languages feed; empty disables the feed
+	IndigenousFeedURI string
+	// AT-URI of the feed generator record for the verified organizations feed; requires Orgs
+	OrgsFeedURI string
+	// verified organization registry, kept in sync by the caller
+	Orgs *orgs.Registry
+	// feed generator AT-URI to country code; each serves posts by accounts classified to that country
+	CountryFeeds map[string]string
+	// visibility of posts by accounts outside the sovereign set in assembled threads; nil shows everything
+	ThreadPolicy *ThreadPolicy
+	// if set, typeahead searches are served from this trie rather than the index
+	ActorTrie *ActorTrie
+	// bearer token for the admin API; empty disables it
+	AdminToken string
 }
 
 type Server struct {
@@ -42,7 +57,17 @@ type Server struct {
 	echo         *echo.Echo
 	logger       *slog.Logger
 
+	indigenousFeedURI string
+	orgsFeedURI       string
+	orgs              *orgs.Registry
+	countryFeeds      map[string]string
+	threadPolicy      *ThreadPolicy
+	actorTrie         *ActorTrie
+	adminToken        string
+
 	Indexer *Indexer
+	// researcher dataset exports, managed through the admin API; nil disables
+	Exporter *Exporter
 }
 
 func NewServer(escli *es.Client, dir identity.Directory, config ServerConfig) (*Server, error) {
@@ -59,6 +84,19 @@ func NewServer(escli *es.Client, dir identity.Directory, config ServerConfig) (*
 		profileIndex: config.ProfileIndex,
 		dir:          dir,
 		logger:       logger,
+
+		indigenousFeedURI: config.IndigenousFeedURI,
+		orgs:              config.Orgs,
+		countryFeeds:      config.CountryFeeds,
+		threadPolicy:      config.ThreadPolicy,
+		actorTrie:         config.ActorTrie,
+		adminToken:        config.AdminToken,
+	}
+	if config.OrgsFeedURI != "" {
+		if config.Orgs == nil {
+			return nil, fmt.Errorf("verified organizations feed requires an organization registry")
+		}
+		serv.orgsFeedURI = config.OrgsFeedURI
 	}
 
 	return &serv, nil
@@ -152,6 +190,19 @@ func (s *Server) RunAPI(listen string) error {
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	e.GET("/xrpc/app.bsky.unspecced.searchPostsSkeleton", s.handleSearchPostsSkeleton)
 	e.GET("/xrpc/app.bsky.unspecced.searchActorsSkeleton", s.handleSearchActorsSkeleton)
+	e.GET("/xrpc/app.bsky.feed.getPostThread", s.handleGetPostThread)
+	e.GET("/xrpc/ca.gander.actor.searchTypeahead", s.handleSearchTypeahead)
+	if s.indigenousFeedURI != "" || s.orgsFeedURI != "" || len(s.countryFeeds) > 0 {
+		e.GET("/xrpc/app.bsky.feed.getFeedSkeleton", s.handleFeedSkeleton)
+	}
+	if s.adminToken != "" && s.Exporter != nil {
+		admin := e.Group("/admin", s.checkAdminAuth)
+		admin.POST("/exports", s.handleAdminSubmitExport)
+		admin.GET("/exports", s.handleAdminListExports)
+		admin.POST("/exports/review", s.handleAdminReviewExport)
+		admin.GET("/exports/download", s.handleAdminDownloadExport)
+		admin.GET("/exports/log", s.handleAdminExportLog)
+	}
 	s.echo = e
 
 	s.logger.Info("starting search API daemon", "bind", listen)
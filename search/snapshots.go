@@ -0,0 +1,112 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// S3Repository configures an OpenSearch snapshot repository in S3 (or an S3-compatible object store). The cluster needs the repository-s3 plugin, with credentials in its keystore.
+type S3Repository struct {
+	Bucket   string
+	BasePath string
+	// optional; for S3-compatible stores hosted in-country
+	Endpoint string
+	Region   string
+}
+
+// RegisterS3Repository creates or updates a named snapshot repository, and has the cluster verify it can write to it.
+func (lc *Lifecycle) RegisterS3Repository(ctx context.Context, name string, repo S3Repository) error {
+	if repo.Bucket == "" {
+		return fmt.Errorf("S3 bucket is required")
+	}
+	settings := map[string]any{"bucket": repo.Bucket}
+	if repo.BasePath != "" {
+		settings["base_path"] = repo.BasePath
+	}
+	if repo.Endpoint != "" {
+		settings["endpoint"] = repo.Endpoint
+	}
+	if repo.Region != "" {
+		settings["region"] = repo.Region
+	}
+	return lc.do(ctx, esapi.SnapshotCreateRepositoryRequest{
+		Repository: name,
+		Body:       jsonBody(map[string]any{"type": "s3", "settings": settings}),
+		Verify:     &trueVal,
+	}, nil)
+}
+
+// SnapshotName returns a default name for a snapshot taken at the given time.
+func SnapshotName(t time.Time) string {
+	return "palomar-" + t.UTC().Format(backingTimeLayout)
+}
+
+// CreateSnapshot snapshots the given indices or aliases (with their aliases) to a repository, and waits for it to complete.
+func (lc *Lifecycle) CreateSnapshot(ctx context.Context, repo, name string, indices []string) error {
+	var resp struct {
+		Snapshot struct {
+			State    string `json:"state"`
+			Failures []any  `json:"failures"`
+		} `json:"snapshot"`
+	}
+	err := lc.do(ctx, esapi.SnapshotCreateRequest{
+		Repository: repo,
+		Snapshot:   name,
+		Body: jsonBody(map[string]any{
+			"indices":              strings.Join(indices, ","),
+			"include_global_state": false,
+		}),
+		WaitForCompletion: &trueVal,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Snapshot.State != "SUCCESS" {
+		return fmt.Errorf("snapshot %s finished in state %s (%d shard failures)", name, resp.Snapshot.State, len(resp.Snapshot.Failures))
+	}
+	return nil
+}
+
+// SnapshotInfo summarizes a snapshot in a repository.
+type SnapshotInfo struct {
+	Snapshot  string   `json:"snapshot"`
+	State     string   `json:"state"`
+	Indices   []string `json:"indices"`
+	StartTime string   `json:"start_time"`
+	EndTime   string   `json:"end_time"`
+}
+
+func (lc *Lifecycle) ListSnapshots(ctx context.Context, repo string) ([]SnapshotInfo, error) {
+	var resp struct {
+		Snapshots []SnapshotInfo `json:"snapshots"`
+	}
+	if err := lc.do(ctx, esapi.SnapshotGetRequest{Repository: repo, Snapshot: []string{"_all"}}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Snapshots, nil
+}
+
+// RestoreSnapshot restores indices from a snapshot, and waits for it to complete. With a rename suffix, indices are restored alongside the live ones (as "<index><suffix>", without their aliases) so they can be inspected or swapped in by hand; without one, the live indices must have been deleted (or closed) first, and aliases are restored too.
+func (lc *Lifecycle) RestoreSnapshot(ctx context.Context, repo, name string, indices []string, renameSuffix string) error {
+	body := map[string]any{
+		"include_global_state": false,
+		"include_aliases":      renameSuffix == "",
+	}
+	if len(indices) > 0 {
+		body["indices"] = strings.Join(indices, ",")
+	}
+	if renameSuffix != "" {
+		body["rename_pattern"] = "(.+)"
+		body["rename_replacement"] = "$1" + renameSuffix
+	}
+	return lc.do(ctx, esapi.SnapshotRestoreRequest{
+		Repository:        repo,
+		Snapshot:          name,
+		Body:              jsonBody(body),
+		WaitForCompletion: &trueVal,
+	}, nil)
+}
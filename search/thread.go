@@ -0,0 +1,358 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// How posts hidden by a strict ThreadPolicy are shown in assembled threads.
+const (
+	// replaced with an app.bsky.feed.defs#notFoundPost
+	PlaceholderNotFound = "notfound"
+	// replaced with an app.bsky.feed.defs#blockedPost, which clients render as "blocked" rather than "deleted"
+	PlaceholderBlocked = "blocked"
+	// left out of the thread entirely (a hidden anchor or parent is still shown as not found, as the thread has to have a root)
+	PlaceholderOmit = "omit"
+)
+
+// max replies fetched when assembling a thread
+const threadMaxReplies = 1000
+
+// ThreadPolicy controls the visibility of posts by accounts outside the sovereign set when assembling threads. In strict mode, a hidden post's own replies are hidden along with it.
+type ThreadPolicy struct {
+	// if false, every indexed post is shown
+	Strict bool
+	// country codes whose classified accounts are shown in strict mode; if empty, any classified account is
+	Countries []string
+	// one of the Placeholder* constants; defaults to PlaceholderNotFound
+	Placeholder string
+}
+
+// ParseThreadPlaceholder validates a placeholder mode.
+func ParseThreadPlaceholder(raw string) (string, error) {
+	switch raw {
+	case "", PlaceholderNotFound:
+		return PlaceholderNotFound, nil
+	case PlaceholderBlocked, PlaceholderOmit:
+		return raw, nil
+	default:
+		return "", fmt.Errorf("invalid thread placeholder %q (expected %s, %s or %s)", raw, PlaceholderNotFound, PlaceholderBlocked, PlaceholderOmit)
+	}
+}
+
+func (p *ThreadPolicy) visible(doc *PostDoc) bool {
+	if p == nil || !p.Strict {
+		return true
+	}
+	if doc.Country == "" {
+		return false
+	}
+	return len(p.Countries) == 0 || slices.Contains(p.Countries, doc.Country)
+}
+
+func (p *ThreadPolicy) placeholder() string {
+	if p == nil || p.Placeholder == "" {
+		return PlaceholderNotFound
+	}
+	return p.Placeholder
+}
+
+// threadParent is one step up a thread from the anchor post; doc is nil if the parent is not indexed
+type threadParent struct {
+	uri string
+	doc *PostDoc
+}
+
+// threadAssembler builds getPostThread output from indexed post documents
+type threadAssembler struct {
+	policy *ThreadPolicy
+	view   func(doc *PostDoc) *appbsky.FeedDefs_PostView
+	// replies by parent AT-URI, oldest first
+	children map[string][]*PostDoc
+}
+
+func (d *PostDoc) ATURI() string {
+	return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", d.DID, d.RecordRkey)
+}
+
+// assembleThread builds the thread around anchor. parents are ordered nearest first; replies are all indexed posts in the thread (in any order), of which only descendants of the anchor are used, down to the given depth.
+func assembleThread(anchor *PostDoc, parents []threadParent, replies []*PostDoc, depth int, policy *ThreadPolicy, view func(*PostDoc) *appbsky.FeedDefs_PostView) *appbsky.FeedGetPostThread_Output_Thread {
+	ta := threadAssembler{
+		policy:   policy,
+		view:     view,
+		children: make(map[string][]*PostDoc),
+	}
+	for _, r := range replies {
+		if r.ReplyParentATURI != nil {
+			ta.children[*r.ReplyParentATURI] = append(ta.children[*r.ReplyParentATURI], r)
+		}
+	}
+	for _, c := range ta.children {
+		slices.SortStableFunc(c, func(a, b *PostDoc) int {
+			return strings.Compare(createdAt(a), createdAt(b))
+		})
+	}
+
+	if !policy.visible(anchor) {
+		// whatever the placeholder mode, a hidden anchor is simply not found
+		return &appbsky.FeedGetPostThread_Output_Thread{FeedDefs_NotFoundPost: ta.notFound(anchor.ATURI())}
+	}
+
+	tvp := ta.replyTree(anchor, depth)
+	cur := tvp
+	for _, p := range parents {
+		if p.doc == nil {
+			cur.Parent = &appbsky.FeedDefs_ThreadViewPost_Parent{FeedDefs_NotFoundPost: ta.notFound(p.uri)}
+			break
+		}
+		if !policy.visible(p.doc) {
+			if policy.placeholder() == PlaceholderBlocked {
+				cur.Parent = &appbsky.FeedDefs_ThreadViewPost_Parent{FeedDefs_BlockedPost: ta.blocked(p.doc)}
+			} else {
+				cur.Parent = &appbsky.FeedDefs_ThreadViewPost_Parent{FeedDefs_NotFoundPost: ta.notFound(p.uri)}
+			}
+			break
+		}
+		parent := &appbsky.FeedDefs_ThreadViewPost{Post: view(p.doc)}
+		cur.Parent = &appbsky.FeedDefs_ThreadViewPost_Parent{FeedDefs_ThreadViewPost: parent}
+		cur = parent
+	}
+	return &appbsky.FeedGetPostThread_Output_Thread{FeedDefs_ThreadViewPost: tvp}
+}
+
+func (ta *threadAssembler) replyTree(doc *PostDoc, depth int) *appbsky.FeedDefs_ThreadViewPost {
+	tvp := &appbsky.FeedDefs_ThreadViewPost{Post: ta.view(doc)}
+	if depth <= 0 {
+		return tvp
+	}
+	for _, child := range ta.children[doc.ATURI()] {
+		if ta.policy.visible(child) {
+			tvp.Replies = append(tvp.Replies, &appbsky.FeedDefs_ThreadViewPost_Replies_Elem{
+				FeedDefs_ThreadViewPost: ta.replyTree(child, depth-1),
+			})
+			continue
+		}
+		switch ta.policy.placeholder() {
+		case PlaceholderOmit:
+		case PlaceholderBlocked:
+			tvp.Replies = append(tvp.Replies, &appbsky.FeedDefs_ThreadViewPost_Replies_Elem{FeedDefs_BlockedPost: ta.blocked(child)})
+		default:
+			tvp.Replies = append(tvp.Replies, &appbsky.FeedDefs_ThreadViewPost_Replies_Elem{FeedDefs_NotFoundPost: ta.notFound(child.ATURI())})
+		}
+	}
+	return tvp
+}
+
+func (ta *threadAssembler) notFound(uri string) *appbsky.FeedDefs_NotFoundPost {
+	return &appbsky.FeedDefs_NotFoundPost{NotFound: true, Uri: uri}
+}
+
+func (ta *threadAssembler) blocked(doc *PostDoc) *appbsky.FeedDefs_BlockedPost {
+	return &appbsky.FeedDefs_BlockedPost{
+		Blocked: true,
+		Uri:     doc.ATURI(),
+		Author:  &appbsky.FeedDefs_BlockedAuthor{Did: doc.DID},
+	}
+}
+
+func createdAt(d *PostDoc) string {
+	if d.CreatedAt == nil {
+		return ""
+	}
+	return *d.CreatedAt
+}
+
+// handleGetPostThread serves an app.bsky.feed.getPostThread compatible thread, assembled from indexed posts and subject to the server's thread policy. Post views are minimal (no counts, embeds or viewer state), for the AppView to hydrate.
+func (s *Server) handleGetPostThread(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleGetPostThread")
+	defer span.End()
+
+	uri, err := syntax.ParseATURI(e.QueryParam("uri"))
+	if err != nil || uri.Collection() != "app.bsky.feed.post" || uri.RecordKey() == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "invalid value for 'uri' (must be a post AT-URI)",
+		}
+	}
+	depth, err := intParam(e, "depth", 6, 0, 1000)
+	if err != nil {
+		return err
+	}
+	parentHeight, err := intParam(e, "parentHeight", 80, 0, 1000)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("uri", uri.String()), attribute.Int("depth", depth), attribute.Int("parentHeight", parentHeight))
+
+	did, err := uri.Authority().AsDID()
+	if err != nil {
+		ident, err := s.dir.Lookup(ctx, uri.Authority())
+		if err != nil {
+			return notFoundPost(e)
+		}
+		did = ident.DID
+	}
+
+	anchor, err := getPostDoc(ctx, s.escli, s.postIndex, did.String()+"_"+uri.RecordKey().String())
+	if err != nil {
+		return err
+	}
+	if anchor == nil {
+		return notFoundPost(e)
+	}
+
+	var parents []threadParent
+	next := anchor.ReplyParentATURI
+	for len(parents) < parentHeight && next != nil {
+		p := threadParent{uri: *next}
+		pu, err := syntax.ParseATURI(*next)
+		if err == nil {
+			if pdid, err := pu.Authority().AsDID(); err == nil {
+				p.doc, err = getPostDoc(ctx, s.escli, s.postIndex, pdid.String()+"_"+pu.RecordKey().String())
+				if err != nil {
+					return err
+				}
+			}
+		}
+		parents = append(parents, p)
+		if p.doc == nil {
+			break
+		}
+		next = p.doc.ReplyParentATURI
+	}
+
+	var replies []*PostDoc
+	if depth > 0 {
+		root := anchor.ATURI()
+		if anchor.ReplyRootATURI != nil {
+			root = *anchor.ReplyRootATURI
+		}
+		replies, err = doThreadReplies(ctx, s.escli, s.postIndex, root)
+		if err != nil {
+			return err
+		}
+	}
+
+	thread := assembleThread(anchor, parents, replies, depth, s.threadPolicy, func(doc *PostDoc) *appbsky.FeedDefs_PostView {
+		return s.postView(ctx, doc)
+	})
+	return e.JSON(200, appbsky.FeedGetPostThread_Output{Thread: thread})
+}
+
+func notFoundPost(e echo.Context) error {
+	return e.JSON(400, map[string]any{
+		"error":   "NotFound",
+		"message": "Post not found",
+	})
+}
+
+func intParam(e echo.Context, name string, def, lo, hi int) (int, error) {
+	raw := strings.TrimSpace(e.QueryParam(name))
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < lo || v > hi {
+		return 0, &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid value for '%s' (must be between %d and %d)", name, lo, hi),
+		}
+	}
+	return v, nil
+}
+
+// postView builds a minimal post view from an indexed document
+func (s *Server) postView(ctx context.Context, doc *PostDoc) *appbsky.FeedDefs_PostView {
+	pv := &appbsky.FeedDefs_PostView{
+		Author: &appbsky.ActorDefs_ProfileViewBasic{
+			Did:    doc.DID,
+			Handle: syntax.HandleInvalid.String(),
+		},
+		Cid:       doc.RecordCID,
+		IndexedAt: doc.DocIndexTs,
+		Uri:       doc.ATURI(),
+	}
+	if ident, err := s.dir.LookupDID(ctx, syntax.DID(doc.DID)); err == nil && !ident.Handle.IsInvalidHandle() {
+		pv.Author.Handle = ident.Handle.String()
+	}
+	var post appbsky.FeedPost
+	if len(doc.Record) > 0 && json.Unmarshal(doc.Record, &post) == nil {
+		pv.Record = &lexutil.LexiconTypeDecoder{Val: &post}
+	} else {
+		// documents indexed before records were stored only have the text
+		pv.Record = &lexutil.LexiconTypeDecoder{Val: &appbsky.FeedPost{
+			Text:      doc.Text,
+			CreatedAt: createdAt(doc),
+			Langs:     doc.LangCode,
+		}}
+	}
+	return pv
+}
+
+// getPostDoc fetches a single post document by ID, returning nil if it isn't indexed. It searches rather than using a get-by-ID, which doesn't work on aliases over several backing indices.
+func getPostDoc(ctx context.Context, escli *es.Client, index, docID string) (*PostDoc, error) {
+	resp, err := doSearch(ctx, escli, index, map[string]any{
+		"query": map[string]any{
+			"ids": map[string]any{"values": []string{docID}},
+		},
+		"size": 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching post document: %w", err)
+	}
+	if len(resp.Hits.Hits) == 0 {
+		return nil, nil
+	}
+	var doc PostDoc
+	if err := json.Unmarshal(resp.Hits.Hits[0].Source, &doc); err != nil {
+		return nil, fmt.Errorf("decoding post document: %w", err)
+	}
+	return &doc, nil
+}
+
+// doThreadReplies queries for every indexed reply in the thread under root, oldest first.
+func doThreadReplies(ctx context.Context, escli *es.Client, index, root string) ([]*PostDoc, error) {
+	ctx, span := tracer.Start(ctx, "doThreadReplies")
+	defer span.End()
+
+	query := map[string]any{
+		"query": map[string]any{
+			"bool": map[string]any{
+				"filter": []map[string]any{
+					{"term": map[string]any{"reply_root_aturi": root}},
+				},
+			},
+		},
+		"sort": map[string]any{
+			"created_at": map[string]any{
+				"order": "asc",
+			},
+		},
+		"size": threadMaxReplies,
+	}
+	resp, err := doSearch(ctx, escli, index, query)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*PostDoc, 0, len(resp.Hits.Hits))
+	for _, r := range resp.Hits.Hits {
+		var doc PostDoc
+		if err := json.Unmarshal(r.Source, &doc); err != nil {
+			return nil, fmt.Errorf("decoding post doc from search response: %w", err)
+		}
+		out = append(out, &doc)
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package search
+
+import (
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testThreadPost(did, rkey, country, createdAt string, parent *PostDoc) *PostDoc {
+	doc := &PostDoc{DID: did, RecordRkey: rkey, Country: country, CreatedAt: &createdAt}
+	if parent != nil {
+		p := parent.ATURI()
+		doc.ReplyParentATURI = &p
+	}
+	return doc
+}
+
+func TestAssembleThread(t *testing.T) {
+	assert := assert.New(t)
+
+	view := func(doc *PostDoc) *appbsky.FeedDefs_PostView {
+		return &appbsky.FeedDefs_PostView{Uri: doc.ATURI()}
+	}
+
+	root := testThreadPost("did:plc:a", "1", "CA", "2024-01-01T00:00:00Z", nil)
+	anchor := testThreadPost("did:plc:b", "2", "CA", "2024-01-01T00:01:00Z", root)
+	foreign := testThreadPost("did:plc:c", "3", "", "2024-01-01T00:02:00Z", anchor)
+	local := testThreadPost("did:plc:d", "4", "CA", "2024-01-01T00:03:00Z", anchor)
+	// a reply to a hidden post is hidden along with it
+	nested := testThreadPost("did:plc:d", "5", "CA", "2024-01-01T00:04:00Z", foreign)
+	replies := []*PostDoc{nested, local, foreign, anchor}
+	parents := []threadParent{{uri: root.ATURI(), doc: root}}
+
+	// open mode shows everything, oldest reply first
+	thread := assembleThread(anchor, parents, replies, 6, nil, view)
+	tvp := thread.FeedDefs_ThreadViewPost
+	assert.NotNil(tvp)
+	assert.Equal(anchor.ATURI(), tvp.Post.Uri)
+	assert.Equal(root.ATURI(), tvp.Parent.FeedDefs_ThreadViewPost.Post.Uri)
+	assert.Len(tvp.Replies, 2)
+	assert.Equal(foreign.ATURI(), tvp.Replies[0].FeedDefs_ThreadViewPost.Post.Uri)
+	assert.Equal(nested.ATURI(), tvp.Replies[0].FeedDefs_ThreadViewPost.Replies[0].FeedDefs_ThreadViewPost.Post.Uri)
+	assert.Equal(local.ATURI(), tvp.Replies[1].FeedDefs_ThreadViewPost.Post.Uri)
+
+	// depth limits the reply tree
+	thread = assembleThread(anchor, parents, replies, 1, nil, view)
+	assert.Empty(thread.FeedDefs_ThreadViewPost.Replies[0].FeedDefs_ThreadViewPost.Replies)
+
+	strict := &ThreadPolicy{Strict: true}
+	tvp = assembleThread(anchor, parents, replies, 6, strict, view).FeedDefs_ThreadViewPost
+	assert.Len(tvp.Replies, 2)
+	assert.Equal(foreign.ATURI(), tvp.Replies[0].FeedDefs_NotFoundPost.Uri)
+	assert.Equal(local.ATURI(), tvp.Replies[1].FeedDefs_ThreadViewPost.Post.Uri)
+
+	strict.Placeholder = PlaceholderBlocked
+	tvp = assembleThread(anchor, parents, replies, 6, strict, view).FeedDefs_ThreadViewPost
+	assert.Equal("did:plc:c", tvp.Replies[0].FeedDefs_BlockedPost.Author.Did)
+
+	strict.Placeholder = PlaceholderOmit
+	tvp = assembleThread(anchor, parents, replies, 6, strict, view).FeedDefs_ThreadViewPost
+	assert.Len(tvp.Replies, 1)
+	assert.Equal(local.ATURI(), tvp.Replies[0].FeedDefs_ThreadViewPost.Post.Uri)
+
+	// restricted to other countries, the parent and anchor are hidden too
+	strict.Countries = []string{"FR"}
+	thread = assembleThread(anchor, parents, replies, 6, strict, view)
+	assert.Nil(thread.FeedDefs_ThreadViewPost)
+	assert.Equal(anchor.ATURI(), thread.FeedDefs_NotFoundPost.Uri)
+	strict.Countries = nil
+	root.Country = ""
+	tvp = assembleThread(anchor, parents, replies, 6, strict, view).FeedDefs_ThreadViewPost
+	assert.Equal(root.ATURI(), tvp.Parent.FeedDefs_NotFoundPost.Uri)
+
+	// parents which aren't indexed end the chain
+	tvp = assembleThread(anchor, []threadParent{{uri: root.ATURI()}}, nil, 6, nil, view).FeedDefs_ThreadViewPost
+	assert.True(tvp.Parent.FeedDefs_NotFoundPost.NotFound)
+}
+
+func TestParseThreadPlaceholder(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := ParseThreadPlaceholder("")
+	assert.NoError(err)
+	assert.Equal(PlaceholderNotFound, p)
+	p, err = ParseThreadPlaceholder("blocked")
+	assert.NoError(err)
+	assert.Equal(PlaceholderBlocked, p)
+	_, err = ParseThreadPlaceholder("hidden")
+	assert.Error(err)
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"encoding/json"
 	"log/slog"
 	"net/url"
 	"strings"
@@ -9,6 +10,8 @@ import (
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/enrich"
+	"github.com/bluesky-social/indigo/sovereignty/indigenous"
 
 	"github.com/rivo/uniseg"
 )
@@ -28,6 +31,10 @@ type ProfileDoc struct {
 	Emoji       []string `json:"emoji,omitempty"`
 	HasAvatar   bool     `json:"has_avatar"`
 	HasBanner   bool     `json:"has_banner"`
+
+	Country           string  `json:"country,omitempty"`
+	CountryConfidence float64 `json:"country_confidence,omitempty"`
+	CountryVerified   bool    `json:"country_verified,omitempty"`
 }
 
 type PostDoc struct {
@@ -40,9 +47,11 @@ type PostDoc struct {
 	TextJA            *string  `json:"text_ja,omitempty"`
 	LangCode          []string `json:"lang_code,omitempty"`
 	LangCodeIso2      []string `json:"lang_code_iso2,omitempty"`
+	IndigenousLang    []string `json:"indigenous_lang,omitempty"`
 	MentionDID        []string `json:"mention_did,omitempty"`
 	EmbedATURI        *string  `json:"embed_aturi,omitempty"`
 	ReplyRootATURI    *string  `json:"reply_root_aturi,omitempty"`
+	ReplyParentATURI  *string  `json:"reply_parent_aturi,omitempty"`
 	EmbedImgCount     int      `json:"embed_img_count"`
 	EmbedImgAltText   []string `json:"embed_img_alt_text,omitempty"`
 	EmbedImgAltTextJA []string `json:"embed_img_alt_text_ja,omitempty"`
@@ -51,6 +60,17 @@ type PostDoc struct {
 	Domain            []string `json:"domain,omitempty"`
 	Tag               []string `json:"tag,omitempty"`
 	Emoji             []string `json:"emoji,omitempty"`
+	// normalized hashtags, and the .ca domains of linked URLs
+	Hashtag  []string `json:"hashtag,omitempty"`
+	CADomain []string `json:"ca_domain,omitempty"`
+
+	// denormalized from the author's country classification
+	Country           string  `json:"country,omitempty"`
+	CountryConfidence float64 `json:"country_confidence,omitempty"`
+	CountryVerified   bool    `json:"country_verified,omitempty"`
+
+	// the post record itself; stored but not indexed, for thread assembly
+	Record json.RawMessage `json:"record,omitempty"`
 }
 
 // Returns the search index document ID (`_id`) for this document.
@@ -132,8 +152,12 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		}
 	}
 	var replyRootATURI *string
+	var replyParentATURI *string
 	if post.Reply != nil {
 		replyRootATURI = &(post.Reply.Root.Uri)
+		if post.Reply.Parent != nil {
+			replyParentATURI = &(post.Reply.Parent.Uri)
+		}
 	}
 	if post.Embed != nil && post.Embed.EmbedExternal != nil {
 		urls = append(urls, post.Embed.EmbedExternal.External.Uri)
@@ -193,6 +217,8 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		}
 	}
 
+	enriched := enrich.Post(post)
+
 	doc := PostDoc{
 		DocIndexTs:        syntax.DatetimeNow().String(),
 		DID:               did.String(),
@@ -201,9 +227,11 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		Text:              post.Text,
 		LangCode:          post.Langs,
 		LangCodeIso2:      langCodeIso2,
+		IndigenousLang:    indigenous.Match(post.Langs),
 		MentionDID:        mentionDIDs,
 		EmbedATURI:        embedATURI,
 		ReplyRootATURI:    replyRootATURI,
+		ReplyParentATURI:  replyParentATURI,
 		EmbedImgCount:     embedImgCount,
 		EmbedImgAltText:   embedImgAltText,
 		EmbedImgAltTextJA: embedImgAltTextJA,
@@ -212,6 +240,8 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		Domain:            domains,
 		Tag:               parsePostTags(post),
 		Emoji:             parseEmojis(post.Text),
+		Hashtag:           enriched.Hashtags,
+		CADomain:          enriched.CanadianDomains(),
 	}
 
 	if containsJapanese(post.Text) {
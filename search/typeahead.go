@@ -0,0 +1,404 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// max candidates collected from the trie before filtering and ranking
+const typeaheadMaxCandidates = 1000
+
+// TypeaheadActor is an actor returned by a typeahead search.
+type TypeaheadActor struct {
+	DID         string `json:"did"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// actors with a token ending at this node
+	dids map[string]struct{}
+}
+
+type trieActor struct {
+	TypeaheadActor
+	tokens []string
+}
+
+// ActorTrie is an in-memory prefix index over actors' handles and display names, for typeahead search. It is safe for concurrent use.
+type ActorTrie struct {
+	mu     sync.RWMutex
+	root   *trieNode
+	actors map[string]*trieActor
+}
+
+func NewActorTrie() *ActorTrie {
+	return &ActorTrie{
+		root:   &trieNode{},
+		actors: make(map[string]*trieActor),
+	}
+}
+
+// foldText lower-cases and strips diacritics, so "Éloïse" matches "elo"
+func foldText(s string) string {
+	// transformers are stateful, so one is needed per call
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+func splitTokenRune(c rune) bool {
+	return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+}
+
+// actorTokens returns the strings an actor can be found by: the full handle, each of its labels, and each word of the display name
+func actorTokens(handle, displayName string) []string {
+	var out []string
+	if handle != "" && handle != syntax.HandleInvalid.String() {
+		h := strings.ToLower(handle)
+		out = append(out, h)
+		out = append(out, strings.FieldsFunc(h, splitTokenRune)...)
+	}
+	out = append(out, strings.FieldsFunc(foldText(displayName), splitTokenRune)...)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// Put adds or replaces an actor.
+func (t *ActorTrie) Put(did, handle, displayName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(did)
+	a := &trieActor{
+		TypeaheadActor: TypeaheadActor{DID: did, Handle: handle, DisplayName: displayName},
+		tokens:         actorTokens(handle, displayName),
+	}
+	t.actors[did] = a
+	for _, tok := range a.tokens {
+		n := t.root
+		for _, r := range tok {
+			if n.children == nil {
+				n.children = make(map[rune]*trieNode)
+			}
+			child, ok := n.children[r]
+			if !ok {
+				child = &trieNode{}
+				n.children[r] = child
+			}
+			n = child
+		}
+		if n.dids == nil {
+			n.dids = make(map[string]struct{})
+		}
+		n.dids[did] = struct{}{}
+	}
+}
+
+// SetHandle updates the handle of an actor, if it is in the trie.
+func (t *ActorTrie) SetHandle(did, handle string) {
+	t.mu.RLock()
+	a, ok := t.actors[did]
+	t.mu.RUnlock()
+	if !ok || a.Handle == handle {
+		return
+	}
+	t.Put(did, handle, a.DisplayName)
+}
+
+// Remove drops an actor from the trie.
+func (t *ActorTrie) Remove(did string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(did)
+}
+
+func (t *ActorTrie) remove(did string) {
+	a, ok := t.actors[did]
+	if !ok {
+		return
+	}
+	delete(t.actors, did)
+	for _, tok := range a.tokens {
+		removeToken(t.root, []rune(tok), did)
+	}
+}
+
+// removeToken removes a DID from the node for a token, pruning nodes left empty. It reports whether n itself is now empty.
+func removeToken(n *trieNode, tok []rune, did string) bool {
+	if len(tok) == 0 {
+		delete(n.dids, did)
+	} else if child, ok := n.children[tok[0]]; ok {
+		if removeToken(child, tok[1:], did) {
+			delete(n.children, tok[0])
+		}
+	}
+	return len(n.dids) == 0 && len(n.children) == 0
+}
+
+func (t *ActorTrie) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.actors)
+}
+
+// Search returns up to limit actors matching a query. Each word of the query has to be a prefix of one of the actor's tokens. Actors whose handle starts with the query rank first, then shorter handles.
+func (t *ActorTrie) Search(query string, limit int) []TypeaheadActor {
+	words := strings.FieldsFunc(foldText(strings.TrimPrefix(strings.TrimSpace(query), "@")), unicode.IsSpace)
+	if len(words) == 0 || limit <= 0 {
+		return nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// the longest word is the most selective
+	first := slices.MaxFunc(words, func(a, b string) int { return len(a) - len(b) })
+	n := t.root
+	for _, r := range first {
+		n = n.children[r]
+		if n == nil {
+			return nil
+		}
+	}
+	candidates := make(map[string]struct{})
+	collectDIDs(n, candidates)
+
+	var matches []*trieActor
+	for did := range candidates {
+		a := t.actors[did]
+		if a != nil && matchesAll(a.tokens, words) {
+			matches = append(matches, a)
+		}
+	}
+	handlePrefix := strings.Join(words, " ")
+	slices.SortFunc(matches, func(a, b *trieActor) int {
+		ap, bp := strings.HasPrefix(a.Handle, handlePrefix), strings.HasPrefix(b.Handle, handlePrefix)
+		if ap != bp {
+			if ap {
+				return -1
+			}
+			return 1
+		}
+		if len(a.Handle) != len(b.Handle) {
+			return len(a.Handle) - len(b.Handle)
+		}
+		return strings.Compare(a.Handle, b.Handle)
+	})
+
+	out := make([]TypeaheadActor, 0, min(limit, len(matches)))
+	for _, a := range matches[:min(limit, len(matches))] {
+		out = append(out, a.TypeaheadActor)
+	}
+	return out
+}
+
+// collectDIDs gathers DIDs below a node, up to typeaheadMaxCandidates
+func collectDIDs(n *trieNode, out map[string]struct{}) {
+	for did := range n.dids {
+		if len(out) >= typeaheadMaxCandidates {
+			return
+		}
+		out[did] = struct{}{}
+	}
+	for _, child := range n.children {
+		if len(out) >= typeaheadMaxCandidates {
+			return
+		}
+		collectDIDs(child, out)
+	}
+}
+
+func matchesAll(tokens, words []string) bool {
+	for _, w := range words {
+		if !slices.ContainsFunc(tokens, func(tok string) bool { return strings.HasPrefix(tok, w) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadActorTrie fills a trie from the profile index. With classifiedOnly, only profiles with a country classification are loaded. Blocks until the whole index has been scrolled through.
+func LoadActorTrie(ctx context.Context, escli *es.Client, index string, t *ActorTrie, classifiedOnly bool) (int, error) {
+	ctx, span := tracer.Start(ctx, "LoadActorTrie")
+	defer span.End()
+
+	query := map[string]any{
+		"_source": []string{"did", "handle", "display_name"},
+		"size":    5000,
+	}
+	if classifiedOnly {
+		query["query"] = map[string]any{
+			"exists": map[string]any{"field": "country"},
+		}
+	}
+	b, err := json.Marshal(query)
+	if err != nil {
+		return 0, err
+	}
+	res, err := escli.Search(
+		escli.Search.WithContext(ctx),
+		escli.Search.WithIndex(index),
+		escli.Search.WithBody(strings.NewReader(string(b))),
+		escli.Search.WithScroll(time.Minute),
+	)
+	loaded := 0
+	for {
+		if err != nil {
+			return loaded, fmt.Errorf("scrolling profile index: %w", err)
+		}
+		var page struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []struct {
+					Source ProfileDoc `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return loaded, err
+		}
+		if res.IsError() {
+			return loaded, fmt.Errorf("scrolling profile index: status %d: %s", res.StatusCode, string(body))
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return loaded, fmt.Errorf("decoding scroll response: %w", err)
+		}
+		for _, h := range page.Hits.Hits {
+			doc := h.Source
+			var displayName string
+			if doc.DisplayName != nil {
+				displayName = *doc.DisplayName
+			}
+			t.Put(doc.DID, doc.Handle, displayName)
+			loaded++
+		}
+		if len(page.Hits.Hits) == 0 || page.ScrollID == "" {
+			if page.ScrollID != "" {
+				if cres, err := escli.ClearScroll(escli.ClearScroll.WithScrollID(page.ScrollID)); err == nil {
+					cres.Body.Close()
+				}
+			}
+			span.SetAttributes(attribute.Int("loaded", loaded))
+			return loaded, nil
+		}
+		res, err = escli.Scroll(
+			escli.Scroll.WithContext(ctx),
+			escli.Scroll.WithScrollID(page.ScrollID),
+			escli.Scroll.WithScroll(time.Minute),
+		)
+	}
+}
+
+func (s *Server) handleSearchTypeahead(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchTypeahead")
+	defer span.End()
+
+	q := strings.TrimSpace(e.QueryParam("q"))
+	if q == "" {
+		return e.JSON(200, map[string]any{"actors": []TypeaheadActor{}})
+	}
+	limit, err := intParam(e, "limit", 10, 1, 100)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.String("query", q), attribute.Int("limit", limit))
+
+	if s.actorTrie != nil {
+		return e.JSON(200, map[string]any{"actors": s.actorTrie.Search(q, limit)})
+	}
+
+	// without a trie (eg, read-only instances), fall back to the index
+	params := ActorSearchParams{Query: q, Size: limit}
+	params.Country, err = parseCountryFilter(e)
+	if err != nil {
+		return err
+	}
+	resp, err := DoSearchProfilesTypeahead(ctx, s.escli, s.profileIndex, &params)
+	if err != nil {
+		return err
+	}
+	actors := make([]TypeaheadActor, 0, len(resp.Hits.Hits))
+	for _, h := range resp.Hits.Hits {
+		var doc ProfileDoc
+		if err := json.Unmarshal(h.Source, &doc); err != nil {
+			return fmt.Errorf("decoding profile doc from search response: %w", err)
+		}
+		a := TypeaheadActor{DID: doc.DID, Handle: doc.Handle}
+		if doc.DisplayName != nil {
+			a.DisplayName = *doc.DisplayName
+		}
+		actors = append(actors, a)
+	}
+	return e.JSON(200, map[string]any{"actors": actors})
+}
+
+// sovereignActor reports whether an actor belongs in the typeahead trie: with a classification table configured, only classified accounts do
+func (idx *Indexer) sovereignActor(did string) bool {
+	if idx.countries == nil {
+		return true
+	}
+	_, ok := idx.countries.Get(did)
+	return ok
+}
+
+// refreshActors re-reads the given accounts' profiles from the index in to the typeahead trie, or removes them if they no longer belong
+func (idx *Indexer) refreshActors(ctx context.Context, dids []string) error {
+	for start := 0; start < len(dids); start += countryPropagateBatch {
+		batch := dids[start:min(start+countryPropagateBatch, len(dids))]
+		var add []string
+		for _, did := range batch {
+			if idx.sovereignActor(did) {
+				add = append(add, did)
+			} else {
+				idx.actors.Remove(did)
+			}
+		}
+		if len(add) == 0 {
+			continue
+		}
+		resp, err := doSearch(ctx, idx.escli, idx.profileIndex, map[string]any{
+			"query": map[string]any{
+				"ids": map[string]any{"values": add},
+			},
+			"_source": []string{"did", "handle", "display_name"},
+			"size":    len(add),
+		})
+		if err != nil {
+			return err
+		}
+		for _, h := range resp.Hits.Hits {
+			var doc ProfileDoc
+			if err := json.Unmarshal(h.Source, &doc); err != nil {
+				return fmt.Errorf("decoding profile doc from search response: %w", err)
+			}
+			var displayName string
+			if doc.DisplayName != nil {
+				displayName = *doc.DisplayName
+			}
+			idx.actors.Put(doc.DID, doc.Handle, displayName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActorTrie(t *testing.T) {
+	assert := assert.New(t)
+
+	trie := NewActorTrie()
+	trie.Put("did:plc:a", "eloise.gander.ca", "Éloïse Tremblay")
+	trie.Put("did:plc:b", "elo.gander.ca", "")
+	trie.Put("did:plc:c", "jean.example.com", "Jean Tremblay")
+	trie.Put("did:plc:d", "handle.invalid", "Eloquent Bot")
+	assert.Equal(4, trie.Len())
+
+	handles := func(actors []TypeaheadActor) []string {
+		var out []string
+		for _, a := range actors {
+			out = append(out, a.Handle)
+		}
+		return out
+	}
+
+	// handle prefix matches first, shorter handles first
+	assert.Equal([]string{"elo.gander.ca", "eloise.gander.ca", "handle.invalid"}, handles(trie.Search("@Elo", 10)))
+	assert.Equal([]string{"elo.gander.ca"}, handles(trie.Search("elo", 1)))
+	// display names are folded and matched word by word
+	assert.Equal([]string{"eloise.gander.ca", "jean.example.com"}, handles(trie.Search("tremb", 10)))
+	assert.Equal([]string{"jean.example.com"}, handles(trie.Search("trem je", 10)))
+	// handle labels are tokens too
+	assert.Len(trie.Search("gander", 10), 2)
+	// the invalid handle placeholder isn't searchable
+	assert.Empty(trie.Search("handle", 10))
+	assert.Empty(trie.Search("   ", 10))
+
+	trie.SetHandle("did:plc:c", "jt.gander.ca")
+	assert.Empty(trie.Search("jean.ex", 10))
+	assert.Equal("jt.gander.ca", trie.Search("jean", 10)[0].Handle)
+
+	trie.Put("did:plc:a", "eloise.gander.ca", "Éloïse")
+	assert.Equal([]string{"jt.gander.ca"}, handles(trie.Search("tremblay", 10)))
+
+	trie.Remove("did:plc:b")
+	trie.Remove("did:plc:unknown")
+	assert.Equal(3, trie.Len())
+	assert.Equal([]string{"eloise.gander.ca", "handle.invalid"}, handles(trie.Search("elo", 10)))
+	trie.Remove("did:plc:a")
+	trie.Remove("did:plc:c")
+	trie.Remove("did:plc:d")
+	assert.Empty(trie.root.children)
+}
@@ -0,0 +1,114 @@
+package blobs
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBlob(mime string, size int64) data.Blob {
+	c, _ := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte(mime))
+	return data.Blob{Ref: data.CIDLink(c), MimeType: mime, Size: size}
+}
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	pol := Policy{
+		Allowed: []string{"image/*", "video/mp4"},
+		MaxSize: map[string]int64{
+			"image/*":   1_000_000,
+			"image/gif": 5_000_000,
+			"video/mp4": 50_000_000,
+		},
+	}
+	assert.Equal("", pol.Check(testBlob("image/jpeg", 900_000)))
+	assert.Equal(ReasonTooLarge, pol.Check(testBlob("image/jpeg", 2_000_000)))
+	assert.Equal("", pol.Check(testBlob("image/gif", 2_000_000)))
+	assert.Equal("", pol.Check(testBlob("VIDEO/MP4", 2_000_000)))
+	assert.Equal(ReasonMimeType, pol.Check(testBlob("video/webm", 10)))
+	assert.Equal(ReasonMimeType, pol.Check(testBlob("application/zip", 10)))
+
+	// no allow-list, and a default limit
+	pol = Policy{DefaultMaxSize: 100}
+	assert.Equal("", pol.Check(testBlob("application/zip", 100)))
+	assert.Equal(ReasonTooLarge, pol.Check(testBlob("application/zip", 101)))
+
+	assert.True(IsVideo(testBlob("video/mp4", 1)))
+	assert.False(IsVideo(testBlob("image/png", 1)))
+}
+
+func TestRefs(t *testing.T) {
+	assert := assert.New(t)
+
+	video := testBlob("video/mp4", 1234)
+	rec := map[string]any{
+		"$type": "app.bsky.feed.post",
+		"text":  "clip",
+		"embed": map[string]any{
+			"$type": "app.bsky.embed.video",
+			"video": video,
+		},
+	}
+	blk := cartest.NewBlock(t, rec)
+	commit := &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, blk),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/3k", Cid: blk.Link()},
+			{Action: "delete", Path: "app.bsky.feed.post/3j"},
+		},
+	}
+	refs, err := Refs(commit)
+	assert.NoError(err)
+	assert.Len(refs, 1)
+	assert.Equal("app.bsky.feed.post/3k", refs[0].Path)
+	assert.Equal(video.Ref.String(), refs[0].Blob.Ref.String())
+	assert.Equal(int64(1234), refs[0].Blob.Size)
+}
+
+func TestTranscoder(t *testing.T) {
+	assert := assert.New(t)
+
+	jobs := make(chan Job, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(401)
+			return
+		}
+		var job Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		jobs <- job
+		w.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	tc := NewTranscoder(srv.URL, "s3cret", "https://relay.example.ca/callback", srv.Client(), slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tc.Run(ctx, 2)
+
+	assert.True(tc.Enqueue(Job{Did: "did:plc:abc", Cid: "bafkrei", MimeType: "video/mp4"}))
+	select {
+	case job := <-jobs:
+		assert.Equal("did:plc:abc", job.Did)
+		assert.Equal("https://relay.example.ca/callback", job.Callback)
+	case <-time.After(5 * time.Second):
+		t.Fatal("transcoding job was not submitted")
+	}
+}
@@ -0,0 +1,60 @@
+package blobs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// Ref is a blob referenced by a record.
+type Ref struct {
+	// repo path of the record
+	Path string
+	Blob data.Blob
+}
+
+// Refs returns the blobs referenced by records created or updated in a commit. Records which can't be decoded are skipped.
+func Refs(commit *comatproto.SyncSubscribeRepos_Commit) ([]Ref, error) {
+	want := make(map[cid.Cid]string)
+	for _, op := range commit.Ops {
+		if op.Cid != nil && (op.Action == "create" || op.Action == "update") {
+			want[cid.Cid(*op.Cid)] = op.Path
+		}
+	}
+	if len(want) == 0 {
+		return nil, nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	var refs []Ref
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		path, ok := want[blk.Cid()]
+		if !ok {
+			continue
+		}
+		rec, err := data.UnmarshalCBOR(blk.RawData())
+		if err != nil {
+			continue
+		}
+		for _, b := range data.ExtractBlobs(rec) {
+			refs = append(refs, Ref{Path: path, Blob: b})
+		}
+	}
+	return refs, nil
+}
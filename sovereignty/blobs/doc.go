@@ -0,0 +1,4 @@
+// Policy checks for blobs referenced by mirrored records, and hand-off of video blobs to an external transcoding service.
+//
+// A Policy limits the MIME types records may reference and the size of each blob, by type; records in incoming commits which reference a non-conforming blob are recorded as violations. Video blobs are queued to a Transcoder, which posts jobs to the transcoding service; the service reports back with a playlist reference (eg, an HLS manifest URL) which the relay stores and serves to the national AppView.
+package blobs
@@ -0,0 +1,11 @@
+package blobs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var transcodeJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "blobs_transcode_jobs_total",
+	Help: "Transcoding jobs, by outcome (queued, dropped, submitted, error)",
+}, []string{"outcome"})
@@ -0,0 +1,83 @@
+package blobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+)
+
+const (
+	ReasonMimeType = "mime-type"
+	ReasonTooLarge = "too-large"
+)
+
+// Policy restricts the blobs records may reference. MIME types are matched exactly, or by "type/*" wildcards.
+type Policy struct {
+	// allowed MIME types; empty allows any
+	Allowed []string `json:"allowed,omitempty"`
+	// maximum blob size in bytes, by MIME type (or wildcard); the most specific match applies
+	MaxSize map[string]int64 `json:"maxSize,omitempty"`
+	// maximum size of blobs not covered by MaxSize; zero is unlimited
+	DefaultMaxSize int64 `json:"defaultMaxSize,omitempty"`
+}
+
+// LoadPolicy reads a policy from a JSON file.
+func LoadPolicy(p string) (*Policy, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var pol Policy
+	if err := json.Unmarshal(raw, &pol); err != nil {
+		return nil, fmt.Errorf("parsing blob policy: %w", err)
+	}
+	return &pol, nil
+}
+
+// Check returns the reason the blob violates the policy, or an empty string if it conforms.
+func (p *Policy) Check(b data.Blob) string {
+	mime := strings.ToLower(b.MimeType)
+	if len(p.Allowed) > 0 {
+		ok := false
+		for _, pat := range p.Allowed {
+			if matchMime(pat, mime) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return ReasonMimeType
+		}
+	}
+	if max := p.maxSize(mime); max > 0 && b.Size > max {
+		return ReasonTooLarge
+	}
+	return ""
+}
+
+func (p *Policy) maxSize(mime string) int64 {
+	if max, ok := p.MaxSize[mime]; ok {
+		return max
+	}
+	major, _, _ := strings.Cut(mime, "/")
+	if max, ok := p.MaxSize[major+"/*"]; ok {
+		return max
+	}
+	return p.DefaultMaxSize
+}
+
+func matchMime(pattern, mime string) bool {
+	pattern = strings.ToLower(pattern)
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mime, prefix+"/")
+	}
+	return pattern == mime
+}
+
+// IsVideo reports whether the blob should be handed off for transcoding.
+func IsVideo(b data.Blob) bool {
+	return strings.HasPrefix(strings.ToLower(b.MimeType), "video/")
+}
@@ -0,0 +1,127 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+const (
+	StatusQueued = "queued"
+	StatusReady  = "ready"
+	StatusFailed = "failed"
+)
+
+// Job is the request body posted to the transcoding service.
+type Job struct {
+	Did      string `json:"did"`
+	Cid      string `json:"cid"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+	// where the service can fetch the blob (the account's PDS)
+	Source string `json:"source"`
+	// where the service posts its Result
+	Callback string `json:"callback"`
+}
+
+// Result is posted back by the transcoding service when a job finishes.
+type Result struct {
+	Did string `json:"did"`
+	Cid string `json:"cid"`
+	// StatusReady or StatusFailed
+	Status string `json:"status"`
+	// playlist reference, eg the URL of an HLS manifest
+	Playlist string `json:"playlist,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Transcoder hands video blobs off to an external transcoding service. Jobs are queued in memory and posted by a pool of workers; jobs which don't fit in the queue are dropped (and will be picked up again if the record is re-submitted).
+type Transcoder struct {
+	// URL jobs are posted to
+	URL string
+	// bearer token sent with jobs, and expected on results
+	Secret string
+	// URL included in jobs for the service to post results to
+	CallbackURL string
+	Client      *http.Client
+	Logger      *slog.Logger
+
+	queue chan Job
+}
+
+func NewTranscoder(url, secret, callbackURL string, client *http.Client, logger *slog.Logger) *Transcoder {
+	return &Transcoder{
+		URL:         url,
+		Secret:      secret,
+		CallbackURL: callbackURL,
+		Client:      client,
+		Logger:      logger,
+		queue:       make(chan Job, 10_000),
+	}
+}
+
+// Enqueue queues a job without blocking, returning false if the queue is full.
+func (t *Transcoder) Enqueue(job Job) bool {
+	job.Callback = t.CallbackURL
+	select {
+	case t.queue <- job:
+		transcodeJobs.WithLabelValues("queued").Inc()
+		return true
+	default:
+		transcodeJobs.WithLabelValues("dropped").Inc()
+		return false
+	}
+}
+
+// Run posts queued jobs with the given number of workers until the context is cancelled.
+func (t *Transcoder) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-t.queue:
+					if err := t.post(ctx, job); err != nil {
+						transcodeJobs.WithLabelValues("error").Inc()
+						t.Logger.Warn("failed to submit transcoding job", "did", job.Did, "cid", job.Cid, "err", err)
+						continue
+					}
+					transcodeJobs.WithLabelValues("submitted").Inc()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (t *Transcoder) post(ctx context.Context, job Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Secret)
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("transcoding service returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package sovereignty
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+const (
+	// comma-separated did,country,source[,updatedAt], with an optional header row
+	FormatCSV = "csv"
+	// one JSON Classification object per line
+	FormatJSONL = "jsonl"
+)
+
+// ValidFormat returns an error unless f is a supported bulk format.
+func ValidFormat(f string) error {
+	switch f {
+	case FormatCSV, FormatJSONL:
+		return nil
+	default:
+		return fmt.Errorf("unsupported bulk format: %q", f)
+	}
+}
+
+// maximum number of row errors and sample changes kept in an ImportReport
+const reportSampleSize = 100
+
+// RowError describes an input row which was rejected.
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Change is a single difference an import makes to the table. From is empty for new entries.
+type Change struct {
+	DID  string `json:"did"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// ImportReport summarizes the effect of an import, or what it would be for a dry run.
+type ImportReport struct {
+	DryRun bool `json:"dryRun"`
+	Rows   int  `json:"rows"`
+	// rows rejected by validation
+	Invalid int `json:"invalid"`
+	// rows for a DID seen earlier in the same input; the first occurrence wins
+	Duplicates int `json:"duplicates"`
+	Added      int `json:"added"`
+	Changed    int `json:"changed"`
+	Unchanged  int `json:"unchanged"`
+	// the first rejected rows
+	Errors []RowError `json:"errors,omitempty"`
+	// the first additions and changes
+	Sample []Change `json:"sample,omitempty"`
+}
+
+// Importer streams classification rows from a CSV or JSONL input, validating and deduplicating them and diffing against the current table.
+type Importer struct {
+	Table *Table
+	// source recorded for rows which don't specify one
+	DefaultSource string
+	// report without calling Apply
+	DryRun    bool
+	BatchSize int
+	// persists a batch of additions and changes; the caller is responsible for updating Table
+	Apply func([]Classification) error
+	// if set, called with the running report every ProgressEvery rows
+	Progress      func(*ImportReport)
+	ProgressEvery int
+}
+
+// Run reads the whole input, applying additions and changes in batches unless DryRun is set. Invalid rows are reported, not fatal; I/O and Apply errors abort the import, leaving earlier batches applied.
+func (im *Importer) Run(r io.Reader, format string) (*ImportReport, error) {
+	var next func() (Classification, int, error)
+	switch format {
+	case FormatCSV:
+		next = csvRows(r)
+	case FormatJSONL:
+		next = jsonlRows(r)
+	default:
+		return nil, ValidFormat(format)
+	}
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	now := time.Now().UTC()
+
+	rep := &ImportReport{DryRun: im.DryRun}
+	seen := make(map[string]struct{})
+	var batch []Classification
+	flush := func() error {
+		if len(batch) == 0 || im.DryRun {
+			batch = batch[:0]
+			return nil
+		}
+		if err := im.Apply(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		c, line, err := next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *rowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return rep, err
+		}
+		rep.Rows++
+		if im.Progress != nil && im.ProgressEvery > 0 && rep.Rows%im.ProgressEvery == 0 {
+			im.Progress(rep)
+		}
+		if rowErr != nil {
+			rep.reject(line, rowErr.err)
+			continue
+		}
+
+		if err := validateRow(&c); err != nil {
+			rep.reject(line, err)
+			continue
+		}
+		if _, dup := seen[c.DID]; dup {
+			rep.Duplicates++
+			continue
+		}
+		seen[c.DID] = struct{}{}
+		if c.Source == "" {
+			c.Source = im.DefaultSource
+		}
+
+		prev, ok := im.Table.Get(c.DID)
+		switch {
+		case !ok:
+			rep.Added++
+			rep.sample(Change{DID: c.DID, To: c.Country})
+		case prev.Country != c.Country || prev.Subdivision != c.Subdivision || prev.Source != c.Source || !sameExpiry(prev.ExpiresAt, c.ExpiresAt):
+			rep.Changed++
+			rep.sample(Change{DID: c.DID, From: prev.Country, To: c.Country})
+		default:
+			rep.Unchanged++
+			continue
+		}
+		c.UpdatedAt = now
+		batch = append(batch, c)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return rep, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (rep *ImportReport) reject(line int, err error) {
+	rep.Invalid++
+	if len(rep.Errors) < reportSampleSize {
+		rep.Errors = append(rep.Errors, RowError{Line: line, Error: err.Error()})
+	}
+}
+
+func (rep *ImportReport) sample(c Change) {
+	if len(rep.Sample) < reportSampleSize {
+		rep.Sample = append(rep.Sample, c)
+	}
+}
+
+func validateRow(c *Classification) error {
+	did, err := syntax.ParseDID(strings.TrimSpace(c.DID))
+	if err != nil {
+		return err
+	}
+	c.DID = did.String()
+	c.Country, err = NormalizeCountry(c.Country)
+	if err != nil {
+		return err
+	}
+	c.Subdivision, err = NormalizeSubdivision(c.Country, c.Subdivision)
+	if err != nil {
+		return err
+	}
+	c.Source = strings.TrimSpace(c.Source)
+	return nil
+}
+
+// rowError wraps a per-row parse failure, as opposed to an I/O error
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string { return e.err.Error() }
+
+func csvRows(r io.Reader) func() (Classification, int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	first := true
+	return func() (Classification, int, error) {
+		for {
+			rec, err := cr.Read()
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return Classification{}, perr.Line, &rowError{err}
+			}
+			if err != nil {
+				return Classification{}, 0, err
+			}
+			line, _ := cr.FieldPos(0)
+			if first {
+				first = false
+				if strings.EqualFold(strings.TrimSpace(rec[0]), "did") {
+					continue
+				}
+			}
+			if len(rec) < 2 {
+				return Classification{}, line, &rowError{fmt.Errorf("expected at least did and country columns")}
+			}
+			c := Classification{DID: rec[0], Country: rec[1]}
+			if len(rec) > 2 {
+				c.Source = rec[2]
+			}
+			return c, line, nil
+		}
+	}
+}
+
+func jsonlRows(r io.Reader) func() (Classification, int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	return func() (Classification, int, error) {
+		for sc.Scan() {
+			line++
+			b := sc.Bytes()
+			if len(strings.TrimSpace(string(b))) == 0 {
+				continue
+			}
+			var c Classification
+			if err := json.Unmarshal(b, &c); err != nil {
+				return c, line, &rowError{err}
+			}
+			return c, line, nil
+		}
+		if err := sc.Err(); err != nil {
+			return Classification{}, line, err
+		}
+		return Classification{}, line, io.EOF
+	}
+}
+
+// ExportFilter selects which classifications to export. Zero fields match everything.
+type ExportFilter struct {
+	Country string
+	Source  string
+	// only entries updated at or after this time
+	Since time.Time
+}
+
+// Match returns true if the classification passes the filter.
+func (f *ExportFilter) Match(c Classification) bool {
+	if f.Country != "" && c.Country != f.Country {
+		return false
+	}
+	if f.Source != "" && c.Source != f.Source {
+		return false
+	}
+	if !f.Since.IsZero() && c.UpdatedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Export writes the matching entries in the given format, returning the number written. CSV output has a header row and an updatedAt column, and can be imported again as-is.
+func Export(w io.Writer, format string, entries []Classification, filter ExportFilter) (int, error) {
+	n := 0
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"did", "country", "source", "updatedAt"}); err != nil {
+			return 0, err
+		}
+		for _, c := range entries {
+			if !filter.Match(c) {
+				continue
+			}
+			if err := cw.Write([]string{c.DID, c.Country, c.Source, c.UpdatedAt.UTC().Format(time.RFC3339)}); err != nil {
+				return n, err
+			}
+			n++
+		}
+		cw.Flush()
+		return n, cw.Error()
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, c := range entries {
+			if !filter.Match(c) {
+				continue
+			}
+			if err := enc.Encode(c); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	default:
+		return 0, ValidFormat(format)
+	}
+}
@@ -0,0 +1,116 @@
+package sovereignty
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	assert := assert.New(t)
+
+	tbl := NewTable()
+	tbl.Set(Classification{DID: "did:plc:same", Country: "CA", Source: "admin"})
+	tbl.Set(Classification{DID: "did:plc:moved", Country: "US", Source: "admin"})
+
+	input := `did,country,source
+did:plc:same,CA,admin
+did:plc:moved,ca,admin
+did:plc:new,fr,
+not-a-did,CA,admin
+did:plc:bad,Canada,admin
+did:plc:new,DE,admin
+did:plc:short
+`
+	var applied []Classification
+	var progress []int
+	im := Importer{
+		Table:         tbl,
+		DefaultSource: "import",
+		BatchSize:     1,
+		Apply: func(batch []Classification) error {
+			applied = append(applied, batch...)
+			return nil
+		},
+		Progress:      func(r *ImportReport) { progress = append(progress, r.Rows) },
+		ProgressEvery: 3,
+	}
+
+	// dry run reports without applying
+	im.DryRun = true
+	rep, err := im.Run(strings.NewReader(input), FormatCSV)
+	assert.NoError(err)
+	assert.Empty(applied)
+	assert.True(rep.DryRun)
+	assert.Equal(7, rep.Rows)
+	assert.Equal(1, rep.Added)
+	assert.Equal(1, rep.Changed)
+	assert.Equal(1, rep.Unchanged)
+	assert.Equal(1, rep.Duplicates)
+	assert.Equal(3, rep.Invalid)
+	assert.Equal([]int{5, 6, 8}, []int{rep.Errors[0].Line, rep.Errors[1].Line, rep.Errors[2].Line})
+	assert.Equal([]Change{{DID: "did:plc:moved", From: "US", To: "CA"}, {DID: "did:plc:new", To: "FR"}}, rep.Sample)
+	assert.Equal([]int{3, 6}, progress)
+
+	im.DryRun = false
+	_, err = im.Run(strings.NewReader(input), FormatCSV)
+	assert.NoError(err)
+	if assert.Len(applied, 2) {
+		assert.Equal("did:plc:moved", applied[0].DID)
+		assert.Equal("did:plc:new", applied[1].DID)
+		assert.Equal("import", applied[1].Source)
+		assert.False(applied[1].UpdatedAt.IsZero())
+	}
+
+	jsonl := `{"did":"did:plc:new","country":"FR","source":"import"}
+
+{"did":"did:plc:other","country":"NZ"}
+{not json
+`
+	applied = nil
+	rep, err = im.Run(strings.NewReader(jsonl), FormatJSONL)
+	assert.NoError(err)
+	assert.Equal(3, rep.Rows)
+	assert.Equal(1, rep.Invalid)
+	assert.Equal(4, rep.Errors[0].Line)
+	assert.Len(applied, 2)
+
+	_, err = im.Run(strings.NewReader(""), "xml")
+	assert.Error(err)
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []Classification{
+		{DID: "did:plc:a", Country: "CA", Source: "admin", UpdatedAt: at},
+		{DID: "did:plc:b", Country: "US", Source: "import", UpdatedAt: at.Add(-time.Hour)},
+		{DID: "did:plc:c", Country: "CA", Source: "import", UpdatedAt: at},
+	}
+
+	var buf bytes.Buffer
+	n, err := Export(&buf, FormatCSV, entries, ExportFilter{Country: "CA"})
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.Equal("did,country,source,updatedAt\ndid:plc:a,CA,admin,2025-01-02T03:04:05Z\ndid:plc:c,CA,import,2025-01-02T03:04:05Z\n", buf.String())
+
+	buf.Reset()
+	n, err = Export(&buf, FormatJSONL, entries, ExportFilter{Source: "import", Since: at})
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Contains(buf.String(), `"did":"did:plc:c"`)
+
+	// exports round-trip through import
+	buf.Reset()
+	_, err = Export(&buf, FormatCSV, entries, ExportFilter{})
+	assert.NoError(err)
+	im := Importer{Table: NewTable(), DryRun: true}
+	rep, err := im.Run(&buf, FormatCSV)
+	assert.NoError(err)
+	assert.Equal(3, rep.Added)
+	assert.Zero(rep.Invalid)
+}
@@ -0,0 +1,305 @@
+package sovereignty
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+)
+
+// Classification records the country an account (DID) has been attributed to, and where that attribution came from.
+type Classification struct {
+	DID string `json:"did"`
+	// ISO 3166-1 alpha-2 country code, upper case (eg, "CA")
+	Country string `json:"country"`
+	// ISO 3166-2 subdivision code within Country, without the country prefix (eg, "QC"); empty if unknown
+	Subdivision string `json:"subdivision,omitempty"`
+	// free-form short identifier of the signal or process which produced this classification (eg, "admin", "import", "pds-geo")
+	Source    string    `json:"source,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// when a classification derived automatically lapses, so it is derived afresh; nil if it doesn't
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// how sure the country resolver was, for classifications it applied; ConfidenceNone for classifications made by operators or imported
+	Confidence Confidence `json:"confidence,omitempty"`
+}
+
+// Expired returns true if the classification has lapsed by now.
+func (c Classification) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// Assurance returns how sure the classification is: the resolver's confidence, or ConfidenceHigh for classifications which didn't come from a resolver.
+func (c Classification) Assurance() Confidence {
+	if c.Confidence == ConfidenceNone {
+		return ConfidenceHigh
+	}
+	return c.Confidence
+}
+
+// NormalizeCountry validates a two-letter country code and returns it in canonical (upper case) form.
+func NormalizeCountry(raw string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(raw))
+	if len(c) != 2 {
+		return "", fmt.Errorf("invalid country code: %q", raw)
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid country code: %q", raw)
+		}
+	}
+	return c, nil
+}
+
+// NormalizeSubdivision validates an ISO 3166-2 subdivision code, with or without its country prefix, and returns it in canonical (upper case, unprefixed) form. An empty code is returned unchanged.
+func NormalizeSubdivision(country, raw string) (string, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimPrefix(s, country+"-")
+	if s == "" {
+		return "", nil
+	}
+	if len(s) > 3 {
+		return "", fmt.Errorf("invalid subdivision code: %q", raw)
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return "", fmt.Errorf("invalid subdivision code: %q", raw)
+		}
+	}
+	return s, nil
+}
+
+// ParseRegion parses a country code (eg, "CA") or an ISO 3166-2 subdivision code prefixed with its country (eg, "CA-QC"), returning both parts in canonical form. The subdivision is empty for a country code.
+func ParseRegion(raw string) (country, subdivision string, err error) {
+	c, sub, _ := strings.Cut(strings.TrimSpace(raw), "-")
+	country, err = NormalizeCountry(c)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid region: %q", raw)
+	}
+	if strings.Contains(raw, "-") && strings.TrimSpace(sub) == "" {
+		return "", "", fmt.Errorf("invalid region: %q", raw)
+	}
+	subdivision, err = NormalizeSubdivision(country, sub)
+	if err != nil {
+		return "", "", err
+	}
+	return country, subdivision, nil
+}
+
+// NormalizeRegion validates an ISO 3166-2 subdivision code prefixed with its country (eg, "ca-qc"), and returns it in canonical form (eg, "CA-QC").
+func NormalizeRegion(raw string) (string, error) {
+	c, sub, err := ParseRegion(raw)
+	if err != nil {
+		return "", err
+	}
+	if sub == "" {
+		return "", fmt.Errorf("invalid subdivision code: %q (must be prefixed with its country, eg CA-QC)", raw)
+	}
+	return c + "-" + sub, nil
+}
+
+// Region returns the classification's ISO 3166-2 region: the country and subdivision codes joined by a hyphen (eg, "CA-QC"), or just the country if the subdivision isn't known.
+func (c Classification) Region() string {
+	if c.Subdivision == "" {
+		return c.Country
+	}
+	return c.Country + "-" + c.Subdivision
+}
+
+// tableShards is the number of stripes a Table is split into, so that lookups from many goroutines, made for every event on the firehose, don't all contend on one lock
+const tableShards = 64
+
+type tableShard struct {
+	lk      sync.RWMutex
+	entries map[string]Classification
+	// keeps neighbouring shards' locks off the same cache line
+	_ [32]byte
+}
+
+// Table is an in-process DID to Classification mapping, safe for concurrent use. It is split into shards by DID hash, each with its own lock; operations spanning DIDs (Replace, ApplyBatch, Snapshot) lock every shard, so they stay atomic to readers.
+type Table struct {
+	// time source for expiry and update times; nil uses the system clock. Set before the table is used
+	Clock clock.Clock
+
+	seed   maphash.Seed
+	shards [tableShards]tableShard
+}
+
+// NewTable returns an empty Table.
+func NewTable() *Table {
+	t := &Table{seed: maphash.MakeSeed()}
+	for i := range t.shards {
+		t.shards[i].entries = make(map[string]Classification)
+	}
+	return t
+}
+
+func (t *Table) now() time.Time {
+	return clock.OrSystem(t.Clock).Now()
+}
+
+// shardIndex returns the index of the shard holding a DID
+func (t *Table) shardIndex(did string) int {
+	return int(maphash.String(t.seed, did) % tableShards)
+}
+
+func (t *Table) shard(did string) *tableShard {
+	return &t.shards[t.shardIndex(did)]
+}
+
+// lockAll takes every shard's write lock, in order; the returned func releases them
+func (t *Table) lockAll() func() {
+	for i := range t.shards {
+		t.shards[i].lk.Lock()
+	}
+	return func() {
+		for i := range t.shards {
+			t.shards[i].lk.Unlock()
+		}
+	}
+}
+
+// rlockAll takes every shard's read lock, in order; the returned func releases them
+func (t *Table) rlockAll() func() {
+	for i := range t.shards {
+		t.shards[i].lk.RLock()
+	}
+	return func() {
+		for i := range t.shards {
+			t.shards[i].lk.RUnlock()
+		}
+	}
+}
+
+// Get returns the classification for the DID, if there is one. Expired classifications are treated as missing, even before Expire removes them.
+func (t *Table) Get(did string) (Classification, bool) {
+	sh := t.shard(did)
+	sh.lk.RLock()
+	c, ok := sh.entries[did]
+	sh.lk.RUnlock()
+	if ok && c.Expired(t.now()) {
+		return Classification{}, false
+	}
+	return c, ok
+}
+
+// Set inserts or replaces the classification for c.DID. If UpdatedAt is not set, the current time is used.
+func (t *Table) Set(c Classification) {
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = t.now().UTC()
+	}
+	sh := t.shard(c.DID)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	sh.entries[c.DID] = c
+}
+
+// Delete removes any classification for the DID, returning true if an entry existed.
+func (t *Table) Delete(did string) bool {
+	sh := t.shard(did)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	_, ok := sh.entries[did]
+	delete(sh.entries, did)
+	return ok
+}
+
+// Reset drops all entries from the table.
+func (t *Table) Reset() {
+	t.Replace(nil)
+}
+
+// Replace swaps the full contents of the table for the given entries. Concurrent readers see either the old or the new contents, never a mix.
+func (t *Table) Replace(entries []Classification) {
+	var maps [tableShards]map[string]Classification
+	for i := range maps {
+		maps[i] = make(map[string]Classification, len(entries)/tableShards)
+	}
+	for _, c := range entries {
+		maps[t.shardIndex(c.DID)][c.DID] = c
+	}
+	defer t.lockAll()()
+	for i := range t.shards {
+		t.shards[i].entries = maps[i]
+	}
+}
+
+// ApplyBatch sets and deletes a group of entries while holding the locks once, so concurrent readers never see the batch half-applied. Deletes are applied after sets.
+func (t *Table) ApplyBatch(set []Classification, del []string) {
+	defer t.lockAll()()
+	for _, c := range set {
+		t.shard(c.DID).entries[c.DID] = c
+	}
+	for _, did := range del {
+		delete(t.shard(did).entries, did)
+	}
+}
+
+// Expire removes the classifications which have lapsed by now, and returns them.
+func (t *Table) Expire(now time.Time) []Classification {
+	var out []Classification
+	for i := range t.shards {
+		sh := &t.shards[i]
+		// most shards have nothing to expire; scan without blocking writers
+		var dids []string
+		sh.lk.RLock()
+		for did, c := range sh.entries {
+			if c.Expired(now) {
+				dids = append(dids, did)
+			}
+		}
+		sh.lk.RUnlock()
+		if len(dids) == 0 {
+			continue
+		}
+
+		sh.lk.Lock()
+		for _, did := range dids {
+			// may have been replaced since the scan
+			if c, ok := sh.entries[did]; ok && c.Expired(now) {
+				delete(sh.entries, did)
+				out = append(out, c)
+			}
+		}
+		sh.lk.Unlock()
+	}
+	return out
+}
+
+// Len returns the number of classified DIDs, including any expired ones not yet removed.
+func (t *Table) Len() int {
+	n := 0
+	for i := range t.shards {
+		sh := &t.shards[i]
+		sh.lk.RLock()
+		n += len(sh.entries)
+		sh.lk.RUnlock()
+	}
+	return n
+}
+
+// Snapshot returns a copy of all unexpired entries, sorted by DID.
+func (t *Table) Snapshot() []Classification {
+	now := t.now()
+	unlock := t.rlockAll()
+	n := 0
+	for i := range t.shards {
+		n += len(t.shards[i].entries)
+	}
+	out := make([]Classification, 0, n)
+	for i := range t.shards {
+		for _, c := range t.shards[i].entries {
+			if c.Expired(now) {
+				continue
+			}
+			out = append(out, c)
+		}
+	}
+	unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].DID < out[j].DID })
+	return out
+}
@@ -0,0 +1,256 @@
+package sovereignty
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		raw  string
+		out  string
+		fail bool
+	}{
+		{raw: "CA", out: "CA"},
+		{raw: "ca", out: "CA"},
+		{raw: " de ", out: "DE"},
+		{raw: "", fail: true},
+		{raw: "C", fail: true},
+		{raw: "CAN", fail: true},
+		{raw: "C1", fail: true},
+		{raw: "É1", fail: true},
+		{raw: "--", fail: true},
+	}
+
+	for _, tc := range tests {
+		out, err := NormalizeCountry(tc.raw)
+		if tc.fail {
+			assert.Error(err, tc.raw)
+			continue
+		}
+		assert.NoError(err, tc.raw)
+		assert.Equal(tc.out, out)
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	assert := assert.New(t)
+
+	for raw, exp := range map[string][2]string{
+		"CA":     {"CA", ""},
+		"ca-qc":  {"CA", "QC"},
+		" FR-75": {"FR", "75"},
+	} {
+		c, sub, err := ParseRegion(raw)
+		assert.NoError(err, raw)
+		assert.Equal(exp, [2]string{c, sub}, raw)
+	}
+	for _, raw := range []string{"", "CA-", "Canada-QC", "CA-QUEB", "-QC"} {
+		_, _, err := ParseRegion(raw)
+		assert.Error(err, raw)
+	}
+
+	r, err := NormalizeRegion("ca-on")
+	assert.NoError(err)
+	assert.Equal("CA-ON", r)
+	_, err = NormalizeRegion("CA")
+	assert.Error(err)
+}
+
+func TestTable(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := Classification{DID: "did:plc:aaa", Country: "CA", UpdatedAt: ts}
+	b := Classification{DID: "did:plc:bbb", Country: "US", UpdatedAt: ts}
+	c := Classification{DID: "did:plc:ccc", Country: "FR", UpdatedAt: ts}
+
+	tests := []struct {
+		name  string
+		apply func(tbl *Table)
+		want  []Classification
+	}{
+		{
+			name:  "set",
+			apply: func(tbl *Table) { tbl.Set(b); tbl.Set(a) },
+			want:  []Classification{a, b},
+		},
+		{
+			name: "overwrite",
+			apply: func(tbl *Table) {
+				tbl.Set(a)
+				tbl.Set(Classification{DID: a.DID, Country: "MX", UpdatedAt: ts})
+			},
+			want: []Classification{{DID: a.DID, Country: "MX", UpdatedAt: ts}},
+		},
+		{
+			name:  "delete",
+			apply: func(tbl *Table) { tbl.Set(a); tbl.Set(b); tbl.Delete(a.DID) },
+			want:  []Classification{b},
+		},
+		{
+			name:  "reset",
+			apply: func(tbl *Table) { tbl.Set(a); tbl.Reset() },
+			want:  []Classification{},
+		},
+		{
+			name:  "replace",
+			apply: func(tbl *Table) { tbl.Set(a); tbl.Replace([]Classification{c, b}) },
+			want:  []Classification{b, c},
+		},
+		{
+			name:  "batch",
+			apply: func(tbl *Table) { tbl.Set(a); tbl.Set(b); tbl.ApplyBatch([]Classification{c}, []string{a.DID}) },
+			want:  []Classification{b, c},
+		},
+	}
+
+	for _, tc := range tests {
+		tbl := NewTable()
+		tc.apply(tbl)
+		assert.Equal(tc.want, tbl.Snapshot(), tc.name)
+		assert.Equal(len(tc.want), tbl.Len(), tc.name)
+	}
+
+	tbl := NewTable()
+	assert.False(tbl.Delete(a.DID))
+	tbl.Set(Classification{DID: a.DID, Country: "CA"})
+	got, ok := tbl.Get(a.DID)
+	assert.True(ok)
+	assert.False(got.UpdatedAt.IsZero())
+	assert.True(tbl.Delete(a.DID))
+	_, ok = tbl.Get(a.DID)
+	assert.False(ok)
+}
+
+func TestTableExpire(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	a := Classification{DID: "did:plc:aaa", Country: "CA", ExpiresAt: &past}
+	b := Classification{DID: "did:plc:bbb", Country: "US", ExpiresAt: &future}
+	c := Classification{DID: "did:plc:ccc", Country: "FR"}
+
+	clk := clock.NewMock(now)
+	tbl := NewTable()
+	tbl.Clock = clk
+	tbl.Replace([]Classification{a, b, c})
+
+	// expired entries are missing before they are removed
+	_, ok := tbl.Get(a.DID)
+	assert.False(ok)
+	_, ok = tbl.Get(b.DID)
+	assert.True(ok)
+	assert.Equal([]Classification{b, c}, tbl.Snapshot())
+	assert.Equal(3, tbl.Len())
+
+	assert.Equal([]Classification{a}, tbl.Expire(now))
+	assert.Equal(2, tbl.Len())
+	assert.Empty(tbl.Expire(now))
+
+	clk.Set(future)
+	_, ok = tbl.Get(b.DID)
+	assert.False(ok)
+	expired := tbl.Expire(future)
+	assert.Equal([]Classification{b}, expired)
+	assert.Equal([]Classification{c}, tbl.Snapshot())
+}
+
+func TestExplain(t *testing.T) {
+	assert := assert.New(t)
+
+	carried := map[string]bool{"CA": true}
+	c := &Classification{DID: "did:plc:a", Country: "CA", Source: "pds-geo", UpdatedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	s := Explain(StandingInput{DID: "did:plc:a", Classification: c, StreamCountries: carried})
+	assert.True(s.Included)
+	assert.Equal([]string{
+		"classified as CA (source: pds-geo, updated 2025-03-01)",
+		"CA is carried on the sovereign stream",
+	}, s.Reasons)
+
+	s = Explain(StandingInput{DID: "did:plc:b", Classification: &Classification{Country: "US"}, StreamCountries: carried})
+	assert.False(s.Included)
+	assert.Contains(s.Reasons, "US is not carried on the sovereign stream (carried: CA)")
+
+	s = Explain(StandingInput{DID: "did:plc:c", StreamCountries: carried})
+	assert.False(s.Included)
+	assert.Equal([]string{"not classified to any country"}, s.Reasons)
+
+	s = Explain(StandingInput{DID: "did:plc:d", StreamCountries: carried, Priority: true, HashOnly: true})
+	assert.True(s.Included)
+	assert.Len(s.Reasons, 3)
+
+	s = Explain(StandingInput{DID: "did:plc:a", Classification: c, StreamCountries: carried, IdentityFlags: []string{"rotation keys changed 3 times within 24h0m0s"}})
+	assert.True(s.Included)
+	assert.Equal("identity history flagged: rotation keys changed 3 times within 24h0m0s", s.Reasons[2])
+
+	// sub-national streams carry accounts by subdivision
+	qc := &Classification{Country: "CA", Subdivision: "QC", Source: "admin", UpdatedAt: c.UpdatedAt}
+	s = Explain(StandingInput{DID: "did:plc:e", Classification: qc, StreamSubdivisions: map[string]bool{"CA-QC": true}})
+	assert.True(s.Included)
+	assert.Equal("CA-QC is carried on the sovereign stream", s.Reasons[1])
+	s = Explain(StandingInput{DID: "did:plc:e", Classification: qc, StreamSubdivisions: map[string]bool{"CA-ON": true}})
+	assert.False(s.Included)
+	assert.Equal("CA-QC is not carried on the sovereign stream (carried: CA-ON)", s.Reasons[1])
+
+	// exclusion streams carry every account but the excluded countries'
+	excluded := map[string]bool{"US": true}
+	s = Explain(StandingInput{DID: "did:plc:b", Classification: &Classification{Country: "US"}, ExcludeCountries: excluded})
+	assert.False(s.Included)
+	assert.Equal("US is excluded from the sovereign stream", s.Reasons[1])
+	s = Explain(StandingInput{DID: "did:plc:a", Classification: c, ExcludeCountries: excluded})
+	assert.True(s.Included)
+	assert.Equal("the sovereign stream carries all accounts except those of excluded countries (excluded: US)", s.Reasons[1])
+	s = Explain(StandingInput{DID: "did:plc:c", ExcludeCountries: excluded})
+	assert.True(s.Included)
+
+	// the operator's lists override classifications, but not priority
+	s = Explain(StandingInput{DID: "did:plc:b", Classification: &Classification{Country: "US"}, StreamCountries: carried, ListedIn: true})
+	assert.True(s.Included)
+	assert.Equal("listed as in country by the relay operator, which is always carried", s.Reasons[0])
+	s = Explain(StandingInput{DID: "did:plc:a", Classification: c, StreamCountries: carried, ListedIn: true, ListedOut: true})
+	assert.False(s.Included)
+	assert.Equal("listed as out of country by the relay operator, which overrides its classification", s.Reasons[0])
+	s = Explain(StandingInput{DID: "did:plc:a", Classification: c, StreamCountries: carried, Priority: true, ListedOut: true})
+	assert.True(s.Included)
+
+	s = Explain(StandingInput{DID: "did:plc:b", Classification: &Classification{Country: "US", UpdatedAt: c.UpdatedAt}, Lang: i18n.French})
+	assert.Equal([]string{
+		"classé US (source : non précisée, mis à jour le 1er mars 2025)",
+		"US n'est pas diffusé sur le flux souverain (diffusés : aucun)",
+	}, s.Reasons)
+}
+
+// BenchmarkTableParallel looks up accounts from many goroutines, as the firehose fanout does for every event, with one in a hundred operations classifying an account.
+func BenchmarkTableParallel(b *testing.B) {
+	const n = 100_000
+	tbl := NewTable()
+	dids := make([]string, n)
+	for i := range dids {
+		dids[i] = fmt.Sprintf("did:plc:%024d", i)
+		tbl.Set(Classification{DID: dids[i], Country: "CA"})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Intn(n)
+		for pb.Next() {
+			i = (i + 7919) % n
+			if i%100 == 0 {
+				tbl.Set(Classification{DID: dids[i], Country: "CA"})
+			} else {
+				tbl.Get(dids[i])
+			}
+		}
+	})
+}
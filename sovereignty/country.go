@@ -0,0 +1,246 @@
+package sovereignty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Confidence is how sure a resolver is of the country it attributed an account to
+type Confidence int
+
+const (
+	ConfidenceNone Confidence = iota
+	// a weak signal, such as the country-code TLD of the account's PDS
+	ConfidenceLow
+	// a signal from the account's infrastructure, such as where its PDS is hosted
+	ConfidenceMedium
+	// an authoritative signal, such as a declaration by the account or its organization
+	ConfidenceHigh
+)
+
+var confidenceNames = []string{"none", "low", "medium", "high"}
+
+func (c Confidence) String() string {
+	if c < 0 || int(c) >= len(confidenceNames) {
+		return fmt.Sprintf("confidence(%d)", int(c))
+	}
+	return confidenceNames[c]
+}
+
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Confidence) UnmarshalText(b []byte) error {
+	v, err := ParseConfidence(string(b))
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+// ParseConfidence parses a confidence level by name (none, low, medium or high)
+func ParseConfidence(s string) (Confidence, error) {
+	for i, name := range confidenceNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return Confidence(i), nil
+		}
+	}
+	return ConfidenceNone, fmt.Errorf("invalid confidence level: %q", s)
+}
+
+// ErrCountryUnknown is returned by resolvers with no answer for an account
+var ErrCountryUnknown = errors.New("country could not be determined")
+
+// CountryResolver attributes an account to a country. The country is an ISO 3166-1 alpha-2 code, or an ISO 3166-2 subdivision code (eg, "CA-QC") when the resolver knows the account's subdivision; accounts the resolver has no answer for return an error wrapping ErrCountryUnknown.
+type CountryResolver interface {
+	ResolveCountry(ctx context.Context, did string) (string, Confidence, error)
+}
+
+// CountryResolverFunc adapts a function to the CountryResolver interface.
+type CountryResolverFunc func(ctx context.Context, did string) (string, Confidence, error)
+
+func (f CountryResolverFunc) ResolveCountry(ctx context.Context, did string) (string, Confidence, error) {
+	return f(ctx, did)
+}
+
+// Resolution is a resolver's answer for an account, and the signal it came from
+type Resolution struct {
+	DID     string `json:"did"`
+	Country string `json:"country"`
+	// ISO 3166-2 subdivision within Country, unprefixed (eg, "QC"); empty if unknown
+	Subdivision string     `json:"subdivision,omitempty"`
+	Confidence  Confidence `json:"confidence"`
+	// recorded as the classification's source
+	Source string `json:"source"`
+}
+
+// Region returns the answer's country, or its ISO 3166-2 subdivision code if the subdivision is known (eg, "CA-QC").
+func (r *Resolution) Region() string {
+	return Classification{Country: r.Country, Subdivision: r.Subdivision}.Region()
+}
+
+// SourceResolver is implemented by resolvers which can say which of their signals an answer came from
+type SourceResolver interface {
+	ResolveCountrySource(ctx context.Context, did string) (*Resolution, error)
+}
+
+// Resolve asks r about the account, with the answer's source if r reports one. Otherwise the source is fallback. The country and subdivision are returned normalized; resolvers may answer with an ISO 3166-2 subdivision code (eg, "CA-QC") in place of the country, when they know the subdivision.
+func Resolve(ctx context.Context, r CountryResolver, did, fallback string) (*Resolution, error) {
+	var res *Resolution
+	if sr, ok := r.(SourceResolver); ok {
+		var err error
+		res, err = sr.ResolveCountrySource(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		country, conf, err := r.ResolveCountry(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+		res = &Resolution{DID: did, Country: country, Confidence: conf}
+	}
+	if res.Source == "" {
+		res.Source = fallback
+	}
+	country, sub, err := ParseRegion(res.Country)
+	if err != nil {
+		return nil, err
+	}
+	if sub == "" {
+		sub, err = NormalizeSubdivision(country, res.Subdivision)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.Country, res.Subdivision = country, sub
+	return res, nil
+}
+
+// ResolverLink is one resolver in a chain
+type ResolverLink struct {
+	// the source recorded for its answers, unless the resolver reports its own
+	Name     string
+	Resolver CountryResolver
+}
+
+// ChainedResolver asks each of its resolvers in turn, stopping at the first answer with at least StopAt confidence. Failing that, the most confident answer is returned, the earliest in the chain winning ties. Errors from individual resolvers don't stop the chain; they are only returned if no resolver has an answer.
+type ChainedResolver struct {
+	Links  []ResolverLink
+	StopAt Confidence
+}
+
+func (cr *ChainedResolver) ResolveCountry(ctx context.Context, did string) (string, Confidence, error) {
+	res, err := cr.ResolveCountrySource(ctx, did)
+	if err != nil {
+		return "", ConfidenceNone, err
+	}
+	return res.Region(), res.Confidence, nil
+}
+
+func (cr *ChainedResolver) ResolveCountrySource(ctx context.Context, did string) (*Resolution, error) {
+	var best *Resolution
+	var errs []error
+	for _, l := range cr.Links {
+		res, err := Resolve(ctx, l.Resolver, did, l.Name)
+		if err != nil {
+			if !errors.Is(err, ErrCountryUnknown) {
+				errs = append(errs, fmt.Errorf("%s: %w", l.Name, err))
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if best == nil || res.Confidence > best.Confidence {
+			best = res
+		}
+		if res.Confidence >= cr.StopAt {
+			break
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(append([]error{ErrCountryUnknown}, errs...)...)
+	}
+	return nil, ErrCountryUnknown
+}
+
+// HTTPCountryResolver asks an external service, with a GET request to URL with the account's DID in the "did" query parameter. The service responds with JSON: {"country": "CA", "confidence": "medium"}, and an optional "subdivision" (eg, "QC") and "source"; a 404 means it has no answer.
+type HTTPCountryResolver struct {
+	URL    string
+	Client *http.Client
+	// optional extra headers (eg, "Authorization") to include in every request
+	Headers map[string]string
+}
+
+type httpCountryAnswer struct {
+	Country     string `json:"country"`
+	Subdivision string `json:"subdivision"`
+	Confidence  string `json:"confidence"`
+	Source      string `json:"source"`
+}
+
+func (hr *HTTPCountryResolver) ResolveCountry(ctx context.Context, did string) (string, Confidence, error) {
+	res, err := hr.ResolveCountrySource(ctx, did)
+	if err != nil {
+		return "", ConfidenceNone, err
+	}
+	return res.Region(), res.Confidence, nil
+}
+
+func (hr *HTTPCountryResolver) ResolveCountrySource(ctx context.Context, did string) (*Resolution, error) {
+	u, err := url.Parse(hr.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("did", did)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range hr.Headers {
+		req.Header.Set(k, v)
+	}
+	client := hr.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrCountryUnknown, did)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("country resolver: HTTP %d", resp.StatusCode)
+	}
+
+	var ans httpCountryAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&ans); err != nil {
+		return nil, fmt.Errorf("country resolver: %w", err)
+	}
+	if ans.Country == "" {
+		return nil, fmt.Errorf("%w: %s", ErrCountryUnknown, did)
+	}
+	conf, err := ParseConfidence(ans.Confidence)
+	if err != nil {
+		return nil, fmt.Errorf("country resolver: %w", err)
+	}
+	return &Resolution{DID: did, Country: ans.Country, Subdivision: ans.Subdivision, Confidence: conf, Source: ans.Source}, nil
+}
@@ -0,0 +1,147 @@
+package sovereignty
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixedResolver(country string, conf Confidence, calls *int) CountryResolver {
+	return CountryResolverFunc(func(ctx context.Context, did string) (string, Confidence, error) {
+		*calls++
+		if country == "" {
+			return "", ConfidenceNone, fmt.Errorf("%w: %s", ErrCountryUnknown, did)
+		}
+		return country, conf, nil
+	})
+}
+
+func TestChainedResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var a, b, c int
+	cr := &ChainedResolver{
+		Links: []ResolverLink{
+			{Name: "a", Resolver: fixedResolver("", ConfidenceNone, &a)},
+			{Name: "b", Resolver: fixedResolver("fr", ConfidenceLow, &b)},
+			{Name: "c", Resolver: fixedResolver("CA", ConfidenceMedium, &c)},
+		},
+		StopAt: ConfidenceMedium,
+	}
+	res, err := Resolve(ctx, cr, "did:plc:aaaa", "fallback")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal(ConfidenceMedium, res.Confidence)
+	assert.Equal("c", res.Source)
+	assert.Equal([]int{1, 1, 1}, []int{a, b, c})
+
+	// stops at the first confident enough answer
+	cr.StopAt = ConfidenceLow
+	res, err = Resolve(ctx, cr, "did:plc:aaaa", "fallback")
+	assert.NoError(err)
+	assert.Equal("FR", res.Country)
+	assert.Equal("b", res.Source)
+	assert.Equal(1, c)
+
+	// otherwise the most confident
+	cr.StopAt = ConfidenceHigh
+	res, err = Resolve(ctx, cr, "did:plc:aaaa", "fallback")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+
+	// errors only surface without an answer
+	cr.Links = []ResolverLink{
+		{Name: "broken", Resolver: CountryResolverFunc(func(ctx context.Context, did string) (string, Confidence, error) {
+			return "", ConfidenceNone, fmt.Errorf("connection refused")
+		})},
+		{Name: "a", Resolver: fixedResolver("", ConfidenceNone, &a)},
+	}
+	_, _, err = cr.ResolveCountry(ctx, "did:plc:aaaa")
+	assert.ErrorIs(err, ErrCountryUnknown)
+	assert.ErrorContains(err, "broken: connection refused")
+
+	cr.Links = append(cr.Links, ResolverLink{Name: "b", Resolver: fixedResolver("FR", ConfidenceLow, &b)})
+	country, conf, err := cr.ResolveCountry(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("FR", country)
+	assert.Equal(ConfidenceLow, conf)
+
+	// resolvers can answer with a subdivision
+	res, err = Resolve(ctx, fixedResolver("ca-qc", ConfidenceMedium, &a), "did:plc:aaaa", "fallback")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal("QC", res.Subdivision)
+	assert.Equal("CA-QC", res.Region())
+
+	// answers which aren't countries are errors
+	_, err = Resolve(ctx, fixedResolver("Canada", ConfidenceHigh, &a), "did:plc:aaaa", "fallback")
+	assert.Error(err)
+}
+
+func TestHTTPCountryResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("did") {
+		case "did:plc:aaaa":
+			fmt.Fprint(w, `{"country": "ca", "confidence": "high", "source": "declared"}`)
+		case "did:plc:qqqq":
+			fmt.Fprint(w, `{"country": "CA", "subdivision": "qc", "confidence": "medium"}`)
+		case "did:plc:bbbb":
+			fmt.Fprint(w, `{"country": "DE", "confidence": "low"}`)
+		case "did:plc:cccc":
+			fmt.Fprint(w, `{"country": "DE", "confidence": "certain"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	hr := &HTTPCountryResolver{URL: srv.URL + "/resolve?v=1", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	res, err := Resolve(ctx, hr, "did:plc:aaaa", "external")
+	assert.NoError(err)
+	assert.Equal(&Resolution{DID: "did:plc:aaaa", Country: "CA", Confidence: ConfidenceHigh, Source: "declared"}, res)
+
+	res, err = Resolve(ctx, hr, "did:plc:qqqq", "external")
+	assert.NoError(err)
+	assert.Equal("QC", res.Subdivision)
+
+	res, err = Resolve(ctx, hr, "did:plc:bbbb", "external")
+	assert.NoError(err)
+	assert.Equal(ConfidenceLow, res.Confidence)
+	assert.Equal("external", res.Source)
+
+	_, err = Resolve(ctx, hr, "did:plc:cccc", "external")
+	assert.Error(err)
+	assert.NotErrorIs(err, ErrCountryUnknown)
+
+	_, err = Resolve(ctx, hr, "did:plc:zzzz", "external")
+	assert.ErrorIs(err, ErrCountryUnknown)
+
+	hr.Headers = nil
+	_, err = Resolve(ctx, hr, "did:plc:aaaa", "external")
+	assert.ErrorContains(err, "HTTP 401")
+}
+
+func TestConfidenceText(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := ConfidenceMedium.MarshalText()
+	assert.NoError(err)
+	assert.Equal("medium", string(b))
+
+	var c Confidence
+	assert.NoError(c.UnmarshalText([]byte("High")))
+	assert.Equal(ConfidenceHigh, c)
+	assert.Error(c.UnmarshalText([]byte("very")))
+}
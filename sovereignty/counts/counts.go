@@ -0,0 +1,86 @@
+package counts
+
+import (
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Kinds of interaction which are counted.
+const (
+	KindLike   = "like"
+	KindRepost = "repost"
+	KindReply  = "reply"
+)
+
+// Interaction is a record which counts towards a subject's counters.
+type Interaction struct {
+	// AT-URI of the interaction record itself
+	URI    string `gorm:"primarykey"`
+	Author string `gorm:"index"`
+	Kind   string
+	// AT-URI of the record being liked, reposted or replied to
+	Subject   string `gorm:"index"`
+	IndexedAt time.Time
+}
+
+// Count holds the counters for a subject record.
+type Count struct {
+	Subject string `gorm:"primarykey"`
+	Likes   int64
+	Reposts int64
+	Replies int64
+}
+
+// Get returns the counter for an interaction kind.
+func (c *Count) Get(kind string) int64 {
+	switch kind {
+	case KindLike:
+		return c.Likes
+	case KindRepost:
+		return c.Reposts
+	case KindReply:
+		return c.Replies
+	}
+	return 0
+}
+
+// counter columns by interaction kind
+var kindColumns = map[string]string{
+	KindLike:   "likes",
+	KindRepost: "reposts",
+	KindReply:  "replies",
+}
+
+// Derive returns the interaction represented by a record, or nil if the record doesn't count towards anything.
+func Derive(uri syntax.ATURI, rec any) *Interaction {
+	author := uri.Authority().String()
+	var kind, subject string
+	switch r := rec.(type) {
+	case *appbsky.FeedLike:
+		if r.Subject != nil {
+			kind, subject = KindLike, r.Subject.Uri
+		}
+	case *appbsky.FeedRepost:
+		if r.Subject != nil {
+			kind, subject = KindRepost, r.Subject.Uri
+		}
+	case *appbsky.FeedPost:
+		if r.Reply != nil && r.Reply.Parent != nil {
+			kind, subject = KindReply, r.Reply.Parent.Uri
+		}
+	}
+	if kind == "" {
+		return nil
+	}
+	if _, err := syntax.ParseATURI(subject); err != nil {
+		return nil
+	}
+	return &Interaction{
+		URI:     uri.String(),
+		Author:  author,
+		Kind:    kind,
+		Subject: subject,
+	}
+}
@@ -0,0 +1,208 @@
+package counts
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	alice = "did:plc:alice"
+	bob   = "did:plc:bob"
+
+	post1 = "at://did:plc:carol/app.bsky.feed.post/1"
+	post2 = "at://did:plc:carol/app.bsky.feed.post/2"
+)
+
+func testStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "counts.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func like(author, rkey, subject string) *Interaction {
+	return &Interaction{URI: "at://" + author + "/app.bsky.feed.like/" + rkey, Author: author, Kind: KindLike, Subject: subject}
+}
+
+func TestDerive(t *testing.T) {
+	assert := assert.New(t)
+
+	it := Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.repost/1"), &appbsky.FeedRepost{Subject: &comatproto.RepoStrongRef{Uri: post1}})
+	assert.Equal(&Interaction{URI: "at://" + alice + "/app.bsky.feed.repost/1", Author: alice, Kind: KindRepost, Subject: post1}, it)
+
+	it = Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.post/1"), &appbsky.FeedPost{Reply: &appbsky.FeedPost_ReplyRef{
+		Parent: &comatproto.RepoStrongRef{Uri: post2},
+		Root:   &comatproto.RepoStrongRef{Uri: post1},
+	}})
+	assert.Equal(KindReply, it.Kind)
+	assert.Equal(post2, it.Subject)
+
+	assert.Nil(Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.post/1"), &appbsky.FeedPost{Text: "hello"}))
+	assert.Nil(Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.like/1"), &appbsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "invalid"}}))
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := testStore(t)
+
+	for _, it := range []*Interaction{like(alice, "1", post1), like(bob, "1", post1), like(alice, "2", post2)} {
+		ok, err := store.Add(ctx, it)
+		assert.NoError(err)
+		assert.True(ok)
+	}
+	// replays are ignored
+	ok, err := store.Add(ctx, like(alice, "1", post1))
+	assert.NoError(err)
+	assert.False(ok)
+
+	counts, err := store.Get(ctx, []string{post1, post2})
+	assert.NoError(err)
+	assert.Equal(int64(2), counts[post1].Likes)
+	assert.Equal(int64(1), counts[post2].Likes)
+
+	ok, err = store.Delete(ctx, like(bob, "1", post1).URI)
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = store.Delete(ctx, like(bob, "1", post1).URI)
+	assert.NoError(err)
+	assert.False(ok)
+	counts, err = store.Get(ctx, []string{post1})
+	assert.NoError(err)
+	assert.Equal(int64(1), counts[post1].Likes)
+
+	// counters which have drifted are repaired by a recount
+	assert.NoError(store.db.Model(&Count{}).Where("subject = ?", post1).Update("likes", 7).Error)
+	drift, err := store.Recount(ctx, []string{post1, post2})
+	assert.NoError(err)
+	assert.Equal([]Drift{{Subject: post1, Kind: KindLike, Stored: 7, Actual: 1}}, drift)
+	drift, err = store.Recount(ctx, []string{post1, post2})
+	assert.NoError(err)
+	assert.Empty(drift)
+
+	assert.NoError(store.DeleteAuthor(ctx, alice))
+	counts, err = store.Get(ctx, []string{post1, post2})
+	assert.NoError(err)
+	assert.Empty(counts)
+
+	seq, err := store.Cursor(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(0), seq)
+	assert.NoError(store.SaveCursor(ctx, 42))
+	seq, err = store.Cursor(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(42), seq)
+}
+
+// testRepoCar builds a repository export containing likes of the given subjects
+func testRepoCar(t *testing.T, did string, likes map[string]string) []byte {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := repo.NewRepo(ctx, did, bs)
+	for rkey, subject := range likes {
+		_, err := r.PutRecord(ctx, "app.bsky.feed.like/"+rkey, &appbsky.FeedLike{
+			CreatedAt: "2024-01-01T00:00:00Z",
+			Subject:   &comatproto.RepoStrongRef{Uri: subject, Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	kmgr := &util.FakeKeyManager{}
+	root, _, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range keys {
+		blk, err := bs.Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the blockstore only keeps multihashes, and repo blocks are all dag-cbor
+		c := cid.NewCidV1(cid.DagCBOR, k.Hash())
+		if err := carutil.LdWrite(&buf, c.Bytes(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReconcileAccount(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := testStore(t)
+
+	// the stream missed the creation of like 2 and the deletion of like 3
+	mirror := testRepoCar(t, alice, map[string]string{"1": post1, "2": post2})
+	old := time.Now().Add(-time.Hour)
+	for _, it := range []*Interaction{like(alice, "1", post1), like(alice, "3", post1)} {
+		it.IndexedAt = old
+		_, err := store.Add(ctx, it)
+		assert.NoError(err)
+	}
+
+	rec := NewReconciler(store, func(ctx context.Context, did string) ([]byte, error) {
+		return mirror, nil
+	}, slog.Default())
+	added, removed, err := rec.ReconcileAccount(ctx, alice)
+	assert.NoError(err)
+	assert.Equal(1, added)
+	assert.Equal(1, removed)
+
+	counts, err := store.Get(ctx, []string{post1, post2})
+	assert.NoError(err)
+	assert.Equal(int64(1), counts[post1].Likes)
+	assert.Equal(int64(1), counts[post2].Likes)
+
+	// a second pass finds nothing to repair
+	assert.NoError(rec.Pass(ctx))
+	added, removed, err = rec.ReconcileAccount(ctx, alice)
+	assert.NoError(err)
+	assert.Zero(added)
+	assert.Zero(removed)
+
+	// the mirror doesn't have interactions newer than the fetch
+	fresh := like(alice, "4", post2)
+	fresh.IndexedAt = time.Now().Add(time.Minute)
+	_, err = store.Add(ctx, fresh)
+	assert.NoError(err)
+	_, removed, err = rec.ReconcileAccount(ctx, alice)
+	assert.NoError(err)
+	assert.Zero(removed)
+
+	_, _, err = rec.ReconcileAccount(ctx, bob)
+	assert.Error(err)
+}
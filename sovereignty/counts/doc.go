@@ -0,0 +1,4 @@
+// Interaction counts for the sovereign AppView.
+//
+// The counts service consumes the relay's filtered sovereign stream and maintains like, repost and reply counters per subject record, alongside a table of the interaction records themselves. Counters can drift from reality when events are missed (eg, during an outage longer than the stream's replay window), so a Reconciler periodically re-reads authors' repositories from the relay's repo mirror to repair the interaction table, and recounts counters from it, reporting the magnitude of any drift it finds as metrics. Counts are served by cmd/countd.
+package counts
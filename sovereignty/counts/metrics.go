@@ -0,0 +1,32 @@
+package counts
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var counterDrift = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "counts_reconcile_counter_drift",
+	Help:    "Absolute difference between stored and recounted counters, for counters which had drifted",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+}, []string{"kind"})
+
+var countersRepaired = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "counts_reconcile_counters_repaired_total",
+	Help: "Number of counters overwritten by reconciliation",
+}, []string{"kind"})
+
+var mirrorDrift = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "counts_reconcile_mirror_drift_total",
+	Help: "Number of interaction records found missing from (or extra in) the interaction table when compared with the repo mirror",
+}, []string{"direction"})
+
+var accountsReconciled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "counts_reconcile_accounts_total",
+	Help: "Number of accounts compared with the repo mirror, by result",
+}, []string{"result"})
+
+var subjectsRecounted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "counts_reconcile_subjects_recounted_total",
+	Help: "Number of subjects whose counters were recounted",
+})
@@ -0,0 +1,214 @@
+package counts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/repo"
+
+	"github.com/ipfs/go-cid"
+)
+
+// FetchRepo returns a full repository export (CAR file) for an account, eg from the relay's com.atproto.sync.getRepo.
+type FetchRepo func(ctx context.Context, did string) ([]byte, error)
+
+// Reconciler repairs drift between the Store and the repo mirror. Each pass compares a batch of authors' interactions with their repositories, then recounts a batch of subjects; successive passes work through all authors and subjects in turn.
+//
+// The repo mirror and the stream are not read at a single point in time, so a pass can race with stream events. Interactions recorded after a repository was fetched are never removed, and any other mistake is corrected by a later pass.
+type Reconciler struct {
+	Store  *Store
+	Fetch  FetchRepo
+	Logger *slog.Logger
+	// authors compared with the mirror per pass
+	AccountBatch int
+	// subjects recounted per pass
+	SubjectBatch int
+
+	// round-robin positions
+	lastAuthor  string
+	lastSubject string
+}
+
+func NewReconciler(store *Store, fetch FetchRepo, logger *slog.Logger) *Reconciler {
+	return &Reconciler{
+		Store:        store,
+		Fetch:        fetch,
+		Logger:       logger,
+		AccountBatch: 100,
+		SubjectBatch: 5000,
+	}
+}
+
+// ReconcileAccount compares an account's recorded interactions with its repository in the mirror, recording any which are missing and removing any which no longer exist. Counters of affected subjects are adjusted along the way.
+func (r *Reconciler) ReconcileAccount(ctx context.Context, did string) (added, removed int, err error) {
+	fetchedAt := time.Now().UTC()
+	b, err := r.Fetch(ctx, did)
+	if err != nil {
+		return 0, 0, fmt.Errorf("fetching repo from mirror: %w", err)
+	}
+	mirrored, err := repoInteractions(ctx, did, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	stored, err := r.Store.AuthorInteractions(ctx, did)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, it := range stored {
+		if _, ok := mirrored[it.URI]; ok {
+			delete(mirrored, it.URI)
+			continue
+		}
+		if it.IndexedAt.After(fetchedAt) {
+			continue
+		}
+		ok, err := r.Store.Delete(ctx, it.URI)
+		if err != nil {
+			return added, removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+	for _, it := range mirrored {
+		it.IndexedAt = fetchedAt
+		ok, err := r.Store.Add(ctx, it)
+		if err != nil {
+			return added, removed, err
+		}
+		if ok {
+			added++
+		}
+	}
+	mirrorDrift.WithLabelValues("missing").Add(float64(added))
+	mirrorDrift.WithLabelValues("extra").Add(float64(removed))
+	return added, removed, nil
+}
+
+// repoInteractions reads every interaction out of a repository export, keyed by AT-URI
+func repoInteractions(ctx context.Context, did string, b []byte) (map[string]*Interaction, error) {
+	rr, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("reading repo from mirror: %w", err)
+	}
+	if rr.RepoDid() != did {
+		return nil, fmt.Errorf("mirror returned repo for %s, not %s", rr.RepoDid(), did)
+	}
+	out := make(map[string]*Interaction)
+	for coll := range countCollections {
+		var paths []string
+		err := rr.ForEach(ctx, coll, func(k string, _ cid.Cid) error {
+			paths = append(paths, k)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing %s records: %w", coll, err)
+		}
+		for _, path := range paths {
+			uri, err := syntax.ParseATURI("at://" + did + "/" + path)
+			if err != nil || uri.Collection().String() != coll {
+				continue
+			}
+			_, raw, err := rr.GetRecordBytes(ctx, path)
+			if err != nil {
+				return nil, fmt.Errorf("reading record %s: %w", path, err)
+			}
+			rec, err := lexutil.CborDecodeValue(*raw)
+			if err != nil {
+				continue
+			}
+			if it := Derive(uri, rec); it != nil {
+				out[it.URI] = it
+			}
+		}
+	}
+	return out, nil
+}
+
+// RecountNext recounts the next batch of subjects, returning the drift found.
+func (r *Reconciler) RecountNext(ctx context.Context) ([]Drift, error) {
+	subjects, err := r.Store.Subjects(ctx, r.lastSubject, r.SubjectBatch)
+	if err != nil {
+		return nil, err
+	}
+	if len(subjects) < r.SubjectBatch {
+		r.lastSubject = ""
+	} else {
+		r.lastSubject = subjects[len(subjects)-1]
+	}
+	drift, err := r.Store.Recount(ctx, subjects)
+	if err != nil {
+		return nil, err
+	}
+	subjectsRecounted.Add(float64(len(subjects)))
+	for _, d := range drift {
+		mag := d.Actual - d.Stored
+		if mag < 0 {
+			mag = -mag
+		}
+		counterDrift.WithLabelValues(d.Kind).Observe(float64(mag))
+		countersRepaired.WithLabelValues(d.Kind).Inc()
+	}
+	return drift, nil
+}
+
+// Pass runs one round of reconciliation: the next batch of accounts is compared with the mirror, then the next batch of subjects is recounted. Failures to fetch individual accounts are logged and skipped.
+func (r *Reconciler) Pass(ctx context.Context) error {
+	authors, err := r.Store.Authors(ctx, r.lastAuthor, r.AccountBatch)
+	if err != nil {
+		return err
+	}
+	if len(authors) < r.AccountBatch {
+		r.lastAuthor = ""
+	} else {
+		r.lastAuthor = authors[len(authors)-1]
+	}
+	for _, did := range authors {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		added, removed, err := r.ReconcileAccount(ctx, did)
+		if err != nil {
+			accountsReconciled.WithLabelValues("error").Inc()
+			r.Logger.Warn("failed to reconcile account with mirror", "did", did, "err", err)
+			continue
+		}
+		if added > 0 || removed > 0 {
+			accountsReconciled.WithLabelValues("repaired").Inc()
+			r.Logger.Info("repaired interactions from mirror", "did", did, "added", added, "removed", removed)
+		} else {
+			accountsReconciled.WithLabelValues("ok").Inc()
+		}
+	}
+
+	drift, err := r.RecountNext(ctx)
+	if err != nil {
+		return err
+	}
+	if len(drift) > 0 {
+		r.Logger.Info("repaired drifted counters", "count", len(drift))
+	}
+	return nil
+}
+
+// Run calls Pass at the given interval until the context is cancelled.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Pass(ctx); err != nil && ctx.Err() == nil {
+				r.Logger.Error("reconciliation pass failed", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package counts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StreamCursor is the last applied sovereign stream sequence number.
+type StreamCursor struct {
+	ID  uint `gorm:"primarykey"`
+	Seq int64
+}
+
+// Drift is a counter which didn't match a recount of the interaction table.
+type Drift struct {
+	Subject string
+	Kind    string
+	Stored  int64
+	Actual  int64
+}
+
+// Store persists interactions and counters in a SQL database. Counters are only changed in the same transaction as the interaction table, so they only drift from it through bugs or manual changes; Recount repairs them regardless.
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&Interaction{}, &Count{}, &StreamCursor{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Add records an interaction and increments its subject's counter. It returns false if the interaction was already recorded (eg, when the stream is replayed).
+func (s *Store) Add(ctx context.Context, it *Interaction) (bool, error) {
+	col, ok := kindColumns[it.Kind]
+	if !ok {
+		return false, fmt.Errorf("unknown interaction kind: %q", it.Kind)
+	}
+	var added bool
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(it)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		added = true
+		return tx.Model(&Count{}).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "subject"}},
+			DoUpdates: clause.Assignments(map[string]any{col: gorm.Expr("counts." + col + " + 1")}),
+		}).Create(map[string]any{"subject": it.Subject, col: 1}).Error
+	})
+	return added, err
+}
+
+// Delete removes an interaction and decrements its subject's counter. It returns false if the interaction wasn't recorded.
+func (s *Store) Delete(ctx context.Context, uri string) (bool, error) {
+	var deleted bool
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var it Interaction
+		err := tx.Where("uri = ?", uri).Take(&it).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&it).Error; err != nil {
+			return err
+		}
+		deleted = true
+		col, ok := kindColumns[it.Kind]
+		if !ok {
+			return nil
+		}
+		return tx.Model(&Count{}).Where("subject = ? AND "+col+" > 0", it.Subject).Update(col, gorm.Expr(col+" - 1")).Error
+	})
+	return deleted, err
+}
+
+// DeleteAuthor removes all of an account's interactions, when it is deleted, and recounts the affected subjects.
+func (s *Store) DeleteAuthor(ctx context.Context, did string) error {
+	var subjects []string
+	if err := s.db.WithContext(ctx).Model(&Interaction{}).Where("author = ?", did).Distinct().Pluck("subject", &subjects).Error; err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Where("author = ?", did).Delete(&Interaction{}).Error; err != nil {
+		return err
+	}
+	_, err := s.Recount(ctx, subjects)
+	return err
+}
+
+// Get returns the counters for the given subjects. Subjects without any interactions are left out.
+func (s *Store) Get(ctx context.Context, subjects []string) (map[string]Count, error) {
+	var rows []Count
+	if err := s.db.WithContext(ctx).Where("subject IN ?", subjects).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]Count, len(rows))
+	for _, r := range rows {
+		out[r.Subject] = r
+	}
+	return out, nil
+}
+
+// AuthorInteractions returns all of an account's recorded interactions.
+func (s *Store) AuthorInteractions(ctx context.Context, did string) ([]Interaction, error) {
+	var out []Interaction
+	err := s.db.WithContext(ctx).Where("author = ?", did).Find(&out).Error
+	return out, err
+}
+
+// Authors returns a page of accounts with recorded interactions, in DID order, starting after the given DID.
+func (s *Store) Authors(ctx context.Context, after string, limit int) ([]string, error) {
+	var out []string
+	err := s.db.WithContext(ctx).Model(&Interaction{}).Where("author > ?", after).Distinct().Order("author").Limit(limit).Pluck("author", &out).Error
+	return out, err
+}
+
+// Subjects returns a page of subjects with counters, in order, starting after the given subject.
+func (s *Store) Subjects(ctx context.Context, after string, limit int) ([]string, error) {
+	var out []string
+	err := s.db.WithContext(ctx).Model(&Count{}).Where("subject > ?", after).Order("subject").Limit(limit).Pluck("subject", &out).Error
+	return out, err
+}
+
+// Recount recomputes the counters of the given subjects from the interaction table, overwriting any which differ, and returns the differences found.
+func (s *Store) Recount(ctx context.Context, subjects []string) ([]Drift, error) {
+	if len(subjects) == 0 {
+		return nil, nil
+	}
+	var drift []Drift
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tallies []struct {
+			Subject string
+			Kind    string
+			N       int64
+		}
+		if err := tx.Model(&Interaction{}).Select("subject, kind, count(*) AS n").Where("subject IN ?", subjects).Group("subject, kind").Scan(&tallies).Error; err != nil {
+			return err
+		}
+		actual := make(map[string]*Count, len(subjects))
+		for _, subj := range subjects {
+			actual[subj] = &Count{Subject: subj}
+		}
+		for _, t := range tallies {
+			c := actual[t.Subject]
+			switch t.Kind {
+			case KindLike:
+				c.Likes = t.N
+			case KindRepost:
+				c.Reposts = t.N
+			case KindReply:
+				c.Replies = t.N
+			}
+		}
+
+		var stored []Count
+		if err := tx.Where("subject IN ?", subjects).Find(&stored).Error; err != nil {
+			return err
+		}
+		storedBySubject := make(map[string]Count, len(stored))
+		for _, c := range stored {
+			storedBySubject[c.Subject] = c
+		}
+
+		for _, subj := range subjects {
+			want := actual[subj]
+			have := storedBySubject[subj]
+			changed := false
+			for _, kind := range []string{KindLike, KindRepost, KindReply} {
+				if have.Get(kind) != want.Get(kind) {
+					drift = append(drift, Drift{Subject: subj, Kind: kind, Stored: have.Get(kind), Actual: want.Get(kind)})
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			if want.Likes == 0 && want.Reposts == 0 && want.Replies == 0 {
+				if err := tx.Where("subject = ?", subj).Delete(&Count{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Save(want).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return drift, err
+}
+
+// Cursor returns the last saved stream sequence number, or zero.
+func (s *Store) Cursor(ctx context.Context) (int64, error) {
+	var c StreamCursor
+	err := s.db.WithContext(ctx).Where("id = 1").Take(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return c.Seq, err
+}
+
+func (s *Store) SaveCursor(ctx context.Context, seq int64) error {
+	return s.db.WithContext(ctx).Save(&StreamCursor{ID: 1, Seq: seq}).Error
+}
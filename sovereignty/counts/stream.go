@@ -0,0 +1,132 @@
+package counts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+
+	"github.com/ipfs/go-cid"
+)
+
+// collections whose records can be interactions
+var countCollections = map[string]bool{
+	"app.bsky.feed.like":   true,
+	"app.bsky.feed.post":   true,
+	"app.bsky.feed.repost": true,
+}
+
+// Service maintains counters from the sovereign stream in a Store.
+type Service struct {
+	Store *Store
+
+	seq atomic.Int64
+}
+
+func NewService(store *Store) *Service {
+	return &Service{Store: store}
+}
+
+// Seq returns the sequence number of the last event counted, as saved by SaveCursor.
+func (s *Service) Seq() int64 {
+	return s.seq.Load()
+}
+
+// LoadCursor restores the stream position from the store.
+func (s *Service) LoadCursor(ctx context.Context) error {
+	seq, err := s.Store.Cursor(ctx)
+	if err != nil {
+		return err
+	}
+	s.seq.Store(seq)
+	return nil
+}
+
+// SaveCursor persists the current stream position.
+func (s *Service) SaveCursor(ctx context.Context) error {
+	return s.Store.SaveCursor(ctx, s.seq.Load())
+}
+
+// HandleEvent applies a stream event. It has the signature of a stream scheduler handler.
+func (s *Service) HandleEvent(ctx context.Context, evt *events.XRPCStreamEvent) error {
+	switch {
+	case evt.RepoCommit != nil:
+		if err := s.ObserveCommit(ctx, evt.RepoCommit); err != nil {
+			return err
+		}
+		s.seq.Store(evt.RepoCommit.Seq)
+	case evt.RepoAccount != nil:
+		acc := evt.RepoAccount
+		if !acc.Active && acc.Status != nil && *acc.Status == "deleted" {
+			if err := s.Store.DeleteAuthor(ctx, acc.Did); err != nil {
+				return err
+			}
+		}
+		s.seq.Store(acc.Seq)
+	case evt.RepoIdentity != nil:
+		s.seq.Store(evt.RepoIdentity.Seq)
+	case evt.RepoSync != nil:
+		s.seq.Store(evt.RepoSync.Seq)
+	}
+	return nil
+}
+
+// ObserveCommit records interactions created in a commit, and removes deleted ones. Record updates are ignored, as interactions can't change subject.
+func (s *Service) ObserveCommit(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit) error {
+	var blocks map[cid.Cid][]byte
+	now := time.Now().UTC()
+	for _, op := range commit.Ops {
+		coll, rkey, ok := strings.Cut(op.Path, "/")
+		if !ok || !countCollections[coll] {
+			continue
+		}
+		uri, err := syntax.ParseATURI(fmt.Sprintf("at://%s/%s/%s", commit.Repo, coll, rkey))
+		if err != nil {
+			continue
+		}
+		switch op.Action {
+		case "delete":
+			if _, err := s.Store.Delete(ctx, uri.String()); err != nil {
+				return err
+			}
+			continue
+		case "create":
+		default:
+			continue
+		}
+		if op.Cid == nil {
+			continue
+		}
+		if blocks == nil {
+			blocks, err = follower.ReadBlocks(commit.Blocks)
+			if err != nil {
+				return err
+			}
+		}
+		raw, ok := blocks[cid.Cid(*op.Cid)]
+		if !ok {
+			return fmt.Errorf("record block missing from commit: %s", op.Path)
+		}
+		rec, err := lexutil.CborDecodeValue(raw)
+		if err != nil {
+			// an undecodable record can't be counted, and skipping it keeps the counters moving
+			continue
+		}
+		it := Derive(uri, rec)
+		if it == nil {
+			continue
+		}
+		it.IndexedAt = now
+		if _, err := s.Store.Add(ctx, it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
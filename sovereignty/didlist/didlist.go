@@ -0,0 +1,110 @@
+package didlist
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Load reads a set of DIDs from a list.
+func Load(r io.Reader) (map[string]bool, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	dids := make(map[string]bool)
+	first := true
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw := strings.TrimSpace(rec[0])
+		if first && strings.EqualFold(raw, "did") {
+			first = false
+			continue
+		}
+		first = false
+		did, err := syntax.ParseDID(raw)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		dids[did.String()] = true
+	}
+	return dids, nil
+}
+
+// File is a list loaded from a file.
+type File struct {
+	path string
+
+	// serialises reloads
+	lk      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	dids atomic.Pointer[map[string]bool]
+}
+
+// Open loads the list in the file at path.
+func Open(path string) (*File, error) {
+	f := &File{path: path}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the list file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Reload reads the file again if it has changed (by modification time or size) since it was last loaded, and reports whether it did. If the new file can't be read, the previous list stays in use.
+func (f *File) Reload() (bool, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if f.dids.Load() != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return false, nil
+	}
+	r, err := os.Open(f.path)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	dids, err := Load(r)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.dids.Store(&dids)
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	return true, nil
+}
+
+// Contains returns true if the DID is on the list.
+func (f *File) Contains(did string) bool {
+	return (*f.dids.Load())[did]
+}
+
+// Len returns the number of DIDs on the list.
+func (f *File) Len() int {
+	return len(*f.dids.Load())
+}
@@ -0,0 +1,62 @@
+package didlist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dids, err := Load(strings.NewReader("did,note\n# comment\n\ndid:plc:aaa\ndid:web:example.com, ministry\n"))
+	assert.NoError(err)
+	assert.Equal(map[string]bool{"did:plc:aaa": true, "did:web:example.com": true}, dids)
+
+	_, err = Load(strings.NewReader("did:plc:aaa\nnot-a-did\n"))
+	assert.ErrorContains(err, "line 2")
+}
+
+func TestFileReload(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "in-country.csv")
+	write := func(s string, mtime time.Time) {
+		assert.NoError(os.WriteFile(path, []byte(s), 0644))
+		assert.NoError(os.Chtimes(path, mtime, mtime))
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	write("did:plc:aaa\n", start)
+	f, err := Open(path)
+	assert.NoError(err)
+	assert.True(f.Contains("did:plc:aaa"))
+	assert.Equal(1, f.Len())
+
+	reloaded, err := f.Reload()
+	assert.NoError(err)
+	assert.False(reloaded)
+
+	write("did:plc:aaa\ndid:plc:bbb\n", start.Add(time.Minute))
+	reloaded, err = f.Reload()
+	assert.NoError(err)
+	assert.True(reloaded)
+	assert.True(f.Contains("did:plc:bbb"))
+
+	// an invalid file keeps the previous list
+	write("did:plc:aaa\nbogus\n", start.Add(2*time.Minute))
+	_, err = f.Reload()
+	assert.Error(err)
+	assert.True(f.Contains("did:plc:bbb"))
+
+	assert.NoError(os.Remove(path))
+	_, err = f.Reload()
+	assert.Error(err)
+	assert.Equal(2, f.Len())
+
+	_, err = Open(path)
+	assert.Error(err)
+}
@@ -0,0 +1,4 @@
+// Operator-maintained lists of accounts, read from files which can be replaced while the relay runs.
+//
+// A list file holds one DID per line, optionally followed by further comma-separated columns (eg, a note), which are ignored. Blank lines, lines starting with '#', and a header row starting with "did" are skipped. A File remembers the modification time and size of the file it last loaded; Reload reads the file again when either has changed, keeping the previous list if the new file is missing or invalid.
+package didlist
@@ -0,0 +1,2 @@
+// Shared types and helpers for the relay's data sovereignty features: the DID classification table, and the artifacts derived from it.
+package sovereignty
@@ -0,0 +1,4 @@
+// Country-of-destination egress controls for the sovereign stream.
+//
+// Some record types may only be exported to certain countries. A Policy holds per-collection rules naming the countries whose subscribers (located by the GeoIP of their address) may receive those records in full; subscribers elsewhere, or whose address can't be located, get the commit with the records' blocks withheld, keeping the commit, tree nodes and op CIDs so they can still follow the repo. Collections no rule covers are sent in full to everyone.
+package egress
@@ -0,0 +1,107 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// Rule restricts where records of a collection may be sent in full.
+type Rule struct {
+	Name string `json:"name"`
+	// NSID of the collection this applies to; a trailing "*" matches any collection with that prefix
+	Collection string `json:"collection"`
+	// countries (ISO 3166-1 alpha-2) whose subscribers receive the records in full
+	Countries []string `json:"countries"`
+}
+
+// LoadRules reads a JSON array of rules from a file.
+func LoadRules(fname string) ([]Rule, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parsing egress rules: %w", err)
+	}
+	return rules, nil
+}
+
+type rule struct {
+	name       string
+	collection string
+	prefix     bool
+	countries  map[string]bool
+}
+
+func (r *rule) matches(collection string) bool {
+	if r.prefix {
+		return strings.HasPrefix(collection, r.collection)
+	}
+	return r.collection == collection
+}
+
+// Policy is a validated set of egress rules.
+type Policy struct {
+	rules []rule
+}
+
+// NewPolicy validates the rules.
+func NewPolicy(rules []Rule) (*Policy, error) {
+	p := &Policy{}
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("egress rule missing name")
+		}
+		if r.Collection == "" {
+			return nil, fmt.Errorf("egress rule %s: missing collection", r.Name)
+		}
+		cr := rule{name: r.Name, collection: r.Collection, countries: make(map[string]bool)}
+		if prefix, ok := strings.CutSuffix(r.Collection, "*"); ok {
+			cr.collection, cr.prefix = prefix, true
+		}
+		for _, c := range r.Countries {
+			country, err := sovereignty.NormalizeCountry(c)
+			if err != nil {
+				return nil, fmt.Errorf("egress rule %s: %w", r.Name, err)
+			}
+			cr.countries[country] = true
+		}
+		p.rules = append(p.rules, cr)
+	}
+	return p, nil
+}
+
+// For returns the restrictions on a subscriber in the country, or "" if its address couldn't be located. Returns nil if nothing is restricted for it.
+func (p *Policy) For(country string) *Restriction {
+	var out Restriction
+	for i := range p.rules {
+		if !p.rules[i].countries[country] || country == "" {
+			out.rules = append(out.rules, &p.rules[i])
+		}
+	}
+	if len(out.rules) == 0 {
+		return nil
+	}
+	return &out
+}
+
+// Restriction is the rules which withhold records from a subscriber.
+type Restriction struct {
+	rules []*rule
+}
+
+// Withheld returns the first rule withholding the record at path (collection/rkey) from the subscriber, if any does.
+func (r *Restriction) Withheld(path string) (string, bool) {
+	collection, _, _ := strings.Cut(path, "/")
+	for _, rl := range r.rules {
+		if rl.matches(collection) {
+			return rl.name, true
+		}
+	}
+	return "", false
+}
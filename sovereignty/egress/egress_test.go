@@ -0,0 +1,53 @@
+package egress
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "egress.json")
+	assert.NoError(os.WriteFile(fname, []byte(`[
+		{"name": "health", "collection": "ca.gander.health.*", "countries": ["ca"]},
+		{"name": "dms", "collection": "app.gndr.chat.message", "countries": ["CA", "FR"]}
+	]`), 0644))
+	rules, err := LoadRules(fname)
+	assert.NoError(err)
+	p, err := NewPolicy(rules)
+	assert.NoError(err)
+
+	// subscribers in an allowed country get everything in full
+	assert.Nil(p.For("CA"))
+
+	fr := p.For("FR")
+	if assert.NotNil(fr) {
+		rule, ok := fr.Withheld("ca.gander.health.record/3k")
+		assert.True(ok)
+		assert.Equal("health", rule)
+		_, ok = fr.Withheld("app.gndr.chat.message/3k")
+		assert.False(ok)
+		_, ok = fr.Withheld("app.gndr.feed.post/3k")
+		assert.False(ok)
+	}
+
+	// those nobody could locate get nothing restricted in full
+	unlocated := p.For("")
+	if assert.NotNil(unlocated) {
+		rule, ok := unlocated.Withheld("app.gndr.chat.message/3k")
+		assert.True(ok)
+		assert.Equal("dms", rule)
+	}
+
+	_, err = NewPolicy([]Rule{{Collection: "app.gndr.feed.post"}})
+	assert.Error(err)
+	_, err = NewPolicy([]Rule{{Name: "posts"}})
+	assert.Error(err)
+	_, err = NewPolicy([]Rule{{Name: "posts", Collection: "app.gndr.feed.post", Countries: []string{"Canada"}}})
+	assert.Error(err)
+}
@@ -0,0 +1,101 @@
+package enrich
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+const postCollection = "app.bsky.feed.post"
+
+// AnnotateEvent returns the event with the hashtags and links of each post added to its frame annotations. An existing annotation for the same record (eg, Indigenous languages) is extended rather than duplicated. Events without any hashtags or links are returned unchanged; otherwise a copy is returned with the annotations added to its (unsigned) FrameMeta. The input event is never mutated.
+func AnnotateEvent(evt *events.XRPCStreamEvent) (*events.XRPCStreamEvent, error) {
+	if evt.RepoCommit == nil {
+		return evt, nil
+	}
+	commit := evt.RepoCommit
+
+	want := make(map[cid.Cid]string)
+	for _, op := range commit.Ops {
+		if op.Cid != nil && strings.HasPrefix(op.Path, postCollection+"/") {
+			want[cid.Cid(*op.Cid)] = op.Path
+		}
+	}
+	if len(want) == 0 {
+		return evt, nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	found := make(map[string]Enrichment)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		path, ok := want[blk.Cid()]
+		if !ok {
+			continue
+		}
+		var post appbsky.FeedPost
+		if err := post.UnmarshalCBOR(bytes.NewReader(blk.RawData())); err != nil {
+			continue
+		}
+		if e := Post(&post); !e.Empty() {
+			found[path] = e
+		}
+	}
+	if len(found) == 0 {
+		return evt, nil
+	}
+
+	meta := &events.FrameMeta{
+		Repo: commit.Repo,
+		Seq:  commit.Seq,
+	}
+	if evt.Meta != nil {
+		*meta = *evt.Meta
+		meta.Sig = nil
+	}
+	annotations := append([]events.OpAnnotation{}, meta.Annotations...)
+	for i := range annotations {
+		if e, ok := found[annotations[i].Path]; ok {
+			setAnnotation(&annotations[i], e)
+			delete(found, annotations[i].Path)
+		}
+	}
+	// ops order, so the output is deterministic
+	for _, op := range commit.Ops {
+		if e, ok := found[op.Path]; ok {
+			ann := events.OpAnnotation{Path: op.Path}
+			setAnnotation(&ann, e)
+			annotations = append(annotations, ann)
+			delete(found, op.Path)
+		}
+	}
+	meta.Annotations = annotations
+
+	return &events.XRPCStreamEvent{
+		RepoCommit: commit,
+		Meta:       meta,
+		PrivUid:    evt.PrivUid,
+	}, nil
+}
+
+func setAnnotation(ann *events.OpAnnotation, e Enrichment) {
+	ann.Hashtags = e.Hashtags
+	ann.Links = e.URLs()
+	ann.CaDomains = e.CanadianDomains()
+}
@@ -0,0 +1,4 @@
+// Hashtag and link extraction from post records, for downstream analytics.
+//
+// Hashtags are collected from tag facets and the post's "tags" field, and normalized (Unicode NFC, lower case, without a leading '#'). Links are collected from link facets and external embeds, and normalized (lower case host without "www.", no fragment or tracking parameters); links to .ca domains are flagged. The results annotate the sovereign stream and populate search index fields.
+package enrich
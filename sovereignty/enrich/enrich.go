@@ -0,0 +1,152 @@
+package enrich
+
+import (
+	"net/url"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+
+	"github.com/PuerkitoBio/purell"
+	"golang.org/x/text/unicode/norm"
+)
+
+// query parameters which only identify where a link was shared from
+var trackingParams = []string{
+	"__s",
+	"_ga",
+	"fbclid",
+	"gclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"ref_src",
+	"si",
+	"utm_campaign",
+	"utm_content",
+	"utm_medium",
+	"utm_source",
+	"utm_term",
+}
+
+// Link is a normalized external URL referenced by a post.
+type Link struct {
+	URL    string `json:"url"`
+	Domain string `json:"domain"`
+	// the domain is under the .ca top-level domain
+	Canadian bool `json:"canadian,omitempty"`
+}
+
+// Enrichment is the hashtags and links extracted from a single post.
+type Enrichment struct {
+	Hashtags []string `json:"hashtags,omitempty"`
+	Links    []Link   `json:"links,omitempty"`
+}
+
+// Empty reports whether nothing was extracted.
+func (e *Enrichment) Empty() bool {
+	return len(e.Hashtags) == 0 && len(e.Links) == 0
+}
+
+// URLs returns the normalized link URLs.
+func (e *Enrichment) URLs() []string {
+	var out []string
+	for _, l := range e.Links {
+		out = append(out, l.URL)
+	}
+	return out
+}
+
+// CanadianDomains returns the distinct domains of links flagged as Canadian.
+func (e *Enrichment) CanadianDomains() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, l := range e.Links {
+		if l.Canadian && !seen[l.Domain] {
+			out = append(out, l.Domain)
+			seen[l.Domain] = true
+		}
+	}
+	return out
+}
+
+// Post extracts and normalizes the hashtags and links of a post record. Duplicates are removed, preserving the order of first appearance.
+func Post(post *appbsky.FeedPost) Enrichment {
+	var out Enrichment
+	seenTags := make(map[string]bool)
+	addTag := func(raw string) {
+		tag := NormalizeHashtag(raw)
+		if tag != "" && !seenTags[tag] {
+			out.Hashtags = append(out.Hashtags, tag)
+			seenTags[tag] = true
+		}
+	}
+	seenLinks := make(map[string]bool)
+	addLink := func(raw string) {
+		l, ok := NormalizeLink(raw)
+		if ok && !seenLinks[l.URL] {
+			out.Links = append(out.Links, l)
+			seenLinks[l.URL] = true
+		}
+	}
+
+	for _, facet := range post.Facets {
+		for _, feat := range facet.Features {
+			if feat.RichtextFacet_Tag != nil {
+				addTag(feat.RichtextFacet_Tag.Tag)
+			}
+			if feat.RichtextFacet_Link != nil {
+				addLink(feat.RichtextFacet_Link.Uri)
+			}
+		}
+	}
+	for _, tag := range post.Tags {
+		addTag(tag)
+	}
+	if post.Embed != nil {
+		if post.Embed.EmbedExternal != nil && post.Embed.EmbedExternal.External != nil {
+			addLink(post.Embed.EmbedExternal.External.Uri)
+		}
+		if rwm := post.Embed.EmbedRecordWithMedia; rwm != nil && rwm.Media != nil && rwm.Media.EmbedExternal != nil && rwm.Media.EmbedExternal.External != nil {
+			addLink(rwm.Media.EmbedExternal.External.Uri)
+		}
+	}
+	return out
+}
+
+// NormalizeHashtag returns the canonical form of a hashtag, or an empty string if there is nothing left of it.
+func NormalizeHashtag(raw string) string {
+	tag := strings.TrimSpace(raw)
+	tag = strings.TrimLeft(tag, "#＃")
+	return strings.ToLower(norm.NFC.String(tag))
+}
+
+// NormalizeLink returns the canonical form of an external http(s) URL. Other URLs (and unparseable ones) are rejected.
+func NormalizeLink(raw string) (Link, bool) {
+	clean, err := purell.NormalizeURLString(strings.TrimSpace(raw), purell.FlagsUsuallySafeGreedy|purell.FlagRemoveDirectoryIndex|purell.FlagRemoveFragment|purell.FlagRemoveDuplicateSlashes|purell.FlagRemoveWWW|purell.FlagSortQuery)
+	if err != nil {
+		return Link{}, false
+	}
+	u, err := url.Parse(clean)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return Link{}, false
+	}
+	if u.RawQuery != "" {
+		params := u.Query()
+		for _, p := range trackingParams {
+			params.Del(p)
+		}
+		u.RawQuery = params.Encode()
+	}
+	domain := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return Link{
+		URL:      u.String(),
+		Domain:   domain,
+		Canadian: IsCanadianDomain(domain),
+	}, true
+}
+
+// IsCanadianDomain reports whether the domain is under the .ca top-level domain.
+func IsCanadianDomain(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return strings.HasSuffix(domain, ".ca")
+}
@@ -0,0 +1,108 @@
+package enrich
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("canada", NormalizeHashtag("#Canada"))
+	assert.Equal("québec", NormalizeHashtag(" ＃QUÉBEC"))
+	assert.Equal("", NormalizeHashtag("##"))
+
+	l, ok := NormalizeLink("https://WWW.CBC.ca/news/?utm_source=x&id=2#top")
+	assert.True(ok)
+	assert.Equal("https://cbc.ca/news?id=2", l.URL)
+	assert.Equal("cbc.ca", l.Domain)
+	assert.True(l.Canadian)
+
+	l, ok = NormalizeLink("http://example.com/")
+	assert.True(ok)
+	assert.False(l.Canadian)
+
+	_, ok = NormalizeLink("at://did:plc:abc/app.bsky.feed.post/3k")
+	assert.False(ok)
+	_, ok = NormalizeLink("mailto:someone@example.ca")
+	assert.False(ok)
+
+	assert.True(IsCanadianDomain("gc.ca."))
+	assert.False(IsCanadianDomain("ca"))
+	assert.False(IsCanadianDomain("example.cat"))
+}
+
+func TestPost(t *testing.T) {
+	assert := assert.New(t)
+
+	post := &appbsky.FeedPost{
+		Text: "#Hockey night https://www.tsn.ca/nhl",
+		Tags: []string{"hockey", "NHL"},
+		Facets: []*appbsky.RichtextFacet{{
+			Features: []*appbsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Tag: &appbsky.RichtextFacet_Tag{Tag: "Hockey"}},
+				{RichtextFacet_Link: &appbsky.RichtextFacet_Link{Uri: "https://www.tsn.ca/nhl"}},
+			},
+		}},
+		Embed: &appbsky.FeedPost_Embed{
+			EmbedExternal: &appbsky.EmbedExternal{
+				External: &appbsky.EmbedExternal_External{Uri: "https://tsn.ca/nhl?fbclid=abc"},
+			},
+		},
+	}
+	e := Post(post)
+	assert.Equal([]string{"hockey", "nhl"}, e.Hashtags)
+	assert.Equal([]string{"https://tsn.ca/nhl"}, e.URLs())
+	assert.Equal([]string{"tsn.ca"}, e.CanadianDomains())
+
+	e = Post(&appbsky.FeedPost{Text: "nothing to see"})
+	assert.True(e.Empty())
+}
+
+func TestAnnotateEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	tag := cartest.NewBlock(t, &appbsky.FeedPost{Text: "go", Tags: []string{"Canada"}, CreatedAt: "2024-01-01T00:00:00Z"})
+	plain := cartest.NewBlock(t, &appbsky.FeedPost{Text: "plain", CreatedAt: "2024-01-01T00:00:00Z"})
+
+	orig := &events.XRPCStreamEvent{
+		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:abc",
+			Seq:    7,
+			Blocks: cartest.CAR(t, tag, plain),
+			Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+				{Action: "create", Path: "app.bsky.feed.post/3k", Cid: tag.Link()},
+				{Action: "create", Path: "app.bsky.feed.post/3l", Cid: plain.Link()},
+			},
+		},
+		// an existing language annotation for the same record
+		Meta: &events.FrameMeta{
+			Repo:        "did:plc:abc",
+			Seq:         7,
+			Annotations: []events.OpAnnotation{{Path: "app.bsky.feed.post/3k", Langs: []string{"iu"}}},
+			Sig:         []byte("stale"),
+		},
+		Preserialized: []byte("stale"),
+	}
+
+	out, err := AnnotateEvent(orig)
+	assert.NoError(err)
+	assert.Nil(out.Preserialized)
+	assert.Nil(out.Meta.Sig)
+	assert.Len(out.Meta.Annotations, 1)
+	assert.Equal([]string{"iu"}, out.Meta.Annotations[0].Langs)
+	assert.Equal([]string{"canada"}, out.Meta.Annotations[0].Hashtags)
+	assert.Nil(orig.Meta.Annotations[0].Hashtags)
+
+	// nothing to annotate
+	orig.RepoCommit.Ops = orig.RepoCommit.Ops[1:]
+	out, err = AnnotateEvent(orig)
+	assert.NoError(err)
+	assert.Same(orig, out)
+}
@@ -0,0 +1,6 @@
+// Stable, versioned JSON formats for the sovereignty artifacts the relay hands to downstream consumers: compliance reports, audit logs, and classifications.
+//
+// Each format is described by a JSON Schema document in the schema directory (also embedded, see Schema), named for the format and its Version. Fields are only ever added to a version of a format; renaming, removing, or changing the meaning of a field bumps Version, and the schemas of the previous version stay in place. The formats are pinned by golden files in testdata, so an accidental change fails the tests rather than reaching consumers.
+//
+// The signed classification snapshots published by the snapshot package are versioned by snapshot.FormatVersion, and their schemas live here too.
+package export
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"time"
+)
+
+// Version is bumped on any incompatible change to the formats in this package.
+const Version = 1
+
+// audit logs, by name
+const (
+	LogPriority   = "priority"
+	LogAppeals    = "appeals"
+	LogLegalHolds = "legal-holds"
+)
+
+// ValidLog returns true if name is one of the audit logs.
+func ValidLog(name string) bool {
+	switch name {
+	case LogPriority, LogAppeals, LogLegalHolds:
+		return true
+	default:
+		return false
+	}
+}
+
+// AuditEntry is a single entry of one of the relay's sovereignty audit logs.
+type AuditEntry struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// account the entry concerns, if any
+	DID string `json:"did,omitempty"`
+	// appeal or legal hold the entry concerns, in those logs
+	Subject uint   `json:"subject,omitempty"`
+	Action  string `json:"action"`
+	Actor   string `json:"actor,omitempty"`
+	Note    string `json:"note,omitempty"`
+	// priority account category, in the priority log
+	Category string `json:"category,omitempty"`
+	RemoteIP string `json:"remoteIp,omitempty"`
+}
+
+// AuditLog is a page of one audit log, newest entries first.
+type AuditLog struct {
+	Version     int          `json:"version"`
+	Log         string       `json:"log"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Entries     []AuditEntry `json:"entries"`
+}
+
+// NewAuditLog returns an empty page of the named log, generated at now.
+func NewAuditLog(log string, now time.Time) *AuditLog {
+	return &AuditLog{
+		Version:     Version,
+		Log:         log,
+		GeneratedAt: now.UTC(),
+		Entries:     []AuditEntry{},
+	}
+}
+
+// ClassificationCounts summarizes the relay's classification table.
+type ClassificationCounts struct {
+	Total int `json:"total"`
+	// accounts the sovereign stream carries by their classification
+	Carried int `json:"carried"`
+	// by country, or by subdivision (eg, "CA-QC") for accounts classified to one
+	ByRegion map[string]int `json:"byRegion"`
+	// by source, with "unspecified" for classifications without one
+	BySource map[string]int `json:"bySource"`
+}
+
+// Report is a compliance report: what the relay's sovereign stream carries, and the state of the records behind it, at a point in time.
+type Report struct {
+	Version     int       `json:"version"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	// version of the applied policy document; 0 if the relay runs on its configuration
+	PolicyVersion      int64                `json:"policyVersion"`
+	StreamCountries    []string             `json:"streamCountries"`
+	StreamSubdivisions []string             `json:"streamSubdivisions"`
+	Classifications    ClassificationCounts `json:"classifications"`
+	PriorityAccounts   int                  `json:"priorityAccounts"`
+	ActiveLegalHolds   int                  `json:"activeLegalHolds"`
+	// appeals by status
+	Appeals map[string]int `json:"appeals"`
+	// countries the stream leaves out, carrying all other accounts; absent unless it excludes countries
+	ExcludeCountries []string `json:"excludeCountries,omitempty"`
+}
+
+// NewReport returns an empty report generated at now.
+func NewReport(now time.Time) *Report {
+	return &Report{
+		Version:            Version,
+		GeneratedAt:        now.UTC(),
+		StreamCountries:    []string{},
+		StreamSubdivisions: []string{},
+		Classifications: ClassificationCounts{
+			ByRegion: map[string]int{},
+			BySource: map[string]int{},
+		},
+		Appeals: map[string]int{},
+	}
+}
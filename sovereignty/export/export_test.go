@@ -0,0 +1,118 @@
+package export
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// checkGolden compares the JSON encoding of v against a golden file, and validates it against the format's schema
+func checkGolden(t *testing.T, name, schema string, v any) {
+	t.Helper()
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, '\n')
+	path := filepath.Join("testdata", name+".json")
+	if *update {
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(golden), string(b), "%s changed; if intended, bump Version or only add fields, and rerun with -update", path)
+	assert.NoError(t, Validate(schema, Version, golden))
+}
+
+var fixtureTime = time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func TestAuditLogFormat(t *testing.T) {
+	log := NewAuditLog(LogLegalHolds, fixtureTime)
+	log.Entries = append(log.Entries,
+		AuditEntry{ID: 2, CreatedAt: fixtureTime.Add(-time.Hour), DID: "did:plc:held", Subject: 7, Action: "release", Actor: "counsel", RemoteIP: "192.0.2.1"},
+		AuditEntry{ID: 1, CreatedAt: fixtureTime.Add(-48 * time.Hour), DID: "did:plc:held", Subject: 7, Action: "place", Actor: "counsel", Note: "matter 2025-01"},
+	)
+	checkGolden(t, "audit-log", SchemaAuditLog, log)
+
+	prio := NewAuditLog(LogPriority, fixtureTime)
+	prio.Entries = append(prio.Entries, AuditEntry{ID: 1, CreatedAt: fixtureTime, DID: "did:plc:gov", Action: "add", Actor: "ops", Category: "government"})
+	checkGolden(t, "audit-log-priority", SchemaAuditLog, prio)
+}
+
+func TestReportFormat(t *testing.T) {
+	r := NewReport(fixtureTime)
+	r.PolicyVersion = 3
+	r.StreamCountries = []string{"CA"}
+	r.StreamSubdivisions = []string{"US-AK"}
+	r.Classifications = ClassificationCounts{
+		Total:    4,
+		Carried:  3,
+		ByRegion: map[string]int{"CA": 1, "CA-QC": 1, "US": 1, "US-AK": 1},
+		BySource: map[string]int{"admin": 1, "pds-geo": 3},
+	}
+	r.PriorityAccounts = 2
+	r.ActiveLegalHolds = 1
+	r.Appeals = map[string]int{"accepted": 1, "pending": 2}
+	checkGolden(t, "compliance-report", SchemaReport, r)
+
+	checkGolden(t, "compliance-report-empty", SchemaReport, NewReport(fixtureTime))
+}
+
+func TestClassificationFormat(t *testing.T) {
+	exp := fixtureTime.Add(24 * time.Hour)
+	checkGolden(t, "classification", SchemaClassification, sovereignty.Classification{
+		DID:         "did:plc:quebec",
+		Country:     "CA",
+		Subdivision: "QC",
+		Source:      "pds-geo",
+		UpdatedAt:   fixtureTime,
+		ExpiresAt:   &exp,
+		Confidence:  sovereignty.ConfidenceMedium,
+	})
+	checkGolden(t, "classification-admin", SchemaClassification, sovereignty.Classification{
+		DID:       "did:plc:admin",
+		Country:   "CA",
+		Source:    "admin",
+		UpdatedAt: fixtureTime,
+	})
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Schema(SchemaReport, Version+1)
+	assert.Error(err)
+
+	valid := `{"version": 1, "log": "appeals", "generatedAt": "2025-03-01T12:30:00Z", "entries": [{"id": 1, "createdAt": "2025-03-01T12:30:00Z", "subject": 4, "action": "submit"}]}`
+	assert.NoError(Validate(SchemaAuditLog, 1, []byte(valid)))
+
+	for _, doc := range []string{
+		// wrong version
+		`{"version": 2, "log": "appeals", "generatedAt": "2025-03-01T12:30:00Z", "entries": []}`,
+		// unknown log
+		`{"version": 1, "log": "other", "generatedAt": "2025-03-01T12:30:00Z", "entries": []}`,
+		// missing entries
+		`{"version": 1, "log": "appeals", "generatedAt": "2025-03-01T12:30:00Z"}`,
+		// malformed timestamp
+		`{"version": 1, "log": "appeals", "generatedAt": "March 1st", "entries": []}`,
+		// undeclared property
+		`{"version": 1, "log": "appeals", "generatedAt": "2025-03-01T12:30:00Z", "entries": [{"id": 1, "createdAt": "2025-03-01T12:30:00Z", "action": "submit", "extra": true}]}`,
+		// fractional id
+		`{"version": 1, "log": "appeals", "generatedAt": "2025-03-01T12:30:00Z", "entries": [{"id": 1.5, "createdAt": "2025-03-01T12:30:00Z", "action": "submit"}]}`,
+	} {
+		assert.Error(Validate(SchemaAuditLog, 1, []byte(doc)), doc)
+	}
+}
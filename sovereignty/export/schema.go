@@ -0,0 +1,172 @@
+package export
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// JSON Schema documents for the formats, named <format>.v<version>.json
+//
+//go:embed schema/*.json
+var schemas embed.FS
+
+// schemas of the formats, by name
+const (
+	SchemaAuditLog         = "audit-log"
+	SchemaReport           = "compliance-report"
+	SchemaClassification   = "classification"
+	SchemaSnapshotEntry    = "snapshot-entry"
+	SchemaSnapshotManifest = "snapshot-manifest"
+	SchemaSnapshotIndex    = "snapshot-index"
+)
+
+// Schema returns the JSON Schema document for a version of a format.
+func Schema(name string, version int) ([]byte, error) {
+	b, err := schemas.ReadFile(fmt.Sprintf("schema/%s.v%d.json", name, version))
+	if err != nil {
+		return nil, fmt.Errorf("no schema for %s version %d", name, version)
+	}
+	return b, nil
+}
+
+// node is the subset of JSON Schema the format schemas use
+type node struct {
+	Type                 string           `json:"type"`
+	Properties           map[string]*node `json:"properties"`
+	Required             []string         `json:"required"`
+	AdditionalProperties json.RawMessage  `json:"additionalProperties"`
+	Items                *node            `json:"items"`
+	Enum                 []any            `json:"enum"`
+	Const                any              `json:"const"`
+	Format               string           `json:"format"`
+}
+
+// Validate checks a JSON document against a version of a format's schema. It understands the subset of JSON Schema the format schemas are written in: type, properties, required, additionalProperties, items, enum, const, and the date-time format.
+func Validate(name string, version int, doc []byte) error {
+	raw, err := Schema(name, version)
+	if err != nil {
+		return err
+	}
+	var root node
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return fmt.Errorf("invalid schema for %s: %w", name, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return root.check("$", v)
+}
+
+func (n *node) check(path string, v any) error {
+	if n.Const != nil && fmt.Sprint(n.Const) != fmt.Sprint(v) {
+		return fmt.Errorf("%s: must be %v", path, n.Const)
+	}
+	if len(n.Enum) > 0 {
+		found := false
+		for _, e := range n.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, n.Enum)
+		}
+	}
+
+	switch n.Type {
+	case "":
+		return nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: must be a string", path)
+		}
+		if n.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: must be an RFC 3339 timestamp", path)
+			}
+		}
+	case "integer":
+		num, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+		if _, err := num.Int64(); err != nil {
+			return fmt.Errorf("%s: must be an integer", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: must be a boolean", path)
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an array", path)
+		}
+		if n.Items != nil {
+			for i, item := range arr {
+				if err := n.Items.check(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: must be an object", path)
+		}
+		return n.checkObject(path, obj)
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, n.Type)
+	}
+	return nil
+}
+
+func (n *node) checkObject(path string, obj map[string]any) error {
+	for _, r := range n.Required {
+		if _, ok := obj[r]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, r)
+		}
+	}
+
+	// additionalProperties is either false, or a schema for them
+	var extra *node
+	closed := false
+	if len(n.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(n.AdditionalProperties, &closed); err == nil {
+			closed = !closed
+		} else if err := json.Unmarshal(n.AdditionalProperties, &extra); err != nil {
+			return fmt.Errorf("%s: invalid additionalProperties in schema", path)
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub, ok := n.Properties[k]
+		switch {
+		case ok:
+		case extra != nil:
+			sub = extra
+		case closed:
+			return fmt.Errorf("%s: unexpected property %q", path, k)
+		default:
+			continue
+		}
+		if err := sub.check(path+"."+k, obj[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
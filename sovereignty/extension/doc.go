@@ -0,0 +1,6 @@
+// Loading of operator-supplied extensions which filter, transform and classify the sovereign stream.
+//
+// Extensions are WebAssembly modules implementing the ABI described in the sdk package, loaded from a directory (every *.wasm file, applied in file name order). A module can filter the events the relay carries, transform the records of commits, and classify events in place of the relay's geographic filter. Each runs sandboxed: in its own runtime, with only the WASI system interface (no filesystem, network, or environment), limited to MemoryLimit bytes of memory, and to Timeout per call. A module which traps, runs out of time, or returns something malformed fails the call, and its instance is discarded; the relay fails closed, dropping the event. The directory can be changed while the relay runs: Reload compiles new and changed modules and unloads removed ones, keeping a module's previous version if its new one fails to load.
+//
+// Go plugins (the plugin package) are deliberately not supported: they can't be sandboxed, or unloaded once loaded.
+package extension
@@ -0,0 +1,72 @@
+package extension
+
+import (
+	"encoding/json"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+)
+
+// simplify converts an event to the form extensions see, without records; it returns nil for events not about an account
+func (h *Host) simplify(evt *events.XRPCStreamEvent) *sdk.Event {
+	return SimplifyEvent(evt, h.opts.Classify)
+}
+
+// SimplifyEvent converts an event to the simplified form, without records, with the account's classification looked up by classify (nil leaves it out). It returns nil for events not about an account.
+func SimplifyEvent(evt *events.XRPCStreamEvent, classify func(did string) (sovereignty.Classification, bool)) *sdk.Event {
+	var out sdk.Event
+	switch {
+	case evt.RepoCommit != nil:
+		c := evt.RepoCommit
+		out = sdk.Event{Kind: sdk.KindCommit, Seq: c.Seq, DID: c.Repo, Time: c.Time, Rev: c.Rev}
+		out.Ops = make([]sdk.Op, len(c.Ops))
+		for i, op := range c.Ops {
+			out.Ops[i] = sdk.Op{Action: op.Action, Path: op.Path}
+			if op.Cid != nil {
+				out.Ops[i].CID = op.Cid.String()
+			}
+		}
+	case evt.RepoSync != nil:
+		out = sdk.Event{Kind: sdk.KindSync, Seq: evt.RepoSync.Seq, DID: evt.RepoSync.Did, Time: evt.RepoSync.Time, Rev: evt.RepoSync.Rev}
+	case evt.RepoIdentity != nil:
+		id := evt.RepoIdentity
+		out = sdk.Event{Kind: sdk.KindIdentity, Seq: id.Seq, DID: id.Did, Time: id.Time}
+		if id.Handle != nil {
+			out.Handle = *id.Handle
+		}
+	case evt.RepoAccount != nil:
+		acct := evt.RepoAccount
+		active := acct.Active
+		out = sdk.Event{Kind: sdk.KindAccount, Seq: acct.Seq, DID: acct.Did, Time: acct.Time, Active: &active}
+		if acct.Status != nil {
+			out.Status = *acct.Status
+		}
+	default:
+		return nil
+	}
+	if classify != nil {
+		if cl, ok := classify(out.DID); ok {
+			out.Country = cl.Country
+			out.Subdivision = cl.Subdivision
+		}
+	}
+	return &out
+}
+
+// withRecords returns a copy of the event carrying the records of its ops, in atproto JSON form
+func withRecords(evt *sdk.Event, recs map[string]map[string]any) (*sdk.Event, error) {
+	out := *evt
+	out.Ops = make([]sdk.Op, len(evt.Ops))
+	for i, op := range evt.Ops {
+		out.Ops[i] = op
+		if rec, ok := recs[op.Path]; ok {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return nil, err
+			}
+			out.Ops[i].Record = b
+		}
+	}
+	return &out, nil
+}
@@ -0,0 +1,215 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildExtension compiles one of the example extensions in testdata
+func buildExtension(t *testing.T, name, dir string) {
+	t.Helper()
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available to build extensions")
+	}
+	cmd := exec.Command(gobin, "build", "-buildmode=c-shared", "-o", filepath.Join(dir, name+".wasm"), "./testdata/"+name)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building %s: %s\n%s", name, err, out)
+	}
+}
+
+func commitEvent(t *testing.T, did string, recs map[string]map[string]any) *events.XRPCStreamEvent {
+	root := cartest.Commit(t, did)
+	blocks := []cartest.Block{root}
+	commit := &comatproto.SyncSubscribeRepos_Commit{Repo: did, Seq: 1, Time: "2025-03-01T12:00:00Z", Commit: lexutil.LexLink(root.Cid)}
+	for path, rec := range recs {
+		blk := cartest.NewBlock(t, rec)
+		commit.Ops = append(commit.Ops, &comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: path, Cid: blk.Link()})
+		blocks = append(blocks, blk)
+	}
+	commit.Blocks = cartest.CAR(t, blocks...)
+	return &events.XRPCStreamEvent{RepoCommit: commit}
+}
+
+func TestHost(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	buildExtension(t, "redact", dir)
+
+	opts := DefaultOptions()
+	opts.Dir = dir
+	opts.Classify = func(did string) (sovereignty.Classification, bool) {
+		if did == "did:plc:quebec" {
+			return sovereignty.Classification{DID: did, Country: "CA", Subdivision: "QC"}, true
+		}
+		return sovereignty.Classification{}, false
+	}
+	h, err := NewHost(ctx, opts)
+	assert.NoError(err)
+	defer h.Close(ctx)
+	if assert.Len(h.Modules(), 1) {
+		m := h.Modules()[0]
+		assert.Equal("redact", m.Name)
+		assert.True(m.Filters)
+		assert.True(m.Transforms)
+	}
+
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}}
+	}
+	keep, err := h.Filter(ctx, identity("did:plc:quebec"))
+	assert.NoError(err)
+	assert.False(keep)
+	keep, err = h.Filter(ctx, identity("did:plc:ontario"))
+	assert.NoError(err)
+	assert.True(keep)
+	keep, err = h.Filter(ctx, &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}})
+	assert.NoError(err)
+	assert.True(keep)
+
+	key, err := crypto.GeneratePrivateKeyP256()
+	assert.NoError(err)
+	evt := commitEvent(t, "did:plc:ontario", map[string]map[string]any{
+		"app.bsky.feed.post/3k": {"$type": "app.bsky.feed.post", "text": "a secret", "createdAt": "2025-03-01T12:00:00Z"},
+		"app.bsky.feed.post/3l": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2025-03-01T12:00:00Z"},
+	})
+	out, err := h.TransformEvent(ctx, evt, key)
+	if !assert.NoError(err) {
+		return
+	}
+	if assert.NotNil(out.Meta) && assert.Len(out.Meta.Modified, 1) {
+		mod := out.Meta.Modified[0]
+		assert.Equal("app.bsky.feed.post/3k", mod.Path)
+		assert.Equal([]string{"extension:redact"}, mod.Rules)
+		cr, err := car.NewCarReader(bytes.NewReader(out.RepoCommit.Blocks))
+		assert.NoError(err)
+		for {
+			blk, err := cr.Next()
+			if err != nil {
+				break
+			}
+			if blk.Cid().String() == mod.Cid {
+				rec, err := data.UnmarshalCBOR(blk.RawData())
+				assert.NoError(err)
+				assert.Equal("[redacted]", rec["text"])
+			}
+		}
+	}
+	// unchanged events pass through as they were
+	evt = commitEvent(t, "did:plc:ontario", map[string]map[string]any{
+		"app.bsky.feed.post/3m": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2025-03-01T12:00:00Z"},
+	})
+	out, err = h.TransformEvent(ctx, evt, key)
+	assert.NoError(err)
+	assert.Same(evt, out)
+
+	// modules are unloaded when removed
+	assert.NoError(os.Rename(filepath.Join(dir, "redact.wasm"), filepath.Join(dir, "redact.off")))
+	changed, err := h.Reload(ctx)
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Empty(h.Modules())
+	keep, err = h.Filter(ctx, identity("did:plc:quebec"))
+	assert.NoError(err)
+	assert.True(keep)
+
+	// a broken module doesn't load
+	assert.NoError(os.WriteFile(filepath.Join(dir, "broken.wasm"), []byte("not wasm"), 0644))
+	_, err = h.Reload(ctx)
+	assert.Error(err)
+	assert.Empty(h.Modules())
+	_, err = NewHost(ctx, opts)
+	assert.Error(err)
+}
+
+func TestSandbox(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	buildExtension(t, "misbehave", dir)
+
+	opts := DefaultOptions()
+	opts.Dir = dir
+	opts.Timeout = 200 * time.Millisecond
+	h, err := NewHost(ctx, opts)
+	assert.NoError(err)
+	defer h.Close(ctx)
+
+	identity := func(did string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did}}
+	}
+	start := time.Now()
+	keep, err := h.Filter(ctx, identity("did:plc:spin"))
+	assert.False(keep)
+	assert.True(errors.Is(err, ErrTimeout), "%v", err)
+	assert.Less(time.Since(start), 5*time.Second)
+
+	keep, err = h.Filter(ctx, identity("did:plc:hog"))
+	assert.False(keep)
+	assert.Error(err)
+
+	// the module still works after its failed instances are discarded
+	keep, err = h.Filter(ctx, identity("did:plc:fine"))
+	assert.NoError(err)
+	assert.True(keep)
+}
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	buildExtension(t, "classify", dir)
+	buildExtension(t, "redact", dir)
+
+	opts := DefaultOptions()
+	opts.Dir = dir
+	opts.Classify = func(did string) (sovereignty.Classification, bool) {
+		if did == "did:plc:us" {
+			return sovereignty.Classification{DID: did, Country: "US"}, true
+		}
+		return sovereignty.Classification{}, false
+	}
+	h, err := NewHost(ctx, opts)
+	assert.NoError(err)
+	defer h.Close(ctx)
+	if assert.Len(h.Modules(), 2) {
+		assert.True(h.Modules()[0].Classifies)
+	}
+
+	identity := func(did, handle string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Handle: &handle}}
+	}
+	v, err := h.Classify(ctx, identity("did:plc:fed", "agency.gc.ca"))
+	assert.NoError(err)
+	assert.Equal(&Verdict{Module: "classify", Keep: true, Reason: "federal"}, v)
+	v, err = h.Classify(ctx, identity("did:plc:us", "someone.example.com"))
+	assert.NoError(err)
+	assert.Equal(&Verdict{Module: "classify", Keep: false, Reason: "us"}, v)
+
+	// left to the relay, by the classifier and by the module without one
+	v, err = h.Classify(ctx, identity("did:plc:other", "someone.example.com"))
+	assert.NoError(err)
+	assert.Nil(v)
+	v, err = h.Classify(ctx, &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}})
+	assert.NoError(err)
+	assert.Nil(v)
+}
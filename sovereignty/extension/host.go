@@ -0,0 +1,303 @@
+package extension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+)
+
+type Options struct {
+	// directory the *.wasm modules are loaded from
+	Dir string
+	// most memory each module instance may use, in bytes
+	MemoryLimit uint64
+	// longest a single call into a module may run
+	Timeout time.Duration
+	// looks up the classification of an account, which extensions see with its events; nil leaves it out
+	Classify func(did string) (sovereignty.Classification, bool)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MemoryLimit: 128 << 20,
+		Timeout:     100 * time.Millisecond,
+	}
+}
+
+// Host runs the chain of extension modules in a directory.
+type Host struct {
+	opts Options
+
+	// serialises reloads
+	lk    sync.Mutex
+	files map[string]fileState
+
+	// loaded modules, in file name order
+	modules atomic.Pointer[[]*Module]
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	module  *Module
+}
+
+// NewHost loads the modules in the directory; any which fails to load is an error.
+func NewHost(ctx context.Context, opts Options) (*Host, error) {
+	h := &Host{
+		opts:  opts,
+		files: make(map[string]fileState),
+	}
+	h.modules.Store(&[]*Module{})
+	if _, err := h.Reload(ctx); err != nil {
+		h.Close(ctx)
+		return nil, err
+	}
+	return h, nil
+}
+
+// Modules returns the loaded modules, in the order they apply.
+func (h *Host) Modules() []*Module {
+	return *h.modules.Load()
+}
+
+// Reload loads modules added to the directory or changed (by modification time or size) since they were last loaded, and unloads removed ones, reporting whether anything changed. A module whose new version fails to load keeps its previous version, if it had one; the errors are joined.
+func (h *Host) Reload(ctx context.Context) (bool, error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	entries, err := os.ReadDir(h.opts.Dir)
+	if err != nil {
+		return false, err
+	}
+	var errs []error
+	changed := false
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".wasm") {
+			continue
+		}
+		name := e.Name()
+		seen[name] = true
+		fi, err := e.Info()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		prev, ok := h.files[name]
+		if ok && fi.ModTime().Equal(prev.modTime) && fi.Size() == prev.size {
+			continue
+		}
+		m, err := h.load(ctx, name)
+		if err != nil {
+			reloadsCounter.WithLabelValues("failed").Inc()
+			errs = append(errs, err)
+			continue
+		}
+		reloadsCounter.WithLabelValues("loaded").Inc()
+		if prev.module != nil {
+			// calls in flight on the previous version fail, and their events are dropped
+			defer prev.module.Close(ctx)
+		}
+		h.files[name] = fileState{modTime: fi.ModTime(), size: fi.Size(), module: m}
+		changed = true
+	}
+	for name, st := range h.files {
+		if !seen[name] {
+			defer st.module.Close(ctx)
+			delete(h.files, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		names := make([]string, 0, len(h.files))
+		for name := range h.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		modules := make([]*Module, len(names))
+		for i, name := range names {
+			modules[i] = h.files[name].module
+		}
+		h.modules.Store(&modules)
+	}
+	return changed, errors.Join(errs...)
+}
+
+func (h *Host) load(ctx context.Context, name string) (*Module, error) {
+	wasm, err := os.ReadFile(filepath.Join(h.opts.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return Compile(ctx, strings.TrimSuffix(name, ".wasm"), wasm, h.opts.MemoryLimit, h.opts.Timeout)
+}
+
+// Close unloads all the modules.
+func (h *Host) Close(ctx context.Context) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	for name, st := range h.files {
+		st.module.Close(ctx)
+		delete(h.files, name)
+	}
+	h.modules.Store(&[]*Module{})
+}
+
+// Filter asks each filtering module in turn whether the event stays on the stream, returning false as soon as one drops it. Events not about an account are always kept. An error from any module is returned along with false.
+func (h *Host) Filter(ctx context.Context, evt *events.XRPCStreamEvent) (bool, error) {
+	modules := h.Modules()
+	if len(modules) == 0 {
+		return true, nil
+	}
+	simple := h.simplify(evt)
+	if simple == nil {
+		return true, nil
+	}
+	for _, m := range modules {
+		if !m.Filters {
+			continue
+		}
+		start := time.Now()
+		keep, err := m.Filter(ctx, simple)
+		callDuration.WithLabelValues(m.Name, "filter").Observe(time.Since(start).Seconds())
+		if err != nil {
+			callsCounter.WithLabelValues(m.Name, "filter", errorResult(err)).Inc()
+			return false, err
+		}
+		if !keep {
+			callsCounter.WithLabelValues(m.Name, "filter", "drop").Inc()
+			return false, nil
+		}
+		callsCounter.WithLabelValues(m.Name, "filter", "ok").Inc()
+	}
+	return true, nil
+}
+
+// Verdict is a classifying module's decision on an event.
+type Verdict struct {
+	// name of the module which decided
+	Module string
+	Keep   bool
+	Reason string
+}
+
+// Classify asks each classifying module in turn for its decision on the event, returning the first module's which gives one, or nil if they all leave it to the relay. Events not about an account are left to the relay. An error from any module is returned, and the relay should drop the event.
+func (h *Host) Classify(ctx context.Context, evt *events.XRPCStreamEvent) (*Verdict, error) {
+	var modules []*Module
+	for _, m := range h.Modules() {
+		if m.Classifies {
+			modules = append(modules, m)
+		}
+	}
+	if len(modules) == 0 {
+		return nil, nil
+	}
+	simple := h.simplify(evt)
+	if simple == nil {
+		return nil, nil
+	}
+	for _, m := range modules {
+		start := time.Now()
+		d, err := m.Classify(ctx, simple)
+		callDuration.WithLabelValues(m.Name, "classify").Observe(time.Since(start).Seconds())
+		if err != nil {
+			callsCounter.WithLabelValues(m.Name, "classify", errorResult(err)).Inc()
+			return nil, err
+		}
+		if d == nil {
+			callsCounter.WithLabelValues(m.Name, "classify", "ok").Inc()
+			continue
+		}
+		callsCounter.WithLabelValues(m.Name, "classify", d.Verdict).Inc()
+		return &Verdict{Module: m.Name, Keep: d.Verdict == sdk.VerdictKeep, Reason: d.Reason}, nil
+	}
+	return nil, nil
+}
+
+// TransformEvent passes a commit's records through each transforming module in turn, each seeing the records as the previous left them, and returns the event as it should be emitted. Rewritten records are re-encoded as by transform.RewriteEvent, and listed in the FrameMeta, signed with key, under the rule name "extension:" followed by the module's name.
+func (h *Host) TransformEvent(ctx context.Context, evt *events.XRPCStreamEvent, key crypto.PrivateKey) (*events.XRPCStreamEvent, error) {
+	var modules []*Module
+	for _, m := range h.Modules() {
+		if m.Transforms {
+			modules = append(modules, m)
+		}
+	}
+	if len(modules) == 0 || evt.RepoCommit == nil {
+		return evt, nil
+	}
+	simple := h.simplify(evt)
+
+	var failed error
+	out, err := transform.RewriteEvent(evt, key, func(string) bool { return true }, func(recs []transform.Record) map[string][]string {
+		byPath := make(map[string]map[string]any, len(recs))
+		for _, r := range recs {
+			byPath[r.Path] = r.Value
+		}
+		cur, err := withRecords(simple, byPath)
+		if err != nil {
+			failed = err
+			return nil
+		}
+		applied := make(map[string][]string)
+		for _, m := range modules {
+			start := time.Now()
+			res, err := m.Transform(ctx, cur)
+			callDuration.WithLabelValues(m.Name, "transform").Observe(time.Since(start).Seconds())
+			if err != nil {
+				callsCounter.WithLabelValues(m.Name, "transform", errorResult(err)).Inc()
+				failed = err
+				return nil
+			}
+			if res == nil || len(res.Records) == 0 {
+				callsCounter.WithLabelValues(m.Name, "transform", "ok").Inc()
+				continue
+			}
+			callsCounter.WithLabelValues(m.Name, "transform", "changed").Inc()
+			for i, op := range cur.Ops {
+				raw, ok := res.Records[op.Path]
+				rec, found := byPath[op.Path]
+				if !ok || !found {
+					// only records the commit writes can be replaced
+					continue
+				}
+				val, err := data.UnmarshalJSON(raw)
+				if err != nil {
+					failed = fmt.Errorf("extension %s returned an invalid record for %s: %w", m.Name, op.Path, err)
+					return nil
+				}
+				clear(rec)
+				maps.Copy(rec, val)
+				cur.Ops[i].Record = raw
+				applied[op.Path] = append(applied[op.Path], "extension:"+m.Name)
+			}
+		}
+		return applied
+	})
+	if failed != nil {
+		return nil, failed
+	}
+	return out, err
+}
+
+func errorResult(err error) string {
+	if errors.Is(err, ErrTimeout) {
+		return "timeout"
+	}
+	return "error"
+}
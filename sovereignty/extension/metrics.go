@@ -0,0 +1,22 @@
+package extension
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var callsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "extension_calls_total",
+	Help: "Calls into extensions, by module, call (filter, transform or classify), and result (ok, keep, drop, changed, timeout or error)",
+}, []string{"module", "call", "result"})
+
+var callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "extension_call_duration_seconds",
+	Help:    "Time taken by calls into extensions, by module and call",
+	Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+}, []string{"module", "call"})
+
+var reloadsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "extension_reloads_total",
+	Help: "Extension modules loaded after their file was added or changed, by result (loaded or failed)",
+}, []string{"result"})
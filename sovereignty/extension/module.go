@@ -0,0 +1,266 @@
+package extension
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// size of a WebAssembly memory page
+const pageSize = 64 << 10
+
+// ErrTimeout is returned when an extension call runs longer than the configured timeout.
+var ErrTimeout = errors.New("extension call timed out")
+
+// Module is a compiled extension, with a pool of instances to call it on.
+type Module struct {
+	Name     string
+	SHA256   string
+	LoadedAt time.Time
+	// which of the optional functions the module exports
+	Filters    bool
+	Transforms bool
+	Classifies bool
+
+	rt       wazero.Runtime
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+
+	// idle instances; an instance only runs one call at a time
+	lk   sync.Mutex
+	idle []api.Module
+}
+
+// Compile validates and compiles a module, checking it exports the functions of the ABI version the relay implements.
+func Compile(ctx context.Context, name string, wasm []byte, memoryLimit uint64, timeout time.Duration) (*Module, error) {
+	cfg := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true)
+	if memoryLimit > 0 {
+		cfg = cfg.WithMemoryLimitPages(uint32(max(memoryLimit/pageSize, 1)))
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	compiled, err := rt.CompileModule(ctx, wasm)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("compiling extension %s: %w", name, err)
+	}
+	sum := sha256.Sum256(wasm)
+	m := &Module{
+		Name:     name,
+		SHA256:   hex.EncodeToString(sum[:]),
+		LoadedAt: time.Now().UTC(),
+		rt:       rt,
+		compiled: compiled,
+		timeout:  timeout,
+	}
+	exports := compiled.ExportedFunctions()
+	for _, f := range []string{sdk.ExportABIVersion, sdk.ExportAlloc} {
+		if _, ok := exports[f]; !ok {
+			rt.Close(ctx)
+			return nil, fmt.Errorf("extension %s doesn't export %s", name, f)
+		}
+	}
+	_, m.Filters = exports[sdk.ExportFilter]
+	_, m.Transforms = exports[sdk.ExportTransform]
+	_, m.Classifies = exports[sdk.ExportClassify]
+
+	// instantiating one up front runs its initialization, and checks the version
+	inst, err := m.instance(ctx)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	res, err := m.call(ctx, inst, sdk.ExportABIVersion)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	if v := int32(res[0]); v != sdk.ABIVersion {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("extension %s was built for ABI version %d, not %d", name, v, sdk.ABIVersion)
+	}
+	m.release(inst)
+	return m, nil
+}
+
+// Close unloads the module, and frees its instances.
+func (m *Module) Close(ctx context.Context) error {
+	return m.rt.Close(ctx)
+}
+
+func (m *Module) instance(ctx context.Context) (api.Module, error) {
+	m.lk.Lock()
+	if n := len(m.idle); n > 0 {
+		inst := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.lk.Unlock()
+		return inst, nil
+	}
+	m.lk.Unlock()
+
+	// anonymous, so any number can be instantiated; a WASI reactor is initialized rather than started
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	inst, err := m.rt.InstantiateModule(ctx, m.compiled, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("instantiating extension %s: %w", m.Name, err)
+	}
+	return inst, nil
+}
+
+func (m *Module) release(inst api.Module) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.idle = append(m.idle, inst)
+}
+
+// call invokes an exported function within the timeout. On failure the instance is closed, as its state can't be trusted
+func (m *Module) call(ctx context.Context, inst api.Module, name string, params ...uint64) ([]uint64, error) {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	res, err := inst.ExportedFunction(name).Call(ctx, params...)
+	if err != nil {
+		inst.Close(context.Background())
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %s in %s", ErrTimeout, name, m.Name)
+		}
+		return nil, fmt.Errorf("extension %s: %s: %w", m.Name, name, err)
+	}
+	return res, nil
+}
+
+// write copies the encoded event into memory allocated by the instance
+func (m *Module) write(ctx context.Context, inst api.Module, b []byte) (uint64, uint64, error) {
+	res, err := m.call(ctx, inst, sdk.ExportAlloc, uint64(len(b)))
+	if err != nil {
+		return 0, 0, err
+	}
+	ptr := uint32(res[0])
+	if !inst.Memory().Write(ptr, b) {
+		inst.Close(context.Background())
+		return 0, 0, fmt.Errorf("extension %s allocated memory out of range", m.Name)
+	}
+	return uint64(ptr), uint64(len(b)), nil
+}
+
+// Filter asks the module whether the event stays on the stream.
+func (m *Module) Filter(ctx context.Context, evt *sdk.Event) (bool, error) {
+	if !m.Filters {
+		return true, nil
+	}
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return false, err
+	}
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return false, err
+	}
+	ptr, size, err := m.write(ctx, inst, b)
+	if err != nil {
+		return false, err
+	}
+	res, err := m.call(ctx, inst, sdk.ExportFilter, ptr, size)
+	if err != nil {
+		return false, err
+	}
+	m.release(inst)
+	return int32(res[0]) != 0, nil
+}
+
+// Transform passes a commit to the module, returning what it changed, or nil if nothing.
+func (m *Module) Transform(ctx context.Context, evt *sdk.Event) (*sdk.Result, error) {
+	if !m.Transforms {
+		return nil, nil
+	}
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ptr, size, err := m.write(ctx, inst, b)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.call(ctx, inst, sdk.ExportTransform, ptr, size)
+	if err != nil {
+		return nil, err
+	}
+	var out sdk.Result
+	ok, err := m.output(inst, res[0], &out)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Classify asks the module for its decision on the event, returning nil if it leaves the event to the relay.
+func (m *Module) Classify(ctx context.Context, evt *sdk.Event) (*sdk.Decision, error) {
+	if !m.Classifies {
+		return nil, nil
+	}
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ptr, size, err := m.write(ctx, inst, b)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.call(ctx, inst, sdk.ExportClassify, ptr, size)
+	if err != nil {
+		return nil, err
+	}
+	var out sdk.Decision
+	ok, err := m.output(inst, res[0], &out)
+	if !ok || err != nil {
+		return nil, err
+	}
+	if out.Verdict != sdk.VerdictKeep && out.Verdict != sdk.VerdictDrop {
+		return nil, fmt.Errorf("extension %s returned an unknown verdict %q", m.Name, out.Verdict)
+	}
+	return &out, nil
+}
+
+// output decodes the result a call packed into its return value, releasing the instance, and reports whether there was one
+func (m *Module) output(inst api.Module, packed uint64, v any) (bool, error) {
+	if packed == 0 {
+		m.release(inst)
+		return false, nil
+	}
+	b, ok := inst.Memory().Read(uint32(packed>>32), uint32(packed))
+	if !ok {
+		inst.Close(context.Background())
+		return false, fmt.Errorf("extension %s returned a result out of range", m.Name)
+	}
+	err := json.Unmarshal(b, v)
+	m.release(inst)
+	if err != nil {
+		return false, fmt.Errorf("extension %s returned a malformed result: %w", m.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,39 @@
+// SDK for writing sovereign stream extensions in Go.
+//
+// An extension is a WebAssembly module the relay loads to filter or transform the events of its sovereign stream, so an institution's own policies don't require a fork of the relay. Extensions are built as WASI reactors, and register their handlers from an init function:
+//
+//	package main
+//
+//	import "github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+//
+//	func init() {
+//		sdk.HandleFilter(func(evt *sdk.Event) bool {
+//			return evt.Subdivision != "QC"
+//		})
+//	}
+//
+//	func main() {}
+//
+// A module can also take the place of the relay's geographic filter, with a classifier which keeps or drops events whatever the account's classification:
+//
+//	sdk.HandleClassify(func(evt *sdk.Event) *sdk.Decision {
+//		if strings.HasSuffix(evt.Handle, ".gc.ca") {
+//			return &sdk.Decision{Verdict: sdk.VerdictKeep, Reason: "federal"}
+//		}
+//		return nil
+//	})
+//
+// Either is compiled with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o policy.wasm
+//
+// The types in this package define the events and results exchanged with the relay, encoded as JSON, and are shared with the host side. The ABI (version ABIVersion) is:
+//
+//   - gander_abi_version() i32: the ABI version the module was built for
+//   - gander_alloc(size i32) i32: allocates size bytes of module memory for the relay to write an event into
+//   - gander_filter(ptr i32, len i32) i32: decides on the event at ptr: non-zero keeps it on the stream, zero drops it
+//   - gander_transform(ptr i32, len i32) i64: returns a Result, at the module memory address in the upper 32 bits and of the length in the lower, or 0 to leave the event unchanged
+//   - gander_classify(ptr i32, len i32) i64: returns a Decision on the event, packed as for gander_transform, or 0 to leave it to the relay's geographic filter
+//
+// Each of gander_filter, gander_transform and gander_classify is optional. Memory the relay allocated for an event stays valid until the next call into the module, as does a returned Result or Decision.
+package sdk
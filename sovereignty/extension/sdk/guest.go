@@ -0,0 +1,108 @@
+//go:build wasip1
+
+package sdk
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+var (
+	filter    func(*Event) bool
+	transform func(*Event) *Result
+	classify  func(*Event) *Decision
+
+	// memory handed out to the relay, kept reachable until the next call
+	pinned [][]byte
+)
+
+// HandleFilter registers the function deciding which events stay on the stream. Call it from an init function.
+func HandleFilter(f func(evt *Event) bool) {
+	filter = f
+}
+
+// HandleTransform registers the function rewriting the records of commits; it returns nil to leave an event unchanged. Call it from an init function.
+func HandleTransform(f func(evt *Event) *Result) {
+	transform = f
+}
+
+// HandleClassify registers the function deciding on events in place of the relay's geographic filter; it returns nil to leave an event to the relay. Call it from an init function.
+func HandleClassify(f func(evt *Event) *Decision) {
+	classify = f
+}
+
+//go:wasmexport gander_abi_version
+func abiVersion() int32 {
+	return ABIVersion
+}
+
+//go:wasmexport gander_alloc
+func alloc(size int32) int32 {
+	if size <= 0 {
+		return 0
+	}
+	buf := make([]byte, size)
+	pinned = append(pinned, buf)
+	return int32(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// input decodes the event the relay wrote, and releases the memory handed out since the last call
+func input(ptr, size int32) (*Event, bool) {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(uintptr(ptr))), size)
+	var evt Event
+	err := json.Unmarshal(b, &evt)
+	pinned = nil
+	return &evt, err == nil
+}
+
+//go:wasmexport gander_filter
+func filterEvent(ptr, size int32) int32 {
+	evt, ok := input(ptr, size)
+	if !ok {
+		return 0
+	}
+	if filter == nil || filter(evt) {
+		return 1
+	}
+	return 0
+}
+
+//go:wasmexport gander_transform
+func transformEvent(ptr, size int32) int64 {
+	evt, ok := input(ptr, size)
+	if !ok || transform == nil {
+		return 0
+	}
+	res := transform(evt)
+	if res == nil || len(res.Records) == 0 {
+		return 0
+	}
+	out, err := json.Marshal(res)
+	if err != nil {
+		return 0
+	}
+	return output(out)
+}
+
+//go:wasmexport gander_classify
+func classifyEvent(ptr, size int32) int64 {
+	evt, ok := input(ptr, size)
+	if !ok || classify == nil {
+		return 0
+	}
+	d := classify(evt)
+	if d == nil {
+		return 0
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		return 0
+	}
+	return output(out)
+}
+
+// output pins an encoded result, and packs its address and length
+func output(out []byte) int64 {
+	pinned = append(pinned, out)
+	return int64(uintptr(unsafe.Pointer(&out[0])))<<32 | int64(len(out))
+}
@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"encoding/json"
+)
+
+// ABIVersion is bumped on any incompatible change to the module interface or the types in this package.
+const ABIVersion = 1
+
+// names of the functions modules export
+const (
+	ExportABIVersion = "gander_abi_version"
+	ExportAlloc      = "gander_alloc"
+	ExportFilter     = "gander_filter"
+	ExportTransform  = "gander_transform"
+	ExportClassify   = "gander_classify"
+)
+
+// kinds of Event
+const (
+	KindCommit   = "commit"
+	KindSync     = "sync"
+	KindIdentity = "identity"
+	KindAccount  = "account"
+)
+
+// Event is a simplified firehose event.
+type Event struct {
+	// one of the Kind constants
+	Kind string `json:"kind"`
+	Seq  int64  `json:"seq"`
+	DID  string `json:"did"`
+	Time string `json:"time,omitempty"`
+	// classification of the account, if it has one
+	Country     string `json:"country,omitempty"`
+	Subdivision string `json:"subdivision,omitempty"`
+
+	// commits only
+	Rev string `json:"rev,omitempty"`
+	Ops []Op   `json:"ops,omitempty"`
+
+	// identity events only
+	Handle string `json:"handle,omitempty"`
+
+	// account events only
+	Active *bool  `json:"active,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// Op is an operation of a commit.
+type Op struct {
+	// "create", "update" or "delete"
+	Action string `json:"action"`
+	// collection and record key, eg "app.bsky.feed.post/3k2a..."
+	Path string `json:"path"`
+	CID  string `json:"cid,omitempty"`
+	// the record written, in atproto JSON form; only passed to transforms, for creates and updates
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// Collection returns the collection of the record the op writes.
+func (op Op) Collection() string {
+	for i := 0; i < len(op.Path); i++ {
+		if op.Path[i] == '/' {
+			return op.Path[:i]
+		}
+	}
+	return op.Path
+}
+
+// Result is what a transform changed in an event.
+type Result struct {
+	// replacement records, in atproto JSON form, by op path; ops not listed are unchanged
+	Records map[string]json.RawMessage `json:"records,omitempty"`
+}
+
+// verdicts of a Decision
+const (
+	VerdictKeep = "keep"
+	VerdictDrop = "drop"
+)
+
+// Decision is a classifier's verdict on an event, which takes the place of the relay's own geographic filter.
+type Decision struct {
+	// VerdictKeep or VerdictDrop
+	Verdict string `json:"verdict"`
+	// why, for the relay's logs
+	Reason string `json:"reason,omitempty"`
+}
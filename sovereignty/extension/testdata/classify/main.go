@@ -0,0 +1,22 @@
+// An example classifier: keeps the events of accounts with handles under gc.ca, and drops those of accounts classified in the US, whatever the relay's geographic filter would do.
+package main
+
+import (
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+)
+
+func init() {
+	sdk.HandleClassify(func(evt *sdk.Event) *sdk.Decision {
+		switch {
+		case strings.HasSuffix(evt.Handle, ".gc.ca"):
+			return &sdk.Decision{Verdict: sdk.VerdictKeep, Reason: "federal"}
+		case evt.Country == "US":
+			return &sdk.Decision{Verdict: sdk.VerdictDrop, Reason: "us"}
+		}
+		return nil
+	})
+}
+
+func main() {}
@@ -0,0 +1,25 @@
+// An extension which misbehaves on request, to exercise the sandbox's limits.
+package main
+
+import (
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+)
+
+var hoard [][]byte
+
+func init() {
+	sdk.HandleFilter(func(evt *sdk.Event) bool {
+		switch evt.DID {
+		case "did:plc:spin":
+			for {
+			}
+		case "did:plc:hog":
+			for {
+				hoard = append(hoard, make([]byte, 16<<20))
+			}
+		}
+		return true
+	})
+}
+
+func main() {}
@@ -0,0 +1,34 @@
+// An example extension: drops events of accounts classified in Quebec, and redacts the text of posts mentioning "secret".
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+)
+
+func init() {
+	sdk.HandleFilter(func(evt *sdk.Event) bool {
+		return evt.Subdivision != "QC"
+	})
+	sdk.HandleTransform(func(evt *sdk.Event) *sdk.Result {
+		res := &sdk.Result{Records: map[string]json.RawMessage{}}
+		for _, op := range evt.Ops {
+			if op.Collection() != "app.bsky.feed.post" || op.Record == nil {
+				continue
+			}
+			var rec map[string]any
+			if err := json.Unmarshal(op.Record, &rec); err != nil {
+				continue
+			}
+			if text, _ := rec["text"].(string); strings.Contains(text, "secret") {
+				rec["text"] = "[redacted]"
+				res.Records[op.Path], _ = json.Marshal(rec)
+			}
+		}
+		return res
+	})
+}
+
+func main() {}
@@ -0,0 +1,4 @@
+// Firehose consumer which fails over between cooperating sovereign relays.
+//
+// Relays advertise alternates in their describeServer output, and in the error frame they send to consumers when shutting down. Sequence numbers are local to each relay, so on switching relays the client rewinds the new relay's stream a fixed distance and skips forward until it finds the last event it processed, matched by (did, rev).
+package failover
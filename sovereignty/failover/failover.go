@@ -0,0 +1,356 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/sequential"
+
+	"github.com/gorilla/websocket"
+)
+
+// Description is the describeServer output of a sovereign relay. Alternates and HeadSeq are extensions to the com.atproto.server.describeServer schema.
+type Description struct {
+	Did                  string   `json:"did,omitempty"`
+	AvailableUserDomains []string `json:"availableUserDomains"`
+	// base URLs of other relays carrying the same data
+	Alternates []string `json:"alternates,omitempty"`
+	// sequence number of the most recent event on the relay's firehose
+	HeadSeq int64 `json:"headSeq"`
+}
+
+type Options struct {
+	// extra relays to fail over to, in addition to any the relays advertise
+	Alternates []string
+	// how far to rewind a new relay's stream when searching for the last processed event
+	Lookback int64
+	// number of recently processed events remembered for matching and de-duplication
+	Window int
+	// consecutive connection failures before moving on to the next relay
+	MaxRetries int
+	RetryDelay time.Duration
+	Client     *http.Client
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Lookback:   10_000,
+		Window:     20_000,
+		MaxRetries: 3,
+		RetryDelay: 5 * time.Second,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// errShutdown ends a stream when the relay announces it is shutting down
+var errShutdown = errors.New("relay shutting down")
+
+// Client consumes a relay firehose, failing over to alternates when the current relay goes away.
+type Client struct {
+	handle func(context.Context, *events.XRPCStreamEvent) error
+	opts   Options
+	hosts  []string
+	// index into hosts of the relay currently (or most recently) connected to
+	current int
+	// last processed sequence number on the current relay; nil before the first event
+	cursor *int64
+
+	// true after switching relays, until the last processed event has been found on the new relay
+	matching bool
+	// events seen while matching, delivered if the match is never found
+	pending []*events.XRPCStreamEvent
+	// head of the new relay when matching started
+	matchHead int64
+
+	recent    []string
+	recentSet map[string]int
+	recentPos int
+
+	log *slog.Logger
+}
+
+// NewClient creates a client starting at the given relay base URL (eg, "https://relay.example.ca"). The handler is called for each event, in order, and never concurrently.
+func NewClient(host string, handle func(context.Context, *events.XRPCStreamEvent) error, opts *Options) *Client {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	c := &Client{
+		handle:    handle,
+		opts:      *opts,
+		recentSet: make(map[string]int),
+		log:       slog.Default().With("system", "failover"),
+	}
+	c.addHosts([]string{host})
+	c.addHosts(opts.Alternates)
+	return c
+}
+
+// Host returns the base URL of the relay currently in use.
+func (c *Client) Host() string {
+	return c.hosts[c.current]
+}
+
+// Run consumes events until the context is cancelled or the handler returns an error.
+func (c *Client) Run(ctx context.Context) error {
+	if desc, err := c.describe(ctx, c.Host()); err == nil {
+		c.addHosts(desc.Alternates)
+	} else {
+		c.log.Warn("failed to fetch relay description", "host", c.Host(), "err", err)
+	}
+
+	failures := 0
+	for {
+		err := c.stream(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var herr *handlerError
+		if errors.As(err, &herr) {
+			return herr.err
+		}
+
+		switch {
+		case errors.Is(err, errShutdown):
+			c.log.Info("relay shutting down, failing over", "host", c.Host())
+		case failures+1 < c.opts.MaxRetries:
+			failures++
+			c.log.Warn("relay stream failed, retrying", "host", c.Host(), "err", err)
+			if err := sleep(ctx, c.opts.RetryDelay); err != nil {
+				return err
+			}
+			continue
+		default:
+			c.log.Warn("relay stream failed, failing over", "host", c.Host(), "err", err)
+		}
+
+		failures = 0
+		if len(c.hosts) == 1 {
+			if err := sleep(ctx, c.opts.RetryDelay); err != nil {
+				return err
+			}
+			continue
+		}
+		c.switchHost(ctx, (c.current+1)%len(c.hosts))
+	}
+}
+
+// switchHost moves to another relay, rewinding its stream so the last processed event can be found
+func (c *Client) switchHost(ctx context.Context, next int) {
+	c.current = next
+	c.cursor = nil
+	c.matching = false
+	c.pending = nil
+	if len(c.recent) == 0 {
+		// nothing processed yet, so nothing to match against
+		return
+	}
+
+	desc, err := c.describe(ctx, c.Host())
+	if err != nil {
+		c.log.Warn("failed to fetch alternate relay head, starting from live stream", "host", c.Host(), "err", err)
+		return
+	}
+	c.addHosts(desc.Alternates)
+	start := desc.HeadSeq - c.opts.Lookback
+	if start < 0 {
+		start = 0
+	}
+	c.cursor = &start
+	c.matching = true
+	c.matchHead = desc.HeadSeq
+}
+
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string { return e.err.Error() }
+
+func (c *Client) stream(ctx context.Context) error {
+	u := websocketURL(c.Host()) + "/xrpc/com.atproto.sync.subscribeRepos"
+	if c.cursor != nil {
+		u += fmt.Sprintf("?cursor=%d", *c.cursor)
+	}
+	d := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	con, _, err := d.DialContext(ctx, u, http.Header{})
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", c.Host(), err)
+	}
+	defer con.Close()
+
+	sched := sequential.NewScheduler("failover", c.process)
+	return events.HandleRepoStream(ctx, con, sched, c.log)
+}
+
+// process is called for every event on the stream, in order
+func (c *Client) process(ctx context.Context, evt *events.XRPCStreamEvent) error {
+	if evt.Error != nil {
+		if evt.Error.Error == events.ErrRelayShutdown {
+			c.addHosts(evt.Error.Alternates())
+			return errShutdown
+		}
+		return c.deliver(ctx, evt)
+	}
+
+	if seq, ok := evt.GetSequence(); ok {
+		c.cursor = &seq
+	}
+
+	key := eventKey(evt)
+	if c.matching {
+		if key != "" && c.recentSet[key] > 0 {
+			c.log.Info("found last processed event on new relay", "host", c.Host(), "pending", len(c.pending))
+			c.matching = false
+			c.pending = nil
+			return nil
+		}
+		c.pending = append(c.pending, evt)
+		seq, _ := evt.GetSequence()
+		if seq < c.matchHead && int64(len(c.pending)) <= 2*c.opts.Lookback {
+			return nil
+		}
+		// caught up without finding it; deliver everything rather than risk a gap
+		c.log.Warn("last processed event not found on new relay, delivering possible duplicates", "host", c.Host(), "count", len(c.pending))
+		c.matching = false
+		pending := c.pending
+		c.pending = nil
+		for _, p := range pending {
+			if err := c.deliver(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return c.deliver(ctx, evt)
+}
+
+func (c *Client) deliver(ctx context.Context, evt *events.XRPCStreamEvent) error {
+	key := eventKey(evt)
+	if key != "" {
+		if c.recentSet[key] > 0 {
+			// already processed on a previous relay
+			return nil
+		}
+		c.remember(key)
+	}
+	if err := c.handle(ctx, evt); err != nil {
+		return &handlerError{err: err}
+	}
+	return nil
+}
+
+func (c *Client) remember(key string) {
+	if c.opts.Window <= 0 {
+		return
+	}
+	if len(c.recent) < c.opts.Window {
+		c.recent = append(c.recent, key)
+	} else {
+		old := c.recent[c.recentPos]
+		if c.recentSet[old]--; c.recentSet[old] <= 0 {
+			delete(c.recentSet, old)
+		}
+		c.recent[c.recentPos] = key
+		c.recentPos = (c.recentPos + 1) % c.opts.Window
+	}
+	c.recentSet[key]++
+}
+
+func (c *Client) addHosts(hosts []string) {
+	for _, h := range hosts {
+		h = strings.TrimSuffix(h, "/")
+		if h == "" {
+			continue
+		}
+		dup := false
+		for _, existing := range c.hosts {
+			if existing == h {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			c.hosts = append(c.hosts, h)
+		}
+	}
+}
+
+func (c *Client) describe(ctx context.Context, host string) (*Description, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpURL(host)+"/xrpc/com.atproto.server.describeServer", nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from describeServer", resp.StatusCode)
+	}
+	var desc Description
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&desc); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
+
+// eventKey identifies an event independent of which relay it came through. Returns empty string for events which can't be matched.
+func eventKey(evt *events.XRPCStreamEvent) string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Repo + " " + evt.RepoCommit.Rev
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Did + " " + evt.RepoSync.Rev
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Did + " identity " + evt.RepoIdentity.Time
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Did + " account " + evt.RepoAccount.Time
+	default:
+		return ""
+	}
+}
+
+func websocketURL(host string) string {
+	switch {
+	case strings.HasPrefix(host, "https://"):
+		return "wss://" + strings.TrimPrefix(host, "https://")
+	case strings.HasPrefix(host, "http://"):
+		return "ws://" + strings.TrimPrefix(host, "http://")
+	default:
+		return host
+	}
+}
+
+func httpURL(host string) string {
+	switch {
+	case strings.HasPrefix(host, "wss://"):
+		return "https://" + strings.TrimPrefix(host, "wss://")
+	case strings.HasPrefix(host, "ws://"):
+		return "http://" + strings.TrimPrefix(host, "ws://")
+	default:
+		return host
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func commit(seq int64, rev int) *events.XRPCStreamEvent {
+	return &events.XRPCStreamEvent{
+		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Seq:  seq,
+			Repo: "did:plc:abc",
+			Rev:  fmt.Sprintf("rev%04d", rev),
+		},
+	}
+}
+
+func TestCursorTranslation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var got []string
+	handle := func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		got = append(got, evt.RepoCommit.Rev)
+		return nil
+	}
+	c := NewClient("https://a.example.com/", handle, &Options{Lookback: 10, Window: 100})
+
+	for i := 1; i <= 5; i++ {
+		assert.NoError(c.process(ctx, commit(int64(100+i), i)))
+	}
+	assert.Equal(int64(105), *c.cursor)
+
+	// relay shuts down, advertising an alternate
+	err := c.process(ctx, &events.XRPCStreamEvent{Error: events.ShutdownErrorFrame([]string{"https://b.example.com", "https://a.example.com"})})
+	assert.ErrorIs(err, errShutdown)
+	assert.Equal([]string{"https://a.example.com", "https://b.example.com"}, c.hosts)
+
+	// on the new relay, events before and including the last processed one are skipped, as are any already processed
+	c.current = 1
+	c.matching = true
+	c.matchHead = 60
+	for i, rev := range []int{2, 3, 5, 4, 6, 7} {
+		assert.NoError(c.process(ctx, commit(int64(50+i), rev)))
+	}
+	assert.Equal([]string{"rev0001", "rev0002", "rev0003", "rev0004", "rev0005", "rev0006", "rev0007"}, got)
+	assert.False(c.matching)
+	assert.Equal(int64(55), *c.cursor)
+
+	// if the last processed event never turns up, everything is delivered once caught up
+	got = nil
+	c.recent = nil
+	c.recentSet = make(map[string]int)
+	c.matching = true
+	c.matchHead = 3
+	for i := 1; i <= 4; i++ {
+		assert.NoError(c.process(ctx, commit(int64(i), 10+i)))
+		if i < 3 {
+			assert.Empty(got)
+		}
+	}
+	assert.Equal([]string{"rev0011", "rev0012", "rev0013", "rev0014"}, got)
+}
+
+func TestRecentWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewClient("https://a.example.com", nil, &Options{Window: 3})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.remember(k)
+	}
+	assert.Equal(0, c.recentSet["a"])
+	assert.Equal(1, c.recentSet["d"])
+	assert.Len(c.recentSet, 3)
+}
+
+func TestShutdownFrame(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"https://b", "https://c"}, events.ShutdownErrorFrame([]string{"https://b", "https://c"}).Alternates())
+	assert.Empty(events.ShutdownErrorFrame(nil).Alternates())
+	assert.Nil((&events.ErrorFrame{Error: "ConsumerTooSlow", Message: "https://b"}).Alternates())
+}
@@ -0,0 +1,4 @@
+// Runtime feature flags for the relay's experimental behaviors.
+//
+// Each Flag has a built-in default, which deployment configuration may change at startup. Operators may then override flags at runtime; overrides are persisted in a Store (a JSON file, or the relay database) so they survive restarts, and can be reset to fall back to the configured value. A Set evaluates flags with a single atomic load, so checks are cheap enough for per-event hot paths.
+package features
@@ -0,0 +1,280 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Flag identifies an experimental behavior.
+type Flag int
+
+const (
+	// withhold record content of accounts flagged as minors on the sovereign stream, when the minor policy requires it
+	HashOnlyEmission Flag = iota
+	// annotate posts on the sovereign stream with their normalized hashtags and links
+	PostEnrichment
+	// evaluate the sovereign stream filter on every event, recording what it would do, without filtering the stream
+	ShadowFiltering
+
+	numFlags
+)
+
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceOverride = "override"
+)
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Definition describes a flag.
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+var definitions = [numFlags]Definition{
+	HashOnlyEmission: {
+		Name:        "hash-only-emission",
+		Description: "withhold record content of accounts flagged as minors on the sovereign stream, when the minor policy requires it",
+		Default:     true,
+	},
+	PostEnrichment: {
+		Name:        "post-enrichment",
+		Description: "annotate posts on the sovereign stream with their normalized hashtags and links",
+	},
+	ShadowFiltering: {
+		Name:        "shadow-filtering",
+		Description: "evaluate the sovereign stream filter on every event, recording what it would do, without filtering the stream",
+	},
+}
+
+func (f Flag) String() string {
+	if f < 0 || f >= numFlags {
+		return fmt.Sprintf("Flag(%d)", int(f))
+	}
+	return definitions[f].Name
+}
+
+// Lookup returns the flag with the given name.
+func Lookup(name string) (Flag, error) {
+	for f, d := range definitions {
+		if d.Name == name {
+			return Flag(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownFlag, name)
+}
+
+// Definitions returns all flags, in declaration order.
+func Definitions() []Definition {
+	return append([]Definition(nil), definitions[:]...)
+}
+
+// Store persists runtime overrides, by flag name.
+type Store interface {
+	Load(ctx context.Context) (map[string]bool, error)
+	Put(ctx context.Context, name string, enabled bool) error
+	Delete(ctx context.Context, name string) error
+}
+
+// State is a flag's current value, and where it comes from.
+type State struct {
+	Definition
+	Enabled bool `json:"enabled"`
+	// one of SourceDefault, SourceConfig or SourceOverride
+	Source string `json:"source"`
+}
+
+// Set holds the current values of all flags.
+type Set struct {
+	enabled [numFlags]atomic.Bool
+
+	lk        sync.Mutex
+	config    map[Flag]bool
+	overrides map[Flag]bool
+	store     Store
+}
+
+// NewSet returns a set with the configured values (by flag name) applied over the defaults. Overrides are kept in memory only if store is nil.
+func NewSet(config map[string]bool, store Store) (*Set, error) {
+	s := &Set{
+		config:    make(map[Flag]bool),
+		overrides: make(map[Flag]bool),
+		store:     store,
+	}
+	for name, v := range config {
+		f, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		s.config[f] = v
+	}
+	s.refresh()
+	return s, nil
+}
+
+// Load replaces the in-memory overrides with those in the store. Stored overrides of flags this version doesn't define are ignored.
+func (s *Set) Load(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	stored, err := s.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading feature flags: %w", err)
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.overrides = make(map[Flag]bool)
+	for name, v := range stored {
+		if f, err := Lookup(name); err == nil {
+			s.overrides[f] = v
+		}
+	}
+	s.refresh()
+	return nil
+}
+
+// Enabled reports whether the flag is on. A nil set reports the defaults.
+func (s *Set) Enabled(f Flag) bool {
+	if s == nil {
+		return definitions[f].Default
+	}
+	return s.enabled[f].Load()
+}
+
+// Override sets the flag at runtime, persisting the override.
+func (s *Set) Override(ctx context.Context, f Flag, enabled bool) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.store != nil {
+		if err := s.store.Put(ctx, f.String(), enabled); err != nil {
+			return err
+		}
+	}
+	s.overrides[f] = enabled
+	s.refresh()
+	return nil
+}
+
+// Reset removes the flag's runtime override, returning it to its configured value.
+func (s *Set) Reset(ctx context.Context, f Flag) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.store != nil {
+		if err := s.store.Delete(ctx, f.String()); err != nil {
+			return err
+		}
+	}
+	delete(s.overrides, f)
+	s.refresh()
+	return nil
+}
+
+// States returns the current state of every flag, in declaration order.
+func (s *Set) States() []State {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	out := make([]State, numFlags)
+	for f := range numFlags {
+		v, src := s.resolve(f)
+		out[f] = State{Definition: definitions[f], Enabled: v, Source: src}
+	}
+	return out
+}
+
+func (s *Set) resolve(f Flag) (bool, string) {
+	if v, ok := s.overrides[f]; ok {
+		return v, SourceOverride
+	}
+	if v, ok := s.config[f]; ok {
+		return v, SourceConfig
+	}
+	return definitions[f].Default, SourceDefault
+}
+
+// refresh recomputes the values read by Enabled; callers hold the lock, except during construction
+func (s *Set) refresh() {
+	for f := range numFlags {
+		v, _ := s.resolve(f)
+		s.enabled[f].Store(v)
+	}
+}
+
+// FileStore keeps overrides in a JSON object file, mapping flag names to values. A missing file holds no overrides.
+type FileStore struct {
+	Path string
+
+	lk sync.Mutex
+}
+
+func (fs *FileStore) Load(ctx context.Context) (map[string]bool, error) {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	return fs.read()
+}
+
+func (fs *FileStore) Put(ctx context.Context, name string, enabled bool) error {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	m, err := fs.read()
+	if err != nil {
+		return err
+	}
+	m[name] = enabled
+	return fs.write(m)
+}
+
+func (fs *FileStore) Delete(ctx context.Context, name string) error {
+	fs.lk.Lock()
+	defer fs.lk.Unlock()
+	m, err := fs.read()
+	if err != nil {
+		return err
+	}
+	delete(m, name)
+	return fs.write(m)
+}
+
+func (fs *FileStore) read() (map[string]bool, error) {
+	m := make(map[string]bool)
+	b, err := os.ReadFile(fs.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", fs.Path, err)
+	}
+	return m, nil
+}
+
+// write replaces the file atomically, so a crash never leaves it half-written
+func (fs *FileStore) write(m map[string]bool) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fs.Path), filepath.Base(fs.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.Path)
+}
@@ -0,0 +1,73 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var nilSet *Set
+	assert.True(nilSet.Enabled(HashOnlyEmission))
+	assert.False(nilSet.Enabled(PostEnrichment))
+
+	_, err := NewSet(map[string]bool{"no-such-flag": true}, nil)
+	assert.True(errors.Is(err, ErrUnknownFlag))
+
+	s, err := NewSet(map[string]bool{"post-enrichment": true}, nil)
+	assert.NoError(err)
+	assert.True(s.Enabled(HashOnlyEmission))
+	assert.True(s.Enabled(PostEnrichment))
+
+	assert.NoError(s.Override(ctx, HashOnlyEmission, false))
+	assert.NoError(s.Override(ctx, PostEnrichment, false))
+	assert.False(s.Enabled(HashOnlyEmission))
+	assert.False(s.Enabled(PostEnrichment))
+	states := s.States()
+	assert.Equal("hash-only-emission", states[HashOnlyEmission].Name)
+	assert.Equal(SourceOverride, states[HashOnlyEmission].Source)
+
+	// reset falls back to the configured value, then the default
+	assert.NoError(s.Reset(ctx, PostEnrichment))
+	assert.NoError(s.Reset(ctx, HashOnlyEmission))
+	assert.True(s.Enabled(PostEnrichment))
+	assert.True(s.Enabled(HashOnlyEmission))
+	states = s.States()
+	assert.Equal(SourceConfig, states[PostEnrichment].Source)
+	assert.Equal(SourceDefault, states[HashOnlyEmission].Source)
+}
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "features.json")
+	store := &FileStore{Path: path}
+
+	s, err := NewSet(nil, store)
+	assert.NoError(err)
+	assert.NoError(s.Load(ctx))
+	assert.NoError(s.Override(ctx, PostEnrichment, true))
+
+	// overrides survive a restart; unknown names in the file are ignored
+	assert.NoError(store.Put(ctx, "retired-flag", true))
+	s2, err := NewSet(nil, store)
+	assert.NoError(err)
+	assert.False(s2.Enabled(PostEnrichment))
+	assert.NoError(s2.Load(ctx))
+	assert.True(s2.Enabled(PostEnrichment))
+
+	assert.NoError(s2.Reset(ctx, PostEnrichment))
+	stored, err := store.Load(ctx)
+	assert.NoError(err)
+	assert.Equal(map[string]bool{"retired-flag": true}, stored)
+
+	assert.NoError(os.WriteFile(path, []byte("{"), 0o644))
+	assert.Error(s2.Load(ctx))
+}
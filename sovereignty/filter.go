@@ -0,0 +1,77 @@
+package sovereignty
+
+import "fmt"
+
+// FilterMode is how sure the sovereign stream filter must be of an account's country to carry its events.
+type FilterMode string
+
+const (
+	// carry accounts classified with any confidence, including weak signals
+	FilterBalanced FilterMode = "balanced"
+	// carry only accounts classified with at least medium confidence
+	FilterStrict FilterMode = "strict"
+)
+
+// ParseFilterMode parses a filter mode by name (balanced or strict)
+func ParseFilterMode(s string) (FilterMode, error) {
+	switch m := FilterMode(s); m {
+	case FilterBalanced, FilterStrict:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid filter mode: %q (must be balanced or strict)", s)
+	}
+}
+
+// Admits returns true if the mode carries accounts classified with the given confidence.
+func (m FilterMode) Admits(c Confidence) bool {
+	if m == FilterStrict {
+		return c >= ConfidenceMedium
+	}
+	return c >= ConfidenceLow
+}
+
+// Reasons for a filter result
+const (
+	// not about an account, such as info frames
+	FilterReasonNoAccount = "no_account"
+	FilterReasonPriority  = "priority"
+	// withheld for dominating the relay's traffic
+	FilterReasonLimited = "limited"
+	// on the operator's list of accounts in country, or out of country
+	FilterReasonListedIn     = "listed_in"
+	FilterReasonListedOut    = "listed_out"
+	FilterReasonUnclassified = "unclassified"
+	// not classified, and the country resolver couldn't place it when last asked: it didn't know the account, wasn't confident enough, or failed
+	FilterReasonUnresolved = "unresolved"
+	// classified into a country carried by the stream (or, when it excludes countries, one it doesn't exclude)
+	FilterReasonCountry = "country"
+	// classified into a subdivision carried by the stream, in a country it doesn't carry as a whole
+	FilterReasonSubdivision = "subdivision"
+	// classified into a country, or subdivision, the stream doesn't carry
+	FilterReasonOtherCountry = "other_country"
+	// classified into a country the stream excludes, when it carries all others
+	FilterReasonExcludedCountry = "excluded_country"
+	// classified into a carried country, but not confidently enough for the mode
+	FilterReasonLowConfidence = "low_confidence"
+	// a commit touching only collections outside the stream's NSID namespaces
+	FilterReasonNamespace = "namespace"
+	// left out for its posts declaring none of the language filter's languages, or carried for one declaring one of them
+	FilterReasonLanguage = "language"
+	// dropped by one of the operator's extensions, or kept or dropped by one classifying events in place of the geographic filter
+	FilterReasonExtension = "extension"
+	// dropped by the operator's filter plugin, or left to its fallback
+	FilterReasonPlugin = "plugin"
+	// carried whatever the filter decides, in shadow mode
+	FilterReasonShadow = "shadow"
+)
+
+// FilterResult is the sovereign stream filter's decision on an event.
+type FilterResult struct {
+	Include bool
+	// the event is not carried, but a stub of it is sent in its place: the commit's hash and sequence, without its blocks or ops, so consumers keep cursor continuity
+	HashOnly bool
+	// how sure the filter is of the account's country; ConfidenceHigh for decisions which don't depend on it
+	Confidence Confidence
+	// one of the FilterReason constants
+	Reason string
+}
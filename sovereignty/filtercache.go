@@ -0,0 +1,109 @@
+package sovereignty
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// FilterDecision is the outcome of resolving an unclassified account's country for the sovereign stream filter
+type FilterDecision struct {
+	// empty if the account couldn't be attributed to a country with enough confidence
+	Country    string     `json:"country,omitempty"`
+	Confidence Confidence `json:"confidence"`
+	Source     string     `json:"source,omitempty"`
+	// expiry of the classification applied for the decision, if any
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	DecidedAt time.Time  `json:"decidedAt"`
+}
+
+// Classification returns the classification applied for the decision, if the account was attributed to a country
+func (d *FilterDecision) Classification(did string) (Classification, bool) {
+	if d.Country == "" {
+		return Classification{}, false
+	}
+	return Classification{
+		DID:        did,
+		Country:    d.Country,
+		Source:     d.Source,
+		UpdatedAt:  d.DecidedAt,
+		ExpiresAt:  d.ExpiresAt,
+		Confidence: d.Confidence,
+	}, true
+}
+
+// FilterCache holds sovereign stream filter decisions, so that relay instances sharing a cache don't each resolve the same accounts. Get returns nil, without error, for accounts with no decision; a ttl of 0 keeps the decision until it is deleted or evicted.
+type FilterCache interface {
+	Get(ctx context.Context, did string) (*FilterDecision, error)
+	Set(ctx context.Context, did string, d FilterDecision, ttl time.Duration) error
+	Delete(ctx context.Context, did string) error
+}
+
+type memFilterEntry struct {
+	decision FilterDecision
+	expires  time.Time
+}
+
+// MemFilterCache is a FilterCache local to the process, holding up to a fixed number of decisions
+type MemFilterCache struct {
+	// time source for entry expiry; nil uses the system clock
+	Clock clock.Clock
+
+	data *lru.Cache[string, memFilterEntry]
+}
+
+var _ FilterCache = (*MemFilterCache)(nil)
+
+func NewMemFilterCache(capacity int) *MemFilterCache {
+	data, _ := lru.New[string, memFilterEntry](capacity)
+	return &MemFilterCache{data: data}
+}
+
+func (c *MemFilterCache) Get(ctx context.Context, did string) (*FilterDecision, error) {
+	ent, ok := c.data.Get(did)
+	if !ok {
+		return nil, nil
+	}
+	if !ent.expires.IsZero() && !clock.OrSystem(c.Clock).Now().Before(ent.expires) {
+		c.data.Remove(did)
+		return nil, nil
+	}
+	d := ent.decision
+	return &d, nil
+}
+
+func (c *MemFilterCache) Set(ctx context.Context, did string, d FilterDecision, ttl time.Duration) error {
+	ent := memFilterEntry{decision: d}
+	if ttl > 0 {
+		ent.expires = clock.OrSystem(c.Clock).Now().Add(ttl)
+	}
+	c.data.Add(did, ent)
+	return nil
+}
+
+func (c *MemFilterCache) Delete(ctx context.Context, did string) error {
+	c.data.Remove(did)
+	return nil
+}
+
+// Len returns the number of decisions held, including expired ones not yet looked up again
+func (c *MemFilterCache) Len() int {
+	return c.data.Len()
+}
+
+// Range calls fn with each unexpired decision held, and when it lapses (zero if it doesn't), from the least recently used, until fn returns false. Entries aren't marked as used.
+func (c *MemFilterCache) Range(fn func(did string, d FilterDecision, expires time.Time) bool) {
+	now := clock.OrSystem(c.Clock).Now()
+	for _, did := range c.data.Keys() {
+		ent, ok := c.data.Peek(did)
+		if !ok || (!ent.expires.IsZero() && !now.Before(ent.expires)) {
+			continue
+		}
+		if !fn(did, ent.decision, ent.expires) {
+			return
+		}
+	}
+}
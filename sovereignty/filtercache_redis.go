@@ -0,0 +1,63 @@
+package sovereignty
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisFilterCache is a FilterCache in Redis, shared by every relay instance configured with the same server and prefix, and kept across restarts
+type RedisFilterCache struct {
+	Client *redis.Client
+	// prepended to the DID to make each decision's key
+	Prefix string
+}
+
+var _ FilterCache = (*RedisFilterCache)(nil)
+
+// NewRedisFilterCache connects to the Redis server at redisURL (eg, "redis://localhost:6379/0"), and checks the connection
+func NewRedisFilterCache(redisURL string) (*RedisFilterCache, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opt)
+	// check redis connection
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		return nil, err
+	}
+	return &RedisFilterCache{
+		Client: rdb,
+		Prefix: "sovereignty/filter/",
+	}, nil
+}
+
+func (c *RedisFilterCache) Get(ctx context.Context, did string) (*FilterDecision, error) {
+	b, err := c.Client.Get(ctx, c.Prefix+did).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d FilterDecision
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *RedisFilterCache) Set(ctx context.Context, did string, d FilterDecision, ttl time.Duration) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, c.Prefix+did, b, ttl).Err()
+}
+
+func (c *RedisFilterCache) Delete(ctx context.Context, did string) error {
+	return c.Client.Del(ctx, c.Prefix+did).Err()
+}
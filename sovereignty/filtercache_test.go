@@ -0,0 +1,75 @@
+package sovereignty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// advance lets the cache's time move on, past entries' expiry
+func testFilterCache(t *testing.T, fc FilterCache, advance func(time.Duration)) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	did := "did:plc:filtercachetest"
+
+	d, err := fc.Get(ctx, did)
+	assert.NoError(err)
+	assert.Nil(d)
+
+	exp := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	decided := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(fc.Set(ctx, did, FilterDecision{Country: "CA", Confidence: ConfidenceMedium, Source: "pds", ExpiresAt: &exp, DecidedAt: decided}, time.Hour))
+	d, err = fc.Get(ctx, did)
+	assert.NoError(err)
+	if assert.NotNil(d) {
+		assert.Equal(ConfidenceMedium, d.Confidence)
+		cl, ok := d.Classification(did)
+		assert.True(ok)
+		assert.Equal("CA", cl.Country)
+		assert.Equal("pds", cl.Source)
+		assert.True(exp.Equal(*cl.ExpiresAt))
+		assert.True(decided.Equal(cl.UpdatedAt))
+	}
+
+	// no country attributed
+	assert.NoError(fc.Set(ctx, did, FilterDecision{Confidence: ConfidenceLow, DecidedAt: decided}, time.Hour))
+	d, err = fc.Get(ctx, did)
+	assert.NoError(err)
+	if assert.NotNil(d) {
+		_, ok := d.Classification(did)
+		assert.False(ok)
+		assert.Equal(ConfidenceLow, d.Confidence)
+	}
+
+	assert.NoError(fc.Delete(ctx, did))
+	d, err = fc.Get(ctx, did)
+	assert.NoError(err)
+	assert.Nil(d)
+
+	assert.NoError(fc.Set(ctx, did, FilterDecision{DecidedAt: decided}, 10*time.Millisecond))
+	advance(20 * time.Millisecond)
+	d, err = fc.Get(ctx, did)
+	assert.NoError(err)
+	assert.Nil(d)
+}
+
+func TestMemFilterCache(t *testing.T) {
+	clk := clock.NewMock(time.Now())
+	fc := NewMemFilterCache(100)
+	fc.Clock = clk
+	testFilterCache(t, fc, clk.Advance)
+}
+
+func TestRedisFilterCache(t *testing.T) {
+	t.Skip("live test, need redis running locally")
+
+	fc, err := NewRedisFilterCache("redis://localhost:6379/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFilterCache(t, fc, time.Sleep)
+}
@@ -0,0 +1,336 @@
+package filterplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/extension"
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned, with the fallback, while the plugin isn't being asked after failing.
+var ErrCircuitOpen = errors.New("filter plugin is failing")
+
+// What becomes of events the plugin can't decide on.
+const (
+	FallbackKeep = "keep"
+	FallbackDrop = "drop"
+)
+
+// Circuit states.
+const (
+	CircuitClosed = "closed"
+	CircuitOpen   = "open"
+	// the cooldown is over, and a call is trying the plugin again
+	CircuitHalfOpen = "half_open"
+)
+
+type Options struct {
+	// gRPC target of the plugin, eg "localhost:7400" or "unix:///run/relay-filter.sock"
+	Target string
+	// connect with TLS, checking the plugin's certificate against the system roots; otherwise connections are in plaintext, for plugins on the same host or a private network
+	TLS bool
+	// connections kept to the plugin, calls being spread over them in turn
+	Conns int
+	// longest a call to the plugin may take
+	Timeout time.Duration
+	// what becomes of events the plugin can't decide on, because it failed, timed out or isn't being asked: FallbackKeep or FallbackDrop
+	Fallback string
+	// failed calls in a row at which the circuit opens
+	Failures int
+	// how long the plugin isn't asked once the circuit opens
+	Cooldown time.Duration
+	// accounts whose Classify decisions are cached, the least recently used being dropped beyond this
+	CacheSize int
+	// looks up the classification of an account, which the plugin is told with its requests; nil leaves it out
+	Classify func(did string) (sovereignty.Classification, bool)
+	// time source for the cache and circuit; nil uses the system clock
+	Clock clock.Clock
+	// appended to the client's own dial options, eg to dial through a custom dialer
+	DialOptions []grpc.DialOption
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Conns:     4,
+		Timeout:   50 * time.Millisecond,
+		Fallback:  FallbackKeep,
+		Failures:  5,
+		Cooldown:  10 * time.Second,
+		CacheSize: 100_000,
+	}
+}
+
+// Status is the circuit's state, for operators.
+type Status struct {
+	// one of the Circuit states
+	Circuit string `json:"circuit"`
+	// failed calls in a row
+	Failures int `json:"failures"`
+	// when the plugin will be tried again, while the circuit is open
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+	// accounts with cached Classify decisions
+	Cached int `json:"cached"`
+	// whether the plugin implements each call; false once it has answered UNIMPLEMENTED
+	Classify      bool `json:"classify"`
+	ClassifyEvent bool `json:"classifyEvent"`
+}
+
+type cachedDecision struct {
+	decision *Decision
+	expires  time.Time
+}
+
+// Client asks a filter plugin about events, over a pool of connections. It is safe for concurrent use.
+type Client struct {
+	opts  Options
+	clock clock.Clock
+	conns []*grpc.ClientConn
+	// a stub for each connection
+	clients []FilterClient
+	next    atomic.Uint64
+	cache   *lru.Cache[string, cachedDecision]
+
+	// set once the plugin answers UNIMPLEMENTED to a call, so it isn't asked again
+	noClassify      atomic.Bool
+	noClassifyEvent atomic.Bool
+
+	lk        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// a call is trying the plugin after the cooldown
+	probing bool
+}
+
+// NewClient sets up the connections to the plugin, which are made in the background: a plugin which isn't up yet fails calls, which take the fallback, until it is.
+func NewClient(opts Options) (*Client, error) {
+	if opts.Target == "" {
+		return nil, errors.New("filter plugin target is required")
+	}
+	if opts.Fallback != FallbackKeep && opts.Fallback != FallbackDrop {
+		return nil, fmt.Errorf("invalid filter plugin fallback: %q (must be keep or drop)", opts.Fallback)
+	}
+	cache, err := lru.New[string, cachedDecision](max(opts.CacheSize, 1))
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if opts.TLS {
+		creds = credentials.NewTLS(nil)
+	}
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts.DialOptions...)
+
+	c := &Client{
+		opts:  opts,
+		clock: clock.OrSystem(opts.Clock),
+		cache: cache,
+	}
+	for range max(opts.Conns, 1) {
+		conn, err := grpc.Dial(opts.Target, dialOpts...)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("dialing filter plugin: %w", err)
+		}
+		c.conns = append(c.conns, conn)
+		c.clients = append(c.clients, NewFilterClient(conn))
+	}
+	return c, nil
+}
+
+// Close closes the connections to the plugin.
+func (c *Client) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Filter asks the plugin whether the event stays on the stream: first about its account, from the cache if the plugin's last answer still holds, then, if the plugin abstains on the account, about the event itself. Events not about an account, and those the plugin abstains on, are kept. If the plugin can't decide, the fallback is returned, with the error.
+func (c *Client) Filter(ctx context.Context, evt *events.XRPCStreamEvent) (bool, error) {
+	simple := extension.SimplifyEvent(evt, c.opts.Classify)
+	if simple == nil {
+		return true, nil
+	}
+	d, err := c.decide(ctx, simple)
+	if err != nil {
+		return c.opts.Fallback == FallbackKeep, err
+	}
+	return d.Verdict != Verdict_VERDICT_DROP, nil
+}
+
+func (c *Client) decide(ctx context.Context, evt *sdk.Event) (*Decision, error) {
+	if !c.noClassify.Load() {
+		d, err := c.classify(ctx, evt)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil && d.Verdict != Verdict_VERDICT_ABSTAIN {
+			return d, nil
+		}
+	}
+	if c.noClassifyEvent.Load() {
+		return &Decision{}, nil
+	}
+	d, err := c.call(ctx, "classify_event", func(ctx context.Context, fc FilterClient) (*Decision, error) {
+		return fc.ClassifyEvent(ctx, newEvent(evt))
+	})
+	if status.Code(err) == codes.Unimplemented {
+		c.noClassifyEvent.Store(true)
+		return &Decision{}, nil
+	}
+	return d, err
+}
+
+// classify returns the plugin's decision on the event's account, or nil if it doesn't implement Classify
+func (c *Client) classify(ctx context.Context, evt *sdk.Event) (*Decision, error) {
+	if cd, ok := c.cache.Get(evt.DID); ok && c.clock.Now().Before(cd.expires) {
+		callsCounter.WithLabelValues("classify", "cached").Inc()
+		return cd.decision, nil
+	}
+	req := &ClassifyRequest{Did: evt.DID, Country: evt.Country, Subdivision: evt.Subdivision}
+	d, err := c.call(ctx, "classify", func(ctx context.Context, fc FilterClient) (*Decision, error) {
+		return fc.Classify(ctx, req)
+	})
+	if status.Code(err) == codes.Unimplemented {
+		c.noClassify.Store(true)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.TtlSeconds > 0 {
+		ttl := time.Duration(d.TtlSeconds) * time.Second
+		c.cache.Add(evt.DID, cachedDecision{decision: d, expires: c.clock.Now().Add(ttl)})
+	}
+	return d, nil
+}
+
+// call makes one call to the plugin, named name in metrics, on the next connection of the pool, within the timeout
+func (c *Client) call(ctx context.Context, name string, invoke func(ctx context.Context, fc FilterClient) (*Decision, error)) (*Decision, error) {
+	if !c.allow() {
+		callsCounter.WithLabelValues(name, "circuit_open").Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	callCtx := ctx
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	fc := c.clients[c.next.Add(1)%uint64(len(c.clients))]
+	start := time.Now()
+	d, err := invoke(callCtx, fc)
+	callDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err == nil && (d.Verdict < Verdict_VERDICT_ABSTAIN || d.Verdict > Verdict_VERDICT_DROP) {
+		err = fmt.Errorf("filter plugin answered an unknown %s", verdictLabel(d.Verdict))
+	}
+
+	switch {
+	case err == nil:
+		c.succeeded()
+		callsCounter.WithLabelValues(name, verdictLabel(d.Verdict)).Inc()
+		return d, nil
+	case status.Code(err) == codes.Unimplemented:
+		// the plugin is up, and only decides the other way
+		c.succeeded()
+		callsCounter.WithLabelValues(name, "unimplemented").Inc()
+		return nil, err
+	case ctx.Err() != nil:
+		// given up by the caller, which says nothing of the plugin
+		c.abandoned()
+		return nil, err
+	case callCtx.Err() != nil || status.Code(err) == codes.DeadlineExceeded:
+		c.failed()
+		callsCounter.WithLabelValues(name, "timeout").Inc()
+		return nil, fmt.Errorf("filter plugin timed out: %w", err)
+	default:
+		c.failed()
+		callsCounter.WithLabelValues(name, "error").Inc()
+		return nil, fmt.Errorf("filter plugin: %w", err)
+	}
+}
+
+// allow reports whether the plugin may be asked now
+func (c *Client) allow() bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.openUntil.IsZero() {
+		return true
+	}
+	if c.probing || c.clock.Now().Before(c.openUntil) {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+func (c *Client) succeeded() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.failures = 0
+	c.openUntil = time.Time{}
+	c.probing = false
+}
+
+func (c *Client) failed() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.failures++
+	if c.probing || (c.openUntil.IsZero() && c.failures >= max(c.opts.Failures, 1)) {
+		if c.openUntil.IsZero() {
+			circuitOpenedCounter.Inc()
+		}
+		c.openUntil = c.clock.Now().Add(c.opts.Cooldown)
+	}
+	c.probing = false
+}
+
+func (c *Client) abandoned() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.probing = false
+}
+
+// Forget drops the cached decision on an account, so the plugin is asked again about its next event.
+func (c *Client) Forget(did string) {
+	c.cache.Remove(did)
+}
+
+// Status reports the circuit's state, and which calls the plugin implements.
+func (c *Client) Status() Status {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	st := Status{
+		Circuit:       CircuitClosed,
+		Failures:      c.failures,
+		Cached:        c.cache.Len(),
+		Classify:      !c.noClassify.Load(),
+		ClassifyEvent: !c.noClassifyEvent.Load(),
+	}
+	if !c.openUntil.IsZero() {
+		st.Circuit = CircuitOpen
+		if c.probing || !c.clock.Now().Before(c.openUntil) {
+			st.Circuit = CircuitHalfOpen
+		} else {
+			until := c.openUntil.UTC()
+			st.OpenUntil = &until
+		}
+	}
+	return st
+}
@@ -0,0 +1,8 @@
+// Filtering decisions on the sovereign stream by an external service, over gRPC.
+//
+// Where WebAssembly extensions (the extension package) suit small self-contained rules, a filter plugin is a service of its own, in any language with gRPC support, implementing the Filter service in filter.proto: Classify decides on all of an account's events at once, optionally for a while (ttl_seconds), and ClassifyEvent on a single event, in the simplified form extensions see. A plugin may implement either or both; the relay asks Classify first, then ClassifyEvent about the events of accounts Classify abstains on, and stops asking a call the plugin answers UNIMPLEMENTED. The relay only asks about events its own filter and extensions carry, and a plugin can only drop them.
+//
+// A Client keeps a pool of connections to the plugin, spreading calls over them. Each call is limited to Timeout; a plugin which fails, times out or answers with an unknown verdict leaves the event to the Fallback, keeping or dropping it. A circuit breaker stops asking the plugin for Cooldown once Failures calls in a row have failed, applying the fallback without waiting on a plugin which is down; after the cooldown, a single call tries it again, closing the circuit if it succeeds.
+//
+// The messages and service stubs are generated from filter.proto (see filter.go to regenerate them); plugins written in Go can implement FilterServer, embedding UnimplementedFilterServer, and register it with RegisterFilterServer.
+package filterplugin
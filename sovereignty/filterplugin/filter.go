@@ -0,0 +1,38 @@
+package filterplugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative filter.proto
+
+// newEvent is the wire form of an event, as extensions see it
+func newEvent(evt *sdk.Event) *Event {
+	out := &Event{
+		Kind:        evt.Kind,
+		Seq:         evt.Seq,
+		Did:         evt.DID,
+		Time:        evt.Time,
+		Country:     evt.Country,
+		Subdivision: evt.Subdivision,
+		Rev:         evt.Rev,
+		Handle:      evt.Handle,
+		Active:      evt.Active,
+		Status:      evt.Status,
+	}
+	for _, op := range evt.Ops {
+		out.Ops = append(out.Ops, &Op{Action: op.Action, Path: op.Path, Cid: op.CID})
+	}
+	return out
+}
+
+// verdictLabel names a verdict in metrics and errors: "abstain", "keep" or "drop"
+func verdictLabel(v Verdict) string {
+	if name, ok := Verdict_name[int32(v)]; ok {
+		return strings.ToLower(strings.TrimPrefix(name, "VERDICT_"))
+	}
+	return fmt.Sprintf("verdict(%d)", int32(v))
+}
@@ -0,0 +1,239 @@
+package filterplugin
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/extension/sdk"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// testPlugin drops accounts in "XX" for an hour, and otherwise decides on events by kind
+type testPlugin struct {
+	UnimplementedFilterServer
+
+	lk       sync.Mutex
+	accounts int
+	events   int
+	delay    time.Duration
+	byEvent  bool
+}
+
+func (p *testPlugin) Classify(ctx context.Context, req *ClassifyRequest) (*Decision, error) {
+	p.lk.Lock()
+	p.accounts++
+	p.lk.Unlock()
+	if p.byEvent {
+		return p.UnimplementedFilterServer.Classify(ctx, req)
+	}
+	if req.Country == "XX" {
+		return &Decision{Verdict: Verdict_VERDICT_DROP, Reason: "country", TtlSeconds: 3600}, nil
+	}
+	return &Decision{Verdict: Verdict_VERDICT_ABSTAIN, TtlSeconds: 3600}, nil
+}
+
+func (p *testPlugin) ClassifyEvent(ctx context.Context, evt *Event) (*Decision, error) {
+	p.lk.Lock()
+	p.events++
+	delay := p.delay
+	p.lk.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if evt.Kind == sdk.KindIdentity && evt.Handle == "spam.example.com" {
+		return &Decision{Verdict: Verdict_VERDICT_DROP, Reason: "handle"}, nil
+	}
+	return &Decision{}, nil
+}
+
+func (p *testPlugin) counts() (int, int) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.accounts, p.events
+}
+
+func startPlugin(t *testing.T, p FilterServer, opts Options) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterFilterServer(srv, p)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	opts.Target = "bufnet"
+	opts.DialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})}
+	c, err := NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func identity(did, handle string) *events.XRPCStreamEvent {
+	return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Handle: &handle}}
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	p := &testPlugin{}
+	opts := DefaultOptions()
+	opts.Timeout = 5 * time.Second
+	opts.Classify = func(did string) (sovereignty.Classification, bool) {
+		if did == "did:plc:away" {
+			return sovereignty.Classification{DID: did, Country: "XX"}, true
+		}
+		return sovereignty.Classification{}, false
+	}
+	c := startPlugin(t, p, opts)
+
+	keep, err := c.Filter(ctx, identity("did:plc:away", "away.example.com"))
+	assert.NoError(err)
+	assert.False(keep)
+	// the account's decision holds for its later events
+	keep, err = c.Filter(ctx, identity("did:plc:away", "away.example.com"))
+	assert.NoError(err)
+	assert.False(keep)
+	accounts, evts := p.counts()
+	assert.Equal(1, accounts)
+	assert.Equal(0, evts)
+
+	// abstaining on the account passes its events on
+	keep, err = c.Filter(ctx, identity("did:plc:home", "home.example.com"))
+	assert.NoError(err)
+	assert.True(keep)
+	keep, err = c.Filter(ctx, identity("did:plc:home", "spam.example.com"))
+	assert.NoError(err)
+	assert.False(keep)
+	accounts, evts = p.counts()
+	assert.Equal(2, accounts)
+	assert.Equal(2, evts)
+
+	keep, err = c.Filter(ctx, &events.XRPCStreamEvent{})
+	assert.NoError(err)
+	assert.True(keep)
+	assert.Equal(CircuitClosed, c.Status().Circuit)
+	assert.Equal(2, c.Status().Cached)
+}
+
+func TestFilterUnimplemented(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	p := &testPlugin{byEvent: true}
+	opts := DefaultOptions()
+	opts.Timeout = 5 * time.Second
+	c := startPlugin(t, p, opts)
+
+	for _, handle := range []string{"a.example.com", "spam.example.com", "b.example.com"} {
+		keep, err := c.Filter(ctx, identity("did:plc:home", handle))
+		assert.NoError(err)
+		assert.Equal(handle != "spam.example.com", keep)
+	}
+	accounts, evts := p.counts()
+	assert.Equal(1, accounts)
+	assert.Equal(3, evts)
+	st := c.Status()
+	assert.False(st.Classify)
+	assert.True(st.ClassifyEvent)
+}
+
+func TestFilterFallback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	clk := clock.NewMock(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	p := &testPlugin{byEvent: true}
+	opts := DefaultOptions()
+	opts.Timeout = 10 * time.Millisecond
+	opts.Failures = 2
+	opts.Cooldown = time.Minute
+	opts.Fallback = FallbackDrop
+	opts.Clock = clk
+	c := startPlugin(t, p, opts)
+
+	// learn that the plugin only decides on events, before it slows down
+	_, err := c.Filter(ctx, identity("did:plc:home", "a.example.com"))
+	assert.NoError(err)
+	p.lk.Lock()
+	p.delay = time.Second
+	p.lk.Unlock()
+
+	for range 2 {
+		keep, err := c.Filter(ctx, identity("did:plc:home", "a.example.com"))
+		assert.ErrorContains(err, "timed out")
+		assert.False(keep)
+	}
+	assert.Equal(CircuitOpen, c.Status().Circuit)
+	_, evts := p.counts()
+
+	// not asked while the circuit is open
+	keep, err := c.Filter(ctx, identity("did:plc:home", "a.example.com"))
+	assert.ErrorIs(err, ErrCircuitOpen)
+	assert.False(keep)
+	_, after := p.counts()
+	assert.Equal(evts, after)
+
+	// tried again after the cooldown
+	p.lk.Lock()
+	p.delay = 0
+	p.lk.Unlock()
+	clk.Advance(time.Minute)
+	assert.Equal(CircuitHalfOpen, c.Status().Circuit)
+	keep, err = c.Filter(ctx, identity("did:plc:home", "a.example.com"))
+	assert.NoError(err)
+	assert.True(keep)
+	assert.Equal(CircuitClosed, c.Status().Circuit)
+
+	_, err = NewClient(Options{Target: "bufnet", Fallback: "maybe"})
+	assert.ErrorContains(err, "invalid filter plugin fallback")
+}
+
+func TestEvent(t *testing.T) {
+	assert := assert.New(t)
+	active := false
+	in := &sdk.Event{
+		Kind:    sdk.KindCommit,
+		Seq:     1 << 40,
+		DID:     "did:plc:abc",
+		Country: "CA",
+		Rev:     "3k2a",
+		Ops: []sdk.Op{
+			{Action: "create", Path: "app.bsky.feed.post/1", CID: "bafy"},
+			{Action: "delete", Path: "app.bsky.feed.post/2"},
+		},
+		Active: &active,
+	}
+
+	b, err := proto.Marshal(newEvent(in))
+	assert.NoError(err)
+	var out Event
+	assert.NoError(proto.Unmarshal(b, &out))
+	assert.Equal(int64(1<<40), out.Seq)
+	assert.Equal("did:plc:abc", out.Did)
+	assert.Len(out.Ops, 2)
+	assert.Equal("bafy", out.Ops[0].Cid)
+	// optional, so present even when false
+	if assert.NotNil(out.Active) {
+		assert.False(*out.Active)
+	}
+
+	assert.Equal("drop", verdictLabel(Verdict_VERDICT_DROP))
+	assert.Equal("verdict(7)", verdictLabel(Verdict(7)))
+}
@@ -0,0 +1,22 @@
+package filterplugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var callsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "filter_plugin_calls_total",
+	Help: "Calls to the filter plugin, by call (classify or classify_event) and result (keep, drop, abstain, cached, unimplemented, timeout, error, or circuit_open for calls not made, the plugin having failed)",
+}, []string{"call", "result"})
+
+var callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "filter_plugin_call_duration_seconds",
+	Help:    "Time taken by calls to the filter plugin, by call",
+	Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+}, []string{"call"})
+
+var circuitOpenedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "filter_plugin_circuit_opened_total",
+	Help: "Times the filter plugin failed often enough that the relay stopped asking it for a while",
+})
@@ -0,0 +1,91 @@
+package sovereignty
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FilterStateVersion is bumped on any incompatible change to the filter state format.
+const FilterStateVersion = 1
+
+// FilterStateHeader is the first line of a filter state snapshot.
+type FilterStateHeader struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// FilterStateEntry is what the sovereign stream filter knows about one account, in a filter state snapshot. Each field is absent if it knows nothing of that kind.
+type FilterStateEntry struct {
+	DID            string          `json:"did"`
+	Classification *Classification `json:"classification,omitempty"`
+	// the filter cache's decision on the account, and when it lapses; no expiry if it lasts until evicted
+	Decision          *FilterDecision `json:"decision,omitempty"`
+	DecisionExpiresAt *time.Time      `json:"decisionExpiresAt,omitempty"`
+	// when the country resolver was last asked about the account
+	TriedAt *time.Time `json:"triedAt,omitempty"`
+	// when the country resolver last couldn't place it
+	UnresolvedAt *time.Time `json:"unresolvedAt,omitempty"`
+}
+
+// FilterStateWriter writes a filter state snapshot: JSON lines, a FilterStateHeader followed by one FilterStateEntry per account.
+type FilterStateWriter struct {
+	enc *json.Encoder
+}
+
+// NewFilterStateWriter writes the snapshot header, and returns a writer for its entries.
+func NewFilterStateWriter(w io.Writer, exportedAt time.Time) (*FilterStateWriter, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(FilterStateHeader{Version: FilterStateVersion, ExportedAt: exportedAt.UTC()}); err != nil {
+		return nil, err
+	}
+	return &FilterStateWriter{enc: enc}, nil
+}
+
+func (fw *FilterStateWriter) Write(e FilterStateEntry) error {
+	return fw.enc.Encode(e)
+}
+
+// ReadFilterState reads a filter state snapshot, passing each entry to fn. Snapshots of another version are rejected before any entry is read.
+func ReadFilterState(r io.Reader, fn func(FilterStateEntry) error) (*FilterStateHeader, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var hdr *FilterStateHeader
+	line := 0
+	for sc.Scan() {
+		line++
+		b := sc.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		if hdr == nil {
+			hdr = &FilterStateHeader{}
+			if err := json.Unmarshal(b, hdr); err != nil {
+				return nil, fmt.Errorf("invalid filter state header: %w", err)
+			}
+			if hdr.Version != FilterStateVersion {
+				return nil, fmt.Errorf("unsupported filter state version %d (expected %d)", hdr.Version, FilterStateVersion)
+			}
+			continue
+		}
+		var e FilterStateEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return hdr, fmt.Errorf("invalid filter state entry on line %d: %w", line, err)
+		}
+		if e.DID == "" {
+			return hdr, fmt.Errorf("filter state entry without a DID on line %d", line)
+		}
+		if err := fn(e); err != nil {
+			return hdr, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return hdr, err
+	}
+	if hdr == nil {
+		return nil, fmt.Errorf("empty filter state snapshot")
+	}
+	return hdr, nil
+}
@@ -0,0 +1,298 @@
+package flapping
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// most results remembered per account, however many fall within the window
+const maxHistory = 32
+
+type Options struct {
+	// changes of country or subdivision within Window at which an account is flapping
+	Changes int
+	Window  time.Duration
+	// how long a flapping account's classification is held; 0 reports flapping without damping it
+	HoldDown time.Duration
+	// accounts whose recent classifications are remembered
+	Size int
+	// time source for the window and hold-down; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Changes:  3,
+		Window:   time.Hour,
+		HoldDown: 6 * time.Hour,
+		Size:     100_000,
+	}
+}
+
+// Result is a classification an account had, from when it was applied.
+type Result struct {
+	Country     string                 `json:"country"`
+	Subdivision string                 `json:"subdivision,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+	Confidence  sovereignty.Confidence `json:"confidence,omitempty"`
+	At          time.Time              `json:"at"`
+}
+
+// Status is an account's recent classification history, and whether it is flapping.
+type Status struct {
+	DID string `json:"did"`
+	// oldest first: the classification the account had when it was first seen changing, then each change since, back to the start of the window
+	History []Result `json:"history"`
+	// changes within the window
+	Changes  int  `json:"changes"`
+	Flapping bool `json:"flapping"`
+	// the classification the account is held at, and until when
+	Held      *sovereignty.Classification `json:"held,omitempty"`
+	HeldUntil *time.Time                  `json:"heldUntil,omitempty"`
+}
+
+type state struct {
+	history   []Result
+	flapping  bool
+	held      *sovereignty.Classification
+	heldUntil time.Time
+}
+
+// Detector tracks accounts' classification changes, reports the accounts flapping, and holds their classifications. It is safe for concurrent use.
+type Detector struct {
+	opts  Options
+	clock clock.Clock
+
+	lk       sync.Mutex
+	accounts *lru.Cache[string, *state]
+}
+
+func NewDetector(opts Options) *Detector {
+	accounts, _ := lru.New[string, *state](max(opts.Size, 1))
+	return &Detector{
+		opts:     opts,
+		clock:    clock.OrSystem(opts.Clock),
+		accounts: accounts,
+	}
+}
+
+func sameRegion(a, b sovereignty.Classification) bool {
+	return a.Country == b.Country && a.Subdivision == b.Subdivision
+}
+
+func resultOf(c sovereignty.Classification, at time.Time) Result {
+	return Result{Country: c.Country, Subdivision: c.Subdivision, Source: c.Source, Confidence: c.Confidence, At: at}
+}
+
+// Observe records a classification applied to an account, which had prev (nil if it had none, or its classification lapsed), and reports whether the account is flapping. A manual classification (by an operator) releases any hold, and becomes the held classification if the account is flapping. Otherwise, if the account is held and c is not its held classification, or the change starts a hold at another classification, hold is the classification to go back to.
+func (d *Detector) Observe(prev *sovereignty.Classification, c sovereignty.Classification, manual bool) (flapping bool, hold *sovereignty.Classification) {
+	now := d.clock.Now()
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	st, ok := d.accounts.Get(c.DID)
+	switch {
+	case ok:
+		last := st.history[len(st.history)-1]
+		if prev == nil {
+			prev = &sovereignty.Classification{Country: last.Country, Subdivision: last.Subdivision}
+		}
+	case prev == nil:
+		return false, nil
+	}
+	if sameRegion(*prev, c) {
+		return ok && st.flapping, nil
+	}
+	if !ok {
+		st = &state{history: []Result{resultOf(*prev, prev.UpdatedAt)}}
+		d.accounts.Add(c.DID, st)
+	}
+	d.expireHold(st, now)
+	if manual {
+		st.held = nil
+	} else if st.held != nil && sameRegion(*st.held, c) {
+		// going back to the held classification
+		return st.flapping, nil
+	}
+
+	st.history = append(st.history, resultOf(c, now))
+	d.prune(st, now)
+	flapping = d.changes(st, now) >= d.opts.Changes
+	if flapping && !st.flapping {
+		detectedCounter.Inc()
+	}
+	st.flapping = flapping
+	if !flapping || d.opts.HoldDown <= 0 {
+		return flapping, nil
+	}
+
+	switch {
+	case manual:
+		held := c
+		st.held = &held
+		st.heldUntil = now.Add(d.opts.HoldDown)
+	case st.held == nil:
+		held := d.pick(c.DID, st, now)
+		st.held = &held
+		st.heldUntil = now.Add(d.opts.HoldDown)
+	case c.Assurance() > st.held.Assurance():
+		// a more confident answer replaces the held one
+		held := c
+		st.held = &held
+	}
+	if sameRegion(*st.held, c) {
+		return true, nil
+	}
+	h := *st.held
+	return true, &h
+}
+
+// Lapsed remembers the classification an account had when it expired, so the classification it is next resolved to is compared with it.
+func (d *Detector) Lapsed(c sovereignty.Classification) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	st, ok := d.accounts.Peek(c.DID)
+	if !ok {
+		d.accounts.Add(c.DID, &state{history: []Result{resultOf(c, c.UpdatedAt)}})
+		return
+	}
+	if last := st.history[len(st.history)-1]; last.Country != c.Country || last.Subdivision != c.Subdivision {
+		st.history = append(st.history, resultOf(c, c.UpdatedAt))
+	}
+}
+
+// Damp reports whether an automatic change of an account's classification to c should be suppressed, as the account is held at a classification at least as confident. It returns the held classification.
+func (d *Detector) Damp(c sovereignty.Classification) (sovereignty.Classification, bool) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	st, ok := d.accounts.Peek(c.DID)
+	if !ok {
+		return sovereignty.Classification{}, false
+	}
+	d.expireHold(st, d.clock.Now())
+	if st.held == nil || sameRegion(*st.held, c) || c.Assurance() > st.held.Assurance() {
+		return sovereignty.Classification{}, false
+	}
+	dampedCounter.Inc()
+	return *st.held, true
+}
+
+// Release ends any hold on the account's classification, and forgets its changes, so it is only held again if it goes on flapping.
+func (d *Detector) Release(did string) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if st, ok := d.accounts.Peek(did); ok {
+		st.held = nil
+		st.flapping = false
+		st.history = st.history[len(st.history)-1:]
+	}
+}
+
+// Get returns the account's status, if it has changed classification recently.
+func (d *Detector) Get(did string) (Status, bool) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	st, ok := d.accounts.Peek(did)
+	if !ok {
+		return Status{}, false
+	}
+	return d.status(did, st, d.clock.Now()), true
+}
+
+// Flapping returns the accounts which are flapping or held, by most changes.
+func (d *Detector) Flapping() []Status {
+	d.lk.Lock()
+	now := d.clock.Now()
+	var out []Status
+	for _, did := range d.accounts.Keys() {
+		st, ok := d.accounts.Peek(did)
+		if !ok {
+			continue
+		}
+		if s := d.status(did, st, now); s.Flapping || s.Held != nil {
+			out = append(out, s)
+		}
+	}
+	d.lk.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Changes != out[j].Changes {
+			return out[i].Changes > out[j].Changes
+		}
+		return out[i].DID < out[j].DID
+	})
+	return out
+}
+
+// status reports an account's state as of now. Must be called with d.lk held
+func (d *Detector) status(did string, st *state, now time.Time) Status {
+	d.expireHold(st, now)
+	d.prune(st, now)
+	n := d.changes(st, now)
+	s := Status{
+		DID:      did,
+		History:  append([]Result{}, st.history...),
+		Changes:  n,
+		Flapping: n >= d.opts.Changes,
+	}
+	if st.held != nil {
+		held := *st.held
+		until := st.heldUntil
+		s.Held = &held
+		s.HeldUntil = &until
+	}
+	return s
+}
+
+func (d *Detector) expireHold(st *state, now time.Time) {
+	if st.held != nil && !now.Before(st.heldUntil) {
+		st.held = nil
+	}
+}
+
+// prune forgets the results which were replaced before the window
+func (d *Detector) prune(st *state, now time.Time) {
+	start := now.Add(-d.opts.Window)
+	for len(st.history) > 1 && (st.history[1].At.Before(start) || len(st.history) > maxHistory) {
+		st.history = st.history[1:]
+	}
+}
+
+// changes counts the changes within the window
+func (d *Detector) changes(st *state, now time.Time) int {
+	start := now.Add(-d.opts.Window)
+	n := 0
+	for _, r := range st.history[1:] {
+		if !r.At.Before(start) {
+			n++
+		}
+	}
+	return n
+}
+
+// pick chooses the classification to hold a flapping account at: the most confident of its recent results, then the one which stood longest, then the latest
+func (d *Detector) pick(did string, st *state, now time.Time) sovereignty.Classification {
+	best, bestStood := -1, time.Duration(0)
+	var bestConf sovereignty.Confidence
+	for i, r := range st.history {
+		end := now
+		if i+1 < len(st.history) {
+			end = st.history[i+1].At
+		}
+		stood := end.Sub(r.At)
+		conf := sovereignty.Classification{Confidence: r.Confidence}.Assurance()
+		if best < 0 || conf > bestConf || (conf == bestConf && stood >= bestStood) {
+			best, bestStood, bestConf = i, stood, conf
+		}
+	}
+	r := st.history[best]
+	return sovereignty.Classification{DID: did, Country: r.Country, Subdivision: r.Subdivision, Source: r.Source, Confidence: r.Confidence}
+}
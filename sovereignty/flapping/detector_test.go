@@ -0,0 +1,115 @@
+package flapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	opts := DefaultOptions()
+	opts.Clock = clk
+	d := NewDetector(opts)
+
+	cl := func(did, country string, conf sovereignty.Confidence) sovereignty.Classification {
+		return sovereignty.Classification{DID: did, Country: country, Source: "pds-geo", Confidence: conf, UpdatedAt: clk.Now()}
+	}
+	// apply runs an automatic change past the detector, returning the classification the account ends up with
+	apply := func(prev, c sovereignty.Classification) (sovereignty.Classification, bool) {
+		clk.Advance(time.Minute)
+		if held, damped := d.Damp(c); damped {
+			return held, false
+		}
+		flapping, hold := d.Observe(&prev, c, false)
+		if hold != nil {
+			return *hold, flapping
+		}
+		return c, flapping
+	}
+
+	// changes further apart than the window aren't flapping
+	steady := cl("did:plc:steady", "CA", sovereignty.ConfidenceMedium)
+	for _, country := range []string{"US", "CA", "US"} {
+		clk.Advance(opts.Window)
+		next := cl("did:plc:steady", country, sovereignty.ConfidenceMedium)
+		flapping, hold := d.Observe(&steady, next, false)
+		assert.False(flapping)
+		assert.Nil(hold)
+		steady = next
+	}
+
+	// a change across a lapsed classification counts
+	d.Lapsed(cl("did:plc:lapsed", "CA", sovereignty.ConfidenceMedium))
+	d.Observe(nil, cl("did:plc:lapsed", "US", sovereignty.ConfidenceMedium), false)
+	st, ok := d.Get("did:plc:lapsed")
+	assert.True(ok)
+	assert.Equal(1, st.Changes)
+
+	// the account stood in CA with medium confidence, then a weaker signal disagreed
+	cur := cl("did:plc:flappy", "CA", sovereignty.ConfidenceMedium)
+	cur, flapping := apply(cur, cl("did:plc:flappy", "US", sovereignty.ConfidenceLow))
+	assert.False(flapping)
+	cur, _ = apply(cur, cl("did:plc:flappy", "CA", sovereignty.ConfidenceMedium))
+	cur, flapping = apply(cur, cl("did:plc:flappy", "US", sovereignty.ConfidenceLow))
+	assert.True(flapping)
+	// held at the more confident, longer standing result
+	assert.Equal("CA", cur.Country)
+	st, ok = d.Get("did:plc:flappy")
+	assert.True(ok)
+	assert.Equal(3, st.Changes)
+	if assert.NotNil(st.Held) {
+		assert.Equal("CA", st.Held.Country)
+		assert.Equal(start.Add(3*opts.Window+3*time.Minute+opts.HoldDown), *st.HeldUntil)
+	}
+
+	// going back to the held classification isn't another change, and the weaker answer is now damped
+	_, hold := d.Observe(&sovereignty.Classification{DID: "did:plc:flappy", Country: "US"}, cur, false)
+	assert.Nil(hold)
+	held, damped := d.Damp(cl("did:plc:flappy", "US", sovereignty.ConfidenceLow))
+	assert.True(damped)
+	assert.Equal("CA", held.Country)
+
+	// a more confident answer gets through, and is held instead
+	cur, _ = apply(cur, cl("did:plc:flappy", "US", sovereignty.ConfidenceHigh))
+	assert.Equal("US", cur.Country)
+	_, damped = d.Damp(cl("did:plc:flappy", "CA", sovereignty.ConfidenceMedium))
+	assert.True(damped)
+
+	// an operator's classification is held in its place
+	admin := sovereignty.Classification{DID: "did:plc:flappy", Country: "CA", Source: "admin"}
+	_, hold = d.Observe(&cur, admin, true)
+	assert.Nil(hold)
+	held, damped = d.Damp(cl("did:plc:flappy", "US", sovereignty.ConfidenceHigh))
+	assert.True(damped)
+	assert.Equal("admin", held.Source)
+
+	report := d.Flapping()
+	if assert.Len(report, 1) {
+		assert.Equal("did:plc:flappy", report[0].DID)
+		assert.True(report[0].Flapping)
+	}
+
+	// holds lapse, and can be released early
+	clk.Advance(opts.HoldDown)
+	_, damped = d.Damp(cl("did:plc:flappy", "US", sovereignty.ConfidenceLow))
+	assert.False(damped)
+	assert.Empty(d.Flapping())
+
+	cur = cl("did:plc:other", "CA", sovereignty.ConfidenceMedium)
+	for _, country := range []string{"US", "CA", "US"} {
+		cur, _ = apply(cur, cl("did:plc:other", country, sovereignty.ConfidenceMedium))
+	}
+	_, damped = d.Damp(cl("did:plc:other", "US", sovereignty.ConfidenceMedium))
+	assert.True(damped)
+	d.Release("did:plc:other")
+	_, damped = d.Damp(cl("did:plc:other", "US", sovereignty.ConfidenceMedium))
+	assert.False(damped)
+}
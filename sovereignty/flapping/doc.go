@@ -0,0 +1,4 @@
+// Detection and damping of accounts whose classification oscillates between countries.
+//
+// Conflicting signals (eg, a PDS whose addresses geolocate to different countries, or resolvers which disagree and answer in turn) can make the country resolver classify an account one way, then another, then back again, each time changing whether the sovereign stream carries its events. A Detector remembers the recent classifications of each account which changed, and reports an account as flapping once it has changed Changes times within Window. A flapping account is held: the detector picks its most trustworthy recent result (the most confident, then the one which stood longest, then the latest), and for HoldDown, Damp suppresses automatic changes away from it unless they are more confident.
+package flapping
@@ -0,0 +1,16 @@
+package flapping
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var detectedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "flapping_detected_total",
+	Help: "Accounts which started flapping: their classification changed too often within the window",
+})
+
+var dampedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "flapping_damped_total",
+	Help: "Automatic classification changes suppressed because the account's classification was held",
+})
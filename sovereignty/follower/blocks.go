@@ -0,0 +1,30 @@
+package follower
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// ReadBlocks decodes the CAR slice carried in a commit event into its blocks, by CID, for looking up the records the commit's ops point at.
+func ReadBlocks(b []byte) (map[cid.Cid][]byte, error) {
+	cr, err := car.NewCarReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	blocks := make(map[cid.Cid][]byte)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		blocks[blk.Cid()] = blk.RawData()
+	}
+	return blocks, nil
+}
@@ -0,0 +1,4 @@
+// Reconnecting consumer of a relay's sovereign stream.
+//
+// Follow subscribes to the sovereign stream of a relay, passing each event to a handler, and reconnects with backoff whenever the connection drops, resuming from the consumer's last applied sequence number. ReadBlocks decodes the record blocks a commit event carries. Both are shared by the services which derive state from the stream, such as graphd, notifyd and countd.
+package follower
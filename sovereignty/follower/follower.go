@@ -0,0 +1,86 @@
+package follower
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/sequential"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/gorilla/websocket"
+)
+
+// StreamPath is the sovereign stream's path, relative to the relay's base URL
+const StreamPath = "sovereignty/xrpc/com.atproto.sync.subscribeRepos"
+
+// Options configures Follow.
+type Options struct {
+	// consuming service, named in the User-Agent header and scheduler metrics
+	Name string
+	// returns the last applied sequence number, asked for on each (re)connect; zero starts from the live stream
+	Cursor func() int64
+	Logger *slog.Logger
+}
+
+// StreamURL returns the URL of a relay's sovereign stream, keeping any path prefix of the relay's URL.
+func StreamURL(relayHost string, cursor int64) (*url.URL, error) {
+	u, err := url.Parse(relayHost)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("relay host must be an absolute URL: %q", relayHost)
+	}
+	u = u.JoinPath(StreamPath)
+	u.RawQuery = ""
+	if cursor > 0 {
+		u.RawQuery = fmt.Sprintf("cursor=%d", cursor)
+	}
+	return u, nil
+}
+
+// Follow consumes a relay's sovereign stream until the context is cancelled, passing each event to handle, and reconnecting (from the last applied sequence number) on errors. It only returns early if relayHost isn't a valid URL.
+func Follow(ctx context.Context, relayHost string, handle func(context.Context, *events.XRPCStreamEvent) error, opts Options) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if _, err := StreamURL(relayHost, 0); err != nil {
+		return fmt.Errorf("invalid relay host: %w", err)
+	}
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		var cursor int64
+		if opts.Cursor != nil {
+			cursor = opts.Cursor()
+		}
+		u, _ := StreamURL(relayHost, cursor)
+
+		logger.Info("connecting to sovereign stream", "url", u.String())
+		con, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), http.Header{
+			"User-Agent": []string{fmt.Sprintf("%s/%s", opts.Name, versioninfo.Short())},
+		})
+		if err == nil {
+			backoff = time.Second
+			sched := sequential.NewScheduler(opts.Name, handle)
+			err = events.HandleRepoStream(ctx, con, sched, logger)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.Warn("sovereign stream disconnected", "err", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package follower
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamURL(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := StreamURL("ws://localhost:2470", 0)
+	assert.NoError(err)
+	assert.Equal("ws://localhost:2470/sovereignty/xrpc/com.atproto.sync.subscribeRepos", u.String())
+
+	// a relay behind a path prefix keeps it
+	u, err = StreamURL("wss://gateway.example.ca/relay/", 42)
+	assert.NoError(err)
+	assert.Equal("wss://gateway.example.ca/relay/sovereignty/xrpc/com.atproto.sync.subscribeRepos?cursor=42", u.String())
+
+	_, err = StreamURL("localhost:2470", 0)
+	assert.Error(err)
+	_, err = StreamURL("ws://[::1", 0)
+	assert.Error(err)
+}
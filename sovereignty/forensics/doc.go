@@ -0,0 +1,4 @@
+// Forensic capture of the relay's state around anomalies.
+//
+// A Recorder keeps the most recent frames received from PDS hosts, and the most recent log records, in bounded memory. When an anomaly is detected (a flood of events from one account, events out of order, an account's classification flapping between countries), Trigger captures a bundle: the frames from the affected account and its host, the log records mentioning either, and the account's classification state, written gzipped JSON to a directory only the relay's user can read. Captures are rate limited per account or host, and the oldest bundles are removed beyond a limit, so a sustained anomaly can't fill the disk.
+package forensics
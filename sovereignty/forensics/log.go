@@ -0,0 +1,83 @@
+package forensics
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// Handler returns a log handler passing records on to next, and remembering them for bundles.
+func (r *Recorder) Handler(next slog.Handler) slog.Handler {
+	return &logHandler{next: next, r: r}
+}
+
+type logHandler struct {
+	next slog.Handler
+	r    *Recorder
+	// attributes from WithAttrs, already qualified by group
+	attrs []slog.Attr
+	group string
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, rec slog.Record) error {
+	lr := LogRecord{Time: rec.Time.UTC(), Level: rec.Level.String(), Message: rec.Message}
+	if len(h.attrs) > 0 || rec.NumAttrs() > 0 {
+		lr.Attrs = make(map[string]string, len(h.attrs)+rec.NumAttrs())
+	}
+	for _, a := range h.attrs {
+		flatten(lr.Attrs, "", a)
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		flatten(lr.Attrs, h.group, a)
+		return true
+	})
+	h.r.recordLog(lr)
+	return h.next.Handle(ctx, rec)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	qualified := slices.Clone(h.attrs)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		qualified = append(qualified, a)
+	}
+	return &logHandler{next: h.next.WithAttrs(attrs), r: h.r, attrs: qualified, group: h.group}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &logHandler{next: h.next.WithGroup(name), r: h.r, attrs: h.attrs, group: group}
+}
+
+// flatten records an attribute's value as a string, and a group's members under dotted keys
+func flatten(out map[string]string, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	key := a.Key
+	switch {
+	case prefix == "":
+	case key == "":
+		// an inlined group
+		key = prefix
+	default:
+		key = prefix + "." + key
+	}
+	if v.Kind() == slog.KindGroup {
+		for _, ga := range v.Group() {
+			flatten(out, key, ga)
+		}
+		return
+	}
+	out[key] = v.String()
+}
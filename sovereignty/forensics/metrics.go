@@ -0,0 +1,17 @@
+package forensics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var capturesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "forensics_captures_total",
+	Help: "Forensic captures triggered, by trigger kind and result (written, suppressed by the cooldown, dropped with the queue full, or error)",
+}, []string{"kind", "result"})
+
+var bundleBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "forensics_bundle_bytes",
+	Help:    "Compressed size of forensic bundles written",
+	Buckets: prometheus.ExponentialBuckets(1<<10, 4, 10),
+})
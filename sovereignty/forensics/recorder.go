@@ -0,0 +1,432 @@
+package forensics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/clock"
+)
+
+// Kinds of anomaly which trigger a capture
+const (
+	// one account's events dominate the relay's traffic
+	KindFlood = "flood"
+	// an account's events were broadcast out of seq or rev order
+	KindOrdering = "ordering"
+	// an account's classification changed country repeatedly in a short time
+	KindFlapping = "flapping"
+	// requested by an operator
+	KindManual = "manual"
+)
+
+// bundle files are named for their ID, with this suffix
+const bundleSuffix = ".json.gz"
+
+// Trigger is an anomaly to capture a bundle for.
+type Trigger struct {
+	Kind string `json:"kind"`
+	// the affected account and PDS host; at least one is required. If only the account is given, its host is taken from its most recent frame
+	DID    string `json:"did,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Frame is an event as received from a PDS.
+type Frame struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Host       string    `json:"host"`
+	DID        string    `json:"did,omitempty"`
+	// the host's sequence number
+	Seq int64 `json:"seq"`
+	// the event's frame as streamed, header then body, in CBOR
+	Data []byte `json:"data"`
+}
+
+// LogRecord is a log record mentioning the affected account or host.
+type LogRecord struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// Bundle is what is captured for a trigger.
+type Bundle struct {
+	ID         string    `json:"id"`
+	Trigger    Trigger   `json:"trigger"`
+	CapturedAt time.Time `json:"capturedAt"`
+	// the account's classification state at capture, from Options.State
+	State  any         `json:"state,omitempty"`
+	Frames []Frame     `json:"frames"`
+	Logs   []LogRecord `json:"logs"`
+	// matching frames and log records left out by the bundle's bounds
+	DroppedFrames int `json:"droppedFrames,omitempty"`
+	DroppedLogs   int `json:"droppedLogs,omitempty"`
+}
+
+// BundleInfo describes a bundle on disk.
+type BundleInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Options struct {
+	// recent frames kept in memory, across all accounts and hosts
+	Frames int
+	// recent log records kept in memory
+	LogRecords int
+	// most frames and log records in one bundle; the most recent are kept
+	MaxBundleFrames int
+	MaxBundleLogs   int
+	// an account (or host) is captured at most once per cooldown, whatever the trigger
+	Cooldown time.Duration
+	// bundles kept on disk; the oldest are removed beyond this. 0 keeps every bundle
+	MaxBundles int
+	// returns the account's classification state, recorded in its bundles; optional. Called from Run
+	State func(did string) any
+	// time source for frame and capture times, and the cooldown; nil uses the system clock
+	Clock clock.Clock
+	Log   *slog.Logger
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Frames:          10_000,
+		LogRecords:      5_000,
+		MaxBundleFrames: 1_000,
+		MaxBundleLogs:   500,
+		Cooldown:        10 * time.Minute,
+		MaxBundles:      100,
+	}
+}
+
+type recordedFrame struct {
+	receivedAt time.Time
+	host       string
+	did        string
+	evt        *events.XRPCStreamEvent
+}
+
+type capture struct {
+	id      string
+	trigger Trigger
+	at      time.Time
+	frames  []recordedFrame
+	logs    []LogRecord
+	dropped [2]int
+}
+
+// ring is a fixed-size buffer of the most recent items
+type ring[T any] struct {
+	items []T
+	next  int
+	full  bool
+}
+
+func newRing[T any](n int) *ring[T] {
+	return &ring[T]{items: make([]T, max(n, 1))}
+}
+
+func (r *ring[T]) add(v T) {
+	r.items[r.next] = v
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// match returns, oldest first, the most recent n items for which keep returns true, and how many more matched
+func (r *ring[T]) match(n int, keep func(T) bool) ([]T, int) {
+	var out []T
+	dropped := 0
+	size := r.next
+	if r.full {
+		size = len(r.items)
+	}
+	for i := 1; i <= size; i++ {
+		v := r.items[(r.next-i+len(r.items))%len(r.items)]
+		if !keep(v) {
+			continue
+		}
+		if len(out) == n {
+			dropped++
+			continue
+		}
+		out = append(out, v)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, dropped
+}
+
+// Recorder records recent frames and log records, and captures bundles of them when triggered. It is safe for concurrent use.
+type Recorder struct {
+	dir   string
+	opts  Options
+	clock clock.Clock
+	log   *slog.Logger
+
+	lk     sync.Mutex
+	frames *ring[recordedFrame]
+	logs   *ring[LogRecord]
+	// when each account or host was last captured
+	captured map[string]time.Time
+	seq      int
+
+	queue chan *capture
+}
+
+// NewRecorder returns a recorder writing bundles to dir, which is created if needed, and restricted to the relay's user.
+func NewRecorder(dir string, opts Options) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// an existing directory may have been created more permissively
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+	log := opts.Log
+	if log == nil {
+		log = slog.Default().With("system", "forensics")
+	}
+	return &Recorder{
+		dir:      dir,
+		opts:     opts,
+		clock:    clock.OrSystem(opts.Clock),
+		log:      log,
+		frames:   newRing[recordedFrame](opts.Frames),
+		logs:     newRing[LogRecord](opts.LogRecords),
+		captured: make(map[string]time.Time),
+		queue:    make(chan *capture, 16),
+	}, nil
+}
+
+// RecordFrame remembers an event received from a PDS host. The event must not be modified afterwards.
+func (r *Recorder) RecordFrame(host string, evt *events.XRPCStreamEvent) {
+	f := recordedFrame{host: host, did: eventDID(evt), evt: evt}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	f.receivedAt = r.clock.Now()
+	r.frames.add(f)
+}
+
+func (r *Recorder) recordLog(rec LogRecord) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.logs.add(rec)
+}
+
+// Trigger queues a capture for the anomaly, and reports whether it did: the affected account or host may have been captured within the cooldown, or too many captures may be waiting to be written. It doesn't block.
+func (r *Recorder) Trigger(t Trigger) bool {
+	if t.DID == "" && t.Host == "" {
+		return false
+	}
+	r.lk.Lock()
+	now := r.clock.Now()
+	for k, at := range r.captured {
+		if now.Sub(at) >= r.opts.Cooldown {
+			delete(r.captured, k)
+		}
+	}
+	key := t.DID
+	if key == "" {
+		key = t.Host
+	}
+	if _, ok := r.captured[key]; ok && t.Kind != KindManual {
+		r.lk.Unlock()
+		capturesCounter.WithLabelValues(t.Kind, "suppressed").Inc()
+		return false
+	}
+	if t.Host == "" {
+		recent, _ := r.frames.match(1, func(f recordedFrame) bool { return f.did == t.DID })
+		if len(recent) > 0 {
+			t.Host = recent[0].host
+		}
+	}
+	c := &capture{trigger: t, at: now}
+	var dropped int
+	c.frames, dropped = r.frames.match(r.opts.MaxBundleFrames, func(f recordedFrame) bool {
+		return (t.DID != "" && f.did == t.DID) || (t.Host != "" && f.host == t.Host)
+	})
+	c.dropped[0] = dropped
+	c.logs, dropped = r.logs.match(r.opts.MaxBundleLogs, func(l LogRecord) bool {
+		for _, v := range l.Attrs {
+			if (t.DID != "" && v == t.DID) || (t.Host != "" && v == t.Host) {
+				return true
+			}
+		}
+		return false
+	})
+	c.dropped[1] = dropped
+	r.seq++
+	c.id = fmt.Sprintf("%s-%s-%d", now.UTC().Format("20060102T150405.000Z"), t.Kind, r.seq)
+
+	select {
+	case r.queue <- c:
+	default:
+		r.lk.Unlock()
+		capturesCounter.WithLabelValues(t.Kind, "dropped").Inc()
+		return false
+	}
+	r.captured[key] = now
+	r.lk.Unlock()
+	return true
+}
+
+// Run writes queued captures until the context is cancelled.
+func (r *Recorder) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-r.queue:
+			if err := r.write(c); err != nil {
+				capturesCounter.WithLabelValues(c.trigger.Kind, "error").Inc()
+				r.log.Error("failed to write forensic bundle", "id", c.id, "err", err)
+				continue
+			}
+			capturesCounter.WithLabelValues(c.trigger.Kind, "written").Inc()
+			r.log.Info("wrote forensic bundle", "id", c.id, "kind", c.trigger.Kind, "did", c.trigger.DID, "host", c.trigger.Host, "frames", len(c.frames))
+			r.prune()
+		}
+	}
+}
+
+func (r *Recorder) write(c *capture) error {
+	b := Bundle{
+		ID:            c.id,
+		Trigger:       c.trigger,
+		CapturedAt:    c.at.UTC(),
+		Frames:        make([]Frame, 0, len(c.frames)),
+		Logs:          c.logs,
+		DroppedFrames: c.dropped[0],
+		DroppedLogs:   c.dropped[1],
+	}
+	if r.opts.State != nil && c.trigger.DID != "" {
+		b.State = r.opts.State(c.trigger.DID)
+	}
+	for _, f := range c.frames {
+		var buf bytes.Buffer
+		if err := f.evt.Serialize(&buf); err != nil {
+			// nor could it have been streamed; the rest of the bundle is still useful
+			b.DroppedFrames++
+			continue
+		}
+		seq, _ := f.evt.GetSequence()
+		b.Frames = append(b.Frames, Frame{ReceivedAt: f.receivedAt.UTC(), Host: f.host, DID: f.did, Seq: seq, Data: buf.Bytes()})
+	}
+	if b.Logs == nil {
+		b.Logs = []LogRecord{}
+	}
+
+	// CreateTemp uses 0600, and the rename keeps readers from seeing a partial bundle
+	tmp, err := os.CreateTemp(r.dir, ".tmp-"+c.id)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if fi, err := tmp.Stat(); err == nil {
+		bundleBytes.Observe(float64(fi.Size()))
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(r.dir, c.id+bundleSuffix))
+}
+
+// prune removes the oldest bundles beyond MaxBundles
+func (r *Recorder) prune() {
+	if r.opts.MaxBundles <= 0 {
+		return
+	}
+	list, err := r.List()
+	if err != nil {
+		r.log.Warn("failed to list forensic bundles", "err", err)
+		return
+	}
+	for _, b := range list[min(r.opts.MaxBundles, len(list)):] {
+		if err := os.Remove(filepath.Join(r.dir, b.Name)); err != nil {
+			r.log.Warn("failed to remove forensic bundle", "name", b.Name, "err", err)
+		}
+	}
+}
+
+// List returns the bundles on disk, newest first.
+func (r *Recorder) List() ([]BundleInfo, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []BundleInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), bundleSuffix) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, BundleInfo{Name: e.Name(), Size: fi.Size(), CreatedAt: fi.ModTime().UTC()})
+	}
+	// names start with the capture time, so sort in time order
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out, nil
+}
+
+// Open reads a bundle by its name, as returned by List.
+func (r *Recorder) Open(name string) (*Bundle, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, bundleSuffix) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid bundle name: %q", name)
+	}
+	f, err := os.Open(filepath.Join(r.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.NewDecoder(zr).Decode(&b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func eventDID(evt *events.XRPCStreamEvent) string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Repo
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Did
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Did
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Did
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,119 @@
+package forensics
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func identityEvt(did string, seq int64) *events.XRPCStreamEvent {
+	return &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: did, Seq: seq, Time: "2024-01-01T00:00:00Z"}}
+}
+
+// writeQueued writes the captures waiting in the queue, as Run would
+func writeQueued(t *testing.T, r *Recorder) {
+	for {
+		select {
+		case c := <-r.queue:
+			if err := r.write(c); err != nil {
+				t.Fatal(err)
+			}
+			r.prune()
+		default:
+			return
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "forensics")
+	clk := clock.NewMock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOptions()
+	opts.MaxBundleFrames = 3
+	opts.MaxBundles = 2
+	opts.Clock = clk
+	opts.State = func(did string) any { return map[string]string{"country": "CA"} }
+	r, err := NewRecorder(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dir)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0700), fi.Mode().Perm())
+
+	log := slog.New(r.Handler(slog.NewTextHandler(&bytes.Buffer{}, nil))).With("system", "bgs")
+	for i := int64(1); i <= 4; i++ {
+		r.RecordFrame("pds.example.ca", identityEvt("did:plc:a", i))
+		r.RecordFrame("pds.example.com", identityEvt("did:plc:b", i))
+	}
+	r.RecordFrame("pds.example.ca", identityEvt("did:plc:c", 5))
+	log.Warn("account dominates event volume", "did", "did:plc:a")
+	log.Info("unrelated", "did", "did:plc:b")
+	log.WithGroup("req").Info("connected", "host", "pds.example.ca")
+
+	assert.True(r.Trigger(Trigger{Kind: KindFlood, DID: "did:plc:a", Detail: "share 0.5"}))
+	// within the cooldown
+	assert.False(r.Trigger(Trigger{Kind: KindOrdering, DID: "did:plc:a"}))
+	assert.False(r.Trigger(Trigger{Kind: KindOrdering}))
+	writeQueued(t, r)
+
+	list, err := r.List()
+	assert.NoError(err)
+	if !assert.Len(list, 1) {
+		return
+	}
+	info, err := os.Stat(filepath.Join(dir, list[0].Name))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	b, err := r.Open(list[0].Name)
+	assert.NoError(err)
+	// the account's host was taken from its frames
+	assert.Equal(Trigger{Kind: KindFlood, DID: "did:plc:a", Host: "pds.example.ca", Detail: "share 0.5"}, b.Trigger)
+	assert.Equal(map[string]any{"country": "CA"}, b.State)
+	// the most recent frames of the account and its host, oldest first
+	var seqs []int64
+	for _, f := range b.Frames {
+		seqs = append(seqs, f.Seq)
+		var evt events.XRPCStreamEvent
+		assert.NoError(evt.Deserialize(bytes.NewReader(f.Data)))
+		assert.Equal(f.DID, evt.RepoIdentity.Did)
+	}
+	assert.Equal([]int64{3, 4, 5}, seqs)
+	assert.Equal(2, b.DroppedFrames)
+	if assert.Len(b.Logs, 2) {
+		assert.Equal("account dominates event volume", b.Logs[0].Message)
+		assert.Equal(map[string]string{"system": "bgs", "did": "did:plc:a"}, b.Logs[0].Attrs)
+		assert.Equal("pds.example.ca", b.Logs[1].Attrs["req.host"])
+	}
+
+	// operators aren't held to the cooldown, and the oldest bundles are removed beyond the limit
+	clk.Advance(time.Second)
+	assert.True(r.Trigger(Trigger{Kind: KindManual, DID: "did:plc:a"}))
+	clk.Advance(opts.Cooldown)
+	assert.True(r.Trigger(Trigger{Kind: KindFlapping, Host: "pds.example.com"}))
+	writeQueued(t, r)
+	list, err = r.List()
+	assert.NoError(err)
+	if assert.Len(list, 2) {
+		b, err = r.Open(list[0].Name)
+		assert.NoError(err)
+		assert.Equal(KindFlapping, b.Trigger.Kind)
+		assert.Len(b.Frames, 3)
+		assert.Nil(b.State)
+	}
+
+	_, err = r.Open("../" + list[0].Name)
+	assert.Error(err)
+}
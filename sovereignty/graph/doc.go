@@ -0,0 +1,4 @@
+// Follow and block graph of sovereign accounts.
+//
+// The graph is maintained in memory from the relay's filtered sovereign stream, as sorted adjacency lists of interned account IDs, and is periodically written to a snapshot file (along with the stream cursor) so a restart only replays recent events. It answers follower and following counts, mutual follows, and block checks for the feed generator and moderation tooling, which is served over an internal HTTP API by cmd/graphd.
+package graph
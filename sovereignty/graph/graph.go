@@ -0,0 +1,303 @@
+package graph
+
+import (
+	"slices"
+	"sync"
+)
+
+const (
+	FollowCollection = "app.bsky.graph.follow"
+	BlockCollection  = "app.bsky.graph.block"
+)
+
+// Kind is the type of a graph edge.
+type Kind uint8
+
+const (
+	KindFollow Kind = iota + 1
+	KindBlock
+)
+
+// Collection returns the record collection edges of this kind are declared in.
+func (k Kind) Collection() string {
+	switch k {
+	case KindFollow:
+		return FollowCollection
+	case KindBlock:
+		return BlockCollection
+	default:
+		return ""
+	}
+}
+
+// KindForCollection returns the edge kind for a record collection, if it is one the graph tracks.
+func KindForCollection(coll string) (Kind, bool) {
+	switch coll {
+	case FollowCollection:
+		return KindFollow, true
+	case BlockCollection:
+		return KindBlock, true
+	default:
+		return 0, false
+	}
+}
+
+// idSet is a sorted list of account IDs
+type idSet []uint32
+
+func (s idSet) has(id uint32) bool {
+	_, ok := slices.BinarySearch(s, id)
+	return ok
+}
+
+func (s *idSet) add(id uint32) {
+	i, ok := slices.BinarySearch(*s, id)
+	if !ok {
+		*s = slices.Insert(*s, i, id)
+	}
+}
+
+func (s *idSet) remove(id uint32) {
+	i, ok := slices.BinarySearch(*s, id)
+	if ok {
+		*s = slices.Delete(*s, i, i+1)
+	}
+}
+
+// record is a follow or block record, tracked so that deletes (which carry only the record path) can be applied
+type record struct {
+	kind    Kind
+	subject uint32
+}
+
+type edge struct {
+	kind          Kind
+	from, subject uint32
+}
+
+// account is the per-account state; out and in edge lists are indexed by Kind
+type account struct {
+	out  [3]idSet
+	in   [3]idSet
+	recs map[string]record
+}
+
+// Graph is an in-memory follow and block graph, safe for concurrent use.
+type Graph struct {
+	lk       sync.RWMutex
+	ids      map[string]uint32
+	dids     []string
+	accounts []*account
+	// extra references to an edge beyond the first, for accounts with duplicate records for the same subject
+	dupes map[edge]int
+	// stream sequence number of the last applied event
+	seq int64
+}
+
+func New() *Graph {
+	return &Graph{
+		ids:   make(map[string]uint32),
+		dupes: make(map[edge]int),
+	}
+}
+
+// intern returns the ID for the DID, allocating one if needed. Caller must hold the write lock.
+func (g *Graph) intern(did string) uint32 {
+	if id, ok := g.ids[did]; ok {
+		return id
+	}
+	id := uint32(len(g.dids))
+	g.ids[did] = id
+	g.dids = append(g.dids, did)
+	g.accounts = append(g.accounts, &account{})
+	return id
+}
+
+func (g *Graph) lookup(did string) (*account, bool) {
+	id, ok := g.ids[did]
+	if !ok {
+		return nil, false
+	}
+	return g.accounts[id], true
+}
+
+// Put records a follow or block record by actor, replacing any previous record at the same record key.
+func (g *Graph) Put(kind Kind, actor, rkey, subject string) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	g.put(kind, actor, rkey, subject)
+}
+
+func (g *Graph) put(kind Kind, actor, rkey, subject string) {
+	from := g.intern(actor)
+	to := g.intern(subject)
+	a := g.accounts[from]
+	key := kind.Collection() + "/" + rkey
+	if prev, ok := a.recs[key]; ok {
+		if prev.subject == to {
+			return
+		}
+		g.unlink(from, prev)
+	}
+	if a.recs == nil {
+		a.recs = make(map[string]record)
+	}
+	a.recs[key] = record{kind: kind, subject: to}
+
+	if a.out[kind].has(to) {
+		g.dupes[edge{kind, from, to}]++
+		return
+	}
+	a.out[kind].add(to)
+	g.accounts[to].in[kind].add(from)
+}
+
+// Delete removes the record at the given record key, if the graph has it.
+func (g *Graph) Delete(kind Kind, actor, rkey string) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	from, ok := g.ids[actor]
+	if !ok {
+		return
+	}
+	a := g.accounts[from]
+	key := kind.Collection() + "/" + rkey
+	rec, ok := a.recs[key]
+	if !ok {
+		return
+	}
+	delete(a.recs, key)
+	g.unlink(from, rec)
+}
+
+func (g *Graph) unlink(from uint32, rec record) {
+	e := edge{rec.kind, from, rec.subject}
+	if n := g.dupes[e]; n > 0 {
+		if n == 1 {
+			delete(g.dupes, e)
+		} else {
+			g.dupes[e] = n - 1
+		}
+		return
+	}
+	g.accounts[from].out[rec.kind].remove(rec.subject)
+	g.accounts[rec.subject].in[rec.kind].remove(from)
+}
+
+// RemoveAccount drops all follow and block records declared by the account, eg when its repo is deleted. Edges pointing at the account are declared in other repos and are left alone.
+func (g *Graph) RemoveAccount(did string) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	from, ok := g.ids[did]
+	if !ok {
+		return
+	}
+	a := g.accounts[from]
+	for _, rec := range a.recs {
+		g.unlink(from, rec)
+	}
+	a.recs = nil
+}
+
+// Counts returns the number of followers and followed accounts for the DID.
+func (g *Graph) Counts(did string) (followers, following int) {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+	a, ok := g.lookup(did)
+	if !ok {
+		return 0, 0
+	}
+	return len(a.in[KindFollow]), len(a.out[KindFollow])
+}
+
+// Follows returns true if actor follows subject.
+func (g *Graph) Follows(actor, subject string) bool {
+	return g.hasEdge(KindFollow, actor, subject)
+}
+
+// Blocks returns true if actor blocks subject.
+func (g *Graph) Blocks(actor, subject string) bool {
+	return g.hasEdge(KindBlock, actor, subject)
+}
+
+// Blocked returns true if either account blocks the other.
+func (g *Graph) Blocked(a, b string) bool {
+	return g.Blocks(a, b) || g.Blocks(b, a)
+}
+
+func (g *Graph) hasEdge(kind Kind, actor, subject string) bool {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+	a, ok := g.lookup(actor)
+	if !ok {
+		return false
+	}
+	to, ok := g.ids[subject]
+	if !ok {
+		return false
+	}
+	return a.out[kind].has(to)
+}
+
+// Mutuals returns up to limit accounts which both follow and are followed by the DID, in a stable order. A limit of zero or less returns all of them.
+func (g *Graph) Mutuals(did string, limit int) []string {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+	a, ok := g.lookup(did)
+	if !ok {
+		return []string{}
+	}
+	out := []string{}
+	following, followers := a.out[KindFollow], a.in[KindFollow]
+	i, j := 0, 0
+	for i < len(following) && j < len(followers) {
+		switch {
+		case following[i] < followers[j]:
+			i++
+		case following[i] > followers[j]:
+			j++
+		default:
+			out = append(out, g.dids[following[i]])
+			if limit > 0 && len(out) >= limit {
+				return out
+			}
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Seq returns the sequence number of the last event reflected in the graph; snapshots record it so a restored graph resumes from there.
+func (g *Graph) Seq() int64 {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+	return g.seq
+}
+
+func (g *Graph) setSeq(seq int64) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	if seq > g.seq {
+		g.seq = seq
+	}
+}
+
+// Stats summarizes the size of the graph.
+type Stats struct {
+	Accounts int   `json:"accounts"`
+	Follows  int   `json:"follows"`
+	Blocks   int   `json:"blocks"`
+	Seq      int64 `json:"seq"`
+}
+
+func (g *Graph) Stats() Stats {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+	st := Stats{Accounts: len(g.dids), Seq: g.seq}
+	for _, a := range g.accounts {
+		st.Follows += len(a.out[KindFollow])
+		st.Blocks += len(a.out[KindBlock])
+	}
+	return st
+}
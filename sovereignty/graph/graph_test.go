@@ -0,0 +1,106 @@
+package graph
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	alice = "did:plc:alice"
+	bob   = "did:plc:bob"
+	carol = "did:plc:carol"
+)
+
+func TestFollowsAndMutuals(t *testing.T) {
+	assert := assert.New(t)
+	g := New()
+
+	g.Put(KindFollow, alice, "1", bob)
+	g.Put(KindFollow, bob, "1", alice)
+	g.Put(KindFollow, alice, "2", carol)
+	g.Put(KindBlock, carol, "1", bob)
+
+	followers, following := g.Counts(alice)
+	assert.Equal(1, followers)
+	assert.Equal(2, following)
+	assert.True(g.Follows(alice, carol))
+	assert.False(g.Follows(carol, alice))
+	assert.Equal([]string{bob}, g.Mutuals(alice, 0))
+	assert.Equal([]string{}, g.Mutuals("did:plc:unknown", 0))
+
+	assert.True(g.Blocks(carol, bob))
+	assert.False(g.Blocks(bob, carol))
+	assert.True(g.Blocked(bob, carol))
+	assert.False(g.Blocked(alice, bob))
+
+	g.Delete(KindFollow, bob, "1")
+	assert.Equal([]string{}, g.Mutuals(alice, 0))
+	followers, _ = g.Counts(alice)
+	assert.Equal(0, followers)
+
+	// a record key being rewritten to a new subject moves the edge
+	g.Put(KindFollow, alice, "2", bob)
+	assert.False(g.Follows(alice, carol))
+	assert.True(g.Follows(alice, bob))
+}
+
+func TestDuplicateRecords(t *testing.T) {
+	assert := assert.New(t)
+	g := New()
+
+	g.Put(KindFollow, alice, "1", bob)
+	g.Put(KindFollow, alice, "2", bob)
+	_, following := g.Counts(alice)
+	assert.Equal(1, following)
+
+	g.Delete(KindFollow, alice, "1")
+	assert.True(g.Follows(alice, bob))
+	g.Delete(KindFollow, alice, "2")
+	assert.False(g.Follows(alice, bob))
+
+	g.Put(KindFollow, alice, "1", bob)
+	g.Put(KindFollow, alice, "2", bob)
+	g.Put(KindBlock, alice, "1", carol)
+	g.RemoveAccount(alice)
+	assert.False(g.Follows(alice, bob))
+	assert.False(g.Blocks(alice, carol))
+	assert.Equal(Stats{Accounts: 3}, g.Stats())
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	g := New()
+	g.Put(KindFollow, alice, "1", bob)
+	g.Put(KindFollow, alice, "2", bob)
+	g.Put(KindFollow, bob, "1", alice)
+	g.Put(KindBlock, carol, "1", alice)
+	g.setSeq(1234)
+
+	var buf bytes.Buffer
+	assert.NoError(g.WriteSnapshot(&buf))
+	loaded, err := ReadSnapshot(&buf)
+	assert.NoError(err)
+	assert.Equal(g.Stats(), loaded.Stats())
+	assert.Equal(int64(1234), loaded.Seq())
+	assert.Equal([]string{bob}, loaded.Mutuals(alice, 0))
+	assert.True(loaded.Blocked(alice, carol))
+
+	// duplicate record references survive the round trip
+	loaded.Delete(KindFollow, alice, "1")
+	assert.True(loaded.Follows(alice, bob))
+
+	path := filepath.Join(t.TempDir(), "graph.snapshot")
+	empty, err := LoadFile(path)
+	assert.NoError(err)
+	assert.Equal(Stats{}, empty.Stats())
+	assert.NoError(g.SaveFile(path))
+	loaded, err = LoadFile(path)
+	assert.NoError(err)
+	assert.Equal(g.Stats(), loaded.Stats())
+
+	_, err = ReadSnapshot(bytes.NewReader([]byte("garbage")))
+	assert.Error(err)
+}
@@ -0,0 +1,178 @@
+package graph
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const snapshotMagic = "sovgraph1\n"
+
+// WriteSnapshot serializes the graph's records and stream cursor. Adjacency lists are not written; they are rebuilt from the records on load.
+//
+// Writers are blocked while the snapshot is written.
+func (g *Graph) WriteSnapshot(w io.Writer) error {
+	g.lk.RLock()
+	defer g.lk.RUnlock()
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(buf[:], v)
+		bw.Write(buf[:n])
+	}
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		bw.WriteString(s)
+	}
+
+	bw.WriteString(snapshotMagic)
+	putUvarint(uint64(g.seq))
+	putUvarint(uint64(len(g.dids)))
+	for _, did := range g.dids {
+		putString(did)
+	}
+	for id, a := range g.accounts {
+		if len(a.recs) == 0 {
+			continue
+		}
+		putUvarint(uint64(id) + 1)
+		putUvarint(uint64(len(a.recs)))
+		for key, rec := range a.recs {
+			bw.WriteByte(byte(rec.kind))
+			putString(strings.TrimPrefix(key, rec.kind.Collection()+"/"))
+			putUvarint(uint64(rec.subject))
+		}
+	}
+	// end of accounts
+	putUvarint(0)
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot loads a graph written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Graph, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading graph snapshot: %w", err)
+	}
+	br := bufio.NewReader(zr)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, fmt.Errorf("not a graph snapshot")
+	}
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return "", err
+		}
+		if n > 8192 {
+			return "", fmt.Errorf("string too long (%d bytes)", n)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	seq, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("reading graph snapshot: %w", err)
+	}
+	ndids, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("reading graph snapshot: %w", err)
+	}
+	g := New()
+	g.seq = int64(seq)
+	dids := make([]string, 0, min(ndids, 1<<20))
+	for i := uint64(0); i < ndids; i++ {
+		did, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("reading graph snapshot: %w", err)
+		}
+		dids = append(dids, did)
+		g.intern(did)
+	}
+	for {
+		id, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading graph snapshot: %w", err)
+		}
+		if id == 0 {
+			break
+		}
+		if id > ndids {
+			return nil, fmt.Errorf("reading graph snapshot: account id out of range")
+		}
+		nrecs, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading graph snapshot: %w", err)
+		}
+		for i := uint64(0); i < nrecs; i++ {
+			kind, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("reading graph snapshot: %w", err)
+			}
+			rkey, err := readString()
+			if err != nil {
+				return nil, fmt.Errorf("reading graph snapshot: %w", err)
+			}
+			subject, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, fmt.Errorf("reading graph snapshot: %w", err)
+			}
+			if Kind(kind).Collection() == "" || subject >= ndids {
+				return nil, fmt.Errorf("reading graph snapshot: invalid record")
+			}
+			g.put(Kind(kind), dids[id-1], rkey, dids[subject])
+		}
+	}
+	return g, nil
+}
+
+// SaveFile atomically writes a snapshot to path.
+func (g *Graph) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := g.WriteSnapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile reads a snapshot from path. If there is no file yet, an empty graph is returned.
+func LoadFile(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+
+	"github.com/ipfs/go-cid"
+)
+
+// HandleEvent applies a stream event to the graph. It has the signature of a stream scheduler handler.
+func (g *Graph) HandleEvent(ctx context.Context, evt *events.XRPCStreamEvent) error {
+	switch {
+	case evt.RepoCommit != nil:
+		if err := g.ObserveCommit(evt.RepoCommit); err != nil {
+			return err
+		}
+		g.setSeq(evt.RepoCommit.Seq)
+	case evt.RepoAccount != nil:
+		acc := evt.RepoAccount
+		if !acc.Active && acc.Status != nil && *acc.Status == "deleted" {
+			g.RemoveAccount(acc.Did)
+		}
+		g.setSeq(acc.Seq)
+	case evt.RepoIdentity != nil:
+		g.setSeq(evt.RepoIdentity.Seq)
+	case evt.RepoSync != nil:
+		g.setSeq(evt.RepoSync.Seq)
+	}
+	return nil
+}
+
+// ObserveCommit applies the follow and block record writes in a commit.
+func (g *Graph) ObserveCommit(commit *comatproto.SyncSubscribeRepos_Commit) error {
+	var blocks map[cid.Cid][]byte
+	for _, op := range commit.Ops {
+		coll, rkey, ok := strings.Cut(op.Path, "/")
+		if !ok {
+			continue
+		}
+		kind, ok := KindForCollection(coll)
+		if !ok {
+			continue
+		}
+		if op.Action == "delete" || op.Cid == nil {
+			g.Delete(kind, commit.Repo, rkey)
+			continue
+		}
+		if blocks == nil {
+			var err error
+			blocks, err = follower.ReadBlocks(commit.Blocks)
+			if err != nil {
+				return err
+			}
+		}
+		raw, ok := blocks[cid.Cid(*op.Cid)]
+		if !ok {
+			return fmt.Errorf("record block missing from commit: %s", op.Path)
+		}
+		rec, err := data.UnmarshalCBOR(raw)
+		if err != nil {
+			return fmt.Errorf("decoding %s record: %w", coll, err)
+		}
+		subject, _ := rec["subject"].(string)
+		did, err := syntax.ParseDID(subject)
+		if err != nil {
+			// a follow or block without a valid subject DID has no edge to add
+			continue
+		}
+		g.Put(kind, commit.Repo, rkey, did.String())
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+// Periodic re-verification of the handle↔DID bindings of tracked accounts.
+//
+// A Pool of workers checks each tracked account's handle on a schedule, and again whenever it is enqueued (eg, after an identity event). Results are cached: a verified handle is trusted for VerifiedTTL, while a failed check is retried after the shorter FailedTTL, so transient DNS or HTTP failures clear quickly without hammering the account's infrastructure. An account whose checks keep failing (FailureThreshold consecutive failures) is reported as a persistent failure, until a check succeeds again.
+package handlecheck
@@ -0,0 +1,21 @@
+package handlecheck
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var checksCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "handlecheck_checks_total",
+	Help: "Handle verification checks, by result (verified or failed)",
+}, []string{"result"})
+
+var droppedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "handlecheck_dropped_total",
+	Help: "Handle checks not enqueued because the queue was full; due accounts are picked up again on the next schedule tick",
+})
+
+var failingGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "handlecheck_persistent_failures",
+	Help: "Tracked accounts whose handle verification is persistently failing",
+})
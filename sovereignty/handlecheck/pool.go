@@ -0,0 +1,270 @@
+package handlecheck
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checker verifies one account's handle. It returns the handle the account claims, and an error if the handle doesn't resolve back to the account's DID.
+type Checker interface {
+	Check(ctx context.Context, did string) (handle string, err error)
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(ctx context.Context, did string) (string, error)
+
+func (f CheckerFunc) Check(ctx context.Context, did string) (string, error) {
+	return f(ctx, did)
+}
+
+// Status is the outcome of the latest checks of an account's handle.
+type Status struct {
+	DID    string `json:"did"`
+	Handle string `json:"handle,omitempty"`
+	// the latest check succeeded
+	Verified bool `json:"verified"`
+	// consecutive failed checks
+	Failures  int       `json:"failures"`
+	LastError string    `json:"lastError,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	NextCheck time.Time `json:"nextCheck"`
+	// when the failures became persistent; zero unless they are
+	FailingSince time.Time `json:"failingSince"`
+}
+
+// Persistent returns true if the account's checks have failed at least FailureThreshold times in a row.
+func (s Status) Persistent() bool {
+	return !s.FailingSince.IsZero()
+}
+
+type Options struct {
+	Workers int
+	// how long a successful check is trusted
+	VerifiedTTL time.Duration
+	// how long a failed check is cached before it is retried
+	FailedTTL time.Duration
+	// consecutive failures after which an account is reported as a persistent failure
+	FailureThreshold int
+	// maximum number of accounts waiting for a check
+	QueueSize int
+	// how often tracked accounts are scanned for due checks
+	ScanInterval time.Duration
+	// called after every check, eg to persist the status; flipped is true if the account became, or stopped being, a persistent failure
+	OnResult func(st Status, flipped bool)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Workers:          4,
+		VerifiedTTL:      24 * time.Hour,
+		FailedTTL:        time.Hour,
+		FailureThreshold: 3,
+		QueueSize:        10_000,
+		ScanInterval:     time.Minute,
+	}
+}
+
+// Pool schedules and runs handle checks. It is safe for concurrent use.
+type Pool struct {
+	opts    Options
+	checker Checker
+	queue   chan string
+
+	lk     sync.Mutex
+	status map[string]*Status
+	queued map[string]bool
+}
+
+func NewPool(checker Checker, opts Options) *Pool {
+	return &Pool{
+		opts:    opts,
+		checker: checker,
+		queue:   make(chan string, max(opts.QueueSize, 1)),
+		status:  make(map[string]*Status),
+		queued:  make(map[string]bool),
+	}
+}
+
+// Load restores previously persisted statuses, so cached results survive restarts.
+func (p *Pool) Load(sts []Status) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	for _, st := range sts {
+		st := st
+		p.status[st.DID] = &st
+	}
+	p.updateFailingGauge()
+}
+
+// Enqueue schedules a check of the account as soon as a worker is free, regardless of any cached result. It returns false if the queue is full.
+func (p *Pool) Enqueue(did string) bool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.enqueue(did)
+}
+
+// enqueue must be called with lk held
+func (p *Pool) enqueue(did string) bool {
+	if p.queued[did] {
+		return true
+	}
+	select {
+	case p.queue <- did:
+		p.queued[did] = true
+		return true
+	default:
+		droppedCounter.Inc()
+		return false
+	}
+}
+
+// Get returns the account's latest status, if it has been checked.
+func (p *Pool) Get(did string) (Status, bool) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	st, ok := p.status[did]
+	if !ok {
+		return Status{}, false
+	}
+	return *st, true
+}
+
+// Failing returns the persistently failing accounts, longest-failing first.
+func (p *Pool) Failing() []Status {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	var out []Status
+	for _, st := range p.status {
+		if st.Persistent() {
+			out = append(out, *st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].FailingSince.Equal(out[j].FailingSince) {
+			return out[i].FailingSince.Before(out[j].FailingSince)
+		}
+		return out[i].DID < out[j].DID
+	})
+	return out
+}
+
+// Scan enqueues every tracked account whose cached result has expired (or which was never checked), and forgets accounts which are no longer tracked.
+func (p *Pool) Scan(tracked []string, now time.Time) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	keep := make(map[string]bool, len(tracked))
+	for _, did := range tracked {
+		keep[did] = true
+		if st, ok := p.status[did]; ok && now.Before(st.NextCheck) {
+			continue
+		}
+		if !p.enqueue(did) {
+			break
+		}
+	}
+	for did := range p.status {
+		if !keep[did] {
+			delete(p.status, did)
+		}
+	}
+	p.updateFailingGauge()
+}
+
+// Run starts the workers, and scans the tracked accounts every ScanInterval, until the context is cancelled.
+func (p *Pool) Run(ctx context.Context, tracked func() []string) {
+	var wg sync.WaitGroup
+	for range max(p.opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	defer wg.Wait()
+
+	t := time.NewTicker(p.opts.ScanInterval)
+	defer t.Stop()
+	for {
+		p.Scan(tracked(), time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case did := <-p.queue:
+			p.lk.Lock()
+			delete(p.queued, did)
+			p.lk.Unlock()
+			p.check(ctx, did, time.Now())
+		}
+	}
+}
+
+// check runs one check and records its result
+func (p *Pool) check(ctx context.Context, did string, now time.Time) {
+	handle, err := p.checker.Check(ctx, did)
+	if err != nil && ctx.Err() != nil {
+		// shutting down; the failure says nothing about the account
+		return
+	}
+
+	p.lk.Lock()
+	st, ok := p.status[did]
+	if !ok {
+		st = &Status{DID: did}
+		p.status[did] = st
+	}
+	wasFailing := st.Persistent()
+	if handle != "" {
+		st.Handle = handle
+	}
+	st.CheckedAt = now
+	if err == nil {
+		checksCounter.WithLabelValues("verified").Inc()
+		st.Verified = true
+		st.Failures = 0
+		st.LastError = ""
+		st.FailingSince = time.Time{}
+		st.NextCheck = now.Add(p.opts.VerifiedTTL)
+	} else {
+		checksCounter.WithLabelValues("failed").Inc()
+		st.Verified = false
+		st.Failures++
+		st.LastError = err.Error()
+		st.NextCheck = now.Add(p.opts.FailedTTL)
+		if st.Failures >= p.opts.FailureThreshold && !wasFailing {
+			st.FailingSince = now
+		}
+	}
+	out := *st
+	flipped := wasFailing != st.Persistent()
+	if flipped {
+		p.updateFailingGauge()
+	}
+	p.lk.Unlock()
+
+	if p.opts.OnResult != nil {
+		p.opts.OnResult(out, flipped)
+	}
+}
+
+// updateFailingGauge must be called with lk held
+func (p *Pool) updateFailingGauge() {
+	n := 0
+	for _, st := range p.status {
+		if st.Persistent() {
+			n++
+		}
+	}
+	failingGauge.Set(float64(n))
+}
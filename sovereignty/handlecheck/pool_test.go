@@ -0,0 +1,73 @@
+package handlecheck
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	broken := map[string]bool{"did:plc:bad": true}
+	var flips []Status
+	opts := DefaultOptions()
+	opts.OnResult = func(st Status, flipped bool) {
+		if flipped {
+			flips = append(flips, st)
+		}
+	}
+	p := NewPool(CheckerFunc(func(ctx context.Context, did string) (string, error) {
+		if broken[did] {
+			return "bad.example.ca", fmt.Errorf("handle resolves to a different DID")
+		}
+		return "good.example.ca", nil
+	}), opts)
+
+	now := time.Now()
+	p.check(ctx, "did:plc:good", now)
+	for i := range 3 {
+		p.check(ctx, "did:plc:bad", now.Add(time.Duration(i)*time.Minute))
+	}
+
+	good, ok := p.Get("did:plc:good")
+	assert.True(ok)
+	assert.True(good.Verified)
+	assert.Equal("good.example.ca", good.Handle)
+	assert.Equal(now.Add(opts.VerifiedTTL), good.NextCheck)
+
+	// failures are cached for less time, and become persistent at the threshold
+	bad, _ := p.Get("did:plc:bad")
+	assert.False(bad.Verified)
+	assert.Equal(3, bad.Failures)
+	assert.Equal(now.Add(2*time.Minute).Add(opts.FailedTTL), bad.NextCheck)
+	assert.True(bad.Persistent())
+	assert.Len(flips, 1)
+	assert.Equal([]string{"did:plc:bad"}, dids(p.Failing()))
+
+	// scans only enqueue due and new accounts, and forget untracked ones
+	p.Scan([]string{"did:plc:bad", "did:plc:new"}, now.Add(30*time.Minute))
+	assert.Len(p.queue, 1)
+	p.Scan([]string{"did:plc:bad", "did:plc:new"}, now.Add(2*time.Hour))
+	assert.Len(p.queue, 2)
+	_, ok = p.Get("did:plc:good")
+	assert.False(ok)
+
+	// recovery clears the persistent failure
+	broken["did:plc:bad"] = false
+	p.check(ctx, "did:plc:bad", now.Add(2*time.Hour))
+	assert.Empty(p.Failing())
+	assert.Len(flips, 2)
+}
+
+func dids(sts []Status) []string {
+	var out []string
+	for _, st := range sts {
+		out = append(out, st.DID)
+	}
+	return out
+}
@@ -0,0 +1,4 @@
+// English and French output for operator-facing strings.
+//
+// Messages are written in English, which is the canonical form and the key their translations are looked up by, so untranslated messages fall back to English. The language of a request is negotiated from its Accept-Language header, falling back to the relay's configured language. Only output read by people is translated: logs and metrics stay in English.
+package i18n
@@ -0,0 +1,102 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lang is a language operator-facing output is available in.
+type Lang string
+
+const (
+	English Lang = "en"
+	French  Lang = "fr"
+)
+
+// ParseLang parses a language by code (en or fr), ignoring any region (eg, fr-CA).
+func ParseLang(s string) (Lang, error) {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "-")
+	switch l := Lang(base); l {
+	case English, French:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unsupported language: %q (must be en or fr)", s)
+	}
+}
+
+// Negotiate picks the language to answer a request in from its Accept-Language header: the supported language the client prefers most, or fallback if it prefers none of them.
+func Negotiate(header string, fallback Lang) Lang {
+	type pref struct {
+		lang Lang
+		q    float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		l, err := ParseLang(tag)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, pref{l, q})
+		}
+	}
+	if len(prefs) == 0 {
+		return fallback
+	}
+	// the first listed wins among equals
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	return prefs[0].lang
+}
+
+// Translate returns a message in the language, or unchanged if it has no translation.
+func Translate(l Lang, msg string) string {
+	if l == French {
+		if t, ok := french[msg]; ok {
+			return t
+		}
+	}
+	return msg
+}
+
+// Sprintf formats a message in the language, translating the English format string.
+func Sprintf(l Lang, format string, args ...any) string {
+	return fmt.Sprintf(Translate(l, format), args...)
+}
+
+var frenchMonths = [...]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}
+
+func frenchDate(t time.Time) string {
+	day := strconv.Itoa(t.Day())
+	if t.Day() == 1 {
+		day = "1er"
+	}
+	return fmt.Sprintf("%s %s %d", day, frenchMonths[t.Month()-1], t.Year())
+}
+
+// FormatDate formats the date of a time, in UTC: 2025-03-01 in English, 1er mars 2025 in French.
+func FormatDate(l Lang, t time.Time) string {
+	t = t.UTC()
+	if l == French {
+		return frenchDate(t)
+	}
+	return t.Format(time.DateOnly)
+}
+
+// FormatTime formats a time to the minute, in UTC: 2025-03-01 12:30 UTC in English, 1er mars 2025 à 12 h 30 UTC in French.
+func FormatTime(l Lang, t time.Time) string {
+	t = t.UTC()
+	if l == French {
+		return fmt.Sprintf("%s à %d h %02d UTC", frenchDate(t), t.Hour(), t.Minute())
+	}
+	return t.Format("2006-01-02 15:04") + " UTC"
+}
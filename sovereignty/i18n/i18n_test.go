@@ -0,0 +1,51 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tc := range []struct {
+		header   string
+		fallback Lang
+		expected Lang
+	}{
+		{"", English, English},
+		{"", French, French},
+		{"fr-CA,fr;q=0.9,en;q=0.8", English, French},
+		{"en-CA, fr-CA;q=0.5", French, English},
+		{"de, fr;q=0.2", English, French},
+		{"de, *;q=0.5", French, French},
+		{"fr;q=0, en", French, English},
+		{"EN-us", French, English},
+	} {
+		assert.Equal(tc.expected, Negotiate(tc.header, tc.fallback), tc.header)
+	}
+
+	l, err := ParseLang("fr-CA")
+	assert.NoError(err)
+	assert.Equal(French, l)
+	_, err = ParseLang("de")
+	assert.Error(err)
+}
+
+func TestTranslate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("limit doit être compris entre 1 et 1000", Translate(French, "limit must be between 1 and 1000"))
+	assert.Equal("limit must be between 1 and 1000", Translate(English, "limit must be between 1 and 1000"))
+	assert.Equal("no translation here", Translate(French, "no translation here"))
+	assert.Equal("CA est diffusé sur le flux souverain", Sprintf(French, "%s is carried on the sovereign stream", "CA"))
+
+	ts := time.Date(2025, 3, 1, 9, 5, 0, 0, time.FixedZone("EST", -5*3600))
+	assert.Equal("2025-03-01", FormatDate(English, ts))
+	assert.Equal("1er mars 2025", FormatDate(French, ts))
+	assert.Equal("2025-03-01 14:05 UTC", FormatTime(English, ts))
+	assert.Equal("1er mars 2025 à 14 h 05 UTC", FormatTime(French, ts))
+	assert.Equal("12 août 2025", FormatDate(French, time.Date(2025, 8, 12, 0, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,103 @@
+package i18n
+
+// french translates operator-facing messages, keyed by their English text (or format string)
+var french = map[string]string{
+	// account standing
+	"designated as a priority account, which is always carried":                          "désigné comme compte prioritaire, toujours diffusé",
+	"listed as out of country by the relay operator, which overrides its classification": "inscrit par l'opérateur du relais comme hors du pays, ce qui l'emporte sur sa classification",
+	"listed as in country by the relay operator, which is always carried":                "inscrit par l'opérateur du relais comme dans le pays, toujours diffusé",
+	"classified as %s (source: %s, updated %s)":                                          "classé %s (source : %s, mis à jour le %s)",
+	"unspecified":                           "non précisée",
+	"%s is carried on the sovereign stream": "%s est diffusé sur le flux souverain",
+	"%s is not carried on the sovereign stream (carried: %s)":                                     "%s n'est pas diffusé sur le flux souverain (diffusés : %s)",
+	"%s is excluded from the sovereign stream":                                                    "%s est exclu du flux souverain",
+	"the sovereign stream carries all accounts except those of excluded countries (excluded: %s)": "le flux souverain diffuse tous les comptes sauf ceux des pays exclus (exclus : %s)",
+	"none":                          "aucun",
+	"not classified to any country": "n'est classé dans aucun pays",
+	"identity history flagged: %s":  "historique d'identité signalé : %s",
+	"record content is withheld, only record hashes are carried": "le contenu des enregistrements est retenu, seuls leurs hachages sont diffusés",
+
+	// admin API responses
+	"atproto service auth required":                    "authentification de service atproto requise",
+	"must specify numeric appeal id":                   "un identifiant d'appel numérique est requis",
+	"account is not taken down":                        "le compte n'est pas retiré",
+	"only classified accounts' handles are tracked":    "seuls les pseudonymes des comptes classés sont suivis",
+	"account's handle has not been checked":            "le pseudonyme du compte n'a pas été vérifié",
+	"no classification for DID":                        "aucune classification pour ce DID",
+	"priority accounts must be verified organizations": "les comptes prioritaires doivent être des organisations vérifiées",
+	"not a priority account":                           "ce n'est pas un compte prioritaire",
+	"not a verified organization":                      "ce n'est pas une organisation vérifiée",
+	"no such pending event":                            "aucun événement en attente de ce type",
+	"account is not on the watchlist":                  "le compte n'est pas sous surveillance",
+	"no such active hold":                              "aucune conservation légale active de ce type",
+	"no such bundle":                                   "aucun paquet de ce nom",
+	"no such profile":                                  "aucun profil de ce nom",
+	"no such subscriber token":                         "aucun jeton d'abonné de ce type",
+	"invalid subscriber token":                         "jeton d'abonné invalide",
+	"profile is assigned to active subscriber tokens":  "le profil est attribué à des jetons d'abonné actifs",
+	"repo not found":                                   "dépôt introuvable",
+	"record not found":                                 "enregistrement introuvable",
+	"too many captures waiting to be written":          "trop de captures en attente d'écriture",
+	"handle check queue is full":                       "la file de vérification des pseudonymes est pleine",
+	"a mirror check pass is already running":           "une vérification des miroirs est déjà en cours",
+	"account lists are not configured":                 "les listes de comptes ne sont pas configurées",
+	"account is not listed through the admin API":      "le compte n'est pas inscrit par l'API d'administration",
+	"a scrub pass is already running":                  "une vérification d'intégrité est déjà en cours",
+	"domain is already banned":                         "le domaine est déjà banni",
+	"domain is already trusted":                        "le domaine est déjà approuvé",
+	"no active connection to given host":               "aucune connexion active à cet hôte",
+	"no resync found for given PDS":                    "aucune resynchronisation trouvée pour ce PDS",
+	"cannot remove the last enrolled credential":       "impossible de retirer le dernier identifiant enregistré",
+	"no such credential":                               "aucun identifiant de ce type",
+	"unknown or expired challenge":                     "défi inconnu ou expiré",
+
+	"limit must be between 1 and 1000":                       "limit doit être compris entre 1 et 1000",
+	"invalid value for 'limit' (must be between 1 and 100)":  "valeur de « limit » invalide (doit être comprise entre 1 et 100)",
+	"invalid value for 'limit' (must be between 1 and 250)":  "valeur de « limit » invalide (doit être comprise entre 1 et 250)",
+	"invalid value for 'limit' (must be between 1 and 1000)": "valeur de « limit » invalide (doit être comprise entre 1 et 1000)",
+	"kind must be account or pds":                            "kind doit valoir account ou pds",
+	"log must be priority, appeals or legal-holds":           "log doit valoir priority, appeals ou legal-holds",
+	"list must be in_country or out_of_country":              "list doit valoir in_country ou out_of_country",
+	"redaction must be none, standard or records":            "redaction doit valoir none, standard ou records",
+	"annotations must be none, standard or full":             "annotations doit valoir none, standard ou full",
+	"result must be include, hash_only or exclude":           "result doit valoir include, hash_only ou exclude",
+	"by must be bytes or events":                             "by doit valoir bytes ou events",
+	"after must be a sequence number":                        "after doit être un numéro de séquence",
+	"must pass a valid host":                                 "un hôte valide est requis",
+	"must specify a 'cid'":                                   "un « cid » est requis",
+	"must specify a did:plc":                                 "un did:plc est requis",
+	"must specify name and actor":                            "un nom et un acteur sont requis",
+	"must specify a name for the credential":                 "un nom d'identifiant est requis",
+	"must specify a valid 'did'":                             "un « did » valide est requis",
+	"must specify actor":                                     "un acteur est requis",
+	"must specify actor for the audit log":                   "un acteur est requis pour le journal d'audit",
+	"must specify at least one uriPatterns":                  "au moins un uriPatterns est requis",
+	"must specify did and actor in body":                     "did et actor sont requis dans le corps",
+	"must specify did in body":                               "did est requis dans le corps",
+	"must specify did or host":                               "did ou host est requis",
+	"must specify did parameter in body":                     "le paramètre did est requis dans le corps",
+	"must specify enabled":                                   "enabled est requis",
+	"must specify reason and actor for the audit log":        "une raison et un acteur sont requis pour le journal d'audit",
+	"must specify reviewer and actor":                        "un réviseur et un acteur sont requis",
+	"PDS geolocation is not configured":                      "la géolocalisation des PDS n'est pas configurée",
+	"no country resolver is configured":                      "aucun résolveur de pays n'est configuré",
+	"PLC auditing is not enabled":                            "l'audit PLC n'est pas activé",
+	"admin WebAuthn is not enabled":                          "WebAuthn pour l'administration n'est pas activé",
+	"extensions are not configured":                          "les extensions ne sont pas configurées",
+	"external verification is not enabled":                   "la vérification externe n'est pas activée",
+	"encryption at rest is not enabled":                      "le chiffrement au repos n'est pas activé",
+	"event accounting is not enabled":                        "la comptabilisation des événements n'est pas activée",
+	"feature flags are not enabled":                          "les indicateurs de fonctionnalité ne sont pas activés",
+	"flapping detection is not enabled":                      "la détection d'instabilité n'est pas activée",
+	"forensic capture is not enabled":                        "la capture forensique n'est pas activée",
+	"handle verification is not enabled":                     "la vérification des pseudonymes n'est pas activée",
+	"integrity scrubbing is not enabled":                     "la vérification d'intégrité n'est pas activée",
+	"minor protection is not enabled":                        "la protection des mineurs n'est pas activée",
+	"mirror checking is not enabled":                         "la vérification des miroirs n'est pas activée",
+	"moderation pre-screening is not enabled":                "le contrôle préalable par la modération n'est pas activé",
+	"residency declarations are not enabled":                 "les déclarations de résidence ne sont pas activées",
+	"record validation is not enabled":                       "la validation des enregistrements n'est pas activée",
+	"shadow decision logging is not enabled":                 "la journalisation des décisions en mode fantôme n'est pas activée",
+	"the sequencer is only used by the disk persister":       "le séquenceur n'est utilisé que par la persistance sur disque",
+	"this relay only hosts its own repo":                     "ce relais n'héberge que son propre dépôt",
+}
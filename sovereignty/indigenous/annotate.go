@@ -0,0 +1,93 @@
+package indigenous
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+const postCollection = "app.bsky.feed.post"
+
+// AnnotateEvent returns the event with an annotation for each post declaring an Indigenous language. Events without any such post are returned unchanged; otherwise a copy is returned with the annotations added to its (unsigned) FrameMeta. The input event is never mutated.
+func AnnotateEvent(evt *events.XRPCStreamEvent) (*events.XRPCStreamEvent, error) {
+	if evt.RepoCommit == nil {
+		return evt, nil
+	}
+	commit := evt.RepoCommit
+
+	want := make(map[cid.Cid]string)
+	for _, op := range commit.Ops {
+		if op.Cid != nil && strings.HasPrefix(op.Path, postCollection+"/") {
+			want[cid.Cid(*op.Cid)] = op.Path
+		}
+	}
+	if len(want) == 0 {
+		return evt, nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	var annotations []events.OpAnnotation
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		path, ok := want[blk.Cid()]
+		if !ok {
+			continue
+		}
+		rec, err := data.UnmarshalCBOR(blk.RawData())
+		if err != nil {
+			continue
+		}
+		if langs := Match(recordLangs(rec)); len(langs) > 0 {
+			annotations = append(annotations, events.OpAnnotation{Path: path, Langs: langs})
+		}
+	}
+	if len(annotations) == 0 {
+		return evt, nil
+	}
+
+	meta := &events.FrameMeta{
+		Repo: commit.Repo,
+		Seq:  commit.Seq,
+	}
+	if evt.Meta != nil {
+		*meta = *evt.Meta
+		meta.Sig = nil
+	}
+	meta.Annotations = append(append([]events.OpAnnotation{}, meta.Annotations...), annotations...)
+
+	return &events.XRPCStreamEvent{
+		RepoCommit: commit,
+		Meta:       meta,
+		PrivUid:    evt.PrivUid,
+	}, nil
+}
+
+func recordLangs(rec map[string]any) []string {
+	raw, ok := rec["langs"].([]any)
+	if !ok {
+		return nil
+	}
+	var langs []string
+	for _, l := range raw {
+		if s, ok := l.(string); ok {
+			langs = append(langs, s)
+		}
+	}
+	return langs
+}
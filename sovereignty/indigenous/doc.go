@@ -0,0 +1,4 @@
+// Recognition of Indigenous languages of Canada in post language tags.
+//
+// Posts declare their languages as BCP-47 tags in the "langs" field. The primary subtag of each is checked against a table of ISO 639 codes for Indigenous languages (eg, "iu" Inuktitut, "cr" Cree, "oj" Ojibwe), and matches are used to annotate the sovereign stream and to populate a dedicated search index field.
+package indigenous
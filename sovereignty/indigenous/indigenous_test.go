@@ -0,0 +1,64 @@
+package indigenous
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tc := range []struct {
+		tags []string
+		out  []string
+	}{
+		{[]string{"en", "fr"}, nil},
+		{[]string{"iu"}, []string{"iu"}},
+		{[]string{"IU-Cans", "en", "iu-Latn"}, []string{"iu"}},
+		{[]string{"crk", "oj", "moh"}, []string{"crk", "oj", "moh"}},
+		{[]string{"", "-", "cree"}, nil},
+	} {
+		assert.Equal(tc.out, Match(tc.tags), tc.tags)
+	}
+}
+
+func TestAnnotateEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	commit := cartest.Commit(t, "did:plc:abc")
+	iu := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "ᐊᐃ", "langs": []any{"iu"}})
+	en := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "hi", "langs": []any{"en"}})
+
+	orig := &events.XRPCStreamEvent{
+		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:abc",
+			Seq:    7,
+			Blocks: cartest.CAR(t, commit, iu, en),
+			Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+				{Action: "create", Path: "app.bsky.feed.post/3k", Cid: iu.Link()},
+				{Action: "create", Path: "app.bsky.feed.post/3l", Cid: en.Link()},
+			},
+		},
+		Preserialized: []byte("stale"),
+	}
+
+	out, err := AnnotateEvent(orig)
+	assert.NoError(err)
+	assert.Nil(orig.Meta)
+	assert.Nil(out.Preserialized)
+	if assert.NotNil(out.Meta) {
+		assert.Equal(int64(7), out.Meta.Seq)
+		assert.Equal([]events.OpAnnotation{{Path: "app.bsky.feed.post/3k", Langs: []string{"iu"}}}, out.Meta.Annotations)
+	}
+
+	// no matching posts, no change
+	orig.RepoCommit.Ops = orig.RepoCommit.Ops[1:]
+	same, err := AnnotateEvent(orig)
+	assert.NoError(err)
+	assert.Same(orig, same)
+}
@@ -0,0 +1,122 @@
+package indigenous
+
+import (
+	"strings"
+)
+
+// Languages maps ISO 639 codes of Indigenous languages of Canada to their English names. Macrolanguage codes (eg, "cr") and individual language codes (eg, "crk") are both included, since either may appear in tags.
+var Languages = map[string]string{
+	// Inuit languages
+	"iu":  "Inuktitut",
+	"ike": "Eastern Canadian Inuktitut",
+	"ikt": "Inuinnaqtun",
+	"ik":  "Inupiaq",
+	// Cree and related
+	"cr":  "Cree",
+	"crk": "Plains Cree",
+	"cwd": "Woods Cree",
+	"csw": "Swampy Cree",
+	"crm": "Moose Cree",
+	"crl": "Northern East Cree",
+	"crj": "Southern East Cree",
+	"nsk": "Naskapi",
+	"moe": "Innu-aimun",
+	"atj": "Atikamekw",
+	"crg": "Michif",
+	// Ojibwe and related
+	"oj":  "Ojibwe",
+	"ojb": "Northwestern Ojibwe",
+	"ojc": "Central Ojibwe",
+	"ojg": "Eastern Ojibwe",
+	"ojs": "Oji-Cree",
+	"ojw": "Western Ojibwe",
+	"otw": "Odawa",
+	"alq": "Algonquin",
+	"pot": "Potawatomi",
+	// other Algonquian
+	"mic": "Mi'kmaq",
+	"pqm": "Wolastoqey (Maliseet-Passamaquoddy)",
+	"bla": "Blackfoot",
+	"del": "Lenape",
+	// Iroquoian
+	"moh": "Mohawk",
+	"one": "Oneida",
+	"cay": "Cayuga",
+	"see": "Seneca",
+	"ono": "Onondaga",
+	"tus": "Tuscarora",
+	// Dene (Athabaskan)
+	"den": "Slavey",
+	"scs": "North Slavey",
+	"xsl": "South Slavey",
+	"chp": "Dene Suline",
+	"dgr": "Tłı̨chǫ",
+	"gwi": "Gwich'in",
+	"bea": "Beaver (Dane-zaa)",
+	"crx": "Carrier",
+	"caf": "Southern Carrier",
+	"clc": "Chilcotin",
+	"kkz": "Kaska",
+	"tht": "Tahltan",
+	"ttm": "Northern Tutchone",
+	"tce": "Southern Tutchone",
+	"srs": "Tsuut'ina",
+	"sek": "Sekani",
+	// Siouan
+	"sto": "Stoney (Nakoda)",
+	"dak": "Dakota",
+	"lkt": "Lakota",
+	"asb": "Assiniboine",
+	// Pacific coast and interior
+	"hai": "Haida",
+	"tli": "Tlingit",
+	"tsi": "Sm'algyax (Tsimshian)",
+	"git": "Gitxsan",
+	"ncg": "Nisga'a",
+	"kwk": "Kwak'wala",
+	"hei": "Heiltsuk",
+	"has": "Haisla",
+	"nuk": "Nuu-chah-nulth",
+	"dtd": "Ditidaht",
+	"hur": "Halkomelem",
+	"squ": "Squamish",
+	"str": "Straits Salish",
+	"sec": "Sechelt",
+	"coo": "Comox",
+	"lil": "St'át'imcets (Lillooet)",
+	"shs": "Secwepemctsín (Shuswap)",
+	"thp": "Nłeʔkepmxcín (Thompson)",
+	"oka": "Nsyilxcən (Okanagan)",
+	"kut": "Ktunaxa",
+	"blc": "Nuxalk (Bella Coola)",
+}
+
+// Code returns the lower-cased primary subtag of a BCP-47 language tag, and whether it is an Indigenous language.
+func Code(tag string) (string, bool) {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	primary = strings.ToLower(primary)
+	_, ok := Languages[primary]
+	return primary, ok
+}
+
+// Match returns the Indigenous language codes among the given tags, de-duplicated, in order of first appearance.
+func Match(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		c, ok := Code(t)
+		if !ok {
+			continue
+		}
+		dup := false
+		for _, existing := range out {
+			if existing == c {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, c)
+		}
+	}
+	return out
+}
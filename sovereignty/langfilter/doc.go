@@ -0,0 +1,4 @@
+// Filtering of the sovereign stream by the languages posts declare.
+//
+// A Filter reads the `langs` of the posts a commit creates, and judges the commit Matched if any of them declares one of its languages, or Unmatched if none does; commits creating no posts are Undecided. A language matches a declared BCP-47 tag equal to it or extending it, case-insensitively: "fr-CA" matches "fr-CA" and "fr-CA-x-qc" but not "fr", while "fr" matches every French tag. The relay applies the verdict according to the filter's Mode, after the geographic filter: ModeRequire drops the commits it carries which are Unmatched, and ModePrefer carries commits which are Matched even when the geographic filter would leave them out.
+package langfilter
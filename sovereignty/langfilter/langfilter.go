@@ -0,0 +1,188 @@
+package langfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// Mode is how the relay applies a Filter's verdicts.
+type Mode string
+
+const (
+	// only commits whose posts declare one of the languages are carried
+	ModeRequire Mode = "require"
+	// commits whose posts declare one of the languages are carried whatever the geographic filter decides
+	ModePrefer Mode = "prefer"
+)
+
+// ParseMode parses a mode by name (require or prefer)
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeRequire, ModePrefer:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid language filter mode %q (must be require or prefer)", s)
+}
+
+// Verdict is a Filter's judgement of a commit.
+type Verdict int
+
+const (
+	// the commit creates no posts
+	Undecided Verdict = iota
+	// a post the commit creates declares one of the languages
+	Matched
+	// the commit creates posts, none declaring one of the languages
+	Unmatched
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Matched:
+		return "matched"
+	case Unmatched:
+		return "unmatched"
+	default:
+		return "undecided"
+	}
+}
+
+const postCollection = "app.bsky.feed.post"
+
+type Options struct {
+	Mode Mode
+	// BCP-47 language tags, each matching the tags equal to it or extending it
+	Langs []string
+	// posts declaring no languages are Matched, rather than Unmatched
+	KeepUndeclared bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Mode:  ModeRequire,
+		Langs: []string{"fr-CA", "en-CA"},
+	}
+}
+
+// Filter judges commits by the languages of the posts they create.
+type Filter struct {
+	Mode           Mode
+	langs          []string
+	keepUndeclared bool
+}
+
+// NewFilter validates the options.
+func NewFilter(opts Options) (*Filter, error) {
+	if _, err := ParseMode(string(opts.Mode)); err != nil {
+		return nil, err
+	}
+	if len(opts.Langs) == 0 {
+		return nil, fmt.Errorf("language filter needs at least one language")
+	}
+	f := &Filter{Mode: opts.Mode, keepUndeclared: opts.KeepUndeclared}
+	for _, l := range opts.Langs {
+		if !validTag(l) {
+			return nil, fmt.Errorf("invalid language tag %q", l)
+		}
+		f.langs = append(f.langs, strings.ToLower(l))
+	}
+	return f, nil
+}
+
+// validTag checks the shape of a BCP-47 tag: alphanumeric subtags of up to 8 characters, separated by hyphens, the first alphabetic
+func validTag(tag string) bool {
+	for i, sub := range strings.Split(tag, "-") {
+		if sub == "" || len(sub) > 8 {
+			return false
+		}
+		for _, c := range sub {
+			alpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !alpha && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Matches reports whether a post declaring the languages is in one of the filter's.
+func (f *Filter) Matches(langs []string) bool {
+	if len(langs) == 0 {
+		return f.keepUndeclared
+	}
+	for _, tag := range langs {
+		tag = strings.ToLower(tag)
+		for _, l := range f.langs {
+			if tag == l || strings.HasPrefix(tag, l+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Commit judges a commit by the posts it creates, reading their records from its blocks. Posts whose records the commit doesn't carry, or which can't be decoded, are judged as declaring no languages.
+func (f *Filter) Commit(commit *comatproto.SyncSubscribeRepos_Commit) (Verdict, error) {
+	posts := make(map[cid.Cid]bool)
+	for _, op := range commit.Ops {
+		if op.Action == "create" && op.Cid != nil && strings.HasPrefix(op.Path, postCollection+"/") {
+			posts[cid.Cid(*op.Cid)] = false
+		}
+	}
+	if len(posts) == 0 {
+		return Undecided, nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return Undecided, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Undecided, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		if _, ok := posts[blk.Cid()]; !ok {
+			continue
+		}
+		posts[blk.Cid()] = true
+		rec, err := data.UnmarshalCBOR(blk.RawData())
+		if err != nil {
+			rec = nil
+		}
+		if f.Matches(recordLangs(rec)) {
+			return Matched, nil
+		}
+	}
+	for _, read := range posts {
+		if !read && f.Matches(nil) {
+			return Matched, nil
+		}
+	}
+	return Unmatched, nil
+}
+
+func recordLangs(rec map[string]any) []string {
+	raw, ok := rec["langs"].([]any)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package langfilter
+
+import (
+	"fmt"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// postCommit builds a commit creating a post declaring each set of languages (nil for none)
+func postCommit(t *testing.T, posts ...[]any) *comatproto.SyncSubscribeRepos_Commit {
+	blocks := []cartest.Block{cartest.Commit(t, "did:plc:abc")}
+	commit := &comatproto.SyncSubscribeRepos_Commit{Repo: "did:plc:abc"}
+	for i, langs := range posts {
+		rec := map[string]any{"$type": "app.bsky.feed.post", "text": fmt.Sprintf("post %d", i)}
+		if langs != nil {
+			rec["langs"] = langs
+		}
+		blk := cartest.NewBlock(t, rec)
+		blocks = append(blocks, blk)
+		commit.Ops = append(commit.Ops, &comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: fmt.Sprintf("app.bsky.feed.post/3k%d", i), Cid: blk.Link()})
+	}
+	commit.Blocks = cartest.CAR(t, blocks...)
+	return commit
+}
+
+func TestMatches(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFilter(DefaultOptions())
+	assert.NoError(err)
+	assert.True(f.Matches([]string{"fr-CA"}))
+	assert.True(f.Matches([]string{"de", "EN-ca"}))
+	assert.True(f.Matches([]string{"fr-CA-x-qc"}))
+	assert.False(f.Matches([]string{"fr", "en-US"}))
+	assert.False(f.Matches([]string{"fr-CAN"}))
+	assert.False(f.Matches(nil))
+
+	opts := DefaultOptions()
+	opts.Langs = []string{"fr", "iu"}
+	opts.KeepUndeclared = true
+	f, err = NewFilter(opts)
+	assert.NoError(err)
+	assert.True(f.Matches([]string{"fr-FR"}))
+	assert.True(f.Matches([]string{"iu-Cans-CA"}))
+	assert.False(f.Matches([]string{"en"}))
+	assert.True(f.Matches(nil))
+
+	_, err = NewFilter(Options{Mode: "favour", Langs: []string{"fr"}})
+	assert.ErrorContains(err, "invalid language filter mode")
+	_, err = NewFilter(Options{Mode: ModePrefer})
+	assert.Error(err)
+	_, err = NewFilter(Options{Mode: ModePrefer, Langs: []string{"fr_CA"}})
+	assert.ErrorContains(err, "invalid language tag")
+}
+
+func TestCommit(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFilter(DefaultOptions())
+	assert.NoError(err)
+
+	check := func(want Verdict, commit *comatproto.SyncSubscribeRepos_Commit) {
+		t.Helper()
+		v, err := f.Commit(commit)
+		assert.NoError(err)
+		assert.Equal(want, v)
+	}
+	check(Matched, postCommit(t, []any{"en-US"}, []any{"fr-CA"}))
+	check(Unmatched, postCommit(t, []any{"en-US"}, nil))
+	check(Undecided, postCommit(t))
+
+	// only the posts created count
+	commit := postCommit(t, []any{"de"})
+	commit.Ops = append(commit.Ops, &comatproto.SyncSubscribeRepos_RepoOp{Action: "delete", Path: "app.bsky.feed.post/3x"})
+	check(Unmatched, commit)
+	commit.Ops = commit.Ops[1:]
+	check(Undecided, commit)
+
+	// a post whose record the commit doesn't carry declares no languages
+	commit = postCommit(t, []any{"de"})
+	commit.Blocks = postCommit(t).Blocks
+	check(Unmatched, commit)
+	opts := DefaultOptions()
+	opts.KeepUndeclared = true
+	f, err = NewFilter(opts)
+	assert.NoError(err)
+	check(Matched, commit)
+
+	commit.Blocks = []byte("junk")
+	_, err = f.Commit(commit)
+	assert.Error(err)
+}
@@ -0,0 +1,4 @@
+// Sampling-based estimates of the language distribution of sovereign content, by region and day.
+//
+// A Collector samples a fixed fraction of new posts from classified accounts (chosen by a hash of the record URI, so the sample is deterministic and unaffected by replays), and buckets each by its declared languages: English, French, each Indigenous language (by ISO 639 code), other languages, and undetermined when none are declared. Counts are accumulated in memory per ISO 3166-2 region (eg, "CA-QC", or "CA" when the account's province or territory isn't known) and UTC day, and periodically flushed to a Store, which serves share estimates with confidence intervals for official-languages reporting.
+package langstats
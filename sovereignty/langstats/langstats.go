@@ -0,0 +1,224 @@
+package langstats
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/sovereignty/indigenous"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+const (
+	LangEnglish = "en"
+	LangFrench  = "fr"
+	// a declared language which is neither official nor Indigenous
+	LangOther = "other"
+	// no declared languages
+	LangUndetermined = "und"
+)
+
+// bucket of the per-region daily total of sampled posts
+const langTotal = ""
+
+const postCollection = "app.bsky.feed.post"
+
+// Buckets returns the language buckets a post with the given BCP-47 language tags counts towards, de-duplicated, in order of first appearance. Indigenous languages are bucketed by their ISO 639 code.
+func Buckets(langs []string) []string {
+	var out []string
+	add := func(b string) {
+		for _, existing := range out {
+			if existing == b {
+				return
+			}
+		}
+		out = append(out, b)
+	}
+	for _, tag := range langs {
+		code, ok := indigenous.Code(tag)
+		switch {
+		case ok:
+			add(code)
+		case code == LangEnglish, code == LangFrench:
+			add(code)
+		case code != "":
+			add(LangOther)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, LangUndetermined)
+	}
+	return out
+}
+
+// Key identifies one counter: the posts sampled in a region on a day, in one language bucket.
+type Key struct {
+	// UTC midnight
+	Day    time.Time
+	Region string
+	Lang   string
+}
+
+// Collector samples posts and accumulates language counts in memory until they are taken for storage. It is safe for concurrent use.
+type Collector struct {
+	// fraction of posts sampled
+	Rate float64
+
+	// posts are sampled when the hash of their URI is below this
+	threshold uint64
+	lk        sync.Mutex
+	counts    map[Key]int64
+}
+
+// NewCollector returns a collector sampling the given fraction of posts, which must be in (0, 1].
+func NewCollector(rate float64) (*Collector, error) {
+	if !(rate > 0 && rate <= 1) {
+		return nil, fmt.Errorf("language statistics sample rate must be in (0, 1], got %v", rate)
+	}
+	threshold := uint64(math.MaxUint64)
+	if rate < 1 {
+		threshold = uint64(rate * math.MaxUint64)
+	}
+	return &Collector{
+		Rate:      rate,
+		threshold: threshold,
+		counts:    make(map[Key]int64),
+	}, nil
+}
+
+// Sampled returns true if the record is part of the sample.
+func (c *Collector) Sampled(uri string) bool {
+	h := sha256.Sum256([]byte(uri))
+	return binary.BigEndian.Uint64(h[:8]) <= c.threshold
+}
+
+// Observe counts a sampled post, declaring the given languages, for a region and time.
+func (c *Collector) Observe(region string, langs []string, at time.Time) {
+	day := at.UTC().Truncate(24 * time.Hour)
+	buckets := Buckets(langs)
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.counts[Key{Day: day, Region: region, Lang: langTotal}]++
+	for _, b := range buckets {
+		c.counts[Key{Day: day, Region: region, Lang: b}]++
+		sampledPosts.WithLabelValues(b).Inc()
+	}
+}
+
+// ObserveCommit counts the sampled posts created in a commit, attributing them to the given region. Records which can't be decoded are skipped.
+func (c *Collector) ObserveCommit(commit *comatproto.SyncSubscribeRepos_Commit, region string, at time.Time) error {
+	want := make(map[cid.Cid]bool)
+	for _, op := range commit.Ops {
+		if op.Action != "create" || op.Cid == nil || !strings.HasPrefix(op.Path, postCollection+"/") {
+			continue
+		}
+		if c.Sampled("at://" + commit.Repo + "/" + op.Path) {
+			want[cid.Cid(*op.Cid)] = true
+		}
+	}
+	if len(want) == 0 {
+		return nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return fmt.Errorf("reading commit blocks: %w", err)
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading commit blocks: %w", err)
+		}
+		if !want[blk.Cid()] {
+			continue
+		}
+		rec, err := data.UnmarshalCBOR(blk.RawData())
+		if err != nil {
+			continue
+		}
+		c.Observe(region, recordLangs(rec), at)
+	}
+	return nil
+}
+
+func recordLangs(rec map[string]any) []string {
+	raw, ok := rec["langs"].([]any)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Take returns the accumulated counts and resets them.
+func (c *Collector) Take() map[Key]int64 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	out := c.counts
+	c.counts = make(map[Key]int64)
+	return out
+}
+
+// restore adds counts back after a failed flush
+func (c *Collector) restore(counts map[Key]int64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for k, n := range counts {
+		c.counts[k] += n
+	}
+}
+
+// Flush moves the accumulated counts to the store. On failure the counts are kept for the next attempt.
+func (c *Collector) Flush(ctx context.Context, store *Store) error {
+	counts := c.Take()
+	if len(counts) == 0 {
+		return nil
+	}
+	if err := store.Add(ctx, counts, c.Rate); err != nil {
+		c.restore(counts)
+		flushErrors.Inc()
+		return err
+	}
+	return nil
+}
+
+// Run flushes counts to the store at the given interval until the context is cancelled, then makes a final flush.
+func (c *Collector) Run(ctx context.Context, store *Store, interval time.Duration, logger *slog.Logger) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.Flush(flushCtx, store); err != nil {
+				logger.Error("failed to flush language statistics", "err", err)
+			}
+			return
+		case <-t.C:
+			if err := c.Flush(ctx, store); err != nil {
+				logger.Warn("failed to flush language statistics", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package langstats
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{LangEnglish}, Buckets([]string{"en-CA"}))
+	assert.Equal([]string{LangFrench, LangEnglish}, Buckets([]string{"fr-CA", "EN", "en-US"}))
+	assert.Equal([]string{"iu", LangOther}, Buckets([]string{"iu", "de", "ja"}))
+	assert.Equal([]string{LangUndetermined}, Buckets(nil))
+}
+
+func TestSampled(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewCollector(0)
+	assert.Error(err)
+	_, err = NewCollector(1.5)
+	assert.Error(err)
+
+	all, err := NewCollector(1)
+	assert.NoError(err)
+	tenth, err := NewCollector(0.1)
+	assert.NoError(err)
+	n := 0
+	for i := 0; i < 10000; i++ {
+		uri := fmt.Sprintf("at://did:plc:abc/app.bsky.feed.post/%d", i)
+		assert.True(all.Sampled(uri))
+		if tenth.Sampled(uri) {
+			n++
+			// deterministic
+			assert.True(tenth.Sampled(uri))
+		}
+	}
+	assert.InDelta(1000, n, 150)
+}
+
+func TestObserveCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := cartest.NewBlock(t, map[string]any{
+		"$type": "app.bsky.feed.post",
+		"text":  "bonjour",
+		"langs": []any{"fr"},
+	})
+	commit := &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, rec),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/3k", Cid: rec.Link()},
+			{Action: "create", Path: "app.bsky.feed.like/3k", Cid: rec.Link()},
+		},
+	}
+	c, err := NewCollector(1)
+	assert.NoError(err)
+	now := time.Date(2026, 7, 1, 15, 0, 0, 0, time.UTC)
+	assert.NoError(c.ObserveCommit(commit, "CA-QC", now))
+
+	day := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(map[Key]int64{
+		{Day: day, Region: "CA-QC", Lang: langTotal}:  1,
+		{Day: day, Region: "CA-QC", Lang: LangFrench}: 1,
+	}, c.Take())
+	assert.Empty(c.Take())
+}
+
+func TestEstimates(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "langstats.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCollector(0.5)
+	assert.NoError(err)
+	day := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		c.Observe("CA-QC", []string{"fr"}, day)
+	}
+	for i := 0; i < 10; i++ {
+		c.Observe("CA-QC", []string{"en", "fr"}, day)
+	}
+	// too few to report
+	c.Observe("CA-NU", []string{"iu"}, day)
+	c.Observe("US", nil, day)
+	assert.NoError(c.Flush(ctx, store))
+	// flushes accumulate
+	c.Observe("CA-QC", []string{"cr"}, day)
+	assert.NoError(c.Flush(ctx, store))
+
+	est, err := store.Estimates(ctx, Query{Region: "CA", MinSamples: 5})
+	assert.NoError(err)
+	assert.Len(est, 1)
+	qc := est[0]
+	assert.Equal("2026-07-01", qc.Day)
+	assert.Equal("CA-QC", qc.Region)
+	assert.Equal(int64(41), qc.Samples)
+	assert.Equal(int64(82), qc.EstimatedPosts)
+	assert.Len(qc.Languages, 3)
+	assert.Equal(LangFrench, qc.Languages[0].Lang)
+	assert.Equal(int64(40), qc.Languages[0].Samples)
+	assert.InDelta(40.0/41, qc.Languages[0].Share, 0.0001)
+	assert.Less(qc.Languages[0].Low, qc.Languages[0].Share)
+	assert.Greater(qc.Languages[0].High, qc.Languages[0].Share)
+	assert.LessOrEqual(qc.Languages[0].High, 1.0)
+
+	est, err = store.Estimates(ctx, Query{})
+	assert.NoError(err)
+	assert.Len(est, 3)
+
+	est, err = store.Estimates(ctx, Query{Region: "CA-NU", Since: day.Add(24 * time.Hour)})
+	assert.NoError(err)
+	assert.Empty(est)
+}
@@ -0,0 +1,16 @@
+package langstats
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var sampledPosts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "langstats_sampled_posts_total",
+	Help: "Posts sampled for language statistics, by language bucket (a post may count towards several)",
+}, []string{"lang"})
+
+var flushErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "langstats_flush_errors_total",
+	Help: "Failed flushes of sampled counts to the database; the counts are kept for the next attempt",
+})
@@ -0,0 +1,161 @@
+package langstats
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LangSample is the persisted count of sampled posts for a Key. Rows with an empty Lang hold the total number of sampled posts.
+type LangSample struct {
+	ID     uint      `gorm:"primarykey"`
+	Day    time.Time `gorm:"uniqueIndex:idx_lang_sample_key"`
+	Region string    `gorm:"uniqueIndex:idx_lang_sample_key"`
+	Lang   string    `gorm:"uniqueIndex:idx_lang_sample_key"`
+	Count  int64
+	// sample rate in effect when the row was last updated
+	Rate float64
+}
+
+// Store persists sampled counts in a SQL database.
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&LangSample{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Add increments the stored counters by the given counts, sampled at the given rate.
+func (s *Store) Add(ctx context.Context, counts map[Key]int64, rate float64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for k, n := range counts {
+			row := LangSample{Day: k.Day, Region: k.Region, Lang: k.Lang, Count: n, Rate: rate}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "day"}, {Name: "region"}, {Name: "lang"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"count": gorm.Expr("lang_samples.count + ?", n),
+					"rate":  rate,
+				}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query selects the days and regions to estimate.
+type Query struct {
+	// a country ("CA", which includes all of its subdivisions) or a subdivision ("CA-QC"); empty for all regions
+	Region string
+	// inclusive range of UTC days; zero values leave the range open
+	Since time.Time
+	Until time.Time
+	// days with fewer sampled posts in a region are left out, as too small to estimate from (and too close to identifying individual accounts)
+	MinSamples int64
+}
+
+// LangShare is the estimated share of posts in one language bucket. Shares of a day may sum to more than one, as posts can declare several languages.
+type LangShare struct {
+	Lang    string  `json:"lang"`
+	Samples int64   `json:"samples"`
+	Share   float64 `json:"share"`
+	// 95% confidence interval of Share
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// Estimate is the language distribution of posts in a region on a day.
+type Estimate struct {
+	// UTC, as YYYY-MM-DD
+	Day     string `json:"day"`
+	Region  string `json:"region"`
+	Samples int64  `json:"samples"`
+	// total posts, extrapolated from the sample
+	EstimatedPosts int64       `json:"estimatedPosts"`
+	Languages      []LangShare `json:"languages"`
+}
+
+// Estimates returns the language distribution for each day and region matching the query, ordered by day and region.
+func (s *Store) Estimates(ctx context.Context, q Query) ([]Estimate, error) {
+	tx := s.db.WithContext(ctx).Model(&LangSample{})
+	if q.Region != "" {
+		tx = tx.Where("region = ? OR region LIKE ?", q.Region, q.Region+"-%")
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("day >= ?", q.Since.UTC().Truncate(24*time.Hour))
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("day <= ?", q.Until.UTC().Truncate(24*time.Hour))
+	}
+	var rows []LangSample
+	if err := tx.Order("day, region, lang").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	type dayRegion struct {
+		day    time.Time
+		region string
+	}
+	totals := make(map[dayRegion]LangSample)
+	for _, r := range rows {
+		if r.Lang == langTotal {
+			totals[dayRegion{r.Day.UTC(), r.Region}] = r
+		}
+	}
+	byKey := make(map[dayRegion]*Estimate)
+	var out []*Estimate
+	for _, r := range rows {
+		k := dayRegion{r.Day.UTC(), r.Region}
+		total, ok := totals[k]
+		if !ok || total.Count < max(q.MinSamples, 1) || r.Lang == langTotal {
+			continue
+		}
+		est := byKey[k]
+		if est == nil {
+			est = &Estimate{
+				Day:            k.day.Format(time.DateOnly),
+				Region:         r.Region,
+				Samples:        total.Count,
+				EstimatedPosts: int64(math.Round(float64(total.Count) / total.Rate)),
+			}
+			byKey[k] = est
+			out = append(out, est)
+		}
+		low, high := wilson(r.Count, total.Count)
+		est.Languages = append(est.Languages, LangShare{
+			Lang:    r.Lang,
+			Samples: r.Count,
+			Share:   float64(r.Count) / float64(total.Count),
+			Low:     low,
+			High:    high,
+		})
+	}
+
+	res := make([]Estimate, len(out))
+	for i, est := range out {
+		sort.Slice(est.Languages, func(a, b int) bool { return est.Languages[a].Samples > est.Languages[b].Samples })
+		res[i] = *est
+	}
+	return res, nil
+}
+
+// wilson returns the 95% Wilson score interval for a proportion of k successes in n trials
+func wilson(k, n int64) (float64, float64) {
+	const z = 1.96
+	p := float64(k) / float64(n)
+	nf := float64(n)
+	denom := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denom
+	half := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denom
+	return max(center-half, 0), min(center+half, 1)
+}
@@ -0,0 +1,145 @@
+package lexcheck
+
+import (
+	"bytes"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/lexicon"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// Why records fail validation
+const (
+	// the registry has no lexicon for the record's collection
+	ErrorUnknownLexicon = "unknown_lexicon"
+	// the record doesn't match its collection's lexicon
+	ErrorInvalid = "invalid"
+	// the record isn't valid DAG-CBOR data
+	ErrorUndecodable = "undecodable"
+	// the record's block is missing from the commit
+	ErrorMissingBlock = "missing_block"
+)
+
+// Finding is a record of a commit which failed validation.
+type Finding struct {
+	Path       string `json:"path"`
+	Collection string `json:"collection"`
+	CID        string `json:"cid"`
+	// one of the Error types
+	Type  string `json:"type"`
+	Error string `json:"error"`
+	// how strictly the failure is handled, by the policy
+	Strictness string `json:"strictness"`
+}
+
+// Checker validates commits' records against a registry's lexicons.
+type Checker struct {
+	registry *Registry
+	policy   *Policy
+}
+
+func NewChecker(registry *Registry, policy *Policy) *Checker {
+	return &Checker{
+		registry: registry,
+		policy:   policy,
+	}
+}
+
+func (c *Checker) Registry() *Registry {
+	return c.registry
+}
+
+func (c *Checker) Policy() *Policy {
+	return c.policy
+}
+
+// metricCollection is the collection label records are counted under: collections the registry or policy doesn't know are counted together, to bound the metrics' cardinality
+func (c *Checker) metricCollection(collection string, known bool) string {
+	if known || c.policy.configured(collection) {
+		return collection
+	}
+	return "other"
+}
+
+// CheckCommit validates the records a commit creates or updates. Returns the records failing validation, and the strictest of their strictnesses (StrictnessPass if none fail).
+func (c *Checker) CheckCommit(commit *comatproto.SyncSubscribeRepos_Commit) (string, []Finding) {
+	want := make(map[cid.Cid]bool)
+	for _, op := range commit.Ops {
+		if op.Cid != nil && op.Action != "delete" {
+			want[cid.Cid(*op.Cid)] = true
+		}
+	}
+	if len(want) == 0 {
+		return StrictnessPass, nil
+	}
+	blocks := readBlocks(commit.Blocks, want)
+
+	var flags lexicon.ValidateFlags
+	if c.policy.Lenient {
+		flags = lexicon.LenientMode
+	}
+	action := StrictnessPass
+	var findings []Finding
+	for _, op := range commit.Ops {
+		if op.Cid == nil || op.Action == "delete" {
+			continue
+		}
+		collection, _, _ := strings.Cut(op.Path, "/")
+		known := c.registry.Known(collection)
+		f := Finding{
+			Path:       op.Path,
+			Collection: collection,
+			CID:        op.Cid.String(),
+			Strictness: c.policy.Strictness(collection),
+		}
+		raw, ok := blocks[cid.Cid(*op.Cid)]
+		switch {
+		case !ok:
+			f.Type, f.Error = ErrorMissingBlock, "record block missing from commit"
+		case !known:
+			f.Type, f.Error = ErrorUnknownLexicon, "no lexicon for collection "+collection
+			f.Strictness = c.policy.Unknown
+		default:
+			rec, err := data.UnmarshalCBOR(raw)
+			if err != nil {
+				f.Type, f.Error = ErrorUndecodable, err.Error()
+			} else if err := lexicon.ValidateRecord(c.registry, rec, collection, flags); err != nil {
+				f.Type, f.Error = ErrorInvalid, err.Error()
+			}
+		}
+		if f.Type == "" {
+			recordsCounter.WithLabelValues(c.metricCollection(collection, known), "valid").Inc()
+			continue
+		}
+		recordsCounter.WithLabelValues(c.metricCollection(collection, known), f.Type).Inc()
+		findings = append(findings, f)
+		if strictnessRank(f.Strictness) > strictnessRank(action) {
+			action = f.Strictness
+		}
+	}
+	return action, findings
+}
+
+// readBlocks returns the wanted blocks of a commit's CAR slice; any it can't read are left out
+func readBlocks(b []byte, want map[cid.Cid]bool) map[cid.Cid][]byte {
+	out := make(map[cid.Cid][]byte, len(want))
+	cr, err := car.NewCarReader(bytes.NewReader(b))
+	if err != nil {
+		return out
+	}
+	for len(out) < len(want) {
+		blk, err := cr.Next()
+		if err != nil {
+			// io.EOF, or a corrupt slice
+			break
+		}
+		if want[blk.Cid()] {
+			out[blk.Cid()] = blk.RawData()
+		}
+	}
+	return out
+}
@@ -0,0 +1,4 @@
+// Record validation against lexicons.
+//
+// A Registry holds the lexicon schemas records are checked against: those loaded from a directory of schema files, and optionally those resolved from the network as records of collections it doesn't know turn up. A Checker validates the records a commit creates or updates against the registry, and its Policy sets how strictly failures of each collection are handled: rejecting the whole commit, labeling the failing records for operators, or passing them, only counting the failure. Records of collections without a lexicon in the registry are handled by the policy's Unknown strictness.
+package lexcheck
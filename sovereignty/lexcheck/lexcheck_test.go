@@ -0,0 +1,142 @@
+package lexcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const noteLexicon = `{
+  "lexicon": 1,
+  "id": "com.example.note",
+  "defs": {
+    "main": {
+      "type": "record",
+      "key": "tid",
+      "record": {
+        "type": "object",
+        "required": ["text", "createdAt"],
+        "properties": {
+          "text": {"type": "string", "maxLength": 10},
+          "createdAt": {"type": "string", "format": "datetime"}
+        }
+      }
+    }
+  }
+}`
+
+// testRegistry returns a registry of the example note lexicon, in the returned directory
+func testRegistry(t *testing.T) (*Registry, string) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "com", "example"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "com", "example", "note.json"), []byte(noteLexicon), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultRegistryOptions()
+	opts.Dir = dir
+	r, err := NewRegistry(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, dir
+}
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p := DefaultPolicy()
+	p.Collections = map[string]string{
+		"com.example.*":     StrictnessReject,
+		"com.example.draft": StrictnessPass,
+		"com.example.sub.*": StrictnessLabel,
+		"app.bsky.feed.*":   StrictnessReject,
+	}
+	assert.NoError(p.Validate())
+	assert.Equal(StrictnessReject, p.Strictness("com.example.note"))
+	assert.Equal(StrictnessPass, p.Strictness("com.example.draft"))
+	assert.Equal(StrictnessLabel, p.Strictness("com.example.sub.thing"))
+	assert.Equal(StrictnessLabel, p.Strictness("org.example.note"))
+	assert.True(p.configured("app.bsky.feed.post"))
+	assert.False(p.configured("app.bsky.graph.follow"))
+
+	for _, bad := range []*Policy{
+		{Default: "drop", Unknown: StrictnessPass},
+		{Default: StrictnessPass, Unknown: ""},
+		{Default: StrictnessPass, Unknown: StrictnessPass, Collections: map[string]string{"not an nsid": StrictnessPass}},
+		{Default: StrictnessPass, Unknown: StrictnessPass, Collections: map[string]string{"com.example.note": "maybe"}},
+	} {
+		assert.Error(bad.Validate(), bad)
+	}
+}
+
+func TestCheckCommit(t *testing.T) {
+	assert := assert.New(t)
+	reg, dir := testRegistry(t)
+	assert.True(reg.Known("com.example.note"))
+	assert.False(reg.Known("com.example.other"))
+
+	root := cartest.Commit(t, "did:plc:abc")
+	good := cartest.NewBlock(t, map[string]any{"$type": "com.example.note", "text": "hi", "createdAt": "2025-03-01T12:00:00Z"})
+	long := cartest.NewBlock(t, map[string]any{"$type": "com.example.note", "text": "far too long a note", "createdAt": "2025-03-01T12:00:00Z"})
+	otherRec := cartest.NewBlock(t, map[string]any{"$type": "com.example.other", "anything": "goes"})
+	blocks := cartest.CAR(t, root, good, long, otherRec)
+	commit := func(ops ...*comatproto.SyncSubscribeRepos_RepoOp) *comatproto.SyncSubscribeRepos_Commit {
+		return &comatproto.SyncSubscribeRepos_Commit{Repo: "did:plc:abc", Blocks: blocks, Ops: ops}
+	}
+
+	p := DefaultPolicy()
+	c := NewChecker(reg, p)
+	action, findings := c.CheckCommit(commit(
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "com.example.note/1", Cid: good.Link()},
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "delete", Path: "com.example.note/2"},
+	))
+	assert.Equal(StrictnessPass, action)
+	assert.Empty(findings)
+
+	// unknown collections pass by default; invalid records are labeled
+	action, findings = c.CheckCommit(commit(
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "com.example.note/3", Cid: long.Link()},
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "update", Path: "com.example.other/4", Cid: otherRec.Link()},
+	))
+	assert.Equal(StrictnessLabel, action)
+	if assert.Len(findings, 2) {
+		assert.Equal(ErrorInvalid, findings[0].Type)
+		assert.Equal(StrictnessLabel, findings[0].Strictness)
+		assert.Equal(long.Cid.String(), findings[0].CID)
+		assert.Equal(ErrorUnknownLexicon, findings[1].Type)
+		assert.Equal(StrictnessPass, findings[1].Strictness)
+	}
+
+	missing := cartest.NewBlock(t, map[string]any{"$type": "com.example.note", "text": "gone"})
+	p.Collections = map[string]string{"com.example.*": StrictnessReject}
+	action, findings = c.CheckCommit(commit(
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "com.example.note/5", Cid: missing.Link()},
+	))
+	assert.Equal(StrictnessReject, action)
+	if assert.Len(findings, 1) {
+		assert.Equal(ErrorMissingBlock, findings[0].Type)
+	}
+
+	// a reload picks up lexicons added to the directory
+	other := `{"lexicon": 1, "id": "com.example.other", "defs": {"main": {"type": "record", "key": "any", "record": {"type": "object", "properties": {}}}}}`
+	assert.NoError(os.WriteFile(filepath.Join(dir, "com", "example", "other.json"), []byte(other), 0644))
+	assert.NoError(reg.Reload())
+	assert.Len(reg.Lexicons(), 2)
+	action, findings = c.CheckCommit(commit(
+		&comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: "com.example.other/6", Cid: otherRec.Link()},
+	))
+	assert.Equal(StrictnessPass, action)
+	assert.Empty(findings)
+
+	// a broken file leaves the registry as it was
+	assert.NoError(os.WriteFile(filepath.Join(dir, "com", "example", "broken.json"), []byte("{"), 0644))
+	assert.Error(reg.Reload())
+	assert.True(reg.Known("com.example.other"))
+}
@@ -0,0 +1,21 @@
+package lexcheck
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var recordsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "lexcheck_records_total",
+	Help: "Records validated against their lexicons, by collection (\"other\" for collections neither the registry nor the policy knows) and result (valid, or the error type)",
+}, []string{"collection", "result"})
+
+var registryLexicons = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "lexcheck_registry_lexicons",
+	Help: "Lexicons in the registry records are validated against",
+})
+
+var resolutionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "lexcheck_resolutions_total",
+	Help: "Lexicons of unknown collections resolved from the network, by result (resolved, failed, or dropped from a full queue)",
+}, []string{"result"})
@@ -0,0 +1,119 @@
+package lexcheck
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/policyfile"
+)
+
+// How strictly records failing validation are handled, from least to most strict
+const (
+	// the failure is only counted
+	StrictnessPass = "pass"
+	// the commit is emitted, and the failing record is labeled for operators
+	StrictnessLabel = "label"
+	// the whole commit is left out of the relay's output
+	StrictnessReject = "reject"
+)
+
+func strictnessRank(s string) int {
+	switch s {
+	case StrictnessLabel:
+		return 1
+	case StrictnessReject:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Policy is the per-deployment configuration of how strictly records are validated.
+type Policy struct {
+	// strictness for collections not listed in Collections
+	Default string `json:"default"`
+	// strictness by collection NSID, or by NSID prefix ending in ".*" (eg, "app.bsky.*"); the most specific entry applies
+	Collections map[string]string `json:"collections,omitempty"`
+	// strictness for records of collections the registry has no lexicon for
+	Unknown string `json:"unknown"`
+	// accept legacy blobs, and datetimes missing a timezone
+	Lenient bool `json:"lenient,omitempty"`
+}
+
+// DefaultPolicy returns a policy labeling invalid records, passing records of unknown collections, and accepting legacy data.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Default: StrictnessLabel,
+		Unknown: StrictnessPass,
+		Lenient: true,
+	}
+}
+
+// LoadPolicy reads a lexicon validation policy file. Collections and strictnesses it doesn't set keep their DefaultPolicy values.
+func LoadPolicy(fname string) (*Policy, error) {
+	return policyfile.Load(fname, "lexicon", DefaultPolicy())
+}
+
+func validStrictness(s string) bool {
+	switch s {
+	case StrictnessPass, StrictnessLabel, StrictnessReject:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate checks the policy's strictnesses and collections.
+func (p *Policy) Validate() error {
+	if !validStrictness(p.Default) {
+		return fmt.Errorf("lexicon policy: default must be pass, label or reject, not %q", p.Default)
+	}
+	if !validStrictness(p.Unknown) {
+		return fmt.Errorf("lexicon policy: unknown must be pass, label or reject, not %q", p.Unknown)
+	}
+	for c, s := range p.Collections {
+		if !validStrictness(s) {
+			return fmt.Errorf("lexicon policy: strictness of %s must be pass, label or reject, not %q", c, s)
+		}
+		if prefix, ok := strings.CutSuffix(c, ".*"); ok {
+			if prefix == "" || strings.ContainsAny(prefix, "*") {
+				return fmt.Errorf("lexicon policy: invalid collection prefix %q", c)
+			}
+			continue
+		}
+		if _, err := syntax.ParseNSID(c); err != nil {
+			return fmt.Errorf("lexicon policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// Strictness returns how strictly failing records of the collection are handled.
+func (p *Policy) Strictness(collection string) string {
+	if s, ok := p.Collections[collection]; ok {
+		return s
+	}
+	// the longest matching prefix
+	best, strictness := -1, p.Default
+	for c, s := range p.Collections {
+		prefix, ok := strings.CutSuffix(c, "*")
+		if ok && strings.HasPrefix(collection, prefix) && len(prefix) > best {
+			best, strictness = len(prefix), s
+		}
+	}
+	return strictness
+}
+
+// configured returns true if the policy names the collection, or a prefix of it
+func (p *Policy) configured(collection string) bool {
+	for c := range p.Collections {
+		if c == collection {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(c, "*"); ok && strings.HasPrefix(collection, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package lexcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/lexicon"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Where a registry's lexicon came from
+const (
+	SourceFile    = "file"
+	SourceNetwork = "network"
+)
+
+// Entry describes a lexicon in the registry.
+type Entry struct {
+	NSID     string    `json:"nsid"`
+	Source   string    `json:"source"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+type RegistryOptions struct {
+	// directory of lexicon schema files, searched recursively for .json files
+	Dir string
+	// identity directory lexicons of unknown collections are resolved through; nil disables network resolution
+	Directory identity.Directory
+	// how long after a failed resolution a collection's lexicon is tried again
+	RetryInterval time.Duration
+	// maximum number of collections waiting to be resolved
+	QueueSize int
+	Logger    *slog.Logger
+}
+
+func DefaultRegistryOptions() RegistryOptions {
+	return RegistryOptions{
+		RetryInterval: time.Hour,
+		QueueSize:     100,
+	}
+}
+
+// Registry is the set of lexicons records are checked against, which may change at runtime: it is reloaded from its directory, and supplemented from the network if enabled. It implements lexicon.Catalog, and is safe for concurrent use.
+type Registry struct {
+	opts  RegistryOptions
+	queue chan syntax.NSID
+
+	lk  sync.RWMutex
+	cat lexicon.BaseCatalog
+	// by NSID
+	entries map[string]Entry
+	// schemas resolved from the network, kept over reloads unless the directory gains them
+	resolved map[string]lexicon.SchemaFile
+	// when resolution of each NSID was last requested
+	tried map[string]time.Time
+}
+
+// NewRegistry loads the lexicons in the options' directory.
+func NewRegistry(opts RegistryOptions) (*Registry, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	r := &Registry{
+		opts:     opts,
+		queue:    make(chan syntax.NSID, opts.QueueSize),
+		resolved: make(map[string]lexicon.SchemaFile),
+		tried:    make(map[string]time.Time),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadDir reads every schema file under the directory
+func loadDir(dir string) ([]lexicon.SchemaFile, error) {
+	var files []lexicon.SchemaFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var sf lexicon.SchemaFile
+		if err := json.Unmarshal(b, &sf); err != nil {
+			return fmt.Errorf("parsing lexicon %s: %w", p, err)
+		}
+		files = append(files, sf)
+		return nil
+	})
+	return files, err
+}
+
+// Reload replaces the registry's lexicons with those now in its directory, keeping the ones resolved from the network the directory doesn't have. On error the registry is unchanged.
+func (r *Registry) Reload() error {
+	files, err := loadDir(r.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("loading lexicons: %w", err)
+	}
+	now := time.Now().UTC()
+	cat := lexicon.NewBaseCatalog()
+	entries := make(map[string]Entry, len(files))
+	for _, sf := range files {
+		if err := cat.AddSchemaFile(sf); err != nil {
+			return fmt.Errorf("loading lexicon %s: %w", sf.ID, err)
+		}
+		entries[sf.ID] = Entry{NSID: sf.ID, Source: SourceFile, LoadedAt: now}
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for nsid, sf := range r.resolved {
+		if _, ok := entries[nsid]; ok {
+			delete(r.resolved, nsid)
+			continue
+		}
+		if err := cat.AddSchemaFile(sf); err != nil {
+			delete(r.resolved, nsid)
+			continue
+		}
+		entries[nsid] = r.entries[nsid]
+	}
+	r.cat = cat
+	r.entries = entries
+	registryLexicons.Set(float64(len(entries)))
+	return nil
+}
+
+// Resolve looks up a schema reference, as lexicon.Catalog.
+func (r *Registry) Resolve(ref string) (*lexicon.Schema, error) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	return r.cat.Resolve(ref)
+}
+
+// Known returns true if the registry has the collection's lexicon. If it doesn't, and network resolution is enabled, the lexicon is queued to be resolved, unless it was tried recently or the queue is full.
+func (r *Registry) Known(collection string) bool {
+	r.lk.RLock()
+	_, ok := r.entries[collection]
+	r.lk.RUnlock()
+	if ok || r.opts.Directory == nil {
+		return ok
+	}
+	nsid, err := syntax.ParseNSID(collection)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	r.lk.Lock()
+	if t, ok := r.tried[collection]; ok && now.Sub(t) < r.opts.RetryInterval {
+		r.lk.Unlock()
+		return false
+	}
+	r.tried[collection] = now
+	r.lk.Unlock()
+	select {
+	case r.queue <- nsid:
+	default:
+		resolutionsCounter.WithLabelValues("dropped").Inc()
+	}
+	return false
+}
+
+// Lexicons lists the registry's lexicons, by NSID.
+func (r *Registry) Lexicons() []Entry {
+	r.lk.RLock()
+	out := make([]Entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, e)
+	}
+	r.lk.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].NSID < out[j].NSID })
+	return out
+}
+
+// Run resolves queued lexicons from the network, until the context is cancelled.
+func (r *Registry) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case nsid := <-r.queue:
+			rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			err := r.resolve(rctx, nsid)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					resolutionsCounter.WithLabelValues("failed").Inc()
+					r.opts.Logger.Debug("failed to resolve lexicon", "nsid", nsid, "err", err)
+				}
+				continue
+			}
+			resolutionsCounter.WithLabelValues("resolved").Inc()
+			r.opts.Logger.Info("resolved lexicon", "nsid", nsid)
+		}
+	}
+}
+
+func (r *Registry) resolve(ctx context.Context, nsid syntax.NSID) error {
+	sf, err := lexicon.ResolveLexiconSchemaFile(ctx, r.opts.Directory, nsid)
+	if err != nil {
+		return err
+	}
+	if sf.ID != nsid.String() {
+		return fmt.Errorf("lexicon ID does not match NSID: %s != %s", sf.ID, nsid)
+	}
+	// checked apart, so a bad schema doesn't leave some of its definitions in the registry
+	scratch := lexicon.NewBaseCatalog()
+	if err := scratch.AddSchemaFile(*sf); err != nil {
+		return err
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if _, ok := r.entries[sf.ID]; ok {
+		return nil
+	}
+	if err := r.cat.AddSchemaFile(*sf); err != nil {
+		return err
+	}
+	r.resolved[sf.ID] = *sf
+	r.entries[sf.ID] = Entry{NSID: sf.ID, Source: SourceNetwork, LoadedAt: time.Now().UTC()}
+	registryLexicons.Set(float64(len(r.entries)))
+	return nil
+}
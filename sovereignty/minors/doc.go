@@ -0,0 +1,4 @@
+// Stricter handling for accounts belonging to minors.
+//
+// An account is flagged as a minor either by a moderation label (applied through an operator endpoint) or by a declared birthdate record in its repo. Depending on the deployment's Policy, flagged accounts have their record content stripped from public sovereign streams (only the CIDs are emitted), are skipped by the search indexer, and are left out of published statistics and classification snapshots.
+package minors
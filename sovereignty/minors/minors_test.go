@@ -0,0 +1,143 @@
+package minors
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+func testModule() *Module {
+	p := DefaultPolicy()
+	p.BirthdateCollection = "ca.gander.actor.birthdate"
+	m := NewModule(p)
+	m.now = func() time.Time { return time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return m
+}
+
+func TestModule(t *testing.T) {
+	assert := assert.New(t)
+	m := testModule()
+
+	assert.False(m.ObserveLabel("did:plc:a", "porn", false))
+	assert.True(m.ObserveLabel("did:plc:a", "minor", false))
+	assert.False(m.ObserveLabel("did:plc:a", "minor", false))
+	assert.True(m.IsMinor("did:plc:a"))
+	assert.True(m.HashOnly("did:plc:a"))
+
+	for _, tc := range []struct {
+		birthDate string
+		minor     bool
+	}{
+		{"2010-03-04", true},
+		{"2007-06-02", true},
+		{"2007-06-01", false},
+		{"1990-01-01T00:00:00Z", false},
+	} {
+		_, err := m.ObserveBirthdate("did:plc:b", map[string]any{"birthDate": tc.birthDate})
+		assert.NoError(err)
+		assert.Equal(tc.minor, m.IsMinor("did:plc:b"), tc.birthDate)
+	}
+	_, err := m.ObserveBirthdate("did:plc:b", map[string]any{"birthDate": "last tuesday"})
+	assert.Error(err)
+
+	// birthdate flags lapse at the age of majority
+	_, err = m.ObserveBirthdate("did:plc:c", map[string]any{"birthDate": "2007-06-02"})
+	assert.NoError(err)
+	assert.True(m.IsMinor("did:plc:c"))
+	m.now = func() time.Time { return time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC) }
+	assert.False(m.IsMinor("did:plc:c"))
+
+	assert.Equal([]Flag{
+		{DID: "did:plc:a", Reason: ReasonLabel},
+		{DID: "did:plc:c", Reason: ReasonBirthdate, Until: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)},
+	}, m.Flags())
+
+	// protections follow the policy
+	m.Policy.HashOnly = false
+	assert.False(m.HashOnly("did:plc:a"))
+	assert.True(m.ExcludeStats("did:plc:a"))
+	assert.True(m.ObserveLabel("did:plc:a", "minor", true))
+	assert.False(m.SuppressSearch("did:plc:a"))
+}
+
+func TestCommits(t *testing.T) {
+	assert := assert.New(t)
+	m := testModule()
+
+	commit := cartest.Commit(t, "did:plc:abc")
+	bd := cartest.NewBlock(t, map[string]any{"$type": "ca.gander.actor.birthdate", "birthDate": "2012-01-01"})
+	post := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "hi"})
+
+	changed, err := m.ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit, bd),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "ca.gander.actor.birthdate/self", Cid: bd.Link()}},
+	})
+	assert.NoError(err)
+	assert.True(changed)
+	assert.True(m.IsMinor("did:plc:abc"))
+
+	orig := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit, post),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/3k", Cid: post.Link()}},
+	}}
+	origBlocks := append([]byte{}, orig.RepoCommit.Blocks...)
+	out, err := m.HashOnlyEvent(orig)
+	assert.NoError(err)
+	assert.Equal(origBlocks, []byte(orig.RepoCommit.Blocks))
+	assert.Equal(post.Cid, cid.Cid(*out.RepoCommit.Ops[0].Cid))
+
+	cr, err := car.NewCarReader(bytes.NewReader(out.RepoCommit.Blocks))
+	assert.NoError(err)
+	var found []cid.Cid
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		found = append(found, blk.Cid())
+	}
+	assert.Equal([]cid.Cid{commit.Cid}, found)
+
+	// deleting the birthdate record clears the flag, and content flows again
+	changed, err = m.ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo: "did:plc:abc",
+		Ops:  []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "delete", Path: "ca.gander.actor.birthdate/self"}},
+	})
+	assert.NoError(err)
+	assert.True(changed)
+	same, err := m.HashOnlyEvent(orig)
+	assert.NoError(err)
+	assert.Same(orig, same)
+
+	// withholding only some records
+	both := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit, bd, post),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "ca.gander.actor.birthdate/self", Cid: bd.Link()},
+			{Action: "create", Path: "app.bsky.feed.post/3k", Cid: post.Link()},
+		},
+	}}
+	out, err = WithholdRecords(both, func(path string) bool { return strings.HasPrefix(path, "ca.gander.actor.birthdate/") })
+	assert.NoError(err)
+	_, blocks, _, err := readBlocks(out.RepoCommit.Blocks)
+	assert.NoError(err)
+	assert.Contains(blocks, post.Cid)
+	assert.NotContains(blocks, bd.Cid)
+	same, err = WithholdRecords(both, func(path string) bool { return false })
+	assert.NoError(err)
+	assert.Same(both, same)
+}
@@ -0,0 +1,251 @@
+package minors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/policyfile"
+)
+
+const (
+	// flagged because a moderation label marks the account as a minor
+	ReasonLabel = "label"
+	// flagged because the account's declared birthdate is under the policy's adult age
+	ReasonBirthdate = "birthdate"
+)
+
+// Policy is the per-deployment configuration of minor protection.
+type Policy struct {
+	// label values which flag an account as a minor
+	Labels []string `json:"labels"`
+	// NSID of the record collection holding a declared birthdate; empty disables birthdate detection
+	BirthdateCollection string `json:"birthdateCollection,omitempty"`
+	// record field holding the birthdate, as "YYYY-MM-DD" or a datetime
+	BirthdateField string `json:"birthdateField,omitempty"`
+	// accounts younger than this are minors
+	AdultAge int `json:"adultAge"`
+
+	// emit only record CIDs, not record content, on public sovereign streams
+	HashOnly bool `json:"hashOnly"`
+	// skip the account's records in search indexing
+	SuppressSearch bool `json:"suppressSearch"`
+	// leave the account out of published statistics and classification snapshots
+	ExcludeStats bool `json:"excludeStats"`
+}
+
+// DefaultPolicy returns a policy with all protections enabled, flagging on the "minor" label only.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Labels:         []string{"minor"},
+		BirthdateField: "birthDate",
+		AdultAge:       18,
+		HashOnly:       true,
+		SuppressSearch: true,
+		ExcludeStats:   true,
+	}
+}
+
+// LoadPolicy reads a minor-protection policy file. Protections it doesn't mention stay enabled, as in DefaultPolicy, so a file need only list what it relaxes.
+func LoadPolicy(fname string) (*Policy, error) {
+	return policyfile.Load(fname, "minor-protection", DefaultPolicy())
+}
+
+// Validate checks the policy's adult age and birthdate collection.
+func (p *Policy) Validate() error {
+	if p.AdultAge <= 0 {
+		return fmt.Errorf("minor-protection policy: invalid adult age %d", p.AdultAge)
+	}
+	if p.BirthdateCollection != "" {
+		if _, err := syntax.ParseNSID(p.BirthdateCollection); err != nil {
+			return fmt.Errorf("minor-protection policy: invalid birthdate collection: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsMinorLabel returns true if the label value flags an account as a minor.
+func (p *Policy) IsMinorLabel(val string) bool {
+	for _, l := range p.Labels {
+		if l == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag is a single reason an account is flagged.
+type Flag struct {
+	DID    string `json:"did"`
+	Reason string `json:"reason"`
+	// when the flag lapses (eg, the account holder's birthday of majority); zero means it doesn't
+	Until time.Time `json:"until,omitempty"`
+}
+
+// Module applies a Policy, tracking which accounts are flagged. It is safe for concurrent use.
+type Module struct {
+	Policy *Policy
+
+	lk sync.RWMutex
+	// DID to reason to expiry (zero for none)
+	flags map[string]map[string]time.Time
+
+	now func() time.Time
+}
+
+// NewModule returns a module with no accounts flagged. If policy is nil, DefaultPolicy is used.
+func NewModule(policy *Policy) *Module {
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	return &Module{
+		Policy: policy,
+		flags:  make(map[string]map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Load replaces all flags, eg with those previously persisted.
+func (m *Module) Load(flags []Flag) {
+	fm := make(map[string]map[string]time.Time)
+	for _, f := range flags {
+		if fm[f.DID] == nil {
+			fm[f.DID] = make(map[string]time.Time)
+		}
+		fm[f.DID][f.Reason] = f.Until
+	}
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.flags = fm
+}
+
+// Set flags or unflags the account for the given reason. Returns true if anything changed.
+func (m *Module) Set(did, reason string, flagged bool) bool {
+	return m.set(did, reason, flagged, time.Time{})
+}
+
+func (m *Module) set(did, reason string, flagged bool, until time.Time) bool {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	reasons := m.flags[did]
+	prev, ok := reasons[reason]
+	if flagged {
+		if ok && prev.Equal(until) {
+			return false
+		}
+		if reasons == nil {
+			reasons = make(map[string]time.Time)
+			m.flags[did] = reasons
+		}
+		reasons[reason] = until
+		return true
+	}
+	if !ok {
+		return false
+	}
+	delete(reasons, reason)
+	if len(reasons) == 0 {
+		delete(m.flags, did)
+	}
+	return true
+}
+
+// IsMinor returns true if the account is flagged for any reason which hasn't lapsed.
+func (m *Module) IsMinor(did string) bool {
+	now := m.now()
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	for _, until := range m.flags[did] {
+		if until.IsZero() || now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the flag for the account and reason, if there is one.
+func (m *Module) Get(did, reason string) (Flag, bool) {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	until, ok := m.flags[did][reason]
+	return Flag{DID: did, Reason: reason, Until: until}, ok
+}
+
+// Flags returns all current flags, sorted by DID then reason.
+func (m *Module) Flags() []Flag {
+	m.lk.RLock()
+	var out []Flag
+	for did, reasons := range m.flags {
+		for r, until := range reasons {
+			out = append(out, Flag{DID: did, Reason: r, Until: until})
+		}
+	}
+	m.lk.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DID != out[j].DID {
+			return out[i].DID < out[j].DID
+		}
+		return out[i].Reason < out[j].Reason
+	})
+	return out
+}
+
+// Len returns the number of accounts with any flag, including lapsed ones.
+func (m *Module) Len() int {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	return len(m.flags)
+}
+
+// HashOnly returns true if the account's record content must be withheld from public streams.
+func (m *Module) HashOnly(did string) bool {
+	return m.Policy.HashOnly && m.IsMinor(did)
+}
+
+// SuppressSearch returns true if the account's records must not be indexed for search.
+func (m *Module) SuppressSearch(did string) bool {
+	return m.Policy.SuppressSearch && m.IsMinor(did)
+}
+
+// ExcludeStats returns true if the account must be left out of published statistics.
+func (m *Module) ExcludeStats(did string) bool {
+	return m.Policy.ExcludeStats && m.IsMinor(did)
+}
+
+// ObserveLabel updates the label flag for an account from a label (or label negation).
+func (m *Module) ObserveLabel(did, val string, neg bool) bool {
+	if !m.Policy.IsMinorLabel(val) {
+		return false
+	}
+	return m.Set(did, ReasonLabel, !neg)
+}
+
+// ObserveBirthdate updates the birthdate flag for an account from a decoded birthdate record. The flag lapses on the account holder's birthday of majority. Returns true if the flag changed, and an error if the record has no usable birthdate.
+func (m *Module) ObserveBirthdate(did string, rec map[string]any) (bool, error) {
+	raw, ok := rec[m.Policy.BirthdateField].(string)
+	if !ok {
+		return false, fmt.Errorf("birthdate record missing %q field", m.Policy.BirthdateField)
+	}
+	born, err := parseBirthdate(raw)
+	if err != nil {
+		return false, err
+	}
+	adult := born.AddDate(m.Policy.AdultAge, 0, 0)
+	return m.set(did, ReasonBirthdate, m.now().Before(adult), adult), nil
+}
+
+func parseBirthdate(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	dt, err := syntax.ParseDatetimeLenient(raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid birthdate: %q", raw)
+	}
+	return dt.Time(), nil
+}
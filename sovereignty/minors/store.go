@@ -0,0 +1,42 @@
+package minors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoadFlags reads all persisted flags from the database into the module.
+func (m *Module) LoadFlags(ctx context.Context, db *gorm.DB) error {
+	var rows []models.MinorFlag
+	if err := db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading minor flags: %w", err)
+	}
+	flags := make([]Flag, len(rows))
+	for i, r := range rows {
+		flags[i] = Flag{DID: r.Did, Reason: r.Reason, Until: r.Until}
+	}
+	m.Load(flags)
+	return nil
+}
+
+// SaveFlag persists the module's current flag for the account and reason, deleting the row if the account is no longer flagged for that reason.
+func (m *Module) SaveFlag(ctx context.Context, db *gorm.DB, did, reason string) error {
+	f, ok := m.Get(did, reason)
+	if !ok {
+		return db.WithContext(ctx).Unscoped().Where("did = ? AND reason = ?", did, reason).Delete(&models.MinorFlag{}).Error
+	}
+	row := models.MinorFlag{
+		Did:    f.DID,
+		Reason: f.Reason,
+		Until:  f.Until,
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}, {Name: "reason"}},
+		DoUpdates: clause.AssignmentColumns([]string{"until", "updated_at"}),
+	}).Create(&row).Error
+}
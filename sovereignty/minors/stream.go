@@ -0,0 +1,124 @@
+package minors
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+// ObserveCommit looks for birthdate record writes in a commit and updates the account's birthdate flag. Returns true if the flag changed.
+func (m *Module) ObserveCommit(commit *comatproto.SyncSubscribeRepos_Commit) (bool, error) {
+	coll := m.Policy.BirthdateCollection
+	if coll == "" {
+		return false, nil
+	}
+	var op *comatproto.SyncSubscribeRepos_RepoOp
+	for _, o := range commit.Ops {
+		if strings.HasPrefix(o.Path, coll+"/") {
+			op = o
+		}
+	}
+	if op == nil {
+		return false, nil
+	}
+	if op.Action == "delete" || op.Cid == nil {
+		return m.Set(commit.Repo, ReasonBirthdate, false), nil
+	}
+
+	_, blocks, _, err := readBlocks(commit.Blocks)
+	if err != nil {
+		return false, err
+	}
+	raw, ok := blocks[cid.Cid(*op.Cid)]
+	if !ok {
+		return false, fmt.Errorf("birthdate record block missing from commit")
+	}
+	rec, err := data.UnmarshalCBOR(raw)
+	if err != nil {
+		return false, fmt.Errorf("decoding birthdate record: %w", err)
+	}
+	return m.ObserveBirthdate(commit.Repo, rec)
+}
+
+// HashOnlyEvent returns the event as it may be emitted on a public stream. For flagged accounts (when the policy requires it), a copy of #commit events is returned with all record blocks removed, leaving the commit, tree nodes and op CIDs. Other events are returned unchanged. The input event is never mutated.
+func (m *Module) HashOnlyEvent(evt *events.XRPCStreamEvent) (*events.XRPCStreamEvent, error) {
+	if evt.RepoCommit == nil || !m.HashOnly(evt.RepoCommit.Repo) {
+		return evt, nil
+	}
+	return WithholdRecords(evt, nil)
+}
+
+// WithholdRecords returns a copy of a #commit event with record blocks removed, leaving the commit, tree nodes and op CIDs, whoever's account it is: the blocks of the ops whose path withhold matches, or all of them if withhold is nil. Other events, and commits with nothing to withhold, are returned unchanged. The input event is never mutated.
+func WithholdRecords(evt *events.XRPCStreamEvent, withhold func(path string) bool) (*events.XRPCStreamEvent, error) {
+	if evt.RepoCommit == nil {
+		return evt, nil
+	}
+	commit := evt.RepoCommit
+
+	drop := make(map[cid.Cid]bool)
+	for _, op := range commit.Ops {
+		if op.Cid != nil && (withhold == nil || withhold(op.Path)) {
+			drop[cid.Cid(*op.Cid)] = true
+		}
+	}
+	if len(drop) == 0 && withhold != nil {
+		return evt, nil
+	}
+	roots, blocks, order, err := readBlocks(commit.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: roots, Version: 1}, &buf); err != nil {
+		return nil, err
+	}
+	for _, c := range order {
+		if drop[c] {
+			continue
+		}
+		if err := carutil.LdWrite(&buf, c.Bytes(), blocks[c]); err != nil {
+			return nil, err
+		}
+	}
+
+	newCommit := *commit
+	newCommit.Blocks = buf.Bytes()
+	return &events.XRPCStreamEvent{
+		RepoCommit: &newCommit,
+		Meta:       evt.Meta,
+		PrivUid:    evt.PrivUid,
+	}, nil
+}
+
+// readBlocks decodes a CAR slice into its roots and a block map, also returning the block CIDs in their original order
+func readBlocks(b []byte) ([]cid.Cid, map[cid.Cid][]byte, []cid.Cid, error) {
+	cr, err := car.NewCarReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	blocks := make(map[cid.Cid][]byte)
+	var order []cid.Cid
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		if _, ok := blocks[blk.Cid()]; !ok {
+			order = append(order, blk.Cid())
+		}
+		blocks[blk.Cid()] = blk.RawData()
+	}
+	return cr.Header.Roots, blocks, order, nil
+}
@@ -0,0 +1,4 @@
+// NSID namespace governance for the sovereign stream.
+//
+// A Policy allows or blocks records on the sovereign stream by the NSID of their collection: whole namespaces (eg, "app.gndr.*") or single collections. It is decided from commit op paths alone, without reading the records. Matcher matches record paths against the same patterns, for consumers subscribing to some collections.
+package namespaces
@@ -0,0 +1,133 @@
+package namespaces
+
+import (
+	"fmt"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+)
+
+// Unlisted is the namespace reported for collections blocked for matching none of the allowlist's patterns.
+const Unlisted = "unlisted"
+
+type pattern struct {
+	// the pattern as configured, reported as the namespace of what it matches
+	raw    string
+	value  string
+	prefix bool
+}
+
+func (p pattern) matches(collection string) bool {
+	if p.prefix {
+		return strings.HasPrefix(collection, p.value)
+	}
+	return collection == p.value
+}
+
+// parsePattern parses a collection NSID, or a namespace ending in ".*"
+func parsePattern(s string) (pattern, error) {
+	p := pattern{raw: s, value: s}
+	if prefix, ok := strings.CutSuffix(s, ".*"); ok {
+		p.value, p.prefix = prefix+".", true
+		s = prefix
+	}
+	if s == "" {
+		return p, fmt.Errorf("invalid namespace %q", p.raw)
+	}
+	for _, seg := range strings.Split(s, ".") {
+		if seg == "" || strings.Trim(seg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-") != "" {
+			return p, fmt.Errorf("invalid namespace %q", p.raw)
+		}
+	}
+	return p, nil
+}
+
+// Policy decides which collections' records the sovereign stream carries.
+type Policy struct {
+	allow []pattern
+	block []pattern
+}
+
+// NewPolicy validates allowlist and blocklist patterns: collection NSIDs, or namespaces ending in ".*". With an allowlist, only collections it matches are carried; the blocklist applies over it, so a namespace can be allowed except for some of its parts. Returns nil if both are empty.
+func NewPolicy(allow, block []string) (*Policy, error) {
+	if len(allow) == 0 && len(block) == 0 {
+		return nil, nil
+	}
+	p := &Policy{}
+	for _, s := range allow {
+		pt, err := parsePattern(s)
+		if err != nil {
+			return nil, fmt.Errorf("namespace allowlist: %w", err)
+		}
+		p.allow = append(p.allow, pt)
+	}
+	for _, s := range block {
+		pt, err := parsePattern(s)
+		if err != nil {
+			return nil, fmt.Errorf("namespace blocklist: %w", err)
+		}
+		p.block = append(p.block, pt)
+	}
+	return p, nil
+}
+
+// Blocked returns true if the stream doesn't carry the collection's records, and the namespace blocking it: the blocklist pattern matching it, or Unlisted if the allowlist doesn't.
+func (p *Policy) Blocked(collection string) (string, bool) {
+	for _, pt := range p.block {
+		if pt.matches(collection) {
+			return pt.raw, true
+		}
+	}
+	if len(p.allow) == 0 {
+		return "", false
+	}
+	for _, pt := range p.allow {
+		if pt.matches(collection) {
+			return "", false
+		}
+	}
+	return Unlisted, true
+}
+
+// BlockedPath is Blocked for a record path (collection/rkey).
+func (p *Policy) BlockedPath(path string) (string, bool) {
+	collection, _, _ := strings.Cut(path, "/")
+	return p.Blocked(collection)
+}
+
+// AllBlocked returns true if a commit has ops, and all of them are of collections the stream doesn't carry.
+func (p *Policy) AllBlocked(commit *comatproto.SyncSubscribeRepos_Commit) bool {
+	if len(commit.Ops) == 0 {
+		return false
+	}
+	for _, op := range commit.Ops {
+		if _, blocked := p.BlockedPath(op.Path); !blocked {
+			return false
+		}
+	}
+	return true
+}
+
+// Matcher returns a matcher of record paths (collection/rkey) of collections any of the patterns match, as collection NSIDs or namespaces ending in ".*"; nil if there are none.
+func Matcher(patterns []string) (func(path string) bool, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	var pts []pattern
+	for _, s := range patterns {
+		pt, err := parsePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		pts = append(pts, pt)
+	}
+	return func(path string) bool {
+		collection, _, _ := strings.Cut(path, "/")
+		for _, pt := range pts {
+			if pt.matches(collection) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
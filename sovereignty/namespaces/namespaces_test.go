@@ -0,0 +1,71 @@
+package namespaces
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewPolicy(nil, nil)
+	assert.NoError(err)
+	assert.Nil(p)
+
+	p, err = NewPolicy([]string{"app.gndr.*", "ca.gndr.*", "app.bsky.feed.post"}, []string{"chat.*", "app.gndr.chat.*"})
+	assert.NoError(err)
+	for _, tc := range []struct {
+		collection string
+		namespace  string
+		blocked    bool
+	}{
+		{"app.gndr.feed.post", "", false},
+		{"ca.gndr.sovereign.thing", "", false},
+		{"app.bsky.feed.post", "", false},
+		{"app.bsky.feed.like", Unlisted, true},
+		{"app.gndrx.feed.post", Unlisted, true},
+		{"chat.bsky.convo.message", "chat.*", true},
+		{"app.gndr.chat.message", "app.gndr.chat.*", true},
+	} {
+		ns, blocked := p.Blocked(tc.collection)
+		assert.Equal(tc.blocked, blocked, tc.collection)
+		assert.Equal(tc.namespace, ns, tc.collection)
+	}
+
+	// a blocklist alone carries everything else
+	p, err = NewPolicy(nil, []string{"chat.*"})
+	assert.NoError(err)
+	_, blocked := p.BlockedPath("app.bsky.feed.post/3333333333333")
+	assert.False(blocked)
+	ns, blocked := p.BlockedPath("chat.bsky.convo.message/3333333333333")
+	assert.True(blocked)
+	assert.Equal("chat.*", ns)
+
+	commit := &comatproto.SyncSubscribeRepos_Commit{}
+	assert.False(p.AllBlocked(commit))
+	commit.Ops = []*comatproto.SyncSubscribeRepos_RepoOp{{Path: "chat.bsky.convo.message/1"}, {Path: "chat.bsky.actor.declaration/self"}}
+	assert.True(p.AllBlocked(commit))
+	commit.Ops = append(commit.Ops, &comatproto.SyncSubscribeRepos_RepoOp{Path: "app.bsky.feed.post/2"})
+	assert.False(p.AllBlocked(commit))
+
+	for _, bad := range []string{"", "*", ".*", "app..feed", "app.bsky.*.post", "app/bsky"} {
+		_, err := NewPolicy([]string{bad}, nil)
+		assert.Error(err, bad)
+		_, err = NewPolicy(nil, []string{bad})
+		assert.Error(err, bad)
+	}
+
+	match, err := Matcher([]string{"app.gndr.feed.*", "ca.gndr.sovereign.thing"})
+	assert.NoError(err)
+	assert.True(match("app.gndr.feed.post/3333333333333"))
+	assert.True(match("ca.gndr.sovereign.thing/self"))
+	assert.False(match("app.gndr.graph.follow/3333333333333"))
+	match, err = Matcher(nil)
+	assert.NoError(err)
+	assert.Nil(match)
+	_, err = Matcher([]string{"app..feed"})
+	assert.Error(err)
+}
@@ -0,0 +1,4 @@
+// Notifications for sovereign accounts.
+//
+// The notification service consumes the relay's filtered sovereign stream and materializes a row for each like, reply, follow and mention addressed to a sovereign account, removing rows again when the underlying record or the authoring account is deleted. Read state is a per-recipient "seen at" timestamp, as in app.bsky.notification.updateSeen. Rows are served through a listNotifications-compatible endpoint by cmd/notifyd, as one of the building blocks of the national AppView.
+package notify
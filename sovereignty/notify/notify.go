@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// Notification reasons, as used by app.bsky.notification.listNotifications
+const (
+	ReasonLike    = "like"
+	ReasonReply   = "reply"
+	ReasonFollow  = "follow"
+	ReasonMention = "mention"
+)
+
+// Notification is a single materialized notification row. A record produces at most one notification per recipient; a reply which also mentions the parent author is only a reply.
+type Notification struct {
+	ID        uint   `gorm:"primarykey;index:idx_notif_recipient_id,priority:2"`
+	Recipient string `gorm:"uniqueIndex:idx_notif_recipient_uri;index:idx_notif_recipient_id,priority:1;not null"`
+	// AT-URI of the record which caused the notification
+	URI    string `gorm:"uniqueIndex:idx_notif_recipient_uri;index;not null"`
+	CID    string `gorm:"not null"`
+	Author string `gorm:"index;not null"`
+	Reason string `gorm:"not null"`
+	// AT-URI of the recipient's record this is about (the liked post, the replied-to post), if any
+	ReasonSubject string
+	// raw CBOR of the record
+	Record    []byte
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// Derive returns the notifications produced by the creation of a record. Self-notifications are never produced, and recipients for whom isRecipient returns false are skipped.
+func Derive(uri syntax.ATURI, cid string, rec lexutil.CBOR, raw []byte, isRecipient func(did string) bool) []Notification {
+	author := uri.Authority().String()
+	var out []Notification
+	seen := make(map[string]bool)
+	add := func(recipient, reason, subject string) {
+		if recipient == "" || recipient == author || seen[recipient] {
+			return
+		}
+		seen[recipient] = true
+		if isRecipient != nil && !isRecipient(recipient) {
+			return
+		}
+		out = append(out, Notification{
+			Recipient:     recipient,
+			URI:           uri.String(),
+			CID:           cid,
+			Author:        author,
+			Reason:        reason,
+			ReasonSubject: subject,
+			Record:        raw,
+		})
+	}
+
+	switch r := rec.(type) {
+	case *appbsky.FeedLike:
+		if r.Subject != nil {
+			add(uriAuthor(r.Subject.Uri), ReasonLike, r.Subject.Uri)
+		}
+	case *appbsky.GraphFollow:
+		if did, err := syntax.ParseDID(r.Subject); err == nil {
+			add(did.String(), ReasonFollow, "")
+		}
+	case *appbsky.FeedPost:
+		if r.Reply != nil {
+			if r.Reply.Parent != nil {
+				add(uriAuthor(r.Reply.Parent.Uri), ReasonReply, r.Reply.Parent.Uri)
+			}
+			if r.Reply.Root != nil {
+				add(uriAuthor(r.Reply.Root.Uri), ReasonReply, r.Reply.Root.Uri)
+			}
+		}
+		for _, facet := range r.Facets {
+			for _, feat := range facet.Features {
+				if feat.RichtextFacet_Mention == nil {
+					continue
+				}
+				if did, err := syntax.ParseDID(feat.RichtextFacet_Mention.Did); err == nil {
+					add(did.String(), ReasonMention, "")
+				}
+			}
+		}
+	}
+	return out
+}
+
+// uriAuthor returns the DID authority of an AT-URI, or empty string if it isn't one
+func uriAuthor(raw string) string {
+	u, err := syntax.ParseATURI(raw)
+	if err != nil {
+		return ""
+	}
+	did, err := u.Authority().AsDID()
+	if err != nil {
+		return ""
+	}
+	return did.String()
+}
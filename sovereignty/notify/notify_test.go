@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	alice = "did:plc:alice"
+	bob   = "did:plc:bob"
+	carol = "did:plc:carol"
+)
+
+func testStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "notify.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestDerive(t *testing.T) {
+	assert := assert.New(t)
+
+	bobPost := "at://" + bob + "/app.bsky.feed.post/3k2aa"
+	carolPost := "at://" + carol + "/app.bsky.feed.post/3k2bb"
+
+	like := &appbsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: bobPost}}
+	n := Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.like/1"), "cid", like, nil, nil)
+	assert.Len(n, 1)
+	assert.Equal(bob, n[0].Recipient)
+	assert.Equal(alice, n[0].Author)
+	assert.Equal(ReasonLike, n[0].Reason)
+	assert.Equal(bobPost, n[0].ReasonSubject)
+
+	// no self-notifications
+	n = Derive(syntax.ATURI("at://"+bob+"/app.bsky.feed.like/1"), "cid", like, nil, nil)
+	assert.Empty(n)
+
+	n = Derive(syntax.ATURI("at://"+alice+"/app.bsky.graph.follow/1"), "cid", &appbsky.GraphFollow{Subject: carol}, nil, nil)
+	assert.Len(n, 1)
+	assert.Equal(ReasonFollow, n[0].Reason)
+
+	// a reply to bob in carol's thread, which also mentions bob and alice
+	post := &appbsky.FeedPost{
+		Reply: &appbsky.FeedPost_ReplyRef{
+			Parent: &comatproto.RepoStrongRef{Uri: bobPost},
+			Root:   &comatproto.RepoStrongRef{Uri: carolPost},
+		},
+		Facets: []*appbsky.RichtextFacet{{
+			Features: []*appbsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Mention: &appbsky.RichtextFacet_Mention{Did: bob}},
+				{RichtextFacet_Mention: &appbsky.RichtextFacet_Mention{Did: alice}},
+			},
+		}},
+	}
+	n = Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.post/1"), "cid", post, nil, nil)
+	assert.Len(n, 2)
+	assert.Equal(bob, n[0].Recipient)
+	assert.Equal(ReasonReply, n[0].Reason)
+	assert.Equal(carol, n[1].Recipient)
+	assert.Equal(ReasonReply, n[1].Reason)
+
+	n = Derive(syntax.ATURI("at://"+alice+"/app.bsky.feed.post/1"), "cid", post, nil, func(did string) bool { return did == carol })
+	assert.Len(n, 1)
+	assert.Equal(carol, n[0].Recipient)
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := testStore(t)
+
+	t0 := time.Now().UTC().Add(-time.Hour)
+	var notifs []Notification
+	for i, reason := range []string{ReasonLike, ReasonFollow, ReasonReply} {
+		notifs = append(notifs, Notification{
+			Recipient: bob,
+			URI:       "at://" + alice + "/app.bsky.feed.like/" + reason,
+			CID:       "cid",
+			Author:    alice,
+			Reason:    reason,
+			CreatedAt: t0.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	assert.NoError(store.Add(ctx, notifs))
+	// replays are ignored
+	assert.NoError(store.Add(ctx, notifs[:1]))
+
+	page, err := store.List(ctx, ListParams{Recipient: bob, Limit: 2})
+	assert.NoError(err)
+	assert.Len(page, 2)
+	assert.Equal(ReasonReply, page[0].Reason)
+	assert.Equal(ReasonFollow, page[1].Reason)
+	page, err = store.List(ctx, ListParams{Recipient: bob, Limit: 2, Before: page[1].ID})
+	assert.NoError(err)
+	assert.Len(page, 1)
+	assert.Equal(ReasonLike, page[0].Reason)
+
+	page, err = store.List(ctx, ListParams{Recipient: bob, Limit: 10, Reasons: []string{ReasonFollow}})
+	assert.NoError(err)
+	assert.Len(page, 1)
+
+	count, err := store.UnreadCount(ctx, bob)
+	assert.NoError(err)
+	assert.Equal(int64(3), count)
+	assert.NoError(store.UpdateSeen(ctx, bob, t0.Add(90*time.Second)))
+	assert.NoError(store.UpdateSeen(ctx, bob, t0.Add(90*time.Second)))
+	count, err = store.UnreadCount(ctx, bob)
+	assert.NoError(err)
+	assert.Equal(int64(1), count)
+
+	assert.NoError(store.DeleteURI(ctx, notifs[0].URI))
+	page, err = store.List(ctx, ListParams{Recipient: bob, Limit: 10})
+	assert.NoError(err)
+	assert.Len(page, 2)
+	assert.NoError(store.DeleteAuthor(ctx, alice))
+	page, err = store.List(ctx, ListParams{Recipient: bob, Limit: 10})
+	assert.NoError(err)
+	assert.Empty(page)
+
+	seq, err := store.Cursor(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(0), seq)
+	assert.NoError(store.SaveCursor(ctx, 42))
+	seq, err = store.Cursor(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(42), seq)
+}
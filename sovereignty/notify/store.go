@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReadState is the per-recipient read marker; notifications created at or before SeenAt are read.
+type ReadState struct {
+	Recipient string `gorm:"primarykey"`
+	SeenAt    time.Time
+}
+
+// StreamCursor is the last applied sovereign stream sequence number.
+type StreamCursor struct {
+	ID  uint `gorm:"primarykey"`
+	Seq int64
+}
+
+// Store persists notifications and read state in a SQL database.
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) (*Store, error) {
+	if err := db.AutoMigrate(&Notification{}, &ReadState{}, &StreamCursor{}); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Add inserts notifications, ignoring any which already exist for the same recipient and record (eg, when the stream is replayed).
+func (s *Store) Add(ctx context.Context, notifs []Notification) error {
+	if len(notifs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&notifs).Error
+}
+
+// DeleteURI removes the notifications caused by a record, when it is deleted.
+func (s *Store) DeleteURI(ctx context.Context, uri string) error {
+	return s.db.WithContext(ctx).Where("uri = ?", uri).Delete(&Notification{}).Error
+}
+
+// DeleteAuthor removes all notifications caused by an account, when it is deleted.
+func (s *Store) DeleteAuthor(ctx context.Context, did string) error {
+	return s.db.WithContext(ctx).Where("author = ?", did).Delete(&Notification{}).Error
+}
+
+// ListParams selects a page of a recipient's notifications, newest first.
+type ListParams struct {
+	Recipient string
+	// only return notifications with an ID below this; zero for the first page
+	Before uint
+	Limit  int
+	// if non-empty, only return notifications with these reasons
+	Reasons []string
+}
+
+func (s *Store) List(ctx context.Context, p ListParams) ([]Notification, error) {
+	q := s.db.WithContext(ctx).Where("recipient = ?", p.Recipient)
+	if p.Before > 0 {
+		q = q.Where("id < ?", p.Before)
+	}
+	if len(p.Reasons) > 0 {
+		q = q.Where("reason IN ?", p.Reasons)
+	}
+	var out []Notification
+	if err := q.Order("id DESC").Limit(p.Limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SeenAt returns the recipient's read marker, or the zero time if they have never marked notifications as seen.
+func (s *Store) SeenAt(ctx context.Context, recipient string) (time.Time, error) {
+	var rs ReadState
+	err := s.db.WithContext(ctx).Where("recipient = ?", recipient).Take(&rs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rs.SeenAt, nil
+}
+
+// UpdateSeen moves the recipient's read marker to seenAt.
+func (s *Store) UpdateSeen(ctx context.Context, recipient string, seenAt time.Time) error {
+	rs := ReadState{Recipient: recipient, SeenAt: seenAt.UTC()}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "recipient"}},
+		DoUpdates: clause.AssignmentColumns([]string{"seen_at"}),
+	}).Create(&rs).Error
+}
+
+// UnreadCount returns the number of the recipient's notifications created after their read marker.
+func (s *Store) UnreadCount(ctx context.Context, recipient string) (int64, error) {
+	seenAt, err := s.SeenAt(ctx, recipient)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = s.db.WithContext(ctx).Model(&Notification{}).Where("recipient = ? AND created_at > ?", recipient, seenAt).Count(&n).Error
+	return n, err
+}
+
+// Cursor returns the last saved stream sequence number, or zero.
+func (s *Store) Cursor(ctx context.Context) (int64, error) {
+	var c StreamCursor
+	err := s.db.WithContext(ctx).Where("id = 1").Take(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return c.Seq, err
+}
+
+func (s *Store) SaveCursor(ctx context.Context, seq int64) error {
+	return s.db.WithContext(ctx).Save(&StreamCursor{ID: 1, Seq: seq}).Error
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/sovereignty/follower"
+
+	"github.com/ipfs/go-cid"
+)
+
+// collections whose records can produce notifications
+var notifyCollections = map[string]bool{
+	"app.bsky.feed.like":    true,
+	"app.bsky.feed.post":    true,
+	"app.bsky.graph.follow": true,
+}
+
+// Service materializes notifications from the sovereign stream in to a Store.
+type Service struct {
+	Store *Store
+	// if set, only these accounts receive notifications (eg, accounts with a sovereignty classification)
+	IsRecipient func(did string) bool
+
+	seq atomic.Int64
+}
+
+func NewService(store *Store) *Service {
+	return &Service{Store: store}
+}
+
+// Seq returns the sequence number of the last event notifications were derived from, which is the cursor to resume the stream from.
+func (s *Service) Seq() int64 {
+	return s.seq.Load()
+}
+
+// LoadCursor restores the stream position from the store.
+func (s *Service) LoadCursor(ctx context.Context) error {
+	seq, err := s.Store.Cursor(ctx)
+	if err != nil {
+		return err
+	}
+	s.seq.Store(seq)
+	return nil
+}
+
+// SaveCursor persists the current stream position.
+func (s *Service) SaveCursor(ctx context.Context) error {
+	return s.Store.SaveCursor(ctx, s.seq.Load())
+}
+
+// HandleEvent applies a stream event. It has the signature of a stream scheduler handler.
+func (s *Service) HandleEvent(ctx context.Context, evt *events.XRPCStreamEvent) error {
+	switch {
+	case evt.RepoCommit != nil:
+		if err := s.ObserveCommit(ctx, evt.RepoCommit); err != nil {
+			return err
+		}
+		s.seq.Store(evt.RepoCommit.Seq)
+	case evt.RepoAccount != nil:
+		acc := evt.RepoAccount
+		if !acc.Active && acc.Status != nil && *acc.Status == "deleted" {
+			if err := s.Store.DeleteAuthor(ctx, acc.Did); err != nil {
+				return err
+			}
+		}
+		s.seq.Store(acc.Seq)
+	case evt.RepoIdentity != nil:
+		s.seq.Store(evt.RepoIdentity.Seq)
+	case evt.RepoSync != nil:
+		s.seq.Store(evt.RepoSync.Seq)
+	}
+	return nil
+}
+
+// ObserveCommit materializes notifications for records created in a commit, and removes them for deleted records. Record updates are ignored.
+func (s *Service) ObserveCommit(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit) error {
+	var blocks map[cid.Cid][]byte
+	var notifs []Notification
+	for _, op := range commit.Ops {
+		coll, rkey, ok := strings.Cut(op.Path, "/")
+		if !ok || !notifyCollections[coll] {
+			continue
+		}
+		uri, err := syntax.ParseATURI(fmt.Sprintf("at://%s/%s/%s", commit.Repo, coll, rkey))
+		if err != nil {
+			continue
+		}
+		switch op.Action {
+		case "delete":
+			if err := s.Store.DeleteURI(ctx, uri.String()); err != nil {
+				return err
+			}
+			continue
+		case "create":
+		default:
+			continue
+		}
+		if op.Cid == nil {
+			continue
+		}
+		if blocks == nil {
+			blocks, err = follower.ReadBlocks(commit.Blocks)
+			if err != nil {
+				return err
+			}
+		}
+		raw, ok := blocks[cid.Cid(*op.Cid)]
+		if !ok {
+			return fmt.Errorf("record block missing from commit: %s", op.Path)
+		}
+		rec, err := lexutil.CborDecodeValue(raw)
+		if err != nil {
+			// nobody is notified about a record that doesn't decode
+			continue
+		}
+		notifs = append(notifs, Derive(uri, op.Cid.String(), rec, raw, s.IsRecipient)...)
+	}
+
+	created := time.Now().UTC()
+	for i := range notifs {
+		notifs[i].CreatedAt = created
+	}
+	return s.Store.Add(ctx, notifs)
+}
@@ -0,0 +1,60 @@
+package orgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// path under a relay's base URL at which the verified organization list is published
+const ListPath = "/sovereignty/orgs"
+
+// FetchList downloads the list of verified organizations published by a relay.
+func FetchList(ctx context.Context, client *http.Client, relayURL string) ([]Org, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", relayURL+ListPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching verified organizations: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("fetching verified organizations: HTTP status %d", resp.StatusCode)
+	}
+	var out []Org
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding verified organizations: %w", err)
+	}
+	return out, nil
+}
+
+// Follow keeps the registry in sync with the list published by a relay, refreshing every interval until the context is cancelled. Fetch failures are logged and the previous contents kept.
+func (r *Registry) Follow(ctx context.Context, client *http.Client, relayURL string, interval time.Duration, logger *slog.Logger) {
+	refresh := func() {
+		orgs, err := FetchList(ctx, client, relayURL)
+		if err != nil {
+			logger.Warn("failed to refresh verified organizations", "relay", relayURL, "err", err)
+			return
+		}
+		r.Replace(orgs)
+	}
+
+	refresh()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			refresh()
+		}
+	}
+}
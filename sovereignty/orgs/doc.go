@@ -0,0 +1,4 @@
+// Registry of verified institutional accounts, such as government bodies and universities.
+//
+// An organization is verified by proving that its account DID controls the organization's official domain, using the same DNS TXT or HTTPS well-known mechanism as atproto handle resolution. The relay keeps the authoritative registry and publishes the list of verified organizations; the search service's feed generator, the automod labeler (which applies an "org-verified" account label), and the priority channel all consume it.
+package orgs
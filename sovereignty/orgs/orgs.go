@@ -0,0 +1,127 @@
+package orgs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	KindGovernment = "government"
+	KindUniversity = "university"
+)
+
+const (
+	// domain proven with a TXT record at _atproto.<domain>
+	MethodDNS = "dns"
+	// domain proven with https://<domain>/.well-known/atproto-did
+	MethodWellKnown = "well-known"
+)
+
+// account label applied to verified organizations
+const VerifiedLabel = "org-verified"
+
+// ValidKind returns an error unless k is one of the known organization kinds.
+func ValidKind(k string) error {
+	switch k {
+	case KindGovernment, KindUniversity:
+		return nil
+	default:
+		return fmt.Errorf("unknown organization kind: %q", k)
+	}
+}
+
+// Org is a single verified organization.
+type Org struct {
+	DID string `json:"did"`
+	// official domain the DID was proven against
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	// how the domain was proven; one of the Method constants
+	Method     string    `json:"method"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// Registry is the in-process set of verified organizations, safe for concurrent use.
+type Registry struct {
+	lk   sync.RWMutex
+	orgs map[string]Org
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		orgs: make(map[string]Org),
+	}
+}
+
+// Get returns the verified organization record for the DID, if there is one.
+func (r *Registry) Get(did string) (Org, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	o, ok := r.orgs[did]
+	return o, ok
+}
+
+// IsVerified returns true if the DID is a verified organization.
+func (r *Registry) IsVerified(did string) bool {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	_, ok := r.orgs[did]
+	return ok
+}
+
+// Set inserts or replaces the record for o.DID.
+func (r *Registry) Set(o Org) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.orgs[o.DID] = o
+}
+
+// Delete removes the DID, returning true if it was a verified organization.
+func (r *Registry) Delete(did string) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	_, ok := r.orgs[did]
+	delete(r.orgs, did)
+	return ok
+}
+
+// Replace swaps the full contents of the registry.
+func (r *Registry) Replace(orgs []Org) {
+	m := make(map[string]Org, len(orgs))
+	for _, o := range orgs {
+		m[o.DID] = o
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.orgs = m
+}
+
+// List returns all verified organizations, sorted by DID.
+func (r *Registry) List() []Org {
+	r.lk.RLock()
+	out := make([]Org, 0, len(r.orgs))
+	for _, o := range r.orgs {
+		out = append(out, o)
+	}
+	r.lk.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].DID < out[j].DID })
+	return out
+}
+
+// DIDs returns the DIDs of all verified organizations, sorted.
+func (r *Registry) DIDs() []string {
+	r.lk.RLock()
+	out := make([]string, 0, len(r.orgs))
+	for did := range r.orgs {
+		out = append(out, did)
+	}
+	r.lk.RUnlock()
+
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,104 @@
+package orgs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	dns       map[string]syntax.DID
+	wellKnown map[string]syntax.DID
+}
+
+func (f *fakeResolver) ResolveHandleDNS(ctx context.Context, h syntax.Handle) (syntax.DID, error) {
+	if did, ok := f.dns[h.String()]; ok {
+		return did, nil
+	}
+	return "", identity.ErrHandleNotFound
+}
+
+func (f *fakeResolver) ResolveHandleWellKnown(ctx context.Context, h syntax.Handle) (syntax.DID, error) {
+	if did, ok := f.wellKnown[h.String()]; ok {
+		return did, nil
+	}
+	return "", identity.ErrHandleNotFound
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	v := NewVerifier(&fakeResolver{
+		dns:       map[string]syntax.DID{"canada.ca": "did:plc:gov", "elsewhere.ca": "did:plc:other"},
+		wellKnown: map[string]syntax.DID{"utoronto.ca": "did:plc:uoft"},
+	})
+	v.now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	o, err := v.Verify(ctx, Org{DID: "did:plc:gov", Domain: "Canada.CA", Kind: KindGovernment})
+	assert.NoError(err)
+	assert.Equal(MethodDNS, o.Method)
+	assert.Equal("canada.ca", o.Domain)
+	assert.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), o.VerifiedAt)
+
+	o, err = v.Verify(ctx, Org{DID: "did:plc:uoft", Domain: "utoronto.ca", Kind: KindUniversity})
+	assert.NoError(err)
+	assert.Equal(MethodWellKnown, o.Method)
+
+	_, err = v.Verify(ctx, Org{DID: "did:plc:gov", Domain: "elsewhere.ca"})
+	assert.ErrorIs(err, ErrDomainMismatch)
+	_, err = v.Verify(ctx, Org{DID: "did:plc:gov", Domain: "missing.ca"})
+	assert.ErrorIs(err, identity.ErrHandleNotFound)
+	_, err = v.Verify(ctx, Org{DID: "did:plc:gov", Domain: "not a domain"})
+	assert.Error(err)
+
+	assert.NoError(ValidKind(KindUniversity))
+	assert.Error(ValidKind("celebrity"))
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRegistry()
+	r.Set(Org{DID: "did:plc:b", Domain: "utoronto.ca", Kind: KindUniversity})
+	r.Set(Org{DID: "did:plc:a", Domain: "canada.ca", Kind: KindGovernment})
+	assert.True(r.IsVerified("did:plc:a"))
+	assert.Equal([]string{"did:plc:a", "did:plc:b"}, r.DIDs())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != ListPath {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewEncoder(w).Encode(r.List())
+	}))
+	defer srv.Close()
+
+	orgs, err := FetchList(context.Background(), srv.Client(), srv.URL)
+	assert.NoError(err)
+	assert.Equal(r.List(), orgs)
+
+	assert.True(r.Delete("did:plc:a"))
+	assert.False(r.IsVerified("did:plc:a"))
+
+	follower := NewRegistry()
+	follower.Set(Org{DID: "did:plc:stale"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go follower.Follow(ctx, srv.Client(), srv.URL, time.Hour, slog.Default())
+	assert.Eventually(func() bool { return !follower.IsVerified("did:plc:stale") }, time.Second, 10*time.Millisecond)
+	assert.Equal([]string{"did:plc:b"}, follower.DIDs())
+
+	_, err = FetchList(context.Background(), srv.Client(), fmt.Sprintf("%s/nope", srv.URL))
+	assert.Error(err)
+}
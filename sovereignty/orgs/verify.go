@@ -0,0 +1,64 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+var ErrDomainMismatch = errors.New("domain does not resolve to the organization's DID")
+
+// HandleResolver is the subset of identity.BaseDirectory used to prove domain control.
+type HandleResolver interface {
+	ResolveHandleDNS(ctx context.Context, handle syntax.Handle) (syntax.DID, error)
+	ResolveHandleWellKnown(ctx context.Context, handle syntax.Handle) (syntax.DID, error)
+}
+
+// Verifier proves that a DID controls an organization's official domain.
+type Verifier struct {
+	Resolver HandleResolver
+	now      func() time.Time
+}
+
+// NewVerifier returns a Verifier using the given resolver, typically an *identity.BaseDirectory.
+func NewVerifier(r HandleResolver) *Verifier {
+	return &Verifier{
+		Resolver: r,
+		now:      time.Now,
+	}
+}
+
+// Verify checks that the organization's domain resolves to its DID, trying DNS first and then the HTTPS well-known path. On success it returns a copy of the org with Method and VerifiedAt filled in.
+func (v *Verifier) Verify(ctx context.Context, o Org) (Org, error) {
+	did, err := syntax.ParseDID(o.DID)
+	if err != nil {
+		return o, fmt.Errorf("invalid organization DID: %w", err)
+	}
+	domain, err := syntax.ParseHandle(o.Domain)
+	if err != nil {
+		return o, fmt.Errorf("invalid organization domain: %w", err)
+	}
+	domain = domain.Normalize()
+	o.Domain = domain.String()
+
+	dnsDID, dnsErr := v.Resolver.ResolveHandleDNS(ctx, domain)
+	if dnsErr == nil && dnsDID == did {
+		o.Method = MethodDNS
+		o.VerifiedAt = v.now().UTC()
+		return o, nil
+	}
+	wkDID, wkErr := v.Resolver.ResolveHandleWellKnown(ctx, domain)
+	if wkErr == nil && wkDID == did {
+		o.Method = MethodWellKnown
+		o.VerifiedAt = v.now().UTC()
+		return o, nil
+	}
+
+	if dnsErr == nil || wkErr == nil {
+		return o, fmt.Errorf("%w: %s", ErrDomainMismatch, domain)
+	}
+	return o, fmt.Errorf("resolving %s: dns: %w; well-known: %w", domain, dnsErr, wkErr)
+}
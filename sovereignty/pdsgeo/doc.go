@@ -0,0 +1,4 @@
+// Attribution of accounts to countries by where their PDS is hosted.
+//
+// An account's DID document names its PDS; the PDS hostname is resolved and its addresses geolocated against an operator-supplied table of IP ranges, a MaxMind GeoIP2 database, or both. If that fails (the host doesn't resolve, its addresses aren't in the table, or they are spread over several countries, as with anycast CDNs), the hostname's country-code top-level domain is used instead, when it has one. DID strings themselves carry no location information and are never inspected.
+package pdsgeo
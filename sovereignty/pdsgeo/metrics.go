@@ -0,0 +1,11 @@
+package pdsgeo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var pdsGeoResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "pdsgeo_resolutions_total",
+	Help: "PDS country resolutions, by how the country was determined (pds-geo, pds-tld or none)",
+}, []string{"source"})
@@ -0,0 +1,112 @@
+package pdsgeo
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDB is a Geolocator backed by a MaxMind GeoIP2 or GeoLite2 Country or City database file. Addresses are located by the country of the network's users, with its subdivision from City databases, falling back to the country it is registered in. The file can be replaced while in use; Reload picks up the new one.
+type MMDB struct {
+	path string
+
+	// serialises reloads
+	lk      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	// read into memory rather than mapped, so lookups on a replaced reader stay valid
+	reader atomic.Pointer[maxminddb.Reader]
+}
+
+var _ Geolocator = (*MMDB)(nil)
+
+// the subset of a GeoIP2 record needed to locate an address
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	// City databases only, largest first
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// OpenMMDB loads the MaxMind database at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	m := &MMDB{path: path}
+	if _, err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload reads the database file again if it has changed (by modification time or size) since it was last loaded, and reports whether it did. If the new file can't be read, the previous database stays in use.
+func (m *MMDB) Reload() (bool, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return false, err
+	}
+	if m.reader.Load() != nil && fi.ModTime().Equal(m.modTime) && fi.Size() == m.size {
+		return false, nil
+	}
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		return false, err
+	}
+	r, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return false, fmt.Errorf("loading %s: %w", m.path, err)
+	}
+	m.reader.Store(r)
+	m.modTime = fi.ModTime()
+	m.size = fi.Size()
+	return true, nil
+}
+
+// Metadata describes the database currently in use.
+func (m *MMDB) Metadata() maxminddb.Metadata {
+	return m.reader.Load().Metadata
+}
+
+func (m *MMDB) Country(addr netip.Addr) (string, bool) {
+	var rec mmdbRecord
+	if err := m.reader.Load().Lookup(net.IP(addr.Unmap().AsSlice()), &rec); err != nil {
+		return "", false
+	}
+	c := rec.Country.ISOCode
+	if c == "" {
+		c = rec.RegisteredCountry.ISOCode
+	} else if len(rec.Subdivisions) > 0 && rec.Subdivisions[0].ISOCode != "" {
+		// the subdivision of where the network's users are
+		return c + "-" + rec.Subdivisions[0].ISOCode, true
+	}
+	if c == "" {
+		return "", false
+	}
+	return c, true
+}
+
+// Geolocators is a Geolocator asking each of its members in turn, answering with the first to locate the address. Eg, operator-supplied IP ranges can override a GeoIP database.
+type Geolocators []Geolocator
+
+func (gs Geolocators) Country(addr netip.Addr) (string, bool) {
+	for _, g := range gs {
+		if c, ok := g.Country(addr); ok {
+			return c, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+package pdsgeo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestMMDB writes an IPv4 MaxMind database mapping each prefix to a record with that country (or, prefixed with "registered:", registered country)
+func writeTestMMDB(t *testing.T, path string, ranges map[string]string) {
+	type node struct {
+		// child node index, or -1 for empty, or -2-offset for data
+		children [2]int
+	}
+	nodes := []node{{children: [2]int{-1, -1}}}
+	var data bytes.Buffer
+	str := func(s string) {
+		data.WriteByte(0x40 | byte(len(s)))
+		data.WriteString(s)
+	}
+	for p, c := range ranges {
+		prefix := netip.MustParsePrefix(p)
+		off := data.Len()
+		key := "country"
+		if strings.HasPrefix(c, "registered:") {
+			key, c = "registered_country", strings.TrimPrefix(c, "registered:")
+		}
+		data.WriteByte(0xE1)
+		str(key)
+		data.WriteByte(0xE1)
+		str("iso_code")
+		str(c)
+
+		ip := prefix.Addr().As4()
+		cur := 0
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := (ip[i/8] >> (7 - i%8)) & 1
+			if i == prefix.Bits()-1 {
+				nodes[cur].children[bit] = -2 - off
+				break
+			}
+			next := nodes[cur].children[bit]
+			if next < 0 {
+				nodes = append(nodes, node{children: [2]int{-1, -1}})
+				next = len(nodes) - 1
+				nodes[cur].children[bit] = next
+			}
+			cur = next
+		}
+	}
+
+	var out bytes.Buffer
+	n := len(nodes)
+	for _, nd := range nodes {
+		for _, ch := range nd.children {
+			v := n // empty
+			if ch >= 0 {
+				v = ch
+			} else if ch <= -2 {
+				v = n + 16 + (-2 - ch)
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	meta := &data
+	meta.Reset()
+	meta.WriteByte(0xE0 | 5)
+	str("node_count")
+	meta.WriteByte(0xC4)
+	binary.Write(meta, binary.BigEndian, uint32(n))
+	str("record_size")
+	meta.Write([]byte{0xA1, 24})
+	str("ip_version")
+	meta.Write([]byte{0xA1, 4})
+	str("binary_format_major_version")
+	meta.Write([]byte{0xA1, 2})
+	str("database_type")
+	str("Test-Country")
+	out.Write(meta.Bytes())
+
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMDB(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeTestMMDB(t, path, map[string]string{
+		"198.51.100.0/24": "CA",
+		"203.0.113.0/25":  "registered:FR",
+	})
+
+	db, err := OpenMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("Test-Country", db.Metadata().DatabaseType)
+	for addr, exp := range map[string]string{
+		"198.51.100.7":        "CA",
+		"::ffff:198.51.100.7": "CA",
+		"203.0.113.1":         "FR",
+		"203.0.113.200":       "",
+		"192.0.2.1":           "",
+		"2001:db8::1":         "",
+	} {
+		c, ok := db.Country(netip.MustParseAddr(addr))
+		assert.Equal(exp != "", ok, addr)
+		assert.Equal(exp, c, addr)
+	}
+
+	// unchanged files aren't read again
+	reloaded, err := db.Reload()
+	assert.NoError(err)
+	assert.False(reloaded)
+
+	// a broken replacement leaves the loaded database in use
+	later := time.Now().Add(time.Minute)
+	assert.NoError(os.WriteFile(path, []byte("not a database"), 0644))
+	assert.NoError(os.Chtimes(path, later, later))
+	_, err = db.Reload()
+	assert.Error(err)
+	c, _ := db.Country(netip.MustParseAddr("198.51.100.7"))
+	assert.Equal("CA", c)
+
+	writeTestMMDB(t, path, map[string]string{"198.51.100.0/24": "US"})
+	later = later.Add(time.Minute)
+	assert.NoError(os.Chtimes(path, later, later))
+	reloaded, err = db.Reload()
+	assert.NoError(err)
+	assert.True(reloaded)
+	c, _ = db.Country(netip.MustParseAddr("198.51.100.7"))
+	assert.Equal("US", c)
+
+	// operator ranges take precedence over the database
+	rt, err := NewRangeTable(map[string]string{"198.51.100.0/28": "CA"})
+	assert.NoError(err)
+	geo := Geolocators{rt, db}
+	c, _ = geo.Country(netip.MustParseAddr("198.51.100.7"))
+	assert.Equal("CA", c)
+	c, _ = geo.Country(netip.MustParseAddr("198.51.100.70"))
+	assert.Equal("US", c)
+}
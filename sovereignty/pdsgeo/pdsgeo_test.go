@@ -0,0 +1,166 @@
+package pdsgeo
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	rt, err := LoadRanges(strings.NewReader("# prefix,country\n198.51.100.0/24,ca\n198.51.0.0/16,US\n2001:db8::/32,CA\n"))
+	assert.NoError(err)
+	assert.Equal(3, rt.Len())
+
+	for addr, exp := range map[string]string{
+		"198.51.100.7":        "CA",
+		"198.51.7.1":          "US",
+		"::ffff:198.51.100.7": "CA",
+		"2001:db8::1":         "CA",
+		"203.0.113.1":         "",
+		"2001:db9::1":         "",
+	} {
+		c, ok := rt.Country(netip.MustParseAddr(addr))
+		assert.Equal(exp != "", ok, addr)
+		assert.Equal(exp, c, addr)
+	}
+
+	// rows can locate prefixes to a subdivision
+	rt, err = LoadRanges(strings.NewReader("198.51.100.0/24,ca-qc\n"))
+	assert.NoError(err)
+	c, _ := rt.Country(netip.MustParseAddr("198.51.100.7"))
+	assert.Equal("CA-QC", c)
+
+	_, err = LoadRanges(strings.NewReader("198.51.100.0/24,CAN\n"))
+	assert.Error(err)
+	_, err = LoadRanges(strings.NewReader("not a prefix,CA\n"))
+	assert.Error(err)
+}
+
+func TestTLDCountry(t *testing.T) {
+	assert := assert.New(t)
+	for host, exp := range map[string]string{
+		"pds.example.ca":    "CA",
+		"pds.example.ca.":   "CA",
+		"pds.example.co.uk": "GB",
+		"pds.example.com":   "",
+		"pds.example.io":    "",
+		"localhost":         "",
+		"198.51.100.7":      "",
+	} {
+		c, ok := TLDCountry(host)
+		assert.Equal(exp != "", ok, host)
+		assert.Equal(exp, c, host)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir := identity.NewMockDirectory()
+	pds := func(did, endpoint string) {
+		dir.Insert(identity.Identity{
+			DID:    syntax.DID(did),
+			Handle: syntax.Handle("handle.invalid"),
+			Services: map[string]identity.Service{
+				"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: endpoint},
+			},
+		})
+	}
+	pds("did:plc:aaaa", "https://pds.example.com")
+	pds("did:plc:bbbb", "https://cdn.example.ca")
+	pds("did:plc:cccc", "https://cdn.example.com")
+	pds("did:plc:dddd", "https://down.example.ca:2583")
+	pds("did:plc:eeee", "https://198.51.100.9")
+	dir.Insert(identity.Identity{DID: "did:plc:ffff", Handle: "handle.invalid"})
+
+	rt, err := NewRangeTable(map[string]string{"198.51.100.0/24": "CA", "203.0.113.0/24": "US"})
+	assert.NoError(err)
+	r := &Resolver{
+		Dir: &dir,
+		Geo: rt,
+		LookupIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			switch host {
+			case "pds.example.com":
+				return []netip.Addr{netip.MustParseAddr("198.51.100.7"), netip.MustParseAddr("198.51.100.8")}, nil
+			case "cdn.example.ca", "cdn.example.com":
+				return []netip.Addr{netip.MustParseAddr("198.51.100.7"), netip.MustParseAddr("203.0.113.7")}, nil
+			}
+			return nil, fmt.Errorf("no such host")
+		},
+	}
+
+	res, err := r.Resolve(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal(SourceGeo, res.Source)
+	assert.Equal("pds.example.com", res.PDS)
+	assert.Len(res.Addrs, 2)
+
+	res, err = r.Resolve(ctx, "did:plc:eeee")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal(SourceGeo, res.Source)
+
+	// addresses spread over several countries fall back to the TLD
+	res, err = r.Resolve(ctx, "did:plc:bbbb")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal(SourceTLD, res.Source)
+	assert.Contains(res.Fallback, "several countries")
+
+	res, err = r.Resolve(ctx, "did:plc:dddd")
+	assert.NoError(err)
+	assert.Equal(SourceTLD, res.Source)
+	assert.Equal("down.example.ca", res.PDS)
+
+	_, err = r.Resolve(ctx, "did:plc:cccc")
+	assert.ErrorIs(err, ErrNoCountry)
+
+	// as a country resolver, the TLD is a weaker signal
+	country, conf, err := r.ResolveCountry(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("CA", country)
+	assert.Equal(sovereignty.ConfidenceMedium, conf)
+	cres, err := r.ResolveCountrySource(ctx, "did:plc:dddd")
+	assert.NoError(err)
+	assert.Equal(sovereignty.ConfidenceLow, cres.Confidence)
+	assert.Equal(SourceTLD, cres.Source)
+	_, _, err = r.ResolveCountry(ctx, "did:plc:cccc")
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+
+	// nothing to fall back on without a PDS
+	_, err = r.Resolve(ctx, "did:plc:ffff")
+	assert.Error(err)
+	assert.NotErrorIs(err, ErrNoCountry)
+	_, err = r.Resolve(ctx, "did:plc:zzzz")
+	assert.Error(err)
+
+	// a subdivision is kept if every address is in it
+	r.Geo, err = NewRangeTable(map[string]string{"198.51.100.0/25": "CA-QC", "198.51.100.128/25": "CA-ON"})
+	assert.NoError(err)
+	res, err = r.Resolve(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal("QC", res.Subdivision)
+	country, _, err = r.ResolveCountry(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("CA-QC", country)
+	pds("did:plc:gggg", "https://198.51.100.200")
+	r.LookupIP = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("198.51.100.7"), netip.MustParseAddr("198.51.100.200")}, nil
+	}
+	res, err = r.Resolve(ctx, "did:plc:aaaa")
+	assert.NoError(err)
+	assert.Equal("CA", res.Country)
+	assert.Equal("", res.Subdivision)
+}
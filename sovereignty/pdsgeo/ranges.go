@@ -0,0 +1,115 @@
+package pdsgeo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// Geolocator maps an IP address to the ISO 3166-1 alpha-2 code of the country it is located in, or to the ISO 3166-2 code of its subdivision (eg, "CA-QC") when that is known.
+type Geolocator interface {
+	Country(addr netip.Addr) (string, bool)
+}
+
+type ipRange struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// RangeTable is a Geolocator backed by a list of IP prefixes, such as an export of a GeoIP database or of the regional internet registries' delegation files. Where prefixes overlap, the most specific one wins.
+type RangeTable struct {
+	// sorted by prefix length, longest first
+	ranges []ipRange
+}
+
+// NewRangeTable builds a table from prefixes (eg, "192.0.2.0/24") mapped to country or subdivision codes.
+func NewRangeTable(ranges map[string]string) (*RangeTable, error) {
+	rt := &RangeTable{}
+	for p, c := range ranges {
+		if err := rt.add(p, c); err != nil {
+			return nil, err
+		}
+	}
+	rt.sort()
+	return rt, nil
+}
+
+// LoadRanges reads a table from CSV rows of prefix and country code, or subdivision code (eg, "CA-QC"). Blank lines and lines starting with '#' are skipped.
+func LoadRanges(r io.Reader) (*RangeTable, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	rt := &RangeTable{}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := rt.add(rec[0], rec[1]); err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	rt.sort()
+	return rt, nil
+}
+
+// LoadRangesFile reads a table with LoadRanges from the named file.
+func LoadRangesFile(fname string) (*RangeTable, error) {
+	fi, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	rt, err := LoadRanges(fi)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return rt, nil
+}
+
+func (rt *RangeTable) add(prefix, country string) error {
+	p, err := netip.ParsePrefix(strings.TrimSpace(prefix))
+	if err != nil {
+		return err
+	}
+	c, sub, err := sovereignty.ParseRegion(country)
+	if err != nil {
+		return err
+	}
+	region := sovereignty.Classification{Country: c, Subdivision: sub}.Region()
+	rt.ranges = append(rt.ranges, ipRange{prefix: p.Masked(), country: region})
+	return nil
+}
+
+func (rt *RangeTable) sort() {
+	sort.SliceStable(rt.ranges, func(i, j int) bool {
+		return rt.ranges[i].prefix.Bits() > rt.ranges[j].prefix.Bits()
+	})
+}
+
+// Len returns the number of prefixes in the table.
+func (rt *RangeTable) Len() int {
+	return len(rt.ranges)
+}
+
+func (rt *RangeTable) Country(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+	for _, r := range rt.ranges {
+		if r.prefix.Contains(addr) {
+			return r.country, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,206 @@
+package pdsgeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// Sources recorded on classifications, by how the country was determined
+const (
+	SourceGeo = "pds-geo"
+	SourceTLD = "pds-tld"
+)
+
+// ErrNoCountry is returned when neither the PDS's addresses nor its hostname indicate a country
+var ErrNoCountry = errors.New("could not determine the country of the account's PDS")
+
+// Result is the country an account's PDS is hosted in.
+type Result struct {
+	DID string `json:"did"`
+	// hostname of the account's PDS
+	PDS     string `json:"pds"`
+	Country string `json:"country"`
+	// ISO 3166-2 subdivision within Country, unprefixed; empty unless every address was located in it
+	Subdivision string `json:"subdivision,omitempty"`
+	// SourceGeo or SourceTLD
+	Source string `json:"source"`
+	// the addresses the PDS hostname resolved to
+	Addrs []string `json:"addrs,omitempty"`
+	// why geolocation fell back to the hostname, if it did
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Resolver attributes accounts to the country their PDS is hosted in.
+type Resolver struct {
+	Dir identity.Directory
+	Geo Geolocator
+	// resolves the PDS hostname; nil uses net.DefaultResolver
+	LookupIP func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+func (r *Resolver) lookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	if r.LookupIP != nil {
+		return r.LookupIP(ctx, host)
+	}
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// Resolve looks up the account's DID document, and geolocates the PDS it names. Errors resolving the DID, or a DID document without a PDS, are returned as they are: there is nothing to fall back on. Returns ErrNoCountry if no country could be determined.
+func (r *Resolver) Resolve(ctx context.Context, did syntax.DID) (*Result, error) {
+	ident, err := r.Dir.LookupDID(ctx, did)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", did, err)
+	}
+	endpoint := ident.PDSEndpoint()
+	if endpoint == "" {
+		return nil, fmt.Errorf("%s has no PDS in its DID document", did)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("%s has an invalid PDS endpoint: %q", did, endpoint)
+	}
+	res, err := r.LocateHost(ctx, u.Hostname())
+	res.DID = did.String()
+	return res, err
+}
+
+// LocateHost geolocates a PDS hostname, falling back to its country-code TLD. The result has no DID. Returns ErrNoCountry, with the partial result, if no country could be determined.
+func (r *Resolver) LocateHost(ctx context.Context, host string) (*Result, error) {
+	host = strings.ToLower(host)
+	res := &Result{PDS: host}
+
+	country, sub, fallback := r.geolocate(ctx, host, res)
+	if country != "" {
+		res.Country, res.Subdivision = country, sub
+		res.Source = SourceGeo
+		pdsGeoResults.WithLabelValues(SourceGeo).Inc()
+		return res, nil
+	}
+	res.Fallback = fallback
+	if c, ok := TLDCountry(host); ok {
+		res.Country = c
+		res.Source = SourceTLD
+		pdsGeoResults.WithLabelValues(SourceTLD).Inc()
+		return res, nil
+	}
+	pdsGeoResults.WithLabelValues("none").Inc()
+	return res, fmt.Errorf("%w: %s (%s)", ErrNoCountry, host, fallback)
+}
+
+// ResolveCountry implements sovereignty.CountryResolver. Geolocated answers have medium confidence, those from the hostname's TLD low confidence.
+func (r *Resolver) ResolveCountry(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+	res, err := r.ResolveCountrySource(ctx, did)
+	if err != nil {
+		return "", sovereignty.ConfidenceNone, err
+	}
+	return res.Region(), res.Confidence, nil
+}
+
+// ResolveCountrySource implements sovereignty.SourceResolver, reporting SourceGeo or SourceTLD as the source
+func (r *Resolver) ResolveCountrySource(ctx context.Context, did string) (*sovereignty.Resolution, error) {
+	d, err := syntax.ParseDID(did)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Resolve(ctx, d)
+	if err != nil {
+		if errors.Is(err, ErrNoCountry) {
+			return nil, fmt.Errorf("%w: %w", sovereignty.ErrCountryUnknown, err)
+		}
+		return nil, err
+	}
+	conf := sovereignty.ConfidenceMedium
+	if res.Source == SourceTLD {
+		conf = sovereignty.ConfidenceLow
+	}
+	return &sovereignty.Resolution{DID: res.DID, Country: res.Country, Subdivision: res.Subdivision, Confidence: conf, Source: res.Source}, nil
+}
+
+// geolocate returns the single country all of the host's addresses are located in, and their subdivision if they share one, or why there isn't a country
+func (r *Resolver) geolocate(ctx context.Context, host string, res *Result) (string, string, string) {
+	if r.Geo == nil {
+		return "", "", "no geolocation configured"
+	}
+	var addrs []netip.Addr
+	if a, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{a}
+	} else {
+		addrs, err = r.lookupIP(ctx, host)
+		if err != nil {
+			return "", "", fmt.Sprintf("lookup failed: %s", err)
+		}
+	}
+	if len(addrs) == 0 {
+		return "", "", "no addresses"
+	}
+
+	var country, sub string
+	for i, a := range addrs {
+		res.Addrs = append(res.Addrs, a.String())
+		region, ok := r.Geo.Country(a)
+		if !ok {
+			return "", "", fmt.Sprintf("%s could not be geolocated", a)
+		}
+		c, s, err := sovereignty.ParseRegion(region)
+		if err != nil {
+			return "", "", fmt.Sprintf("%s was located in an invalid region: %s", a, err)
+		}
+		if country != "" && c != country {
+			return "", "", fmt.Sprintf("addresses in several countries (%s, %s)", country, c)
+		}
+		if i > 0 && s != sub {
+			// spread over several subdivisions, or only some located to one
+			s = ""
+		}
+		country, sub = c, s
+	}
+	return country, sub, ""
+}
+
+// TLDCountry returns the country of the host's country-code top-level domain. ccTLDs commonly used as generic domains (eg, .io, .co) don't count.
+func TLDCountry(host string) (string, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	i := strings.LastIndexByte(host, '.')
+	if i < 0 {
+		return "", false
+	}
+	tld := host[i+1:]
+	if len(tld) != 2 || genericCCTLDs[tld] {
+		return "", false
+	}
+	for _, c := range tld {
+		if c < 'a' || c > 'z' {
+			return "", false
+		}
+	}
+	if tld == "uk" {
+		return "GB", true
+	}
+	return strings.ToUpper(tld), true
+}
+
+var genericCCTLDs = map[string]bool{
+	"ai": true,
+	"co": true,
+	"fm": true,
+	"gg": true,
+	"io": true,
+	"ly": true,
+	"me": true,
+	"sh": true,
+	"so": true,
+	"tv": true,
+	"ws": true,
+	// reserved by IANA, not a country
+	"eu": true,
+	"su": true,
+}
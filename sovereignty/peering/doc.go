@@ -0,0 +1,4 @@
+// Health beacons exchanged between cooperating sovereign relays.
+//
+// Each relay periodically POSTs a summary of its own health (head sequence number, lag, upstream host counts, classification snapshot generation) to every configured peer, and gets the peer's summary back in the response. The combined view of the relay itself plus its peers is the "mesh" status, which operators can inspect, and which is intended as groundwork for coordinated failover.
+package peering
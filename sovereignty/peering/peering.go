@@ -0,0 +1,236 @@
+package peering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+const (
+	BeaconPath = "/sovereignty/peering/beacon"
+	MeshPath   = "/sovereignty/peering/mesh"
+
+	// cap on beacon and mesh response bodies
+	maxBodyBytes = 1024 * 1024
+)
+
+// Health is the summary a relay shares about itself.
+type Health struct {
+	// public hostname of the relay (no scheme)
+	Relay string `json:"relay"`
+	// sequence number of the most recent event on the relay's firehose
+	HeadSeq int64 `json:"headSeq"`
+	// seconds since the most recent firehose event; -1 if none since startup
+	LagSeconds float64 `json:"lagSeconds"`
+	// upstream hosts with an active subscription
+	ActiveHosts int `json:"activeHosts"`
+	// all known upstream hosts
+	KnownHosts      int `json:"knownHosts"`
+	Classifications int `json:"classifications"`
+	// generation of the last published classification snapshot; zero if not publishing
+	SnapshotGeneration int64  `json:"snapshotGeneration"`
+	Time               string `json:"time"`
+}
+
+// PeerStatus is the most recently observed state of a single peer.
+type PeerStatus struct {
+	// peer base URL, as configured
+	URL    string  `json:"url"`
+	Health *Health `json:"health,omitempty"`
+	// last time a beacon was exchanged successfully
+	LastSeen string `json:"lastSeen,omitempty"`
+	// error from the most recent exchange attempt, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// Mesh is the status of a relay and all of its configured peers.
+type Mesh struct {
+	Self  Health       `json:"self"`
+	Peers []PeerStatus `json:"peers"`
+}
+
+// Beacon periodically exchanges health summaries with a fixed set of peer relays.
+type Beacon struct {
+	self     func() Health
+	peers    []string
+	interval time.Duration
+	// exchanges beacons; may be replaced before Run
+	Client *http.Client
+
+	lk     sync.Mutex
+	status map[string]*PeerStatus
+
+	log *slog.Logger
+}
+
+// NewBeacon creates a beacon for the given peer base URLs (eg, "https://relay.example.ca"). The self callback is invoked to produce the local health summary whenever one is needed.
+func NewBeacon(self func() Health, peers []string, interval time.Duration) *Beacon {
+	status := make(map[string]*PeerStatus, len(peers))
+	norm := make([]string, 0, len(peers))
+	for _, p := range peers {
+		p = strings.TrimSuffix(p, "/")
+		norm = append(norm, p)
+		status[p] = &PeerStatus{URL: p}
+	}
+	return &Beacon{
+		self:     self,
+		peers:    norm,
+		interval: interval,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		status:   status,
+		log:      slog.Default().With("system", "peering"),
+	}
+}
+
+// Run exchanges beacons with all peers on the configured interval until the context is cancelled.
+func (b *Beacon) Run(ctx context.Context) {
+	if b.interval <= 0 || len(b.peers) == 0 {
+		return
+	}
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	for {
+		b.ExchangeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ExchangeAll sends the local health summary to every peer, concurrently, and records their responses.
+func (b *Beacon) ExchangeAll(ctx context.Context) {
+	self := b.self()
+	var wg sync.WaitGroup
+	for _, p := range b.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			h, err := Exchange(ctx, b.Client, peer, &self)
+			b.record(peer, h, err)
+			if err != nil {
+				b.log.Warn("peer beacon exchange failed", "peer", peer, "err", err)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+func (b *Beacon) record(peer string, h *Health, err error) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	st, ok := b.status[peer]
+	if !ok {
+		return
+	}
+	if err != nil {
+		st.Error = err.Error()
+		return
+	}
+	st.Error = ""
+	st.Health = h
+	st.LastSeen = syntax.DatetimeNow().String()
+}
+
+// HandleBeacon processes a beacon received from a peer, returning the local health summary to send back. Beacons are only accepted from configured peers, matched by hostname.
+func (b *Beacon) HandleBeacon(h *Health) (*Health, error) {
+	peer := b.peerForHost(h.Relay)
+	if peer == "" {
+		return nil, fmt.Errorf("beacon from unknown relay: %q", h.Relay)
+	}
+	b.record(peer, h, nil)
+	self := b.self()
+	return &self, nil
+}
+
+func (b *Beacon) peerForHost(host string) string {
+	if host == "" {
+		return ""
+	}
+	for _, p := range b.peers {
+		u, err := url.Parse(p)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Host, host) {
+			return p
+		}
+	}
+	return ""
+}
+
+// Mesh returns the local health summary along with the last known status of every peer, sorted by URL.
+func (b *Beacon) Mesh() *Mesh {
+	m := &Mesh{Self: b.self()}
+	b.lk.Lock()
+	for _, st := range b.status {
+		cp := *st
+		if st.Health != nil {
+			h := *st.Health
+			cp.Health = &h
+		}
+		m.Peers = append(m.Peers, cp)
+	}
+	b.lk.Unlock()
+	sort.Slice(m.Peers, func(i, j int) bool { return m.Peers[i].URL < m.Peers[j].URL })
+	return m
+}
+
+// Exchange POSTs a health summary to the peer's beacon endpoint and returns the peer's summary.
+func Exchange(ctx context.Context, client *http.Client, peer string, self *Health) (*Health, error) {
+	body, err := json.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(peer, "/")+BeaconPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var out Health
+	if err := doJSON(client, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FetchMesh fetches the mesh status from a relay.
+func FetchMesh(ctx context.Context, client *http.Client, relay string) (*Mesh, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(relay, "/")+MeshPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Mesh
+	if err := doJSON(client, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxBodyBytes)).Decode(out)
+}
@@ -0,0 +1,74 @@
+package peering
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testServer(b **Beacon) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(BeaconPath, func(w http.ResponseWriter, r *http.Request) {
+		var h Health
+		if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, err := (*b).HandleBeacon(&h)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc(MeshPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode((*b).Mesh())
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestBeaconExchange(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var a, b *Beacon
+	srvA := testServer(&a)
+	defer srvA.Close()
+	srvB := testServer(&b)
+	defer srvB.Close()
+	hostA, _ := url.Parse(srvA.URL)
+	hostB, _ := url.Parse(srvB.URL)
+
+	a = NewBeacon(func() Health { return Health{Relay: hostA.Host, HeadSeq: 100} }, []string{srvB.URL}, 0)
+	b = NewBeacon(func() Health { return Health{Relay: hostB.Host, HeadSeq: 200} }, []string{srvA.URL + "/", "http://offline.invalid"}, 0)
+
+	// a single exchange updates both sides
+	a.ExchangeAll(ctx)
+	m := a.Mesh()
+	assert.Equal(int64(100), m.Self.HeadSeq)
+	if assert.Len(m.Peers, 1) && assert.NotNil(m.Peers[0].Health) {
+		assert.Equal(int64(200), m.Peers[0].Health.HeadSeq)
+		assert.Empty(m.Peers[0].Error)
+	}
+
+	m, err := FetchMesh(ctx, nil, srvB.URL)
+	assert.NoError(err)
+	if assert.Len(m.Peers, 2) {
+		assert.Equal(srvA.URL, m.Peers[0].URL)
+		if assert.NotNil(m.Peers[0].Health) {
+			assert.Equal(int64(100), m.Peers[0].Health.HeadSeq)
+		}
+		assert.Equal("http://offline.invalid", m.Peers[1].URL)
+		assert.Nil(m.Peers[1].Health)
+	}
+
+	// beacons from relays which aren't configured as peers are refused
+	_, err = Exchange(ctx, nil, srvA.URL, &Health{Relay: "rogue.example.com"})
+	assert.Error(err)
+	assert.Len(a.Mesh().Peers, 1)
+}
@@ -0,0 +1,309 @@
+package plcops
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+)
+
+// how long after an operation a higher-priority rotation key may still nullify it
+const RecoveryWindow = 72 * time.Hour
+
+// kinds of anomalous, but valid, histories
+const (
+	// the rotation keys changed several times in a short window
+	AnomalyRapidRotation = "rapid-rotation"
+	// a key was removed, then added back later
+	AnomalyResurrectedKey = "resurrected-key"
+	// operations were nullified by a higher-priority rotation key, ie the identity was recovered
+	AnomalyNullified = "nullified-operations"
+	// the identity has been deactivated
+	AnomalyTombstoned = "tombstoned"
+)
+
+var didEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Anomaly is a suspicious feature of an otherwise valid history.
+type Anomaly struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+	// createdAt of the operation the anomaly was noticed at
+	At string `json:"at,omitempty"`
+}
+
+type AuditOptions struct {
+	// rotation key changes within this window count towards AnomalyRapidRotation
+	RapidRotationWindow time.Duration
+	// number of rotation key changes within the window that is flagged
+	RapidRotationCount int
+}
+
+func DefaultAuditOptions() AuditOptions {
+	return AuditOptions{
+		RapidRotationWindow: 24 * time.Hour,
+		RapidRotationCount:  3,
+	}
+}
+
+// Audit is the outcome of replaying an identity's operation log.
+type Audit struct {
+	DID        string `json:"did"`
+	Operations int    `json:"operations"`
+	Nullified  int    `json:"nullified"`
+	// the log replays cleanly: every operation is correctly linked and signed by a key it was allowed to be signed by
+	Valid bool `json:"valid"`
+	// why the log doesn't replay
+	Errors    []string  `json:"errors,omitempty"`
+	Anomalies []Anomaly `json:"anomalies,omitempty"`
+}
+
+// Flagged returns true if the history is invalid or anomalous.
+func (a *Audit) Flagged() bool {
+	return !a.Valid || len(a.Anomalies) > 0
+}
+
+// DID returns the did:plc identifier a signed genesis operation creates.
+func (op *Operation) DID() (string, error) {
+	if op.Prev != nil {
+		return "", fmt.Errorf("only genesis operations determine the DID")
+	}
+	if op.Sig == "" {
+		return "", fmt.Errorf("operation is not signed")
+	}
+	b, err := data.MarshalCBOR(op.data(true))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "did:plc:" + strings.ToLower(didEncoding.EncodeToString(sum[:]))[:24], nil
+}
+
+// rotationKeys returns the keys which may sign the operation's successor, highest priority first
+func (op *Operation) rotationKeys() []string {
+	if op.Type == OpTypeCreate {
+		return []string{op.RecoveryKey, op.SigningKey}
+	}
+	return op.RotationKeys
+}
+
+// signer returns the index of the key (in keys) which signed the operation, or -1
+func (op *Operation) signer(keys []string) int {
+	for i, k := range keys {
+		if op.VerifySignature(k) == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+type replayed struct {
+	op        *Operation
+	createdAt time.Time
+	// index of the signing key in the previous operation's rotation keys
+	signer    int
+	nullified bool
+	// CIDs of later operations referencing this one, in log order
+	next []string
+}
+
+// VerifyLog replays an identity's audit log (oldest first, including nullified operations), checking the DID, the links between operations, and every signature against the rotation keys in force, including the priority rules for nullifying operations within the recovery window. Valid histories are also checked for anomalies.
+func VerifyLog(did string, entries []LogEntry, opts AuditOptions) *Audit {
+	a := &Audit{DID: did, Operations: len(entries)}
+	fail := func(i int, format string, args ...any) {
+		a.Errors = append(a.Errors, fmt.Sprintf("operation %d: ", i)+fmt.Sprintf(format, args...))
+	}
+	if len(entries) == 0 {
+		a.Errors = append(a.Errors, "empty operation log")
+		return a
+	}
+
+	ops := make(map[string]*replayed, len(entries))
+	var chain []*replayed
+	var head string
+	for i, e := range entries {
+		if e.Operation == nil {
+			fail(i, "missing operation")
+			continue
+		}
+		c, err := e.Operation.CID()
+		if err != nil {
+			fail(i, "%s", err)
+			continue
+		}
+		if c.String() != e.CID {
+			fail(i, "CID %s doesn't match the operation (%s)", e.CID, c)
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, e.CreatedAt)
+		if err != nil {
+			fail(i, "invalid createdAt: %q", e.CreatedAt)
+		}
+		r := &replayed{op: e.Operation, createdAt: createdAt, nullified: e.Nullified}
+		if e.Nullified {
+			a.Nullified++
+		}
+
+		if i == 0 {
+			if e.Operation.Prev != nil {
+				fail(i, "genesis operation has a prev")
+				continue
+			}
+			if r.signer = e.Operation.signer(e.Operation.rotationKeys()); r.signer < 0 {
+				fail(i, "genesis operation isn't signed by one of its own rotation keys")
+			}
+			if genesisDID, err := e.Operation.DID(); err != nil || genesisDID != did {
+				fail(i, "genesis operation creates %s, not %s", genesisDID, did)
+			}
+		} else {
+			if e.Operation.Prev == nil {
+				fail(i, "second genesis operation")
+				continue
+			}
+			prev, ok := ops[*e.Operation.Prev]
+			if !ok {
+				fail(i, "prev %s isn't an earlier operation", *e.Operation.Prev)
+				continue
+			}
+			if prev.op.Type == OpTypeTombstone {
+				fail(i, "follows a tombstone")
+			}
+			if r.signer = e.Operation.signer(prev.op.rotationKeys()); r.signer < 0 {
+				fail(i, "not signed by a rotation key of its prev")
+			}
+			switch {
+			case e.Nullified:
+			case len(prev.next) > 0:
+				// a fork: the operations which followed prev must have been nullified by this one, which requires a higher-priority key, within the recovery window
+				displaced := ops[prev.next[0]]
+				if r.signer < 0 || displaced.signer <= r.signer {
+					fail(i, "nullifies an operation signed by an equal or higher-priority key")
+				}
+				if r.createdAt.Sub(displaced.createdAt) > RecoveryWindow {
+					fail(i, "nullifies an operation older than the recovery window")
+				}
+			case *e.Operation.Prev != head:
+				fail(i, "doesn't follow the latest valid operation")
+			}
+			prev.next = append(prev.next, e.CID)
+		}
+		ops[e.CID] = r
+		if !e.Nullified {
+			head = e.CID
+			chain = append(chain, r)
+		}
+	}
+
+	a.Valid = len(a.Errors) == 0
+	if a.Valid {
+		a.Anomalies = anomalies(chain, a.Nullified, opts)
+	}
+	return a
+}
+
+// anomalies inspects the valid (non-nullified) chain of operations
+func anomalies(chain []*replayed, nullified int, opts AuditOptions) []Anomaly {
+	var out []Anomaly
+	at := func(r *replayed) string {
+		return r.createdAt.UTC().Format(time.RFC3339)
+	}
+
+	// rotation key changes in a sliding window
+	var changes []*replayed
+	flaggedRapid := false
+	for i := 1; i < len(chain) && !flaggedRapid; i++ {
+		if sameKeys(chain[i-1].op.rotationKeys(), chain[i].op.rotationKeys()) || chain[i].op.Type == OpTypeTombstone {
+			continue
+		}
+		changes = append(changes, chain[i])
+		for len(changes) > 0 && chain[i].createdAt.Sub(changes[0].createdAt) > opts.RapidRotationWindow {
+			changes = changes[1:]
+		}
+		if opts.RapidRotationCount > 0 && len(changes) >= opts.RapidRotationCount {
+			flaggedRapid = true
+			out = append(out, Anomaly{
+				Kind:   AnomalyRapidRotation,
+				Detail: fmt.Sprintf("rotation keys changed %d times within %s", len(changes), opts.RapidRotationWindow),
+				At:     at(chain[i]),
+			})
+		}
+	}
+
+	// keys which disappear, then come back
+	removed := make(map[string]bool)
+	var current []string
+	for i, r := range chain {
+		if r.op.Type == OpTypeTombstone {
+			continue
+		}
+		keys := opKeys(r.op)
+		if i > 0 {
+			for _, k := range keys {
+				if removed[k] && !slices.Contains(current, k) {
+					out = append(out, Anomaly{
+						Kind:   AnomalyResurrectedKey,
+						Detail: fmt.Sprintf("key %s was removed, then added back", k),
+						At:     at(r),
+					})
+					delete(removed, k)
+				}
+			}
+			for _, k := range current {
+				if !slices.Contains(keys, k) {
+					removed[k] = true
+				}
+			}
+		}
+		current = keys
+	}
+
+	if nullified > 0 {
+		out = append(out, Anomaly{
+			Kind:   AnomalyNullified,
+			Detail: fmt.Sprintf("%d operations were nullified by a higher-priority rotation key", nullified),
+		})
+	}
+	if last := chain[len(chain)-1]; last.op.Type == OpTypeTombstone {
+		out = append(out, Anomaly{
+			Kind:   AnomalyTombstoned,
+			Detail: "the identity has been tombstoned",
+			At:     at(last),
+		})
+	}
+	return out
+}
+
+// opKeys returns every key an operation grants authority to: rotation keys and the repo signing key
+func opKeys(op *Operation) []string {
+	keys := append([]string{}, op.rotationKeys()...)
+	if k := op.VerificationMethods[SigningKeyID]; k != "" && !slices.Contains(keys, k) {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, k := range a {
+		if !slices.Contains(b, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// Audit fetches and verifies an identity's full operation log.
+func (c *Client) Audit(ctx context.Context, did string, opts AuditOptions) (*Audit, error) {
+	entries, err := c.AuditLog(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyLog(did, entries, opts), nil
+}
@@ -0,0 +1,147 @@
+package plcops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// maximum number of rotation keys the PLC directory accepts
+const MaxRotationKeys = 5
+
+// ErrNoChange is returned when a change would leave the identity as it is.
+var ErrNoChange = errors.New("change leaves the identity unchanged")
+
+// Change is an update to an identity's PLC data. Zero fields are left unchanged.
+type Change struct {
+	// new PDS service endpoint, eg "https://pds.example.ca"
+	PDSEndpoint string
+	// new repo signing key
+	SigningKey crypto.PublicKey
+	Handle     syntax.Handle
+	// replaces the rotation keys, highest priority first
+	RotationKeys []crypto.PublicKey
+}
+
+// Preview is a prepared, unsigned change: exactly the operation which would be submitted.
+type Preview struct {
+	DID string `json:"did"`
+	// CID of the operation the change follows
+	Prev     string     `json:"prev"`
+	Current  *Operation `json:"current"`
+	Proposed *Operation `json:"proposed"`
+	// human-readable summary of what changes
+	Changes []string `json:"changes"`
+}
+
+// Prepare applies a change to the identity's latest operation.
+func Prepare(latest *LogEntry, ch Change) (*Preview, error) {
+	cur := latest.Operation
+	if cur == nil || cur.Type != OpTypeOperation {
+		return nil, fmt.Errorf("latest operation of %s is not a regular operation, and can't be updated from here", latest.DID)
+	}
+	next := cur.Clone()
+	next.Type = OpTypeOperation
+	prev := latest.CID
+	next.Prev = &prev
+	p := &Preview{
+		DID:      latest.DID,
+		Prev:     latest.CID,
+		Current:  cur,
+		Proposed: next,
+	}
+
+	if ch.PDSEndpoint != "" {
+		endpoint := strings.TrimSuffix(ch.PDSEndpoint, "/")
+		if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+			return nil, fmt.Errorf("PDS endpoint must be an HTTP(S) URL: %q", ch.PDSEndpoint)
+		}
+		if old := cur.Services[PDSServiceID]; old.Endpoint != endpoint {
+			next.Services[PDSServiceID] = Service{Type: PDSServiceType, Endpoint: endpoint}
+			p.Changes = append(p.Changes, fmt.Sprintf("PDS endpoint: %q -> %q", old.Endpoint, endpoint))
+		}
+	}
+	if ch.SigningKey != nil {
+		key := ch.SigningKey.DIDKey()
+		if old := cur.VerificationMethods[SigningKeyID]; old != key {
+			next.VerificationMethods[SigningKeyID] = key
+			p.Changes = append(p.Changes, fmt.Sprintf("signing key: %s -> %s", old, key))
+		}
+	}
+	if ch.Handle != "" {
+		aka := "at://" + ch.Handle.Normalize().String()
+		var old string
+		if len(cur.AlsoKnownAs) > 0 {
+			old = cur.AlsoKnownAs[0]
+		}
+		if old != aka {
+			// the handle is the first alsoKnownAs entry; any others are kept
+			next.AlsoKnownAs = append([]string{aka}, slices.DeleteFunc(next.AlsoKnownAs, func(s string) bool { return s == aka || s == old })...)
+			p.Changes = append(p.Changes, fmt.Sprintf("handle: %q -> %q", old, aka))
+		}
+	}
+	if ch.RotationKeys != nil {
+		if len(ch.RotationKeys) == 0 || len(ch.RotationKeys) > MaxRotationKeys {
+			return nil, fmt.Errorf("an identity must have between 1 and %d rotation keys", MaxRotationKeys)
+		}
+		keys := make([]string, len(ch.RotationKeys))
+		for i, k := range ch.RotationKeys {
+			keys[i] = k.DIDKey()
+		}
+		if !slices.Equal(keys, cur.RotationKeys) {
+			next.RotationKeys = keys
+			p.Changes = append(p.Changes, fmt.Sprintf("rotation keys: [%s] -> [%s]", strings.Join(cur.RotationKeys, ", "), strings.Join(keys, ", ")))
+		}
+	}
+
+	if len(p.Changes) == 0 {
+		return nil, ErrNoChange
+	}
+	return p, nil
+}
+
+// Sign signs the proposed operation with one of the identity's current rotation keys.
+func (p *Preview) Sign(key crypto.PrivateKey) (*Operation, error) {
+	pub, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(p.Current.RotationKeys, pub.DIDKey()) {
+		return nil, fmt.Errorf("key %s is not one of the rotation keys of %s", pub.DIDKey(), p.DID)
+	}
+	op := p.Proposed.Clone()
+	if err := op.Sign(key); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// Prepare fetches the identity's latest operation from the directory, and applies a change to it.
+func (c *Client) Prepare(ctx context.Context, did string, ch Change) (*Preview, error) {
+	latest, err := c.Latest(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return Prepare(latest, ch)
+}
+
+// Apply prepares, signs and (unless dryRun) submits a change. The preview and signed operation are returned either way.
+func (c *Client) Apply(ctx context.Context, did string, ch Change, key crypto.PrivateKey, dryRun bool) (*Preview, *Operation, error) {
+	p, err := c.Prepare(ctx, did, ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	op, err := p.Sign(key)
+	if err != nil {
+		return p, nil, err
+	}
+	if dryRun {
+		return p, op, nil
+	}
+	return p, op, c.Submit(ctx, did, op)
+}
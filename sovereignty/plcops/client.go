@@ -0,0 +1,138 @@
+package plcops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maximum size of an audit log response
+const maxAuditLogSize = 16 << 20
+
+// LogEntry is an operation in an identity's PLC audit log.
+type LogEntry struct {
+	DID       string     `json:"did"`
+	Operation *Operation `json:"operation"`
+	CID       string     `json:"cid"`
+	// operations may be nullified by a higher-priority rotation key within the recovery window
+	Nullified bool   `json:"nullified"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Client reads identities' audit logs from a PLC directory, and submits operations to it. Requests are rate-limited, so bulk changes don't trip the directory's own limits.
+type Client struct {
+	// method, hostname and port of the PLC directory, eg "https://plc.directory"
+	Host       string
+	HTTPClient *http.Client
+	// limits all requests to the directory; nil disables limiting
+	Limiter   *rate.Limiter
+	UserAgent string
+}
+
+// NewClient returns a client for the given directory, limited to perSecond requests per second.
+func NewClient(host string, perSecond float64) *Client {
+	return &Client{
+		Host:       strings.TrimSuffix(host, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Limiter:    rate.NewLimiter(rate.Limit(perSecond), 1),
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Host+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// AuditLog returns the identity's full operation log, oldest first, including nullified operations.
+func (c *Client) AuditLog(ctx context.Context, did string) ([]LogEntry, error) {
+	resp, err := c.do(ctx, "GET", "/"+did+"/log/audit", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching PLC audit log for %s: %w", did, readError(resp))
+	}
+	var entries []LogEntry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAuditLogSize)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("parsing PLC audit log for %s: %w", did, err)
+	}
+	return entries, nil
+}
+
+// Latest returns the identity's most recent operation which hasn't been nullified.
+func (c *Client) Latest(ctx context.Context, did string) (*LogEntry, error) {
+	entries, err := c.AuditLog(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Nullified {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("PLC audit log for %s has no operations", did)
+}
+
+// Submit sends a signed operation to the directory.
+func (c *Client) Submit(ctx context.Context, did string, op *Operation) error {
+	if op.Sig == "" {
+		return fmt.Errorf("operation is not signed")
+	}
+	body, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, "POST", "/"+did, body)
+	if err != nil {
+		submissionsCounter.WithLabelValues("error").Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		submissionsCounter.WithLabelValues("rejected").Inc()
+		return fmt.Errorf("submitting PLC operation for %s: %w", did, readError(resp))
+	}
+	submissionsCounter.WithLabelValues("ok").Inc()
+	return nil
+}
+
+func readError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(b, &msg) == nil && msg.Message != "" {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg.Message)
+	}
+	return fmt.Errorf("HTTP %d", resp.StatusCode)
+}
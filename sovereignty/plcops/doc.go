@@ -0,0 +1,4 @@
+// Signed did:plc operations for identities whose rotation keys the operator controls.
+//
+// Institutions hosting accounts, and the account migration tool, use this package to change an identity's PDS service endpoint, signing key, handle or rotation keys directly with the PLC directory, instead of asking the account's current PDS to sign the operation. A Change is first prepared against the identity's latest operation, giving a Preview of exactly what would be submitted (so it can be reviewed, or the whole run done dry); the preview is then signed with one of the identity's current rotation keys and submitted through a rate-limited Client.
+package plcops
@@ -0,0 +1,11 @@
+package plcops
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var submissionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "plcops_submissions_total",
+	Help: "PLC operations submitted to the directory, by result (ok, rejected or error)",
+}, []string{"result"})
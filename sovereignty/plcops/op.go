@@ -0,0 +1,167 @@
+package plcops
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	OpTypeOperation = "plc_operation"
+	OpTypeTombstone = "plc_tombstone"
+	// legacy genesis operation type, still found at the start of old identities' logs
+	OpTypeCreate = "create"
+
+	// service ID and type of an identity's PDS
+	PDSServiceID   = "atproto_pds"
+	PDSServiceType = "AtprotoPersonalDataServer"
+	// verification method ID of an identity's repo signing key
+	SigningKeyID = "atproto"
+)
+
+// Service is a service entry in a PLC operation.
+type Service struct {
+	Type     string `json:"type"`
+	Endpoint string `json:"endpoint"`
+}
+
+// Operation is a regular (or tombstone) did:plc operation.
+type Operation struct {
+	Type string `json:"type"`
+	// did:key rotation keys, highest priority first
+	RotationKeys []string `json:"rotationKeys"`
+	// did:key verification methods, by ID (eg, "atproto")
+	VerificationMethods map[string]string  `json:"verificationMethods"`
+	AlsoKnownAs         []string           `json:"alsoKnownAs"`
+	Services            map[string]Service `json:"services"`
+	// CID of the previous operation; nil for the genesis operation
+	Prev *string `json:"prev"`
+	// base64url signature, by one of the previous operation's rotation keys
+	Sig string `json:"sig,omitempty"`
+
+	// fields of legacy genesis ("create") operations, in place of the above
+	SigningKey  string `json:"signingKey,omitempty"`
+	RecoveryKey string `json:"recoveryKey,omitempty"`
+	Handle      string `json:"handle,omitempty"`
+	Service     string `json:"service,omitempty"`
+}
+
+// Clone returns a deep copy of the operation, without its signature.
+func (op *Operation) Clone() *Operation {
+	out := &Operation{
+		Type:                op.Type,
+		RotationKeys:        append([]string{}, op.RotationKeys...),
+		VerificationMethods: make(map[string]string, len(op.VerificationMethods)),
+		AlsoKnownAs:         append([]string{}, op.AlsoKnownAs...),
+		Services:            make(map[string]Service, len(op.Services)),
+	}
+	for k, v := range op.VerificationMethods {
+		out.VerificationMethods[k] = v
+	}
+	for k, v := range op.Services {
+		out.Services[k] = v
+	}
+	if op.Prev != nil {
+		prev := *op.Prev
+		out.Prev = &prev
+	}
+	return out
+}
+
+// data returns the operation in the generic form it is DAG-CBOR encoded from
+func (op *Operation) data(signed bool) map[string]any {
+	var prev any
+	if op.Prev != nil {
+		prev = *op.Prev
+	}
+	d := map[string]any{
+		"type": op.Type,
+		"prev": prev,
+	}
+	switch op.Type {
+	case OpTypeTombstone:
+	case OpTypeCreate:
+		d["signingKey"] = op.SigningKey
+		d["recoveryKey"] = op.RecoveryKey
+		d["handle"] = op.Handle
+		d["service"] = op.Service
+	default:
+		rotation := make([]any, len(op.RotationKeys))
+		for i, k := range op.RotationKeys {
+			rotation[i] = k
+		}
+		aka := make([]any, len(op.AlsoKnownAs))
+		for i, a := range op.AlsoKnownAs {
+			aka[i] = a
+		}
+		vms := make(map[string]any, len(op.VerificationMethods))
+		for k, v := range op.VerificationMethods {
+			vms[k] = v
+		}
+		svcs := make(map[string]any, len(op.Services))
+		for k, v := range op.Services {
+			svcs[k] = map[string]any{"type": v.Type, "endpoint": v.Endpoint}
+		}
+		d["rotationKeys"] = rotation
+		d["alsoKnownAs"] = aka
+		d["verificationMethods"] = vms
+		d["services"] = svcs
+	}
+	if signed {
+		d["sig"] = op.Sig
+	}
+	return d
+}
+
+// UnsignedBytes returns the DAG-CBOR encoding of the operation without its signature, which is what gets signed.
+func (op *Operation) UnsignedBytes() ([]byte, error) {
+	return data.MarshalCBOR(op.data(false))
+}
+
+// CID returns the CID of the signed operation, which the next operation references as its prev.
+func (op *Operation) CID() (cid.Cid, error) {
+	if op.Sig == "" {
+		return cid.Undef, fmt.Errorf("operation is not signed")
+	}
+	b, err := data.MarshalCBOR(op.data(true))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(b)
+}
+
+// Sign signs the operation with the given rotation key.
+func (op *Operation) Sign(key crypto.PrivateKey) error {
+	b, err := op.UnsignedBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := key.HashAndSign(b)
+	if err != nil {
+		return err
+	}
+	op.Sig = base64.RawURLEncoding.EncodeToString(sig)
+	return nil
+}
+
+// VerifySignature checks the operation's signature against a did:key public key.
+func (op *Operation) VerifySignature(didKey string) error {
+	pub, err := crypto.ParsePublicDIDKey(didKey)
+	if err != nil {
+		return fmt.Errorf("invalid rotation key %q: %w", didKey, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(op.Sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	b, err := op.UnsignedBytes()
+	if err != nil {
+		return err
+	}
+	return pub.HashAndVerify(b, sig)
+}
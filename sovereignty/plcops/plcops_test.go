@@ -0,0 +1,212 @@
+package plcops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	rotation, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotationPub, _ := rotation.PublicKey()
+	signing, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingPub, _ := signing.PublicKey()
+
+	did := "did:plc:abcdefghijklmnopqrstuvwx"
+	genesis := &Operation{
+		Type:                OpTypeOperation,
+		RotationKeys:        []string{rotationPub.DIDKey()},
+		VerificationMethods: map[string]string{SigningKeyID: rotationPub.DIDKey()},
+		AlsoKnownAs:         []string{"at://old.example.ca"},
+		Services:            map[string]Service{PDSServiceID: {Type: PDSServiceType, Endpoint: "https://old-pds.example.ca"}},
+	}
+	assert.NoError(genesis.Sign(rotation))
+	assert.NoError(genesis.VerifySignature(rotationPub.DIDKey()))
+	genesisCID, err := genesis.CID()
+	assert.NoError(err)
+
+	var submitted []*Operation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/"+did+"/log/audit":
+			json.NewEncoder(w).Encode([]LogEntry{{DID: did, Operation: genesis, CID: genesisCID.String()}})
+		case r.Method == "POST" && r.URL.Path == "/"+did:
+			var op Operation
+			if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+				t.Fatal(err)
+			}
+			submitted = append(submitted, &op)
+		default:
+			http.Error(w, `{"message":"not found"}`, 404)
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, 100)
+
+	ch := Change{PDSEndpoint: "https://pds.example.ca/", SigningKey: signingPub, Handle: "New.Example.CA"}
+
+	// dry runs sign, but don't submit
+	p, op, err := c.Apply(ctx, did, ch, rotation, true)
+	assert.NoError(err)
+	assert.Len(p.Changes, 3)
+	assert.Empty(submitted)
+	assert.Equal(genesisCID.String(), *op.Prev)
+	assert.Equal("https://pds.example.ca", op.Services[PDSServiceID].Endpoint)
+	assert.Equal(signingPub.DIDKey(), op.VerificationMethods[SigningKeyID])
+	assert.Equal([]string{"at://new.example.ca"}, op.AlsoKnownAs)
+	// the current operation is untouched
+	assert.Equal("https://old-pds.example.ca", p.Current.Services[PDSServiceID].Endpoint)
+
+	_, _, err = c.Apply(ctx, did, ch, rotation, false)
+	assert.NoError(err)
+	assert.Len(submitted, 1)
+	assert.NoError(submitted[0].VerifySignature(rotationPub.DIDKey()))
+
+	// only rotation keys may sign
+	_, _, err = c.Apply(ctx, did, ch, signing, true)
+	assert.Error(err)
+
+	_, err = c.Prepare(ctx, did, Change{Handle: "old.example.ca"})
+	assert.ErrorIs(err, ErrNoChange)
+
+	_, err = c.Prepare(ctx, "did:plc:unknown", ch)
+	assert.ErrorContains(err, "not found")
+}
+
+// auditLog builds signed log entries, each op signed by the matching key and linked to the entry at prevs[i] (-1 for genesis)
+func auditLog(t *testing.T, ops []*Operation, keys []crypto.PrivateKey, prevs []int, times []time.Time) []LogEntry {
+	var entries []LogEntry
+	for i, op := range ops {
+		if prevs[i] >= 0 {
+			prev := entries[prevs[i]].CID
+			op.Prev = &prev
+		}
+		if err := op.Sign(keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		c, err := op.CID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, LogEntry{Operation: op, CID: c.String(), CreatedAt: times[i].UTC().Format(time.RFC3339Nano)})
+	}
+	return entries
+}
+
+func TestVerifyLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var keys []crypto.PrivateKey
+	var pubs []string
+	for i := 0; i < 3; i++ {
+		k, err := crypto.GeneratePrivateKeyK256()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _ := k.PublicKey()
+		keys = append(keys, k)
+		pubs = append(pubs, pub.DIDKey())
+	}
+	op := func(rotation ...string) *Operation {
+		return &Operation{
+			Type:                OpTypeOperation,
+			RotationKeys:        rotation,
+			VerificationMethods: map[string]string{SigningKeyID: pubs[2]},
+			AlsoKnownAs:         []string{"at://user.example.ca"},
+			Services:            map[string]Service{PDSServiceID: {Type: PDSServiceType, Endpoint: "https://pds.example.ca"}},
+		}
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	opts := DefaultAuditOptions()
+
+	// a quiet history
+	entries := auditLog(t, []*Operation{op(pubs[0], pubs[1]), op(pubs[0], pubs[1])}, []crypto.PrivateKey{keys[0], keys[1]}, []int{-1, 0}, []time.Time{at(0), at(1)})
+	did, err := entries[0].Operation.DID()
+	assert.NoError(err)
+	a := VerifyLog(did, entries, opts)
+	assert.True(a.Valid, a.Errors)
+	assert.False(a.Flagged())
+
+	// wrong DID
+	a = VerifyLog("did:plc:abcdefghijklmnopqrstuvwx", entries, opts)
+	assert.False(a.Valid)
+
+	// tampered operation
+	entries[1].Operation.AlsoKnownAs = []string{"at://other.example.ca"}
+	a = VerifyLog(did, entries, opts)
+	assert.False(a.Valid)
+
+	// signed by a key that isn't a rotation key of prev
+	entries = auditLog(t, []*Operation{op(pubs[0]), op(pubs[0])}, []crypto.PrivateKey{keys[0], keys[1]}, []int{-1, 0}, []time.Time{at(0), at(1)})
+	did, _ = entries[0].Operation.DID()
+	a = VerifyLog(did, entries, opts)
+	assert.False(a.Valid)
+
+	// rapid rotations, bringing back a removed key
+	entries = auditLog(t,
+		[]*Operation{op(pubs[0]), op(pubs[1]), op(pubs[0], pubs[1]), op(pubs[1])},
+		[]crypto.PrivateKey{keys[0], keys[0], keys[1], keys[0]},
+		[]int{-1, 0, 1, 2},
+		[]time.Time{at(0), at(1), at(2), at(3)})
+	did, _ = entries[0].Operation.DID()
+	a = VerifyLog(did, entries, opts)
+	assert.True(a.Valid, a.Errors)
+	kinds := map[string]bool{}
+	for _, an := range a.Anomalies {
+		kinds[an.Kind] = true
+	}
+	assert.True(kinds[AnomalyRapidRotation])
+	assert.True(kinds[AnomalyResurrectedKey])
+
+	// recovery: a higher-priority key nullifies an operation within the window
+	entries = auditLog(t,
+		[]*Operation{op(pubs[0], pubs[1]), op(pubs[1]), op(pubs[0], pubs[1])},
+		[]crypto.PrivateKey{keys[0], keys[1], keys[0]},
+		[]int{-1, 0, 0},
+		[]time.Time{at(0), at(1), at(2)})
+	entries[1].Nullified = true
+	did, _ = entries[0].Operation.DID()
+	a = VerifyLog(did, entries, opts)
+	assert.True(a.Valid, a.Errors)
+	assert.Equal(1, a.Nullified)
+	assert.Equal(AnomalyNullified, a.Anomalies[0].Kind)
+
+	// ...but not by a lower-priority key
+	entries = auditLog(t,
+		[]*Operation{op(pubs[0], pubs[1]), op(pubs[0]), op(pubs[0], pubs[1])},
+		[]crypto.PrivateKey{keys[0], keys[0], keys[1]},
+		[]int{-1, 0, 0},
+		[]time.Time{at(0), at(1), at(2)})
+	entries[1].Nullified = true
+	did, _ = entries[0].Operation.DID()
+	a = VerifyLog(did, entries, opts)
+	assert.False(a.Valid)
+
+	// ...nor after the recovery window
+	entries = auditLog(t,
+		[]*Operation{op(pubs[0], pubs[1]), op(pubs[1]), op(pubs[0], pubs[1])},
+		[]crypto.PrivateKey{keys[0], keys[1], keys[0]},
+		[]int{-1, 0, 0},
+		[]time.Time{at(0), at(1), at(100)})
+	entries[1].Nullified = true
+	did, _ = entries[0].Operation.DID()
+	a = VerifyLog(did, entries, opts)
+	assert.False(a.Valid)
+}
@@ -0,0 +1,4 @@
+// Attribution of did:plc accounts to countries by the provenance of their identity.
+//
+// The identity's operation log is fetched from the PLC directory and replayed (see plcops.VerifyLog). The PDS named by the genesis operation, the one the account registered on, is geolocated as in pdsgeo, and its country is the account's origin. How far to trust it depends on what happened since: an account which moved to a PDS in another country, whose original rotation keys have all been replaced, or whose history is anomalous, is attributed with low confidence. Histories which don't replay, and tombstoned identities, have no origin. Results are cached, so a busy account isn't looked up in the directory more than once per cache lifetime.
+package plcorigin
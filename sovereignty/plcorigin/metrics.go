@@ -0,0 +1,23 @@
+package plcorigin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var auditLogDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "plcorigin_audit_log_duration_seconds",
+	Help:    "Latency of fetching identities' operation logs from the PLC directory",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+})
+
+var resolutionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "plcorigin_resolution_duration_seconds",
+	Help:    "Latency of attributing accounts to countries by their PLC history, including geolocation, by result (ok, unknown or error); cached answers aren't counted",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+}, []string{"result"})
+
+var cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "plcorigin_cache_lookups_total",
+	Help: "Lookups of PLC origin answers in the cache, by result (hit or miss)",
+}, []string{"result"})
@@ -0,0 +1,244 @@
+package plcorigin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Source recorded on classifications attributed by PLC origin
+const Source = "plc-origin"
+
+// AuditLogger fetches identities' operation logs; *plcops.Client is one.
+type AuditLogger interface {
+	AuditLog(ctx context.Context, did string) ([]plcops.LogEntry, error)
+}
+
+// HostLocator attributes a PDS hostname to a country; *pdsgeo.Resolver is one.
+type HostLocator interface {
+	LocateHost(ctx context.Context, host string) (*pdsgeo.Result, error)
+}
+
+// Origin is the provenance of an identity, and the country it is attributed to.
+type Origin struct {
+	DID string `json:"did"`
+	// hostname of the PDS named by the genesis operation
+	RegisteredPDS string `json:"registeredPDS"`
+	// pdsgeo.SourceGeo or pdsgeo.SourceTLD, by how the registering PDS was located
+	RegisteredSource string `json:"registeredSource"`
+	// hostname of the PDS named by the latest operation
+	CurrentPDS string `json:"currentPDS"`
+	// country of the current PDS, if the account has moved and it could be located
+	CurrentCountry string `json:"currentCountry,omitempty"`
+	// times the identity's PDS changed host
+	Migrations int `json:"migrations"`
+	// times the identity's rotation keys changed
+	RotationChanges int `json:"rotationChanges"`
+	// none of the genesis operation's rotation keys remain
+	RotationReplaced bool             `json:"rotationReplaced"`
+	Anomalies        []plcops.Anomaly `json:"anomalies,omitempty"`
+
+	// the registering PDS's country
+	Country    string                 `json:"country"`
+	Confidence sovereignty.Confidence `json:"confidence"`
+}
+
+type Options struct {
+	// accounts whose answers are cached
+	CacheSize int
+	// how long an answer, or the lack of one, is cached; 0 disables caching
+	CacheTTL time.Duration
+	Audit    plcops.AuditOptions
+	// time source for cache expiry; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		CacheSize: 100_000,
+		CacheTTL:  24 * time.Hour,
+		Audit:     plcops.DefaultAuditOptions(),
+	}
+}
+
+type cacheEntry struct {
+	origin *Origin
+	// the ErrCountryUnknown answer, if there was no origin
+	err error
+	at  time.Time
+}
+
+// Resolver attributes did:plc accounts to the country of the PDS they registered on. It is safe for concurrent use.
+type Resolver struct {
+	log   AuditLogger
+	hosts HostLocator
+	opts  Options
+	clock clock.Clock
+	cache *lru.Cache[string, cacheEntry]
+}
+
+var _ sovereignty.SourceResolver = (*Resolver)(nil)
+
+func NewResolver(log AuditLogger, hosts HostLocator, opts Options) *Resolver {
+	r := &Resolver{
+		log:   log,
+		hosts: hosts,
+		opts:  opts,
+		clock: clock.OrSystem(opts.Clock),
+	}
+	if opts.CacheTTL > 0 {
+		r.cache, _ = lru.New[string, cacheEntry](max(opts.CacheSize, 1))
+	}
+	return r
+}
+
+// Resolve returns the account's origin, from the cache if it is fresh. Accounts which can't be attributed (not did:plc, an invalid or tombstoned history, or a registering PDS which can't be located) return an error wrapping sovereignty.ErrCountryUnknown.
+func (r *Resolver) Resolve(ctx context.Context, did string) (*Origin, error) {
+	if !strings.HasPrefix(did, "did:plc:") {
+		return nil, fmt.Errorf("%w: %s is not a did:plc", sovereignty.ErrCountryUnknown, did)
+	}
+	if r.cache != nil {
+		if e, ok := r.cache.Get(did); ok && r.clock.Since(e.at) < r.opts.CacheTTL {
+			cacheLookups.WithLabelValues("hit").Inc()
+			return e.origin, e.err
+		}
+		cacheLookups.WithLabelValues("miss").Inc()
+	}
+
+	start := time.Now()
+	o, err := r.resolve(ctx, did)
+	result := "ok"
+	switch {
+	case errors.Is(err, sovereignty.ErrCountryUnknown):
+		result = "unknown"
+	case err != nil:
+		result = "error"
+	}
+	resolutionDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	// transient failures aren't cached
+	if r.cache != nil && result != "error" {
+		r.cache.Add(did, cacheEntry{origin: o, err: err, at: r.clock.Now()})
+	}
+	return o, err
+}
+
+func (r *Resolver) resolve(ctx context.Context, did string) (*Origin, error) {
+	start := time.Now()
+	entries, err := r.log.AuditLog(ctx, did)
+	auditLogDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	a := plcops.VerifyLog(did, entries, r.opts.Audit)
+	if !a.Valid {
+		return nil, fmt.Errorf("%w: the PLC history of %s doesn't replay", sovereignty.ErrCountryUnknown, did)
+	}
+	var chain []*plcops.Operation
+	for _, e := range entries {
+		if !e.Nullified {
+			chain = append(chain, e.Operation)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: every operation of %s was nullified", sovereignty.ErrCountryUnknown, did)
+	}
+	genesis, latest := chain[0], chain[len(chain)-1]
+	if latest.Type == plcops.OpTypeTombstone {
+		return nil, fmt.Errorf("%w: %s is tombstoned", sovereignty.ErrCountryUnknown, did)
+	}
+
+	o := &Origin{
+		DID:           did,
+		RegisteredPDS: pdsHost(genesis),
+		CurrentPDS:    pdsHost(latest),
+		Anomalies:     a.Anomalies,
+	}
+	if o.RegisteredPDS == "" {
+		return nil, fmt.Errorf("%w: the genesis operation of %s names no PDS", sovereignty.ErrCountryUnknown, did)
+	}
+	for i := 1; i < len(chain); i++ {
+		if h := pdsHost(chain[i]); h != "" && h != pdsHost(chain[i-1]) {
+			o.Migrations++
+		}
+		if !slices.Equal(rotationKeys(chain[i-1]), rotationKeys(chain[i])) {
+			o.RotationChanges++
+		}
+	}
+	o.RotationReplaced = !slices.ContainsFunc(rotationKeys(genesis), func(k string) bool {
+		return slices.Contains(rotationKeys(latest), k)
+	})
+
+	loc, err := r.hosts.LocateHost(ctx, o.RegisteredPDS)
+	if err != nil {
+		if errors.Is(err, pdsgeo.ErrNoCountry) {
+			return nil, fmt.Errorf("%w: %w", sovereignty.ErrCountryUnknown, err)
+		}
+		return nil, err
+	}
+	o.Country = loc.Country
+	o.RegisteredSource = loc.Source
+
+	o.Confidence = sovereignty.ConfidenceMedium
+	if loc.Source == pdsgeo.SourceTLD || o.RotationReplaced || len(o.Anomalies) > 0 {
+		o.Confidence = sovereignty.ConfidenceLow
+	}
+	if o.CurrentPDS != "" && o.CurrentPDS != o.RegisteredPDS {
+		// the origin only says where the account is now if it stayed in the same country
+		if cur, err := r.hosts.LocateHost(ctx, o.CurrentPDS); err == nil {
+			o.CurrentCountry = cur.Country
+		}
+		if o.CurrentCountry != o.Country {
+			o.Confidence = sovereignty.ConfidenceLow
+		}
+	}
+	return o, nil
+}
+
+// ResolveCountry implements sovereignty.CountryResolver.
+func (r *Resolver) ResolveCountry(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+	o, err := r.Resolve(ctx, did)
+	if err != nil {
+		return "", sovereignty.ConfidenceNone, err
+	}
+	return o.Country, o.Confidence, nil
+}
+
+// ResolveCountrySource implements sovereignty.SourceResolver, reporting Source as the source
+func (r *Resolver) ResolveCountrySource(ctx context.Context, did string) (*sovereignty.Resolution, error) {
+	o, err := r.Resolve(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return &sovereignty.Resolution{DID: did, Country: o.Country, Confidence: o.Confidence, Source: Source}, nil
+}
+
+// pdsHost returns the hostname of the PDS an operation names, or "" if it names none
+func pdsHost(op *plcops.Operation) string {
+	endpoint := op.Service
+	if op.Type != plcops.OpTypeCreate {
+		endpoint = op.Services[plcops.PDSServiceID].Endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func rotationKeys(op *plcops.Operation) []string {
+	if op.Type == plcops.OpTypeCreate {
+		return []string{op.RecoveryKey, op.SigningKey}
+	}
+	return op.RotationKeys
+}
@@ -0,0 +1,170 @@
+package plcorigin
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/pdsgeo"
+	"github.com/bluesky-social/indigo/sovereignty/plcops"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogs struct {
+	logs  map[string][]plcops.LogEntry
+	calls int
+	fail  bool
+}
+
+func (tl *testLogs) AuditLog(ctx context.Context, did string) ([]plcops.LogEntry, error) {
+	tl.calls++
+	if tl.fail {
+		return nil, fmt.Errorf("directory unavailable")
+	}
+	return tl.logs[did], nil
+}
+
+// history builds a signed log: a genesis operation on the first PDS with the first rotation key, then one operation per further step
+type step struct {
+	pds      string
+	rotation int
+	tomb     bool
+}
+
+func history(t *testing.T, keys []crypto.PrivateKey, steps ...step) (string, []plcops.LogEntry) {
+	var entries []plcops.LogEntry
+	var did string
+	signer := keys[steps[0].rotation]
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, s := range steps {
+		pub, _ := keys[s.rotation].PublicKey()
+		op := &plcops.Operation{
+			Type:                plcops.OpTypeOperation,
+			RotationKeys:        []string{pub.DIDKey()},
+			VerificationMethods: map[string]string{plcops.SigningKeyID: pub.DIDKey()},
+			AlsoKnownAs:         []string{"at://someone.example.ca"},
+			Services:            map[string]plcops.Service{plcops.PDSServiceID: {Type: plcops.PDSServiceType, Endpoint: "https://" + s.pds}},
+		}
+		if s.tomb {
+			op = &plcops.Operation{Type: plcops.OpTypeTombstone}
+		}
+		if i > 0 {
+			prev := entries[i-1].CID
+			op.Prev = &prev
+		}
+		if err := op.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		c, err := op.CID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if did, err = op.DID(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries = append(entries, plcops.LogEntry{DID: did, Operation: op, CID: c.String(), CreatedAt: at.Add(time.Duration(i) * 30 * 24 * time.Hour).Format(time.RFC3339Nano)})
+		signer = keys[s.rotation]
+	}
+	return did, entries
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var keys []crypto.PrivateKey
+	for i := 0; i < 2; i++ {
+		k, err := crypto.GeneratePrivateKeyK256()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+
+	ranges, err := pdsgeo.NewRangeTable(map[string]string{"198.51.100.0/24": "CA", "203.0.113.0/24": "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := map[string]string{
+		"pds.example.ca":    "198.51.100.1",
+		"pds2.example.ca":   "198.51.100.2",
+		"pds.example.com":   "203.0.113.1",
+		"pds.example.ninja": "192.0.2.1",
+	}
+	hosts := &pdsgeo.Resolver{Geo: ranges, LookupIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr(addrs[host])}, nil
+	}}
+
+	logs := &testLogs{logs: map[string][]plcops.LogEntry{}}
+	add := func(steps ...step) string {
+		did, entries := history(t, keys, steps...)
+		logs.logs[did] = entries
+		return did
+	}
+	stayed := add(step{pds: "pds.example.ca"}, step{pds: "pds2.example.ca"})
+	moved := add(step{pds: "pds.example.ca"}, step{pds: "pds.example.com"})
+	rotated := add(step{pds: "pds.example.ca"}, step{pds: "pds.example.ca", rotation: 1})
+	tombstoned := add(step{pds: "pds.example.ca"}, step{tomb: true})
+	unlocated := add(step{pds: "pds.example.ninja"})
+	broken := add(step{pds: "pds.example.ca"})
+	logs.logs[broken][0].CID = logs.logs[stayed][0].CID
+
+	clk := clock.NewMock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOptions()
+	opts.Clock = clk
+	r := NewResolver(logs, hosts, opts)
+
+	o, err := r.Resolve(ctx, stayed)
+	assert.NoError(err)
+	assert.Equal("pds.example.ca", o.RegisteredPDS)
+	assert.Equal("pds2.example.ca", o.CurrentPDS)
+	assert.Equal(1, o.Migrations)
+	assert.Equal("CA", o.CurrentCountry)
+	assert.Equal("CA", o.Country)
+	assert.Equal(sovereignty.ConfidenceMedium, o.Confidence)
+
+	res, err := r.ResolveCountrySource(ctx, moved)
+	assert.NoError(err)
+	assert.Equal(&sovereignty.Resolution{DID: moved, Country: "CA", Confidence: sovereignty.ConfidenceLow, Source: Source}, res)
+
+	o, err = r.Resolve(ctx, rotated)
+	assert.NoError(err)
+	assert.True(o.RotationReplaced)
+	assert.Equal(1, o.RotationChanges)
+	assert.Equal(sovereignty.ConfidenceLow, o.Confidence)
+
+	for _, did := range []string{tombstoned, unlocated, broken, "did:web:example.ca"} {
+		_, err = r.Resolve(ctx, did)
+		assert.ErrorIs(err, sovereignty.ErrCountryUnknown, did)
+	}
+
+	// answers, and the lack of them, are cached until they expire
+	calls := logs.calls
+	_, err = r.Resolve(ctx, stayed)
+	assert.NoError(err)
+	_, err = r.Resolve(ctx, tombstoned)
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.Equal(calls, logs.calls)
+	clk.Advance(opts.CacheTTL)
+	_, err = r.Resolve(ctx, stayed)
+	assert.NoError(err)
+	assert.Equal(calls+1, logs.calls)
+
+	// failures to reach the directory aren't
+	logs.fail = true
+	clk.Advance(opts.CacheTTL)
+	for i := 0; i < 2; i++ {
+		_, err = r.Resolve(ctx, stayed)
+		assert.Error(err)
+		assert.NotErrorIs(err, sovereignty.ErrCountryUnknown)
+	}
+	assert.Equal(calls+3, logs.calls)
+}
@@ -0,0 +1,4 @@
+// Signed sovereignty policy documents.
+//
+// A policy authority, identified by its public key, issues the relay's sovereign stream policy (carried countries, outbound transformation rules and related switches) as a JWS over a JSON document. The relay verifies the signature and the document before applying it, refuses documents which don't advance the version or were issued before the last applied one, and keeps the most recently applied documents for audit. A document may be rolled out gradually with a Ramp, covering a growing share of accounts chosen by DID hash.
+package policy
@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	_ "github.com/bluesky-social/indigo/atproto/auth"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrWrongIssuer is returned when a document is validly signed, but claims an issuer other than the policy authority.
+var ErrWrongIssuer = errors.New("policy document not issued by the policy authority")
+
+// ErrNotNewer is returned for documents which don't supersede the last applied one: they don't advance its version, or were issued before it. Presenting a previously issued token again is refused this way.
+var ErrNotNewer = errors.New("policy document does not supersede the last applied one")
+
+// ErrCarryAndExclude is returned for documents which both name the countries the stream carries and those it excludes.
+var ErrCarryAndExclude = errors.New("the sovereign stream either carries listed countries or excludes them, not both")
+
+// Document is the part of the relay's sovereignty configuration which a policy authority controls.
+type Document struct {
+	// must increase with each document issued; relays refuse documents which don't advance the version
+	Version int64 `json:"version"`
+	// countries whose accounts are carried on the sovereign stream
+	StreamCountries []string `json:"streamCountries"`
+	// ISO 3166-2 subdivisions (eg, "CA-QC") whose accounts are carried on the sovereign stream, for sub-national streams; accounts of a carried country are carried whatever their subdivision
+	StreamSubdivisions []string `json:"streamSubdivisions,omitempty"`
+	// countries whose accounts are left out of the sovereign stream, which carries all other accounts, classified or not; can't be combined with StreamCountries or StreamSubdivisions
+	ExcludeCountries []string `json:"excludeCountries,omitempty"`
+	// outbound transformation rules for the sovereign stream
+	TransformRules []transform.Rule `json:"transformRules,omitempty"`
+	// annotate posts in Indigenous languages on the sovereign stream
+	AnnotateIndigenousLangs bool `json:"annotateIndigenousLangs,omitempty"`
+	// only verified organizations may be added as priority accounts
+	PriorityRequiresVerifiedOrg bool `json:"priorityRequiresVerifiedOrg,omitempty"`
+
+	// when the authority signed the document, from the token's iat claim; set by Verify
+	IssuedAt time.Time `json:"-"`
+}
+
+// Validate checks the document is well-formed, normalizing country codes in place.
+func (d *Document) Validate() error {
+	if d.Version <= 0 {
+		return fmt.Errorf("policy document version must be positive")
+	}
+	for i, raw := range d.StreamCountries {
+		c, err := sovereignty.NormalizeCountry(raw)
+		if err != nil {
+			return err
+		}
+		d.StreamCountries[i] = c
+	}
+	for i, raw := range d.StreamSubdivisions {
+		r, err := sovereignty.NormalizeRegion(raw)
+		if err != nil {
+			return err
+		}
+		d.StreamSubdivisions[i] = r
+	}
+	for i, raw := range d.ExcludeCountries {
+		c, err := sovereignty.NormalizeCountry(raw)
+		if err != nil {
+			return err
+		}
+		d.ExcludeCountries[i] = c
+	}
+	if len(d.ExcludeCountries) > 0 && (len(d.StreamCountries) > 0 || len(d.StreamSubdivisions) > 0) {
+		return ErrCarryAndExclude
+	}
+	if err := transform.ValidateRules(d.TransformRules); err != nil {
+		return fmt.Errorf("policy document transformation rules: %w", err)
+	}
+	return nil
+}
+
+// FilterHash identifies the parts of the document which decide what consumers of the sovereign stream receive: carried (or excluded) countries and subdivisions, transformation rules and annotation. Documents which differ only in version or in other switches hash the same.
+func (d *Document) FilterHash() uint64 {
+	countries := slices.Clone(d.StreamCountries)
+	slices.Sort(countries)
+	subdivisions := slices.Clone(d.StreamSubdivisions)
+	slices.Sort(subdivisions)
+	excluded := slices.Clone(d.ExcludeCountries)
+	slices.Sort(excluded)
+	b, _ := json.Marshal(struct {
+		Countries    []string         `json:"c"`
+		Rules        []transform.Rule `json:"r"`
+		Annotate     bool             `json:"a"`
+		Subdivisions []string         `json:"s,omitempty"`
+		Excluded     []string         `json:"x,omitempty"`
+	}{countries, d.TransformRules, d.AnnotateIndigenousLangs, subdivisions, excluded})
+	sum := sha256.Sum256(b)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+type policyClaims struct {
+	jwt.RegisteredClaims
+	Policy Document `json:"policy"`
+}
+
+// Sign validates the document and returns it as a compact JWS, issued by the did:key of the given private key.
+func Sign(doc Document, priv crypto.PrivateKey) (string, error) {
+	if err := doc.Validate(); err != nil {
+		return "", err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	var alg string
+	switch priv.(type) {
+	case *crypto.PrivateKeyP256:
+		alg = "ES256"
+	case *crypto.PrivateKeyK256:
+		alg = "ES256K"
+	default:
+		return "", fmt.Errorf("unknown signing key type: %T", priv)
+	}
+	claims := policyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   pub.DIDKey(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Policy: doc,
+	}
+	return jwt.NewWithClaims(jwt.GetSigningMethod(alg), claims).SignedString(priv)
+}
+
+// Verify checks that the token is signed by the policy authority, and returns the validated document. If last, the last applied document, is given, the token must also supersede it: a higher version, issued no earlier. Documents signed within the same second share an issue time, so the version orders them.
+func Verify(token string, authority crypto.PublicKey, last *Document) (*Document, error) {
+	var claims policyClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return authority, nil
+	}, jwt.WithValidMethods([]string{"ES256", "ES256K"}), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	if claims.Issuer != authority.DIDKey() {
+		return nil, ErrWrongIssuer
+	}
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("invalid policy document: missing iat claim")
+	}
+	doc := claims.Policy
+	doc.IssuedAt = claims.IssuedAt.Time
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	if last != nil && (doc.Version <= last.Version || doc.IssuedAt.Before(last.IssuedAt)) {
+		return nil, ErrNotNewer
+	}
+	return &doc, nil
+}
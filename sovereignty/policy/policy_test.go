@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	priv, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := other.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := Document{
+		Version:            3,
+		StreamCountries:    []string{"ca", "FR"},
+		StreamSubdivisions: []string{"ca-nb"},
+		TransformRules: []transform.Rule{
+			{Name: "strip-text", Collection: "app.bsky.feed.post", Path: "text", Action: transform.ActionRemove},
+		},
+		AnnotateIndigenousLangs: true,
+	}
+	token, err := Sign(doc, priv)
+	assert.NoError(err)
+
+	out, err := Verify(token, pub, nil)
+	assert.NoError(err)
+	assert.Equal(int64(3), out.Version)
+	assert.Equal([]string{"CA", "FR"}, out.StreamCountries)
+	assert.Equal([]string{"CA-NB"}, out.StreamSubdivisions)
+	assert.Len(out.TransformRules, 1)
+	assert.True(out.AnnotateIndigenousLangs)
+
+	// signed by some other key
+	_, err = Verify(token, otherPub, nil)
+	assert.Error(err)
+	otherToken, err := Sign(doc, other)
+	assert.NoError(err)
+	_, err = Verify(otherToken, pub, nil)
+	assert.Error(err)
+
+	// tampered payload
+	parts := strings.Split(token, ".")
+	parts[1] = parts[1][:len(parts[1])-2] + "AA"
+	_, err = Verify(strings.Join(parts, "."), pub, nil)
+	assert.Error(err)
+
+	// invalid documents are neither signed nor accepted
+	for _, bad := range []Document{
+		{Version: 0, StreamCountries: []string{"CA"}},
+		{Version: 1, StreamCountries: []string{"Canada"}},
+		{Version: 1, StreamSubdivisions: []string{"QC"}},
+		{Version: 1, StreamCountries: []string{"CA"}, ExcludeCountries: []string{"US"}},
+		{Version: 1, ExcludeCountries: []string{"United States"}},
+		{Version: 1, TransformRules: []transform.Rule{{Name: "x", Collection: "app.bsky.feed.post", Action: "shout"}}},
+	} {
+		_, err := Sign(bad, priv)
+		assert.Error(err)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	priv, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signAt := func(doc Document, iat time.Time) string {
+		claims := policyClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: pub.DIDKey(), IssuedAt: jwt.NewNumericDate(iat)},
+			Policy:           doc,
+		}
+		token, err := jwt.NewWithClaims(jwt.GetSigningMethod("ES256K"), claims).SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	now := time.Now()
+	old := signAt(Document{Version: 1, StreamCountries: []string{"CA"}}, now.Add(-48*time.Hour))
+	oldDoc, err := Verify(old, pub, nil)
+	assert.NoError(err)
+	assert.Equal(now.Add(-48*time.Hour).Unix(), oldDoc.IssuedAt.Unix())
+
+	current, err := Verify(signAt(Document{Version: 2, StreamCountries: []string{"FR"}}, now.Add(-time.Hour)), pub, oldDoc)
+	assert.NoError(err)
+
+	// the earlier token, presented again
+	_, err = Verify(old, pub, current)
+	assert.ErrorIs(err, ErrNotNewer)
+	// the current one again
+	_, err = Verify(signAt(Document{Version: 2, StreamCountries: []string{"FR"}}, now.Add(-time.Hour)), pub, current)
+	assert.ErrorIs(err, ErrNotNewer)
+	// an old token with a higher version, issued before the current document
+	_, err = Verify(signAt(Document{Version: 5, StreamCountries: []string{"CA"}}, now.Add(-2*time.Hour)), pub, current)
+	assert.ErrorIs(err, ErrNotNewer)
+	// documents signed in the same second are ordered by version
+	_, err = Verify(signAt(Document{Version: 3, StreamCountries: []string{"CA"}}, now.Add(-time.Hour)), pub, current)
+	assert.NoError(err)
+
+	// tokens without an issue time can't be ordered
+	noIat, err := jwt.NewWithClaims(jwt.GetSigningMethod("ES256K"), policyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: pub.DIDKey()},
+		Policy:           Document{Version: 4, StreamCountries: []string{"CA"}},
+	}).SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(noIat, pub, nil)
+	assert.Error(err)
+}
+
+func TestFilterHash(t *testing.T) {
+	assert := assert.New(t)
+
+	base := Document{Version: 1, StreamCountries: []string{"CA", "FR"}}
+	h := base.FilterHash()
+
+	same := Document{Version: 2, StreamCountries: []string{"FR", "CA"}, PriorityRequiresVerifiedOrg: true}
+	assert.Equal(h, same.FilterHash())
+
+	for _, changed := range []Document{
+		{Version: 1, StreamCountries: []string{"CA"}},
+		{Version: 1, StreamCountries: []string{"CA", "FR"}, StreamSubdivisions: []string{"CA-QC"}},
+		{Version: 1, StreamCountries: []string{"CA", "FR"}, AnnotateIndigenousLangs: true},
+		{Version: 1, ExcludeCountries: []string{"CA", "FR"}},
+		{Version: 1, StreamCountries: []string{"CA", "FR"}, TransformRules: []transform.Rule{
+			{Name: "strip-text", Collection: "app.bsky.feed.post", Path: "text", Action: transform.ActionRemove},
+		}},
+	} {
+		assert.NotEqual(h, changed.FilterHash())
+	}
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Ramp rolls a policy out gradually, to a growing share of accounts. Which accounts are covered is decided by a hash of the DID, so an account covered at one percentage stays covered as the ramp increases.
+type Ramp struct {
+	// percentage of accounts covered when the policy is applied
+	Start float64 `json:"start"`
+	// percentage points added every Interval, until all accounts are covered
+	Step float64 `json:"step"`
+	// Go duration string, eg "1h"
+	Interval string `json:"interval"`
+}
+
+// Validate checks the ramp parameters.
+func (r *Ramp) Validate() error {
+	if r.Start < 0 || r.Start > 100 {
+		return fmt.Errorf("ramp start must be between 0 and 100")
+	}
+	if r.Step <= 0 {
+		return fmt.Errorf("ramp step must be positive")
+	}
+	d, err := time.ParseDuration(r.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid ramp interval: %w", err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("ramp interval must be positive")
+	}
+	return nil
+}
+
+// Percent returns the percentage of accounts covered at the given time, for a ramp which began at started. The ramp must be valid.
+func (r *Ramp) Percent(started, now time.Time) float64 {
+	d, _ := time.ParseDuration(r.Interval)
+	steps := 0.0
+	if now.After(started) && d > 0 {
+		steps = math.Floor(float64(now.Sub(started)) / float64(d))
+	}
+	return math.Min(100, r.Start+steps*r.Step)
+}
+
+// Bucket returns the account's stable position in [0, 100), derived from a hash of the DID.
+func Bucket(did string) float64 {
+	h := sha256.Sum256([]byte(did))
+	return float64(binary.BigEndian.Uint64(h[:8])) / math.Exp2(64) * 100
+}
+
+// Covers returns true if the account is within the given percentage of a ramp.
+func Covers(did string, percent float64) bool {
+	return percent >= 100 || Bucket(did) < percent
+}
@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRamp(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Ramp{Start: 10, Step: 25, Interval: "1h"}
+	assert.NoError(r.Validate())
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(10.0, r.Percent(start, start.Add(-time.Minute)))
+	assert.Equal(10.0, r.Percent(start, start.Add(59*time.Minute)))
+	assert.Equal(35.0, r.Percent(start, start.Add(time.Hour)))
+	assert.Equal(85.0, r.Percent(start, start.Add(3*time.Hour)))
+	assert.Equal(100.0, r.Percent(start, start.Add(4*time.Hour)))
+
+	for _, bad := range []Ramp{
+		{Start: -1, Step: 1, Interval: "1h"},
+		{Start: 101, Step: 1, Interval: "1h"},
+		{Start: 5, Step: 0, Interval: "1h"},
+		{Start: 5, Step: 1, Interval: "soon"},
+		{Start: 5, Step: 1, Interval: "-1h"},
+	} {
+		assert.Error(bad.Validate())
+	}
+
+	// coverage is stable as the percentage grows, and roughly proportional
+	var at25, at50 int
+	for i := 0; i < 10000; i++ {
+		did := fmt.Sprintf("did:plc:%08d", i)
+		assert.Equal(Bucket(did), Bucket(did))
+		if Covers(did, 25) {
+			at25++
+			assert.True(Covers(did, 50))
+		}
+		if Covers(did, 50) {
+			at50++
+		}
+		assert.True(Covers(did, 100))
+		assert.False(Covers(did, 0))
+	}
+	assert.InDelta(2500, at25, 200)
+	assert.InDelta(5000, at50, 200)
+}
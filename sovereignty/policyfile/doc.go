@@ -0,0 +1,4 @@
+// Loading of the JSON policy files which configure the relay's sovereignty modules.
+//
+// Each module's policy has defaults which a file only partly overrides, and rules a loaded policy must satisfy; Load reads a file over a module's defaults and validates the result, so modules don't each carry their own copy of that.
+package policyfile
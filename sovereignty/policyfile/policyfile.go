@@ -0,0 +1,28 @@
+package policyfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Policy is a module policy which can check itself once loaded.
+type Policy interface {
+	Validate() error
+}
+
+// Load reads the JSON policy in fname over defaults, so fields missing from the file keep their default values, and validates the result. kind names the policy in parse errors, eg "residency".
+func Load[P Policy](fname, kind string, defaults P) (P, error) {
+	var zero P
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return zero, err
+	}
+	if err := json.Unmarshal(b, defaults); err != nil {
+		return zero, fmt.Errorf("parsing %s policy: %w", kind, err)
+	}
+	if err := defaults.Validate(); err != nil {
+		return zero, err
+	}
+	return defaults, nil
+}
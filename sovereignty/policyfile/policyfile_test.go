@@ -0,0 +1,44 @@
+package policyfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPolicy struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+func (p *testPolicy) Validate() error {
+	if p.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	write := func(body string) string {
+		fname := filepath.Join(t.TempDir(), "policy.json")
+		if err := os.WriteFile(fname, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+
+	p, err := Load(write(`{"name": "custom"}`), "test", &testPolicy{Name: "default", Limit: 3})
+	assert.NoError(err)
+	assert.Equal(&testPolicy{Name: "custom", Limit: 3}, p)
+
+	_, err = Load(write(`{"limit": 0}`), "test", &testPolicy{Limit: 3})
+	assert.Error(err)
+	_, err = Load(write(`{"limit": "many"}`), "test", &testPolicy{})
+	assert.ErrorContains(err, "parsing test policy")
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"), "test", &testPolicy{})
+	assert.ErrorIs(err, os.ErrNotExist)
+}
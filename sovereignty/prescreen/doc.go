@@ -0,0 +1,4 @@
+// Moderation pre-screening of watchlisted accounts' events, before the relay emits them.
+//
+// For accounts on the watchlist (eg, under a court-ordered monitoring arrangement), a Queue holds each event back before it is persisted or broadcast, until a moderator approves it, which emits it, or rejects it, which drops it. Events nobody decides on within Timeout are emitted or dropped, as OnTimeout says. An account's events are emitted in the order they arrived: an approved event waits for the account's earlier events to be decided, and while any of its events are pending, the account's new events are held behind them, even once it is off the watchlist. At most MaxPending events are held; beyond that, the oldest is handled as on timeout to make room.
+package prescreen
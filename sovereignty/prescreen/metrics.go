@@ -0,0 +1,27 @@
+package prescreen
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var heldCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "prescreen_held_total",
+	Help: "Events of watchlisted accounts held for moderation",
+})
+
+var decisionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "prescreen_decisions_total",
+	Help: "Held events decided, by decision (approved, rejected, timed_out or overflow) and action (emit or drop)",
+}, []string{"decision", "action"})
+
+var pendingGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "prescreen_pending",
+	Help: "Events held for moderation, awaiting a decision or their account's earlier events",
+})
+
+var waitHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "prescreen_wait_seconds",
+	Help:    "How long held events waited for a decision",
+	Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+})
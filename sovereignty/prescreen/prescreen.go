@@ -0,0 +1,292 @@
+package prescreen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/clock"
+)
+
+// Actions taken on a held event.
+const (
+	ActionEmit = "emit"
+	ActionDrop = "drop"
+)
+
+// Decisions on a held event.
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+	DecisionTimedOut = "timed_out"
+	// handled as on timeout, to make room for newer events
+	DecisionOverflow = "overflow"
+)
+
+var ErrNotPending = errors.New("no such pending event")
+
+type Options struct {
+	// how long an event waits for a decision
+	Timeout time.Duration
+	// what is done with events nobody decides on in time: ActionEmit or ActionDrop
+	OnTimeout string
+	// most events held at once
+	MaxPending int
+	// time source for deadlines; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:    15 * time.Minute,
+		OnTimeout:  ActionEmit,
+		MaxPending: 10_000,
+	}
+}
+
+// ParseAction parses a timeout action (emit or drop).
+func ParseAction(s string) (string, error) {
+	switch s {
+	case ActionEmit, ActionDrop:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid pre-screen timeout action %q: must be %s or %s", s, ActionEmit, ActionDrop)
+	}
+}
+
+// Item is a held event, for moderators.
+type Item struct {
+	ID  uint64 `json:"id"`
+	DID string `json:"did"`
+	// the event's type: commit, sync, identity or account
+	Kind string `json:"kind"`
+	// the commit's revision, and the paths of the records it creates, updates or deletes
+	Rev string   `json:"rev,omitempty"`
+	Ops []string `json:"ops,omitempty"`
+	// why the account is watched
+	Reason   string    `json:"reason,omitempty"`
+	HeldAt   time.Time `json:"heldAt"`
+	Deadline time.Time `json:"deadline"`
+	// set once the event is decided, while it waits for the account's earlier events
+	Action string `json:"action,omitempty"`
+
+	evt *events.XRPCStreamEvent
+}
+
+// Queue holds watchlisted accounts' events for moderation. It is safe for concurrent use.
+type Queue struct {
+	opts  Options
+	clock clock.Clock
+	// emits an event which was held; called in each account's order, with no other event of the queue being emitted at the same time
+	emit func(*events.XRPCStreamEvent)
+
+	lk sync.Mutex
+	// reason each account is watched, by DID
+	watched map[string]string
+	// each account's held events, oldest first
+	accounts map[string][]*Item
+	byID     map[uint64]*Item
+	nextID   uint64
+}
+
+func NewQueue(opts Options, emit func(*events.XRPCStreamEvent)) *Queue {
+	return &Queue{
+		opts:     opts,
+		clock:    clock.OrSystem(opts.Clock),
+		emit:     emit,
+		watched:  make(map[string]string),
+		accounts: make(map[string][]*Item),
+		byID:     make(map[uint64]*Item),
+	}
+}
+
+// SetWatchlist replaces the watchlist: a reason by DID.
+func (q *Queue) SetWatchlist(watched map[string]string) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	q.watched = make(map[string]string, len(watched))
+	for did, reason := range watched {
+		q.watched[did] = reason
+	}
+}
+
+// Watch adds an account to the watchlist, holding its events from the next one.
+func (q *Queue) Watch(did, reason string) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	q.watched[did] = reason
+}
+
+// Unwatch removes an account from the watchlist. Its held events still wait for decisions, and its new events are held behind them until they are decided.
+func (q *Queue) Unwatch(did string) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	delete(q.watched, did)
+}
+
+// Hold reports whether an event is held. Held events are emitted or dropped later; the caller does nothing more with them.
+func (q *Queue) Hold(evt *events.XRPCStreamEvent) bool {
+	item := newItem(evt)
+	if item.DID == "" {
+		return false
+	}
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	reason, watched := q.watched[item.DID]
+	if !watched && len(q.accounts[item.DID]) == 0 {
+		return false
+	}
+	if len(q.byID) >= max(q.opts.MaxPending, 1) {
+		q.evictOldest()
+	}
+	q.nextID++
+	item.ID = q.nextID
+	item.Reason = reason
+	item.HeldAt = q.clock.Now().UTC()
+	item.Deadline = item.HeldAt.Add(q.opts.Timeout)
+	q.accounts[item.DID] = append(q.accounts[item.DID], item)
+	q.byID[item.ID] = item
+	heldCounter.Inc()
+	pendingGauge.Set(float64(len(q.byID)))
+	return true
+}
+
+func newItem(evt *events.XRPCStreamEvent) *Item {
+	item := &Item{evt: evt}
+	switch {
+	case evt.RepoCommit != nil:
+		item.DID, item.Kind, item.Rev = evt.RepoCommit.Repo, "commit", evt.RepoCommit.Rev
+		for _, op := range evt.RepoCommit.Ops {
+			item.Ops = append(item.Ops, op.Path)
+		}
+	case evt.RepoSync != nil:
+		item.DID, item.Kind, item.Rev = evt.RepoSync.Did, "sync", evt.RepoSync.Rev
+	case evt.RepoIdentity != nil:
+		item.DID, item.Kind = evt.RepoIdentity.Did, "identity"
+	case evt.RepoAccount != nil:
+		item.DID, item.Kind = evt.RepoAccount.Did, "account"
+	}
+	return item
+}
+
+// evictOldest handles the oldest undecided event as on timeout. q.lk must be held
+func (q *Queue) evictOldest() {
+	var oldest *Item
+	for _, item := range q.byID {
+		if item.Action == "" && (oldest == nil || item.ID < oldest.ID) {
+			oldest = item
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	q.decide(oldest, DecisionOverflow, q.opts.OnTimeout)
+}
+
+// decide records the action on an event, and emits or drops those of its account's events which are ready. q.lk must be held
+func (q *Queue) decide(item *Item, decision, action string) {
+	item.Action = action
+	decisionsCounter.WithLabelValues(decision, action).Inc()
+	waitHistogram.Observe(q.clock.Since(item.HeldAt).Seconds())
+
+	held := q.accounts[item.DID]
+	for len(held) > 0 && held[0].Action != "" {
+		next := held[0]
+		held = held[1:]
+		delete(q.byID, next.ID)
+		if next.Action == ActionEmit {
+			q.emit(next.evt)
+		}
+	}
+	if len(held) == 0 {
+		delete(q.accounts, item.DID)
+	} else {
+		q.accounts[item.DID] = held
+	}
+	pendingGauge.Set(float64(len(q.byID)))
+}
+
+// Decide approves (emitting) or rejects (dropping) a held event. It returns ErrNotPending for events already decided, or not held.
+func (q *Queue) Decide(id uint64, approve bool) (*Item, error) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	item, ok := q.byID[id]
+	if !ok || item.Action != "" {
+		return nil, ErrNotPending
+	}
+	if approve {
+		q.decide(item, DecisionApproved, ActionEmit)
+	} else {
+		q.decide(item, DecisionRejected, ActionDrop)
+	}
+	out := *item
+	out.evt = nil
+	return &out, nil
+}
+
+// Pending returns up to limit held events, oldest first, including those decided but waiting for their account's earlier events.
+func (q *Queue) Pending(limit int) []Item {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	out := make([]Item, 0, min(limit, len(q.byID)))
+	for _, item := range q.byID {
+		c := *item
+		c.evt = nil
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Expire handles the events whose deadline has passed as OnTimeout says, returning how many there were.
+func (q *Queue) Expire() int {
+	now := q.clock.Now()
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	var expired []*Item
+	for _, item := range q.byID {
+		if item.Action == "" && !now.Before(item.Deadline) {
+			expired = append(expired, item)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+	for _, item := range expired {
+		q.decide(item, DecisionTimedOut, q.opts.OnTimeout)
+	}
+	return len(expired)
+}
+
+// DropAccount drops all of an account's held events (eg, when it is taken down), returning how many there were.
+func (q *Queue) DropAccount(did string) int {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	held := q.accounts[did]
+	for _, item := range held {
+		delete(q.byID, item.ID)
+	}
+	delete(q.accounts, did)
+	pendingGauge.Set(float64(len(q.byID)))
+	return len(held)
+}
+
+// Run expires events as their deadlines pass, until the context is cancelled.
+func (q *Queue) Run(ctx context.Context) {
+	t := q.clock.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			q.Expire()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package prescreen
+
+import (
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	clk := clock.NewMock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOptions()
+	opts.Timeout = time.Minute
+	opts.OnTimeout = ActionDrop
+	opts.MaxPending = 4
+	opts.Clock = clk
+	var emitted []string
+	q := NewQueue(opts, func(evt *events.XRPCStreamEvent) {
+		emitted = append(emitted, evt.RepoCommit.Rev)
+	})
+	commit := func(did, rev string) *events.XRPCStreamEvent {
+		return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo: did,
+			Rev:  rev,
+			Ops:  []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/" + rev}},
+		}}
+	}
+
+	q.Watch("did:plc:watched", "case 123")
+	assert.False(q.Hold(commit("did:plc:other", "a")))
+	assert.False(q.Hold(&events.XRPCStreamEvent{Error: &events.ErrorFrame{Error: "oops"}}))
+	assert.True(q.Hold(commit("did:plc:watched", "1")))
+	assert.True(q.Hold(commit("did:plc:watched", "2")))
+	pending := q.Pending(10)
+	if assert.Len(pending, 2) {
+		assert.Equal("case 123", pending[0].Reason)
+		assert.Equal("1", pending[0].Rev)
+		assert.Equal([]string{"app.bsky.feed.post/1"}, pending[0].Ops)
+		assert.Equal(clk.Now().Add(time.Minute), pending[0].Deadline)
+	}
+
+	// emitted in order: the second waits for the first
+	_, err := q.Decide(pending[1].ID, true)
+	assert.NoError(err)
+	assert.Empty(emitted)
+	_, err = q.Decide(pending[1].ID, true)
+	assert.ErrorIs(err, ErrNotPending)
+
+	// off the watchlist, new events queue behind the held ones
+	q.Unwatch("did:plc:watched")
+	assert.True(q.Hold(commit("did:plc:watched", "3")))
+	_, err = q.Decide(pending[0].ID, false)
+	assert.NoError(err)
+	assert.Equal([]string{"2"}, emitted)
+	pending = q.Pending(10)
+	if assert.Len(pending, 1) {
+		assert.Equal("3", pending[0].Rev)
+	}
+
+	// undecided events time out
+	clk.Advance(time.Minute)
+	assert.Equal(1, q.Expire())
+	assert.Equal([]string{"2"}, emitted)
+	assert.Empty(q.Pending(10))
+	assert.False(q.Hold(commit("did:plc:watched", "4")))
+
+	// beyond MaxPending, the oldest is handled as on timeout
+	q.Watch("did:plc:watched", "")
+	for _, rev := range []string{"5", "6", "7", "8", "9"} {
+		assert.True(q.Hold(commit("did:plc:watched", rev)))
+	}
+	pending = q.Pending(10)
+	if assert.Len(pending, 4) {
+		assert.Equal("6", pending[0].Rev)
+	}
+	assert.Equal(4, q.DropAccount("did:plc:watched"))
+	assert.Empty(q.Pending(10))
+}
@@ -0,0 +1,4 @@
+// Registry of priority accounts, such as official emergency management and election authorities.
+//
+// Events from priority accounts are exempt from upstream rate limits, always pass sovereign stream filtering, and are additionally carried on a dedicated low-volume priority stream. Changes to the registry are made through the relay admin API and recorded in an audit log.
+package priority
@@ -0,0 +1,102 @@
+package priority
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	CategoryEmergency = "emergency"
+	CategoryElection  = "election"
+)
+
+// ValidCategory returns an error unless c is one of the known categories.
+func ValidCategory(c string) error {
+	switch c {
+	case CategoryEmergency, CategoryElection:
+		return nil
+	default:
+		return fmt.Errorf("unknown priority category: %q", c)
+	}
+}
+
+// Account is a single designated priority account.
+type Account struct {
+	DID      string `json:"did"`
+	Category string `json:"category"`
+	// free-form description, eg the name of the authority
+	Note    string    `json:"note,omitempty"`
+	AddedBy string    `json:"addedBy,omitempty"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Registry is the in-process set of priority accounts, safe for concurrent use.
+type Registry struct {
+	lk       sync.RWMutex
+	accounts map[string]Account
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		accounts: make(map[string]Account),
+	}
+}
+
+// Get returns the priority account record for the DID, if there is one.
+func (r *Registry) Get(did string) (Account, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	a, ok := r.accounts[did]
+	return a, ok
+}
+
+// IsPriority returns true if the DID is a priority account.
+func (r *Registry) IsPriority(did string) bool {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+	_, ok := r.accounts[did]
+	return ok
+}
+
+// Set inserts or replaces the record for a.DID.
+func (r *Registry) Set(a Account) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.accounts[a.DID] = a
+}
+
+// Delete removes the DID, returning true if it was a priority account.
+func (r *Registry) Delete(did string) bool {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	_, ok := r.accounts[did]
+	delete(r.accounts, did)
+	return ok
+}
+
+// Replace swaps the full contents of the registry.
+func (r *Registry) Replace(accounts []Account) {
+	m := make(map[string]Account, len(accounts))
+	for _, a := range accounts {
+		m[a.DID] = a
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.accounts = m
+}
+
+// List returns all priority accounts, sorted by DID.
+func (r *Registry) List() []Account {
+	r.lk.RLock()
+	out := make([]Account, 0, len(r.accounts))
+	for _, a := range r.accounts {
+		out = append(out, a)
+	}
+	r.lk.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].DID < out[j].DID })
+	return out
+}
@@ -0,0 +1,36 @@
+package priority
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidCategory(CategoryElection))
+	assert.Error(ValidCategory("celebrity"))
+
+	r := NewRegistry()
+	assert.False(r.IsPriority("did:plc:a"))
+
+	r.Set(Account{DID: "did:plc:b", Category: CategoryElection, Note: "Elections Canada"})
+	r.Set(Account{DID: "did:plc:a", Category: CategoryEmergency})
+	assert.True(r.IsPriority("did:plc:a"))
+	a, ok := r.Get("did:plc:b")
+	assert.True(ok)
+	assert.Equal("Elections Canada", a.Note)
+
+	list := r.List()
+	assert.Len(list, 2)
+	assert.Equal("did:plc:a", list[0].DID)
+
+	assert.True(r.Delete("did:plc:a"))
+	assert.False(r.Delete("did:plc:a"))
+	assert.False(r.IsPriority("did:plc:a"))
+
+	r.Replace([]Account{{DID: "did:plc:c", Category: CategoryEmergency}})
+	assert.False(r.IsPriority("did:plc:b"))
+	assert.True(r.IsPriority("did:plc:c"))
+}
@@ -0,0 +1,4 @@
+// Transformation profiles, shaping the sovereign stream for each subscriber.
+//
+// Different consumers of the same stream need different versions of it: a research consumer may want only which accounts committed and when, while a government AppView wants records as the policy's transformation rules leave them, with every annotation the relay can make. A Profile names such a shape: its redaction level (from records as committed to no record content at all), its annotation level, and the classification confidence below which carried accounts' commits are sent as hash-only stubs. Profiles are assigned to subscriber tokens, and apply to the connections made with them.
+package profile
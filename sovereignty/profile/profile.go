@@ -0,0 +1,105 @@
+package profile
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// Redaction levels: how much record content subscribers see.
+const (
+	// records as committed by the account, without the policy's transformation rules or the operator's extensions
+	RedactionNone = "none"
+	// records as the policy's transformation rules and the operator's extensions leave them
+	RedactionStandard = "standard"
+	// no record content: commits carry the commit, tree nodes and op CIDs, without record blocks
+	RedactionRecords = "records"
+)
+
+// Annotation levels: which relay-derived information frames carry.
+const (
+	// no annotations, and no region, even if the subscriber asks for it
+	AnnotationsNone = "none"
+	// the annotations the policy and feature flags call for, and the region if the subscriber asks for it
+	AnnotationsStandard = "standard"
+	// every annotation the relay can make, whatever the policy and feature flags, and the account's current region unless the subscriber asks for another basis
+	AnnotationsFull = "full"
+)
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Profile is an admin-defined shape of the sovereign stream.
+type Profile struct {
+	// lower case letters, digits and hyphens, eg "research"
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// one of the Redaction levels; empty means RedactionStandard
+	Redaction string `json:"redaction,omitempty"`
+	// one of the Annotations levels; empty means AnnotationsStandard
+	Annotations string `json:"annotations,omitempty"`
+	// commits of carried accounts classified with less confidence than this are sent as hash-only stubs; ConfidenceNone sends them in full
+	HashOnlyBelow sovereignty.Confidence `json:"hashOnlyBelow"`
+	// whether commits the stream doesn't carry are sent as hash-only stubs, overriding the relay's setting; nil keeps it
+	HashOnlyExcluded *bool `json:"hashOnlyExcluded,omitempty"`
+	// subscribers with the profile are in the public class, which gets the stream with the relay's public delay, if it has one
+	Public bool `json:"public,omitempty"`
+}
+
+// Validate checks the profile's name and levels.
+func (p *Profile) Validate() error {
+	if !nameRegex.MatchString(p.Name) {
+		return fmt.Errorf("invalid profile name %q: must be lower case letters, digits and hyphens, up to 64 characters", p.Name)
+	}
+	switch p.Redaction {
+	case "", RedactionNone, RedactionStandard, RedactionRecords:
+	default:
+		return fmt.Errorf("redaction must be %s, %s or %s", RedactionNone, RedactionStandard, RedactionRecords)
+	}
+	switch p.Annotations {
+	case "", AnnotationsNone, AnnotationsStandard, AnnotationsFull:
+	default:
+		return fmt.Errorf("annotations must be %s, %s or %s", AnnotationsNone, AnnotationsStandard, AnnotationsFull)
+	}
+	return nil
+}
+
+// Transforms reports whether the policy's transformation rules and the operator's extensions apply. A nil profile is the relay's default shape, as are the methods below.
+func (p *Profile) Transforms() bool {
+	return p == nil || p.Redaction != RedactionNone
+}
+
+// WithholdsRecords reports whether record blocks are removed from every commit.
+func (p *Profile) WithholdsRecords() bool {
+	return p != nil && p.Redaction == RedactionRecords
+}
+
+// IsPublic reports whether subscribers get the stream with the relay's public delay. Consumers without a subscriber token (the relay's default shape) always do.
+func (p *Profile) IsPublic() bool {
+	return p == nil || p.Public
+}
+
+// AnnotationLevel returns the profile's annotation level.
+func (p *Profile) AnnotationLevel() string {
+	if p == nil || p.Annotations == "" {
+		return AnnotationsStandard
+	}
+	return p.Annotations
+}
+
+// Apply adjusts the relay's filter decision for an event for the profile: carried commits of accounts classified with less confidence than HashOnlyBelow become stubs, and HashOnlyExcluded overrides hashOnlyExcluded, the relay's setting for commits it doesn't carry.
+func (p *Profile) Apply(r sovereignty.FilterResult, commit, hashOnlyExcluded bool) sovereignty.FilterResult {
+	if p != nil && p.HashOnlyExcluded != nil {
+		hashOnlyExcluded = *p.HashOnlyExcluded
+	}
+	r.HashOnly = false
+	switch {
+	case !commit:
+	case r.Include && p != nil && r.Confidence < p.HashOnlyBelow:
+		r.Include = false
+		r.HashOnly = true
+	case !r.Include && hashOnlyExcluded:
+		r.HashOnly = true
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Profile{Name: "research"}).Validate())
+	assert.NoError((&Profile{Name: "gov-appview", Redaction: RedactionNone, Annotations: AnnotationsFull}).Validate())
+	assert.Error((&Profile{Name: ""}).Validate())
+	assert.Error((&Profile{Name: "Research"}).Validate())
+	assert.Error((&Profile{Name: "research", Redaction: "partial"}).Validate())
+	assert.Error((&Profile{Name: "research", Annotations: "verbose"}).Validate())
+}
+
+func TestApply(t *testing.T) {
+	assert := assert.New(t)
+	yes, no := true, false
+
+	carried := sovereignty.FilterResult{Include: true, Confidence: sovereignty.ConfidenceLow, Reason: sovereignty.FilterReasonCountry}
+	excluded := sovereignty.FilterResult{Confidence: sovereignty.ConfidenceHigh, Reason: sovereignty.FilterReasonOtherCountry}
+	stub := func(r sovereignty.FilterResult) sovereignty.FilterResult {
+		r.Include = false
+		r.HashOnly = true
+		return r
+	}
+
+	for _, tc := range []struct {
+		name     string
+		prof     *Profile
+		in       sovereignty.FilterResult
+		commit   bool
+		relay    bool
+		expected sovereignty.FilterResult
+	}{
+		{name: "default carried", in: carried, commit: true, expected: carried},
+		{name: "default excluded", in: excluded, commit: true, expected: excluded},
+		{name: "default excluded stubbed", in: excluded, commit: true, relay: true, expected: stub(excluded)},
+		{name: "default excluded non-commit", in: excluded, relay: true, expected: excluded},
+		{name: "below threshold", prof: &Profile{HashOnlyBelow: sovereignty.ConfidenceMedium}, in: carried, commit: true, expected: stub(carried)},
+		{name: "below threshold non-commit", prof: &Profile{HashOnlyBelow: sovereignty.ConfidenceMedium}, in: carried, expected: carried},
+		{name: "at threshold", prof: &Profile{HashOnlyBelow: sovereignty.ConfidenceLow}, in: carried, commit: true, expected: carried},
+		{name: "profile stubs excluded", prof: &Profile{HashOnlyExcluded: &yes}, in: excluded, commit: true, expected: stub(excluded)},
+		{name: "profile leaves out excluded", prof: &Profile{HashOnlyExcluded: &no}, in: excluded, commit: true, relay: true, expected: excluded},
+		{name: "profile keeps relay setting", prof: &Profile{}, in: excluded, commit: true, relay: true, expected: stub(excluded)},
+	} {
+		assert.Equal(tc.expected, tc.prof.Apply(tc.in, tc.commit, tc.relay), tc.name)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	var def *Profile
+	assert.True(def.Transforms())
+	assert.False(def.WithholdsRecords())
+	assert.True(def.IsPublic())
+	assert.Equal(AnnotationsStandard, def.AnnotationLevel())
+
+	assert.True((&Profile{}).Transforms())
+	assert.Equal(AnnotationsStandard, (&Profile{}).AnnotationLevel())
+	assert.False((&Profile{Redaction: RedactionNone}).Transforms())
+	assert.True((&Profile{Redaction: RedactionRecords}).Transforms())
+	assert.True((&Profile{Redaction: RedactionRecords}).WithholdsRecords())
+	assert.Equal(AnnotationsNone, (&Profile{Annotations: AnnotationsNone}).AnnotationLevel())
+	assert.False((&Profile{}).IsPublic())
+	assert.True((&Profile{Public: true}).IsPublic())
+}
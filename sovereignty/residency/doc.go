@@ -0,0 +1,4 @@
+// User-declared residency.
+//
+// Account holders can declare the country they live in with an app.gndr.sovereign.residencyDeclaration record (record key "self") in their repo. The relay reads declarations from the commits it processes and, as its Policy allows, classifies the account by them: trusting them outright, only where the country resolver agrees, or only recording them for operators. Declarations never replace classifications made by operators or imported, nor resolver answers more confident than the policy gives declarations.
+package residency
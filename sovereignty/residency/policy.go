@@ -0,0 +1,152 @@
+package residency
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policyfile"
+)
+
+const (
+	// declarations classify the account outright
+	ModeTrust = "trust"
+	// declarations classify the account only if the country resolver places it in the same country
+	ModeCorroborate = "corroborate"
+	// declarations are recorded for operators, never applied
+	ModeRecord = "record"
+)
+
+// Results of evaluating a declaration
+const (
+	// the account was classified by its declaration
+	ResultApplied = "applied"
+	// recorded only, as the policy's mode requires
+	ResultRecorded = "recorded"
+	// the declared country isn't one the policy accepts declarations for
+	ResultCountryNotAllowed = "country_not_allowed"
+	// the account's classification was made by an operator, imported, or is more confident than a declaration
+	ResultOverridden = "overridden"
+	// the country resolver places the account in another country
+	ResultContradicted = "contradicted"
+	// the country resolver has no answer to corroborate the declaration with
+	ResultUnconfirmed = "unconfirmed"
+	// the account changed its declared country too recently
+	ResultTooSoon = "too_soon"
+	// the account deleted its declaration
+	ResultWithdrawn = "withdrawn"
+)
+
+// Policy is the per-deployment configuration of how declarations are verified.
+type Policy struct {
+	// trust, corroborate or record
+	Mode string `json:"mode"`
+	// confidence given to classifications applied from declarations. Resolver classifications more confident than this are never replaced
+	Confidence sovereignty.Confidence `json:"confidence"`
+	// ISO 3166-1 alpha-2 codes declarations are accepted for; empty accepts any
+	Countries []string `json:"countries,omitempty"`
+	// minimum time between an account's applied declarations of different countries; zero doesn't limit them
+	MinInterval Duration `json:"minInterval,omitempty"`
+}
+
+// Duration is a time.Duration written in JSON as a Go duration string (eg, "720h").
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// DefaultPolicy returns a policy applying declarations the country resolver corroborates, at low confidence, at most once a month.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Mode:        ModeCorroborate,
+		Confidence:  sovereignty.ConfidenceLow,
+		MinInterval: Duration(30 * 24 * time.Hour),
+	}
+}
+
+// LoadPolicy reads a residency policy file, validating it and normalizing its countries. A mode or confidence it leaves out keeps its DefaultPolicy value.
+func LoadPolicy(fname string) (*Policy, error) {
+	return policyfile.Load(fname, "residency", DefaultPolicy())
+}
+
+// Validate checks the policy, normalizing its countries.
+func (p *Policy) Validate() error {
+	switch p.Mode {
+	case ModeTrust, ModeCorroborate, ModeRecord:
+	default:
+		return fmt.Errorf("residency policy: mode must be trust, corroborate or record, not %q", p.Mode)
+	}
+	if p.Confidence == sovereignty.ConfidenceNone {
+		return fmt.Errorf("residency policy: must specify a confidence")
+	}
+	if p.MinInterval < 0 {
+		return fmt.Errorf("residency policy: invalid minimum interval %s", time.Duration(p.MinInterval))
+	}
+	for i, c := range p.Countries {
+		n, err := sovereignty.NormalizeCountry(c)
+		if err != nil {
+			return fmt.Errorf("residency policy: %w", err)
+		}
+		p.Countries[i] = n
+	}
+	return nil
+}
+
+// Allows returns true if the policy accepts declarations of the country.
+func (p *Policy) Allows(country string) bool {
+	if len(p.Countries) == 0 {
+		return true
+	}
+	for _, c := range p.Countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides what a declaration does to the account's classification. current is the account's classification, or nil; resolved is the country resolver's answer, consulted in corroborate mode (nil if it had none); now is when the declaration is evaluated. Returns the result, and for ResultApplied the classification to apply. Withdrawals are ResultWithdrawn; it is up to the caller to remove a classification the declaration made.
+func (p *Policy) Evaluate(d *Declaration, current *sovereignty.Classification, resolved *sovereignty.Resolution, now time.Time) (string, *sovereignty.Classification) {
+	if d.Withdrawn {
+		return ResultWithdrawn, nil
+	}
+	if !p.Allows(d.Country) {
+		return ResultCountryNotAllowed, nil
+	}
+	if p.Mode == ModeRecord {
+		return ResultRecorded, nil
+	}
+	if current != nil && current.Source != SourceDeclaration && current.Assurance() > p.Confidence {
+		return ResultOverridden, nil
+	}
+	if p.Mode == ModeCorroborate {
+		if resolved == nil {
+			return ResultUnconfirmed, nil
+		}
+		if resolved.Country != d.Country {
+			return ResultContradicted, nil
+		}
+	}
+	if current != nil && current.Source == SourceDeclaration && current.Country != d.Country &&
+		p.MinInterval > 0 && now.Sub(current.UpdatedAt) < time.Duration(p.MinInterval) {
+		return ResultTooSoon, nil
+	}
+	return ResultApplied, &sovereignty.Classification{
+		DID:         d.DID,
+		Country:     d.Country,
+		Subdivision: d.Subdivision,
+		Source:      SourceDeclaration,
+		UpdatedAt:   now.UTC(),
+		Confidence:  p.Confidence,
+	}
+}
@@ -0,0 +1,124 @@
+package residency
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/lexicon"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+const (
+	// NSID of declaration records
+	Collection = "app.gndr.sovereign.residencyDeclaration"
+	// record key of an account's declaration
+	RecordKey = "self"
+	// source recorded for classifications applied from declarations
+	SourceDeclaration = "declaration"
+)
+
+//go:embed lexicons
+var lexicons embed.FS
+
+var catalog = func() *lexicon.BaseCatalog {
+	cat := lexicon.NewBaseCatalog()
+	if err := cat.LoadEmbedFS(lexicons); err != nil {
+		panic(fmt.Sprintf("loading residency lexicon: %v", err))
+	}
+	return &cat
+}()
+
+// Declaration is an account's declared residency, or its withdrawal.
+type Declaration struct {
+	DID     string `json:"did"`
+	Country string `json:"country,omitempty"`
+	// unprefixed (eg, "QC"); empty if not declared
+	Subdivision string    `json:"subdivision,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	// the record was deleted
+	Withdrawn bool `json:"withdrawn,omitempty"`
+}
+
+// Region returns the declared country, or its ISO 3166-2 subdivision code if one was declared (eg, "CA-QC").
+func (d Declaration) Region() string {
+	return sovereignty.Classification{Country: d.Country, Subdivision: d.Subdivision}.Region()
+}
+
+// ParseRecord validates a declaration record against the lexicon, returning the declaration it makes for the account.
+func ParseRecord(did string, rec map[string]any) (*Declaration, error) {
+	if err := lexicon.ValidateRecord(catalog, rec, Collection, 0); err != nil {
+		return nil, fmt.Errorf("invalid residency declaration: %w", err)
+	}
+	country, err := sovereignty.NormalizeCountry(rec["country"].(string))
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := rec["subdivision"].(string)
+	sub, err = sovereignty.NormalizeSubdivision(country, sub)
+	if err != nil {
+		return nil, err
+	}
+	created, err := syntax.ParseDatetimeLenient(rec["createdAt"].(string))
+	if err != nil {
+		return nil, err
+	}
+	return &Declaration{
+		DID:         did,
+		Country:     country,
+		Subdivision: sub,
+		CreatedAt:   created.Time(),
+	}, nil
+}
+
+// ObserveCommit returns the declaration a commit makes or withdraws, or nil if it doesn't touch the account's declaration.
+func ObserveCommit(commit *comatproto.SyncSubscribeRepos_Commit) (*Declaration, error) {
+	var op *comatproto.SyncSubscribeRepos_RepoOp
+	for _, o := range commit.Ops {
+		if o.Path == Collection+"/"+RecordKey {
+			op = o
+		}
+	}
+	if op == nil {
+		return nil, nil
+	}
+	if op.Action == "delete" || op.Cid == nil {
+		return &Declaration{DID: commit.Repo, Withdrawn: true}, nil
+	}
+	raw, err := findBlock(commit.Blocks, cid.Cid(*op.Cid))
+	if err != nil {
+		return nil, err
+	}
+	rec, err := data.UnmarshalCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decoding residency declaration: %w", err)
+	}
+	return ParseRecord(commit.Repo, rec)
+}
+
+func findBlock(b []byte, c cid.Cid) ([]byte, error) {
+	cr, err := car.NewCarReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("residency declaration block missing from commit")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		if blk.Cid().Equals(c) {
+			return blk.RawData(), nil
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package residency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := ParseRecord("did:plc:a", map[string]any{
+		"$type":       Collection,
+		"country":     "ca",
+		"subdivision": "CA-QC",
+		"createdAt":   "2025-03-01T12:00:00Z",
+	})
+	assert.NoError(err)
+	assert.Equal("CA", d.Country)
+	assert.Equal("QC", d.Subdivision)
+	assert.Equal("CA-QC", d.Region())
+	assert.Equal(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), d.CreatedAt.UTC())
+
+	for _, rec := range []map[string]any{
+		{"$type": Collection, "createdAt": "2025-03-01T12:00:00Z"},
+		{"$type": Collection, "country": "CAN", "createdAt": "2025-03-01T12:00:00Z"},
+		{"$type": Collection, "country": "CA"},
+		{"$type": Collection, "country": "C1", "createdAt": "2025-03-01T12:00:00Z"},
+	} {
+		_, err := ParseRecord("did:plc:a", rec)
+		assert.Error(err, rec)
+	}
+}
+
+func TestObserveCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	commit := cartest.Commit(t, "did:plc:abc")
+	decl := cartest.NewBlock(t, map[string]any{"$type": Collection, "country": "CA", "createdAt": "2025-03-01T12:00:00Z"})
+	post := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "hi"})
+
+	d, err := ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit, decl),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: Collection + "/self", Cid: decl.Link()}},
+	})
+	assert.NoError(err)
+	if assert.NotNil(d) {
+		assert.Equal("did:plc:abc", d.DID)
+		assert.Equal("CA", d.Country)
+		assert.False(d.Withdrawn)
+	}
+
+	// only the "self" record is a declaration
+	d, err = ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit, post, decl),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/3k", Cid: post.Link()},
+			{Action: "create", Path: Collection + "/other", Cid: decl.Link()},
+		},
+	})
+	assert.NoError(err)
+	assert.Nil(d)
+
+	d, err = ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "delete", Path: Collection + "/self"}},
+	})
+	assert.NoError(err)
+	if assert.NotNil(d) {
+		assert.True(d.Withdrawn)
+	}
+
+	// the block is missing
+	_, err = ObserveCommit(&comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:abc",
+		Blocks: cartest.CAR(t, commit),
+		Ops:    []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "update", Path: Collection + "/self", Cid: decl.Link()}},
+	})
+	assert.Error(err)
+}
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	decl := &Declaration{DID: "did:plc:a", Country: "CA", Subdivision: "QC"}
+	resolved := func(country string) *sovereignty.Resolution {
+		return &sovereignty.Resolution{DID: "did:plc:a", Country: country, Confidence: sovereignty.ConfidenceMedium}
+	}
+
+	p := DefaultPolicy()
+	result, cl := p.Evaluate(decl, nil, resolved("CA"), now)
+	assert.Equal(ResultApplied, result)
+	if assert.NotNil(cl) {
+		assert.Equal("CA-QC", cl.Region())
+		assert.Equal(SourceDeclaration, cl.Source)
+		assert.Equal(sovereignty.ConfidenceLow, cl.Confidence)
+	}
+	result, _ = p.Evaluate(decl, nil, resolved("US"), now)
+	assert.Equal(ResultContradicted, result)
+	result, _ = p.Evaluate(decl, nil, nil, now)
+	assert.Equal(ResultUnconfirmed, result)
+
+	// operators' classifications, and more confident resolver answers, stand
+	manual := &sovereignty.Classification{DID: "did:plc:a", Country: "US", Source: "admin"}
+	result, _ = p.Evaluate(decl, manual, resolved("CA"), now)
+	assert.Equal(ResultOverridden, result)
+	confident := &sovereignty.Classification{DID: "did:plc:a", Country: "US", Source: "pds", Confidence: sovereignty.ConfidenceMedium}
+	result, _ = p.Evaluate(decl, confident, resolved("CA"), now)
+	assert.Equal(ResultOverridden, result)
+	weak := &sovereignty.Classification{DID: "did:plc:a", Country: "CA", Source: "plc", Confidence: sovereignty.ConfidenceLow}
+	result, _ = p.Evaluate(decl, weak, resolved("CA"), now)
+	assert.Equal(ResultApplied, result)
+
+	// moving country too soon after a declaration was applied
+	declared := &sovereignty.Classification{DID: "did:plc:a", Country: "US", Source: SourceDeclaration, Confidence: sovereignty.ConfidenceLow, UpdatedAt: now.Add(-24 * time.Hour)}
+	result, _ = p.Evaluate(decl, declared, resolved("CA"), now)
+	assert.Equal(ResultTooSoon, result)
+	declared.UpdatedAt = now.Add(-60 * 24 * time.Hour)
+	result, _ = p.Evaluate(decl, declared, resolved("CA"), now)
+	assert.Equal(ResultApplied, result)
+
+	p.Mode = ModeTrust
+	result, _ = p.Evaluate(decl, nil, nil, now)
+	assert.Equal(ResultApplied, result)
+	p.Countries = []string{"FR"}
+	result, _ = p.Evaluate(decl, nil, nil, now)
+	assert.Equal(ResultCountryNotAllowed, result)
+	p.Countries = nil
+	p.Mode = ModeRecord
+	result, cl = p.Evaluate(decl, nil, nil, now)
+	assert.Equal(ResultRecorded, result)
+	assert.Nil(cl)
+
+	result, _ = p.Evaluate(&Declaration{DID: "did:plc:a", Withdrawn: true}, nil, nil, now)
+	assert.Equal(ResultWithdrawn, result)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	write := func(s string) string {
+		fname := filepath.Join(dir, "policy.json")
+		assert.NoError(os.WriteFile(fname, []byte(s), 0o644))
+		return fname
+	}
+
+	p, err := LoadPolicy(write(`{"mode": "trust", "confidence": "medium", "countries": ["ca"], "minInterval": "24h"}`))
+	assert.NoError(err)
+	assert.Equal(ModeTrust, p.Mode)
+	assert.Equal(sovereignty.ConfidenceMedium, p.Confidence)
+	assert.Equal([]string{"CA"}, p.Countries)
+	assert.Equal(Duration(24*time.Hour), p.MinInterval)
+
+	p, err = LoadPolicy(write(`{}`))
+	assert.NoError(err)
+	assert.Equal(DefaultPolicy(), p)
+
+	_, err = LoadPolicy(write(`{"mode": "believe"}`))
+	assert.Error(err)
+	_, err = LoadPolicy(write(`{"countries": ["Canada"]}`))
+	assert.Error(err)
+}
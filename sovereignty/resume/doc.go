@@ -0,0 +1,4 @@
+// Resume tokens for sovereign stream consumers.
+//
+// Instead of a bare sequence number, each frame on the sovereign stream carries an opaque token binding the sequence number to the relay's event log epoch and a hash of the stream's filter configuration, authenticated with an HMAC under a relay-held key. On reconnect the relay can tell a tampered or foreign cursor from one issued before its event log was reset, or before the stream's filter changed, and tell the consumer what to do about it.
+package resume
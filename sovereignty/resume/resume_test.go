@@ -0,0 +1,48 @@
+package resume
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSigner([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := Token{Seq: 12345, Epoch: 3, Filter: 0xdeadbeefcafef00d}
+	tok := s.Issue(in)
+	out, err := s.Parse(tok)
+	assert.NoError(err)
+	assert.Equal(in, out)
+}
+
+func TestTampering(t *testing.T) {
+	assert := assert.New(t)
+
+	s, _ := NewSigner([]byte("0123456789abcdef"))
+	other, _ := NewSigner([]byte("fedcba9876543210"))
+	tok := s.Issue(Token{Seq: 100, Epoch: 1, Filter: 42})
+
+	// bump the sequence number
+	raw, _ := base64.RawURLEncoding.DecodeString(tok)
+	raw[8]++
+	_, err := s.Parse(base64.RawURLEncoding.EncodeToString(raw))
+	assert.ErrorIs(err, ErrInvalidMAC)
+
+	_, err = other.Parse(tok)
+	assert.ErrorIs(err, ErrInvalidMAC)
+
+	for _, bad := range []string{"", "12345", "not base64!", tok[:len(tok)-2]} {
+		_, err = s.Parse(bad)
+		assert.ErrorIs(err, ErrMalformed, bad)
+	}
+
+	_, err = NewSigner([]byte("short"))
+	assert.Error(err)
+}
@@ -0,0 +1,4 @@
+// The relay's own atproto repository, where it publishes the state of the sovereign infrastructure as records.
+//
+// The repo belongs to the relay's did:web identity (did:web:<hostname>), whose DID document the relay serves itself, with its own signing key and itself as the repo host; there is no separate PDS. Records are written as the relay runs: a status record (rkey "self") refreshed periodically with the same health figures exchanged with peer relays, a record for each applied policy document (its version and SHA-256 hash, not its content), and a record announcing each published classification snapshot. Commits are signed like any other repo, and the repo is persisted as a single CAR file, as it stays small.
+package selfrepo
@@ -0,0 +1,11 @@
+package selfrepo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var commitsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "selfrepo_commits_total",
+	Help: "Commits to the relay's own repo",
+})
@@ -0,0 +1,100 @@
+package selfrepo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/peering"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/snapshot"
+)
+
+const (
+	// the relay's current status; a single record, with rkey StatusRKey
+	StatusCollection = syntax.NSID("ca.gander.relay.status")
+	StatusRKey       = syntax.RecordKey("self")
+	// one record per applied policy document
+	PolicyCollection = syntax.NSID("ca.gander.relay.policy")
+	// one record per published classification snapshot or diff
+	SnapshotCollection = syntax.NSID("ca.gander.relay.snapshot")
+)
+
+// StatusRecord returns the status record for the relay's health figures.
+func StatusRecord(h peering.Health, streamCountries []string) map[string]any {
+	countries := make([]any, len(streamCountries))
+	for i, c := range streamCountries {
+		countries[i] = c
+	}
+	return map[string]any{
+		"hostname":           h.Relay,
+		"headSeq":            h.HeadSeq,
+		"activeHosts":        int64(h.ActiveHosts),
+		"knownHosts":         int64(h.KnownHosts),
+		"classifications":    int64(h.Classifications),
+		"snapshotGeneration": h.SnapshotGeneration,
+		"streamCountries":    countries,
+		"updatedAt":          h.Time,
+	}
+}
+
+// PolicyRecord returns the record announcing an applied policy document. Only the document's hash is published; the signed document itself is distributed by the policy authority.
+func PolicyRecord(doc *policy.Document, token string) map[string]any {
+	sum := sha256.Sum256([]byte(token))
+	return map[string]any{
+		"version":   doc.Version,
+		"sha256":    hex.EncodeToString(sum[:]),
+		"appliedAt": syntax.DatetimeNow().String(),
+	}
+}
+
+// SnapshotRecord returns the record announcing a published classification snapshot, pointing at its manifest under baseURL.
+func SnapshotRecord(m *snapshot.Manifest, baseURL string) map[string]any {
+	rec := map[string]any{
+		"kind":          m.Kind,
+		"generation":    m.Generation,
+		"count":         int64(m.Count),
+		"payload":       m.Payload,
+		"payloadSha256": m.PayloadSHA256,
+		"signer":        m.Signer,
+		"createdAt":     m.CreatedAt,
+	}
+	if m.Base != 0 {
+		rec["base"] = m.Base
+	}
+	if baseURL != "" {
+		rec["index"] = baseURL + "/" + snapshot.IndexFile
+	}
+	return rec
+}
+
+// DIDDocument returns the DID document of the relay's did:web identity: its atproto signing key (which also signs the relay's labels), and the relay itself as the repo host and labeler.
+func DIDDocument(hostname string, key crypto.PublicKey) identity.DIDDocument {
+	did := "did:web:" + hostname
+	return identity.DIDDocument{
+		DID:         syntax.DID(did),
+		AlsoKnownAs: []string{"at://" + hostname},
+		VerificationMethod: []identity.DocVerificationMethod{{
+			ID:                 did + "#atproto",
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: key.Multibase(),
+		}, {
+			ID:                 did + "#atproto_label",
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: key.Multibase(),
+		}},
+		Service: []identity.DocService{{
+			ID:              "#atproto_pds",
+			Type:            "AtprotoPersonalDataServer",
+			ServiceEndpoint: "https://" + hostname,
+		}, {
+			ID:              "#atproto_labeler",
+			Type:            "AtprotoLabeler",
+			ServiceEndpoint: "https://" + hostname,
+		}},
+	}
+}
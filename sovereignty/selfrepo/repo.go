@@ -0,0 +1,288 @@
+package selfrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/label"
+	atrepo "github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/repo"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/ipld/go-car"
+)
+
+// ErrNotFound is returned for records which aren't in the repo.
+var ErrNotFound = errors.New("record not found")
+
+// Repo is a single-account atproto repository, signed with the relay's own key and persisted as a CAR file. It is safe for concurrent use.
+type Repo struct {
+	did  syntax.DID
+	key  crypto.PrivateKey
+	path string
+
+	lk   sync.Mutex
+	bs   *atrepo.TinyBlockstore
+	repo *repo.Repo
+	head cid.Cid
+	rev  string
+}
+
+// record is a generic record, encoded as DAG-CBOR
+type record map[string]any
+
+func (r record) MarshalCBOR(w io.Writer) error {
+	b, err := data.MarshalCBOR(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Open loads the repo from the CAR file at path, or starts an empty one if the file doesn't exist yet. The file must belong to the given DID.
+func Open(ctx context.Context, path string, did syntax.DID, key crypto.PrivateKey) (*Repo, error) {
+	r := &Repo{
+		did:  did,
+		key:  key,
+		path: path,
+		bs:   atrepo.NewTinyBlockstore(),
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		r.repo = repo.NewRepo(ctx, did.String(), r.bs)
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root, err := repo.IngestRepo(ctx, r.bs, f)
+	if err != nil {
+		return nil, fmt.Errorf("loading relay repo: %w", err)
+	}
+	rr, err := repo.OpenRepo(ctx, r.bs, root)
+	if err != nil {
+		return nil, fmt.Errorf("loading relay repo: %w", err)
+	}
+	if rr.RepoDid() != did.String() {
+		return nil, fmt.Errorf("relay repo at %s belongs to %s, not %s", path, rr.RepoDid(), did)
+	}
+	r.repo = rr
+	r.head = root
+	r.rev = rr.SignedCommit().Rev
+	return r, nil
+}
+
+// DID returns the repo's account DID.
+func (r *Repo) DID() syntax.DID {
+	return r.did
+}
+
+// PublicKey returns the public half of the repo's signing key.
+func (r *Repo) PublicKey() (crypto.PublicKey, error) {
+	return r.key.PublicKey()
+}
+
+// SignLabel sets the label's source to the repo's account, and signs it with the repo's key.
+func (r *Repo) SignLabel(l *label.Label) error {
+	l.SourceDID = r.did.String()
+	return l.Sign(r.key)
+}
+
+// Head returns the CID and revision of the current commit, or cid.Undef if nothing has been committed yet.
+func (r *Repo) Head() (cid.Cid, string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.head, r.rev
+}
+
+// Put creates or replaces a record, and commits.
+func (r *Repo) Put(ctx context.Context, collection syntax.NSID, rkey syntax.RecordKey, rec map[string]any) (cid.Cid, error) {
+	rec["$type"] = collection.String()
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	c, err := r.repo.PutRecord(ctx, collection.String()+"/"+rkey.String(), record(rec))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return c, r.commit(ctx)
+}
+
+// Create adds a record with a TID record key, and commits.
+func (r *Repo) Create(ctx context.Context, collection syntax.NSID, rec map[string]any) (syntax.RecordKey, cid.Cid, error) {
+	rec["$type"] = collection.String()
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	c, rkey, err := r.repo.CreateRecord(ctx, collection.String(), record(rec))
+	if err != nil {
+		return "", cid.Undef, err
+	}
+	return syntax.RecordKey(rkey), c, r.commit(ctx)
+}
+
+// commit signs a new commit and writes the repo to disk; the caller must hold lk
+func (r *Repo) commit(ctx context.Context) error {
+	head, rev, err := r.repo.Commit(ctx, func(_ context.Context, _ string, b []byte) ([]byte, error) {
+		return r.key.HashAndSign(b)
+	})
+	if err != nil {
+		return err
+	}
+	r.head = head
+	r.rev = rev
+	commitsCounter.Inc()
+	return r.persist(ctx)
+}
+
+// persist atomically replaces the CAR file with the current repo; the caller must hold lk
+func (r *Repo) persist(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := r.writeCAR(ctx, &buf); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// WriteCAR writes the full repo (commit, tree and records) as a CAR file, as served by com.atproto.sync.getRepo.
+func (r *Repo) WriteCAR(ctx context.Context, w io.Writer) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.writeCAR(ctx, w)
+}
+
+func (r *Repo) writeCAR(ctx context.Context, w io.Writer) error {
+	if !r.head.Defined() {
+		return ErrNotFound
+	}
+	hb, err := cbor.DumpObject(&car.CarHeader{
+		Roots:   []cid.Cid{r.head},
+		Version: 1,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := carstore.LdWrite(w, hb); err != nil {
+		return err
+	}
+	commit, err := r.bs.Get(ctx, r.head)
+	if err != nil {
+		return err
+	}
+	cw := &carWriter{w: w, src: r.bs}
+	if err := cw.Put(ctx, commit); err != nil {
+		return err
+	}
+	return r.repo.CopyDataTo(ctx, cw)
+}
+
+// carWriter is a write-only blockstore which appends blocks to a CAR file
+type carWriter struct {
+	w   io.Writer
+	src *atrepo.TinyBlockstore
+}
+
+func (cw *carWriter) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return cw.src.Get(ctx, c)
+}
+
+func (cw *carWriter) Put(_ context.Context, blk blocks.Block) error {
+	_, err := carstore.LdWrite(cw.w, blk.Cid().Bytes(), blk.RawData())
+	return err
+}
+
+// GetRecord returns the CID and DAG-CBOR bytes of a record.
+func (r *Repo) GetRecord(ctx context.Context, collection syntax.NSID, rkey syntax.RecordKey) (cid.Cid, []byte, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if !r.head.Defined() {
+		return cid.Undef, nil, ErrNotFound
+	}
+	c, raw, err := r.repo.GetRecordBytes(ctx, collection.String()+"/"+rkey.String())
+	if err != nil {
+		// the tree doesn't distinguish missing keys from other failures; the repo is local and small, so treat all as missing
+		return cid.Undef, nil, ErrNotFound
+	}
+	return c, *raw, nil
+}
+
+// Entry is a record listed from a collection.
+type Entry struct {
+	RKey  syntax.RecordKey
+	CID   cid.Cid
+	Value map[string]any
+}
+
+// List returns up to limit records of a collection in record key order, starting after the given record key (if any).
+func (r *Repo) List(ctx context.Context, collection syntax.NSID, after string, limit int) ([]Entry, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if !r.head.Defined() {
+		return nil, nil
+	}
+	prefix := collection.String() + "/"
+	var keys []string
+	var cids []cid.Cid
+	errStop := errors.New("stop")
+	err := r.repo.ForEach(ctx, prefix+after, func(k string, v cid.Cid) error {
+		if k < prefix {
+			return nil
+		}
+		if !strings.HasPrefix(k, prefix) {
+			return errStop
+		}
+		rkey := strings.TrimPrefix(k, prefix)
+		if after != "" && rkey <= after {
+			return nil
+		}
+		keys = append(keys, rkey)
+		cids = append(cids, v)
+		if len(keys) >= limit {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(keys))
+	for i, k := range keys {
+		blk, err := r.bs.Get(ctx, cids[i])
+		if err != nil {
+			return nil, err
+		}
+		val, err := data.UnmarshalCBOR(blk.RawData())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Entry{RKey: syntax.RecordKey(k), CID: cids[i], Value: val})
+	}
+	return out, nil
+}
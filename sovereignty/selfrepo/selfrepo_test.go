@@ -0,0 +1,93 @@
+package selfrepo
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/label"
+	atrepo "github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty/peering"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepo(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	priv, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	did := syntax.DID("did:web:relay.example.ca")
+	path := filepath.Join(t.TempDir(), "repo.car")
+
+	r, err := Open(ctx, path, did, priv)
+	assert.NoError(err)
+	head, _ := r.Head()
+	assert.False(head.Defined())
+	_, _, err = r.GetRecord(ctx, StatusCollection, StatusRKey)
+	assert.ErrorIs(err, ErrNotFound)
+
+	h := peering.Health{Relay: "relay.example.ca", HeadSeq: 42, Classifications: 7, Time: syntax.DatetimeNow().String()}
+	_, err = r.Put(ctx, StatusCollection, StatusRKey, StatusRecord(h, []string{"CA"}))
+	assert.NoError(err)
+	for v := int64(1); v <= 3; v++ {
+		_, _, err = r.Create(ctx, PolicyCollection, PolicyRecord(&policy.Document{Version: v}, "token"))
+		assert.NoError(err)
+	}
+	head, rev := r.Head()
+	assert.True(head.Defined())
+
+	// the served CAR is a valid, signed repo
+	var buf bytes.Buffer
+	assert.NoError(r.WriteCAR(ctx, &buf))
+	commit, loaded, err := atrepo.LoadRepoFromCAR(ctx, bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal(did.String(), commit.DID)
+	assert.Equal(rev, commit.Rev)
+	assert.NoError(commit.VerifySignature(pub))
+	raw, _, err := loaded.GetRecordBytes(ctx, StatusCollection, StatusRKey)
+	assert.NoError(err)
+	assert.NotEmpty(raw)
+
+	// reopened from disk
+	r, err = Open(ctx, path, did, priv)
+	assert.NoError(err)
+	reopened, _ := r.Head()
+	assert.Equal(head, reopened)
+	_, _, err = r.GetRecord(ctx, StatusCollection, StatusRKey)
+	assert.NoError(err)
+
+	page, err := r.List(ctx, PolicyCollection, "", 2)
+	assert.NoError(err)
+	assert.Len(page, 2)
+	assert.Equal(int64(1), page[0].Value["version"])
+	assert.Equal(string(PolicyCollection), page[0].Value["$type"])
+	page, err = r.List(ctx, PolicyCollection, page[1].RKey.String(), 2)
+	assert.NoError(err)
+	assert.Len(page, 1)
+	assert.Equal(int64(3), page[0].Value["version"])
+
+	// the file belongs to another identity
+	_, err = Open(ctx, path, syntax.DID("did:web:other.example.ca"), priv)
+	assert.Error(err)
+
+	l := label.Label{URI: "did:plc:abc123", Val: "handle-unverified", Version: label.ATPROTO_LABEL_VERSION, CreatedAt: syntax.DatetimeNow().String()}
+	assert.NoError(r.SignLabel(&l))
+	assert.Equal(did.String(), l.SourceDID)
+	assert.NoError(l.VerifySignature(pub))
+
+	doc := DIDDocument("relay.example.ca", pub)
+	assert.Equal(did, doc.DID)
+	assert.Equal(pub.Multibase(), doc.VerificationMethod[0].PublicKeyMultibase)
+}
@@ -0,0 +1,4 @@
+// Sampled log of the sovereign stream filter's decisions in shadow mode.
+//
+// In shadow mode the relay evaluates the sovereign stream filter on every event it broadcasts, but doesn't act on the results: the stream carries everything. Operators see what enforcement would do from the would-pass and would-drop metrics, and from a Log of sampled decisions, which they can read back to check individual accounts' classifications before enforcing the filter. The Log keeps the most recent Size sampled decisions, sampling a steady SampleRate share of them.
+package shadow
@@ -0,0 +1,103 @@
+package shadow
+
+import (
+	"sync"
+	"time"
+)
+
+// Result values: what the filter would do with an event.
+const (
+	ResultInclude  = "include"
+	ResultHashOnly = "hash_only"
+	ResultExclude  = "exclude"
+)
+
+type Options struct {
+	// sampled decisions kept, the oldest being dropped beyond this
+	Size int
+	// share of decisions sampled, from 0 (none) to 1 (all)
+	SampleRate float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Size:       10_000,
+		SampleRate: 0.01,
+	}
+}
+
+// Decision is the filter's decision on an event, which shadow mode didn't act on.
+type Decision struct {
+	Time time.Time `json:"time"`
+	Seq  int64     `json:"seq"`
+	DID  string    `json:"did,omitempty"`
+	// the event's type: commit, sync, identity or account
+	Kind string `json:"kind"`
+	// one of the Result constants
+	Result     string `json:"result"`
+	Confidence string `json:"confidence"`
+	// one of the sovereignty.FilterReason constants
+	Reason string `json:"reason"`
+}
+
+// Log keeps a sample of recent decisions. It is safe for concurrent use.
+type Log struct {
+	opts Options
+
+	lk      sync.Mutex
+	ring    []Decision
+	next    int
+	credit  float64
+	sampled int64
+}
+
+func NewLog(opts Options) *Log {
+	return &Log{
+		opts: opts,
+		ring: make([]Decision, 0, max(opts.Size, 1)),
+	}
+}
+
+// Record offers a decision to the log, and reports whether it was sampled. Samples are evenly spaced rather than random: a rate of 0.01 keeps about every hundredth decision.
+func (l *Log) Record(d Decision) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	l.credit += l.opts.SampleRate
+	if l.credit < 1 {
+		return false
+	}
+	l.credit--
+	l.sampled++
+	if len(l.ring) < cap(l.ring) {
+		l.ring = append(l.ring, d)
+	} else {
+		l.ring[l.next] = d
+	}
+	l.next = (l.next + 1) % cap(l.ring)
+	return true
+}
+
+// Sampled returns the number of decisions sampled since the log was made, including those since dropped.
+func (l *Log) Sampled() int64 {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return l.sampled
+}
+
+// Recent returns up to limit of the sampled decisions, newest first, restricted to those with the result if it is not empty.
+func (l *Log) Recent(limit int, result string) []Decision {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	out := []Decision{}
+	for i := 0; i < len(l.ring) && len(out) < limit; i++ {
+		// the newest is just before l.next, wrapping around once the ring is full
+		d := l.ring[(l.next-1-i+2*len(l.ring))%len(l.ring)]
+		if result != "" && d.Result != result {
+			continue
+		}
+		out = append(out, d)
+	}
+	return out
+}
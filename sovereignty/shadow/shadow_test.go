@@ -0,0 +1,47 @@
+package shadow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewLog(Options{Size: 3, SampleRate: 0.5})
+	var kept []int64
+	for seq := int64(1); seq <= 10; seq++ {
+		result := ResultInclude
+		if seq%4 == 0 {
+			result = ResultExclude
+		}
+		if l.Record(Decision{Seq: seq, Result: result}) {
+			kept = append(kept, seq)
+		}
+	}
+	assert.Equal([]int64{2, 4, 6, 8, 10}, kept)
+	assert.Equal(int64(5), l.Sampled())
+
+	seqs := func(ds []Decision) []int64 {
+		out := []int64{}
+		for _, d := range ds {
+			out = append(out, d.Seq)
+		}
+		return out
+	}
+	// only the last three sampled are kept, newest first
+	assert.Equal([]int64{10, 8, 6}, seqs(l.Recent(10, "")))
+	assert.Equal([]int64{10}, seqs(l.Recent(1, "")))
+	assert.Equal([]int64{8}, seqs(l.Recent(10, ResultExclude)))
+
+	// before the ring fills
+	l = NewLog(Options{Size: 3, SampleRate: 1})
+	l.Record(Decision{Seq: 1})
+	l.Record(Decision{Seq: 2})
+	assert.Equal([]int64{2, 1}, seqs(l.Recent(10, "")))
+
+	l = NewLog(Options{Size: 3})
+	assert.False(l.Record(Decision{Seq: 1}))
+	assert.Empty(l.Recent(10, ""))
+}
@@ -0,0 +1,4 @@
+// Signed, periodic snapshots of the DID classification table, with incremental diffs, for consumption by peer relays, AppViews, and researchers.
+//
+// A published snapshot directory contains an index.json file pointing at the current chain: one full snapshot manifest followed by zero or more diff manifests. Each manifest is signed by the publishing relay, and commits to a gzipped JSON-lines payload by hash.
+package snapshot
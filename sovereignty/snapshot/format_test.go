@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/export"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func checkGolden(t *testing.T, name string, b []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(golden), string(b), "%s changed; if intended, bump FormatVersion or only add fields, and rerun with -update", path)
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(export.Version, FormatVersion, "snapshot schemas are kept with the export formats")
+
+	// signer and signature are fixed, as signatures aren't deterministic
+	m := Manifest{
+		Version:       FormatVersion,
+		Kind:          KindDiff,
+		Generation:    5,
+		Base:          4,
+		CreatedAt:     "2025-03-01T12:30:00.000Z",
+		Count:         2,
+		Payload:       payloadName(KindDiff, 5),
+		PayloadSHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Signer:        "did:key:zQ3shXjHeiBuRCKmM36cuYnm7YEMzhGnCmCyW92sRJ9pribSF",
+		Sig:           "c2lnbmF0dXJl",
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	assert.NoError(err)
+	checkGolden(t, "manifest.json", append(b, '\n'))
+	assert.NoError(export.Validate(export.SchemaSnapshotManifest, FormatVersion, b))
+
+	idx := Index{
+		Version:   FormatVersion,
+		Head:      5,
+		CreatedAt: "2025-03-01T12:30:00.000Z",
+		Manifests: []string{manifestName(KindFull, 4), manifestName(KindDiff, 5)},
+		Signer:    m.Signer,
+		Sig:       m.Sig,
+	}
+	b, err = json.MarshalIndent(idx, "", "  ")
+	assert.NoError(err)
+	checkGolden(t, "index.json", append(b, '\n'))
+	assert.NoError(export.Validate(export.SchemaSnapshotIndex, FormatVersion, b))
+
+	// payload lines, as encodePayload writes them before compression
+	updated := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Classification: sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Subdivision: "QC", Source: "pds-geo", UpdatedAt: updated, Confidence: sovereignty.ConfidenceHigh}},
+		{Classification: sovereignty.Classification{DID: "did:plc:bbb"}, Deleted: true},
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		assert.NoError(enc.Encode(e))
+	}
+	checkGolden(t, "payload.jsonl", buf.Bytes())
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		assert.NoError(export.Validate(export.SchemaSnapshotEntry, FormatVersion, line))
+	}
+}
+
+func TestPublishedMatchesSchema(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	priv, _ := testKey(t)
+	dir := t.TempDir()
+	src := sovereignty.NewTable()
+	src.Set(sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "test"})
+	p := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+	_, err := p.PublishOnce(ctx)
+	assert.NoError(err)
+	src.Delete("did:plc:aaa")
+	_, err = p.PublishOnce(ctx)
+	assert.NoError(err)
+
+	b, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	assert.NoError(err)
+	assert.NoError(export.Validate(export.SchemaSnapshotIndex, FormatVersion, b))
+	var idx Index
+	assert.NoError(json.Unmarshal(b, &idx))
+	assert.Len(idx.Manifests, 2)
+	for _, name := range idx.Manifests {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(err)
+		assert.NoError(export.Validate(export.SchemaSnapshotManifest, FormatVersion, b))
+		var m Manifest
+		assert.NoError(json.Unmarshal(b, &m))
+		f, err := os.Open(filepath.Join(dir, m.Payload))
+		assert.NoError(err)
+		assert.NoError(ReadPayload(f, 0, 0, func(e *Entry) error {
+			line, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			return export.Validate(export.SchemaSnapshotEntry, FormatVersion, line)
+		}))
+		f.Close()
+	}
+}
@@ -0,0 +1,234 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+const (
+	// default cap on the size of index and manifest files
+	DefaultMaxManifestBytes = 1024 * 1024
+	// default cap on the (compressed) size of a single payload
+	DefaultMaxPayloadBytes = 512 * 1024 * 1024
+	// default cap on the decompressed size of a single payload
+	DefaultMaxDecodedBytes = 4 * 1024 * 1024 * 1024
+	// default cap on the number of entries in a single payload
+	DefaultMaxEntries = 50_000_000
+)
+
+// Loader fetches and verifies snapshots published by a Publisher, from an HTTP base URL, and applies them to a local classification table.
+type Loader struct {
+	BaseURL string
+	// key which the index and all manifests must be signed by
+	Signer crypto.PublicKey
+	Client *http.Client
+
+	// if positive, reject an index older than this
+	MaxAge time.Duration
+
+	MaxManifestBytes int64
+	MaxPayloadBytes  int64
+	MaxDecodedBytes  int64
+	MaxEntries       int
+
+	// generation of the most recently applied manifest
+	Generation int64
+}
+
+func NewLoader(baseURL string, signer crypto.PublicKey) *Loader {
+	return &Loader{
+		BaseURL:          strings.TrimSuffix(baseURL, "/"),
+		Signer:           signer,
+		Client:           http.DefaultClient,
+		MaxManifestBytes: DefaultMaxManifestBytes,
+		MaxPayloadBytes:  DefaultMaxPayloadBytes,
+		MaxDecodedBytes:  DefaultMaxDecodedBytes,
+		MaxEntries:       DefaultMaxEntries,
+	}
+}
+
+// Sync brings the table up to date with the remote snapshot chain. If the table has never been loaded, or the remote has started a new full snapshot since the last sync, the table contents are replaced by the full snapshot plus any diffs. Returns the number of entries applied.
+//
+// Everything is fetched and verified before the table is touched, and the table is updated under a single lock, so on error the table is left unchanged and readers never see a partially applied sync.
+func (l *Loader) Sync(ctx context.Context, tbl *sovereignty.Table) (int, error) {
+	var idx Index
+	if err := l.getJSON(ctx, IndexFile, &idx); err != nil {
+		return 0, fmt.Errorf("fetching snapshot index: %w", err)
+	}
+	if err := idx.Verify(l.Signer); err != nil {
+		return 0, fmt.Errorf("verifying snapshot index: %w", err)
+	}
+	if idx.Head < l.Generation {
+		return 0, fmt.Errorf("snapshot index rolled back: head generation %d, already applied %d", idx.Head, l.Generation)
+	}
+	if l.MaxAge > 0 {
+		created, err := syntax.ParseDatetime(idx.CreatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("invalid snapshot index timestamp: %w", err)
+		}
+		if age := time.Since(created.Time()); age > l.MaxAge {
+			return 0, fmt.Errorf("snapshot index is stale (%s old)", age.Round(time.Second))
+		}
+	}
+	if len(idx.Manifests) == 0 {
+		return 0, nil
+	}
+
+	manifests := make([]*Manifest, 0, len(idx.Manifests))
+	for _, name := range idx.Manifests {
+		var m Manifest
+		if err := l.getJSON(ctx, name, &m); err != nil {
+			return 0, fmt.Errorf("fetching snapshot manifest: %w", err)
+		}
+		if err := m.Verify(l.Signer); err != nil {
+			return 0, fmt.Errorf("verifying snapshot manifest %s: %w", name, err)
+		}
+		manifests = append(manifests, &m)
+	}
+
+	if manifests[0].Kind != KindFull {
+		return 0, fmt.Errorf("snapshot chain does not start with a full snapshot")
+	}
+	for i := 1; i < len(manifests); i++ {
+		if manifests[i].Kind != KindDiff || manifests[i].Base != manifests[i-1].Generation {
+			return 0, fmt.Errorf("broken snapshot chain at generation %d", manifests[i].Generation)
+		}
+	}
+	if head := manifests[len(manifests)-1].Generation; head != idx.Head {
+		return 0, fmt.Errorf("snapshot index head %d does not match chain head %d", idx.Head, head)
+	}
+
+	// skip everything we have already applied, unless a new full snapshot has been cut since
+	start := 0
+	if l.Generation >= manifests[0].Generation {
+		start = len(manifests)
+		for i, m := range manifests {
+			if m.Generation > l.Generation {
+				start = i
+				break
+			}
+		}
+	}
+	if start == len(manifests) {
+		return 0, nil
+	}
+
+	// pending changes, keyed by DID; later manifests override earlier ones
+	var full map[string]sovereignty.Classification
+	changes := make(map[string]*Entry)
+	applied := 0
+	for _, m := range manifests[start:] {
+		entries, err := l.fetchEntries(ctx, m)
+		if err != nil {
+			return 0, err
+		}
+		applied += len(entries)
+		if m.Kind == KindFull {
+			full = make(map[string]sovereignty.Classification, len(entries))
+			for _, e := range entries {
+				full[e.DID] = e.Classification
+			}
+			continue
+		}
+		for i := range entries {
+			e := &entries[i]
+			if full != nil {
+				if e.Deleted {
+					delete(full, e.DID)
+				} else {
+					full[e.DID] = e.Classification
+				}
+			} else {
+				changes[e.DID] = e
+			}
+		}
+	}
+
+	if full != nil {
+		all := make([]sovereignty.Classification, 0, len(full))
+		for _, c := range full {
+			all = append(all, c)
+		}
+		tbl.Replace(all)
+	} else {
+		var set []sovereignty.Classification
+		var del []string
+		for _, e := range changes {
+			if e.Deleted {
+				del = append(del, e.DID)
+			} else {
+				set = append(set, e.Classification)
+			}
+		}
+		tbl.ApplyBatch(set, del)
+	}
+	l.Generation = manifests[len(manifests)-1].Generation
+	return applied, nil
+}
+
+func (l *Loader) fetchEntries(ctx context.Context, m *Manifest) ([]Entry, error) {
+	payload, err := l.get(ctx, m.Payload, l.MaxPayloadBytes)
+	if err != nil {
+		return nil, fmt.Errorf("fetching snapshot payload: %w", err)
+	}
+	if err := m.CheckPayload(payload); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := ReadPayload(bytes.NewReader(payload), l.MaxEntries, l.MaxDecodedBytes, func(e *Entry) error {
+		entries = append(entries, *e)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("reading snapshot payload %s: %w", m.Payload, err)
+	}
+	return entries, nil
+}
+
+func (l *Loader) get(ctx context.Context, name string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.BaseURL+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d fetching %s", resp.StatusCode, name)
+	}
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%s: %w", name, ErrPayloadTooLarge)
+	}
+	return b, nil
+}
+
+func (l *Loader) getJSON(ctx context.Context, name string, out any) error {
+	b, err := l.get(ctx, name, l.MaxManifestBytes)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,220 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// FormatVersion is bumped on any incompatible change to manifests or payloads.
+const FormatVersion = 1
+
+const (
+	KindFull = "full"
+	KindDiff = "diff"
+)
+
+// IndexFile is the well-known name of the file listing the current snapshot chain.
+const IndexFile = "index.json"
+
+// Manifest describes a single published snapshot (full or diff). The signature covers the JSON encoding of the manifest with the Sig field empty, and the manifest commits to the payload via a SHA-256 hash.
+type Manifest struct {
+	Version    int    `json:"version"`
+	Kind       string `json:"kind"`
+	Generation int64  `json:"generation"`
+	// for diffs, the generation this diff applies on top of
+	Base      int64  `json:"base,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	// number of entries in the payload (for diffs, including deletions)
+	Count         int    `json:"count"`
+	Payload       string `json:"payload"`
+	PayloadSHA256 string `json:"payloadSha256"`
+	// did:key of the signing key
+	Signer string `json:"signer"`
+	Sig    string `json:"sig,omitempty"`
+}
+
+// Entry is a single line of a (gzipped, newline-delimited JSON) snapshot payload.
+type Entry struct {
+	sovereignty.Classification
+	// only meaningful in diffs
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Index is the content of IndexFile: the most recent full snapshot manifest, followed by any diffs which apply on top of it, in order.
+//
+// The index is signed, and commits to the head (newest) generation, so a loader can detect a truncated or rolled-back chain.
+type Index struct {
+	Version int `json:"version"`
+	// generation of the last manifest in the chain
+	Head      int64    `json:"head"`
+	CreatedAt string   `json:"createdAt"`
+	Manifests []string `json:"manifests"`
+	Signer    string   `json:"signer"`
+	Sig       string   `json:"sig,omitempty"`
+}
+
+func manifestName(kind string, gen int64) string {
+	return fmt.Sprintf("%s-%016d.json", kind, gen)
+}
+
+func payloadName(kind string, gen int64) string {
+	return fmt.Sprintf("%s-%016d.jsonl.gz", kind, gen)
+}
+
+// Sign populates the Signer and Sig fields using the provided key.
+func (m *Manifest) Sign(key crypto.PrivateKey) error {
+	return signDoc(key, &m.Signer, &m.Sig, func() ([]byte, error) {
+		unsigned := *m
+		unsigned.Sig = ""
+		return json.Marshal(unsigned)
+	})
+}
+
+// Verify checks the manifest signature against the given public key. It does not trust the Signer field in the manifest itself.
+func (m *Manifest) Verify(pub crypto.PublicKey) error {
+	if m.Version != FormatVersion {
+		return fmt.Errorf("unsupported snapshot format version: %d", m.Version)
+	}
+	return verifyDoc(pub, m.Signer, m.Sig, func() ([]byte, error) {
+		unsigned := *m
+		unsigned.Sig = ""
+		return json.Marshal(unsigned)
+	})
+}
+
+// Sign populates the Signer and Sig fields using the provided key.
+func (idx *Index) Sign(key crypto.PrivateKey) error {
+	return signDoc(key, &idx.Signer, &idx.Sig, func() ([]byte, error) {
+		unsigned := *idx
+		unsigned.Sig = ""
+		return json.Marshal(unsigned)
+	})
+}
+
+// Verify checks the index signature against the given public key.
+func (idx *Index) Verify(pub crypto.PublicKey) error {
+	if idx.Version != FormatVersion {
+		return fmt.Errorf("unsupported snapshot index version: %d", idx.Version)
+	}
+	return verifyDoc(pub, idx.Signer, idx.Sig, func() ([]byte, error) {
+		unsigned := *idx
+		unsigned.Sig = ""
+		return json.Marshal(unsigned)
+	})
+}
+
+// signDoc sets the signer and signature fields; the bytes callback must serialize the document with an empty signature field (but signer already set).
+func signDoc(key crypto.PrivateKey, signer, sig *string, signingBytes func() ([]byte, error)) error {
+	pub, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	*signer = pub.DIDKey()
+	b, err := signingBytes()
+	if err != nil {
+		return err
+	}
+	raw, err := key.HashAndSign(b)
+	if err != nil {
+		return err
+	}
+	*sig = base64.RawURLEncoding.EncodeToString(raw)
+	return nil
+}
+
+func verifyDoc(pub crypto.PublicKey, signer, sig string, signingBytes func() ([]byte, error)) error {
+	if signer != pub.DIDKey() {
+		return fmt.Errorf("snapshot signed by unexpected key: %s", signer)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("malformed snapshot signature: %w", err)
+	}
+	b, err := signingBytes()
+	if err != nil {
+		return err
+	}
+	return pub.HashAndVerify(b, raw)
+}
+
+// CheckPayload verifies that the payload bytes match the hash committed to in the manifest.
+func (m *Manifest) CheckPayload(payload []byte) error {
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != m.PayloadSHA256 {
+		return fmt.Errorf("snapshot payload hash mismatch: %s", m.Payload)
+	}
+	return nil
+}
+
+func encodePayload(entries []Entry) ([]byte, string, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:]), nil
+}
+
+// ErrPayloadTooLarge is returned when a payload exceeds the configured entry or size limits.
+var ErrPayloadTooLarge = errors.New("snapshot payload too large")
+
+// ReadPayload decodes a gzipped snapshot payload, invoking cb for each entry. If maxEntries is positive, payloads with more entries are rejected; if maxBytes is positive, payloads which decompress to more than that many bytes are rejected.
+func ReadPayload(r io.Reader, maxEntries int, maxBytes int64, cb func(e *Entry) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var src io.Reader = gz
+	var lr *io.LimitedReader
+	if maxBytes > 0 {
+		lr = &io.LimitedReader{R: gz, N: maxBytes + 1}
+		src = lr
+	}
+
+	sc := bufio.NewScanner(src)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	count := 0
+	for sc.Scan() {
+		if lr != nil && lr.N <= 0 {
+			return ErrPayloadTooLarge
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		count++
+		if maxEntries > 0 && count > maxEntries {
+			return ErrPayloadTooLarge
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid snapshot entry: %w", err)
+		}
+		if err := cb(&e); err != nil {
+			return err
+		}
+	}
+	if lr != nil && lr.N <= 0 {
+		return ErrPayloadTooLarge
+	}
+	return sc.Err()
+}
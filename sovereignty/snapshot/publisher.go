@@ -0,0 +1,274 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/sovereignty"
+)
+
+// Source is anything which can produce a point-in-time copy of the classification table. It is implemented by sovereignty.Table.
+type Source interface {
+	Snapshot() []sovereignty.Classification
+}
+
+// PublisherOptions tunes a Publisher.
+type PublisherOptions struct {
+	// how often to publish; zero disables the periodic loop in Run
+	Interval time.Duration
+	// publish a full snapshot after this many consecutive diffs
+	MaxDiffs int
+	// called (synchronously) after each successful publish
+	OnPublish func(m *Manifest)
+}
+
+// DefaultPublisherOptions returns the options used when NewPublisher is passed nil.
+func DefaultPublisherOptions() *PublisherOptions {
+	return &PublisherOptions{
+		Interval: 15 * time.Minute,
+		MaxDiffs: 24,
+	}
+}
+
+// Publisher periodically exports the classification table as a signed full snapshot, followed by a chain of signed incremental diffs.
+//
+// The first publish after process start is always a full snapshot. Generation numbers are seeded from wall-clock time and from any index already in the store, so they keep increasing across restarts. When a new full snapshot is cut, files from the chain before the previous one are deleted; the previous chain is kept so loaders part way through a sync can still finish.
+type Publisher struct {
+	source Source
+	store  Store
+	key    crypto.PrivateKey
+	opts   PublisherOptions
+
+	lk         sync.Mutex
+	seeded     bool
+	generation int64
+	// state as of the last successful publish; nil until the first full snapshot
+	last      map[string]sovereignty.Classification
+	chain     []string
+	prevChain []string
+	// readable without lk, which is held for the duration of a publish
+	published atomic.Int64
+
+	log *slog.Logger
+}
+
+func NewPublisher(source Source, store Store, key crypto.PrivateKey, opts *PublisherOptions) *Publisher {
+	if opts == nil {
+		opts = DefaultPublisherOptions()
+	}
+	return &Publisher{
+		source:     source,
+		store:      store,
+		key:        key,
+		opts:       *opts,
+		generation: time.Now().Unix(),
+		log:        slog.Default().With("system", "snapshot-publisher"),
+	}
+}
+
+// Generation returns the generation of the most recent successful publish, or zero if nothing has been published yet by this process.
+func (p *Publisher) Generation() int64 {
+	return p.published.Load()
+}
+
+// Run publishes on the configured interval until the context is cancelled.
+func (p *Publisher) Run(ctx context.Context) {
+	if p.opts.Interval <= 0 {
+		return
+	}
+	t := time.NewTicker(p.opts.Interval)
+	defer t.Stop()
+	for {
+		if _, err := p.PublishOnce(ctx); err != nil {
+			p.log.Error("failed to publish classification snapshot", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// PublishOnce writes either a full snapshot or a diff against the previous publish. If nothing has changed since the previous publish, no files are written and a nil manifest is returned.
+func (p *Publisher) PublishOnce(ctx context.Context) (*Manifest, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if !p.seeded {
+		if err := p.seed(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	current := p.source.Snapshot()
+	curMap := make(map[string]sovereignty.Classification, len(current))
+	for _, c := range current {
+		curMap[c.DID] = c
+	}
+
+	kind := KindDiff
+	if p.last == nil || len(p.chain) > p.opts.MaxDiffs {
+		kind = KindFull
+	}
+
+	var entries []Entry
+	if kind == KindFull {
+		entries = make([]Entry, len(current))
+		for i, c := range current {
+			entries[i] = Entry{Classification: c}
+		}
+	} else {
+		entries = diffEntries(p.last, current)
+		if len(entries) == 0 {
+			return nil, nil
+		}
+	}
+
+	gen := p.generation + 1
+	if now := time.Now().Unix(); now > gen {
+		gen = now
+	}
+
+	payload, sum, err := encodePayload(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Manifest{
+		Version:       FormatVersion,
+		Kind:          kind,
+		Generation:    gen,
+		CreatedAt:     syntax.DatetimeNow().String(),
+		Count:         len(entries),
+		Payload:       payloadName(kind, gen),
+		PayloadSHA256: sum,
+	}
+	if kind == KindDiff {
+		m.Base = p.generation
+	}
+	if err := m.Sign(p.key); err != nil {
+		return nil, fmt.Errorf("signing snapshot manifest: %w", err)
+	}
+	mb, err := json.Marshal(&m)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []string
+	if kind == KindFull {
+		chain = []string{manifestName(kind, gen)}
+	} else {
+		chain = append(append([]string{}, p.chain...), manifestName(kind, gen))
+	}
+	idx := Index{
+		Version:   FormatVersion,
+		Head:      gen,
+		CreatedAt: m.CreatedAt,
+		Manifests: chain,
+	}
+	if err := idx.Sign(p.key); err != nil {
+		return nil, fmt.Errorf("signing snapshot index: %w", err)
+	}
+	ib, err := json.Marshal(&idx)
+	if err != nil {
+		return nil, err
+	}
+
+	// order matters: the index must only ever reference files which already exist
+	if err := p.store.Put(ctx, m.Payload, payload); err != nil {
+		return nil, fmt.Errorf("writing snapshot payload: %w", err)
+	}
+	if err := p.store.Put(ctx, manifestName(kind, gen), mb); err != nil {
+		return nil, fmt.Errorf("writing snapshot manifest: %w", err)
+	}
+	if err := p.store.Put(ctx, IndexFile, ib); err != nil {
+		return nil, fmt.Errorf("writing snapshot index: %w", err)
+	}
+
+	if kind == KindFull {
+		p.prune(ctx, p.prevChain)
+		p.prevChain = p.chain
+	}
+	p.generation = gen
+	p.published.Store(gen)
+	p.last = curMap
+	p.chain = chain
+	p.log.Info("published classification snapshot", "kind", kind, "generation", gen, "entries", len(entries))
+	if p.opts.OnPublish != nil {
+		p.opts.OnPublish(&m)
+	}
+	return &m, nil
+}
+
+// seed picks up the generation and chain from an index left in the store by an earlier process, so generations never go backwards and the old chain eventually gets pruned.
+func (p *Publisher) seed(ctx context.Context) error {
+	b, err := p.store.Get(ctx, IndexFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		p.seeded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading existing snapshot index: %w", err)
+	}
+	p.seeded = true
+
+	pub, err := p.key.PublicKey()
+	if err != nil {
+		return err
+	}
+	var idx Index
+	if err := json.Unmarshal(b, &idx); err != nil {
+		p.log.Warn("ignoring unparseable existing snapshot index", "err", err)
+		return nil
+	}
+	if err := idx.Verify(pub); err != nil {
+		p.log.Warn("ignoring existing snapshot index with bad signature", "err", err)
+		return nil
+	}
+	if idx.Head > p.generation {
+		p.generation = idx.Head
+	}
+	p.chain = idx.Manifests
+	return nil
+}
+
+// prune deletes the manifests and payloads of a chain which is no longer referenced. Failures are logged; a leftover file is harmless.
+func (p *Publisher) prune(ctx context.Context, chain []string) {
+	for _, name := range chain {
+		payload := strings.TrimSuffix(name, ".json") + ".jsonl.gz"
+		for _, n := range []string{name, payload} {
+			if err := p.store.Delete(ctx, n); err != nil {
+				p.log.Warn("failed to prune old snapshot file", "name", n, "err", err)
+			}
+		}
+	}
+}
+
+func diffEntries(prev map[string]sovereignty.Classification, current []sovereignty.Classification) []Entry {
+	var out []Entry
+	seen := make(map[string]bool, len(current))
+	for _, c := range current {
+		seen[c.DID] = true
+		old, ok := prev[c.DID]
+		if !ok || old != c {
+			out = append(out, Entry{Classification: c})
+		}
+	}
+	for did := range prev {
+		if !seen[did] {
+			out = append(out, Entry{Classification: sovereignty.Classification{DID: did}, Deleted: true})
+		}
+	}
+	return out
+}
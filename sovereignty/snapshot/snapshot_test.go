@@ -0,0 +1,421 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/sovereignty"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishAndLoad(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	priv, pub := testKey(t)
+
+	dir := t.TempDir()
+	src := sovereignty.NewTable()
+	src.Set(sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "test"})
+	src.Set(sovereignty.Classification{DID: "did:plc:bbb", Country: "US", Source: "test"})
+
+	p := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+	m, err := p.PublishOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(KindFull, m.Kind)
+	assert.Equal(2, m.Count)
+
+	// no changes means no new diff
+	m, err = p.PublishOnce(ctx)
+	assert.NoError(err)
+	assert.Nil(m)
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+
+	dst := sovereignty.NewTable()
+	l := NewLoader(srv.URL, pub)
+	n, err := l.Sync(ctx, dst)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.Equal(src.Snapshot(), dst.Snapshot())
+
+	src.Delete("did:plc:bbb")
+	src.Set(sovereignty.Classification{DID: "did:plc:ccc", Country: "CA", Source: "test"})
+	m, err = p.PublishOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(KindDiff, m.Kind)
+	assert.Equal(2, m.Count)
+
+	n, err = l.Sync(ctx, dst)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.Equal(src.Snapshot(), dst.Snapshot())
+
+	// already up to date
+	n, err = l.Sync(ctx, dst)
+	assert.NoError(err)
+	assert.Equal(0, n)
+
+	// manifests signed by some other key are rejected
+	_, otherPub := testKey(t)
+	_, err = NewLoader(srv.URL, otherPub).Sync(ctx, sovereignty.NewTable())
+	assert.Error(err)
+
+	// published files must be world-readable, since they get served
+	fi, err := os.Stat(filepath.Join(dir, IndexFile))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0644), fi.Mode().Perm())
+}
+
+func testKey(t *testing.T) (crypto.PrivateKey, crypto.PublicKey) {
+	priv, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub
+}
+
+func testClassification(did, country string) sovereignty.Classification {
+	return sovereignty.Classification{DID: did, Country: country, Source: "test"}
+}
+
+func TestRotationAndPruning(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	priv, pub := testKey(t)
+
+	dir := t.TempDir()
+	src := sovereignty.NewTable()
+	src.Set(testClassification("did:plc:aaa", "CA"))
+	var announced []int64
+	p := NewPublisher(src, &DirStore{Dir: dir}, priv, &PublisherOptions{
+		MaxDiffs:  2,
+		OnPublish: func(m *Manifest) { announced = append(announced, m.Generation) },
+	})
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	dst := sovereignty.NewTable()
+	l := NewLoader(srv.URL, pub)
+
+	var kinds []string
+	var full []*Manifest
+	for i := 0; i < 7; i++ {
+		src.Set(testClassification("did:plc:aaa", []string{"CA", "US"}[i%2]))
+		m, err := p.PublishOnce(ctx)
+		assert.NoError(err)
+		kinds = append(kinds, m.Kind)
+		if m.Kind == KindFull {
+			full = append(full, m)
+		}
+		_, err = l.Sync(ctx, dst)
+		assert.NoError(err)
+		assert.Equal(src.Snapshot(), dst.Snapshot())
+	}
+	assert.Equal([]string{KindFull, KindDiff, KindDiff, KindFull, KindDiff, KindDiff, KindFull}, kinds)
+	assert.Len(announced, 7)
+
+	// the current and previous chains are kept; anything older is pruned
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	assert.False(exists(manifestName(KindFull, full[0].Generation)))
+	assert.False(exists(full[0].Payload))
+	assert.True(exists(manifestName(KindFull, full[1].Generation)))
+	assert.True(exists(manifestName(KindFull, full[2].Generation)))
+}
+
+func TestPublisherRestart(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	priv, pub := testKey(t)
+
+	dir := t.TempDir()
+	src := sovereignty.NewTable()
+	src.Set(testClassification("did:plc:aaa", "CA"))
+	src.Set(testClassification("did:plc:bbb", "US"))
+	p1 := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+	m1, err := p1.PublishOnce(ctx)
+	assert.NoError(err)
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	dst := sovereignty.NewTable()
+	l := NewLoader(srv.URL, pub)
+	_, err = l.Sync(ctx, dst)
+	assert.NoError(err)
+
+	// a fresh process starts a new chain with a full snapshot, at a later generation even if the clock hasn't moved
+	src.Delete("did:plc:bbb")
+	p2 := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+	p2.generation = 0
+	m2, err := p2.PublishOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(KindFull, m2.Kind)
+	assert.Greater(m2.Generation, m1.Generation)
+
+	n, err := l.Sync(ctx, dst)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Equal(src.Snapshot(), dst.Snapshot())
+}
+
+func TestLoaderRejects(t *testing.T) {
+	ctx := context.Background()
+	priv, pub := testKey(t)
+
+	// publishes a full snapshot and two diffs, then lets the test mangle the files
+	setup := func(t *testing.T) (string, []*Manifest) {
+		dir := t.TempDir()
+		src := sovereignty.NewTable()
+		src.Set(testClassification("did:plc:aaa", "CA"))
+		p := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+		var ms []*Manifest
+		for _, country := range []string{"CA", "US", "FR"} {
+			src.Set(testClassification("did:plc:aaa", country))
+			m, err := p.PublishOnce(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms = append(ms, m)
+		}
+		return dir, ms
+	}
+	writeJSON := func(t *testing.T, path string, v any) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mangle func(t *testing.T, dir string, ms []*Manifest)
+		loader func(l *Loader)
+		errMsg string
+	}{
+		{
+			name: "payload hash mismatch",
+			mangle: func(t *testing.T, dir string, ms []*Manifest) {
+				payload, _, err := encodePayload([]Entry{{Classification: testClassification("did:plc:aaa", "ZZ")}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				os.WriteFile(filepath.Join(dir, ms[2].Payload), payload, 0644)
+			},
+			errMsg: "hash mismatch",
+		},
+		{
+			name: "tampered manifest",
+			mangle: func(t *testing.T, dir string, ms []*Manifest) {
+				m := *ms[1]
+				m.Count = 100
+				writeJSON(t, filepath.Join(dir, manifestName(m.Kind, m.Generation)), &m)
+			},
+			errMsg: "verifying snapshot manifest",
+		},
+		{
+			name: "tampered index",
+			mangle: func(t *testing.T, dir string, ms []*Manifest) {
+				idx := Index{Version: FormatVersion, Head: ms[0].Generation, Manifests: []string{manifestName(KindFull, ms[0].Generation)}}
+				if err := idx.Sign(priv); err != nil {
+					t.Fatal(err)
+				}
+				idx.Head = ms[2].Generation
+				writeJSON(t, filepath.Join(dir, IndexFile), &idx)
+			},
+			errMsg: "verifying snapshot index",
+		},
+		{
+			name: "broken chain",
+			mangle: func(t *testing.T, dir string, ms []*Manifest) {
+				idx := Index{
+					Version:   FormatVersion,
+					Head:      ms[2].Generation,
+					Manifests: []string{manifestName(KindFull, ms[0].Generation), manifestName(KindDiff, ms[2].Generation)},
+				}
+				if err := idx.Sign(priv); err != nil {
+					t.Fatal(err)
+				}
+				writeJSON(t, filepath.Join(dir, IndexFile), &idx)
+			},
+			errMsg: "broken snapshot chain",
+		},
+		{
+			name: "truncated chain",
+			mangle: func(t *testing.T, dir string, ms []*Manifest) {
+				idx := Index{
+					Version:   FormatVersion,
+					Head:      ms[2].Generation,
+					Manifests: []string{manifestName(KindFull, ms[0].Generation), manifestName(KindDiff, ms[1].Generation)},
+				}
+				if err := idx.Sign(priv); err != nil {
+					t.Fatal(err)
+				}
+				writeJSON(t, filepath.Join(dir, IndexFile), &idx)
+			},
+			errMsg: "does not match chain head",
+		},
+		{
+			name:   "decompressed payload too large",
+			loader: func(l *Loader) { l.MaxDecodedBytes = 10 },
+			errMsg: "too large",
+		},
+		{
+			name:   "payload too large",
+			loader: func(l *Loader) { l.MaxPayloadBytes = 10 },
+			errMsg: "too large",
+		},
+		{
+			name:   "stale index",
+			loader: func(l *Loader) { l.MaxAge = time.Nanosecond },
+			errMsg: "stale",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			dir, ms := setup(t)
+			if tc.mangle != nil {
+				tc.mangle(t, dir, ms)
+			}
+			srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+			defer srv.Close()
+
+			dst := sovereignty.NewTable()
+			dst.Set(testClassification("did:plc:zzz", "CA"))
+			before := dst.Snapshot()
+
+			l := NewLoader(srv.URL, pub)
+			if tc.loader != nil {
+				tc.loader(l)
+			}
+			_, err := l.Sync(ctx, dst)
+			if assert.Error(err) {
+				assert.Contains(err.Error(), tc.errMsg)
+			}
+			// a failed sync leaves the table untouched
+			assert.Equal(before, dst.Snapshot())
+			assert.Equal(int64(0), l.Generation)
+		})
+	}
+}
+
+func TestLoaderRollback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	priv, pub := testKey(t)
+
+	dir := t.TempDir()
+	src := sovereignty.NewTable()
+	src.Set(testClassification("did:plc:aaa", "CA"))
+	p := NewPublisher(src, &DirStore{Dir: dir}, priv, nil)
+	_, err := p.PublishOnce(ctx)
+	assert.NoError(err)
+	oldIndex, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	assert.NoError(err)
+
+	src.Set(testClassification("did:plc:aaa", "US"))
+	_, err = p.PublishOnce(ctx)
+	assert.NoError(err)
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	dst := sovereignty.NewTable()
+	l := NewLoader(srv.URL, pub)
+	_, err = l.Sync(ctx, dst)
+	assert.NoError(err)
+
+	// replaying an older (validly signed) index is an error, not a silent no-op
+	assert.NoError(os.WriteFile(filepath.Join(dir, IndexFile), oldIndex, 0644))
+	_, err = l.Sync(ctx, dst)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "rolled back")
+	}
+	c, _ := dst.Get("did:plc:aaa")
+	assert.Equal("US", c.Country)
+}
+
+// memServer is a minimal object store accepting PUT, GET and DELETE
+type memServer struct {
+	lk    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *memServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		s.files[name] = b
+	case http.MethodDelete:
+		delete(s.files, name)
+	case http.MethodGet:
+		b, ok := s.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	priv, pub := testKey(t)
+
+	srv := httptest.NewServer(&memServer{files: make(map[string][]byte)})
+	defer srv.Close()
+
+	src := sovereignty.NewTable()
+	src.Set(testClassification("did:plc:aaa", "CA"))
+
+	// missing auth header fails the upload
+	p := NewPublisher(src, &HTTPStore{BaseURL: srv.URL}, priv, nil)
+	_, err := p.PublishOnce(ctx)
+	assert.Error(err)
+
+	store := &HTTPStore{BaseURL: srv.URL + "/", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	p = NewPublisher(src, store, priv, nil)
+	_, err = p.PublishOnce(ctx)
+	assert.NoError(err)
+
+	dst := sovereignty.NewTable()
+	n, err := NewLoader(srv.URL, pub).Sync(ctx, dst)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Equal(src.Snapshot(), dst.Snapshot())
+
+	assert.NoError(store.Delete(ctx, IndexFile))
+	assert.NoError(store.Delete(ctx, IndexFile))
+	_, err = store.Get(ctx, IndexFile)
+	assert.ErrorIs(err, os.ErrNotExist)
+}
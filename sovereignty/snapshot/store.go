@@ -0,0 +1,152 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store is a destination for published snapshot files. Files are small in number and written whole; names are flat (no directories).
+//
+// Get must return an error wrapping fs.ErrNotExist for missing files, and Delete of a missing file is not an error.
+type Store interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// DirStore writes snapshot files to a local directory, which can then be served over HTTP (eg, with http.FileServer).
+type DirStore struct {
+	Dir string
+}
+
+func (s *DirStore) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	// write to a temporary file and rename, so readers never observe a partial file
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp uses 0600, but these files are meant to be served
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+func (s *DirStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, name))
+}
+
+func (s *DirStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.Dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// HTTPStore uploads snapshot files with HTTP PUT requests, relative to a base URL. This works with S3-compatible object stores (behind pre-signed or proxy auth), WebDAV, and similar.
+type HTTPStore struct {
+	BaseURL string
+	Client  *http.Client
+	// optional extra headers (eg, "Authorization") to include in every request
+	Headers map[string]string
+}
+
+func (s *HTTPStore) Put(ctx context.Context, name string, data []byte) error {
+	req, err := s.newRequest(ctx, http.MethodPut, name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, ".json") {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/gzip")
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("snapshot upload failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPStore) Get(ctx context.Context, name string) ([]byte, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("snapshot file %s: %w", name, fs.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("snapshot fetch failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, DefaultMaxManifestBytes))
+}
+
+func (s *HTTPStore) Delete(ctx context.Context, name string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("snapshot delete failed (%s): HTTP %d", name, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPStore) newRequest(ctx context.Context, method, name string, body io.Reader) (*http.Request, error) {
+	u := strings.TrimSuffix(s.BaseURL, "/") + "/" + name
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (s *HTTPStore) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
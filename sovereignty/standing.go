@@ -0,0 +1,118 @@
+package sovereignty
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/sovereignty/i18n"
+)
+
+// Standing explains whether an account is carried on the sovereign stream, and why.
+type Standing struct {
+	DID            string          `json:"did"`
+	Classification *Classification `json:"classification,omitempty"`
+	Included       bool            `json:"included"`
+	// human-readable signals behind the decision, in the order they were considered
+	Reasons []string `json:"reasons"`
+}
+
+// StandingInput is the state relevant to a single account's standing.
+type StandingInput struct {
+	DID            string
+	Classification *Classification
+	// countries carried on the sovereign stream
+	StreamCountries map[string]bool
+	// subdivisions carried on the sovereign stream, by region (eg, "CA-QC")
+	StreamSubdivisions map[string]bool
+	// countries left out of the sovereign stream, which carries all other accounts; when set, StreamCountries and StreamSubdivisions are empty
+	ExcludeCountries map[string]bool
+	// account is a designated priority account
+	Priority bool
+	// account is on the operator's list of accounts in country, or out of country
+	ListedIn  bool
+	ListedOut bool
+	// account's record content is withheld on the sovereign stream
+	HashOnly bool
+	// problems found in the account's identity (DID operation) history, as a trust signal
+	IdentityFlags []string
+	// language the reasons are written in; empty for English
+	Lang i18n.Lang
+}
+
+// Explain computes an account's Standing, mirroring the relay's sovereign stream filter.
+func Explain(in StandingInput) Standing {
+	s := Standing{
+		DID:            in.DID,
+		Classification: in.Classification,
+		Reasons:        []string{},
+	}
+
+	if in.Priority {
+		s.Included = true
+		s.Reasons = append(s.Reasons, i18n.Translate(in.Lang, "designated as a priority account, which is always carried"))
+	}
+	switch {
+	case in.ListedOut:
+		s.Reasons = append(s.Reasons, i18n.Translate(in.Lang, "listed as out of country by the relay operator, which overrides its classification"))
+	case in.ListedIn:
+		s.Included = true
+		s.Reasons = append(s.Reasons, i18n.Translate(in.Lang, "listed as in country by the relay operator, which is always carried"))
+	}
+
+	if c := in.Classification; c != nil {
+		source := c.Source
+		if source == "" {
+			source = i18n.Translate(in.Lang, "unspecified")
+		}
+		s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "classified as %s (source: %s, updated %s)", c.Region(), source, i18n.FormatDate(in.Lang, c.UpdatedAt)))
+		switch {
+		case len(in.ExcludeCountries) > 0 && in.ExcludeCountries[c.Country]:
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "%s is excluded from the sovereign stream", c.Country))
+		case len(in.ExcludeCountries) > 0:
+			s.Included = true
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "the sovereign stream carries all accounts except those of excluded countries (excluded: %s)", countryList(in.Lang, in.ExcludeCountries)))
+		case in.StreamCountries[c.Country]:
+			s.Included = true
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "%s is carried on the sovereign stream", c.Country))
+		case c.Subdivision != "" && in.StreamSubdivisions[c.Region()]:
+			s.Included = true
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "%s is carried on the sovereign stream", c.Region()))
+		default:
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "%s is not carried on the sovereign stream (carried: %s)", c.Region(), countryList(in.Lang, in.StreamCountries, in.StreamSubdivisions)))
+		}
+	} else {
+		s.Reasons = append(s.Reasons, i18n.Translate(in.Lang, "not classified to any country"))
+		if len(in.ExcludeCountries) > 0 {
+			s.Included = true
+			s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "the sovereign stream carries all accounts except those of excluded countries (excluded: %s)", countryList(in.Lang, in.ExcludeCountries)))
+		}
+	}
+
+	if in.ListedOut && !in.Priority {
+		s.Included = false
+	}
+
+	for _, f := range in.IdentityFlags {
+		s.Reasons = append(s.Reasons, i18n.Sprintf(in.Lang, "identity history flagged: %s", f))
+	}
+
+	if s.Included && in.HashOnly {
+		s.Reasons = append(s.Reasons, i18n.Translate(in.Lang, "record content is withheld, only record hashes are carried"))
+	}
+	return s
+}
+
+// countryList lists the carried (or excluded) countries and subdivisions
+func countryList(l i18n.Lang, sets ...map[string]bool) string {
+	var out []string
+	for _, m := range sets {
+		for c := range m {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return i18n.Translate(l, "none")
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,4 @@
+// Per-account and per-PDS accounting of the events the relay processes.
+//
+// A Tracker counts events and their bytes by account (DID) and by PDS over a rolling window, divided into buckets which expire one at a time, so the counts cover the last Window to within one bucket. Top reports the accounts or hosts with the most traffic in the window ("top talkers"). An account whose share of the window's bytes reaches DominantShare dominates; its Policy decides what is done about it (flagged for review, or rate limited), until its share falls back below the threshold.
+package talkers
@@ -0,0 +1,16 @@
+package talkers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var dominantGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "talkers_dominant_accounts",
+	Help: "Accounts currently dominating the window's event bytes, by the action taken (review or limit)",
+}, []string{"action"})
+
+var trackedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "talkers_tracked_keys",
+	Help: "Accounts and PDS hosts with events in the current window, by kind (account or pds)",
+}, []string{"kind"})
@@ -0,0 +1,355 @@
+package talkers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+)
+
+// Kind is what usage is counted by.
+type Kind string
+
+const (
+	KindAccount Kind = "account"
+	KindPDS     Kind = "pds"
+)
+
+// Action is what is done about an account which dominates the window.
+type Action string
+
+const (
+	ActionNone Action = ""
+	// flagged for an operator to look at; its events are unaffected
+	ActionReview Action = "review"
+	// its events are withheld from the sovereign stream while it dominates
+	ActionLimit Action = "limit"
+)
+
+// ParseAction parses an action by name (review or limit)
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionReview, ActionLimit:
+		return a, nil
+	default:
+		return ActionNone, fmt.Errorf("invalid action: %q (must be review or limit)", s)
+	}
+}
+
+// Usage is the traffic of an account or PDS host over the window.
+type Usage struct {
+	Key    string `json:"key"`
+	Events int64  `json:"events"`
+	Bytes  int64  `json:"bytes"`
+	// fraction of all bytes in the window
+	Share float64 `json:"share"`
+	// what is being done about the account, if it dominates the window
+	Action Action `json:"action,omitempty"`
+}
+
+// Policy decides what to do about an account which dominates the window.
+type Policy interface {
+	Dominant(u Usage) Action
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(u Usage) Action
+
+func (f PolicyFunc) Dominant(u Usage) Action {
+	return f(u)
+}
+
+type Options struct {
+	Window time.Duration
+	// the window is expired one bucket at a time
+	Buckets int
+	// share of the window's bytes at which an account dominates; 0 disables the policy
+	DominantShare float64
+	// nobody dominates a window with fewer bytes than this
+	MinBytes int64
+	// nil flags dominant accounts for review; a policy may also return ActionNone to leave the account be
+	Policy Policy
+	// called, outside the tracker's lock, when an account starts dominating (with the action taken) or stops
+	OnChange func(u Usage, dominant bool)
+	// time source for the window; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Window:        time.Hour,
+		Buckets:       60,
+		DominantShare: 0.05,
+		MinBytes:      64 << 20,
+	}
+}
+
+type stat struct {
+	events int64
+	bytes  int64
+}
+
+// counts for one Kind: running totals over the window, and the part of them in each bucket
+type dimension struct {
+	totals  map[string]*stat
+	buckets []map[string]*stat
+}
+
+func newDimension(n int) *dimension {
+	d := &dimension{totals: make(map[string]*stat), buckets: make([]map[string]*stat, n)}
+	for i := range d.buckets {
+		d.buckets[i] = make(map[string]*stat)
+	}
+	return d
+}
+
+func (d *dimension) add(bucket int, key string, bytes int64) *stat {
+	b := d.buckets[bucket][key]
+	if b == nil {
+		b = &stat{}
+		d.buckets[bucket][key] = b
+	}
+	b.events++
+	b.bytes += bytes
+	t := d.totals[key]
+	if t == nil {
+		t = &stat{}
+		d.totals[key] = t
+	}
+	t.events++
+	t.bytes += bytes
+	return t
+}
+
+func (d *dimension) expire(bucket int) {
+	for key, b := range d.buckets[bucket] {
+		t := d.totals[key]
+		t.events -= b.events
+		t.bytes -= b.bytes
+		if t.events <= 0 {
+			delete(d.totals, key)
+		}
+	}
+	d.buckets[bucket] = make(map[string]*stat)
+}
+
+// Tracker counts events by account and PDS over a rolling window. It is safe for concurrent use.
+type Tracker struct {
+	opts      Options
+	clock     clock.Clock
+	bucketDur time.Duration
+
+	lk       sync.Mutex
+	cur      int
+	curStart time.Time
+	accounts *dimension
+	hosts    *dimension
+	total    stat
+	totals   []stat
+
+	// accounts currently dominating, and the action taken; separately locked, as the sovereign filter checks it for every event
+	domLk    sync.RWMutex
+	dominant map[string]Action
+}
+
+func NewTracker(opts Options) *Tracker {
+	opts.Buckets = max(opts.Buckets, 1)
+	t := &Tracker{
+		opts:      opts,
+		clock:     clock.OrSystem(opts.Clock),
+		bucketDur: max(opts.Window/time.Duration(opts.Buckets), 1),
+		accounts:  newDimension(opts.Buckets),
+		hosts:     newDimension(opts.Buckets),
+		totals:    make([]stat, opts.Buckets),
+		dominant:  make(map[string]Action),
+	}
+	t.curStart = t.clock.Now()
+	return t
+}
+
+// Window returns the length of the window usage is counted over.
+func (t *Tracker) Window() time.Duration {
+	return t.bucketDur * time.Duration(t.opts.Buckets)
+}
+
+// Add counts an event of the given size by the account, from the PDS host.
+func (t *Tracker) Add(did, host string, bytes int64) {
+	t.lk.Lock()
+	changes := t.advance()
+	u := t.accounts.add(t.cur, did, bytes)
+	if host != "" {
+		t.hosts.add(t.cur, host, bytes)
+	}
+	t.total.events++
+	t.total.bytes += bytes
+	t.totals[t.cur].events++
+	t.totals[t.cur].bytes += bytes
+	usage := t.usage(did, u)
+	dominant := t.isDominant(usage, t.total.bytes)
+	t.lk.Unlock()
+
+	if dominant {
+		t.domLk.RLock()
+		_, already := t.dominant[did]
+		t.domLk.RUnlock()
+		if !already {
+			changes = append(changes, t.setDominant(usage))
+		}
+	}
+	t.notify(changes)
+}
+
+type change struct {
+	usage    Usage
+	dominant bool
+}
+
+// advance expires the buckets which have left the window, and returns the accounts which stopped dominating. Must be called with t.lk held
+func (t *Tracker) advance() []change {
+	now := t.clock.Now()
+	expired := false
+	for i := 0; i < t.opts.Buckets && now.Sub(t.curStart) >= t.bucketDur; i++ {
+		t.cur = (t.cur + 1) % t.opts.Buckets
+		t.accounts.expire(t.cur)
+		t.hosts.expire(t.cur)
+		t.total.events -= t.totals[t.cur].events
+		t.total.bytes -= t.totals[t.cur].bytes
+		t.totals[t.cur] = stat{}
+		t.curStart = t.curStart.Add(t.bucketDur)
+		expired = true
+	}
+	if now.Sub(t.curStart) >= t.bucketDur {
+		// idle for longer than the window: every bucket has been cleared
+		t.curStart = now
+	}
+	if !expired {
+		return nil
+	}
+	trackedGauge.WithLabelValues(string(KindAccount)).Set(float64(len(t.accounts.totals)))
+	trackedGauge.WithLabelValues(string(KindPDS)).Set(float64(len(t.hosts.totals)))
+
+	t.domLk.Lock()
+	defer t.domLk.Unlock()
+	var changes []change
+	for did, action := range t.dominant {
+		u := t.usage(did, t.accounts.totals[did])
+		if t.isDominant(u, t.total.bytes) {
+			continue
+		}
+		delete(t.dominant, did)
+		if action != ActionNone {
+			dominantGauge.WithLabelValues(string(action)).Dec()
+		}
+		changes = append(changes, change{usage: u, dominant: false})
+	}
+	return changes
+}
+
+// usage returns an account's usage from its window totals, which may be nil. Must be called with t.lk held
+func (t *Tracker) usage(key string, s *stat) Usage {
+	u := Usage{Key: key}
+	if s != nil {
+		u.Events = s.events
+		u.Bytes = s.bytes
+	}
+	if t.total.bytes > 0 {
+		u.Share = float64(u.Bytes) / float64(t.total.bytes)
+	}
+	return u
+}
+
+// isDominant reports whether the usage dominates a window of windowBytes
+func (t *Tracker) isDominant(u Usage, windowBytes int64) bool {
+	return t.opts.DominantShare > 0 && windowBytes >= t.opts.MinBytes && u.Bytes > 0 && u.Share >= t.opts.DominantShare
+}
+
+func (t *Tracker) setDominant(u Usage) change {
+	action := ActionReview
+	if t.opts.Policy != nil {
+		action = t.opts.Policy.Dominant(u)
+	}
+	u.Action = action
+	t.domLk.Lock()
+	defer t.domLk.Unlock()
+	if _, ok := t.dominant[u.Key]; ok {
+		return change{}
+	}
+	t.dominant[u.Key] = action
+	if action != ActionNone {
+		dominantGauge.WithLabelValues(string(action)).Inc()
+	}
+	return change{usage: u, dominant: true}
+}
+
+func (t *Tracker) notify(changes []change) {
+	if t.opts.OnChange == nil {
+		return
+	}
+	for _, c := range changes {
+		if c.usage.Key != "" {
+			t.opts.OnChange(c.usage, c.dominant)
+		}
+	}
+}
+
+// Limited returns true if the account's events are being withheld from the sovereign stream.
+func (t *Tracker) Limited(did string) bool {
+	t.domLk.RLock()
+	defer t.domLk.RUnlock()
+	return t.dominant[did] == ActionLimit
+}
+
+// Top returns the n accounts or hosts with the most bytes (or, if byEvents, the most events) in the window, and the window's totals.
+func (t *Tracker) Top(kind Kind, n int, byEvents bool) ([]Usage, Usage) {
+	t.lk.Lock()
+	changes := t.advance()
+	d := t.accounts
+	if kind == KindPDS {
+		d = t.hosts
+	}
+	out := make([]Usage, 0, len(d.totals))
+	for key, s := range d.totals {
+		out = append(out, t.usage(key, s))
+	}
+	total := Usage{Events: t.total.events, Bytes: t.total.bytes, Share: 1}
+	t.lk.Unlock()
+	t.notify(changes)
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if byEvents && a.Events != b.Events {
+			return a.Events > b.Events
+		}
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Events != b.Events {
+			return a.Events > b.Events
+		}
+		return a.Key < b.Key
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	if kind == KindAccount {
+		t.domLk.RLock()
+		for i := range out {
+			out[i].Action = t.dominant[out[i].Key]
+		}
+		t.domLk.RUnlock()
+	}
+	return out, total
+}
+
+// Dominant returns the accounts currently dominating the window, and the action taken about each.
+func (t *Tracker) Dominant() map[string]Action {
+	t.domLk.RLock()
+	defer t.domLk.RUnlock()
+	out := make(map[string]Action, len(t.dominant))
+	for k, v := range t.dominant {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package talkers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	assert := assert.New(t)
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var changes []Usage
+	opts := Options{
+		Window:        time.Hour,
+		Buckets:       6,
+		DominantShare: 0.5,
+		MinBytes:      1000,
+		Policy: PolicyFunc(func(u Usage) Action {
+			if u.Key == "did:plc:bulk" {
+				return ActionLimit
+			}
+			return ActionReview
+		}),
+		OnChange: func(u Usage, dominant bool) {
+			if !dominant {
+				u.Action = ActionNone
+			}
+			changes = append(changes, u)
+		},
+		Clock: clk,
+	}
+	tr := NewTracker(opts)
+
+	// nobody dominates until the window holds MinBytes
+	tr.Add("did:plc:bulk", "pds.example.ca", 600)
+	assert.Empty(changes)
+	tr.Add("did:plc:alice", "pds.example.ca", 100)
+	tr.Add("did:plc:bob", "pds.example.com", 300)
+	assert.False(tr.Limited("did:plc:bulk"))
+	tr.Add("did:plc:bulk", "pds.example.ca", 100)
+	assert.True(tr.Limited("did:plc:bulk"))
+	assert.Len(changes, 1)
+	assert.Equal(Usage{Key: "did:plc:bulk", Events: 2, Bytes: 700, Share: 700.0 / 1100, Action: ActionLimit}, changes[0])
+
+	top, total := tr.Top(KindAccount, 2, false)
+	assert.Equal(Usage{Events: 4, Bytes: 1100, Share: 1}, total)
+	assert.Equal([]string{"did:plc:bulk", "did:plc:bob"}, keys(top))
+	assert.Equal(ActionLimit, top[0].Action)
+	hosts, _ := tr.Top(KindPDS, 10, false)
+	assert.Equal([]string{"pds.example.ca", "pds.example.com"}, keys(hosts))
+	assert.Equal(int64(800), hosts[0].Bytes)
+
+	// bob's later traffic overtakes, and bulk's first events leave the window
+	clk.Advance(30 * time.Minute)
+	for i := 0; i < 10; i++ {
+		tr.Add("did:plc:bob", "pds.example.com", 200)
+	}
+	assert.Equal(map[string]Action{"did:plc:bulk": ActionLimit, "did:plc:bob": ActionReview}, tr.Dominant())
+	byEvents, _ := tr.Top(KindAccount, 1, true)
+	assert.Equal("did:plc:bob", byEvents[0].Key)
+
+	clk.Advance(40 * time.Minute)
+	top, total = tr.Top(KindAccount, 10, false)
+	assert.Equal(Usage{Events: 10, Bytes: 2000, Share: 1}, total)
+	assert.Equal([]string{"did:plc:bob"}, keys(top))
+	assert.False(tr.Limited("did:plc:bulk"))
+	assert.Len(changes, 3)
+	assert.Equal("did:plc:bulk", changes[2].Key)
+
+	// an idle window empties
+	clk.Advance(2 * time.Hour)
+	top, total = tr.Top(KindAccount, 10, false)
+	assert.Empty(top)
+	assert.Equal(int64(0), total.Events)
+	assert.Empty(tr.Dominant())
+}
+
+func keys(us []Usage) []string {
+	var out []string
+	for _, u := range us {
+		out = append(out, u.Key)
+	}
+	return out
+}
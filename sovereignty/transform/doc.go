@@ -0,0 +1,4 @@
+// Outbound record transformation for the sovereign stream.
+//
+// A Pipeline applies per-collection rules to the records in #commit events before they are emitted: removing fields (or array elements with a matching $type), or rewriting strings matching a pattern. Modified records are re-encoded with new CIDs, and the event carries a FrameMeta, signed by the relay, listing the original and new CID of each modified record.
+package transform
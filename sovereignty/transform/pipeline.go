@@ -0,0 +1,301 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+)
+
+// Pipeline applies a set of rules to outbound events.
+type Pipeline struct {
+	rules []Rule
+	key   crypto.PrivateKey
+}
+
+// NewPipeline validates the rules and returns a pipeline which signs FrameMeta with the given key.
+func NewPipeline(rules []Rule, key crypto.PrivateKey) (*Pipeline, error) {
+	if key == nil {
+		return nil, fmt.Errorf("record transformation requires a signing key")
+	}
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{rules: compiled, key: key}, nil
+}
+
+// ValidateRules checks that all rules are well-formed, without building a pipeline.
+func ValidateRules(rules []Rule) error {
+	_, err := compileRules(rules)
+	return err
+}
+
+func compileRules(rules []Rule) ([]Rule, error) {
+	compiled := make([]Rule, len(rules))
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+		compiled[i] = r
+	}
+	return compiled, nil
+}
+
+// TransformRecord applies all matching rules to a decoded record, in place. Returns the names of the rules which changed anything.
+func (p *Pipeline) TransformRecord(collection string, rec map[string]any) []string {
+	var applied []string
+	for i := range p.rules {
+		r := &p.rules[i]
+		if !r.matchesCollection(collection) {
+			continue
+		}
+		if r.apply(rec) {
+			applied = append(applied, r.Name)
+		}
+	}
+	return applied
+}
+
+// TransformEvent returns the event as it should be emitted. Events without modified records are returned unchanged; otherwise a copy is returned with rewritten blocks, updated op CIDs, and a signed FrameMeta (extending any FrameMeta the event already had). The input event is never mutated, since it is shared with other subscribers.
+func (p *Pipeline) TransformEvent(evt *events.XRPCStreamEvent) (*events.XRPCStreamEvent, error) {
+	if len(p.rules) == 0 {
+		return evt, nil
+	}
+	return RewriteEvent(evt, p.key, p.anyRuleFor, func(recs []Record) map[string][]string {
+		applied := make(map[string][]string)
+		for _, r := range recs {
+			if names := p.TransformRecord(collectionOf(r.Path), r.Value); len(names) > 0 {
+				applied[r.Path] = names
+			}
+		}
+		return applied
+	})
+}
+
+// Record is a record written by an op of a commit, decoded for rewriting.
+type Record struct {
+	Path  string
+	Value map[string]any
+}
+
+// RewriteEvent rewrites the records a #commit event writes, as TransformEvent does with a pipeline's rules. The records of collections relevant reports true for are decoded and passed to rewrite, which modifies them in place, and returns the names of what changed each modified record, by path. Records which can't be decoded are passed through untouched. The FrameMeta is signed with key.
+func RewriteEvent(evt *events.XRPCStreamEvent, key crypto.PrivateKey, relevant func(collection string) bool, rewrite func([]Record) map[string][]string) (*events.XRPCStreamEvent, error) {
+	if evt.RepoCommit == nil {
+		return evt, nil
+	}
+	commit := evt.RepoCommit
+
+	// only bother decoding the CAR if some op might be affected
+	affected := false
+	for _, op := range commit.Ops {
+		if op.Cid != nil && relevant(collectionOf(op.Path)) {
+			affected = true
+			break
+		}
+	}
+	if !affected {
+		return evt, nil
+	}
+
+	cr, err := car.NewCarReader(bytes.NewReader(commit.Blocks))
+	if err != nil {
+		return nil, fmt.Errorf("reading commit blocks: %w", err)
+	}
+	var order []cid.Cid
+	blocks := make(map[cid.Cid][]byte)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit blocks: %w", err)
+		}
+		if _, ok := blocks[blk.Cid()]; !ok {
+			order = append(order, blk.Cid())
+		}
+		blocks[blk.Cid()] = blk.RawData()
+	}
+
+	var recs []Record
+	for _, op := range commit.Ops {
+		if op.Cid == nil || !relevant(collectionOf(op.Path)) {
+			continue
+		}
+		raw, ok := blocks[cid.Cid(*op.Cid)]
+		if !ok {
+			continue
+		}
+		rec, err := data.UnmarshalCBOR(raw)
+		if err != nil {
+			// not something we can safely rewrite; pass it through untouched
+			continue
+		}
+		recs = append(recs, Record{Path: op.Path, Value: rec})
+	}
+	if len(recs) == 0 {
+		return evt, nil
+	}
+	applied := rewrite(recs)
+	if len(applied) == 0 {
+		return evt, nil
+	}
+	rewritten := make(map[string]map[string]any, len(applied))
+	for _, r := range recs {
+		if len(applied[r.Path]) > 0 {
+			rewritten[r.Path] = r.Value
+		}
+	}
+
+	var modified []events.ModifiedOp
+	newOps := make([]*comatproto.SyncSubscribeRepos_RepoOp, len(commit.Ops))
+	builder := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256)
+	for i, op := range commit.Ops {
+		newOps[i] = op
+		rec, ok := rewritten[op.Path]
+		if op.Cid == nil || !ok {
+			continue
+		}
+		orig := cid.Cid(*op.Cid)
+		out, err := data.MarshalCBOR(rec)
+		if err != nil {
+			return nil, fmt.Errorf("re-encoding transformed record %s: %w", op.Path, err)
+		}
+		nc, err := builder.Sum(out)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := blocks[nc]; !ok {
+			order = append(order, nc)
+		}
+		blocks[nc] = out
+
+		cp := *op
+		link := lexutil.LexLink(nc)
+		cp.Cid = &link
+		newOps[i] = &cp
+		modified = append(modified, events.ModifiedOp{
+			Path:  op.Path,
+			Orig:  orig.String(),
+			Cid:   nc.String(),
+			Rules: applied[op.Path],
+		})
+	}
+	if len(modified) == 0 {
+		return evt, nil
+	}
+
+	// original record blocks are dropped, so the untransformed content never leaves the relay
+	dropped := make(map[cid.Cid]bool)
+	for _, m := range modified {
+		c, _ := cid.Decode(m.Orig)
+		dropped[c] = true
+	}
+	for _, op := range newOps {
+		if op.Cid != nil {
+			delete(dropped, cid.Cid(*op.Cid))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: cr.Header.Roots, Version: 1}, &buf); err != nil {
+		return nil, err
+	}
+	for _, c := range order {
+		if dropped[c] {
+			continue
+		}
+		if err := carutil.LdWrite(&buf, c.Bytes(), blocks[c]); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := &events.FrameMeta{
+		Repo: commit.Repo,
+		Seq:  commit.Seq,
+	}
+	if evt.Meta != nil {
+		// keep annotations from earlier stages
+		*meta = *evt.Meta
+	}
+	meta.Modified = append(append([]events.ModifiedOp{}, meta.Modified...), modified...)
+	if err := SignMeta(meta, key); err != nil {
+		return nil, err
+	}
+
+	newCommit := *commit
+	newCommit.Ops = newOps
+	newCommit.Blocks = buf.Bytes()
+	return &events.XRPCStreamEvent{
+		RepoCommit: &newCommit,
+		Meta:       meta,
+		PrivUid:    evt.PrivUid,
+	}, nil
+}
+
+func (p *Pipeline) anyRuleFor(collection string) bool {
+	for i := range p.rules {
+		if p.rules[i].matchesCollection(collection) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectionOf(path string) string {
+	collection, _, _ := strings.Cut(path, "/")
+	return collection
+}
+
+func metaSigningBytes(meta *events.FrameMeta) ([]byte, error) {
+	unsigned := *meta
+	unsigned.Sig = nil
+	var buf bytes.Buffer
+	if err := unsigned.MarshalCBOR(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SignMeta sets the Signer and Sig fields of the frame metadata.
+func SignMeta(meta *events.FrameMeta, key crypto.PrivateKey) error {
+	pub, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	meta.Signer = pub.DIDKey()
+	b, err := metaSigningBytes(meta)
+	if err != nil {
+		return err
+	}
+	sig, err := key.HashAndSign(b)
+	if err != nil {
+		return err
+	}
+	meta.Sig = sig
+	return nil
+}
+
+// VerifyMeta checks the frame metadata signature against the relay's public key.
+func VerifyMeta(meta *events.FrameMeta, pub crypto.PublicKey) error {
+	if meta.Signer != pub.DIDKey() {
+		return fmt.Errorf("frame metadata signed by unexpected key: %s", meta.Signer)
+	}
+	b, err := metaSigningBytes(meta)
+	if err != nil {
+		return err
+	}
+	return pub.HashAndVerify(b, meta.Sig)
+}
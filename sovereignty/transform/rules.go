@@ -0,0 +1,192 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// delete the field at Path; if the field is an array and Type is set, only remove elements with a matching $type
+	ActionRemove = "remove"
+	// replace matches of Pattern in string values at Path (or anywhere under it)
+	ActionReplace = "replace"
+)
+
+// Rule is a single transformation, as loaded from configuration.
+type Rule struct {
+	Name string `json:"name"`
+	// NSID of the collection this applies to; a trailing "*" matches any collection with that prefix
+	Collection string `json:"collection"`
+	// dot-separated field path; arrays along the path are traversed element-wise. Empty means the whole record.
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	// for ActionRemove on arrays: glob (path.Match syntax) for the $type of elements to remove
+	Type string `json:"type,omitempty"`
+	// for ActionReplace: regular expression to match
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// LoadRules reads a JSON array of rules from a file.
+func LoadRules(fname string) ([]Rule, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parsing transformation rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("transformation rule missing name")
+	}
+	if r.Collection == "" {
+		return fmt.Errorf("transformation rule %s: missing collection", r.Name)
+	}
+	switch r.Action {
+	case ActionRemove:
+		if r.Path == "" {
+			return fmt.Errorf("transformation rule %s: remove requires a path", r.Name)
+		}
+		if r.Type != "" {
+			if _, err := path.Match(r.Type, ""); err != nil {
+				return fmt.Errorf("transformation rule %s: invalid type glob: %w", r.Name, err)
+			}
+		}
+	case ActionReplace:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("transformation rule %s: invalid pattern: %w", r.Name, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("transformation rule %s: unknown action %q", r.Name, r.Action)
+	}
+	return nil
+}
+
+func (r *Rule) matchesCollection(collection string) bool {
+	if prefix, ok := strings.CutSuffix(r.Collection, "*"); ok {
+		return strings.HasPrefix(collection, prefix)
+	}
+	return r.Collection == collection
+}
+
+// apply transforms the record in place, returning true if anything changed
+func (r *Rule) apply(rec map[string]any) bool {
+	if r.Path == "" {
+		// only allowed for ActionReplace
+		return r.replaceIn(rec)
+	}
+	return r.walk(rec, strings.Split(r.Path, "."))
+}
+
+// walk descends to the parent of the last path segment, then acts on it
+func (r *Rule) walk(val any, segs []string) bool {
+	switch v := val.(type) {
+	case []any:
+		changed := false
+		for _, elem := range v {
+			if r.walk(elem, segs) {
+				changed = true
+			}
+		}
+		return changed
+	case map[string]any:
+		if len(segs) == 1 {
+			return r.act(v, segs[0])
+		}
+		child, ok := v[segs[0]]
+		if !ok {
+			return false
+		}
+		return r.walk(child, segs[1:])
+	default:
+		return false
+	}
+}
+
+func (r *Rule) act(obj map[string]any, field string) bool {
+	val, ok := obj[field]
+	if !ok {
+		return false
+	}
+	switch r.Action {
+	case ActionRemove:
+		arr, isArr := val.([]any)
+		if r.Type == "" || !isArr {
+			delete(obj, field)
+			return true
+		}
+		kept := make([]any, 0, len(arr))
+		for _, elem := range arr {
+			if m, ok := elem.(map[string]any); ok {
+				if t, ok := m["$type"].(string); ok {
+					if match, _ := path.Match(r.Type, t); match {
+						continue
+					}
+				}
+			}
+			kept = append(kept, elem)
+		}
+		if len(kept) == len(arr) {
+			return false
+		}
+		obj[field] = kept
+		return true
+	case ActionReplace:
+		if s, ok := val.(string); ok {
+			out := r.re.ReplaceAllString(s, r.Replacement)
+			if out == s {
+				return false
+			}
+			obj[field] = out
+			return true
+		}
+		return r.replaceIn(val)
+	}
+	return false
+}
+
+// replaceIn rewrites all string values nested anywhere under val
+func (r *Rule) replaceIn(val any) bool {
+	changed := false
+	switch v := val.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if k == "$type" {
+				continue
+			}
+			if s, ok := child.(string); ok {
+				if out := r.re.ReplaceAllString(s, r.Replacement); out != s {
+					v[k] = out
+					changed = true
+				}
+			} else if r.replaceIn(child) {
+				changed = true
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if s, ok := child.(string); ok {
+				if out := r.re.ReplaceAllString(s, r.Replacement); out != s {
+					v[i] = out
+					changed = true
+				}
+			} else if r.replaceIn(child) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,170 @@
+package transform
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/util/cartest"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRules = []Rule{
+	{
+		Name:       "strip-geo",
+		Collection: "app.bsky.feed.post",
+		Path:       "facets.features",
+		Action:     ActionRemove,
+		Type:       "community.lexicon.location.*",
+	},
+	{
+		Name:        "redact-email",
+		Collection:  "app.bsky.*",
+		Path:        "text",
+		Action:      ActionReplace,
+		Pattern:     `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		Replacement: "[redacted]",
+	},
+}
+
+func TestRules(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewPipeline(testRules, testKey(t))
+	assert.NoError(err)
+
+	rec := map[string]any{
+		"$type": "app.bsky.feed.post",
+		"text":  "email me at someone@example.ca",
+		"facets": []any{
+			map[string]any{
+				"features": []any{
+					map[string]any{"$type": "app.bsky.richtext.facet#tag", "tag": "yyz"},
+					map[string]any{"$type": "community.lexicon.location.geo", "latitude": "43.65"},
+				},
+			},
+		},
+	}
+	assert.Equal([]string{"strip-geo", "redact-email"}, p.TransformRecord("app.bsky.feed.post", rec))
+	assert.Equal("email me at [redacted]", rec["text"])
+	features := rec["facets"].([]any)[0].(map[string]any)["features"].([]any)
+	assert.Len(features, 1)
+
+	// idempotent, and collection-scoped
+	assert.Empty(p.TransformRecord("app.bsky.feed.post", rec))
+	other := map[string]any{"text": "someone@example.ca"}
+	assert.Empty(p.TransformRecord("com.example.thing", other))
+
+	for _, bad := range []Rule{
+		{Name: "x", Collection: "app.bsky.feed.post", Action: ActionRemove},
+		{Name: "x", Collection: "app.bsky.feed.post", Action: ActionReplace, Pattern: "("},
+		{Name: "x", Collection: "app.bsky.feed.post", Path: "text", Action: "shout"},
+		{Collection: "app.bsky.feed.post", Path: "text", Action: ActionRemove},
+	} {
+		_, err := NewPipeline([]Rule{bad}, testKey(t))
+		assert.Error(err)
+	}
+}
+
+func testKey(t *testing.T) crypto.PrivateKey {
+	priv, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestTransformEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	key := testKey(t)
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPipeline(testRules, key)
+	assert.NoError(err)
+
+	commit := cartest.Commit(t, "did:plc:abc")
+	post := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.post", "text": "hi someone@example.ca", "createdAt": "2024-01-01T00:00:00Z"})
+	like := cartest.NewBlock(t, map[string]any{"$type": "app.bsky.feed.like", "createdAt": "2024-01-01T00:00:00Z"})
+
+	orig := &events.XRPCStreamEvent{
+		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:abc",
+			Seq:    42,
+			Commit: lexutil.LexLink(commit.Cid),
+			Blocks: cartest.CAR(t, commit, post, like),
+			Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+				{Action: "create", Path: "app.bsky.feed.post/3k", Cid: post.Link()},
+				{Action: "create", Path: "app.bsky.feed.like/3l", Cid: like.Link()},
+			},
+		},
+	}
+	origBlocks := append([]byte{}, orig.RepoCommit.Blocks...)
+
+	out, err := p.TransformEvent(orig)
+	assert.NoError(err)
+	assert.NotSame(orig, out)
+
+	// the shared input event is untouched
+	assert.Equal(origBlocks, []byte(orig.RepoCommit.Blocks))
+	assert.Equal(post.Cid, cid.Cid(*orig.RepoCommit.Ops[0].Cid))
+	assert.Nil(orig.Meta)
+
+	newCid := cid.Cid(*out.RepoCommit.Ops[0].Cid)
+	assert.NotEqual(post.Cid, newCid)
+	assert.Equal(like.Cid, cid.Cid(*out.RepoCommit.Ops[1].Cid))
+
+	cr, err := car.NewCarReader(bytes.NewReader(out.RepoCommit.Blocks))
+	assert.NoError(err)
+	assert.Equal([]cid.Cid{commit.Cid}, cr.Header.Roots)
+	found := map[cid.Cid][]byte{}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		found[blk.Cid()] = blk.RawData()
+	}
+	assert.NotContains(found, post.Cid)
+	assert.Contains(found, like.Cid)
+	rec, err := data.UnmarshalCBOR(found[newCid])
+	assert.NoError(err)
+	assert.Equal("hi [redacted]", rec["text"])
+
+	if assert.NotNil(out.Meta) && assert.Len(out.Meta.Modified, 1) {
+		assert.Equal("app.bsky.feed.post/3k", out.Meta.Modified[0].Path)
+		assert.Equal(post.Cid.String(), out.Meta.Modified[0].Orig)
+		assert.Equal([]string{"redact-email"}, out.Meta.Modified[0].Rules)
+		assert.NoError(VerifyMeta(out.Meta, pub))
+		out.Meta.Seq = 43
+		assert.Error(VerifyMeta(out.Meta, pub))
+		out.Meta.Seq = 42
+	}
+
+	// metadata survives a trip over the wire in the frame header
+	var wire bytes.Buffer
+	assert.NoError(out.Serialize(&wire))
+	var decoded events.XRPCStreamEvent
+	assert.NoError(decoded.Deserialize(&wire))
+	assert.Equal(out.Meta, decoded.Meta)
+	assert.NoError(VerifyMeta(decoded.Meta, pub))
+
+	// events without matching ops pass straight through
+	likeOnly := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "com.example.thing/3l", Cid: like.Link()}},
+	}}
+	same, err := p.TransformEvent(likeOnly)
+	assert.NoError(err)
+	assert.Same(likeOnly, same)
+}
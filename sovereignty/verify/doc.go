@@ -0,0 +1,6 @@
+// Verification of accounts the country resolvers have no answer for, by an external service.
+//
+// Operators with institutional verification systems (a registry of public bodies, a membership directory) can have the relay ask them about accounts it can't otherwise place. A Verifier POSTs the account's DID to the service as JSON, {"did": "did:plc:..."}, and the service answers as a country resolver does: {"country": "CA", "confidence": "high"}, with an optional "subdivision" and "source", confidence defaulting to high; a 404, or an answer without a country, means it can't verify the account. Verdicts are cached, answers for CacheTTL and "can't verify" for UnknownTTL, so each account is asked about at most once per TTL. Requests are limited to Timeout, and a circuit breaker stops asking for Cooldown once Failures requests in a row have failed, the accounts in the meantime being left unknown rather than waiting on a service which is down. After the cooldown, a single request tries the service again, closing the circuit if it succeeds.
+//
+// Fallback composes a Verifier with the relay's resolver chain, asking the verifier only about accounts the chain has no answer for.
+package verify
@@ -0,0 +1,16 @@
+package verify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "verification_requests_total",
+	Help: "Accounts asked about, by result: verified, unknown (the service can't verify the account), error, circuit_open (not asked, the service having failed) or cached",
+}, []string{"result"})
+
+var circuitOpenedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "verification_circuit_opened_total",
+	Help: "Times the verification service failed often enough that the relay stopped asking it for a while",
+})
@@ -0,0 +1,317 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// SourceVerification is the source recorded for answers which don't name their own.
+const SourceVerification = "verification"
+
+// ErrCircuitOpen is returned, wrapping sovereignty.ErrCountryUnknown, while the service isn't being asked after failing.
+var ErrCircuitOpen = fmt.Errorf("%w: verification service is failing", sovereignty.ErrCountryUnknown)
+
+// Circuit states.
+const (
+	CircuitClosed = "closed"
+	CircuitOpen   = "open"
+	// the cooldown is over, and a request is trying the service again
+	CircuitHalfOpen = "half_open"
+)
+
+type Options struct {
+	URL string
+	// optional extra headers (eg, "Authorization") to include in every request
+	Headers map[string]string
+	// longest a request to the service may take
+	Timeout time.Duration
+	// failed requests in a row at which the circuit opens
+	Failures int
+	// how long the service isn't asked once the circuit opens
+	Cooldown time.Duration
+	// verdicts cached, the least recently used being dropped beyond this
+	CacheSize int
+	// how long answers are cached
+	CacheTTL time.Duration
+	// how long the service's not being able to verify an account is cached
+	UnknownTTL time.Duration
+	// nil uses http.DefaultClient
+	Client *http.Client
+	// time source for the cache and circuit; nil uses the system clock
+	Clock clock.Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:    5 * time.Second,
+		Failures:   5,
+		Cooldown:   time.Minute,
+		CacheSize:  100_000,
+		CacheTTL:   7 * 24 * time.Hour,
+		UnknownTTL: 24 * time.Hour,
+	}
+}
+
+type verdict struct {
+	// nil if the service can't verify the account
+	res     *sovereignty.Resolution
+	expires time.Time
+}
+
+// Status is the circuit's state, for operators.
+type Status struct {
+	// one of the Circuit states
+	Circuit string `json:"circuit"`
+	// failed requests in a row
+	Failures int `json:"failures"`
+	// when the service will be tried again, while the circuit is open
+	OpenUntil *time.Time `json:"openUntil,omitempty"`
+	Cached    int        `json:"cached"`
+}
+
+// Verifier asks the verification service about accounts. It implements sovereignty.CountryResolver, and is safe for concurrent use.
+type Verifier struct {
+	opts   Options
+	client *http.Client
+	clock  clock.Clock
+	cache  *lru.Cache[string, verdict]
+
+	lk        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// a request is trying the service after the cooldown
+	probing bool
+}
+
+func NewVerifier(opts Options) (*Verifier, error) {
+	if opts.URL == "" {
+		return nil, errors.New("verification service URL is required")
+	}
+	cache, err := lru.New[string, verdict](max(opts.CacheSize, 1))
+	if err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Verifier{
+		opts:   opts,
+		client: client,
+		clock:  clock.OrSystem(opts.Clock),
+		cache:  cache,
+	}, nil
+}
+
+func (v *Verifier) ResolveCountry(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+	res, err := v.ResolveCountrySource(ctx, did)
+	if err != nil {
+		return "", sovereignty.ConfidenceNone, err
+	}
+	return res.Region(), res.Confidence, nil
+}
+
+// ResolveCountrySource returns the service's verdict on the account, from the cache if it is there. Accounts the service can't verify, and all accounts while the circuit is open, return an error wrapping sovereignty.ErrCountryUnknown.
+func (v *Verifier) ResolveCountrySource(ctx context.Context, did string) (*sovereignty.Resolution, error) {
+	if vd, ok := v.cache.Get(did); ok && v.clock.Now().Before(vd.expires) {
+		requestsCounter.WithLabelValues("cached").Inc()
+		if vd.res == nil {
+			return nil, fmt.Errorf("%w: %s", sovereignty.ErrCountryUnknown, did)
+		}
+		res := *vd.res
+		return &res, nil
+	}
+	if !v.allow() {
+		requestsCounter.WithLabelValues("circuit_open").Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := v.request(ctx, did)
+	switch {
+	case err == nil:
+		v.succeeded()
+		requestsCounter.WithLabelValues("verified").Inc()
+		v.cache.Add(did, verdict{res: res, expires: v.clock.Now().Add(v.opts.CacheTTL)})
+		out := *res
+		return &out, nil
+	case errors.Is(err, sovereignty.ErrCountryUnknown):
+		v.succeeded()
+		requestsCounter.WithLabelValues("unknown").Inc()
+		v.cache.Add(did, verdict{expires: v.clock.Now().Add(v.opts.UnknownTTL)})
+		return nil, err
+	case ctx.Err() != nil:
+		// given up by the caller, which says nothing of the service
+		v.abandoned()
+		return nil, err
+	default:
+		v.failed()
+		requestsCounter.WithLabelValues("error").Inc()
+		return nil, err
+	}
+}
+
+// allow reports whether the service may be asked now
+func (v *Verifier) allow() bool {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	if v.openUntil.IsZero() {
+		return true
+	}
+	if v.probing || v.clock.Now().Before(v.openUntil) {
+		return false
+	}
+	v.probing = true
+	return true
+}
+
+func (v *Verifier) succeeded() {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	v.failures = 0
+	v.openUntil = time.Time{}
+	v.probing = false
+}
+
+func (v *Verifier) failed() {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	v.failures++
+	if v.probing || (v.openUntil.IsZero() && v.failures >= max(v.opts.Failures, 1)) {
+		if v.openUntil.IsZero() {
+			circuitOpenedCounter.Inc()
+		}
+		v.openUntil = v.clock.Now().Add(v.opts.Cooldown)
+	}
+	v.probing = false
+}
+
+func (v *Verifier) abandoned() {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	v.probing = false
+}
+
+type verifyRequest struct {
+	DID string `json:"did"`
+}
+
+type verifyAnswer struct {
+	Country     string `json:"country"`
+	Subdivision string `json:"subdivision"`
+	Confidence  string `json:"confidence"`
+	Source      string `json:"source"`
+}
+
+func (v *Verifier) request(ctx context.Context, did string) (*sovereignty.Resolution, error) {
+	if v.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.opts.Timeout)
+		defer cancel()
+	}
+	body, err := json.Marshal(verifyRequest{DID: did})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, val := range v.opts.Headers {
+		req.Header.Set(k, val)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", sovereignty.ErrCountryUnknown, did)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("verification service: HTTP %d", resp.StatusCode)
+	}
+
+	var ans verifyAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&ans); err != nil {
+		return nil, fmt.Errorf("verification service: %w", err)
+	}
+	if ans.Country == "" {
+		return nil, fmt.Errorf("%w: %s", sovereignty.ErrCountryUnknown, did)
+	}
+	conf := sovereignty.ConfidenceHigh
+	if ans.Confidence != "" {
+		conf, err = sovereignty.ParseConfidence(ans.Confidence)
+		if err != nil {
+			return nil, fmt.Errorf("verification service: %w", err)
+		}
+	}
+	source := ans.Source
+	if source == "" {
+		source = SourceVerification
+	}
+	return &sovereignty.Resolution{DID: did, Country: ans.Country, Subdivision: ans.Subdivision, Confidence: conf, Source: source}, nil
+}
+
+// Forget drops the cached verdict on an account, so the service is asked again next time.
+func (v *Verifier) Forget(did string) {
+	v.cache.Remove(did)
+}
+
+// Status reports the circuit's state.
+func (v *Verifier) Status() Status {
+	v.lk.Lock()
+	defer v.lk.Unlock()
+	st := Status{Circuit: CircuitClosed, Failures: v.failures, Cached: v.cache.Len()}
+	if !v.openUntil.IsZero() {
+		st.Circuit = CircuitOpen
+		if v.probing || !v.clock.Now().Before(v.openUntil) {
+			st.Circuit = CircuitHalfOpen
+		} else {
+			until := v.openUntil.UTC()
+			st.OpenUntil = &until
+		}
+	}
+	return st
+}
+
+// Fallback asks next about accounts, and the verifier only about those next has no answer for. Next may be nil, leaving only the verifier. The resolver returned is also a sovereignty.SourceResolver.
+func Fallback(next sovereignty.CountryResolver, v *Verifier) sovereignty.CountryResolver {
+	return &fallback{next: next, verifier: v}
+}
+
+type fallback struct {
+	next     sovereignty.CountryResolver
+	verifier *Verifier
+}
+
+func (f *fallback) ResolveCountry(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+	res, err := f.ResolveCountrySource(ctx, did)
+	if err != nil {
+		return "", sovereignty.ConfidenceNone, err
+	}
+	return res.Region(), res.Confidence, nil
+}
+
+func (f *fallback) ResolveCountrySource(ctx context.Context, did string) (*sovereignty.Resolution, error) {
+	if f.next != nil {
+		// the caller records its own source for answers next doesn't name one for
+		res, err := sovereignty.Resolve(ctx, f.next, did, "")
+		if !errors.Is(err, sovereignty.ErrCountryUnknown) {
+			return res, err
+		}
+	}
+	return f.verifier.ResolveCountrySource(ctx, did)
+}
@@ -0,0 +1,126 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/util/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifier(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal("POST", r.Method)
+		assert.Equal("Bearer secret", r.Header.Get("Authorization"))
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body verifyRequest
+		assert.NoError(json.NewDecoder(r.Body).Decode(&body))
+		switch body.DID {
+		case "did:plc:gov":
+			w.Write([]byte(`{"country": "CA", "subdivision": "QC", "source": "registry"}`))
+		case "did:plc:low":
+			w.Write([]byte(`{"country": "CA", "confidence": "low"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	clk := clock.NewMock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOptions()
+	opts.URL = srv.URL
+	opts.Headers = map[string]string{"Authorization": "Bearer secret"}
+	opts.Failures = 2
+	opts.Clock = clk
+	v, err := NewVerifier(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := v.ResolveCountrySource(ctx, "did:plc:gov")
+	assert.NoError(err)
+	assert.Equal("CA-QC", res.Region())
+	assert.Equal(sovereignty.ConfidenceHigh, res.Confidence)
+	assert.Equal("registry", res.Source)
+	res, err = v.ResolveCountrySource(ctx, "did:plc:low")
+	assert.NoError(err)
+	assert.Equal(sovereignty.ConfidenceLow, res.Confidence)
+	assert.Equal(SourceVerification, res.Source)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:nobody")
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.Equal(int64(3), requests.Load())
+
+	// verdicts are cached, unknowns for less time
+	_, err = v.ResolveCountrySource(ctx, "did:plc:gov")
+	assert.NoError(err)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:nobody")
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.Equal(int64(3), requests.Load())
+	clk.Advance(opts.UnknownTTL)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:nobody")
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.Equal(int64(4), requests.Load())
+
+	// the circuit opens after failures in a row
+	down.Store(true)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:a")
+	assert.Error(err)
+	assert.NotErrorIs(err, sovereignty.ErrCountryUnknown)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:b")
+	assert.Error(err)
+	assert.Equal(CircuitOpen, v.Status().Circuit)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:c")
+	assert.ErrorIs(err, ErrCircuitOpen)
+	assert.Equal(int64(6), requests.Load())
+
+	// a failed probe after the cooldown opens it again
+	clk.Advance(opts.Cooldown)
+	assert.Equal(CircuitHalfOpen, v.Status().Circuit)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:c")
+	assert.Error(err)
+	assert.Equal(CircuitOpen, v.Status().Circuit)
+	assert.Equal(int64(7), requests.Load())
+
+	// and a successful one closes it
+	down.Store(false)
+	clk.Advance(opts.Cooldown)
+	_, err = v.ResolveCountrySource(ctx, "did:plc:c")
+	assert.ErrorIs(err, sovereignty.ErrCountryUnknown)
+	assert.NotErrorIs(err, ErrCircuitOpen)
+	assert.Equal(CircuitClosed, v.Status().Circuit)
+
+	// the verifier is only asked when the chain has no answer
+	chain := sovereignty.CountryResolverFunc(func(ctx context.Context, did string) (string, sovereignty.Confidence, error) {
+		if did == "did:plc:pds" {
+			return "US", sovereignty.ConfidenceMedium, nil
+		}
+		return "", sovereignty.ConfidenceNone, sovereignty.ErrCountryUnknown
+	})
+	r := Fallback(chain, v).(sovereignty.SourceResolver)
+	before := requests.Load()
+	res, err = r.ResolveCountrySource(ctx, "did:plc:pds")
+	assert.NoError(err)
+	assert.Equal("US", res.Country)
+	assert.Equal(before, requests.Load())
+	v.Forget("did:plc:gov")
+	res, err = r.ResolveCountrySource(ctx, "did:plc:gov")
+	assert.NoError(err)
+	assert.Equal("registry", res.Source)
+	assert.Equal(before+1, requests.Load())
+}
@@ -0,0 +1,4 @@
+// Hardware-token (WebAuthn) authentication for relay operators.
+//
+// This is a small WebAuthn relying party: it creates registration and assertion options, and verifies authenticator responses with github.com/go-webauthn/webauthn, which parses the CBOR, authenticator data and COSE keys. Registration asks for no attestation, since enrollment is itself authenticated (by an existing operator, or a one-time bootstrap token). Credentials must use ES256 (P-256) or EdDSA (Ed25519) keys, and assertions require user presence, and by default user verification (a PIN or biometric), so a stolen token alone isn't enough. Discoverable (resident) credentials are supported, allowing sign-in without naming an account. RecoveryCodes provides single-use codes for operators who lose their tokens.
+package webauthn
@@ -0,0 +1,40 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// number of random bytes in a recovery code: 80 bits
+const recoveryCodeBytes = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns n random single-use recovery codes, formatted for reading aloud as four groups of four characters.
+func NewRecoveryCodes(n int) ([]string, error) {
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		out = append(out, s[0:4]+"-"+s[4:8]+"-"+s[8:12]+"-"+s[12:16])
+	}
+	return out, nil
+}
+
+// HashRecoveryCode returns the form a recovery code is stored in. Codes are normalized first, so case and separators don't matter.
+func HashRecoveryCode(code string) string {
+	norm := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	h := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(h[:])
+}
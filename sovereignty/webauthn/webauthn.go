@@ -0,0 +1,291 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// COSE algorithm identifiers of the supported credential keys
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+)
+
+// how long the browser is given to complete a ceremony
+const CeremonyTimeout = 5 * time.Minute
+
+// ErrCloned is returned when an assertion's signature counter didn't advance, which suggests the authenticator was cloned
+var ErrCloned = errors.New("authenticator signature counter went backwards, it may have been cloned")
+
+// Bytes is binary data, encoded in JSON as unpadded base64url, as in the WebAuthn JSON serialization.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+	out, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = out
+	return nil
+}
+
+// RelyingParty is the relay's WebAuthn identity.
+type RelyingParty struct {
+	// domain credentials are scoped to, eg "relay.example.ca"
+	ID string
+	// human-readable name shown by authenticators
+	Name string
+	// origins the admin dashboard is served from, eg "https://relay.example.ca"
+	Origins []string
+	// require the authenticator to verify the operator (PIN or biometric), not just their presence
+	RequireUserVerification bool
+}
+
+// Credential is an enrolled authenticator's public key.
+type Credential struct {
+	ID Bytes `json:"id"`
+	// COSE_Key encoded public key
+	PublicKey  Bytes  `json:"publicKey"`
+	SignCount  uint32 `json:"signCount"`
+	UserHandle Bytes  `json:"userHandle"`
+}
+
+// User is the account a credential is enrolled for.
+type User struct {
+	// opaque handle, at most 64 bytes, returned by discoverable credentials on sign-in
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() to enroll an authenticator.
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get() to sign in.
+type RequestOptions struct {
+	Challenge Bytes  `json:"challenge"`
+	RPID      string `json:"rpId"`
+	Timeout   int64  `json:"timeout"`
+	// empty allows any discoverable credential
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the response of an enrolling authenticator.
+type AttestationResponse struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AttestationObject Bytes `json:"attestationObject"`
+}
+
+// AssertionResponse is the response of an authenticator signing in.
+type AssertionResponse struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle,omitempty"`
+}
+
+// NewChallenge returns a random ceremony challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (rp *RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+func descriptors(creds []Credential) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, CredentialDescriptor{Type: "public-key", ID: c.ID})
+	}
+	return out
+}
+
+// CreationOptions returns the options to enroll a discoverable credential for user, excluding authenticators which are already enrolled.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude []Credential) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+		},
+		Timeout:            CeremonyTimeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   rp.userVerification(),
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options to sign in with one of allow, or any discoverable credential if allow is empty.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []Credential) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          CeremonyTimeout.Milliseconds(),
+		AllowCredentials: descriptors(allow),
+		UserVerification: rp.userVerification(),
+	}
+}
+
+// VerifyRegistration checks an enrollment response against the challenge it was issued for, returning the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp AttestationResponse) (*Credential, error) {
+	raw := protocol.AuthenticatorAttestationResponse{
+		AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: protocol.URLEncodedBase64(resp.ClientDataJSON)},
+		AttestationObject:     protocol.URLEncodedBase64(resp.AttestationObject),
+	}
+	parsed, err := raw.Parse()
+	if err != nil {
+		return nil, describe("invalid attestation", err)
+	}
+	if err := parsed.CollectedClientData.Verify(encodeChallenge(challenge), protocol.CreateCeremony, rp.Origins); err != nil {
+		return nil, describe("invalid client data", err)
+	}
+	hash := sha256.Sum256(resp.ClientDataJSON)
+	if err := parsed.AttestationObject.Verify(rp.ID, hash[:], rp.RequireUserVerification); err != nil {
+		return nil, describe("invalid attestation", err)
+	}
+	ad := parsed.AttestationObject.AuthData
+	if err := checkPublicKey(ad.AttData.CredentialPublicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        ad.AttData.CredentialID,
+		PublicKey: ad.AttData.CredentialPublicKey,
+		SignCount: ad.Counter,
+	}, nil
+}
+
+// VerifyAssertion checks a sign-in response from cred's authenticator against the challenge it was issued for, returning the authenticator's new signature counter.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, resp AssertionResponse) (uint32, error) {
+	if len(resp.UserHandle) > 0 && len(cred.UserHandle) > 0 && !bytes.Equal(resp.UserHandle, cred.UserHandle) {
+		return 0, fmt.Errorf("user handle doesn't match the credential")
+	}
+	if err := checkPublicKey(cred.PublicKey); err != nil {
+		return 0, err
+	}
+	raw := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: protocol.PublicKeyCredential{
+			Credential: protocol.Credential{ID: base64.RawURLEncoding.EncodeToString(cred.ID), Type: "public-key"},
+			RawID:      protocol.URLEncodedBase64(cred.ID),
+		},
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: protocol.URLEncodedBase64(resp.ClientDataJSON)},
+			AuthenticatorData:     protocol.URLEncodedBase64(resp.AuthenticatorData),
+			Signature:             protocol.URLEncodedBase64(resp.Signature),
+			UserHandle:            protocol.URLEncodedBase64(resp.UserHandle),
+		},
+	}
+	parsed, err := raw.Parse()
+	if err != nil {
+		return 0, describe("invalid assertion", err)
+	}
+	if err := parsed.Verify(encodeChallenge(challenge), rp.ID, rp.Origins, "", rp.RequireUserVerification, cred.PublicKey); err != nil {
+		return 0, describe("invalid assertion", err)
+	}
+	count := parsed.Response.AuthenticatorData.Counter
+	// authenticators which don't implement counters always report zero
+	if (count != 0 || cred.SignCount != 0) && count <= cred.SignCount {
+		return 0, ErrCloned
+	}
+	return count, nil
+}
+
+// encodeChallenge returns a challenge as it appears in client data
+func encodeChallenge(challenge []byte) string {
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+// describe wraps a verification error, keeping the library's debugging detail
+func describe(msg string, err error) error {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return fmt.Errorf("%s: %w (%s)", msg, err, strings.TrimSpace(perr.DevInfo))
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// checkPublicKey rejects COSE keys other than ES256 and EdDSA
+func checkPublicKey(cose []byte) error {
+	key, err := webauthncose.ParsePublicKey(cose)
+	if err != nil {
+		return fmt.Errorf("invalid credential public key: %w", err)
+	}
+	switch k := key.(type) {
+	case webauthncose.EC2PublicKeyData:
+		if k.Algorithm == AlgES256 && k.Curve == 1 && len(k.XCoord) == 32 && len(k.YCoord) == 32 {
+			return nil
+		}
+		return fmt.Errorf("unsupported credential key (kty %d, alg %d); ES256 or EdDSA required", k.KeyType, k.Algorithm)
+	case webauthncose.OKPPublicKeyData:
+		if k.Algorithm == AlgEdDSA && len(k.XCoord) == ed25519.PublicKeySize {
+			return nil
+		}
+		return fmt.Errorf("unsupported credential key (kty %d, alg %d); ES256 or EdDSA required", k.KeyType, k.Algorithm)
+	case webauthncose.RSAPublicKeyData:
+		return fmt.Errorf("unsupported credential key (kty %d, alg %d); ES256 or EdDSA required", k.KeyType, k.Algorithm)
+	}
+	return fmt.Errorf("unsupported credential key; ES256 or EdDSA required")
+}
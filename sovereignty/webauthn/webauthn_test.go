@@ -0,0 +1,278 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// cborHead encodes a CBOR item head
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(i int) []byte {
+	if i < 0 {
+		return cborHead(1, -1-i)
+	}
+	return cborHead(0, i)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, len(s)), s...)
+}
+
+// testAuthenticator is a software P-256 authenticator
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	out := append(cborHead(5, 5), cborInt(1)...)
+	out = append(out, cborInt(2)...)
+	out = append(out, cborInt(3)...)
+	out = append(out, cborInt(AlgES256)...)
+	out = append(out, cborInt(-1)...)
+	out = append(out, cborInt(1)...)
+	out = append(out, cborInt(-2)...)
+	out = append(out, cborBytes(a.key.X.FillBytes(make([]byte, 32)))...)
+	out = append(out, cborInt(-3)...)
+	return append(out, cborBytes(a.key.Y.FillBytes(make([]byte, 32)))...)
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	out := append(h[:], flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	if attested {
+		out = append(out, make([]byte, 16)...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.id)))
+		out = append(out, a.id...)
+		out = append(out, a.coseKey()...)
+	}
+	return out
+}
+
+func clientDataJSON(typ string, challenge []byte, origin string) []byte {
+	b, _ := json.Marshal(map[string]string{"type": typ, "challenge": base64.RawURLEncoding.EncodeToString(challenge), "origin": origin})
+	return b
+}
+
+func (a *testAuthenticator) create(rpID, origin string, challenge []byte, flags byte) AttestationResponse {
+	obj := append(cborHead(5, 3), cborText("fmt")...)
+	obj = append(obj, cborText("none")...)
+	obj = append(obj, cborText("attStmt")...)
+	obj = append(obj, cborHead(5, 0)...)
+	obj = append(obj, cborText("authData")...)
+	obj = append(obj, cborBytes(a.authData(rpID, flags|flagAttested, true))...)
+	return AttestationResponse{
+		ClientDataJSON:    clientDataJSON("webauthn.create", challenge, origin),
+		AttestationObject: obj,
+	}
+}
+
+func (a *testAuthenticator) get(rpID, origin string, challenge []byte, flags byte) AssertionResponse {
+	a.signCount++
+	return a.sign(a.authData(rpID, flags, false), clientDataJSON("webauthn.get", challenge, origin))
+}
+
+// sign returns an assertion over arbitrary authenticator data
+func (a *testAuthenticator) sign(ad, cd []byte) AssertionResponse {
+	h := sha256.Sum256(cd)
+	msg := sha256.Sum256(append(append([]byte{}, ad...), h[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, msg[:])
+	if err != nil {
+		panic(err)
+	}
+	return AssertionResponse{ClientDataJSON: cd, AuthenticatorData: ad, Signature: sig}
+}
+
+func TestCeremonies(t *testing.T) {
+	assert := assert.New(t)
+
+	rp := &RelyingParty{ID: "relay.example.ca", Name: "Relay", Origins: []string{"https://relay.example.ca"}, RequireUserVerification: true}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testAuthenticator{key: key, id: []byte("credential-1")}
+	origin := "https://relay.example.ca"
+
+	challenge, err := NewChallenge()
+	assert.NoError(err)
+	opts := rp.CreationOptions(challenge, User{ID: []byte("u1"), Name: "ops"}, nil)
+	assert.Equal("required", opts.AuthenticatorSelection.ResidentKey)
+
+	// wrong challenge, origin, or relying party
+	_, err = rp.VerifyRegistration([]byte("other"), a.create(rp.ID, origin, challenge, flagUserPresent|flagUserVerified))
+	assert.Error(err)
+	_, err = rp.VerifyRegistration(challenge, a.create(rp.ID, "https://evil.example.com", challenge, flagUserPresent|flagUserVerified))
+	assert.Error(err)
+	_, err = rp.VerifyRegistration(challenge, a.create("evil.example.com", origin, challenge, flagUserPresent|flagUserVerified))
+	assert.Error(err)
+	// user verification is required
+	_, err = rp.VerifyRegistration(challenge, a.create(rp.ID, origin, challenge, flagUserPresent))
+	assert.Error(err)
+
+	cred, err := rp.VerifyRegistration(challenge, a.create(rp.ID, origin, challenge, flagUserPresent|flagUserVerified))
+	assert.NoError(err)
+	assert.Equal([]byte("credential-1"), []byte(cred.ID))
+
+	challenge, _ = NewChallenge()
+	count, err := rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, flagUserPresent|flagUserVerified))
+	assert.NoError(err)
+	assert.Equal(uint32(1), count)
+	cred.SignCount = count
+
+	// a response to another challenge doesn't verify
+	other, _ := NewChallenge()
+	_, err = rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, other, flagUserPresent|flagUserVerified))
+	assert.Error(err)
+
+	// tampered signature
+	resp := a.get(rp.ID, origin, challenge, flagUserPresent|flagUserVerified)
+	resp.AuthenticatorData[32] |= 0x02
+	_, err = rp.VerifyAssertion(challenge, cred, resp)
+	assert.Error(err)
+
+	// counter must advance
+	a.signCount = 0
+	_, err = rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, flagUserPresent|flagUserVerified))
+	assert.ErrorIs(err, ErrCloned)
+}
+
+func TestMalformedResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	rp := &RelyingParty{ID: "relay.example.ca", Name: "Relay", Origins: []string{"https://relay.example.ca"}, RequireUserVerification: true}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testAuthenticator{key: key, id: []byte("credential-1")}
+	origin := "https://relay.example.ca"
+	ok := byte(flagUserPresent | flagUserVerified)
+	challenge, _ := NewChallenge()
+
+	// attestation objects whose authData is truncated, claims attested data it doesn't carry, or has trailing bytes
+	attestation := func(authData []byte) AttestationResponse {
+		obj := append(cborHead(5, 3), cborText("fmt")...)
+		obj = append(obj, cborText("none")...)
+		obj = append(obj, cborText("attStmt")...)
+		obj = append(obj, cborHead(5, 0)...)
+		obj = append(obj, cborText("authData")...)
+		obj = append(obj, cborBytes(authData)...)
+		return AttestationResponse{ClientDataJSON: clientDataJSON("webauthn.create", challenge, origin), AttestationObject: obj}
+	}
+	full := a.authData(rp.ID, ok|flagAttested, true)
+	for name, ad := range map[string][]byte{
+		"empty":       nil,
+		"truncated":   full[:36],
+		"no key":      full[:len(full)-len(a.coseKey())],
+		"no attested": a.authData(rp.ID, ok|flagAttested, false),
+		"trailing":    append(append([]byte{}, full...), 0x00),
+	} {
+		_, err := rp.VerifyRegistration(challenge, attestation(ad))
+		assert.Error(err, name)
+	}
+	_, err = rp.VerifyRegistration(challenge, AttestationResponse{ClientDataJSON: clientDataJSON("webauthn.create", challenge, origin), AttestationObject: []byte{0xa1}})
+	assert.Error(err)
+	// an assertion response offered for registration
+	_, err = rp.VerifyRegistration(challenge, AttestationResponse{ClientDataJSON: clientDataJSON("webauthn.get", challenge, origin), AttestationObject: a.create(rp.ID, origin, challenge, ok).AttestationObject})
+	assert.Error(err)
+
+	// user presence is always required, even when verification isn't
+	lax := *rp
+	lax.RequireUserVerification = false
+	_, err = lax.VerifyRegistration(challenge, a.create(rp.ID, origin, challenge, flagUserVerified))
+	assert.Error(err)
+	cred, err := lax.VerifyRegistration(challenge, a.create(rp.ID, origin, challenge, flagUserPresent))
+	assert.NoError(err)
+
+	_, err = lax.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, 0))
+	assert.Error(err)
+	_, err = rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, flagUserPresent))
+	assert.Error(err)
+	// signed, but for another relying party
+	_, err = rp.VerifyAssertion(challenge, cred, a.get("evil.example.com", origin, challenge, ok))
+	assert.Error(err)
+	// authenticator data which is too short, or has trailing bytes
+	cd := clientDataJSON("webauthn.get", challenge, origin)
+	_, err = rp.VerifyAssertion(challenge, cred, a.sign(a.authData(rp.ID, ok, false)[:36], cd))
+	assert.Error(err)
+	_, err = rp.VerifyAssertion(challenge, cred, a.sign(append(a.authData(rp.ID, ok, false), 0x00), cd))
+	assert.Error(err)
+	// a handle for another user
+	resp := a.get(rp.ID, origin, challenge, ok)
+	resp.UserHandle = []byte("u2")
+	cred.UserHandle = []byte("u1")
+	_, err = rp.VerifyAssertion(challenge, cred, resp)
+	assert.Error(err)
+
+	// counter rollback, after the counter has advanced
+	count, err := rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, ok))
+	assert.NoError(err)
+	cred.SignCount = count + 10
+	_, err = rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, ok))
+	assert.ErrorIs(err, ErrCloned)
+	a.signCount = cred.SignCount
+	_, err = rp.VerifyAssertion(challenge, cred, a.get(rp.ID, origin, challenge, ok))
+	assert.NoError(err)
+
+	// keys other than ES256 and EdDSA are rejected
+	rsa := append(cborHead(5, 2), cborInt(1)...)
+	rsa = append(rsa, cborInt(3)...)
+	rsa = append(rsa, cborInt(3)...)
+	rsa = append(rsa, cborInt(-257)...)
+	_, err = rp.VerifyAssertion(challenge, &Credential{ID: a.id, PublicKey: rsa}, a.get(rp.ID, origin, challenge, ok))
+	assert.Error(err)
+}
+
+func TestBytesJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := json.Marshal(Bytes{0xfb, 0xff})
+	assert.NoError(err)
+	assert.Equal(`"-_8"`, string(b))
+	var out Bytes
+	assert.NoError(json.Unmarshal([]byte(`"-_8="`), &out))
+	assert.Equal(Bytes{0xfb, 0xff}, out)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	codes, err := NewRecoveryCodes(10)
+	assert.NoError(err)
+	assert.Len(codes, 10)
+	assert.Len(codes[0], 19)
+	assert.NotEqual(codes[0], codes[1])
+	assert.Equal(HashRecoveryCode(codes[0]), HashRecoveryCode(" "+codes[0][0:4]+codes[0][5:]+" "))
+}
@@ -3,15 +3,29 @@ package testing
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/bgs"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
 	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/sovereignty"
+	"github.com/bluesky-social/indigo/sovereignty/policy"
+	"github.com/bluesky-social/indigo/sovereignty/priority"
+	"github.com/bluesky-social/indigo/sovereignty/resume"
+	"github.com/bluesky-social/indigo/sovereignty/transform"
 	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/gorilla/websocket"
 	"github.com/ipfs/go-cid"
 	car "github.com/ipld/go-car"
 	"github.com/stretchr/testify/assert"
@@ -64,7 +78,6 @@ func testRelayBasic(t *testing.T, archive bool) {
 	bp1 := bob.Post(t, "cats for cats")
 	ap1 := alice.Post(t, "no i like dogs")
 
-	_ = bp1
 	_ = ap1
 
 	t.Log("bob:", bob.DID())
@@ -86,6 +99,59 @@ func testRelayBasic(t *testing.T, archive bool) {
 	t.Log("event 5")
 	pbe1 := pbevts.Next()
 	assert.Equal(*e3, *pbe1)
+
+	if !archive {
+		return
+	}
+
+	// the full repo streams back out, walked from the current commit
+	c := &xrpc.Client{Host: "http://" + b1.Host()}
+	carb, err := atproto.SyncGetRepo(context.Background(), c, bob.DID(), "")
+	if !assert.NoError(err) {
+		return
+	}
+	rr, err := repo.ReadRepoFromCar(context.Background(), bytes.NewReader(carb))
+	if !assert.NoError(err) {
+		return
+	}
+	var found bool
+	assert.NoError(rr.ForEach(context.Background(), "", func(k string, v cid.Cid) error {
+		if v.String() == bp1.Cid {
+			found = true
+		}
+		return nil
+	}))
+	assert.True(found)
+
+	// with since, only what changed after the account's first commit
+	diffb, err := atproto.SyncGetRepo(context.Background(), c, bob.DID(), e1.RepoCommit.Rev)
+	if !assert.NoError(err) {
+		return
+	}
+	cr, err := car.NewCarReader(bytes.NewReader(diffb))
+	if !assert.NoError(err) {
+		return
+	}
+	fr, err := car.NewCarReader(bytes.NewReader(carb))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(fr.Header.Roots, cr.Header.Roots)
+	found = false
+	for {
+		blk, err := cr.Next()
+		if err != nil {
+			break
+		}
+		if blk.Cid().String() == bp1.Cid {
+			found = true
+		}
+	}
+	assert.True(found)
+	assert.Less(len(diffb), len(carb))
+
+	_, err = atproto.SyncGetRepo(context.Background(), c, "did:plc:nobodyhere", "")
+	assert.Error(err)
 }
 
 func randomFollows(t *testing.T, users []*TestUser) {
@@ -449,7 +515,8 @@ func testRelayTakedown(t *testing.T, archive bool) {
 	evts1 := es1.WaitFor(expCount)
 	assert.Equal(expCount, len(evts1))
 
-	assert.NoError(b1.bgs.TakeDownRepo(context.TODO(), bob.did))
+	_, err := b1.bgs.TakeDownRepo(context.TODO(), bob.did)
+	assert.NoError(err)
 
 	es2 := b1.Events(t, 0)
 	time.Sleep(time.Millisecond * 50) // wait for events to stream in and be collected
@@ -471,6 +538,411 @@ func testRelayTakedown(t *testing.T, archive bool) {
 	assert.Equal(alice.did, last.RepoCommit.Repo)
 }
 
+func TestRelayPriorityStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Relay test in 'short' test mode")
+	}
+	assert := assert.New(t)
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".tpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupRelay(t, didr, true)
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	p1.BumpLimits(t, b1)
+
+	time.Sleep(time.Millisecond * 50)
+
+	bob := p1.MustNewUser(t, "bob.tpds")
+	alice := p1.MustNewUser(t, "alice.tpds")
+
+	assert.NoError(b1.bgs.SetPriorityAccount(context.TODO(), priority.Account{
+		DID:      alice.did,
+		Category: priority.CategoryEmergency,
+		AddedBy:  "test",
+	}, "127.0.0.1"))
+
+	es := b1.EventsAt(t, "/sovereignty/priority/xrpc/com.atproto.sync.subscribeRepos", -1)
+	time.Sleep(time.Millisecond * 50)
+
+	bob.Post(t, "just a regular post")
+	alice.Post(t, "evacuation order for the area")
+
+	time.Sleep(time.Millisecond * 100)
+	before := es.All()
+	assert.NotEmpty(before)
+	for _, evt := range before {
+		assert.Equal(alice.did, evt.RepoCommit.Repo)
+	}
+
+	// nothing more once the account is removed
+	assert.NoError(b1.bgs.RemovePriorityAccount(context.TODO(), alice.did, "test", "127.0.0.1"))
+	alice.Post(t, "all clear")
+	bob.Post(t, "another regular post")
+	time.Sleep(time.Millisecond * 100)
+	assert.Len(es.All(), len(before))
+
+	var audit []models.PriorityAuditEntry
+	assert.NoError(b1.db.Order("id").Find(&audit).Error)
+	if assert.Len(audit, 2) {
+		assert.Equal("add", audit[0].Action)
+		assert.Equal("remove", audit[1].Action)
+		assert.Equal(alice.did, audit[1].Did)
+	}
+}
+
+func TestRelayAppeals(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Relay test in 'short' test mode")
+	}
+	assert := assert.New(t)
+	ctx := context.TODO()
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".tpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupRelay(t, didr, true)
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	p1.BumpLimits(t, b1)
+
+	time.Sleep(time.Millisecond * 50)
+
+	alice := p1.MustNewUser(t, "alice.tpds")
+	alice.Post(t, "hello")
+	time.Sleep(time.Millisecond * 100)
+
+	// classification appeal, reassigned and accepted with an override
+	assert.NoError(b1.bgs.SetClassification(ctx, sovereignty.Classification{DID: alice.did, Country: "US", Source: "pds-geo"}))
+	cl := &models.Appeal{Did: alice.did, Kind: bgs.AppealKindClassification, CurrentCountry: "US", RequestedCountry: "CA"}
+	assert.NoError(b1.bgs.SubmitAppeal(ctx, cl, "127.0.0.1"))
+	assert.ErrorIs(b1.bgs.SubmitAppeal(ctx, &models.Appeal{Did: alice.did, Kind: bgs.AppealKindClassification}, "127.0.0.1"), bgs.ErrAppealPending)
+
+	_, err := b1.bgs.AssignAppeal(ctx, cl.ID, "reviewer1", "lead", "127.0.0.1")
+	assert.NoError(err)
+	override := "fr"
+	out, err := b1.bgs.ResolveAppeal(ctx, cl.ID, bgs.AppealDecision{Status: bgs.AppealStatusAccepted, Actor: "reviewer1", Country: &override}, "127.0.0.1")
+	assert.NoError(err)
+	assert.Equal(bgs.AppealStatusAccepted, out.Status)
+	assert.Equal("reviewer1", out.AssignedTo)
+	c, ok := b1.bgs.Classifications.Get(alice.did)
+	assert.True(ok)
+	assert.Equal("FR", c.Country)
+	assert.Equal("appeal", c.Source)
+
+	_, err = b1.bgs.ResolveAppeal(ctx, cl.ID, bgs.AppealDecision{Status: bgs.AppealStatusRejected, Actor: "reviewer2"}, "127.0.0.1")
+	assert.ErrorIs(err, bgs.ErrAppealClosed)
+
+	var audit []models.AppealAuditEntry
+	assert.NoError(b1.db.Where("appeal_id = ?", cl.ID).Order("id").Find(&audit).Error)
+	var actions []string
+	for _, a := range audit {
+		actions = append(actions, a.Action)
+	}
+	assert.Equal([]string{"submit", "assign", bgs.AppealStatusAccepted}, actions)
+
+	// takedown appeal
+	_, err = b1.bgs.TakeDownRepo(ctx, alice.did)
+	assert.NoError(err)
+	td := &models.Appeal{Did: alice.did, Kind: bgs.AppealKindTakedown}
+	assert.NoError(b1.bgs.SubmitAppeal(ctx, td, "127.0.0.1"))
+	_, err = b1.bgs.ResolveAppeal(ctx, td.ID, bgs.AppealDecision{Status: bgs.AppealStatusAccepted, Actor: "reviewer1"}, "127.0.0.1")
+	assert.NoError(err)
+	var u bgs.User
+	assert.NoError(b1.db.Where("did = ?", alice.did).First(&u).Error)
+	assert.False(u.TakenDown)
+}
+
+func TestRelayClassificationImport(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Relay test in 'short' test mode")
+	}
+	assert := assert.New(t)
+
+	didr := TestPLC(t)
+	b1 := MustSetupRelay(t, didr, true)
+	b1.Run(t)
+	assert.NoError(b1.bgs.CreateAdminToken("test"))
+
+	admin := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, "http://"+b1.Host()+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer test")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	input := "did,country,source\ndid:plc:aaa,ca,\ndid:plc:bbb,US,admin\nbogus,CA,\n"
+	for _, dryRun := range []bool{true, false} {
+		resp := admin("POST", fmt.Sprintf("/admin/sovereignty/import?format=csv&dryRun=%t", dryRun), input)
+		assert.Equal(200, resp.StatusCode)
+		var rep sovereignty.ImportReport
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&rep))
+		resp.Body.Close()
+		assert.Equal(2, rep.Added)
+		assert.Equal(1, rep.Invalid)
+	}
+	c, ok := b1.bgs.Classifications.Get("did:plc:aaa")
+	assert.True(ok)
+	assert.Equal("CA", c.Country)
+	assert.Equal("import", c.Source)
+
+	resp := admin("GET", "/admin/sovereignty/export?format=jsonl&country=CA", "")
+	assert.Equal(200, resp.StatusCode)
+	out, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if assert.Len(lines, 1) {
+		assert.Contains(lines[0], `"did":"did:plc:aaa"`)
+	}
+
+	// the imported rows were persisted
+	var n int64
+	assert.NoError(b1.db.Model(&models.DIDClassification{}).Count(&n).Error)
+	assert.Equal(int64(2), n)
+}
+
+func TestRelayPolicy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Relay test in 'short' test mode")
+	}
+	assert := assert.New(t)
+
+	authority, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorityPub, err := authority.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	didr := TestPLC(t)
+	b1 := MustSetupRelayWithConfig(t, didr, true, func(config *bgs.BGSConfig) {
+		config.Sovereign.SnapshotSigningKey = signingKey
+		config.Sovereign.PolicyAuthority = authorityPub
+		config.Sovereign.PolicyHistory = 2
+	})
+	b1.Run(t)
+	assert.NoError(b1.bgs.CreateAdminToken("test"))
+	ctx := context.Background()
+	assert.NoError(b1.bgs.SetClassification(ctx, sovereignty.Classification{DID: "did:plc:aaa", Country: "CA", Source: "admin"}))
+	assert.False(b1.bgs.AccountStanding("did:plc:aaa").Included)
+
+	apply := func(doc policy.Document, key crypto.PrivateKey, ramp *policy.Ramp) int {
+		token, err := policy.Sign(doc, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(map[string]any{"token": token, "ramp": ramp, "actor": "tester"})
+		req, err := http.NewRequest("POST", "http://"+b1.Host()+"/admin/sovereignty/policy", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer test")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	doc := policy.Document{
+		Version:         1,
+		StreamCountries: []string{"CA"},
+		TransformRules: []transform.Rule{
+			{Name: "redact-email", Collection: "app.bsky.*", Path: "text", Action: transform.ActionReplace, Pattern: `\S+@\S+`, Replacement: "[redacted]"},
+		},
+	}
+	assert.Equal(200, apply(doc, authority, nil))
+	assert.True(b1.bgs.AccountStanding("did:plc:aaa").Included)
+
+	// replays, rollbacks and other signers are refused
+	assert.Equal(409, apply(doc, authority, nil))
+	other, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Version = 2
+	assert.Equal(400, apply(doc, other, nil))
+
+	for v := int64(2); v <= 3; v++ {
+		doc.Version = v
+		doc.StreamCountries = []string{"FR"}
+		assert.Equal(200, apply(doc, authority, nil))
+	}
+	assert.False(b1.bgs.AccountStanding("did:plc:aaa").Included)
+
+	// only the newest documents are kept
+	var history []models.AppliedPolicy
+	assert.NoError(b1.db.Order("id desc").Find(&history).Error)
+	if assert.Len(history, 2) {
+		assert.Equal(int64(3), history[0].Version)
+		assert.Equal("tester", history[0].Actor)
+		out, err := policy.Verify(history[0].Token, authorityPub, nil)
+		assert.NoError(err)
+		assert.Equal([]string{"FR"}, out.StreamCountries)
+	}
+
+	// a ramped policy applies to a stable half of accounts, the rest staying on the previous policy
+	var batch []sovereignty.Classification
+	for i := 0; i < 200; i++ {
+		batch = append(batch, sovereignty.Classification{DID: fmt.Sprintf("did:plc:ramp%d", i), Country: "CA", Source: "admin"})
+	}
+	assert.NoError(b1.bgs.SetClassifications(ctx, batch))
+	doc.Version = 4
+	doc.StreamCountries = []string{"CA"}
+	assert.Equal(400, apply(doc, authority, &policy.Ramp{Start: 50, Step: 0, Interval: "1h"}))
+	assert.Equal(200, apply(doc, authority, &policy.Ramp{Start: 50, Step: 10, Interval: "1h"}))
+	var included int
+	for _, c := range batch {
+		st := b1.bgs.AccountStanding(c.DID)
+		assert.Equal(policy.Covers(c.DID, 50), st.Included)
+		if st.Included {
+			included++
+		}
+	}
+	assert.InDelta(100, included, 30)
+	st := b1.bgs.PolicyRamp()
+	assert.Equal(int64(4), st.Version)
+	assert.Equal(50.0, st.Percent)
+	if assert.NotNil(st.PreviousVersion) {
+		assert.Equal(int64(3), *st.PreviousVersion)
+	}
+
+	// applying without a ramp ends the rollout
+	doc.Version = 5
+	assert.Equal(200, apply(doc, authority, nil))
+	st = b1.bgs.PolicyRamp()
+	assert.Nil(st.PreviousVersion)
+	assert.Equal(100.0, st.Percent)
+	assert.True(b1.bgs.AccountStanding(batch[0].DID).Included)
+}
+
+func TestRelayResumeTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping Relay test in 'short' test mode")
+	}
+	assert := assert.New(t)
+
+	key := []byte("resume-token-test-key")
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".tpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupRelayWithConfig(t, didr, true, func(config *bgs.BGSConfig) {
+		config.Sovereign.StreamCountries = []string{"CA"}
+		config.Sovereign.ResumeKey = key
+		config.Sovereign.ResumeEpoch = 2
+	})
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+	p1.RequestScraping(t, b1)
+	p1.BumpLimits(t, b1)
+	time.Sleep(time.Millisecond * 50)
+
+	bob := p1.MustNewUser(t, "bob.tpds")
+	assert.NoError(b1.bgs.SetClassification(context.TODO(), sovereignty.Classification{DID: bob.did, Country: "CA", Source: "admin"}))
+
+	dial := func(cursor string) *websocket.Conn {
+		u := "ws://" + b1.Host() + "/sovereignty/xrpc/com.atproto.sync.subscribeRepos"
+		if cursor != "" {
+			u += "?cursor=" + url.QueryEscape(cursor)
+		}
+		con, _, err := websocket.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { con.Close() })
+		return con
+	}
+	next := func(con *websocket.Conn) *events.XRPCStreamEvent {
+		con.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, r, err := con.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var evt events.XRPCStreamEvent
+		if err := evt.Deserialize(r); err != nil {
+			t.Fatal(err)
+		}
+		return &evt
+	}
+
+	live := dial("")
+	time.Sleep(time.Millisecond * 50)
+	bob.Post(t, "first")
+	bob.Post(t, "second")
+	first, second := next(live), next(live)
+	assert.NotEmpty(first.Resume)
+	assert.NotEqual(first.Resume, second.Resume)
+
+	signer, err := resume.NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := signer.Parse(first.Resume)
+	assert.NoError(err)
+	assert.Equal(first.Sequence(), tok.Seq)
+	assert.Equal(int64(2), tok.Epoch)
+
+	// resuming after the first frame picks up at the second
+	assert.Equal(second.Sequence(), next(dial(first.Resume)).Sequence())
+
+	rejected := func(cursor, kind string) string {
+		evt := next(dial(cursor))
+		if assert.NotNil(evt.Error) {
+			assert.Equal(kind, evt.Error.Error)
+			return evt.Error.Message
+		}
+		return ""
+	}
+
+	// integer cursors can't be checked, so they are refused without the compat option
+	rejected(fmt.Sprint(first.Sequence()), bgs.ErrInvalidResumeToken)
+
+	forged := tok
+	forged.Seq = 0
+	other, _ := resume.NewSigner([]byte("some-other-relays-key"))
+	rejected(other.Issue(forged), bgs.ErrInvalidResumeToken)
+	rejected("not-a-cursor", bgs.ErrInvalidResumeToken)
+
+	stale := tok
+	stale.Epoch = 1
+	assert.Contains(rejected(signer.Issue(stale), bgs.ErrResumeEpochMismatch), "epoch 1")
+
+	// a token from before a filter change comes back with a fresh token to accept the change
+	changed := tok
+	changed.Filter++
+	msg := rejected(signer.Issue(changed), bgs.ErrFilterConfigChanged)
+	idx := strings.Index(msg, "cursor=")
+	if assert.True(idx >= 0, msg) {
+		assert.Equal(second.Sequence(), next(dial(msg[idx+len("cursor="):])).Sequence())
+	}
+}
+
 func commitFromSlice(t *testing.T, slice []byte, rcid cid.Cid) *repo.SignedCommit {
 	carr, err := car.NewCarReader(bytes.NewReader(slice))
 	if err != nil {
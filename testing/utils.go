@@ -509,9 +509,14 @@ func (t *TestRelay) Host() string {
 }
 
 func MustSetupRelay(t *testing.T, didr plc.PLCClient, archive bool) *TestRelay {
+	return MustSetupRelayWithConfig(t, didr, archive, nil)
+}
+
+// MustSetupRelayWithConfig is MustSetupRelay, letting the caller adjust the relay's config before it is created
+func MustSetupRelayWithConfig(t *testing.T, didr plc.PLCClient, archive bool, configure func(*bgs.BGSConfig)) *TestRelay {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	tbgs, err := SetupRelay(ctx, didr, archive)
+	tbgs, err := SetupRelayWithConfig(ctx, didr, archive, configure)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -520,6 +525,10 @@ func MustSetupRelay(t *testing.T, didr plc.PLCClient, archive bool) *TestRelay {
 }
 
 func SetupRelay(ctx context.Context, didr plc.PLCClient, archive bool) (*TestRelay, error) {
+	return SetupRelayWithConfig(ctx, didr, archive, nil)
+}
+
+func SetupRelayWithConfig(ctx context.Context, didr plc.PLCClient, archive bool, configure func(*bgs.BGSConfig)) (*TestRelay, error) {
 	dir, err := os.MkdirTemp("", "integtest")
 	if err != nil {
 		return nil, err
@@ -582,6 +591,9 @@ func SetupRelay(ctx context.Context, didr plc.PLCClient, archive bool) (*TestRel
 
 	bgsConfig := bgs.DefaultBGSConfig()
 	bgsConfig.SSL = false
+	if configure != nil {
+		configure(bgsConfig)
+	}
 	b, err := bgs.NewBGS(maindb, ix, repoman, evtman, didr, rf, tr, bgsConfig)
 	if err != nil {
 		return nil, err
@@ -629,6 +641,11 @@ type EventStream struct {
 }
 
 func (b *TestRelay) Events(t *testing.T, since int64) *EventStream {
+	return b.EventsAt(t, "/xrpc/com.atproto.sync.subscribeRepos", since)
+}
+
+// EventsAt subscribes to a firehose-style stream served at the given path
+func (b *TestRelay) EventsAt(t *testing.T, path string, since int64) *EventStream {
 	d := websocket.Dialer{}
 	h := http.Header{}
 
@@ -637,7 +654,7 @@ func (b *TestRelay) Events(t *testing.T, since int64) *EventStream {
 		q = fmt.Sprintf("?cursor=%d", since)
 	}
 
-	con, resp, err := d.Dial("ws://"+b.Host()+"/xrpc/com.atproto.sync.subscribeRepos"+q, h)
+	con, resp, err := d.Dial("ws://"+b.Host()+path+q, h)
 	if err != nil {
 		t.Fatal(err)
 	}
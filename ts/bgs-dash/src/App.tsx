@@ -15,6 +15,7 @@ import Domains from "./components/Domains/Domains";
 import Repos from "./components/Repos/Repos";
 import Consumers from "./components/Consumers/Consumers";
 import NewPDS from "./components/NewPDS/NewPDS";
+import PreScreen from "./components/PreScreen/PreScreen";
 
 function classNames(...classes: string[]) {
   return classes.filter(Boolean).join(" ");
@@ -116,6 +117,21 @@ const routes: Route[] = [
     ),
     requrieAuth: true,
   },
+  {
+    path: "/prescreen",
+    name: "Pre-screen",
+    element: (
+      <RequireAuth>
+        <Nav />
+        <main>
+          <div className="mx-auto max-w-7xl px-2 py-6 sm:px-6 lg:px-8">
+            <PreScreen />
+          </div>
+        </main>
+      </RequireAuth>
+    ),
+    requrieAuth: true,
+  },
 
   {
     path: "/login",
@@ -0,0 +1,421 @@
+import { FC, useEffect, useState } from "react";
+import Notification, {
+  NotificationMeta,
+  NotificationType,
+} from "../Notification/Notification";
+
+import { RELAY_HOST } from "../../constants";
+
+import { useNavigate } from "react-router-dom";
+import { HeldEvent, WatchedRepo } from "../../models/prescreen";
+
+const PreScreen: FC<{}> = () => {
+  const [pending, setPending] = useState<HeldEvent[] | null>(null);
+  const [watchlist, setWatchlist] = useState<WatchedRepo[] | null>(null);
+  const [actor, setActor] = useState<string>("");
+  const [repoToWatch, setRepoToWatch] = useState<string>("");
+  const [watchReason, setWatchReason] = useState<string>("");
+
+  // Notification Management
+  const [shouldShowNotification, setShouldShowNotification] =
+    useState<boolean>(false);
+  const [notification, setNotification] = useState<NotificationMeta>({
+    message: "",
+    alertType: "",
+  });
+
+  const [adminToken, setAdminToken] = useState<string>(
+    localStorage.getItem("admin_route_token") || ""
+  );
+  const navigate = useNavigate();
+
+  const setAlertWithTimeout = (
+    type: NotificationType,
+    message: string,
+    dismiss: boolean
+  ) => {
+    setNotification({
+      message,
+      alertType: type,
+      autodismiss: dismiss,
+    });
+    setShouldShowNotification(true);
+  };
+
+  const adminRequest = (path: string, body?: object) => {
+    return fetch(`${RELAY_HOST}/admin/sovereignty/prescreen${path}`, {
+      method: body ? "POST" : "GET",
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${adminToken}`,
+      },
+      body: body ? JSON.stringify(body) : undefined,
+    }).then(async (res) => {
+      const json = await res.json();
+      if (!res.ok) {
+        throw new Error(json.message || res.statusText);
+      }
+      return json;
+    });
+  };
+
+  const refreshPending = () => {
+    adminRequest("")
+      .then((res) => setPending(res.pending))
+      .catch((err) => {
+        setAlertWithTimeout(
+          "failure",
+          `Failed to fetch pre-screen queue: ${err.message}`,
+          true
+        );
+      });
+  };
+
+  const refreshWatchlist = () => {
+    adminRequest("/watchlist")
+      .then((res) => setWatchlist(res.watchlist))
+      .catch((err) => {
+        setAlertWithTimeout(
+          "failure",
+          `Failed to fetch watchlist: ${err.message}`,
+          true
+        );
+      });
+  };
+
+  useEffect(() => {
+    const token = localStorage.getItem("admin_route_token");
+    if (token) {
+      setAdminToken(token);
+    } else {
+      navigate("/login");
+    }
+  }, []);
+
+  useEffect(() => {
+    refreshPending();
+    refreshWatchlist();
+    // Refresh the queue every 5 seconds
+    const interval = setInterval(refreshPending, 5000);
+    return () => clearInterval(interval);
+  }, [adminToken]);
+
+  const decide = (item: HeldEvent, approve: boolean) => {
+    if (!actor.trim()) {
+      setAlertWithTimeout("failure", "Enter your name for the audit log", true);
+      return;
+    }
+    adminRequest("/decide", { id: item.id, approve, actor: actor.trim() })
+      .then(() => {
+        setAlertWithTimeout(
+          "success",
+          `${approve ? "Approved" : "Dropped"} ${item.kind} event from ${item.did}`,
+          true
+        );
+        refreshPending();
+      })
+      .catch((err) => {
+        setAlertWithTimeout(
+          "failure",
+          `Failed to decide on event: ${err.message}`,
+          true
+        );
+      });
+  };
+
+  const watch = () => {
+    adminRequest("/watchlist", {
+      did: repoToWatch.trim(),
+      reason: watchReason.trim(),
+      actor: actor.trim(),
+    })
+      .then(() => {
+        setAlertWithTimeout(
+          "success",
+          `Added ${repoToWatch.trim()} to the watchlist`,
+          true
+        );
+        setRepoToWatch("");
+        setWatchReason("");
+        refreshWatchlist();
+      })
+      .catch((err) => {
+        setAlertWithTimeout(
+          "failure",
+          `Failed to add to the watchlist: ${err.message}`,
+          true
+        );
+      });
+  };
+
+  const unwatch = (did: string) => {
+    adminRequest("/watchlist/remove", { did, actor: actor.trim() })
+      .then(() => {
+        setAlertWithTimeout(
+          "success",
+          `Removed ${did} from the watchlist`,
+          true
+        );
+        refreshWatchlist();
+      })
+      .catch((err) => {
+        setAlertWithTimeout(
+          "failure",
+          `Failed to remove from the watchlist: ${err.message}`,
+          true
+        );
+      });
+  };
+
+  return (
+    <div className="mx-auto max-w-full">
+      {shouldShowNotification ? (
+        <Notification
+          message={notification.message}
+          alertType={notification.alertType}
+          subMessage={notification.subMessage}
+          autodismiss={notification.autodismiss}
+          unshow={() => {
+            setShouldShowNotification(false);
+            setNotification({ message: "", alertType: "" });
+          }}
+          show={shouldShowNotification}
+        ></Notification>
+      ) : (
+        <></>
+      )}
+      <div className="sm:flex sm:items-center">
+        <div className="sm:flex-auto">
+          <h1 className="text-2xl font-semibold leading-6 text-gray-900">
+            Moderation Pre-screen
+          </h1>
+          <p className="mt-2 text-sm text-gray-700">
+            Events from watchlisted repos are held here until they are approved
+            or dropped, or their deadline passes. Decisions and watchlist
+            changes are recorded in the audit log under your name.
+          </p>
+        </div>
+      </div>
+      <div className="mt-5 max-w-3xl w-full">
+        <label
+          htmlFor="actor"
+          className="block text-sm font-medium leading-6 text-gray-900"
+        >
+          Moderator
+        </label>
+        <input
+          type="text"
+          name="actor"
+          id="actor"
+          className="mt-2 block w-72 rounded-md border-0 py-1.5 text-gray-900 shadow-sm ring-1 ring-inset ring-gray-300 placeholder:text-gray-400 focus:ring-2 focus:ring-inset focus:ring-indigo-600 sm:text-sm sm:leading-6"
+          placeholder="your name"
+          value={actor}
+          onChange={(e) => {
+            setActor(e.target.value);
+          }}
+        />
+      </div>
+      <div className="mt-8 flow-root">
+        <div className="shadow ring-1 ring-black ring-opacity-5 sm:rounded-lg overflow-x-auto">
+          <table className="min-w-full divide-y divide-gray-300">
+            <thead className="bg-gray-50">
+              <tr>
+                <th
+                  scope="col"
+                  className="py-3.5 pl-4 pr-3 text-left text-sm font-semibold text-gray-900 sm:pl-6"
+                >
+                  Repo
+                </th>
+                <th
+                  scope="col"
+                  className="px-3 py-3.5 text-left text-sm font-semibold text-gray-900"
+                >
+                  Event
+                </th>
+                <th
+                  scope="col"
+                  className="px-3 py-3.5 text-left text-sm font-semibold text-gray-900"
+                >
+                  Held At
+                </th>
+                <th
+                  scope="col"
+                  className="px-3 py-3.5 text-left text-sm font-semibold text-gray-900"
+                >
+                  Deadline
+                </th>
+                <th scope="col" className="relative py-3.5 pl-3 pr-4 sm:pr-6">
+                  <span className="sr-only">Decide</span>
+                </th>
+              </tr>
+            </thead>
+            <tbody className="divide-y divide-gray-200 bg-white">
+              {pending && pending.length === 0 && (
+                <tr>
+                  <td
+                    colSpan={5}
+                    className="whitespace-nowrap py-4 pl-4 pr-3 text-sm text-gray-500 sm:pl-6"
+                  >
+                    No events are held.
+                  </td>
+                </tr>
+              )}
+              {pending &&
+                pending.map((item) => {
+                  return (
+                    <tr key={item.id}>
+                      <td className="whitespace-nowrap py-4 pl-4 pr-3 text-sm font-medium text-gray-900 sm:pl-6 text-left">
+                        {item.did}
+                        {item.reason && (
+                          <div className="text-gray-400">{item.reason}</div>
+                        )}
+                      </td>
+                      <td className="px-3 py-4 text-sm text-gray-500 text-left">
+                        {item.kind}
+                        {item.rev && ` ${item.rev}`}
+                        {item.ops &&
+                          item.ops.map((op) => (
+                            <div key={op} className="text-gray-400">
+                              {op}
+                            </div>
+                          ))}
+                      </td>
+                      <td className="whitespace-nowrap px-3 py-4 text-sm text-gray-500 text-left">
+                        {new Date(item.heldAt).toLocaleString()}
+                      </td>
+                      <td className="whitespace-nowrap px-3 py-4 text-sm text-gray-500 text-left">
+                        {new Date(item.deadline).toLocaleString()}
+                      </td>
+                      <td className="whitespace-nowrap py-4 pl-3 pr-4 text-right text-sm font-medium sm:pr-6">
+                        {item.action ? (
+                          <span className="text-gray-400">
+                            {item.action === "emit" ? "Approved" : "Dropped"},
+                            waiting for earlier events
+                          </span>
+                        ) : (
+                          <>
+                            <button
+                              type="button"
+                              onClick={() => decide(item, true)}
+                              className="inline-flex items-center rounded-md bg-green-600 px-2.5 py-1.5 text-sm font-semibold text-white shadow-sm hover:bg-green-500"
+                            >
+                              Approve
+                            </button>
+                            <button
+                              type="button"
+                              onClick={() => decide(item, false)}
+                              className="ml-2 inline-flex items-center rounded-md bg-red-600 px-2.5 py-1.5 text-sm font-semibold text-white shadow-sm hover:bg-red-500"
+                            >
+                              Drop
+                            </button>
+                          </>
+                        )}
+                      </td>
+                    </tr>
+                  );
+                })}
+            </tbody>
+          </table>
+        </div>
+      </div>
+      <div className="mt-10 sm:flex sm:items-center">
+        <div className="sm:flex-auto">
+          <h2 className="text-xl font-semibold leading-6 text-gray-900">
+            Watchlist
+          </h2>
+        </div>
+      </div>
+      <div className="mt-5 inline-flex flex-col sm:flex-row">
+        <input
+          type="text"
+          name="repo"
+          id="repo"
+          className="block w-72 rounded-md border-0 py-1.5 text-gray-900 shadow-sm ring-1 ring-inset ring-gray-300 placeholder:text-gray-400 focus:ring-2 focus:ring-inset focus:ring-indigo-600 sm:text-sm sm:leading-6"
+          placeholder="did:plc:watched"
+          value={repoToWatch}
+          onChange={(e) => {
+            setRepoToWatch(e.target.value);
+          }}
+        />
+        <input
+          type="text"
+          name="reason"
+          id="reason"
+          className="mt-4 sm:mt-0 sm:ml-2 block w-72 rounded-md border-0 py-1.5 text-gray-900 shadow-sm ring-1 ring-inset ring-gray-300 placeholder:text-gray-400 focus:ring-2 focus:ring-inset focus:ring-indigo-600 sm:text-sm sm:leading-6"
+          placeholder="reason (eg, court order reference)"
+          value={watchReason}
+          onChange={(e) => {
+            setWatchReason(e.target.value);
+          }}
+        />
+        <button
+          type="button"
+          onClick={watch}
+          className="mt-4 sm:mt-0 sm:ml-2 inline-flex whitespace-nowrap items-center rounded-md bg-indigo-600 px-2.5 py-1.5 text-sm font-semibold text-white shadow-sm hover:bg-indigo-500"
+        >
+          Watch Repo
+        </button>
+      </div>
+      <div className="mt-5 flow-root">
+        <div className="shadow ring-1 ring-black ring-opacity-5 sm:rounded-lg overflow-x-auto">
+          <table className="min-w-full divide-y divide-gray-300">
+            <thead className="bg-gray-50">
+              <tr>
+                <th
+                  scope="col"
+                  className="py-3.5 pl-4 pr-3 text-left text-sm font-semibold text-gray-900 sm:pl-6"
+                >
+                  Repo
+                </th>
+                <th
+                  scope="col"
+                  className="px-3 py-3.5 text-left text-sm font-semibold text-gray-900"
+                >
+                  Reason
+                </th>
+                <th
+                  scope="col"
+                  className="px-3 py-3.5 text-left text-sm font-semibold text-gray-900"
+                >
+                  Added By
+                </th>
+                <th scope="col" className="relative py-3.5 pl-3 pr-4 sm:pr-6">
+                  <span className="sr-only">Remove</span>
+                </th>
+              </tr>
+            </thead>
+            <tbody className="divide-y divide-gray-200 bg-white">
+              {watchlist &&
+                watchlist.map((repo) => {
+                  return (
+                    <tr key={repo.did}>
+                      <td className="whitespace-nowrap py-4 pl-4 pr-3 text-sm font-medium text-gray-900 sm:pl-6 text-left">
+                        {repo.did}
+                      </td>
+                      <td className="px-3 py-4 text-sm text-gray-500 text-left">
+                        {repo.reason}
+                      </td>
+                      <td className="whitespace-nowrap px-3 py-4 text-sm text-gray-500 text-left">
+                        {repo.addedBy} ({new Date(repo.createdAt).toLocaleString()})
+                      </td>
+                      <td className="whitespace-nowrap py-4 pl-3 pr-4 text-right text-sm font-medium sm:pr-6">
+                        <button
+                          type="button"
+                          onClick={() => unwatch(repo.did)}
+                          className="text-red-600 hover:text-red-900"
+                        >
+                          Remove
+                        </button>
+                      </td>
+                    </tr>
+                  );
+                })}
+            </tbody>
+          </table>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default PreScreen;
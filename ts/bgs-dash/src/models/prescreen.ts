@@ -0,0 +1,20 @@
+interface HeldEvent {
+  id: number;
+  did: string;
+  kind: string;
+  rev?: string;
+  ops?: string[];
+  reason?: string;
+  heldAt: string;
+  deadline: string;
+  action?: string;
+}
+
+interface WatchedRepo {
+  did: string;
+  reason?: string;
+  addedBy: string;
+  createdAt: string;
+}
+
+export type { HeldEvent, WatchedRepo };
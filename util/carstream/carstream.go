@@ -0,0 +1,192 @@
+package carstream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+// Getter is the part of a blockstore needed to stream blocks out of it. Get must be safe to call concurrently.
+type Getter interface {
+	Get(ctx context.Context, c cid.Cid) (blockformat.Block, error)
+}
+
+// Options bound the work Copy does at once
+type Options struct {
+	// blocks fetched concurrently
+	Concurrency int
+	// blocks fetched ahead of the one being written, including those in flight. This bounds memory use
+	Window int
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Concurrency: 8,
+		Window:      64,
+	}
+}
+
+// Writer writes a CARv1 file, one block at a time
+type Writer struct {
+	bw      *bufio.Writer
+	written int64
+	blocks  int
+}
+
+// NewWriter writes the CAR header with the given roots. Blocks are buffered; call Flush once done.
+func NewWriter(w io.Writer, roots ...cid.Cid) (*Writer, error) {
+	cw := &Writer{bw: bufio.NewWriterSize(w, 64<<10)}
+	if err := car.WriteHeader(&car.CarHeader{Roots: roots, Version: 1}, countingWriter{cw}); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+type countingWriter struct {
+	cw *Writer
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.cw.bw.Write(p)
+	c.cw.written += int64(n)
+	return n, err
+}
+
+// WriteBlock appends a block to the CAR
+func (cw *Writer) WriteBlock(blk blockformat.Block) error {
+	if err := carutil.LdWrite(countingWriter{cw}, blk.Cid().Bytes(), blk.RawData()); err != nil {
+		return err
+	}
+	cw.blocks++
+	return nil
+}
+
+// Flush writes out any buffered data
+func (cw *Writer) Flush() error {
+	return cw.bw.Flush()
+}
+
+// Written returns the bytes written so far, including any still buffered
+func (cw *Writer) Written() int64 {
+	return cw.written
+}
+
+// Blocks returns the number of blocks written so far
+func (cw *Writer) Blocks() int {
+	return cw.blocks
+}
+
+// Item is a block to write: either a CID to fetch, or a block the source already has
+type Item struct {
+	Cid   cid.Cid
+	Block blockformat.Block
+}
+
+// Source produces the blocks to write, in order, by calling emit for each. emit blocks while the window is full, and returns an error once the copy has failed; the source should return it.
+type Source func(ctx context.Context, emit func(Item) error) error
+
+type fetch struct {
+	c    cid.Cid
+	blk  blockformat.Block
+	err  error
+	done chan struct{}
+}
+
+// Copy writes the blocks produced by src, fetching those it doesn't supply from bs with opts.Concurrency requests in flight. Blocks are written in the order src produced them, whatever order the fetches complete in. The first error from the source, a fetch, or a write stops the copy.
+func (cw *Writer) Copy(ctx context.Context, bs Getter, src Source, opts *Options) error {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	workers := max(opts.Concurrency, 1)
+	window := max(opts.Window, workers)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pending holds fetches in output order; its capacity is the window
+	pending := make(chan *fetch, window-1)
+	work := make(chan *fetch)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				f.blk, f.err = bs.Get(ctx, f.c)
+				if f.err == nil && !f.blk.Cid().Equals(f.c) {
+					f.err = fmt.Errorf("blockstore returned %s for %s", f.blk.Cid(), f.c)
+				}
+				close(f.done)
+			}
+		}()
+	}
+
+	var srcErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		defer close(work)
+		srcErr = src(ctx, func(it Item) error {
+			f := &fetch{c: it.Cid, blk: it.Block, done: make(chan struct{})}
+			if f.blk != nil {
+				close(f.done)
+			}
+			select {
+			case pending <- f:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if f.blk != nil {
+				return nil
+			}
+			select {
+			case work <- f:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		})
+	}()
+
+	err := cw.drain(ctx, pending)
+	if err != nil {
+		cancel()
+	}
+	// unblock the source if it is waiting on a full window
+	for range pending {
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if srcErr != nil {
+		return srcErr
+	}
+	return nil
+}
+
+func (cw *Writer) drain(ctx context.Context, pending <-chan *fetch) error {
+	for f := range pending {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if f.err != nil {
+			return fmt.Errorf("fetching %s: %w", f.c, f.err)
+		}
+		if err := cw.WriteBlock(f.blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package carstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-libipfs/blocks"
+	car "github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowGetter delays each fetch by a random amount, and tracks how many are in flight
+type slowGetter struct {
+	bs       blockstore.Blockstore
+	inflight atomic.Int64
+	peak     atomic.Int64
+	fail     cid.Cid
+}
+
+func (sg *slowGetter) Get(ctx context.Context, c cid.Cid) (blockformat.Block, error) {
+	n := sg.inflight.Add(1)
+	defer sg.inflight.Add(-1)
+	for {
+		p := sg.peak.Load()
+		if n <= p || sg.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	if c.Equals(sg.fail) {
+		return nil, fmt.Errorf("disk on fire")
+	}
+	return sg.bs.Get(ctx, c)
+}
+
+func TestCopyOrder(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	var cids []cid.Cid
+	for i := 0; i < 500; i++ {
+		blk := blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+		assert.NoError(bs.Put(ctx, blk))
+		cids = append(cids, blk.Cid())
+	}
+	src := func(ctx context.Context, emit func(Item) error) error {
+		for _, c := range cids {
+			if err := emit(Item{Cid: c}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sg := &slowGetter{bs: bs}
+	buf := new(bytes.Buffer)
+	cw, err := NewWriter(buf, cids[0])
+	assert.NoError(err)
+	assert.NoError(cw.Copy(ctx, sg, src, &Options{Concurrency: 4, Window: 16}))
+	assert.NoError(cw.Flush())
+	assert.Equal(500, cw.Blocks())
+	assert.Equal(int64(buf.Len()), cw.Written())
+	assert.LessOrEqual(sg.peak.Load(), int64(4))
+	assert.Greater(sg.peak.Load(), int64(1))
+
+	cr, err := car.NewCarReader(buf)
+	assert.NoError(err)
+	for i := range cids {
+		blk, err := cr.Next()
+		if !assert.NoError(err) {
+			break
+		}
+		assert.Equal(cids[i], blk.Cid())
+	}
+
+	// a failed fetch stops the copy
+	sg = &slowGetter{bs: bs, fail: cids[300]}
+	cw, err = NewWriter(new(bytes.Buffer), cids[0])
+	assert.NoError(err)
+	err = cw.Copy(ctx, sg, src, &Options{Concurrency: 4, Window: 16})
+	assert.ErrorContains(err, "disk on fire")
+	assert.Equal(300, cw.Blocks())
+}
+
+func TestWriteRepo(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	r := repo.NewRepo(ctx, "did:plc:carstream", bs)
+	recs := make(map[cid.Cid]bool)
+	for i := 0; i < 300; i++ {
+		c, _, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)})
+		assert.NoError(err)
+		recs[c] = true
+	}
+	kmgr := &util.FakeKeyManager{}
+	head, _, err := r.Commit(ctx, kmgr.SignForUser)
+	assert.NoError(err)
+
+	buf := new(bytes.Buffer)
+	n, err := WriteRepo(ctx, buf, &slowGetter{bs: bs}, head, &Options{Concurrency: 8, Window: 8})
+	assert.NoError(err)
+	assert.Equal(int64(buf.Len()), n)
+
+	rr, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(rr.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		if !recs[v] {
+			return fmt.Errorf("unexpected record %s", k)
+		}
+		delete(recs, v)
+		return nil
+	}))
+	assert.Empty(recs)
+
+	// the commit comes first
+	cr, err := car.NewCarReader(bytes.NewReader(buf.Bytes()))
+	assert.NoError(err)
+	assert.Equal([]cid.Cid{head}, cr.Header.Roots)
+	first, err := cr.Next()
+	assert.NoError(err)
+	assert.Equal(head, first.Cid())
+}
+
+func TestWriteDiff(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	kmgr := &util.FakeKeyManager{}
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	r := repo.NewRepo(ctx, "did:plc:carstream", bs)
+	var paths []string
+	for i := 0; i < 1000; i++ {
+		_, rkey, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)})
+		assert.NoError(err)
+		paths = append(paths, "app.bsky.feed.post/"+rkey)
+	}
+	since, _, err := r.Commit(ctx, kmgr.SignForUser)
+	assert.NoError(err)
+
+	r, err = repo.OpenRepo(ctx, bs, since)
+	assert.NoError(err)
+	for i := 0; i < 10; i++ {
+		_, _, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("new post %d", i)})
+		assert.NoError(err)
+	}
+	assert.NoError(r.DeleteRecord(ctx, paths[10]))
+	_, err = r.UpdateRecord(ctx, paths[20], &appbsky.FeedPost{Text: "edited"})
+	assert.NoError(err)
+	// the same content as an existing record
+	_, _, err = r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: "post 30"})
+	assert.NoError(err)
+	head, _, err := r.Commit(ctx, kmgr.SignForUser)
+	assert.NoError(err)
+
+	full := new(bytes.Buffer)
+	_, err = WriteRepo(ctx, full, bs, since, nil)
+	assert.NoError(err)
+	diff := new(bytes.Buffer)
+	n, err := WriteDiff(ctx, diff, &slowGetter{bs: bs}, since, head, nil)
+	assert.NoError(err)
+	assert.Equal(int64(diff.Len()), n)
+	assert.Less(diff.Len(), full.Len()/10)
+
+	// the old repo plus the diff make up the new repo
+	cbs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	_, err = car.LoadCar(ctx, cbs, bytes.NewReader(full.Bytes()))
+	assert.NoError(err)
+	ch, err := car.LoadCar(ctx, cbs, bytes.NewReader(diff.Bytes()))
+	assert.NoError(err)
+	assert.Equal([]cid.Cid{head}, ch.Roots)
+	checkComplete(t, cbs, bs, head)
+
+	// without a usable since commit, the whole repo is sent
+	for _, old := range []cid.Cid{cid.Undef, blocks.NewBlock([]byte("not a commit")).Cid()} {
+		buf := new(bytes.Buffer)
+		_, err = WriteDiff(ctx, buf, bs, old, head, nil)
+		assert.NoError(err)
+		cbs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+		_, err = car.LoadCar(ctx, cbs, bytes.NewReader(buf.Bytes()))
+		assert.NoError(err)
+		checkComplete(t, cbs, bs, head)
+	}
+
+	// nothing changed
+	buf := new(bytes.Buffer)
+	_, err = WriteDiff(ctx, buf, bs, head, head, nil)
+	assert.NoError(err)
+	cr, err := car.NewCarReader(buf)
+	assert.NoError(err)
+	blk, err := cr.Next()
+	assert.NoError(err)
+	assert.Equal(head, blk.Cid())
+	_, err = cr.Next()
+	assert.Error(err)
+}
+
+// checkComplete checks bs holds every block of the repo with the given commit, as found in src
+func checkComplete(t *testing.T, bs, src blockstore.Blockstore, commit cid.Cid) {
+	t.Helper()
+	ctx := context.Background()
+	want := new(bytes.Buffer)
+	_, err := WriteRepo(ctx, want, src, commit, nil)
+	assert.NoError(t, err)
+	cr, err := car.NewCarReader(want)
+	assert.NoError(t, err)
+	for {
+		blk, err := cr.Next()
+		if err != nil {
+			break
+		}
+		has, err := bs.Has(ctx, blk.Cid())
+		assert.NoError(t, err)
+		assert.True(t, has, "missing %s", blk.Cid())
+	}
+}
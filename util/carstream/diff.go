@@ -0,0 +1,179 @@
+package carstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/mst"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DiffSource produces the blocks a consumer holding the repo at the since commit needs to bring it up to the given commit: the new commit block, the new tree's MST nodes which the old tree doesn't have, and the records they point to which the old tree doesn't have either.
+//
+// Both trees are walked a layer at a time, from the top. A key always sits at the same layer, so a subtree shared by both trees is found at the same layer in each, and is skipped on both sides without being read. Only the parts of the trees which differ are walked. The old tree is only used to leave blocks out: if it, or any part of it, can't be read, more of the new tree is sent, never less.
+func DiffSource(bs Getter, since, commit cid.Cid) Source {
+	return func(ctx context.Context, emit func(Item) error) error {
+		blk, sc, err := getCommit(ctx, bs, commit)
+		if err != nil {
+			return err
+		}
+		if err := emit(Item{Cid: commit, Block: blk}); err != nil {
+			return err
+		}
+		if since.Equals(commit) {
+			return nil
+		}
+
+		var from cid.Cid
+		if since.Defined() {
+			if _, old, err := getCommit(ctx, bs, since); err == nil {
+				from = old.Data
+			} else if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		return diffTrees(ctx, bs, from, sc.Data, emit)
+	}
+}
+
+// diffLevel is one tree's nodes at a layer which remain to be walked
+type diffLevel struct {
+	layer int
+	nodes []cid.Cid
+}
+
+func diffTrees(ctx context.Context, bs Getter, from, to cid.Cid, emit func(Item) error) error {
+	if from.Equals(to) {
+		return nil
+	}
+	newTop, err := nodeLayer(ctx, bs, to)
+	if err != nil {
+		return err
+	}
+	newLevel := &diffLevel{layer: newTop, nodes: []cid.Cid{to}}
+	var oldLevel *diffLevel
+	if from.Defined() {
+		if oldTop, err := nodeLayer(ctx, bs, from); err == nil {
+			oldLevel = &diffLevel{layer: oldTop, nodes: []cid.Cid{from}}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	// records the consumer has, or has been sent
+	known := make(map[cid.Cid]bool)
+	for newLevel != nil {
+		layer := newLevel.layer
+		if oldLevel != nil && oldLevel.layer > layer {
+			layer = oldLevel.layer
+		}
+		var olds, news []cid.Cid
+		if oldLevel != nil && oldLevel.layer == layer {
+			olds = oldLevel.nodes
+		}
+		if newLevel.layer == layer {
+			news = newLevel.nodes
+		}
+		shared := make(map[cid.Cid]bool)
+		for _, c := range olds {
+			shared[c] = true
+		}
+
+		// the old side goes first, so the new side's records can be checked against it
+		if olds != nil {
+			inNew := make(map[cid.Cid]bool, len(news))
+			for _, c := range news {
+				inNew[c] = true
+			}
+			var next []cid.Cid
+			for _, c := range olds {
+				if inNew[c] {
+					continue
+				}
+				_, nd, err := getNode(ctx, bs, c)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					continue
+				}
+				next = appendChildren(next, nd)
+				for _, e := range nd.Entries {
+					known[e.Val] = true
+				}
+			}
+			oldLevel = &diffLevel{layer: layer - 1, nodes: next}
+			if len(next) == 0 {
+				oldLevel = nil
+			}
+		}
+
+		if news != nil {
+			var next []cid.Cid
+			for _, c := range news {
+				if shared[c] {
+					continue
+				}
+				blk, nd, err := getNode(ctx, bs, c)
+				if err != nil {
+					return err
+				}
+				if err := emit(Item{Cid: c, Block: blk}); err != nil {
+					return err
+				}
+				next = appendChildren(next, nd)
+				for _, e := range nd.Entries {
+					if known[e.Val] {
+						continue
+					}
+					known[e.Val] = true
+					if err := emit(Item{Cid: e.Val}); err != nil {
+						return err
+					}
+				}
+			}
+			newLevel = &diffLevel{layer: layer - 1, nodes: next}
+			if len(next) == 0 {
+				newLevel = nil
+			}
+		}
+	}
+	return nil
+}
+
+// appendChildren appends the node's subtrees, left to right
+func appendChildren(out []cid.Cid, nd *mst.NodeData) []cid.Cid {
+	if nd.Left != nil {
+		out = append(out, *nd.Left)
+	}
+	for _, e := range nd.Entries {
+		if e.Tree != nil {
+			out = append(out, *e.Tree)
+		}
+	}
+	return out
+}
+
+// nodeLayer finds the layer of the node at the top of a tree, descending to the first node with keys if need be
+func nodeLayer(ctx context.Context, bs Getter, node cid.Cid) (int, error) {
+	above := 0
+	for {
+		_, nd, err := getNode(ctx, bs, node)
+		if err != nil {
+			return 0, err
+		}
+		if layer, ok := nd.Layer(); ok {
+			return layer + above, nil
+		}
+		if nd.Left == nil {
+			// an empty tree
+			return above, nil
+		}
+		if above > 128 {
+			return 0, fmt.Errorf("MST node %s: too deep", node)
+		}
+		node = *nd.Left
+		above++
+	}
+}
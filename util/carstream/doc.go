@@ -0,0 +1,4 @@
+// Streaming CAR serialization with bounded memory.
+//
+// A Writer writes a CARv1 file block by block, so a repo can be sent to an HTTP response or an archive file without first being assembled in memory. Copy fetches blocks from a blockstore with several requests in flight, and writes them in the order they were requested; at most Options.Window blocks are held at once, however large the repo. WriteRepo walks a repo from its commit, through its MST, to its records, fetching records concurrently.
+package carstream
@@ -0,0 +1,109 @@
+package carstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/mst"
+	"github.com/bluesky-social/indigo/repo"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// RepoSource walks the repo with the given commit: the commit block, then its MST depth-first, each node followed by its left subtree, then each entry's record and right subtree, in key order. MST nodes are fetched by the walk itself, since their children are only known once they are read; records are left for Copy to fetch concurrently.
+func RepoSource(bs Getter, commit cid.Cid) Source {
+	return func(ctx context.Context, emit func(Item) error) error {
+		blk, sc, err := getCommit(ctx, bs, commit)
+		if err != nil {
+			return err
+		}
+		if err := emit(Item{Cid: commit, Block: blk}); err != nil {
+			return err
+		}
+		return walkNode(ctx, bs, sc.Data, emit)
+	}
+}
+
+func getCommit(ctx context.Context, bs Getter, commit cid.Cid) (blockformat.Block, *repo.SignedCommit, error) {
+	blk, err := bs.Get(ctx, commit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching commit %s: %w", commit, err)
+	}
+	var sc repo.SignedCommit
+	if err := sc.UnmarshalCBOR(bytes.NewReader(blk.RawData())); err != nil {
+		return nil, nil, fmt.Errorf("decoding commit %s: %w", commit, err)
+	}
+	return blk, &sc, nil
+}
+
+func getNode(ctx context.Context, bs Getter, node cid.Cid) (blockformat.Block, *mst.NodeData, error) {
+	blk, err := bs.Get(ctx, node)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching MST node %s: %w", node, err)
+	}
+	var nd mst.NodeData
+	if err := nd.UnmarshalCBOR(bytes.NewReader(blk.RawData())); err != nil {
+		return nil, nil, fmt.Errorf("decoding MST node %s: %w", node, err)
+	}
+	return blk, &nd, nil
+}
+
+func walkNode(ctx context.Context, bs Getter, node cid.Cid, emit func(Item) error) error {
+	blk, nd, err := getNode(ctx, bs, node)
+	if err != nil {
+		return err
+	}
+	if err := emit(Item{Cid: node, Block: blk}); err != nil {
+		return err
+	}
+
+	if nd.Left != nil {
+		if err := walkNode(ctx, bs, *nd.Left, emit); err != nil {
+			return err
+		}
+	}
+	for _, e := range nd.Entries {
+		if err := emit(Item{Cid: e.Val}); err != nil {
+			return err
+		}
+		if e.Tree != nil {
+			if err := walkNode(ctx, bs, *e.Tree, emit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteRepo writes the full repo with the given commit to w as a CAR file rooted at the commit, and returns the number of bytes written.
+func WriteRepo(ctx context.Context, w io.Writer, bs Getter, commit cid.Cid, opts *Options) (int64, error) {
+	cw, err := NewWriter(w, commit)
+	if err != nil {
+		return 0, err
+	}
+	if err := cw.Copy(ctx, bs, RepoSource(bs, commit), opts); err != nil {
+		return cw.Written(), err
+	}
+	if err := cw.Flush(); err != nil {
+		return cw.Written(), err
+	}
+	return cw.Written(), nil
+}
+
+// WriteDiff writes the blocks needed to bring a copy of the repo at the since commit up to the given commit, as a CAR file rooted at the new commit; see DiffSource. Returns the number of bytes written.
+func WriteDiff(ctx context.Context, w io.Writer, bs Getter, since, commit cid.Cid, opts *Options) (int64, error) {
+	cw, err := NewWriter(w, commit)
+	if err != nil {
+		return 0, err
+	}
+	if err := cw.Copy(ctx, bs, DiffSource(bs, since, commit), opts); err != nil {
+		return cw.Written(), err
+	}
+	if err := cw.Flush(); err != nil {
+		return cw.Written(), err
+	}
+	return cw.Written(), nil
+}
@@ -0,0 +1,80 @@
+package cartest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+var builder = cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256)
+
+// Block is an encoded DAG-CBOR block.
+type Block struct {
+	Cid cid.Cid
+	Raw []byte
+}
+
+// Link returns the block's CID, as referenced by a commit op.
+func (b Block) Link() *lexutil.LexLink {
+	l := lexutil.LexLink(b.Cid)
+	return &l
+}
+
+// NewBlock encodes obj, a map of atproto data or a cbor-gen value, as a block.
+func NewBlock(t testing.TB, obj any) Block {
+	t.Helper()
+	var raw []byte
+	switch v := obj.(type) {
+	case map[string]any:
+		b, err := data.MarshalCBOR(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw = b
+	case cbg.CBORMarshaler:
+		var buf bytes.Buffer
+		if err := v.MarshalCBOR(&buf); err != nil {
+			t.Fatal(err)
+		}
+		raw = buf.Bytes()
+	default:
+		t.Fatalf("can't encode %T as a block", obj)
+	}
+	c, err := builder.Sum(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Block{Cid: c, Raw: raw}
+}
+
+// Commit returns a commit block for did; it carries just enough to serve as a CAR root.
+func Commit(t testing.TB, did string) Block {
+	t.Helper()
+	return NewBlock(t, map[string]any{"did": did, "version": int64(3)})
+}
+
+// CAR writes blocks as a CARv1 file, rooted at the first.
+func CAR(t testing.TB, blocks ...Block) []byte {
+	t.Helper()
+	if len(blocks) == 0 {
+		t.Fatal("a CAR file needs a root block")
+	}
+	var buf bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{blocks[0].Cid}, Version: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := carutil.LdWrite(&buf, b.Cid.Bytes(), b.Raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,4 @@
+// Test fixtures of DAG-CBOR blocks and CAR files.
+//
+// NewBlock encodes a record, or a commit, as a block; CAR writes blocks as a CARv1 file, as in the blocks of a firehose commit. Failures are reported to the test, so fixtures can be built inline.
+package cartest
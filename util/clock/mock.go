@@ -0,0 +1,154 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Mock is a Clock whose time only moves when the test says so, with Advance or Set. Timers and tickers fire, in order, as the time passes their deadlines; like the real ones, each holds at most one undelivered tick, and further ticks are dropped until it is received.
+type Mock struct {
+	lk      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*mockWaiter
+}
+
+var _ Clock = (*Mock)(nil)
+
+// NewMock returns a Mock clock stopped at start.
+func NewMock(start time.Time) *Mock {
+	m := &Mock{now: start}
+	m.cond = sync.NewCond(&m.lk)
+	return m
+}
+
+func (m *Mock) Now() time.Time {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.now
+}
+
+func (m *Mock) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	return m.add(d, 0)
+}
+
+// NewTicker panics if d is not positive, like [time.NewTicker].
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for Mock.NewTicker")
+	}
+	return mockTicker{m.add(d, d)}
+}
+
+func (m *Mock) add(d, period time.Duration) *mockWaiter {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	w := &mockWaiter{
+		m:      m,
+		c:      make(chan time.Time, 1),
+		at:     m.now.Add(d),
+		period: period,
+	}
+	m.waiters = append(m.waiters, w)
+	m.cond.Broadcast()
+	return w
+}
+
+// Advance moves the clock forward by d, firing each timer and ticker which comes due on the way.
+func (m *Mock) Advance(d time.Duration) {
+	m.lk.Lock()
+	target := m.now.Add(d)
+	m.lk.Unlock()
+	m.Set(target)
+}
+
+// Set moves the clock to t, firing each timer and ticker which comes due on the way. The clock never moves backwards; earlier times are ignored.
+func (m *Mock) Set(t time.Time) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for {
+		var next *mockWaiter
+		for _, w := range m.waiters {
+			if !w.at.After(t) && (next == nil || w.at.Before(next.at)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.at.After(m.now) {
+			m.now = next.at
+		}
+		select {
+		case next.c <- m.now:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			m.remove(next)
+		}
+	}
+	if t.After(m.now) {
+		m.now = t
+	}
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, so a test can be sure the goroutine under test is waiting on the clock before advancing it.
+func (m *Mock) BlockUntil(n int) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for len(m.waiters) < n {
+		m.cond.Wait()
+	}
+}
+
+// must be called while holding m.lk; returns false if w wasn't pending
+func (m *Mock) remove(w *mockWaiter) bool {
+	for i, o := range m.waiters {
+		if o == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type mockWaiter struct {
+	m      *Mock
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+}
+
+func (w *mockWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *mockWaiter) Stop() bool {
+	w.m.lk.Lock()
+	defer w.m.lk.Unlock()
+	return w.m.remove(w)
+}
+
+type mockTicker struct {
+	*mockWaiter
+}
+
+func (t mockTicker) Stop() {
+	t.mockWaiter.Stop()
+}
+
+func (w *mockWaiter) Reset(d time.Duration) bool {
+	w.m.lk.Lock()
+	defer w.m.lk.Unlock()
+	active := w.m.remove(w)
+	w.at = w.m.now.Add(d)
+	w.m.waiters = append(w.m.waiters, w)
+	w.m.cond.Broadcast()
+	return active
+}
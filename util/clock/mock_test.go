@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockTimers(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMock(start)
+
+	timer := m.NewTimer(time.Minute)
+	ticker := m.NewTicker(20 * time.Second)
+	m.BlockUntil(2)
+
+	m.Advance(30 * time.Second)
+	assert.Equal(start.Add(30*time.Second), m.Now())
+	assert.Equal(start.Add(20*time.Second), <-ticker.C())
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	// undelivered ticks are dropped, as with time.Ticker
+	m.Advance(40 * time.Second)
+	assert.Equal(start.Add(40*time.Second), <-ticker.C())
+	assert.Equal(start.Add(time.Minute), <-timer.C())
+	assert.False(timer.Stop())
+
+	assert.False(timer.Reset(time.Second))
+	assert.True(timer.Stop())
+	m.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	ticker.Stop()
+	m.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+
+	// the clock doesn't go backwards
+	m.Set(start)
+	assert.Equal(start.Add(71*time.Second+time.Hour), m.Now())
+	assert.Equal(time.Hour, m.Since(start.Add(71*time.Second)))
+}
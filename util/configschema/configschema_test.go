@@ -0,0 +1,134 @@
+package configschema
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testInner struct {
+	Labels []string `json:"labels"`
+	Age    int      `json:"adultAge"`
+}
+
+type testConfig struct {
+	SSL          bool
+	PLCAuditHost string
+	Interval     time.Duration
+	Workers      int     `config:"min=0"`
+	SampleRate   float64 `config:"min=0,max=1"`
+	Mode         string  `config:"enum=buffered|group|sync"`
+	Crawlers     []*url.URL
+	Limits       map[string]int64
+	Policy       *testInner
+	Secret       []byte
+	Resolver     func(string) string
+	Hidden       string `config:"-"`
+	unexported   int
+}
+
+func TestSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	s := For(testConfig{SSL: true, Interval: time.Minute}, "test")
+	assert.Equal(Dialect, s.Dialect)
+	assert.Contains(s.Properties, "ssl")
+	assert.Contains(s.Properties, "plcAuditHost")
+	assert.NotContains(s.Properties, "resolver")
+	assert.NotContains(s.Properties, "hidden")
+	assert.NotContains(s.Properties, "unexported")
+	assert.Equal(true, s.Properties["ssl"].Default)
+	assert.Equal("1m0s", s.Properties["interval"].Default)
+	assert.Equal(Types{"object", "null"}, s.Properties["policy"].Type)
+	assert.Contains(s.Properties["policy"].Properties, "adultAge")
+
+	// schemas are themselves JSON
+	_, err := json.Marshal(s)
+	assert.NoError(err)
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := testConfig{SSL: true, Workers: 4, Interval: time.Minute}
+	err := Load([]byte(`{
+		"plcAuditHost": "https://plc.example.ca",
+		"interval": "90s",
+		"crawlers": ["https://relay.example.ca"],
+		"limits": {"video/*": 1000},
+		"policy": {"labels": ["minor"], "adultAge": 18},
+		"secret": "hunter2"
+	}`), &cfg)
+	assert.NoError(err)
+	// defaults survive
+	assert.True(cfg.SSL)
+	assert.Equal(4, cfg.Workers)
+	assert.Equal("https://plc.example.ca", cfg.PLCAuditHost)
+	assert.Equal(90*time.Second, cfg.Interval)
+	assert.Equal("relay.example.ca", cfg.Crawlers[0].Host)
+	assert.Equal(int64(1000), cfg.Limits["video/*"])
+	assert.Equal(18, cfg.Policy.Age)
+	assert.Equal([]byte("hunter2"), cfg.Secret)
+
+	// every problem is reported, with its path
+	err = Load([]byte(`{
+		"ssl": "yes",
+		"interval": "soon",
+		"workers": -1,
+		"sampleRate": 2,
+		"mode": "async",
+		"policy": {"adultAge": 1.5, "label": []},
+		"plc-audit-host": ""
+	}`), &cfg)
+	var errs Errors
+	assert.True(errors.As(err, &errs))
+	paths := map[string]string{}
+	for _, e := range errs {
+		paths[e.Path] = e.Message
+	}
+	assert.Len(paths, 8)
+	assert.Contains(paths, "/ssl")
+	assert.Contains(paths["/interval"], "invalid duration")
+	assert.Contains(paths, "/workers")
+	assert.Contains(paths, "/sampleRate")
+	assert.Contains(paths, "/mode")
+	assert.Contains(paths, "/policy/adultAge")
+	assert.Contains(paths, "/policy/label")
+	assert.Contains(paths["/plc-audit-host"], `did you mean "plcAuditHost"?`)
+
+	err = Load([]byte(`{"ssl": true} {}`), &cfg)
+	assert.Error(err)
+}
+
+func TestLoadSection(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"relay": {"workers": 2}, "resolver": {"workers": -1}}`)
+	cfg := testConfig{Workers: 4}
+	assert.NoError(LoadSection(doc, "relay", &cfg))
+	assert.Equal(2, cfg.Workers)
+	assert.NoError(LoadSection(doc, "missing", &cfg))
+
+	err := LoadSection(doc, "resolver", &cfg)
+	var errs Errors
+	assert.True(errors.As(err, &errs))
+	assert.Equal("/resolver/workers", errs[0].Path)
+}
+
+func TestLowerCamel(t *testing.T) {
+	assert := assert.New(t)
+
+	for in, out := range map[string]string{
+		"SSL":              "ssl",
+		"PLCAuditHost":     "plcAuditHost",
+		"DefaultRepoLimit": "defaultRepoLimit",
+		"URL":              "url",
+		"ResumeKey":        "resumeKey",
+	} {
+		assert.Equal(out, lowerCamel(in))
+	}
+}
@@ -0,0 +1,4 @@
+// JSON Schema generation, validation and loading for configuration structs.
+//
+// Schemas are derived from the structs themselves by reflection: property names come from `json` tags (or the field name in lower camel case), and constraints from `config` tags, eg `config:"min=1"`, `config:"max=1"`, `config:"enum=buffered|group|sync"`, `config:"required"`, or `config:"-"` to leave a field out. Durations are strings in Go syntax ("90s", "24h"). Fields of interface, func and channel types are left out, unless their type has been registered with a Codec. Load validates a JSON document against the schema, reporting every problem with its JSON Pointer path, then decodes it over an existing (default) value, so fields the document doesn't mention keep their defaults.
+package configschema
@@ -0,0 +1,139 @@
+package configschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Load validates a JSON document against the schema of v, which must be a pointer, then decodes the document into v. Fields absent from the document are left as they are, so v should be initialized with defaults.
+func Load(doc []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("configschema: Load requires a non-nil pointer")
+	}
+	if err := For(rv.Elem().Interface(), "").Validate(doc); err != nil {
+		return err
+	}
+	parsed, err := parseDocument(doc)
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), parsed, "")
+}
+
+func assign(rv reflect.Value, v any, path string) error {
+	fail := func(err error) error {
+		return Errors{{Path: pointer(path), Message: err.Error()}}
+	}
+	t := rv.Type()
+	if c, ok := codecFor(t); ok {
+		if v == nil {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		out, err := c.Decode(v)
+		if err != nil {
+			return fail(err)
+		}
+		rv.Set(reflect.ValueOf(out).Convert(t))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v == nil {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(t.Elem()))
+		}
+		return assign(rv.Elem(), v, path)
+	case reflect.Struct:
+		m := v.(map[string]any)
+		for _, f := range fields(t) {
+			fv, ok := m[f.name]
+			if !ok {
+				continue
+			}
+			if err := assign(rv.FieldByIndex(f.index), fv, path+"/"+escapeToken(f.name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m := v.(map[string]any)
+		out := reflect.MakeMapWithSize(t, len(m))
+		for k, ev := range m {
+			e := reflect.New(t.Elem()).Elem()
+			if err := assign(e, ev, path+"/"+escapeToken(k)); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), e)
+		}
+		rv.Set(out)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes([]byte(v.(string)))
+			return nil
+		}
+		items := v.([]any)
+		out := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := assign(out.Index(i), item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(out)
+	case reflect.String:
+		rv.SetString(v.(string))
+	case reflect.Bool:
+		rv.SetBool(v.(bool))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := v.(json.Number).Int64()
+		if err != nil || rv.OverflowInt(n) {
+			return fail(fmt.Errorf("integer out of range: %s", v))
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := v.(json.Number).Int64()
+		if err != nil || n < 0 || rv.OverflowUint(uint64(n)) {
+			return fail(fmt.Errorf("integer out of range: %s", v))
+		}
+		rv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, err := v.(json.Number).Float64()
+		if err != nil {
+			return fail(err)
+		}
+		rv.SetFloat(n)
+	default:
+		return fail(fmt.Errorf("unsupported configuration type %s", t))
+	}
+	return nil
+}
+
+// LoadSection loads the named top-level property of a JSON document into v, as Load does, if the document has it. This allows a single file to configure components which are set up at different times; validate the whole document first so unknown sections are reported.
+func LoadSection(doc []byte, name string, v any) error {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &sections); err != nil {
+		return Errors{{Path: "/", Message: fmt.Sprintf("invalid JSON: %s", err)}}
+	}
+	section, ok := sections[name]
+	if !ok {
+		return nil
+	}
+	err := Load(section, v)
+	var errs Errors
+	if errors.As(err, &errs) {
+		prefixed := make(Errors, 0, len(errs))
+		for _, e := range errs {
+			e.Path = strings.TrimSuffix("/"+escapeToken(name)+e.Path, "/")
+			prefixed = append(prefixed, e)
+		}
+		return prefixed
+	}
+	return err
+}
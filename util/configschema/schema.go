@@ -0,0 +1,276 @@
+package configschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// JSON Schema dialect of generated schemas
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema used to describe configuration.
+type Schema struct {
+	Dialect     string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// JSON types the value may have; a single type is encoded as a string
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Default              any                `json:"default,omitempty"`
+}
+
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = Types{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func (t Types) has(typ string) bool {
+	for _, x := range t {
+		if x == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Codec describes how a Go type which doesn't map directly onto JSON is configured, eg a key parsed from a string.
+type Codec struct {
+	Schema Schema
+	// converts a value which has passed Schema into the Go type
+	Decode func(v any) (any, error)
+	// converts the Go value into its JSON form, for defaults; nil omits defaults
+	Encode func(v any) any
+}
+
+var (
+	codecsLk sync.RWMutex
+	codecs   = map[reflect.Type]Codec{
+		reflect.TypeOf(time.Duration(0)): {
+			Schema: Schema{Type: Types{"string"}, Format: "duration", Pattern: `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`},
+			Decode: func(v any) (any, error) {
+				return time.ParseDuration(v.(string))
+			},
+			Encode: func(v any) any {
+				return v.(time.Duration).String()
+			},
+		},
+		reflect.TypeOf(&url.URL{}): {
+			Schema: Schema{Type: Types{"string"}, Format: "uri"},
+			Decode: func(v any) (any, error) {
+				return url.Parse(v.(string))
+			},
+			Encode: func(v any) any {
+				return v.(*url.URL).String()
+			},
+		},
+	}
+)
+
+// Register sets how values of the given type are configured.
+func Register(t reflect.Type, c Codec) {
+	codecsLk.Lock()
+	defer codecsLk.Unlock()
+	codecs[t] = c
+}
+
+func codecFor(t reflect.Type) (Codec, bool) {
+	codecsLk.RLock()
+	defer codecsLk.RUnlock()
+	c, ok := codecs[t]
+	return c, ok
+}
+
+// field is a configurable struct field
+type field struct {
+	name     string
+	index    []int
+	required bool
+	min, max *float64
+	enum     []any
+}
+
+// fields returns the configurable fields of a struct type, flattening embedded structs as encoding/json does
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if sf.Tag.Get("config") == "-" || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("json") == "" {
+			for _, f := range fields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				out = append(out, f)
+			}
+			continue
+		}
+		if !configurable(sf.Type) {
+			continue
+		}
+		f := field{name: fieldName(sf), index: []int{i}}
+		for _, opt := range strings.Split(sf.Tag.Get("config"), ",") {
+			k, v, _ := strings.Cut(opt, "=")
+			switch k {
+			case "required":
+				f.required = true
+			case "min":
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					panic(fmt.Sprintf("configschema: invalid min on %s.%s: %q", t.Name(), sf.Name, v))
+				}
+				f.min = &n
+			case "max":
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					panic(fmt.Sprintf("configschema: invalid max on %s.%s: %q", t.Name(), sf.Name, v))
+				}
+				f.max = &n
+			case "enum":
+				for _, e := range strings.Split(v, "|") {
+					f.enum = append(f.enum, e)
+				}
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func fieldName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return lowerCamel(sf.Name)
+}
+
+// lowerCamel lowercases a leading initialism or word: "SSL" → "ssl", "PLCAuditHost" → "plcAuditHost"
+func lowerCamel(s string) string {
+	r := []rune(s)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// configurable reports whether values of the type can be described in JSON
+func configurable(t reflect.Type) bool {
+	if _, ok := codecFor(t); ok {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return configurable(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && configurable(t.Elem())
+	}
+	return true
+}
+
+// For returns the schema of a configuration value. Non-zero values in v are recorded as defaults.
+func For(v any, title string) *Schema {
+	s := schemaFor(reflect.TypeOf(v), reflect.ValueOf(v))
+	s.Dialect = Dialect
+	s.Title = title
+	return s
+}
+
+func schemaFor(t reflect.Type, v reflect.Value) *Schema {
+	if c, ok := codecFor(t); ok {
+		s := c.Schema
+		if c.Encode != nil && v.IsValid() && !v.IsZero() {
+			s.Default = c.Encode(v.Interface())
+		}
+		return &s
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		var elem reflect.Value
+		if v.IsValid() && !v.IsNil() {
+			elem = v.Elem()
+		}
+		s := schemaFor(t.Elem(), elem)
+		s.Type = append(s.Type, "null")
+		return s
+	case reflect.Struct:
+		s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}, AdditionalProperties: false}
+		for _, f := range fields(t) {
+			var fv reflect.Value
+			if v.IsValid() {
+				fv = v.FieldByIndex(f.index)
+			}
+			fs := schemaFor(t.FieldByIndex(f.index).Type, fv)
+			fs.Minimum, fs.Maximum = f.min, f.max
+			if f.enum != nil {
+				fs.Enum = f.enum
+			}
+			if f.required {
+				s.Required = append(s.Required, f.name)
+			}
+			s.Properties[f.name] = fs
+		}
+		return s
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}, AdditionalProperties: schemaFor(t.Elem(), reflect.Value{}), Default: defaultOf(v)}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}}
+		}
+		return &Schema{Type: Types{"array"}, Items: schemaFor(t.Elem(), reflect.Value{}), Default: defaultOf(v)}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}, Default: defaultOf(v)}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}, Default: defaultOf(v)}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: Types{"integer"}, Default: defaultOf(v)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &Schema{Type: Types{"integer"}, Minimum: &zero, Default: defaultOf(v)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}, Default: defaultOf(v)}
+	}
+	return &Schema{}
+}
+
+// defaultOf returns a non-zero plain value, for the schema's default
+func defaultOf(v reflect.Value) any {
+	if !v.IsValid() || v.IsZero() {
+		return nil
+	}
+	return v.Interface()
+}
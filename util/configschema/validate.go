@@ -0,0 +1,197 @@
+package configschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Error is a problem with a configuration value, at a JSON Pointer path.
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Errors is every problem found in a configuration document.
+type Errors []Error
+
+func (es Errors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return "invalid configuration:\n  " + strings.Join(msgs, "\n  ")
+}
+
+var patterns sync.Map
+
+func compiled(p string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(p); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(p, re)
+	return re, nil
+}
+
+// parseDocument decodes JSON keeping numbers exact
+func parseDocument(doc []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the configuration document")
+	}
+	return v, nil
+}
+
+// Validate checks a JSON document against the schema, returning every problem found (as Errors), or nil.
+func (s *Schema) Validate(doc []byte) error {
+	v, err := parseDocument(doc)
+	if err != nil {
+		return Errors{{Path: "/", Message: fmt.Sprintf("invalid JSON: %s", err)}}
+	}
+	if errs := s.validate(v, ""); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func escapeToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func (s *Schema) validate(v any, path string) Errors {
+	fail := func(format string, args ...any) Errors {
+		return Errors{{Path: pointer(path), Message: fmt.Sprintf(format, args...)}}
+	}
+	typ := jsonType(v)
+	if len(s.Type) > 0 && !s.Type.has(typ) && !(typ == "integer" && s.Type.has("number")) {
+		return fail("expected %s, got %s", strings.Join(s.Type, " or "), typ)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(v)
+		}
+		if !found {
+			return fail("must be one of %v, got %v", s.Enum, v)
+		}
+	}
+
+	var errs Errors
+	switch v := v.(type) {
+	case string:
+		if s.Pattern != "" {
+			re, err := compiled(s.Pattern)
+			if err == nil && !re.MatchString(v) {
+				switch s.Format {
+				case "duration":
+					return fail("invalid duration %q (expected eg \"90s\", \"15m\" or \"24h\")", v)
+				default:
+					return fail("%q doesn't match %s", v, s.Pattern)
+				}
+			}
+		}
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return fail("invalid number: %s", v)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fail("must be at least %v, got %s", *s.Minimum, v)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fail("must be at most %v, got %s", *s.Maximum, v)
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + escapeToken(k)
+			if ps, ok := s.Properties[k]; ok {
+				errs = append(errs, ps.validate(v[k], p)...)
+				continue
+			}
+			switch ap := s.AdditionalProperties.(type) {
+			case *Schema:
+				errs = append(errs, ap.validate(v[k], p)...)
+			case bool:
+				if !ap {
+					errs = append(errs, Error{Path: p, Message: "unknown field" + suggestion(k, s.Properties)})
+				}
+			}
+		}
+		for _, r := range s.Required {
+			if _, ok := v[r]; !ok {
+				errs = append(errs, Error{Path: path + "/" + escapeToken(r), Message: "required field is missing"})
+			}
+		}
+	}
+	return errs
+}
+
+// suggestion names a known property differing from an unknown one only in case or separators, which is the usual mistake
+func suggestion(k string, props map[string]*Schema) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	}
+	for p := range props {
+		if norm(p) == norm(k) {
+			return fmt.Sprintf(" (did you mean %q?)", p)
+		}
+	}
+	return ""
+}
@@ -15,6 +15,10 @@ type LeveledSlog struct {
 	inner *slog.Logger
 }
 
+func NewLeveledSlog(inner *slog.Logger) LeveledSlog {
+	return LeveledSlog{inner: inner}
+}
+
 // re-writes HTTP client ERROR to WARN level (because of retries)
 func (l LeveledSlog) Error(msg string, keysAndValues ...interface{}) {
 	l.inner.Warn(msg, keysAndValues...)
@@ -0,0 +1,529 @@
+// Package httpprofile builds the HTTP clients a service makes outbound requests with, from a few named profiles, so that timeouts, TLS settings, proxying and the User-Agent are set in one place rather than by each caller.
+//
+// Interactive is for requests a user or operator is waiting on (request handlers, webhooks, lookups on the filter path): short timeouts and no retries. Crawler is for background requests to other services, such as listing a PDS's repos: longer timeouts, with retries. Bulk is for large transfers, such as fetching whole repos: long overall timeouts, with retries.
+//
+// DNS resolution gets its own timeout, within the request's context, so a slow resolver fails a request before its dial timeout is spent.
+//
+// Requests can go through an HTTP(S) or SOCKS5 proxy, for networks whose only way out is an egress gateway: each profile has a default proxy, and proxy rules routing some destinations (by host name, domain or address range) through proxies of their own, or directly. SetProxy applies a proxy and rules to all the profiles at once.
+package httpprofile
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Profile names.
+const (
+	Interactive = "interactive"
+	Crawler     = "crawler"
+	Bulk        = "bulk"
+)
+
+// ProxyNone, as a profile's Proxy, connects directly, whatever the environment says.
+const ProxyNone = "none"
+
+// Duration is a time.Duration written in JSON as a Go duration string (eg, "30s").
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Profile configures the HTTP clients built from it. Zero timeouts don't limit.
+type Profile struct {
+	// limit on a whole request, including retries and reading the response body
+	Timeout Duration `json:"timeout"`
+	// limit on resolving a host name
+	DNSTimeout Duration `json:"dnsTimeout"`
+	// limit on connecting to an address
+	DialTimeout           Duration `json:"dialTimeout"`
+	TLSHandshakeTimeout   Duration `json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout Duration `json:"responseHeaderTimeout"`
+	// how long an idle connection is kept for reuse
+	IdleConnTimeout     Duration `json:"idleConnTimeout"`
+	MaxIdleConnsPerHost int      `json:"maxIdleConnsPerHost"`
+
+	// lowest TLS version accepted, "1.2" or "1.3"; empty accepts 1.2
+	MinTLSVersion string `json:"minTLSVersion,omitempty"`
+	// PEM file of CA certificates trusted besides the system's
+	CAFile string `json:"caFile,omitempty"`
+	// don't verify servers' certificates; for testing only
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// URL of the proxy requests go through (http, https, socks5 or socks5h); empty uses the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY), ProxyNone connects directly
+	Proxy string `json:"proxy,omitempty"`
+	// proxies for particular destinations, taking precedence over Proxy; the first rule matching a request's host applies
+	ProxyRules []ProxyRule `json:"proxyRules,omitempty"`
+	// sent with requests which don't set their own; empty leaves it to the caller
+	UserAgent string `json:"userAgent,omitempty"`
+	// times a request failing with a connection error or 5xx status is retried (429s aren't, so callers can back off themselves); 0 doesn't retry
+	Retries int `json:"retries"`
+}
+
+// ProxyRule routes requests to some destinations through a proxy.
+type ProxyRule struct {
+	// host names ("pds.example.com"), domains with their subdomains ("*.example.com"), IP addresses or CIDR ranges ("10.0.0.0/8") the rule applies to; "*" matches every host
+	Hosts []string `json:"hosts"`
+	// URL of the proxy, as for Profile.Proxy; ProxyNone connects directly
+	Proxy string `json:"proxy"`
+}
+
+// matches reports whether the rule applies to a host name or address, without its port
+func (r *ProxyRule) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	addr, addrErr := netip.ParseAddr(host)
+	for _, h := range r.Hosts {
+		h = strings.ToLower(h)
+		switch {
+		case h == "*":
+			return true
+		case strings.HasPrefix(h, "*."):
+			if host == h[2:] || strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+		case strings.Contains(h, "/"):
+			if prefix, err := netip.ParsePrefix(h); err == nil && addrErr == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		case h == host:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ProxyRule) validate() error {
+	if len(r.Hosts) == 0 {
+		return errors.New("proxy rule has no hosts")
+	}
+	for _, h := range r.Hosts {
+		if h == "" || h == "*." || (strings.Contains(h, "/") && !validPrefix(h)) {
+			return fmt.Errorf("invalid proxy rule host: %q", h)
+		}
+	}
+	if r.Proxy == "" {
+		return errors.New("proxy rule has no proxy")
+	}
+	_, err := parseProxy(r.Proxy)
+	return err
+}
+
+func validPrefix(s string) bool {
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+// LoadProxyRules reads a JSON file of proxy rules, a list of objects with "hosts" and "proxy".
+func LoadProxyRules(fname string) ([]ProxyRule, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ProxyRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("parsing proxy rules: %w", err)
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("proxy rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// Profiles are profiles by name.
+type Profiles map[string]*Profile
+
+// Defaults returns the default profiles.
+func Defaults() Profiles {
+	return Profiles{
+		Interactive: {
+			Timeout:               Duration(10 * time.Second),
+			DNSTimeout:            Duration(3 * time.Second),
+			DialTimeout:           Duration(5 * time.Second),
+			TLSHandshakeTimeout:   Duration(5 * time.Second),
+			ResponseHeaderTimeout: Duration(10 * time.Second),
+			IdleConnTimeout:       Duration(90 * time.Second),
+			MaxIdleConnsPerHost:   10,
+		},
+		Crawler: {
+			Timeout:               Duration(time.Minute),
+			DNSTimeout:            Duration(5 * time.Second),
+			DialTimeout:           Duration(10 * time.Second),
+			TLSHandshakeTimeout:   Duration(10 * time.Second),
+			ResponseHeaderTimeout: Duration(30 * time.Second),
+			IdleConnTimeout:       Duration(90 * time.Second),
+			MaxIdleConnsPerHost:   4,
+			Retries:               3,
+		},
+		Bulk: {
+			Timeout:               Duration(30 * time.Minute),
+			DNSTimeout:            Duration(5 * time.Second),
+			DialTimeout:           Duration(10 * time.Second),
+			TLSHandshakeTimeout:   Duration(10 * time.Second),
+			ResponseHeaderTimeout: Duration(time.Minute),
+			IdleConnTimeout:       Duration(90 * time.Second),
+			MaxIdleConnsPerHost:   4,
+			Retries:               3,
+		},
+	}
+}
+
+// Load reads profiles from a JSON file, an object of profiles by name. Fields missing from the file keep their Defaults values.
+func Load(fname string) (Profiles, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing HTTP client profiles: %w", err)
+	}
+	ps := Defaults()
+	for name, msg := range raw {
+		p, ok := ps[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown HTTP client profile: %q (must be %s, %s or %s)", name, Interactive, Crawler, Bulk)
+		}
+		if err := json.Unmarshal(msg, p); err != nil {
+			return nil, fmt.Errorf("parsing HTTP client profile %s: %w", name, err)
+		}
+	}
+	if err := ps.Validate(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// SetProxy applies a proxy and proxy rules to every profile: the proxy to those which don't set their own, and the rules after each profile's own.
+func (ps Profiles) SetProxy(proxy string, rules []ProxyRule) {
+	for _, p := range ps {
+		if p.Proxy == "" {
+			p.Proxy = proxy
+		}
+		p.ProxyRules = append(p.ProxyRules[:len(p.ProxyRules):len(p.ProxyRules)], rules...)
+	}
+}
+
+// Validate checks each profile.
+func (ps Profiles) Validate() error {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := ps[name].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("HTTP client profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the profile's settings.
+func (p *Profile) Validate() error {
+	if p.Retries < 0 || p.MaxIdleConnsPerHost < 0 {
+		return errors.New("retries and idle connections can't be negative")
+	}
+	for _, d := range []Duration{p.Timeout, p.DNSTimeout, p.DialTimeout, p.TLSHandshakeTimeout, p.ResponseHeaderTimeout, p.IdleConnTimeout} {
+		if d < 0 {
+			return errors.New("timeouts can't be negative")
+		}
+	}
+	if _, err := p.minTLSVersion(); err != nil {
+		return err
+	}
+	if _, err := p.proxy(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Profile) minTLSVersion() (uint16, error) {
+	switch p.MinTLSVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid minimum TLS version: %q (must be 1.2 or 1.3)", p.MinTLSVersion)
+	}
+}
+
+// proxy returns the function choosing the proxy for a request, following the rules, then Proxy
+func (p *Profile) proxy() (func(*http.Request) (*url.URL, error), error) {
+	def, err := parseProxy(p.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.ProxyRules) == 0 {
+		return def, nil
+	}
+	type route struct {
+		rule  *ProxyRule
+		proxy func(*http.Request) (*url.URL, error)
+	}
+	routes := make([]route, len(p.ProxyRules))
+	for i := range p.ProxyRules {
+		r := &p.ProxyRules[i]
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("proxy rule %d: %w", i+1, err)
+		}
+		routes[i].rule = r
+		routes[i].proxy, _ = parseProxy(r.Proxy)
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		for _, rt := range routes {
+			if rt.rule.matches(req.URL.Hostname()) {
+				if rt.proxy == nil {
+					return nil, nil
+				}
+				return rt.proxy(req)
+			}
+		}
+		if def == nil {
+			return nil, nil
+		}
+		return def(req)
+	}, nil
+}
+
+// parseProxy parses a proxy setting: nil for ProxyNone
+func parseProxy(s string) (func(*http.Request) (*url.URL, error), error) {
+	switch s {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyNone:
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL: %q", s)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL: %q (must be http, https, socks5 or socks5h)", s)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// NewClient builds a client with the profile's settings. Each client has its own connection pool; Clients shares one per profile.
+func (p *Profile) NewClient() (*http.Client, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify}
+	tlsConf.MinVersion, _ = p.minTLSVersion()
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", p.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	proxy, _ := p.proxy()
+
+	d := &dialer{
+		Dialer:     net.Dialer{Timeout: time.Duration(p.DialTimeout), KeepAlive: 30 * time.Second},
+		dnsTimeout: time.Duration(p.DNSTimeout),
+	}
+	var rt http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           d.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   p.MaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(p.IdleConnTimeout),
+		TLSHandshakeTimeout:   time.Duration(p.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(p.ResponseHeaderTimeout),
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       tlsConf,
+	}
+	rt = otelhttp.NewTransport(rt)
+	if p.UserAgent != "" {
+		rt = &userAgentTransport{next: rt, userAgent: p.UserAgent}
+	}
+
+	if p.Retries == 0 {
+		return &http.Client{Transport: rt, Timeout: time.Duration(p.Timeout)}, nil
+	}
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient.Transport = rt
+	retryClient.RetryMax = p.Retries
+	retryClient.RetryWaitMin = 1 * time.Second
+	retryClient.RetryWaitMax = 10 * time.Second
+	retryClient.Logger = retryablehttp.LeveledLogger(util.NewLeveledSlog(slog.Default().With("subsystem", "httpprofile")))
+	retryClient.CheckRetry = util.XRPCRetryPolicy
+	client := retryClient.StandardClient()
+	client.Timeout = time.Duration(p.Timeout)
+	return client, nil
+}
+
+// dialer resolves host names within the DNS timeout, then connects to each address in turn until one answers
+type dialer struct {
+	net.Dialer
+	dnsTimeout time.Duration
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || d.dnsTimeout <= 0 || net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, addr)
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, d.dnsTimeout)
+	ips, err := net.DefaultResolver.LookupNetIP(lookupCtx, lookupNetwork(network), host)
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil && lookupCtx.Err() != nil {
+			return nil, fmt.Errorf("resolving %s: timed out after %s", host, d.dnsTimeout)
+		}
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		conn, err := d.Dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("resolving %s: no addresses", host)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// userAgentTransport sets the User-Agent of requests which don't set their own
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// Clients holds one client per profile, so requests made under a profile share its connection pool. It is safe for concurrent use.
+type Clients struct {
+	profiles Profiles
+	clients  map[string]*http.Client
+}
+
+// NewClients builds a client for each profile.
+func NewClients(ps Profiles) (*Clients, error) {
+	cs := &Clients{profiles: ps, clients: make(map[string]*http.Client, len(ps))}
+	for name, p := range ps {
+		c, err := p.NewClient()
+		if err != nil {
+			return nil, fmt.Errorf("HTTP client profile %s: %w", name, err)
+		}
+		cs.clients[name] = c
+	}
+	return cs, nil
+}
+
+// DefaultClients returns clients for the default profiles.
+func DefaultClients() *Clients {
+	cs, err := NewClients(Defaults())
+	if err != nil {
+		// the defaults are valid
+		panic(err)
+	}
+	return cs
+}
+
+// Get returns the client for a profile. An unknown name gets the Interactive profile's client, or, failing that, http.DefaultClient.
+func (cs *Clients) Get(name string) *http.Client {
+	if c, ok := cs.clients[name]; ok {
+		return c
+	}
+	if c, ok := cs.clients[Interactive]; ok {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// Proxy returns the function choosing a profile's proxy for a request, as the profile's clients do, for connections made other than with its clients, such as websockets; nil connects directly.
+func (cs *Clients) Proxy(name string) func(*http.Request) (*url.URL, error) {
+	p, ok := cs.profiles[name]
+	if !ok {
+		p, ok = cs.profiles[Interactive]
+	}
+	if !ok {
+		return http.ProxyFromEnvironment
+	}
+	proxy, _ := p.proxy()
+	return proxy
+}
+
+// UserAgent returns the User-Agent of a profile, empty if it doesn't set one.
+func (cs *Clients) UserAgent(name string) string {
+	if p, ok := cs.profiles[name]; ok {
+		return p.UserAgent
+	}
+	return ""
+}
+
+// ApplyXRPC has an XRPC client make its requests with a profile's client and User-Agent (which XRPC clients otherwise set themselves).
+func (cs *Clients) ApplyXRPC(name string, c *xrpc.Client) {
+	c.Client = cs.Get(name)
+	if ua := cs.UserAgent(name); ua != "" {
+		c.UserAgent = &ua
+	}
+}
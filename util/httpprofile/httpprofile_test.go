@@ -0,0 +1,181 @@
+package httpprofile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	fname := filepath.Join(t.TempDir(), "profiles.json")
+	write := func(s string) {
+		if err := os.WriteFile(fname, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"crawler": {"timeout": "2m", "userAgent": "relay.example.com", "proxy": "http://proxy.internal:3128"}}`)
+	ps, err := Load(fname)
+	assert.NoError(err)
+	assert.Equal(Duration(2*time.Minute), ps[Crawler].Timeout)
+	assert.Equal("relay.example.com", ps[Crawler].UserAgent)
+	// the rest are defaults
+	assert.Equal(3, ps[Crawler].Retries)
+	assert.Equal(Defaults()[Bulk], ps[Bulk])
+
+	write(`{"batch": {}}`)
+	_, err = Load(fname)
+	assert.ErrorContains(err, "unknown HTTP client profile")
+	write(`{"bulk": {"minTLSVersion": "1.0"}}`)
+	_, err = Load(fname)
+	assert.ErrorContains(err, "invalid minimum TLS version")
+	write(`{"bulk": {"dnsTimeout": "soon"}}`)
+	_, err = Load(fname)
+	assert.Error(err)
+}
+
+func TestClients(t *testing.T) {
+	assert := assert.New(t)
+	var hits atomic.Int32
+	var ua atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua.Store(r.Header.Get("User-Agent"))
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ps := Defaults()
+	ps[Crawler].UserAgent = "relay.example.com"
+	cs, err := NewClients(ps)
+	assert.NoError(err)
+
+	// retried
+	resp, err := cs.Get(Crawler).Get(srv.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(int32(2), hits.Load())
+	assert.Equal("relay.example.com", ua.Load())
+
+	// not retried
+	hits.Store(0)
+	resp, err = cs.Get(Interactive).Get(srv.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(int32(1), hits.Load())
+
+	// a request's own User-Agent is kept
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("User-Agent", "mine")
+	resp, err = cs.Get(Crawler).Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("mine", ua.Load())
+
+	// XRPC clients take the profile's User-Agent over their own
+	xc := &xrpc.Client{Host: srv.URL}
+	cs.ApplyXRPC(Crawler, xc)
+	assert.Same(cs.Get(Crawler), xc.Client)
+	assert.Equal("relay.example.com", *xc.UserAgent)
+
+	assert.Same(cs.Get(Interactive), cs.Get("unknown"))
+}
+
+func TestProxy(t *testing.T) {
+	assert := assert.New(t)
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxied request names the whole URL
+		proxied.Store(r.URL.String())
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	p := *Defaults()[Interactive]
+	p.Proxy = proxy.URL
+	c, err := p.NewClient()
+	assert.NoError(err)
+	resp, err := c.Get("http://pds.example.com/xrpc/_health")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("http://pds.example.com/xrpc/_health", proxied.Load())
+
+	p.Proxy = "::"
+	_, err = p.NewClient()
+	assert.ErrorContains(err, "invalid proxy URL")
+	p.Proxy = "ftp://proxy.internal"
+	_, err = p.NewClient()
+	assert.ErrorContains(err, "invalid proxy URL")
+}
+
+func TestProxyRules(t *testing.T) {
+	assert := assert.New(t)
+	ps := Defaults()
+	ps[Crawler].ProxyRules = []ProxyRule{{Hosts: []string{"plc.directory"}, Proxy: ProxyNone}}
+	ps.SetProxy("http://gateway.internal:3128", []ProxyRule{
+		{Hosts: []string{"*.gc.ca", "10.0.0.0/8"}, Proxy: ProxyNone},
+		{Hosts: []string{"*.example.com", "plc.directory"}, Proxy: "socks5://socks.internal:1080"},
+	})
+	assert.NoError(ps.Validate())
+	cs, err := NewClients(ps)
+	assert.NoError(err)
+
+	proxyFor := func(profile, target string) string {
+		req, _ := http.NewRequest("GET", target, nil)
+		u, err := cs.Proxy(profile)(req)
+		assert.NoError(err)
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+	assert.Equal("http://gateway.internal:3128", proxyFor(Interactive, "https://pds.example.net/xrpc/_health"))
+	assert.Equal("", proxyFor(Interactive, "https://canada.gc.ca/"))
+	assert.Equal("", proxyFor(Interactive, "https://gc.ca/"))
+	assert.Equal("", proxyFor(Interactive, "http://10.1.2.3:8080/"))
+	assert.Equal("socks5://socks.internal:1080", proxyFor(Interactive, "wss://pds.example.com/xrpc/com.atproto.sync.subscribeRepos"))
+	// a profile's own rules come first
+	assert.Equal("", proxyFor(Crawler, "https://plc.directory/did:plc:abc"))
+	assert.Equal("socks5://socks.internal:1080", proxyFor(Interactive, "https://plc.directory/did:plc:abc"))
+
+	// a profile's own proxy isn't replaced
+	ps = Defaults()
+	ps[Bulk].Proxy = ProxyNone
+	ps.SetProxy("http://gateway.internal:3128", nil)
+	assert.Equal(ProxyNone, ps[Bulk].Proxy)
+	assert.Equal("http://gateway.internal:3128", ps[Crawler].Proxy)
+
+	fname := filepath.Join(t.TempDir(), "rules.json")
+	write := func(s string) {
+		if err := os.WriteFile(fname, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"hosts": ["*.gc.ca"], "proxy": "none"}, {"hosts": ["*"], "proxy": "socks5h://socks.internal:1080"}]`)
+	rules, err := LoadProxyRules(fname)
+	assert.NoError(err)
+	assert.Len(rules, 2)
+	write(`[{"hosts": [], "proxy": "none"}]`)
+	_, err = LoadProxyRules(fname)
+	assert.ErrorContains(err, "no hosts")
+	write(`[{"hosts": ["10.0.0.0/33"], "proxy": "none"}]`)
+	_, err = LoadProxyRules(fname)
+	assert.ErrorContains(err, "invalid proxy rule host")
+	write(`[{"hosts": ["*.gc.ca"]}]`)
+	_, err = LoadProxyRules(fname)
+	assert.ErrorContains(err, "no proxy")
+}
@@ -0,0 +1,6 @@
+// Envelope encryption of data at rest.
+//
+// A Keyring holds named AES-256 key-encryption keys (KEKs), one of which is primary. Data is encrypted with AES-GCM under a random data key, and the data key is stored alongside it wrapped (encrypted) under the primary KEK, tagged with the KEK's name. Rotating means adding a new KEK and making it primary: new data is wrapped under it, existing data stays readable as long as the KEK it names is still in the keyring, and Rewrap (or Reseal) re-wraps existing data keys under the new primary without touching the data, after which the old KEK can be retired.
+//
+// Keyrings are loaded from a JSON file: {"primary": "2026-10", "keys": {"2026-10": "<base64>", "2026-04": "<base64>"}}, each key being 32 random bytes.
+package keymgmt
@@ -0,0 +1,112 @@
+package keymgmt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	kr, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt := []byte("some repo data")
+	sealed, err := kr.Seal(pt, []byte("sh-1"))
+	assert.NoError(err)
+	assert.True(IsSealed(sealed))
+	assert.False(bytes.Contains(sealed, pt))
+
+	out, err := kr.Open(sealed, []byte("sh-1"))
+	assert.NoError(err)
+	assert.Equal(pt, out)
+
+	// bound to its additional data
+	_, err = kr.Open(sealed, []byte("sh-2"))
+	assert.Error(err)
+
+	sealed[len(sealed)-1]++
+	_, err = kr.Open(sealed, []byte("sh-1"))
+	assert.Error(err)
+
+	for _, bad := range [][]byte{nil, []byte("plain"), sealMagic, sealed[:8]} {
+		_, err = kr.Open(bad, nil)
+		assert.ErrorIs(err, ErrMalformed)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	old, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	aead, wrapped, err := old.NewDataKey()
+	assert.NoError(err)
+	sealed, err := old.Seal([]byte("hello"), nil)
+	assert.NoError(err)
+
+	// the new primary can still read data wrapped under the old key
+	kr, _ := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	assert.Equal([]string{"k1", "k2"}, kr.Keys())
+	unwrapped, err := kr.UnwrapDataKey(wrapped)
+	assert.NoError(err)
+	nonce := make([]byte, aead.NonceSize())
+	assert.Equal(aead.Seal(nil, nonce, []byte("x"), nil), unwrapped.Seal(nil, nonce, []byte("x"), nil))
+
+	rewrapped, changed, err := kr.Rewrap(wrapped)
+	assert.NoError(err)
+	assert.True(changed)
+	id, _ := WrappedKeyID(rewrapped)
+	assert.Equal("k2", id)
+	_, changed, _ = kr.Rewrap(rewrapped)
+	assert.False(changed)
+
+	resealed, changed, err := kr.Reseal(sealed)
+	assert.NoError(err)
+	assert.True(changed)
+
+	// once everything is re-wrapped, the old key can be retired
+	retired, _ := NewKeyring("k2", map[string][]byte{"k2": testKey(2)})
+	pt, err := retired.Open(resealed, nil)
+	assert.NoError(err)
+	assert.Equal([]byte("hello"), pt)
+	_, err = retired.UnwrapDataKey(wrapped)
+	assert.ErrorIs(err, ErrUnknownKey)
+	_, err = retired.Open(sealed, nil)
+	assert.ErrorIs(err, ErrUnknownKey)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	write := func(name, doc string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(doc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	k := base64.StdEncoding.EncodeToString(testKey(7))
+
+	kr, err := LoadKeyring(write("ok.json", `{"primary": "2026-10", "keys": {"2026-10": "`+k+`"}}`))
+	assert.NoError(err)
+	assert.Equal("2026-10", kr.Primary())
+
+	_, err = LoadKeyring(write("noprimary.json", `{"primary": "missing", "keys": {"2026-10": "`+k+`"}}`))
+	assert.Error(err)
+	_, err = LoadKeyring(write("short.json", `{"primary": "a", "keys": {"a": "c2hvcnQ="}}`))
+	assert.Error(err)
+	_, err = LoadKeyring(write("base64.json", `{"primary": "a", "keys": {"a": "not base64!"}}`))
+	assert.Error(err)
+}
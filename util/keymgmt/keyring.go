@@ -0,0 +1,274 @@
+package keymgmt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrUnknownKey is returned for data wrapped under a KEK which isn't in the keyring, eg one retired before its data was re-wrapped.
+	ErrUnknownKey = errors.New("data key wrapped under a key not in the keyring")
+	// ErrMalformed is returned for wrapped keys and sealed blobs which can't be parsed.
+	ErrMalformed = errors.New("malformed encrypted data")
+)
+
+// KeySize is the length of key-encryption keys and data keys, in bytes (AES-256).
+const KeySize = 32
+
+const (
+	wrapVersion = 1
+	nonceSize   = 12
+)
+
+// Keyring holds the key-encryption keys used to wrap data keys. It is safe for concurrent use.
+type Keyring struct {
+	primary string
+	keks    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw KEKs by name; new data keys are wrapped under primary.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	kr := &Keyring{primary: primary, keks: make(map[string]cipher.AEAD, len(keys))}
+	for id, k := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("key name %q must be 1-255 bytes", id)
+		}
+		if len(k) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", id, KeySize, len(k))
+		}
+		aead, err := newAEAD(k)
+		if err != nil {
+			return nil, err
+		}
+		kr.keks[id] = aead
+	}
+	return kr, nil
+}
+
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LoadKeyring reads a keyring file: the name of the primary key, and base64 encoded keys by name.
+func LoadKeyring(fname string) (*Keyring, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var kf keyringFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, fmt.Errorf("parsing keyring %s: %w", fname, err)
+	}
+	keys := make(map[string][]byte, len(kf.Keys))
+	for id, enc := range kf.Keys {
+		k, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("keyring %s: key %q: %w", fname, id, err)
+		}
+		keys[id] = k
+	}
+	kr, err := NewKeyring(kf.Primary, keys)
+	if err != nil {
+		return nil, fmt.Errorf("keyring %s: %w", fname, err)
+	}
+	return kr, nil
+}
+
+// Primary returns the name of the key new data keys are wrapped under.
+func (kr *Keyring) Primary() string {
+	return kr.primary
+}
+
+// Keys returns the names of every key in the keyring, sorted.
+func (kr *Keyring) Keys() []string {
+	ids := make([]string, 0, len(kr.keks))
+	for id := range kr.keks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NewDataKey generates a random data key, returning a cipher for it and the key wrapped under the primary KEK for storage.
+func (kr *Keyring) NewDataKey() (cipher.AEAD, []byte, error) {
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := kr.wrap(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, wrapped, nil
+}
+
+// UnwrapDataKey returns a cipher for a wrapped data key.
+func (kr *Keyring) UnwrapDataKey(wrapped []byte) (cipher.AEAD, error) {
+	dek, err := kr.unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(dek)
+}
+
+// Rewrap re-wraps a data key under the primary KEK, reporting whether it changed; keys already wrapped under the primary are returned as they are.
+func (kr *Keyring) Rewrap(wrapped []byte) ([]byte, bool, error) {
+	id, err := WrappedKeyID(wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+	if id == kr.primary {
+		return wrapped, false, nil
+	}
+	dek, err := kr.unwrap(wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := kr.wrap(dek)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// WrappedKeyID returns the name of the KEK a data key is wrapped under.
+func WrappedKeyID(wrapped []byte) (string, error) {
+	if len(wrapped) < 2 || wrapped[0] != wrapVersion || len(wrapped) < 2+int(wrapped[1]) {
+		return "", ErrMalformed
+	}
+	return string(wrapped[2 : 2+int(wrapped[1])]), nil
+}
+
+// wrapped keys are: version, name length, KEK name, nonce, then the sealed data key. The header is authenticated as additional data
+func (kr *Keyring) wrap(dek []byte) ([]byte, error) {
+	kek := kr.keks[kr.primary]
+	hdr := make([]byte, 0, 2+len(kr.primary)+nonceSize+KeySize+kek.Overhead())
+	hdr = append(hdr, wrapVersion, byte(len(kr.primary)))
+	hdr = append(hdr, kr.primary...)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(hdr, nonce...)
+	return kek.Seal(out, nonce, dek, hdr), nil
+}
+
+func (kr *Keyring) unwrap(wrapped []byte) ([]byte, error) {
+	id, err := WrappedKeyID(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	kek, ok := kr.keks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	hlen := 2 + len(id)
+	if len(wrapped) < hlen+nonceSize {
+		return nil, ErrMalformed
+	}
+	dek, err := kek.Open(nil, wrapped[hlen:hlen+nonceSize], wrapped[hlen+nonceSize:], wrapped[:hlen])
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key under %q: %w", id, err)
+	}
+	if len(dek) != KeySize {
+		return nil, ErrMalformed
+	}
+	return dek, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealed blobs are: sealMagic, the wrapped data key's length (big endian uint16) and the wrapped key, then a nonce and the ciphertext. The leading zero byte can't start a CAR file or JSON document, so sealed and plaintext files can be told apart
+var sealMagic = []byte{0x00, 'k', 'm', 0x01}
+
+// IsSealed reports whether b looks like the output of Seal.
+func IsSealed(b []byte) bool {
+	return len(b) >= len(sealMagic) && string(b[:len(sealMagic)]) == string(sealMagic)
+}
+
+// Seal encrypts plaintext under a fresh data key, which is embedded wrapped in the output. aad must be passed again to Open.
+func (kr *Keyring) Seal(plaintext, aad []byte) ([]byte, error) {
+	aead, wrapped, err := kr.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sealMagic)+2+len(wrapped)+nonceSize+len(plaintext)+aead.Overhead())
+	out = append(out, sealMagic...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, aad), nil
+}
+
+// splitSealed returns the wrapped data key and the rest (nonce and ciphertext) of a sealed blob
+func splitSealed(sealed []byte) (wrapped, rest []byte, err error) {
+	if !IsSealed(sealed) || len(sealed) < len(sealMagic)+2 {
+		return nil, nil, ErrMalformed
+	}
+	wlen := int(binary.BigEndian.Uint16(sealed[len(sealMagic):]))
+	start := len(sealMagic) + 2
+	if len(sealed) < start+wlen+nonceSize {
+		return nil, nil, ErrMalformed
+	}
+	return sealed[start : start+wlen], sealed[start+wlen:], nil
+}
+
+// Open decrypts the output of Seal.
+func (kr *Keyring) Open(sealed, aad []byte) ([]byte, error) {
+	wrapped, rest, err := splitSealed(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := kr.UnwrapDataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := aead.Open(nil, rest[:nonceSize], rest[nonceSize:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+	return pt, nil
+}
+
+// Reseal re-wraps the data key embedded in a sealed blob under the primary KEK, reporting whether it changed. The ciphertext is carried over as it is.
+func (kr *Keyring) Reseal(sealed []byte) ([]byte, bool, error) {
+	wrapped, rest, err := splitSealed(sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	nw, changed, err := kr.Rewrap(wrapped)
+	if err != nil || !changed {
+		return sealed, false, err
+	}
+	out := make([]byte, 0, len(sealMagic)+2+len(nw)+len(rest))
+	out = append(out, sealMagic...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(nw)))
+	out = append(out, nw...)
+	return append(out, rest...), true, nil
+}
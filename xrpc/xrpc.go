@@ -84,6 +84,14 @@ func (e *Error) IsThrottled() bool {
 	return e.StatusCode == http.StatusTooManyRequests
 }
 
+// ThrottledUntil returns when the rate limit which throttled the request resets, zero if the request wasn't throttled or the server didn't say
+func (e *Error) ThrottledUntil() time.Time {
+	if !e.IsThrottled() || e.Ratelimit == nil {
+		return time.Time{}
+	}
+	return e.Ratelimit.Reset
+}
+
 func errorFromHTTPResponse(resp *http.Response, err error) error {
 	r := &Error{
 		StatusCode: resp.StatusCode,
@@ -131,6 +139,11 @@ func makeParams(p map[string]any) string {
 	return params.Encode()
 }
 
+// streamDecoder is util.StreamDecoder: an output which decodes the response body as it is read
+type streamDecoder interface {
+	DecodeStream(r io.Reader) error
+}
+
 func (c *Client) Do(ctx context.Context, kind string, inpenc string, method string, params map[string]interface{}, bodyobj interface{}, out interface{}) error {
 	var body io.Reader
 	if bodyobj != nil {
@@ -216,6 +229,10 @@ func (c *Client) Do(ctx context.Context, kind string, inpenc string, method stri
 					return fmt.Errorf("reading length delimited response body (%d < %d): %w", n, resp.ContentLength, err)
 				}
 			}
+		} else if sd, ok := out.(streamDecoder); ok {
+			if err := sd.DecodeStream(resp.Body); err != nil {
+				return fmt.Errorf("decoding xrpc response: %w", err)
+			}
 		} else {
 			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 				return fmt.Errorf("decoding xrpc response: %w", err)
@@ -1,7 +1,16 @@
 package xrpc
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
 	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 )
 
 // TestMakeParams tests the makeParams function.
@@ -57,3 +66,79 @@ func TestMakeParams(t *testing.T) {
 		})
 	}
 }
+
+// heapInUse returns the live heap, after a collection
+func heapInUse() int64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.HeapAlloc)
+}
+
+// TestStreamDecodeMemory lists a hundred thousand repos in one response, checking that streaming it holds a fraction of what decoding it whole does
+func TestStreamDecodeMemory(t *testing.T) {
+	const n = 100_000
+	var bodySize atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{w: w}
+		fmt.Fprint(cw, `{"cursor": "next", "repos": [`)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				fmt.Fprint(cw, ",")
+			}
+			fmt.Fprintf(cw, `{"did": "did:plc:%024d", "head": "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm", "rev": "3kdyv3yz2ym2e", "active": true}`, i)
+		}
+		fmt.Fprint(cw, `]}`)
+		bodySize.Store(cw.n)
+	}))
+	defer srv.Close()
+	c := &Client{Host: srv.URL, Client: srv.Client()}
+	ctx := context.Background()
+
+	base := heapInUse()
+	var peak int64
+	seen := 0
+	cursor, err := lexutil.StreamQuery(ctx, c, "com.atproto.sync.listRepos", nil, "repos", func(r *comatproto.SyncListRepos_Repo) error {
+		seen++
+		if seen%(n/10) == 0 {
+			peak = max(peak, heapInUse()-base)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != n || cursor != "next" {
+		t.Fatalf("streamed %d repos with cursor %q, expected %d with cursor \"next\"", seen, cursor, n)
+	}
+
+	base = heapInUse()
+	out, err := comatproto.SyncListRepos(ctx, c, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole := heapInUse() - base
+	if len(out.Repos) != n {
+		t.Fatalf("decoded %d repos, expected %d", len(out.Repos), n)
+	}
+
+	size := bodySize.Load()
+	t.Logf("%d byte response: streaming held at most %d bytes, decoding it whole %d", size, peak, whole)
+	if peak > size/10 {
+		t.Fatalf("streaming held %d bytes of a %d byte response", peak, size)
+	}
+	if whole < size/2 {
+		t.Fatalf("expected decoding the whole response to hold most of it, held %d of %d bytes", whole, size)
+	}
+}
+
+type countingWriter struct {
+	w http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}